@@ -40,6 +40,18 @@ type DfGetTask struct {
 	//
 	Dfdaemon bool `json:"dfdaemon,omitempty"`
 
+	// the ID of the task group which the file belongs to, such as all the layers of an image.
+	// The downloads of a group share the deadline of the group, and they're listed together
+	// by the group.
+	//
+	Group string `json:"group,omitempty"`
+
+	// the unix time in milliseconds by which the downloads of the group should finish.
+	// The downloads of the group are scheduled as the high priority once the deadline is
+	// within groupUrgentWindow of supernode. It's 0 if the group has no deadline.
+	//
+	GroupDeadline int64 `json:"groupDeadline,omitempty"`
+
 	// path is used in one peer A for uploading functionality. When peer B hopes
 	// to get piece C from peer A, B must provide a URL for piece C.
 	// Then when creating a task in supernode, peer A must provide this URL in request.
@@ -58,6 +70,19 @@ type DfGetTask struct {
 	//
 	PieceSize int32 `json:"pieceSize,omitempty"`
 
+	// priority
+	Priority Priority `json:"priority,omitempty"`
+
+	// the length in bytes of the range from rangeOffset, 0 means to the end of the file.
+	//
+	RangeLength int64 `json:"rangeLength,omitempty"`
+
+	// the offset in bytes of the range of the file which the client downloads only,
+	// such as the range requested by the client of dfdaemon. Only the pieces covering
+	// the range are scheduled to the client, and the client finishes once it has them.
+	//
+	RangeOffset int64 `json:"rangeOffset,omitempty"`
+
 	// The status of Dfget download process.
 	//
 	// Enum: [WAITING RUNNING FAILED SUCCESS]
@@ -78,6 +103,10 @@ func (m *DfGetTask) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validatePriority(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateStatus(formats); err != nil {
 		res = append(res, err)
 	}
@@ -101,6 +130,22 @@ func (m *DfGetTask) validateCallSystem(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *DfGetTask) validatePriority(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Priority) { // not required
+		return nil
+	}
+
+	if err := m.Priority.Validate(formats); err != nil {
+		if ve, ok := err.(*errors.Validation); ok {
+			return ve.ValidateName("priority")
+		}
+		return err
+	}
+
+	return nil
+}
+
 var dfGetTaskTypeStatusPropEnum []interface{}
 
 func init() {
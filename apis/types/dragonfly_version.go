@@ -22,6 +22,12 @@ type DragonflyVersion struct {
 	// Build Date of Dragonfly components
 	BuildDate string `json:"BuildDate,omitempty"`
 
+	// The name of the Dragonfly component, such as supernode and dfdaemon
+	Component string `json:"Component,omitempty"`
+
+	// The optional features enabled by the configuration of the Dragonfly component
+	Features []string `json:"Features"`
+
 	// Golang runtime version
 	GoVersion string `json:"GoVersion,omitempty"`
 
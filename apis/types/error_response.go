@@ -22,6 +22,14 @@ type ErrorResponse struct {
 
 	// detailed error message
 	Message string `json:"message,omitempty"`
+
+	// the machine-readable name of this error, such as DataNotFound, InvalidValue and Timeout.
+	//
+	Reason string `json:"reason,omitempty"`
+
+	// whether the request may succeed if the client retries it later.
+	//
+	Retryable bool `json:"retryable,omitempty"`
 }
 
 // Validate validates this error response
@@ -28,6 +28,15 @@ type HeartBeatRequest struct {
 	//
 	CID string `json:"cID,omitempty"`
 
+	// the max total size in bytes of the task files cached by the uploader, 0 means unlimited
+	CacheCapacity int64 `json:"cacheCapacity,omitempty"`
+
+	// the total size in bytes of the task files cached by the uploader now
+	CacheUsed int64 `json:"cacheUsed,omitempty"`
+
+	// the number of pieces that the uploader is uploading to other peers now
+	Load int32 `json:"load,omitempty"`
+
 	// when registering, dfget will setup one uploader process.
 	// This one acts as a server for peer pulling tasks.
 	// This port is which this server listens on.
@@ -35,6 +44,26 @@ type HeartBeatRequest struct {
 	// Maximum: 65000
 	// Minimum: 15000
 	Port int32 `json:"port,omitempty"`
+
+	// the IDs of the tasks purged by the supernode whose files the uploader has deleted
+	// since the last heart beat.
+	//
+	PurgedTaskIds []string `json:"purgedTaskIDs"`
+
+	// the address ip:port of the uploader of the primary peer which this uploader is the warm standby of.
+	//
+	StandbyOf string `json:"standbyOf,omitempty"`
+
+	// the number of task files that the uploader is serving
+	TaskCount int32 `json:"taskCount,omitempty"`
+
+	// the IDs of the tasks which the uploader is seeding for the supernode
+	TaskIds []string `json:"taskIDs"`
+
+	// the total bytes of every task which the uploader has uploaded to other peers since it started,
+	// the key is the ID of task.
+	//
+	TaskUploadedBytes map[string]int64 `json:"taskUploadedBytes,omitempty"`
 }
 
 // Validate validates this heart beat request
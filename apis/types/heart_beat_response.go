@@ -6,8 +6,11 @@ package types
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"strconv"
+
 	strfmt "github.com/go-openapi/strfmt"
 
+	"github.com/go-openapi/errors"
 	"github.com/go-openapi/swag"
 )
 
@@ -19,11 +22,30 @@ type HeartBeatResponse struct {
 	//
 	NeedRegister bool `json:"needRegister,omitempty"`
 
+	// The array of taskID which have been purged from supernode. The peer should delete its files of them
+	// immediately regardless of the seeding policies, and report them by purgedTaskIDs of the next heart beat.
+	//
+	PurgeTaskIds []string `json:"purgeTaskIDs"`
+
+	// The pieces which the uploader should push to the nearly-complete peers whose downloads stall.
+	//
+	PushTasks []*PushTask `json:"pushTasks"`
+
+	// The tasks which the uploader should download to replicate their pieces to more peers,
+	// because the pieces are owned by less alive peers than the replication factor of supernode.
+	//
+	ReplicateTasks []*ReplicateTask `json:"replicateTasks"`
+
 	// The array of seed taskID which now are selected as seed for the peer. If peer have other seed file which
 	// is not included in the array, these seed file should be weed out.
 	//
 	SeedTaskIds []string `json:"seedTaskIDs"`
 
+	// The array of taskID reported by the peer which the supernode doesn't need the peer to seed any more,
+	// such as the ones have been deleted from supernode. The peer may stop seeding them.
+	//
+	StopSeedingTaskIds []string `json:"stopSeedingTaskIDs"`
+
 	// The version of supernode. If supernode restarts, version should be different, so dfdaemon could know
 	// the restart of supernode.
 	//
@@ -32,6 +54,69 @@ type HeartBeatResponse struct {
 
 // Validate validates this heart beat response
 func (m *HeartBeatResponse) Validate(formats strfmt.Registry) error {
+	var res []error
+
+	if err := m.validatePushTasks(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateReplicateTasks(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if len(res) > 0 {
+		return errors.CompositeValidationError(res...)
+	}
+	return nil
+}
+
+func (m *HeartBeatResponse) validatePushTasks(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.PushTasks) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.PushTasks); i++ {
+		if swag.IsZero(m.PushTasks[i]) { // not required
+			continue
+		}
+
+		if m.PushTasks[i] != nil {
+			if err := m.PushTasks[i].Validate(formats); err != nil {
+				if ve, ok := err.(*errors.Validation); ok {
+					return ve.ValidateName("pushTasks" + "." + strconv.Itoa(i))
+				}
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
+func (m *HeartBeatResponse) validateReplicateTasks(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.ReplicateTasks) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.ReplicateTasks); i++ {
+		if swag.IsZero(m.ReplicateTasks[i]) { // not required
+			continue
+		}
+
+		if m.ReplicateTasks[i] != nil {
+			if err := m.ReplicateTasks[i].Validate(formats); err != nil {
+				if ve, ok := err.(*errors.Validation); ok {
+					return ve.ValidateName("replicateTasks" + "." + strconv.Itoa(i))
+				}
+				return err
+			}
+		}
+
+	}
+
 	return nil
 }
 
@@ -24,11 +24,27 @@ type PeerCreateRequest struct {
 	// Format: ipv4
 	IP strfmt.IPv4 `json:"IP,omitempty"`
 
+	// Whether the uploader of the peer accepts the pieces pushed by the seeders which
+	// supernode instructs when the download of the peer stalls near the completion.
+	//
+	AcceptPush bool `json:"acceptPush,omitempty"`
+
+	// The other addresses on which the uploader of the peer can be reached, such as
+	// the IPv6 one or the ones on the other NICs. They're dialed by the other peers
+	// with the happy eyeballs racing together with the IP.
+	//
+	Addresses []string `json:"addresses"`
+
 	// host name of peer client node, as a valid RFC 1123 hostname.
 	// Min Length: 1
 	// Format: hostname
 	HostName strfmt.Hostname `json:"hostName,omitempty"`
 
+	// the labels of the peer node, such as its IDC and rack, by which
+	// the emergency brakes could be scoped.
+	//
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// when registering, dfget will setup one uploader process.
 	// This one acts as a server for peer pulling tasks.
 	// This port is which this server listens on.
@@ -37,6 +53,12 @@ type PeerCreateRequest struct {
 	// Minimum: 15000
 	Port int32 `json:"port,omitempty"`
 
+	// The names of the piece transports served by the uploader of the peer, such as http.
+	// The other peers fetch the pieces from it with one of them which they also support,
+	// and http is used if it's empty.
+	//
+	Transports []string `json:"transports"`
+
 	// version number of dfget binary.
 	Version string `json:"version,omitempty"`
 }
@@ -6,6 +6,8 @@ package types
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"encoding/json"
+
 	strfmt "github.com/go-openapi/strfmt"
 
 	"github.com/go-openapi/errors"
@@ -28,6 +30,23 @@ type PeerInfo struct {
 	// Format: ipv4
 	IP strfmt.IPv4 `json:"IP,omitempty"`
 
+	// Whether the uploader of the peer accepts the pieces pushed by the seeders which
+	// supernode instructs when the download of the peer stalls near the completion.
+	//
+	AcceptPush bool `json:"acceptPush,omitempty"`
+
+	// The other addresses on which the uploader of the peer can be reached, such as
+	// the IPv6 one or the ones on the other NICs. They're dialed by the other peers
+	// with the happy eyeballs racing together with the IP.
+	//
+	Addresses []string `json:"addresses"`
+
+	// the max total size in bytes of the task files cached by the peer, 0 means unlimited
+	CacheCapacity int64 `json:"cacheCapacity,omitempty"`
+
+	// the total size in bytes of the task files cached by the peer when it sends the last heart beat
+	CacheUsed int64 `json:"cacheUsed,omitempty"`
+
 	// the time to join the P2P network
 	// Format: date-time
 	Created strfmt.DateTime `json:"created,omitempty"`
@@ -37,6 +56,18 @@ type PeerInfo struct {
 	// Format: hostname
 	HostName strfmt.Hostname `json:"hostName,omitempty"`
 
+	// the labels of the peer node, such as its IDC and rack, by which
+	// the emergency brakes could be scoped.
+	//
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// the time when supernode receives the last heart beat of the peer
+	// Format: date-time
+	LastHeartbeat strfmt.DateTime `json:"lastHeartbeat,omitempty"`
+
+	// the number of pieces that the peer is uploading when it sends the last heart beat
+	Load int32 `json:"load,omitempty"`
+
 	// when registering, dfget will setup one uploader process.
 	// This one acts as a server for peer pulling tasks.
 	// This port is which this server listens on.
@@ -45,6 +76,28 @@ type PeerInfo struct {
 	// Minimum: 15000
 	Port int32 `json:"port,omitempty"`
 
+	// Whether the standby is promoted as the source of the pieces since no peer of its primary is alive.
+	//
+	Promoted bool `json:"promoted,omitempty"`
+
+	// The address ip:port of the uploader of the primary peer which this peer is the warm
+	// standby of. The tasks cached by the primary are replicated to the standby, which isn't
+	// scheduled as the source of the pieces while the primary is alive.
+	//
+	StandbyOf string `json:"standbyOf,omitempty"`
+
+	// The liveness state of the peer inferred from its heart beats.
+	// It's empty if the peer never sends a heart beat to supernode.
+	//
+	// Enum: [alive suspect dead]
+	State string `json:"state,omitempty"`
+
+	// The names of the piece transports served by the uploader of the peer, such as http.
+	// The other peers fetch the pieces from it with one of them which they also support,
+	// and http is used if it's empty.
+	//
+	Transports []string `json:"transports"`
+
 	// version number of dfget binary
 	Version string `json:"version,omitempty"`
 }
@@ -65,10 +118,18 @@ func (m *PeerInfo) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateLastHeartbeat(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validatePort(formats); err != nil {
 		res = append(res, err)
 	}
 
+	if err := m.validateState(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -118,6 +179,19 @@ func (m *PeerInfo) validateHostName(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *PeerInfo) validateLastHeartbeat(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.LastHeartbeat) { // not required
+		return nil
+	}
+
+	if err := validate.FormatOf("lastHeartbeat", "body", "date-time", m.LastHeartbeat.String(), formats); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (m *PeerInfo) validatePort(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.Port) { // not required
@@ -135,6 +209,52 @@ func (m *PeerInfo) validatePort(formats strfmt.Registry) error {
 	return nil
 }
 
+var peerInfoTypeStatePropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["alive","suspect","dead"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		peerInfoTypeStatePropEnum = append(peerInfoTypeStatePropEnum, v)
+	}
+}
+
+const (
+
+	// PeerInfoStateAlive captures enum value "alive"
+	PeerInfoStateAlive string = "alive"
+
+	// PeerInfoStateSuspect captures enum value "suspect"
+	PeerInfoStateSuspect string = "suspect"
+
+	// PeerInfoStateDead captures enum value "dead"
+	PeerInfoStateDead string = "dead"
+)
+
+// prop value enum
+func (m *PeerInfo) validateStateEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, peerInfoTypeStatePropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *PeerInfo) validateState(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.State) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateStateEnum("state", "body", m.State); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *PeerInfo) MarshalBinary() ([]byte, error) {
 	if m == nil {
@@ -22,6 +22,11 @@ type PieceInfo struct {
 	//
 	Path string `json:"path,omitempty"`
 
+	// The other addresses on which the uploader of the target peer can be reached,
+	// they're dialed with the happy eyeballs racing together with the peerIP.
+	//
+	PeerAddresses []string `json:"peerAddresses"`
+
 	// When dfget needs to download a piece from another peer. Supernode will return a PieceInfo
 	// that contains a peerIP. This peerIP represents the IP of this dfget's target peer.
 	//
@@ -32,6 +37,11 @@ type PieceInfo struct {
 	//
 	PeerPort int32 `json:"peerPort,omitempty"`
 
+	// The names of the piece transports served by the uploader of the target peer,
+	// by which dfget chooses the transport to fetch the piece with.
+	//
+	PeerTransports []string `json:"peerTransports"`
+
 	// the MD5 information of piece which is generated by supernode when doing CDN cache.
 	// This value will be returned to dfget in order to validate the piece's completeness.
 	//
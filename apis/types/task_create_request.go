@@ -37,6 +37,13 @@ type TaskCreateRequest struct {
 	//
 	Dfdaemon bool `json:"dfdaemon,omitempty"`
 
+	// digest of the resource to distribute, formatted as "algorithm:encoded", such as sha256:xxx.
+	// It's used instead of md5 when the resource is verified with a stronger algorithm.
+	// Supernode verifies the source file with the sha256 digests, and the other algorithms are
+	// verified by dfget only.
+	//
+	Digest string `json:"digest,omitempty"`
+
 	// This attribute represents the length of resource, dfdaemon or dfget catches and calculates
 	// this parameter from the headers of request URL. If fileLength is vaild, the supernode need
 	// not get the length of resource by accessing the rawURL.
@@ -51,6 +58,18 @@ type TaskCreateRequest struct {
 	//
 	Filter []string `json:"filter"`
 
+	// the ID of the task group which the file belongs to, such as all the layers of an image.
+	// The downloads of a group share the deadline of the group, and they're listed together
+	// by the group.
+	//
+	Group string `json:"group,omitempty"`
+
+	// the unix time in milliseconds by which the downloads of the group should finish.
+	// The downloads of the group are scheduled as the high priority once the deadline is
+	// within groupUrgentWindow of supernode. It's 0 if the group has no deadline.
+	//
+	GroupDeadline int64 `json:"groupDeadline,omitempty"`
+
 	// extra HTTP headers sent to the rawURL.
 	// This field is carried with the request to supernode.
 	// Supernode will extract these HTTP headers, and set them in HTTP downloading requests
@@ -83,6 +102,25 @@ type TaskCreateRequest struct {
 	//
 	PeerID string `json:"peerID,omitempty"`
 
+	// The piece size chosen by the client in bytes, which must be between 256KB and 15MB.
+	// It's only used when the task is created, and the piece size is computed by supernode
+	// with the file length if it's 0.
+	//
+	PieceSize int32 `json:"pieceSize,omitempty"`
+
+	// priority
+	Priority Priority `json:"priority,omitempty"`
+
+	// the length in bytes of the range from rangeOffset, 0 means to the end of the file.
+	//
+	RangeLength int64 `json:"rangeLength,omitempty"`
+
+	// the offset in bytes of the range of the file which the client downloads only,
+	// such as the range requested by the client of dfdaemon. Only the pieces covering
+	// the range are scheduled to the client, and the client finishes once it has them.
+	//
+	RangeOffset int64 `json:"rangeOffset,omitempty"`
+
 	// The is the resource's URL which user uses dfget to download. The location of URL can be anywhere, LAN or WAN.
 	// For image distribution, this is image layer's URL in image registry.
 	// The resource url is provided by command line parameter.
@@ -111,6 +149,10 @@ func (m *TaskCreateRequest) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validatePriority(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -130,6 +172,22 @@ func (m *TaskCreateRequest) validateCallSystem(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *TaskCreateRequest) validatePriority(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Priority) { // not required
+		return nil
+	}
+
+	if err := m.Priority.Validate(formats); err != nil {
+		if ve, ok := err.(*errors.Validation); ok {
+			return ve.ValidateName("priority")
+		}
+		return err
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *TaskCreateRequest) MarshalBinary() ([]byte, error) {
 	if m == nil {
@@ -31,6 +31,11 @@ type TaskCreateResponse struct {
 	// 2. Otherwise, it equals to the smaller value between totalSize/100MB + 2 MB and 15MB.
 	//
 	PieceSize int32 `json:"pieceSize,omitempty"`
+
+	// the headers of the response of the source server kept with the task,
+	// which are replayed by dfdaemon on the responses served from the P2P network.
+	//
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
 }
 
 // Validate validates this task create response
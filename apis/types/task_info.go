@@ -31,18 +31,37 @@ type TaskInfo struct {
 	// Enum: [WAITING RUNNING FAILED SUCCESS SOURCE_ERROR]
 	CdnStatus string `json:"cdnStatus,omitempty"`
 
+	// digest of the resource to distribute, formatted as "algorithm:encoded", such as sha256:xxx.
+	// It's used instead of md5 when the resource is verified with a stronger algorithm.
+	// Supernode verifies the source file with the sha256 digests, and the other algorithms are
+	// verified by dfget only.
+	//
+	Digest string `json:"digest,omitempty"`
+
 	// The length of the file dfget requests to download in bytes
 	// which including the header and the trailer of each piece.
 	//
 	FileLength int64 `json:"fileLength,omitempty"`
 
+	// the filter of the request which creates the task, the queries in it are removed
+	// from the rawURL to generate the taskURL.
+	//
+	Filter []string `json:"filter"`
+
 	// extra HTTP headers sent to the rawURL.
 	// This field is carried with the request to supernode.
 	// Supernode will extract these HTTP headers, and set them in HTTP downloading requests
 	// from source server as user's wish.
+	// The values of the sensitive headers such as Authorization and Cookie are redacted.
 	//
 	Headers map[string]string `json:"headers,omitempty"`
 
+	// the sha256 digest of the sorted headers of the request which creates the task.
+	// The taskID is generated with the taskURL, md5 or identifier and the Range header,
+	// so the tasks of the same URL with different headers hashes may be different tasks.
+	//
+	HeadersHash string `json:"headersHash,omitempty"`
+
 	// The length of the source file in bytes.
 	//
 	HTTPFileLength int64 `json:"httpFileLength,omitempty"`
@@ -64,12 +83,22 @@ type TaskInfo struct {
 	// The size of pieces which is calculated as per the following strategy
 	// 1. If file's total size is less than 200MB, then the piece size is 4MB by default.
 	// 2. Otherwise, it equals to the smaller value between totalSize/100MB + 2 MB and 15MB.
+	// The piece size chosen by the client is used instead if it's specified when the task is created.
 	//
 	PieceSize int32 `json:"pieceSize,omitempty"`
 
+	// where the piece size comes from, it's computed by supernode with the file length
+	// or chosen by the client which creates the task.
+	//
+	// Enum: [computed client]
+	PieceSizeSource string `json:"pieceSizeSource,omitempty"`
+
 	// piece total
 	PieceTotal int32 `json:"pieceTotal,omitempty"`
 
+	// priority
+	Priority Priority `json:"priority,omitempty"`
+
 	// The is the resource's URL which user uses dfget to download. The location of URL can be anywhere, LAN or WAN.
 	// For image distribution, this is image layer's URL in image registry.
 	// The resource url is provided by command line parameter.
@@ -82,6 +111,20 @@ type TaskInfo struct {
 	//
 	RealMd5 string `json:"realMd5,omitempty"`
 
+	// when supernode finishes downloading file/image from the source location,
+	// the sha256 digest of the source file will be calculated as the value of the realSha256.
+	// It's published to the peers downloading the task to verify the file,
+	// which is useful especially when the md5 is not provided by the callers.
+	//
+	RealSha256 string `json:"realSha256,omitempty"`
+
+	// the headers of the response of the source server which are selected by passThroughHeaders
+	// of supernode when the task is registered, such as Content-Type and Docker-Content-Digest.
+	// They're returned to dfget at the registration, and replayed by dfdaemon on the responses
+	// served from the P2P network.
+	//
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+
 	// taskURL is generated from rawURL. rawURL may contains some queries or parameter, dfget will filter some queries via
 	// --filter parameter of dfget. The usage of it is that different rawURL may generate the same taskID.
 	//
@@ -96,6 +139,14 @@ func (m *TaskInfo) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validatePieceSizeSource(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validatePriority(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -154,6 +205,65 @@ func (m *TaskInfo) validateCdnStatus(formats strfmt.Registry) error {
 	return nil
 }
 
+var taskInfoTypePieceSizeSourcePropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["computed","client"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskInfoTypePieceSizeSourcePropEnum = append(taskInfoTypePieceSizeSourcePropEnum, v)
+	}
+}
+
+const (
+
+	// TaskInfoPieceSizeSourceComputed captures enum value "computed"
+	TaskInfoPieceSizeSourceComputed string = "computed"
+
+	// TaskInfoPieceSizeSourceClient captures enum value "client"
+	TaskInfoPieceSizeSourceClient string = "client"
+)
+
+// prop value enum
+func (m *TaskInfo) validatePieceSizeSourceEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskInfoTypePieceSizeSourcePropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskInfo) validatePieceSizeSource(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.PieceSizeSource) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validatePieceSizeSourceEnum("pieceSizeSource", "body", m.PieceSizeSource); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *TaskInfo) validatePriority(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Priority) { // not required
+		return nil
+	}
+
+	if err := m.Priority.Validate(formats); err != nil {
+		if ve, ok := err.(*errors.Validation); ok {
+			return ve.ValidateName("priority")
+		}
+		return err
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *TaskInfo) MarshalBinary() ([]byte, error) {
 	if m == nil {
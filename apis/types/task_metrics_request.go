@@ -6,6 +6,8 @@ package types
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"strconv"
+
 	strfmt "github.com/go-openapi/strfmt"
 
 	"github.com/go-openapi/errors"
@@ -20,6 +22,16 @@ type TaskMetricsRequest struct {
 	// IP address which peer client carries
 	IP string `json:"IP,omitempty"`
 
+	// The seconds since the start of the download when dfget decided to download
+	// the file from the source, which is only set when the download backs to the source.
+	//
+	BacksourceAfter float64 `json:"backsourceAfter,omitempty"`
+
+	// The seconds spent downloading the file from the source, which is only set
+	// when the download backs to the source.
+	//
+	BacksourceDuration float64 `json:"backsourceDuration,omitempty"`
+
 	// when registering, dfget will setup one uploader process.
 	// This one acts as a server for peer pulling tasks.
 	// This port is which this server listens on.
@@ -44,6 +56,14 @@ type TaskMetricsRequest struct {
 	//
 	Duration float64 `json:"duration,omitempty"`
 
+	// The events which dfget ran into during the download, such as the schedule waits,
+	// the retries and the errors. It's sent only when the upload of the event log is enabled.
+	//
+	Events []*TaskEvent `json:"events"`
+
+	// The number of the events dropped since the event log is full.
+	EventsDropped int32 `json:"eventsDropped,omitempty"`
+
 	// The length of the file dfget requests to download in bytes.
 	FileLength int64 `json:"fileLength,omitempty"`
 
@@ -70,6 +90,10 @@ func (m *TaskMetricsRequest) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateEvents(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validatePort(formats); err != nil {
 		res = append(res, err)
 	}
@@ -93,6 +117,31 @@ func (m *TaskMetricsRequest) validateCallSystem(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *TaskMetricsRequest) validateEvents(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Events) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.Events); i++ {
+		if swag.IsZero(m.Events[i]) { // not required
+			continue
+		}
+
+		if m.Events[i] != nil {
+			if err := m.Events[i].Validate(formats); err != nil {
+				if ve, ok := err.(*errors.Validation); ok {
+					return ve.ValidateName("events" + "." + strconv.Itoa(i))
+				}
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
 func (m *TaskMetricsRequest) validatePort(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.Port) { // not required
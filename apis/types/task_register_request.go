@@ -21,6 +21,17 @@ type TaskRegisterRequest struct {
 	// Format: ipv4
 	IP strfmt.IPv4 `json:"IP,omitempty"`
 
+	// Whether the uploader of the peer accepts the pieces pushed by the seeders which
+	// supernode instructs when the download of the peer stalls near the completion.
+	//
+	AcceptPush bool `json:"acceptPush,omitempty"`
+
+	// The other addresses on which the uploader of the peer can be reached, such as
+	// the IPv6 one or the ones on the other NICs. They're dialed by the other peers
+	// with the happy eyeballs racing together with the IP.
+	//
+	Addresses []string `json:"addresses"`
+
 	// This attribute represents the node as a seed node for the taskURL.
 	//
 	AsSeed bool `json:"asSeed,omitempty"`
@@ -39,18 +50,47 @@ type TaskRegisterRequest struct {
 	// Min Length: 1
 	CallSystem string `json:"callSystem,omitempty"`
 
+	// The unix time in milliseconds when the client sends the request. Supernode compares it
+	// with its own clock to detect the clock skew of the peer.
+	//
+	ClientTime int64 `json:"clientTime,omitempty"`
+
 	// tells whether it is a call from dfdaemon. dfdaemon is a long running
 	// process which works for container engines. It translates the image
 	// pulling request into raw requests into those dfget recognizes.
 	//
 	Dfdaemon bool `json:"dfdaemon,omitempty"`
 
+	// digest of the resource to distribute, formatted as "algorithm:encoded", such as sha256:xxx.
+	// It's used instead of md5 when the resource is verified with a stronger algorithm.
+	// Supernode verifies the source file with the sha256 digests, and the other algorithms are
+	// verified by dfget only.
+	//
+	Digest string `json:"digest,omitempty"`
+
 	// This attribute represents the length of resource, dfdaemon or dfget catches and calculates
 	// this parameter from the headers of request URL. If fileLength is vaild, the supernode need
 	// not get the length of resource by accessing the rawURL.
 	//
 	FileLength int64 `json:"fileLength,omitempty"`
 
+	// the filter which dfget has applied to the rawURL to generate the taskURL,
+	// it's recorded in the task for troubleshooting.
+	//
+	Filter []string `json:"filter"`
+
+	// the ID of the task group which the file belongs to, such as all the layers of an image.
+	// The downloads of a group share the deadline of the group, and they're listed together
+	// by the group.
+	//
+	Group string `json:"group,omitempty"`
+
+	// the unix time in milliseconds by which the downloads of the group should finish.
+	// The downloads of the group are scheduled as the high priority once the deadline is
+	// within groupUrgentWindow of supernode. It's 0 if the group has no deadline.
+	//
+	GroupDeadline int64 `json:"groupDeadline,omitempty"`
+
 	// extra HTTP headers sent to the rawURL.
 	// This field is carried with the request to supernode.
 	// Supernode will extract these HTTP headers, and set them in HTTP downloading requests
@@ -74,6 +114,11 @@ type TaskRegisterRequest struct {
 	//
 	Insecure bool `json:"insecure,omitempty"`
 
+	// the labels of the peer node, such as its IDC and rack, by which
+	// the emergency brakes could be scoped.
+	//
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// md5 checksum for the resource to distribute. dfget catches this parameter from dfget's CLI
 	// and passes it to supernode. When supernode finishes downloading file/image from the source location,
 	// it will validate the source file with this md5 value to check whether this is a valid file.
@@ -86,6 +131,11 @@ type TaskRegisterRequest struct {
 	//
 	Path string `json:"path,omitempty"`
 
+	// The piece size chosen by the client in bytes, which must be between 256KB and 15MB.
+	// The piece size is computed by supernode with the file length if it's 0.
+	//
+	PieceSize int32 `json:"pieceSize,omitempty"`
+
 	// when registering, dfget will setup one uploader process.
 	// This one acts as a server for peer pulling tasks.
 	// This port is which this server listens on.
@@ -94,6 +144,19 @@ type TaskRegisterRequest struct {
 	// Minimum: 15000
 	Port int32 `json:"port,omitempty"`
 
+	// priority
+	Priority Priority `json:"priority,omitempty"`
+
+	// the length in bytes of the range from rangeOffset, 0 means to the end of the file.
+	//
+	RangeLength int64 `json:"rangeLength,omitempty"`
+
+	// the offset in bytes of the range of the file which the client downloads only,
+	// such as the range requested by the client of dfdaemon. Only the pieces covering
+	// the range are scheduled to the client, and the client finishes once it has them.
+	//
+	RangeOffset int64 `json:"rangeOffset,omitempty"`
+
 	// The is the resource's URL which user uses dfget to download. The location of URL can be anywhere, LAN or WAN.
 	// For image distribution, this is image layer's URL in image registry.
 	// The resource url is provided by command line parameter.
@@ -117,6 +180,12 @@ type TaskRegisterRequest struct {
 	//
 	TaskURL string `json:"taskURL,omitempty"`
 
+	// The names of the piece transports served by the uploader of the peer, such as http.
+	// The other peers fetch the pieces from it with one of them which they also support,
+	// and http is used if it's empty.
+	//
+	Transports []string `json:"transports"`
+
 	// version number of dfget binary.
 	Version string `json:"version,omitempty"`
 }
@@ -141,6 +210,10 @@ func (m *TaskRegisterRequest) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validatePriority(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateRootCAs(formats); err != nil {
 		res = append(res, err)
 	}
@@ -207,6 +280,22 @@ func (m *TaskRegisterRequest) validatePort(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *TaskRegisterRequest) validatePriority(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Priority) { // not required
+		return nil
+	}
+
+	if err := m.Priority.Validate(formats); err != nil {
+		if ve, ok := err.(*errors.Validation); ok {
+			return ve.ValidateName("priority")
+		}
+		return err
+	}
+
+	return nil
+}
+
 func (m *TaskRegisterRequest) validateRootCAs(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.RootCAs) { // not required
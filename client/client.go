@@ -24,6 +24,9 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/peertoken"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
 )
 
 var (
@@ -42,6 +45,10 @@ type APIClient struct {
 	HTTPCli *http.Client
 	// version of the server talks to
 	version string
+	// headers are set to every request, such as the tokens
+	headers http.Header
+	// retry is the policy of retrying the failed idempotent requests
+	retry retry.Policy
 }
 
 // TLSConfig contains information of TLS which users can specify.
@@ -81,6 +88,7 @@ func NewAPIClient(host string, tls TLSConfig) (CommonAPIClient, error) {
 		baseURL: basePath,
 		HTTPCli: httpCli,
 		version: version,
+		retry:   retry.DefaultPolicy(),
 	}, nil
 }
 
@@ -140,3 +148,30 @@ func (client *APIClient) GetAPIPath(path string, query url.Values) string {
 func (client *APIClient) UpdateClientVersion(v string) {
 	client.version = v
 }
+
+// SetRetryPolicy sets the policy of retrying the failed idempotent requests,
+// such as GET and DELETE. A request is retried if it fails to reach supernode,
+// or supernode responds that it's unavailable or the error is retryable.
+// The zero policy disables the retries.
+func (client *APIClient) SetRetryPolicy(p retry.Policy) {
+	client.retry = p
+}
+
+// SetAuthToken sets the bearer token sent in the Authorization header of every
+// request, which is checked by the authenticating proxy in front of supernode.
+func (client *APIClient) SetAuthToken(token string) {
+	client.setHeader("Authorization", "Bearer "+token)
+}
+
+// SetPeerToken sets the peer token issued by supernode peer-token, which is sent
+// with every request and authenticates the requests to the peer APIs.
+func (client *APIClient) SetPeerToken(token string) {
+	client.setHeader(peertoken.Header, token)
+}
+
+func (client *APIClient) setHeader(key, value string) {
+	if client.headers == nil {
+		client.headers = http.Header{}
+	}
+	client.headers.Set(key, value)
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+
+	dto "github.com/prometheus/client_model/go"
 )
 
 // CommonAPIClient defines common methods of api client.
@@ -27,12 +29,16 @@ type CommonAPIClient interface {
 	PreheatAPIClient
 	PeerAPIClient
 	TaskAPIClient
+	PurgeAPIClient
+	SystemAPIClient
 }
 
 // PreheatAPIClient defines methods of Container client.
 type PreheatAPIClient interface {
 	PreheatCreate(ctx context.Context, request *types.PreheatCreateRequest) (preheatCreateResponse *types.PreheatCreateResponse, err error)
 	PreheatInfo(ctx context.Context, id string) (preheatInfoResponse *types.PreheatInfo, err error)
+	PreheatList(ctx context.Context, id string) ([]*types.PreheatInfo, error)
+	PreheatDelete(ctx context.Context, id string) error
 }
 
 // PeerAPIClient defines methods of peer related client.
@@ -48,5 +54,20 @@ type TaskAPIClient interface {
 	TaskCreate(ctx context.Context, request *types.TaskCreateRequest) (taskCreateResponse *types.TaskCreateResponse, err error)
 	TaskDelete(ctx context.Context, id string) error
 	TaskInfo(ctx context.Context, id string) (taskInfoResponse *types.TaskInfo, err error)
+	TaskList(ctx context.Context, opts *TaskListOptions) (tasks []*types.TaskInfo, total int, err error)
 	TaskUpdate(ctx context.Context, id string, config *types.TaskUpdateRequest) error
+	TaskGroupInfo(ctx context.Context, id string) (*types.TaskGroupInfo, error)
+}
+
+// PurgeAPIClient defines methods of purging the tasks from supernode and the peers.
+type PurgeAPIClient interface {
+	TaskPurge(ctx context.Context, id string) (*types.TaskPurge, error)
+	TaskPurgeInfo(ctx context.Context, id string) (*types.TaskPurge, error)
+	PurgeList(ctx context.Context) ([]*types.TaskPurge, error)
+}
+
+// SystemAPIClient defines methods of the status of supernode.
+type SystemAPIClient interface {
+	Ping(ctx context.Context) (string, error)
+	MetricsSnapshot(ctx context.Context) (map[string]*dto.MetricFamily, error)
 }
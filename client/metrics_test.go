@@ -0,0 +1,53 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	body := `# HELP dragonfly_supernode_peers Current status of peers
+# TYPE dragonfly_supernode_peers gauge
+dragonfly_supernode_peers{peer="192.168.10.11"} 2
+dragonfly_supernode_peers{peer="192.168.10.12"} 1
+`
+	client := &APIClient{
+		HTTPCli: newMockClient(func(req *http.Request) (*http.Response, error) {
+			assert.Equal("/metrics", req.URL.Path)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	}
+
+	families, err := client.MetricsSnapshot(context.Background())
+	assert.Nil(err)
+	peers := families["dragonfly_supernode_peers"]
+	if assert.NotNil(peers) {
+		assert.Len(peers.Metric, 2)
+		assert.Equal(float64(2), peers.Metric[0].GetGauge().GetValue())
+	}
+}
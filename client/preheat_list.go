@@ -31,7 +31,7 @@ func (client *APIClient) PreheatList(ctx context.Context, id string) ([]*types.P
 
 	preheats := []*types.PreheatInfo{}
 
-	err = decodeBody(preheats, resp.Body)
+	err = decodeBody(&preheats, resp.Body)
 	ensureCloseReader(resp)
 
 	return preheats, err
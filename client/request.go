@@ -28,12 +28,16 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
 )
 
 // RespError defines the response error.
 type RespError struct {
-	code int
-	msg  string
+	code      int
+	msg       string
+	reason    string
+	retryable bool
 }
 
 // Error implements the error interface.
@@ -46,10 +50,34 @@ func (e RespError) Code() int {
 	return e.code
 }
 
+// Reason returns the machine-readable name of the error
+// which is parsed from the error body returned by supernode.
+func (e RespError) Reason() string {
+	return e.reason
+}
+
+// Retryable returns whether the request may succeed if it's retried later.
+func (e RespError) Retryable() bool {
+	return e.retryable
+}
+
+// newRespError creates a RespError and parses the reason
+// if the body is an ErrorResponse.
+func newRespError(code int, data []byte) RespError {
+	respErr := RespError{code: code, msg: string(data)}
+	errResp := &types.ErrorResponse{}
+	if err := json.Unmarshal(data, errResp); err == nil {
+		respErr.reason = errResp.Reason
+		respErr.retryable = errResp.Retryable
+	}
+	return respErr
+}
+
 // Response wraps the http.Response and other states.
 type Response struct {
 	StatusCode int
 	Status     string
+	Header     http.Header
 	Body       io.ReadCloser
 }
 
@@ -132,6 +160,9 @@ func (client *APIClient) newRequest(method, path string, query url.Values, body
 		return nil, err
 	}
 
+	for k, v := range client.headers {
+		req.Header[k] = v
+	}
 	for k, v := range header {
 		req.Header[k] = v
 	}
@@ -139,7 +170,58 @@ func (client *APIClient) newRequest(method, path string, query url.Values, body
 	return req, err
 }
 
+// sendRequest sends the request, and retries it by the retry policy of the client
+// if it's idempotent and the failure is retryable.
 func (client *APIClient) sendRequest(ctx context.Context, method, path string, query url.Values, body io.Reader, headers map[string][]string) (*Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := client.doRequest(ctx, method, path, query, body, headers)
+		if err == nil || attempt >= client.retry.MaxAttempts || !isRetryable(method, err) {
+			return resp, err
+		}
+		if body != nil {
+			seeker, ok := body.(io.Seeker)
+			if !ok {
+				return nil, err
+			}
+			if _, serr := seeker.Seek(0, io.SeekStart); serr != nil {
+				return nil, err
+			}
+		}
+
+		timer := time.NewTimer(client.retry.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable returns whether the request failed with err may succeed if it's
+// sent again. Only the idempotent requests are retried.
+func isRetryable(method string, err error) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	respErr, ok := err.(RespError)
+	if !ok {
+		// supernode isn't reached
+		return true
+	}
+	switch respErr.Code() {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return respErr.Retryable()
+}
+
+func (client *APIClient) doRequest(ctx context.Context, method, path string, query url.Values, body io.Reader, headers map[string][]string) (*Response, error) {
 	req, err := client.newRequest(method, path, query, body, headers)
 	if err != nil {
 		return nil, err
@@ -159,12 +241,13 @@ func (client *APIClient) sendRequest(ctx context.Context, method, path string, q
 			return nil, err
 		}
 
-		return nil, RespError{code: resp.StatusCode, msg: string(data)}
+		return nil, newRespError(resp.StatusCode, data)
 	}
 
 	return &Response{
 		StatusCode: resp.StatusCode,
 		Status:     resp.Status,
+		Header:     resp.Header,
 		Body:       resp.Body,
 	}, nil
 }
@@ -0,0 +1,78 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/peertoken"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendRequestRetry(t *testing.T) {
+	assert := assert.New(t)
+	var attempts int
+	codes := []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("Bearer foo", r.Header.Get("Authorization"))
+		assert.Equal("bar", r.Header.Get(peertoken.Header))
+		w.WriteHeader(codes[attempts])
+		attempts++
+	}))
+	defer server.Close()
+
+	cli, err := NewAPIClient(server.URL, TLSConfig{})
+	assert.Nil(err)
+	client := cli.(*APIClient)
+	client.SetAuthToken("foo")
+	client.SetPeerToken("bar")
+	client.SetRetryPolicy(retry.Policy{MaxAttempts: 3, BackoffBase: time.Millisecond})
+
+	assert.Nil(client.PreheatDelete(context.Background(), "id"))
+	assert.Equal(3, attempts)
+
+	// the non-idempotent requests are never retried
+	attempts = 0
+	_, err = client.TaskPurge(context.Background(), "id")
+	assert.Equal(http.StatusServiceUnavailable, err.(RespError).Code())
+	assert.Equal(1, attempts)
+
+	// neither are the errors which aren't retryable
+	attempts = 0
+	codes = []int{http.StatusNotFound}
+	_, err = client.TaskInfo(context.Background(), "id")
+	assert.Equal(http.StatusNotFound, err.(RespError).Code())
+	assert.Equal(1, attempts)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(isRetryable(http.MethodGet, context.Canceled))
+	assert.True(isRetryable(http.MethodGet, &net.OpError{Op: "dial"}))
+	assert.False(isRetryable(http.MethodPost, &net.OpError{Op: "dial"}))
+	assert.True(isRetryable(http.MethodDelete, RespError{code: http.StatusTooManyRequests}))
+	assert.True(isRetryable(http.MethodPut, RespError{code: http.StatusInternalServerError, retryable: true}))
+	assert.False(isRetryable(http.MethodPut, RespError{code: http.StatusInternalServerError}))
+	assert.False(isRetryable(http.MethodGet, RespError{code: http.StatusBadRequest}))
+}
@@ -22,7 +22,7 @@ import (
 
 // TaskDelete deletes the specified task in supernode.
 func (client *APIClient) TaskDelete(ctx context.Context, id string) error {
-	resp, err := client.delete(ctx, "/tasks/"+id, nil, nil)
+	resp, err := client.delete(ctx, "/api/v1/tasks/"+id, nil, nil)
 	if err != nil {
 		return err
 	}
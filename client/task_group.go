@@ -0,0 +1,38 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// TaskGroupInfo gets the downloads of the task group registered in supernode,
+// which tells whether they've all finished.
+func (client *APIClient) TaskGroupInfo(ctx context.Context, id string) (*types.TaskGroupInfo, error) {
+	resp, err := client.get(ctx, "/api/v1/groups/"+id, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &types.TaskGroupInfo{}
+	err = decodeBody(group, resp.Body)
+	ensureCloseReader(resp)
+
+	return group, err
+}
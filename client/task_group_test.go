@@ -0,0 +1,60 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskGroupInfo(t *testing.T) {
+	assert := assert.New(t)
+	client := &APIClient{
+		HTTPCli: newMockClient(func(req *http.Request) (*http.Response, error) {
+			assert.Equal("/api/v1/groups/image", req.URL.Path)
+			b, err := json.Marshal(&types.TaskGroupInfo{
+				ID:        "image",
+				Completed: true,
+				Downloads: []*types.DfGetTask{{CID: "a", Status: types.DfGetTaskStatusSUCCESS}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+
+	group, err := client.TaskGroupInfo(context.Background(), "image")
+	assert.Nil(err)
+	assert.True(group.Completed)
+	assert.Len(group.Downloads, 1)
+
+	client.HTTPCli = newMockClient(errorMockResponse(http.StatusNotFound, "task group image not found"))
+	_, err = client.TaskGroupInfo(context.Background(), "image")
+	assert.NotNil(err)
+}
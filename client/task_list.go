@@ -0,0 +1,109 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// TaskListOptions selects the tasks listed by TaskList.
+// The zero values of the fields select all tasks.
+type TaskListOptions struct {
+	// URL is the regular expression matching the URLs of the tasks.
+	URL string
+	// Status is the CDN statuses of the tasks, such as SUCCESS.
+	Status []string
+	// MinAge and MaxAge bound the time since the tasks are created.
+	MinAge time.Duration
+	MaxAge time.Duration
+	// MinSize and MaxSize bound the lengths of the files of the tasks in bytes.
+	MinSize int64
+	MaxSize int64
+
+	// SortKey is one of createTime, accessTime and fileLength,
+	// and SortDirect is one of ASC and DESC.
+	SortKey    string
+	SortDirect string
+	// PageNum starts from 0, and all tasks are returned if PageSize is 0.
+	PageNum  int
+	PageSize int
+}
+
+func (opts *TaskListOptions) query() url.Values {
+	query := url.Values{}
+	if opts == nil {
+		return query
+	}
+	if opts.URL != "" {
+		query.Set("url", opts.URL)
+	}
+	for _, status := range opts.Status {
+		query.Add("status", status)
+	}
+	durations := map[string]time.Duration{"minAge": opts.MinAge, "maxAge": opts.MaxAge}
+	for name, d := range durations {
+		if d > 0 {
+			query.Set(name, d.String())
+		}
+	}
+	sizes := map[string]int64{"minSize": opts.MinSize, "maxSize": opts.MaxSize}
+	for name, size := range sizes {
+		if size > 0 {
+			query.Set(name, strconv.FormatInt(size, 10))
+		}
+	}
+	if opts.SortKey != "" {
+		query.Set("sortKey", opts.SortKey)
+	}
+	if opts.SortDirect != "" {
+		query.Set("sortDirect", opts.SortDirect)
+	}
+	if opts.PageSize > 0 {
+		query.Set("pageNum", strconv.Itoa(opts.PageNum))
+		query.Set("pageSize", strconv.Itoa(opts.PageSize))
+	}
+	return query
+}
+
+// TaskList lists the page of the tasks selected by opts in supernode,
+// and returns the total number of the selected tasks.
+func (client *APIClient) TaskList(ctx context.Context, opts *TaskListOptions) (tasks []*types.TaskInfo, total int, err error) {
+	resp, err := client.get(ctx, "/api/v1/tasks", opts.query(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tasks = []*types.TaskInfo{}
+	err = decodeBody(&tasks, resp.Body)
+	ensureCloseReader(resp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total = len(tasks)
+	if v := resp.Header.Get("X-Total-Count"); v != "" {
+		if total, err = strconv.Atoi(v); err != nil {
+			return nil, 0, err
+		}
+	}
+	return tasks, total, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskList(t *testing.T) {
+	assert := assert.New(t)
+	client := &APIClient{
+		HTTPCli: newMockClient(func(req *http.Request) (*http.Response, error) {
+			assert.Equal("/api/v1/tasks", req.URL.Path)
+			query := req.URL.Query()
+			assert.Equal("^http://a.com/", query.Get("url"))
+			assert.Equal([]string{"SUCCESS", "RUNNING"}, query["status"])
+			assert.Equal("1h0m0s", query.Get("minAge"))
+			assert.Equal("", query.Get("maxAge"))
+			assert.Equal("1024", query.Get("minSize"))
+			assert.Equal("fileLength", query.Get("sortKey"))
+			assert.Equal("1", query.Get("pageNum"))
+			assert.Equal("2", query.Get("pageSize"))
+
+			b, err := json.Marshal([]*types.TaskInfo{{ID: "a"}, {ID: "b"}})
+			if err != nil {
+				return nil, err
+			}
+			header := http.Header{}
+			header.Set("X-Total-Count", "5")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+
+	tasks, total, err := client.TaskList(context.Background(), &TaskListOptions{
+		URL:      "^http://a.com/",
+		Status:   []string{types.TaskInfoCdnStatusSUCCESS, types.TaskInfoCdnStatusRUNNING},
+		MinAge:   time.Hour,
+		MinSize:  1024,
+		SortKey:  "fileLength",
+		PageNum:  1,
+		PageSize: 2,
+	})
+	assert.Nil(err)
+	assert.Equal(5, total)
+	assert.Len(tasks, 2)
+	assert.Equal("b", tasks[1].ID)
+}
+
+func TestTaskListError(t *testing.T) {
+	client := &APIClient{
+		HTTPCli: newMockClient(errorMockResponse(http.StatusBadRequest, "invalid status")),
+	}
+	_, _, err := client.TaskList(context.Background(), nil)
+	assert.Contains(t, err.Error(), "invalid status")
+}
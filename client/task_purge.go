@@ -0,0 +1,66 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// TaskPurge purges the task from supernode and all peers holding it.
+// The peers delete their files of the task asynchronously, which is tracked by TaskPurgeInfo.
+func (client *APIClient) TaskPurge(ctx context.Context, id string) (*types.TaskPurge, error) {
+	resp, err := client.post(ctx, "/api/v1/tasks/"+id+"/purge", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	purge := &types.TaskPurge{}
+	err = decodeBody(purge, resp.Body)
+	ensureCloseReader(resp)
+
+	return purge, err
+}
+
+// TaskPurgeInfo gets the progress of the purge of the task.
+func (client *APIClient) TaskPurgeInfo(ctx context.Context, id string) (*types.TaskPurge, error) {
+	resp, err := client.get(ctx, "/api/v1/tasks/"+id+"/purge", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	purge := &types.TaskPurge{}
+	err = decodeBody(purge, resp.Body)
+	ensureCloseReader(resp)
+
+	return purge, err
+}
+
+// PurgeList lists the purges of all tasks tracked by supernode.
+func (client *APIClient) PurgeList(ctx context.Context) ([]*types.TaskPurge, error) {
+	resp, err := client.get(ctx, "/api/v1/purges", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	purges := []*types.TaskPurge{}
+	err = decodeBody(&purges, resp.Body)
+	ensureCloseReader(resp)
+
+	return purges, err
+}
@@ -17,10 +17,8 @@
 package app
 
 import (
-	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
 	"runtime"
@@ -35,6 +33,8 @@ import (
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+	"github.com/dragonflyoss/Dragonfly/pkg/sourceprotocol"
 	statutil "github.com/dragonflyoss/Dragonfly/pkg/stat"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 
@@ -98,19 +98,33 @@ func initDfdaemon(cfg *config.Properties) error {
 		cfg.LocalIP = getLocalIP(cfg.SuperNodes)
 	}
 
+	if err := registerSourceProtocols(dfgetcfg.NewConfig().ConfigFiles); err != nil {
+		return errors.Wrap(err, "register the source protocols")
+	}
+
 	go cleanLocalRepo(cfg.DFRepo)
 
-	if !cfg.StreamMode {
-		dfgetVersion, err := exec.Command(cfg.DFPath, "version").CombinedOutput()
-		if err != nil {
-			return errors.Wrap(err, "get dfget version")
-		}
-		logrus.Infof("use %s from %s", bytes.TrimSpace(dfgetVersion), cfg.DFPath)
-	}
+	// the downloads of dfget are run in the process of dfdaemon,
+	// and their messages on console are discarded since they're logged too
+	printer.SetPrinter(nil)
 
 	return nil
 }
 
+// registerSourceProtocols registers the source protocols configured in the properties of dfget,
+// since the downloads run in the process of dfdaemon read their files from the source stations
+// by the round trippers of the process. The properties are loaded from the first of the files
+// which is loaded successfully, the same as by the downloads.
+func registerSourceProtocols(files []string) error {
+	properties := dfgetcfg.NewProperties()
+	for _, file := range files {
+		if err := properties.Load(file); err == nil {
+			break
+		}
+	}
+	return sourceprotocol.Register(properties.SourceProtocols)
+}
+
 // initLogger initializes the global logrus logger.
 func initLogger(cfg config.Properties) error {
 	if cfg.WorkHome == "" {
@@ -124,7 +138,7 @@ func initLogger(cfg config.Properties) error {
 		cfg.LogConfig.Path = filepath.Join(cfg.WorkHome, "logs", "dfdaemon.log")
 	}
 	opts := []dflog.Option{
-		dflog.WithLogFile(cfg.LogConfig.Path, cfg.LogConfig.MaxSize, cfg.LogConfig.MaxBackups),
+		dflog.WithLogConfig(cfg.LogConfig),
 		dflog.WithSign(fmt.Sprintf("%d", os.Getpid())),
 		dflog.WithDebug(cfg.Verbose),
 	}
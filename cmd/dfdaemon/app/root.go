@@ -27,8 +27,12 @@ import (
 	"github.com/dragonflyoss/Dragonfly/dfdaemon"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/config"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/transport"
 	"github.com/dragonflyoss/Dragonfly/pkg/cmd"
+	"github.com/dragonflyoss/Dragonfly/pkg/diagnostics"
 	dferr "github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rate"
 
@@ -65,16 +69,23 @@ var rootCmd = &cobra.Command{
 			return errors.Wrap(err, "init dfdaemon")
 		}
 
-		cfgJSON, _ := json.Marshal(cfg)
+		logged := *cfg
+		logged.DfgetFlags = httputils.RedactHeaderArgs(cfg.DfgetFlags)
+		cfgJSON, _ := json.Marshal(&logged)
 		logrus.Infof("using config: %s", cfgJSON)
 
 		s, err := dfdaemon.NewFromConfig(*cfg)
 		if err != nil {
 			return errors.Wrap(err, "create dfdaemon from config")
 		}
-		// if stream mode, launch peer server in dfdaemon progress
-		if cfg.StreamMode {
-			go dfdaemon.LaunchPeerServer(*cfg)
+		if _, err := diagnostics.Serve("dfdaemon", cfg.AdminPort); err != nil {
+			return errors.Wrap(err, "start diagnostics server")
+		}
+		diagnostics.RegisterStatus("downloads", transport.WriteDownloadsStatus)
+		diagnostics.WatchStatusSignals("dfdaemon")
+		// launch peer server in dfdaemon process, which is shared by the downloads
+		if err := dfdaemon.LaunchPeerServer(*cfg); err != nil {
+			return errors.Wrap(err, "launch peer server")
 		}
 		return s.Start()
 	},
@@ -98,9 +109,19 @@ func init() {
 	rf.String("hostIp", "127.0.0.1", "dfdaemon host ip, default: 127.0.0.1")
 	rf.Uint("port", 65001, "dfdaemon will listen the port")
 	rf.Uint("peerPort", 0, "peerserver will listen the port")
+	rf.StringSlice("advertiseIPs", nil, "other IP addresses on which peerserver can be reached, such as the IPv6 one or the ones on the other NICs, they're dialed by other peers with the happy eyeballs racing")
+	rf.String("p2pIP", "", "IP address on the dedicated network of the p2p transfers, peerserver listens on it and the pieces are downloaded from other peers with it as the source address")
 	rf.Bool("streamMode", false, "dfdaemon will run in stream mode")
+	rf.String("noDiskMemoryLimit", "64MB", "maximal size of the pieces held in memory for a download of the proxy rules with no_disk, in format of G(B)/M(B)/K(B)/B, 0 means no limit")
+	rf.String("onClientDisconnect", config.ClientDisconnectContinue, "policy of the download when its client disconnects before it finishes, one of continue, cancel and deprioritize")
 	rf.String("certpem", "", "cert.pem file path")
 	rf.String("keypem", "", "key.pem file path")
+	rf.Int("adminPort", 0, "the port on the loopback address to serve the diagnostics endpoints such as pprof, 0 means disabled")
+	rf.Float64("accessLogSampleRate", 0, "rate in [0, 1] of the requests which are written to the access log, 0 means disabled")
+	rf.Duration("dnsCacheTTL", 0, "the time for which the addresses of the resolved hostnames are cached, 0 means disabled")
+	rf.Duration("dnsNegativeCacheTTL", 0, "the time for which the failures of resolving the hostnames are cached, 0 means disabled")
+	rf.Int("log-max-size", 0, "maximum size in megabytes of the log file before it gets rotated, default 40")
+	rf.Int("log-max-age", 0, "maximum number of days to retain the rotated log files, 0 means that they are not removed due to age")
 
 	rf.String("registry", "https://index.docker.io", "registry mirror url, which will override the registry mirror settings in the config file if presented")
 
@@ -108,6 +129,7 @@ func init() {
 	rf.String("localrepo", "", "temp output dir of dfdaemon")
 	rf.String("workHome", filepath.Join(os.Getenv("HOME"), ".small-dragonfly"), "the work home directory of dfdaemon.")
 	rf.String("dfpath", defaultDfgetPath, "dfget path")
+	rf.MarkDeprecated("dfpath", "dfget is run in the process of dfdaemon")
 	rf.Var(netutils.NetLimit(), "ratelimit", "net speed limit")
 	rf.StringSlice("node", nil, "specify the addresses(host:port) of supernodes that will be passed to dfget.")
 
@@ -115,9 +137,11 @@ func init() {
 
 	// add sub commands
 	rootCmd.AddCommand(NewGenCACommand())
+	rootCmd.AddCommand(NewInstallServiceCommand())
+	rootCmd.AddCommand(NewUninstallServiceCommand())
 	rootCmd.AddCommand(cmd.NewGenDocCommand("dfdaemon"))
 	rootCmd.AddCommand(cmd.NewVersionCommand("dfdaemon"))
-	rootCmd.AddCommand(cmd.NewConfigCommand("dfdaemon", getDefaultConfig))
+	rootCmd.AddCommand(cmd.NewConfigCommand("dfdaemon", getDefaultConfig, validateConfigFile))
 }
 
 // bindRootFlags binds flags on rootCmd to the given viper instance.
@@ -128,8 +152,19 @@ func bindRootFlags(v *viper.Viper) error {
 	if err := v.BindPFlag("registry_mirror.remote", rootCmd.Flag("registry")); err != nil {
 		return err
 	}
+	if err := v.BindPFlag("logConfig.maxSize", rootCmd.Flag("log-max-size")); err != nil {
+		return err
+	}
+	if err := v.BindPFlag("logConfig.maxAge", rootCmd.Flag("log-max-age")); err != nil {
+		return err
+	}
 	v.SetEnvPrefix(DFDaemonEnvPrefix)
 	v.AutomaticEnv()
+	// the admin token isn't a flag to keep it out of the command line,
+	// and it's read from the environment if it isn't in the config file
+	if err := v.BindEnv("adminToken"); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -175,6 +210,27 @@ func getDefaultConfig() (interface{}, error) {
 	return getConfigFromViper(rootCmd, viper.GetViper())
 }
 
+// validateConfigFile validates the config file of dfdaemon. The unknown fields
+// are detected by the strict yaml decoding, and the values are then decoded onto
+// the defaults of the flags the same way as starting dfdaemon before being validated.
+func validateConfigFile(path string) error {
+	if err := fileutils.LoadYamlStrict(path, &config.Properties{}); err != nil {
+		return err
+	}
+
+	v := viper.New()
+	if err := bindRootFlags(v); err != nil {
+		return err
+	}
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	_, err := getConfigFromViper(rootCmd, v)
+	return err
+}
+
 // getConfigFromViper returns dfdaemon config from the given viper instance
 func getConfigFromViper(cmd *cobra.Command, v *viper.Viper) (*config.Properties, error) {
 	// override supernodes in config file if --node is specified in cli.
@@ -193,6 +249,7 @@ func getConfigFromViper(cmd *cobra.Command, v *viper.Viper) (*config.Properties,
 			reflect.TypeOf(config.CertPool{}),
 			reflect.TypeOf(time.Second),
 			reflect.TypeOf(rate.B),
+			reflect.TypeOf(fileutils.B),
 		)
 	}); err != nil {
 		return nil, errors.Wrap(err, "unmarshal yaml")
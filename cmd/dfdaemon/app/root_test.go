@@ -20,11 +20,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
@@ -118,6 +125,28 @@ func (ts *rootTestSuite) TestNodeFlag() {
 	}
 }
 
+func (ts *rootTestSuite) TestNoDiskConfig() {
+	r := ts.Require()
+	fs := afero.NewMemMapFs()
+
+	configName := "dfdaemon-nodisk.yml"
+	file, err := fs.Create(configName)
+	r.Nil(err)
+	file.WriteString("noDiskMemoryLimit: 16MB\nproxies:\n- regx: blobs/sha256.*\n  no_disk: true")
+	file.Close()
+
+	v := viper.New()
+	v.SetFs(fs)
+	rootCmd.Flags().Set("config", configName)
+	r.Nil(bindRootFlags(v))
+	r.Nil(readConfigFile(v, rootCmd))
+	cfg, err := getConfigFromViper(rootCmd, v)
+	r.Nil(err)
+	r.Equal(16*fileutils.MB, cfg.NoDiskMemoryLimit)
+	r.Len(cfg.Proxies, 1)
+	r.True(cfg.Proxies[0].NoDisk)
+}
+
 func generateFakeFilename(fs afero.Fs) string {
 	for i := 0; i < 100; i++ {
 		d := fmt.Sprintf("/dftest-%d-%d", time.Now().UnixNano(), rand.Int())
@@ -210,6 +239,54 @@ func (ts *rootTestSuite) TestDecodeWithYAML() {
 	r.NotNil(cfg.RegistryMirror.Certs.CertPool)
 }
 
+func (ts *rootTestSuite) TestValidateConfigFile() {
+	r := ts.Require()
+	dir, err := ioutil.TempDir("", "dfdaemon-validate-")
+	r.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for content, valid := range map[string]bool{
+		"port: 65001":                      true,
+		"port: 65001\nunknownField: 1":     false,
+		"port: 65001\nadminPort: 65001":    false,
+		"port: 65001\nlocalrepo: relative": false,
+	} {
+		file := filepath.Join(dir, "dfdaemon.yml")
+		r.Nil(ioutil.WriteFile(file, []byte(content), 0644))
+		err := validateConfigFile(file)
+		r.Equal(valid, err == nil, "%s: %v", content, err)
+	}
+	r.Nil(validateConfigFile("../../../docs/config/dfdaemon_config_template.yml"))
+}
+
+func (ts *rootTestSuite) TestRegisterSourceProtocols() {
+	r := ts.Require()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("user.name") != "dragonfly" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"FileStatus":{"length":0,"modificationTime":0,"type":"FILE"}}`))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	dir, err := ioutil.TempDir("", "dfdaemon-source-protocols-")
+	r.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dfget.yml")
+	r.Nil(ioutil.WriteFile(file, []byte("sourceProtocols:\n  hdfs:\n    webPort: "+port+"\n    user: dragonfly\n"), 0644))
+
+	// the config of hdfs is loaded from the first file which exists
+	r.Nil(registerSourceProtocols([]string{filepath.Join(dir, "notexist.yml"), file}))
+	tr := &http.Transport{}
+	httputils.RegisterProtocolOnTransport(tr)
+	resp, err := (&http.Client{Transport: tr}).Head("hdfs://127.0.0.1:8020/dir/file")
+	r.Nil(err)
+	resp.Body.Close()
+	r.Equal(http.StatusOK, resp.StatusCode)
+}
+
 func TestRootCommand(t *testing.T) {
 	suite.Run(t, &rootTestSuite{})
 }
@@ -0,0 +1,259 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
+	"github.com/dragonflyoss/Dragonfly/pkg/systemd"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// systemctl runs the systemctl command with the given args,
+// it's replaced in the tests.
+var systemctl = func(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "systemctl %s: %s", strings.Join(args, " "), bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// ServiceCommand is used to implement 'install-service' and 'uninstall-service' commands.
+type ServiceCommand struct {
+	cmd *cobra.Command
+
+	// name is the name of the units without the suffix
+	name string
+	// unitDir is the directory which the unit files are installed to
+	unitDir string
+	// dryRun is a flag to print the units instead of installing them
+	dryRun bool
+	// noStart is a flag to only enable the units without starting them
+	noStart bool
+
+	// configPath is the path of the configuration file passed to dfdaemon
+	configPath string
+	// user is the user which dfdaemon runs as
+	user string
+	// workHome is the work home of dfdaemon, which is writable to the service
+	workHome string
+	// rwPaths are the other paths writable to the service, such as the local repo
+	rwPaths []string
+	// watchdog is the timeout of the watchdog of systemd
+	watchdog time.Duration
+	// socket are the addresses the socket unit listens on
+	socket []string
+}
+
+// NewInstallServiceCommand returns cobra.Command for "install-service" command
+func NewInstallServiceCommand() *cobra.Command {
+	s := &ServiceCommand{}
+	s.cmd = &cobra.Command{
+		Use:   "install-service [flags] [-- dfdaemon flags]",
+		Short: "install dfdaemon as a systemd service",
+		Long: "install dfdaemon as a systemd service, the args after '--' are passed to dfdaemon. " +
+			"If --socket is specified, a socket unit is installed too, and dfdaemon is started by systemd on the first connection to the proxy port.",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return s.runInstall(args)
+		},
+	}
+
+	s.addCommonFlags()
+	flagSet := s.cmd.Flags()
+	flagSet.BoolVar(&s.dryRun, "dry-run", false, "print the units instead of installing them")
+	flagSet.BoolVar(&s.noStart, "no-start", false, "only enable the units without starting them")
+	flagSet.StringVar(&s.configPath, "config", constant.DefaultConfigPath, "the path of dfdaemon's configuration file")
+	flagSet.StringVar(&s.user, "user", "", "the user which dfdaemon runs as, empty means root")
+	flagSet.StringVar(&s.workHome, "workHome", filepath.Join(os.Getenv("HOME"), ".small-dragonfly"), "the work home directory of dfdaemon, which is writable to the service")
+	flagSet.StringSliceVar(&s.rwPaths, "rw-path", nil, "other paths writable to the service, such as the local repo out of the work home")
+	flagSet.DurationVar(&s.watchdog, "watchdog", 30*time.Second, "the timeout of the watchdog of systemd, before which dfdaemon must notify that it's alive, 0 means disabled")
+	flagSet.StringSliceVar(&s.socket, "socket", nil, "the addresses of the proxy port which systemd listens on and activates dfdaemon with, such as 127.0.0.1:65001")
+	return s.cmd
+}
+
+// NewUninstallServiceCommand returns cobra.Command for "uninstall-service" command
+func NewUninstallServiceCommand() *cobra.Command {
+	s := &ServiceCommand{}
+	s.cmd = &cobra.Command{
+		Use:           "uninstall-service",
+		Short:         "stop and remove the systemd service of dfdaemon",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return s.runUninstall()
+		},
+	}
+
+	s.addCommonFlags()
+	return s.cmd
+}
+
+// addCommonFlags adds the flags shared by the commands.
+func (s *ServiceCommand) addCommonFlags() {
+	flagSet := s.cmd.Flags()
+	flagSet.StringVar(&s.name, "name", "dfdaemon", "the name of the units")
+	flagSet.StringVar(&s.unitDir, "unit-dir", "/etc/systemd/system", "the directory of the unit files")
+}
+
+func (s *ServiceCommand) servicePath() string {
+	return filepath.Join(s.unitDir, s.name+".service")
+}
+
+func (s *ServiceCommand) socketPath() string {
+	return filepath.Join(s.unitDir, s.name+".socket")
+}
+
+// validate validates the provided options.
+func (s *ServiceCommand) validate() error {
+	if s.name == "" || strings.ContainsRune(s.name, '/') {
+		return fmt.Errorf("invalid unit name %q", s.name)
+	}
+	if !filepath.IsAbs(s.unitDir) {
+		return fmt.Errorf("unit directory %s is not absolute", s.unitDir)
+	}
+	for _, p := range append([]string{s.configPath, s.workHome}, s.rwPaths...) {
+		if p != "" && !filepath.IsAbs(p) {
+			return fmt.Errorf("path %s is not absolute", p)
+		}
+	}
+	return nil
+}
+
+// units renders the unit files, keyed by their paths.
+func (s *ServiceCommand) units(args []string) (map[string][]byte, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "get the path of dfdaemon")
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return nil, errors.Wrap(err, "get the path of dfdaemon")
+	}
+
+	service := &systemd.ServiceUnit{
+		Description: "Dragonfly dfdaemon, the proxy of p2p image distribution",
+		ExecStart:   append([]string{self, "--config", s.configPath}, args...),
+		User:        s.user,
+		WatchdogSec: s.watchdog,
+	}
+	if s.workHome != "" {
+		service.ReadWritePaths = append(service.ReadWritePaths, s.workHome)
+	}
+	service.ReadWritePaths = append(service.ReadWritePaths, s.rwPaths...)
+
+	units := make(map[string][]byte)
+	if len(s.socket) > 0 {
+		socket := &systemd.SocketUnit{
+			Description:  "Dragonfly dfdaemon proxy socket",
+			ListenStream: s.socket,
+			Service:      s.name + ".service",
+		}
+		buf := &bytes.Buffer{}
+		if err := socket.Render(buf); err != nil {
+			return nil, errors.Wrap(err, "render socket unit")
+		}
+		units[s.socketPath()] = buf.Bytes()
+		service.Socket = s.name + ".socket"
+	}
+	buf := &bytes.Buffer{}
+	if err := service.Render(buf); err != nil {
+		return nil, errors.Wrap(err, "render service unit")
+	}
+	units[s.servicePath()] = buf.Bytes()
+	return units, nil
+}
+
+func (s *ServiceCommand) runInstall(args []string) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	units, err := s.units(args)
+	if err != nil {
+		return err
+	}
+	paths := []string{s.servicePath()}
+	if _, ok := units[s.socketPath()]; ok {
+		paths = append([]string{s.socketPath()}, paths...)
+	}
+
+	if s.dryRun {
+		return writeUnits(s.cmd.OutOrStdout(), paths, units)
+	}
+
+	for _, p := range paths {
+		if err := ioutil.WriteFile(p, units[p], 0644); err != nil {
+			return errors.Wrapf(err, "write unit file %s", p)
+		}
+		fmt.Fprintf(s.cmd.OutOrStdout(), "installed %s\n", p)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	// the socket is enabled instead of the service if any, so that
+	// the service is started on demand by the socket
+	enable := []string{"enable", filepath.Base(paths[0])}
+	if !s.noStart {
+		enable = append(enable, "--now")
+	}
+	return systemctl(enable...)
+}
+
+func (s *ServiceCommand) runUninstall() error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	for _, p := range []string{s.socketPath(), s.servicePath()} {
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		if err := systemctl("disable", "--now", filepath.Base(p)); err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil {
+			return errors.Wrapf(err, "remove unit file %s", p)
+		}
+		fmt.Fprintf(s.cmd.OutOrStdout(), "removed %s\n", p)
+	}
+	return systemctl("daemon-reload")
+}
+
+// writeUnits writes the units to w in order of the paths, headed by their paths.
+func writeUnits(w io.Writer, paths []string, units map[string][]byte) error {
+	for i, p := range paths {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if _, err := fmt.Fprintf(w, "# %s\n%s", p, units[p]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
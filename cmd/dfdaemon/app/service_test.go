@@ -0,0 +1,131 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+)
+
+type serviceTestSuite struct {
+	suite.Suite
+	unitDir string
+	calls   []string
+
+	systemctl func(args ...string) error
+}
+
+func (ts *serviceTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "dfdaemon-serviceTestSuite-")
+	ts.Require().Nil(err)
+	ts.unitDir = dir
+	ts.calls = nil
+	ts.systemctl = systemctl
+	systemctl = func(args ...string) error {
+		ts.calls = append(ts.calls, strings.Join(args, " "))
+		return nil
+	}
+}
+
+func (ts *serviceTestSuite) TearDownTest() {
+	os.RemoveAll(ts.unitDir)
+	systemctl = ts.systemctl
+}
+
+func (ts *serviceTestSuite) run(cmd func() *cobra.Command, args ...string) string {
+	out := &bytes.Buffer{}
+	c := cmd()
+	c.SetOutput(out)
+	c.SetArgs(append([]string{"--unit-dir", ts.unitDir}, args...))
+	ts.Require().Nil(c.Execute())
+	return out.String()
+}
+
+func (ts *serviceTestSuite) TestInstallAndUninstall() {
+	r := ts.Require()
+
+	ts.run(NewInstallServiceCommand, "--socket", "127.0.0.1:65001", "--rw-path", "/data/dfdaemon", "--", "--verbose")
+	r.Equal([]string{"daemon-reload", "enable dfdaemon.socket --now"}, ts.calls)
+
+	service, err := ioutil.ReadFile(filepath.Join(ts.unitDir, "dfdaemon.service"))
+	r.Nil(err)
+	r.Contains(string(service), " --config /etc/dragonfly/dfdaemon.yml --verbose\n")
+	r.Contains(string(service), "\nReadWritePaths="+filepath.Join(os.Getenv("HOME"), ".small-dragonfly")+" /data/dfdaemon\n")
+	r.Contains(string(service), "\nWatchdogSec=30\n")
+	r.Contains(string(service), "\nRequires=dfdaemon.socket\n")
+	socket, err := ioutil.ReadFile(filepath.Join(ts.unitDir, "dfdaemon.socket"))
+	r.Nil(err)
+	r.Contains(string(socket), "\nListenStream=127.0.0.1:65001\n")
+
+	ts.calls = nil
+	ts.run(NewUninstallServiceCommand)
+	r.Equal([]string{"disable --now dfdaemon.socket", "disable --now dfdaemon.service", "daemon-reload"}, ts.calls)
+	files, err := ioutil.ReadDir(ts.unitDir)
+	r.Nil(err)
+	r.Empty(files)
+}
+
+func (ts *serviceTestSuite) TestInstallWithoutSocket() {
+	r := ts.Require()
+
+	ts.run(NewInstallServiceCommand, "--no-start", "--watchdog", "0", "--name", "dfdaemon-test")
+	r.Equal([]string{"daemon-reload", "enable dfdaemon-test.service"}, ts.calls)
+	service, err := ioutil.ReadFile(filepath.Join(ts.unitDir, "dfdaemon-test.service"))
+	r.Nil(err)
+	r.NotContains(string(service), "WatchdogSec")
+	r.NotContains(string(service), "Requires=")
+	_, err = os.Stat(filepath.Join(ts.unitDir, "dfdaemon-test.socket"))
+	r.True(os.IsNotExist(err))
+}
+
+func (ts *serviceTestSuite) TestDryRun() {
+	r := ts.Require()
+
+	out := ts.run(NewInstallServiceCommand, "--dry-run", "--socket", "65001")
+	r.Empty(ts.calls)
+	r.True(strings.HasPrefix(out, "# "+filepath.Join(ts.unitDir, "dfdaemon.socket")+"\n"))
+	r.Contains(out, "\n# "+filepath.Join(ts.unitDir, "dfdaemon.service")+"\n")
+	files, err := ioutil.ReadDir(ts.unitDir)
+	r.Nil(err)
+	r.Empty(files)
+}
+
+func (ts *serviceTestSuite) TestValidate() {
+	r := ts.Require()
+
+	c := NewInstallServiceCommand()
+	c.SetOutput(ioutil.Discard)
+	c.SetArgs([]string{"--unit-dir", "relative"})
+	r.NotNil(c.Execute())
+
+	c = NewInstallServiceCommand()
+	c.SetOutput(ioutil.Discard)
+	c.SetArgs([]string{"--unit-dir", ts.unitDir, "--config", "dfdaemon.yml"})
+	r.NotNil(c.Execute())
+	r.Empty(ts.calls)
+}
+
+func TestServiceCommand(t *testing.T) {
+	suite.Run(t, &serviceTestSuite{})
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/uploader"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var cacheDescription = `Export the task files served by the local peer server into a portable archive,
+or import an archive into the cache directory of the work home, so that golden images
+and air-gapped sites could pre-populate the peers. The imported task files are reported
+to the supernodes, and then seeded, when the peer server starts next time.
+The task files could also be verified and repaired in place.`
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Export, import or verify the task files cached by the peer server",
+	Long:  cacheDescription,
+}
+
+var (
+	cacheFile string
+
+	verifyOpts  = &uploader.VerifyCacheOptions{Concurrency: 4}
+	verifyRate  rate.Rate
+	verifyNodes []string
+)
+
+var cacheExportCmd = &cobra.Command{
+	Use:           "export",
+	Short:         "Export the task files served by the local peer server into an archive",
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := initProperties(); err != nil {
+			return err
+		}
+
+		f, err := os.Create(cacheFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create cache archive")
+		}
+		count, err := uploader.ExportCache(cfg, f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(cacheFile)
+			return err
+		}
+		printer.Printf("export %d task files to %s", count, cacheFile)
+		return nil
+	},
+}
+
+var cacheImportCmd = &cobra.Command{
+	Use:           "import",
+	Short:         "Import the task files from an archive into the cache directory",
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := initProperties(); err != nil {
+			return err
+		}
+
+		f, err := os.Open(cacheFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open cache archive")
+		}
+		defer f.Close()
+
+		dir := filepath.Join(cfg.WorkHome, config.CacheDirName)
+		count, err := uploader.ImportCache(f, dir)
+		if err != nil {
+			return err
+		}
+		printer.Printf("import %d task files into %s", count, dir)
+		return nil
+	},
+}
+
+var cacheVerifyDescription = `Re-read the task files served by the local peer server, or the ones of the given
+task IDs, and verify them against the piece indexes stored next to them, or else against
+their md5s. With --repair, the pieces of the corrupt task files which don't match the piece
+md5s published by the supernode are re-fetched from its CDN and overwritten in place.
+It fails if any task file is still corrupt.`
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:           "verify [taskID...]",
+	Short:         "Verify the task files served by the local peer server",
+	Long:          cacheVerifyDescription,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := initProperties(); err != nil {
+			return err
+		}
+
+		verifyOpts.TaskIDs = args
+		verifyOpts.Rate = int64(verifyRate)
+		verifyOpts.Nodes = cfg.Nodes
+		if len(verifyNodes) > 0 {
+			nodes, err := config.ParseNodesSlice(verifyNodes)
+			if err != nil {
+				return err
+			}
+			verifyOpts.Nodes = config.NodeWeightSlice2StringSlice(nodes)
+		}
+		if len(verifyOpts.Nodes) == 0 {
+			verifyOpts.Nodes = config.NodeWeightSlice2StringSlice(config.GetDefaultSupernodesValue())
+		}
+
+		results, err := uploader.VerifyCache(cfg, verifyOpts)
+		if err != nil {
+			return err
+		}
+		var corrupt, repaired, skipped int
+		for _, r := range results {
+			switch {
+			case r.Skipped:
+				skipped++
+			case r.Repaired:
+				repaired++
+				printer.Printf("task %s at %s is corrupt and repaired, %d pieces are re-fetched: %v", r.TaskID, r.Path, len(r.BadPieces), r.Err)
+			case r.Corrupt():
+				corrupt++
+				printer.Printf("task %s at %s is corrupt: %v", r.TaskID, r.Path, r.Err)
+				if len(r.BadPieces) > 0 {
+					printer.Printf("  bad pieces: %v", r.BadPieces)
+				}
+				if r.RepairErr != nil {
+					printer.Printf("  failed to repair: %v", r.RepairErr)
+				}
+			}
+		}
+		printer.Printf("verify %d task files: %d corrupt, %d repaired, %d skipped",
+			len(results), corrupt, repaired, skipped)
+		if corrupt > 0 {
+			return fmt.Errorf("%d task files are corrupt", corrupt)
+		}
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.PersistentFlags().StringVar(&cfg.WorkHome, "home", cfg.WorkHome,
+		"the work home directory of dfget")
+	cacheExportCmd.Flags().StringVarP(&cacheFile, "file", "f", "", "the path of the cache archive to write")
+	cacheExportCmd.MarkFlagRequired("file")
+	cacheImportCmd.Flags().StringVarP(&cacheFile, "file", "f", "", "the path of the cache archive to read")
+	cacheImportCmd.MarkFlagRequired("file")
+	cacheVerifyCmd.Flags().IntVar(&verifyOpts.Concurrency, "concurrency", verifyOpts.Concurrency,
+		"the number of the task files verified in parallel")
+	cacheVerifyCmd.Flags().Var(&verifyRate, "rate",
+		"the max rate of reading the task files in total, such as 20M, it's unlimited if it's 0")
+	cacheVerifyCmd.Flags().BoolVar(&verifyOpts.Repair, "repair", false,
+		"re-fetch the corrupt pieces from the supernode and overwrite them in place")
+	cacheVerifyCmd.Flags().StringSliceVar(&verifyNodes, "node", nil,
+		"the supernodes which the corrupt pieces are re-fetched from, the ones in the config file are used by default")
+
+	cacheCmd.AddCommand(cacheExportCmd, cacheImportCmd, cacheVerifyCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/cgroup"
+
+	"github.com/sirupsen/logrus"
+)
+
+// joinCgroup moves the process into the cgroup created for the download if Cgroup
+// is configured, and returns the function which removes the cgroup after downloading.
+// The download goes on without the cgroup if it fails to be created or joined,
+// such as when dfget isn't privileged.
+func joinCgroup(cfg *config.Config) (leave func()) {
+	leave = func() {}
+	if cfg.Cgroup == nil {
+		return
+	}
+
+	paths := []string{cfg.WorkHome, filepath.Dir(cfg.Output)}
+	if cfg.WorkDir != "" {
+		paths = append(paths, cfg.WorkDir)
+	}
+	for _, dir := range cfg.DataDirs {
+		paths = append(paths, dir.Path)
+	}
+	g, err := cgroup.Create(cfg.Cgroup.ParentOrDefault(), "dfget-"+cfg.Sign, cfg.Cgroup.Limits(paths...))
+	if err != nil {
+		logrus.Warnf("failed to create the cgroup of the download, go on without it: %v", err)
+		return
+	}
+	if err := g.Join(); err != nil {
+		logrus.Warnf("failed to join the cgroup %s, go on without it: %v", g.Path, err)
+		if err := g.Remove(); err != nil {
+			logrus.Warnf("failed to remove the cgroup %s: %v", g.Path, err)
+		}
+		return
+	}
+	logrus.Infof("join the cgroup %s for the download", g.Path)
+	cfg.RV.Cgroup = g
+
+	return func() {
+		cfg.RV.Cgroup = nil
+		if err := g.Remove(); err != nil {
+			logrus.Warnf("failed to remove the cgroup %s: %v", g.Path, err)
+		}
+	}
+}
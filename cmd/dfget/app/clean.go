@@ -0,0 +1,97 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+
+	"github.com/spf13/cobra"
+)
+
+var cleanDescription = `Remove the orphaned temp files left by the crashed dfget processes,
+and report the reclaimed space. The temp files are identified by their names, which contain
+the pid of the dfget process that created them, so the ones of the running processes are never removed.
+The data directories of the work home are always cleaned, and the target directories
+of the downloads could be specified by '--dir'.`
+
+var cleanFlags struct {
+	dirs   []string
+	age    time.Duration
+	dryRun bool
+}
+
+var cleanCmd = &cobra.Command{
+	Use:           "clean",
+	Short:         "Remove the orphaned temp files left by the crashed dfget processes",
+	Long:          cleanDescription,
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := initProperties(); err != nil {
+			return err
+		}
+
+		var (
+			count int
+			bytes int64
+		)
+		scavenge := func(dir string, withTaskFiles bool) {
+			result, err := helper.ScavengeOrphans(dir, withTaskFiles, cleanFlags.age, cleanFlags.dryRun)
+			if err != nil {
+				printer.Printf("failed to clean %s: %v", dir, err)
+				return
+			}
+			for _, f := range result.Files {
+				printer.Printf("remove %s", f)
+			}
+			count += len(result.Files)
+			bytes += result.Bytes
+		}
+
+		scavenge(cfg.RV.SystemDataDir, true)
+		for _, dir := range cfg.DataDirs {
+			scavenge(dir.Path, true)
+		}
+		for _, dir := range cleanFlags.dirs {
+			scavenge(dir, false)
+		}
+
+		if cleanFlags.dryRun {
+			printer.Printf("found %d orphaned files, %d bytes could be reclaimed", count, bytes)
+		} else {
+			printer.Printf("removed %d orphaned files, %d bytes reclaimed", count, bytes)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flagSet := cleanCmd.Flags()
+	flagSet.StringVar(&cfg.WorkHome, "home", cfg.WorkHome, "the work home directory of dfget")
+	flagSet.StringSliceVar(&cleanFlags.dirs, "dir", nil,
+		"the target directories of the downloads to clean besides the data directories")
+	flagSet.DurationVar(&cleanFlags.age, "age", config.DefaultOrphanFileAge,
+		"only remove the orphaned files which are not modified in this duration")
+	flagSet.BoolVar(&cleanFlags.dryRun, "dry-run", false, "only report the orphaned files without removing them")
+
+	rootCmd.AddCommand(cleanCmd)
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/cmd"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+)
+
+func init() {
+	rootCmd.AddCommand(cmd.NewConfigCommand("dfget", getDefaultConfig, validateConfigFile))
+}
+
+// getDefaultConfig returns the default properties of dfget.
+func getDefaultConfig() (interface{}, error) {
+	return config.NewProperties(), nil
+}
+
+// validateConfigFile validates the property file of dfget. The unknown fields of
+// the yaml files are detected by the strict yaml decoding, while the ini files
+// only contain the supernodes.
+func validateConfigFile(path string) error {
+	p := config.NewProperties()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := fileutils.LoadYamlStrict(path, p); err != nil {
+			return err
+		}
+	default:
+		if err := p.Load(path); err != nil {
+			return err
+		}
+	}
+	return p.Validate()
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"os"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/diagnostics"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var debugDumpDescription = `Collect the runtime diagnostics, such as the goroutine dump, the heap profile
+and the expvar variables, from the admin port of dfget server, dfdaemon or supernode,
+and write them into a gzipped tar archive as a support bundle.
+The admin port is specified by '--admin-port' of dfget server, 'adminPort' of dfdaemon
+or 'adminPort' of supernode, which listens on the loopback address.
+The status of the active tasks is also written into the log file of dfget, dfget server
+and dfdaemon when they receive SIGQUIT or SIGUSR1, even if the admin port is disabled.`
+
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Debug the running Dragonfly components",
+}
+
+var (
+	debugAddr       string
+	debugFile       string
+	debugCPUSeconds int
+)
+
+var debugDumpCmd = &cobra.Command{
+	Use:           "dump",
+	Short:         "Collect the runtime diagnostics from an admin port into a support bundle",
+	Long:          debugDumpDescription,
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Create(debugFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create support bundle")
+		}
+		collected, err := diagnostics.Dump(f, debugAddr, debugCPUSeconds)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(debugFile)
+			return err
+		}
+		printer.Printf("collect %d items from %s into %s", len(collected), debugAddr, debugFile)
+		return nil
+	},
+}
+
+func init() {
+	flagSet := debugDumpCmd.Flags()
+	flagSet.StringVar(&debugAddr, "addr", "", "the admin address(host:port) to collect the diagnostics from")
+	flagSet.StringVarP(&debugFile, "file", "f", "dragonfly-debug.tar.gz", "the path of the support bundle to write")
+	flagSet.IntVar(&debugCPUSeconds, "cpu-seconds", 0, "the seconds to collect the CPU profile, 0 means not to collect it")
+	debugDumpCmd.MarkFlagRequired("addr")
+
+	debugCmd.AddCommand(debugDumpCmd)
+	rootCmd.AddCommand(debugCmd)
+}
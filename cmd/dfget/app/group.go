@@ -0,0 +1,108 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/core/group"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var groupDescription = `Download a group of the related files together, such as all the layers of an image,
+which are listed in a file by the lines of "url output". Every file is downloaded by a dfget
+process registered to supernode with the task group, at most --parallel at a time, and they
+share the deadline of the group, so supernode schedules them as high priority once the deadline
+is near. The files are downloaded to the temp files next to their outputs, and are moved into
+place only after all of them succeed, otherwise none of them is. The arguments after '--' are
+passed to every dfget process, such as '-- --node 127.0.0.1'.`
+
+var groupFlags struct {
+	list     string
+	id       string
+	deadline time.Duration
+	parallel int
+}
+
+var groupCmd = &cobra.Command{
+	Use:           "group [-- dfget flags...]",
+	Short:         "Download a group of the related files together",
+	Long:          groupDescription,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(groupFlags.list)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open the list of the group")
+		}
+		files, err := group.ParseList(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		opts := &group.Options{
+			ID:       groupFlags.id,
+			Parallel: groupFlags.parallel,
+			Args:     args,
+		}
+		if groupFlags.deadline > 0 {
+			opts.Deadline = time.Now().Add(groupFlags.deadline)
+		}
+		start := time.Now()
+		results, err := group.Download(context.Background(), opts, files, runGroupDfget)
+		for _, r := range results {
+			if r.Err != nil {
+				printer.Printf("%s FAIL: %v", r.URL, r.Err)
+				continue
+			}
+			printer.Printf("%s SUCCESS cost:%.3fs output:%s", r.URL, r.Cost.Seconds(), r.Output)
+		}
+		if err != nil {
+			return err
+		}
+		printer.Printf("download group %s SUCCESS cost:%.3fs files:%d", opts.ID, time.Since(start).Seconds(), len(files))
+		return nil
+	},
+}
+
+// runGroupDfget runs dfget with the arguments and waits for it to exit,
+// and it's killed once ctx is done.
+func runGroupDfget(ctx context.Context, args []string) error {
+	return exec.CommandContext(ctx, os.Args[0], args...).Run()
+}
+
+func init() {
+	groupCmd.Flags().StringVarP(&groupFlags.list, "list", "l", "",
+		"the file which lists the files of the group by the lines of \"url output\", the blank lines and the ones starting with '#' are ignored")
+	groupCmd.MarkFlagRequired("list")
+	groupCmd.Flags().StringVar(&groupFlags.id, "id", "",
+		"the ID of the task group registered to supernode, by which the downloads of the group are listed")
+	groupCmd.MarkFlagRequired("id")
+	groupCmd.Flags().DurationVar(&groupFlags.deadline, "deadline", 0,
+		"the time from now by which all the files of the group should be downloaded, 0 means none")
+	groupCmd.Flags().IntVar(&groupFlags.parallel, "parallel", 4,
+		"the max number of the files downloaded at the same time")
+
+	rootCmd.AddCommand(groupCmd)
+}
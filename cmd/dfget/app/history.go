@@ -0,0 +1,149 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/history"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var historyDescription = `List the finished downloads recorded in the history database of the work home,
+including their url, digest, size, duration, the ratio of the bytes downloaded from the other peers
+and the exit status, which helps to audit what the node fetched and how efficiently.`
+
+var historyFlags struct {
+	url    string
+	since  time.Duration
+	status string
+	limit  int
+	json   bool
+}
+
+var historyCmd = &cobra.Command{
+	Use:           "history",
+	Short:         "List the finished downloads recorded in the history database",
+	Long:          historyDescription,
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := initProperties(); err != nil {
+			return err
+		}
+
+		switch historyFlags.status {
+		case "", history.StatusSuccess, history.StatusFail:
+		default:
+			return errors.Errorf("invalid status: %s", historyFlags.status)
+		}
+		filter := &history.Filter{
+			URL:    historyFlags.url,
+			Status: historyFlags.status,
+			Limit:  historyFlags.limit,
+		}
+		if historyFlags.since > 0 {
+			filter.Since = time.Now().Add(-historyFlags.since)
+		}
+
+		records, err := historyDB().List(filter)
+		if err != nil {
+			return err
+		}
+
+		w := cmd.OutOrStdout()
+		if historyFlags.json {
+			if records == nil {
+				records = []*history.Record{}
+			}
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(records)
+		}
+		for _, r := range records {
+			fmt.Fprintf(w, "%s %s size:%d cost:%.3fs p2p:%.2f reason:%d %s -> %s",
+				r.Time.Format(time.RFC3339), r.Status(), r.Size, r.Duration, r.P2PRatio,
+				r.BackSourceReason, r.URL, r.Output)
+			if r.Digest != "" {
+				fmt.Fprintf(w, " %s", r.Digest)
+			}
+			if r.ExitCode != 0 {
+				fmt.Fprintf(w, " code:%d error:%s", r.ExitCode, r.Error)
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flagSet := historyCmd.Flags()
+	flagSet.StringVar(&cfg.WorkHome, "home", cfg.WorkHome, "the work home directory of dfget")
+	flagSet.StringVar(&historyFlags.url, "url", "", "only list the downloads whose url contains it")
+	flagSet.DurationVar(&historyFlags.since, "since", 0, "only list the downloads started in this duration, 0 means unlimited")
+	flagSet.StringVar(&historyFlags.status, "status", "", "only list the downloads with the status, must be success/fail")
+	flagSet.IntVar(&historyFlags.limit, "limit", 0, "the max number of the latest downloads to list, 0 means unlimited")
+	flagSet.BoolVar(&historyFlags.json, "json", false, "output the downloads in JSON")
+
+	rootCmd.AddCommand(historyCmd)
+}
+
+func historyDB() *history.DB {
+	return history.New(filepath.Join(cfg.WorkHome, history.DirName, history.FileName), 0)
+}
+
+// recordHistory records the finished download into the history database.
+func recordHistory(cfg *config.Config, end time.Time, e *errortypes.DfError) {
+	r := &history.Record{
+		Time:             cfg.StartTime,
+		URL:              cfg.URL,
+		Output:           cfg.Output,
+		Size:             cfg.RV.FileLength,
+		Duration:         end.Sub(cfg.StartTime).Seconds(),
+		BackSourceReason: cfg.BackSourceReason,
+	}
+	if e != nil {
+		r.ExitCode = e.Code
+		r.Error = e.Msg
+	}
+	switch {
+	case cfg.Md5 != "":
+		r.Digest = "md5:" + cfg.Md5
+	case cfg.RV.Sha256 != "":
+		r.Digest = "sha256:" + cfg.RV.Sha256
+	}
+	// the bytes downloaded from the peers are wasted if it backs to the source station
+	if cfg.BackSourceReason == config.BackSourceReasonNone && cfg.RV.FileLength > 0 {
+		r.P2PRatio = float64(cfg.RV.PeerBytes) / float64(cfg.RV.FileLength)
+		if r.P2PRatio > 1 {
+			r.P2PRatio = 1
+		}
+	}
+
+	if err := historyDB().Append(r); err != nil {
+		logrus.Warnf("failed to record the download history: %v", err)
+	}
+}
@@ -17,20 +17,20 @@
 package app
 
 import (
-	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core"
 	"github.com/dragonflyoss/Dragonfly/pkg/cmd"
 	"github.com/dragonflyoss/Dragonfly/pkg/dflog"
+	"github.com/dragonflyoss/Dragonfly/pkg/diagnostics"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/printer"
-	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/sourceprotocol"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -43,8 +43,6 @@ type propertiesResult struct {
 	err      error
 }
 
-var filter string
-
 var cfg = config.NewConfig()
 
 // dfgetDescription is used to describe dfget command in details.
@@ -69,7 +67,7 @@ var rootCmd = &cobra.Command{
 func init() {
 	initFlags()
 	rootCmd.AddCommand(cmd.NewGenDocCommand("dfget"))
-	rootCmd.AddCommand(cmd.NewVersionCommand("dfget"))
+	rootCmd.AddCommand(newVersionCommand())
 }
 
 // runDfget does some init operations and starts to download.
@@ -85,6 +83,11 @@ func runDfget() error {
 		return err
 	}
 
+	// initialize printer
+	if err := initPrinter(); err != nil {
+		return err
+	}
+
 	// TODO: make the result print of initproperties elegant.
 	// print property load result
 	for _, propRst := range propResults {
@@ -95,21 +98,41 @@ func runDfget() error {
 		logrus.Debugf("initProperties[%s] success: %v", propRst.fileName, propRst.prop)
 	}
 
-	cfg.Filter = transFilter(filter)
-
 	if err := checkParameters(); err != nil {
 		return err
 	}
-	logrus.Infof("get cmd params:%q", os.Args)
+	logrus.Infof("get cmd params:%q", httputils.RedactHeaderArgs(os.Args))
 
+	if err := sourceprotocol.Register(cfg.SourceProtocols); err != nil {
+		return errors.Wrap(err, "failed to register the source protocols")
+	}
 	if err := config.AssertConfig(cfg); err != nil {
 		return errors.Wrap(err, "failed to assert context")
 	}
 	logrus.Infof("get init config:%v", cfg)
 
+	// dump the status of the download on SIGQUIT/SIGUSR1
+	stopWatch := diagnostics.WatchStatusSignals("dfget")
+	defer stopWatch()
+
 	// enter the core process
+	leaveCgroup := joinCgroup(cfg)
 	dfError := core.Start(cfg)
-	printer.Println(resultMsg(cfg, time.Now(), dfError))
+	leaveCgroup()
+	end := time.Now()
+	printer.Println(resultMsg(cfg, end, dfError))
+	if !cfg.VerifyOnly {
+		summary := newSummary(cfg, end, dfError)
+		printer.Println(summary.String())
+		if cfg.SummaryFile != "" {
+			if err := writeSummary(cfg.SummaryFile, summary); err != nil {
+				logrus.Warnf("failed to write the summary of the download: %v", err)
+			}
+		}
+	}
+	if !cfg.VerifyOnly && !cfg.NoCache {
+		recordHistory(cfg, end, dfError)
+	}
 	if dfError != nil {
 		os.Exit(dfError.Code)
 	}
@@ -139,33 +162,11 @@ func initProperties() ([]*propertiesResult, error) {
 		})
 	}
 
-	supernodes := cfg.Supernodes
-	if supernodes == nil {
-		supernodes = properties.Supernodes
-	}
-	if supernodes != nil {
-		cfg.Nodes = config.NodeWeightSlice2StringSlice(supernodes)
-	}
-
-	if cfg.LocalLimit == 0 {
-		cfg.LocalLimit = properties.LocalLimit
-	}
-
-	if cfg.MinRate == 0 {
-		cfg.MinRate = properties.MinRate
-	}
-
-	if cfg.TotalLimit == 0 {
-		cfg.TotalLimit = properties.TotalLimit
-	}
-
-	if cfg.ClientQueueSize == 0 {
-		cfg.ClientQueueSize = properties.ClientQueueSize
-	}
+	cfg.MergeProperties(properties)
 
 	currentUser, err := user.Current()
 	if err != nil {
-		printer.Println(fmt.Sprintf("get user error: %s", err))
+		printer.Printf("get user error: %s", err)
 		os.Exit(config.CodeGetUserError)
 	}
 	cfg.User = currentUser.Username
@@ -193,7 +194,7 @@ func initClientLog() error {
 	}
 
 	opts := []dflog.Option{
-		dflog.WithLogFile(cfg.LogConfig.Path, cfg.LogConfig.MaxSize, cfg.LogConfig.MaxBackups),
+		dflog.WithLogConfig(cfg.LogConfig),
 		dflog.WithSign(cfg.Sign),
 		dflog.WithDebug(cfg.Verbose),
 	}
@@ -206,91 +207,45 @@ func initClientLog() error {
 	return dflog.Init(logrus.StandardLogger(), opts...)
 }
 
+// initPrinter selects the printer which outputs messages on console
+// according to the flags and the capabilities of the terminal.
+func initPrinter() error {
+	if err := printer.SetLocale(cfg.Locale); err != nil {
+		return err
+	}
+
+	format := cfg.OutputFormat
+	if cfg.Quiet {
+		format = printer.FormatQuiet
+	}
+	p, err := printer.New(format, os.Stdout, cfg.ShowBar && !cfg.Console)
+	if err != nil {
+		return err
+	}
+	printer.SetPrinter(p)
+	return nil
+}
+
 func initFlags() {
 	// pass to server
 	flagSet := rootCmd.Flags()
-
-	// url & output
-	flagSet.StringVarP(&cfg.URL, "url", "u", "", "URL of user requested downloading file(only HTTP/HTTPs supported)")
-	flagSet.StringVarP(&cfg.Output, "output", "o", "",
-		"destination path which is used to store the requested downloading file. It must contain detailed directory and specific filename, for example, '/tmp/file.mp4'")
-
-	// localLimit & minRate & totalLimit & timeout
-	flagSet.VarP(&cfg.LocalLimit, "locallimit", "s",
-		"network bandwidth rate limit for single download task, in format of G(B)/g/M(B)/m/K(B)/k/B, pure number will also be parsed as Byte")
-	flagSet.Var(&cfg.MinRate, "minrate",
-		"minimal network bandwidth rate for downloading a file, in format of G(B)/g/M(B)/m/K(B)/k/B, pure number will also be parsed as Byte")
-	flagSet.Var(&cfg.TotalLimit, "totallimit",
-		"network bandwidth rate limit for the whole host, in format of G(B)/g/M(B)/m/K(B)/k/B, pure number will also be parsed as Byte")
-	flagSet.DurationVarP(&cfg.Timeout, "timeout", "e", 0,
-		"timeout set for file downloading task. If dfget has not finished downloading all pieces of file before --timeout, the dfget will throw an error and exit")
-
-	// md5 & identifier
-	flagSet.StringVarP(&cfg.Md5, "md5", "m", "",
-		"md5 value input from user for the requested downloading file to enhance security")
-	flagSet.StringVarP(&cfg.Identifier, "identifier", "i", "",
-		"the usage of identifier is making different downloading tasks generate different downloading task IDs even if they have the same URLs. conflict with --md5.")
-	flagSet.StringVar(&cfg.CallSystem, "callsystem", "",
-		"the name of dfget caller which is for debugging. Once set, it will be passed to all components around the request to make debugging easy")
-	flagSet.StringSliceVar(&cfg.Cacerts, "cacerts", nil,
-		"the cacert file which is used to verify remote server when supernode interact with the source.")
-	flagSet.StringVarP(&cfg.Pattern, "pattern", "p", "p2p",
-		"download pattern, must be p2p/cdn/source, cdn and source do not support flag --totallimit")
-	flagSet.StringVarP(&filter, "filter", "f", "",
-		"filter some query params of URL, use char '&' to separate different params"+
-			"\neg: -f 'key&sign' will filter 'key' and 'sign' query param"+
-			"\nin this way, different but actually the same URLs can reuse the same downloading task")
-	flagSet.StringArrayVar(&cfg.Header, "header", nil,
-		"http header, eg: --header='Accept: *' --header='Host: abc'")
-	flagSet.VarP(config.NewSupernodesValue(&cfg.Supernodes, nil), "node", "n",
-		"specify the addresses(host:port=weight) of supernodes where the host is necessary, the port(default: 8002) and the weight(default:1) are optional. And the type of weight must be integer")
-	flagSet.BoolVar(&cfg.Notbs, "notbs", false,
-		"disable back source downloading for requested file when p2p fails to download it")
-	flagSet.BoolVar(&cfg.DFDaemon, "dfdaemon", false,
-		"identify whether the request is from dfdaemon")
-	flagSet.BoolVar(&cfg.Insecure, "insecure", false,
-		"identify whether supernode should skip secure verify when interact with the source.")
-	flagSet.IntVar(&cfg.ClientQueueSize, "clientqueue", config.DefaultClientQueueSize,
-		"specify the size of client queue which controls the number of pieces that can be processed simultaneously")
-
-	// others
-	flagSet.BoolVarP(&cfg.ShowBar, "showbar", "b", false,
-		"show progress bar, it is conflict with '--console'")
-	flagSet.BoolVar(&cfg.Console, "console", false,
-		"show log on console, it's conflict with '--showbar'")
-	flagSet.BoolVar(&cfg.Verbose, "verbose", false,
-		"be verbose")
-	flagSet.StringVar(&cfg.WorkHome, "home", cfg.WorkHome,
-		"the work home directory of dfget")
-
-	// pass to peer server which as a uploader server
-	flagSet.StringVar(&cfg.RV.LocalIP, "ip", "",
-		"IP address that server will listen on")
-	flagSet.IntVar(&cfg.RV.PeerPort, "port", 0,
-		"port number that server will listen on")
-	flagSet.DurationVar(&cfg.RV.DataExpireTime, "expiretime", config.DataExpireTime,
-		"caching duration for which cached file keeps no accessed by any process, after this period cache file will be deleted")
-	flagSet.DurationVar(&cfg.RV.ServerAliveTime, "alivetime", config.ServerAliveTime,
-		"alive duration for which uploader keeps no accessing by any uploading requests, after this period uploader will automatically exit")
+	config.AddFlags(flagSet, cfg)
 
 	flagSet.MarkDeprecated("exceed", "please use '--timeout' or '-e' instead")
 }
 
-func transFilter(filter string) []string {
-	if stringutils.IsEmptyStr(filter) {
-		return nil
-	}
-	return strings.Split(filter, "&")
-}
-
 func resultMsg(cfg *config.Config, end time.Time, e *errortypes.DfError) string {
 	if e != nil {
-		return fmt.Sprintf("download FAIL(%d) cost:%.3fs length:%d reason:%d error:%v",
+		return printer.Sprintf("download FAIL(%d) cost:%.3fs length:%d reason:%d error:%v",
 			e.Code, end.Sub(cfg.StartTime).Seconds(), cfg.RV.FileLength,
 			cfg.BackSourceReason, e)
 	}
-	return fmt.Sprintf("download SUCCESS cost:%.3fs length:%d reason:%d",
+	msg := printer.Sprintf("download SUCCESS cost:%.3fs length:%d reason:%d",
 		end.Sub(cfg.StartTime).Seconds(), cfg.RV.FileLength, cfg.BackSourceReason)
+	if cfg.RV.Sha256 != "" {
+		msg += " sha256:" + cfg.RV.Sha256
+	}
+	return msg
 }
 
 // Execute will process dfget.
@@ -103,30 +103,6 @@ func (suit *dfgetSuit) Test_HeaderFlags() {
 	suit.Equal(cfg.Header, []string{"Host: abc", "Date:Mon, 30 Dec 2019"})
 }
 
-func (suit *dfgetSuit) Test_transFilter() {
-	var cases = []string{
-		"a&b&c",
-		"a",
-		"",
-		"abc",
-	}
-
-	var expectedResult = [][]string{
-		0: {"a", "b", "c"},
-		1: {"a"},
-		2: nil,
-		3: {"abc"},
-	}
-
-	testResult := make([][]string, len(cases))
-	for i, v := range cases {
-		filters := transFilter(v)
-		testResult[i] = filters
-	}
-
-	suit.EqualValues(expectedResult, testResult)
-}
-
 func (suit *dfgetSuit) TestResultMsg() {
 	cfg := config.NewConfig()
 	end := cfg.StartTime.Add(100 * time.Millisecond)
@@ -139,6 +115,55 @@ func (suit *dfgetSuit) TestResultMsg() {
 		`{"Code":1,"Msg":"TestFail"}`)
 }
 
+func (suit *dfgetSuit) TestSummary() {
+	cfg := config.NewConfig()
+	cfg.RV.FileLength = 3 * 1024 * 1024
+	cfg.RV.PeerBytes = 2 * 1024 * 1024
+	cfg.RV.SupernodeBytes = 1024 * 1024
+	cfg.RV.Retries = 2
+	end := cfg.StartTime.Add(time.Second)
+
+	s := newSummary(cfg, end, nil)
+	suit.Equal(s.Speed, float64(cfg.RV.FileLength))
+	suit.Equal(s.Verification, verificationSkipped)
+	suit.Equal(s.String(), "summary cost:1.000s speed:3.000MB/s peer:2097152 supernode:1048576 source:0 retries:2 verification:skipped")
+
+	cfg.Md5 = "x"
+	suit.Equal(newSummary(cfg, end, nil).Verification, verificationPassed)
+	suit.Equal(newSummary(cfg, end, errortypes.New(1, "TestFail")).Verification, verificationFailed)
+
+	dir, _ := ioutil.TempDir("/tmp", "dfget-TestSummary-")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "summary.json")
+	suit.Nil(writeSummary(file, s))
+	data, err := ioutil.ReadFile(file)
+	suit.Nil(err)
+	suit.Contains(string(data), `"peerBytes": 2097152`)
+}
+
+func (suit *dfgetSuit) TestValidateConfigFile() {
+	dir, err := ioutil.TempDir("", "dfget-validate-")
+	suit.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for content, valid := range map[string]bool{
+		"nodes:\n  - 127.0.0.1:8002=2":           true,
+		"nodes:\n  - 127.0.0.1\nunknownField: 1": false,
+		"dataDirPlacement: random":               false,
+		"localLimit: 1M\nminRate: 2M":            false,
+	} {
+		file := filepath.Join(dir, "dfget.yml")
+		suit.Nil(ioutil.WriteFile(file, []byte(content), 0644))
+		err := validateConfigFile(file)
+		suit.Equal(valid, err == nil, "%s: %v", content, err)
+	}
+
+	ini := filepath.Join(dir, "dragonfly.conf")
+	suit.Nil(ioutil.WriteFile(ini, []byte("[node]\naddress=127.0.0.1:8002"), 0644))
+	suit.Nil(validateConfigFile(ini))
+	suit.Nil(validateConfigFile("../../../docs/config/dfget_config_template.yml"))
+}
+
 func TestSuite(t *testing.T) {
 	suite.Run(t, new(dfgetSuit))
 }
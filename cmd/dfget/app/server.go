@@ -17,6 +17,7 @@
 package app
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
@@ -46,12 +47,22 @@ func initServerFlags() {
 
 	flagSet.StringVar(&cfg.RV.SystemDataDir, "data", cfg.RV.SystemDataDir,
 		"local directory which stores temporary files for p2p uploading")
+	flagSet.Var(config.NewDataDirsValue(&cfg.DataDirs, nil), "datadirs",
+		"additional data directories(path=weight) which store temporary files for p2p uploading")
 	flagSet.StringVar(&cfg.WorkHome, "home", cfg.WorkHome,
 		"the work home directory of dfget server")
 	flagSet.StringVar(&cfg.RV.LocalIP, "ip", "",
 		"IP address that server will listen on")
+	flagSet.StringVar(&cfg.P2PIP, "p2p-ip", "",
+		"IP address on the dedicated network of the p2p transfers that server will listen on instead of the one specified by --ip")
+	flagSet.StringSliceVar(&cfg.AdvertiseIPs, "advertise-ip", nil,
+		"other IP addresses that server will listen on, which are advertised to the other peers besides the one specified by --ip")
+	flagSet.StringVar(&cfg.StandbyOf, "standby-of", "",
+		"address ip:port of the server of the primary node which this server is the warm standby of, whose tasks are replicated to this server")
 	flagSet.IntVar(&cfg.RV.PeerPort, "port", 0,
 		"port number that server will listen on")
+	flagSet.Var(&cfg.PeerPortRange, "port-range",
+		"range of ports(lower-upper) from which server selects an available one to listen on if --port is not set, the port selected last time is preferred")
 	flagSet.StringVar(&cfg.RV.MetaPath, "meta", cfg.RV.MetaPath,
 		"meta file path")
 
@@ -59,6 +70,34 @@ func initServerFlags() {
 		"caching duration for which cached file keeps no accessed by any process, after this period cache file will be deleted")
 	flagSet.DurationVar(&cfg.RV.ServerAliveTime, "alivetime", config.ServerAliveTime,
 		"alive duration for which uploader keeps no accessing by any uploading requests, after this period uploader will automatically exit")
+	flagSet.DurationVar(&cfg.RV.MinSeedTime, "minseedtime", 0,
+		"minimum duration for which uploader keeps seeding a downloaded file and keeps alive, no matter whether other seeding policies are satisfied")
+	flagSet.Float64Var(&cfg.RV.SeedRatio, "seedratio", 0,
+		"target ratio of the uploaded bytes to the file length, uploader stops seeding a file once the ratio is reached, 0 means unlimited")
+	flagSet.Var(&cfg.RV.CacheSize, "cachesize",
+		"max total size of the files cached by uploader, the least recently accessed ones are evicted once it's exceeded, 0 means unlimited")
+	flagSet.IntVar(&cfg.RV.ReadAheadPieces, "readahead", config.DefaultReadAheadPieces,
+		"number of the following pieces which uploader reads ahead into the page cache when it observes the sequential piece requests of a file, 0 means disabled")
+	flagSet.IntVar(&cfg.RV.DiskFailureLimit, "disk-failure-limit", config.DefaultDiskFailureLimit,
+		"number of the read errors and checksum failures of the cached files within "+config.DiskFailureWindow.String()+", beyond which uploader fences itself and stops serving the pieces, 0 means disabled")
+	flagSet.BoolVar(&cfg.RV.ReverifyOnFence, "reverify-on-fence", false,
+		"re-verify all the cached files once uploader is fenced, and remove the ones which can't be read or don't match their md5s")
+	flagSet.Float64Var(&cfg.RV.AccessLogSampleRate, "access-log-sample-rate", 0,
+		"rate in [0, 1] of the requests to uploader which are written to the access log, 0 means disabled")
+	flagSet.IntVar(&cfg.RV.AdminPort, "admin-port", 0,
+		"port on the loopback address on which uploader serves the diagnostics endpoints such as pprof, 0 means disabled")
+	flagSet.BoolVar(&cfg.RV.Multiplex, "multiplex", false,
+		"serve the diagnostics endpoints and the control endpoints on the port of uploader besides the pieces, which are authorized by adminToken and controlToken of the config file")
+	flagSet.IntVar(&cfg.LogConfig.MaxSize, "log-max-size", 0,
+		"maximum size in megabytes of the log file before it gets rotated, default 40")
+	flagSet.IntVar(&cfg.LogConfig.MaxAge, "log-max-age", 0,
+		"maximum number of days to retain the rotated log files, 0 means that they are not removed due to age")
+	flagSet.StringVar(&cfg.RV.SeedDir, "seeddir", "",
+		"read-only directory of the files staged in advance, uploader serves them as a seeder according to the "+config.SeedManifestFile+" in the directory")
+	flagSet.StringToStringVar(&cfg.CacheKeys, "cache-keys", nil,
+		"files of the keys(namespace=file) with which the cached files of the namespaces are encrypted and decrypted")
+	flagSet.VarP(config.NewSupernodesValue(&cfg.Supernodes, nil), "node", "n",
+		"specify the addresses(host:port=weight) of supernodes to which the files in the seed directory are reported, the supernodes in the config file are used if it's not set")
 
 	flagSet.BoolVar(&cfg.Verbose, "verbose", false,
 		"be verbose")
@@ -68,6 +107,10 @@ func runServer() error {
 	if err := initServerLog(); err != nil {
 		return err
 	}
+	if err := initServerSeed(); err != nil {
+		return err
+	}
+	initServerTokens()
 	// launch a peer server as a uploader server
 	port, err := uploader.LaunchPeerServer(cfg)
 	if err != nil {
@@ -81,12 +124,60 @@ func runServer() error {
 	return nil
 }
 
+// initServerSeed initializes the supernodes which the files in the seed directory belong to.
+func initServerSeed() error {
+	if cfg.RV.SeedDir == "" {
+		return nil
+	}
+	if cfg.RV.LocalIP == "" {
+		return fmt.Errorf("the IP address must be specified to seed the files in %s", cfg.RV.SeedDir)
+	}
+
+	supernodes := cfg.Supernodes
+	if supernodes == nil {
+		supernodes = loadServerProperties().Supernodes
+	}
+	if supernodes == nil {
+		return fmt.Errorf("no supernode is specified to seed the files in %s", cfg.RV.SeedDir)
+	}
+	cfg.Nodes = config.NodeWeightSlice2StringSlice(supernodes)
+	return nil
+}
+
+// initServerTokens initializes the tokens authorizing the surfaces multiplexed on the port,
+// and the secret signing the share links.
+func initServerTokens() {
+	loadTokens := cfg.RV.Multiplex && cfg.AdminToken == "" && cfg.ControlToken == ""
+	if !loadTokens && cfg.ShareSecret != "" {
+		return
+	}
+	properties := loadServerProperties()
+	if loadTokens {
+		cfg.AdminToken = properties.AdminToken
+		cfg.ControlToken = properties.ControlToken
+	}
+	if cfg.ShareSecret == "" {
+		cfg.ShareSecret = properties.ShareSecret
+	}
+}
+
+// loadServerProperties loads the properties from the first config file loaded successfully.
+func loadServerProperties() *config.Properties {
+	properties := config.NewProperties()
+	for _, v := range cfg.ConfigFiles {
+		if err := properties.Load(v); err == nil {
+			break
+		}
+	}
+	return properties
+}
+
 func initServerLog() error {
 	if cfg.LogConfig.Path == "" {
 		cfg.LogConfig.Path = filepath.Join(cfg.WorkHome, "logs", "dfserver.log")
 	}
 	opts := []dflog.Option{
-		dflog.WithLogFile(cfg.LogConfig.Path, cfg.LogConfig.MaxSize, cfg.LogConfig.MaxBackups),
+		dflog.WithLogConfig(cfg.LogConfig),
 		dflog.WithSign(cfg.Sign),
 		dflog.WithDebug(cfg.Verbose),
 	}
@@ -0,0 +1,123 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+
+	"github.com/pkg/errors"
+)
+
+/* the result of verifying the downloaded file */
+const (
+	verificationPassed  = "passed"
+	verificationFailed  = "failed"
+	verificationSkipped = "skipped"
+)
+
+// downloadSummary is the summary of a finished download, which tells
+// how much the download benefits from the p2p network.
+type downloadSummary struct {
+	Success bool `json:"success"`
+
+	// Duration is the total time of the download in seconds.
+	Duration float64 `json:"duration"`
+
+	FileLength int64 `json:"fileLength"`
+
+	// Speed is the average speed of the download in bytes per second.
+	Speed float64 `json:"speed"`
+
+	PeerBytes      int64 `json:"peerBytes"`
+	SupernodeBytes int64 `json:"supernodeBytes"`
+	SourceBytes    int64 `json:"sourceBytes"`
+	EdgeBytes      int64 `json:"edgeBytes"`
+	MirrorBytes    int64 `json:"mirrorBytes"`
+
+	Retries          int64 `json:"retries"`
+	BackSourceReason int   `json:"backSourceReason"`
+
+	// Verification is the result of verifying the downloaded file against
+	// its digest, must be passed/failed/skipped.
+	Verification string `json:"verification"`
+	Digest       string `json:"digest,omitempty"`
+
+	// Stages are the results of the stages of the fallback chain which have run.
+	Stages []*config.StageResult `json:"stages,omitempty"`
+}
+
+// newSummary summarizes the finished download.
+func newSummary(cfg *config.Config, end time.Time, e *errortypes.DfError) *downloadSummary {
+	s := &downloadSummary{
+		Success:          e == nil,
+		Duration:         end.Sub(cfg.StartTime).Seconds(),
+		FileLength:       cfg.RV.FileLength,
+		PeerBytes:        atomic.LoadInt64(&cfg.RV.PeerBytes),
+		SupernodeBytes:   atomic.LoadInt64(&cfg.RV.SupernodeBytes),
+		SourceBytes:      atomic.LoadInt64(&cfg.RV.SourceBytes),
+		EdgeBytes:        atomic.LoadInt64(&cfg.RV.EdgeBytes),
+		MirrorBytes:      atomic.LoadInt64(&cfg.RV.MirrorBytes),
+		Retries:          atomic.LoadInt64(&cfg.RV.Retries),
+		BackSourceReason: cfg.BackSourceReason,
+		Verification:     verificationSkipped,
+		Stages:           cfg.RV.Stages,
+	}
+	if s.Duration > 0 {
+		s.Speed = float64(s.PeerBytes+s.SupernodeBytes+s.SourceBytes+s.EdgeBytes+s.MirrorBytes) / s.Duration
+	}
+
+	// the file downloaded from the source station is only verified against the md5 given by user
+	switch {
+	case cfg.Md5 != "":
+		s.Digest = "md5:" + cfg.Md5
+	case cfg.RV.Sha256 != "" && cfg.BackSourceReason == config.BackSourceReasonNone:
+		s.Digest = "sha256:" + cfg.RV.Sha256
+	}
+	if s.Digest != "" {
+		s.Verification = verificationPassed
+		if e != nil {
+			s.Verification = verificationFailed
+		}
+	}
+	return s
+}
+
+// String returns the summary in one line which is printed on console.
+func (s *downloadSummary) String() string {
+	return printer.Sprintf("summary cost:%.3fs speed:%.3fMB/s peer:%d supernode:%d source:%d retries:%d verification:%s",
+		s.Duration, s.Speed/1024/1024, s.PeerBytes, s.SupernodeBytes, s.SourceBytes,
+		s.Retries, s.Verification)
+}
+
+// writeSummary writes the summary in JSON to the file.
+func writeSummary(file string, s *downloadSummary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write summary file %s", file)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/locator"
+	"github.com/dragonflyoss/Dragonfly/pkg/cmd"
+	"github.com/dragonflyoss/Dragonfly/version"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var versionFlags struct {
+	remote bool
+	json   bool
+}
+
+// remoteVersion is the version of a supernode queried by `dfget version --remote`.
+type remoteVersion struct {
+	Node    string                  `json:"node"`
+	Version *types.DragonflyVersion `json:"version,omitempty"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+func newVersionCommand() *cobra.Command {
+	versionCmd := cmd.NewVersionCommand("dfget")
+	local := versionCmd.RunE
+	versionCmd.RunE = func(c *cobra.Command, args []string) error {
+		if !versionFlags.remote {
+			return local(c, args)
+		}
+		if _, err := initProperties(); err != nil {
+			return err
+		}
+		if cfg.Supernodes != nil {
+			cfg.Nodes = config.NodeWeightSlice2StringSlice(cfg.Supernodes)
+		}
+		var nodes []string
+		seen := make(map[string]bool)
+		for _, group := range locator.CreateLocator(cfg).All() {
+			for _, node := range group.Nodes {
+				if !seen[node.String()] {
+					seen[node.String()] = true
+					nodes = append(nodes, node.String())
+				}
+			}
+		}
+		if !versionFlags.json {
+			if err := local(c, args); err != nil {
+				return err
+			}
+		}
+		return printRemoteVersions(c.OutOrStdout(), api.NewSupernodeAPIWithToken(cfg.PeerToken), nodes, versionFlags.json)
+	}
+
+	flagSet := versionCmd.Flags()
+	flagSet.BoolVar(&versionFlags.remote, "remote", false,
+		"also query the versions and the enabled features of the supernodes, which are the ones of --node or the config file")
+	flagSet.VarP(config.NewSupernodesValue(&cfg.Supernodes, nil), "node", "n",
+		"specify the addresses(host:port=weight) of supernodes to query with --remote, the supernodes in the config file are used if it's not set")
+	flagSet.BoolVar(&versionFlags.json, "json", false, "output the versions of the supernodes in JSON with --remote")
+	return versionCmd
+}
+
+// printRemoteVersions queries the versions of the supernodes, and marks the ones
+// different from dfget. An error is returned if any supernode can't be queried.
+func printRemoteVersions(w io.Writer, supernodeAPI api.SupernodeAPI, nodes []string, asJSON bool) error {
+	var (
+		versions []*remoteVersion
+		failed   int
+	)
+	for _, node := range nodes {
+		v := &remoteVersion{Node: node}
+		info, err := supernodeAPI.Version(node)
+		if err != nil {
+			v.Error = err.Error()
+			failed++
+		} else {
+			v.Version = info
+		}
+		versions = append(versions, v)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(versions); err != nil {
+			return err
+		}
+	} else {
+		for _, v := range versions {
+			if v.Version == nil {
+				fmt.Fprintf(w, "\nsupernode %s: %s\n", v.Node, v.Error)
+				continue
+			}
+			fmt.Fprintf(w, "\nsupernode %s version  %s", v.Node, v.Version.Version)
+			if v.Version.Version != version.DFGetVersion {
+				fmt.Fprintf(w, " (differs from dfget %s)", version.DFGetVersion)
+			}
+			fmt.Fprintf(w, "\n  Git commit:     %s\n  Build date:     %s\n  Go version:     %s\n  OS/Arch:        %s/%s\n  Features:       %s\n",
+				v.Version.Revision, v.Version.BuildDate, v.Version.GoVersion, v.Version.OS, v.Version.Arch,
+				strings.Join(v.Version.Features, ", "))
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to query %d of %d supernodes", failed, len(nodes))
+	}
+	return nil
+}
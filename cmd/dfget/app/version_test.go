@@ -0,0 +1,58 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/version"
+)
+
+func (suit *dfgetSuit) TestPrintRemoteVersions() {
+	supernodeAPI := &helper.MockSupernodeAPI{
+		VersionFunc: func(node string) (*types.DragonflyVersion, error) {
+			switch node {
+			case "same:8002":
+				return &types.DragonflyVersion{Version: version.DFGetVersion, Features: []string{"a", "b"}}, nil
+			case "old:8002":
+				return &types.DragonflyVersion{Version: "0.0.1"}, nil
+			}
+			return nil, fmt.Errorf("connection refused")
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	suit.Nil(printRemoteVersions(buf, supernodeAPI, []string{"same:8002", "old:8002"}, false))
+	out := buf.String()
+	suit.Contains(out, "supernode same:8002 version  "+version.DFGetVersion+"\n")
+	suit.Contains(out, "Features:       a, b\n")
+	suit.Contains(out, "supernode old:8002 version  0.0.1 (differs from dfget")
+
+	buf.Reset()
+	suit.NotNil(printRemoteVersions(buf, supernodeAPI, []string{"same:8002", "down:8002"}, true))
+	var versions []*remoteVersion
+	suit.Nil(json.Unmarshal(buf.Bytes(), &versions))
+	suit.Len(versions, 2)
+	suit.Equal([]string{"a", "b"}, versions[0].Version.Features)
+	suit.Nil(versions[1].Version)
+	suit.True(strings.Contains(versions[1].Error, "connection refused"))
+}
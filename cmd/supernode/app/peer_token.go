@@ -0,0 +1,58 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/peertoken"
+
+	"github.com/spf13/cobra"
+)
+
+var peerTokenDescription = `Issue the token of the node with the given ip, which is signed by the
+peerTokenSecret of supernode. The token is set to peerToken in the configuration
+of dfget on the node, and dfget carries it in the requests to supernode.`
+
+// newPeerTokenCommand returns cobra.Command for "supernode peer-token".
+func newPeerTokenCommand() *cobra.Command {
+	var (
+		secret string
+		ip     string
+	)
+
+	cmd := &cobra.Command{
+		Use:           "peer-token",
+		Short:         "Issue the token of a node to authenticate its peers",
+		Long:          peerTokenDescription,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintln(cmd.OutOrStdout(), peertoken.Sign(secret, ip))
+			return nil
+		},
+	}
+
+	flagSet := cmd.Flags()
+	flagSet.StringVar(&secret, "secret", "", "the peerTokenSecret of supernode")
+	flagSet.StringVar(&ip, "ip", "", "the ip of the node which the token is issued to")
+	cmd.MarkFlagRequired("secret")
+	cmd.MarkFlagRequired("ip")
+
+	return cmd
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/dragonflyoss/Dragonfly/pkg/dflog"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rate"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
@@ -102,6 +103,12 @@ var rootCmd = &cobra.Command{
 		// set up the CIDPrefix
 		cfg.SetCIDPrefix(cfg.AdvertiseIP)
 
+		httputils.SetIdentity(httputils.Identity{
+			UserAgent: cfg.UserAgent,
+			Cluster:   cfg.Cluster,
+			Node:      cfg.AdvertiseIP,
+		})
+
 		logrus.Debugf("get supernode config: %+v", cfg)
 		logrus.Info("start to run supernode")
 
@@ -127,7 +134,9 @@ func init() {
 	// add sub commands
 	rootCmd.AddCommand(cmd.NewGenDocCommand("supernode"))
 	rootCmd.AddCommand(cmd.NewVersionCommand("supernode"))
-	rootCmd.AddCommand(cmd.NewConfigCommand("supernode", getDefaultConfig))
+	rootCmd.AddCommand(cmd.NewConfigCommand("supernode", getDefaultConfig, validateConfigFile))
+	rootCmd.AddCommand(newSchedulerReplayCommand())
+	rootCmd.AddCommand(newPeerTokenCommand())
 }
 
 // setupFlags setups flags for command line.
@@ -196,6 +205,81 @@ func setupFlags(cmd *cobra.Command) {
 	flagSet.Duration("peer-gc-delay", defaultBaseProperties.PeerGCDelay,
 		"peer gc delay is the delay time to execute the GC after the peer has reported the offline")
 
+	flagSet.Duration("peer-suspect-timeout", defaultBaseProperties.PeerSuspectTimeout,
+		"peer suspect timeout is the time after the last heart beat that a peer is treated as suspect and no piece will be assigned to it")
+
+	flagSet.Duration("peer-dead-timeout", defaultBaseProperties.PeerDeadTimeout,
+		"peer dead timeout is the time after the last heart beat that a peer is treated as dead and will be cleaned up, 0 means disabled")
+
+	flagSet.Int("scheduler-audit-size", defaultBaseProperties.SchedulerAuditSize,
+		"the number of the latest scheduler decisions kept in memory, 0 means disabled")
+
+	flagSet.String("scheduler-audit-file", defaultBaseProperties.SchedulerAuditFile,
+		"the file to record all scheduler decisions, empty means disabled")
+
+	flagSet.Int("event-log-size", defaultBaseProperties.EventLogSize,
+		"the number of the latest event logs of the downloads uploaded by dfget kept in memory, 0 means disabled")
+
+	flagSet.Float64("incentive-weight", defaultBaseProperties.IncentiveWeight,
+		"the weight in [0, 1] of the contribution of a node when scheduling peers for it, 0 means disabled")
+
+	flagSet.Float64("low-priority-ratio", defaultBaseProperties.LowPriorityRatio,
+		"the ratio in (0, 1) of the upload slots and the origin bandwidth which the downloads of a lower priority can take, 0 or 1 means disabled")
+
+	flagSet.Duration("group-urgent-window", defaultBaseProperties.GroupUrgentWindow,
+		"the time before the deadline of a task group within which the downloads of the group are scheduled as the high priority, 0 means disabled")
+
+	flagSet.Bool("persist-task-meta", defaultBaseProperties.PersistTaskMeta,
+		"persist the metadata of tasks so that the cached tasks can be recovered after restart")
+
+	flagSet.String("bundle-secret", defaultBaseProperties.BundleSecret,
+		"the secret shared by supernodes to sign and verify the bundles of tasks")
+
+	flagSet.String("peer-token-secret", defaultBaseProperties.PeerTokenSecret,
+		"the secret shared by supernodes to verify the tokens of the nodes, the requests of the peers without a valid token are rejected if it's set")
+
+	flagSet.Float64("access-log-sample-rate", defaultBaseProperties.AccessLogSampleRate,
+		"the rate in [0, 1] of the requests written to the access log, 0 means disabled")
+
+	flagSet.Int("admin-port", defaultBaseProperties.AdminPort,
+		"the port on the loopback address to serve the diagnostics endpoints such as pprof, 0 means disabled")
+
+	flagSet.Int("log-max-size", defaultBaseProperties.LogConfig.MaxSize,
+		"the maximum size in megabytes of the log files before they get rotated, default 40")
+
+	flagSet.Int("log-max-age", defaultBaseProperties.LogConfig.MaxAge,
+		"the maximum number of days to retain the rotated log files, 0 means that they are not removed due to age")
+
+	flagSet.Duration("cache-ttl", defaultBaseProperties.CacheTTL,
+		"the time that the cached file keeps fresh without validation if the origin response has no caching directives")
+
+	flagSet.Bool("piece-dedup", defaultBaseProperties.PieceDedup,
+		"store the identical pieces of tasks once by reflinks, which requires a file system such as btrfs or xfs")
+
+	flagSet.Int("cdn-hash-workers", defaultBaseProperties.CDNHashWorkers,
+		"the number of the workers which hash and write the pieces of a task concurrently when the CDN fetches it from the source")
+
+	flagSet.Bool("cdn-preallocate", defaultBaseProperties.CDNPreallocate,
+		"allocate the disk space of a task file before the CDN writes its pieces if the file length is known")
+
+	flagSet.Bool("cdn-verify-write", defaultBaseProperties.CDNVerifyWrite,
+		"read back every piece written by the CDN and compare it with the fetched one")
+
+	flagSet.Int("cache-scan-workers", defaultBaseProperties.CacheScanWorkers,
+		"the number of the workers which scan the cached files in parallel after supernode starts and remove the inconsistent ones, 0 means disabling the scan")
+
+	flagSet.String("user-agent", defaultBaseProperties.UserAgent,
+		"the User-Agent of the requests sent to the origins")
+
+	flagSet.String("cluster", defaultBaseProperties.Cluster,
+		"the name of the cluster, which is sent to the origins with the node and task in the identification headers if it's not empty")
+
+	flagSet.Int("dispatch-workers", defaultBaseProperties.DispatchWorkers,
+		"the number of the workers which dispatch the piece tasks pulled by dfget, 0 means dispatching them in the HTTP handlers")
+
+	flagSet.Int("dispatch-queue-size", defaultBaseProperties.DispatchQueueSize,
+		"the max number of the pulls of piece tasks waiting for the dispatch workers, beyond which dfget is told to wait and retry")
+
 	exitOnError(bindRootFlags(supernodeViper), "bind root command flags")
 }
 
@@ -277,6 +361,106 @@ func bindRootFlags(v *viper.Viper) error {
 			key:  "base.peerGCDelay",
 			flag: "peer-gc-delay",
 		},
+		{
+			key:  "base.peerSuspectTimeout",
+			flag: "peer-suspect-timeout",
+		},
+		{
+			key:  "base.peerDeadTimeout",
+			flag: "peer-dead-timeout",
+		},
+		{
+			key:  "base.schedulerAuditSize",
+			flag: "scheduler-audit-size",
+		},
+		{
+			key:  "base.schedulerAuditFile",
+			flag: "scheduler-audit-file",
+		},
+		{
+			key:  "base.eventLogSize",
+			flag: "event-log-size",
+		},
+		{
+			key:  "base.incentiveWeight",
+			flag: "incentive-weight",
+		},
+		{
+			key:  "base.lowPriorityRatio",
+			flag: "low-priority-ratio",
+		},
+		{
+			key:  "base.groupUrgentWindow",
+			flag: "group-urgent-window",
+		},
+		{
+			key:  "base.persistTaskMeta",
+			flag: "persist-task-meta",
+		},
+		{
+			key:  "base.bundleSecret",
+			flag: "bundle-secret",
+		},
+		{
+			key:  "base.peerTokenSecret",
+			flag: "peer-token-secret",
+		},
+		{
+			key:  "base.accessLogSampleRate",
+			flag: "access-log-sample-rate",
+		},
+		{
+			key:  "base.adminPort",
+			flag: "admin-port",
+		},
+		{
+			key:  "base.cacheTTL",
+			flag: "cache-ttl",
+		},
+		{
+			key:  "base.pieceDedup",
+			flag: "piece-dedup",
+		},
+		{
+			key:  "base.cdnHashWorkers",
+			flag: "cdn-hash-workers",
+		},
+		{
+			key:  "base.cdnPreallocate",
+			flag: "cdn-preallocate",
+		},
+		{
+			key:  "base.cdnVerifyWrite",
+			flag: "cdn-verify-write",
+		},
+		{
+			key:  "base.cacheScanWorkers",
+			flag: "cache-scan-workers",
+		},
+		{
+			key:  "base.userAgent",
+			flag: "user-agent",
+		},
+		{
+			key:  "base.cluster",
+			flag: "cluster",
+		},
+		{
+			key:  "base.dispatchWorkers",
+			flag: "dispatch-workers",
+		},
+		{
+			key:  "base.dispatchQueueSize",
+			flag: "dispatch-queue-size",
+		},
+		{
+			key:  "base.logConfig.maxSize",
+			flag: "log-max-size",
+		},
+		{
+			key:  "base.logConfig.maxAge",
+			flag: "log-max-age",
+		},
 	}
 
 	for _, f := range flags {
@@ -314,6 +498,30 @@ func getDefaultConfig() (interface{}, error) {
 	return getConfigFromViper(viper.GetViper())
 }
 
+// validateConfigFile validates the config file of supernode. The unknown fields
+// are detected by the strict yaml decoding, and the values are then decoded onto
+// the defaults of the flags the same way as starting supernode before being validated.
+func validateConfigFile(path string) error {
+	if err := fileutils.LoadYamlStrict(path, &config.Config{}); err != nil {
+		return err
+	}
+
+	v := viper.New()
+	if err := bindRootFlags(v); err != nil {
+		return err
+	}
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	cfg, err := getConfigFromViper(v)
+	if err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
 // getConfigFromViper returns supernode config from the given viper instance
 func getConfigFromViper(v *viper.Viper) (*config.Config, error) {
 	cfg := config.NewConfig()
@@ -353,9 +561,10 @@ func decodeWithYAML(types ...reflect.Type) mapstructure.DecodeHookFunc {
 // initLog initializes log Level and log format.
 func initLog(logger *logrus.Logger, logPath string, logConfig dflog.LogConfig) error {
 	logFilePath := filepath.Join(supernodeViper.GetString("base.homeDir"), "logs", logPath)
+	logConfig.Path = logFilePath
 
 	opts := []dflog.Option{
-		dflog.WithLogFile(logFilePath, logConfig.MaxSize, logConfig.MaxBackups),
+		dflog.WithLogConfig(logConfig),
 		dflog.WithSign(fmt.Sprintf("%d", os.Getpid())),
 		dflog.WithDebug(supernodeViper.GetBool("base.debug")),
 	}
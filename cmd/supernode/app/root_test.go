@@ -18,6 +18,7 @@ package app
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -112,6 +113,31 @@ func (ts *rootTestSuite) TestPortFlag() {
 	}
 }
 
+func (ts *rootTestSuite) TestLogConfigFlag() {
+	r := ts.Require()
+	fs := afero.NewMemMapFs()
+
+	configName := "supernode-log.yml"
+	file, err := fs.Create(configName)
+	r.Nil(err)
+	file.WriteString("base:\n    logConfig:\n        maxBackups: 3\n        maxAge: 7\n        compress: true")
+	file.Close()
+
+	v := viper.New()
+	v.SetFs(fs)
+	rootCmd.Flags().Set("config", configName)
+	rootCmd.Flags().Set("log-max-size", "100")
+	defer rootCmd.Flags().Set("log-max-size", "0")
+	r.Nil(bindRootFlags(v))
+	r.Nil(readConfigFile(v, rootCmd))
+	cfg, err := getConfigFromViper(v)
+	r.Nil(err)
+	r.Equal(100, cfg.LogConfig.MaxSize)
+	r.Equal(3, cfg.LogConfig.MaxBackups)
+	r.Equal(7, cfg.LogConfig.MaxAge)
+	r.True(cfg.LogConfig.Compress)
+}
+
 func (ts *rootTestSuite) TestHomeDirFlag() {
 	r := ts.Require()
 
@@ -180,6 +206,28 @@ func generateFakeFilename(fs afero.Fs) string {
 	panic("failed to generate fake dir")
 }
 
+func (ts *rootTestSuite) TestValidateConfigFile() {
+	r := ts.Require()
+	dir, err := ioutil.TempDir("", "supernode-validate-")
+	r.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for content, valid := range map[string]bool{
+		"base:\n  listenPort: 8888":                              true,
+		"base:\n  listenPort: 8888\n  unknownField: 1":           false,
+		"base:\n  cdnPattern: p2p":                               false,
+		"base:\n  peerSuspectTimeout: 2m\n  peerDeadTimeout: 1m": false,
+		"base:\n  dispatchWeights:\n    urgent: 1":               false,
+		"base:\n  replicationTasks:\n    - \"[\"":                false,
+	} {
+		file := filepath.Join(dir, "supernode.yml")
+		r.Nil(ioutil.WriteFile(file, []byte(content), 0644))
+		err := validateConfigFile(file)
+		r.Equal(valid, err == nil, "%s: %v", content, err)
+	}
+	r.Nil(validateConfigFile("../../../docs/config/supernode_config_template.yml"))
+}
+
 func TestRootCommand(t *testing.T) {
 	suite.Run(t, &rootTestSuite{})
 }
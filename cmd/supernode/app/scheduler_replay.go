@@ -0,0 +1,106 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"os"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/scheduler"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var schedulerReplayDescription = `Replay the scheduler decisions recorded in the audit log file of supernode
+and summarize them by task, which helps to debug the pathological scheduling on specific tasks.
+The audit log file is specified by schedulerAuditFile in the configuration of supernode.
+
+The candidates recorded with every decision are fed back through the checks of the scheduler
+with the given elimination limit and peer up limit, and the decisions which come out differently
+from the recorded ones are printed, so the effect of the configuration can be checked offline.`
+
+// newSchedulerReplayCommand returns cobra.Command for "supernode scheduler-replay".
+func newSchedulerReplayCommand() *cobra.Command {
+	var (
+		file             string
+		taskID           string
+		eliminationLimit int
+		peerUpLimit      int
+	)
+
+	cmd := &cobra.Command{
+		Use:           "scheduler-replay",
+		Short:         "Analyze the scheduler decisions recorded in the audit log file",
+		Long:          schedulerReplayDescription,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(file)
+			if err != nil {
+				return errors.Wrapf(err, "failed to open audit log file")
+			}
+			defer f.Close()
+
+			decisions, err := scheduler.ReadDecisions(f)
+			if err != nil {
+				return err
+			}
+
+			cfg := scheduler.ReplayConfig{
+				EliminationLimit: eliminationLimit,
+				PeerUpLimit:      int32(peerUpLimit),
+			}
+			reports := scheduler.Analyze(decisions)
+			if taskID == "" {
+				scheduler.WriteReports(cmd.OutOrStdout(), reports)
+				scheduler.WriteReplay(cmd.OutOrStdout(), scheduler.Replay(decisions, cfg))
+				return nil
+			}
+
+			for _, r := range reports {
+				if r.TaskID == taskID {
+					scheduler.WriteReports(cmd.OutOrStdout(), []*scheduler.TaskReport{r})
+					scheduler.WriteTimeline(cmd.OutOrStdout(), decisions, taskID)
+
+					var taskDecisions []*mgr.SchedulerDecision
+					for _, d := range decisions {
+						if d.TaskID == taskID {
+							taskDecisions = append(taskDecisions, d)
+						}
+					}
+					scheduler.WriteReplay(cmd.OutOrStdout(), scheduler.Replay(taskDecisions, cfg))
+					return nil
+				}
+			}
+			return errors.Errorf("no decision of task %s is found", taskID)
+		},
+	}
+
+	flagSet := cmd.Flags()
+	flagSet.StringVarP(&file, "file", "f", "", "the audit log file of scheduler decisions")
+	flagSet.StringVar(&taskID, "task", "", "only analyze the given task and print the timeline of its decisions")
+	flagSet.IntVar(&eliminationLimit, "elimination-limit", config.DefaultEliminationLimit,
+		"the elimination limit with which the decisions are replayed")
+	flagSet.IntVar(&peerUpLimit, "peer-up-limit", 0,
+		"the peer up limit with which the decisions are replayed, and the recorded one is used if it's 0")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dfdaemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader/dfget"
+	dfgetConfig "github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/uploader"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// adminHealthTimeout is the timeout of pinging supernodes and the peer server
+// to check the health of P2P.
+const adminHealthTimeout = 3 * time.Second
+
+// cacheStats is the number of the entries in the caches of dfdaemon.
+type cacheStats struct {
+	Certs int `json:"certs"`
+	DNS   int `json:"dns"`
+	// LazyFiles is the number of the files of the tasks opened for the lazy reads,
+	// they're not flushed since they may be being read.
+	LazyFiles int `json:"lazyFiles"`
+}
+
+// endpointHealth is the result of pinging a supernode or the peer server.
+type endpointHealth struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"`
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// p2pHealth is the health of the supernodes and the peer server used by the downloads.
+type p2pHealth struct {
+	Supernodes []*endpointHealth `json:"supernodes"`
+	PeerServer *endpointHealth   `json:"peerServer"`
+}
+
+// adminHandler returns the handler of the admin API, the requests are rejected
+// if the admin token isn't set or they don't carry it as the bearer token.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(constant.AdminPath+"requests", s.adminRequests)
+	mux.HandleFunc(constant.AdminPath+"rules", s.adminRules)
+	mux.HandleFunc(constant.AdminPath+"cache", s.adminCache)
+	mux.HandleFunc(constant.AdminPath+"cache/flush", s.adminFlushCache)
+	mux.HandleFunc(constant.AdminPath+"health", s.adminHealth)
+	mux.HandleFunc(constant.AdminPath+"bypass", s.adminBypass)
+	mux.HandleFunc(constant.AdminPath+"groups", s.adminGroups)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			http.Error(w, "admin API is disabled, set adminToken to enable it", http.StatusForbidden)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// adminRequests lists the requests being proxied.
+func (s *Server) adminRequests(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, s.proxy.InFlight())
+}
+
+// adminRules returns the proxy rule matched by the query url with the query method,
+// which is GET by default.
+func (s *Server) adminRules(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		method = http.MethodGet
+	}
+	writeJSON(w, s.proxy.MatchRule(method, url))
+}
+
+// adminCache returns the number of the entries in the caches.
+func (s *Server) adminCache(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, s.cacheStats())
+}
+
+// adminFlushCache flushes the generated certificates and the resolved hostnames.
+func (s *Server) adminFlushCache(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	s.proxy.FlushCaches()
+	logrus.Infof("flush the caches of dfdaemon by the admin API from %s", r.RemoteAddr)
+	writeJSON(w, s.cacheStats())
+}
+
+// adminBypass returns whether the proxy is bypassed, and sets it by PUT with the query enabled.
+func (s *Server) adminBypass(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid enabled: %s", r.URL.Query().Get("enabled")), http.StatusBadRequest)
+			return
+		}
+		s.proxy.SetBypass(enabled)
+		logrus.Infof("set the bypass mode of dfdaemon to %t by the admin API from %s", enabled, r.RemoteAddr)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]bool{"enabled": s.proxy.Bypassed()})
+}
+
+// adminGroups returns the status of the downloads of the task group of the query id,
+// which waits until none of them is running for at most the duration of the query wait.
+func (s *Server) adminGroups(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, fmt.Sprintf("invalid wait: %s", v), http.StatusBadRequest)
+			return
+		}
+		wait = d
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	status := dfget.WaitGroup(ctx, id)
+	if status == nil {
+		http.Error(w, fmt.Sprintf("task group %s not found", id), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, status)
+}
+
+// adminHealth pings the supernodes and the peer server concurrently.
+func (s *Server) adminHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	health := &p2pHealth{
+		Supernodes: make([]*endpointHealth, len(s.supernodes)),
+		PeerServer: &endpointHealth{Error: "peer server isn't running"},
+	}
+	var wg sync.WaitGroup
+	for i, node := range s.supernodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			health.Supernodes[i] = ping(node, "/_ping")
+		}(i, node)
+	}
+	if addr := uploader.PeerServerAddr(); addr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health.PeerServer = ping(addr, dfgetConfig.LocalHTTPPing)
+		}()
+	}
+	wg.Wait()
+	writeJSON(w, health)
+}
+
+func (s *Server) cacheStats() *cacheStats {
+	ps := s.proxy.CacheStats()
+	stats := &cacheStats{Certs: ps.Certs, DNS: ps.DNS}
+	if s.lazyFiles != nil {
+		stats.LazyFiles = s.lazyFiles.Len()
+	}
+	return stats
+}
+
+// ping requests the path of the http server on addr, which is healthy if it responds 200.
+func ping(addr, path string) *endpointHealth {
+	h := &endpointHealth{Addr: addr}
+	start := time.Now()
+	code, _, err := httputils.Get("http://"+addr+path, adminHealthTimeout)
+	h.Latency = time.Since(start).Truncate(time.Microsecond).String()
+	switch {
+	case err != nil:
+		h.Error = err.Error()
+	case code != http.StatusOK:
+		h.Error = fmt.Sprintf("unexpected status code: %d", code)
+	default:
+		h.Healthy = true
+	}
+	return h
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("failed to write the response of admin API: %v", err)
+	}
+}
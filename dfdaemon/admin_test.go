@@ -0,0 +1,76 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dfdaemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandler(t *testing.T) {
+	a := assert.New(t)
+	s, err := New()
+	a.Nil(err)
+
+	serve := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.adminHandler().ServeHTTP(w, req)
+		return w
+	}
+
+	// disabled without the token
+	a.Equal(http.StatusForbidden, serve(http.MethodGet, "/admin/requests", "").Code)
+
+	a.Nil(WithAdminToken("secret")(s))
+	a.Equal(http.StatusUnauthorized, serve(http.MethodGet, "/admin/requests", "").Code)
+	a.Equal(http.StatusUnauthorized, serve(http.MethodGet, "/admin/requests", "wrong").Code)
+	a.Equal(http.StatusOK, serve(http.MethodGet, "/admin/requests", "secret").Code)
+	a.Equal(http.StatusMethodNotAllowed, serve(http.MethodPost, "/admin/requests", "secret").Code)
+	a.Equal(http.StatusBadRequest, serve(http.MethodGet, "/admin/rules", "secret").Code)
+
+	w := serve(http.MethodPut, "/admin/bypass?enabled=true", "secret")
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(`{"enabled":true}`, strings.TrimSpace(w.Body.String()))
+	a.True(s.proxy.Bypassed())
+	a.Equal(http.StatusBadRequest, serve(http.MethodPut, "/admin/bypass?enabled=x", "secret").Code)
+
+	w = serve(http.MethodPost, "/admin/cache/flush", "secret")
+	a.Equal(http.StatusOK, w.Code)
+	stats := &cacheStats{}
+	a.Nil(json.Unmarshal(w.Body.Bytes(), stats))
+	a.Equal(-1, stats.DNS)
+
+	a.Equal(http.StatusBadRequest, serve(http.MethodGet, "/admin/groups", "secret").Code)
+	a.Equal(http.StatusBadRequest, serve(http.MethodGet, "/admin/groups?id=image&wait=x", "secret").Code)
+	a.Equal(http.StatusNotFound, serve(http.MethodGet, "/admin/groups?id=image&wait=1ms", "secret").Code)
+
+	w = serve(http.MethodGet, "/admin/health", "secret")
+	a.Equal(http.StatusOK, w.Code)
+	health := &p2pHealth{}
+	a.Nil(json.Unmarshal(w.Body.Bytes(), health))
+	a.Empty(health.Supernodes)
+	a.False(health.PeerServer.Healthy)
+}
@@ -23,10 +23,13 @@ import (
 	"net/url"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
 	"github.com/dragonflyoss/Dragonfly/pkg/dflog"
 	dferr "github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rate"
 
 	"github.com/pkg/errors"
@@ -35,6 +38,20 @@ import (
 
 var fs = afero.NewOsFs()
 
+// the policies of the download run by dfget when its client disconnects before it finishes.
+const (
+	// ClientDisconnectContinue keeps the download running, so that its pieces are
+	// still downloaded and seeded to the other peers.
+	ClientDisconnectContinue = "continue"
+
+	// ClientDisconnectCancel aborts the download.
+	ClientDisconnectCancel = "cancel"
+
+	// ClientDisconnectDeprioritize keeps the P2P download running at no more than
+	// the min rate of dfget, so that it doesn't compete with the others.
+	ClientDisconnectDeprioritize = "deprioritize"
+)
+
 // -----------------------------------------------------------------------------
 // Properties
 
@@ -67,6 +84,12 @@ var fs = afero.NewOsFs()
 //     # proxy requests with redirect
 //     - regx: some-registry
 //       redirect: another-registry
+//     # proxy requests with dfget, and hold the pieces only in memory
+//     - regx: tiny-disk-registry/.*/blobs/sha256.*
+//       no_disk: true
+//     # proxy the responses less than 64KB directly, and the others with dfget
+//     - regx: some-artifacts/
+//       direct_size: 64KB
 //
 //     hijack_https:
 //       # key pair used to hijack https requests
@@ -113,7 +136,45 @@ type Properties struct {
 	LogConfig  dflog.LogConfig `yaml:"logConfig" json:"logConfig"`
 	LocalIP    string          `yaml:"localIP" json:"localIP"`
 	PeerPort   int             `yaml:"peerPort" json:"peerPort"`
+	P2PIP      string          `yaml:"p2pIP" json:"p2pIP"`
 	StreamMode bool            `yaml:"streamMode" json:"streamMode"`
+
+	// AdvertiseIPs are the other addresses on which the peer server can be reached,
+	// such as the IPv6 one or the ones on the other NICs, which are dialed by the
+	// other peers with the happy eyeballs racing.
+	AdvertiseIPs []string `yaml:"advertiseIPs" json:"advertiseIPs"`
+
+	// AccessLogSampleRate is the rate in [0, 1] of the requests to dfdaemon
+	// which are written to the access log. 0 means that the access log is disabled.
+	AccessLogSampleRate float64 `yaml:"accessLogSampleRate" json:"accessLogSampleRate"`
+
+	// AdminPort is the port on the loopback address to serve the diagnostics endpoints,
+	// such as pprof, expvar and the goroutine dump. 0 means that it's disabled.
+	AdminPort int `yaml:"adminPort" json:"adminPort"`
+
+	// AdminToken is the bearer token authenticating the requests to the admin API
+	// of dfdaemon under /admin/, which is disabled if it's empty. It's never logged.
+	AdminToken string `yaml:"adminToken" json:"-"`
+
+	// DNSCacheTTL is the time for which the addresses of the hostnames resolved
+	// by dfdaemon and the downloads of dfget are cached, and DNSNegativeCacheTTL
+	// is the time for which the failures of resolving them are cached.
+	// The DNS cache is disabled if both of them are 0.
+	DNSCacheTTL         time.Duration `yaml:"dnsCacheTTL" json:"dnsCacheTTL"`
+	DNSNegativeCacheTTL time.Duration `yaml:"dnsNegativeCacheTTL" json:"dnsNegativeCacheTTL"`
+
+	// NoDiskMemoryLimit is the maximal size of the pieces which are received out of order
+	// and held in memory for a download of the proxy rules with no_disk. The download fails
+	// once it's exceeded, and 0 means no limit.
+	NoDiskMemoryLimit fileutils.Fsize `yaml:"noDiskMemoryLimit" json:"noDiskMemoryLimit"`
+
+	// OnClientDisconnect is the policy of the download run by dfget when its client
+	// disconnects before it finishes, one of continue(default), cancel and deprioritize.
+	OnClientDisconnect string `yaml:"onClientDisconnect" json:"onClientDisconnect"`
+
+	// MetricsExporters are the backends which the metrics are pushed to in addition to
+	// being served by /metrics for Prometheus, such as statsd, dogstatsd and otlp.
+	MetricsExporters []*metricsutils.ExporterConfig `yaml:"metricsExporters" json:"metricsExporters"`
 }
 
 // Validate validates the config
@@ -124,6 +185,41 @@ func (p *Properties) Validate() error {
 			"invalid port %d", p.Port,
 		)
 	}
+	if p.AdminPort < 0 || p.AdminPort > 65535 || (p.AdminPort > 0 && uint(p.AdminPort) == p.Port) {
+		return dferr.Newf(
+			constant.CodeExitPortInvalid,
+			"invalid admin port %d", p.AdminPort,
+		)
+	}
+	if p.PeerPort < 0 || p.PeerPort > 65535 {
+		return dferr.Newf(
+			constant.CodeExitPortInvalid,
+			"invalid peer port %d", p.PeerPort,
+		)
+	}
+
+	if p.RateLimit < 0 {
+		return dferr.Newf(
+			constant.CodeExitRateLimitInvalid,
+			"invalid rate limit %s", p.RateLimit,
+		)
+	}
+
+	if p.AccessLogSampleRate < 0 || p.AccessLogSampleRate > 1 {
+		return dferr.Newf(
+			constant.CodeExitConfigError,
+			"access log sample rate %v must be in [0, 1]", p.AccessLogSampleRate,
+		)
+	}
+
+	switch p.OnClientDisconnect {
+	case "", ClientDisconnectContinue, ClientDisconnectCancel, ClientDisconnectDeprioritize:
+	default:
+		return dferr.Newf(
+			constant.CodeExitConfigError,
+			"invalid onClientDisconnect %s", p.OnClientDisconnect,
+		)
+	}
 
 	if !filepath.IsAbs(p.DFRepo) {
 		return dferr.Newf(
@@ -149,10 +245,18 @@ func (p *Properties) DFGetConfig() DFGetConfig {
 		DfgetFlags: dfgetFlags,
 		SuperNodes: p.SuperNodes,
 		RateLimit:  p.RateLimit.String(),
+		WorkHome:   p.WorkHome,
 		DFRepo:     p.DFRepo,
 		DFPath:     p.DFPath,
 		LocalIP:    p.LocalIP,
 		PeerPort:   p.PeerPort,
+		P2PIP:      p.P2PIP,
+
+		AdvertiseIPs:        p.AdvertiseIPs,
+		DNSCacheTTL:         p.DNSCacheTTL,
+		DNSNegativeCacheTTL: p.DNSNegativeCacheTTL,
+		NoDiskMemoryLimit:   p.NoDiskMemoryLimit,
+		OnClientDisconnect:  p.OnClientDisconnect,
 	}
 	if p.HijackHTTPS != nil {
 		dfgetConfig.HostsConfig = p.HijackHTTPS.Hosts
@@ -175,11 +279,22 @@ type DFGetConfig struct {
 	DfgetFlags  []string      `yaml:"dfget_flags"`
 	SuperNodes  []string      `yaml:"supernodes"`
 	RateLimit   string        `yaml:"ratelimit"`
+	WorkHome    string        `yaml:"workHome"`
 	DFRepo      string        `yaml:"localrepo"`
 	DFPath      string        `yaml:"dfpath"`
 	HostsConfig []*HijackHost `yaml:"hosts" json:"hosts"`
 	PeerPort    int           `yaml:"peerPort"`
 	LocalIP     string        `yaml:"localIP"`
+	P2PIP       string        `yaml:"p2pIP"`
+
+	AdvertiseIPs []string `yaml:"advertiseIPs"`
+
+	DNSCacheTTL         time.Duration `yaml:"dnsCacheTTL"`
+	DNSNegativeCacheTTL time.Duration `yaml:"dnsNegativeCacheTTL"`
+
+	NoDiskMemoryLimit fileutils.Fsize `yaml:"noDiskMemoryLimit"`
+
+	OnClientDisconnect string `yaml:"onClientDisconnect"`
 }
 
 // RegistryMirror configures the mirror of the official docker registry
@@ -392,6 +507,14 @@ type Proxy struct {
 	Direct   bool    `yaml:"direct" json:"direct"`
 	// Redirect is the host to redirect to, if not empty
 	Redirect string `yaml:"redirect" json:"redirect"`
+	// NoDisk indicates whether the pieces of the matched requests are held only
+	// in memory and streamed to the response without being written to the disk,
+	// so they can't be seeded to other peers later.
+	NoDisk bool `yaml:"no_disk" json:"no_disk"`
+	// DirectSize is the size below which the responses of the matched requests are
+	// proxied directly instead of with dfget, it's known by a HEAD request to the origin.
+	// 0 means that all of them are proxied with dfget.
+	DirectSize fileutils.Fsize `yaml:"direct_size" json:"direct_size"`
 }
 
 // NewProxy returns a new proxy rule with given attributes.
@@ -72,6 +72,34 @@ func (ts *configTestSuite) TestValidatePort() {
 	}
 }
 
+func (ts *configTestSuite) TestValidateRanges() {
+	c := defaultConfig()
+	r := ts.Require()
+	c.Port = 65001
+
+	c.AdminPort = 65001
+	r.Equal(constant.CodeExitPortInvalid, getCode(c.Validate()))
+	c.AdminPort = 65002
+	r.Nil(c.Validate())
+
+	c.PeerPort = 65536
+	r.Equal(constant.CodeExitPortInvalid, getCode(c.Validate()))
+	c.PeerPort = 0
+
+	c.RateLimit = -1
+	r.Equal(constant.CodeExitRateLimitInvalid, getCode(c.Validate()))
+	c.RateLimit = 0
+
+	c.AccessLogSampleRate = 1.5
+	r.Equal(constant.CodeExitConfigError, getCode(c.Validate()))
+	c.AccessLogSampleRate = 0
+
+	c.OnClientDisconnect = "abort"
+	r.Equal(constant.CodeExitConfigError, getCode(c.Validate()))
+	c.OnClientDisconnect = ClientDisconnectDeprioritize
+	r.Nil(c.Validate())
+}
+
 func (ts *configTestSuite) TestValidateDFRepo() {
 	c := defaultConfig()
 	r := ts.Require()
@@ -265,6 +293,7 @@ func (ts *configTestSuite) TestDFGetConfig() {
 		r.Contains(flagsConfigs.DfgetFlags, "--dfdaemon")
 		r.Equal(c.SuperNodes, flagsConfigs.SuperNodes)
 		r.Equal(c.RateLimit.String(), flagsConfigs.RateLimit)
+		r.Equal(c.WorkHome, flagsConfigs.WorkHome)
 		r.Equal(c.DFRepo, flagsConfigs.DFRepo)
 		r.Equal(c.DFPath, flagsConfigs.DFPath)
 
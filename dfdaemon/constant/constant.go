@@ -51,3 +51,40 @@ const (
 	// Subsystem represents metrics for dfdaemon
 	Subsystem = "dfdaemon"
 )
+
+const (
+	// HeaderErrorReason is the response header which carries the machine-readable
+	// name of the error when dfdaemon fails to serve a request.
+	HeaderErrorReason = "X-Dragonfly-Error-Reason"
+	// HeaderErrorRetryable is the response header which indicates whether
+	// the failed request may succeed if it's retried later.
+	HeaderErrorRetryable = "X-Dragonfly-Error-Retryable"
+	// HeaderSource is the response header which tells where the resource proxied by
+	// dfdaemon comes from, it's one of p2p, cdn, source and direct.
+	// The ID of the task is carried by the header X-Dragonfly-Task.
+	HeaderSource = "X-Dragonfly-Source"
+	// HeaderGroup is the request header which tells the ID of the task group the requested
+	// file belongs to, such as all the layers of an image. It's passed to dfget as --group
+	// instead of being sent to the origin.
+	HeaderGroup = "X-Dragonfly-Group"
+	// HeaderGroupDeadline is the request header which tells the time in RFC3339 by which the
+	// downloads of the group should finish. It's passed to dfget as --group-deadline.
+	HeaderGroupDeadline = "X-Dragonfly-Group-Deadline"
+)
+
+const (
+	// LazyFilePath is the path prefix of dfdaemon to read the file of a task lazily,
+	// such as "/lazy/{taskID}". Only the pieces covering the requested range are fetched.
+	LazyFilePath = "/lazy/"
+
+	// LazyFileCacheDir is the directory in the local repo which caches the fetched pieces.
+	LazyFileCacheDir = "lazy"
+
+	// AdminPath is the path prefix of the admin API of dfdaemon, which inspects
+	// and controls the proxy at runtime. It's authenticated by the admin token.
+	AdminPath = "/admin/"
+
+	// VersionPath is the path of dfdaemon which serves the build information
+	// and the optional features enabled by the config.
+	VersionPath = "/version"
+)
@@ -19,21 +19,34 @@ package dfget
 import (
 	"context"
 	"fmt"
+	"io"
 	netUrl "net/url"
-	"os/exec"
+	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/config"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/exception"
+	dfgetConfig "github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 )
 
+// lastSignMillis is the time in milliseconds in the sign of the last config
+// created by newConfig, which is updated atomically.
+var lastSignMillis int64
+
 // DFGetter implements Downloader to download file by dragonfly.
+// The downloads are run by the core of dfget in the process of dfdaemon,
+// and they share the peer server launched by dfdaemon.
 type DFGetter struct {
 	config config.DFGetConfig
 }
@@ -47,24 +60,239 @@ func NewGetter(cfg config.DFGetConfig) *DFGetter {
 func (dfGetter *DFGetter) DownloadContext(ctx context.Context, url string, header map[string][]string, name string) (string, error) {
 	startTime := time.Now()
 	dstPath := filepath.Join(dfGetter.config.DFRepo, name)
-	cmd := dfGetter.getCommand(ctx, url, header, dstPath)
-	err := cmd.Run()
-	if cmd.ProcessState.Success() {
-		log.Infof("dfget url:%s [SUCCESS] cost:%.3fs", url, time.Since(startTime).Seconds())
-		return dstPath, nil
-	}
-	if value, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
-		if value.ExitStatus() == constant.CodeReqAuth {
+	cfg, err := dfGetter.getConfig(ctx, url, header, dstPath)
+	if err != nil {
+		return "", errors.Wrap(err, "init dfget config")
+	}
+	dfGetter.applyDisconnectPolicy(ctx, cfg)
+	reportProgress(ctx, cfg)
+
+	done := make(chan *errortypes.DfError, 1)
+	finish := groups.start(cfg.Group, url)
+	go func() {
+		dfErr := core.Start(cfg)
+		finish(dfErr)
+		done <- dfErr
+	}()
+
+	select {
+	case dfErr := <-done:
+		if dfErr == nil {
+			log.Infof("dfget url:%s [SUCCESS] cost:%.3fs", url, time.Since(startTime).Seconds())
+			recordProvenance(ctx, cfg, false)
+			return dstPath, nil
+		}
+		if dfErr.Code == constant.CodeReqAuth {
 			return "", &exception.AuthError{}
 		}
+		return "", fmt.Errorf("dfget fail(%d):%v", dfErr.Code, dfErr)
+	case <-ctx.Done():
+		// the download is aborted by the canceled ctx if the policy is cancel,
+		// otherwise it keeps running to seed the pieces to the other peers,
+		// and the target is removed once it finishes since nobody reads it
+		if dfGetter.config.OnClientDisconnect == config.ClientDisconnectDeprioritize {
+			atomic.StoreInt32(&cfg.RV.Deprioritized, 1)
+			log.Infof("dfget url:%s is deprioritized since the client disconnects", url)
+		}
+		go func() {
+			<-done
+			os.Remove(dstPath)
+		}()
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", errors.Wrapf(errortypes.ErrTimeout, "dfget fail:%v", ctx.Err())
+		}
+		return "", fmt.Errorf("dfget fail:%v", ctx.Err())
+	}
+}
+
+// DownloadStreamContext downloads the resources as specified in url, and returns a reader
+// of the data instead of writing it to the local repo. The pieces are held only in memory,
+// so the resource can't be seeded to other peers later.
+func (dfGetter *DFGetter) DownloadStreamContext(ctx context.Context, url string, header map[string][]string, name string) (io.Reader, error) {
+	cfg, err := dfGetter.getConfig(ctx, url, header, filepath.Join(dfGetter.config.DFRepo, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "init dfget config")
+	}
+	cfg.RV.StreamMemoryLimit = int64(dfGetter.config.NoDiskMemoryLimit)
+	dfGetter.applyDisconnectPolicy(ctx, cfg)
+	reportProgress(ctx, cfg)
+
+	reader, dfErr := core.StartStream(cfg)
+	if dfErr != nil {
+		if dfErr.Code == constant.CodeReqAuth {
+			return nil, &exception.AuthError{}
+		}
+		return nil, fmt.Errorf("dfget fail(%d):%v", dfErr.Code, dfErr)
+	}
+	log.Infof("dfget url:%s [STREAMING]", url)
+	recordProvenance(ctx, cfg, true)
+	return reader, nil
+}
+
+// DownloadStreamRangeContext downloads the length bytes of the resource from the offset
+// like DownloadStreamContext. The whole resource is registered as the task, so that
+// the ranges of the same resource share the pieces.
+func (dfGetter *DFGetter) DownloadStreamRangeContext(ctx context.Context, url string, header map[string][]string,
+	name string, offset, length int64) (*downloader.Range, error) {
+	cfg, err := dfGetter.getConfig(ctx, url, header, filepath.Join(dfGetter.config.DFRepo, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "init dfget config")
+	}
+	cfg.RV.StreamMemoryLimit = int64(dfGetter.config.NoDiskMemoryLimit)
+	dfGetter.applyDisconnectPolicy(ctx, cfg)
+	reportProgress(ctx, cfg)
+
+	reader, dfErr := core.StartStreamRange(cfg, offset, length)
+	if dfErr != nil {
+		if dfErr.Code == constant.CodeReqAuth {
+			return nil, &exception.AuthError{}
+		}
+		if dfErr.Code == errortypes.ErrRangeNotSatisfiable.Code {
+			return nil, errors.Wrapf(errortypes.ErrRangeNotSatisfiable, "dfget fail:%v", dfErr)
+		}
+		return nil, fmt.Errorf("dfget fail(%d):%v", dfErr.Code, dfErr)
+	}
+	log.Infof("dfget url:%s [STREAMING] range offset:%d length:%d", url, reader.Offset, reader.Length)
+	recordProvenance(ctx, cfg, true)
+	return &downloader.Range{
+		ReadCloser: reader,
+		Offset:     reader.Offset,
+		Length:     reader.Length,
+		Total:      reader.Total,
+	}, nil
+}
+
+// applyDisconnectPolicy makes the download aborted once ctx is done if the policy
+// on the disconnection of the client is cancel. The download is deprioritized
+// by the caller when it sees ctx done if the policy is deprioritize.
+func (dfGetter *DFGetter) applyDisconnectPolicy(ctx context.Context, cfg *dfgetConfig.Config) {
+	if dfGetter.config.OnClientDisconnect == config.ClientDisconnectCancel {
+		cfg.RV.Context = ctx
+	}
+}
+
+// reportProgress makes the Progress carried by ctx report the bytes downloaded
+// from all the sources and the length of the file, if there is one.
+func reportProgress(ctx context.Context, cfg *dfgetConfig.Config) {
+	p := downloader.ProgressFrom(ctx)
+	if p == nil {
+		return
+	}
+	rv := &cfg.RV
+	p.Report(func() (int64, int64) {
+		completed := atomic.LoadInt64(&rv.PeerBytes) + atomic.LoadInt64(&rv.SupernodeBytes) +
+			atomic.LoadInt64(&rv.SourceBytes) + atomic.LoadInt64(&rv.MirrorBytes) +
+			atomic.LoadInt64(&rv.EdgeBytes)
+		total := atomic.LoadInt64(&rv.FileLength)
+		if total <= 0 {
+			total = -1
+		}
+		return completed, total
+	})
+}
+
+// recordProvenance fills the Provenance carried by ctx if there is one. The source of
+// a finished download is told by the bytes downloaded from each source, and the one of
+// a streaming download is told by the downloader which has just started.
+func recordProvenance(ctx context.Context, cfg *dfgetConfig.Config, streaming bool) {
+	p := downloader.ProvenanceFrom(ctx)
+	if p == nil {
+		return
+	}
+	p.TaskID = cfg.RV.TaskID
+	p.Headers = cfg.RV.ResponseHeaders
+	switch {
+	case cfg.BackSourceReason > 0 || (!streaming && atomic.LoadInt64(&cfg.RV.SourceBytes) > 0):
+		p.Source = downloader.SourceOrigin
+	case cfg.Pattern == dfgetConfig.PatternCDN || (!streaming && atomic.LoadInt64(&cfg.RV.PeerBytes) == 0):
+		p.Source = downloader.SourceCDN
+	default:
+		p.Source = downloader.SourceP2P
 	}
-	return "", fmt.Errorf("dfget fail(%s):%v", cmd.ProcessState.String(), err)
 }
 
-// getCommand returns the command to download the given resource.
-func (dfGetter *DFGetter) getCommand(
+// getConfig returns the config of dfget to download the given resource.
+// It's parsed from the same flags as the dfget command, and the properties
+// are loaded from the config files of dfget.
+func (dfGetter *DFGetter) getConfig(
 	ctx context.Context, url string, header map[string][]string, output string,
-) (cmd *exec.Cmd) {
+) (*dfgetConfig.Config, error) {
+	cfg := newConfig()
+	flagSet := pflag.NewFlagSet("dfget", pflag.ContinueOnError)
+	dfgetConfig.AddFlags(flagSet, cfg)
+	if err := flagSet.Parse(dfGetter.getArgs(url, header, output)); err != nil {
+		return nil, err
+	}
+
+	properties := dfgetConfig.NewProperties()
+	for _, file := range cfg.ConfigFiles {
+		if err := properties.Load(file); err == nil {
+			break
+		}
+	}
+	cfg.MergeProperties(properties)
+
+	if cfg.WorkHome == "" {
+		cfg.WorkHome = dfGetter.config.WorkHome
+	}
+	if cfg.WorkHome == "" {
+		cfg.WorkHome = properties.WorkHome
+	}
+	cfg.RV.MetaPath = filepath.Join(cfg.WorkHome, "meta", "host.meta")
+	cfg.RV.SystemDataDir = filepath.Join(cfg.WorkHome, "data")
+	if cfg.RV.LocalIP == "" {
+		cfg.RV.LocalIP = dfGetter.config.LocalIP
+	}
+	if cfg.P2PIP == "" {
+		cfg.P2PIP = dfGetter.config.P2PIP
+	}
+	if len(cfg.AdvertiseIPs) == 0 {
+		cfg.AdvertiseIPs = dfGetter.config.AdvertiseIPs
+	}
+	if c := dfGetter.config; c.DNSCacheTTL != 0 || c.DNSNegativeCacheTTL != 0 {
+		cfg.DNSCacheTTL, cfg.DNSNegativeCacheTTL = c.DNSCacheTTL, c.DNSNegativeCacheTTL
+	}
+	// the image pulls are interactive, so they're preferred to the batch downloads
+	// unless the priority is specified by the dfget flags.
+	if cfg.Priority == "" {
+		cfg.Priority = dfgetConfig.PriorityHigh
+	}
+	if deadline, ok := ctx.Deadline(); ok && cfg.Timeout == 0 {
+		cfg.Timeout = time.Until(deadline)
+	}
+
+	return cfg, dfgetConfig.AssertConfig(cfg)
+}
+
+// newConfig returns a new config of dfget, whose sign is unique among the downloads
+// in the process so that their temp files and task files don't conflict.
+// The sign is in the same form as the one of the dfget command, which is parsed by
+// dfgetConfig.ParseSign, but its time is advanced by a millisecond if it isn't later
+// than the last one, so the concurrent downloads never share a sign.
+func newConfig() *dfgetConfig.Config {
+	cfg := dfgetConfig.NewConfig()
+	millis := nextSignMillis(cfg.StartTime.UnixNano() / int64(time.Millisecond))
+	cfg.Sign = fmt.Sprintf("%d-%d.%03d", os.Getpid(), millis/1000, millis%1000)
+	return cfg
+}
+
+// nextSignMillis returns the time in milliseconds of the next sign, which is
+// the later one of now and the last one plus a millisecond.
+func nextSignMillis(now int64) int64 {
+	for {
+		last := atomic.LoadInt64(&lastSignMillis)
+		next := now
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastSignMillis, last, next) {
+			return next
+		}
+	}
+}
+
+// getArgs returns the arguments of dfget to download the given resource.
+func (dfGetter *DFGetter) getArgs(url string, header map[string][]string, output string) []string {
 	args := []string{
 		"-u", url,
 		"-o", output,
@@ -87,6 +315,18 @@ func (dfGetter *DFGetter) getCommand(
 		if strings.EqualFold(key, "host") {
 			continue
 		}
+		if strings.EqualFold(key, constant.HeaderGroup) {
+			for _, v := range value {
+				add("--group", v)
+			}
+			continue
+		}
+		if strings.EqualFold(key, constant.HeaderGroupDeadline) {
+			for _, v := range value {
+				add("--group-deadline", v)
+			}
+			continue
+		}
 		if len(value) > 0 {
 			for _, v := range value {
 				add("--header", fmt.Sprintf("%s:%s", key, v))
@@ -108,5 +348,5 @@ func (dfGetter *DFGetter) getCommand(
 		}
 	}
 
-	return exec.CommandContext(ctx, dfGetter.config.DFPath, args...)
+	return args
 }
@@ -0,0 +1,182 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dfget
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/config"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader"
+	dfgetConfig "github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("/tmp", "dfdaemon-TestGetConfig-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	regx, err := config.NewRegexp("a.b.com")
+	assert.Nil(t, err)
+	getter := NewGetter(config.DFGetConfig{
+		DfgetFlags:  []string{"--dfdaemon", "-f", "key&sign"},
+		SuperNodes:  []string{"127.0.0.1:8002"},
+		RateLimit:   "10M",
+		WorkHome:    dir,
+		DFRepo:      dir,
+		HostsConfig: []*config.HijackHost{{Regx: regx, Insecure: true}},
+		LocalIP:     "127.0.0.2",
+
+		DNSCacheTTL:         time.Minute,
+		DNSNegativeCacheTTL: time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	output := filepath.Join(dir, "foo")
+	cfg, err := getter.getConfig(ctx, "http://a.b.com/foo?key=1",
+		map[string][]string{"Host": {"a.b.com"}, "X-Foo": {"bar"},
+			"X-Dragonfly-Group": {"image"}, "X-Dragonfly-Group-Deadline": {"2026-10-14T08:00:00Z"}}, output)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "http://a.b.com/foo?key=1", cfg.URL)
+	assert.Equal(t, output, cfg.Output)
+	assert.True(t, cfg.DFDaemon)
+	assert.True(t, cfg.Insecure)
+	assert.Equal(t, []string{"key", "sign"}, cfg.Filter)
+	assert.Equal(t, []string{"X-Foo:bar"}, cfg.Header)
+	assert.Equal(t, []string{"127.0.0.1:8002"}, cfg.Nodes)
+	assert.Equal(t, 10*rate.MB, cfg.LocalLimit)
+	assert.Equal(t, 10*rate.MB, cfg.TotalLimit)
+	assert.Equal(t, filepath.Join(dir, "meta", "host.meta"), cfg.RV.MetaPath)
+	assert.Equal(t, filepath.Join(dir, "data"), cfg.RV.SystemDataDir)
+	assert.Equal(t, "127.0.0.2", cfg.RV.LocalIP)
+	assert.True(t, cfg.Timeout > 0 && cfg.Timeout <= time.Minute)
+	assert.Equal(t, "high", cfg.Priority)
+	assert.Equal(t, "image", cfg.Group)
+	assert.Equal(t, time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC), cfg.GroupDeadline.UTC())
+	assert.Equal(t, time.Minute, cfg.DNSCacheTTL)
+	assert.Equal(t, time.Second, cfg.DNSNegativeCacheTTL)
+
+	_, err = getter.getConfig(ctx, "invalid", nil, output)
+	assert.NotNil(t, err)
+}
+
+func TestNewConfig(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		wg    sync.WaitGroup
+		signs = make(map[string]bool)
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sign := newConfig().Sign
+			pid, _, ok := dfgetConfig.ParseSign(sign)
+			assert.True(t, ok, sign)
+			assert.Equal(t, os.Getpid(), pid)
+
+			lock.Lock()
+			defer lock.Unlock()
+			assert.False(t, signs[sign], sign)
+			signs[sign] = true
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, signs, 100)
+}
+
+func TestRecordProvenance(t *testing.T) {
+	a := assert.New(t)
+	recordProvenance(context.Background(), dfgetConfig.NewConfig(), false)
+
+	var cases = []struct {
+		pattern    string
+		backSource int
+		peer, src  int64
+		streaming  bool
+		expected   string
+	}{
+		{pattern: dfgetConfig.PatternP2P, peer: 1, expected: downloader.SourceP2P},
+		{pattern: dfgetConfig.PatternP2P, expected: downloader.SourceCDN},
+		{pattern: dfgetConfig.PatternP2P, streaming: true, expected: downloader.SourceP2P},
+		{pattern: dfgetConfig.PatternCDN, streaming: true, expected: downloader.SourceCDN},
+		{pattern: dfgetConfig.PatternP2P, peer: 1, src: 1, expected: downloader.SourceOrigin},
+		{pattern: dfgetConfig.PatternP2P, backSource: dfgetConfig.BackSourceReasonRegisterFail, streaming: true,
+			expected: downloader.SourceOrigin},
+	}
+	for _, c := range cases {
+		cfg := dfgetConfig.NewConfig()
+		cfg.Pattern = c.pattern
+		cfg.BackSourceReason = c.backSource
+		cfg.RV.PeerBytes, cfg.RV.SourceBytes = c.peer, c.src
+		cfg.RV.TaskID = "foo"
+		cfg.RV.ResponseHeaders = map[string]string{"Content-Type": "text/plain"}
+		ctx, p := downloader.WithProvenance(context.Background())
+		recordProvenance(ctx, cfg, c.streaming)
+		a.Equal(c.expected, p.Source, "%+v", c)
+		a.Equal("foo", p.TaskID)
+		a.Equal(cfg.RV.ResponseHeaders, p.Headers)
+	}
+}
+
+func TestApplyDisconnectPolicy(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, policy := range []string{"", config.ClientDisconnectContinue, config.ClientDisconnectDeprioritize} {
+		cfg := dfgetConfig.NewConfig()
+		NewGetter(config.DFGetConfig{OnClientDisconnect: policy}).applyDisconnectPolicy(ctx, cfg)
+		a.Nil(cfg.RV.Context, policy)
+	}
+
+	cfg := dfgetConfig.NewConfig()
+	NewGetter(config.DFGetConfig{OnClientDisconnect: config.ClientDisconnectCancel}).applyDisconnectPolicy(ctx, cfg)
+	a.Equal(ctx, cfg.RV.Context)
+}
+
+func TestReportProgress(t *testing.T) {
+	a := assert.New(t)
+	cfg := dfgetConfig.NewConfig()
+	reportProgress(context.Background(), cfg)
+
+	ctx, p := downloader.WithProgress(context.Background())
+	_, _, ok := p.Get()
+	a.False(ok)
+
+	reportProgress(ctx, cfg)
+	completed, total, ok := p.Get()
+	a.True(ok)
+	a.Zero(completed)
+	a.Equal(int64(-1), total)
+
+	cfg.RV.PeerBytes, cfg.RV.SupernodeBytes, cfg.RV.SourceBytes = 1, 2, 3
+	cfg.RV.FileLength = 10
+	completed, total, _ = p.Get()
+	a.Equal(int64(6), completed)
+	a.Equal(int64(10), total)
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dfget
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+)
+
+// groupRetention is the time for which a task group is kept after its last download
+// finishes, so the clients can still tell whether it has completed.
+const groupRetention = time.Hour
+
+/* the statuses of the downloads of a task group */
+const (
+	GroupDownloadRunning = "RUNNING"
+	GroupDownloadSuccess = "SUCCESS"
+	GroupDownloadFailed  = "FAILED"
+)
+
+// GroupDownload is a download of a task group run by dfdaemon.
+type GroupDownload struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GroupStatus is the status of the downloads of a task group run by dfdaemon.
+type GroupStatus struct {
+	ID string `json:"id"`
+	// Completed tells whether all the downloads of the group have finished successfully.
+	Completed bool             `json:"completed"`
+	Running   int              `json:"running"`
+	Failed    int              `json:"failed"`
+	Downloads []*GroupDownload `json:"downloads"`
+}
+
+type trackedGroup struct {
+	downloads []*GroupDownload
+	running   int
+	// idle is closed once no download of the group is running.
+	idle     chan struct{}
+	finished time.Time
+}
+
+// groupTracker tracks the downloads of the task groups run by the getters
+// in the process, so the clients could wait for all of them to finish.
+type groupTracker struct {
+	sync.Mutex
+	groups map[string]*trackedGroup
+
+	now func() time.Time
+}
+
+// groups is the tracker of the task groups downloaded by dfdaemon.
+var groups = newGroupTracker()
+
+func newGroupTracker() *groupTracker {
+	return &groupTracker{
+		groups: make(map[string]*trackedGroup),
+		now:    time.Now,
+	}
+}
+
+// start tracks a download of the group, and returns the function
+// to be called with the result once it finishes.
+func (t *groupTracker) start(id, url string) func(*errortypes.DfError) {
+	if id == "" {
+		return func(*errortypes.DfError) {}
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	now := t.now()
+	for k, g := range t.groups {
+		if g.running == 0 && now.Sub(g.finished) > groupRetention {
+			delete(t.groups, k)
+		}
+	}
+	g, ok := t.groups[id]
+	if !ok {
+		g = &trackedGroup{}
+		t.groups[id] = g
+	}
+	if g.running == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.running++
+	// a retried download of the same url replaces the last result
+	var d *GroupDownload
+	for _, v := range g.downloads {
+		if v.URL == url {
+			d = v
+			d.Status, d.Error = GroupDownloadRunning, ""
+		}
+	}
+	if d == nil {
+		d = &GroupDownload{URL: url, Status: GroupDownloadRunning}
+		g.downloads = append(g.downloads, d)
+	}
+
+	return func(dfErr *errortypes.DfError) {
+		t.Lock()
+		defer t.Unlock()
+		if dfErr != nil {
+			d.Status, d.Error = GroupDownloadFailed, dfErr.Error()
+		} else {
+			d.Status = GroupDownloadSuccess
+		}
+		g.running--
+		if g.running == 0 {
+			g.finished = t.now()
+			close(g.idle)
+		}
+	}
+}
+
+// wait waits until no download of the group is running or ctx is done,
+// and returns the status of the group. It returns nil if the group isn't found.
+func (t *groupTracker) wait(ctx context.Context, id string) *GroupStatus {
+	t.Lock()
+	g, ok := t.groups[id]
+	var idle chan struct{}
+	if ok {
+		idle = g.idle
+	}
+	t.Unlock()
+	if !ok {
+		return nil
+	}
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	status := &GroupStatus{ID: id, Running: g.running}
+	for _, d := range g.downloads {
+		if d.Status == GroupDownloadFailed {
+			status.Failed++
+		}
+		download := *d
+		status.Downloads = append(status.Downloads, &download)
+	}
+	status.Completed = status.Running == 0 && status.Failed == 0
+	return status
+}
+
+// WaitGroup waits until no download of the task group run by dfdaemon is running
+// or ctx is done, and returns the status of the group. It returns nil if no download
+// of the group has been run within groupRetention.
+func WaitGroup(ctx context.Context, id string) *GroupStatus {
+	return groups.wait(ctx, id)
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dfget
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupTracker(t *testing.T) {
+	a := assert.New(t)
+	tracker := newGroupTracker()
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	a.Nil(tracker.wait(ctx, "image"))
+	tracker.start("", "http://a.com/0")(nil)
+	a.Empty(tracker.groups)
+
+	finish1 := tracker.start("image", "http://a.com/1")
+	finish2 := tracker.start("image", "http://a.com/2")
+
+	// it doesn't block beyond ctx
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	status := tracker.wait(timeout, "image")
+	a.Equal(2, status.Running)
+	a.False(status.Completed)
+
+	done := make(chan *GroupStatus)
+	go func() {
+		done <- tracker.wait(ctx, "image")
+	}()
+	finish1(nil)
+	select {
+	case <-done:
+		t.Fatal("wait returns with a running download")
+	case <-time.After(10 * time.Millisecond):
+	}
+	finish2(errortypes.New(1, "failed"))
+	status = <-done
+	a.Equal(0, status.Running)
+	a.Equal(1, status.Failed)
+	a.False(status.Completed)
+	a.Equal(GroupDownloadSuccess, status.Downloads[0].Status)
+	a.Equal(GroupDownloadFailed, status.Downloads[1].Status)
+
+	// a retried download replaces the failed one
+	tracker.start("image", "http://a.com/2")(nil)
+	status = tracker.wait(ctx, "image")
+	a.True(status.Completed)
+	a.Len(status.Downloads, 2)
+
+	// the finished groups are removed after groupRetention
+	now = now.Add(groupRetention + time.Second)
+	tracker.start("other", "http://a.com/4")(nil)
+	a.Nil(tracker.wait(ctx, "image"))
+	a.True(tracker.wait(ctx, "other").Completed)
+}
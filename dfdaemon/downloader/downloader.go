@@ -19,6 +19,7 @@ package downloader
 import (
 	"context"
 	"io"
+	"sync"
 )
 
 // Interface specifies on how an plugin can download a file.
@@ -34,6 +35,108 @@ type Stream interface {
 	DownloadStreamContext(ctx context.Context, url string, header map[string][]string, name string) (io.Reader, error)
 }
 
+// RangeStream is implemented by the Stream which can download a range of the resource,
+// so that the partial content requests are served without reading the whole resource.
+type RangeStream interface {
+	// DownloadStreamRangeContext downloads the length bytes of the resource from the offset,
+	// and it's read to the end of the resource if the length is negative.
+	DownloadStreamRangeContext(ctx context.Context, url string, header map[string][]string, name string,
+		offset, length int64) (*Range, error)
+}
+
+// Range is a range of the resource downloaded by RangeStream.
+type Range struct {
+	io.ReadCloser
+	// Offset is the offset of the range in the resource.
+	Offset int64
+	// Length is the length of the range, it's -1 if it's unknown.
+	Length int64
+	// Total is the length of the whole resource, it's -1 if it's unknown.
+	Total int64
+}
+
+// the sources of the resources told by Provenance.
+const (
+	// SourceP2P means that the pieces are scheduled by supernode among the peers and supernode.
+	SourceP2P = "p2p"
+	// SourceCDN means that all the pieces are downloaded from the CDN of supernode.
+	SourceCDN = "cdn"
+	// SourceOrigin means that the resource is downloaded from the source station by dfget.
+	SourceOrigin = "source"
+	// SourceDirect means that the request is sent to the origin directly without dfget.
+	SourceDirect = "direct"
+)
+
+// Provenance tells where the resource downloaded by a downloader comes from.
+type Provenance struct {
+	// Source is one of SourceP2P, SourceCDN and SourceOrigin.
+	Source string
+	// TaskID is the ID of the task registered to supernode,
+	// it's empty if the task isn't registered.
+	TaskID string
+	// Headers are the headers of the response of the source kept with the task
+	// by supernode, which are replayed on the response to the client.
+	Headers map[string]string
+}
+
+type provenanceKey struct{}
+
+// WithProvenance returns a copy of ctx which carries a Provenance. The downloaders
+// supporting it fill the Provenance when the download starts if it's streamed,
+// or when it finishes successfully otherwise.
+func WithProvenance(ctx context.Context) (context.Context, *Provenance) {
+	p := &Provenance{}
+	return context.WithValue(ctx, provenanceKey{}, p), p
+}
+
+// ProvenanceFrom returns the Provenance carried by ctx, it's nil if there isn't one.
+func ProvenanceFrom(ctx context.Context) *Provenance {
+	p, _ := ctx.Value(provenanceKey{}).(*Provenance)
+	return p
+}
+
+// Progress reports the progress of a download. The downloaders supporting it set
+// the function reporting the progress once the download starts.
+type Progress struct {
+	mu     sync.Mutex
+	report func() (completed, total int64)
+}
+
+type progressKey struct{}
+
+// WithProgress returns a copy of ctx which carries a Progress.
+func WithProgress(ctx context.Context) (context.Context, *Progress) {
+	p := &Progress{}
+	return context.WithValue(ctx, progressKey{}, p), p
+}
+
+// ProgressFrom returns the Progress carried by ctx, it's nil if there isn't one.
+func ProgressFrom(ctx context.Context) *Progress {
+	p, _ := ctx.Value(progressKey{}).(*Progress)
+	return p
+}
+
+// Report sets the function which returns the bytes downloaded and the length
+// of the resource, which is -1 if it's unknown.
+func (p *Progress) Report(report func() (completed, total int64)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.report = report
+}
+
+// Get returns the bytes downloaded and the length of the resource,
+// and ok is false if the download hasn't started.
+func (p *Progress) Get() (completed, total int64, ok bool) {
+	p.mu.Lock()
+	report := p.report
+	p.mu.Unlock()
+	if report == nil {
+		return 0, 0, false
+	}
+	completed, total = report()
+	return completed, total, true
+}
+
 // Factory is a function that returns a new downloader.
 type Factory func() Interface
 type StreamFactory func() Stream
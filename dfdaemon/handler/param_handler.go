@@ -20,16 +20,19 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
 	"github.com/sirupsen/logrus"
 )
 
-// getArgs returns all the arguments of command-line except the program name.
+// getArgs returns all the arguments of command-line except the program name,
+// the values of the sensitive headers are redacted.
 func getArgs(w http.ResponseWriter, r *http.Request) {
 	logrus.Debugf("access:%s", r.URL.String())
 
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/plain;charset=utf-8")
-	for index, value := range os.Args {
+	for index, value := range httputils.RedactHeaderArgs(os.Args) {
 		if index > 0 {
 			if _, err := w.Write([]byte(value + " ")); err != nil {
 				logrus.Errorf("failed to respond information: %v", err)
@@ -0,0 +1,175 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/config"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader"
+)
+
+// InFlightRequest is a request being proxied by dfdaemon.
+type InFlightRequest struct {
+	ID     uint64 `json:"id"`
+	Method string `json:"method"`
+	// URL is the url of the request without the query,
+	// which may carry the signatures of the origin.
+	URL    string `json:"url"`
+	Client string `json:"client"`
+	// Hijacked tells whether the request is an https one hijacked by dfdaemon.
+	Hijacked bool      `json:"hijacked"`
+	Start    time.Time `json:"start"`
+	Elapsed  string    `json:"elapsed"`
+	// Downloaded and Total are the bytes downloaded by dfget for the request and
+	// the length of the resource, which are omitted before the download starts.
+	// Total is -1 if the length is unknown.
+	Downloaded int64 `json:"downloaded,omitempty"`
+	Total      int64 `json:"total,omitempty"`
+
+	progress *downloader.Progress
+}
+
+// RuleMatch is the proxy rule matched by a request.
+type RuleMatch struct {
+	// Index is the index of the rule in the rules, it's -1 if no rule is matched.
+	Index int           `json:"index"`
+	Rule  *config.Proxy `json:"rule,omitempty"`
+	// UseDfget tells whether the request is proxied with dfget,
+	// which is false for all the requests while the proxy is bypassed.
+	UseDfget bool `json:"useDfget"`
+	Bypassed bool `json:"bypassed"`
+}
+
+// CacheStats is the number of the entries in the caches of the proxy.
+type CacheStats struct {
+	// Certs is the number of the leaf certificates generated for the hijacked hosts.
+	Certs int `json:"certs"`
+	// DNS is the number of the cached hostnames, it's -1 if the DNS cache is disabled.
+	DNS int `json:"dns"`
+}
+
+// SetBypass sets whether the requests matching the rules are proxied directly
+// instead of with dfget, which takes effect for the requests received after.
+func (proxy *Proxy) SetBypass(bypass bool) {
+	var v int32
+	if bypass {
+		v = 1
+	}
+	atomic.StoreInt32(&proxy.bypass, v)
+}
+
+// Bypassed returns whether the requests are proxied directly.
+func (proxy *Proxy) Bypassed() bool {
+	return atomic.LoadInt32(&proxy.bypass) == 1
+}
+
+// MatchRule returns the proxy rule matched by the request with the method and the url.
+func (proxy *Proxy) MatchRule(method, rawURL string) *RuleMatch {
+	m := &RuleMatch{Index: -1, Bypassed: proxy.Bypassed()}
+	for i, rule := range proxy.rules {
+		if rule.Match(rawURL) {
+			m.Index = i
+			m.Rule = rule
+			m.UseDfget = method == http.MethodGet && !rule.Direct && !m.Bypassed
+			break
+		}
+	}
+	return m
+}
+
+// InFlight returns the requests being proxied, the longest running ones first.
+func (proxy *Proxy) InFlight() []*InFlightRequest {
+	var result []*InFlightRequest
+	now := time.Now()
+	proxy.inFlight.Range(func(_, value interface{}) bool {
+		r := *value.(*InFlightRequest)
+		r.Elapsed = now.Sub(r.Start).Truncate(time.Millisecond).String()
+		if r.progress != nil {
+			if completed, total, ok := r.progress.Get(); ok {
+				r.Downloaded, r.Total = completed, total
+			}
+		}
+		result = append(result, &r)
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// CacheStats returns the number of the entries in the caches of the proxy.
+func (proxy *Proxy) CacheStats() *CacheStats {
+	stats := &CacheStats{DNS: -1}
+	proxy.certCacheLock.Lock()
+	if proxy.certCache != nil {
+		stats.Certs = proxy.certCache.Len()
+	}
+	proxy.certCacheLock.Unlock()
+	if proxy.dnsCache != nil {
+		stats.DNS = proxy.dnsCache.Len()
+	}
+	return stats
+}
+
+// FlushCaches removes the generated certificates and the resolved hostnames,
+// so that they're generated and resolved again by the next requests.
+func (proxy *Proxy) FlushCaches() {
+	proxy.certCacheLock.Lock()
+	if proxy.certCache != nil {
+		proxy.certCache.Clear()
+	}
+	proxy.certCacheLock.Unlock()
+	if proxy.dnsCache != nil {
+		proxy.dnsCache.Flush()
+	}
+}
+
+// track records the request as in flight until the returned function is called.
+// The returned request carries the Progress of the download of dfget for it.
+func (proxy *Proxy) track(r *http.Request, hijacked bool) (tracked *http.Request, untrack func()) {
+	u := url.URL{Scheme: r.URL.Scheme, Host: r.URL.Host, Path: r.URL.Path}
+	if hijacked {
+		u.Scheme, u.Host = "https", r.Host
+	}
+	id := atomic.AddUint64(&proxy.nextRequestID, 1)
+	ctx, progress := downloader.WithProgress(r.Context())
+	proxy.inFlight.Store(id, &InFlightRequest{
+		ID:       id,
+		Method:   r.Method,
+		URL:      u.String(),
+		Client:   r.RemoteAddr,
+		Hijacked: hijacked,
+		Start:    time.Now(),
+		progress: progress,
+	})
+	return r.WithContext(ctx), func() { proxy.inFlight.Delete(id) }
+}
+
+// trackHijacked records the hijacked https requests served by h as in flight.
+func (proxy *Proxy) trackHijacked(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, untrack := proxy.track(r, true)
+		defer untrack()
+		h.ServeHTTP(w, r)
+	})
+}
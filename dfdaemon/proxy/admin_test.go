@@ -0,0 +1,114 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/config"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBypass(t *testing.T) {
+	a := assert.New(t)
+	direct, err := config.NewProxy("/a/b", false, true, "")
+	a.Nil(err)
+	other, err := config.NewProxy("/a", true, false, "")
+	a.Nil(err)
+	tp, err := New(WithRules([]*config.Proxy{direct, other}))
+	a.Nil(err)
+
+	m := tp.MatchRule(http.MethodGet, "http://h/a/c")
+	a.Equal(1, m.Index)
+	a.Equal(other, m.Rule)
+	a.True(m.UseDfget)
+	a.False(tp.MatchRule(http.MethodGet, "http://h/a/b").UseDfget)
+	a.False(tp.MatchRule(http.MethodHead, "http://h/a/c").UseDfget)
+	m = tp.MatchRule(http.MethodGet, "http://h/x")
+	a.Equal(-1, m.Index)
+	a.Nil(m.Rule)
+
+	tp.SetBypass(true)
+	a.True(tp.Bypassed())
+	m = tp.MatchRule(http.MethodGet, "http://h/a/c")
+	a.Equal(1, m.Index)
+	a.False(m.UseDfget)
+	a.True(m.Bypassed)
+	// the rule is still applied except that the request is proxied directly
+	req, _ := http.NewRequest(http.MethodGet, "http://h/a/c", nil)
+	a.False(tp.shouldUseDfget(req))
+	a.Equal("https", req.URL.Scheme)
+
+	tp.SetBypass(false)
+	a.True(tp.shouldUseDfget(req))
+}
+
+func TestInFlight(t *testing.T) {
+	a := assert.New(t)
+	tp, err := New()
+	a.Nil(err)
+	a.Empty(tp.InFlight())
+
+	first := httptest.NewRequest(http.MethodGet, "http://h/a?signature=s", nil)
+	tracked, untrack := tp.track(first, false)
+	second := httptest.NewRequest(http.MethodGet, "/b", nil)
+	second.Host = "secure"
+	var inFlight []*InFlightRequest
+	tp.trackHijacked(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = tp.InFlight()
+	})).ServeHTTP(httptest.NewRecorder(), second)
+
+	if a.Len(inFlight, 2) {
+		a.Equal("http://h/a", inFlight[0].URL)
+		a.False(inFlight[0].Hijacked)
+		a.Zero(inFlight[0].Total)
+		a.Equal("https://secure/b", inFlight[1].URL)
+		a.True(inFlight[1].Hijacked)
+	}
+
+	// the progress is reported once dfget starts downloading for the request
+	downloader.ProgressFrom(tracked.Context()).Report(func() (int64, int64) { return 10, 100 })
+	if inFlight = tp.InFlight(); a.Len(inFlight, 1) {
+		a.Equal(int64(10), inFlight[0].Downloaded)
+		a.Equal(int64(100), inFlight[0].Total)
+	}
+	untrack()
+	a.Empty(tp.InFlight())
+}
+
+func TestCacheStats(t *testing.T) {
+	a := assert.New(t)
+	tp, err := New()
+	a.Nil(err)
+	a.Equal(&CacheStats{DNS: -1}, tp.CacheStats())
+	tp.FlushCaches()
+
+	tp, err = New(WithDNSCache(netutils.NewDNSCache(time.Minute, 0)))
+	a.Nil(err)
+	tp.certCache = lru.New(10)
+	tp.certCache.Add("h", nil)
+	a.Equal(&CacheStats{Certs: 1, DNS: 0}, tp.CacheStats())
+	tp.FlushCaches()
+	a.Equal(&CacheStats{Certs: 0, DNS: 0}, tp.CacheStats())
+}
@@ -24,15 +24,20 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/config"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader/dfget"
-	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader/p2p"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/transport"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
 	"github.com/golang/groupcache/lru"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -122,6 +127,15 @@ func WithStreamDownloaderFactory(f downloader.StreamFactory) Option {
 	}
 }
 
+// WithDNSCache sets the DNSCache which resolves the hosts of the requests
+// proxied directly, the hosts are resolved by every connection if it's nil.
+func WithDNSCache(c *netutils.DNSCache) Option {
+	return func(p *Proxy) error {
+		p.dnsCache = c
+		return nil
+	}
+}
+
 // New returns a new transparent proxy with the given rules
 func New(opts ...Option) (*Proxy, error) {
 	proxy := &Proxy{
@@ -133,6 +147,10 @@ func New(opts ...Option) (*Proxy, error) {
 			return nil, err
 		}
 	}
+	proxy.client = transport.NewClient(nil, proxy.dnsCache)
+	if proxy.registry != nil {
+		proxy.mirrorClient = transport.NewClient(proxy.registry.TLSConfig(), proxy.dnsCache)
+	}
 
 	return proxy, nil
 }
@@ -146,9 +164,10 @@ func NewFromConfig(c config.Properties) (*Proxy, error) {
 			return dfget.NewGetter(c.DFGetConfig())
 		}),
 		WithStreamDownloaderFactory(func() downloader.Stream {
-			return p2p.NewClient(c.DFGetConfig())
+			return dfget.NewGetter(c.DFGetConfig())
 		}),
 		WithStreamMode(c.StreamMode),
+		WithDNSCache(netutils.GetDNSCache(c.DNSCacheTTL, c.DNSNegativeCacheTTL)),
 	}
 
 	logrus.Infof("registry mirror: %s", c.RegistryMirror.Remote)
@@ -164,6 +183,9 @@ func NewFromConfig(c config.Properties) (*Proxy, error) {
 			if r.UseHTTPS {
 				scheme = "and force https"
 			}
+			if r.NoDisk && !r.Direct {
+				method += " in memory"
+			}
 			logrus.Infof("[%d] proxy %s %s %s", i+1, r.Regx, method, scheme)
 		}
 	}
@@ -194,21 +216,40 @@ type Proxy struct {
 	// cert is the certificate used to hijack https proxy requests
 	cert *tls.Certificate
 	// certCache is a in-memory cache store for TLS certs used in HTTPS hijack. Lazy init.
-	certCache *lru.Cache
+	certCache     *lru.Cache
+	certCacheLock sync.Mutex
 	// directHandler are used to handle non proxy requests
 	directHandler http.Handler
 	// downloadFactory returns the downloader used for p2p downloading
 	downloadFactory       downloader.Factory
 	streamDownloadFactory downloader.StreamFactory
 	streamMode            bool
+	// dnsCache resolves the hosts of the requests which are not proxied with dfget
+	dnsCache *netutils.DNSCache
+	// client and mirrorClient send the proxy requests and the registry mirror requests
+	// which are not proxied with dfget, whose connections are reused by the requests.
+	client       *httputils.Client
+	mirrorClient *httputils.Client
+
+	// bypass is 1 if the requests matching the rules are proxied directly
+	// instead of with dfget, it's toggled at runtime by the admin API.
+	bypass int32
+	// inFlight records the requests being proxied, the key is the ID
+	// of the request, and the value is *InFlightRequest.
+	inFlight      sync.Map
+	nextRequestID uint64
 }
 
 func (proxy *Proxy) mirrorRegistry(w http.ResponseWriter, r *http.Request) {
 	reverseProxy := httputil.NewSingleHostReverseProxy(proxy.registry.Remote.URL)
+	client := proxy.mirrorClient
+	if client == nil {
+		client = transport.NewClient(proxy.registry.TLSConfig(), proxy.dnsCache)
+	}
 	t, err := transport.New(
 		transport.WithDownloader(proxy.downloadFactory()),
 		transport.WithStreamDownloader(proxy.streamDownloadFactory()),
-		transport.WithTLS(proxy.registry.TLSConfig()),
+		transport.WithClient(client),
 		transport.WithCondition(proxy.shouldUseDfgetForMirror),
 	)
 	if err != nil {
@@ -233,6 +274,24 @@ func (proxy *Proxy) remoteConfig(host string) *tls.Config {
 	return nil
 }
 
+// Features returns the optional features enabled by the options of the proxy.
+func (proxy *Proxy) Features() []string {
+	var features []string
+	if proxy.registry != nil && proxy.registry.Remote != nil {
+		features = append(features, "registry-mirror")
+	}
+	if proxy.cert != nil && len(proxy.httpsHosts) > 0 {
+		features = append(features, "hijack-https")
+	}
+	if proxy.streamMode {
+		features = append(features, "stream-mode")
+	}
+	if proxy.dnsCache != nil {
+		features = append(features, "dns-cache")
+	}
+	return features
+}
+
 // SetRules changes the rule lists of the proxy to the given rules.
 func (proxy *Proxy) SetRules(rules []*config.Proxy) error {
 	proxy.rules = rules
@@ -249,6 +308,8 @@ func (proxy *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		proxy.directHandler.ServeHTTP(w, r)
 	} else {
 		// handle http proxy requests
+		r, untrack := proxy.track(r, false)
+		defer untrack()
 		proxy.handleHTTP(w, r)
 	}
 }
@@ -256,7 +317,7 @@ func (proxy *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (proxy *Proxy) handleHTTP(w http.ResponseWriter, req *http.Request) {
 	resp, err := proxy.roundTripper(nil).RoundTrip(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		writeError(w, err, http.StatusServiceUnavailable)
 		return
 	}
 	defer resp.Body.Close()
@@ -267,12 +328,20 @@ func (proxy *Proxy) handleHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// roundTripper returns the round tripper of the proxy requests. The ones of the hijacked
+// https connections have their own tlsConfig, and the others share the client of the proxy.
 func (proxy *Proxy) roundTripper(tlsConfig *tls.Config) http.RoundTripper {
+	client := proxy.client
+	if tlsConfig != nil || client == nil {
+		client = transport.NewClient(tlsConfig, proxy.dnsCache)
+	}
 	rt, _ := transport.New(
 		transport.WithDownloader(proxy.downloadFactory()),
 		transport.WithStreamDownloader(proxy.streamDownloadFactory()),
-		transport.WithTLS(tlsConfig),
+		transport.WithClient(client),
 		transport.WithCondition(proxy.shouldUseDfget),
+		transport.WithNoDiskCondition(proxy.shouldStreamInMemory),
+		transport.WithDirectSizeCondition(proxy.directSize),
 	)
 	return rt
 }
@@ -294,7 +363,37 @@ func (proxy *Proxy) shouldUseDfget(req *http.Request) bool {
 				req.URL.Host = rule.Redirect
 				req.Host = rule.Redirect
 			}
-			return !rule.Direct
+			return !rule.Direct && !proxy.Bypassed()
+		}
+	}
+	return false
+}
+
+// directSize returns the size below which the response of the request is proxied directly,
+// which is decided by the first matched rule.
+func (proxy *Proxy) directSize(req *http.Request) int64 {
+	if req.Method != http.MethodGet {
+		return 0
+	}
+
+	for _, rule := range proxy.rules {
+		if rule.Match(req.URL.String()) {
+			return int64(rule.DirectSize)
+		}
+	}
+	return 0
+}
+
+// shouldStreamInMemory returns whether the request proxied with dfget is streamed
+// from the pieces held only in memory, which is decided by the first matched rule.
+func (proxy *Proxy) shouldStreamInMemory(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+
+	for _, rule := range proxy.rules {
+		if rule.Match(req.URL.String()) {
+			return rule.NoDisk
 		}
 	}
 	return false
@@ -303,14 +402,19 @@ func (proxy *Proxy) shouldUseDfget(req *http.Request) bool {
 // shouldUseDfgetForMirror returns whether we should use dfget to proxy a request
 // when we use registry mirror.
 func (proxy *Proxy) shouldUseDfgetForMirror(req *http.Request) bool {
-	return proxy.registry != nil && !proxy.registry.Direct && transport.NeedUseGetter(req)
+	return proxy.registry != nil && !proxy.registry.Direct && !proxy.Bypassed() && transport.NeedUseGetter(req)
 }
 
 // tunnelHTTPS handles a CONNECT request and proxy an https request through an
 // http tunnel.
-func tunnelHTTPS(w http.ResponseWriter, r *http.Request) {
+func (proxy *Proxy) tunnelHTTPS(w http.ResponseWriter, r *http.Request) {
 	logrus.Debugf("Tunneling https request for %s", r.Host)
-	dst, err := net.DialTimeout("tcp", r.Host, 10*time.Second)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	dial := dialer.DialContext
+	if proxy.dnsCache != nil {
+		dial = proxy.dnsCache.DialContext(dialer)
+	}
+	dst, err := dial(r.Context(), "tcp", r.Host)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
@@ -332,13 +436,13 @@ func tunnelHTTPS(w http.ResponseWriter, r *http.Request) {
 
 func (proxy *Proxy) handleHTTPS(w http.ResponseWriter, r *http.Request) {
 	if proxy.cert == nil {
-		tunnelHTTPS(w, r)
+		proxy.tunnelHTTPS(w, r)
 		return
 	}
 
 	cConfig := proxy.remoteConfig(r.Host)
 	if cConfig == nil {
-		tunnelHTTPS(w, r)
+		proxy.tunnelHTTPS(w, r)
 		return
 	}
 
@@ -346,9 +450,11 @@ func (proxy *Proxy) handleHTTPS(w http.ResponseWriter, r *http.Request) {
 
 	sConfig := new(tls.Config)
 	if proxy.cert.Leaf != nil && proxy.cert.Leaf.IsCA {
+		proxy.certCacheLock.Lock()
 		if proxy.certCache == nil { // Initialize proxy.certCache on first access. (Lazy init)
 			proxy.certCache = lru.New(100) // Default max entries size = 100
 		}
+		proxy.certCacheLock.Unlock()
 		logrus.Debugf("hijack https request with CA <%s>", proxy.cert.Leaf.Subject.CommonName)
 		leafCertSpec := LeafCertSpec{
 			proxy.cert.Leaf.PublicKey,
@@ -360,6 +466,8 @@ func (proxy *Proxy) handleHTTPS(w http.ResponseWriter, r *http.Request) {
 			logrus.Debugf("Generate temporal leaf TLS cert for ServerName <%s>, host <%s>", hello.ServerName, host)
 			// It's assumed that `hello.ServerName` is always same as `host`, in practice.
 			cacheKey := host
+			proxy.certCacheLock.Lock()
+			defer proxy.certCacheLock.Unlock()
 			cached, hit := proxy.certCache.Get(cacheKey)
 			if hit && time.Now().Before(cached.(*tls.Certificate).Leaf.NotAfter) { // If cache hit and the cert is not expired
 				logrus.Debugf("TLS Cache hit, cacheKey = <%s>", cacheKey)
@@ -392,13 +500,14 @@ func (proxy *Proxy) handleHTTPS(w http.ResponseWriter, r *http.Request) {
 	}
 	cConn.Close()
 
-	rp := &httputil.ReverseProxy{
+	var rp http.Handler = &httputil.ReverseProxy{
 		Director: func(r *http.Request) {
 			r.URL.Host = r.Host
 			r.URL.Scheme = "https"
 		},
 		Transport: proxy.roundTripper(cConfig),
 	}
+	rp = proxy.trackHijacked(rp)
 
 	// We have to wait until the connection is closed
 	wg := sync.WaitGroup{}
@@ -410,6 +519,20 @@ func (proxy *Proxy) handleHTTPS(w http.ResponseWriter, r *http.Request) {
 	wg.Wait()
 }
 
+// writeError replies the request with the err, the status code and the reason
+// headers are decided by the error code of err, and the defaultCode is used
+// if the err is unknown.
+func writeError(w http.ResponseWriter, err error, defaultCode int) {
+	code := defaultCode
+	reason := errortypes.Reason(err)
+	if reason != errortypes.ReasonUnknown {
+		code = errortypes.HTTPStatus(err)
+	}
+	w.Header().Set(constant.HeaderErrorReason, reason)
+	w.Header().Set(constant.HeaderErrorRetryable, strconv.FormatBool(errortypes.IsRetryable(err)))
+	http.Error(w, err.Error(), code)
+}
+
 func copyAndClose(dst io.WriteCloser, src io.ReadCloser) error {
 	defer src.Close()
 	defer dst.Close()
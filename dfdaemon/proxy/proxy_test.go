@@ -165,3 +165,39 @@ func TestMatch(t *testing.T) {
 		WithTest("http://index.docker.io/v2/blobs/sha256/xxx", true, false, "").
 		TestMirror(t)
 }
+
+func TestShouldStreamInMemory(t *testing.T) {
+	a := assert.New(t)
+	noDisk, err := config.NewProxy("/a/b", false, false, "r")
+	a.Nil(err)
+	noDisk.NoDisk = true
+	other, err := config.NewProxy("/a", false, false, "")
+	a.Nil(err)
+	tp, err := New(WithRules([]*config.Proxy{noDisk, other}))
+	a.Nil(err)
+
+	for url, expected := range map[string]bool{
+		"http://h/a/b": true,
+		"http://h/a/c": false,
+		"http://h/x":   false,
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		a.Equal(expected, tp.shouldStreamInMemory(req), url)
+	}
+
+	req, _ := http.NewRequest("HEAD", "http://h/a/b", nil)
+	a.False(tp.shouldStreamInMemory(req))
+}
+
+func TestFeatures(t *testing.T) {
+	a := assert.New(t)
+	tp, err := New()
+	a.Nil(err)
+	a.Empty(tp.Features())
+
+	remote, err := config.NewURL("http://registry")
+	a.Nil(err)
+	tp, err = New(WithRegistryMirror(&config.RegistryMirror{Remote: remote}), WithStreamMode(true))
+	a.Nil(err)
+	a.Equal([]string{"registry-mirror", "stream-mode"}, tp.Features())
+}
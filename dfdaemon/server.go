@@ -20,13 +20,21 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"path/filepath"
 
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/config"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/handler"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/proxy"
 	dfgetConfig "github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/lazyfile"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/uploader"
+	"github.com/dragonflyoss/Dragonfly/pkg/accesslog"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/systemd"
 	"github.com/dragonflyoss/Dragonfly/version"
 
 	"github.com/pkg/errors"
@@ -36,8 +44,21 @@ import (
 
 // Server represents the dfdaemon server.
 type Server struct {
-	server *http.Server
-	proxy  *proxy.Proxy
+	server    *http.Server
+	proxy     *proxy.Proxy
+	accessLog *accesslog.Logger
+	lazyFiles *lazyfile.Manager
+
+	// adminToken authenticates the requests to the admin API.
+	adminToken string
+	// supernodes are the addresses of the supernodes pinged by the admin API.
+	supernodes []string
+
+	metricsExporters []*metricsutils.ExporterConfig
+	stopExporters    func()
+
+	// done is closed when the server is stopped.
+	done chan struct{}
 }
 
 // Option is the functional option for creating a server.
@@ -77,6 +98,46 @@ func WithProxy(p *proxy.Proxy) Option {
 	}
 }
 
+// WithAccessLogSampleRate sets the sample rate of the access log.
+func WithAccessLogSampleRate(rate float64) Option {
+	return func(s *Server) error {
+		s.accessLog.SetSampleRate(rate)
+		return nil
+	}
+}
+
+// WithMetricsExporters pushes the metrics to the backends of the configs while the server runs.
+func WithMetricsExporters(configs []*metricsutils.ExporterConfig) Option {
+	return func(s *Server) error {
+		s.metricsExporters = configs
+		return nil
+	}
+}
+
+// WithLazyFiles serves the ranged reads of the tasks with the given manager.
+func WithLazyFiles(m *lazyfile.Manager) Option {
+	return func(s *Server) error {
+		s.lazyFiles = m
+		return nil
+	}
+}
+
+// WithAdminToken enables the admin API authenticated by the bearer token.
+func WithAdminToken(token string) Option {
+	return func(s *Server) error {
+		s.adminToken = token
+		return nil
+	}
+}
+
+// WithSupernodes sets the supernodes whose health is checked by the admin API.
+func WithSupernodes(nodes []string) Option {
+	return func(s *Server) error {
+		s.supernodes = nodes
+		return nil
+	}
+}
+
 // New returns a new server instance.
 func New(opts ...Option) (*Server, error) {
 	p, _ := proxy.New()
@@ -84,7 +145,9 @@ func New(opts ...Option) (*Server, error) {
 		server: &http.Server{
 			Addr: ":65001",
 		},
-		proxy: p,
+		proxy:     p,
+		accessLog: accesslog.New("dfdaemon", 0, identifyRequest),
+		done:      make(chan struct{}),
 	}
 	// register dfdaemon build information
 	version.NewBuildInfo("dfdaemon", prometheus.DefaultRegisterer)
@@ -108,7 +171,22 @@ func NewFromConfig(cfg config.Properties) (*Server, error) {
 	opts := []Option{
 		WithProxy(p),
 		WithAddr(fmt.Sprintf(":%d", cfg.Port)),
+		WithAccessLogSampleRate(cfg.AccessLogSampleRate),
+		WithMetricsExporters(cfg.MetricsExporters),
+	}
+
+	nodes := dfgetConfig.GetDefaultSupernodesValue()
+	if len(cfg.SuperNodes) > 0 {
+		if nodes, err = dfgetConfig.ParseNodesSlice(cfg.SuperNodes); err != nil {
+			return nil, errors.Wrap(err, "parse supernodes")
+		}
 	}
+	var nodeAddrs []string
+	for _, n := range nodes {
+		nodeAddrs = append(nodeAddrs, n.Node)
+	}
+	opts = append(opts, WithAdminToken(cfg.AdminToken), WithSupernodes(nodeAddrs))
+	opts = append(opts, WithLazyFiles(lazyfile.NewManager(nodeAddrs, filepath.Join(cfg.DFRepo, constant.LazyFileCacheDir))))
 
 	if cfg.CertPem != "" && cfg.KeyPem != "" {
 		opts = append(opts, WithTLSFromFile(cfg.CertPem, cfg.KeyPem))
@@ -117,35 +195,131 @@ func NewFromConfig(cfg config.Properties) (*Server, error) {
 	return New(opts...)
 }
 
+// LaunchPeerServer launches the peer server in the process of dfdaemon, which
+// uploads the files downloaded by dfdaemon until dfdaemon exits.
 func LaunchPeerServer(cfg config.Properties) error {
 	peerServerConfig := dfgetConfig.NewConfig()
+	peerServerConfig.WorkHome = cfg.WorkHome
+	peerServerConfig.RV.MetaPath = filepath.Join(cfg.WorkHome, "meta", "host.meta")
+	peerServerConfig.RV.SystemDataDir = filepath.Join(cfg.WorkHome, "data")
 	peerServerConfig.RV.LocalIP = cfg.LocalIP
 	peerServerConfig.RV.PeerPort = cfg.PeerPort
+	peerServerConfig.P2PIP = cfg.P2PIP
+	peerServerConfig.AdvertiseIPs = cfg.AdvertiseIPs
+	peerServerConfig.RV.DataExpireTime = dfgetConfig.DataExpireTime
 	peerServerConfig.RV.ServerAliveTime = 0
-	port, err := uploader.LaunchPeerServer(peerServerConfig)
-	if err != nil {
+	peerServerConfig.RV.ReadAheadPieces = dfgetConfig.DefaultReadAheadPieces
+	peerServerConfig.RV.DiskFailureLimit = dfgetConfig.DefaultDiskFailureLimit
+	peerServerConfig.RV.AccessLogSampleRate = cfg.AccessLogSampleRate
+	if err := fileutils.CreateDirectory(filepath.Dir(peerServerConfig.RV.MetaPath)); err != nil {
 		return err
 	}
-	peerServerConfig.RV.PeerPort = port
+	if _, err := uploader.LaunchPeerServer(peerServerConfig); err != nil {
+		return err
+	}
+	// the downloads use the peer server instead of starting new processes
+	uploader.SetupPeerServerExecutor(uploader.NewInProcessExecutor())
 	return nil
 }
 
+// features returns the optional features enabled by the options of the server.
+func (s *Server) features() []string {
+	features := s.proxy.Features()
+	if s.server.TLSConfig != nil {
+		features = append(features, "https")
+	}
+	if s.lazyFiles != nil {
+		features = append(features, "lazy-files")
+	}
+	if len(s.metricsExporters) > 0 {
+		features = append(features, "metrics-exporters")
+	}
+	if s.adminToken != "" {
+		features = append(features, "admin-api")
+	}
+	return features
+}
+
 // Start runs dfdaemon's http server.
 func (s *Server) Start() error {
 	var err error
-	_ = proxy.WithDirectHandler(handler.New())(s.proxy)
-	s.server.Handler = s.proxy
+	mux := handler.New()
+	mux.HandleFunc(accesslog.ConfigPath, s.accessLog.ConfigHandler())
+	mux.HandleFunc(constant.VersionPath, version.NewHandler("dfdaemon", s.features))
+	mux.Handle(constant.AdminPath, s.adminHandler())
+	if s.lazyFiles != nil {
+		mux.Handle(constant.LazyFilePath, s.lazyFiles)
+	}
+	_ = proxy.WithDirectHandler(mux)(s.proxy)
+	s.server.Handler = s.accessLog.Handler(s.proxy)
+
+	if s.stopExporters, err = metricsutils.StartExporters("dfdaemon", prometheus.DefaultGatherer, s.metricsExporters); err != nil {
+		return err
+	}
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	// tell systemd that the proxy is ready, it's a no-op if dfdaemon
+	// isn't run as a service of type notify
+	if _, err := systemd.Notify(systemd.StateReady); err != nil {
+		logrus.Warnf("failed to notify systemd: %v", err)
+	}
+	scheme := "http"
+	if s.server.TLSConfig != nil {
+		scheme = "https"
+	}
+	// the watchdog is pinged only if dfdaemon still serves the requests,
+	// and the certificate of the server isn't verified by the check
+	go systemd.RunWatchdog(s.done, systemd.HTTPCheck(
+		systemd.LoopbackURL(scheme, ln.Addr(), constant.VersionPath),
+		&tls.Config{InsecureSkipVerify: true}))
+
 	if s.server.TLSConfig != nil {
-		logrus.Infof("start dfdaemon https server on %s", s.server.Addr)
-		err = s.server.ListenAndServeTLS("", "")
+		logrus.Infof("start dfdaemon https server on %s", ln.Addr())
+		err = s.server.ServeTLS(ln, "", "")
 	} else {
-		logrus.Infof("start dfdaemon http server on %s", s.server.Addr)
-		err = s.server.ListenAndServe()
+		logrus.Infof("start dfdaemon http server on %s", ln.Addr())
+		err = s.server.Serve(ln)
 	}
 	return err
 }
 
+// listen returns the listener of the socket passed by systemd if dfdaemon is
+// activated by a socket unit, or listens on the address of the server otherwise.
+func (s *Server) listen() (net.Listener, error) {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, errors.Wrap(err, "get the listeners of socket activation")
+	}
+	if len(listeners) > 0 {
+		for _, ln := range listeners[1:] {
+			logrus.Warnf("ignore the extra socket %s passed by systemd", ln.Addr())
+			ln.Close()
+		}
+		return listeners[0], nil
+	}
+	return net.Listen("tcp", s.server.Addr)
+}
+
 // Stop gracefully stops the dfdaemon http server.
 func (s *Server) Stop(ctx context.Context) error {
+	close(s.done)
+	if s.lazyFiles != nil {
+		defer s.lazyFiles.Close()
+	}
+	if s.stopExporters != nil {
+		defer s.stopExporters()
+	}
 	return s.server.Shutdown(ctx)
 }
+
+// identifyRequest identifies the peer by the IP of the client. The task ID is
+// unknown to dfdaemon since it's assigned by supernode to the dfget process.
+func identifyRequest(r *http.Request) (peer, taskID string) {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	return peer, ""
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transport
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// activeDownloads records the downloads being served by dfget,
+// the key is the name of the download, and the value is *activeDownload.
+var activeDownloads sync.Map
+
+type activeDownload struct {
+	url   string
+	start time.Time
+}
+
+// trackDownload records the download as active until the returned function is called.
+func trackDownload(name, url string) (untrack func()) {
+	activeDownloads.Store(name, &activeDownload{url: url, start: time.Now()})
+	var once sync.Once
+	return func() {
+		once.Do(func() { activeDownloads.Delete(name) })
+	}
+}
+
+// WriteDownloadsStatus writes the downloads being served by dfget to w,
+// the longest running ones first.
+func WriteDownloadsStatus(w io.Writer) {
+	type item struct {
+		name string
+		*activeDownload
+	}
+	var items []item
+	activeDownloads.Range(func(key, value interface{}) bool {
+		items = append(items, item{key.(string), value.(*activeDownload)})
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].start.Before(items[j].start)
+	})
+
+	fmt.Fprintf(w, "active downloads: %d\n", len(items))
+	now := time.Now()
+	for _, it := range items {
+		fmt.Fprintf(w, "  %s elapsed:%s url:%s\n", it.name, now.Sub(it.start).Truncate(time.Millisecond), it.url)
+	}
+}
+
+// untrackCloser calls untrack when the body is closed.
+type untrackCloser struct {
+	io.Reader
+	untrack func()
+}
+
+func (c *untrackCloser) Close() error {
+	c.untrack()
+	return nil
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDownloadsStatus(t *testing.T) {
+	untrack := trackDownload("foo", "http://a.b/foo")
+	body := &untrackCloser{Reader: strings.NewReader(""), untrack: trackDownload("bar", "http://a.b/bar")}
+
+	buf := &bytes.Buffer{}
+	WriteDownloadsStatus(buf)
+	assert.Contains(t, buf.String(), "active downloads: 2\n")
+	assert.True(t, strings.Index(buf.String(), "foo") < strings.Index(buf.String(), "bar"))
+
+	untrack()
+	untrack()
+	body.Close()
+	buf.Reset()
+	WriteDownloadsStatus(buf)
+	assert.Equal(t, "active downloads: 0\n", buf.String())
+}
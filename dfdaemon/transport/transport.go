@@ -19,19 +19,27 @@ package transport
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader"
 	"github.com/dragonflyoss/Dragonfly/dfdaemon/exception"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 )
 
 var (
@@ -39,22 +47,38 @@ var (
 	layerReg = regexp.MustCompile("^.+/blobs/sha256.*$")
 )
 
+// dialTimeout is the timeout of establishing the connections of the requests
+// which don't use dfget.
+const dialTimeout = 10 * time.Second
+
 // DFRoundTripper implements RoundTripper for dfget.
 // It uses http.fileTransport to serve requests that need to use dfget,
-// and uses http.Transport to serve the other requests.
+// and uses httputils.Client to serve the other requests.
 type DFRoundTripper struct {
-	Round            *http.Transport
+	Round            http.RoundTripper
 	Round2           http.RoundTripper
 	ShouldUseDfget   func(req *http.Request) bool
 	Downloader       downloader.Interface
 	StreamDownloader downloader.Stream
 	streamMode       bool
+
+	// ShouldStreamInMemory decides whether the requests downloaded with dfget are
+	// streamed from the pieces held only in memory, it's nil if none of them are.
+	ShouldStreamInMemory func(req *http.Request) bool
+
+	// DirectSize returns the size below which the responses of the requests are proxied
+	// directly instead of with dfget, it's nil or returns 0 if none of them are.
+	DirectSize func(req *http.Request) int64
+
+	// tlsConfig and dnsCache configure the Client created for Round
+	// if it's not set by WithClient.
+	tlsConfig *tls.Config
+	dnsCache  *netutils.DNSCache
 }
 
 // New returns the default DFRoundTripper.
 func New(opts ...Option) (*DFRoundTripper, error) {
 	rt := &DFRoundTripper{
-		Round:          defaultHTTPTransport(nil),
 		Round2:         http.NewFileTransport(http.Dir("/")),
 		ShouldUseDfget: NeedUseGetter,
 	}
@@ -69,6 +93,10 @@ func New(opts ...Option) (*DFRoundTripper, error) {
 		return nil, errors.Errorf("nil downloader")
 	}
 
+	if rt.Round == nil {
+		rt.Round = NewClient(rt.tlsConfig, rt.dnsCache)
+	}
+
 	return rt, nil
 }
 
@@ -78,25 +106,50 @@ type Option func(rt *DFRoundTripper) error
 // WithTLS configures TLS config used for http transport.
 func WithTLS(cfg *tls.Config) Option {
 	return func(rt *DFRoundTripper) error {
-		rt.Round = defaultHTTPTransport(cfg)
+		rt.tlsConfig = cfg
 		return nil
 	}
 }
 
-func defaultHTTPTransport(cfg *tls.Config) *http.Transport {
+// WithClient sets the Client sending the requests which don't use dfget,
+// which is shared by the DFRoundTrippers to reuse the connections.
+// WithTLS and WithDNSCache are ignored if it's set.
+func WithClient(c *httputils.Client) Option {
+	return func(rt *DFRoundTripper) error {
+		if c != nil {
+			rt.Round = c
+		}
+		return nil
+	}
+}
+
+// NewClient creates the Client sending the requests which don't use dfget, which skips
+// verifying the certificates if cfg is nil, and resolves the hosts by dnsCache if it's
+// not nil. No proxy is read from the environment, since dfdaemon is the proxy itself.
+func NewClient(cfg *tls.Config, dnsCache *netutils.DNSCache) *httputils.Client {
 	if cfg == nil {
 		cfg = &tls.Config{InsecureSkipVerify: true}
 	}
-	return &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   10 * time.Second,
+	opts := []httputils.ClientOption{
+		httputils.WithTLSConfig(cfg),
+		httputils.WithDialTimeout(dialTimeout),
+		httputils.WithProxy(func(*http.Request) (*url.URL, error) { return nil, nil }),
+	}
+	if dnsCache != nil {
+		opts = append(opts, httputils.WithDialContext(dnsCache.DialContext(&net.Dialer{
+			Timeout:   dialTimeout,
 			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig:       cfg,
+		})))
+	}
+	return httputils.NewClient(opts...)
+}
+
+// WithDNSCache makes the hosts of the requests which don't use dfget
+// resolved by the DNSCache, it's ignored if the cache is nil.
+func WithDNSCache(c *netutils.DNSCache) Option {
+	return func(rt *DFRoundTripper) error {
+		rt.dnsCache = c
+		return nil
 	}
 }
 
@@ -122,6 +175,25 @@ func WithStreamMode(streamMode bool) Option {
 	}
 }
 
+// WithNoDiskCondition configures how to decide whether the requests downloaded
+// with dfget are streamed from the pieces held only in memory.
+func WithNoDiskCondition(c func(r *http.Request) bool) Option {
+	return func(rt *DFRoundTripper) error {
+		rt.ShouldStreamInMemory = c
+		return nil
+	}
+}
+
+// WithDirectSizeCondition configures the size below which the responses of the requests
+// matching the condition of dfget are proxied directly, since the overhead of downloading
+// with dfget dominates for the small ones, such as the manifests of the images.
+func WithDirectSizeCondition(c func(r *http.Request) int64) Option {
+	return func(rt *DFRoundTripper) error {
+		rt.DirectSize = c
+		return nil
+	}
+}
+
 // WithCondition configures how to decide whether to use dfget or not.
 func WithCondition(c func(r *http.Request) bool) Option {
 	return func(rt *DFRoundTripper) error {
@@ -133,12 +205,18 @@ func WithCondition(c func(r *http.Request) bool) Option {
 // RoundTrip only process first redirect at present
 // fix resource release
 func (roundTripper *DFRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	if roundTripper.ShouldUseDfget(req) {
+	// it's decided before ShouldUseDfget which may rewrite the url of the request
+	noDisk := roundTripper.ShouldStreamInMemory != nil && roundTripper.ShouldStreamInMemory(req)
+	var directSize int64
+	if roundTripper.DirectSize != nil {
+		directSize = roundTripper.DirectSize(req)
+	}
+	if roundTripper.ShouldUseDfget(req) && !roundTripper.isSmall(req, directSize) {
 		// delete the Accept-Encoding header to avoid returning the same cached
 		// result for different requests
 		req.Header.Del("Accept-Encoding")
 		logrus.Debugf("round trip with dfget: %s", req.URL.String())
-		if res, err := roundTripper.download(req, req.URL.String()); err == nil || !exception.IsNotAuth(err) {
+		if res, err := roundTripper.download(req, req.URL.String(), noDisk); err == nil || !exception.IsNotAuth(err) {
 			return res, err
 		}
 	}
@@ -146,16 +224,57 @@ func (roundTripper *DFRoundTripper) RoundTrip(req *http.Request) (*http.Response
 	req.Host = req.URL.Host
 	req.Header.Set("Host", req.Host)
 	res, err := roundTripper.Round.RoundTrip(req)
+	if err == nil {
+		res.Header.Set(constant.HeaderSource, downloader.SourceDirect)
+	}
 	return res, err
 }
 
-// download uses dfget to download.
-func (roundTripper *DFRoundTripper) download(req *http.Request, urlString string) (*http.Response, error) {
-	if roundTripper.streamMode {
-		return roundTripper.downloadByStream(req.Context(), urlString, req.Header, uuid.New())
+// isSmall returns whether the resource of the request is known to be smaller than size
+// by a HEAD request to the origin. It's false if the size is unknown.
+func (roundTripper *DFRoundTripper) isSmall(req *http.Request, size int64) bool {
+	if size <= 0 {
+		return false
+	}
+	head, err := http.NewRequest(http.MethodHead, req.URL.String(), nil)
+	if err != nil {
+		return false
+	}
+	head = head.WithContext(req.Context())
+	for k, v := range req.Header {
+		head.Header[k] = v
+	}
+	head.Header.Del("Range")
+	head.Host = req.URL.Host
+	resp, err := roundTripper.Round.RoundTrip(head)
+	if err != nil {
+		logrus.Debugf("failed to get the size of %s: %v", req.URL.String(), err)
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 || resp.ContentLength >= size {
+		return false
+	}
+	logrus.Debugf("proxy %s directly with the size %d less than %d", req.URL.String(), resp.ContentLength, size)
+	return true
+}
+
+// download uses dfget to download, the data is streamed from memory if noDisk is true.
+func (roundTripper *DFRoundTripper) download(req *http.Request, urlString string, noDisk bool) (*http.Response, error) {
+	// the trace headers are passed to dfget with the other headers
+	if trace := httputils.FormatTraceHeaders(httputils.ExtractHTTPTraceHeaders(req.Header)); trace != "" {
+		logrus.Infof("download url:%s with trace headers: %s", urlString, trace)
+	}
+	ctx, provenance := downloader.WithProvenance(req.Context())
+	if roundTripper.streamMode || noDisk {
+		resp, err := roundTripper.downloadByStream(ctx, urlString, req.Header, uuid.New())
+		if err == nil {
+			setProvenance(resp.Header, provenance)
+		}
+		return resp, err
 	}
 
-	dstPath, err := roundTripper.downloadByGetter(req.Context(), urlString, req.Header, uuid.New())
+	dstPath, err := roundTripper.downloadByGetter(ctx, urlString, req.Header, uuid.New())
 	if err != nil {
 		logrus.Errorf("download fail: %v", err)
 		return nil, err
@@ -170,6 +289,7 @@ func (roundTripper *DFRoundTripper) download(req *http.Request, urlString string
 	response, err := roundTripper.Round2.RoundTrip(fileReq)
 	if err == nil {
 		response.Header.Set("Content-Disposition", "attachment; filename="+dstPath)
+		setProvenance(response.Header, provenance)
 	} else {
 		logrus.Errorf("read response from file:%s error:%v", dstPath, err)
 	}
@@ -180,24 +300,143 @@ func (roundTripper *DFRoundTripper) download(req *http.Request, urlString string
 // downloadByGetter is used to download file by DFGetter.
 func (roundTripper *DFRoundTripper) downloadByGetter(ctx context.Context, url string, header map[string][]string, name string) (string, error) {
 	logrus.Infof("start download url:%s to %s in repo", url, name)
+	defer trackDownload(name, url)()
 	return roundTripper.Downloader.DownloadContext(ctx, url, header, name)
 }
 
 func (roundTripper *DFRoundTripper) downloadByStream(ctx context.Context, url string, header map[string][]string, name string) (*http.Response, error) {
 	logrus.Infof("start download url:%s to %s in repo", url, name)
+	if rs, ok := roundTripper.StreamDownloader.(downloader.RangeStream); ok {
+		if offset, length, ok := parseRange(http.Header(header).Get("Range")); ok {
+			resp, err := roundTripper.downloadRangeByStream(ctx, rs, url, header, name, offset, length)
+			if resp != nil || err != nil {
+				return resp, err
+			}
+		}
+	}
+
+	untrack := trackDownload(name, url)
 	reader, err := roundTripper.StreamDownloader.DownloadStreamContext(ctx, url, header, name)
 	if err != nil {
+		untrack()
 		logrus.Errorf("download fail: %v", err)
 		return nil, err
 	}
 
 	resp := &http.Response{
 		StatusCode: 200,
-		Body:       ioutil.NopCloser(reader),
+		Header:     http.Header{},
+		Body:       &untrackCloser{Reader: reader, untrack: untrack},
 	}
 	return resp, nil
 }
 
+// framingHeaders are the headers describing how the response is transferred,
+// which are set by dfdaemon itself rather than replayed from the source.
+var framingHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Content-Range":     true,
+	"Transfer-Encoding": true,
+}
+
+// setProvenance sets the headers telling where the resource comes from,
+// which are omitted if the downloader doesn't tell it. The headers of the
+// source kept with the task are replayed except the framing ones.
+func setProvenance(h http.Header, p *downloader.Provenance) {
+	for k, v := range p.Headers {
+		if k = http.CanonicalHeaderKey(k); !framingHeaders[k] {
+			h.Set(k, v)
+		}
+	}
+	if p.Source != "" {
+		h.Set(constant.HeaderSource, p.Source)
+	}
+	if p.TaskID != "" {
+		h.Set(httputils.HeaderTask, p.TaskID)
+	}
+}
+
+// downloadRangeByStream downloads the range of the resource and responds it with 206.
+// The resource is downloaded without the Range header, so that all the ranges of it share
+// the same task. It returns nil without any error if the length of the range is unknown,
+// then the resource should be downloaded as a whole.
+func (roundTripper *DFRoundTripper) downloadRangeByStream(ctx context.Context, rs downloader.RangeStream,
+	url string, header map[string][]string, name string, offset, length int64) (*http.Response, error) {
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		h[k] = v
+	}
+	h.Del("Range")
+	untrack := trackDownload(name, url)
+	rng, err := rs.DownloadStreamRangeContext(ctx, url, h, name, offset, length)
+	if errortypes.IsRangeNotSatisfiable(err) {
+		untrack()
+		return &http.Response{
+			StatusCode: http.StatusRequestedRangeNotSatisfiable,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	if err != nil {
+		untrack()
+		logrus.Errorf("download fail: %v", err)
+		return nil, err
+	}
+	if rng.Length < 0 {
+		untrack()
+		rng.Close()
+		logrus.Warnf("unknown length of the range from %d of url:%s, download it as a whole", offset, url)
+		return nil, nil
+	}
+
+	total := "*"
+	if rng.Total >= 0 {
+		total = strconv.FormatInt(rng.Total, 10)
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusPartialContent,
+		Header: http.Header{
+			"Content-Range":  {fmt.Sprintf("bytes %d-%d/%s", rng.Offset, rng.Offset+rng.Length-1, total)},
+			"Content-Length": {strconv.FormatInt(rng.Length, 10)},
+		},
+		ContentLength: rng.Length,
+		Body: &untrackCloser{Reader: rng, untrack: func() {
+			rng.Close()
+			untrack()
+		}},
+	}
+	return resp, nil
+}
+
+// parseRange parses the Range header of a single range from the offset, like "bytes=0-99"
+// or "bytes=100-". The length is -1 if it's requested to the end of the resource.
+// The multiple ranges and the suffix ranges are not supported.
+func parseRange(s string) (offset, length int64, ok bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, false
+	}
+	s = strings.TrimSpace(s[len(prefix):])
+	i := strings.Index(s, "-")
+	if i <= 0 || strings.Contains(s, ",") {
+		return 0, 0, false
+	}
+	offset, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil || offset < 0 {
+		return 0, 0, false
+	}
+	if s[i+1:] == "" {
+		return offset, -1, true
+	}
+	end, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil || end < offset {
+		return 0, 0, false
+	}
+	return offset, end - offset + 1, true
+}
+
 // needUseGetter is the default value for ShouldUseDfget, which downloads all
 // images layers with dfget.
 func NeedUseGetter(req *http.Request) bool {
@@ -0,0 +1,238 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/constant"
+	"github.com/dragonflyoss/Dragonfly/dfdaemon/downloader"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDownloader struct{}
+
+func (d *fakeDownloader) DownloadContext(ctx context.Context, url string, header map[string][]string, name string) (string, error) {
+	return "", errors.New("downloaded to the disk")
+}
+
+func (d *fakeDownloader) DownloadStreamContext(ctx context.Context, url string, header map[string][]string, name string) (io.Reader, error) {
+	if p := downloader.ProvenanceFrom(ctx); p != nil {
+		p.Source, p.TaskID = downloader.SourceP2P, "foo"
+		p.Headers = map[string]string{"docker-content-digest": "sha256:abc", "Content-Length": "1"}
+	}
+	return strings.NewReader("in memory"), nil
+}
+
+func TestRoundTripNoDisk(t *testing.T) {
+	a := assert.New(t)
+	d := &fakeDownloader{}
+	rt, err := New(
+		WithDownloader(d),
+		WithStreamDownloader(d),
+		WithCondition(func(req *http.Request) bool {
+			req.URL.Path = "/rewritten"
+			return true
+		}),
+		WithNoDiskCondition(func(req *http.Request) bool {
+			return req.URL.Path == "/blobs"
+		}),
+	)
+	a.Nil(err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://h/blobs", nil)
+	resp, err := rt.RoundTrip(req)
+	a.Nil(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	a.Equal("in memory", string(body))
+	a.Equal(downloader.SourceP2P, resp.Header.Get(constant.HeaderSource))
+	a.Equal("foo", resp.Header.Get(httputils.HeaderTask))
+	a.Equal("sha256:abc", resp.Header.Get("Docker-Content-Digest"))
+	a.Empty(resp.Header.Get("Content-Length"), "the framing headers aren't replayed")
+
+	req, _ = http.NewRequest(http.MethodGet, "http://h/other", nil)
+	_, err = rt.RoundTrip(req)
+	a.EqualError(err, "downloaded to the disk")
+}
+
+type fakeRangeDownloader struct {
+	fakeDownloader
+	header map[string][]string
+}
+
+func (d *fakeRangeDownloader) DownloadStreamRangeContext(ctx context.Context, url string, header map[string][]string,
+	name string, offset, length int64) (*downloader.Range, error) {
+	d.header = header
+	content := "0123456789"
+	if offset >= int64(len(content)) {
+		return nil, errortypes.ErrRangeNotSatisfiable
+	}
+	if length < 0 || offset+length > int64(len(content)) {
+		length = int64(len(content)) - offset
+	}
+	return &downloader.Range{
+		ReadCloser: ioutil.NopCloser(strings.NewReader(content[offset : offset+length])),
+		Offset:     offset,
+		Length:     length,
+		Total:      int64(len(content)),
+	}, nil
+}
+
+func TestRoundTripRange(t *testing.T) {
+	a := assert.New(t)
+	d := &fakeRangeDownloader{}
+	rt, err := New(
+		WithStreamDownloader(d),
+		WithStreamMode(true),
+		WithCondition(func(req *http.Request) bool { return true }),
+	)
+	a.Nil(err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://h/blobs", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	resp, err := rt.RoundTrip(req)
+	a.Nil(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	a.Equal(http.StatusPartialContent, resp.StatusCode)
+	a.Equal("bytes 2-4/10", resp.Header.Get("Content-Range"))
+	a.Equal("234", string(body))
+	// the whole resource is downloaded as the task
+	a.Empty(http.Header(d.header).Get("Range"))
+
+	req.Header.Set("Range", "bytes=7-")
+	resp, err = rt.RoundTrip(req)
+	a.Nil(err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	a.Equal("bytes 7-9/10", resp.Header.Get("Content-Range"))
+	a.Equal("789", string(body))
+
+	req.Header.Set("Range", "bytes=10-")
+	resp, err = rt.RoundTrip(req)
+	a.Nil(err)
+	a.Equal(http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+
+	// the multiple ranges are streamed as a whole
+	req.Header.Set("Range", "bytes=0-1,3-4")
+	resp, err = rt.RoundTrip(req)
+	a.Nil(err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.Equal("in memory", string(body))
+}
+
+func TestRoundTripDirectSize(t *testing.T) {
+	a := assert.New(t)
+	var heads int
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads++
+		}
+		if r.URL.Path == "/manifest" {
+			w.Write([]byte("small"))
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer origin.Close()
+
+	d := &fakeDownloader{}
+	rt, err := New(
+		WithDownloader(d),
+		WithStreamDownloader(d),
+		WithCondition(func(req *http.Request) bool { return true }),
+		WithDirectSizeCondition(func(req *http.Request) int64 { return 10 }),
+	)
+	a.Nil(err)
+
+	req, _ := http.NewRequest(http.MethodGet, origin.URL+"/manifest", nil)
+	resp, err := rt.RoundTrip(req)
+	a.Nil(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	a.Equal("small", string(body))
+	a.Equal(downloader.SourceDirect, resp.Header.Get(constant.HeaderSource))
+
+	req, _ = http.NewRequest(http.MethodGet, origin.URL+"/blob", nil)
+	_, err = rt.RoundTrip(req)
+	a.EqualError(err, "downloaded to the disk")
+	a.Equal(2, heads)
+}
+
+func TestRoundTripWithClient(t *testing.T) {
+	a := assert.New(t)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer origin.Close()
+
+	var hosts []string
+	client := httputils.NewClient(httputils.WithMetricsHook(func(method, host string, code int, cost time.Duration, err error) {
+		hosts = append(hosts, host)
+	}))
+	d := &fakeDownloader{}
+	rt, err := New(
+		WithDownloader(d),
+		WithStreamDownloader(d),
+		WithClient(client),
+		WithCondition(func(req *http.Request) bool { return false }),
+	)
+	a.Nil(err)
+
+	req, _ := http.NewRequest(http.MethodGet, origin.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	a.Nil(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	a.Equal("direct", string(body))
+	a.Equal([]string{req.URL.Host}, hosts, "the direct requests are sent by the shared client")
+}
+
+func TestParseRange(t *testing.T) {
+	a := assert.New(t)
+	var cases = []struct {
+		header         string
+		offset, length int64
+		ok             bool
+	}{
+		{"bytes=0-99", 0, 100, true},
+		{"bytes=100-", 100, -1, true},
+		{"bytes=-100", 0, 0, false},
+		{"bytes=5-4", 0, 0, false},
+		{"bytes=0-1,3-4", 0, 0, false},
+		{"items=0-1", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, c := range cases {
+		offset, length, ok := parseRange(c.header)
+		a.Equal(c.ok, ok, c.header)
+		a.Equal(c.offset, offset, c.header)
+		a.Equal(c.length, length, c.header)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"crypto/tls"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/pkg/errors"
+)
+
+// CDNTLSConfig configures downloading the pieces from the CDN of supernode over HTTPS.
+type CDNTLSConfig struct {
+	// Port is the HTTPS port of the CDN of supernode.
+	// The download port registered by supernode is used if it's 0.
+	Port int `yaml:"port,omitempty" json:"port,omitempty"`
+
+	// CA are the files of the CA certificates which verify the certificate of the CDN.
+	// The root CA set of the host is used if it's empty.
+	CA []string `yaml:"ca,omitempty" json:"ca,omitempty"`
+
+	// Pins are the base64-encoded SHA-256 digests of the public keys, which may
+	// be prefixed with "sha256/". One of the certificates of the CDN must have
+	// one of the public keys if it's not empty.
+	Pins []string `yaml:"pins,omitempty" json:"pins,omitempty"`
+
+	// ServerName is the host name which the certificate of the CDN is verified against.
+	// The IP of supernode is used if it's empty.
+	ServerName string `yaml:"serverName,omitempty" json:"serverName,omitempty"`
+
+	// Insecure indicates whether to skip verifying the certificate chain of the CDN,
+	// and then only the pins are checked.
+	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+// TLSConfig loads the CA certificates and the pins into a tls.Config.
+func (c *CDNTLSConfig) TLSConfig() (*tls.Config, error) {
+	if c.Port < 0 || c.Port > 65535 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "cdnTLS port %d", c.Port)
+	}
+	if c.Insecure && len(c.Pins) == 0 {
+		return nil, errors.Wrap(errortypes.ErrInvalidValue, "cdnTLS: insecure requires pins")
+	}
+	tlsConfig, err := httputils.NewTLSConfigFromFiles(c.CA, c.Insecure)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load the CA of cdnTLS")
+	}
+	tlsConfig.ServerName = c.ServerName
+	if err := httputils.PinPublicKeys(tlsConfig, c.Pins); err != nil {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "cdnTLS: %v", err)
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+)
+
+func (suite *ConfigSuite) TestCDNTLSConfig(c *check.C) {
+	pin := "sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+	tlsConfig, err := (&CDNTLSConfig{Pins: []string{pin}, ServerName: "supernode"}).TLSConfig()
+	c.Assert(err, check.IsNil)
+	c.Check(tlsConfig.ServerName, check.Equals, "supernode")
+	c.Check(tlsConfig.VerifyPeerCertificate, check.NotNil)
+	c.Check(tlsConfig.InsecureSkipVerify, check.Equals, false)
+
+	tlsConfig, err = (&CDNTLSConfig{Pins: []string{pin}, Insecure: true}).TLSConfig()
+	c.Assert(err, check.IsNil)
+	c.Check(tlsConfig.InsecureSkipVerify, check.Equals, true)
+
+	_, err = (&CDNTLSConfig{Insecure: true}).TLSConfig()
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+	_, err = (&CDNTLSConfig{Pins: []string{"invalid"}}).TLSConfig()
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+	_, err = (&CDNTLSConfig{Port: 70000}).TLSConfig()
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+	_, err = (&CDNTLSConfig{CA: []string{"/non-existent"}}).TLSConfig()
+	c.Check(err, check.NotNil)
+}
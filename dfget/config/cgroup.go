@@ -0,0 +1,78 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/dragonflyoss/Dragonfly/pkg/cgroup"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+)
+
+// DefaultCgroupParent is the default cgroup below which the cgroups of the downloads are created.
+const DefaultCgroupParent = "/sys/fs/cgroup/dragonfly"
+
+// CgroupConfig configures the cgroup v2 created for every download of the dfget command,
+// which limits the CPU, the memory and the I/O used by the download and the pieces
+// written to disk. The zero values mean unlimited.
+type CgroupConfig struct {
+	// Parent is the cgroup below which the cgroups of the downloads are created,
+	// it must be in a cgroup v2 file system and it mustn't contain processes.
+	// default: /sys/fs/cgroup/dragonfly.
+	Parent string `yaml:"parent,omitempty" json:"parent,omitempty"`
+
+	// CPU is the max number of the CPU cores used by a download, such as 0.5.
+	CPU float64 `yaml:"cpu,omitempty" json:"cpu,omitempty"`
+
+	// CPUWeight is the relative share of the CPU time of a download in [1, 10000]
+	// when the CPU is contended, the default weight of the cgroups is 100.
+	CPUWeight int `yaml:"cpuWeight,omitempty" json:"cpuWeight,omitempty"`
+
+	// Memory is the max size of the memory used by a download, including the page cache
+	// of the file written, in format of G(B)/M(B)/K(B)/B.
+	Memory fileutils.Fsize `yaml:"memory,omitempty" json:"memory,omitempty"`
+
+	// IOWeight is the relative share of the I/O of a download in [1, 10000]
+	// when the disks are contended, the default weight of the cgroups is 100.
+	IOWeight int `yaml:"ioWeight,omitempty" json:"ioWeight,omitempty"`
+
+	// IOReadLimit and IOWriteLimit are the max rates at which a download reads from
+	// and writes to the disks of the work home and the target.
+	IOReadLimit  rate.Rate `yaml:"ioReadLimit,omitempty" json:"ioReadLimit,omitempty"`
+	IOWriteLimit rate.Rate `yaml:"ioWriteLimit,omitempty" json:"ioWriteLimit,omitempty"`
+}
+
+// ParentOrDefault returns the Parent, or DefaultCgroupParent if it's empty.
+func (c *CgroupConfig) ParentOrDefault() string {
+	if c.Parent == "" {
+		return DefaultCgroupParent
+	}
+	return c.Parent
+}
+
+// Limits returns the limits of the cgroup, whose I/O limits are applied
+// to the disks of the paths.
+func (c *CgroupConfig) Limits(paths ...string) *cgroup.Limits {
+	return &cgroup.Limits{
+		CPU:        c.CPU,
+		CPUWeight:  c.CPUWeight,
+		Memory:     int64(c.Memory),
+		IOWeight:   c.IOWeight,
+		IOReadBPS:  int64(c.IOReadLimit),
+		IOWriteBPS: int64(c.IOWriteLimit),
+		IODevices:  paths,
+	}
+}
@@ -18,21 +18,30 @@
 package config
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/dragonflyoss/Dragonfly/pkg/cgroup"
 	"github.com/dragonflyoss/Dragonfly/pkg/dflog"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/printer"
 	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
+	"github.com/dragonflyoss/Dragonfly/pkg/sourceprotocol"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 
 	"github.com/pkg/errors"
@@ -78,14 +87,242 @@ type Properties struct {
 
 	// ClientQueueSize is the size of client queue
 	// which controls the number of pieces that can be processed simultaneously.
-	// It is only useful when the Pattern equals "source".
+	// It also bounds the number of pieces waiting to be written to disk,
+	// the depth of the writer queues is logged after downloading for tuning.
 	// The default value is 6.
 	ClientQueueSize int `yaml:"clientQueueSize" json:"clientQueueSize,omitempty"`
 
+	// MaxConnsPerPeer is the max number of the simultaneous connections to any one peer,
+	// and MaxConnsPerTask is the max number of the simultaneous connections to all the peers
+	// when downloading a task. They prevent the connection storms against a lone seeder during
+	// the flash crowds, and the pieces wait for a connection to be released once a limit is reached.
+	// There is no limit if they're 0.
+	MaxConnsPerPeer int `yaml:"maxConnsPerPeer,omitempty" json:"maxConnsPerPeer,omitempty"`
+	MaxConnsPerTask int `yaml:"maxConnsPerTask,omitempty" json:"maxConnsPerTask,omitempty"`
+
+	// ReportBatchSize is the max number of the pieces reported to supernode in one request
+	// after they are downloaded, which reduces the requests to supernode for the tasks
+	// with many pieces. The pieces are reported one by one if it's not greater than 1.
+	// The default value is 8.
+	ReportBatchSize int `yaml:"reportBatchSize,omitempty" json:"reportBatchSize,omitempty"`
+
+	// ReportInterval is the max time that a downloaded piece waits to be reported in a batch.
+	// The interval is doubled up to 8 times when supernode responds slowly.
+	// The default value is 200ms.
+	ReportInterval time.Duration `yaml:"reportInterval,omitempty" json:"reportInterval,omitempty"`
+
+	// PeerPortRange is the range of ports from which the peer server selects
+	// an available one to listen on if the port is not specified, e.g. "15000-15100".
+	// The port selected last time is preferred so that the firewall rules for it
+	// remain valid across restarts.
+	PeerPortRange PortRange `yaml:"peerPortRange,omitempty" json:"peerPortRange,omitempty"`
+
+	// DataDirs specify the data directories with weight, such as the ones on different disks,
+	// across which the downloaded files are spread to improve the throughput of uploading.
+	// The directories should be dedicated to dfget since the expired files in them are deleted.
+	// The SystemDataDir is used if it's empty.
+	//
+	// E.g. ["/data1/dragonfly=2", "/data2/dragonfly=1"]
+	DataDirs []*DataDirWeight `yaml:"dataDirs,omitempty" json:"dataDirs,omitempty"`
+
+	// DataDirPlacement is the policy of placing the downloaded files into DataDirs,
+	// must be weight/freespace. The directory is selected randomly according to the weights
+	// if it's weight, or the one with the most free space is selected if it's freespace.
+	// default: weight.
+	DataDirPlacement string `yaml:"dataDirPlacement,omitempty" json:"dataDirPlacement,omitempty"`
+
+	// BackSourceStatus specifies the acceptable status codes of the final response
+	// from the source station when downloading the file from it directly.
+	// Only 206 is acceptable if the request has a Range header.
+	// default: [200].
+	BackSourceStatus []int `yaml:"backSourceStatus,omitempty" json:"backSourceStatus,omitempty"`
+
+	// BackSourceMaxRedirects is the max number of redirects followed when downloading
+	// the file from the source station, and no redirect is followed if it's negative.
+	// default: 10.
+	BackSourceMaxRedirects int `yaml:"backSourceMaxRedirects,omitempty" json:"backSourceMaxRedirects,omitempty"`
+
+	// BackSourceResume is the retry policy of resuming the download from the source station
+	// after it's interrupted, such as by a network blip. The download is resumed from the bytes
+	// written with a range request, as long as the source supports it and the file hasn't changed
+	// according to its ETag and Last-Modified. The partial file and its checkpoint are kept
+	// for the next dfget of the same url and target if all the attempts fail with IfExistsResume.
+	// default: {maxAttempts: 3, backoffBase: 1s, backoffCap: 30s, jitter: 0.8}.
+	BackSourceResume retry.Policy `yaml:"backSourceResume,omitempty" json:"backSourceResume,omitempty"`
+
+	// BackSourceSegments is the number of the ranges of the file downloaded concurrently
+	// from the source station, which share the LocalLimit. The file is downloaded in a single
+	// stream if it's not greater than 1, or the source doesn't support the range requests.
+	// Every segment is at least MinBackSourceSegmentSize, so a small file is split into fewer ones.
+	// default: 1.
+	BackSourceSegments int `yaml:"backSourceSegments,omitempty" json:"backSourceSegments,omitempty"`
+
+	// FallbackChain is the ordered stages which the file is downloaded by, and the next
+	// stage is tried when a stage fails or times out, such as [dragonfly, mirror, source]
+	// to try an internal mirror before the source station. The file is never registered
+	// to supernode if there's no dragonfly stage, which can only be the first one.
+	// default: [dragonfly, source].
+	FallbackChain []*FallbackStage `yaml:"fallbackChain,omitempty" json:"fallbackChain,omitempty"`
+
+	// UserAgent is the User-Agent of the requests sent to supernode and the source station,
+	// unless it's specified by the header of the download request.
+	// The default one of the HTTP client is used if it's empty.
+	UserAgent string `yaml:"userAgent,omitempty" json:"userAgent,omitempty"`
+
+	// Cluster is the name of the cluster which dfget belongs to. If it's not empty,
+	// the requests sent to supernode and the source station carry the identification
+	// headers X-Dragonfly-Cluster, X-Dragonfly-Node with the local IP and
+	// X-Dragonfly-Task with the taskID.
+	Cluster string `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+
+	// Labels are the labels of this node, such as its IDC and rack, which are reported
+	// to supernode when registering, so that the maintenance of a part of the cluster
+	// could be scoped by them.
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+
+	// PeerToken is the token of this node issued by "supernode peer-token", which is
+	// carried in the requests sent to supernode. It's required by the supernodes whose
+	// peerTokenSecret is set, so that other processes can't impersonate the peers.
+	PeerToken string `yaml:"peerToken,omitempty" json:"-"`
+
+	// AdminToken is the bearer token required by the diagnostics endpoints served on the port
+	// of the peer server when it's started with --multiplex. Only the local processes can
+	// request them if it's empty.
+	AdminToken string `yaml:"adminToken,omitempty" json:"-"`
+
+	// ControlToken is the bearer token with which the remote processes request the control
+	// endpoints of the peer server started with --multiplex, such as pausing the uploads.
+	// The local processes can always request them.
+	ControlToken string `yaml:"controlToken,omitempty" json:"-"`
+
+	// ShareSecret is the key signing the time-limited share links of the task files
+	// created by the peer server. A random one is generated when the peer server starts
+	// if it's empty, so the links are invalidated once the peer server exits, and
+	// the share links are disabled if it can't be generated.
+	ShareSecret string `yaml:"shareSecret,omitempty" json:"-"`
+
+	// Filter is the query params of the url which are always filtered in addition
+	// to the ones of the command line, such as the tokens of the signed urls.
+	// A param ending with '*' filters all the params with the prefix before it.
+	Filter []string `yaml:"filter,omitempty" json:"filter,omitempty"`
+
+	// CacheKeys specify the files of the hex-encoded AES keys of the namespaces,
+	// with which the cached files of the tasks downloaded with `--namespace` are encrypted.
+	// The tenants sharing a node can't read the cached files of the others from disk,
+	// as long as the key files are only readable by their owners and dfget.
+	CacheKeys map[string]string `yaml:"cacheKeys,omitempty" json:"cacheKeys,omitempty"`
+
+	// DNSCacheTTL is the time for which the addresses of the peers addressed by
+	// hostnames are cached. If a hostname fails to be resolved again, the addresses
+	// resolved last time are used until it's resolved successfully.
+	// The DNS cache is disabled if both it and DNSNegativeCacheTTL are 0.
+	// default: 0.
+	DNSCacheTTL time.Duration `yaml:"dnsCacheTTL,omitempty" json:"dnsCacheTTL,omitempty"`
+
+	// DNSNegativeCacheTTL is the time for which the failures of resolving
+	// the hostnames of the peers are cached.
+	// default: 0.
+	DNSNegativeCacheTTL time.Duration `yaml:"dnsNegativeCacheTTL,omitempty" json:"dnsNegativeCacheTTL,omitempty"`
+
+	// Retry is the retry policy of the failed requests to supernode, the failed piece
+	// downloads from the peers and the failed requests to the source station.
+	// The interval between two attempts grows exponentially from backoffBase up to backoffCap,
+	// and it's randomized by jitter.
+	// default: {maxAttempts: 3, backoffBase: 300ms, backoffCap: 5s, jitter: 0.8}.
+	Retry retry.Policy `yaml:"retry,omitempty" json:"retry,omitempty"`
+
+	// RegisterHedgeDelay is the time after which the registration is sent to the next
+	// supernode as well if the previous ones haven't responded, and the first accepted
+	// response is used. It reduces the latency of the registration when a supernode is
+	// briefly slow. The piece pulls aren't hedged, since they're scheduled by the supernode
+	// which the task is registered to.
+	// The hedging is disabled if it's 0.
+	// default: 0.
+	RegisterHedgeDelay time.Duration `yaml:"registerHedgeDelay,omitempty" json:"registerHedgeDelay,omitempty"`
+
+	// RegisterHedges is the max number of the hedged registrations in flight
+	// in addition to the first one.
+	// default: 1.
+	RegisterHedges int `yaml:"registerHedges,omitempty" json:"registerHedges,omitempty"`
+
 	// WorkHome work home path,
 	// default: `$HOME/.small-dragonfly`.
 	WorkHome string `yaml:"workHome" json:"workHome,omitempty"`
 
+	// WorkDir is the directory to store the temp files of the target file
+	// before they're moved to the target path. It's useful when the target
+	// directory is read-mostly or watched by other processes.
+	// The temp files are created in the target directory if it's empty.
+	WorkDir string `yaml:"workDir,omitempty" json:"workDir,omitempty"`
+
+	// NoCache indicates whether to never write the service files, the meta file
+	// and the download history into the work home, which degrades dfget to a pure download from supernode
+	// with the cdn pattern. It's useful when only the target path is writable.
+	NoCache bool `yaml:"noCache,omitempty" json:"noCache,omitempty"`
+
+	// P2PIP is the IP address on the dedicated network of the P2P transfers, such as
+	// a storage network separated from the one used to communicate with supernode.
+	// The peer server listens on it and it's registered to supernode as the address
+	// of the peer, and the pieces are downloaded from the other peers with it as the
+	// source address. The IP connecting to supernode is used if it's empty.
+	P2PIP string `yaml:"p2pIP,omitempty" json:"p2pIP,omitempty"`
+
+	// AdvertiseIPs are the other addresses on which the peer server can be reached,
+	// such as the IPv6 one or the ones on the other NICs. They're registered to supernode
+	// together with the IP of the peer, and the other peers dial all of them with the
+	// happy eyeballs racing to download the pieces.
+	AdvertiseIPs []string `yaml:"advertiseIPs,omitempty" json:"advertiseIPs,omitempty"`
+
+	// StandbyOf is the address ip:port of the peer server of the primary node which
+	// this node is the warm standby of, such as a critical seed node. It's reported to
+	// supernode with the heart beats of the peer server, then supernode replicates the tasks
+	// cached by the primary to it, and promotes it as the source of the pieces once the
+	// primary goes down. It isn't scheduled as the source while the primary is alive.
+	StandbyOf string `yaml:"standbyOf,omitempty" json:"standbyOf,omitempty"`
+
+	// SourceProtocols are the endpoints and the credentials of the source stations
+	// other than http, such as s3, oss and hdfs, which are downloaded from when dfget
+	// downloads from the source station.
+	SourceProtocols *sourceprotocol.Config `yaml:"sourceProtocols,omitempty" json:"sourceProtocols,omitempty"`
+
+	// UploadEventLog indicates whether to upload the log of the events of a download,
+	// such as the schedule waits, the retries and the errors, to supernode when it finishes
+	// or fails, so that it could be retrieved by the taskID from supernode.
+	// default: false.
+	UploadEventLog bool `yaml:"uploadEventLog,omitempty" json:"uploadEventLog,omitempty"`
+
+	// CDNTLS makes the pieces downloaded from the CDN of supernode over HTTPS,
+	// whose certificate is verified with the CA and optionally pinned to the public keys,
+	// so that the integrity and the confidentiality of the pieces don't depend on the
+	// trust of the network. The pieces are downloaded over HTTP if it's nil.
+	CDNTLS *CDNTLSConfig `yaml:"cdnTLS,omitempty" json:"cdnTLS,omitempty"`
+
+	// BandwidthProbe indicates whether to probe the bandwidth to supernode with a short
+	// burst before downloading, and set LocalLimit and ClientQueueSize from it if they're
+	// left as default. The result is cached in the work home for an hour.
+	// default: false.
+	BandwidthProbe bool `yaml:"bandwidthProbe,omitempty" json:"bandwidthProbe,omitempty"`
+
+	// VerifyWrite indicates whether to read back every piece written to disk after fsync
+	// and compare it with the downloaded one, which detects the disks corrupting the data
+	// silently at the cost of a sync per piece. The short writes are always detected.
+	// default: false.
+	VerifyWrite bool `yaml:"verifyWrite,omitempty" json:"verifyWrite,omitempty"`
+
+	// AcceptPush indicates whether to accept the missing pieces pushed by the other peers
+	// when the download stalls near the completion, which are received by the peer server
+	// and verified against their md5s before they're used.
+	// default: false.
+	AcceptPush bool `yaml:"acceptPush,omitempty" json:"acceptPush,omitempty"`
+
+	// Cgroup places every download of the dfget command under a dedicated cgroup v2
+	// with the limits of the CPU, the memory and the I/O, which isolates the heavy downloads
+	// from the latency-sensitive workloads on the same host. It requires the privileges
+	// to write the cgroup file system, and the download goes on without the cgroup
+	// if it fails to be created. The downloads of dfdaemon aren't isolated.
+	// default: nil.
+	Cgroup *CgroupConfig `yaml:"cgroup,omitempty" json:"cgroup,omitempty"`
+
 	LogConfig dflog.LogConfig `yaml:"logConfig" json:"logConfig"`
 }
 
@@ -97,6 +334,16 @@ func NewProperties() *Properties {
 		LocalLimit:      DefaultLocalLimit,
 		MinRate:         DefaultMinRate,
 		ClientQueueSize: DefaultClientQueueSize,
+		ReportBatchSize: DefaultReportBatchSize,
+		ReportInterval:  DefaultReportInterval,
+		Retry:           retry.DefaultPolicy(),
+		RegisterHedges:  DefaultRegisterHedges,
+		BackSourceResume: retry.Policy{
+			MaxAttempts: DefaultBackSourceResumeAttempts,
+			BackoffBase: DefaultBackSourceResumeBackoffBase,
+			BackoffCap:  DefaultBackSourceResumeBackoffCap,
+			Jitter:      retry.DefaultJitter,
+		},
 	}
 }
 
@@ -168,6 +415,17 @@ type Config struct {
 	// Md5 expected file md5.
 	Md5 string `json:"md5,omitempty"`
 
+	// Digest is the expected digest of the file in the form of "algo:hex",
+	// where the algo is md5, sha256 or sha512. It's taken as md5 without the algo.
+	// The Md5 is set if it's an md5 digest, and vice versa.
+	// Several digests of different algorithms may be given separated by commas,
+	// then it's set to the first one which isn't md5 after they're checked.
+	Digest string `json:"digest,omitempty"`
+
+	// Digests are all the expected digests of the file parsed from the Digest,
+	// which are verified together in a single pass after downloading.
+	Digests []string `json:"digests,omitempty"`
+
 	// Identifier identify download task, it is available merely when md5 param not exist.
 	Identifier string `json:"identifier,omitempty"`
 
@@ -178,6 +436,22 @@ type Config struct {
 	// default:`p2p`.
 	Pattern string `json:"pattern,omitempty"`
 
+	// Priority is the priority class of the download, must be 'high' or 'normal' or 'low',
+	// supernode prefers the downloads of a higher priority in scheduling and fetching
+	// from the source. The downloads of dfdaemon are high unless it's specified,
+	// and the others are normal.
+	Priority string `json:"priority,omitempty"`
+
+	// Group is the ID of the task group which the download belongs to, such as all the
+	// layers of an image. The downloads of a group are listed together by supernode,
+	// and they're scheduled as high once GroupDeadline is within groupUrgentWindow
+	// of supernode.
+	Group string `json:"group,omitempty"`
+
+	// GroupDeadline is the time by which the downloads of the group should finish,
+	// zero means none.
+	GroupDeadline time.Time `json:"-"`
+
 	// CA certificate to verify when supernode interact with the source.
 	Cacerts []string `json:"cacert,omitempty"`
 
@@ -188,11 +462,55 @@ type Config struct {
 
 	// Header of http request.
 	// eg: --header='Accept: *' --header='Host: abc'.
+	// A value may reference an environment variable as ${env:NAME}.
 	Header []string `json:"header,omitempty"`
 
+	// HeaderFile is the file which contains the headers in the same form as Header,
+	// one per line, so that the credentials aren't visible in the arguments of the process.
+	// The headers in it are appended to the Header by AssertConfig.
+	HeaderFile string `json:"headerFile,omitempty"`
+
+	// Namespace is the namespace of the tenant which the task belongs to,
+	// the cached file of the task is encrypted with the key of the namespace in CacheKeys.
+	Namespace string `json:"namespace,omitempty"`
+
 	// Notbs indicates whether to not back source to download when p2p fails.
 	Notbs bool `json:"notbs,omitempty"`
 
+	// MaxDownloadSize is the max number of the bytes downloaded from the source station,
+	// 0 means unlimited.
+	MaxDownloadSize fileutils.Fsize `json:"maxDownloadSize,omitempty"`
+
+	// DownloadSizeMargin is the ratio by which the data downloaded from the source station
+	// may exceed its Content-Length before the download is aborted.
+	DownloadSizeMargin float64 `json:"downloadSizeMargin,omitempty"`
+
+	// SkipIfExists indicates whether to skip downloading if the target already exists
+	// and matches the md5 given by user or the digest recorded when it was downloaded.
+	SkipIfExists bool `json:"skipIfExists,omitempty"`
+
+	// IfExists is the policy when the target already exists, must be overwrite/fail/resume/backup.
+	// The existing target is overwritten if it's empty.
+	IfExists string `json:"ifExists,omitempty"`
+
+	// Symlink is the policy when the target is a symlink, must be replace/follow.
+	// The symlink itself is replaced by the downloaded file if it's empty.
+	Symlink string `json:"symlink,omitempty"`
+
+	// VerifyFailure is the policy for the downloaded file which doesn't match the expected
+	// md5 or digest, must be delete/quarantine. The file is deleted if it's empty.
+	VerifyFailure string `json:"verifyFailure,omitempty"`
+
+	// HandOff is the unix domain socket of a resident uploader, such as the peer server
+	// of dfdaemon, to which the seeding of the downloaded target is handed off, so that
+	// it's still seeded after dfget and the peer server launched by it exit.
+	// The target must be readable by the resident uploader at the same path.
+	HandOff string `json:"handOff,omitempty"`
+
+	// VerifyOnly indicates whether to only verify the existing target against the md5
+	// of all pieces computed by supernode instead of downloading the data.
+	VerifyOnly bool `json:"verifyOnly,omitempty"`
+
 	// DFDaemon indicates whether the caller is from dfdaemon
 	DFDaemon bool `json:"dfdaemon,omitempty"`
 
@@ -205,6 +523,20 @@ type Config struct {
 	// Console shows log on console, it's conflict with `--showbar`.
 	Console bool `json:"console,omitempty"`
 
+	// Quiet indicates whether to suppress all the output on console.
+	Quiet bool `json:"quiet,omitempty"`
+
+	// OutputFormat is the format of the output on console,
+	// must be auto/text/json, default: auto.
+	OutputFormat string `json:"outputFormat,omitempty"`
+
+	// Locale is the locale of the messages output on console,
+	// must be auto/en/zh, default: auto.
+	Locale string `json:"locale,omitempty"`
+
+	// SummaryFile is the file to which the summary of the download is written in JSON.
+	SummaryFile string `json:"summaryFile,omitempty"`
+
 	// Verbose indicates whether to be verbose.
 	// If set true, log level will be 'debug'.
 	Verbose bool `json:"verbose,omitempty"`
@@ -240,10 +572,33 @@ type Config struct {
 }
 
 func (cfg *Config) String() string {
-	js, _ := json.Marshal(cfg)
+	c := *cfg
+	c.Header = httputils.RedactHeaderLines(cfg.Header)
+	js, _ := json.Marshal(&c)
 	return string(js)
 }
 
+// PeerIP returns the IP address on which the peer server serves the other peers,
+// which is P2PIP if it's set, otherwise LocalIP.
+func (cfg *Config) PeerIP() string {
+	if cfg.P2PIP != "" {
+		return cfg.P2PIP
+	}
+	return cfg.RV.LocalIP
+}
+
+// PeerAddresses returns the other addresses of the peer server advertised to supernode,
+// which are AdvertiseIPs except PeerIP.
+func (cfg *Config) PeerAddresses() []string {
+	var addrs []string
+	for _, ip := range cfg.AdvertiseIPs {
+		if ip != "" && ip != cfg.PeerIP() {
+			addrs = append(addrs, ip)
+		}
+	}
+	return addrs
+}
+
 // NewConfig creates and initializes a Config.
 func NewConfig() *Config {
 	cfg := new(Config)
@@ -253,7 +608,7 @@ func NewConfig() *Config {
 
 	currentUser, err := user.Current()
 	if err != nil {
-		printer.Println(fmt.Sprintf("get user error: %s", err))
+		printer.Printf("get user error: %s", err)
 		os.Exit(CodeGetUserError)
 	}
 	cfg.User = currentUser.Username
@@ -262,6 +617,187 @@ func NewConfig() *Config {
 	return cfg
 }
 
+// MergeProperties sets the options which are not set by the flags with the properties.
+func (cfg *Config) MergeProperties(properties *Properties) {
+	supernodes := cfg.Supernodes
+	if supernodes == nil {
+		supernodes = properties.Supernodes
+	}
+	if supernodes != nil {
+		cfg.Nodes = NodeWeightSlice2StringSlice(supernodes)
+	}
+
+	if cfg.LocalLimit == 0 {
+		cfg.LocalLimit = properties.LocalLimit
+	}
+
+	if cfg.MinRate == 0 {
+		cfg.MinRate = properties.MinRate
+	}
+
+	if cfg.TotalLimit == 0 {
+		cfg.TotalLimit = properties.TotalLimit
+	}
+
+	if cfg.ClientQueueSize == 0 {
+		cfg.ClientQueueSize = properties.ClientQueueSize
+	}
+
+	if cfg.MaxConnsPerPeer == 0 {
+		cfg.MaxConnsPerPeer = properties.MaxConnsPerPeer
+	}
+
+	if cfg.MaxConnsPerTask == 0 {
+		cfg.MaxConnsPerTask = properties.MaxConnsPerTask
+	}
+
+	if cfg.ReportBatchSize == 0 {
+		cfg.ReportBatchSize = properties.ReportBatchSize
+	}
+
+	if cfg.ReportInterval == 0 {
+		cfg.ReportInterval = properties.ReportInterval
+	}
+
+	if cfg.LogConfig.MaxSize == 0 {
+		cfg.LogConfig.MaxSize = properties.LogConfig.MaxSize
+	}
+
+	if cfg.LogConfig.MaxBackups == 0 {
+		cfg.LogConfig.MaxBackups = properties.LogConfig.MaxBackups
+	}
+
+	if cfg.LogConfig.MaxAge == 0 {
+		cfg.LogConfig.MaxAge = properties.LogConfig.MaxAge
+	}
+
+	if !cfg.NoCache {
+		cfg.NoCache = properties.NoCache
+	}
+
+	if cfg.P2PIP == "" {
+		cfg.P2PIP = properties.P2PIP
+	}
+
+	if len(cfg.AdvertiseIPs) == 0 {
+		cfg.AdvertiseIPs = properties.AdvertiseIPs
+	}
+
+	if cfg.StandbyOf == "" {
+		cfg.StandbyOf = properties.StandbyOf
+	}
+
+	if cfg.SourceProtocols == nil {
+		cfg.SourceProtocols = properties.SourceProtocols
+	}
+
+	if !cfg.UploadEventLog {
+		cfg.UploadEventLog = properties.UploadEventLog
+	}
+
+	if cfg.CDNTLS == nil {
+		cfg.CDNTLS = properties.CDNTLS
+	}
+
+	if !cfg.BandwidthProbe {
+		cfg.BandwidthProbe = properties.BandwidthProbe
+	}
+
+	if !cfg.VerifyWrite {
+		cfg.VerifyWrite = properties.VerifyWrite
+	}
+
+	if !cfg.AcceptPush {
+		cfg.AcceptPush = properties.AcceptPush
+	}
+
+	if cfg.Cgroup == nil {
+		cfg.Cgroup = properties.Cgroup
+	}
+
+	if !cfg.LogConfig.Compress {
+		cfg.LogConfig.Compress = properties.LogConfig.Compress
+	}
+
+	if cfg.LogConfig.Target == "" {
+		cfg.LogConfig.Target = properties.LogConfig.Target
+	}
+
+	if cfg.LogConfig.ShipURL == "" {
+		cfg.LogConfig.ShipURL = properties.LogConfig.ShipURL
+	}
+
+	if cfg.PeerPortRange.IsEmpty() {
+		cfg.PeerPortRange = properties.PeerPortRange
+	}
+
+	if len(cfg.DataDirs) == 0 {
+		cfg.DataDirs = properties.DataDirs
+	}
+
+	if cfg.DataDirPlacement == "" {
+		cfg.DataDirPlacement = properties.DataDirPlacement
+	}
+
+	if cfg.WorkDir == "" {
+		cfg.WorkDir = properties.WorkDir
+	}
+
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = properties.UserAgent
+	}
+
+	if cfg.Cluster == "" {
+		cfg.Cluster = properties.Cluster
+	}
+
+	if len(cfg.Labels) == 0 {
+		cfg.Labels = properties.Labels
+	}
+
+	if cfg.PeerToken == "" {
+		cfg.PeerToken = properties.PeerToken
+	}
+
+	if cfg.AdminToken == "" {
+		cfg.AdminToken = properties.AdminToken
+	}
+
+	if cfg.ControlToken == "" {
+		cfg.ControlToken = properties.ControlToken
+	}
+
+	if cfg.ShareSecret == "" {
+		cfg.ShareSecret = properties.ShareSecret
+	}
+
+	if cfg.Retry == (retry.Policy{}) {
+		cfg.Retry = properties.Retry
+	}
+
+	if cfg.BackSourceResume == (retry.Policy{}) {
+		cfg.BackSourceResume = properties.BackSourceResume
+	}
+
+	if len(cfg.FallbackChain) == 0 {
+		cfg.FallbackChain = properties.FallbackChain
+	}
+
+	cfg.Filter = append(cfg.Filter, properties.Filter...)
+
+	if len(cfg.CacheKeys) == 0 {
+		cfg.CacheKeys = properties.CacheKeys
+	}
+
+	if cfg.DNSCacheTTL == 0 {
+		cfg.DNSCacheTTL = properties.DNSCacheTTL
+	}
+
+	if cfg.DNSNegativeCacheTTL == 0 {
+		cfg.DNSNegativeCacheTTL = properties.DNSNegativeCacheTTL
+	}
+}
+
 // AssertConfig checks the config and return errors.
 func AssertConfig(cfg *Config) (err error) {
 	if cfg == nil {
@@ -275,9 +811,154 @@ func AssertConfig(cfg *Config) (err error) {
 	if err := checkOutput(cfg); err != nil {
 		return errors.Wrapf(errortypes.ErrInvalidValue, "output: %v", err)
 	}
+
+	if err := checkDigest(cfg); err != nil {
+		return err
+	}
+
+	if err := checkHeaders(cfg); err != nil {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "header: %v", err)
+	}
+	return nil
+}
+
+// envReference matches the references of the environment variables in the headers.
+var envReference = regexp.MustCompile(`\$\{env:([^}]*)\}`)
+
+// checkHeaders appends the headers in the HeaderFile to the Header, and replaces
+// the references of the environment variables in them with their values.
+func checkHeaders(cfg *Config) error {
+	if cfg.HeaderFile != "" {
+		lines, err := readHeaderFile(cfg.HeaderFile)
+		if err != nil {
+			return err
+		}
+		cfg.Header = append(cfg.Header, lines...)
+		cfg.HeaderFile = ""
+	}
+
+	for i, header := range cfg.Header {
+		var unset string
+		cfg.Header[i] = envReference.ReplaceAllStringFunc(header, func(ref string) string {
+			name := envReference.FindStringSubmatch(ref)[1]
+			v, ok := os.LookupEnv(name)
+			if !ok && unset == "" {
+				unset = name
+			}
+			return v
+		})
+		if unset != "" {
+			key := strings.SplitN(header, ":", 2)[0]
+			return fmt.Errorf("%s references the unset environment variable %s", key, unset)
+		}
+	}
 	return nil
 }
 
+// readHeaderFile reads the headers in the file, the blank lines and the ones
+// starting with '#' are ignored.
+func readHeaderFile(file string) ([]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// checkDigest normalizes the Digest and keeps it consistent with the Md5,
+// so that either of them could be used to verify the md5 of the file.
+func checkDigest(cfg *Config) error {
+	if stringutils.IsEmptyStr(cfg.Digest) {
+		if !stringutils.IsEmptyStr(cfg.Md5) {
+			cfg.Digest = digest.String(digest.AlgorithmMD5, cfg.Md5)
+		}
+		return nil
+	}
+
+	primary, primaryAlgo := "", ""
+	for _, d := range strings.Split(cfg.Digest, ",") {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		algo, encoded, err := digest.Parse(d)
+		if err != nil {
+			return errors.Wrapf(err, "digest")
+		}
+		d = digest.String(algo, encoded)
+		if algo == digest.AlgorithmMD5 {
+			if !stringutils.IsEmptyStr(cfg.Md5) && !strings.EqualFold(cfg.Md5, encoded) {
+				return errors.Wrapf(errortypes.ErrInvalidValue, "digest %s conflicts with md5 %s", d, cfg.Md5)
+			}
+			cfg.Md5 = encoded
+		}
+		if err := addDigest(cfg, algo, d); err != nil {
+			return err
+		}
+		if primary == "" || (primaryAlgo == digest.AlgorithmMD5 && algo != digest.AlgorithmMD5) {
+			primary, primaryAlgo = d, algo
+		}
+	}
+	cfg.Digest = primary
+	return nil
+}
+
+// addDigest adds the digest d of the algo to the Digests unless it's already there.
+// The digests of the same algorithm must be the same.
+func addDigest(cfg *Config, algo, d string) error {
+	for _, e := range cfg.Digests {
+		if e == d {
+			return nil
+		}
+		if strings.HasPrefix(e, algo+":") {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "digest %s conflicts with %s", d, e)
+		}
+	}
+	cfg.Digests = append(cfg.Digests, d)
+	return nil
+}
+
+// ExpectedDigests returns all the expected digests of the file in the form of "algo:hex",
+// including the Md5, the Digests and the sha256 published by supernode.
+func (cfg *Config) ExpectedDigests() []string {
+	var digests []string
+	if !stringutils.IsEmptyStr(cfg.Md5) {
+		digests = append(digests, digest.String(digest.AlgorithmMD5, strings.ToLower(cfg.Md5)))
+	}
+	if len(cfg.Digests) == 0 && !stringutils.IsEmptyStr(cfg.Digest) {
+		digests = append(digests, cfg.Digest)
+	}
+	digests = append(digests, cfg.Digests...)
+	if cfg.RV.Sha256 != "" {
+		digests = append(digests, digest.String(digest.AlgorithmSHA256, cfg.RV.Sha256))
+	}
+	return digests
+}
+
+// ExpectedDigest returns the algorithm and the expected digest of the file in the form
+// of "algo:hex", which is the Digest if it's set, otherwise the md5 one of the Md5.
+// They're empty if neither of them is set.
+func (cfg *Config) ExpectedDigest() (algo, expected string) {
+	d := cfg.Digest
+	if stringutils.IsEmptyStr(d) {
+		d = cfg.Md5
+	}
+	if stringutils.IsEmptyStr(d) {
+		return "", ""
+	}
+	algo, encoded, err := digest.Parse(d)
+	if err != nil {
+		return "", ""
+	}
+	return algo, digest.String(algo, encoded)
+}
+
 // This function must be called after checkURL
 func checkOutput(cfg *Config) error {
 	if stringutils.IsEmptyStr(cfg.Output) {
@@ -297,6 +978,32 @@ func checkOutput(cfg *Config) error {
 		cfg.Output = absPath
 	}
 
+	switch cfg.IfExists {
+	case "", IfExistsOverwrite, IfExistsFail, IfExistsResume, IfExistsBackup:
+	default:
+		return fmt.Errorf("invalid policy when the target exists: %s", cfg.IfExists)
+	}
+
+	switch cfg.Symlink {
+	case "", SymlinkReplace:
+	case SymlinkFollow:
+		if f, err := os.Lstat(cfg.Output); err == nil && f.Mode()&os.ModeSymlink != 0 {
+			realPath, err := filepath.EvalSymlinks(cfg.Output)
+			if err != nil {
+				return fmt.Errorf("resolve symlink[%s] error: %v", cfg.Output, err)
+			}
+			cfg.Output = realPath
+		}
+	default:
+		return fmt.Errorf("invalid policy when the target is a symlink: %s", cfg.Symlink)
+	}
+
+	switch cfg.VerifyFailure {
+	case "", VerifyFailureDelete, VerifyFailureQuarantine:
+	default:
+		return fmt.Errorf("invalid policy when the file fails to be verified: %s", cfg.VerifyFailure)
+	}
+
 	if f, err := os.Stat(cfg.Output); err == nil && f.IsDir() {
 		return fmt.Errorf("path[%s] is directory but requires file path", cfg.Output)
 	}
@@ -323,25 +1030,44 @@ type RuntimeVariable struct {
 	SystemDataDir string
 
 	// DataDir specifies a directory to store temporary files.
-	// For now, the value of `DataDir` always equals `SystemDataDir`,
-	// and there is no difference between them.
+	// It's selected from the `DataDirs` if they're configured,
+	// otherwise it equals `SystemDataDir`.
 	// TODO: If there is insufficient disk space, we should set it to the `TargetDir`.
 	DataDir string
 
 	// RealTarget specifies the full target path whose value is equal to the `Output`.
 	RealTarget string
 
+	// BlockDevice indicates that the RealTarget is a block device or a raw partition,
+	// which is written in place instead of being renamed from a temp file.
+	BlockDevice bool
+
 	// StreamMode specifies that all pieces will be wrote to a Pipe, currently only support cdn mode.
 	// when StreamMode is true, all data will write directly.
 	// the mode is prepared for this issue https://github.com/dragonflyoss/Dragonfly/issues/1164
 	// TODO: support p2p mode
 	StreamMode bool
 
+	// StreamMemoryLimit is the maximal bytes of the pieces which are received out of order
+	// and held in memory until they're written to the pipe in StreamMode.
+	// The download fails once it's exceeded, and 0 means no limit.
+	StreamMemoryLimit int64
+
+	// StreamRangeOffset and StreamRangeLength are the range of the file which is downloaded
+	// only in StreamMode, which are registered to supernode so that only the pieces covering
+	// the range are scheduled. The length 0 means to the end of the file.
+	StreamRangeOffset int64
+	StreamRangeLength int64
+
 	// TargetDir is the directory of the RealTarget path.
 	TargetDir string
 
+	// TempDir is the directory in which the temp files of the target are created.
+	// It equals `WorkDir` if it's set, otherwise `TargetDir`.
+	TempDir string
+
 	// TempTarget is a temp file path that try to determine
-	// whether the `TargetDir` and the `DataDir` belong to the same disk by making a hard link.
+	// whether the `TempDir` and the `DataDir` belong to the same disk by making a hard link.
 	TempTarget string
 
 	// Cid means the client ID which is a string composed of `localIP + "-" + sign` which represents a peer node.
@@ -355,15 +1081,85 @@ type RuntimeVariable struct {
 	// TaskFileName is a string composed of `the last element of RealTarget path + "-" + sign`.
 	TaskFileName string
 
+	// TaskID is the ID of the task registered to supernode, it's empty if the file
+	// is downloaded from the source station without registering.
+	TaskID string
+
+	// ResponseHeaders are the headers of the response of the source kept with the task
+	// by supernode, which are returned at the registration and replayed by dfdaemon.
+	ResponseHeaders map[string]string
+
 	// LocalIP is the native IP which can connect supernode successfully.
 	LocalIP string
 
 	// PeerPort is the TCP port on which the file upload service listens as a peer node.
 	PeerPort int
 
-	// FileLength the length of the file to download.
+	// FileLength the length of the file to download, it's set atomically
+	// since the progress of the download is read by dfdaemon concurrently.
 	FileLength int64
 
+	// PeerBytes is the number of the bytes downloaded from the other peers
+	// rather than supernode, which is updated atomically.
+	PeerBytes int64
+
+	// SupernodeBytes is the number of the bytes downloaded from supernode,
+	// which is updated atomically.
+	SupernodeBytes int64
+
+	// SourceBytes is the number of the bytes downloaded from the source station directly,
+	// which is updated atomically.
+	SourceBytes int64
+
+	// MirrorBytes is the number of the bytes downloaded from the mirrors of the source station
+	// in the fallback chain, which is updated atomically.
+	MirrorBytes int64
+
+	// EdgeBytes is the number of the bytes downloaded from the edge caches
+	// advertised by supernode, which is updated atomically.
+	EdgeBytes int64
+
+	// Retries is the number of the retries during the download, including the retried
+	// and rescheduled pieces, the migrations to other supernodes and backing to the source,
+	// which is updated atomically.
+	Retries int64
+
+	// BackSourceTime is the time when the download starts to back to the source,
+	// and BackSourceDuration is the time spent downloading the file from the source.
+	// They're reported to supernode with BackSourceReason.
+	BackSourceTime     time.Time
+	BackSourceDuration time.Duration
+
+	// Stages are the results of the stages of the fallback chain which have run.
+	Stages []*StageResult
+
+	// EventLog records the events of the download which are uploaded to supernode,
+	// it's nil if UploadEventLog is false.
+	EventLog *EventLog
+
+	// CDNTLSConfig is the TLS config of the HTTPS connections to the CDN of supernode
+	// loaded from CDNTLS, it's nil if CDNTLS is nil.
+	CDNTLSConfig *tls.Config `json:"-"`
+
+	// Cgroup is the cgroup which the process has joined for the download if Cgroup
+	// of the properties is set, the peer server started by the process is released from it.
+	Cgroup *cgroup.Group `json:"-"`
+
+	// Context is the context of the download when it's run by the process embedding
+	// the core of dfget, such as dfdaemon on behalf of its clients. The download is
+	// aborted once it's done, and it's nil for the dfget command.
+	Context context.Context `json:"-"`
+
+	// Deprioritized is set to 1 atomically by the process embedding the core of dfget
+	// when nobody waits for the download anymore, then the P2P download continues at
+	// no more than MinRate, so that the pieces are still seeded to the other peers.
+	Deprioritized int32
+
+	// Sha256 is the sha256 digest of the file published by supernode when the task finishes,
+	// which is calculated by supernode CDN when it fetches the file from the source.
+	// The downloaded file is verified against it if it's not empty.
+	Sha256 string
+
 	// DataExpireTime specifies the caching duration for which
 	// cached files keep no accessed by any process.
 	// After this period, the cached files will be deleted.
@@ -373,6 +1169,61 @@ type RuntimeVariable struct {
 	// uploader keeps no accessing by any uploading requests.
 	// After this period, the uploader will automatically exit.
 	ServerAliveTime time.Duration
+
+	// MinSeedTime specifies the minimum duration for which uploader keeps
+	// seeding a downloaded file after the download finished,
+	// no matter whether other seeding policies are satisfied.
+	// The uploader will not automatically exit within this period either.
+	MinSeedTime time.Duration
+
+	// SeedRatio specifies the target ratio of the uploaded bytes to the file length.
+	// The uploader stops seeding a file once the ratio is reached.
+	// 0 means the ratio is not limited.
+	SeedRatio float64
+
+	// CacheSize specifies the max total size of the task files served by the uploader.
+	// The least recently accessed finished task files are evicted once it's exceeded,
+	// and the capacity and the utilization are advertised to the supernodes, which
+	// avoid relying on the nearly full peers. 0 means the size is not limited.
+	CacheSize fileutils.Fsize
+
+	// ReadAheadPieces specifies the number of the following pieces which the uploader
+	// reads ahead into the page cache when it observes the sequential piece requests
+	// of a task, which improves the disk throughput for the cold large files.
+	// 0 means that the read-ahead is disabled.
+	ReadAheadPieces int
+
+	// AccessLogSampleRate specifies the rate in [0, 1] of the requests to the uploader
+	// which are written to the access log. 0 means that the access log is disabled.
+	AccessLogSampleRate float64
+
+	// AdminPort specifies the port on the loopback address on which the uploader
+	// serves the diagnostics endpoints, such as pprof, expvar and the goroutine dump.
+	// 0 means that it's disabled.
+	AdminPort int
+
+	// Multiplex indicates whether the uploader serves the diagnostics endpoints and the
+	// control endpoints on the peer port besides the pieces and the health, each surface
+	// of which is authorized separately, so that only one port needs to be opened.
+	Multiplex bool
+
+	// DiskFailureLimit specifies the number of the read errors and the checksum failures
+	// of the task files within DiskFailureWindow, beyond which the uploader treats its disk
+	// as failing and fences itself: it stops serving the pieces, tells the supernodes that
+	// its task files aren't served any more and leaves a fence file next to the meta file,
+	// so that the following downloads don't start a new uploader on the same disk.
+	// 0 means that the disk failures are never counted.
+	DiskFailureLimit int
+
+	// ReverifyOnFence indicates whether the uploader re-verifies all the task files it
+	// serves once it's fenced, and removes the ones which can't be read or don't match
+	// their md5s, so that only the sound files are served after the fence is lifted.
+	ReverifyOnFence bool
+
+	// SeedDir specifies a read-only directory of the task files staged in advance,
+	// such as the ones baked into the image. The uploader serves them directly as a seeder
+	// according to the manifest file in the directory.
+	SeedDir string
 }
 
 func (rv *RuntimeVariable) String() string {
@@ -29,7 +29,9 @@ import (
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 
 	"github.com/go-check/check"
@@ -159,6 +161,113 @@ func (suite *ConfigSuite) TestCheckOutput(c *check.C) {
 	}
 }
 
+func (suite *ConfigSuite) TestCheckDigest(c *check.C) {
+	md5Hex := "098f6bcd4621d373cade4e832627b4f6"
+	sha256Hex := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	cases := []struct {
+		md5            string
+		digest         string
+		err            bool
+		expectedMd5    string
+		expectedDigest string
+	}{
+		{"", "", false, "", ""},
+		{md5Hex, "", false, md5Hex, "md5:" + md5Hex},
+		{"", strings.ToUpper(md5Hex), false, md5Hex, "md5:" + md5Hex},
+		{md5Hex, "MD5:" + md5Hex, false, md5Hex, "md5:" + md5Hex},
+		{"", "sha256:" + sha256Hex, false, "", "sha256:" + sha256Hex},
+		{md5Hex, "sha256:" + sha256Hex, false, md5Hex, "sha256:" + sha256Hex},
+		{md5Hex, "md5:" + strings.Repeat("0", 32), true, "", ""},
+		{"", "sha256:" + md5Hex, true, "", ""},
+		{"", "crc32:0", true, "", ""},
+		{"", "md5:" + md5Hex + ", sha256:" + sha256Hex, false, md5Hex, "sha256:" + sha256Hex},
+		{"", "sha256:" + sha256Hex + ",sha256:" + strings.Repeat("0", 64), true, "", ""},
+		{"", "sha256:" + sha256Hex + ",crc32:0", true, "", ""},
+	}
+	for _, v := range cases {
+		cfg := &Config{Md5: v.md5, Digest: v.digest}
+		err := checkDigest(cfg)
+		c.Assert(err != nil, check.Equals, v.err, check.Commentf("%v", v))
+		if !v.err {
+			c.Check(cfg.Md5, check.Equals, v.expectedMd5)
+			c.Check(cfg.Digest, check.Equals, v.expectedDigest)
+		}
+	}
+
+	cfg := &Config{Digest: "sha256:" + sha256Hex + ",MD5:" + md5Hex}
+	c.Assert(checkDigest(cfg), check.IsNil)
+	c.Check(cfg.Digests, check.DeepEquals, []string{"sha256:" + sha256Hex, "md5:" + md5Hex})
+	// it's the same after checked again
+	c.Assert(checkDigest(cfg), check.IsNil)
+	c.Check(cfg.Digests, check.HasLen, 2)
+	cfg.RV.Sha256 = sha256Hex
+	c.Check(cfg.ExpectedDigests(), check.DeepEquals, []string{"md5:" + md5Hex, "sha256:" + sha256Hex,
+		"md5:" + md5Hex, "sha256:" + sha256Hex})
+
+	algo, expected := (&Config{Md5: md5Hex, Digest: "SHA256:" + sha256Hex}).ExpectedDigest()
+	c.Check(algo, check.Equals, "sha256")
+	c.Check(expected, check.Equals, "sha256:"+sha256Hex)
+	algo, expected = (&Config{Md5: md5Hex}).ExpectedDigest()
+	c.Check(algo, check.Equals, "md5")
+	c.Check(expected, check.Equals, "md5:"+md5Hex)
+	algo, expected = (&Config{}).ExpectedDigest()
+	c.Check(algo, check.Equals, "")
+	c.Check(expected, check.Equals, "")
+}
+
+func (suite *ConfigSuite) TestCheckHeaders(c *check.C) {
+	tmpDir, _ := ioutil.TempDir("/tmp", "dfget-TestCheckHeaders-")
+	defer os.RemoveAll(tmpDir)
+	headerFile := filepath.Join(tmpDir, "headers")
+	content := "# the credentials\nAuthorization: Bearer ${env:DFGET_TEST_TOKEN}\n\n  Accept: *  \n"
+	c.Assert(ioutil.WriteFile(headerFile, []byte(content), 0600), check.IsNil)
+	os.Setenv("DFGET_TEST_TOKEN", "t1")
+	defer os.Unsetenv("DFGET_TEST_TOKEN")
+
+	cfg := &Config{Header: []string{"Host: abc"}, HeaderFile: headerFile}
+	c.Assert(checkHeaders(cfg), check.IsNil)
+	c.Check(cfg.Header, check.DeepEquals, []string{"Host: abc", "Authorization: Bearer t1", "Accept: *"})
+	c.Check(strings.Contains(cfg.String(), "t1"), check.Equals, false)
+
+	cfg = &Config{Header: []string{"X-Api-Key: ${env:DFGET_TEST_UNSET}"}}
+	c.Check(checkHeaders(cfg), check.ErrorMatches, ".*X-Api-Key references the unset environment variable DFGET_TEST_UNSET")
+
+	cfg = &Config{HeaderFile: filepath.Join(tmpDir, "notexist")}
+	c.Check(checkHeaders(cfg), check.NotNil)
+}
+
+func (suite *ConfigSuite) TestCheckOutputPolicies(c *check.C) {
+	tmpDir, _ := ioutil.TempDir("/tmp", "dfget-TestCheckOutputPolicies-")
+	defer os.RemoveAll(tmpDir)
+	realPath := filepath.Join(tmpDir, "real")
+	linkPath := filepath.Join(tmpDir, "link")
+	c.Assert(ioutil.WriteFile(realPath, []byte("real"), 0644), check.IsNil)
+	c.Assert(os.Symlink(realPath, linkPath), check.IsNil)
+
+	cfg := NewConfig()
+	cfg.Output = linkPath
+	c.Assert(checkOutput(cfg), check.IsNil)
+	c.Check(cfg.Output, check.Equals, linkPath)
+
+	cfg.Symlink = SymlinkFollow
+	c.Assert(checkOutput(cfg), check.IsNil)
+	c.Check(cfg.Output, check.Equals, realPath)
+
+	cfg.Symlink = "x"
+	c.Check(checkOutput(cfg), check.NotNil)
+
+	cfg.Symlink = ""
+	cfg.IfExists = "x"
+	c.Check(checkOutput(cfg), check.NotNil)
+	cfg.IfExists = IfExistsBackup
+	c.Check(checkOutput(cfg), check.IsNil)
+
+	cfg.VerifyFailure = "x"
+	c.Check(checkOutput(cfg), check.NotNil)
+	cfg.VerifyFailure = VerifyFailureQuarantine
+	c.Check(checkOutput(cfg), check.IsNil)
+}
+
 func (suite *ConfigSuite) TestProperties_Load(c *check.C) {
 	dirName, _ := ioutil.TempDir("/tmp", "dfget-TestProperties_Load-")
 	defer os.RemoveAll(dirName)
@@ -183,6 +292,35 @@ func (suite *ConfigSuite) TestProperties_Load(c *check.C) {
 		{create: true, ext: "yaml",
 			content: "totalLimit: 10M",
 			errMsg:  "", expected: &Properties{TotalLimit: 10 * rate.MB}},
+		{create: true, ext: "yaml",
+			content: "peerPortRange: 15000-15100",
+			errMsg:  "", expected: &Properties{PeerPortRange: PortRange{15000, 15100}}},
+		{create: true, ext: "yaml",
+			content: "peerPortRange: 15100-15000", errMsg: "port range"},
+		{create: true, ext: "yaml",
+			content: "reportBatchSize: 16\nreportInterval: 1s",
+			errMsg:  "", expected: &Properties{ReportBatchSize: 16, ReportInterval: time.Second}},
+		{create: true, ext: "yaml",
+			content: "retry:\n  maxAttempts: 5\n  backoffBase: 100ms\n  jitter: 0.5",
+			errMsg:  "", expected: &Properties{Retry: retry.Policy{MaxAttempts: 5, BackoffBase: 100 * time.Millisecond, Jitter: 0.5}}},
+		{create: true, ext: "yaml",
+			content: "retry:\n  jitter: 2", errMsg: "jitter"},
+		{create: true, ext: "yaml",
+			content: "dnsCacheTTL: 30s\ndnsNegativeCacheTTL: 5s",
+			errMsg:  "", expected: &Properties{DNSCacheTTL: 30 * time.Second, DNSNegativeCacheTTL: 5 * time.Second}},
+		{create: true, ext: "yaml",
+			content: "dataDirs:\n  - /data1=2\n  - /data2\ndataDirPlacement: freespace",
+			errMsg:  "", expected: &Properties{
+				DataDirs:         []*DataDirWeight{{"/data1", 2}, {"/data2", 1}},
+				DataDirPlacement: DataDirPlacementFreeSpace,
+			}},
+		{create: true, ext: "yaml",
+			content: "cgroup:\n  cpu: 0.5\n  memory: 512M\n  ioWriteLimit: 100M",
+			errMsg:  "", expected: &Properties{Cgroup: &CgroupConfig{
+				CPU:          0.5,
+				Memory:       512 * fileutils.MB,
+				IOWriteLimit: 100 * rate.MB,
+			}}},
 		{create: false, ext: "ini", content: "[node]\naddress=1.1.1.1", errMsg: "read ini config"},
 		{create: true, ext: "ini", content: "[node]\naddress=1.1.1.1",
 			expected: &Properties{Supernodes: []*NodeWeight{
@@ -17,6 +17,7 @@
 package config
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/rate"
@@ -45,6 +46,39 @@ const (
 	PatternSource = "source"
 )
 
+/* download priority */
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+/* data directory placement */
+const (
+	DataDirPlacementWeight    = "weight"
+	DataDirPlacementFreeSpace = "freespace"
+)
+
+/* policy when the target already exists */
+const (
+	IfExistsOverwrite = "overwrite"
+	IfExistsFail      = "fail"
+	IfExistsResume    = "resume"
+	IfExistsBackup    = "backup"
+)
+
+/* policy when the target is a symlink */
+const (
+	SymlinkReplace = "replace"
+	SymlinkFollow  = "follow"
+)
+
+/* policy when the downloaded file fails to be verified */
+const (
+	VerifyFailureDelete     = "delete"
+	VerifyFailureQuarantine = "quarantine"
+)
+
 /* properties */
 const (
 	DefaultYamlConfigFile  = "/etc/dragonfly/dfget.yml"
@@ -52,9 +86,28 @@ const (
 	DefaultLocalLimit      = 20 * rate.MB
 	DefaultMinRate         = 64 * rate.KB
 	DefaultClientQueueSize = 6
+	DefaultReportBatchSize = 8
+	DefaultReportInterval  = 200 * time.Millisecond
 	DefaultSupernodeWeight = 1
+	DefaultDataDirWeight   = 1
+
+	DefaultBackSourceMaxRedirects = 10
+
+	DefaultBackSourceResumeAttempts    = 3
+	DefaultBackSourceResumeBackoffBase = time.Second
+	DefaultBackSourceResumeBackoffCap  = 30 * time.Second
+
+	DefaultRegisterHedges = 1
+
+	// MinBackSourceSegmentSize is the min size of the ranges of the file
+	// downloaded concurrently from the source station.
+	MinBackSourceSegmentSize = 4 * rate.MB
 )
 
+// DefaultBackSourceStatus is the default acceptable status codes
+// of the response from the source station.
+var DefaultBackSourceStatus = []int{http.StatusOK}
+
 /* http headers */
 const (
 	StrRange         = "Range"
@@ -69,9 +122,24 @@ const (
 	StrRateLimit    = "rateLimit"
 	StrPieceNum     = "pieceNum"
 	StrPieceSize    = "pieceSize"
+	StrPieceOffset  = "pieceOffset"
 	StrDataDir      = "dataDir"
 	StrTotalLimit   = "totalLimit"
 	StrCDNSource    = "cdnSource"
+	StrURL          = "url"
+	StrTaskURL      = "taskURL"
+	StrMd5          = "md5"
+	StrIdentifier   = "identifier"
+	StrNamespace    = "namespace"
+	StrAcceptPush   = "acceptPush"
+	StrTarget       = "target"
+	StrCurrent      = "current"
+	StrRequestID    = "requestID"
+	StrError        = "error"
+	StrTTL          = "ttl"
+	StrExpires      = "expires"
+	StrNonce        = "nonce"
+	StrSignature    = "sig"
 
 	StrBytes   = "bytes"
 	StrPattern = "pattern"
@@ -108,16 +176,113 @@ const (
 	RangeNotSatisfiableDesc = "range not satisfiable"
 	AddrUsedDesc            = "address already in use"
 
-	PeerHTTPPathPrefix = "/peer/file/"
-	CDNPathPrefix      = "/qtdown/"
+	PeerHTTPPathPrefix  = "/peer/file/"
+	PushHTTPPathPrefix  = "/push/"
+	ShareHTTPPathPrefix = "/share/"
+	CDNPathPrefix       = "/qtdown/"
+
+	// SuperNodeCIDPrefix is the prefix of the CIDs of supernode, which tells
+	// the pieces downloaded from the CDN of supernode.
+	SuperNodeCIDPrefix = "cdnnode:"
+	SchemaHTTPS        = "https"
 
 	LocalHTTPPathCheck  = "/check/"
 	LocalHTTPPathClient = "/client/"
 	LocalHTTPPathRate   = "/rate/"
 	LocalHTTPPing       = "/server/ping"
 
+	// CacheDirName is the name of the directory in the work home which stores
+	// the task files imported from the cache archives. It's used as the seed directory
+	// of the peer server started by dfget.
+	CacheDirName = "cache"
+
+	// QuarantineDirName is the name of the directory in the work home which stores
+	// the downloaded files failing to be verified when VerifyFailure is quarantine.
+	QuarantineDirName = "quarantine"
+
+	// ReplicaDirName is the name of the directory in the work home which the pieces
+	// of the tasks assigned by supernode to be replicated are downloaded to.
+	ReplicaDirName = "replica"
+
+	// PushDirName is the name of the directory in the work home which the pieces
+	// pushed by the other peers to the running downloads are received into.
+	PushDirName = "push"
+
+	// SeedManifestFile is the name of the manifest file in the seed directory,
+	// which describes the task files staged in the directory.
+	SeedManifestFile = "manifest.json"
+
+	// BackupFileSuffix is the suffix of the backup of the existing target
+	// which is kept when IfExists is backup.
+	BackupFileSuffix = ".bak"
+
+	// DefaultOrphanFileAge is the default minimal age of the orphaned temp files
+	// left by the crashed dfget processes before they're removed.
+	DefaultOrphanFileAge = time.Hour
+
+	// DefaultPeerProbeInterval is the interval of probing the health of the peers
+	// which the pieces are downloaded from.
+	DefaultPeerProbeInterval = 3 * time.Second
+
+	// UploaderSocketFile is the name of the unix domain socket file in the directory
+	// of the meta file, on which the uploader serves the requests of the local dfget processes.
+	UploaderSocketFile = "uploader.sock"
+
+	// DefaultReadAheadPieces is the default number of the pieces which the peer server
+	// reads ahead when it observes the sequential piece requests of a task.
+	DefaultReadAheadPieces = 4
+
+	// DefaultProgressExtendInterval is the interval of requesting the extensions of the
+	// progress deadline from supernode before the deadline is known.
+	DefaultProgressExtendInterval = 30 * time.Second
+
+	// DefaultKeepaliveInterval is the max interval of the keepalives sent to supernode
+	// during a download, which is shortened to a third of the expiry time of the task
+	// returned by supernode.
+	DefaultKeepaliveInterval = time.Minute
+
+	// DefaultClockSkewTolerance is the max offset of the clock of supernode from the local one
+	// estimated at the registration, beyond which a warning is logged.
+	DefaultClockSkewTolerance = 5 * time.Second
+
+	// BandwidthProbeSize is the number of the bytes requested from supernode
+	// to probe the bandwidth.
+	BandwidthProbeSize = 4 * rate.MB
+
+	// BandwidthProbeFile is the name of the file in the meta directory which caches
+	// the result of the last bandwidth probe for BandwidthProbeTTL.
+	BandwidthProbeFile = "bandwidth.json"
+	BandwidthProbeTTL  = time.Hour
+
+	// MaxClientQueueSize is the max ClientQueueSize set from the bandwidth probe.
+	MaxClientQueueSize = 32
+
+	// PieceWriteAttempts is the max number of the attempts of writing a piece to disk
+	// when less data than the piece is written.
+	PieceWriteAttempts = 2
+
+	// DefaultDiskFailureLimit is the default number of the read errors and the checksum
+	// failures of the task files within DiskFailureWindow, beyond which the uploader fences itself.
+	DefaultDiskFailureLimit = 5
+	DiskFailureWindow       = 10 * time.Minute
+
+	// FenceFile is the name of the file in the meta directory which is left by the
+	// uploader fenced for its disk failures. No uploader is started by dfget until
+	// it's removed, such as by the operator after replacing the disk.
+	FenceFile = "fence.json"
+
+	// DefaultShareLinkTTL is the default time for which a share link of a task file is valid,
+	// and MaxShareLinkTTL is the max one.
+	DefaultShareLinkTTL = time.Hour
+	MaxShareLinkTTL     = 24 * time.Hour
+
+	// DefaultEventLogSize is the max number of the events kept in the event log
+	// of a download, beyond which the events are dropped.
+	DefaultEventLogSize = 256
+
 	DataExpireTime         = 3 * time.Minute
 	ServerAliveTime        = 5 * time.Minute
+	HeartBeatInterval      = 10 * time.Second
 	DefaultDownloadTimeout = 5 * time.Minute
 
 	DefaultSupernodeSchema = "http"
@@ -141,6 +306,15 @@ const (
 
 	// CodeDownloadError represents failed to download file.
 	CodeDownloadError
+
+	// CodeVerifyError represents failed to verify the local file.
+	CodeVerifyError
+
+	// CodeSizeLimitError represents the source station sends more data than allowed.
+	CodeSizeLimitError
+
+	// CodeDigestMismatchError represents the downloaded file doesn't match the expected md5 or digest.
+	CodeDigestMismatchError
 )
 
 const (
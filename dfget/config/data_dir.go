@@ -0,0 +1,154 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// DataDirWeight is a data directory with the weight of placing the downloaded files into it.
+type DataDirWeight struct {
+	Path   string
+	Weight int
+}
+
+// DataDirsValue implements the pflag.Value interface for the data directories,
+// format: "path=weight" separated by comma, and the weight(default: 1) is optional.
+type DataDirsValue struct {
+	Dirs *[]*DataDirWeight
+}
+
+// NewDataDirsValue creates a DataDirsValue which stores the parsed value to p.
+func NewDataDirsValue(p *[]*DataDirWeight, val []*DataDirWeight) *DataDirsValue {
+	dv := &DataDirsValue{Dirs: p}
+	*dv.Dirs = val
+	return dv
+}
+
+// String implements the pflag.Value interface.
+func (dv *DataDirsValue) String() string {
+	var result []string
+	for _, v := range *dv.Dirs {
+		result = append(result, v.string())
+	}
+	return strings.Join(result, ",")
+}
+
+// Set implements the pflag.Value interface.
+func (dv *DataDirsValue) Set(value string) error {
+	dirs, err := ParseDataDirs(strings.Split(value, ","))
+	if err != nil {
+		return err
+	}
+	*dv.Dirs = dirs
+	return nil
+}
+
+// Type implements the pflag.Value interface.
+func (dv *DataDirsValue) Type() string {
+	return "datadirs"
+}
+
+// ParseDataDirs parses the values in format "path=weight" to []*DataDirWeight.
+func ParseDataDirs(values []string) ([]*DataDirWeight, error) {
+	var result []*DataDirWeight
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		dir, err := string2DataDirWeight(v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, dir)
+	}
+	return result, nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (dw *DataDirWeight) MarshalYAML() (interface{}, error) {
+	return dw.string(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (dw *DataDirWeight) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	dir, err := string2DataDirWeight(value)
+	if err != nil {
+		return err
+	}
+	*dw = *dir
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (dw *DataDirWeight) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dw.string())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (dw *DataDirWeight) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	dir, err := string2DataDirWeight(value)
+	if err != nil {
+		return err
+	}
+	*dw = *dir
+	return nil
+}
+
+func (dw *DataDirWeight) string() string {
+	return fmt.Sprintf("%s%c%d", dw.Path, weightSeparator, dw.Weight)
+}
+
+func string2DataDirWeight(value string) (*DataDirWeight, error) {
+	path := strings.TrimSpace(value)
+	weight := DefaultDataDirWeight
+	if idx := strings.LastIndexByte(path, weightSeparator); idx >= 0 {
+		w, err := strconv.Atoi(strings.TrimSpace(path[idx+1:]))
+		if err != nil || w <= 0 {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue,
+				"data dir: %s, the weight must be a positive integer", value)
+		}
+		path, weight = strings.TrimSpace(path[:idx]), w
+	}
+
+	if !filepath.IsAbs(path) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue,
+			"data dir: %s, the path must be absolute", value)
+	}
+	return &DataDirWeight{
+		Path:   filepath.Clean(path),
+		Weight: weight,
+	}, nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/go-check/check"
+)
+
+func (suite *ConfigSuite) TestParseDataDirs(c *check.C) {
+	var cases = []struct {
+		values   []string
+		expected []*DataDirWeight
+		hasErr   bool
+	}{
+		{values: []string{""}, expected: nil},
+		{values: []string{"/data1/dragonfly", "/data2=2"},
+			expected: []*DataDirWeight{{"/data1/dragonfly", 1}, {"/data2", 2}}},
+		{values: []string{"/data1/dragonfly/ = 3"},
+			expected: []*DataDirWeight{{"/data1/dragonfly", 3}}},
+		{values: []string{"data1"}, hasErr: true},
+		{values: []string{"/data1=0"}, hasErr: true},
+		{values: []string{"/data1=a"}, hasErr: true},
+	}
+
+	for _, v := range cases {
+		dirs, err := ParseDataDirs(v.values)
+		if v.hasErr {
+			c.Check(err, check.NotNil, check.Commentf("%v", v.values))
+			continue
+		}
+		c.Check(err, check.IsNil, check.Commentf("%v", v.values))
+		c.Check(dirs, check.DeepEquals, v.expected)
+	}
+}
+
+func (suite *ConfigSuite) TestDataDirsValue(c *check.C) {
+	var dirs []*DataDirWeight
+	dv := NewDataDirsValue(&dirs, nil)
+	c.Check(dv.String(), check.Equals, "")
+
+	c.Assert(dv.Set("/data1,/data2=2"), check.IsNil)
+	c.Check(dirs, check.DeepEquals, []*DataDirWeight{{"/data1", 1}, {"/data2", 2}})
+	c.Check(dv.String(), check.Equals, "/data1=1,/data2=2")
+	c.Check(dv.Set("/data1=x"), check.NotNil)
+}
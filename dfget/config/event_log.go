@@ -0,0 +1,97 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+
+	strfmt "github.com/go-openapi/strfmt"
+)
+
+/* the types of the events in the event log */
+const (
+	EventWait       = "wait"
+	EventRetry      = "retry"
+	EventPieceError = "piece-error"
+	EventMigrate    = "migrate"
+	EventBackSource = "back-source"
+	EventFallback   = "fallback"
+	EventError      = "error"
+)
+
+// EventLog is a compact log of the events which dfget runs into during a download,
+// such as the schedule waits, the retries and the errors. It's uploaded to supernode
+// with the metrics when the download finishes, so the failed downloads could be
+// debugged without logging into the node.
+// All methods of a nil EventLog are no-ops.
+type EventLog struct {
+	sync.Mutex
+
+	size    int
+	events  []*types.TaskEvent
+	dropped int32
+}
+
+// NewEventLog creates an EventLog which keeps at most size events.
+func NewEventLog(size int) *EventLog {
+	return &EventLog{size: size}
+}
+
+// Record records an event. It's folded into the last event if they're of the same type,
+// piece and peer, so that a long run of schedule waits takes only one entry.
+func (l *EventLog) Record(typ, pieceRange, peer, message string) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+
+	if n := len(l.events); n > 0 {
+		last := l.events[n-1]
+		if last.Type == typ && last.PieceRange == pieceRange && last.Peer == peer {
+			last.Count++
+			last.Message = message
+			return
+		}
+	}
+	if len(l.events) >= l.size {
+		l.dropped++
+		return
+	}
+	l.events = append(l.events, &types.TaskEvent{
+		Time:       strfmt.DateTime(time.Now()),
+		Type:       typ,
+		PieceRange: pieceRange,
+		Peer:       peer,
+		Message:    message,
+		Count:      1,
+	})
+}
+
+// Events returns the recorded events and the number of the events dropped
+// since the log is full.
+func (l *EventLog) Events() ([]*types.TaskEvent, int32) {
+	if l == nil {
+		return nil, 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	return append([]*types.TaskEvent(nil), l.events...), l.dropped
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/go-check/check"
+)
+
+func (suite *ConfigSuite) TestEventLog(c *check.C) {
+	var l *EventLog
+	l.Record(EventWait, "0-99", "127.0.0.1:8002", "")
+	events, dropped := l.Events()
+	c.Check(events, check.IsNil)
+	c.Check(dropped, check.Equals, int32(0))
+
+	l = NewEventLog(2)
+	l.Record(EventWait, "0-99", "127.0.0.1:8002", "wait 1")
+	l.Record(EventWait, "0-99", "127.0.0.1:8002", "wait 2")
+	l.Record(EventRetry, "0-99", "127.0.0.2:15001", "timeout")
+	l.Record(EventError, "", "", "failed")
+	events, dropped = l.Events()
+	c.Assert(events, check.HasLen, 2)
+	c.Check(events[0].Type, check.Equals, EventWait)
+	c.Check(events[0].Count, check.Equals, int32(2))
+	c.Check(events[0].Message, check.Equals, "wait 2")
+	c.Check(events[1].Type, check.Equals, EventRetry)
+	c.Check(events[1].Peer, check.Equals, "127.0.0.2:15001")
+	c.Check(dropped, check.Equals, int32(1))
+}
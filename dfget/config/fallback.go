@@ -0,0 +1,166 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+/* the providers of the stages of the fallback chain */
+const (
+	// ProviderDragonfly downloads the file from the peers and the CDN of supernode,
+	// as the pieces are scheduled by supernode with the download pattern.
+	ProviderDragonfly = "dragonfly"
+	// ProviderMirror downloads the file from a mirror of the source station.
+	ProviderMirror = "mirror"
+	// ProviderSource downloads the file from the source station directly.
+	ProviderSource = "source"
+)
+
+// FallbackStage is a stage of the FallbackChain, which downloads the file from a provider.
+type FallbackStage struct {
+	// Provider is where the file is downloaded from in the stage,
+	// must be dragonfly/mirror/source.
+	Provider string `yaml:"provider" json:"provider"`
+
+	// URL is the base url of the mirror, which replaces the scheme and the host of
+	// the url downloaded and prefixes its path, e.g. the url http://a.com/b/c is
+	// downloaded from http://mirror.local/a/b/c with the base url http://mirror.local/a.
+	// It's only used by the mirror stage.
+	URL string `yaml:"url,omitempty" json:"url,omitempty"`
+
+	// Hosts are the hosts of the urls which the mirror serves, and the mirror stage
+	// is skipped for the urls of other hosts. The mirror serves all the urls if it's empty.
+	Hosts []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+
+	// Timeout is the max time of the stage, after which the next stage is tried.
+	// The timeout of the download is used if it's 0.
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// DefaultFallbackChain returns the fallback chain used when FallbackChain is empty,
+// which downloads the file by dragonfly and backs to the source station if it fails.
+func DefaultFallbackChain() []*FallbackStage {
+	return []*FallbackStage{
+		{Provider: ProviderDragonfly},
+		{Provider: ProviderSource},
+	}
+}
+
+// Name returns the name of the stage in the logs and the summary, which is the provider
+// followed by the host of the mirror for the mirror stage.
+func (s *FallbackStage) Name() string {
+	if s.Provider != ProviderMirror {
+		return s.Provider
+	}
+	if u, err := url.Parse(s.URL); err == nil && u.Host != "" {
+		return s.Provider + "(" + u.Host + ")"
+	}
+	return s.Provider
+}
+
+// Serves reports whether the mirror stage serves the url.
+func (s *FallbackStage) Serves(rawURL string) bool {
+	if len(s.Hosts) == 0 {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, h := range s.Hosts {
+		if strings.EqualFold(h, u.Host) || strings.EqualFold(h, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// MirrorURL returns the url from which the mirror stage downloads the file of rawURL.
+func (s *FallbackStage) MirrorURL(rawURL string) (string, error) {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.User = base.User
+	if base.Path != "" && base.Path != "/" {
+		u.Path = path.Join(base.Path, u.Path)
+		u.RawPath = ""
+	}
+	return u.String(), nil
+}
+
+// HasProvider reports whether any stage of the chain downloads from the provider.
+func HasProvider(chain []*FallbackStage, provider string) bool {
+	for _, s := range chain {
+		if s.Provider == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFallbackChain checks the stages of the chain. The dragonfly stage can only be
+// the first one, since the file is registered to supernode before the first stage starts.
+func validateFallbackChain(chain []*FallbackStage) error {
+	for i, s := range chain {
+		if s == nil {
+			return invalid("fallbackChain", "empty stage %d", i)
+		}
+		switch s.Provider {
+		case ProviderDragonfly:
+			if i > 0 {
+				return invalid("fallbackChain", "dragonfly must be the first stage: stage %d", i)
+			}
+		case ProviderMirror:
+			u, err := url.Parse(s.URL)
+			if err != nil || (u.Scheme != SchemaHTTP && u.Scheme != SchemaHTTPS) || u.Host == "" {
+				return invalid("fallbackChain", "url of the mirror of stage %d must be a http(s) url: %s", i, s.URL)
+			}
+		case ProviderSource:
+		default:
+			return invalid("fallbackChain", "provider of stage %d must be dragonfly, mirror or source: %s", i, s.Provider)
+		}
+		if s.Timeout < 0 {
+			return invalid("fallbackChain", "timeout of stage %d must not be negative: %v", i, s.Timeout)
+		}
+	}
+	return nil
+}
+
+// StageResult is the result of a stage of the fallback chain which has run.
+type StageResult struct {
+	Name string `json:"name"`
+
+	// Duration is the time of the stage in seconds.
+	Duration float64 `json:"duration"`
+
+	// Bytes is the number of the bytes downloaded in the stage.
+	Bytes int64 `json:"bytes"`
+
+	// Error is the error failing the stage, it's empty if the file is downloaded.
+	Error string `json:"error,omitempty"`
+}
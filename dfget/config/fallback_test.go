@@ -0,0 +1,41 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/go-check/check"
+)
+
+func (suite *ConfigSuite) TestFallbackStage(c *check.C) {
+	stage := &FallbackStage{Provider: ProviderMirror, URL: "http://mirror.local:8080/cache", Hosts: []string{"a.com"}}
+	c.Check(stage.Name(), check.Equals, "mirror(mirror.local:8080)")
+	c.Check(stage.Serves("https://a.com/x"), check.Equals, true)
+	c.Check(stage.Serves("https://b.com/x"), check.Equals, false)
+
+	u, err := stage.MirrorURL("https://a.com/b/c?d=1")
+	c.Assert(err, check.IsNil)
+	c.Check(u, check.Equals, "http://mirror.local:8080/cache/b/c?d=1")
+
+	stage.URL = "http://mirror.local"
+	u, err = stage.MirrorURL("https://a.com/b/c")
+	c.Assert(err, check.IsNil)
+	c.Check(u, check.Equals, "http://mirror.local/b/c")
+
+	c.Check(HasProvider(DefaultFallbackChain(), ProviderDragonfly), check.Equals, true)
+	c.Check(HasProvider([]*FallbackStage{stage}, ProviderDragonfly), check.Equals, false)
+	c.Check((&FallbackStage{Provider: ProviderSource}).Name(), check.Equals, ProviderSource)
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/spf13/pflag"
+)
+
+// AddFlags adds the flags of dfget to the flagSet which set the options of cfg,
+// so that the same flags could be parsed by the dfget command and the programs
+// which run the downloads of dfget in their own processes.
+func AddFlags(flagSet *pflag.FlagSet, cfg *Config) {
+	// url & output
+	flagSet.StringVarP(&cfg.URL, "url", "u", "", "URL of user requested downloading file(only HTTP/HTTPs supported)")
+	flagSet.StringVarP(&cfg.Output, "output", "o", "",
+		"destination path which is used to store the requested downloading file. It must contain detailed directory and specific filename, for example, '/tmp/file.mp4'. It could also be a block device such as '/dev/vdb', which is written in place")
+
+	// localLimit & minRate & totalLimit & timeout
+	flagSet.VarP(&cfg.LocalLimit, "locallimit", "s",
+		"network bandwidth rate limit for single download task, in format of G(B)/g/M(B)/m/K(B)/k/B, pure number will also be parsed as Byte")
+	flagSet.Var(&cfg.MinRate, "minrate",
+		"minimal network bandwidth rate for downloading a file, in format of G(B)/g/M(B)/m/K(B)/k/B, pure number will also be parsed as Byte")
+	flagSet.Var(&cfg.TotalLimit, "totallimit",
+		"network bandwidth rate limit for the whole host, in format of G(B)/g/M(B)/m/K(B)/k/B, pure number will also be parsed as Byte")
+	flagSet.DurationVarP(&cfg.Timeout, "timeout", "e", 0,
+		"timeout set for file downloading task. If dfget has not finished downloading all pieces of file before --timeout, the dfget will throw an error and exit")
+
+	// md5 & identifier
+	flagSet.StringVarP(&cfg.Md5, "md5", "m", "",
+		"md5 value input from user for the requested downloading file to enhance security")
+	flagSet.StringVar(&cfg.Digest, "digest", "",
+		"the expected digest of the requested downloading file in the form of algo:hex, where the algo is md5, sha256 or sha512. An md5 digest is the same as --md5. Several digests of different algorithms can be given separated by commas, such as md5:hex,sha256:hex, and all of them are verified in a single pass")
+	flagSet.StringVarP(&cfg.Identifier, "identifier", "i", "",
+		"the usage of identifier is making different downloading tasks generate different downloading task IDs even if they have the same URLs. conflict with --md5.")
+	flagSet.StringVar(&cfg.CallSystem, "callsystem", "",
+		"the name of dfget caller which is for debugging. Once set, it will be passed to all components around the request to make debugging easy")
+	flagSet.StringSliceVar(&cfg.Cacerts, "cacerts", nil,
+		"the cacert file which is used to verify remote server when supernode interact with the source.")
+	flagSet.StringVarP(&cfg.Pattern, "pattern", "p", "p2p",
+		"download pattern, must be p2p/cdn/source, cdn and source do not support flag --totallimit")
+	flagSet.StringVar(&cfg.Priority, "priority", "",
+		"priority class of the download which supernode prefers to the ones of a lower priority in scheduling and fetching from the source, must be high/normal/low, default: high with --dfdaemon, otherwise normal")
+	flagSet.StringVar(&cfg.Group, "group", "",
+		"ID of the task group which the download belongs to, such as all the layers of an image, the downloads of a group are listed together by supernode")
+	flagSet.Var(&deadlineValue{deadline: &cfg.GroupDeadline}, "group-deadline",
+		"time in RFC3339 by which the downloads of the group should finish, they're scheduled as high priority once it's within groupUrgentWindow of supernode")
+	flagSet.VarP(&filterValue{filter: &cfg.Filter}, "filter", "f",
+		"filter some query params of URL, use char '&' to separate different params"+
+			"\neg: -f 'key&sign' will filter 'key' and 'sign' query param"+
+			"\na param ending with '*' filters all the params with the prefix before it, eg: -f 'X-Amz-*'"+
+			"\nin this way, different but actually the same URLs can reuse the same downloading task")
+	flagSet.StringArrayVar(&cfg.Header, "header", nil,
+		"http header, eg: --header='Accept: *' --header='Host: abc', a value may reference an environment variable as ${env:NAME} in single quotes, such as --header='Authorization: Bearer ${env:TOKEN}', so that the credential isn't visible in the arguments of the process")
+	flagSet.StringVar(&cfg.HeaderFile, "header-file", "",
+		"file which contains the http headers in the same form as --header, one per line, the blank lines and the ones starting with '#' are ignored")
+	flagSet.StringVar(&cfg.Namespace, "namespace", "",
+		"namespace of the tenant which the download belongs to, the cached file is encrypted with the key of the namespace in cacheKeys of the config file")
+	flagSet.VarP(NewSupernodesValue(&cfg.Supernodes, nil), "node", "n",
+		"specify the addresses(host:port=weight) of supernodes where the host is necessary, the port(default: 8002) and the weight(default:1) are optional. And the type of weight must be integer")
+	flagSet.BoolVar(&cfg.Notbs, "notbs", false,
+		"disable back source downloading for requested file when p2p fails to download it")
+	flagSet.Var(&cfg.MaxDownloadSize, "max-download-size",
+		"max size of the file downloaded from the source station, in format of G(B)/M(B)/K(B)/B, pure number will also be parsed as Byte, the download is aborted once it's exceeded even if the source doesn't send the Content-Length, 0 means unlimited")
+	flagSet.Float64Var(&cfg.DownloadSizeMargin, "download-size-margin", 0,
+		"ratio by which the data downloaded from the source station may exceed its Content-Length before the download is aborted")
+	flagSet.BoolVar(&cfg.SkipIfExists, "skip-if-exists", false,
+		"skip downloading without any network traffic if the target already exists and matches the md5 or the digest recorded in its extended attributes when it was downloaded")
+	flagSet.StringVar(&cfg.IfExists, "if-exists", "",
+		"policy when the target already exists, must be overwrite/fail/resume/backup, resume continues the download from the source station from the partial file kept by the last failed download or the end of the existing target, backup keeps the existing target with the suffix '.bak', default: overwrite")
+	flagSet.StringVar(&cfg.Symlink, "symlink", "",
+		"policy when the target is a symlink, must be replace/follow, follow downloads the file to the path which the symlink points to, default: replace")
+	flagSet.StringVar(&cfg.VerifyFailure, "verify-failure", "",
+		"policy for the downloaded file which doesn't match the expected md5 or digest, must be delete/quarantine, quarantine moves it into the directory 'quarantine' in the work home with a record of the failure, default: delete")
+	flagSet.StringVar(&cfg.HandOff, "handoff", "",
+		"the unix domain socket of a resident uploader to which the seeding of the downloaded target is handed off after downloading, so that it's still seeded after dfget exits, the target must be readable by the uploader at the same path")
+	flagSet.BoolVar(&cfg.VerifyOnly, "verify-only", false,
+		"only verify the existing target against the md5 of every piece computed by supernode without downloading the data, and report the byte ranges which differ")
+	flagSet.BoolVar(&cfg.DFDaemon, "dfdaemon", false,
+		"identify whether the request is from dfdaemon")
+	flagSet.BoolVar(&cfg.Insecure, "insecure", false,
+		"identify whether supernode should skip secure verify when interact with the source.")
+	flagSet.IntVar(&cfg.ClientQueueSize, "clientqueue", DefaultClientQueueSize,
+		"specify the size of client queue which controls the number of pieces that can be processed simultaneously")
+	flagSet.IntVar(&cfg.MaxConnsPerPeer, "max-conns-per-peer", 0,
+		"the max number of simultaneous connections to any one peer, 0 means no limit")
+	flagSet.IntVar(&cfg.MaxConnsPerTask, "max-conns-per-task", 0,
+		"the max number of simultaneous connections to all the peers when downloading the task, 0 means no limit")
+
+	// others
+	flagSet.BoolVarP(&cfg.ShowBar, "showbar", "b", false,
+		"show progress bar, it is conflict with '--console'")
+	flagSet.BoolVar(&cfg.Console, "console", false,
+		"show log on console, it's conflict with '--showbar'")
+	flagSet.BoolVarP(&cfg.Quiet, "quiet", "q", false,
+		"suppress all the output on console except the log enabled by '--console'")
+	flagSet.StringVar(&cfg.OutputFormat, "output-format", printer.FormatAuto,
+		"format of the output on console, must be auto/text/json, auto shows a progress bar with '--showbar' when the output is a terminal")
+	flagSet.StringVar(&cfg.Locale, "locale", printer.LocaleAuto,
+		"locale of the messages output on console, must be auto/en/zh, auto detects it from LC_ALL, LC_MESSAGES and LANG, the log is always in English")
+	flagSet.StringVar(&cfg.SummaryFile, "summary-file", "",
+		"file to which the summary of the download is written in JSON, including the bytes from the peers, supernode and the source station, the retries and the verification result")
+	flagSet.BoolVar(&cfg.Verbose, "verbose", false,
+		"be verbose")
+	flagSet.StringVar(&cfg.WorkHome, "home", cfg.WorkHome,
+		"the work home directory of dfget")
+	flagSet.StringVar(&cfg.WorkHome, "home-dir", cfg.WorkHome,
+		"the directory which stores all the state of dfget such as the logs, the meta file and the cached files, it's the same as '--home'")
+	flagSet.BoolVar(&cfg.NoCache, "no-cache", false,
+		"never write the service files and the meta file, the file is downloaded from supernode with the cdn pattern and isn't shared with other peers")
+	flagSet.StringVar(&cfg.WorkDir, "work-dir", "",
+		"directory to store the temp files before they're moved to the target path, the target directory is used if it's not set")
+	flagSet.Var(NewDataDirsValue(&cfg.DataDirs, nil), "datadirs",
+		"specify the data directories(path=weight) such as the ones on different disks across which the downloaded files are spread, the weight(default:1) is optional, the data directory in the work home is used if it's not set")
+	flagSet.StringVar(&cfg.DataDirPlacement, "datadir-placement", "",
+		"policy of placing the downloaded files into the data directories, must be weight/freespace, default: weight")
+
+	// pass to peer server which as a uploader server
+	flagSet.StringVar(&cfg.RV.LocalIP, "ip", "",
+		"IP address that server will listen on")
+	flagSet.StringVar(&cfg.P2PIP, "p2p-ip", "",
+		"IP address on the dedicated network of the p2p transfers, server listens on it and the pieces are downloaded from other peers with it as the source address, the IP connecting to supernode is used if it's not set")
+	flagSet.StringSliceVar(&cfg.AdvertiseIPs, "advertise-ip", nil,
+		"other IP addresses on which server can be reached, such as the IPv6 one or the ones on the other NICs, they're dialed by other peers with the happy eyeballs racing")
+	flagSet.IntVar(&cfg.RV.PeerPort, "port", 0,
+		"port number that server will listen on")
+	flagSet.Var(&cfg.PeerPortRange, "port-range",
+		"range of ports(lower-upper) from which server selects an available one to listen on if --port is not set, the port selected last time is preferred")
+	flagSet.DurationVar(&cfg.RV.DataExpireTime, "expiretime", DataExpireTime,
+		"caching duration for which cached file keeps no accessed by any process, after this period cache file will be deleted")
+	flagSet.DurationVar(&cfg.RV.ServerAliveTime, "alivetime", ServerAliveTime,
+		"alive duration for which uploader keeps no accessing by any uploading requests, after this period uploader will automatically exit")
+	flagSet.DurationVar(&cfg.RV.MinSeedTime, "minseedtime", 0,
+		"minimum duration for which uploader keeps seeding a downloaded file and keeps alive, no matter whether other seeding policies are satisfied")
+	flagSet.Float64Var(&cfg.RV.SeedRatio, "seedratio", 0,
+		"target ratio of the uploaded bytes to the file length, uploader stops seeding a file once the ratio is reached, 0 means unlimited")
+	flagSet.Var(&cfg.RV.CacheSize, "cachesize",
+		"max total size of the files cached by uploader, the least recently accessed ones are evicted once it's exceeded, 0 means unlimited")
+	flagSet.IntVar(&cfg.RV.ReadAheadPieces, "readahead", DefaultReadAheadPieces,
+		"number of the following pieces which uploader reads ahead into the page cache when it observes the sequential piece requests of a file, 0 means disabled")
+	flagSet.IntVar(&cfg.RV.DiskFailureLimit, "disk-failure-limit", DefaultDiskFailureLimit,
+		"number of the read errors and checksum failures of the cached files within "+DiskFailureWindow.String()+", beyond which uploader fences itself and stops serving the pieces, 0 means disabled")
+	flagSet.BoolVar(&cfg.RV.ReverifyOnFence, "reverify-on-fence", false,
+		"re-verify all the cached files once uploader is fenced, and remove the ones which can't be read or don't match their md5s")
+	flagSet.Float64Var(&cfg.RV.AccessLogSampleRate, "access-log-sample-rate", 0,
+		"rate in [0, 1] of the requests to uploader which are written to the access log, 0 means disabled")
+	flagSet.IntVar(&cfg.RV.AdminPort, "admin-port", 0,
+		"port on the loopback address on which uploader serves the diagnostics endpoints such as pprof, 0 means disabled")
+	flagSet.BoolVar(&cfg.RV.Multiplex, "multiplex", false,
+		"serve the diagnostics endpoints and the control endpoints on the port of uploader besides the pieces, which are authorized by adminToken and controlToken of the config file")
+	flagSet.IntVar(&cfg.LogConfig.MaxSize, "log-max-size", 0,
+		"maximum size in megabytes of the log file before it gets rotated, default 40")
+	flagSet.IntVar(&cfg.LogConfig.MaxAge, "log-max-age", 0,
+		"maximum number of days to retain the rotated log files, 0 means that they are not removed due to age")
+}
+
+// filterValue implements pflag.Value for the query params of URL separated by '&'.
+type filterValue struct {
+	filter *[]string
+}
+
+func (fv *filterValue) String() string {
+	return strings.Join(*fv.filter, "&")
+}
+
+func (fv *filterValue) Set(value string) error {
+	*fv.filter = nil
+	if !stringutils.IsEmptyStr(value) {
+		*fv.filter = strings.Split(value, "&")
+	}
+	return nil
+}
+
+func (fv *filterValue) Type() string {
+	return "string"
+}
+
+// deadlineValue implements pflag.Value for a time in RFC3339.
+type deadlineValue struct {
+	deadline *time.Time
+}
+
+func (dv *deadlineValue) String() string {
+	if dv.deadline.IsZero() {
+		return ""
+	}
+	return dv.deadline.Format(time.RFC3339)
+}
+
+func (dv *deadlineValue) Set(value string) error {
+	if stringutils.IsEmptyStr(value) {
+		*dv.deadline = time.Time{}
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+	*dv.deadline = t
+	return nil
+}
+
+func (dv *deadlineValue) Type() string {
+	return "time"
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"time"
+
+	"github.com/go-check/check"
+	"github.com/spf13/pflag"
+)
+
+func (suite *ConfigSuite) TestAddFlags(c *check.C) {
+	cfg := NewConfig()
+	flagSet := pflag.NewFlagSet("dfget", pflag.ContinueOnError)
+	AddFlags(flagSet, cfg)
+
+	err := flagSet.Parse([]string{"-u", "http://a.b.com/x", "--header", "Host: abc",
+		"--node", "127.0.0.1", "--locallimit", "10M", "--dfdaemon"})
+	c.Assert(err, check.IsNil)
+	c.Check(cfg.URL, check.Equals, "http://a.b.com/x")
+	c.Check(cfg.Header, check.DeepEquals, []string{"Host: abc"})
+	c.Assert(cfg.Supernodes, check.HasLen, 1)
+	c.Check(*cfg.Supernodes[0], check.Equals, NodeWeight{"127.0.0.1:8002", 1})
+	c.Check(cfg.LocalLimit.String(), check.Equals, "10MB")
+	c.Check(cfg.DFDaemon, check.Equals, true)
+	c.Check(cfg.ClientQueueSize, check.Equals, DefaultClientQueueSize)
+}
+
+func (suite *ConfigSuite) TestGroupDeadlineFlag(c *check.C) {
+	cfg := NewConfig()
+	flagSet := pflag.NewFlagSet("dfget", pflag.ContinueOnError)
+	AddFlags(flagSet, cfg)
+	c.Assert(flagSet.Parse([]string{"--group", "image", "--group-deadline", "2026-10-14T08:00:00Z"}), check.IsNil)
+	c.Check(cfg.Group, check.Equals, "image")
+	c.Check(cfg.GroupDeadline.Equal(time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)), check.Equals, true)
+	c.Check(flagSet.Lookup("group-deadline").Value.String(), check.Equals, "2026-10-14T08:00:00Z")
+
+	c.Check(flagSet.Parse([]string{"--group-deadline", "tomorrow"}), check.NotNil)
+}
+
+func (suite *ConfigSuite) TestFilterFlag(c *check.C) {
+	var cases = []struct {
+		filter   string
+		expected []string
+	}{
+		{"a&b&c", []string{"a", "b", "c"}},
+		{"a", []string{"a"}},
+		{"", nil},
+		{"abc", []string{"abc"}},
+	}
+
+	for _, v := range cases {
+		cfg := NewConfig()
+		flagSet := pflag.NewFlagSet("dfget", pflag.ContinueOnError)
+		AddFlags(flagSet, cfg)
+		c.Assert(flagSet.Parse([]string{"--filter", v.filter}), check.IsNil)
+		c.Check(cfg.Filter, check.DeepEquals, v.expected)
+	}
+}
@@ -19,8 +19,28 @@ package config
 import (
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
+// GetUploaderSocket returns the path of the unix domain socket on which the uploader
+// serves the requests of the local dfget processes, it's next to the meta file.
+func GetUploaderSocket(metaPath string) string {
+	if metaPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(metaPath), UploaderSocketFile)
+}
+
+// GetFenceFile returns the path of the fence file left by the uploader fenced for
+// its disk failures, it's next to the meta file.
+func GetFenceFile(metaPath string) string {
+	if metaPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(metaPath), FenceFile)
+}
+
 // NewMetaData creates a MetaData instance.
 func NewMetaData(metaPath string) *MetaData {
 	return &MetaData{
@@ -33,17 +53,25 @@ type MetaData struct {
 	// ServicePort the TCP port on which the file upload service listens.
 	ServicePort int `json:"servicePort"`
 
+	// ServiceIP the IP address on which the file upload service listens.
+	ServiceIP string `json:"serviceIP,omitempty"`
+
 	// MetaPath the path of meta file.
 	MetaPath string `json:"-"`
 }
 
-// Persist writes meta information into storage.
+// Persist writes meta information into storage. The directory of the meta file
+// is created if it doesn't exist, such as when the peer server is started by
+// `dfget server` before any download with the same work home.
 func (md *MetaData) Persist() error {
 	content, err := json.Marshal(md)
-	if err == nil {
-		return ioutil.WriteFile(md.MetaPath, content, 0755)
+	if err != nil {
+		return err
 	}
-	return err
+	if err := os.MkdirAll(filepath.Dir(md.MetaPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(md.MetaPath, content, 0755)
 }
 
 // Load loads meta information from storage.
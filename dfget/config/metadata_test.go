@@ -33,6 +33,7 @@ func (suite *ConfigSuite) TestMetaData(c *check.C) {
 		e    *MetaData
 	}{
 		{path: tmp + "/1", port: 1, e: &MetaData{ServicePort: 1}},
+		{path: tmp + "/meta/host.meta", port: 2, e: &MetaData{ServicePort: 2}},
 		{path: tmp, port: 1, e: nil},
 	}
 
@@ -0,0 +1,136 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const portRangeSeparator = "-"
+
+// PortRange is a range of TCP ports with inclusive bounds,
+// format: "lower-upper" or a single port, e.g. "15000-15100".
+// The zero value means that the range is not set.
+type PortRange struct {
+	Lower int
+	Upper int
+}
+
+// ParsePortRange parses the string to a PortRange.
+// An empty string is parsed to the zero value.
+func ParsePortRange(s string) (PortRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return PortRange{}, nil
+	}
+
+	bounds := strings.SplitN(s, portRangeSeparator, 2)
+	lower, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return PortRange{}, errors.Wrapf(errortypes.ErrInvalidValue, "port range %s", s)
+	}
+	upper := lower
+	if len(bounds) == 2 {
+		if upper, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+			return PortRange{}, errors.Wrapf(errortypes.ErrInvalidValue, "port range %s", s)
+		}
+	}
+
+	if lower <= 0 || upper > 65535 || lower > upper {
+		return PortRange{}, errors.Wrapf(errortypes.ErrInvalidValue,
+			"port range %s: the bounds must satisfy 0 < lower <= upper <= 65535", s)
+	}
+	return PortRange{Lower: lower, Upper: upper}, nil
+}
+
+// IsEmpty returns whether the range is not set.
+func (r PortRange) IsEmpty() bool {
+	return r.Lower <= 0
+}
+
+// Size returns the number of ports in the range.
+func (r PortRange) Size() int {
+	if r.IsEmpty() {
+		return 0
+	}
+	return r.Upper - r.Lower + 1
+}
+
+// Contains returns whether the port is in the range.
+func (r PortRange) Contains(port int) bool {
+	return !r.IsEmpty() && port >= r.Lower && port <= r.Upper
+}
+
+// String implements the pflag.Value interface.
+func (r PortRange) String() string {
+	if r.IsEmpty() {
+		return ""
+	}
+	if r.Lower == r.Upper {
+		return strconv.Itoa(r.Lower)
+	}
+	return strconv.Itoa(r.Lower) + portRangeSeparator + strconv.Itoa(r.Upper)
+}
+
+// Set implements the pflag.Value interface.
+func (r *PortRange) Set(s string) error {
+	pr, err := ParsePortRange(s)
+	if err != nil {
+		return err
+	}
+	*r = pr
+	return nil
+}
+
+// Type implements the pflag.Value interface.
+func (r *PortRange) Type() string {
+	return "port-range"
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (r PortRange) MarshalYAML() (interface{}, error) {
+	return r.String(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (r *PortRange) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return r.Set(s)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r PortRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (r *PortRange) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return r.Set(s)
+}
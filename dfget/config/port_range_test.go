@@ -0,0 +1,69 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/go-check/check"
+)
+
+func (suite *ConfigSuite) TestParsePortRange(c *check.C) {
+	var cases = []struct {
+		s        string
+		expected PortRange
+		hasErr   bool
+	}{
+		{s: "", expected: PortRange{}},
+		{s: "15000", expected: PortRange{15000, 15000}},
+		{s: "15000-15100", expected: PortRange{15000, 15100}},
+		{s: " 15000 - 15100 ", expected: PortRange{15000, 15100}},
+		{s: "15100-15000", hasErr: true},
+		{s: "0-100", hasErr: true},
+		{s: "15000-70000", hasErr: true},
+		{s: "a-b", hasErr: true},
+	}
+
+	for _, v := range cases {
+		r, err := ParsePortRange(v.s)
+		if v.hasErr {
+			c.Check(err, check.NotNil, check.Commentf("%s", v.s))
+			continue
+		}
+		c.Check(err, check.IsNil, check.Commentf("%s", v.s))
+		c.Check(r, check.Equals, v.expected)
+	}
+}
+
+func (suite *ConfigSuite) TestPortRange(c *check.C) {
+	r := PortRange{}
+	c.Check(r.IsEmpty(), check.Equals, true)
+	c.Check(r.Size(), check.Equals, 0)
+	c.Check(r.Contains(15000), check.Equals, false)
+	c.Check(r.String(), check.Equals, "")
+
+	c.Assert(r.Set("15000-15009"), check.IsNil)
+	c.Check(r.Size(), check.Equals, 10)
+	c.Check(r.Contains(15000), check.Equals, true)
+	c.Check(r.Contains(15009), check.Equals, true)
+	c.Check(r.Contains(15010), check.Equals, false)
+	c.Check(r.String(), check.Equals, "15000-15009")
+
+	data, err := r.MarshalJSON()
+	c.Assert(err, check.IsNil)
+	actual := PortRange{}
+	c.Assert(actual.UnmarshalJSON(data), check.IsNil)
+	c.Check(actual, check.Equals, r)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+/* kinds of the temp files */
+const (
+	// TempKindTarget is the kind of the temp file in the target directory,
+	// which is renamed to the target when the download finishes.
+	TempKindTarget = "tmp"
+
+	// TempKindBackSource is the kind of the temp file in the target directory,
+	// which is written when downloading from the source station.
+	TempKindBackSource = "backsource"
+)
+
+var (
+	// tempFileReg matches the temp files named by TempFilePrefix.
+	tempFileReg = regexp.MustCompile(`^dfget-(\d+-\d+\.\d+)\.(tmp|backsource)-[^/]+$`)
+
+	// legacyBackSourceReg matches the temp files of back source written by the old versions.
+	legacyBackSourceReg = regexp.MustCompile(`^backsource\.(\d+-\d+\.\d+)\.[^/]+$`)
+
+	// taskFileReg matches the task files in the data directory,
+	// which are named by the last element of the target and the sign.
+	taskFileReg = regexp.MustCompile(`^.+-(\d+-\d+\.\d{3})$`)
+
+	signReg = regexp.MustCompile(`^(\d+)-(\d+)\.(\d+)$`)
+)
+
+// TempFilePrefix returns the prefix of the temp file of the given kind
+// created by the dfget process with the sign.
+// All the temp files are named in the form of "dfget-{sign}.{kind}-{random}",
+// so that the orphaned ones left by the crashed processes could be identified.
+func TempFilePrefix(sign, kind string) string {
+	return "dfget-" + sign + "." + kind + "-"
+}
+
+// ParseTempFileName returns the sign from the name of a temp file created
+// in the target directory, and ok is false if it's not a temp file of dfget.
+func ParseTempFileName(name string) (sign string, ok bool) {
+	if m := tempFileReg.FindStringSubmatch(name); m != nil {
+		return m[1], true
+	}
+	if m := legacyBackSourceReg.FindStringSubmatch(name); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// ParseTaskFileName returns the sign from the name of a task file created
+// in the data directory, and ok is false if it's not a task file of dfget.
+func ParseTaskFileName(name string) (sign string, ok bool) {
+	if m := taskFileReg.FindStringSubmatch(name); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// ParseSign returns the pid and the start time of the dfget process from the sign.
+func ParseSign(sign string) (pid int, start time.Time, ok bool) {
+	m := signReg.FindStringSubmatch(sign)
+	if m == nil {
+		return 0, time.Time{}, false
+	}
+	pid, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	msec, _ := strconv.ParseInt((m[3] + "000")[:3], 10, 64)
+	return pid, time.Unix(sec, msec*int64(time.Millisecond)), true
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func (suite *ConfigSuite) TestTempFileName(c *check.C) {
+	sign := "1234-1571989637.123"
+	var cases = []struct {
+		name     string
+		taskFile bool
+		ok       bool
+	}{
+		{TempFilePrefix(sign, TempKindTarget) + "567", false, true},
+		{TempFilePrefix(sign, TempKindBackSource) + "567", false, true},
+		{"backsource." + sign + ".567", false, true},
+		{"foo-" + sign, true, true},
+		{"foo-" + sign + ".service", true, false},
+		{"dfget-" + sign + ".unknown-567", false, false},
+		{"foo.tmp", false, false},
+	}
+	for _, cc := range cases {
+		parse := ParseTempFileName
+		if cc.taskFile {
+			parse = ParseTaskFileName
+		}
+		s, ok := parse(cc.name)
+		c.Check(ok, check.Equals, cc.ok, check.Commentf("%s", cc.name))
+		if ok {
+			c.Check(s, check.Equals, sign)
+		}
+	}
+
+	pid, start, ok := ParseSign(sign)
+	c.Assert(ok, check.Equals, true)
+	c.Check(pid, check.Equals, 1234)
+	c.Check(start.Equal(time.Unix(1571989637, 123*int64(time.Millisecond))), check.Equals, true)
+
+	_, _, ok = ParseSign("foo")
+	c.Check(ok, check.Equals, false)
+}
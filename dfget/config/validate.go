@@ -0,0 +1,111 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"net"
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// Validate checks the ranges of the properties and the constraints between them,
+// and returns the first invalid one.
+func (p *Properties) Validate() error {
+	for _, s := range p.Supernodes {
+		if s == nil || s.Node == "" {
+			return invalid("nodes", "empty node")
+		}
+		if s.Weight <= 0 {
+			return invalid("nodes", "weight of %s must be positive: %d", s.Node, s.Weight)
+		}
+	}
+
+	if p.LocalLimit < 0 || p.MinRate < 0 || p.TotalLimit < 0 {
+		return invalid("localLimit", "rates must not be negative: localLimit %s, minRate %s, totalLimit %s",
+			p.LocalLimit, p.MinRate, p.TotalLimit)
+	}
+	if p.LocalLimit > 0 && p.MinRate > p.LocalLimit {
+		return invalid("minRate", "must not be greater than localLimit %s: %s", p.LocalLimit, p.MinRate)
+	}
+
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"clientQueueSize", p.ClientQueueSize},
+		{"maxConnsPerPeer", p.MaxConnsPerPeer},
+		{"maxConnsPerTask", p.MaxConnsPerTask},
+		{"reportBatchSize", p.ReportBatchSize},
+		{"backSourceMaxRedirects", p.BackSourceMaxRedirects},
+		{"backSourceSegments", p.BackSourceSegments},
+		{"registerHedges", p.RegisterHedges},
+	} {
+		if v.value < 0 {
+			return invalid(v.name, "must not be negative: %d", v.value)
+		}
+	}
+	if p.ReportInterval < 0 || p.DNSCacheTTL < 0 || p.DNSNegativeCacheTTL < 0 || p.RegisterHedgeDelay < 0 {
+		return invalid("reportInterval", "durations must not be negative: reportInterval %v, dnsCacheTTL %v, "+
+			"dnsNegativeCacheTTL %v, registerHedgeDelay %v",
+			p.ReportInterval, p.DNSCacheTTL, p.DNSNegativeCacheTTL, p.RegisterHedgeDelay)
+	}
+
+	switch p.DataDirPlacement {
+	case "", DataDirPlacementWeight, DataDirPlacementFreeSpace:
+	default:
+		return invalid("dataDirPlacement", "must be weight or freespace: %s", p.DataDirPlacement)
+	}
+	for _, d := range p.DataDirs {
+		if d == nil || !filepath.IsAbs(d.Path) {
+			return invalid("dataDirs", "must be absolute paths")
+		}
+		if d.Weight <= 0 {
+			return invalid("dataDirs", "weight of %s must be positive: %d", d.Path, d.Weight)
+		}
+	}
+
+	for _, code := range p.BackSourceStatus {
+		if code < 100 || code > 599 {
+			return invalid("backSourceStatus", "not a status code: %d", code)
+		}
+	}
+
+	if p.StandbyOf != "" {
+		if _, port, err := net.SplitHostPort(p.StandbyOf); err != nil || port == "" {
+			return invalid("standbyOf", "must be in the form of ip:port: %s", p.StandbyOf)
+		}
+	}
+
+	if err := validateFallbackChain(p.FallbackChain); err != nil {
+		return err
+	}
+
+	if err := p.BackSourceResume.Validate(); err != nil {
+		return errors.Wrap(err, "backSourceResume")
+	}
+	if err := p.Retry.Validate(); err != nil {
+		return errors.Wrap(err, "retry")
+	}
+	return nil
+}
+
+func invalid(name, format string, args ...interface{}) error {
+	return errors.Wrapf(errortypes.ErrInvalidValue, name+": "+format, args...)
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+
+	"github.com/go-check/check"
+)
+
+func (suite *ConfigSuite) TestPropertiesValidate(c *check.C) {
+	c.Assert(NewProperties().Validate(), check.IsNil)
+
+	var cases = []struct {
+		modify func(p *Properties)
+		errMsg string
+	}{
+		{func(p *Properties) { p.Supernodes = []*NodeWeight{{"127.0.0.1:8002", 0}} }, "nodes: .*"},
+		{func(p *Properties) { p.MinRate = p.LocalLimit + rate.KB }, "minRate: .*"},
+		{func(p *Properties) { p.TotalLimit = -1 }, "localLimit: .*"},
+		{func(p *Properties) { p.ClientQueueSize = -1 }, "clientQueueSize: .*"},
+		{func(p *Properties) { p.ReportInterval = -time.Second }, "reportInterval: .*"},
+		{func(p *Properties) { p.DataDirPlacement = "random" }, "dataDirPlacement: .*"},
+		{func(p *Properties) { p.DataDirs = []*DataDirWeight{{"data", 1}} }, "dataDirs: .*"},
+		{func(p *Properties) { p.BackSourceStatus = []int{20} }, "backSourceStatus: .*"},
+		{func(p *Properties) { p.Retry.Jitter = 2 }, "retry: .*"},
+		{func(p *Properties) { p.BackSourceResume.MaxAttempts = -1 }, "backSourceResume: .*"},
+		{func(p *Properties) {
+			p.FallbackChain = []*FallbackStage{{Provider: ProviderSource}, {Provider: ProviderDragonfly}}
+		}, "fallbackChain: dragonfly must be the first stage.*"},
+		{func(p *Properties) { p.FallbackChain = []*FallbackStage{{Provider: ProviderMirror, URL: "mirror"}} },
+			"fallbackChain: url of the mirror.*"},
+		{func(p *Properties) { p.FallbackChain = []*FallbackStage{{Provider: "cache"}} }, "fallbackChain: provider.*"},
+		{func(p *Properties) { p.StandbyOf = "10.0.0.1" }, "standbyOf: .*"},
+	}
+	for _, v := range cases {
+		p := NewProperties()
+		v.modify(p)
+		c.Check(p.Validate(), check.ErrorMatches, v.errMsg)
+	}
+}
@@ -37,6 +37,8 @@ type DownloadRequest struct {
 	PieceNum   int
 	PieceSize  int32
 	Headers    map[string]string
+	// Scheme is the scheme of the request to the peer, http is used if it's empty.
+	Scheme string
 }
 
 // DownloadAPI defines the download method between dfget and peer server.
@@ -47,6 +49,9 @@ type DownloadAPI interface {
 
 // downloadAPI is an implementation of interface DownloadAPI.
 type downloadAPI struct {
+	// pool reuses the connections to the peers, it's nil if the
+	// connections aren't pooled.
+	pool *PeerPool
 }
 
 var _ DownloadAPI = &downloadAPI{}
@@ -56,6 +61,12 @@ func NewDownloadAPI() DownloadAPI {
 	return &downloadAPI{}
 }
 
+// NewDownloadAPIWithPool returns a new DownloadAPI which downloads the pieces
+// from the peers with the connections maintained by the PeerPool.
+func NewDownloadAPIWithPool(pool *PeerPool) DownloadAPI {
+	return &downloadAPI{pool: pool}
+}
+
 func (d *downloadAPI) Download(ip string, port int, req *DownloadRequest, timeout time.Duration) (*http.Response, error) {
 	if req == nil {
 		return nil, fmt.Errorf("nil dwonload request")
@@ -79,11 +90,22 @@ func (d *downloadAPI) Download(ip string, port int, req *DownloadRequest, timeou
 		url = req.Path
 	} else {
 		rangeStr = req.PieceRange
-		url = fmt.Sprintf("http://%s:%d%s", ip, port, req.Path)
+		scheme := config.SchemaHTTP
+		if req.Scheme != "" {
+			scheme = req.Scheme
+		}
+		url = fmt.Sprintf("%s://%s:%d%s", scheme, ip, port, req.Path)
 	}
 	headers[config.StrRange] = httputils.ConstructRangeStr(rangeStr)
 
-	return httputils.HTTPGetTimeout(url, headers, timeout)
+	if d.pool == nil || isFromSource(req) {
+		return httputils.HTTPGetTimeout(url, headers, timeout)
+	}
+	resp, err := d.pool.Client(ip, port).Get(url, headers, timeout)
+	if err != nil {
+		d.pool.Evict(ip, port)
+	}
+	return resp, err
 }
 
 func isFromSource(req *DownloadRequest) bool {
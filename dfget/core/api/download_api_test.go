@@ -17,6 +17,16 @@
 package api
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
 	"github.com/go-check/check"
 )
 
@@ -50,3 +60,40 @@ func (s *DownloadAPITestSuite) TestGetRealRange(c *check.C) {
 			check.Commentf("%v", v))
 	}
 }
+
+func (s *DownloadAPITestSuite) TestDownloadOverTLS(c *check.C) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+	host, portStr, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	download := func(pins []string) (string, error) {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		c.Assert(httputils.PinPublicKeys(tlsConfig, pins), check.IsNil)
+		pool := NewPeerPool(0, 1)
+		defer pool.Close()
+		pool.SetTLSConfig(tlsConfig)
+		resp, err := NewDownloadAPIWithPool(pool).Download(host, port, &DownloadRequest{
+			Path:       "/download/foo",
+			PieceRange: "0-9",
+			Scheme:     "https",
+		}, 0)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	body, err := download([]string{httputils.PublicKeyPin(ts.Certificate())})
+	c.Assert(err, check.IsNil)
+	c.Check(body, check.Equals, "/download/foo")
+
+	_, err = download([]string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="})
+	c.Check(err, check.NotNil)
+}
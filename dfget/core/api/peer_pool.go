@@ -0,0 +1,453 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// peerIdleExpire is the time after which the peers that no piece is
+	// downloaded from are removed from the PeerPool.
+	peerIdleExpire = 90 * time.Second
+
+	// peerProbeTimeout is the timeout of a health probe.
+	peerProbeTimeout = httputils.DefaultTimeout
+
+	// connSlotWaitInterval is the interval of closing the idle connections
+	// when waiting for a slot of the connections to all the peers.
+	connSlotWaitInterval = 100 * time.Millisecond
+)
+
+// PeerPool maintains the connections to every peer which the pieces are downloaded from.
+// The connections to a peer are reused by the pieces, and they're evicted proactively
+// once the peer is found dead by the health probes, so the retries of the pieces don't
+// attempt to connect to a crashed peer repeatedly.
+// It's safe for concurrent use.
+type PeerPool struct {
+	probeInterval time.Duration
+	maxIdleConns  int
+
+	// probe checks whether the peer is alive, it's httputils.CheckConnect
+	// by default and replaced in the tests.
+	probe func(ip string, port int) error
+
+	// dnsCache resolves the peers addressed by hostnames, it's nil if
+	// the hostnames are resolved by every connection.
+	dnsCache *netutils.DNSCache
+
+	// sourceAddr is the local address of the connections to the peers,
+	// it's nil if it's selected by the system.
+	sourceAddr *net.TCPAddr
+
+	// maxConnsPerPeer is the max number of the connections to a peer,
+	// and connSlots bounds the number of the connections to all the peers.
+	// They're unlimited if they're 0 and nil.
+	maxConnsPerPeer int
+	connSlots       chan struct{}
+
+	// tlsConfig is the TLS config of the https connections, such as the ones
+	// to the CDN of supernode, the default one is used if it's nil.
+	tlsConfig *tls.Config
+
+	mu    sync.Mutex
+	peers map[string]*peerEntry
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+type peerEntry struct {
+	ip     string
+	port   int
+	client *httputils.Client
+
+	// addrs are the other addresses of the peer which are raced with ip.
+	addrs []string
+
+	alive     bool
+	checkedAt time.Time
+	usedAt    time.Time
+}
+
+// NewPeerPool creates a PeerPool which keeps at most maxIdleConns idle connections for
+// every peer and probes the health of the peers every probeInterval in the background.
+// No background probe is started if probeInterval <= 0, and then the peers are probed
+// only when they're checked.
+func NewPeerPool(probeInterval time.Duration, maxIdleConns int) *PeerPool {
+	pp := &PeerPool{
+		probeInterval: probeInterval,
+		maxIdleConns:  maxIdleConns,
+		peers:         make(map[string]*peerEntry),
+		stop:          make(chan struct{}),
+	}
+	pp.probe = pp.checkConnect
+	if probeInterval > 0 {
+		go pp.probeLoop()
+	}
+	return pp
+}
+
+// SetDNSCache makes the peers addressed by hostnames resolved by the DNSCache,
+// it must be called before the PeerPool is used.
+func (pp *PeerPool) SetDNSCache(c *netutils.DNSCache) {
+	pp.dnsCache = c
+}
+
+// SetSourceIP makes the connections to the peers sent from the given local IP,
+// such as the one on a dedicated network of the P2P transfers. It must be called
+// before the PeerPool is used, and it's ignored if the ip is empty.
+func (pp *PeerPool) SetSourceIP(ip string) {
+	if ip != "" {
+		pp.sourceAddr = &net.TCPAddr{IP: net.ParseIP(ip)}
+	}
+}
+
+// SetConnLimits bounds the number of the simultaneous connections to any one peer
+// and to all the peers, which prevents the connection storms against a lone seeder.
+// The requests wait for a connection to be released once a limit is reached, and the
+// idle connections are closed to make room when the total limit is reached.
+// The connections of the health probes aren't counted. A limit <= 0 means no limit,
+// and it must be called before the PeerPool is used.
+func (pp *PeerPool) SetConnLimits(perPeer, total int) {
+	pp.maxConnsPerPeer = perPeer
+	if total > 0 {
+		pp.connSlots = make(chan struct{}, total)
+	}
+}
+
+// SetTLSConfig sets the TLS config of the https connections to the peers,
+// it must be called before the PeerPool is used.
+func (pp *PeerPool) SetTLSConfig(tlsConfig *tls.Config) {
+	pp.tlsConfig = tlsConfig
+}
+
+// SetAddresses records the other addresses on which the peer can be reached, such as
+// the IPv6 one or the ones on the other NICs. They're dialed with the happy eyeballs
+// racing together with the ip when the peer is connected or probed.
+func (pp *PeerPool) SetAddresses(ip string, port int, addrs []string) {
+	e := pp.entry(ip, port)
+
+	pp.mu.Lock()
+	e.addrs = addrs
+	pp.mu.Unlock()
+}
+
+// Check returns an error if the peer is unreachable. The peer is probed only if it
+// hasn't been checked within the probe interval, and a dead peer fails immediately
+// until a probe finds it alive again.
+func (pp *PeerPool) Check(ip string, port int) error {
+	e := pp.entry(ip, port)
+
+	pp.mu.Lock()
+	fresh := !e.checkedAt.IsZero() && time.Since(e.checkedAt) < pp.probeInterval
+	alive := e.alive
+	pp.mu.Unlock()
+
+	if !fresh {
+		alive = pp.probeEntry(e)
+	}
+	if !alive {
+		return fmt.Errorf("peer %s is unreachable", peerAddr(ip, port))
+	}
+	return nil
+}
+
+// Client returns the http client which reuses the connections to the peer.
+func (pp *PeerPool) Client(ip string, port int) *httputils.Client {
+	return pp.entry(ip, port).client
+}
+
+// Evict closes the idle connections to the peer and resets its health,
+// so it's probed again when it's checked next time. It's called when
+// a request to the peer fails at the transport level.
+func (pp *PeerPool) Evict(ip string, port int) {
+	pp.mu.Lock()
+	e, ok := pp.peers[peerAddr(ip, port)]
+	if ok {
+		e.checkedAt = time.Time{}
+	}
+	pp.mu.Unlock()
+
+	if ok {
+		e.client.CloseIdleConnections()
+	}
+}
+
+// Close stops the background probes and closes all the idle connections.
+func (pp *PeerPool) Close() {
+	pp.stopOnce.Do(func() {
+		close(pp.stop)
+	})
+
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	for addr, e := range pp.peers {
+		e.client.CloseIdleConnections()
+		delete(pp.peers, addr)
+	}
+}
+
+func (pp *PeerPool) entry(ip string, port int) *peerEntry {
+	addr := peerAddr(ip, port)
+
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	e, ok := pp.peers[addr]
+	if !ok {
+		e = &peerEntry{
+			ip:   ip,
+			port: port,
+		}
+		e.client = pp.newClient(ip, port)
+		pp.peers[addr] = e
+	}
+	e.usedAt = time.Now()
+	return e
+}
+
+func (pp *PeerPool) newClient(ip string, port int) *httputils.Client {
+	dial := pp.dialContext(httputils.DefaultDialTimeout)
+	return httputils.NewClient(
+		httputils.WithTLSConfig(pp.tlsConfig),
+		httputils.WithMaxIdleConnsPerHost(pp.maxIdleConns),
+		httputils.WithMaxConnsPerHost(pp.maxConnsPerPeer),
+		httputils.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if err := pp.acquireSlot(ctx); err != nil {
+				return nil, err
+			}
+			var (
+				conn net.Conn
+				err  error
+			)
+			if addrs := pp.candidates(ip, port); len(addrs) > 0 {
+				conn, err = netutils.DialRace(ctx, dial, network, addrs, netutils.DefaultConnectionAttemptDelay)
+			} else {
+				conn, err = dial(ctx, network, addr)
+			}
+			if err != nil {
+				pp.releaseSlot()
+				return nil, err
+			}
+			if pp.connSlots == nil {
+				return conn, nil
+			}
+			return &slotConn{Conn: conn, release: pp.releaseSlot}, nil
+		}))
+}
+
+// acquireSlot waits for a slot of the connections to all the peers, the idle
+// connections are closed to make room every connSlotWaitInterval while waiting.
+func (pp *PeerPool) acquireSlot(ctx context.Context) error {
+	if pp.connSlots == nil {
+		return nil
+	}
+	select {
+	case pp.connSlots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	ticker := time.NewTicker(connSlotWaitInterval)
+	defer ticker.Stop()
+	for {
+		pp.closeIdleConnections()
+		select {
+		case pp.connSlots <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pp *PeerPool) releaseSlot() {
+	if pp.connSlots != nil {
+		<-pp.connSlots
+	}
+}
+
+func (pp *PeerPool) closeIdleConnections() {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	for _, e := range pp.peers {
+		e.client.CloseIdleConnections()
+	}
+}
+
+// slotConn releases its slot of the connections to all the peers once it's closed.
+type slotConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *slotConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// dialContext returns the function which connects to the peers from the source address,
+// their hostnames are resolved by the DNSCache if it's set.
+func (pp *PeerPool) dialContext(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		LocalAddr: pp.localAddr(),
+	}
+	if pp.dnsCache != nil {
+		return pp.dnsCache.DialContext(dialer)
+	}
+	return dialer.DialContext
+}
+
+// candidates returns all the host:port addresses of the peer to be raced,
+// it's nil if the peer has no other address.
+func (pp *PeerPool) candidates(ip string, port int) []string {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	e, ok := pp.peers[peerAddr(ip, port)]
+	if !ok || len(e.addrs) == 0 {
+		return nil
+	}
+
+	addrs := []string{peerAddr(ip, port)}
+	for _, addr := range e.addrs {
+		if addr != ip {
+			addrs = append(addrs, peerAddr(addr, port))
+		}
+	}
+	return addrs
+}
+
+// localAddr returns the local address of the connections to the peers,
+// it's a nil interface rather than a nil *net.TCPAddr if it's not set.
+func (pp *PeerPool) localAddr() net.Addr {
+	if pp.sourceAddr == nil {
+		return nil
+	}
+	return pp.sourceAddr
+}
+
+// checkConnect is the default probe which connects to the peer.
+func (pp *PeerPool) checkConnect(ip string, port int) (err error) {
+	if candidates := pp.candidates(ip, port); len(candidates) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), peerProbeTimeout)
+		defer cancel()
+		conn, err := netutils.DialRace(ctx, pp.dialContext(peerProbeTimeout), "tcp", candidates, netutils.DefaultConnectionAttemptDelay)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	addrs := []string{ip}
+	if pp.dnsCache != nil {
+		if addrs, err = pp.dnsCache.LookupHost(context.Background(), ip); err != nil {
+			return err
+		}
+	}
+	for _, addr := range addrs {
+		if pp.sourceAddr != nil {
+			err = pp.dialFromSource(addr, port)
+		} else {
+			_, err = httputils.CheckConnect(addr, port, int(peerProbeTimeout/time.Millisecond))
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// dialFromSource connects to the peer from the source address.
+func (pp *PeerPool) dialFromSource(ip string, port int) error {
+	dialer := &net.Dialer{Timeout: peerProbeTimeout, LocalAddr: pp.sourceAddr}
+	conn, err := dialer.Dial("tcp4", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeEntry probes the peer and records the result, the idle connections
+// are evicted if the peer is dead.
+func (pp *PeerPool) probeEntry(e *peerEntry) bool {
+	err := pp.probe(e.ip, e.port)
+
+	pp.mu.Lock()
+	wasAlive := e.alive || e.checkedAt.IsZero()
+	e.alive = err == nil
+	e.checkedAt = time.Now()
+	pp.mu.Unlock()
+
+	if err != nil {
+		if wasAlive {
+			logrus.Warnf("peer %s is found dead: %v", peerAddr(e.ip, e.port), err)
+		}
+		e.client.CloseIdleConnections()
+	}
+	return err == nil
+}
+
+func (pp *PeerPool) probeLoop() {
+	ticker := time.NewTicker(pp.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pp.stop:
+			return
+		case <-ticker.C:
+			pp.probeAll()
+		}
+	}
+}
+
+func (pp *PeerPool) probeAll() {
+	var entries []*peerEntry
+
+	pp.mu.Lock()
+	for addr, e := range pp.peers {
+		if time.Since(e.usedAt) > peerIdleExpire {
+			e.client.CloseIdleConnections()
+			delete(pp.peers, addr)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	pp.mu.Unlock()
+
+	for _, e := range entries {
+		pp.probeEntry(e)
+	}
+}
+
+func peerAddr(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/go-check/check"
+)
+
+type PeerPoolTestSuite struct {
+}
+
+func init() {
+	check.Suite(&PeerPoolTestSuite{})
+}
+
+func (s *PeerPoolTestSuite) TestCheck(c *check.C) {
+	pp := NewPeerPool(time.Hour, 2)
+	defer pp.Close()
+
+	probes := 0
+	dead := false
+	pp.probe = func(ip string, port int) error {
+		probes++
+		if dead {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	}
+
+	c.Check(pp.Check("127.0.0.1", 1), check.IsNil)
+	c.Check(pp.Check("127.0.0.1", 1), check.IsNil)
+	c.Check(probes, check.Equals, 1)
+
+	// the peer is probed again after a transport error
+	dead = true
+	pp.Evict("127.0.0.1", 1)
+	c.Check(pp.Check("127.0.0.1", 1), check.NotNil)
+	c.Check(probes, check.Equals, 2)
+
+	// a dead peer fails without probing until the next probe
+	c.Check(pp.Check("127.0.0.1", 1), check.NotNil)
+	c.Check(probes, check.Equals, 2)
+
+	dead = false
+	pp.probeAll()
+	c.Check(probes, check.Equals, 3)
+	c.Check(pp.Check("127.0.0.1", 1), check.IsNil)
+}
+
+func (s *PeerPoolTestSuite) TestDNSCache(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	pp := NewPeerPool(0, 2)
+	defer pp.Close()
+	pp.SetDNSCache(netutils.NewDNSCache(time.Minute, time.Minute))
+
+	c.Assert(pp.Check("localhost", port), check.IsNil)
+	d := NewDownloadAPIWithPool(pp)
+	resp, err := d.Download("localhost", port, &DownloadRequest{Path: "/peer/file/a", PieceRange: "0-1"}, time.Second)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Check(string(body), check.Equals, "localhost:"+portStr)
+
+	c.Check(pp.Check("peer.invalid", port), check.NotNil)
+}
+
+func (s *PeerPoolTestSuite) TestDownload(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Range")))
+	}))
+	host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	pp := NewPeerPool(0, 2)
+	defer pp.Close()
+	d := NewDownloadAPIWithPool(pp)
+	c.Assert(pp.Check(host, port), check.IsNil)
+
+	resp, err := d.Download(host, port, &DownloadRequest{Path: "/peer/file/foo", PieceRange: "0-9"}, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+
+	server.Close()
+	c.Check(pp.Check(host, port), check.NotNil)
+	_, err = d.Download(host, port, &DownloadRequest{Path: "/peer/file/foo", PieceRange: "0-9"}, time.Second)
+	c.Check(err, check.NotNil)
+}
+
+func (s *PeerPoolTestSuite) TestSourceIP(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	defer server.Close()
+	_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	pp := NewPeerPool(0, 2)
+	defer pp.Close()
+	pp.SetSourceIP("127.0.0.2")
+
+	c.Assert(pp.Check("127.0.0.1", port), check.IsNil)
+	d := NewDownloadAPIWithPool(pp)
+	resp, err := d.Download("127.0.0.1", port, &DownloadRequest{Path: "/peer/file/a", PieceRange: "0-1"}, time.Second)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	ip, _, _ := net.SplitHostPort(string(body))
+	c.Check(ip, check.Equals, "127.0.0.2")
+}
+
+func (s *PeerPoolTestSuite) TestAddresses(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	pp := NewPeerPool(0, 2)
+	defer pp.Close()
+
+	// nothing listens on the primary ip, so the peer is reached by its other address
+	c.Check(pp.Check("127.0.0.3", port), check.NotNil)
+	pp.SetAddresses("127.0.0.3", port, []string{"127.0.0.1"})
+	c.Assert(pp.Check("127.0.0.3", port), check.IsNil)
+
+	d := NewDownloadAPIWithPool(pp)
+	resp, err := d.Download("127.0.0.3", port, &DownloadRequest{Path: "/peer/file/a", PieceRange: "0-1"}, time.Second)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Check(string(body), check.Equals, net.JoinHostPort("127.0.0.3", portStr))
+}
+
+func (s *PeerPoolTestSuite) TestConnLimits(c *check.C) {
+	var conns int32
+	entered := make(chan string, 4)
+	release := make(chan struct{})
+	newServer := func(name string) (*httptest.Server, int) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered <- name
+			<-release
+		}))
+		server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		server.Start()
+		_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+		port, _ := strconv.Atoi(portStr)
+		return server, port
+	}
+	serverA, portA := newServer("a")
+	defer serverA.Close()
+	serverB, portB := newServer("b")
+	defer serverB.Close()
+
+	pp := NewPeerPool(0, 2)
+	defer pp.Close()
+	pp.SetConnLimits(1, 1)
+	d := NewDownloadAPIWithPool(pp)
+	download := func(port int) chan error {
+		done := make(chan error, 1)
+		go func() {
+			resp, err := d.Download("127.0.0.1", port, &DownloadRequest{Path: "/peer/file/a", PieceRange: "0-1"}, 5*time.Second)
+			if err == nil {
+				ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			done <- err
+		}()
+		return done
+	}
+
+	// the requests wait for the connection in use by the first one
+	doneA1 := download(portA)
+	c.Assert(<-entered, check.Equals, "a")
+	doneA2 := download(portA)
+	doneB := download(portB)
+	select {
+	case name := <-entered:
+		c.Fatalf("unexpected request to %s", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.Check(atomic.LoadInt32(&conns), check.Equals, int32(1))
+
+	close(release)
+	for _, done := range []chan error{doneA1, doneA2, doneB} {
+		c.Check(<-done, check.IsNil)
+	}
+	c.Check(<-entered, check.Not(check.Equals), "")
+	c.Check(<-entered, check.Not(check.Equals), "")
+}
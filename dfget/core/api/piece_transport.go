@@ -0,0 +1,144 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+)
+
+// TransportHTTP is the name of the built-in piece transport, which fetches the pieces
+// from the uploaders by the ranged HTTP requests. It's used to fetch the pieces from
+// the peers advertising no transport, such as the ones of the old versions.
+const TransportHTTP = "http"
+
+// PieceResponse is the response of a piece fetched from a peer.
+type PieceResponse struct {
+	// StatusCode is the status of the response, which follows the HTTP status codes
+	// no matter which transport fetches the piece.
+	StatusCode int
+
+	// Offset is the offset in the piece from which the body starts, which is set when
+	// the peer resumes the piece from the offset requested. It's 0 if the whole piece is sent.
+	Offset int
+
+	// Body is the content of the piece, or the error message if StatusCode isn't 2xx.
+	Body io.ReadCloser
+}
+
+// PieceTransport fetches the pieces from the uploaders of the peers over a protocol,
+// so that the scheduling and the writing of the pieces don't depend on the protocol.
+type PieceTransport interface {
+	// FetchPiece fetches the piece of the request from the uploader listening on ip:port.
+	FetchPiece(ip string, port int, req *DownloadRequest, timeout time.Duration) (*PieceResponse, error)
+}
+
+// PieceTransportFactory creates a PieceTransport which may reuse the connections
+// to the peers maintained by the pool, the pool may be nil.
+type PieceTransportFactory func(pool *PeerPool) PieceTransport
+
+var (
+	transportsMutex sync.RWMutex
+	transports      = make(map[string]PieceTransportFactory)
+)
+
+func init() {
+	RegisterPieceTransport(TransportHTTP, func(pool *PeerPool) PieceTransport {
+		return NewHTTPTransport(NewDownloadAPIWithPool(pool))
+	})
+}
+
+// RegisterPieceTransport registers the factory of the piece transport of the name,
+// which replaces the one registered before. The names of the registered transports
+// are advertised to supernode as the ones served by the uploader, so a transport
+// must be served by the uploader of the same binary too.
+func RegisterPieceTransport(name string, factory PieceTransportFactory) {
+	transportsMutex.Lock()
+	defer transportsMutex.Unlock()
+	transports[name] = factory
+}
+
+// PieceTransports returns the names of the registered piece transports in the order
+// of preference, in which http is always the last.
+func PieceTransports() []string {
+	transportsMutex.RLock()
+	defer transportsMutex.RUnlock()
+	names := make([]string, 0, len(transports))
+	for name := range transports {
+		if name != TransportHTTP {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append(names, TransportHTTP)
+}
+
+// SelectPieceTransport returns the name of the preferred one among the transports
+// advertised by a peer which are registered too, and http if there's none.
+func SelectPieceTransport(peerTransports []string) string {
+	for _, name := range PieceTransports() {
+		for _, t := range peerTransports {
+			if t == name {
+				return name
+			}
+		}
+	}
+	return TransportHTTP
+}
+
+// NewPieceTransport creates the piece transport of the name with the pool,
+// and the http one is created if the name isn't registered.
+func NewPieceTransport(name string, pool *PeerPool) PieceTransport {
+	transportsMutex.RLock()
+	factory, ok := transports[name]
+	if !ok {
+		factory = transports[TransportHTTP]
+	}
+	transportsMutex.RUnlock()
+	return factory(pool)
+}
+
+// httpTransport is the PieceTransport which fetches the pieces by the DownloadAPI.
+type httpTransport struct {
+	downloadAPI DownloadAPI
+}
+
+var _ PieceTransport = &httpTransport{}
+
+// NewHTTPTransport returns a PieceTransport which fetches the pieces by the ranged
+// HTTP requests sent by the DownloadAPI.
+func NewHTTPTransport(downloadAPI DownloadAPI) PieceTransport {
+	return &httpTransport{downloadAPI: downloadAPI}
+}
+
+func (t *httpTransport) FetchPiece(ip string, port int, req *DownloadRequest, timeout time.Duration) (*PieceResponse, error) {
+	resp, err := t.downloadAPI.Download(ip, port, req, timeout)
+	if err != nil {
+		return nil, err
+	}
+	offset, _ := strconv.Atoi(resp.Header.Get(config.StrPieceOffset))
+	return &PieceResponse{
+		StatusCode: resp.StatusCode,
+		Offset:     offset,
+		Body:       resp.Body,
+	}, nil
+}
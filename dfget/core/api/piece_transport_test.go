@@ -0,0 +1,93 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/go-check/check"
+)
+
+type PieceTransportTestSuite struct {
+}
+
+func init() {
+	check.Suite(&PieceTransportTestSuite{})
+}
+
+// fakeTransport is a PieceTransport which records the pieces fetched.
+type fakeTransport struct {
+	fetched []string
+}
+
+func (t *fakeTransport) FetchPiece(ip string, port int, req *DownloadRequest, timeout time.Duration) (*PieceResponse, error) {
+	t.fetched = append(t.fetched, req.PieceRange)
+	return &PieceResponse{StatusCode: http.StatusOK}, nil
+}
+
+func (s *PieceTransportTestSuite) TestSelectPieceTransport(c *check.C) {
+	c.Check(PieceTransports(), check.DeepEquals, []string{TransportHTTP})
+	c.Check(SelectPieceTransport(nil), check.Equals, TransportHTTP)
+
+	fake := &fakeTransport{}
+	RegisterPieceTransport("quic", func(pool *PeerPool) PieceTransport { return fake })
+	defer func() {
+		transportsMutex.Lock()
+		delete(transports, "quic")
+		transportsMutex.Unlock()
+	}()
+
+	c.Check(PieceTransports(), check.DeepEquals, []string{"quic", TransportHTTP})
+	c.Check(SelectPieceTransport([]string{TransportHTTP}), check.Equals, TransportHTTP)
+	c.Check(SelectPieceTransport([]string{TransportHTTP, "quic"}), check.Equals, "quic")
+	c.Check(SelectPieceTransport([]string{"rdma"}), check.Equals, TransportHTTP)
+
+	_, err := NewPieceTransport("quic", nil).FetchPiece("127.0.0.1", 0, &DownloadRequest{PieceRange: "0-9"}, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(fake.fetched, check.DeepEquals, []string{"0-9"})
+	c.Check(NewPieceTransport("rdma", nil), check.FitsTypeOf, &httpTransport{})
+}
+
+func (s *PieceTransportTestSuite) TestHTTPTransport(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(config.StrPieceOffset, r.Header.Get(config.StrPieceOffset))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(r.Header.Get(config.StrRange)))
+	}))
+	defer ts.Close()
+	host, portStr, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	resp, err := NewHTTPTransport(NewDownloadAPI()).FetchPiece(host, port, &DownloadRequest{
+		Path:       "/peer/file/foo",
+		PieceRange: "0-9",
+		Headers:    map[string]string{config.StrPieceOffset: "4"},
+	}, time.Second)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusPartialContent)
+	c.Check(resp.Offset, check.Equals, 4)
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Check(string(body), check.Equals, "bytes=0-9")
+}
@@ -19,12 +19,15 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"time"
 
 	api_types "github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/peertoken"
 	"github.com/pkg/errors"
 
 	"github.com/sirupsen/logrus"
@@ -35,11 +38,18 @@ const (
 	peerRegisterPath      = "/peer/registry"
 	peerPullPieceTaskPath = "/peer/task"
 	peerReportPiecePath   = "/peer/piece/suc"
+	peerReportPiecesPath  = "/api/v1/peer/pieces"
 	peerClientErrorPath   = "/peer/piece/error"
 	peerServiceDownPath   = "/peer/service/down"
 	metricsReportPath     = "/task/metrics"
 	fetchP2PNetworkPath   = "/peer/network"
 	peerHeartBeatPath     = "/peer/heartbeat"
+	peerSeedPath          = "/peer/seed"
+	taskPieceMD5sPath     = "/api/v1/tasks/%s/md5s"
+	peerExtensionPath     = "/api/v1/peer/extension"
+	peerKeepalivePath     = "/api/v1/peer/keepalive"
+	versionPath           = "/version"
+	peerProbePath         = "/api/v1/peer/probe"
 )
 
 // NewSupernodeAPI creates a new instance of SupernodeAPI with default value.
@@ -51,6 +61,19 @@ func NewSupernodeAPI() SupernodeAPI {
 	}
 }
 
+// NewSupernodeAPIWithToken creates a new instance of SupernodeAPI which carries
+// the peer token of the node in every request if it's not empty.
+func NewSupernodeAPIWithToken(token string) SupernodeAPI {
+	api := NewSupernodeAPI().(*supernodeAPI)
+	if token != "" {
+		api.HTTPClient = &tokenHTTPClient{
+			SimpleHTTPClient: api.HTTPClient,
+			headers:          map[string]string{peertoken.Header: token},
+		}
+	}
+	return api
+}
+
 // SupernodeAPI defines the communication methods between supernode and dfget.
 type SupernodeAPI interface {
 	Register(node string, req *types.RegisterRequest) (resp *types.RegisterResponse, e error)
@@ -59,11 +82,18 @@ type SupernodeAPI interface {
 	ServiceDown(node string, taskID string, cid string) (resp *types.BaseResponse, e error)
 	ReportClientError(node string, req *types.ClientErrorRequest) (resp *types.BaseResponse, e error)
 	ReportMetrics(node string, req *api_types.TaskMetricsRequest) (resp *types.BaseResponse, e error)
-	HeartBeat(node string, req *api_types.HeartBeatRequest) (resp *types.HeartBeatResponse, err error)
+	HeartBeat(node string, req *api_types.HeartBeatRequest) (resp *api_types.HeartBeatResponse, err error)
 	FetchP2PNetworkInfo(node string, start int, limit int, req *api_types.NetworkInfoFetchRequest) (resp *api_types.NetworkInfoFetchResponse, e error)
 	ReportResource(node string, req *types.RegisterRequest) (resp *types.RegisterResponse, err error)
 	ApplyForSeedNode(node string, req *types.RegisterRequest) (resp *types.RegisterResponse, err error)
 	ReportResourceDeleted(node string, taskID string, cid string) (resp *types.BaseResponse, err error)
+	ReportSeed(node string, req *api_types.PeerSeedRequest) (resp *types.BaseResponse, err error)
+	GetPieceMD5s(node string, taskID string, start int, limit int, groupSize int) (resp *api_types.TaskPieceMD5s, err error)
+	ReportPieces(node string, req *api_types.PieceSuccessRequest) (resp *types.BaseResponse, err error)
+	ExtendProgress(node string, req *api_types.ProgressExtensionRequest) (resp *api_types.ProgressExtensionResponse, err error)
+	Keepalive(node string, req *api_types.PeerKeepaliveRequest) (resp *api_types.PeerKeepaliveResponse, err error)
+	Version(node string) (resp *api_types.DragonflyVersion, err error)
+	ProbeBandwidth(node string, size int64) (n int64, err error)
 }
 
 type supernodeAPI struct {
@@ -84,7 +114,14 @@ func (api *supernodeAPI) Register(node string, req *types.RegisterRequest) (
 	)
 	url := fmt.Sprintf("%s://%s%s",
 		api.Scheme, node, peerRegisterPath)
-	if code, body, e = api.HTTPClient.PostJSON(url, req, api.Timeout); e != nil {
+	// pass the trace headers of the download request to supernode
+	// so that the registration can be followed in the logs of supernode.
+	if traceHeaders := httputils.ExtractTraceHeaders(netutils.ConvertHeaders(req.Headers)); len(traceHeaders) > 0 {
+		code, body, e = api.HTTPClient.PostJSONWithHeaders(url, traceHeaders, req, api.Timeout)
+	} else {
+		code, body, e = api.HTTPClient.PostJSON(url, req, api.Timeout)
+	}
+	if e != nil {
 		return nil, e
 	}
 	if !httputils.HTTPStatusOk(code) {
@@ -131,6 +168,81 @@ func (api *supernodeAPI) ReportPiece(node string, req *types.ReportPieceRequest)
 	return
 }
 
+// ReportPieces reports the pieces downloaded successfully to supernode in a batch.
+func (api *supernodeAPI) ReportPieces(node string, req *api_types.PieceSuccessRequest) (
+	resp *types.BaseResponse, err error) {
+	var (
+		code int
+		body []byte
+	)
+	url := fmt.Sprintf("%s://%s%s",
+		api.Scheme, node, peerReportPiecesPath)
+	if code, body, err = api.HTTPClient.PostJSON(url, req, api.Timeout); err != nil {
+		return nil, err
+	}
+	if !httputils.HTTPStatusOk(code) {
+		return nil, fmt.Errorf("%d:%s", code, body)
+	}
+	resp = new(types.BaseResponse)
+	if err = json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != constants.CodeGetPieceReport {
+		return nil, fmt.Errorf("failed to report %d pieces of task %s: api response code is %d not equal to %d",
+			len(req.Pieces), req.TaskID, resp.Code, constants.CodeGetPieceReport)
+	}
+	return resp, nil
+}
+
+// ExtendProgress requests an extension of the progress deadline of the download
+// with the bytes downloaded so far.
+func (api *supernodeAPI) ExtendProgress(node string, req *api_types.ProgressExtensionRequest) (
+	resp *api_types.ProgressExtensionResponse, err error) {
+	var (
+		code int
+		body []byte
+	)
+	url := fmt.Sprintf("%s://%s%s",
+		api.Scheme, node, peerExtensionPath)
+	if code, body, err = api.HTTPClient.PostJSON(url, req, api.Timeout); err != nil {
+		return nil, err
+	}
+	if !httputils.HTTPStatusOk(code) {
+		return nil, fmt.Errorf("%d:%s", code, body)
+	}
+	resp = new(api_types.ProgressExtensionResponse)
+	if err = json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Keepalive keeps the registration of the download alive. It returns a nil response
+// if supernode doesn't support the keepalives.
+func (api *supernodeAPI) Keepalive(node string, req *api_types.PeerKeepaliveRequest) (
+	resp *api_types.PeerKeepaliveResponse, err error) {
+	var (
+		code int
+		body []byte
+	)
+	url := fmt.Sprintf("%s://%s%s",
+		api.Scheme, node, peerKeepalivePath)
+	if code, body, err = api.HTTPClient.PostJSON(url, req, api.Timeout); err != nil {
+		return nil, err
+	}
+	if code == http.StatusNotFound {
+		return nil, nil
+	}
+	if !httputils.HTTPStatusOk(code) {
+		return nil, fmt.Errorf("%d:%s", code, body)
+	}
+	resp = new(api_types.PeerKeepaliveResponse)
+	if err = json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // ServiceDown reports the status of the local peer to supernode.
 func (api *supernodeAPI) ServiceDown(node string, taskID string, cid string) (
 	resp *types.BaseResponse, e error) {
@@ -181,6 +293,68 @@ func (api *supernodeAPI) ReportMetrics(node string, req *api_types.TaskMetricsRe
 	return resp, err
 }
 
+// ReportSeed reports to the supernode that the peer owns the whole task file,
+// so the peer could be scheduled as a seeder without downloading it.
+func (api *supernodeAPI) ReportSeed(node string, req *api_types.PeerSeedRequest) (resp *types.BaseResponse, err error) {
+	var (
+		code int
+		body []byte
+	)
+	url := fmt.Sprintf("%s://%s%s",
+		api.Scheme, node, peerSeedPath)
+	if code, body, err = api.HTTPClient.PostJSON(url, req, api.Timeout); err != nil {
+		return nil, err
+	}
+	if !httputils.HTTPStatusOk(code) {
+		return nil, fmt.Errorf("%d:%s", code, body)
+	}
+	resp = new(types.BaseResponse)
+	if err = json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	return resp, err
+}
+
+// GetPieceMD5s gets the md5 of at most limit pieces from start of the task whose CDN has finished.
+// All the pieces from start are returned if limit isn't positive, and the SHA-1 of the piece md5s
+// of every group is returned instead if groupSize is positive.
+func (api *supernodeAPI) GetPieceMD5s(node string, taskID string, start int, limit int, groupSize int) (resp *api_types.TaskPieceMD5s, err error) {
+	url := fmt.Sprintf("%s://%s"+taskPieceMD5sPath+"?start=%d&limit=%d&groupSize=%d",
+		api.Scheme, node, taskID, start, limit, groupSize)
+
+	resp = new(api_types.TaskPieceMD5s)
+	if err = api.get(url, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Version gets the build information and the features enabled of the supernode.
+func (api *supernodeAPI) Version(node string) (resp *api_types.DragonflyVersion, err error) {
+	url := fmt.Sprintf("%s://%s%s", api.Scheme, node, versionPath)
+
+	resp = new(api_types.DragonflyVersion)
+	if err = api.get(url, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ProbeBandwidth requests the bytes of the size from supernode to measure the
+// bandwidth between them, and returns the number of the bytes received.
+func (api *supernodeAPI) ProbeBandwidth(node string, size int64) (n int64, err error) {
+	url := fmt.Sprintf("%s://%s%s?size=%d", api.Scheme, node, peerProbePath, size)
+
+	code, body, err := api.HTTPClient.Get(url, api.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if !httputils.HTTPStatusOk(code) {
+		return 0, fmt.Errorf("%d:%s", code, body)
+	}
+	return int64(len(body)), nil
+}
+
 func (api *supernodeAPI) get(url string, resp interface{}) error {
 	var (
 		code int
@@ -327,7 +501,7 @@ func (api *supernodeAPI) FetchP2PNetworkInfo(node string, start int, limit int,
 	return rr.Data, nil
 }
 
-func (api *supernodeAPI) HeartBeat(node string, req *api_types.HeartBeatRequest) (resp *types.HeartBeatResponse, err error) {
+func (api *supernodeAPI) HeartBeat(node string, req *api_types.HeartBeatRequest) (resp *api_types.HeartBeatResponse, err error) {
 	var (
 		code int
 		body []byte
@@ -347,9 +521,45 @@ func (api *supernodeAPI) HeartBeat(node string, req *api_types.HeartBeatRequest)
 
 	logrus.Debugf("heart beat resp: %s", string(body))
 
-	resp = new(types.HeartBeatResponse)
+	resp = new(api_types.HeartBeatResponse)
 	if err = json.Unmarshal(body, resp); err != nil {
 		return nil, err
 	}
 	return resp, err
 }
+
+// tokenHTTPClient adds the header of the peer token to all the requests.
+type tokenHTTPClient struct {
+	httputils.SimpleHTTPClient
+	headers map[string]string
+}
+
+func (c *tokenHTTPClient) withToken(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return c.headers
+	}
+	merged := make(map[string]string, len(headers)+len(c.headers))
+	for k, v := range headers {
+		merged[k] = v
+	}
+	for k, v := range c.headers {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (c *tokenHTTPClient) PostJSON(url string, body interface{}, timeout time.Duration) (int, []byte, error) {
+	return c.SimpleHTTPClient.PostJSONWithHeaders(url, c.headers, body, timeout)
+}
+
+func (c *tokenHTTPClient) Get(url string, timeout time.Duration) (int, []byte, error) {
+	return c.SimpleHTTPClient.GetWithHeaders(url, c.headers, timeout)
+}
+
+func (c *tokenHTTPClient) PostJSONWithHeaders(url string, headers map[string]string, body interface{}, timeout time.Duration) (int, []byte, error) {
+	return c.SimpleHTTPClient.PostJSONWithHeaders(url, c.withToken(headers), body, timeout)
+}
+
+func (c *tokenHTTPClient) GetWithHeaders(url string, headers map[string]string, timeout time.Duration) (int, []byte, error) {
+	return c.SimpleHTTPClient.GetWithHeaders(url, c.withToken(headers), timeout)
+}
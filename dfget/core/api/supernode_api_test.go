@@ -20,11 +20,13 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	api_types "github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/peertoken"
 
 	"github.com/go-check/check"
 )
@@ -86,6 +88,50 @@ func (s *SupernodeAPITestSuite) TestSupernodeAPI_Register(c *check.C) {
 	c.Assert(r.Data.FileLength, check.Equals, res.Data.FileLength)
 }
 
+func (s *SupernodeAPITestSuite) TestSupernodeAPI_RegisterWithTraceHeaders(c *check.C) {
+	var headers map[string]string
+	res := types.RegisterResponse{BaseResponse: &types.BaseResponse{Code: constants.Success}}
+	s.mock.PostJSONWithHeadersFunc = func(url string, h map[string]string, body interface{},
+		timeout time.Duration) (int, []byte, error) {
+		headers = h
+		return 200, []byte(res.String()), nil
+	}
+
+	req := createRegisterRequest()
+	req.Headers = []string{"x-request-id: r1", "Accept: *"}
+	r, e := s.api.Register(localhost, req)
+	c.Assert(e, check.IsNil)
+	c.Assert(r.Code, check.Equals, constants.Success)
+	c.Check(headers, check.DeepEquals, map[string]string{"X-Request-Id": "r1"})
+}
+
+func (s *SupernodeAPITestSuite) TestSupernodeAPI_WithToken(c *check.C) {
+	api := NewSupernodeAPIWithToken("t1").(*supernodeAPI)
+	api.HTTPClient.(*tokenHTTPClient).SimpleHTTPClient = s.mock
+	var headers []map[string]string
+	s.mock.PostJSONWithHeadersFunc = func(url string, h map[string]string, body interface{},
+		timeout time.Duration) (int, []byte, error) {
+		headers = append(headers, h)
+		return 200, []byte(`{"Code":611}`), nil
+	}
+	s.mock.GetWithHeadersFunc = func(url string, h map[string]string, timeout time.Duration) (int, []byte, error) {
+		headers = append(headers, h)
+		return 200, []byte(`{"Code":611}`), nil
+	}
+
+	req := createRegisterRequest()
+	req.Headers = []string{"x-request-id: r1"}
+	_, e := api.Register(localhost, req)
+	c.Assert(e, check.IsNil)
+	_, e = api.ReportPiece(localhost, &types.ReportPieceRequest{TaskID: "foo"})
+	c.Assert(e, check.IsNil)
+	c.Assert(headers, check.HasLen, 2)
+	c.Check(headers[0], check.DeepEquals, map[string]string{"X-Request-Id": "r1", peertoken.Header: "t1"})
+	c.Check(headers[1], check.DeepEquals, map[string]string{peertoken.Header: "t1"})
+
+	c.Check(NewSupernodeAPIWithToken("").(*supernodeAPI).HTTPClient, check.Equals, httputils.DefaultHTTPClient)
+}
+
 func (s *SupernodeAPITestSuite) TestSupernodeAPI_PullPieceTask(c *check.C) {
 	res := &types.PullPieceTaskResponse{BaseResponse: &types.BaseResponse{}}
 	res.Code = constants.CodePeerFinish
@@ -110,6 +156,52 @@ func (s *SupernodeAPITestSuite) TestSupernodeAPI_ReportPiece(c *check.C) {
 	c.Check(r.Code, check.Equals, 611)
 }
 
+func (s *SupernodeAPITestSuite) TestSupernodeAPI_ReportPieces(c *check.C) {
+	req := &api_types.PieceSuccessRequest{
+		TaskID: "sssss",
+		Pieces: []*api_types.PieceSuccess{{PieceRange: "0-11"}, {PieceRange: "12-23"}},
+	}
+	s.mock.PostJSONFunc = s.mock.CreatePostJSONFunc(200, []byte(`{"Code":611}`), nil)
+	r, e := s.api.ReportPieces(localhost, req)
+	c.Check(e, check.IsNil)
+	c.Check(r.Code, check.Equals, 611)
+
+	s.mock.PostJSONFunc = s.mock.CreatePostJSONFunc(404, []byte("not found"), nil)
+	_, e = s.api.ReportPieces(localhost, req)
+	c.Check(e, check.NotNil)
+}
+
+func (s *SupernodeAPITestSuite) TestSupernodeAPI_ExtendProgress(c *check.C) {
+	req := &api_types.ProgressExtensionRequest{TaskID: "sssss", CID: "cid", CompletedBytes: 100}
+	s.mock.PostJSONFunc = s.mock.CreatePostJSONFunc(200, []byte(`{"granted":true,"remaining":2}`), nil)
+	r, e := s.api.ExtendProgress(localhost, req)
+	c.Check(e, check.IsNil)
+	c.Check(r.Granted, check.Equals, true)
+	c.Check(r.Remaining, check.Equals, int32(2))
+
+	s.mock.PostJSONFunc = s.mock.CreatePostJSONFunc(404, []byte("not found"), nil)
+	_, e = s.api.ExtendProgress(localhost, req)
+	c.Check(e, check.NotNil)
+}
+
+func (s *SupernodeAPITestSuite) TestSupernodeAPI_Keepalive(c *check.C) {
+	req := &api_types.PeerKeepaliveRequest{TaskID: "sssss", CID: "cid"}
+	s.mock.PostJSONFunc = s.mock.CreatePostJSONFunc(200, []byte(`{"registered":true,"expireAfter":180}`), nil)
+	r, e := s.api.Keepalive(localhost, req)
+	c.Check(e, check.IsNil)
+	c.Check(r.Registered, check.Equals, true)
+	c.Check(r.ExpireAfter, check.Equals, int64(180))
+
+	s.mock.PostJSONFunc = s.mock.CreatePostJSONFunc(404, []byte("not found"), nil)
+	r, e = s.api.Keepalive(localhost, req)
+	c.Check(e, check.IsNil)
+	c.Check(r, check.IsNil)
+
+	s.mock.PostJSONFunc = s.mock.CreatePostJSONFunc(500, []byte("error"), nil)
+	_, e = s.api.Keepalive(localhost, req)
+	c.Check(e, check.NotNil)
+}
+
 func (s *SupernodeAPITestSuite) TestSupernodeAPI_ServiceDown(c *check.C) {
 	s.mock.GetFunc = s.mock.CreateGetFunc(200, []byte(`{"Code":200}`), nil)
 	r, e := s.api.ServiceDown(localhost, "", "")
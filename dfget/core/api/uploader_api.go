@@ -17,13 +17,19 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/sirupsen/logrus"
 )
 
 // UploaderAPI defines the communication methods between dfget and uploader.
@@ -38,6 +44,18 @@ type UploaderAPI interface {
 	// FinishTask report a finished task to peer server.
 	FinishTask(ip string, port int, req *FinishTaskRequest) error
 
+	// ListTasks lists the finished tasks whose files are served by the uploader.
+	ListTasks(ip string, port int) ([]*CachedTask, error)
+
+	// TaskPaused checks whether the download of the task is paused
+	// through the control API of uploader.
+	TaskPaused(ip string, port int, taskFileName string) (bool, error)
+
+	// SyncTarget reports the current target path of the download of the task with the
+	// result of the last move request, and returns the target requested through the
+	// control API of uploader.
+	SyncTarget(ip string, port int, req *SyncTargetRequest) (*TargetStatus, error)
+
 	// PingServer send a request to determine whether the server has started.
 	PingServer(ip string, port int) bool
 }
@@ -45,6 +63,11 @@ type UploaderAPI interface {
 // uploaderAPI is an implementation of interface UploaderAPI.
 type uploaderAPI struct {
 	timeout time.Duration
+
+	// socketPath is the unix domain socket of the uploader, and localClient
+	// sends the requests through it. They're empty if the socket isn't used.
+	socketPath  string
+	localClient *httputils.Client
 }
 
 var _ UploaderAPI = &uploaderAPI{}
@@ -56,33 +79,59 @@ func NewUploaderAPI(timeout time.Duration) UploaderAPI {
 	}
 }
 
+// NewUploaderAPIWithSocket returns a new UploaderAPI which sends the requests except
+// PingServer through the unix domain socket of the uploader, and falls back to
+// the TCP address if the socket isn't available, such as an uploader of the old version.
+func NewUploaderAPIWithSocket(timeout time.Duration, socketPath string) UploaderAPI {
+	return &uploaderAPI{
+		timeout:     timeout,
+		socketPath:  socketPath,
+		localClient: httputils.NewClient(httputils.WithUnixSocket(socketPath)),
+	}
+}
+
 func (u *uploaderAPI) ParseRate(ip string, port int, req *ParseRateRequest) (string, error) {
 	headers := make(map[string]string)
 	headers[config.StrRateLimit] = strconv.Itoa(req.RateLimit)
 
-	url := fmt.Sprintf("http://%s:%d%s%s", ip, port, config.LocalHTTPPathRate, req.TaskFileName)
-	return httputils.Do(url, headers, u.timeout)
+	return u.do(ip, port, config.LocalHTTPPathRate+req.TaskFileName, headers)
 }
 
 func (u *uploaderAPI) CheckServer(ip string, port int, req *CheckServerRequest) (string, error) {
 	headers := make(map[string]string)
 	headers[config.StrDataDir] = req.DataDir
 	headers[config.StrTotalLimit] = strconv.Itoa(req.TotalLimit)
+	if req.Namespace != "" {
+		headers[config.StrNamespace] = req.Namespace
+	}
+	if req.AcceptPush {
+		headers[config.StrAcceptPush] = strconv.FormatBool(req.AcceptPush)
+	}
 
-	url := fmt.Sprintf("http://%s:%d%s%s", ip, port, config.LocalHTTPPathCheck, req.TaskFileName)
-	return httputils.Do(url, headers, u.timeout)
+	return u.do(ip, port, config.LocalHTTPPathCheck+req.TaskFileName, headers)
 }
 
 func (u *uploaderAPI) FinishTask(ip string, port int, req *FinishTaskRequest) error {
-	url := fmt.Sprintf("http://%s:%d%sfinish?"+
-		config.StrTaskFileName+"=%s&"+
-		config.StrTaskID+"=%s&"+
-		config.StrClientID+"=%s&"+
-		config.StrSuperNode+"=%s",
-		ip, port, config.LocalHTTPPathClient,
-		req.TaskFileName, req.TaskID, req.ClientID, req.Node)
-
-	code, body, err := httputils.Get(url, u.timeout)
+	query := url.Values{}
+	query.Set(config.StrTaskFileName, req.TaskFileName)
+	query.Set(config.StrTaskID, req.TaskID)
+	query.Set(config.StrClientID, req.ClientID)
+	query.Set(config.StrSuperNode, req.Node)
+	for k, v := range map[string]string{
+		config.StrURL:        req.URL,
+		config.StrTaskURL:    req.TaskURL,
+		config.StrMd5:        req.Md5,
+		config.StrIdentifier: req.Identifier,
+		config.StrNamespace:  req.Namespace,
+	} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if req.PieceSize > 0 {
+		query.Set(config.StrPieceSize, strconv.Itoa(int(req.PieceSize)))
+	}
+	code, body, err := u.get(ip, port, config.LocalHTTPPathClient+"finish?"+query.Encode(), nil)
 	if code == http.StatusOK {
 		return nil
 	}
@@ -92,8 +141,124 @@ func (u *uploaderAPI) FinishTask(ip string, port int, req *FinishTaskRequest) er
 	return err
 }
 
+func (u *uploaderAPI) ListTasks(ip string, port int) ([]*CachedTask, error) {
+	code, body, err := u.get(ip, port, config.LocalHTTPPathClient+"tasks", nil)
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("%d:%s", code, body)
+	}
+
+	var tasks []*CachedTask
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (u *uploaderAPI) TaskPaused(ip string, port int, taskFileName string) (bool, error) {
+	query := url.Values{}
+	query.Set(config.StrTaskFileName, taskFileName)
+	code, body, err := u.get(ip, port, config.LocalHTTPPathClient+"pause?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	if code != http.StatusOK {
+		return false, fmt.Errorf("%d:%s", code, body)
+	}
+	return strconv.ParseBool(string(body))
+}
+
+func (u *uploaderAPI) SyncTarget(ip string, port int, req *SyncTargetRequest) (*TargetStatus, error) {
+	query := url.Values{}
+	query.Set(config.StrTaskFileName, req.TaskFileName)
+	query.Set(config.StrCurrent, req.Current)
+	query.Set(config.StrRequestID, strconv.FormatInt(req.RequestID, 10))
+	query.Set(config.StrError, req.Error)
+	code, body, err := u.get(ip, port, config.LocalHTTPPathClient+"target?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("%d:%s", code, body)
+	}
+
+	status := &TargetStatus{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
 func (u *uploaderAPI) PingServer(ip string, port int) bool {
 	url := fmt.Sprintf("http://%s:%d%s", ip, port, config.LocalHTTPPing)
 	code, _, _ := httputils.Get(url, u.timeout)
 	return code == http.StatusOK
 }
+
+// HandOff hands off the seeding of a downloaded file to the resident uploader
+// which serves the local requests on the unix domain socket, and returns the
+// taskID which the file is seeded as.
+func HandOff(socketPath string, req *HandOffRequest, timeout time.Duration) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	client := httputils.NewClient(httputils.WithUnixSocket(socketPath))
+	defer client.CloseIdleConnections()
+	resp, err := client.DoWithBody(http.MethodPost, "http://uploader"+config.LocalHTTPPathClient+"handoff",
+		map[string]string{config.StrContentType: "application/json"}, body, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%d:%s", resp.StatusCode, data)
+	}
+	return string(data), nil
+}
+
+// do sends a GET request to the uploader and returns the body of the response
+// whose status code must be 200.
+func (u *uploaderAPI) do(ip string, port int, path string, headers map[string]string) (string, error) {
+	if code, body, ok := u.getLocal(path, headers); ok {
+		if code != http.StatusOK {
+			return "", fmt.Errorf("unexpected status code: %d", code)
+		}
+		return string(body), nil
+	}
+	return httputils.Do(fmt.Sprintf("http://%s:%d%s", ip, port, path), headers, u.timeout)
+}
+
+// get sends a GET request to the uploader through the unix domain socket,
+// or the TCP address if the socket isn't available.
+func (u *uploaderAPI) get(ip string, port int, path string, headers map[string]string) (int, []byte, error) {
+	if code, body, ok := u.getLocal(path, headers); ok {
+		return code, body, nil
+	}
+	return httputils.GetWithHeaders(fmt.Sprintf("http://%s:%d%s", ip, port, path), headers, u.timeout)
+}
+
+// getLocal sends a GET request to the uploader through the unix domain socket,
+// and ok is false if the socket isn't available to fall back to TCP.
+func (u *uploaderAPI) getLocal(path string, headers map[string]string) (code int, body []byte, ok bool) {
+	if u.localClient == nil || !fileutils.PathExist(u.socketPath) {
+		return 0, nil, false
+	}
+	resp, err := u.localClient.Get("http://uploader"+path, headers, u.timeout)
+	if err != nil {
+		logrus.Warnf("failed to send request to uploader through %s, fall back to tcp: %v", u.socketPath, err)
+		return 0, nil, false
+	}
+	defer resp.Body.Close()
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		logrus.Warnf("failed to read response of uploader through %s, fall back to tcp: %v", u.socketPath, err)
+		return 0, nil, false
+	}
+	return resp.StatusCode, body, true
+}
@@ -29,6 +29,8 @@ type CheckServerRequest struct {
 	TaskFileName string
 	DataDir      string
 	TotalLimit   int
+	Namespace    string
+	AcceptPush   bool
 }
 
 // FinishTaskRequest wraps the request which is sent to uploader
@@ -38,4 +40,72 @@ type FinishTaskRequest struct {
 	TaskID       string `request:"taskID"`
 	ClientID     string `request:"cid"`
 	Node         string `request:"superNode"`
+
+	// the source of the task which is used to export the task file, they are optional.
+	URL        string `request:"url"`
+	TaskURL    string `request:"taskURL"`
+	Md5        string `request:"md5"`
+	Identifier string `request:"identifier"`
+
+	// Namespace is the namespace whose key encrypts the task file, it's optional.
+	Namespace string `request:"namespace"`
+
+	// PieceSize is the piece size of the task, by which the uploader indexes
+	// the pieces of the task file. It's optional.
+	PieceSize int32 `request:"pieceSize"`
+}
+
+// CachedTask is a finished task whose file is served by the uploader.
+type CachedTask struct {
+	TaskID     string `json:"taskID"`
+	URL        string `json:"url"`
+	TaskURL    string `json:"taskURL,omitempty"`
+	Md5        string `json:"md5,omitempty"`
+	Identifier string `json:"identifier,omitempty"`
+
+	// Path is the absolute path of the task file.
+	Path string `json:"path"`
+}
+
+// SyncTargetRequest wraps the request which is sent to the uploader by dfget in order
+// to report the current target path of the download and get the requested one.
+type SyncTargetRequest struct {
+	TaskFileName string
+	// Current is the target path which the download is written to currently.
+	Current string
+	// RequestID is the ID of the last move request handled by dfget,
+	// and Error is why it fails, which is empty if it succeeds.
+	RequestID int64
+	Error     string
+}
+
+// TargetStatus is the status of moving the download of a task to another target path.
+type TargetStatus struct {
+	// Target is the target path requested last time, and RequestID is the ID of the request,
+	// which increases with every request. Target is empty if no move is requested.
+	Target    string `json:"target,omitempty"`
+	RequestID int64  `json:"requestID"`
+
+	// Current is the target path which the download is written to currently, and Error is why
+	// the request of RequestID fails to be handled. Both are reported by dfget.
+	Current string `json:"current,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HandOffRequest wraps the request which is sent to a resident uploader through
+// its unix domain socket in order to hand off the seeding of a downloaded file.
+type HandOffRequest struct {
+	TaskFileName string `json:"taskFileName"`
+
+	// Path is the absolute path of the downloaded file, which must be
+	// readable by the resident uploader at the same path.
+	Path string `json:"path"`
+
+	// the source of the task, they should be the same as the ones used to download it.
+	URL        string   `json:"url"`
+	TaskURL    string   `json:"taskURL,omitempty"`
+	Md5        string   `json:"md5,omitempty"`
+	Digest     string   `json:"digest,omitempty"`
+	Identifier string   `json:"identifier,omitempty"`
+	Headers    []string `json:"headers,omitempty"`
 }
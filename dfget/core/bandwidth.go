@@ -0,0 +1,177 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/locator"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minPieceRate is the min rate of every piece in flight,
+// which bounds ClientQueueSize on a slow link.
+const minPieceRate = rate.MB
+
+// bandwidthProbe is the result of probing the bandwidth to a supernode.
+type bandwidthProbe struct {
+	Node      string        `json:"node"`
+	Bandwidth rate.Rate     `json:"bandwidth"`
+	RTT       time.Duration `json:"rtt"`
+	Time      time.Time     `json:"time"`
+}
+
+// tuneLimits sets LocalLimit and ClientQueueSize from the bandwidth to supernode
+// if BandwidthProbe is enabled and they're left as default.
+func tuneLimits(cfg *config.Config, supernodeAPI api.SupernodeAPI, supernodeLocator locator.SupernodeLocator) {
+	tuneLimit := cfg.LocalLimit == config.DefaultLocalLimit
+	tuneQueue := cfg.ClientQueueSize == config.DefaultClientQueueSize
+	if !cfg.BandwidthProbe || (!tuneLimit && !tuneQueue) || cfg.Pattern == config.PatternSource ||
+		supernodeLocator == nil || supernodeLocator.Size() == 0 {
+		return
+	}
+
+	probe := loadBandwidthProbe(cfg, supernodeLocator)
+	if probe == nil {
+		if probe = probeBandwidth(supernodeAPI, supernodeLocator); probe == nil {
+			return
+		}
+		saveBandwidthProbe(cfg, probe)
+	}
+
+	limit, queue := suggestLimits(probe.Bandwidth, probe.RTT)
+	if tuneLimit {
+		cfg.LocalLimit = limit
+	}
+	if tuneQueue {
+		cfg.ClientQueueSize = queue
+	}
+	printer.Printf("bandwidth to %s: %s/s, rtt: %s, localLimit: %s, clientQueueSize: %d",
+		probe.Node, probe.Bandwidth, probe.RTT, cfg.LocalLimit, cfg.ClientQueueSize)
+	logrus.Infof("bandwidth to %s is %s/s with rtt %s, use localLimit %s and clientQueueSize %d",
+		probe.Node, probe.Bandwidth, probe.RTT, cfg.LocalLimit, cfg.ClientQueueSize)
+}
+
+// probeBandwidth measures the bandwidth and the round-trip time to the first
+// supernode which responds to the probes. It returns nil if none responds.
+func probeBandwidth(supernodeAPI api.SupernodeAPI, supernodeLocator locator.SupernodeLocator) *bandwidthProbe {
+	for _, group := range supernodeLocator.All() {
+		for _, n := range group.Nodes {
+			node := n.String()
+			start := time.Now()
+			if _, err := supernodeAPI.ProbeBandwidth(node, 0); err != nil {
+				logrus.Warnf("failed to probe the bandwidth to %s: %v", node, err)
+				continue
+			}
+			rtt := time.Since(start)
+
+			start = time.Now()
+			received, err := supernodeAPI.ProbeBandwidth(node, int64(config.BandwidthProbeSize))
+			if err != nil || received == 0 {
+				logrus.Warnf("failed to probe the bandwidth to %s: %v", node, err)
+				continue
+			}
+			// the round trip of the request isn't the time of transferring the bytes
+			elapsed := time.Since(start) - rtt
+			if elapsed < time.Millisecond {
+				elapsed = time.Millisecond
+			}
+			return &bandwidthProbe{
+				Node:      node,
+				Bandwidth: rate.Rate(float64(received) / elapsed.Seconds()),
+				RTT:       rtt,
+				Time:      time.Now(),
+			}
+		}
+	}
+	return nil
+}
+
+// suggestLimits suggests LocalLimit and ClientQueueSize for the bandwidth and the
+// round-trip time. LocalLimit leaves a fifth of the bandwidth to the other traffic,
+// and ClientQueueSize keeps the bandwidth-delay product in flight with the pieces of
+// the default size, while every piece still gets at least minPieceRate.
+func suggestLimits(bandwidth rate.Rate, rtt time.Duration) (rate.Rate, int) {
+	limit := bandwidth * 8 / 10
+	if limit >= rate.MB {
+		limit = limit / rate.MB * rate.MB
+	} else {
+		limit = limit / rate.KB * rate.KB
+	}
+	if limit < config.DefaultMinRate {
+		limit = config.DefaultMinRate
+	}
+
+	bdp := float64(limit) * rtt.Seconds()
+	queue := config.DefaultClientQueueSize + int(bdp/float64(config.BandwidthProbeSize))
+	if max := int(limit / minPieceRate); queue > max {
+		queue = max
+	}
+	if queue < 2 {
+		queue = 2
+	}
+	if queue > config.MaxClientQueueSize {
+		queue = config.MaxClientQueueSize
+	}
+	return limit, queue
+}
+
+func bandwidthProbeFile(cfg *config.Config) string {
+	return filepath.Join(filepath.Dir(cfg.RV.MetaPath), config.BandwidthProbeFile)
+}
+
+// loadBandwidthProbe returns the cached result of probing one of the supernodes,
+// it returns nil if there's none or it has expired.
+func loadBandwidthProbe(cfg *config.Config, supernodeLocator locator.SupernodeLocator) *bandwidthProbe {
+	if cfg.NoCache || cfg.RV.MetaPath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(bandwidthProbeFile(cfg))
+	if err != nil {
+		return nil
+	}
+	probe := &bandwidthProbe{}
+	if err := json.Unmarshal(data, probe); err != nil || time.Since(probe.Time) > config.BandwidthProbeTTL {
+		return nil
+	}
+	for _, group := range supernodeLocator.All() {
+		for _, n := range group.Nodes {
+			if n.String() == probe.Node {
+				return probe
+			}
+		}
+	}
+	return nil
+}
+
+func saveBandwidthProbe(cfg *config.Config, probe *bandwidthProbe) {
+	if cfg.NoCache || cfg.RV.MetaPath == "" {
+		return
+	}
+	data, _ := json.Marshal(probe)
+	if err := ioutil.WriteFile(bandwidthProbeFile(cfg), data, 0644); err != nil {
+		logrus.Warnf("failed to cache the bandwidth probe: %v", err)
+	}
+}
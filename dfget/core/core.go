@@ -18,25 +18,30 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/downloader"
-	backDown "github.com/dragonflyoss/Dragonfly/dfget/core/downloader/back_downloader"
 	p2pDown "github.com/dragonflyoss/Dragonfly/dfget/core/downloader/p2p_downloader"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/regist"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/uploader"
 	"github.com/dragonflyoss/Dragonfly/dfget/locator"
 	"github.com/dragonflyoss/Dragonfly/pkg/algorithm"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
@@ -51,7 +56,7 @@ import (
 // Start function creates a new task and starts it to download file.
 func Start(cfg *config.Config) *errortypes.DfError {
 	var (
-		supernodeAPI     = api.NewSupernodeAPI()
+		supernodeAPI     = api.NewSupernodeAPIWithToken(cfg.PeerToken)
 		supernodeLocator = locator.CreateLocator(cfg)
 		register         = regist.NewSupernodeRegister(cfg, supernodeAPI, supernodeLocator)
 		err              error
@@ -61,21 +66,231 @@ func Start(cfg *config.Config) *errortypes.DfError {
 	printer.Println(fmt.Sprintf("--%s--  %s",
 		cfg.StartTime.Format(config.DefaultTimestampFormat), cfg.URL))
 
+	if cfg.SkipIfExists && targetMatches(cfg) {
+		printer.Printf("target %s already exists and matches, skip downloading", cfg.Output)
+		logrus.Infof("target %s already exists and matches, skip downloading", cfg.Output)
+		return nil
+	}
+
+	if !cfg.VerifyOnly {
+		if err = applyIfExists(cfg); err != nil {
+			return errortypes.New(config.CodePrepareError, err.Error())
+		}
+	}
+
 	if err = prepare(cfg, supernodeLocator); err != nil {
 		return errortypes.New(config.CodePrepareError, err.Error())
 	}
 
+	if cfg.VerifyOnly {
+		if err = verifyFile(cfg, supernodeAPI, register); err != nil {
+			return errortypes.New(config.CodeVerifyError, err.Error())
+		}
+		return nil
+	}
+	tuneLimits(cfg, supernodeAPI, supernodeLocator)
+
 	if result, err = registerToSuperNode(cfg, register, supernodeLocator); err != nil {
 		return errortypes.New(config.CodeRegisterError, err.Error())
 	}
 
 	if err = downloadFile(cfg, supernodeAPI, supernodeLocator, register, result); err != nil {
+		if errortypes.IsSizeLimitExceeded(err) {
+			return errortypes.New(config.CodeSizeLimitError, err.Error())
+		}
+		if errortypes.IsDigestMismatch(err) {
+			return errortypes.New(config.CodeDigestMismatchError, err.Error())
+		}
 		return errortypes.New(config.CodeDownloadError, err.Error())
 	}
+	if cfg.SkipIfExists && !cfg.RV.BlockDevice {
+		recordDigest(cfg)
+	}
+	if cfg.HandOff != "" {
+		handOff(cfg)
+	}
+
+	return nil
+}
+
+// StartStream starts to download the file like Start, but the data is returned by
+// the reader instead of being written to the target, and nothing is written to the disk.
+// The pieces aren't kept for other peers, so it's always downloaded with the cdn pattern.
+func StartStream(cfg *config.Config) (io.Reader, *errortypes.DfError) {
+	getter, dfErr := newStreamDownloader(cfg)
+	if dfErr != nil {
+		return nil, dfErr
+	}
+	reader, err := getter.RunStream(downloadContext(cfg))
+	if err != nil {
+		return nil, errortypes.New(config.CodeDownloadError, err.Error())
+	}
+	return reader, nil
+}
+
+// StartStreamRange starts to download the file like StartStream, but only the length bytes
+// from the offset are returned, and the range is read to the end of the file if the length
+// is negative. The error is a range not satisfiable one if the offset is out of the file.
+func StartStreamRange(cfg *config.Config, offset, length int64) (*downloader.RangeReader, *errortypes.DfError) {
+	// the range is registered to supernode, which only schedules the pieces covering it
+	cfg.RV.StreamRangeOffset = offset
+	if length > 0 {
+		cfg.RV.StreamRangeLength = length
+	}
+	getter, dfErr := newStreamDownloader(cfg)
+	if dfErr != nil {
+		return nil, dfErr
+	}
+	reader, err := getter.RunStreamRange(downloadContext(cfg), offset, length)
+	if errortypes.IsRangeNotSatisfiable(err) {
+		return nil, errortypes.New(errortypes.ErrRangeNotSatisfiable.Code, err.Error())
+	}
+	if err != nil {
+		return nil, errortypes.New(config.CodeDownloadError, err.Error())
+	}
+	return reader, nil
+}
+
+// newStreamDownloader registers the task to supernode and returns the downloader
+// which downloads the file in stream.
+func newStreamDownloader(cfg *config.Config) (downloader.Downloader, *errortypes.DfError) {
+	var (
+		supernodeAPI     = api.NewSupernodeAPIWithToken(cfg.PeerToken)
+		supernodeLocator = locator.CreateLocator(cfg)
+		register         = regist.NewSupernodeRegister(cfg, supernodeAPI, supernodeLocator)
+	)
+
+	cfg.RV.StreamMode = true
+	cfg.NoCache = true
+	if err := prepare(cfg, supernodeLocator); err != nil {
+		return nil, errortypes.New(config.CodePrepareError, err.Error())
+	}
+	tuneLimits(cfg, supernodeAPI, supernodeLocator)
+
+	result, err := registerToSuperNode(cfg, register, supernodeLocator)
+	if err != nil {
+		return nil, errortypes.New(config.CodeRegisterError, err.Error())
+	}
+
+	// the stream can't fall back to the next stage once it's read, so only the first stage is used
+	stage := firstStage(cfg)
+	if stage == nil {
+		return nil, errortypes.New(config.CodeDownloadError, "all stages of the fallback chain are skipped")
+	}
+	getter, err := newStageDownloader(cfg, supernodeAPI, register, result, stage)
+	if err != nil {
+		return nil, errortypes.New(config.CodeDownloadError, err.Error())
+	}
+	return getter, nil
+}
 
+// applyIfExists applies the IfExists policy to the existing target before downloading.
+// The block devices are always written in place.
+func applyIfExists(cfg *config.Config) error {
+	target := cfg.Output
+	if _, err := os.Lstat(target); err != nil || fileutils.IsBlockDevice(target) {
+		return nil
+	}
+
+	switch cfg.IfExists {
+	case config.IfExistsFail:
+		return fmt.Errorf("target %s already exists", target)
+	case config.IfExistsBackup:
+		// the existing target is kept by a hard link which replaces the old backup,
+		// since the downloaded file is renamed to the target instead of being written into it
+		backup := target + config.BackupFileSuffix
+		if err := fileutils.Link(target, backup); err != nil {
+			logrus.Warnf("failed to link %s to %s, copy it instead: %v", target, backup, err)
+			if err = fileutils.CopyFile(target, backup); err != nil {
+				return fmt.Errorf("failed to back up the target %s: %v", target, err)
+			}
+		}
+		printer.Printf("target %s already exists, back it up to %s", target, backup)
+		logrus.Infof("back up the existing target %s to %s", target, backup)
+	}
 	return nil
 }
 
+// the extended attributes recording where and what the target was downloaded
+const (
+	xattrURL    = "user.dragonfly.url"
+	xattrDigest = "user.dragonfly.digest"
+)
+
+// targetMatches reports whether the existing target is the same as the file to download.
+// It's checked by the digest given by user, or the digest recorded in the extended attributes
+// of the target if the target was downloaded from the same url.
+func targetMatches(cfg *config.Config) bool {
+	target := cfg.Output
+	if !fileutils.IsRegularFile(target) {
+		return false
+	}
+	if algo, expected := cfg.ExpectedDigest(); algo != "" {
+		return digest.String(algo, fileutils.Sum(target, digest.NewHash(algo))) == expected
+	}
+
+	if url, err := fileutils.GetXattr(target, xattrURL); err != nil || url != cfg.URL {
+		return false
+	}
+	recorded, err := fileutils.GetXattr(target, xattrDigest)
+	if err != nil {
+		return false
+	}
+	// only the digests of the known algorithms are trusted
+	algo, expected, err := digest.Parse(recorded)
+	if err != nil || !strings.Contains(recorded, ":") {
+		return false
+	}
+	return fileutils.Sum(target, digest.NewHash(algo)) == expected
+}
+
+// recordDigest records the url and digest of the downloaded target into its extended
+// attributes, so that the next download of the same url could be skipped if it matches.
+func recordDigest(cfg *config.Config) {
+	_, d := cfg.ExpectedDigest()
+	switch {
+	case d != "":
+	case !stringutils.IsEmptyStr(cfg.RV.Sha256):
+		d = digest.String(digest.AlgorithmSHA256, cfg.RV.Sha256)
+	default:
+		d = digest.String(digest.AlgorithmSHA256, fileutils.Sha256Sum(cfg.Output))
+	}
+
+	if err := fileutils.SetXattr(cfg.Output, xattrURL, cfg.URL); err != nil {
+		logrus.Warnf("failed to record the url of %s: %v", cfg.Output, err)
+		return
+	}
+	if err := fileutils.SetXattr(cfg.Output, xattrDigest, d); err != nil {
+		logrus.Warnf("failed to record the digest of %s: %v", cfg.Output, err)
+	}
+}
+
+// handOff hands off the seeding of the downloaded target to the resident uploader.
+// A failed hand-off doesn't fail the download, which has succeeded already.
+// The targets of the namespaces are never handed off, since they would be
+// cached without being encrypted.
+func handOff(cfg *config.Config) {
+	if cfg.RV.BlockDevice || cfg.Namespace != "" {
+		logrus.Warnf("the seeding of %s can't be handed off", cfg.Output)
+		return
+	}
+	taskID, err := api.HandOff(cfg.HandOff, &api.HandOffRequest{
+		TaskFileName: cfg.RV.TaskFileName,
+		Path:         cfg.RV.RealTarget,
+		URL:          cfg.URL,
+		TaskURL:      cfg.RV.TaskURL,
+		Md5:          cfg.Md5,
+		Digest:       cfg.Digest,
+		Identifier:   cfg.Identifier,
+		Headers:      cfg.Header,
+	}, httputils.DefaultTimeout)
+	if err != nil {
+		logrus.Warnf("failed to hand off the seeding of %s to %s: %v", cfg.Output, cfg.HandOff, err)
+		return
+	}
+	logrus.Infof("hand off the seeding of %s to %s as task %s", cfg.Output, cfg.HandOff, taskID)
+}
+
 // prepare the RV-related information and create the corresponding files.
 func prepare(cfg *config.Config, locator locator.SupernodeLocator) (err error) {
 	printer.Printf("dfget version:%s", version.DFGetVersion)
@@ -83,36 +298,94 @@ func prepare(cfg *config.Config, locator locator.SupernodeLocator) (err error) {
 	printer.Printf("sign:%s", cfg.Sign)
 	logrus.Infof("target file path:%s", cfg.Output)
 
+	switch cfg.Priority {
+	case "", config.PriorityHigh, config.PriorityNormal, config.PriorityLow:
+	default:
+		return fmt.Errorf("invalid priority: %s", cfg.Priority)
+	}
+	if !cfg.GroupDeadline.IsZero() && cfg.Group == "" {
+		return fmt.Errorf("--group-deadline requires --group")
+	}
+
 	rv := &cfg.RV
 
-	rv.RealTarget = cfg.Output
-	rv.TargetDir = filepath.Dir(rv.RealTarget)
-	if err = fileutils.CreateDirectory(rv.TargetDir); err != nil {
-		return err
+	if cfg.UploadEventLog && rv.EventLog == nil {
+		rv.EventLog = config.NewEventLog(config.DefaultEventLogSize)
 	}
 
-	if cfg.RV.TempTarget, err = createTempTargetFile(rv.TargetDir, cfg.Sign); err != nil {
-		return err
+	if cfg.CDNTLS != nil && rv.CDNTLSConfig == nil {
+		if rv.CDNTLSConfig, err = cfg.CDNTLS.TLSConfig(); err != nil {
+			return err
+		}
 	}
 
-	if err = fileutils.CreateDirectory(filepath.Dir(rv.MetaPath)); err != nil {
-		return err
-	}
-	if err = fileutils.CreateDirectory(cfg.WorkHome); err != nil {
-		return err
+	rv.RealTarget = cfg.Output
+	rv.TargetDir = filepath.Dir(rv.RealTarget)
+	if fileutils.IsBlockDevice(rv.RealTarget) {
+		// the pieces are written to the device directly
+		logrus.Infof("target %s is a block device", rv.RealTarget)
+		rv.BlockDevice = true
+		rv.TempTarget = rv.RealTarget
+	} else if !rv.StreamMode {
+		// the data is returned by a reader in stream mode, and nothing is written to the target
+		if err = fileutils.CreateDirectory(rv.TargetDir); err != nil {
+			return err
+		}
+		rv.TempDir = rv.TargetDir
+		if cfg.WorkDir != "" {
+			if rv.TempDir, err = filepath.Abs(cfg.WorkDir); err != nil {
+				return err
+			}
+			if err = fileutils.CreateDirectory(rv.TempDir); err != nil {
+				return err
+			}
+		}
+		if cfg.RV.TempTarget, err = createTempTargetFile(rv.TempDir, cfg.Sign); err != nil {
+			return err
+		}
 	}
-	if err = fileutils.CreateDirectory(rv.SystemDataDir); err != nil {
-		return err
+
+	if cfg.NoCache {
+		// nothing is written into the work home, and the file isn't shared with other peers
+		logrus.Infof("no cache mode, the file is downloaded with the %s pattern", config.PatternCDN)
+		if cfg.Pattern == config.PatternP2P {
+			cfg.Pattern = config.PatternCDN
+		}
+	} else {
+		if err = fileutils.CreateDirectory(filepath.Dir(rv.MetaPath)); err != nil {
+			return err
+		}
+		if err = fileutils.CreateDirectory(cfg.WorkHome); err != nil {
+			return err
+		}
+		if err = fileutils.CreateDirectory(rv.SystemDataDir); err != nil {
+			return err
+		}
+		if rv.DataDir, err = selectDataDir(cfg); err != nil {
+			return err
+		}
+		logrus.Infof("data dir:%s", rv.DataDir)
+		scavengeOrphans(cfg)
 	}
-	rv.DataDir = cfg.RV.SystemDataDir
 
 	if stringutils.IsEmptyStr(rv.LocalIP) {
 		rv.LocalIP = checkConnectSupernode(locator)
 	}
 	rv.Cid = getCid(rv.LocalIP, cfg.Sign)
+	httputils.SetIdentity(httputils.Identity{
+		UserAgent: cfg.UserAgent,
+		Cluster:   cfg.Cluster,
+		Node:      rv.LocalIP,
+	})
 	rv.TaskFileName = getTaskFileName(rv.RealTarget, cfg.Sign)
+	if _, err = helper.GetCacheCipher(cfg); err != nil {
+		return err
+	}
 	rv.TaskURL = netutils.FilterURLParam(cfg.URL, cfg.Filter)
 	logrus.Info("runtimeVariable: " + cfg.RV.String())
+	if trace := httputils.FormatTraceHeaders(netutils.ConvertHeaders(cfg.Header)); trace != "" {
+		logrus.Infof("trace headers: %s", trace)
+	}
 
 	return nil
 }
@@ -137,6 +410,10 @@ func registerToSuperNode(cfg *config.Config, register regist.SupernodeRegister,
 		cfg.BackSourceReason = config.BackSourceReasonUserSpecified
 		panic("user specified")
 	}
+	if !config.HasProvider(fallbackChain(cfg), config.ProviderDragonfly) {
+		cfg.BackSourceReason = config.BackSourceReasonUserSpecified
+		panic("no dragonfly stage in the fallback chain")
+	}
 
 	if supernodeLocator == nil || supernodeLocator.Size() == 0 {
 		cfg.BackSourceReason = config.BackSourceReasonNodeEmpty
@@ -158,7 +435,9 @@ func registerToSuperNode(cfg *config.Config, register regist.SupernodeRegister,
 		cfg.BackSourceReason = config.BackSourceReasonRegisterFail
 		panic(e.Error())
 	}
-	cfg.RV.FileLength = result.FileLength
+	atomic.StoreInt64(&cfg.RV.FileLength, result.FileLength)
+	cfg.RV.TaskID = result.TaskID
+	cfg.RV.ResponseHeaders = result.ResponseHeaders
 	printer.Printf("client:%s connected to node:%s", cfg.RV.LocalIP, result.Node)
 	return result, nil
 }
@@ -171,13 +450,19 @@ func downloadFile(cfg *config.Config, supernodeAPI api.SupernodeAPI, locator loc
 	err := doDownload(cfg, supernodeAPI, register, result, timeout)
 	if err != nil {
 		success = false
+		cfg.RV.EventLog.Record(config.EventError, "", "", err.Error())
 	} else if cfg.RV.FileLength < 0 && fileutils.IsRegularFile(cfg.RV.RealTarget) {
 		if info, err := os.Stat(cfg.RV.RealTarget); err == nil {
-			cfg.RV.FileLength = info.Size()
+			atomic.StoreInt64(&cfg.RV.FileLength, info.Size())
 		}
 	}
 
-	os.Remove(cfg.RV.TempTarget)
+	if !cfg.RV.BlockDevice {
+		os.Remove(cfg.RV.TempTarget)
+	}
+	if cfg.AcceptPush {
+		os.RemoveAll(helper.GetPushDir(cfg.WorkHome, cfg.RV.TaskFileName))
+	}
 	downloadTime := time.Since(cfg.StartTime).Seconds()
 	// upload metrics to supernode only if pattern is p2p or cdn and result is not nil
 	if cfg.Pattern != config.PatternSource && result != nil {
@@ -196,36 +481,26 @@ func downloadFile(cfg *config.Config, supernodeAPI api.SupernodeAPI, locator loc
 
 func doDownload(cfg *config.Config, supernodeAPI api.SupernodeAPI,
 	register regist.SupernodeRegister, result *regist.RegisterResult, timeout time.Duration) error {
-	var getter downloader.Downloader
-	isBackDownload := false
-	if cfg.BackSourceReason > 0 {
-		getter = backDown.NewBackDownloader(cfg, result)
-		isBackDownload = true
-	} else {
-		printer.Printf("start download by dragonfly...")
-		getter = p2pDown.NewP2PDownloader(cfg, supernodeAPI, register, result)
-	}
-
-	err := downloader.DoDownloadTimeout(getter, timeout)
-	// report finished task to uploader regardless of the result of downloading from dragonfly
-	reportFinishedTask(cfg, getter)
-	if err == nil {
-		return nil
-	}
-
-	if isBackDownload {
-		return fmt.Errorf("failed to download file from source: %v", err)
-	}
+	return runFallbackChain(cfg, supernodeAPI, register, result, timeout)
+}
 
-	logrus.Errorf("failed to download by dragonfly: %v, and start try to download from source", err)
-	printer.Printf("failed to download by dragonfly: %v, and start try to download from source", err)
+// downloadFromSource downloads the file from the source station directly by the getter,
+// and records the time when it starts and the time it takes.
+func downloadFromSource(cfg *config.Config, getter downloader.Downloader, timeout time.Duration) error {
+	cfg.RV.BackSourceTime = time.Now()
+	defer func() {
+		cfg.RV.BackSourceDuration = time.Since(cfg.RV.BackSourceTime)
+	}()
+	return downloader.DoDownloadContext(downloadContext(cfg), getter, timeout)
+}
 
-	// try to download the file from the source directly
-	getter = backDown.NewBackDownloader(cfg, result)
-	if err := downloader.DoDownloadTimeout(getter, timeout); err != nil {
-		return fmt.Errorf("failed to download file from source: %v", err)
+// downloadContext returns the context of the download, which is done once the process
+// embedding the core of dfget aborts the download.
+func downloadContext(cfg *config.Config) context.Context {
+	if cfg.RV.Context != nil {
+		return cfg.RV.Context
 	}
-	return nil
+	return context.Background()
 }
 
 func reportFinishedTask(cfg *config.Config, getter downloader.Downloader) {
@@ -233,13 +508,22 @@ func reportFinishedTask(cfg *config.Config, getter downloader.Downloader) {
 		return
 	}
 	if getter, ok := getter.(*p2pDown.P2PDownloader); ok {
-		uploader.FinishTask(cfg.RV.LocalIP, cfg.RV.PeerPort,
-			cfg.RV.TaskFileName, cfg.RV.Cid,
-			getter.GetTaskID(), getter.GetNode())
+		uploader.FinishTask(cfg.PeerIP(), cfg.RV.PeerPort, &api.FinishTaskRequest{
+			TaskFileName: cfg.RV.TaskFileName,
+			TaskID:       getter.GetTaskID(),
+			ClientID:     cfg.RV.Cid,
+			Node:         getter.GetNode(),
+			URL:          cfg.URL,
+			TaskURL:      cfg.RV.TaskURL,
+			Md5:          cfg.Md5,
+			Identifier:   cfg.Identifier,
+			Namespace:    cfg.Namespace,
+			PieceSize:    getter.GetPieceSize(),
+		})
 	}
 }
 
-func createTempTargetFile(targetDir string, sign string) (name string, e error) {
+func createTempTargetFile(tempDir string, sign string) (name string, e error) {
 	var (
 		f *os.File
 	)
@@ -250,13 +534,13 @@ func createTempTargetFile(targetDir string, sign string) (name string, e error)
 		}
 	}()
 
-	prefix := "dfget-" + sign + ".tmp-"
-	f, e = ioutil.TempFile(targetDir, prefix)
+	prefix := config.TempFilePrefix(sign, config.TempKindTarget)
+	f, e = ioutil.TempFile(tempDir, prefix)
 	if e == nil {
 		return f.Name(), e
 	}
 
-	f, e = os.OpenFile(filepath.Join(targetDir, fmt.Sprintf("%s%d", prefix, rand.Uint64())),
+	f, e = os.OpenFile(filepath.Join(tempDir, fmt.Sprintf("%s%d", prefix, rand.Uint64())),
 		os.O_CREATE|os.O_EXCL, 0755)
 	if e == nil {
 		return f.Name(), e
@@ -264,6 +548,76 @@ func createTempTargetFile(targetDir string, sign string) (name string, e error)
 	return "", e
 }
 
+// scavengeOrphans removes the orphaned temp files left by the crashed dfget
+// processes in the temp directory of the target and the data directories.
+func scavengeOrphans(cfg *config.Config) {
+	dirs := map[string]bool{cfg.RV.SystemDataDir: true}
+	for _, dir := range cfg.DataDirs {
+		dirs[dir.Path] = true
+	}
+	if !cfg.RV.BlockDevice && cfg.RV.TempDir != "" && !dirs[cfg.RV.TempDir] {
+		dirs[cfg.RV.TempDir] = false
+	}
+
+	for dir, withTaskFiles := range dirs {
+		result, err := helper.ScavengeOrphans(dir, withTaskFiles, config.DefaultOrphanFileAge, false)
+		if err != nil {
+			logrus.Warnf("failed to scavenge orphaned files in %s: %v", dir, err)
+			continue
+		}
+		if len(result.Files) > 0 {
+			logrus.Infof("remove %d orphaned files in %s, reclaimed %d bytes",
+				len(result.Files), dir, result.Bytes)
+		}
+	}
+}
+
+// selectDataDir selects the directory to store the downloaded files from the DataDirs
+// according to the DataDirPlacement, and the SystemDataDir is returned if DataDirs is empty.
+func selectDataDir(cfg *config.Config) (string, error) {
+	if len(cfg.DataDirs) == 0 {
+		return cfg.RV.SystemDataDir, nil
+	}
+
+	switch cfg.DataDirPlacement {
+	case "", config.DataDirPlacementWeight:
+		total := 0
+		for _, dir := range cfg.DataDirs {
+			total += dir.Weight
+		}
+		n := rand.Intn(total)
+		for _, dir := range cfg.DataDirs {
+			if n -= dir.Weight; n < 0 {
+				return dir.Path, fileutils.CreateDirectory(dir.Path)
+			}
+		}
+	case config.DataDirPlacementFreeSpace:
+		var (
+			selected string
+			maxFree  fileutils.Fsize = -1
+		)
+		for _, dir := range cfg.DataDirs {
+			if err := fileutils.CreateDirectory(dir.Path); err != nil {
+				logrus.Warnf("failed to create data dir %s: %v", dir.Path, err)
+				continue
+			}
+			free, err := fileutils.GetFreeSpace(dir.Path)
+			if err != nil {
+				logrus.Warnf("failed to get free space of data dir %s: %v", dir.Path, err)
+				continue
+			}
+			if free > maxFree {
+				selected, maxFree = dir.Path, free
+			}
+		}
+		if selected == "" {
+			return "", fmt.Errorf("no data dir is available")
+		}
+		return selected, nil
+	}
+	return "", fmt.Errorf("invalid data dir placement: %s", cfg.DataDirPlacement)
+}
+
 func getTaskFileName(realTarget string, sign string) string {
 	return filepath.Base(realTarget) + "-" + sign
 }
@@ -286,19 +640,21 @@ func adjustSupernodeList(nodes []string) []string {
 	}
 }
 
-func checkConnectSupernode(locator locator.SupernodeLocator) (localIP string) {
+func checkConnectSupernode(supernodeLocator locator.SupernodeLocator) (localIP string) {
 	var (
 		e error
 	)
-	if locator == nil {
+	if supernodeLocator == nil {
 		return ""
 	}
-	for _, group := range locator.All() {
+	for _, group := range supernodeLocator.All() {
 		for _, n := range group.Nodes {
 			if localIP, e = httputils.CheckConnect(n.IP, n.Port, 1000); e == nil {
 				return localIP
 			}
 			logrus.Errorf("Connect to node:%s error: %v", n, e)
+			// the unreachable node is tried after the others at the registration
+			locator.ReportHealth(supernodeLocator, n.String(), false)
 		}
 	}
 	return ""
@@ -317,21 +673,31 @@ func reportMetrics(cfg *config.Config, supernodeAPI api.SupernodeAPI, locator lo
 		Success:          success,
 		TaskID:           taskID,
 	}
-	node := locator.Get()
+	if cfg.BackSourceReason > 0 && !cfg.RV.BackSourceTime.IsZero() {
+		req.BacksourceAfter = cfg.RV.BackSourceTime.Sub(cfg.StartTime).Seconds()
+		req.BacksourceDuration = cfg.RV.BackSourceDuration.Seconds()
+	}
+	req.Events, req.EventsDropped = cfg.RV.EventLog.Events()
+	// the metrics are reported to the supernode which schedules the task
+	node := locator.Select(taskID)
+	if node == nil {
+		node = locator.Get()
+	}
 	if node == nil {
 		return
 	}
 	nodeStr := node.String()
-	// retry twice
-	for i := 0; i < 2; i++ {
+	cfg.Retry.Do(func(attempt int) error {
 		resp, err := supernodeAPI.ReportMetrics(nodeStr, req)
 		if err != nil {
 			logrus.Errorf("failed to report metrics to supernode %s: %v", nodeStr, err)
+			return err
 		}
-		if resp != nil && resp.IsSuccess() {
-			return
+		if resp == nil || !resp.IsSuccess() {
+			return fmt.Errorf("failed to report metrics to supernode %s: %+v", nodeStr, resp)
 		}
-	}
+		return nil
+	})
 }
 
 func calculateTimeout(cfg *config.Config) time.Duration {
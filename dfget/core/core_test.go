@@ -29,12 +29,16 @@ import (
 	"testing"
 	"time"
 
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	. "github.com/dragonflyoss/Dragonfly/dfget/core/helper"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/regist"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/uploader"
 	"github.com/dragonflyoss/Dragonfly/dfget/locator"
 	"github.com/dragonflyoss/Dragonfly/pkg/algorithm"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
 
 	"github.com/go-check/check"
 	"github.com/valyala/fasthttp"
@@ -73,6 +77,22 @@ func (s *CoreTestSuite) TestPrepare(c *check.C) {
 	fmt.Printf("%s\nerror:%v", buf.String(), err)
 }
 
+func (s *CoreTestSuite) TestPrepareNoCache(c *check.C) {
+	cfg := s.createConfig(&bytes.Buffer{})
+	cfg.Output = filepath.Join(s.workHome, "test.output")
+	cfg.WorkHome = filepath.Join(s.workHome, "nocache")
+	cfg.RV.MetaPath = filepath.Join(cfg.WorkHome, "meta", "host.meta")
+	cfg.RV.SystemDataDir = filepath.Join(cfg.WorkHome, "data")
+	cfg.RV.LocalIP = "127.0.0.1"
+	cfg.Pattern = config.PatternP2P
+	cfg.NoCache = true
+
+	c.Assert(prepare(cfg, nil), check.IsNil)
+	c.Check(cfg.Pattern, check.Equals, config.PatternCDN)
+	c.Check(fileutils.PathExist(cfg.WorkHome), check.Equals, false)
+	os.Remove(cfg.RV.TempTarget)
+}
+
 func (s *CoreTestSuite) TestRegisterToSupernode(c *check.C) {
 	cfg := s.createConfig(&bytes.Buffer{})
 	m := new(MockSupernodeAPI)
@@ -167,8 +187,231 @@ func (s *CoreTestSuite) TestCalculateTimeout(c *check.C) {
 }
 
 // ----------------------------------------------------------------------------
+func (s *CoreTestSuite) TestSelectDataDir(c *check.C) {
+	cfg := s.createConfig(&bytes.Buffer{})
+
+	dir, err := selectDataDir(cfg)
+	c.Assert(err, check.IsNil)
+	c.Check(dir, check.Equals, cfg.RV.SystemDataDir)
+
+	cfg.DataDirs = []*config.DataDirWeight{
+		{Path: filepath.Join(s.workHome, "data1"), Weight: 1},
+		{Path: filepath.Join(s.workHome, "data2"), Weight: 2},
+	}
+	for i := 0; i < 10; i++ {
+		dir, err = selectDataDir(cfg)
+		c.Assert(err, check.IsNil)
+		c.Check(dir == cfg.DataDirs[0].Path || dir == cfg.DataDirs[1].Path, check.Equals, true)
+		c.Check(fileutils.IsDir(dir), check.Equals, true)
+	}
+
+	cfg.DataDirs[0].Weight = 0
+	for i := 0; i < 10; i++ {
+		dir, _ = selectDataDir(cfg)
+		c.Check(dir, check.Equals, cfg.DataDirs[1].Path)
+	}
+
+	cfg.DataDirPlacement = config.DataDirPlacementFreeSpace
+	dir, err = selectDataDir(cfg)
+	c.Assert(err, check.IsNil)
+	c.Check(dir == cfg.DataDirs[0].Path || dir == cfg.DataDirs[1].Path, check.Equals, true)
+
+	cfg.DataDirPlacement = "x"
+	_, err = selectDataDir(cfg)
+	c.Check(err, check.NotNil)
+}
+
+func (s *CoreTestSuite) TestApplyIfExists(c *check.C) {
+	cfg := s.createConfig(&bytes.Buffer{})
+	cfg.Output = filepath.Join(s.workHome, "exists.test")
+	backup := cfg.Output + config.BackupFileSuffix
+
+	cfg.IfExists = config.IfExistsFail
+	c.Assert(applyIfExists(cfg), check.IsNil)
+
+	c.Assert(ioutil.WriteFile(cfg.Output, []byte("old"), 0644), check.IsNil)
+	c.Check(applyIfExists(cfg), check.NotNil)
+
+	cfg.IfExists = config.IfExistsOverwrite
+	c.Check(applyIfExists(cfg), check.IsNil)
+	c.Check(fileutils.PathExist(backup), check.Equals, false)
+
+	cfg.IfExists = config.IfExistsBackup
+	c.Assert(applyIfExists(cfg), check.IsNil)
+	content, err := ioutil.ReadFile(backup)
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, "old")
+
+	// the backup is kept after the target is replaced
+	tmp := filepath.Join(s.workHome, "exists.tmp")
+	c.Assert(ioutil.WriteFile(tmp, []byte("new"), 0644), check.IsNil)
+	c.Assert(fileutils.MoveFile(tmp, cfg.Output), check.IsNil)
+	content, _ = ioutil.ReadFile(backup)
+	c.Check(string(content), check.Equals, "old")
+
+	c.Assert(applyIfExists(cfg), check.IsNil)
+	content, _ = ioutil.ReadFile(backup)
+	c.Check(string(content), check.Equals, "new")
+}
+
+func (s *CoreTestSuite) TestTargetMatches(c *check.C) {
+	cfg := s.createConfig(&bytes.Buffer{})
+	cfg.URL = "http://a.com/skip.test"
+	cfg.Output = filepath.Join(s.workHome, "skip.test")
+	c.Check(targetMatches(cfg), check.Equals, false)
+
+	md5 := CreateTestFileWithMD5(cfg.Output, "test skip")
+	cfg.Md5 = "x"
+	c.Check(targetMatches(cfg), check.Equals, false)
+	cfg.Md5 = md5
+	c.Check(targetMatches(cfg), check.Equals, true)
+
+	cfg.Md5 = ""
+	c.Check(targetMatches(cfg), check.Equals, false)
+	if err := fileutils.SetXattr(cfg.Output, xattrURL, cfg.URL); err != nil {
+		c.Skip(fmt.Sprintf("extended attributes are not supported: %v", err))
+	}
+	recordDigest(cfg)
+	c.Check(targetMatches(cfg), check.Equals, true)
+
+	cfg.URL = "http://a.com/other"
+	c.Check(targetMatches(cfg), check.Equals, false)
+	cfg.URL = "http://a.com/skip.test"
+	ioutil.WriteFile(cfg.Output, []byte("modified"), 0644)
+	c.Check(targetMatches(cfg), check.Equals, false)
+}
+
+func (s *CoreTestSuite) TestVerifyPieces(c *check.C) {
+	path := filepath.Join(s.workHome, "verify.test")
+	pieceSize := int32(10 + config.PieceMetaSize)
+	c.Assert(ioutil.WriteFile(path, []byte("0123456789abcdefghijABCDEFGHIJxyz"), 0644), check.IsNil)
+	expected, err := uploader.ComputePieceMD5s(path, pieceSize)
+	c.Assert(err, check.IsNil)
+	c.Assert(expected, check.HasLen, 4)
+
+	local, _ := uploader.ComputePieceMD5s(path, pieceSize)
+	c.Check(diffPieces(expected, local, pieceSize), check.HasLen, 0)
+
+	// the 2nd and 3rd pieces are merged, and the last one is missing
+	c.Assert(ioutil.WriteFile(path, []byte("0123456789abcdefghiXAXCDEFGHIJ"), 0644), check.IsNil)
+	local, _ = uploader.ComputePieceMD5s(path, pieceSize)
+	c.Check(fmt.Sprint(diffPieces(expected, local, pieceSize)), check.Equals, "[10-32]")
+
+	c.Assert(ioutil.WriteFile(path, []byte("X123456789abcdefghijABCDEFGHIJxyz12"), 0644), check.IsNil)
+	local, _ = uploader.ComputePieceMD5s(path, pieceSize)
+	c.Check(fmt.Sprint(diffPieces(expected, local, pieceSize)), check.Equals, "[0-9 30-34]")
+
+	pieceMD5sRetryInterval = time.Millisecond
+	count := 0
+	var pages []int
+	supernodeAPI := &MockSupernodeAPI{
+		GetPieceMD5sFunc: func(node string, taskID string, start int, limit int, groupSize int) (*apiTypes.TaskPieceMD5s, error) {
+			if count++; count < 3 {
+				return nil, fmt.Errorf("503")
+			}
+			resp := &apiTypes.TaskPieceMD5s{TaskID: taskID, PieceSize: pieceSize,
+				PieceTotal: int32(len(expected)), Start: int32(start)}
+			if groupSize > 0 {
+				resp.GroupSize = int32(groupSize)
+				resp.PieceGroups = digest.GroupSha1(expected, groupSize)
+				return resp, nil
+			}
+			pages = append(pages, start)
+			resp.PieceMD5s = expected[start : start+limit]
+			return resp, nil
+		},
+	}
+	pieceGroupSize = 2
+	manifest, err := getPieceMD5s(supernodeAPI, "node", "task", time.Second)
+	c.Assert(err, check.IsNil)
+	c.Check(manifest.PieceGroups, check.HasLen, 2)
+
+	// only the md5s of the groups which differ from the local ones are fetched
+	c.Assert(ioutil.WriteFile(path, []byte("X123456789abcdefghijABCDEFGHIJxyz"), 0644), check.IsNil)
+	local, _ = uploader.ComputePieceMD5s(path, pieceSize)
+	pieces, err := expectedPieceMD5s(supernodeAPI, "node", manifest, local)
+	c.Assert(err, check.IsNil)
+	c.Check(pieces, check.DeepEquals, expected)
+	c.Check(pages, check.DeepEquals, []int{0})
+
+	pages = nil
+	pieces, err = expectedPieceMD5s(supernodeAPI, "node", manifest, local[:3])
+	c.Assert(err, check.IsNil)
+	c.Check(pieces, check.DeepEquals, expected)
+	c.Check(pages, check.DeepEquals, []int{0, 2})
+
+	pieces, err = expectedPieceMD5s(supernodeAPI, "node", &apiTypes.TaskPieceMD5s{PieceMD5s: expected}, local)
+	c.Assert(err, check.IsNil)
+	c.Check(pieces, check.DeepEquals, expected)
+
+	count = -100
+	_, err = getPieceMD5s(supernodeAPI, "node", "task", 10*time.Millisecond)
+	c.Check(err, check.NotNil)
+}
+
 // helper functions
 
+func (s *CoreTestSuite) TestSuggestLimits(c *check.C) {
+	var cases = []struct {
+		bandwidth rate.Rate
+		rtt       time.Duration
+		limit     rate.Rate
+		queue     int
+	}{
+		{100 * rate.MB, time.Millisecond, 80 * rate.MB, config.DefaultClientQueueSize},
+		{1000 * rate.MB, 100 * time.Millisecond, 800 * rate.MB, config.DefaultClientQueueSize + 20},
+		{1000 * rate.MB, time.Second, 800 * rate.MB, config.MaxClientQueueSize},
+		{4 * rate.MB, time.Millisecond, 3 * rate.MB, 3},
+		{10 * rate.KB, time.Millisecond, config.DefaultMinRate, 2},
+	}
+	for _, cc := range cases {
+		limit, queue := suggestLimits(cc.bandwidth, cc.rtt)
+		c.Check(limit, check.Equals, cc.limit, check.Commentf("%v", cc))
+		c.Check(queue, check.Equals, cc.queue, check.Commentf("%v", cc))
+	}
+}
+
+func (s *CoreTestSuite) TestTuneLimits(c *check.C) {
+	cfg := s.createConfig(&bytes.Buffer{})
+	cfg.RV.MetaPath = filepath.Join(s.workHome, "probe", "meta", "host.meta")
+	c.Assert(os.MkdirAll(filepath.Dir(cfg.RV.MetaPath), 0755), check.IsNil)
+	cfg.LocalLimit = config.DefaultLocalLimit
+	cfg.ClientQueueSize = config.DefaultClientQueueSize
+	snLocator, _ := locator.NewStaticLocatorFromStr("test", []string{"127.0.0.1:8002"})
+	probes := 0
+	m := &MockSupernodeAPI{ProbeBandwidthFunc: func(node string, size int64) (int64, error) {
+		probes++
+		c.Check(node, check.Equals, "127.0.0.1:8002")
+		return size, nil
+	}}
+
+	// the probe is disabled
+	tuneLimits(cfg, m, snLocator)
+	c.Check(probes, check.Equals, 0)
+
+	cfg.BandwidthProbe = true
+	tuneLimits(cfg, m, snLocator)
+	c.Check(probes, check.Equals, 2)
+	c.Check(cfg.LocalLimit > config.DefaultLocalLimit, check.Equals, true)
+	c.Check(fileutils.PathExist(bandwidthProbeFile(cfg)), check.Equals, true)
+
+	// the cached result is used, and the configured values are kept
+	cfg.LocalLimit = 10 * rate.MB
+	cfg.ClientQueueSize = config.DefaultClientQueueSize
+	tuneLimits(cfg, m, snLocator)
+	c.Check(probes, check.Equals, 2)
+	c.Check(cfg.LocalLimit, check.Equals, 10*rate.MB)
+
+	// the cached result of another supernode isn't used
+	other, _ := locator.NewStaticLocatorFromStr("test", []string{"127.0.0.2:8002"})
+	m.ProbeBandwidthFunc = func(node string, size int64) (int64, error) {
+		return 0, fmt.Errorf("unreachable")
+	}
+	cfg.LocalLimit = config.DefaultLocalLimit
+	tuneLimits(cfg, m, other)
+	c.Check(cfg.LocalLimit, check.Equals, config.DefaultLocalLimit)
+}
+
 func (s *CoreTestSuite) createConfig(writer io.Writer) *config.Config {
 	return CreateConfig(writer, s.workHome)
 }
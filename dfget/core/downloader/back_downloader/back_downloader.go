@@ -20,19 +20,24 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/downloader"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/regist"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 
 	"github.com/pkg/errors"
@@ -50,13 +55,32 @@ type BackDownloader struct {
 	// Md5 is the expected file md5 to prevent files from being tampered with.
 	Md5 string
 
+	// Digest is the expected digest of the file in the form of "algo:hex",
+	// which is verified in addition to the Md5 if it's not an md5 one.
+	Digest string
+
 	// TaskID a string which represents a unique task.
 	TaskID string
 
+	// Counter counts the bytes downloaded, the SourceBytes of the runtime variables
+	// is used if it's nil.
+	Counter *int64
+
 	cfg *config.Config
 
 	tempFileName string
 	cleaned      bool
+
+	// checkpointFile records the progress of writing the temp file, and both of them
+	// are kept after Cleanup if keepTempFile is true, so that the next dfget could
+	// resume the download from them.
+	checkpointFile string
+	keepTempFile   bool
+
+	// client sends the requests to the source station, which is created by newClient
+	// and dropped by Cleanup.
+	clientLock sync.Mutex
+	client     *httputils.Client
 }
 
 var _ downloader.Downloader = &BackDownloader{}
@@ -74,22 +98,16 @@ func NewBackDownloader(cfg *config.Config, result *regist.RegisterResult) *BackD
 		URL:    cfg.URL,
 		Target: cfg.RV.RealTarget,
 		Md5:    cfg.Md5,
+		Digest: cfg.Digest,
 		TaskID: taskID,
 	}
 }
 
 // Run starts to download the file.
 func (bd *BackDownloader) Run(ctx context.Context) error {
-	var (
-		resp *http.Response
-		err  error
-		f    *os.File
-	)
-
 	if bd.cfg.Notbs || bd.cfg.BackSourceReason == config.BackSourceReasonNoSpace {
 		bd.cfg.BackSourceReason += config.ForceNotBackSourceAddition
-		err = fmt.Errorf("download fail and not back source: %d", bd.cfg.BackSourceReason)
-		return err
+		return fmt.Errorf("download fail and not back source: %d", bd.cfg.BackSourceReason)
 	}
 
 	printer.Printf("start download %s from the source station", filepath.Base(bd.Target))
@@ -97,37 +115,335 @@ func (bd *BackDownloader) Run(ctx context.Context) error {
 
 	defer bd.Cleanup()
 
-	prefix := "backsource." + bd.cfg.Sign + "."
-	if f, err = ioutil.TempFile(filepath.Dir(bd.Target), prefix); err != nil {
+	if bd.cfg.RV.BlockDevice {
+		return bd.runDevice()
+	}
+
+	f, ck, err := bd.openTempFile()
+	if err != nil {
 		return err
 	}
-	bd.tempFileName = f.Name()
 	defer f.Close()
 
-	if resp, err = httputils.HTTPGetWithTLS(bd.URL, netutils.ConvertHeaders(bd.cfg.Header), 0, bd.cfg.Cacerts, bd.cfg.Insecure); err != nil {
+	// the md5 of the existing target copied is calculated from the temp file at last
+	md5FromFile := bd.Md5 != "" && ck.Offset > 0 && ck.md5sum == nil
+	segmented := false
+	if ck.Offset == 0 && bd.cfg.BackSourceSegments > 1 && !hasRangeHeader(netutils.ConvertHeaders(bd.cfg.Header)) {
+		if segmented, err = bd.downloadSegments(f); segmented && err != nil {
+			if errortypes.IsSizeLimitExceeded(err) {
+				return err
+			}
+			logrus.Warnf("failed to download %s by segments, download it in a single stream: %v", bd.Target, err)
+			if err = resetFile(f); err != nil {
+				return err
+			}
+			segmented = false
+		}
+	}
+	if segmented {
+		// the segments are written out of order, so the md5 is calculated from the temp file
+		md5FromFile = bd.Md5 != ""
+	} else if err = bd.downloadResumable(f, ck, &md5FromFile); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if !bd.isSuccessStatus(resp.StatusCode) {
-		return fmt.Errorf("failed to download from source, response code:%d", resp.StatusCode)
+	realMd5 := ""
+	if ck.md5sum != nil {
+		realMd5 = fileutils.GetMd5Sum(ck.md5sum, nil)
+	}
+	// the md5 calculated from the temp file is verified with the other digests in a single pass
+	digests := bd.otherDigests()
+	if md5FromFile {
+		digests = append(digests, digest.String(digest.AlgorithmMD5, bd.Md5))
+	} else if bd.Md5 != "" && bd.Md5 != realMd5 {
+		err = errors.Wrapf(errortypes.ErrDigestMismatch, "md5 not match, expected:%s real:%s", bd.Md5, realMd5)
 	}
+	if err == nil {
+		err = downloader.VerifyDigests(bd.tempFileName, digests...)
+	}
+	if err != nil {
+		downloader.HandleVerifyFailure(bd.cfg, bd.tempFileName, config.PatternSource, err)
+		return err
+	}
+	return downloader.MoveFile(bd.tempFileName, bd.Target, "")
+}
 
-	buf := make([]byte, 512*1024)
-	reader := limitreader.NewLimitReader(resp.Body, int64(bd.cfg.LocalLimit), bd.Md5 != "")
-	if _, err = io.CopyBuffer(f, reader, buf); err != nil {
+// downloadResumable downloads the rest of the file after the offset of the checkpoint
+// in a single stream, and resumes it with the BackSourceResume policy after it's interrupted.
+func (bd *BackDownloader) downloadResumable(f *os.File, ck *checkpoint, md5FromFile *bool) error {
+	attempts := 0
+	err := bd.cfg.BackSourceResume.Do(func(attempt int) error {
+		attempts = attempt
+		if attempt > 1 {
+			atomic.AddInt64(&bd.cfg.RV.Retries, 1)
+			printer.Printf("resume downloading %s from %d bytes (%d/%d)", filepath.Base(bd.Target),
+				ck.Offset, attempt, bd.cfg.BackSourceResume.MaxAttempts)
+		}
+		e := bd.download(f, ck, md5FromFile)
+		if e == nil {
+			return nil
+		}
+		if !bd.resumable(ck, e) {
+			return retry.Stop(e)
+		}
+		if attempt < bd.cfg.BackSourceResume.MaxAttempts {
+			logrus.Warnf("failed to download %s from source at %d bytes (%d/%d): %v",
+				bd.Target, ck.Offset, attempt, bd.cfg.BackSourceResume.MaxAttempts, e)
+			bd.cfg.RV.EventLog.Record(config.EventRetry, "", "", e.Error())
+		}
+		return e
+	})
+	if err != nil {
+		if bd.cfg.IfExists == config.IfExistsResume && bd.resumable(ck, err) && ck.validator() != "" && ck.Offset > 0 {
+			// keep the temp file for the next dfget to resume from
+			if e := bd.saveCheckpoint(ck); e == nil {
+				bd.keepTempFile = true
+				printer.Printf("downloaded %d bytes of %s is kept to be resumed", ck.Offset, filepath.Base(bd.Target))
+			}
+		}
 		return err
 	}
+	if attempts > 1 {
+		logrus.Infof("download %s from source successfully after %d attempts", bd.Target, attempts)
+	}
+	return nil
+}
 
-	realMd5 := reader.Md5()
-	if bd.Md5 == "" || bd.Md5 == realMd5 {
-		err = downloader.MoveFile(bd.tempFileName, bd.Target, "")
+// openTempFile opens the temp file to write the file downloaded from the source station.
+// If the download is resumed, it takes over the temp file and the checkpoint of the same
+// download left by the last dfget if there's one, or copies the existing target into it.
+// The returned checkpoint tells how many bytes have been written.
+func (bd *BackDownloader) openTempFile() (*os.File, *checkpoint, error) {
+	tempDir := bd.cfg.RV.TempDir
+	if tempDir == "" {
+		tempDir = filepath.Dir(bd.Target)
+	}
+	url := bd.cfg.RV.TaskURL
+	if url == "" {
+		url = bd.URL
+	}
+	key := checkpointKey(url, bd.Target)
+	bd.tempFileName = filepath.Join(tempDir, config.TempFilePrefix(bd.cfg.Sign, config.TempKindBackSource)+key)
+	bd.checkpointFile = bd.tempFileName + checkpointSuffix
+
+	var ck *checkpoint
+	if bd.cfg.IfExists == config.IfExistsResume && !hasRangeHeader(netutils.ConvertHeaders(bd.cfg.Header)) {
+		ck = takeOverCheckpoint(tempDir, key, url, bd.tempFileName)
+	}
+	f, err := os.OpenFile(bd.tempFileName, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ck != nil {
+		if err = f.Truncate(ck.Offset); err == nil {
+			_, err = f.Seek(ck.Offset, io.SeekStart)
+		}
+		if err == nil {
+			printer.Printf("resume downloading %s from %d bytes left by the last download", filepath.Base(bd.Target), ck.Offset)
+			logrus.Infof("resume downloading %s from the checkpoint at %d bytes", bd.Target, ck.Offset)
+			return f, ck, nil
+		}
+		logrus.Warnf("failed to resume from the temp file %s: %v", bd.tempFileName, err)
+	}
+
+	ck = &checkpoint{URL: url, FileLength: -1}
+	ck.reset(bd.Md5 != "")
+	if err = resetFile(f); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if bd.cfg.IfExists == config.IfExistsResume {
+		if ck.Offset = bd.copyExisting(f); ck.Offset > 0 {
+			ck.md5sum = nil
+		}
+	}
+	return f, ck, nil
+}
+
+// download downloads the rest of the file after the offset of the checkpoint into f,
+// and the checkpoint is updated as the bytes are written. The file is downloaded from
+// the beginning if the source station doesn't support resuming or the file has changed.
+func (bd *BackDownloader) download(f *os.File, ck *checkpoint, md5FromFile *bool) error {
+	resp, err := bd.get(ck.Offset, ck.validator())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if ck.Offset > 0 && !ck.matches(resp) {
+		logrus.Infof("source doesn't support resuming or the file has changed, download %s from the beginning", bd.Target)
+		if resp.StatusCode == http.StatusPartialContent {
+			resp.Body.Close()
+			if resp, err = bd.get(0, ""); err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+		}
+		if err = resetFile(f); err != nil {
+			return err
+		}
+		ck.reset(bd.Md5 != "")
+		*md5FromFile = false
+	}
+	if ck.Offset == 0 {
+		ck.update(resp)
 	} else {
-		err = fmt.Errorf("md5 not match, expected:%s real:%s", bd.Md5, realMd5)
+		logrus.Infof("resume downloading %s from %d bytes", bd.Target, ck.Offset)
+	}
+	expected := ck.FileLength
+	if expected < 0 && resp.ContentLength >= 0 {
+		expected = ck.Offset + resp.ContentLength
+	}
+
+	reader := limitreader.NewLimitReaderWithMD5Sum(resp.Body, int64(bd.cfg.LocalLimit), ck.md5sum)
+	w := &checkpointWriter{f: f, ck: ck, reader: reader, save: bd.saveCheckpoint}
+	_, err = bd.copy(w, reader, resp.ContentLength)
+	err = checkLength(ck.Offset, expected, err)
+	if w.err != nil {
+		// the bytes recorded by the checkpoint can't be trusted after failing to write
+		ck.broken = true
+	} else if err != nil {
+		var e error
+		if ck.Md5State, e = reader.Md5State(); e != nil {
+			ck.broken = true
+		}
+	}
+	return err
+}
+
+// resumable reports whether the download could be resumed from the checkpoint after it fails with err.
+// A truncated response is resumed even if the source station doesn't return any validator,
+// since the rest of the file is requested right away, and it's still checked against the
+// length of the file and the md5 if any.
+func (bd *BackDownloader) resumable(ck *checkpoint, err error) bool {
+	return !ck.broken && (ck.validator() != "" || errortypes.IsTruncated(err)) &&
+		!errortypes.IsSizeLimitExceeded(err) && !hasRangeHeader(netutils.ConvertHeaders(bd.cfg.Header))
+}
+
+// checkLength returns ErrTruncated if the received bytes are fewer than the expected ones,
+// whether the source station closes the connection before sending the Content-Length or
+// ends the response early without any. The expected length < 0 means unknown.
+func checkLength(received, expected int64, err error) error {
+	if expected < 0 || received >= expected {
+		return err
+	}
+	if err == nil || errors.Cause(err) == io.ErrUnexpectedEOF {
+		return errors.Wrapf(errortypes.ErrTruncated, "received %d of %d bytes from source", received, expected)
+	}
+	return err
+}
+
+func (bd *BackDownloader) saveCheckpoint(ck *checkpoint) error {
+	if err := ck.save(bd.checkpointFile); err != nil {
+		logrus.Warnf("failed to save the checkpoint %s: %v", bd.checkpointFile, err)
+		return err
+	}
+	return nil
+}
+
+// copyExisting copies the existing target into the temp file to resume the download
+// from its end, and returns the number of bytes copied. Nothing is copied if the
+// requested range is specified by user.
+func (bd *BackDownloader) copyExisting(f *os.File) int64 {
+	if hasRangeHeader(netutils.ConvertHeaders(bd.cfg.Header)) || !fileutils.IsRegularFile(bd.Target) {
+		return 0
+	}
+	src, err := os.Open(bd.Target)
+	if err != nil {
+		logrus.Warnf("failed to open the existing target %s to resume: %v", bd.Target, err)
+		return 0
+	}
+	defer src.Close()
+
+	n, err := io.Copy(f, src)
+	if err != nil {
+		logrus.Warnf("failed to copy the existing target %s to resume: %v", bd.Target, err)
+		if err = resetFile(f); err != nil {
+			logrus.Warnf("failed to reset the temp file %s: %v", f.Name(), err)
+		}
+		return 0
+	}
+	return n
+}
+
+// resetFile truncates the file and rewinds it to the beginning.
+func resetFile(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
 	}
+	_, err := f.Seek(0, io.SeekStart)
 	return err
 }
 
+// runDevice writes the file from the source station to the block device in place,
+// and verifies the data by re-reading the device.
+func (bd *BackDownloader) runDevice() error {
+	f, err := os.OpenFile(bd.Target, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	resp, err := bd.get(0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the md5 is always computed to verify the data written to the device
+	reader := limitreader.NewLimitReader(resp.Body, int64(bd.cfg.LocalLimit), true)
+	n, err := bd.copy(f, reader, resp.ContentLength)
+	if err = checkLength(n, resp.ContentLength, err); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+
+	realMd5 := reader.Md5()
+	if bd.Md5 != "" && bd.Md5 != realMd5 {
+		return errors.Wrapf(errortypes.ErrDigestMismatch, "md5 not match, expected:%s real:%s", bd.Md5, realMd5)
+	}
+	// the digest is verified against the data re-read from the device,
+	// which is the same as the one downloaded if it matches the md5
+	return downloader.VerifyDevice(bd.Target, n, realMd5, "", bd.otherDigests()...)
+}
+
+// otherDigests returns the expected digests other than the md5 ones,
+// since the md5 is verified while the file is downloaded.
+func (bd *BackDownloader) otherDigests() []string {
+	var digests []string
+	for _, d := range append([]string{bd.Digest}, bd.cfg.Digests...) {
+		if algo, _, err := digest.Parse(d); d != "" && (err != nil || algo != digest.AlgorithmMD5) {
+			digests = append(digests, d)
+		}
+	}
+	return digests
+}
+
+func (bd *BackDownloader) copy(dst io.Writer, reader io.Reader, contentLength int64) (int64, error) {
+	buf := make([]byte, 512*1024)
+	reader = limitreader.NewSizeLimitReader(reader, bd.sizeLimit(contentLength))
+	n, err := io.CopyBuffer(dst, printer.NewProgressReader(reader, contentLength), buf)
+	printer.FinishProgress()
+	atomic.AddInt64(bd.counter(), n)
+	return n, err
+}
+
+func (bd *BackDownloader) counter() *int64 {
+	if bd.Counter != nil {
+		return bd.Counter
+	}
+	return &bd.cfg.RV.SourceBytes
+}
+
+// sizeLimit returns the max number of the bytes read from the response of the source station
+// whose content length is contentLength.
+func (bd *BackDownloader) sizeLimit(contentLength int64) int64 {
+	return limitreader.SizeLimit(contentLength, bd.cfg.DownloadSizeMargin, int64(bd.cfg.MaxDownloadSize))
+}
+
 // RunStream returns a io.Reader without any disk io.
 func (bd *BackDownloader) RunStream(ctx context.Context) (io.Reader, error) {
 	var (
@@ -141,16 +457,110 @@ func (bd *BackDownloader) RunStream(ctx context.Context) (io.Reader, error) {
 		return nil, err
 	}
 
-	if resp, err = httputils.HTTPGetWithTLS(bd.URL, netutils.ConvertHeaders(bd.cfg.Header), 0, bd.cfg.Cacerts, bd.cfg.Insecure); err != nil {
+	if resp, err = bd.get(0, ""); err != nil {
+		return nil, err
+	}
+
+	algo, expected := bd.streamDigest()
+	body := limitreader.NewSizeLimitReader(resp.Body, bd.sizeLimit(resp.ContentLength))
+	limitReader := limitreader.NewLimitReaderWithDigest(body, int64(bd.cfg.LocalLimit), algo)
+	return &autoCloseLimitReader{closer: resp.Body, limitReader: limitReader, digest: expected}, nil
+}
+
+// RunStreamRange returns a reader of the length bytes of the file from the offset without any disk io.
+// The range is requested from the source station, and the whole file is read and the bytes before
+// the offset are discarded if it doesn't support the range request. The digest is verified only if
+// the whole file is read.
+func (bd *BackDownloader) RunStreamRange(ctx context.Context, offset, length int64) (*downloader.RangeReader, error) {
+	if bd.cfg.Notbs || bd.cfg.BackSourceReason == config.BackSourceReasonNoSpace {
+		bd.cfg.BackSourceReason += config.ForceNotBackSourceAddition
+		return nil, fmt.Errorf("download fail and not back source: %d", bd.cfg.BackSourceReason)
+	}
+
+	resp, err := bd.getStreamRange(offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		skip     int64
+		total    int64 = -1
+		algo     string
+		expected string
+	)
+	if resp.StatusCode == http.StatusPartialContent {
+		// the total is unknown if it's responded as "*"
+		var start, end int64
+		n, _ := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		if n < 2 || start != offset {
+			resp.Body.Close()
+			return nil, fmt.Errorf("invalid content range: %s", resp.Header.Get("Content-Range"))
+		}
+		if n == 2 {
+			total = -1
+		}
+		if length < 0 {
+			length = end - start + 1
+		}
+	} else {
+		skip, total = offset, resp.ContentLength
+		if total > 0 && offset >= total {
+			resp.Body.Close()
+			return nil, errors.Wrapf(errortypes.ErrRangeNotSatisfiable, "offset %d of file length %d", offset, total)
+		}
+		algo, expected = bd.streamDigest()
+	}
+
+	body := limitreader.NewSizeLimitReader(resp.Body, bd.sizeLimit(resp.ContentLength))
+	limitReader := limitreader.NewLimitReaderWithDigest(body, int64(bd.cfg.LocalLimit), algo)
+	reader := &autoCloseLimitReader{closer: resp.Body, limitReader: limitReader, digest: expected}
+	return downloader.NewRangeReader(reader, skip, offset, length, total, resp.Body.Close), nil
+}
+
+// getStreamRange requests the length bytes of the file from the offset, it's requested to the end
+// of the file if the length is negative. The response of the whole file is also acceptable
+// if the source doesn't support the range request.
+func (bd *BackDownloader) getStreamRange(offset, length int64) (*http.Response, error) {
+	client, err := bd.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := httputils.WithTaskHeader(netutils.ConvertHeaders(bd.cfg.Header), bd.TaskID)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	if length < 0 {
+		headers[config.StrRange] = fmt.Sprintf("%s=%d-", config.StrBytes, offset)
+	} else {
+		headers[config.StrRange] = fmt.Sprintf("%s=%d-%d", config.StrBytes, offset, offset+length-1)
+	}
+	resp, err := client.Do(http.MethodGet, bd.URL, headers, 0)
+	if err != nil {
 		return nil, err
 	}
 
-	if !bd.isSuccessStatus(resp.StatusCode) {
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		resp.Body.Close()
+		return nil, errors.Wrapf(errortypes.ErrRangeNotSatisfiable, "range %s", headers[config.StrRange])
+	}
+	if resp.StatusCode != http.StatusPartialContent && !bd.isSuccessStatus(resp.StatusCode, nil) {
+		resp.Body.Close()
 		return nil, fmt.Errorf("failed to download from source, response code:%d", resp.StatusCode)
 	}
+	return resp, nil
+}
 
-	limitReader := limitreader.NewLimitReader(resp.Body, int64(bd.cfg.LocalLimit), bd.Md5 != "")
-	return &autoCloseLimitReader{closer: resp.Body, limitReader: limitReader, md5: bd.Md5}, nil
+// streamDigest returns the algorithm and the expected digest verified when the file
+// is read in stream. The Digest is preferred to the Md5 unless it's an md5 one.
+func (bd *BackDownloader) streamDigest() (algo, expected string) {
+	if algo, encoded, err := digest.Parse(bd.Digest); err == nil && algo != digest.AlgorithmMD5 {
+		return algo, digest.String(algo, encoded)
+	}
+	if bd.Md5 != "" {
+		return digest.AlgorithmMD5, digest.String(digest.AlgorithmMD5, strings.ToLower(bd.Md5))
+	}
+	return "", ""
 }
 
 // Cleanup clean all temporary resources generated by executing Run.
@@ -159,21 +569,123 @@ func (bd *BackDownloader) Cleanup() {
 		return
 	}
 
-	if !stringutils.IsEmptyStr(bd.tempFileName) {
+	bd.clientLock.Lock()
+	if bd.client != nil {
+		bd.client.CloseIdleConnections()
+		bd.client = nil
+	}
+	bd.clientLock.Unlock()
+
+	if !stringutils.IsEmptyStr(bd.tempFileName) && !bd.keepTempFile {
 		fileutils.DeleteFile(bd.tempFileName)
+		fileutils.DeleteFile(bd.checkpointFile)
 	}
 	bd.cleaned = true
 }
 
-func (bd *BackDownloader) isSuccessStatus(code int) bool {
-	return code < 400
+// get sends the request to the source station and checks the status code
+// of the final response after following the redirects.
+// The data is requested from the offset if it's positive, and the response
+// of the whole file is also acceptable if the source doesn't support the range request,
+// or the file doesn't match the validator which is the ETag or Last-Modified of the file.
+func (bd *BackDownloader) get(offset int64, validator string) (*http.Response, error) {
+	client, err := bd.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := httputils.WithTaskHeader(netutils.ConvertHeaders(bd.cfg.Header), bd.TaskID)
+	if offset > 0 {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[config.StrRange] = fmt.Sprintf("%s=%d-", config.StrBytes, offset)
+		if validator != "" {
+			headers["If-Range"] = validator
+		}
+	}
+	resp, err := client.Do(http.MethodGet, bd.URL, headers, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// the existing target may be complete or longer than the file, download it again
+		resp.Body.Close()
+		return bd.get(0, "")
+	}
+
+	if !bd.isSuccessStatus(resp.StatusCode, headers) && !(offset > 0 && bd.isSuccessStatus(resp.StatusCode, nil)) {
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" {
+			return nil, fmt.Errorf("failed to download from source, response code:%d location:%s",
+				resp.StatusCode, location)
+		}
+		return nil, fmt.Errorf("failed to download from source, response code:%d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// newClient returns the client sending the requests to the source station, which follows
+// the redirects and retries the failed requests according to the config. It's created
+// once for the download, so the connections are reused by the requests of the segments.
+func (bd *BackDownloader) newClient() (*httputils.Client, error) {
+	bd.clientLock.Lock()
+	defer bd.clientLock.Unlock()
+	if bd.client != nil {
+		return bd.client, nil
+	}
+	tlsConfig, err := httputils.GetTLSConfigFromFiles(bd.cfg.Cacerts, bd.cfg.Insecure)
+	if err != nil {
+		return nil, err
+	}
+	maxRedirects := bd.cfg.BackSourceMaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = config.DefaultBackSourceMaxRedirects
+	}
+	// the failed requests and the 5xx responses are retried with the retry policy
+	retryPolicy := &httputils.RetryPolicy{
+		MaxAttempts: bd.cfg.Retry.MaxAttempts,
+		BackoffFunc: bd.cfg.Retry.Backoff,
+	}
+	bd.client = httputils.NewClient(httputils.WithTLSConfig(tlsConfig), httputils.WithMaxRedirects(maxRedirects),
+		httputils.WithRetryPolicy(retryPolicy))
+	return bd.client, nil
+}
+
+// isSuccessStatus reports whether the code is acceptable. Only 206 is acceptable
+// for the ranged request, otherwise the code must be one of the BackSourceStatus.
+func (bd *BackDownloader) isSuccessStatus(code int, headers map[string]string) bool {
+	if hasRangeHeader(headers) {
+		return code == http.StatusPartialContent
+	}
+
+	expected := bd.cfg.BackSourceStatus
+	if len(expected) == 0 {
+		expected = config.DefaultBackSourceStatus
+	}
+	for _, c := range expected {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRangeHeader(headers map[string]string) bool {
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == config.StrRange {
+			return true
+		}
+	}
+	return false
 }
 
 // autoCloseLimitReader will auto close when reader return a error(include io.EOF).
 // it is necessary when return http.Response.Body as an io.Reader.
 type autoCloseLimitReader struct {
 	closer      io.Closer
-	md5         string
+	digest      string
 	limitReader *limitreader.LimitReader
 }
 
@@ -185,11 +697,11 @@ func (a *autoCloseLimitReader) Read(p []byte) (n int, err error) {
 			err = errors.Wrapf(err, "close error: %s", closeError)
 		}
 	}
-	// all data received, calculate md5
-	if err == io.EOF && a.md5 != "" {
-		realMd5 := a.limitReader.Md5()
-		if realMd5 != a.md5 {
-			return n, fmt.Errorf("md5 not match, expected: %s real: %s", a.md5, realMd5)
+	// all data received, calculate the digest
+	if err == io.EOF && a.digest != "" {
+		realDigest := a.limitReader.Digest()
+		if realDigest != a.digest {
+			return n, errors.Wrapf(errortypes.ErrDigestMismatch, "digest not match, expected: %s real: %s", a.digest, realDigest)
 		}
 	}
 	return n, err
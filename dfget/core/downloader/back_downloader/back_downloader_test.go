@@ -18,19 +18,32 @@ package downloader
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
+	"github.com/dragonflyoss/Dragonfly/pkg/sourceprotocol"
 
 	"github.com/go-check/check"
 )
@@ -87,6 +100,7 @@ func (s *BackDownloaderTestSuite) TestBackDownloader_Run(c *check.C) {
 	cfg.BackSourceReason = 0
 	bd.cleaned = false
 	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	c.Assert(cfg.RV.SourceBytes, check.Equals, int64(len("test downloader")))
 
 	bd.cleaned = false
 	bd.Md5 = testFileMd5
@@ -103,6 +117,297 @@ func (s *BackDownloaderTestSuite) TestBackDownloader_Run(c *check.C) {
 	c.Assert(bd.Run(context.TODO()), check.IsNil)
 }
 
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunWithWorkDir(c *check.C) {
+	testFileMd5 := helper.CreateTestFileWithMD5(filepath.Join(s.workHome, "download.test"), "test downloader")
+	dst := filepath.Join(s.workHome, "back.workdir.test")
+	workDir := filepath.Join(s.workHome, "workdir")
+	c.Assert(os.MkdirAll(workDir, 0755), check.IsNil)
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.RV.TempDir = workDir
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    "http://" + s.host + "/download.test",
+		Target: dst,
+		Md5:    testFileMd5,
+	}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	c.Check(fileutils.Md5Sum(dst), check.Equals, testFileMd5)
+
+	files, err := ioutil.ReadDir(workDir)
+	c.Assert(err, check.IsNil)
+	c.Check(files, check.HasLen, 0)
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunResume(c *check.C) {
+	testFileMd5 := helper.CreateTestFileWithMD5(filepath.Join(s.workHome, "download.test"), "test downloader")
+	dst := filepath.Join(s.workHome, "back.resume.test")
+	c.Assert(ioutil.WriteFile(dst, []byte("test down"), 0644), check.IsNil)
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.IfExists = config.IfExistsResume
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    "http://" + s.host + "/download.test",
+		Target: dst,
+		Md5:    testFileMd5,
+	}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	c.Check(fileutils.Md5Sum(dst), check.Equals, testFileMd5)
+
+	// the existing target is complete
+	bd.cleaned = false
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	c.Check(fileutils.Md5Sum(dst), check.Equals, testFileMd5)
+
+	// the existing target doesn't match
+	c.Assert(ioutil.WriteFile(dst, []byte("text"), 0644), check.IsNil)
+	bd.cleaned = false
+	c.Check(bd.Run(context.TODO()), check.NotNil)
+}
+
+// newInterruptedServer returns a server of the content with the etag, which aborts
+// the first response after sending half of the content.
+func newInterruptedServer(content string, etag *string, ranges *[]string) *httptest.Server {
+	interrupted := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range")+";"+r.Header.Get("If-Range"))
+		w.Header().Set("ETag", *etag)
+		if !interrupted {
+			interrupted = true
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content[:len(content)/2]))
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunResumeInterrupted(c *check.C) {
+	content := strings.Repeat("resume ", 1024)
+	etag := `"v1"`
+	var ranges []string
+	ts := newInterruptedServer(content, &etag, &ranges)
+	defer ts.Close()
+	dst := filepath.Join(s.workHome, "interrupted.test")
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.BackSourceResume = retry.Policy{MaxAttempts: 2}
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    ts.URL,
+		Target: dst,
+		Md5:    fmt.Sprintf("%x", md5.Sum([]byte(content))),
+	}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	c.Check(fileutils.Md5Sum(dst), check.Equals, bd.Md5)
+	c.Check(ranges, check.DeepEquals, []string{";", fmt.Sprintf("bytes=%d-;%s", len(content)/2, etag)})
+	c.Check(cfg.RV.Retries, check.Equals, int64(1))
+}
+
+// newTruncatingServer returns a server of the content without any validator, which closes
+// the first truncations responses after sending half of the requested bytes.
+func newTruncatingServer(content string, truncations int, ranges *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		if len(*ranges) > truncations {
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+			return
+		}
+		start := 0
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)-start))
+		if start > 0 {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write([]byte(content[start : start+(len(content)-start)/2]))
+		panic(http.ErrAbortHandler)
+	}))
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunTruncated(c *check.C) {
+	content := strings.Repeat("truncated ", 1024)
+	var ranges []string
+	ts := newTruncatingServer(content, 2, &ranges)
+	defer ts.Close()
+	dst := filepath.Join(s.workHome, "truncated.test")
+
+	// the truncated responses are resumed from the received bytes even without any validator
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.BackSourceResume = retry.Policy{MaxAttempts: 3}
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    ts.URL,
+		Target: dst,
+		Md5:    fmt.Sprintf("%x", md5.Sum([]byte(content))),
+	}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	c.Check(fileutils.Md5Sum(dst), check.Equals, bd.Md5)
+	half := len(content) / 2
+	c.Check(ranges, check.DeepEquals, []string{"",
+		fmt.Sprintf("bytes=%d-", half),
+		fmt.Sprintf("bytes=%d-", half+(len(content)-half)/2)})
+
+	// it fails after the retry budget, and nothing is moved into place
+	ranges = nil
+	ts2 := newTruncatingServer(content, 2, &ranges)
+	defer ts2.Close()
+	dst = filepath.Join(s.workHome, "truncated2.test")
+	cfg = helper.CreateConfig(nil, s.workHome)
+	cfg.BackSourceResume = retry.Policy{MaxAttempts: 2}
+	bd = &BackDownloader{cfg: cfg, URL: ts2.URL, Target: dst}
+	err := bd.Run(context.TODO())
+	c.Check(errortypes.IsTruncated(err), check.Equals, true)
+	c.Check(fileutils.PathExist(dst), check.Equals, false)
+}
+
+func (s *BackDownloaderTestSuite) TestCheckLength(c *check.C) {
+	c.Check(checkLength(10, 10, nil), check.IsNil)
+	c.Check(checkLength(10, -1, nil), check.IsNil)
+	c.Check(errortypes.IsTruncated(checkLength(5, 10, nil)), check.Equals, true)
+	c.Check(errortypes.IsTruncated(checkLength(5, 10, io.ErrUnexpectedEOF)), check.Equals, true)
+	other := fmt.Errorf("write failed")
+	c.Check(checkLength(5, 10, other), check.Equals, other)
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunResumeCheckpoint(c *check.C) {
+	content := strings.Repeat("checkpoint ", 1024)
+	etag := `"v1"`
+	var ranges []string
+	ts := newInterruptedServer(content, &etag, &ranges)
+	defer ts.Close()
+	dir := filepath.Join(s.workHome, "checkpoint")
+	c.Assert(os.MkdirAll(dir, 0755), check.IsNil)
+	dst := filepath.Join(dir, "checkpoint.test")
+	expectedMd5 := fmt.Sprintf("%x", md5.Sum([]byte(content)))
+
+	newBackDownloader := func() *BackDownloader {
+		cfg := helper.CreateConfig(nil, s.workHome)
+		cfg.IfExists = config.IfExistsResume
+		return &BackDownloader{cfg: cfg, URL: ts.URL, Target: dst, Md5: expectedMd5}
+	}
+
+	// the temp file and the checkpoint are kept after the download fails
+	c.Assert(newBackDownloader().Run(context.TODO()), check.NotNil)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 2)
+
+	// the next download resumes from them
+	c.Assert(newBackDownloader().Run(context.TODO()), check.IsNil)
+	c.Check(fileutils.Md5Sum(dst), check.Equals, expectedMd5)
+	c.Check(ranges[1], check.Equals, fmt.Sprintf("bytes=%d-;%s", len(content)/2, etag))
+	files, err = ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Check(files, check.HasLen, 1)
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunResumeChanged(c *check.C) {
+	content := strings.Repeat("changed ", 1024)
+	etag := `"v1"`
+	var ranges []string
+	ts := newInterruptedServer(content, &etag, &ranges)
+	defer ts.Close()
+	dir := filepath.Join(s.workHome, "changed")
+	c.Assert(os.MkdirAll(dir, 0755), check.IsNil)
+	dst := filepath.Join(dir, "changed.test")
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.IfExists = config.IfExistsResume
+	bd := &BackDownloader{cfg: cfg, URL: ts.URL, Target: dst}
+	c.Assert(bd.Run(context.TODO()), check.NotNil)
+
+	// the whole file is downloaded again since it has changed
+	etag = `"v2"`
+	bd = &BackDownloader{cfg: cfg, URL: ts.URL, Target: dst}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	data, err := ioutil.ReadFile(dst)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, content)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Check(files, check.HasLen, 1)
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunSegments(c *check.C) {
+	content := strings.Repeat("s", 3*int(config.MinBackSourceSegmentSize)+100)
+	var (
+		mu          sync.Mutex
+		ranges      []string
+		interrupted bool
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range")+";"+r.Header.Get("If-Range"))
+		interrupt := !interrupted && strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") && r.Header.Get("If-Range") != ""
+		interrupted = interrupted || interrupt
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if interrupt {
+			// abort the first segment after sending a part of it
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)/3-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[:1024]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+	dst := filepath.Join(s.workHome, "segments.test")
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.BackSourceSegments = 4
+	cfg.BackSourceResume = retry.Policy{MaxAttempts: 2}
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    ts.URL,
+		Target: dst,
+		Md5:    fmt.Sprintf("%x", md5.Sum([]byte(content))),
+	}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	c.Check(fileutils.Md5Sum(dst), check.Equals, bd.Md5)
+	c.Check(cfg.RV.SourceBytes, check.Equals, int64(len(content)))
+	c.Check(cfg.RV.Retries, check.Equals, int64(1))
+
+	// the file is split into 3 segments since each one is at least MinBackSourceSegmentSize,
+	// and the first one is resumed after the first 1024 bytes
+	size := len(content) / 3
+	expected := []string{
+		"bytes=0-0;",
+		fmt.Sprintf("bytes=0-%d;\"v1\"", size-1),
+		fmt.Sprintf("bytes=1024-%d;\"v1\"", size-1),
+		fmt.Sprintf("bytes=%d-%d;\"v1\"", size, 2*size-1),
+		fmt.Sprintf("bytes=%d-%d;\"v1\"", 2*size, len(content)-1),
+	}
+	sort.Strings(ranges)
+	sort.Strings(expected)
+	c.Check(ranges, check.DeepEquals, expected)
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunSegmentsUnsupported(c *check.C) {
+	content := strings.Repeat("u", 2*int(config.MinBackSourceSegmentSize))
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Write([]byte(content))
+	}))
+	defer ts.Close()
+	dst := filepath.Join(s.workHome, "segments.unsupported.test")
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.BackSourceSegments = 2
+	bd := &BackDownloader{cfg: cfg, URL: ts.URL, Target: dst}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	data, err := ioutil.ReadFile(dst)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data) == content, check.Equals, true)
+	// the file is downloaded in a single stream after probing
+	c.Check(ranges, check.DeepEquals, []string{"bytes=0-0", ""})
+}
+
 func (s *BackDownloaderTestSuite) TestBackDownloader_RunStream(c *check.C) {
 	testFileMd5 := helper.CreateTestFileWithMD5(filepath.Join(s.workHome, "download.test"), "test downloader")
 	dst := filepath.Join(s.workHome, "back.test")
@@ -147,6 +452,96 @@ func (s *BackDownloaderTestSuite) TestBackDownloader_RunStream(c *check.C) {
 		_, err = ioutil.ReadAll(reader)
 	}
 	c.Assert(err, check.IsNil)
+
+	// test: the sha256 digest is verified instead of the md5
+	bd.Md5 = "x"
+	bd.Digest = "sha256:" + digest.Sha256("test downloader")
+	reader, err = bd.RunStream(context.TODO())
+	c.Assert(err, check.IsNil)
+	_, err = ioutil.ReadAll(reader)
+	c.Assert(err, check.IsNil)
+
+	bd.Digest = "sha256:" + digest.Sha256("test")
+	reader, err = bd.RunStream(context.TODO())
+	c.Assert(err, check.IsNil)
+	_, err = ioutil.ReadAll(reader)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunStreamRange(c *check.C) {
+	content := "test stream range"
+	testFileMd5 := helper.CreateTestFileWithMD5(filepath.Join(s.workHome, "range.test"), content)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the range request isn't supported
+		w.Write([]byte(content))
+	}))
+	defer ts.Close()
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	bd := &BackDownloader{cfg: cfg, URL: "http://" + s.host + "/range.test", Md5: "x"}
+
+	reader, err := bd.RunStreamRange(context.TODO(), 5, 6)
+	c.Assert(err, check.IsNil)
+	c.Check(reader.Total, check.Equals, int64(len(content)))
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "stream")
+	reader.Close()
+
+	reader, err = bd.RunStreamRange(context.TODO(), 12, -1)
+	c.Assert(err, check.IsNil)
+	c.Check(reader.Length, check.Equals, int64(5))
+	data, err = ioutil.ReadAll(reader)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "range")
+
+	_, err = bd.RunStreamRange(context.TODO(), 100, -1)
+	c.Check(errortypes.IsRangeNotSatisfiable(err), check.Equals, true)
+
+	// the bytes before the offset are discarded, and the digest is verified
+	// only if the whole file is read
+	bd.URL = ts.URL
+	reader, err = bd.RunStreamRange(context.TODO(), 5, 6)
+	c.Assert(err, check.IsNil)
+	data, err = ioutil.ReadAll(reader)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "stream")
+
+	reader, err = bd.RunStreamRange(context.TODO(), 5, -1)
+	c.Assert(err, check.IsNil)
+	_, err = ioutil.ReadAll(reader)
+	c.Check(err, check.NotNil)
+
+	bd.Md5 = testFileMd5
+	reader, err = bd.RunStreamRange(context.TODO(), 5, -1)
+	c.Assert(err, check.IsNil)
+	data, err = ioutil.ReadAll(reader)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "stream range")
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunDigest(c *check.C) {
+	content := "test digest"
+	c.Assert(ioutil.WriteFile(filepath.Join(s.workHome, "digest.test"), []byte(content), 0644), check.IsNil)
+	dst := filepath.Join(s.workHome, "back.digest.test")
+	sum := sha512.Sum512([]byte(content))
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    "http://" + s.host + "/digest.test",
+		Target: dst,
+		Digest: "sha512:" + strings.Repeat("0", 128),
+	}
+	c.Assert(bd.Run(context.TODO()), check.NotNil)
+	c.Check(fileutils.PathExist(dst), check.Equals, false)
+
+	bd.cleaned = false
+	bd.Digest = "sha512:" + hex.EncodeToString(sum[:])
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	data, err := ioutil.ReadFile(dst)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, content)
 }
 
 func (s *BackDownloaderTestSuite) TestBackDownloader_Run_NotExist(c *check.C) {
@@ -163,3 +558,110 @@ func (s *BackDownloaderTestSuite) TestBackDownloader_Run_NotExist(c *check.C) {
 	c.Check(err, check.NotNil)
 	c.Check(err, check.ErrorMatches, ".*404")
 }
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunSizeLimit(c *check.C) {
+	// the chunked response without Content-Length
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("size limit"))
+	}))
+	defer ts.Close()
+	dst := filepath.Join(s.workHome, "size.test")
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    ts.URL,
+		Target: dst,
+	}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+
+	cfg.MaxDownloadSize = 8
+	bd.cleaned = false
+	err := bd.Run(context.TODO())
+	c.Check(errortypes.IsSizeLimitExceeded(err), check.Equals, true)
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_RunSourceProtocol(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/dir/file" || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("test source protocol"))
+	}))
+	defer ts.Close()
+	c.Assert(sourceprotocol.Register(&sourceprotocol.Config{
+		S3: &sourceprotocol.S3Config{Endpoint: ts.URL, PathStyle: true, AccessKeyID: "id", SecretAccessKey: "secret"},
+	}), check.IsNil)
+	dst := filepath.Join(s.workHome, "s3.test")
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    "s3://bucket/dir/file",
+		Target: dst,
+	}
+	c.Assert(bd.Run(context.TODO()), check.IsNil)
+	content, err := ioutil.ReadFile(dst)
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, "test source protocol")
+
+	bd.cleaned = false
+	reader, err := bd.RunStream(context.TODO())
+	c.Assert(err, check.IsNil)
+	content, err = ioutil.ReadAll(reader)
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, "test source protocol")
+}
+
+func (s *BackDownloaderTestSuite) TestBackDownloader_Status(c *check.C) {
+	helper.CreateTestFileWithMD5(filepath.Join(s.workHome, "status.test"), "test status")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "http://"+s.host+"/status.test", http.StatusFound)
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	bd := &BackDownloader{
+		cfg:    cfg,
+		URL:    ts.URL + "/redirect",
+		Target: filepath.Join(s.workHome, "status.dst"),
+	}
+	c.Check(bd.Run(context.TODO()), check.IsNil)
+
+	cfg.BackSourceMaxRedirects = -1
+	bd.cleaned = false
+	c.Check(bd.Run(context.TODO()), check.ErrorMatches, ".*302 location:.*")
+
+	bd.URL = ts.URL + "/not-modified"
+	bd.cleaned = false
+	c.Check(bd.Run(context.TODO()), check.ErrorMatches, ".*304")
+
+	bd.URL = ts.URL + "/other"
+	bd.cleaned = false
+	c.Check(bd.Run(context.TODO()), check.ErrorMatches, ".*203")
+	cfg.BackSourceStatus = []int{http.StatusOK, http.StatusNonAuthoritativeInfo}
+	bd.cleaned = false
+	c.Check(bd.Run(context.TODO()), check.IsNil)
+
+	// only 206 is acceptable for the ranged request
+	bd.URL = "http://" + s.host + "/status.test"
+	cfg.Header = []string{"range: bytes=0-3"}
+	bd.cleaned = false
+	c.Check(bd.Run(context.TODO()), check.IsNil)
+	_, err := bd.RunStream(context.TODO())
+	c.Check(err, check.IsNil)
+	cfg.BackSourceStatus = nil
+	bd.URL = ts.URL + "/other"
+	_, err = bd.RunStream(context.TODO())
+	c.Check(err, check.ErrorMatches, ".*203")
+}
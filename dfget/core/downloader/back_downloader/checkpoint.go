@@ -0,0 +1,221 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// checkpointSuffix is the suffix of the checkpoint file of the temp file of back source.
+	checkpointSuffix = ".ckpt"
+
+	// checkpointInterval is the min interval of saving the checkpoint while downloading.
+	checkpointInterval = time.Second
+)
+
+// checkpoint records how much of the file has been written into the temp file
+// when downloading from the source station, so that the download could be resumed
+// from there after it's interrupted, even by another dfget process.
+type checkpoint struct {
+	URL string `json:"url"`
+
+	// Offset is the number of the bytes written into the temp file.
+	Offset int64 `json:"offset"`
+
+	// Md5State is the state of the md5 of the bytes written, it's empty
+	// if the md5 isn't calculated.
+	Md5State []byte `json:"md5State,omitempty"`
+
+	// ETag and LastModified are the validators of the file returned by the source station,
+	// which tell whether the file has changed since it's downloaded.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+
+	// FileLength is the length of the whole file, -1 means unknown.
+	FileLength int64 `json:"fileLength"`
+
+	// md5sum continues calculating the md5 of the bytes written.
+	md5sum hash.Hash
+
+	// broken means that the temp file doesn't match the checkpoint any more.
+	broken bool
+}
+
+// checkpointKey identifies the temp files of the download of the url to the target
+// among the dfget processes.
+func checkpointKey(url, target string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(url+"\n"+target)))[:16]
+}
+
+// validator returns the value of If-Range with which the file is requested from the offset,
+// and it's empty if the source station doesn't return any validator.
+func (ck *checkpoint) validator() string {
+	if ck.ETag != "" && !strings.HasPrefix(ck.ETag, "W/") {
+		return ck.ETag
+	}
+	return ck.LastModified
+}
+
+// update records the validators of the file from the response of the whole file.
+func (ck *checkpoint) update(resp *http.Response) {
+	ck.ETag = resp.Header.Get("ETag")
+	ck.LastModified = resp.Header.Get("Last-Modified")
+	ck.FileLength = resp.ContentLength
+}
+
+// matches reports whether the ranged response is the rest of the same file after the offset.
+func (ck *checkpoint) matches(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusPartialContent {
+		return false
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" && ck.ETag != "" && etag != ck.ETag {
+		return false
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" && ck.LastModified != "" && lm != ck.LastModified {
+		return false
+	}
+	var start, end, total int64
+	n, _ := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+	if n < 2 || start != ck.Offset {
+		return false
+	}
+	return n < 3 || ck.FileLength < 0 || total == ck.FileLength
+}
+
+// reset makes the download start from the beginning.
+func (ck *checkpoint) reset(calculateMd5 bool) {
+	ck.Offset = 0
+	ck.Md5State = nil
+	ck.md5sum = nil
+	if calculateMd5 {
+		ck.md5sum = md5.New()
+	}
+}
+
+func (ck *checkpoint) save(path string) error {
+	data, err := json.Marshal(ck)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// takeOverCheckpoint finds the temp file and the checkpoint of the download with the key left
+// by a dfget which has finished, and renames them to tempFile of this dfget.
+// It returns nil if there's none which could be resumed.
+func takeOverCheckpoint(dir, key, url, tempFile string) *checkpoint {
+	pattern := filepath.Join(dir, "dfget-*."+config.TempKindBackSource+"-"+key+checkpointSuffix)
+	paths, _ := filepath.Glob(pattern)
+	for _, path := range paths {
+		sign, _ := config.ParseTempFileName(filepath.Base(path))
+		// the ones of another running process may be being written
+		if pid, _, ok := config.ParseSign(sign); ok && pid != os.Getpid() && helper.ProcessAlive(pid) {
+			continue
+		}
+		dataFile := strings.TrimSuffix(path, checkpointSuffix)
+		ck, err := loadCheckpoint(path, dataFile, url)
+		if err != nil {
+			logrus.Infof("discard the checkpoint %s: %v", path, err)
+			os.Remove(path)
+			os.Remove(dataFile)
+			continue
+		}
+		if err = os.Rename(dataFile, tempFile); err != nil {
+			logrus.Warnf("failed to take over the temp file %s: %v", dataFile, err)
+			continue
+		}
+		os.Remove(path)
+		return ck
+	}
+	return nil
+}
+
+func loadCheckpoint(path, dataFile, url string) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ck := &checkpoint{}
+	if err = json.Unmarshal(data, ck); err != nil {
+		return nil, err
+	}
+	if ck.URL != url || ck.validator() == "" {
+		return nil, fmt.Errorf("not resumable")
+	}
+	info, err := os.Stat(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	// the bytes after the offset may be written without being recorded
+	if info.Size() < ck.Offset {
+		return nil, fmt.Errorf("temp file is shorter than %d bytes", ck.Offset)
+	}
+	if len(ck.Md5State) > 0 {
+		if ck.md5sum, err = limitreader.RestoreMd5(ck.Md5State); err != nil {
+			return nil, err
+		}
+	}
+	return ck, nil
+}
+
+// checkpointWriter writes the bytes read by the reader into the temp file, and updates
+// the checkpoint after they're written.
+type checkpointWriter struct {
+	f      *os.File
+	ck     *checkpoint
+	reader *limitreader.LimitReader
+	save   func(ck *checkpoint) error
+
+	lastSave time.Time
+	err      error
+}
+
+func (w *checkpointWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.ck.Offset += int64(n)
+	if err != nil {
+		w.err = err
+		return n, err
+	}
+	if time.Since(w.lastSave) < checkpointInterval || w.ck.validator() == "" {
+		return n, nil
+	}
+	// all the bytes read have been written, so the md5 state matches the offset
+	if w.ck.Md5State, err = w.reader.Md5State(); err != nil {
+		w.err = err
+		return n, err
+	}
+	w.lastSave = time.Now()
+	w.save(w.ck)
+	return n, nil
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var errSegmentAborted = errors.New("aborted since another segment failed")
+
+// segment is a range [start, end] of the file downloaded by one of the concurrent requests,
+// and written is the number of the bytes written from start.
+type segment struct {
+	start   int64
+	end     int64
+	written int64
+}
+
+// segments holds the states shared by the concurrent downloads of the segments.
+type segments struct {
+	f         *os.File
+	limiter   *ratelimiter.RateLimiter
+	validator string
+	total     int64
+
+	completed int64
+	failed    int32
+}
+
+// downloadSegments downloads the file into f with BackSourceSegments concurrent range requests,
+// all of which are limited by one rate limiter of LocalLimit. Each segment is resumed from
+// the bytes written with the BackSourceResume policy after it's interrupted.
+// It returns false if the file isn't downloaded by segments, such as the source doesn't
+// support the range requests, then the file should be downloaded in a single stream.
+func (bd *BackDownloader) downloadSegments(f *os.File) (bool, error) {
+	total, validator, err := bd.probeRange()
+	if err != nil {
+		logrus.Infof("download %s in a single stream: %v", bd.Target, err)
+		return false, nil
+	}
+	if limit := bd.sizeLimit(total); limit >= 0 && total > limit {
+		return false, nil
+	}
+	n := int64(bd.cfg.BackSourceSegments)
+	if max := total / int64(config.MinBackSourceSegmentSize); n > max {
+		n = max
+	}
+	if n <= 1 {
+		return false, nil
+	}
+	if err = f.Truncate(total); err != nil {
+		return true, err
+	}
+
+	s := &segments{
+		f:         f,
+		limiter:   ratelimiter.NewRateLimiter(ratelimiter.TransRate(int64(bd.cfg.LocalLimit)), 2),
+		validator: validator,
+		total:     total,
+	}
+	logrus.Infof("download %s of %d bytes in %d segments", bd.Target, total, n)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		size     = total / n
+	)
+	for i := int64(0); i < n; i++ {
+		seg := &segment{start: i * size, end: (i+1)*size - 1}
+		if i == n-1 {
+			seg.end = total - 1
+		}
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			if e := bd.downloadSegment(s, seg); e != nil {
+				atomic.StoreInt32(&s.failed, 1)
+				once.Do(func() { firstErr = e })
+			}
+		}(seg)
+	}
+	wg.Wait()
+	printer.FinishProgress()
+	atomic.AddInt64(bd.counter(), s.completed)
+	return true, firstErr
+}
+
+// downloadSegment downloads the segment, and resumes it from the bytes written after it's interrupted.
+func (bd *BackDownloader) downloadSegment(s *segments, seg *segment) error {
+	return bd.cfg.BackSourceResume.Do(func(attempt int) error {
+		if atomic.LoadInt32(&s.failed) == 1 {
+			return retry.Stop(errSegmentAborted)
+		}
+		if attempt > 1 {
+			atomic.AddInt64(&bd.cfg.RV.Retries, 1)
+		}
+		offset := seg.start + seg.written
+		resp, err := bd.getRange(offset, seg.end, s.validator)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var start, end, total int64
+		if n, _ := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); n != 3 ||
+			start != offset || end != seg.end || total != s.total {
+			return retry.Stop(fmt.Errorf("the file has changed, content range: %s", resp.Header.Get("Content-Range")))
+		}
+
+		remaining := seg.end - offset + 1
+		reader := limitreader.NewLimitReaderWithLimiter(s.limiter,
+			limitreader.NewSizeLimitReader(resp.Body, remaining), false)
+		_, err = io.CopyBuffer(&segmentWriter{s: s, seg: seg}, reader, make([]byte, 256*1024))
+		err = checkLength(seg.start+seg.written, seg.end+1, err)
+		if err == errSegmentAborted {
+			return retry.Stop(err)
+		}
+		if err != nil && attempt < bd.cfg.BackSourceResume.MaxAttempts {
+			logrus.Warnf("failed to download the segment %d-%d of %s at %d bytes (%d/%d): %v",
+				seg.start, seg.end, bd.Target, seg.written, attempt, bd.cfg.BackSourceResume.MaxAttempts, err)
+			bd.cfg.RV.EventLog.Record(config.EventRetry, fmt.Sprintf("%d-%d", seg.start, seg.end), "", err.Error())
+		}
+		return err
+	})
+}
+
+// probeRange requests the first byte of the file to check whether the source station
+// supports the range requests, and returns the length of the file and its validator.
+func (bd *BackDownloader) probeRange() (int64, string, error) {
+	resp, err := bd.getRange(0, 0, "")
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Accept-Ranges") == "none" {
+		return 0, "", fmt.Errorf("source doesn't accept the range requests")
+	}
+	var start, end, total int64
+	if n, _ := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); n != 3 ||
+		start != 0 || total <= 0 {
+		return 0, "", fmt.Errorf("invalid content range: %s", resp.Header.Get("Content-Range"))
+	}
+	ck := &checkpoint{}
+	ck.update(resp)
+	return total, ck.validator(), nil
+}
+
+// getRange requests the range [start, end] of the file, which must be responded with 206.
+// The file is requested only if it matches the validator if it's not empty.
+func (bd *BackDownloader) getRange(start, end int64, validator string) (*http.Response, error) {
+	client, err := bd.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := httputils.WithTaskHeader(netutils.ConvertHeaders(bd.cfg.Header), bd.TaskID)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[config.StrRange] = fmt.Sprintf("%s=%d-%d", config.StrBytes, start, end)
+	if validator != "" {
+		headers["If-Range"] = validator
+	}
+	resp, err := client.Do(http.MethodGet, bd.URL, headers, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, retry.Stop(fmt.Errorf("source doesn't support the range request, response code:%d", resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// segmentWriter writes the bytes of the segment at its offset in the file.
+type segmentWriter struct {
+	s   *segments
+	seg *segment
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&w.s.failed) == 1 {
+		return 0, errSegmentAborted
+	}
+	n, err := w.s.f.WriteAt(p, w.seg.start+w.seg.written)
+	w.seg.written += int64(n)
+	printer.Progress(atomic.AddInt64(&w.s.completed, int64(n)), w.s.total)
+	return n, err
+}
@@ -23,13 +23,22 @@ package downloader
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -38,20 +47,113 @@ type Downloader interface {
 	Run(ctx context.Context) error
 	// RunStream return a io.Reader instead of writing a file without any disk io.
 	RunStream(ctx context.Context) (io.Reader, error)
+	// RunStreamRange returns a reader of the length bytes of the file from the offset
+	// like RunStream, it's read to the end of the file if the length is negative.
+	RunStreamRange(ctx context.Context, offset, length int64) (*RangeReader, error)
 	Cleanup()
 }
 
+// RangeReader reads a range of the file streamed by RunStreamRange.
+type RangeReader struct {
+	// Offset is the offset of the range in the file.
+	Offset int64
+	// Length is the length of the range, it's -1 if the range is read to the end
+	// of the file whose length is unknown.
+	Length int64
+	// Total is the length of the whole file, it's -1 if it's unknown.
+	Total int64
+
+	reader    io.Reader
+	skip      int64
+	remaining int64
+	closer    func() error
+}
+
+// NewRangeReader returns a RangeReader of the length bytes from the offset of the file
+// whose length is total, which reads the range from r after discarding the first skip bytes.
+// The length is bounded by the total if it's known, and the closer is called when it's closed.
+func NewRangeReader(r io.Reader, skip, offset, length, total int64, closer func() error) *RangeReader {
+	if total >= 0 && (length < 0 || offset+length > total) {
+		length = total - offset
+	}
+	return &RangeReader{
+		Offset:    offset,
+		Length:    length,
+		Total:     total,
+		reader:    r,
+		skip:      skip,
+		remaining: length,
+		closer:    closer,
+	}
+}
+
+// Read reads the data of the range. The range which ends at the end of the file is read
+// until the EOF of r, so that the errors of verifying the whole file are returned.
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.skip > 0 {
+		n, err := io.CopyN(ioutil.Discard, r.reader, r.skip)
+		r.skip -= n
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if r.Length < 0 {
+		return r.reader.Read(p)
+	}
+	if r.remaining <= 0 {
+		if r.Offset+r.Length != r.Total {
+			return 0, io.EOF
+		}
+		var b [1]byte
+		for {
+			n, err := r.reader.Read(b[:])
+			if n > 0 {
+				return 0, fmt.Errorf("the file is longer than %d", r.Total)
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Close stops reading the range.
+func (r *RangeReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer()
+}
+
 // DoDownloadTimeout downloads the file and waits for response during
 // the given timeout duration.
 func DoDownloadTimeout(downloader Downloader, timeout time.Duration) error {
+	return DoDownloadContext(context.Background(), downloader, timeout)
+}
+
+// DoDownloadContext downloads the file like DoDownloadTimeout,
+// and the download is also stopped once ctx is done.
+func DoDownloadContext(ctx context.Context, downloader Downloader, timeout time.Duration) error {
 	if timeout <= 0 {
 		logrus.Warnf("invalid download timeout(%.3fs), use default:(%.3fs)",
 			timeout.Seconds(), config.DefaultDownloadTimeout.Seconds())
 		timeout = config.DefaultDownloadTimeout
 	}
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 
-	var ch = make(chan error)
+	var ch = make(chan error, 1)
 	go func() {
 		ch <- downloader.Run(ctx)
 	}()
@@ -62,12 +164,52 @@ func DoDownloadTimeout(downloader Downloader, timeout time.Duration) error {
 	case err = <-ch:
 		return err
 	case <-time.After(timeout):
-		err = fmt.Errorf("download timeout(%.3fs)", timeout.Seconds())
+		err = errors.Wrapf(errortypes.ErrTimeout, "download timeout(%.3fs)", timeout.Seconds())
+		downloader.Cleanup()
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "download is aborted")
 		downloader.Cleanup()
 	}
 	return err
 }
 
+// VerifySha256 checks whether the sha256 digest of the file is expected.
+// It does nothing if the expected digest is empty.
+func VerifySha256(name string, expectSha256 string) error {
+	if expectSha256 == "" {
+		return nil
+	}
+	start := time.Now()
+	realSha256 := fileutils.Sha256Sum(name)
+	logrus.Infof("compute sha256:%s for file:%s cost:%.3fs", realSha256,
+		name, time.Since(start).Seconds())
+	if realSha256 != expectSha256 {
+		return errors.Wrapf(errortypes.ErrDigestMismatch, "Sha256NotMatch, real:%s expect:%s", realSha256, expectSha256)
+	}
+	return nil
+}
+
+// VerifyDigest checks whether the digest of the file is expected, which is in the form
+// of "algo:hex". It does nothing if the expected digest is empty or an md5 one, since the
+// md5 is always verified with the expected md5 of the config which is set from the digest.
+func VerifyDigest(name string, expectDigest string) error {
+	algo, expected, err := digest.Parse(expectDigest)
+	if expectDigest == "" || algo == digest.AlgorithmMD5 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	realSum := fileutils.Sum(name, digest.NewHash(algo))
+	logrus.Infof("compute %s:%s for file:%s cost:%.3fs", algo, realSum,
+		name, time.Since(start).Seconds())
+	if realSum != expected {
+		return errors.Wrapf(errortypes.ErrDigestMismatch, "DigestNotMatch, real:%s:%s expect:%s", algo, realSum, expectDigest)
+	}
+	return nil
+}
+
 // MoveFile moves a file from src to dst and
 // checks if the MD5 code is expected before that.
 func MoveFile(src string, dst string, expectMd5 string) error {
@@ -77,7 +219,7 @@ func MoveFile(src string, dst string, expectMd5 string) error {
 		logrus.Infof("compute raw md5:%s for file:%s cost:%.3fs", realMd5,
 			src, time.Since(start).Seconds())
 		if realMd5 != expectMd5 {
-			return fmt.Errorf("Md5NotMatch, real:%s expect:%s", realMd5, expectMd5)
+			return errors.Wrapf(errortypes.ErrDigestMismatch, "Md5NotMatch, real:%s expect:%s", realMd5, expectMd5)
 		}
 	}
 	err := fileutils.MoveFile(src, dst)
@@ -85,3 +227,149 @@ func MoveFile(src string, dst string, expectMd5 string) error {
 		src, dst, err == nil, time.Since(start).Seconds())
 	return err
 }
+
+// VerifyDigests checks whether the file matches all the expected digests in the form of "algo:hex",
+// which are computed in a single pass of reading the file. The empty digests are ignored.
+func VerifyDigests(name string, expectDigests ...string) error {
+	v, err := NewVerifier(expectDigests...)
+	if err != nil || v.Empty() {
+		return err
+	}
+	start := time.Now()
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(v, f); err != nil {
+		return fmt.Errorf("failed to read file %s: %v", name, err)
+	}
+	logrus.Infof("compute %s for file:%s cost:%.3fs", v, name, time.Since(start).Seconds())
+	return v.Verify()
+}
+
+// VerifyDevice verifies the first length bytes of the block device against
+// the expected md5, sha256 and the digests in the form of "algo:hex". The data is
+// re-read from the device bypassing the page cache, so that what has been written
+// to the disk is checked.
+func VerifyDevice(name string, length int64, expectMd5, expectSha256 string, expectDigests ...string) error {
+	if expectMd5 != "" {
+		expectDigests = append(expectDigests, digest.String(digest.AlgorithmMD5, expectMd5))
+	}
+	if expectSha256 != "" {
+		expectDigests = append(expectDigests, digest.String(digest.AlgorithmSHA256, expectSha256))
+	}
+	v, err := NewVerifier(expectDigests...)
+	if err != nil || v.Empty() {
+		return err
+	}
+	if length < 0 {
+		return fmt.Errorf("failed to verify device %s: unknown file length", name)
+	}
+
+	start := time.Now()
+	f, err := fileutils.OpenDirect(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := fileutils.AlignedBuffer(1024 * fileutils.DirectAlignment)
+	for remaining := length; remaining > 0; {
+		n, err := io.ReadFull(f, buf)
+		if int64(n) >= remaining {
+			v.Write(buf[:remaining])
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read device %s: %v", name, err)
+		}
+		v.Write(buf[:n])
+		remaining -= int64(n)
+	}
+
+	logrus.Infof("compute %s for device:%s length:%d cost:%.3fs", v, name, length, time.Since(start).Seconds())
+	return v.Verify()
+}
+
+// Verifier computes the digests of the data written to it in a single pass,
+// and verifies them against the expected ones.
+type Verifier struct {
+	io.Writer
+
+	// expected is the expected digests in the form of "algo:hex".
+	expected []string
+	hashes   map[string]hash.Hash
+}
+
+// NewVerifier returns a Verifier of the expected digests in the form of "algo:hex",
+// and the empty ones are ignored.
+func NewVerifier(expectDigests ...string) (*Verifier, error) {
+	v := &Verifier{hashes: make(map[string]hash.Hash)}
+	var writers []io.Writer
+	for _, d := range expectDigests {
+		if d == "" {
+			continue
+		}
+		algo, encoded, err := digest.Parse(d)
+		if err != nil {
+			return nil, err
+		}
+		d = digest.String(algo, encoded)
+		if v.contains(d) {
+			continue
+		}
+		v.expected = append(v.expected, d)
+		if _, ok := v.hashes[algo]; !ok {
+			v.hashes[algo] = digest.NewHash(algo)
+			writers = append(writers, v.hashes[algo])
+		}
+	}
+	v.Writer = io.MultiWriter(writers...)
+	return v, nil
+}
+
+func (v *Verifier) contains(d string) bool {
+	for _, e := range v.expected {
+		if e == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether there's no digest to verify.
+func (v *Verifier) Empty() bool {
+	return len(v.expected) == 0
+}
+
+// Verify checks the digests of the data written against the expected ones.
+func (v *Verifier) Verify() error {
+	for _, expected := range v.expected {
+		algo := expected[:strings.Index(expected, ":")]
+		actual := digest.String(algo, hex.EncodeToString(v.hashes[algo].Sum(nil)))
+		if actual == expected {
+			continue
+		}
+		switch algo {
+		case digest.AlgorithmMD5:
+			return errors.Wrapf(errortypes.ErrDigestMismatch, "Md5NotMatch, real:%s expect:%s",
+				actual[len(algo)+1:], expected[len(algo)+1:])
+		case digest.AlgorithmSHA256:
+			return errors.Wrapf(errortypes.ErrDigestMismatch, "Sha256NotMatch, real:%s expect:%s",
+				actual[len(algo)+1:], expected[len(algo)+1:])
+		}
+		return errors.Wrapf(errortypes.ErrDigestMismatch, "DigestNotMatch, real:%s expect:%s", actual, expected)
+	}
+	return nil
+}
+
+// String returns the digests computed.
+func (v *Verifier) String() string {
+	var digests []string
+	for algo, h := range v.hashes {
+		digests = append(digests, digest.String(algo, hex.EncodeToString(h.Sum(nil))))
+	}
+	sort.Strings(digests)
+	return strings.Join(digests, " ")
+}
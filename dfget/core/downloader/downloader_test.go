@@ -22,10 +22,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/go-check/check"
 )
@@ -52,6 +54,12 @@ func (s *DownloaderTestSuite) TestDoDownloadTimeout(c *check.C) {
 
 	err = DoDownloadTimeout(md, 110*time.Millisecond)
 	c.Assert(err, check.IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = DoDownloadContext(ctx, md, 110*time.Millisecond)
+	c.Assert(err, check.NotNil)
+	c.Check(errortypes.IsTimeout(err), check.Equals, false)
 }
 
 func (s *DownloaderTestSuite) TestMoveFile(c *check.C) {
@@ -78,6 +86,113 @@ func (s *DownloaderTestSuite) TestMoveFile(c *check.C) {
 	c.Assert(err, check.NotNil)
 }
 
+func (s *DownloaderTestSuite) TestVerifySha256(c *check.C) {
+	tmp, _ := ioutil.TempDir("/tmp", "dfget-TestVerifySha256-")
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "a")
+	helper.CreateTestFileWithMD5(src, "hello")
+
+	c.Assert(VerifySha256(src, ""), check.IsNil)
+	c.Assert(VerifySha256(src, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"), check.IsNil)
+	c.Assert(VerifySha256(src, "x"), check.NotNil)
+}
+
+func (s *DownloaderTestSuite) TestVerifyDevice(c *check.C) {
+	tmp, _ := ioutil.TempDir("/tmp", "dfget-TestVerifyDevice-")
+	defer os.RemoveAll(tmp)
+
+	// the data is followed by the stale content of the device
+	src := filepath.Join(tmp, "a")
+	helper.CreateTestFileWithMD5(src, "hello"+strings.Repeat("x", 2*fileutils.DirectAlignment))
+
+	md5 := "5d41402abc4b2a76b9719d911017c592"
+	sha256 := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	c.Assert(VerifyDevice(src, 5, "", "", ""), check.IsNil)
+	c.Assert(VerifyDevice(src, 5, md5, sha256, ""), check.IsNil)
+	c.Assert(VerifyDevice(src, 5, "x", "", ""), check.NotNil)
+	c.Assert(VerifyDevice(src, 5, md5, "x", ""), check.NotNil)
+	c.Assert(VerifyDevice(src, 6, md5, "", ""), check.NotNil)
+	c.Assert(VerifyDevice(src, 3*fileutils.DirectAlignment, md5, "", ""), check.NotNil)
+	c.Assert(VerifyDevice(src, -1, md5, "", ""), check.NotNil)
+
+	sha512 := "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"
+	c.Assert(VerifyDevice(src, 5, "", "", "sha512:"+sha512), check.IsNil)
+	c.Assert(VerifyDevice(src, 5, "", "", "sha256:"+sha256), check.IsNil)
+	c.Assert(VerifyDevice(src, 5, md5, "", "sha512:"+strings.Repeat("0", 128)), check.NotNil)
+	c.Assert(VerifyDevice(src, 5, "", "", "sha512:x"), check.NotNil)
+}
+
+func (s *DownloaderTestSuite) TestVerifyDigest(c *check.C) {
+	tmp, _ := ioutil.TempDir("/tmp", "dfget-TestVerifyDigest-")
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "a")
+	helper.CreateTestFileWithMD5(src, "hello")
+
+	c.Assert(VerifyDigest(src, ""), check.IsNil)
+	// the md5 is verified by the expected md5 instead
+	c.Assert(VerifyDigest(src, "md5:"+strings.Repeat("0", 32)), check.IsNil)
+	c.Assert(VerifyDigest(src, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"), check.IsNil)
+	c.Assert(VerifyDigest(src, "sha256:"+strings.Repeat("0", 64)), check.NotNil)
+	c.Assert(VerifyDigest(src, "sha1:0"), check.NotNil)
+}
+
+func (s *DownloaderTestSuite) TestVerifyDigests(c *check.C) {
+	tmp, _ := ioutil.TempDir("/tmp", "dfget-TestVerifyDigests-")
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "a")
+	md5 := helper.CreateTestFileWithMD5(src, "hello")
+	sha256 := "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	c.Assert(VerifyDigests(src), check.IsNil)
+	c.Assert(VerifyDigests(src, "", "md5:"+md5, sha256, sha256), check.IsNil)
+	c.Assert(VerifyDigests(src, md5, "sha512:"+strings.Repeat("0", 128)), check.ErrorMatches, "DigestNotMatch.*")
+	// all the expected digests of the same algorithm are verified
+	err := VerifyDigests(src, sha256, "sha256:"+strings.Repeat("0", 64))
+	c.Check(errortypes.IsDigestMismatch(err), check.Equals, true)
+	c.Assert(VerifyDigests(src, "sha1:0"), check.NotNil)
+
+	v, err := NewVerifier("md5:"+md5, sha256)
+	c.Assert(err, check.IsNil)
+	v.Write([]byte("hello"))
+	c.Check(v.Verify(), check.IsNil)
+	c.Check(v.String(), check.Equals, "md5:"+md5+" "+sha256)
+}
+
+func (s *DownloaderTestSuite) TestRangeReader(c *check.C) {
+	var cases = []struct {
+		skip, offset, length, total int64
+		expected                    string
+		expectedLength              int64
+	}{
+		{skip: 2, offset: 2, length: 3, total: 10, expected: "234", expectedLength: 3},
+		{skip: 6, offset: 6, length: -1, total: 10, expected: "6789", expectedLength: 4},
+		{skip: 6, offset: 6, length: 100, total: 10, expected: "6789", expectedLength: 4},
+		{skip: 0, offset: 2, length: 3, total: -1, expected: "012", expectedLength: 3},
+		{skip: 3, offset: 3, length: -1, total: -1, expected: "3456789", expectedLength: -1},
+	}
+	for _, v := range cases {
+		closed := false
+		r := NewRangeReader(strings.NewReader("0123456789"), v.skip, v.offset, v.length, v.total,
+			func() error { closed = true; return nil })
+		c.Check(r.Length, check.Equals, v.expectedLength)
+		data, err := ioutil.ReadAll(r)
+		c.Check(err, check.IsNil)
+		c.Check(string(data), check.Equals, v.expected)
+		c.Check(r.Close(), check.IsNil)
+		c.Check(closed, check.Equals, true)
+	}
+
+	// the file is shorter than the range
+	r := NewRangeReader(strings.NewReader("0123"), 2, 2, 3, -1, nil)
+	_, err := ioutil.ReadAll(r)
+	c.Check(err, check.Equals, io.ErrUnexpectedEOF)
+	// the file is longer than the total
+	r = NewRangeReader(strings.NewReader("0123456789"), 2, 2, -1, 5, nil)
+	_, err = ioutil.ReadAll(r)
+	c.Check(err, check.NotNil)
+}
+
 // ----------------------------------------------------------------------------
 // helper functions
 
@@ -94,5 +209,9 @@ func (md *MockDownloader) RunStream(ctx context.Context) (io.Reader, error) {
 	return nil, nil
 }
 
+func (md *MockDownloader) RunStreamRange(ctx context.Context, offset, length int64) (*RangeReader, error) {
+	return nil, nil
+}
+
 func (md *MockDownloader) Cleanup() {
 }
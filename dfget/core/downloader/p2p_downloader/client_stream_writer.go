@@ -18,7 +18,10 @@ package downloader
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"time"
 
@@ -26,9 +29,11 @@ import (
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
 	"github.com/dragonflyoss/Dragonfly/pkg/queue"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -48,6 +53,9 @@ type ClientStreamWriter struct {
 
 	// pieceIndex records the number of pieces currently downloaded.
 	pieceIndex int
+	// partial records that the pieces before the start piece are skipped,
+	// so the digests of the whole file aren't verified.
+	partial bool
 	// result records whether the write operation was successful.
 	result bool
 
@@ -60,10 +68,22 @@ type ClientStreamWriter struct {
 	// pipeReader is the read half of a pipe
 	pipeReader *io.PipeReader
 
-	// limitReader supports limit rate and calculates md5
+	// limitReader supports limit rate and calculates the digest
 	limitReader *limitreader.LimitReader
 
+	// expectedDigest is the digest of the file expected by user in the form of "algo:hex".
+	expectedDigest string
+
+	// sha256 calculates the sha256 digest of the data read from the writer,
+	// which is verified against the one published by supernode.
+	sha256 hash.Hash
+
 	cache map[int]*Piece
+	// cacheBytes is the total bytes of the pieces in cache.
+	cacheBytes int64
+
+	// reporter reports the pieces written to the pipe to supernode.
+	reporter *pieceReporter
 
 	// api holds an instance of SupernodeAPI to interact with supernode.
 	api api.SupernodeAPI
@@ -75,23 +95,34 @@ type ClientStreamWriter struct {
 // NewClientStreamWriter creates and initialize a ClientStreamWriter instance.
 func NewClientStreamWriter(clientQueue, notifyQueue queue.Queue, api api.SupernodeAPI, cfg *config.Config) *ClientStreamWriter {
 	pr, pw := io.Pipe()
-	limitReader := limitreader.NewLimitReader(pr, int64(cfg.LocalLimit), cfg.Md5 != "")
+	algo, expectedDigest := cfg.ExpectedDigest()
+	limitReader := limitreader.NewLimitReaderWithDigest(pr, int64(cfg.LocalLimit), algo)
 	clientWriter := &ClientStreamWriter{
-		clientQueue: clientQueue,
-		notifyQueue: notifyQueue,
-		pipeReader:  pr,
-		pipeWriter:  pw,
-		limitReader: limitReader,
-		api:         api,
-		cfg:         cfg,
-		cache:       make(map[int]*Piece),
+		clientQueue:    clientQueue,
+		notifyQueue:    notifyQueue,
+		pipeReader:     pr,
+		pipeWriter:     pw,
+		limitReader:    limitReader,
+		expectedDigest: expectedDigest,
+		sha256:         sha256.New(),
+		api:            api,
+		cfg:            cfg,
+		cache:          make(map[int]*Piece),
 	}
 	return clientWriter
 }
 
+// startAt makes the writer write the pieces from the start piece, the ones before it
+// aren't scheduled to the range downloads and are dropped if they're received.
+func (csw *ClientStreamWriter) startAt(pieceNum int) {
+	csw.pieceIndex = pieceNum
+	csw.partial = pieceNum > 0
+}
+
 func (csw *ClientStreamWriter) PreRun(ctx context.Context) (err error) {
 	csw.p2pPattern = helper.IsP2P(csw.cfg.Pattern)
 	csw.result = true
+	csw.reporter = newPieceReporter(csw.api, csw.cfg.RV.Cid, csw.cfg.ReportBatchSize, csw.cfg.ReportInterval, csw.cfg.Retry, csw.notifyQueue)
 	csw.finish = make(chan struct{})
 	return
 }
@@ -125,9 +156,12 @@ func (csw *ClientStreamWriter) Run(ctx context.Context) {
 			logrus.Errorf("write item:%s error:%v", piece, err)
 			csw.cfg.BackSourceReason = config.BackSourceReasonWriteError
 			csw.result = false
+			// the reader shouldn't take the partial data as the whole file
+			csw.pipeWriter.CloseWithError(err)
 		}
 	}
 
+	csw.reporter.close()
 	csw.pipeWriter.Close()
 	close(csw.finish)
 }
@@ -145,7 +179,7 @@ func (csw *ClientStreamWriter) write(piece *Piece) error {
 
 	err := csw.writePieceToPipe(piece)
 	if err == nil {
-		go sendSuccessPiece(csw.api, csw.cfg.RV.Cid, piece, time.Since(startTime), csw.notifyQueue)
+		csw.reporter.report(piece, time.Since(startTime))
 	}
 	return err
 }
@@ -160,11 +194,18 @@ func (csw *ClientStreamWriter) writePieceToPipe(p *Piece) error {
 					csw.pieceIndex, p.PieceNum)
 				break
 			}
+			if limit := csw.cfg.RV.StreamMemoryLimit; limit > 0 && csw.cacheBytes+p.ContentLength() > limit {
+				p.release()
+				return fmt.Errorf("pieces held in memory exceed the limit %d while waiting for piece %d",
+					limit, csw.pieceIndex)
+			}
 			csw.cache[p.PieceNum] = p
+			csw.cacheBytes += p.ContentLength()
 			break
 		}
 
 		_, err := io.Copy(csw.pipeWriter, p.RawContent(csw.cdnSource == apiTypes.CdnSourceSource))
+		p.release()
 		if err != nil {
 			return err
 		}
@@ -175,6 +216,7 @@ func (csw *ClientStreamWriter) writePieceToPipe(p *Piece) error {
 		if ok {
 			p = next
 			delete(csw.cache, csw.pieceIndex)
+			csw.cacheBytes -= p.ContentLength()
 			continue
 		}
 		break
@@ -183,13 +225,29 @@ func (csw *ClientStreamWriter) writePieceToPipe(p *Piece) error {
 	return nil
 }
 
+// Close closes the reader, then the pieces written later fail.
+func (csw *ClientStreamWriter) Close() error {
+	return csw.pipeReader.Close()
+}
+
 func (csw *ClientStreamWriter) Read(p []byte) (n int, err error) {
 	n, err = csw.limitReader.Read(p)
-	// all data received, calculate md5
-	if err == io.EOF && csw.cfg.Md5 != "" {
-		realMd5 := csw.limitReader.Md5()
-		if realMd5 != csw.cfg.Md5 {
-			return n, fmt.Errorf("md5 not match, expected: %s real: %s", csw.cfg.Md5, realMd5)
+	csw.sha256.Write(p[:n])
+	if err == io.EOF && csw.partial {
+		return n, err
+	}
+	// all data received, calculate the digest
+	if err == io.EOF && csw.expectedDigest != "" {
+		realDigest := csw.limitReader.Digest()
+		if realDigest != csw.expectedDigest {
+			return n, errors.Wrapf(errortypes.ErrDigestMismatch, "digest not match, expected: %s real: %s", csw.expectedDigest, realDigest)
+		}
+	}
+	// the sha256 digest is published by supernode before all data is received
+	if err == io.EOF && csw.cfg.RV.Sha256 != "" {
+		realSha256 := hex.EncodeToString(csw.sha256.Sum(nil))
+		if realSha256 != csw.cfg.RV.Sha256 {
+			return n, errors.Wrapf(errortypes.ErrDigestMismatch, "sha256 not match, expected: %s real: %s", csw.cfg.RV.Sha256, realSha256)
 		}
 	}
 	return n, err
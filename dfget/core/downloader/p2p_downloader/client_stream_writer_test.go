@@ -18,6 +18,7 @@ package downloader
 
 import (
 	"io"
+	"io/ioutil"
 	"sort"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
@@ -121,3 +122,38 @@ func (s *ClientStreamWriterTestSuite) getString(reader io.Reader, length int) st
 	reader.Read(b)
 	return string(b)
 }
+
+func (s *ClientStreamWriterTestSuite) TestWriteMemoryLimit(c *check.C) {
+	cfg := &config.Config{}
+	cfg.RV.StreamMemoryLimit = 10
+	csw := NewClientStreamWriter(nil, nil, nil, cfg)
+
+	c.Check(csw.writePieceToPipe(&Piece{PieceNum: 1, PieceSize: 6, Content: pool.NewBufferString("000020")}),
+		check.IsNil)
+	c.Check(csw.cacheBytes, check.Equals, int64(6))
+	c.Check(csw.writePieceToPipe(&Piece{PieceNum: 2, PieceSize: 6, Content: pool.NewBufferString("000030")}),
+		check.NotNil)
+	c.Check(csw.cache, check.HasLen, 1)
+}
+
+func (s *ClientStreamWriterTestSuite) TestWriteFromStartPiece(c *check.C) {
+	cfg := &config.Config{}
+	cfg.RV.Sha256 = "mismatched"
+	csw := NewClientStreamWriter(nil, nil, nil, cfg)
+	csw.startAt(1)
+	go func() {
+		// the piece before the start piece is dropped
+		c.Check(csw.writePieceToPipe(&Piece{PieceNum: 0, PieceSize: 6, Content: pool.NewBufferString("000010")}),
+			check.IsNil)
+		c.Check(csw.writePieceToPipe(&Piece{PieceNum: 2, PieceSize: 6, Content: pool.NewBufferString("000030")}),
+			check.IsNil)
+		c.Check(csw.writePieceToPipe(&Piece{PieceNum: 1, PieceSize: 6, Content: pool.NewBufferString("000020")}),
+			check.IsNil)
+		csw.pipeWriter.Close()
+	}()
+
+	// the digest of the whole file isn't verified
+	data, err := ioutil.ReadAll(csw)
+	c.Check(err, check.IsNil)
+	c.Check(string(data), check.Equals, "23")
+}
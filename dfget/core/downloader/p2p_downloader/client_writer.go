@@ -17,10 +17,12 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
-	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 
 	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
@@ -29,10 +31,14 @@ import (
 	"github.com/dragonflyoss/Dragonfly/dfget/core/downloader"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
 	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/pool"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
 	"github.com/dragonflyoss/Dragonfly/pkg/queue"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -52,6 +58,12 @@ type PieceWriter interface {
 	Wait()
 }
 
+// retargeter is implemented by the PieceWriter which can move the download
+// to another target path while it's running.
+type retargeter interface {
+	Retarget(target string) error
+}
+
 // ClientWriter writes a file for uploading and a target file.
 type ClientWriter struct {
 	// clientQueue maintains a queue of tasks that need to be written to disk.
@@ -74,11 +86,19 @@ type ClientWriter struct {
 	// serviceFile holds a file object for the serviceFilePath.
 	serviceFile *os.File
 
-	syncQueue queue.Queue
+	// serviceQueue maintains a queue of pieces that need to be written to serviceFile.
+	serviceQueue queue.Queue
+	// serviceWriter writes the pieces to serviceFile asynchronously,
+	// so that the slow disk doesn't block downloading the next pieces.
+	serviceWriter *TargetWriter
+
+	// reporter reports the pieces written to serviceFile to supernode.
+	reporter *pieceReporter
+
 	// pieceIndex records the number of pieces currently downloaded.
 	pieceIndex int
-	// result records whether the write operation was successful.
-	result bool
+	// completedLength records the length of data currently written.
+	completedLength int64
 	// acrossWrite indicates whether the target file location and temporary file location cross file systems.
 	// If that, the value is true. And vice versa.
 	// We judge this by trying to make a hard link.
@@ -96,6 +116,9 @@ type ClientWriter struct {
 	cfg *config.Config
 
 	cdnSource apiTypes.CdnSource
+
+	// fileCipher encrypts the service file if the task belongs to a namespace.
+	fileCipher *helper.FileCipher
 }
 
 // NewClientWriter creates and initialize a ClientWriter instance.
@@ -117,26 +140,44 @@ func NewClientWriter(clientFilePath, serviceFilePath string,
 func (cw *ClientWriter) PreRun(ctx context.Context) (err error) {
 	cw.p2pPattern = helper.IsP2P(cw.cfg.Pattern)
 	if cw.p2pPattern {
-		if e := fileutils.Link(cw.cfg.RV.TempTarget, cw.clientFilePath); e != nil {
+		var cacheCipher *helper.CacheCipher
+		if cacheCipher, err = helper.GetCacheCipher(cw.cfg); err != nil {
+			return err
+		}
+		if cw.cfg.RV.BlockDevice || cacheCipher != nil {
+			// the service file can't share the data with a block device
+			// or the target file if it's encrypted
+			cw.acrossWrite = true
+		} else if e := fileutils.Link(cw.cfg.RV.TempTarget, cw.clientFilePath); e != nil {
 			logrus.Warn(e)
 			cw.acrossWrite = true
 		}
 
-		cw.serviceFile, _ = fileutils.OpenFile(cw.serviceFilePath, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0755)
+		// the service file is truncated below, so it's encrypted with a new nonce.
+		if cw.fileCipher, err = cacheCipher.NewFile(cw.serviceFilePath); err != nil {
+			return err
+		}
+		cw.serviceFile, err = fileutils.OpenFile(cw.serviceFilePath, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0755)
+		if err != nil {
+			return err
+		}
 		if err := fileutils.Link(cw.serviceFilePath, cw.clientFilePath); err != nil {
 			return err
 		}
+		cw.serviceQueue = queue.NewQueue(cw.cfg.ClientQueueSize)
+		cw.serviceWriter = newFileWriter(cw.serviceFile, cw.serviceQueue, cw.cfg, cw.cdnSource, cw.onServiceWrite)
+		cw.serviceWriter.fileCipher = cw.fileCipher
+		cw.reporter = newPieceReporter(cw.api, cw.cfg.RV.Cid, cw.cfg.ReportBatchSize, cw.cfg.ReportInterval, cw.cfg.Retry, cw.notifyQueue)
 	}
 
-	cw.result = true
-	cw.targetQueue = queue.NewQueue(0)
+	// The queues are bounded by the size of client queue to limit the
+	// number of piece buffers held in memory when the disk is slow.
+	cw.targetQueue = queue.NewQueue(cw.cfg.ClientQueueSize)
 	cw.targetWriter, err = NewTargetWriter(cw.cfg.RV.TempTarget, cw.targetQueue, cw.cfg, cw.cdnSource)
 	if err != nil {
 		return
 	}
 
-	cw.syncQueue = startSyncWriter(nil)
-
 	cw.finish = make(chan struct{})
 	return
 }
@@ -154,7 +195,18 @@ func (cw *ClientWriter) PostRun(ctx context.Context) (err error) {
 			}
 		}
 	}
-	if err = downloader.MoveFile(src, cw.cfg.RV.RealTarget, cw.cfg.Md5); err != nil {
+	if cw.cfg.RV.BlockDevice {
+		if err = downloader.VerifyDevice(src, cw.cfg.RV.FileLength, "", "", cw.cfg.ExpectedDigests()...); err != nil {
+			return
+		}
+		logrus.Infof("download successfully from dragonfly")
+		return nil
+	}
+	if err = downloader.VerifyDigests(src, cw.cfg.ExpectedDigests()...); err == nil {
+		err = downloader.MoveFile(src, cw.cfg.RV.RealTarget, "")
+	}
+	if err != nil {
+		downloader.HandleVerifyFailure(cw.cfg, src, cw.cfg.Pattern, err)
 		return
 	}
 	logrus.Infof("download successfully from dragonfly")
@@ -162,49 +214,83 @@ func (cw *ClientWriter) PostRun(ctx context.Context) (err error) {
 }
 
 // Run starts writing downloading file.
+// It dispatches the pieces to the writers of the service file and the target file,
+// which write the pieces to disk in parallel with downloading.
 func (cw *ClientWriter) Run(ctx context.Context) {
 	go cw.targetWriter.Run(ctx)
+	if cw.serviceWriter != nil {
+		go cw.serviceWriter.Run(ctx)
+	}
 
 	for {
 		item := cw.clientQueue.Poll()
 		state, ok := item.(string)
-		if ok && state == last {
-			if !cw.acrossWrite {
-				cw.serviceFile.Sync()
+		if ok && (state == last || state == reset) {
+			if cw.serviceWriter != nil {
+				cw.serviceWriter.put(state)
 			}
-			break
-		}
-		if ok && state == reset {
-			if cw.serviceFile != nil {
-				cw.serviceFile.Truncate(0)
+			if cw.acrossWrite || state == last {
+				cw.targetWriter.put(state)
 			}
-			if cw.acrossWrite {
-				cw.targetQueue.Put(state)
+			if state == last {
+				break
 			}
 			continue
 		}
-		if !cw.result {
-			continue
-		}
 
 		piece, ok := item.(*Piece)
 		if !ok {
 			continue
 		}
-		if err := cw.write(piece); err != nil {
-			logrus.Errorf("write item:%s error:%v", piece, err)
-			cw.cfg.BackSourceReason = config.BackSourceReasonWriteError
-			cw.result = false
-		}
+		cw.write(piece)
 	}
-	if cw.serviceFile != nil {
-		cw.serviceFile.Close()
+
+	if cw.serviceWriter != nil {
+		cw.serviceWriter.Wait()
+		cw.reporter.close()
+		stats := cw.serviceWriter.Stats()
+		logrus.Infof("service file writer stats: %s", &stats)
 	}
-	cw.targetQueue.Put(last)
 	cw.targetWriter.Wait()
+	stats := cw.targetWriter.Stats()
+	logrus.Infof("target file writer stats: %s", &stats)
 	close(cw.finish)
 }
 
+// Retarget moves the download to the target path while it's running. The temp target file
+// is moved to the directory of the target unless it's in the work directory, and it's moved
+// by the target writer after the queued pieces are written, so the completed pieces are kept
+// and the rest ones are written to the moved file.
+func (cw *ClientWriter) Retarget(target string) error {
+	rv := &cw.cfg.RV
+	if rv.BlockDevice {
+		return fmt.Errorf("target %s is a block device", rv.RealTarget)
+	}
+	if !filepath.IsAbs(target) {
+		return fmt.Errorf("target %s isn't an absolute path", target)
+	}
+	if fileutils.PathExist(target) {
+		return fmt.Errorf("target %s already exists", target)
+	}
+	dir := filepath.Dir(target)
+	if err := fileutils.CreateDirectory(dir); err != nil {
+		return err
+	}
+
+	tempTarget := rv.TempTarget
+	if rv.TempDir == rv.TargetDir {
+		tempTarget = filepath.Join(dir, filepath.Base(rv.TempTarget))
+		if err := cw.targetWriter.move(tempTarget); err != nil {
+			return err
+		}
+		rv.TempDir = dir
+	}
+	logrus.Infof("move the download from %s to %s", rv.RealTarget, target)
+	rv.RealTarget, rv.TargetDir, rv.TempTarget = target, dir, tempTarget
+	cw.cfg.Output = target
+	return nil
+}
+
 // Wait for Run whether is finished.
 func (cw *ClientWriter) Wait() {
 	if cw.finish != nil {
@@ -212,50 +298,129 @@ func (cw *ClientWriter) Wait() {
 	}
 }
 
-func (cw *ClientWriter) write(piece *Piece) error {
-	startTime := time.Now()
+func (cw *ClientWriter) write(piece *Piece) {
 	if !cw.p2pPattern {
-		cw.targetQueue.Put(piece)
-		return nil
+		cw.targetWriter.put(piece)
+		return
 	}
 
 	if cw.acrossWrite {
-		cw.targetQueue.Put(piece)
+		// the piece content is shared by both writers
+		piece.retain()
+		cw.targetWriter.put(piece)
 	}
+	cw.serviceWriter.put(piece)
+}
 
+// onServiceWrite is called by serviceWriter after a piece is written to the service file.
+func (cw *ClientWriter) onServiceWrite(piece *Piece, length int64, cost time.Duration) {
 	cw.pieceIndex++
-	err := writePieceToFile(piece, cw.serviceFile, cw.cdnSource)
-	if err == nil {
-		go sendSuccessPiece(cw.api, cw.cfg.RV.Cid, piece, time.Since(startTime), cw.notifyQueue)
+	cw.completedLength += length
+	printer.Progress(cw.completedLength, cw.cfg.RV.FileLength)
+	cw.reporter.report(piece, cost)
+}
+
+// pieceDataLength returns the length of the piece data without the wrapper.
+func pieceDataLength(piece *Piece, cdnSource apiTypes.CdnSource) int64 {
+	length := piece.ContentLength()
+	if cdnSource != apiTypes.CdnSourceSource {
+		length -= config.PieceMetaSize
 	}
-	return err
+	if length < 0 {
+		return 0
+	}
+	return length
 }
 
-func writePieceToFile(piece *Piece, file *os.File, cdnSource apiTypes.CdnSource) error {
+// writePieceToFile writes the data of the piece to the file at its offset. The piece is
+// rewritten if less data is written, and ErrShortWrite is returned if it's still short.
+// If verify is true, the data is read back after fsync and compared with the piece.
+func writePieceToFile(piece *Piece, file *os.File, cdnSource apiTypes.CdnSource, fc *helper.FileCipher, verify bool) (err error) {
 	var pieceHeader = 5
 	// the piece is not wrapped with source cdn type
 	noWrapper := (cdnSource == apiTypes.CdnSourceSource)
 	if noWrapper {
 		pieceHeader = 0
 	}
+	defer piece.release()
 
 	start := int64(piece.PieceNum) * (int64(piece.PieceSize) - int64(pieceHeader))
-	if _, err := file.Seek(start, 0); err != nil {
+	var data []byte
+	if content := piece.RawContent(noWrapper); content != nil {
+		data = content.Bytes()
+	}
+
+	for attempt := 1; attempt <= config.PieceWriteAttempts; attempt++ {
+		if err = writeAt(file, start, data, fc); !errortypes.IsShortWrite(err) {
+			break
+		}
+		logrus.Warnf("failed to write piece %s (%d/%d): %v", piece.Range, attempt, config.PieceWriteAttempts, err)
+	}
+	if err != nil || !verify {
+		return err
+	}
+	return verifyWritten(file, start, data, fc)
+}
+
+// writeAt writes the data to the file at the offset,
+// and it returns ErrShortWrite if less data is written.
+func writeAt(file *os.File, offset int64, data []byte, fc *helper.FileCipher) error {
+	if _, err := file.Seek(offset, 0); err != nil {
 		return err
 	}
 
-	writer := pool.AcquireWriter(file)
-	_, err := io.Copy(writer, piece.RawContent(noWrapper))
+	counter := &countingWriter{w: file}
+	writer := pool.AcquireWriter(fc.Writer(counter, offset))
+	_, err := writer.Write(data)
+	if err == nil {
+		// the error of flushing is dropped by ReleaseWriter
+		err = writer.Flush()
+	}
 	pool.ReleaseWriter(writer)
-	writer = nil
+
+	if counter.n < int64(len(data)) {
+		return errors.Wrapf(errortypes.ErrShortWrite, "%d of %d bytes written at offset %d: %v",
+			counter.n, len(data), offset, err)
+	}
 	return err
 }
 
+// verifyWritten syncs the file and reads the data at the offset back,
+// and it returns ErrShortWrite if it differs from the expected one.
+func verifyWritten(file *os.File, offset int64, data []byte, fc *helper.FileCipher) error {
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	written := make([]byte, len(data))
+	reader := fc.Reader(io.NewSectionReader(file, offset, int64(len(data))), offset)
+	if _, err := io.ReadFull(reader, written); err != nil {
+		return errors.Wrapf(errortypes.ErrShortWrite, "read back %d bytes at offset %d: %v", len(data), offset, err)
+	}
+	if !bytes.Equal(written, data) {
+		return errors.Wrapf(errortypes.ErrShortWrite, "the %d bytes read back at offset %d differ from the written ones",
+			len(data), offset)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
 func startSyncWriter(q queue.Queue) queue.Queue {
 	return nil
 }
 
-func sendSuccessPiece(api api.SupernodeAPI, cid string, piece *Piece, cost time.Duration, notifyQueue queue.Queue) {
+func sendSuccessPiece(api api.SupernodeAPI, cid string, piece *Piece, cost time.Duration,
+	policy retry.Policy, notifyQueue queue.Queue) {
 	reportPieceRequest := &types.ReportPieceRequest{
 		TaskID:     piece.TaskID,
 		Cid:        cid,
@@ -263,29 +428,22 @@ func sendSuccessPiece(api api.SupernodeAPI, cid string, piece *Piece, cost time.
 		PieceRange: piece.Range,
 	}
 
-	var retry = 0
-	var maxRetryTime = 3
-	for {
-		if retry >= maxRetryTime {
-			logrus.Errorf("failed to report piece to supernode with request(%+v) even after retrying max retry time", reportPieceRequest)
-			break
-		}
-
+	err := policy.Do(func(attempt int) error {
 		_, err := api.ReportPiece(piece.SuperNode, reportPieceRequest)
-		if err == nil {
-			if notifyQueue != nil {
-				notifyQueue.Put("success")
-			}
-			if retry > 0 {
-				logrus.Warnf("success to report piece with request(%+v) after retrying (%d) times", reportPieceRequest, retry)
-			}
-			break
+		if err != nil {
+			logrus.Warnf("failed to report piece to supernode with request(%+v) (%d/%d): %v",
+				reportPieceRequest, attempt, policy.MaxAttempts, err)
+			return err
 		}
-
-		sleepTime := time.Duration(rand.Intn(500)+50) * time.Millisecond
-		logrus.Warnf("failed to report piece to supernode with request(%+v) for (%d) times and will retry after sleep %.3fs", reportPieceRequest, retry, sleepTime.Seconds())
-		time.Sleep(sleepTime)
-		retry++
+		if attempt > 1 {
+			logrus.Warnf("success to report piece with request(%+v) after retrying (%d) times", reportPieceRequest, attempt-1)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("failed to report piece to supernode with request(%+v) even after retrying max retry time", reportPieceRequest)
+	} else if notifyQueue != nil {
+		notifyQueue.Put("success")
 	}
 
 	if cost.Seconds() > 2.0 {
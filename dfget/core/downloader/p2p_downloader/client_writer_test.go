@@ -17,14 +17,20 @@
 package downloader
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/pool"
+	"github.com/dragonflyoss/Dragonfly/pkg/queue"
 
 	"github.com/go-check/check"
 )
@@ -89,7 +95,7 @@ func (s *ClientWriterTestSuite) TestWrite(c *check.C) {
 	}
 
 	for _, v := range cases {
-		err := writePieceToFile(v.piece, s.serviceFile, v.cdnSource)
+		err := writePieceToFile(v.piece, s.serviceFile, v.cdnSource, nil, false)
 		c.Assert(err, check.IsNil)
 
 		var pieceHeaderLength = 5
@@ -102,6 +108,115 @@ func (s *ClientWriterTestSuite) TestWrite(c *check.C) {
 	}
 }
 
+func (s *ClientWriterTestSuite) TestWriteShort(c *check.C) {
+	path := filepath.Join(s.workHome, "shortwrite")
+	c.Assert(ioutil.WriteFile(path, []byte("0123456789"), 0644), check.IsNil)
+	cc, err := helper.NewCacheCipher([]byte("0123456789abcdef"))
+	c.Assert(err, check.IsNil)
+	fc, err := cc.NewFile(path)
+	c.Assert(err, check.IsNil)
+
+	// the writes to a read-only file are short
+	file, err := os.Open(path)
+	c.Assert(err, check.IsNil)
+	err = writePieceToFile(&Piece{PieceNum: 1, PieceSize: 3, Content: pool.NewBufferString("abc")},
+		file, apiTypes.CdnSourceSource, nil, false)
+	c.Check(errortypes.IsShortWrite(err), check.Equals, true)
+	file.Close()
+
+	file, err = fileutils.OpenFile(path, os.O_RDWR, 0644)
+	c.Assert(err, check.IsNil)
+	defer file.Close()
+	for _, cipher := range []*helper.FileCipher{nil, fc} {
+		err = writePieceToFile(&Piece{PieceNum: 1, PieceSize: 3, Content: pool.NewBufferString("abc")},
+			file, apiTypes.CdnSourceSource, cipher, true)
+		c.Check(err, check.IsNil)
+	}
+
+	// the data differing from the written one is detected when it's read back
+	c.Check(verifyWritten(file, 3, []byte("abc"), fc), check.IsNil)
+	err = verifyWritten(file, 3, []byte("abd"), fc)
+	c.Check(errortypes.IsShortWrite(err), check.Equals, true)
+	err = verifyWritten(file, 8, []byte("abc"), nil)
+	c.Check(errortypes.IsShortWrite(err), check.Equals, true)
+}
+
+func (s *ClientWriterTestSuite) TestFileWriter(c *check.C) {
+	file, err := fileutils.OpenFile(filepath.Join(s.workHome, "fwtest"), os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0755)
+	c.Assert(err, check.IsNil)
+
+	var written []int
+	cfg := &config.Config{Pattern: config.PatternP2P}
+	q := queue.NewQueue(2)
+	fw := newFileWriter(file, q, cfg, apiTypes.CdnSourceSupernode, func(piece *Piece, length int64, cost time.Duration) {
+		c.Check(length, check.Equals, int64(2))
+		written = append(written, piece.PieceNum)
+	})
+	go fw.Run(context.Background())
+
+	pieces := []*Piece{
+		{PieceNum: 0, PieceSize: 7, Content: pool.NewBufferString("0000ab0"), autoReset: true},
+		{PieceNum: 1, PieceSize: 7, Content: pool.NewBufferString("0000cd0"), autoReset: true},
+		{PieceNum: 2, PieceSize: 7, Content: pool.NewBufferString("0000ef0"), autoReset: true},
+	}
+	// the second piece is shared with another writer
+	pieces[1].retain()
+	for _, p := range pieces {
+		fw.put(p)
+	}
+	fw.put(last)
+	fw.Wait()
+
+	c.Check(written, check.DeepEquals, []int{0, 1, 2})
+	c.Check(pieces[0].Content, check.IsNil)
+	c.Check(pieces[1].Content, check.NotNil)
+	c.Check(pieces[2].Content, check.IsNil)
+
+	content, err := ioutil.ReadFile(file.Name())
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, "abcdef")
+
+	stats := fw.Stats()
+	c.Check(stats.Pieces, check.Equals, 3)
+	c.Check(stats.MaxDepth <= 2, check.Equals, true)
+}
+
+func (s *ClientWriterTestSuite) TestRetarget(c *check.C) {
+	oldDir, newDir := filepath.Join(s.workHome, "retarget-old"), filepath.Join(s.workHome, "retarget-new")
+	c.Assert(fileutils.CreateDirectory(oldDir), check.IsNil)
+	cfg := &config.Config{Pattern: config.PatternCDN}
+	cfg.ClientQueueSize = 2
+	cfg.Output = filepath.Join(oldDir, "target")
+	cfg.RV.RealTarget = cfg.Output
+	cfg.RV.TargetDir = oldDir
+	cfg.RV.TempDir = oldDir
+	cfg.RV.TempTarget = filepath.Join(oldDir, "target.tmp")
+
+	cw := NewClientWriter("", "", queue.NewQueue(2), queue.NewQueue(2), nil, cfg, apiTypes.CdnSourceSupernode).(*ClientWriter)
+	c.Assert(cw.PreRun(context.Background()), check.IsNil)
+	go cw.Run(context.Background())
+
+	cw.clientQueue.Put(&Piece{PieceNum: 0, PieceSize: 7, Content: pool.NewBufferString("0000ab0")})
+	c.Check(cw.Retarget("target"), check.NotNil)
+	c.Check(cw.Retarget(cfg.RV.TempTarget), check.NotNil)
+	c.Assert(cw.Retarget(filepath.Join(newDir, "target")), check.IsNil)
+	cw.clientQueue.Put(&Piece{PieceNum: 1, PieceSize: 7, Content: pool.NewBufferString("0000cd0")})
+	cw.clientQueue.Put(last)
+	cw.Wait()
+
+	c.Check(cfg.Output, check.Equals, filepath.Join(newDir, "target"))
+	c.Check(cfg.RV.RealTarget, check.Equals, cfg.Output)
+	c.Check(cfg.RV.TargetDir, check.Equals, newDir)
+	c.Check(cfg.RV.TempDir, check.Equals, newDir)
+	c.Check(cfg.RV.TempTarget, check.Equals, filepath.Join(newDir, "target.tmp"))
+	c.Check(fileutils.PathExist(filepath.Join(oldDir, "target.tmp")), check.Equals, false)
+
+	// the pieces written before and after the move are all kept
+	content, err := ioutil.ReadFile(cfg.RV.TempTarget)
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, "abcd")
+}
+
 func (s *ClientWriterTestSuite) getString(start int64, length int) string {
 	s.serviceFile.Seek(start, 0)
 	b := make([]byte, length)
@@ -0,0 +1,85 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// downloadStatus is the snapshot of the progress of P2PDownloader written into
+// the status dump. It's updated by the download loop with statusLock held,
+// so the dump doesn't touch the states owned by the loop.
+type downloadStatus struct {
+	// output is the target path, which is changed when the download is moved.
+	output        string
+	node          string
+	taskID        string
+	successPieces int
+	runningPieces int
+	downloaded    int64
+
+	// clockOffset is how far the clock of the registered supernode is ahead of the local one.
+	clockOffset time.Duration
+
+	lastPullTime time.Time
+	lastPullCode int
+}
+
+// updateStatus records the progress after processing an item from the queue.
+func (p2p *P2PDownloader) updateStatus(runningCount int) {
+	p2p.statusLock.Lock()
+	defer p2p.statusLock.Unlock()
+
+	p2p.status.node = p2p.node
+	p2p.status.taskID = p2p.taskID
+	p2p.status.successPieces = len(p2p.pieceSet) - runningCount
+	p2p.status.runningPieces = runningCount
+	p2p.status.downloaded = p2p.total
+}
+
+// updatePullStatus records the result of pulling the piece tasks from supernode.
+func (p2p *P2PDownloader) updatePullStatus(code int) {
+	p2p.statusLock.Lock()
+	defer p2p.statusLock.Unlock()
+
+	p2p.status.lastPullTime = time.Now()
+	p2p.status.lastPullCode = code
+}
+
+// writeStatus writes the status of the download in a human-readable format.
+func (p2p *P2PDownloader) writeStatus(w io.Writer) {
+	p2p.statusLock.Lock()
+	s := p2p.status
+	p2p.statusLock.Unlock()
+
+	fmt.Fprintf(w, "url: %s\n", p2p.cfg.URL)
+	fmt.Fprintf(w, "output: %s\n", s.output)
+	fmt.Fprintf(w, "elapsed: %s\n", time.Since(p2p.cfg.StartTime).Round(time.Millisecond))
+	fmt.Fprintf(w, "supernode: %s\n", s.node)
+	fmt.Fprintf(w, "taskID: %s\n", s.taskID)
+	fmt.Fprintf(w, "pieces: %d success, %d running\n", s.successPieces, s.runningPieces)
+	fmt.Fprintf(w, "downloaded: %d bytes\n", s.downloaded)
+	if s.lastPullTime.IsZero() {
+		fmt.Fprintf(w, "last pull: none\n")
+	} else {
+		fmt.Fprintf(w, "last pull: code %d, %s ago\n", s.lastPullCode, time.Since(s.lastPullTime).Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "queues: %d items to process, %d pieces to write\n", p2p.queue.Len(), p2p.clientQueue.Len())
+	fmt.Fprintf(w, "rate limit: %d bytes/s\n", p2p.rateLimiter.Rate())
+}
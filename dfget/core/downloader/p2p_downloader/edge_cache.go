@@ -0,0 +1,149 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/pool"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// downloadFromEdges downloads the piece from the edge caches advertised by supernode
+// in turn, and it returns nil if none of them serves the piece, then the piece
+// is downloaded from the peer as usual.
+func (pc *PowerClient) downloadFromEdges() *pool.Buffer {
+	if len(pc.pieceTask.EdgeURLs) == 0 {
+		return nil
+	}
+	// the piece fetched from the edge cache can't be trusted without its md5
+	pieceMD5 := strings.Split(pc.pieceTask.PieceMd5, ":")[0]
+	if pieceMD5 == "" && pc.cdnSource != apiTypes.CdnSourceSource {
+		return nil
+	}
+	start, end, ok := pc.edgeRange()
+	if !ok {
+		return nil
+	}
+
+	for _, url := range pc.pieceTask.EdgeURLs {
+		content, err := pc.downloadFromEdge(url, start, end, pieceMD5)
+		if err == nil {
+			return content
+		}
+		logrus.Warnf("failed to download piece %s from edge cache %s: %v", pc.pieceTask.Range, url, err)
+	}
+	return nil
+}
+
+// edgeRange returns the range of the data of the piece in the original file.
+func (pc *PowerClient) edgeRange() (start, end int64, ok bool) {
+	if pc.cdnSource == apiTypes.CdnSourceSource {
+		pieceRange := pc.pieceTask.Range
+		if pc.fileLength > 0 {
+			pieceRange = wipeOutOfRange(pieceRange, pc.fileLength)
+		}
+		indexes := strings.Split(pieceRange, config.RangeSeparator)
+		if len(indexes) != 2 {
+			return 0, 0, false
+		}
+		var err1, err2 error
+		start, err1 = strconv.ParseInt(indexes[0], 10, 64)
+		end, err2 = strconv.ParseInt(indexes[1], 10, 64)
+		return start, end, err1 == nil && err2 == nil && start <= end
+	}
+
+	// every piece in the CDN of supernode is wrapped with the piece head and tail
+	dataSize := int64(pc.pieceTask.PieceSize) - config.PieceMetaSize
+	if dataSize <= 0 {
+		return 0, 0, false
+	}
+	start = int64(pc.pieceTask.PieceNum) * dataSize
+	end = start + dataSize - 1
+	if pc.fileLength > 0 && end >= pc.fileLength {
+		end = pc.fileLength - 1
+	}
+	return start, end, start <= end
+}
+
+// downloadFromEdge downloads the data in [start, end] from the edge cache, and wraps it
+// as the piece in the CDN of supernode unless the task is downloaded from the source.
+func (pc *PowerClient) downloadFromEdge(url string, start, end int64, pieceMD5 string) (*pool.Buffer, error) {
+	headers := netutils.ConvertHeaders(pc.headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[config.StrRange] = httputils.ConstructRangeStr(fmt.Sprintf("%d-%d", start, end))
+
+	startTime := time.Now()
+	timeout := netutils.CalculateTimeout(int64(pc.pieceTask.PieceSize), pc.cfg.MinRate, config.DefaultMinRate, 10*time.Second)
+	resp, err := httputils.HTTPGetTimeout(url, headers, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// a 200 response means the edge cache ignores the range, so the piece isn't read from it
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	wrapped := pc.cdnSource != apiTypes.CdnSourceSource
+	length := end - start + 1
+	data := pool.AcquireBufferSize(int(pc.pieceTask.PieceSize))
+	if wrapped {
+		data.Write(make([]byte, config.PieceHeadSize))
+	}
+	reader := limitreader.NewLimitReaderWithLimiter(pc.rateLimiter, http.MaxBytesReader(nil, resp.Body, length), false)
+	n, err := data.ReadFrom(reader)
+	if err == nil && n != length {
+		err = fmt.Errorf("short data: %d of %d bytes", n, length)
+	}
+	if err != nil {
+		pool.ReleaseBuffer(data)
+		return nil, errors.Wrap(err, "failed to read piece")
+	}
+	if wrapped {
+		binary.BigEndian.PutUint32(data.Bytes()[:config.PieceHeadSize], uint32(n)|uint32(pc.pieceTask.PieceSize)<<4)
+		data.WriteByte(config.PieceTailChar)
+	}
+
+	if pieceMD5 != "" {
+		if realMd5 := fmt.Sprintf("%x", md5.Sum(data.Bytes())); realMd5 != pieceMD5 {
+			pool.ReleaseBuffer(data)
+			return nil, fmt.Errorf("md5 not match, expected:%s real:%s", pieceMD5, realMd5)
+		}
+	}
+
+	pc.total = int64(data.Len())
+	pc.readCost = time.Since(startTime)
+	atomic.AddInt64(&pc.cfg.RV.EdgeBytes, n)
+	return data, nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&EdgeCacheTestSuite{})
+}
+
+type EdgeCacheTestSuite struct {
+	content string
+	server  *httptest.Server
+}
+
+func (s *EdgeCacheTestSuite) SetUpSuite(c *check.C) {
+	s.content = strings.Repeat("abcdefghij", 3)
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/norange" {
+			w.Write([]byte(s.content))
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(s.content))
+	}))
+}
+
+func (s *EdgeCacheTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+}
+
+func (s *EdgeCacheTestSuite) newPowerClient(pieceTask *types.PullPieceTaskResponseContinueData,
+	cdnSource apiTypes.CdnSource) *PowerClient {
+	return &PowerClient{
+		cfg:         &config.Config{},
+		rateLimiter: ratelimiter.NewRateLimiter(0, 2),
+		pieceTask:   pieceTask,
+		cdnSource:   cdnSource,
+		fileLength:  int64(len(s.content)),
+	}
+}
+
+// wrap wraps the data as the piece in the CDN of supernode.
+func wrap(data string, pieceSize int32) []byte {
+	buf := make([]byte, config.PieceHeadSize, len(data)+config.PieceMetaSize)
+	binary.BigEndian.PutUint32(buf, uint32(len(data))|uint32(pieceSize)<<4)
+	buf = append(buf, data...)
+	return append(buf, config.PieceTailChar)
+}
+
+func (s *EdgeCacheTestSuite) TestDownloadFromEdges(c *check.C) {
+	// the last piece holds the rest 6 bytes of the file
+	piece := wrap(s.content[24:], 13)
+	pc := s.newPowerClient(&types.PullPieceTaskResponseContinueData{
+		PieceNum:  3,
+		PieceSize: 13,
+		PieceMd5:  fmt.Sprintf("%x:%d", md5.Sum(piece), len(piece)),
+		EdgeURLs:  []string{s.server.URL + "/norange", s.server.URL + "/file"},
+	}, apiTypes.CdnSourceSupernode)
+	content := pc.downloadFromEdges()
+	c.Assert(content, check.NotNil)
+	c.Check(bytes.Equal(content.Bytes(), piece), check.Equals, true)
+	c.Check(pc.cfg.RV.EdgeBytes, check.Equals, int64(6))
+
+	// md5 not match
+	pc.pieceTask.PieceMd5 = "foo"
+	c.Check(pc.downloadFromEdges(), check.IsNil)
+
+	// no md5 to verify the piece
+	pc.pieceTask.PieceMd5 = ""
+	c.Check(pc.downloadFromEdges(), check.IsNil)
+}
+
+func (s *EdgeCacheTestSuite) TestDownloadFromEdgesOfSource(c *check.C) {
+	pc := s.newPowerClient(&types.PullPieceTaskResponseContinueData{
+		Range:     "20-39",
+		PieceSize: 20,
+		EdgeURLs:  []string{s.server.URL + "/file"},
+	}, apiTypes.CdnSourceSource)
+	content := pc.downloadFromEdges()
+	c.Assert(content, check.NotNil)
+	c.Check(content.String(), check.Equals, s.content[20:])
+	c.Check(pc.total, check.Equals, int64(10))
+}
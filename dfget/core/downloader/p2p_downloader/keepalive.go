@@ -0,0 +1,84 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"sync/atomic"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minKeepaliveInterval is the min interval between two keepalives.
+const minKeepaliveInterval = time.Second
+
+// keepalive sends the keepalives to the registered supernode periodically while
+// the download is running, so that supernode doesn't garbage-collect the task
+// and the dfget task when no piece task is pulled for a long time, such as when
+// the pieces are downloaded slowly from the peers. If supernode has garbage-collected
+// them anyway, the download registers again before pulling the next piece task.
+// It returns when done is closed, or when supernode doesn't support the keepalives.
+func (p2p *P2PDownloader) keepalive(done <-chan struct{}) {
+	interval := p2p.keepaliveInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+
+		p2p.statusLock.Lock()
+		node, taskID := p2p.status.node, p2p.status.taskID
+		p2p.statusLock.Unlock()
+		if node == "" || atomic.LoadInt32(&p2p.registrationLost) == 1 {
+			timer.Reset(interval)
+			continue
+		}
+
+		resp, err := p2p.API.Keepalive(node, &apiTypes.PeerKeepaliveRequest{
+			TaskID: taskID,
+			CID:    p2p.cfg.RV.Cid,
+		})
+		if err != nil {
+			logrus.Warnf("failed to send keepalive to %s: %v", node, err)
+			timer.Reset(interval)
+			continue
+		}
+		if resp == nil {
+			logrus.Debugf("stop sending keepalives to %s which doesn't support them", node)
+			return
+		}
+		if !resp.Registered {
+			logrus.Warnf("task %s is no longer registered on %s, register again", taskID, node)
+			atomic.StoreInt32(&p2p.registrationLost, 1)
+		}
+
+		next := interval
+		if expire := time.Duration(resp.ExpireAfter) * time.Second / 3; expire > 0 && expire < next {
+			next = expire
+		}
+		if next < minKeepaliveInterval {
+			next = minKeepaliveInterval
+		}
+		timer.Reset(next)
+	}
+}
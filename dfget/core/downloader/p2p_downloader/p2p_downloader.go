@@ -23,6 +23,8 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
@@ -33,11 +35,15 @@ import (
 	"github.com/dragonflyoss/Dragonfly/dfget/core/regist"
 	"github.com/dragonflyoss/Dragonfly/dfget/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/diagnostics"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/printer"
 	"github.com/dragonflyoss/Dragonfly/pkg/queue"
 	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -46,10 +52,6 @@ const (
 	last  = "last"
 )
 
-var (
-	uploaderAPI = api.NewUploaderAPI(httputils.DefaultTimeout)
-)
-
 // P2PDownloader is one implementation of Downloader that uses p2p pattern
 // to download files.
 type P2PDownloader struct {
@@ -109,6 +111,37 @@ type P2PDownloader struct {
 	// pullRateTime the time when the pull rate API is called to
 	// control the time interval between two calls to the API.
 	pullRateTime time.Time
+	// peerSpeeds records the throughput observed from every peer.
+	peerSpeeds *peerSpeeds
+	// peerPool maintains the connections to the peers.
+	peerPool *api.PeerPool
+	// uploaderAPI sends the requests to the local peer server.
+	uploaderAPI api.UploaderAPI
+	// pauseCheckTime is the time when it's checked last time whether the download
+	// is paused through the control API of the peer server, and it's checked
+	// at most once per pauseCheckInterval.
+	pauseCheckTime     time.Time
+	pauseCheckInterval time.Duration
+	// retargeter moves the download to the target path requested through the control
+	// API of the peer server, which is synced at most once per pauseCheckInterval since
+	// targetSyncTime. targetRequestID is the ID of the last request handled, and
+	// targetError is why it fails.
+	retargeter      retargeter
+	targetSyncTime  time.Time
+	targetRequestID int64
+	targetError     string
+	// extendInterval is the interval of requesting the extensions of the progress
+	// deadline while the download hasn't got any deadline from supernode yet.
+	extendInterval time.Duration
+	// keepaliveInterval is the max interval of the keepalives sent to supernode.
+	keepaliveInterval time.Duration
+	// registrationLost is set to 1 by the keepalive when supernode has garbage-collected
+	// the registration, and the download registers again before pulling the next piece task.
+	registrationLost int32
+
+	// status is the snapshot of the progress written into the status dump.
+	statusLock sync.Mutex
+	status     downloadStatus
 
 	// dfget will sleep some time which between minTimeout and maxTimeout
 	// unit: Millisecond
@@ -161,6 +194,20 @@ func (p2p *P2PDownloader) init() {
 
 	p2p.rateLimiter = ratelimiter.NewRateLimiter(int64(p2p.cfg.LocalLimit), 2)
 	p2p.pullRateTime = time.Now().Add(-3 * time.Second)
+	p2p.pauseCheckInterval = time.Second
+	p2p.extendInterval = config.DefaultProgressExtendInterval
+	p2p.keepaliveInterval = config.DefaultKeepaliveInterval
+	p2p.uploaderAPI = api.NewUploaderAPIWithSocket(httputils.DefaultTimeout, config.GetUploaderSocket(p2p.cfg.RV.MetaPath))
+	p2p.peerSpeeds = newPeerSpeeds()
+	p2p.peerPool = api.NewPeerPool(config.DefaultPeerProbeInterval, p2p.cfg.ClientQueueSize)
+	if dc := netutils.GetDNSCache(p2p.cfg.DNSCacheTTL, p2p.cfg.DNSNegativeCacheTTL); dc != nil {
+		p2p.peerPool.SetDNSCache(dc)
+	}
+	p2p.peerPool.SetSourceIP(p2p.cfg.P2PIP)
+	p2p.peerPool.SetConnLimits(p2p.cfg.MaxConnsPerPeer, p2p.cfg.MaxConnsPerTask)
+	p2p.peerPool.SetTLSConfig(p2p.cfg.RV.CDNTLSConfig)
+	p2p.status.clockOffset = p2p.RegisterResult.ClockOffset
+	p2p.status.output = p2p.cfg.Output
 }
 
 // Run starts to download the file.
@@ -189,6 +236,51 @@ func (p2p *P2PDownloader) RunStream(ctx context.Context) (io.Reader, error) {
 	return clientStreamWriter, nil
 }
 
+// RunStreamRange starts to download the file in stream like RunStream, but only the length bytes
+// from the offset are returned. The range is registered to supernode, which only schedules the
+// pieces covering it, so the download starts from the piece of the offset and the bytes of the
+// piece before the offset are discarded. The download is stopped when the reader is closed.
+func (p2p *P2PDownloader) RunStreamRange(ctx context.Context, offset, length int64) (*downloader.RangeReader, error) {
+	if !p2p.streamMode {
+		return nil, fmt.Errorf("streamMode disable, should be enabled")
+	}
+	// the offset of an empty file can only be 0, and there's no byte at the offset of the length
+	total := p2p.RegisterResult.FileLength
+	if offset < 0 || (total > 0 && offset >= total) || (total == 0 && offset > 0) {
+		return nil, errors.Wrapf(errortypes.ErrRangeNotSatisfiable, "offset %d of file length %d", offset, total)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	clientStreamWriter := NewClientStreamWriter(p2p.clientQueue, p2p.notifyQueue, p2p.API, p2p.cfg)
+	clientStreamWriter.cdnSource = p2p.RegisterResult.CDNSource
+	startPiece, skip := p2p.startPieceOf(offset)
+	clientStreamWriter.startAt(startPiece)
+	go func() {
+		err := p2p.run(ctx, clientStreamWriter)
+		if err != nil {
+			logrus.Warnf("P2PDownloader run error: %s", err)
+		}
+	}()
+	return downloader.NewRangeReader(clientStreamWriter, skip, offset, length, total, func() error {
+		cancel()
+		return clientStreamWriter.Close()
+	}), nil
+}
+
+// startPieceOf returns the piece which the offset of the file is in, and the offset in it.
+// The pieces of supernode wrap the content between their heads and tails, but the ones of
+// the source pattern don't. It's the first piece if the range isn't registered to supernode.
+func (p2p *P2PDownloader) startPieceOf(offset int64) (pieceNum int, skip int64) {
+	pieceContSize := int64(p2p.RegisterResult.PieceSize)
+	if p2p.RegisterResult.CDNSource != apiTypes.CdnSourceSource {
+		pieceContSize -= config.PieceMetaSize
+	}
+	if p2p.cfg.RV.StreamRangeOffset != offset || pieceContSize <= 0 {
+		return 0, offset
+	}
+	return int(offset / pieceContSize), offset % pieceContSize
+}
+
 func (p2p *P2PDownloader) run(ctx context.Context, pieceWriter PieceWriter) error {
 	var (
 		lastItem *Piece
@@ -202,6 +294,18 @@ func (p2p *P2PDownloader) run(ctx context.Context, pieceWriter PieceWriter) erro
 	go func() {
 		pieceWriter.Run(ctx)
 	}()
+	if r, ok := pieceWriter.(retargeter); ok {
+		p2p.retargeter = r
+	}
+
+	diagnostics.RegisterStatus("download", p2p.writeStatus)
+	defer diagnostics.UnregisterStatus("download")
+	defer p2p.peerPool.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go p2p.extendProgress(done)
+	go p2p.keepalive(done)
 
 	for {
 		goNext, lastItem = p2p.getItem(lastItem)
@@ -214,7 +318,16 @@ func (p2p *P2PDownloader) run(ctx context.Context, pieceWriter PieceWriter) erro
 		curItem.Content = nil
 		lastItem = nil
 
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p2p.waitResumed(ctx); err != nil {
+			return err
+		}
 		response, err := p2p.pullPieceTask(&curItem)
+		if response != nil {
+			p2p.updatePullStatus(response.Code)
+		}
 		if err != nil {
 			logrus.Errorf("failed to download piece: %v", err)
 			if p2p.cfg.BackSourceReason == 0 {
@@ -225,6 +338,9 @@ func (p2p *P2PDownloader) run(ctx context.Context, pieceWriter PieceWriter) erro
 			if code == constants.CodePeerContinue {
 				p2p.processPiece(response, &curItem)
 			} else if code == constants.CodePeerFinish {
+				if data := response.FinishData(); data != nil {
+					p2p.cfg.RV.Sha256 = data.Sha256
+				}
 				p2p.finishTask(ctx, pieceWriter)
 				return nil
 			} else {
@@ -257,12 +373,20 @@ func (p2p *P2PDownloader) GetTaskID() string {
 	return p2p.taskID
 }
 
+// GetPieceSize returns the piece size of the downloading task.
+func (p2p *P2PDownloader) GetPieceSize() int32 {
+	return p2p.pieceSizeHistory[1]
+}
+
 func (p2p *P2PDownloader) pullPieceTask(item *Piece) (
 	*types.PullPieceTaskResponse, error) {
 	var (
 		res *types.PullPieceTaskResponse
 		err error
 	)
+	if atomic.CompareAndSwapInt32(&p2p.registrationLost, 1, 0) {
+		return p2p.migrate(item, "registration is garbage-collected by supernode")
+	}
 	req := &types.PullPieceTaskRequest{
 		SrcCid: p2p.cfg.RV.Cid,
 		DstCid: item.DstCid,
@@ -281,6 +405,7 @@ func (p2p *P2PDownloader) pullPieceTask(item *Piece) (
 		if res.Code != constants.CodePeerWait {
 			break
 		}
+		p2p.cfg.RV.EventLog.Record(config.EventWait, item.Range, item.SuperNode, res.Msg)
 		if p2p.queue.Len() > 0 {
 			break
 		}
@@ -302,19 +427,116 @@ func (p2p *P2PDownloader) pullPieceTask(item *Piece) (
 	}
 
 	logrus.Errorf("pull piece task fail:%v and will migrate", res)
+	reason := fmt.Sprint(err)
+	if res != nil {
+		reason = res.String()
+	}
+	return p2p.migrate(item, reason)
+}
+
+// migrate registers the download again, to the same supernode or another one,
+// and then pulls the piece task of the item from the registered supernode.
+func (p2p *P2PDownloader) migrate(item *Piece, reason string) (*types.PullPieceTaskResponse, error) {
+	atomic.AddInt64(&p2p.cfg.RV.Retries, 1)
+	p2p.cfg.RV.EventLog.Record(config.EventMigrate, item.Range, item.SuperNode, reason)
 	var registerRes *regist.RegisterResult
 	registerRes, registerErr := p2p.Register.Register(p2p.cfg.RV.PeerPort)
 	if registerErr != nil {
 		return nil, registerErr
 	}
 	p2p.pieceSizeHistory[1] = registerRes.PieceSize
+	p2p.statusLock.Lock()
+	p2p.status.clockOffset = registerRes.ClockOffset
+	p2p.statusLock.Unlock()
 	item.Status = constants.TaskStatusStart
 	item.SuperNode = registerRes.Node
 	item.TaskID = registerRes.TaskID
-	printer.Println("migrated to node:" + item.SuperNode)
+	printer.Printf("migrated to node:%s", item.SuperNode)
 	return p2p.pullPieceTask(item)
 }
 
+// waitResumed blocks while the download is paused through the control API of
+// the peer server. The pieces being downloaded are still finished, and the ones
+// downloaded already are still served by the peer server during the pause.
+// The target path is still synced during the pause, so the download can be
+// moved while it's paused.
+func (p2p *P2PDownloader) waitResumed(ctx context.Context) error {
+	var pauseTime time.Time
+	for p2p.syncTarget(); p2p.paused(); p2p.syncTarget() {
+		if pauseTime.IsZero() {
+			pauseTime = time.Now()
+			printer.Printf("download paused")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p2p.pauseCheckInterval):
+		}
+	}
+	if !pauseTime.IsZero() {
+		printer.Printf("download resumed after paused %.3fs", time.Since(pauseTime).Seconds())
+	}
+	return nil
+}
+
+// paused checks whether the download is paused through the control API of
+// the peer server. It's regarded as not paused if the peer server fails to
+// answer, such as the one of an old version.
+func (p2p *P2PDownloader) paused() bool {
+	if time.Since(p2p.pauseCheckTime) < p2p.pauseCheckInterval {
+		return false
+	}
+	p2p.pauseCheckTime = time.Now()
+
+	paused, err := p2p.uploaderAPI.TaskPaused(p2p.cfg.PeerIP(), p2p.cfg.RV.PeerPort, p2p.taskFileName)
+	if err != nil {
+		logrus.Debugf("failed to check whether the download is paused: %v", err)
+		return false
+	}
+	return paused
+}
+
+// syncTarget reports the current target path to the peer server, and moves the download
+// to the target path requested through the control API of the peer server if there's a
+// new request. The download can't be moved if the piece writer isn't a retargeter, such
+// as the one of the stream mode.
+func (p2p *P2PDownloader) syncTarget() {
+	if p2p.retargeter == nil || time.Since(p2p.targetSyncTime) < p2p.pauseCheckInterval {
+		return
+	}
+	p2p.targetSyncTime = time.Now()
+
+	status, err := p2p.uploaderAPI.SyncTarget(p2p.cfg.PeerIP(), p2p.cfg.RV.PeerPort, &api.SyncTargetRequest{
+		TaskFileName: p2p.taskFileName,
+		Current:      p2p.targetFile,
+		RequestID:    p2p.targetRequestID,
+		Error:        p2p.targetError,
+	})
+	if err != nil {
+		logrus.Debugf("failed to sync the target with the peer server: %v", err)
+		return
+	}
+	if status.RequestID <= p2p.targetRequestID || status.Target == "" {
+		return
+	}
+
+	p2p.targetRequestID, p2p.targetError = status.RequestID, ""
+	if status.Target == p2p.targetFile {
+		return
+	}
+	if err := p2p.retargeter.Retarget(status.Target); err != nil {
+		logrus.Errorf("failed to move the download to %s: %v", status.Target, err)
+		printer.Printf("failed to move the download to %s: %v", status.Target, err)
+		p2p.targetError = err.Error()
+		return
+	}
+	printer.Printf("download moved from %s to %s", p2p.targetFile, status.Target)
+	p2p.targetFile = status.Target
+	p2p.statusLock.Lock()
+	p2p.status.output = p2p.cfg.Output
+	p2p.statusLock.Unlock()
+}
+
 // sleepInterval sleep for a while to wait for next pulling piece task until
 // receiving a notification which indicating that all the previous works have
 // been completed.
@@ -341,9 +563,13 @@ func (p2p *P2PDownloader) getPullRate(data *types.PullPieceTaskResponseContinueD
 
 	start := time.Now()
 
-	localRate := data.DownLink * 1024
-	if p2p.cfg.LocalLimit > 0 {
-		localRate = int(p2p.cfg.LocalLimit)
+	localRate := p2p.localRate(data)
+
+	// the boosted task doesn't share the total limit of the node with the others.
+	if data.BoostLink > 0 && localRate > 0 && atomic.LoadInt32(&p2p.cfg.RV.Deprioritized) == 0 {
+		logrus.Infof("pull rate result:%d boosted by supernode", localRate)
+		p2p.rateLimiter.SetRate(ratelimiter.TransRate(int64(localRate)))
+		return
 	}
 
 	// Calculate the download speed limit
@@ -353,7 +579,7 @@ func (p2p *P2PDownloader) getPullRate(data *types.PullPieceTaskResponseContinueD
 		RateLimit:    localRate,
 		TaskFileName: p2p.taskFileName,
 	}
-	resp, err := uploaderAPI.ParseRate(p2p.cfg.RV.LocalIP, p2p.cfg.RV.PeerPort, req)
+	resp, err := p2p.uploaderAPI.ParseRate(p2p.cfg.PeerIP(), p2p.cfg.RV.PeerPort, req)
 	if err != nil {
 		logrus.Errorf("failed to parse rate in pull rate: %v", err)
 		p2p.rateLimiter.SetRate(ratelimiter.TransRate(int64(localRate)))
@@ -370,6 +596,26 @@ func (p2p *P2PDownloader) getPullRate(data *types.PullPieceTaskResponseContinueD
 	p2p.rateLimiter.SetRate(ratelimiter.TransRate(int64(reqRate)))
 }
 
+// localRate returns the download rate limit of this task. The boost link in the piece task
+// raises the local limit while supernode boosts the task, and the down link is a cap told
+// by supernode, such as when its emergency brake throttles the P2P traffic.
+// The deprioritized download is limited to MinRate since nobody waits for it.
+func (p2p *P2PDownloader) localRate(data *types.PullPieceTaskResponseContinueData) int {
+	limit := int(p2p.cfg.LocalLimit)
+	if boost := data.BoostLink * 1024; limit > 0 && boost > limit {
+		limit = boost
+	}
+	if minRate := int(p2p.cfg.MinRate); minRate > 0 && atomic.LoadInt32(&p2p.cfg.RV.Deprioritized) == 1 &&
+		(limit <= 0 || minRate < limit) {
+		limit = minRate
+	}
+	localRate := data.DownLink * 1024
+	if limit > 0 && (localRate <= 0 || limit < localRate) {
+		localRate = limit
+	}
+	return localRate
+}
+
 func (p2p *P2PDownloader) startTask(data *types.PullPieceTaskResponseContinueData) {
 	powerClient := &PowerClient{
 		taskID:      p2p.taskID,
@@ -379,10 +625,12 @@ func (p2p *P2PDownloader) startTask(data *types.PullPieceTaskResponseContinueDat
 		queue:       p2p.queue,
 		clientQueue: p2p.clientQueue,
 		rateLimiter: p2p.rateLimiter,
-		downloadAPI: api.NewDownloadAPI(),
+		downloadAPI: api.NewDownloadAPIWithPool(p2p.peerPool),
 		headers:     p2p.headers,
 		cdnSource:   p2p.RegisterResult.CDNSource,
 		fileLength:  p2p.RegisterResult.FileLength,
+		peerSpeeds:  p2p.peerSpeeds,
+		peerPool:    p2p.peerPool,
 	}
 	if err := powerClient.Run(); err != nil && powerClient.ClientError() != nil {
 		p2p.API.ReportClientError(p2p.node, powerClient.ClientError())
@@ -436,6 +684,7 @@ func (p2p *P2PDownloader) getItem(latestItem *Piece) (bool, *Piece) {
 			runningCount++
 		}
 	}
+	p2p.updateStatus(runningCount)
 	if needMerge && (p2p.queue.Len() > 0 || runningCount > 2) {
 		return false, latestItem
 	}
@@ -17,7 +17,22 @@
 package downloader
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/regist"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
 
 	"github.com/go-check/check"
 )
@@ -61,3 +76,331 @@ func (s *P2PDownloaderTestSuite) TestWipeOutOfRange(c *check.C) {
 		c.Assert(result, check.Equals, v.expected)
 	}
 }
+
+func (s *P2PDownloaderTestSuite) TestWriteStatus(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.URL = "http://example.com/file"
+	cfg.LocalLimit = 1024
+	p2p := NewP2PDownloader(cfg, nil, nil, &regist.RegisterResult{Node: "node", TaskID: "task"})
+
+	p2p.pieceSet["0-9"] = true
+	p2p.pieceSet["10-19"] = false
+	p2p.total = 10
+	p2p.updateStatus(1)
+	p2p.updatePullStatus(constants.CodePeerContinue)
+
+	buf := &bytes.Buffer{}
+	p2p.writeStatus(buf)
+	out := buf.String()
+	for _, expected := range []string{
+		"url: http://example.com/file\n",
+		"supernode: node\n",
+		"taskID: task\n",
+		"pieces: 1 success, 1 running\n",
+		"downloaded: 10 bytes\n",
+		"queues: 1 items to process, 0 pieces to write\n",
+		"rate limit: 1024 bytes/s\n",
+	} {
+		c.Check(strings.Contains(out, expected), check.Equals, true, check.Commentf("%s not in %s", expected, out))
+	}
+}
+
+// pausedUploaderAPI answers the pause state from paused in order.
+type pausedUploaderAPI struct {
+	api.UploaderAPI
+	paused []bool
+}
+
+func (u *pausedUploaderAPI) TaskPaused(ip string, port int, taskFileName string) (bool, error) {
+	if len(u.paused) == 0 {
+		return false, nil
+	}
+	paused := u.paused[0]
+	u.paused = u.paused[1:]
+	return paused, nil
+}
+
+func (s *P2PDownloaderTestSuite) TestWaitResumed(c *check.C) {
+	p2p := NewP2PDownloader(config.NewConfig(), nil, nil, &regist.RegisterResult{Node: "node", TaskID: "task"})
+	p2p.pauseCheckInterval = time.Millisecond
+
+	u := &pausedUploaderAPI{paused: []bool{true, true, false}}
+	p2p.uploaderAPI = u
+	c.Assert(p2p.waitResumed(context.Background()), check.IsNil)
+	c.Check(u.paused, check.HasLen, 0)
+
+	// it isn't checked again within the interval
+	p2p.pauseCheckInterval = time.Hour
+	u.paused = []bool{true}
+	c.Assert(p2p.waitResumed(context.Background()), check.IsNil)
+	c.Check(u.paused, check.HasLen, 1)
+
+	p2p.pauseCheckInterval = time.Millisecond
+	p2p.pauseCheckTime = time.Time{}
+	u.paused = []bool{true, true, true, true}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Check(p2p.waitResumed(ctx), check.Equals, context.Canceled)
+}
+
+// targetUploaderAPI answers the target status and records the synced requests.
+type targetUploaderAPI struct {
+	api.UploaderAPI
+	status api.TargetStatus
+	reqs   []api.SyncTargetRequest
+}
+
+func (u *targetUploaderAPI) SyncTarget(ip string, port int, req *api.SyncTargetRequest) (*api.TargetStatus, error) {
+	u.reqs = append(u.reqs, *req)
+	status := u.status
+	return &status, nil
+}
+
+// fakeRetargeter records the targets moved to, and fails the ones in fail.
+type fakeRetargeter struct {
+	targets []string
+	fail    string
+}
+
+func (r *fakeRetargeter) Retarget(target string) error {
+	if target == r.fail {
+		return fmt.Errorf("cannot move to %s", target)
+	}
+	r.targets = append(r.targets, target)
+	return nil
+}
+
+func (s *P2PDownloaderTestSuite) TestSyncTarget(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.RV.RealTarget = "/a"
+	p2p := NewP2PDownloader(cfg, nil, nil, &regist.RegisterResult{Node: "node", TaskID: "task"})
+	p2p.pauseCheckInterval = 0
+	u := &targetUploaderAPI{}
+	r := &fakeRetargeter{fail: "/c"}
+	p2p.uploaderAPI = u
+
+	// nothing is synced if the piece writer can't move the download
+	p2p.syncTarget()
+	c.Check(u.reqs, check.HasLen, 0)
+
+	p2p.retargeter = r
+	p2p.syncTarget()
+	u.status = api.TargetStatus{Target: "/b", RequestID: 1}
+	p2p.syncTarget()
+	p2p.syncTarget()
+	c.Check(r.targets, check.DeepEquals, []string{"/b"})
+	c.Check(p2p.targetFile, check.Equals, "/b")
+
+	u.status = api.TargetStatus{Target: "/c", RequestID: 2}
+	p2p.syncTarget()
+	p2p.syncTarget()
+	c.Check(r.targets, check.DeepEquals, []string{"/b"})
+	c.Check(p2p.targetFile, check.Equals, "/b")
+
+	c.Assert(u.reqs, check.HasLen, 5)
+	c.Check(u.reqs[0], check.DeepEquals, api.SyncTargetRequest{Current: "/a"})
+	c.Check(u.reqs[2], check.DeepEquals, api.SyncTargetRequest{Current: "/b", RequestID: 1})
+	c.Check(u.reqs[4], check.DeepEquals, api.SyncTargetRequest{Current: "/b", RequestID: 2, Error: "cannot move to /c"})
+}
+
+func (s *P2PDownloaderTestSuite) TestRunStreamRange(c *check.C) {
+	p2p := NewP2PDownloader(config.NewConfig(), nil, nil, &regist.RegisterResult{Node: "node", TaskID: "task",
+		FileLength: 10})
+	_, err := p2p.RunStreamRange(context.Background(), 0, -1)
+	c.Check(err, check.ErrorMatches, "streamMode disable.*")
+
+	p2p.streamMode = true
+	_, err = p2p.RunStreamRange(context.Background(), 11, -1)
+	c.Check(errortypes.IsRangeNotSatisfiable(err), check.Equals, true)
+	_, err = p2p.RunStreamRange(context.Background(), -1, 2)
+	c.Check(errortypes.IsRangeNotSatisfiable(err), check.Equals, true)
+	// there's no byte at the offset of the file length
+	_, err = p2p.RunStreamRange(context.Background(), 10, -1)
+	c.Check(errortypes.IsRangeNotSatisfiable(err), check.Equals, true)
+}
+
+func (s *P2PDownloaderTestSuite) TestStartPieceOf(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.RV.StreamRangeOffset = 250
+	p2p := NewP2PDownloader(cfg, nil, nil, &regist.RegisterResult{Node: "node", TaskID: "task",
+		FileLength: 1000, PieceSize: 100 + config.PieceMetaSize, CDNSource: apiTypes.CdnSourceSupernode})
+	pieceNum, skip := p2p.startPieceOf(250)
+	c.Check(pieceNum, check.Equals, 2)
+	c.Check(skip, check.Equals, int64(50))
+
+	// the pieces of the source pattern aren't wrapped
+	p2p.RegisterResult.PieceSize, p2p.RegisterResult.CDNSource = 100, apiTypes.CdnSourceSource
+	pieceNum, skip = p2p.startPieceOf(250)
+	c.Check(pieceNum, check.Equals, 2)
+	c.Check(skip, check.Equals, int64(50))
+
+	// all pieces are scheduled if the range isn't registered
+	pieceNum, skip = p2p.startPieceOf(300)
+	c.Check(pieceNum, check.Equals, 0)
+	c.Check(skip, check.Equals, int64(300))
+}
+
+func (s *P2PDownloaderTestSuite) TestExtendProgress(c *check.C) {
+	requests := make(chan *apiTypes.ProgressExtensionRequest, 10)
+	var resp *apiTypes.ProgressExtensionResponse
+	var respErr error
+	supernodeAPI := &helper.MockSupernodeAPI{
+		ExtendProgressFunc: func(node string, req *apiTypes.ProgressExtensionRequest) (*apiTypes.ProgressExtensionResponse, error) {
+			requests <- req
+			return resp, respErr
+		},
+	}
+	cfg := config.NewConfig()
+	cfg.RV.Cid = "cid"
+	p2p := NewP2PDownloader(cfg, supernodeAPI, nil, &regist.RegisterResult{Node: "node", TaskID: "task"})
+	p2p.extendInterval = time.Millisecond
+
+	run := func() chan struct{} {
+		exited := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			p2p.extendProgress(done)
+			close(exited)
+		}()
+		time.AfterFunc(100*time.Millisecond, func() { close(done) })
+		return exited
+	}
+
+	// nothing is requested before any byte is downloaded
+	<-run()
+	c.Check(requests, check.HasLen, 0)
+
+	p2p.total = 100
+	p2p.updateStatus(0)
+
+	// supernode doesn't limit the progress
+	resp = &apiTypes.ProgressExtensionResponse{Granted: true}
+	<-run()
+	c.Assert(requests, check.HasLen, 1)
+	req := <-requests
+	c.Check(req.TaskID, check.Equals, "task")
+	c.Check(req.CID, check.Equals, "cid")
+	c.Check(req.CompletedBytes, check.Equals, int64(100))
+
+	// supernode doesn't support the extensions
+	respErr = fmt.Errorf("404:not found")
+	<-run()
+	c.Check(requests, check.HasLen, 1)
+}
+
+func (s *P2PDownloaderTestSuite) TestKeepalive(c *check.C) {
+	requests := make(chan *apiTypes.PeerKeepaliveRequest, 10)
+	var resp *apiTypes.PeerKeepaliveResponse
+	supernodeAPI := &helper.MockSupernodeAPI{
+		KeepaliveFunc: func(node string, req *apiTypes.PeerKeepaliveRequest) (*apiTypes.PeerKeepaliveResponse, error) {
+			requests <- req
+			return resp, nil
+		},
+	}
+	cfg := config.NewConfig()
+	cfg.RV.Cid = "cid"
+	p2p := NewP2PDownloader(cfg, supernodeAPI, nil, &regist.RegisterResult{Node: "node", TaskID: "task"})
+	p2p.keepaliveInterval = time.Millisecond
+
+	run := func() {
+		done := make(chan struct{})
+		time.AfterFunc(100*time.Millisecond, func() { close(done) })
+		p2p.keepalive(done)
+	}
+
+	// nothing is sent before the status is updated
+	run()
+	c.Check(requests, check.HasLen, 0)
+
+	p2p.updateStatus(0)
+	resp = &apiTypes.PeerKeepaliveResponse{Registered: true, ExpireAfter: 180}
+	run()
+	c.Assert(requests, check.HasLen, 1)
+	req := <-requests
+	c.Check(req.TaskID, check.Equals, "task")
+	c.Check(req.CID, check.Equals, "cid")
+	c.Check(p2p.registrationLost, check.Equals, int32(0))
+
+	// no more keepalive is sent once the registration is lost
+	resp = &apiTypes.PeerKeepaliveResponse{}
+	run()
+	c.Check(requests, check.HasLen, 1)
+	<-requests
+	c.Check(p2p.registrationLost, check.Equals, int32(1))
+
+	// supernode doesn't support the keepalives
+	p2p.registrationLost = 0
+	resp = nil
+	run()
+	c.Check(requests, check.HasLen, 1)
+}
+
+func (s *P2PDownloaderTestSuite) TestMigrateAfterRegistrationLost(c *check.C) {
+	var pulled *types.PullPieceTaskRequest
+	var pulledNode string
+	supernodeAPI := &helper.MockSupernodeAPI{
+		PullFunc: func(ip string, req *types.PullPieceTaskRequest) (*types.PullPieceTaskResponse, error) {
+			pulled, pulledNode = req, ip
+			return &types.PullPieceTaskResponse{BaseResponse: &types.BaseResponse{Code: constants.CodePeerContinue}}, nil
+		},
+	}
+	register := &mockRegister{result: &regist.RegisterResult{Node: "node2", TaskID: "task2"}}
+	cfg := config.NewConfig()
+	p2p := NewP2PDownloader(cfg, supernodeAPI, register, &regist.RegisterResult{Node: "node", TaskID: "task"})
+	p2p.registrationLost = 1
+
+	item := NewPiece("task", "node", "", "0-9", constants.ResultSemiSuc, constants.TaskStatusRunning, "")
+	_, err := p2p.pullPieceTask(item)
+	c.Assert(err, check.IsNil)
+	c.Check(register.calls, check.Equals, 1)
+	c.Check(pulledNode, check.Equals, "node2")
+	c.Check(pulled.TaskID, check.Equals, "task2")
+	c.Check(pulled.Status, check.Equals, constants.TaskStatusStart)
+	c.Check(p2p.registrationLost, check.Equals, int32(0))
+	c.Check(cfg.RV.Retries, check.Equals, int64(1))
+}
+
+type mockRegister struct {
+	result *regist.RegisterResult
+	calls  int
+}
+
+func (r *mockRegister) Register(peerPort int) (*regist.RegisterResult, *errortypes.DfError) {
+	r.calls++
+	return r.result, nil
+}
+
+func (s *P2PDownloaderTestSuite) TestLocalRate(c *check.C) {
+	var cases = []struct {
+		localLimit int
+		downLink   int
+		boostLink  int
+		expected   int
+	}{
+		{localLimit: 2048, downLink: 0, expected: 2048},
+		{localLimit: 2048, downLink: 1, expected: 1024},
+		{localLimit: 2048, downLink: 4, expected: 2048},
+		{localLimit: 0, downLink: 1, expected: 1024},
+		{localLimit: 2048, boostLink: 8, expected: 8192},
+		{localLimit: 2048, boostLink: 1, expected: 2048},
+		{localLimit: 2048, downLink: 4, boostLink: 8, expected: 4096},
+		{localLimit: 0, boostLink: 8, expected: 0},
+	}
+
+	for _, v := range cases {
+		cfg := config.NewConfig()
+		cfg.LocalLimit = rate.Rate(v.localLimit)
+		p2p := NewP2PDownloader(cfg, nil, nil, &regist.RegisterResult{Node: "node", TaskID: "task"})
+		c.Check(p2p.localRate(&types.PullPieceTaskResponseContinueData{DownLink: v.downLink, BoostLink: v.boostLink}), check.Equals, v.expected,
+			check.Commentf("%+v", v))
+	}
+
+	// the deprioritized download is limited to the min rate even if it's boosted
+	cfg := config.NewConfig()
+	cfg.LocalLimit = rate.Rate(8192)
+	cfg.MinRate = rate.Rate(1024)
+	cfg.RV.Deprioritized = 1
+	p2p := NewP2PDownloader(cfg, nil, nil, &regist.RegisterResult{Node: "node", TaskID: "task"})
+	c.Check(p2p.localRate(&types.PullPieceTaskResponseContinueData{BoostLink: 16}), check.Equals, 1024)
+	c.Check(p2p.localRate(&types.PullPieceTaskResponseContinueData{DownLink: 512}), check.Equals, 1024)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// speedWeight is the weight of the latest observed throughput
+	// in the moving average of the throughput of a peer.
+	speedWeight = 0.3
+
+	// pieceTimeoutFactor is the multiple of the expected time to download
+	// a piece which the deadline tolerates before giving up the peer.
+	pieceTimeoutFactor = 4
+
+	// pieceTimeoutReserved is added to the deadline to cover the latency
+	// of establishing the connection.
+	pieceTimeoutReserved = time.Second
+
+	minPieceTimeout = 3 * time.Second
+	maxPieceTimeout = 2 * time.Minute
+)
+
+// peerSpeeds records the throughput observed from every peer during the download,
+// the deadline of a piece is computed from its size and the throughput of the peer
+// it's downloaded from.
+type peerSpeeds struct {
+	sync.Mutex
+	// speeds maps the address of a peer to the moving average of
+	// its throughput in bytes per second.
+	speeds map[string]float64
+}
+
+func newPeerSpeeds() *peerSpeeds {
+	return &peerSpeeds{speeds: make(map[string]float64)}
+}
+
+// observe updates the throughput of the peer with a successful download of n bytes.
+func (ps *peerSpeeds) observe(peer string, n int64, cost time.Duration) {
+	if ps == nil || n <= 0 || cost <= 0 {
+		return
+	}
+	speed := float64(n) / cost.Seconds()
+
+	ps.Lock()
+	defer ps.Unlock()
+	if old, ok := ps.speeds[peer]; ok {
+		speed = old*(1-speedWeight) + speed*speedWeight
+	}
+	ps.speeds[peer] = speed
+}
+
+// fail halves the throughput of the peer after a failed download, so the
+// deadline of the next piece from it is doubled rather than failing again
+// for the same reason.
+func (ps *peerSpeeds) fail(peer string) {
+	if ps == nil {
+		return
+	}
+
+	ps.Lock()
+	defer ps.Unlock()
+	if speed, ok := ps.speeds[peer]; ok {
+		ps.speeds[peer] = speed / 2
+	}
+}
+
+// timeout returns the deadline to download a piece of the given size from the peer.
+// The fallback is returned if nothing has been observed from the peer yet.
+func (ps *peerSpeeds) timeout(peer string, pieceSize int64, fallback time.Duration) time.Duration {
+	if ps == nil || pieceSize <= 0 {
+		return fallback
+	}
+
+	ps.Lock()
+	speed, ok := ps.speeds[peer]
+	ps.Unlock()
+	if !ok || speed <= 0 {
+		return fallback
+	}
+
+	expected := time.Duration(float64(pieceSize) / speed * float64(time.Second))
+	timeout := expected*pieceTimeoutFactor + pieceTimeoutReserved
+	if timeout < minPieceTimeout {
+		return minPieceTimeout
+	}
+	if timeout > maxPieceTimeout {
+		return maxPieceTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"math"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+type PeerSpeedsTestSuite struct{}
+
+func init() {
+	check.Suite(&PeerSpeedsTestSuite{})
+}
+
+func (s *PeerSpeedsTestSuite) TestTimeout(c *check.C) {
+	var nilSpeeds *peerSpeeds
+	c.Check(nilSpeeds.timeout("a", 100, time.Minute), check.Equals, time.Minute)
+
+	ps := newPeerSpeeds()
+	c.Check(ps.timeout("a", 100, time.Minute), check.Equals, time.Minute)
+
+	// 1MB/s: a 4MB piece is expected in 4s
+	ps.observe("a", 1024*1024, time.Second)
+	c.Check(ps.timeout("a", 4*1024*1024, time.Minute), check.Equals,
+		4*time.Second*pieceTimeoutFactor+pieceTimeoutReserved)
+	c.Check(ps.timeout("a", 1024, time.Minute), check.Equals, minPieceTimeout)
+	c.Check(ps.timeout("a", 1024*1024*1024, time.Minute), check.Equals, maxPieceTimeout)
+
+	ps.fail("a")
+	c.Check(ps.timeout("a", 4*1024*1024, time.Minute), check.Equals,
+		8*time.Second*pieceTimeoutFactor+pieceTimeoutReserved)
+
+	ps.observe("b", 1024*1024, time.Second)
+	ps.observe("b", 2*1024*1024, time.Second)
+	ps.Lock()
+	c.Check(math.Abs(ps.speeds["b"]-1024*1024*(1+speedWeight)) < 1, check.Equals, true)
+	ps.Unlock()
+}
@@ -19,6 +19,7 @@ package downloader
 import (
 	"bytes"
 	"encoding/json"
+	"sync/atomic"
 
 	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
@@ -59,6 +60,10 @@ type Piece struct {
 
 	// autoReset automatically reset content after reading.
 	autoReset bool
+
+	// refs is the number of the extra writers sharing the content,
+	// the content is reset only after all of them have released it.
+	refs int32
 }
 
 // RawContent returns raw contents,
@@ -66,11 +71,6 @@ type Piece struct {
 func (p *Piece) RawContent(noWrapper bool) *bytes.Buffer {
 	contents := p.Content.Bytes()
 	length := len(contents)
-	defer func() {
-		if p.autoReset {
-			p.ResetContent()
-		}
-	}()
 
 	if noWrapper {
 		return bytes.NewBuffer(contents[:])
@@ -81,6 +81,19 @@ func (p *Piece) RawContent(noWrapper bool) *bytes.Buffer {
 	return nil
 }
 
+// retain adds an extra writer which shares the content of the piece.
+func (p *Piece) retain() {
+	atomic.AddInt32(&p.refs, 1)
+}
+
+// release is called after the content has been read by a writer,
+// it resets the content if it's the last one when autoReset is set.
+func (p *Piece) release() {
+	if p.autoReset && atomic.AddInt32(&p.refs, -1) < 0 {
+		p.ResetContent()
+	}
+}
+
 // ContentLength returns the content length.
 func (p *Piece) ContentLength() int64 {
 	if p.length <= 0 && p.Content != nil {
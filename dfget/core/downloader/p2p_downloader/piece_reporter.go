@@ -0,0 +1,231 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"strings"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/pkg/queue"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxReportBackoff bounds how much the interval and the size of the batches grow
+// when supernode responds slowly, which keeps the scheduling of supernode fresh enough.
+const maxReportBackoff = 8
+
+// pieceReporter reports the pieces written successfully to supernode.
+// If batchSize is greater than 1, the pieces are reported in batches,
+// which reduces the requests to supernode by an order of magnitude for the tasks
+// with many pieces. A smaller batch is reported if no more piece comes within the interval.
+//
+// Only one batch is in flight at a time, and the pieces written meanwhile are
+// accumulated for the next batch. If a batch takes longer than the interval to
+// report, the interval is doubled up to maxReportBackoff times, so the reports back
+// off when supernode is overloaded, and they recover when it responds quickly again.
+type pieceReporter struct {
+	api         api.SupernodeAPI
+	cid         string
+	batchSize   int
+	interval    time.Duration
+	policy      retry.Policy
+	notifyQueue queue.Queue
+
+	pieces chan *Piece
+	done   chan struct{}
+
+	// current is the interval adapted to the latency of supernode.
+	current time.Duration
+
+	// unsupported indicates that the supernode doesn't support the batch reports,
+	// and the pieces are reported one by one then.
+	unsupported bool
+}
+
+func newPieceReporter(api api.SupernodeAPI, cid string, batchSize int, interval time.Duration,
+	policy retry.Policy, notifyQueue queue.Queue) *pieceReporter {
+	if interval <= 0 {
+		interval = config.DefaultReportInterval
+	}
+	r := &pieceReporter{
+		api:         api,
+		cid:         cid,
+		batchSize:   batchSize,
+		interval:    interval,
+		current:     interval,
+		policy:      policy,
+		notifyQueue: notifyQueue,
+	}
+	if batchSize > 1 {
+		r.pieces = make(chan *Piece, batchSize)
+		r.done = make(chan struct{})
+		go r.run()
+	}
+	return r
+}
+
+// report reports the piece to supernode asynchronously.
+func (r *pieceReporter) report(piece *Piece, cost time.Duration) {
+	if r.pieces == nil {
+		go sendSuccessPiece(r.api, r.cid, piece, cost, r.policy, r.notifyQueue)
+		return
+	}
+	r.pieces <- piece
+}
+
+// close reports the remaining pieces and waits until they are reported.
+func (r *pieceReporter) close() {
+	if r.pieces == nil {
+		return
+	}
+	close(r.pieces)
+	<-r.done
+}
+
+func (r *pieceReporter) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var (
+		pending []*Piece
+		// oldest is the time when the first pending piece is written
+		oldest time.Time
+		// sent receives the cost of the batch in flight, it's nil if there is none
+		sent chan time.Duration
+	)
+	start := func() {
+		batch := pending
+		pending = nil
+		sent = make(chan time.Duration, 1)
+		go func(sent chan<- time.Duration) {
+			begin := time.Now()
+			r.flush(batch)
+			sent <- time.Since(begin)
+		}(sent)
+	}
+
+	for {
+		select {
+		case piece, ok := <-r.pieces:
+			if !ok {
+				if sent != nil {
+					r.adapt(<-sent)
+				}
+				r.flush(pending)
+				return
+			}
+			if len(pending) == 0 {
+				oldest = time.Now()
+			}
+			pending = append(pending, piece)
+			if sent == nil && len(pending) >= r.batchSize {
+				start()
+			}
+		case <-ticker.C:
+			if sent == nil && len(pending) > 0 && time.Since(oldest) >= r.current {
+				start()
+			}
+		case cost := <-sent:
+			sent = nil
+			r.adapt(cost)
+			if len(pending) >= r.batchSize {
+				start()
+			}
+		}
+	}
+}
+
+// adapt adjusts the interval of the batches according to the cost of the last one.
+func (r *pieceReporter) adapt(cost time.Duration) {
+	if cost > r.interval {
+		if r.current *= 2; r.current > r.interval*maxReportBackoff {
+			r.current = r.interval * maxReportBackoff
+		}
+		logrus.Debugf("reporting pieces cost %.3fs, back off the interval to %.3fs", cost.Seconds(), r.current.Seconds())
+		return
+	}
+	if r.current /= 2; r.current < r.interval {
+		r.current = r.interval
+	}
+}
+
+// flush reports the pieces of the same supernode and task in one request,
+// and at most batchSize*maxReportBackoff pieces are reported in a request.
+// The task may change after migrating to another supernode.
+func (r *pieceReporter) flush(batch []*Piece) {
+	for len(batch) > 0 {
+		n := 1
+		for n < len(batch) && n < r.batchSize*maxReportBackoff &&
+			batch[n].SuperNode == batch[0].SuperNode && batch[n].TaskID == batch[0].TaskID {
+			n++
+		}
+		r.send(batch[:n])
+		batch = batch[n:]
+	}
+}
+
+func (r *pieceReporter) send(pieces []*Piece) {
+	node := pieces[0].SuperNode
+	req := &apiTypes.PieceSuccessRequest{
+		TaskID: pieces[0].TaskID,
+		CID:    r.cid,
+	}
+	for _, p := range pieces {
+		req.Pieces = append(req.Pieces, &apiTypes.PieceSuccess{DstCID: p.DstCid, PieceRange: p.Range})
+	}
+
+	if !r.unsupported {
+		err := r.policy.Do(func(attempt int) error {
+			_, err := r.api.ReportPieces(node, req)
+			if err == nil {
+				return nil
+			}
+			if strings.HasPrefix(err.Error(), "404:") {
+				logrus.Warnf("supernode %s doesn't support reporting pieces in a batch: %v", node, err)
+				r.unsupported = true
+				return retry.Stop(err)
+			}
+			logrus.Warnf("failed to report %d pieces of task %s (%d/%d): %v",
+				len(pieces), req.TaskID, attempt, r.policy.MaxAttempts, err)
+			return err
+		})
+		if err == nil {
+			r.notify()
+			return
+		}
+	}
+
+	for _, p := range pieces {
+		sendSuccessPiece(r.api, r.cid, p, 0, r.policy, nil)
+	}
+	r.notify()
+}
+
+// notify notifies the downloader to pull the next pieces. It's only a hint,
+// so it's dropped if the queue is full.
+func (r *pieceReporter) notify() {
+	if r.notifyQueue != nil {
+		r.notifyQueue.PutTimeout("success", 0)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/queue"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
+
+	"github.com/go-check/check"
+)
+
+type PieceReporterTestSuite struct {
+}
+
+func init() {
+	check.Suite(&PieceReporterTestSuite{})
+}
+
+func (s *PieceReporterTestSuite) TestReport(c *check.C) {
+	var (
+		lock    sync.Mutex
+		batches [][]string
+		single  []string
+	)
+	supernodeAPI := &helper.MockSupernodeAPI{
+		ReportPiecesFunc: func(node string, req *apiTypes.PieceSuccessRequest) (*types.BaseResponse, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			var ranges []string
+			for _, p := range req.Pieces {
+				ranges = append(ranges, node+"/"+p.PieceRange)
+			}
+			batches = append(batches, ranges)
+			return &types.BaseResponse{Code: constants.CodeGetPieceReport}, nil
+		},
+		ReportFunc: func(node string, req *types.ReportPieceRequest) (*types.BaseResponse, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			single = append(single, req.PieceRange)
+			return &types.BaseResponse{Code: constants.CodeGetPieceReport}, nil
+		},
+	}
+	notifyQueue := queue.NewQueue(1)
+
+	r := newPieceReporter(supernodeAPI, "cid", 2, 0, retry.Policy{}, notifyQueue)
+	for i, node := range []string{"n1", "n1", "n1", "n2"} {
+		r.report(&Piece{SuperNode: node, TaskID: "task", Range: fmt.Sprint(i)}, 0)
+	}
+	r.close()
+	c.Check(batches, check.DeepEquals, [][]string{{"n1/0", "n1/1"}, {"n1/2"}, {"n2/3"}})
+	c.Check(single, check.HasLen, 0)
+	c.Check(notifyQueue.Len(), check.Equals, 1)
+
+	// the pieces are reported one by one if supernode doesn't support the batch reports
+	batches = nil
+	supernodeAPI.ReportPiecesFunc = func(node string, req *apiTypes.PieceSuccessRequest) (*types.BaseResponse, error) {
+		return nil, fmt.Errorf("404:not found")
+	}
+	r = newPieceReporter(supernodeAPI, "cid", 2, 0, retry.Policy{}, notifyQueue)
+	r.report(&Piece{SuperNode: "n1", TaskID: "task", Range: "0"}, 0)
+	r.report(&Piece{SuperNode: "n1", TaskID: "task", Range: "1"}, 0)
+	r.report(&Piece{SuperNode: "n1", TaskID: "task", Range: "2"}, 0)
+	r.close()
+	c.Check(single, check.DeepEquals, []string{"0", "1", "2"})
+	c.Check(r.unsupported, check.Equals, true)
+}
+
+func (s *PieceReporterTestSuite) TestAdapt(c *check.C) {
+	r := &pieceReporter{interval: 10 * time.Millisecond, current: 10 * time.Millisecond}
+	for i := 0; i < 5; i++ {
+		r.adapt(time.Second)
+	}
+	c.Check(r.current, check.Equals, 80*time.Millisecond)
+
+	r.adapt(time.Millisecond)
+	c.Check(r.current, check.Equals, 40*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		r.adapt(time.Millisecond)
+	}
+	c.Check(r.current, check.Equals, 10*time.Millisecond)
+}
+
+func (s *PieceReporterTestSuite) TestReportBackPressure(c *check.C) {
+	var (
+		lock    sync.Mutex
+		batches []int
+	)
+	release := make(chan struct{})
+	supernodeAPI := &helper.MockSupernodeAPI{
+		ReportPiecesFunc: func(node string, req *apiTypes.PieceSuccessRequest) (*types.BaseResponse, error) {
+			lock.Lock()
+			batches = append(batches, len(req.Pieces))
+			first := len(batches) == 1
+			lock.Unlock()
+			if first {
+				<-release
+			}
+			return &types.BaseResponse{Code: constants.CodeGetPieceReport}, nil
+		},
+	}
+
+	// the pieces written while the first batch is in flight are accumulated into the next one
+	r := newPieceReporter(supernodeAPI, "cid", 2, time.Hour, retry.Policy{}, nil)
+	for i := 0; i < 7; i++ {
+		r.report(&Piece{SuperNode: "n1", TaskID: "task", Range: fmt.Sprint(i)}, 0)
+	}
+	close(release)
+	r.close()
+
+	total := 0
+	for _, n := range batches {
+		total += n
+	}
+	c.Check(batches[0], check.Equals, 2)
+	c.Check(total, check.Equals, 7)
+	c.Check(len(batches) < 7, check.Equals, true)
+}
+
+func (s *PieceReporterTestSuite) TestReportInterval(c *check.C) {
+	reported := make(chan int, 1)
+	supernodeAPI := &helper.MockSupernodeAPI{
+		ReportPiecesFunc: func(node string, req *apiTypes.PieceSuccessRequest) (*types.BaseResponse, error) {
+			reported <- len(req.Pieces)
+			return &types.BaseResponse{Code: constants.CodeGetPieceReport}, nil
+		},
+	}
+	r := newPieceReporter(supernodeAPI, "cid", 8, 10*time.Millisecond, retry.Policy{}, nil)
+	defer r.close()
+	r.report(&Piece{SuperNode: "n1", TaskID: "task", Range: "0"}, 0)
+	select {
+	case n := <-reported:
+		c.Check(n, check.Equals, 1)
+	case <-time.After(time.Second):
+		c.Fatal("the piece isn't reported within the interval")
+	}
+}
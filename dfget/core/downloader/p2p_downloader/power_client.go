@@ -18,10 +18,13 @@ package downloader
 
 import (
 	"bytes"
+	"crypto/md5"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
@@ -36,6 +39,7 @@ import (
 	"github.com/dragonflyoss/Dragonfly/pkg/pool"
 	"github.com/dragonflyoss/Dragonfly/pkg/queue"
 	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
 
 	"github.com/sirupsen/logrus"
 )
@@ -81,13 +85,29 @@ type PowerClient struct {
 
 	cdnSource  apiTypes.CdnSource
 	fileLength int64
+
+	// peerPool checks the health of the peers before downloading from them,
+	// the peers are connected directly if it's nil.
+	peerPool *api.PeerPool
+
+	// peerSpeeds records the throughput of the peers to compute
+	// the deadline of the piece.
+	peerSpeeds *peerSpeeds
+
+	// peerUnavailable indicates that the peer is found unavailable before downloading,
+	// and the piece isn't retried from it then.
+	peerUnavailable bool
+
+	// partial is the data of the piece received before the last attempt is interrupted,
+	// and only the rest of the piece is requested from the peer when retrying.
+	partial *pool.Buffer
 }
 
 // Run starts run the task.
 func (pc *PowerClient) Run() error {
 	startTime := time.Now()
 
-	content, err := pc.downloadPiece()
+	content, err := pc.downloadPieceWithRetry()
 
 	timeDuring := time.Since(startTime).Seconds()
 	logrus.Debugf("client range:%s cost:%.3f from peer:%s:%d, readCost:%.3f, length:%d",
@@ -97,6 +117,8 @@ func (pc *PowerClient) Run() error {
 	if err != nil {
 		logrus.Errorf("failed to read piece cont(%s) from dst:%s:%d, wait 20 ms: %v",
 			pc.pieceTask.Range, pc.pieceTask.PeerIP, pc.pieceTask.PeerPort, err)
+		atomic.AddInt64(&pc.cfg.RV.Retries, 1)
+		pc.cfg.RV.EventLog.Record(config.EventPieceError, pc.pieceTask.Range, pc.peerAddr(), err.Error())
 		time.AfterFunc(time.Millisecond*20, func() {
 			pc.queue.Put(pc.failPiece())
 		})
@@ -114,21 +136,95 @@ func (pc *PowerClient) ClientError() *types.ClientErrorRequest {
 	return pc.clientError
 }
 
+// peerAddr returns the address of the peer which the piece is downloaded from.
+func (pc *PowerClient) peerAddr() string {
+	return fmt.Sprintf("%s:%d", pc.pieceTask.PeerIP, pc.pieceTask.PeerPort)
+}
+
+// downloadPieceWithRetry uses the piece pushed by another peer if it's received, or downloads
+// the piece from the edge caches advertised by supernode if there're any, or from the peer
+// with the retry policy.
+func (pc *PowerClient) downloadPieceWithRetry() (content *pool.Buffer, err error) {
+	if content = pc.downloadFromPushed(); content != nil {
+		return content, nil
+	}
+	if content = pc.downloadFromEdges(); content != nil {
+		return content, nil
+	}
+	policy := pc.cfg.Retry
+	err = policy.Do(func(attempt int) error {
+		var e error
+		if content, e = pc.downloadPiece(); e == nil {
+			return nil
+		}
+		if !pc.retryable(e) {
+			return retry.Stop(e)
+		}
+		if attempt < policy.MaxAttempts {
+			atomic.AddInt64(&pc.cfg.RV.Retries, 1)
+			pc.cfg.RV.EventLog.Record(config.EventRetry, pc.pieceTask.Range, pc.peerAddr(), e.Error())
+			logrus.Warnf("failed to download piece %s from dst:%s:%d (%d/%d) and will retry: %v",
+				pc.pieceTask.Range, pc.pieceTask.PeerIP, pc.pieceTask.PeerPort, attempt, policy.MaxAttempts, e)
+		}
+		return e
+	})
+	if pc.partial != nil {
+		pool.ReleaseBuffer(pc.partial)
+		pc.partial = nil
+	}
+	return content, err
+}
+
+// retryable returns whether the failed piece is worth retrying from the same peer.
+// The errors of the data or the peer itself are reported to supernode without retrying,
+// so that the piece is scheduled to another peer.
+func (pc *PowerClient) retryable(err error) bool {
+	if pc.peerUnavailable || pc.clientError != nil {
+		return false
+	}
+	switch e := err.(type) {
+	case errortypes.DfError:
+		return false
+	case *errortypes.DfError:
+		return e.Code >= http.StatusInternalServerError
+	}
+	return true
+}
+
 func (pc *PowerClient) downloadPiece() (content *pool.Buffer, e error) {
 	dstIP := pc.pieceTask.PeerIP
 	peerPort := pc.pieceTask.PeerPort
+	if pc.overTLS() && pc.cfg.CDNTLS.Port > 0 {
+		peerPort = pc.cfg.CDNTLS.Port
+	}
 
 	// check that the target download peer is available
 	if dstIP != "" && dstIP != pc.node {
-		if _, e = httputils.CheckConnect(dstIP, peerPort, -1); e != nil {
+		if e = pc.checkPeer(dstIP, peerPort); e != nil {
+			pc.peerUnavailable = true
 			return nil, e
 		}
 	}
 
 	// send download request
 	startTime := time.Now()
+	peer := fmt.Sprintf("%s:%d", dstIP, peerPort)
+	defer func() {
+		if e != nil {
+			pc.peerSpeeds.fail(peer)
+		}
+	}()
 	timeout := netutils.CalculateTimeout(int64(pc.pieceTask.PieceSize), pc.cfg.MinRate, config.DefaultMinRate, 10*time.Second)
-	resp, err := pc.downloadAPI.Download(dstIP, peerPort, pc.createDownloadRequest(), timeout)
+	timeout = pc.peerSpeeds.timeout(peer, int64(pc.pieceTask.PieceSize), timeout)
+	req := pc.createDownloadRequest()
+	offset := pc.resumeOffset()
+	if offset > 0 {
+		if req.Headers == nil {
+			req.Headers = make(map[string]string)
+		}
+		req.Headers[config.StrPieceOffset] = strconv.Itoa(offset)
+	}
+	resp, err := pc.pieceTransport().FetchPiece(dstIP, peerPort, req, timeout)
 	if err != nil {
 		return nil, err
 	}
@@ -147,25 +243,45 @@ func (pc *PowerClient) downloadPiece() (content *pool.Buffer, e error) {
 	pieceMetaArr := strings.Split(pc.pieceTask.PieceMd5, ":")
 	pieceMD5 := pieceMetaArr[0]
 
+	// the received data is appended by the rest of the piece if the peer resumes
+	// the piece from the offset, or it's dropped if the whole piece is sent again.
+	data := pc.partial
+	pc.partial = nil
+	resumed := offset > 0 && resp.Offset == offset
+	if !resumed {
+		if data != nil {
+			pool.ReleaseBuffer(data)
+		}
+		data = pool.AcquireBufferSize(int(pc.pieceTask.PieceSize))
+	}
+
 	// start to read data from resp
 	// use limitReader to limit the download speed
-	limitReader := limitreader.NewLimitReaderWithLimiter(pc.rateLimiter, resp.Body, pieceMD5 != "")
-	content = pool.AcquireBufferSize(int(pc.pieceTask.PieceSize))
+	limitReader := limitreader.NewLimitReaderWithLimiter(pc.rateLimiter, resp.Body, pieceMD5 != "" && !resumed)
 	defer func() {
-		// if an error happened, the content cannot be released outside.
-		if e != nil {
-			pool.ReleaseBuffer(content)
-			content = nil
+		if e == nil {
+			return
+		}
+		// the received data is kept to resume the piece when retrying, since the
+		// assembled piece can be verified by its md5.
+		if pieceMD5 != "" && pc.clientError == nil && data.Len() > 0 {
+			pc.partial = data
+		} else {
+			pool.ReleaseBuffer(data)
 		}
 	}()
-	if pc.total, e = content.ReadFrom(limitReader); e != nil {
+	if pc.total, e = data.ReadFrom(limitReader); e != nil {
 		return nil, e
 	}
 	pc.readCost = time.Since(startTime)
 
 	// Verify md5 code
 	if pieceMD5 != "" {
-		if realMd5 := limitReader.Md5(); realMd5 != pieceMD5 {
+		realMd5 := limitReader.Md5()
+		if resumed {
+			realMd5 = fmt.Sprintf("%x", md5.Sum(data.Bytes()))
+		}
+		if realMd5 != pieceMD5 {
 			pc.initFileMd5NotMatchError(dstIP, realMd5, pieceMD5)
 			return nil, fmt.Errorf("piece range:%s md5 not match, expected:%s real:%s",
 				pc.pieceTask.Range, pieceMD5, realMd5)
@@ -176,7 +292,45 @@ func (pc *PowerClient) downloadPiece() (content *pool.Buffer, e error) {
 		logrus.Warnf("client range:%s cost:%.3f from peer:%s, readCost:%.3f, length:%d",
 			pc.pieceTask.Range, timeDuring.Seconds(), dstIP, pc.readCost.Seconds(), pc.total)
 	}
-	return content, nil
+	pc.peerSpeeds.observe(peer, pc.total, pc.readCost)
+	if pc.fromSupernode() {
+		atomic.AddInt64(&pc.cfg.RV.SupernodeBytes, pc.total)
+	} else {
+		atomic.AddInt64(&pc.cfg.RV.PeerBytes, pc.total)
+	}
+	return data, nil
+}
+
+// pieceTransport returns the transport which the piece is fetched with, which is the preferred
+// one among the transports advertised by the peer. The pieces of supernode are fetched by http,
+// since supernode advertises no transport.
+func (pc *PowerClient) pieceTransport() api.PieceTransport {
+	name := api.SelectPieceTransport(pc.pieceTask.PeerTransports)
+	if name == api.TransportHTTP {
+		return api.NewHTTPTransport(pc.downloadAPI)
+	}
+	return api.NewPieceTransport(name, pc.peerPool)
+}
+
+// resumeOffset returns the number of the bytes of the piece which have been received,
+// from which the piece is resumed. The pieces downloaded from the source station directly
+// aren't resumed.
+func (pc *PowerClient) resumeOffset() int {
+	if pc.partial == nil || pc.cdnSource == apiTypes.CdnSourceSource {
+		return 0
+	}
+	return pc.partial.Len()
+}
+
+func (pc *PowerClient) checkPeer(ip string, port int) error {
+	if pc.peerPool != nil {
+		if len(pc.pieceTask.PeerAddrs) > 0 {
+			pc.peerPool.SetAddresses(ip, port, pc.pieceTask.PeerAddrs)
+		}
+		return pc.peerPool.Check(ip, port)
+	}
+	_, err := httputils.CheckConnect(ip, port, -1)
+	return err
 }
 
 func (pc *PowerClient) createDownloadRequest() *api.DownloadRequest {
@@ -192,13 +346,29 @@ func (pc *PowerClient) createDownloadRequest() *api.DownloadRequest {
 		headers[config.StrCDNSource] = string(apiTypes.CdnSourceSource)
 	}
 
-	return &api.DownloadRequest{
+	req := &api.DownloadRequest{
 		Path:       pc.pieceTask.Path,
 		PieceRange: pieceRange,
 		PieceNum:   pc.pieceTask.PieceNum,
 		PieceSize:  pc.pieceTask.PieceSize,
 		Headers:    headers,
 	}
+	if pc.overTLS() {
+		req.Scheme = config.SchemaHTTPS
+	}
+	return req
+}
+
+// overTLS returns whether the piece is downloaded from the CDN of supernode over HTTPS.
+func (pc *PowerClient) overTLS() bool {
+	return pc.cfg.RV.CDNTLSConfig != nil && pc.cfg.CDNTLS != nil && pc.fromSupernode()
+}
+
+// fromSupernode returns whether the piece is downloaded from the CDN of supernode.
+// It's told by the CID rather than the IP, since supernode and the peers may share
+// the same IP, such as the ones launched on a single host.
+func (pc *PowerClient) fromSupernode() bool {
+	return strings.HasPrefix(pc.pieceTask.Cid, config.SuperNodeCIDPrefix)
 }
 
 func (pc *PowerClient) successPiece(content *pool.Buffer) *Piece {
@@ -23,6 +23,8 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
+	"testing/iotest"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
@@ -30,6 +32,7 @@ import (
 	"github.com/dragonflyoss/Dragonfly/dfget/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+	"github.com/dragonflyoss/Dragonfly/pkg/retry"
 
 	"github.com/go-check/check"
 )
@@ -127,6 +130,7 @@ func (s *PowerClientTestSuite) TestDownloadPiece(c *check.C) {
 
 	// dstIP == pc.node && Download Success && StatusCode == 200 && md5 match
 	s.powerClient.pieceTask.PieceMd5 = "5d41402abc4b2a76b9719d911017c592"
+	s.powerClient.pieceTask.Cid = config.SuperNodeCIDPrefix + "127.0.0.1~foo"
 	body4 := ioutil.NopCloser(bytes.NewReader([]byte("hello")))
 	resp = &http.Response{
 		StatusCode: http.StatusOK,
@@ -139,6 +143,85 @@ func (s *PowerClientTestSuite) TestDownloadPiece(c *check.C) {
 	c.Check(content, check.NotNil)
 	c.Check(content.String(), check.Equals, "hello")
 	c.Check(err, check.IsNil)
+	c.Check(s.powerClient.cfg.RV.SupernodeBytes, check.Equals, int64(5))
+	c.Check(s.powerClient.cfg.RV.PeerBytes, check.Equals, int64(0))
+}
+
+func (s *PowerClientTestSuite) TestDownloadPieceWithRetry(c *check.C) {
+	s.reset()
+	s.powerClient.cfg.Retry = retry.Policy{MaxAttempts: 3, BackoffBase: time.Millisecond}
+
+	// the transient errors are retried
+	count := 0
+	downloadMock = func() (*http.Response, error) {
+		if count++; count < 3 {
+			return nil, fmt.Errorf("error")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte("hello"))),
+		}, nil
+	}
+	content, err := s.powerClient.downloadPieceWithRetry()
+	c.Assert(err, check.IsNil)
+	c.Check(content.String(), check.Equals, "hello")
+	c.Check(count, check.Equals, 3)
+
+	// the errors of the data aren't retried
+	count = 0
+	downloadMock = func() (*http.Response, error) {
+		count++
+		return &http.Response{
+			StatusCode: http.StatusRequestedRangeNotSatisfiable,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}, nil
+	}
+	_, err = s.powerClient.downloadPieceWithRetry()
+	c.Check(err, check.DeepEquals, errortypes.ErrRangeNotSatisfiable)
+	c.Check(count, check.Equals, 1)
+	s.reset()
+}
+
+func (s *PowerClientTestSuite) TestDownloadResumedPiece(c *check.C) {
+	s.reset()
+	s.powerClient.cfg.Retry = retry.Policy{MaxAttempts: 2}
+	s.powerClient.pieceTask.PieceMd5 = "5d41402abc4b2a76b9719d911017c592"
+
+	var cases = []struct {
+		// resume indicates whether the peer supports resuming the piece
+		resume   bool
+		expected []string
+	}{
+		{resume: true, expected: []string{"", "3"}},
+		{resume: false, expected: []string{"", "3"}},
+	}
+	for _, v := range cases {
+		var offsets []string
+		s.powerClient.downloadAPI = &resumeDownloadAPI{download: func(req *api.DownloadRequest) (*http.Response, error) {
+			offset := req.Headers[config.StrPieceOffset]
+			offsets = append(offsets, offset)
+			if offset == "" {
+				// the connection is broken after a part of the piece is sent
+				body := io.MultiReader(strings.NewReader("hel"), iotest.ErrReader(fmt.Errorf("broken")))
+				return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(body)}, nil
+			}
+			resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header)}
+			if v.resume {
+				resp.Header.Set(config.StrPieceOffset, offset)
+				resp.Body = ioutil.NopCloser(strings.NewReader("lo"))
+			} else {
+				resp.Body = ioutil.NopCloser(strings.NewReader("hello"))
+			}
+			return resp, nil
+		}}
+		content, err := s.powerClient.downloadPieceWithRetry()
+		cmt := check.Commentf("resume:%v", v.resume)
+		c.Assert(err, check.IsNil, cmt)
+		c.Check(content.String(), check.Equals, "hello", cmt)
+		c.Check(offsets, check.DeepEquals, v.expected, cmt)
+		c.Check(s.powerClient.partial, check.IsNil, cmt)
+	}
+	s.reset()
 }
 
 func (s *PowerClientTestSuite) TestReadBody(c *check.C) {
@@ -190,6 +273,15 @@ func NewMockDownloadAPI() api.DownloadAPI {
 	return &downloadMockAPI{}
 }
 
+// resumeDownloadAPI is a DownloadAPI which handles the requests with the download function.
+type resumeDownloadAPI struct {
+	download func(req *api.DownloadRequest) (*http.Response, error)
+}
+
+func (d *resumeDownloadAPI) Download(ip string, port int, req *api.DownloadRequest, timeout time.Duration) (*http.Response, error) {
+	return d.download(req)
+}
+
 func (d *downloadMockAPI) Download(ip string, port int, req *api.DownloadRequest, timeout time.Duration) (*http.Response, error) {
 	return downloadMock()
 }
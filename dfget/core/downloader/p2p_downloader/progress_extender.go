@@ -0,0 +1,82 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minExtendInterval is the min interval between two requests of the extensions.
+const minExtendInterval = time.Second
+
+// extendProgress requests the extensions of the progress deadline from supernode
+// while the pieces are downloaded but not reported yet, such as when they're
+// written slowly to the disk, so that the download isn't kicked by supernode.
+// An extension is requested only if more bytes are downloaded since the last one,
+// and the next one is requested halfway to the deadline, which is converted to the
+// local clock with the clock offset from supernode estimated at the registration.
+// It returns when done is closed, or when supernode doesn't limit the progress
+// of the download or doesn't support the extensions.
+func (p2p *P2PDownloader) extendProgress(done <-chan struct{}) {
+	var lastBytes int64
+	timer := time.NewTimer(p2p.extendInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+
+		p2p.statusLock.Lock()
+		node, taskID, downloaded := p2p.status.node, p2p.status.taskID, p2p.status.downloaded
+		clockOffset := p2p.status.clockOffset
+		p2p.statusLock.Unlock()
+		if node == "" || downloaded <= lastBytes {
+			timer.Reset(p2p.extendInterval)
+			continue
+		}
+
+		resp, err := p2p.API.ExtendProgress(node, &apiTypes.ProgressExtensionRequest{
+			TaskID:         taskID,
+			CID:            p2p.cfg.RV.Cid,
+			CompletedBytes: downloaded,
+		})
+		if err != nil {
+			logrus.Debugf("stop requesting the progress extensions from %s: %v", node, err)
+			return
+		}
+		if resp == nil || time.Time(resp.Deadline).IsZero() {
+			return
+		}
+		lastBytes = downloaded
+		if !resp.Granted {
+			logrus.Warnf("progress extension is rejected by %s: %s", node, resp.Reason)
+		}
+
+		next := time.Until(time.Time(resp.Deadline).Add(-clockOffset)) / 2
+		if next < minExtendInterval {
+			next = minExtendInterval
+		}
+		timer.Reset(next)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/pool"
+
+	"github.com/sirupsen/logrus"
+)
+
+// downloadFromPushed returns the piece pushed to the peer server by another peer as
+// instructed by supernode, if the download accepts the pushed pieces. The pushed piece
+// is removed once it's read, and it's only used if it matches the md5 of the piece.
+func (pc *PowerClient) downloadFromPushed() *pool.Buffer {
+	if !pc.cfg.AcceptPush || pc.cdnSource == apiTypes.CdnSourceSource {
+		return nil
+	}
+	pieceMD5 := strings.Split(pc.pieceTask.PieceMd5, ":")[0]
+	if pieceMD5 == "" {
+		return nil
+	}
+	path := helper.GetPushedPieceFile(pc.cfg.WorkHome, pc.cfg.RV.TaskFileName, pc.pieceTask.PieceNum)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer os.Remove(path)
+	defer f.Close()
+
+	data := pool.AcquireBufferSize(int(pc.pieceTask.PieceSize))
+	if _, err := data.ReadFrom(io.LimitReader(f, int64(pc.pieceTask.PieceSize))); err != nil {
+		pool.ReleaseBuffer(data)
+		logrus.Warnf("failed to read the pushed piece %s: %v", pc.pieceTask.Range, err)
+		return nil
+	}
+	if realMd5 := fmt.Sprintf("%x", md5.Sum(data.Bytes())); realMd5 != pieceMD5 {
+		pool.ReleaseBuffer(data)
+		logrus.Warnf("the pushed piece %s md5 not match, expected:%s real:%s", pc.pieceTask.Range, pieceMD5, realMd5)
+		return nil
+	}
+
+	pc.total = int64(data.Len())
+	atomic.AddInt64(&pc.cfg.RV.PeerBytes, pc.total)
+	logrus.Debugf("use the pushed piece %s", pc.pieceTask.Range)
+	return data
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+
+	"github.com/go-check/check"
+)
+
+func (s *EdgeCacheTestSuite) TestDownloadFromPushed(c *check.C) {
+	workHome, err := ioutil.TempDir("/tmp", "dfget-TestDownloadFromPushed-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(workHome)
+
+	piece := wrap(s.content[:8], 13)
+	pc := s.newPowerClient(&types.PullPieceTaskResponseContinueData{
+		PieceNum:  0,
+		PieceSize: 13,
+		PieceMd5:  fmt.Sprintf("%x:%d", md5.Sum(piece), len(piece)),
+	}, apiTypes.CdnSourceSupernode)
+	pc.cfg.WorkHome = workHome
+	pc.cfg.RV.TaskFileName = "task"
+	path := helper.GetPushedPieceFile(workHome, "task", 0)
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), check.IsNil)
+
+	// the pushed pieces aren't used unless the download accepts them
+	c.Assert(ioutil.WriteFile(path, piece, 0644), check.IsNil)
+	c.Check(pc.downloadFromPushed(), check.IsNil)
+
+	pc.cfg.AcceptPush = true
+	content := pc.downloadFromPushed()
+	c.Assert(content, check.NotNil)
+	c.Check(bytes.Equal(content.Bytes(), piece), check.Equals, true)
+	c.Check(pc.cfg.RV.PeerBytes, check.Equals, int64(len(piece)))
+	_, err = os.Stat(path)
+	c.Check(os.IsNotExist(err), check.Equals, true)
+
+	// the pushed piece not matching the md5 is dropped
+	c.Assert(ioutil.WriteFile(path, wrap(s.content[8:16], 13), 0644), check.IsNil)
+	c.Check(pc.downloadFromPushed(), check.IsNil)
+	_, err = os.Stat(path)
+	c.Check(os.IsNotExist(err), check.Equals, true)
+}
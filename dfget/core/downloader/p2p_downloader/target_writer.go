@@ -20,15 +20,63 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
 	"github.com/dragonflyoss/Dragonfly/pkg/queue"
 
 	"github.com/sirupsen/logrus"
 )
 
+// WriterStats records how the pieces are queued for a writer,
+// which helps to tune the size of the client queue.
+type WriterStats struct {
+	// Pieces is the number of the pieces written.
+	Pieces int
+	// MaxDepth is the max number of the pieces waiting in the queue.
+	MaxDepth int
+	// totalDepth is the sum of the queue depth observed on each piece.
+	totalDepth int
+	// BlockedTime is the total time spent on waiting for a free slot in the queue,
+	// it grows when the disk is slower than the network.
+	BlockedTime time.Duration
+	// WriteTime is the total time spent on writing the pieces to disk.
+	WriteTime time.Duration
+}
+
+// AvgDepth returns the average number of the pieces waiting in the queue.
+func (s *WriterStats) AvgDepth() float64 {
+	if s.Pieces == 0 {
+		return 0
+	}
+	return float64(s.totalDepth) / float64(s.Pieces)
+}
+
+func (s *WriterStats) String() string {
+	return fmt.Sprintf("pieces:%d maxDepth:%d avgDepth:%.2f blocked:%.3fs write:%.3fs",
+		s.Pieces, s.MaxDepth, s.AvgDepth(), s.BlockedTime.Seconds(), s.WriteTime.Seconds())
+}
+
+func (s *WriterStats) observe(depth int, cost time.Duration) {
+	s.Pieces++
+	s.totalDepth += depth
+	if depth > s.MaxDepth {
+		s.MaxDepth = depth
+	}
+	s.WriteTime += cost
+}
+
+// moveRequest asks TargetWriter to move the file being written to dst
+// after the pieces queued before the request are written.
+type moveRequest struct {
+	dst  string
+	done chan error
+}
+
 // TargetWriter writes downloading file to disk.
 type TargetWriter struct {
 	// dst is the destination file path.
@@ -41,13 +89,24 @@ type TargetWriter struct {
 	finish chan struct{}
 	// pieceIndex records the number of pieces currently downloaded.
 	pieceIndex int
+	// completedLength records the length of data currently written.
+	completedLength int64
 	// result records whether the write operation was successful.
 	result bool
 
+	// onWrite is called in the writing goroutine after a piece is written successfully.
+	// If it's nil, the progress is printed instead except the p2p pattern.
+	onWrite func(piece *Piece, length int64, cost time.Duration)
+	// stats records the depth of pieceQueue and the time spent on writing.
+	stats WriterStats
+
 	syncQueue queue.Queue
 	cfg       *config.Config
 
 	cdnSource apiTypes.CdnSource
+
+	// fileCipher encrypts the pieces written to dst, it's nil if they're written as they are.
+	fileCipher *helper.FileCipher
 }
 
 // NewTargetWriter creates and initialize a TargetWriter instance.
@@ -64,18 +123,42 @@ func NewTargetWriter(dst string, q queue.Queue, cfg *config.Config, cdnSource ap
 	return targetWriter, nil
 }
 
+// newFileWriter creates a TargetWriter which writes the pieces to the opened file,
+// and calls onWrite after each piece is written.
+func newFileWriter(file *os.File, q queue.Queue, cfg *config.Config, cdnSource apiTypes.CdnSource,
+	onWrite func(piece *Piece, length int64, cost time.Duration)) *TargetWriter {
+	targetWriter := &TargetWriter{
+		dst:        file.Name(),
+		dstFile:    file,
+		pieceQueue: q,
+		onWrite:    onWrite,
+		cfg:        cfg,
+		cdnSource:  cdnSource,
+	}
+	targetWriter.reset()
+	return targetWriter
+}
+
 func (tw *TargetWriter) init() error {
 	var err error
-	tw.dstFile, err = fileutils.OpenFile(tw.dst, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0755)
+	flag := os.O_RDWR | os.O_TRUNC | os.O_CREATE
+	if tw.cfg.RV.BlockDevice {
+		// the pieces are written to the device at their offsets in place
+		flag = os.O_RDWR
+	}
+	tw.dstFile, err = fileutils.OpenFile(tw.dst, flag, 0755)
 	if err != nil {
 		return fmt.Errorf("open target file:%s error:%v", tw.dst, err)
 	}
+	tw.reset()
+	return nil
+}
 
+func (tw *TargetWriter) reset() {
 	tw.finish = make(chan struct{})
 	tw.pieceIndex = 0
 	tw.result = true
 	tw.syncQueue = startSyncWriter(nil)
-	return nil
 }
 
 // Run starts writing downloading file.
@@ -87,11 +170,18 @@ func (tw *TargetWriter) Run(ctx context.Context) {
 			tw.dstFile.Sync()
 			break
 		}
+		if req, ok := item.(*moveRequest); ok {
+			req.done <- tw.moveTo(req.dst)
+			continue
+		}
 		if !tw.result {
 			continue
 		}
 		if ok && state == reset {
-			tw.dstFile.Truncate(0)
+			// a block device can't be truncated, and all pieces will be rewritten
+			if !tw.cfg.RV.BlockDevice {
+				tw.dstFile.Truncate(0)
+			}
 			continue
 		}
 
@@ -113,6 +203,52 @@ func (tw *TargetWriter) Run(ctx context.Context) {
 	close(tw.finish)
 }
 
+// put puts the item into the queue of the writer and records the time blocked.
+func (tw *TargetWriter) put(item interface{}) {
+	start := time.Now()
+	tw.pieceQueue.Put(item)
+	tw.stats.BlockedTime += time.Since(start)
+}
+
+// move moves the file being written to dst after the queued pieces are written,
+// and the pieces put after it are written to dst.
+func (tw *TargetWriter) move(dst string) error {
+	req := &moveRequest{dst: dst, done: make(chan error, 1)}
+	tw.pieceQueue.Put(req)
+	select {
+	case err := <-req.done:
+		return err
+	case <-tw.finish:
+		return fmt.Errorf("failed to move %s to %s: writer is closed", tw.dst, dst)
+	}
+}
+
+// moveTo moves the file being written to dst, which is renamed if they're on the same
+// file system, or else it's copied and the copy is opened to write the rest pieces.
+func (tw *TargetWriter) moveTo(dst string) error {
+	if err := tw.dstFile.Sync(); err != nil {
+		return err
+	}
+	if err := fileutils.MoveFile(tw.dst, dst); err != nil {
+		return err
+	}
+	file, err := fileutils.OpenFile(dst, os.O_RDWR, 0755)
+	if err != nil {
+		// the file opened may be removed already, so the rest pieces can't be written
+		tw.cfg.BackSourceReason = config.BackSourceReasonWriteError
+		tw.result = false
+		return fmt.Errorf("open moved target file:%s error:%v", dst, err)
+	}
+	tw.dstFile.Close()
+	tw.dst, tw.dstFile = dst, file
+	return nil
+}
+
+// Stats returns the statistics of the writer, it should be called after Wait.
+func (tw *TargetWriter) Stats() WriterStats {
+	return tw.stats
+}
+
 // Wait the Run is finished.
 func (tw *TargetWriter) Wait() {
 	if tw.finish != nil {
@@ -122,5 +258,22 @@ func (tw *TargetWriter) Wait() {
 
 func (tw *TargetWriter) write(piece *Piece, cdnSource apiTypes.CdnSource) error {
 	tw.pieceIndex++
-	return writePieceToFile(piece, tw.dstFile, cdnSource)
+	depth := tw.pieceQueue.Len()
+	startTime := time.Now()
+	length := pieceDataLength(piece, cdnSource)
+	if err := writePieceToFile(piece, tw.dstFile, cdnSource, tw.fileCipher, tw.cfg.VerifyWrite); err != nil {
+		return err
+	}
+	cost := time.Since(startTime)
+	tw.stats.observe(depth, cost)
+	if tw.onWrite != nil {
+		tw.onWrite(piece, length, cost)
+		return nil
+	}
+	// the progress of p2p pattern is reported by ClientWriter.
+	if !helper.IsP2P(tw.cfg.Pattern) {
+		tw.completedLength += length
+		printer.Progress(tw.completedLength, tw.cfg.RV.FileLength)
+	}
+	return nil
 }
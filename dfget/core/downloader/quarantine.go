@@ -0,0 +1,106 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+
+	"github.com/sirupsen/logrus"
+)
+
+// QuarantineRecord describes a quarantined file which fails to be verified.
+// It's written beside the file with the suffix ".json".
+type QuarantineRecord struct {
+	URL          string    `json:"url"`
+	Target       string    `json:"target"`
+	TaskFileName string    `json:"taskFileName,omitempty"`
+	Pattern      string    `json:"pattern"`
+	Md5          string    `json:"md5,omitempty"`
+	Sha256       string    `json:"sha256,omitempty"`
+	Digest       string    `json:"digest,omitempty"`
+	Size         int64     `json:"size"`
+	Error        string    `json:"error"`
+	Time         time.Time `json:"time"`
+}
+
+// HandleVerifyFailure deletes or quarantines the file downloaded with the pattern according to
+// the VerifyFailure policy if err is a digest mismatch one, otherwise the file is left as it is.
+// The file is deleted if it fails to be quarantined, so the corrupt data is never left behind.
+func HandleVerifyFailure(cfg *config.Config, name, pattern string, err error) {
+	if !errortypes.IsDigestMismatch(err) || cfg.RV.BlockDevice || !fileutils.IsRegularFile(name) {
+		return
+	}
+	if cfg.VerifyFailure == config.VerifyFailureQuarantine {
+		dst, qErr := quarantine(cfg, name, pattern, err)
+		if qErr == nil {
+			printer.Printf("the file failing to be verified is quarantined to %s", dst)
+			logrus.Warnf("quarantine the file %s failing to be verified to %s: %v", name, dst, err)
+			return
+		}
+		logrus.Errorf("failed to quarantine the file %s, delete it: %v", name, qErr)
+	}
+	fileutils.DeleteFile(name)
+	logrus.Warnf("delete the file %s failing to be verified: %v", name, err)
+}
+
+// quarantine moves the file into the quarantine directory of the work home
+// and writes the record of the failure beside it.
+func quarantine(cfg *config.Config, name, pattern string, cause error) (string, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cfg.WorkHome, config.QuarantineDirName)
+	if err := fileutils.CreateDirectory(dir); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, fmt.Sprintf("%s.%s.%s", filepath.Base(cfg.Output), cfg.Sign, pattern))
+
+	record := &QuarantineRecord{
+		URL:          cfg.URL,
+		Target:       cfg.Output,
+		TaskFileName: cfg.RV.TaskFileName,
+		Pattern:      pattern,
+		Md5:          cfg.Md5,
+		Sha256:       cfg.RV.Sha256,
+		Digest:       cfg.Digest,
+		Size:         info.Size(),
+		Error:        cause.Error(),
+		Time:         time.Now(),
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := fileutils.MoveFile(name, dst); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(dst+".json", data, 0644); err != nil {
+		logrus.Warnf("failed to write the record of the quarantined file %s: %v", dst, err)
+	}
+	return dst, nil
+}
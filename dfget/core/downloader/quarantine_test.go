@@ -0,0 +1,70 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+
+	"github.com/go-check/check"
+	"github.com/pkg/errors"
+)
+
+func (s *DownloaderTestSuite) TestHandleVerifyFailure(c *check.C) {
+	tmp, _ := ioutil.TempDir("/tmp", "dfget-TestHandleVerifyFailure-")
+	defer os.RemoveAll(tmp)
+	cfg := helper.CreateConfig(nil, tmp)
+	cfg.URL = "http://h/file"
+	cfg.Output = filepath.Join(tmp, "file")
+	cfg.Md5 = "x"
+	src := filepath.Join(tmp, "src")
+	mismatch := errors.Wrapf(errortypes.ErrDigestMismatch, "md5 not match")
+
+	// the file is left as it is if it isn't a verification failure
+	helper.CreateTestFile(src, "corrupt")
+	HandleVerifyFailure(cfg, src, config.PatternSource, fmt.Errorf("other"))
+	c.Check(fileutils.PathExist(src), check.Equals, true)
+
+	HandleVerifyFailure(cfg, src, config.PatternSource, mismatch)
+	c.Check(fileutils.PathExist(src), check.Equals, false)
+
+	helper.CreateTestFile(src, "corrupt")
+	cfg.VerifyFailure = config.VerifyFailureQuarantine
+	HandleVerifyFailure(cfg, src, config.PatternSource, mismatch)
+	c.Check(fileutils.PathExist(src), check.Equals, false)
+	dst := filepath.Join(tmp, config.QuarantineDirName, "file."+cfg.Sign+"."+config.PatternSource)
+	data, err := ioutil.ReadFile(dst)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "corrupt")
+
+	data, err = ioutil.ReadFile(dst + ".json")
+	c.Assert(err, check.IsNil)
+	record := &QuarantineRecord{}
+	c.Assert(json.Unmarshal(data, record), check.IsNil)
+	c.Check(record.URL, check.Equals, cfg.URL)
+	c.Check(record.Md5, check.Equals, "x")
+	c.Check(record.Size, check.Equals, int64(len("corrupt")))
+	c.Check(record.Error, check.Equals, mismatch.Error())
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/downloader"
+	backDown "github.com/dragonflyoss/Dragonfly/dfget/core/downloader/back_downloader"
+	p2pDown "github.com/dragonflyoss/Dragonfly/dfget/core/downloader/p2p_downloader"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/regist"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fallbackChain returns the stages which the file is downloaded by in order.
+func fallbackChain(cfg *config.Config) []*config.FallbackStage {
+	if len(cfg.FallbackChain) == 0 {
+		return config.DefaultFallbackChain()
+	}
+	return cfg.FallbackChain
+}
+
+// skipStage returns why the stage of the fallback chain is skipped,
+// and it's empty if the stage should run.
+func skipStage(cfg *config.Config, stage *config.FallbackStage) string {
+	switch stage.Provider {
+	case config.ProviderDragonfly:
+		if cfg.BackSourceReason > 0 {
+			return fmt.Sprintf("back source reason %d", cfg.BackSourceReason)
+		}
+	case config.ProviderMirror:
+		if !stage.Serves(cfg.URL) {
+			return "the mirror doesn't serve the url"
+		}
+	}
+	return ""
+}
+
+// newStageDownloader creates the downloader which downloads the file in the stage.
+func newStageDownloader(cfg *config.Config, supernodeAPI api.SupernodeAPI, register regist.SupernodeRegister,
+	result *regist.RegisterResult, stage *config.FallbackStage) (downloader.Downloader, error) {
+	switch stage.Provider {
+	case config.ProviderDragonfly:
+		return p2pDown.NewP2PDownloader(cfg, supernodeAPI, register, result), nil
+	case config.ProviderMirror:
+		mirrorURL, err := stage.MirrorURL(cfg.URL)
+		if err != nil {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "mirror url: %v", err)
+		}
+		bd := backDown.NewBackDownloader(cfg, result)
+		bd.URL = mirrorURL
+		bd.Counter = &cfg.RV.MirrorBytes
+		return bd, nil
+	}
+	return backDown.NewBackDownloader(cfg, result), nil
+}
+
+// firstStage returns the first stage of the fallback chain which isn't skipped,
+// it's nil if all stages are skipped.
+func firstStage(cfg *config.Config) *config.FallbackStage {
+	for _, stage := range fallbackChain(cfg) {
+		if skipStage(cfg, stage) == "" {
+			return stage
+		}
+	}
+	return nil
+}
+
+// runFallbackChain downloads the file by the stages of the fallback chain in order,
+// and the next stage is tried when a stage fails, until the file is downloaded.
+// The timeout of a stage is the timeout of the download unless it's specified.
+func runFallbackChain(cfg *config.Config, supernodeAPI api.SupernodeAPI,
+	register regist.SupernodeRegister, result *regist.RegisterResult, timeout time.Duration) error {
+	var (
+		last    *config.FallbackStage
+		lastErr error
+	)
+	for _, stage := range fallbackChain(cfg) {
+		// the aborted download doesn't fall back to the next stage
+		if err := downloadContext(cfg).Err(); err != nil && lastErr != nil {
+			return lastErr
+		}
+		if reason := skipStage(cfg, stage); reason != "" {
+			logrus.Infof("skip the %s stage of the fallback chain: %s", stage.Name(), reason)
+			continue
+		}
+		if lastErr != nil {
+			logrus.Errorf("failed to download by %s: %v, and start try to download by %s", last.Name(), lastErr, stage.Name())
+			printer.Printf("failed to download by %s: %v, and start try to download by %s", last.Name(), lastErr, stage.Name())
+			atomic.AddInt64(&cfg.RV.Retries, 1)
+			event := config.EventFallback
+			if stage.Provider == config.ProviderSource {
+				event = config.EventBackSource
+			}
+			cfg.RV.EventLog.Record(event, "", "", lastErr.Error())
+		}
+
+		err := runStage(cfg, supernodeAPI, register, result, stage, timeout)
+		if err == nil {
+			return nil
+		}
+		last, lastErr = stage, errors.Wrapf(err, "failed to download file from %s", stage.Name())
+	}
+	if lastErr == nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, "all stages of the fallback chain are skipped")
+	}
+	return lastErr
+}
+
+// runStage downloads the file in the stage, and records the result of the stage.
+func runStage(cfg *config.Config, supernodeAPI api.SupernodeAPI, register regist.SupernodeRegister,
+	result *regist.RegisterResult, stage *config.FallbackStage, timeout time.Duration) (err error) {
+	if stage.Timeout > 0 {
+		timeout = stage.Timeout
+	}
+	start, bytes := time.Now(), downloadedBytes(cfg)
+	defer func() {
+		r := &config.StageResult{
+			Name:     stage.Name(),
+			Duration: time.Since(start).Seconds(),
+			Bytes:    downloadedBytes(cfg) - bytes,
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		cfg.RV.Stages = append(cfg.RV.Stages, r)
+		logrus.Infof("stage %s of the fallback chain cost:%.3fs bytes:%d error:%v", r.Name, r.Duration, r.Bytes, err)
+	}()
+
+	getter, err := newStageDownloader(cfg, supernodeAPI, register, result, stage)
+	if err != nil {
+		return err
+	}
+	switch stage.Provider {
+	case config.ProviderDragonfly:
+		printer.Printf("start download by dragonfly...")
+		err = downloader.DoDownloadContext(downloadContext(cfg), getter, timeout)
+		printer.FinishProgress()
+		// report finished task to uploader regardless of the result of downloading from dragonfly
+		reportFinishedTask(cfg, getter)
+	case config.ProviderSource:
+		err = downloadFromSource(cfg, getter, timeout)
+		printer.FinishProgress()
+	default:
+		printer.Printf("start download from %s", stage.Name())
+		err = downloader.DoDownloadContext(downloadContext(cfg), getter, timeout)
+		printer.FinishProgress()
+	}
+	return err
+}
+
+// downloadedBytes returns the number of the bytes downloaded from all the providers.
+func downloadedBytes(cfg *config.Config) int64 {
+	return atomic.LoadInt64(&cfg.RV.PeerBytes) + atomic.LoadInt64(&cfg.RV.SupernodeBytes) +
+		atomic.LoadInt64(&cfg.RV.SourceBytes) + atomic.LoadInt64(&cfg.RV.EdgeBytes) +
+		atomic.LoadInt64(&cfg.RV.MirrorBytes)
+}
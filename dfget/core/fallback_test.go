@@ -0,0 +1,79 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/go-check/check"
+)
+
+func (s *CoreTestSuite) TestRunFallbackChain(c *check.C) {
+	content := "fallback chain"
+	var requests []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/broken/") {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer mirror.Close()
+
+	cfg := s.createConfig(&bytes.Buffer{})
+	cfg.URL = "http://origin.com/file"
+	cfg.RV.RealTarget = filepath.Join(s.workHome, "fallback.output")
+	cfg.BackSourceReason = config.BackSourceReasonNodeEmpty
+	cfg.RV.EventLog = config.NewEventLog(config.DefaultEventLogSize)
+	cfg.FallbackChain = []*config.FallbackStage{
+		{Provider: config.ProviderDragonfly},
+		{Provider: config.ProviderMirror, URL: mirror.URL, Hosts: []string{"other.com"}},
+		{Provider: config.ProviderMirror, URL: mirror.URL + "/broken"},
+		{Provider: config.ProviderMirror, URL: mirror.URL + "/ok"},
+		{Provider: config.ProviderSource},
+	}
+
+	c.Assert(runFallbackChain(cfg, nil, nil, nil, 0), check.IsNil)
+	data, err := ioutil.ReadFile(cfg.RV.RealTarget)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, content)
+	c.Check(requests, check.DeepEquals, []string{"/broken/file", "/ok/file"})
+
+	// the skipped stages aren't recorded, and the source stage isn't reached
+	c.Assert(cfg.RV.Stages, check.HasLen, 2)
+	c.Check(cfg.RV.Stages[0].Error, check.Not(check.Equals), "")
+	c.Check(cfg.RV.Stages[1].Error, check.Equals, "")
+	c.Check(cfg.RV.Stages[1].Bytes, check.Equals, int64(len(content)))
+	c.Check(cfg.RV.MirrorBytes, check.Equals, int64(len(content)))
+	c.Check(cfg.RV.SourceBytes, check.Equals, int64(0))
+	c.Check(cfg.RV.Retries, check.Equals, int64(1))
+	events, _ := cfg.RV.EventLog.Events()
+	c.Assert(events, check.HasLen, 1)
+	c.Check(events[0].Type, check.Equals, config.EventFallback)
+
+	cfg.FallbackChain = cfg.FallbackChain[:2]
+	c.Check(runFallbackChain(cfg, nil, nil, nil, 0), check.ErrorMatches, ".*all stages of the fallback chain are skipped.*")
+	c.Check(firstStage(cfg), check.IsNil)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package group downloads a group of the related files together, such as all the
+// layers of an image, by the dfget processes registered with the same task group,
+// and moves them into place only after all of them have been downloaded.
+package group
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TempSuffix is the suffix of the temp file which a file of the group is
+// downloaded to before all the files of the group are downloaded.
+const TempSuffix = ".group"
+
+// File is a file of the group.
+type File struct {
+	URL    string
+	Output string
+}
+
+// Result is the result of downloading a file of the group.
+type Result struct {
+	*File
+	Cost time.Duration
+	Err  error
+}
+
+// Options specifies how the files of a group are downloaded.
+type Options struct {
+	// ID is the ID of the task group registered to supernode.
+	ID string
+
+	// Deadline is the time by which the files should be downloaded, which is
+	// shared by all the downloads of the group. Zero means none.
+	Deadline time.Time
+
+	// Parallel is the max number of the files downloaded at the same time.
+	Parallel int
+
+	// Args are the extra arguments of dfget passed to every download, such as --node.
+	Args []string
+}
+
+// Runner runs dfget with the arguments and waits for it to exit.
+type Runner func(ctx context.Context, args []string) error
+
+// ParseList parses the files of a group from the lines of "url output",
+// the blank lines and the ones starting with '#' are ignored.
+func ParseList(r io.Reader) ([]*File, error) {
+	var files []*File
+	outputs := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expect url and output: %s", n, line)
+		}
+		output, err := filepath.Abs(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		if outputs[output] {
+			return nil, fmt.Errorf("line %d: duplicated output: %s", n, fields[1])
+		}
+		outputs[output] = true
+		files = append(files, &File{URL: fields[0], Output: output})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file in the list")
+	}
+	return files, nil
+}
+
+// Download downloads the files of the group by the dfget processes run by run,
+// at most opts.Parallel at a time, so the files are pipelined through the
+// peer network rather than downloaded one by one. Every file is downloaded to
+// a temp file next to its output, and the temp files are renamed to the outputs
+// only after all of them succeed. Otherwise, the remaining files aren't started,
+// and all the temp files are removed.
+func Download(ctx context.Context, opts *Options, files []*File, run Runner) ([]*Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	results := make([]*Result, len(files))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i] = &Result{File: file, Err: ctx.Err()}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, file *File) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			err := run(ctx, downloadArgs(opts, file))
+			results[i] = &Result{File: file, Cost: time.Since(start), Err: err}
+			if err != nil {
+				logrus.Warnf("failed to download %s of group %s: %v", file.URL, opts.ID, err)
+				cancel()
+			}
+		}(i, file)
+	}
+	wg.Wait()
+
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		for _, file := range files {
+			os.Remove(tempPath(file))
+		}
+		return results, fmt.Errorf("%d of %d files of group %s fail to be downloaded", failed, len(files), opts.ID)
+	}
+
+	for _, r := range results {
+		if err := os.Rename(tempPath(r.File), r.Output); err != nil {
+			r.Err = err
+			failed++
+		}
+	}
+	if failed > 0 {
+		for _, file := range files {
+			os.Remove(tempPath(file))
+		}
+		return results, fmt.Errorf("%d of %d files of group %s fail to be moved into place", failed, len(files), opts.ID)
+	}
+	return results, nil
+}
+
+// downloadArgs returns the arguments of dfget to download the file
+// to its temp file with the group.
+func downloadArgs(opts *Options, file *File) []string {
+	args := []string{
+		"--url", file.URL,
+		"--output", tempPath(file),
+		"--group", opts.ID,
+	}
+	if !opts.Deadline.IsZero() {
+		args = append(args, "--group-deadline", opts.Deadline.Format(time.RFC3339))
+	}
+	return append(args, opts.Args...)
+}
+
+func tempPath(file *File) string {
+	return file.Output + TempSuffix
+}
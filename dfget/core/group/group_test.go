@@ -0,0 +1,150 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package group
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type GroupTestSuite struct {
+	workHome string
+}
+
+func init() {
+	check.Suite(&GroupTestSuite{})
+}
+
+func (s *GroupTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-GroupTestSuite-")
+}
+
+func (s *GroupTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+// fakeRunner writes the url into the output of the arguments,
+// and fails the urls in fail.
+type fakeRunner struct {
+	sync.Mutex
+	fail    map[string]bool
+	args    [][]string
+	running int
+	peak    int
+}
+
+func (r *fakeRunner) run(ctx context.Context, args []string) error {
+	r.Lock()
+	r.args = append(r.args, args)
+	r.running++
+	if r.running > r.peak {
+		r.peak = r.running
+	}
+	r.Unlock()
+	defer func() {
+		r.Lock()
+		r.running--
+		r.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	url, output := args[1], args[3]
+	if r.fail[url] {
+		return fmt.Errorf("failed to download %s", url)
+	}
+	return ioutil.WriteFile(output, []byte(url), 0644)
+}
+
+func (s *GroupTestSuite) files(urls ...string) []*File {
+	var files []*File
+	for _, url := range urls {
+		files = append(files, &File{URL: url, Output: filepath.Join(s.workHome, filepath.Base(url))})
+	}
+	return files
+}
+
+func (s *GroupTestSuite) TestParseList(c *check.C) {
+	files, err := ParseList(strings.NewReader("# layers\nhttp://a.com/1 /tmp/1\n\n  http://a.com/2   /tmp/2\n"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 2)
+	c.Check(*files[1], check.Equals, File{URL: "http://a.com/2", Output: "/tmp/2"})
+
+	var cases = []struct {
+		list   string
+		errMsg string
+	}{
+		{"", "no file in the list"},
+		{"http://a.com/1", "line 1: expect url and output: .*"},
+		{"http://a.com/1 /tmp/1\nhttp://a.com/2 /tmp/1", "line 2: duplicated output: .*"},
+	}
+	for _, v := range cases {
+		_, err := ParseList(strings.NewReader(v.list))
+		c.Check(err, check.ErrorMatches, v.errMsg)
+	}
+}
+
+func (s *GroupTestSuite) TestDownload(c *check.C) {
+	deadline := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	opts := &Options{ID: "image", Deadline: deadline, Parallel: 2, Args: []string{"--node", "127.0.0.1"}}
+	files := s.files("http://a.com/1", "http://a.com/2", "http://a.com/3")
+	runner := &fakeRunner{}
+
+	results, err := Download(context.Background(), opts, files, runner.run)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 3)
+	c.Check(runner.peak, check.Equals, 2)
+	c.Check(runner.args[0][4:], check.DeepEquals, []string{
+		"--group", "image", "--group-deadline", "2026-10-14T08:00:00Z", "--node", "127.0.0.1"})
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file.Output)
+		c.Check(err, check.IsNil)
+		c.Check(string(content), check.Equals, file.URL)
+		_, err = os.Stat(file.Output + TempSuffix)
+		c.Check(os.IsNotExist(err), check.Equals, true)
+	}
+}
+
+func (s *GroupTestSuite) TestDownloadFail(c *check.C) {
+	opts := &Options{ID: "image", Parallel: 1}
+	files := s.files("http://a.com/1", "http://a.com/2", "http://a.com/3")
+	runner := &fakeRunner{fail: map[string]bool{"http://a.com/2": true}}
+
+	results, err := Download(context.Background(), opts, files, runner.run)
+	c.Assert(err, check.ErrorMatches, "2 of 3 files of group image fail to be downloaded")
+	c.Check(results[0].Err, check.IsNil)
+	c.Check(results[1].Err, check.NotNil)
+	c.Check(results[2].Err, check.Equals, context.Canceled)
+	// the last file isn't started after the failure
+	c.Check(runner.args, check.HasLen, 2)
+
+	// nothing is moved into place
+	names, _ := ioutil.ReadDir(s.workHome)
+	c.Check(names, check.HasLen, 0)
+}
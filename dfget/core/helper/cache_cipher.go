@@ -0,0 +1,203 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/pkg/errors"
+)
+
+// CacheCipher encrypts the service files of the tasks which belong to a namespace,
+// so the tenants sharing a node can't read the cached files of each other from disk.
+type CacheCipher struct {
+	block cipher.Block
+}
+
+// NewCacheCipher creates a CacheCipher with an AES key of 16, 24 or 32 bytes.
+func NewCacheCipher(key []byte) (*CacheCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheCipher{block: block}, nil
+}
+
+// LoadCacheCiphers creates the CacheCiphers of the namespaces with the
+// hex-encoded keys in the files.
+func LoadCacheCiphers(keyFiles map[string]string) (map[string]*CacheCipher, error) {
+	ciphers := make(map[string]*CacheCipher, len(keyFiles))
+	for namespace, keyFile := range keyFiles {
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the cache key of namespace %s", namespace)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cache key of namespace %s", namespace)
+		}
+		if ciphers[namespace], err = NewCacheCipher(key); err != nil {
+			return nil, errors.Wrapf(err, "invalid cache key of namespace %s", namespace)
+		}
+	}
+	return ciphers, nil
+}
+
+// CipherNonceSuffix is appended to the path of an encrypted service file for the file
+// which stores its random nonce, the initial counter of the key stream of the file.
+const CipherNonceSuffix = ".nonce"
+
+// GetCipherNonceFile returns the path of the nonce file of the service file.
+func GetCipherNonceFile(serviceFile string) string {
+	return serviceFile + CipherNonceSuffix
+}
+
+// randRead fills the nonces of the service files, which is replaced in the tests.
+var randRead = rand.Read
+
+// GetCacheCipher returns the CacheCipher of the namespace of the task downloaded
+// by dfget, it's nil if the task doesn't belong to a namespace.
+func GetCacheCipher(cfg *config.Config) (*CacheCipher, error) {
+	if cfg.Namespace == "" {
+		return nil, nil
+	}
+	keyFile, ok := cfg.CacheKeys[cfg.Namespace]
+	if !ok {
+		return nil, fmt.Errorf("no cache key of namespace %s is configured", cfg.Namespace)
+	}
+	ciphers, err := LoadCacheCiphers(map[string]string{cfg.Namespace: keyFile})
+	if err != nil {
+		return nil, err
+	}
+	return ciphers[cfg.Namespace], nil
+}
+
+// NewFile generates a random nonce of the service file and stores it into the nonce
+// file, then returns the FileCipher of the service file. It's called whenever the
+// service file is created, so the contents written into the service files of the same
+// task by the different downloads are never encrypted with the same key stream.
+// It returns nil if c is nil.
+func (c *CacheCipher) NewFile(serviceFile string) (*FileCipher, error) {
+	if c == nil {
+		return nil, nil
+	}
+	fc := &FileCipher{block: c.block}
+	if _, err := randRead(fc.iv[:]); err != nil {
+		return nil, errors.Wrapf(err, "failed to generate the nonce of %s", serviceFile)
+	}
+
+	// the nonce file is replaced atomically, since it may be read by the peer server meanwhile.
+	path := GetCipherNonceFile(serviceFile)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(fc.iv[:]); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+// OpenFile returns the FileCipher of the service file with the nonce stored by NewFile.
+// It returns nil if c is nil.
+func (c *CacheCipher) OpenFile(serviceFile string) (*FileCipher, error) {
+	if c == nil {
+		return nil, nil
+	}
+	path := GetCipherNonceFile(serviceFile)
+	nonce, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the nonce of %s", serviceFile)
+	}
+	if len(nonce) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid nonce of %s: %d bytes", serviceFile, len(nonce))
+	}
+	fc := &FileCipher{block: c.block}
+	copy(fc.iv[:], nonce)
+	return fc, nil
+}
+
+// FileCipher encrypts and decrypts a service file with AES-CTR, whose initial
+// counter is the random nonce of the file. The counter mode keeps the length of
+// the data and allows any range of the file to be processed alone, so the pieces
+// are still written and read at their offsets in the file.
+//
+// A piece may be written more than once at its offset by the same download, always
+// with the same content of the task, so the key stream never covers different data. The ciphertext isn't authenticated on disk, while the pieces
+// decrypted from it are verified by their md5 by the peers downloading them.
+// A nil FileCipher leaves the data as it is.
+type FileCipher struct {
+	block cipher.Block
+	iv    [aes.BlockSize]byte
+}
+
+// Writer returns a writer which encrypts the data written at the offset of the file.
+func (fc *FileCipher) Writer(w io.Writer, offset int64) io.Writer {
+	if fc == nil {
+		return w
+	}
+	return cipher.StreamWriter{S: fc.stream(offset), W: w}
+}
+
+// Reader returns a reader which decrypts the data read from the offset of the file.
+func (fc *FileCipher) Reader(r io.Reader, offset int64) io.Reader {
+	if fc == nil {
+		return r
+	}
+	return cipher.StreamReader{S: fc.stream(offset), R: r}
+}
+
+// stream returns the key stream starting at the offset of the file.
+func (fc *FileCipher) stream(offset int64) cipher.Stream {
+	// the counter is a 128-bit big-endian integer which is increased by the block index
+	var iv [aes.BlockSize]byte
+	hi := binary.BigEndian.Uint64(fc.iv[:8])
+	lo := binary.BigEndian.Uint64(fc.iv[8:])
+	n := uint64(offset / aes.BlockSize)
+	if lo+n < lo {
+		hi++
+	}
+	binary.BigEndian.PutUint64(iv[:8], hi)
+	binary.BigEndian.PutUint64(iv[8:], lo+n)
+
+	s := cipher.NewCTR(fc.block, iv[:])
+	if skip := offset % aes.BlockSize; skip > 0 {
+		buf := make([]byte, skip)
+		s.XORKeyStream(buf, buf)
+	}
+	return s
+}
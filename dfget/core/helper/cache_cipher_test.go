@@ -0,0 +1,129 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/go-check/check"
+)
+
+func (s *HelperTestSuite) TestFileCipher(c *check.C) {
+	dir, err := ioutil.TempDir("/tmp", "dfget-TestFileCipher-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	serviceFile := filepath.Join(dir, "foo.service")
+
+	cc, err := NewCacheCipher(bytes.Repeat([]byte{1}, 32))
+	c.Assert(err, check.IsNil)
+	data := []byte(CreateRandomString(1000))
+	fc, err := cc.NewFile(serviceFile)
+	c.Assert(err, check.IsNil)
+
+	// the ranges written separately are the same as the whole encrypted data
+	whole := &bytes.Buffer{}
+	fc.Writer(whole, 0).Write(data)
+	c.Check(bytes.Equal(whole.Bytes(), data), check.Equals, false)
+	ranges := &bytes.Buffer{}
+	for _, r := range [][2]int{{0, 7}, {7, 300}, {300, 1000}} {
+		fc.Writer(ranges, int64(r[0])).Write(data[r[0]:r[1]])
+	}
+	c.Check(ranges.Bytes(), check.DeepEquals, whole.Bytes())
+
+	// any range is decrypted alone with the nonce stored along with the file
+	opened, err := cc.OpenFile(serviceFile)
+	c.Assert(err, check.IsNil)
+	decrypted, err := ioutil.ReadAll(opened.Reader(bytes.NewReader(whole.Bytes()[333:777]), 333))
+	c.Assert(err, check.IsNil)
+	c.Check(decrypted, check.DeepEquals, data[333:777])
+
+	// the file created again is encrypted with a different key stream
+	recreated, err := cc.NewFile(serviceFile)
+	c.Assert(err, check.IsNil)
+	other := &bytes.Buffer{}
+	recreated.Writer(other, 0).Write(data)
+	c.Check(other.Bytes(), check.Not(check.DeepEquals), whole.Bytes())
+	opened, err = cc.OpenFile(serviceFile)
+	c.Assert(err, check.IsNil)
+	c.Check(opened.iv, check.Equals, recreated.iv)
+
+	var fc0 *FileCipher
+	plain := &bytes.Buffer{}
+	fc0.Writer(plain, 0).Write(data)
+	c.Check(plain.Bytes(), check.DeepEquals, data)
+	var cc0 *CacheCipher
+	fc0, err = cc0.NewFile(serviceFile)
+	c.Check(err, check.IsNil)
+	c.Check(fc0, check.IsNil)
+}
+
+func (s *HelperTestSuite) TestFileCipherNonce(c *check.C) {
+	dir, err := ioutil.TempDir("/tmp", "dfget-TestFileCipherNonce-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	serviceFile := filepath.Join(dir, "foo.service")
+	cc, err := NewCacheCipher(bytes.Repeat([]byte{1}, 32))
+	c.Assert(err, check.IsNil)
+
+	_, err = cc.OpenFile(serviceFile)
+	c.Check(err, check.NotNil)
+	c.Assert(ioutil.WriteFile(GetCipherNonceFile(serviceFile), []byte("short"), 0600), check.IsNil)
+	_, err = cc.OpenFile(serviceFile)
+	c.Check(err, check.NotNil)
+
+	defer func(read func([]byte) (int, error)) { randRead = read }(randRead)
+	randRead = func(b []byte) (int, error) { return 0, fmt.Errorf("no entropy") }
+	_, err = cc.NewFile(serviceFile)
+	c.Check(err, check.NotNil)
+	nonce, err := ioutil.ReadFile(GetCipherNonceFile(serviceFile))
+	c.Assert(err, check.IsNil)
+	c.Check(string(nonce), check.Equals, "short")
+}
+
+func (s *HelperTestSuite) TestGetCacheCipher(c *check.C) {
+	dir, err := ioutil.TempDir("/tmp", "dfget-TestGetCacheCipher-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "foo.key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte("000102030405060708090a0b0c0d0e0f\n"), 0600), check.IsNil)
+	invalidKeyFile := filepath.Join(dir, "bar.key")
+	c.Assert(ioutil.WriteFile(invalidKeyFile, []byte("0001"), 0600), check.IsNil)
+
+	cfg := &config.Config{}
+	cc, err := GetCacheCipher(cfg)
+	c.Check(err, check.IsNil)
+	c.Check(cc, check.IsNil)
+
+	cfg.Namespace = "foo"
+	_, err = GetCacheCipher(cfg)
+	c.Check(err, check.NotNil)
+
+	cfg.CacheKeys = map[string]string{"foo": keyFile, "bar": invalidKeyFile}
+	cc, err = GetCacheCipher(cfg)
+	c.Check(err, check.IsNil)
+	c.Check(cc, check.NotNil)
+
+	cfg.Namespace = "bar"
+	_, err = GetCacheCipher(cfg)
+	c.Check(err, check.NotNil)
+}
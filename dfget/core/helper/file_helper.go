@@ -18,7 +18,10 @@ package helper
 
 import (
 	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
 )
 
 // GetTaskFile returns file path of task file.
@@ -31,6 +34,17 @@ func GetServiceFile(taskFileName, dataDir string) string {
 	return GetTaskFile(taskFileName, dataDir) + ".service"
 }
 
+// GetPushedPieceFile returns file path of the piece of the task file pushed by the other peers.
+func GetPushedPieceFile(workHome, taskFileName string, pieceNum int) string {
+	return filepath.Join(GetPushDir(workHome, taskFileName), strconv.Itoa(pieceNum))
+}
+
+// GetPushDir returns the directory which the pieces of the task file pushed by the other peers
+// are received into.
+func GetPushDir(workHome, taskFileName string) string {
+	return filepath.Join(workHome, config.PushDirName, taskFileName)
+}
+
 // GetTaskName extracts and returns task name from serviceFile.
 func GetTaskName(serviceFile string) string {
 	if idx := strings.LastIndex(serviceFile, ".service"); idx != -1 {
@@ -0,0 +1,93 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ScavengeResult describes the orphaned files found by ScavengeOrphans.
+type ScavengeResult struct {
+	// Files are the paths of the orphaned files.
+	Files []string
+
+	// Bytes is the total size of the orphaned files.
+	Bytes int64
+}
+
+// ScavengeOrphans removes the orphaned temp files in the dir, which are left by
+// the dfget processes that are not running anymore and are older than minAge.
+// The task files are also taken into account if withTaskFiles is true,
+// which should only be set for the data directories.
+// The orphaned files are only reported instead of removed if dryRun is true.
+func ScavengeOrphans(dir string, withTaskFiles bool, minAge time.Duration, dryRun bool) (*ScavengeResult, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScavengeResult{}
+	deadline := time.Now().Add(-minAge)
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || info.ModTime().After(deadline) {
+			continue
+		}
+		sign, ok := config.ParseTempFileName(info.Name())
+		if !ok && withTaskFiles {
+			sign, ok = config.ParseTaskFileName(info.Name())
+		}
+		if !ok {
+			continue
+		}
+		pid, _, ok := config.ParseSign(sign)
+		if !ok || ProcessAlive(pid) {
+			continue
+		}
+
+		path := filepath.Join(dir, info.Name())
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				logrus.Warnf("failed to remove orphaned file %s: %v", path, err)
+				continue
+			}
+			logrus.Infof("remove orphaned file %s, size:%d", path, info.Size())
+		}
+		result.Files = append(result.Files, path)
+		result.Bytes += info.Size()
+	}
+	return result, nil
+}
+
+// ProcessAlive returns whether the process with the pid is running.
+func ProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	if pid == os.Getpid() {
+		return true
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/go-check/check"
+)
+
+func (s *HelperTestSuite) TestScavengeOrphans(c *check.C) {
+	dir, err := ioutil.TempDir("/tmp", "dfget-HelperTestSuite-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+
+	// the pid is greater than the max pid of linux, so it's never running.
+	deadSign := "99999999-1571989637.123"
+	liveSign := fmt.Sprintf("%d-1571989637.123", os.Getpid())
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]time.Time{
+		config.TempFilePrefix(deadSign, config.TempKindTarget) + "1":     old,
+		config.TempFilePrefix(deadSign, config.TempKindBackSource) + "1": old,
+		config.TempFilePrefix(deadSign, config.TempKindTarget) + "2":     time.Now(),
+		config.TempFilePrefix(liveSign, config.TempKindTarget) + "1":     old,
+		"foo-" + deadSign:              old,
+		"foo-" + deadSign + ".service": old,
+		"bar":                          old,
+	}
+	for name, mtime := range files {
+		path := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(path, []byte("abc"), 0644), check.IsNil)
+		c.Assert(os.Chtimes(path, mtime, mtime), check.IsNil)
+	}
+
+	result, err := ScavengeOrphans(dir, false, time.Hour, true)
+	c.Assert(err, check.IsNil)
+	c.Check(result.Files, check.HasLen, 2)
+	c.Check(result.Bytes, check.Equals, int64(6))
+
+	result, err = ScavengeOrphans(dir, true, time.Hour, false)
+	c.Assert(err, check.IsNil)
+	c.Check(result.Files, check.HasLen, 3)
+	c.Check(result.Bytes, check.Equals, int64(9))
+	for _, f := range result.Files {
+		_, err := os.Stat(f)
+		c.Check(os.IsNotExist(err), check.Equals, true)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Check(infos, check.HasLen, len(files)-3)
+
+	_, err = ScavengeOrphans(filepath.Join(dir, "none"), false, time.Hour, false)
+	c.Check(err, check.NotNil)
+}
@@ -121,14 +121,46 @@ type ClientErrorFuncType func(ip string, req *types.ClientErrorRequest) (*types.
 // ClientErrorFuncType function type of SupernodeAPI#ReportMetricsType
 type ReportMetricsFuncType func(node string, req *api_types.TaskMetricsRequest) (*types.BaseResponse, error)
 
+// HeartBeatFuncType function type of SupernodeAPI#HeartBeat
+type HeartBeatFuncType func(node string, req *api_types.HeartBeatRequest) (*api_types.HeartBeatResponse, error)
+
+// ReportSeedFuncType function type of SupernodeAPI#ReportSeed
+type ReportSeedFuncType func(node string, req *api_types.PeerSeedRequest) (*types.BaseResponse, error)
+
+// GetPieceMD5sFuncType function type of SupernodeAPI#GetPieceMD5s
+type GetPieceMD5sFuncType func(node string, taskID string, start int, limit int, groupSize int) (*api_types.TaskPieceMD5s, error)
+
+// ReportPiecesFuncType function type of SupernodeAPI#ReportPieces
+type ReportPiecesFuncType func(node string, req *api_types.PieceSuccessRequest) (*types.BaseResponse, error)
+
+// ExtendProgressFuncType function type of SupernodeAPI#ExtendProgress
+type ExtendProgressFuncType func(node string, req *api_types.ProgressExtensionRequest) (*api_types.ProgressExtensionResponse, error)
+
+// KeepaliveFuncType function type of SupernodeAPI#Keepalive
+type KeepaliveFuncType func(node string, req *api_types.PeerKeepaliveRequest) (*api_types.PeerKeepaliveResponse, error)
+
+// VersionFuncType function type of SupernodeAPI#Version
+type VersionFuncType func(node string) (*api_types.DragonflyVersion, error)
+
+// ProbeBandwidthFuncType function type of SupernodeAPI#ProbeBandwidth
+type ProbeBandwidthFuncType func(node string, size int64) (int64, error)
+
 // MockSupernodeAPI mocks the SupernodeAPI.
 type MockSupernodeAPI struct {
-	RegisterFunc      RegisterFuncType
-	PullFunc          PullFuncType
-	ReportFunc        ReportFuncType
-	ServiceDownFunc   ServiceDownFuncType
-	ClientErrorFunc   ClientErrorFuncType
-	ReportMetricsFunc ReportMetricsFuncType
+	RegisterFunc       RegisterFuncType
+	PullFunc           PullFuncType
+	ReportFunc         ReportFuncType
+	ServiceDownFunc    ServiceDownFuncType
+	ClientErrorFunc    ClientErrorFuncType
+	ReportMetricsFunc  ReportMetricsFuncType
+	HeartBeatFunc      HeartBeatFuncType
+	ReportSeedFunc     ReportSeedFuncType
+	GetPieceMD5sFunc   GetPieceMD5sFuncType
+	ReportPiecesFunc   ReportPiecesFuncType
+	ExtendProgressFunc ExtendProgressFuncType
+	KeepaliveFunc      KeepaliveFuncType
+	VersionFunc        VersionFuncType
+	ProbeBandwidthFunc ProbeBandwidthFuncType
 }
 
 var _ api.SupernodeAPI = &MockSupernodeAPI{}
@@ -184,7 +216,10 @@ func (m *MockSupernodeAPI) ReportMetrics(ip string, req *api_types.TaskMetricsRe
 	return nil, nil
 }
 
-func (m *MockSupernodeAPI) HeartBeat(node string, req *api_types.HeartBeatRequest) (resp *types.HeartBeatResponse, err error) {
+func (m *MockSupernodeAPI) HeartBeat(node string, req *api_types.HeartBeatRequest) (resp *api_types.HeartBeatResponse, err error) {
+	if m.HeartBeatFunc != nil {
+		return m.HeartBeatFunc(node, req)
+	}
 	return nil, nil
 }
 func (m *MockSupernodeAPI) FetchP2PNetworkInfo(node string, start int, limit int, req *api_types.NetworkInfoFetchRequest) (resp *api_types.NetworkInfoFetchResponse, e error) {
@@ -200,6 +235,62 @@ func (m *MockSupernodeAPI) ReportResourceDeleted(node string, taskID string, cid
 	return nil, nil
 }
 
+// ReportSeed implements SupernodeAPI#ReportSeed.
+func (m *MockSupernodeAPI) ReportSeed(node string, req *api_types.PeerSeedRequest) (*types.BaseResponse, error) {
+	if m.ReportSeedFunc != nil {
+		return m.ReportSeedFunc(node, req)
+	}
+	return nil, nil
+}
+
+// GetPieceMD5s implements SupernodeAPI#GetPieceMD5s.
+func (m *MockSupernodeAPI) GetPieceMD5s(node string, taskID string, start int, limit int, groupSize int) (*api_types.TaskPieceMD5s, error) {
+	if m.GetPieceMD5sFunc != nil {
+		return m.GetPieceMD5sFunc(node, taskID, start, limit, groupSize)
+	}
+	return nil, nil
+}
+
+// ReportPieces implements SupernodeAPI#ReportPieces.
+func (m *MockSupernodeAPI) ReportPieces(node string, req *api_types.PieceSuccessRequest) (*types.BaseResponse, error) {
+	if m.ReportPiecesFunc != nil {
+		return m.ReportPiecesFunc(node, req)
+	}
+	return nil, nil
+}
+
+// ExtendProgress implements SupernodeAPI#ExtendProgress.
+func (m *MockSupernodeAPI) ExtendProgress(node string, req *api_types.ProgressExtensionRequest) (*api_types.ProgressExtensionResponse, error) {
+	if m.ExtendProgressFunc != nil {
+		return m.ExtendProgressFunc(node, req)
+	}
+	return nil, nil
+}
+
+// Keepalive implements SupernodeAPI#Keepalive.
+func (m *MockSupernodeAPI) Keepalive(node string, req *api_types.PeerKeepaliveRequest) (*api_types.PeerKeepaliveResponse, error) {
+	if m.KeepaliveFunc != nil {
+		return m.KeepaliveFunc(node, req)
+	}
+	return nil, nil
+}
+
+// Version implements SupernodeAPI#Version.
+func (m *MockSupernodeAPI) Version(node string) (*api_types.DragonflyVersion, error) {
+	if m.VersionFunc != nil {
+		return m.VersionFunc(node)
+	}
+	return nil, nil
+}
+
+// ProbeBandwidth implements SupernodeAPI#ProbeBandwidth.
+func (m *MockSupernodeAPI) ProbeBandwidth(node string, size int64) (int64, error) {
+	if m.ProbeBandwidthFunc != nil {
+		return m.ProbeBandwidthFunc(node, size)
+	}
+	return size, nil
+}
+
 // CreateRegisterFunc creates a mock register function.
 func CreateRegisterFunc() RegisterFuncType {
 	var newResponse = func(code int, msg string) *types.RegisterResponse {
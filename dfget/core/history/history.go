@@ -0,0 +1,238 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package history records the finished downloads of dfget in a local database,
+// so that users could audit what the node fetched and how efficiently.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DirName is the name of the directory in the work home which stores the database.
+	DirName = "history"
+
+	// FileName is the name of the database file, which stores a record in JSON per line.
+	FileName = "history.json"
+
+	// DefaultMaxSize is the default max size of the database file. The older half
+	// of the records are removed when it's exceeded.
+	DefaultMaxSize = 4 * 1024 * 1024
+)
+
+/* the status of the records */
+const (
+	StatusSuccess = "success"
+	StatusFail    = "fail"
+)
+
+// Record is a finished download of dfget.
+type Record struct {
+	// Time is the time when the download started.
+	Time time.Time `json:"time"`
+
+	URL    string `json:"url"`
+	Output string `json:"output"`
+
+	// Digest is the digest of the file in the form of algorithm:value, such as md5:xxx.
+	Digest string `json:"digest,omitempty"`
+
+	// Size is the length of the file.
+	Size int64 `json:"size"`
+
+	// Duration is the seconds which the download cost.
+	Duration float64 `json:"duration"`
+
+	// P2PRatio is the ratio of the bytes downloaded from the other peers to the file length.
+	P2PRatio float64 `json:"p2pRatio"`
+
+	BackSourceReason int `json:"backSourceReason,omitempty"`
+
+	// ExitCode is the exit code of dfget, 0 means the download succeeded.
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Status returns the status of the record.
+func (r *Record) Status() string {
+	if r.ExitCode == 0 {
+		return StatusSuccess
+	}
+	return StatusFail
+}
+
+// Filter selects the records to list.
+type Filter struct {
+	// URL selects the records whose url contains it.
+	URL string
+
+	// Since selects the records which started after it.
+	Since time.Time
+
+	// Status selects the records with the status, must be success/fail.
+	Status string
+
+	// Limit is the max number of the latest records to list, 0 means unlimited.
+	Limit int
+}
+
+func (f *Filter) match(r *Record) bool {
+	if f == nil {
+		return true
+	}
+	if f.URL != "" && !strings.Contains(r.URL, f.URL) {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	return f.Status == "" || f.Status == r.Status()
+}
+
+// DB is the database of the download records. It's shared by the dfget processes
+// of the same work home, which are serialized by the lock of the directory of the file.
+type DB struct {
+	path    string
+	maxSize int64
+}
+
+// New creates a DB stored in the file path. The DefaultMaxSize is used if maxSize isn't positive.
+func New(path string, maxSize int64) *DB {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &DB{path: path, maxSize: maxSize}
+}
+
+// Append appends the record to the database.
+func (db *DB) Append(r *Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(db.path)
+	if err := fileutils.CreateDirectory(dir); err != nil {
+		return err
+	}
+	lock := fileutils.NewFileLock(dir)
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	f, err := os.OpenFile(db.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open history file")
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to write history file")
+	}
+
+	if info, err := os.Stat(db.path); err == nil && info.Size() > db.maxSize {
+		return db.compact()
+	}
+	return nil
+}
+
+// compact removes the older half of the records. It must be called with the lock held.
+func (db *DB) compact() error {
+	lines, err := db.readLines()
+	if err != nil {
+		return err
+	}
+	lines = lines[len(lines)/2:]
+
+	f, err := ioutil.TempFile(filepath.Dir(db.path), FileName+".")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), db.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrapf(err, "failed to compact history file")
+	}
+	return nil
+}
+
+// List returns the records matching the filter from the oldest to the latest.
+// The lines which can't be parsed, such as the ones written partially, are skipped.
+func (db *DB) List(filter *Filter) ([]*Record, error) {
+	lines, err := db.readLines()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	for _, line := range lines {
+		r := &Record{}
+		if err := json.Unmarshal(line, r); err != nil {
+			continue
+		}
+		if filter.match(r) {
+			records = append(records, r)
+		}
+	}
+	if filter != nil && filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[len(records)-filter.Limit:]
+	}
+	return records, nil
+}
+
+func (db *DB) readLines() ([][]byte, error) {
+	content, err := ioutil.ReadFile(db.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read history file")
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.Split(content, []byte{'\n'}) {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type HistoryTestSuite struct {
+	workHome string
+}
+
+func init() {
+	check.Suite(&HistoryTestSuite{})
+}
+
+func (s *HistoryTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-HistoryTestSuite-")
+}
+
+func (s *HistoryTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+func (s *HistoryTestSuite) TestList(c *check.C) {
+	db := New(filepath.Join(s.workHome, DirName, FileName), 0)
+	records, err := db.List(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(records, check.HasLen, 0)
+
+	now := time.Now()
+	for i, url := range []string{"http://a.com/1", "http://b.com/2", "http://a.com/3"} {
+		r := &Record{Time: now.Add(time.Duration(i) * time.Hour), URL: url, Size: int64(i)}
+		if i == 1 {
+			r.ExitCode = 1104
+		}
+		c.Assert(db.Append(r), check.IsNil)
+	}
+
+	records, err = db.List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(records, check.HasLen, 3)
+	c.Check(records[1].Status(), check.Equals, StatusFail)
+
+	records, _ = db.List(&Filter{URL: "a.com"})
+	c.Check(records, check.HasLen, 2)
+	records, _ = db.List(&Filter{Status: StatusSuccess, Since: now.Add(time.Minute)})
+	c.Assert(records, check.HasLen, 1)
+	c.Check(records[0].URL, check.Equals, "http://a.com/3")
+	records, _ = db.List(&Filter{Limit: 1})
+	c.Assert(records, check.HasLen, 1)
+	c.Check(records[0].URL, check.Equals, "http://a.com/3")
+
+	// the line written partially is skipped
+	f, err := os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND, 0644)
+	c.Assert(err, check.IsNil)
+	f.WriteString(`{"url":"http://c.com`)
+	f.Close()
+	records, err = db.List(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(records, check.HasLen, 3)
+}
+
+func (s *HistoryTestSuite) TestCompact(c *check.C) {
+	db := New(filepath.Join(s.workHome, FileName), 1024)
+	for i := 0; i < 20; i++ {
+		c.Assert(db.Append(&Record{URL: "http://a.com/file", Size: int64(i)}), check.IsNil)
+	}
+
+	info, err := os.Stat(db.path)
+	c.Assert(err, check.IsNil)
+	c.Check(info.Size() <= 1024, check.Equals, true)
+
+	records, err := db.List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(records) > 0, check.Equals, true)
+	c.Check(records[len(records)-1].Size, check.Equals, int64(19))
+}
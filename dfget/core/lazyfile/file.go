@@ -0,0 +1,288 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lazyfile provides the random access to the file of a task whose CDN
+// has finished. Only the pieces covering the requested offsets are fetched
+// on demand, and they are cached locally so that each piece is fetched once.
+package lazyfile
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/rangeutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// md5sPageSize is the number of the piece md5s fetched from supernode at once,
+// so the piece md5s of a very large file are not fetched all at once.
+var md5sPageSize = 1024
+
+// File reads the file of a task at random offsets.
+type File struct {
+	taskID   string
+	manifest *apiTypes.TaskPieceMD5s
+	// dataSize is the size of the data in a piece without the piece head and tail.
+	dataSize int64
+
+	supernodeAPI api.SupernodeAPI
+	node         string
+	downloadAPI  api.DownloadAPI
+
+	// md5sLock protects md5s which caches the fetched pages of the piece md5s.
+	md5sLock sync.Mutex
+	md5s     map[int][]string
+	// root is the merkle root of the piece md5s returned with the first page,
+	// and the pages fetched later are verified against it.
+	root string
+
+	// cache is the sparse file which stores the fetched pieces at their offsets.
+	cache *os.File
+
+	// the lock of a piece protects its element of fetched,
+	// and makes sure that the piece is fetched only once.
+	locks   []sync.Mutex
+	fetched []bool
+}
+
+// Open opens the file of the task whose CDN has finished on the supernode node,
+// and it's cached in the file named by taskID in cacheDir.
+func Open(supernodeAPI api.SupernodeAPI, downloadAPI api.DownloadAPI, node, taskID, cacheDir string) (*File, error) {
+	manifest, err := supernodeAPI.GetPieceMD5s(node, taskID, 0, md5sPageSize, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the pieces of task %s", taskID)
+	}
+	f, err := newFile(manifest, downloadAPI, filepath.Join(cacheDir, taskID))
+	if err != nil {
+		return nil, err
+	}
+	f.supernodeAPI = supernodeAPI
+	f.node = node
+	return f, nil
+}
+
+// newFile creates the File of the manifest which contains the first page of the piece md5s.
+func newFile(manifest *apiTypes.TaskPieceMD5s, downloadAPI api.DownloadAPI, cachePath string) (*File, error) {
+	if manifest.PieceSize <= config.PieceMetaSize || manifest.FileLength < 0 {
+		return nil, fmt.Errorf("invalid piece size %d or file length %d of task %s",
+			manifest.PieceSize, manifest.FileLength, manifest.TaskID)
+	}
+	cache, err := fileutils.OpenFile(cachePath, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// the supernode which doesn't support the pagination returns all piece md5s
+	pieces := int(manifest.PieceTotal)
+	if pieces == 0 {
+		pieces = len(manifest.PieceMD5s)
+	}
+	f := &File{
+		taskID:      manifest.TaskID,
+		manifest:    manifest,
+		dataSize:    int64(manifest.PieceSize - config.PieceMetaSize),
+		downloadAPI: downloadAPI,
+		md5s:        make(map[int][]string),
+		root:        manifest.MerkleRoot,
+		cache:       cache,
+		locks:       make([]sync.Mutex, pieces),
+		fetched:     make([]bool, pieces),
+	}
+	if err := f.verifyMD5s(int(manifest.Start), manifest.PieceMD5s, manifest.MerkleProof); err != nil {
+		cache.Close()
+		os.Remove(cachePath)
+		return nil, err
+	}
+	for start := 0; start < len(manifest.PieceMD5s); start += md5sPageSize {
+		end := start + md5sPageSize
+		if end > len(manifest.PieceMD5s) {
+			end = len(manifest.PieceMD5s)
+		}
+		f.md5s[start/md5sPageSize] = manifest.PieceMD5s[start:end]
+	}
+	return f, nil
+}
+
+// MerkleRoot returns the merkle root of the piece md5s of the file,
+// it's empty if supernode doesn't publish it.
+func (f *File) MerkleRoot() string {
+	return f.root
+}
+
+// Size returns the length of the file.
+func (f *File) Size() int64 {
+	return f.manifest.FileLength
+}
+
+// PieceSize returns the size of the pieces of the file wrapped by the piece head and tail.
+func (f *File) PieceSize() int32 {
+	return f.manifest.PieceSize
+}
+
+// ReadAt implements io.ReaderAt, it fetches the pieces covering the range at first.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	size := f.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > size {
+		end = size
+	}
+
+	for n := off / f.dataSize; n <= (end-1)/f.dataSize; n++ {
+		if err := f.ensure(int(n)); err != nil {
+			return 0, err
+		}
+	}
+
+	read, err := f.cache.ReadAt(p[:end-off], off)
+	if err == nil && end-off < int64(len(p)) {
+		err = io.EOF
+	}
+	return read, err
+}
+
+// Close closes and removes the cache file.
+func (f *File) Close() error {
+	f.cache.Close()
+	return os.Remove(f.cache.Name())
+}
+
+// ensure makes sure that the piece pieceNum has been fetched into the cache file.
+func (f *File) ensure(pieceNum int) error {
+	if pieceNum >= len(f.fetched) {
+		return fmt.Errorf("piece %d is out of the %d pieces of task %s", pieceNum, len(f.fetched), f.taskID)
+	}
+
+	f.locks[pieceNum].Lock()
+	defer f.locks[pieceNum].Unlock()
+	if f.fetched[pieceNum] {
+		return nil
+	}
+
+	start := time.Now()
+	data, err := f.fetch(pieceNum)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch piece %d of task %s", pieceNum, f.taskID)
+	}
+	if _, err := f.cache.WriteAt(data, int64(pieceNum)*f.dataSize); err != nil {
+		return err
+	}
+	f.fetched[pieceNum] = true
+	logrus.Debugf("fetch piece %d of task %s cost:%.3fs", pieceNum, f.taskID, time.Since(start).Seconds())
+	return nil
+}
+
+// fetch downloads the piece from supernode and returns the data without the piece head and tail.
+func (f *File) fetch(pieceNum int) ([]byte, error) {
+	pieceSize := f.manifest.PieceSize
+	req := &api.DownloadRequest{
+		Path:       f.manifest.Path,
+		PieceRange: rangeutils.CalculatePieceRange(pieceNum, pieceSize),
+		PieceNum:   pieceNum,
+		PieceSize:  pieceSize,
+	}
+	timeout := netutils.CalculateTimeout(int64(pieceSize), 0, config.DefaultMinRate, 10*time.Second)
+	resp, err := f.downloadAPI.Download(f.manifest.PeerIP, int(f.manifest.PeerPort), req, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	content := bytes.NewBuffer(make([]byte, 0, pieceSize))
+	if _, err := content.ReadFrom(io.LimitReader(resp.Body, int64(pieceSize))); err != nil {
+		return nil, err
+	}
+
+	pieceMD5, err := f.PieceMD5(pieceNum)
+	if err != nil {
+		return nil, err
+	}
+	raw := content.Bytes()
+	expected := strings.Split(pieceMD5, ":")[0]
+	if sum := md5.Sum(raw); expected != "" && hex.EncodeToString(sum[:]) != expected {
+		return nil, fmt.Errorf("md5 not match, expected:%s real:%s", expected, hex.EncodeToString(sum[:]))
+	}
+	if len(raw) < config.PieceMetaSize {
+		return nil, fmt.Errorf("invalid piece length %d", len(raw))
+	}
+	return raw[config.PieceHeadSize : len(raw)-config.PieceTailSize], nil
+}
+
+// PieceMD5 returns the md5 of the piece in the format of "md5:length", and fetches
+// the page of the piece md5s from supernode if it hasn't been fetched.
+func (f *File) PieceMD5(pieceNum int) (string, error) {
+	f.md5sLock.Lock()
+	defer f.md5sLock.Unlock()
+
+	page := pieceNum / md5sPageSize
+	md5s, ok := f.md5s[page]
+	if !ok {
+		if f.supernodeAPI == nil {
+			return "", fmt.Errorf("the md5 of piece %d is unknown", pieceNum)
+		}
+		resp, err := f.supernodeAPI.GetPieceMD5s(f.node, f.taskID, page*md5sPageSize, md5sPageSize, 0)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get the piece md5s from %d", page*md5sPageSize)
+		}
+		if err := f.verifyMD5s(page*md5sPageSize, resp.PieceMD5s, resp.MerkleProof); err != nil {
+			return "", err
+		}
+		md5s = resp.PieceMD5s
+		f.md5s[page] = md5s
+	}
+	if i := pieceNum % md5sPageSize; i < len(md5s) {
+		return md5s[i], nil
+	}
+	return "", fmt.Errorf("the md5 of piece %d is missing", pieceNum)
+}
+
+// verifyMD5s verifies the piece md5s from start against the merkle root with the proof,
+// so the pieces can be verified without fetching the md5s of all pieces.
+func (f *File) verifyMD5s(start int, md5s, proof []string) error {
+	if f.root == "" || len(md5s) == 0 {
+		return nil
+	}
+	if !digest.VerifyMerkleRange(f.root, len(f.fetched), start, md5s, proof) {
+		return fmt.Errorf("the md5s of pieces [%d, %d) of task %s don't match the merkle root %s",
+			start, start+len(md5s), f.taskID, f.root)
+	}
+	return nil
+}
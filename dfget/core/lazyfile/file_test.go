@@ -0,0 +1,234 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lazyfile
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type LazyFileTestSuite struct {
+	workHome string
+}
+
+func init() {
+	check.Suite(&LazyFileTestSuite{})
+}
+
+func (s *LazyFileTestSuite) SetUpSuite(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-LazyFileTestSuite-")
+}
+
+func (s *LazyFileTestSuite) TearDownSuite(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+func (s *LazyFileTestSuite) TestReadAt(c *check.C) {
+	// 3 pieces with the data size of 5
+	data := []byte("0123456789abcde")
+	cdnFile, md5s := wrapPieces(data, 5)
+
+	var requests, pages int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(cdnFile))
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	peerPort, _ := strconv.Atoi(port)
+
+	md5sPageSize = 2
+	defer func() { md5sPageSize = 1024 }()
+	supernodeAPI := &helper.MockSupernodeAPI{
+		GetPieceMD5sFunc: func(node string, taskID string, start int, limit int, groupSize int) (*apiTypes.TaskPieceMD5s, error) {
+			atomic.AddInt32(&pages, 1)
+			end := start + limit
+			if end > len(md5s) {
+				end = len(md5s)
+			}
+			return &apiTypes.TaskPieceMD5s{
+				TaskID:      taskID,
+				PieceSize:   10,
+				FileLength:  int64(len(data)),
+				PieceMD5s:   md5s[start:end],
+				PieceTotal:  int32(len(md5s)),
+				Start:       int32(start),
+				Path:        "/download/foo",
+				PeerIP:      host,
+				PeerPort:    int32(peerPort),
+				MerkleRoot:  digest.MerkleRoot(md5s),
+				MerkleProof: digest.MerkleRangeProof(md5s, start, end),
+			}, nil
+		},
+	}
+	f, err := Open(supernodeAPI, api.NewDownloadAPI(), "node", "foo", s.workHome)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	c.Check(f.Size(), check.Equals, int64(len(data)))
+	c.Check(f.MerkleRoot(), check.Equals, digest.MerkleRoot(md5s))
+
+	buf := make([]byte, 4)
+	n, err := f.ReadAt(buf, 7)
+	c.Assert(err, check.IsNil)
+	c.Check(string(buf[:n]), check.Equals, "789a")
+	// only the pieces covering the range are fetched
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(2))
+	// the md5 of piece 2 is in the second page
+	c.Check(atomic.LoadInt32(&pages), check.Equals, int32(2))
+
+	n, err = f.ReadAt(buf, 5)
+	c.Assert(err, check.IsNil)
+	c.Check(string(buf[:n]), check.Equals, "5678")
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(2))
+
+	n, err = f.ReadAt(buf, 13)
+	c.Check(err, check.Equals, io.EOF)
+	c.Check(string(buf[:n]), check.Equals, "de")
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(2))
+
+	_, err = f.ReadAt(buf, 15)
+	c.Check(err, check.Equals, io.EOF)
+
+	all, err := ioutil.ReadAll(io.NewSectionReader(f, 0, f.Size()))
+	c.Assert(err, check.IsNil)
+	c.Check(string(all), check.Equals, string(data))
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(3))
+	c.Check(atomic.LoadInt32(&pages), check.Equals, int32(2))
+}
+
+func (s *LazyFileTestSuite) TestReadAtMd5NotMatch(c *check.C) {
+	cdnFile, md5s := wrapPieces([]byte("0123456789"), 5)
+	md5s[1] = "x:10"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(cdnFile))
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	peerPort, _ := strconv.Atoi(port)
+
+	f, err := newFile(&apiTypes.TaskPieceMD5s{
+		TaskID:     "bar",
+		PieceSize:  10,
+		FileLength: 10,
+		PieceMD5s:  md5s,
+		PeerIP:     host,
+		PeerPort:   int32(peerPort),
+	}, api.NewDownloadAPI(), s.workHome+"/bar")
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	buf := make([]byte, 5)
+	_, err = f.ReadAt(buf, 0)
+	c.Check(err, check.IsNil)
+	_, err = f.ReadAt(buf, 5)
+	c.Check(err, check.NotNil)
+}
+
+func (s *LazyFileTestSuite) TestReadAtMerkleRootNotMatch(c *check.C) {
+	data := []byte("0123456789abcde")
+	cdnFile, md5s := wrapPieces(data, 5)
+	root := digest.MerkleRoot(md5s)
+	tampered := append([]string{}, md5s...)
+	// the piece and its md5 are both replaced in the page fetched later
+	cdnFile[10+config.PieceHeadSize] = 'x'
+	sum := md5.Sum(cdnFile[10:])
+	tampered[2] = fmt.Sprintf("%s:%d", hex.EncodeToString(sum[:]), len(cdnFile)-10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(cdnFile))
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	peerPort, _ := strconv.Atoi(port)
+
+	md5sPageSize = 2
+	defer func() { md5sPageSize = 1024 }()
+	supernodeAPI := &helper.MockSupernodeAPI{
+		GetPieceMD5sFunc: func(node string, taskID string, start int, limit int, groupSize int) (*apiTypes.TaskPieceMD5s, error) {
+			end := start + limit
+			if end > len(md5s) {
+				end = len(md5s)
+			}
+			return &apiTypes.TaskPieceMD5s{
+				TaskID:      taskID,
+				PieceSize:   10,
+				FileLength:  int64(len(data)),
+				PieceMD5s:   tampered[start:end],
+				PieceTotal:  int32(len(md5s)),
+				Start:       int32(start),
+				PeerIP:      host,
+				PeerPort:    int32(peerPort),
+				MerkleRoot:  root,
+				MerkleProof: digest.MerkleRangeProof(md5s, start, end),
+			}, nil
+		},
+	}
+	f, err := Open(supernodeAPI, api.NewDownloadAPI(), "node", "baz", s.workHome)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	buf := make([]byte, 5)
+	_, err = f.ReadAt(buf, 0)
+	c.Check(err, check.IsNil)
+	_, err = f.ReadAt(buf, 10)
+	c.Check(err, check.ErrorMatches, ".*don't match the merkle root.*")
+}
+
+// wrapPieces wraps the data into pieces like CDN of supernode,
+// and returns the wrapped content and the md5 of each piece.
+func wrapPieces(data []byte, dataSize int) ([]byte, []string) {
+	var (
+		content []byte
+		md5s    []string
+	)
+	for start := 0; start < len(data); start += dataSize {
+		end := start + dataSize
+		if end > len(data) {
+			end = len(data)
+		}
+		piece := append([]byte("head"), data[start:end]...)
+		piece = append(piece, config.PieceTailChar)
+		sum := md5.Sum(piece)
+		md5s = append(md5s, fmt.Sprintf("%s:%d", hex.EncodeToString(sum[:]), len(piece)))
+		content = append(content, piece...)
+	}
+	return content, md5s
+}
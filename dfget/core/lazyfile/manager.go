@@ -0,0 +1,119 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lazyfile
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Manager opens the files of the tasks lazily and shares them between the readers.
+type Manager struct {
+	supernodeAPI api.SupernodeAPI
+	downloadAPI  api.DownloadAPI
+
+	// nodes are the supernodes which are tried in order to open a file.
+	nodes    []string
+	cacheDir string
+
+	mu    sync.Mutex
+	files map[string]*File
+}
+
+// NewManager creates a Manager which caches the pieces in cacheDir.
+func NewManager(nodes []string, cacheDir string) *Manager {
+	return &Manager{
+		supernodeAPI: api.NewSupernodeAPI(),
+		downloadAPI:  api.NewDownloadAPI(),
+		nodes:        nodes,
+		cacheDir:     cacheDir,
+		files:        make(map[string]*File),
+	}
+}
+
+// Open returns the file of the task, which is opened at the first time.
+func (m *Manager) Open(taskID string) (*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[taskID]; ok {
+		return f, nil
+	}
+
+	err := errors.New("no supernode is available")
+	for _, node := range m.nodes {
+		var f *File
+		if f, err = Open(m.supernodeAPI, m.downloadAPI, node, taskID, m.cacheDir); err == nil {
+			m.files[taskID] = f
+			return f, nil
+		}
+		logrus.Warnf("failed to open task %s on supernode %s: %v", taskID, node, err)
+	}
+	return nil, err
+}
+
+// Len returns the number of the opened files.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.files)
+}
+
+// Close closes all the opened files and removes their caches.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for taskID, f := range m.files {
+		f.Close()
+		delete(m.files, taskID)
+	}
+}
+
+// ServeHTTP serves the ranged requests to the file of the task
+// whose ID is the last element of the request path.
+// If the query root is given, it must be the merkle root of the piece md5s
+// published by supernode, which all the pieces read are verified against.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	taskID := path.Base(r.URL.Path)
+	f, err := m.Open(taskID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if root := r.URL.Query().Get("root"); root != "" && !strings.EqualFold(root, f.MerkleRoot()) {
+		http.Error(w, fmt.Sprintf("the merkle root of task %s is %q rather than %s", taskID, f.MerkleRoot(), root),
+			http.StatusPreconditionFailed)
+		return
+	}
+	// avoid sniffing the content type which fetches the first piece
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, taskID, time.Time{}, io.NewSectionReader(f, 0, f.Size()))
+}
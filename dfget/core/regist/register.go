@@ -29,6 +29,7 @@ import (
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/util"
 	"github.com/dragonflyoss/Dragonfly/version"
 
@@ -66,6 +67,8 @@ func (s *supernodeRegister) Register(peerPort int) (*RegisterResult, *errortypes
 		node       *locator.Supernode
 		retryTimes = 0
 		start      = time.Now()
+		sent       time.Time
+		received   time.Time
 	)
 
 	nextOrRetry := func() *locator.Supernode {
@@ -80,21 +83,29 @@ func (s *supernodeRegister) Register(peerPort int) (*RegisterResult, *errortypes
 
 	logrus.Infof("do register to one of %v", s.locator)
 	req := s.constructRegisterRequest(peerPort)
-	for node = s.locator.Next(); node != nil; node = nextOrRetry() {
-		if s.lastRegisteredNode == node {
-			logrus.Warnf("the last registered node is the same(%v)", s.lastRegisteredNode)
-			continue
-		}
-		req.SupernodeIP = node.IP
-		nodeHost := nodeHostStr(node)
-		resp, e = s.api.Register(nodeHost, req)
-		logrus.Infof("do register to %s, res:%s error:%v", nodeHost, resp, e)
-		if e != nil {
-			continue
-		}
-		if resp.Code == constants.Success || resp.Code == constants.CodeNeedAuth ||
-			resp.Code == constants.CodeURLNotReachable {
-			break
+	if s.cfg.RegisterHedgeDelay > 0 && s.cfg.RegisterHedges > 0 {
+		a := s.registerHedged(req)
+		node, resp, e, sent, received = a.node, a.resp, a.err, a.sent, a.received
+	} else {
+		for node = s.locator.Next(); node != nil; node = nextOrRetry() {
+			if s.lastRegisteredNode == node {
+				logrus.Warnf("the last registered node is the same(%v)", s.lastRegisteredNode)
+				continue
+			}
+			req.SupernodeIP = node.IP
+			nodeHost := nodeHostStr(node)
+			sent = time.Now()
+			req.ClientTime = timeutils.GetCurrentTimeMillis()
+			resp, e = s.api.Register(nodeHost, req)
+			received = time.Now()
+			logrus.Infof("do register to %s, res:%s error:%v", nodeHost, resp, e)
+			if e != nil {
+				locator.ReportHealth(s.locator, nodeHost, false)
+				continue
+			}
+			if isRegisterAccepted(resp) {
+				break
+			}
 		}
 	}
 
@@ -104,14 +115,132 @@ func (s *supernodeRegister) Register(peerPort int) (*RegisterResult, *errortypes
 		return nil, err
 	}
 
+	// bind the task to the supernode which schedules it
+	locator.ReportTask(s.locator, nodeHostStr(node), resp.Data.TaskID)
 	result := NewRegisterResult(nodeHostStr(node), s.cfg.URL,
 		resp.Data.TaskID, resp.Data.FileLength, resp.Data.PieceSize, resp.Data.CDNSource)
+	result.Digest = s.cfg.Digest
+	result.ResponseHeaders = resp.Data.ResponseHeaders
+	if resp.Data.ServerTime > 0 {
+		result.ClockOffset = timeutils.ClockOffset(sent, received, timeutils.MillisToTime(resp.Data.ServerTime))
+		if result.ClockOffset > config.DefaultClockSkewTolerance || result.ClockOffset < -config.DefaultClockSkewTolerance {
+			logrus.Warnf("the clock of supernode %s is %v ahead of the local one, which is compensated for its deadlines",
+				result.Node, result.ClockOffset)
+		}
+	}
 
 	logrus.Infof("do register result:%s and cost:%.3fs", resp,
 		time.Since(start).Seconds())
 	return result, nil
 }
 
+// registerAttempt is the result of a registration to a supernode.
+type registerAttempt struct {
+	node     *locator.Supernode
+	resp     *types.RegisterResponse
+	err      error
+	sent     time.Time
+	received time.Time
+}
+
+// isRegisterAccepted returns whether the supernode has answered the registration
+// definitely, so that it isn't sent to the other supernodes.
+func isRegisterAccepted(resp *types.RegisterResponse) bool {
+	return resp != nil && (resp.Code == constants.Success || resp.Code == constants.CodeNeedAuth ||
+		resp.Code == constants.CodeURLNotReachable)
+}
+
+// registerHedged registers to the supernodes in turn like Register does, but it doesn't
+// wait for a slow supernode longer than RegisterHedgeDelay before sending the registration
+// to the next one as well, with at most RegisterHedges hedged registrations in flight.
+// The first accepted response is used, and the ones accepted later are canceled.
+func (s *supernodeRegister) registerHedged(req *types.RegisterRequest) *registerAttempt {
+	var (
+		results     = make(chan *registerAttempt)
+		inflight    = 0
+		maxInflight = 1 + s.cfg.RegisterHedges
+		last        = &registerAttempt{}
+	)
+
+	launch := func() {
+		node := s.locator.Next()
+		for node != nil && node == s.lastRegisteredNode {
+			logrus.Warnf("the last registered node is the same(%v)", s.lastRegisteredNode)
+			node = s.locator.Next()
+		}
+		if node == nil {
+			return
+		}
+		inflight++
+		// every registration has its own copy of the request
+		r := *req
+		go func() { results <- s.registerTo(node, &r) }()
+	}
+
+	launch()
+	timer := time.NewTimer(s.cfg.RegisterHedgeDelay)
+	defer timer.Stop()
+	for inflight > 0 {
+		select {
+		case a := <-results:
+			inflight--
+			if a.err == nil && isRegisterAccepted(a.resp) {
+				go s.cancelRegistrations(results, inflight)
+				return a
+			}
+			if a.err != nil {
+				locator.ReportHealth(s.locator, nodeHostStr(a.node), false)
+			}
+			last = a
+			// fail over to the next supernode at once
+			if inflight < maxInflight {
+				launch()
+			}
+		case <-timer.C:
+			if inflight < maxInflight {
+				logrus.Infof("no supernode responds to the registration in %v, hedge it", s.cfg.RegisterHedgeDelay)
+				launch()
+			}
+			timer.Reset(s.cfg.RegisterHedgeDelay)
+		}
+	}
+	return last
+}
+
+// registerTo registers to the node, and retries for at most 3 times
+// if the supernode waits for the authentication.
+func (s *supernodeRegister) registerTo(node *locator.Supernode, req *types.RegisterRequest) *registerAttempt {
+	nodeHost := nodeHostStr(node)
+	req.SupernodeIP = node.IP
+	a := &registerAttempt{node: node}
+	for retryTimes := 0; ; retryTimes++ {
+		a.sent = time.Now()
+		req.ClientTime = timeutils.GetCurrentTimeMillis()
+		a.resp, a.err = s.api.Register(nodeHost, req)
+		a.received = time.Now()
+		logrus.Infof("do register to %s, res:%s error:%v", nodeHost, a.resp, a.err)
+		if a.err != nil || a.resp == nil || a.resp.Code != constants.CodeWaitAuth || retryTimes >= 3 {
+			return a
+		}
+		logrus.Infof("sleep 1.0 s to wait auth(%d/3)...", retryTimes+1)
+		time.Sleep(1000 * time.Millisecond)
+	}
+}
+
+// cancelRegistrations waits for the pending registrations, and reports the service down
+// to the supernodes which accept them, so that they don't schedule the peer for the task.
+func (s *supernodeRegister) cancelRegistrations(results <-chan *registerAttempt, pending int) {
+	for ; pending > 0; pending-- {
+		a := <-results
+		if a.err != nil || a.resp == nil || a.resp.Code != constants.Success || a.resp.Data == nil {
+			continue
+		}
+		nodeHost := nodeHostStr(a.node)
+		logrus.Infof("cancel the hedged registration to %s", nodeHost)
+		s.api.ServiceDown(nodeHost, a.resp.Data.TaskID, s.cfg.RV.Cid)
+	}
+}
+
 func (s *supernodeRegister) checkResponse(resp *types.RegisterResponse, e error) *errortypes.DfError {
 	if e != nil {
 		return errortypes.New(constants.HTTPError, e.Error())
@@ -136,7 +265,10 @@ func (s *supernodeRegister) constructRegisterRequest(port int) *types.RegisterRe
 		RawURL:     cfg.URL,
 		TaskURL:    cfg.RV.TaskURL,
 		Cid:        cfg.RV.Cid,
-		IP:         cfg.RV.LocalIP,
+		IP:         cfg.PeerIP(),
+		Addresses:  cfg.PeerAddresses(),
+		Transports: api.PieceTransports(),
+		AcceptPush: cfg.AcceptPush,
 		HostName:   hostname,
 		Port:       port,
 		Path:       getTaskPath(cfg.RV.TaskFileName),
@@ -145,9 +277,21 @@ func (s *supernodeRegister) constructRegisterRequest(port int) *types.RegisterRe
 		Headers:    cfg.Header,
 		Dfdaemon:   cfg.DFDaemon,
 		Insecure:   cfg.Insecure,
+		Filter:     cfg.Filter,
+		Priority:   cfg.Priority,
+		Labels:     cfg.Labels,
+		Group:      cfg.Group,
+
+		RangeOffset: cfg.RV.StreamRangeOffset,
+		RangeLength: cfg.RV.StreamRangeLength,
+	}
+	if !cfg.GroupDeadline.IsZero() {
+		req.GroupDeadline = timeutils.TimeToMillis(cfg.GroupDeadline)
 	}
 	if cfg.Md5 != "" {
 		req.Md5 = cfg.Md5
+	} else if cfg.Digest != "" {
+		req.Digest = cfg.Digest
 	} else if cfg.Identifier != "" {
 		req.Identifier = cfg.Identifier
 	}
@@ -199,6 +343,18 @@ type RegisterResult struct {
 	FileLength int64
 	PieceSize  int32
 	CDNSource  apiTypes.CdnSource
+
+	// ClockOffset is how far the clock of the supernode is ahead of the local one,
+	// which is estimated at the registration.
+	ClockOffset time.Duration
+
+	// Digest is the digest of the file which the task is registered with,
+	// formatted as "algorithm:encoded". It's empty if no digest is expected.
+	Digest string
+
+	// ResponseHeaders are the headers of the response of the source kept with the task
+	// by supernode, such as Content-Type.
+	ResponseHeaders map[string]string
 }
 
 func (r *RegisterResult) String() string {
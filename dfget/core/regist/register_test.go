@@ -23,13 +23,17 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	. "github.com/dragonflyoss/Dragonfly/dfget/core/helper"
 	"github.com/dragonflyoss/Dragonfly/dfget/locator"
+	dfgetTypes "github.com/dragonflyoss/Dragonfly/dfget/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
 
 	"github.com/go-check/check"
 )
@@ -117,6 +121,71 @@ func (s *RegistTestSuite) TestSupernodeRegister_Register(c *check.C) {
 	f(constants.HTTPError, "empty response, unknown error", nil)
 }
 
+func (s *RegistTestSuite) TestSupernodeRegister_ClockOffset(c *check.C) {
+	buf := &bytes.Buffer{}
+	cfg := s.createConfig(buf)
+	cfg.URL = "http://lowzj.com"
+	m := new(MockSupernodeAPI)
+	m.RegisterFunc = func(ip string, req *dfgetTypes.RegisterRequest) (*dfgetTypes.RegisterResponse, error) {
+		clientTime := timeutils.MillisToTime(req.ClientTime)
+		c.Check(time.Since(clientTime) < time.Minute, check.Equals, true)
+		return &dfgetTypes.RegisterResponse{
+			BaseResponse: &dfgetTypes.BaseResponse{Code: constants.Success},
+			Data: &dfgetTypes.RegisterResponseData{
+				TaskID:     "a",
+				ServerTime: timeutils.GetCurrentTimeMillis() + time.Hour.Nanoseconds()/time.Millisecond.Nanoseconds(),
+			},
+		}, nil
+	}
+
+	snLocator, _ := locator.NewStaticLocatorFromStr("test", []string{"127.0.0.1:8002"})
+	resp, e := NewSupernodeRegister(cfg, m, snLocator).Register(0)
+	c.Assert(e, check.IsNil)
+	c.Check(resp.ClockOffset > time.Hour-time.Second, check.Equals, true)
+	c.Check(resp.ClockOffset < time.Hour+time.Second, check.Equals, true)
+}
+
+func (s *RegistTestSuite) TestSupernodeRegister_Hedged(c *check.C) {
+	buf := &bytes.Buffer{}
+	cfg := s.createConfig(buf)
+	cfg.URL = "http://lowzj.com"
+	cfg.RegisterHedgeDelay = 20 * time.Millisecond
+	cfg.RegisterHedges = 1
+	nodes := []string{"127.0.0.1:8002", "127.0.0.2:8002"}
+
+	// the supernode which is registered to first is slow
+	var slow atomic.Value
+	canceled := make(chan string, 1)
+	m := new(MockSupernodeAPI)
+	m.RegisterFunc = func(ip string, req *dfgetTypes.RegisterRequest) (*dfgetTypes.RegisterResponse, error) {
+		if slow.Load() == nil {
+			slow.Store(ip)
+			time.Sleep(200 * time.Millisecond)
+		}
+		return &dfgetTypes.RegisterResponse{
+			BaseResponse: &dfgetTypes.BaseResponse{Code: constants.Success},
+			Data:         &dfgetTypes.RegisterResponseData{TaskID: ip},
+		}, nil
+	}
+	m.ServiceDownFunc = func(ip string, taskID string, cid string) (*dfgetTypes.BaseResponse, error) {
+		canceled <- taskID
+		return nil, nil
+	}
+
+	snLocator, _ := locator.NewStaticLocatorFromStr("test", nodes)
+	resp, e := NewSupernodeRegister(cfg, m, snLocator).Register(0)
+	c.Assert(e, check.IsNil)
+	c.Check(resp.Node, check.Not(check.Equals), slow.Load())
+	c.Check(resp.TaskID, check.Equals, resp.Node)
+
+	select {
+	case taskID := <-canceled:
+		c.Check(taskID, check.Equals, slow.Load())
+	case <-time.After(5 * time.Second):
+		c.Fatal("the hedged registration isn't canceled")
+	}
+}
+
 func (s *RegistTestSuite) TestSupernodeRegister_constructRegisterRequest(c *check.C) {
 	buf := &bytes.Buffer{}
 	cfg := s.createConfig(buf)
@@ -131,6 +200,24 @@ func (s *RegistTestSuite) TestSupernodeRegister_constructRegisterRequest(c *chec
 	req = register.constructRegisterRequest(0)
 	c.Assert(req.Identifier, check.Equals, "")
 	c.Assert(req.Md5, check.Equals, cfg.Md5)
+
+	cfg.Md5 = ""
+	cfg.Digest = "sha256:foo"
+	req = register.constructRegisterRequest(0)
+	c.Assert(req.Identifier, check.Equals, "")
+	c.Assert(req.Digest, check.Equals, cfg.Digest)
+	c.Assert(req.GroupDeadline, check.Equals, int64(0))
+
+	cfg.Group = "image"
+	cfg.GroupDeadline = time.Unix(100, 0)
+	req = register.constructRegisterRequest(0)
+	c.Assert(req.Group, check.Equals, "image")
+	c.Assert(req.GroupDeadline, check.Equals, int64(100000))
+
+	cfg.RV.StreamRangeOffset, cfg.RV.StreamRangeLength = 100, 50
+	req = register.constructRegisterRequest(0)
+	c.Assert(req.RangeOffset, check.Equals, int64(100))
+	c.Assert(req.RangeLength, check.Equals, int64(50))
 }
 
 // ----------------------------------------------------------------------------
@@ -0,0 +1,244 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// cacheFilesDir is the directory of the task files in the cache archive.
+const cacheFilesDir = "files"
+
+// ExportCache writes the task files served by the running peer server into
+// a gzipped tar archive, which contains the files and a manifest describing them
+// in the same format as the one of the seed directory.
+// It returns the number of the exported task files.
+func ExportCache(cfg *config.Config, w io.Writer) (int, error) {
+	tasks, err := listCachedTasks(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	manifest := &seedManifest{}
+	for _, task := range tasks {
+		name := cacheFilesDir + "/" + task.TaskID
+		if err := writeCacheFile(tw, name, task.Path); err != nil {
+			// the file may be deleted by the peer server at the same time
+			logrus.Warnf("failed to export task %s: %v", task.TaskID, err)
+			continue
+		}
+		manifest.Artifacts = append(manifest.Artifacts, &seedArtifact{
+			URL:        task.URL,
+			Path:       name,
+			TaskURL:    task.TaskURL,
+			Md5:        task.Md5,
+			Identifier: task.Identifier,
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name: config.SeedManifestFile,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}); err != nil {
+		return 0, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return 0, err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return 0, err
+	}
+	return len(manifest.Artifacts), nil
+}
+
+// listCachedTasks lists the finished tasks whose files are served by the running peer server.
+func listCachedTasks(cfg *config.Config) ([]*api.CachedTask, error) {
+	port := getPortFromMeta(cfg.RV.MetaPath)
+	if port <= 0 {
+		return nil, fmt.Errorf("no peer server is running")
+	}
+	ip := getServiceIPFromMeta(cfg.RV.MetaPath)
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+
+	tasks, err := uploaderAPI().ListTasks(ip, port)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list tasks of peer server %s:%d", ip, port)
+	}
+	return tasks, nil
+}
+
+func writeCacheFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+// ImportCache extracts the cache archive written by ExportCache into dir,
+// and merges the manifest of the archive into the one of dir.
+// The dir is used as the seed directory by the peer server, so that it reports
+// the imported task files to the supernodes when it starts.
+// It returns the number of the imported task files.
+func ImportCache(r io.Reader, dir string) (int, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid cache archive")
+	}
+	defer gr.Close()
+
+	if err := fileutils.CreateDirectory(dir); err != nil {
+		return 0, err
+	}
+
+	var (
+		manifest  *seedManifest
+		extracted = make(map[string]bool)
+		tr        = tar.NewReader(gr)
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid cache archive")
+		}
+
+		// the name is always cleaned as an absolute one to keep it in dir
+		name := strings.TrimPrefix(filepath.Clean("/"+hdr.Name), "/")
+		switch {
+		case name == config.SeedManifestFile:
+			manifest = &seedManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return 0, errors.Wrap(err, "invalid manifest of cache archive")
+			}
+		case hdr.Typeflag == tar.TypeReg && strings.HasPrefix(name, cacheFilesDir+"/"):
+			if err := extractCacheFile(tr, filepath.Join(dir, name)); err != nil {
+				return 0, err
+			}
+			extracted[name] = true
+		}
+	}
+	if manifest == nil {
+		return 0, fmt.Errorf("no manifest is found in cache archive")
+	}
+
+	var imported []*seedArtifact
+	for _, artifact := range manifest.Artifacts {
+		if extracted[artifact.Path] {
+			imported = append(imported, artifact)
+		}
+	}
+	if err := mergeSeedManifest(dir, imported); err != nil {
+		return 0, err
+	}
+	return len(imported), nil
+}
+
+func extractCacheFile(r io.Reader, path string) error {
+	if err := fileutils.CreateDirectory(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mergeSeedManifest adds the artifacts into the manifest of the seed directory,
+// the existing ones with the same path are replaced.
+func mergeSeedManifest(dir string, artifacts []*seedArtifact) error {
+	manifest, err := loadSeedManifest(dir)
+	if os.IsNotExist(errors.Cause(err)) {
+		manifest, err = &seedManifest{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]int)
+	for i, artifact := range manifest.Artifacts {
+		index[artifact.Path] = i
+	}
+	for _, artifact := range artifacts {
+		if i, ok := index[artifact.Path]; ok {
+			manifest.Artifacts[i] = artifact
+			continue
+		}
+		index[artifact.Path] = len(manifest.Artifacts)
+		manifest.Artifacts = append(manifest.Artifacts, artifact)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first to avoid a broken manifest
+	tmp := filepath.Join(dir, config.SeedManifestFile+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, config.SeedManifestFile))
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cachedTask is a task file served by the peer server which counts in the cache size.
+type cachedTask struct {
+	taskFileName string
+	path         string
+	size         int64
+	task         *taskConfig
+	// accessTime is the access time of the task when it's listed.
+	accessTime time.Time
+}
+
+// listCachedTasks returns the total size of the task files in the data directories,
+// and the finished ones which can be evicted from the least recently accessed.
+// The files staged in the seed directory are read-only, so they're not counted.
+func (ps *peerServer) listCachedTasks() (used int64, evictable []*cachedTask) {
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		task, ok := value.(*taskConfig)
+		if !ok || task.servicePath != "" {
+			return true
+		}
+		taskFileName := key.(string)
+		path := helper.GetServiceFile(taskFileName, task.dataDir)
+		info, err := os.Stat(path)
+		if err != nil {
+			return true
+		}
+		used += info.Size()
+		task.lock.RLock()
+		defer task.lock.RUnlock()
+		if task.finished && (ps.cfg.RV.MinSeedTime <= 0 || time.Since(task.finishTime) >= ps.cfg.RV.MinSeedTime) {
+			evictable = append(evictable, &cachedTask{
+				taskFileName: taskFileName,
+				path:         path,
+				size:         info.Size(),
+				task:         task,
+				accessTime:   task.accessTime,
+			})
+		}
+		return true
+	})
+	sort.Slice(evictable, func(i, j int) bool {
+		return evictable[i].accessTime.Before(evictable[j].accessTime)
+	})
+	return used, evictable
+}
+
+// evictCache evicts the least recently accessed finished task files until their
+// total size is within the CacheSize, and returns the total size after eviction.
+// The supernode is told that the evicted files are not served any more, so that
+// their pieces are scheduled to the other peers.
+func (ps *peerServer) evictCache() (used int64) {
+	used, evictable := ps.listCachedTasks()
+	capacity := int64(ps.cfg.RV.CacheSize)
+	if capacity <= 0 {
+		return used
+	}
+	for _, t := range evictable {
+		if used <= capacity {
+			break
+		}
+		logrus.Infof("stop seeding task %s: evicted since the cache size %d exceeds %d",
+			t.task.getTaskID(), used, capacity)
+		ps.api.ServiceDown(t.task.registration())
+		ps.syncTaskMap.Delete(t.taskFileName)
+		if err := removeServiceFile(t.path); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("failed to remove the evicted file %s: %v", t.path, err)
+		}
+		used -= t.size
+	}
+	return used
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+
+	"github.com/go-check/check"
+)
+
+func (s *PeerServerTestSuite) TestEvictCache(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	ps := newPeerServer(cfg, 0)
+	evicted := make(map[string]bool)
+	ps.api = &helper.MockSupernodeAPI{
+		ServiceDownFunc: func(ip string, taskID string, cid string) (*types.BaseResponse, error) {
+			evicted[taskID] = true
+			return nil, nil
+		},
+	}
+
+	now := time.Now()
+	store := func(name string, size int, task *taskConfig) string {
+		path := helper.GetServiceFile(name, cfg.RV.SystemDataDir)
+		c.Assert(ioutil.WriteFile(path, make([]byte, size), os.ModePerm), check.IsNil)
+		task.taskID = name
+		task.dataDir = cfg.RV.SystemDataDir
+		ps.syncTaskMap.Store(name, task)
+		return path
+	}
+	oldest := store("TestEvictCache-oldest", 40, &taskConfig{finished: true, accessTime: now.Add(-3 * time.Minute)})
+	old := store("TestEvictCache-old", 30, &taskConfig{finished: true, accessTime: now.Add(-2 * time.Minute)})
+	recent := store("TestEvictCache-recent", 20, &taskConfig{finished: true, accessTime: now})
+	// the unfinished task counts in the cache size but is never evicted
+	running := store("TestEvictCache-running", 10, &taskConfig{accessTime: now.Add(-time.Hour)})
+	defer func() {
+		for _, path := range []string{oldest, old, recent, running} {
+			os.Remove(path)
+		}
+	}()
+
+	// the cache size is not limited
+	c.Check(ps.evictCache(), check.Equals, int64(100))
+	c.Check(evicted, check.HasLen, 0)
+
+	cfg.RV.CacheSize = 50
+	c.Check(ps.evictCache(), check.Equals, int64(30))
+	c.Check(evicted, check.DeepEquals, map[string]bool{"TestEvictCache-oldest": true, "TestEvictCache-old": true})
+	c.Check(fileutils.PathExist(oldest), check.Equals, false)
+	c.Check(fileutils.PathExist(old), check.Equals, false)
+	c.Check(fileutils.PathExist(recent), check.Equals, true)
+	_, ok := ps.syncTaskMap.Load("TestEvictCache-old")
+	c.Check(ok, check.Equals, false)
+
+	cfg.RV.CacheSize = 1
+	c.Check(ps.evictCache(), check.Equals, int64(10))
+	c.Check(fileutils.PathExist(running), check.Equals, true)
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&CacheTestSuite{})
+}
+
+type CacheTestSuite struct {
+	workHome string
+}
+
+func (s *CacheTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-CacheTestSuite-")
+}
+
+func (s *CacheTestSuite) TearDownTest(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+func (s *CacheTestSuite) TestExportAndImportCache(c *check.C) {
+	cfg := helper.CreateConfig(nil, s.workHome)
+	ps := newPeerServer(cfg, 0)
+	helper.CreateTestFile(helper.GetServiceFile("a", cfg.RV.SystemDataDir), "hello")
+	ps.syncTaskMap.Store("a", &taskConfig{taskID: "ta", dataDir: cfg.RV.SystemDataDir,
+		finished: true, rawURL: "http://host/a?t=1", taskURL: "http://host/a", md5: "md5"})
+	// the source of the task is unknown
+	helper.CreateTestFile(helper.GetServiceFile("b", cfg.RV.SystemDataDir), "b")
+	ps.syncTaskMap.Store("b", &taskConfig{taskID: "tb", dataDir: cfg.RV.SystemDataDir, finished: true})
+	// the task is not finished
+	ps.syncTaskMap.Store("c", &taskConfig{taskID: "tc", dataDir: cfg.RV.SystemDataDir, rawURL: "http://host/c"})
+	// the file has been deleted
+	ps.syncTaskMap.Store("d", &taskConfig{taskID: "td", dataDir: cfg.RV.SystemDataDir,
+		finished: true, rawURL: "http://host/d"})
+
+	_, err := ExportCache(cfg, ioutil.Discard)
+	c.Check(err, check.NotNil)
+
+	srv := httptest.NewServer(ps.initRouter())
+	defer srv.Close()
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	updateServicePortInMeta(cfg.RV.MetaPath, port)
+	updateServiceIPInMeta(cfg.RV.MetaPath, host)
+
+	buf := &bytes.Buffer{}
+	count, err := ExportCache(cfg, buf)
+	c.Assert(err, check.IsNil)
+	c.Check(count, check.Equals, 1)
+
+	dir := filepath.Join(s.workHome, config.CacheDirName)
+	count, err = ImportCache(bytes.NewReader(buf.Bytes()), dir)
+	c.Assert(err, check.IsNil)
+	c.Check(count, check.Equals, 1)
+	// importing the same archive again doesn't duplicate the artifacts
+	_, err = ImportCache(bytes.NewReader(buf.Bytes()), dir)
+	c.Assert(err, check.IsNil)
+
+	manifest, err := loadSeedManifest(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(manifest.Artifacts, check.HasLen, 1)
+	c.Check(manifest.Artifacts[0], check.DeepEquals, &seedArtifact{
+		URL:     "http://host/a?t=1",
+		Path:    cacheFilesDir + "/ta",
+		TaskURL: "http://host/a",
+		Md5:     "md5",
+	})
+	content, err := ioutil.ReadFile(filepath.Join(dir, cacheFilesDir, "ta"))
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, "hello")
+}
+
+func (s *CacheTestSuite) TestImportInvalidCache(c *check.C) {
+	dir := filepath.Join(s.workHome, config.CacheDirName)
+
+	_, err := ImportCache(bytes.NewReader([]byte("invalid")), dir)
+	c.Check(err, check.NotNil)
+
+	// the archive without manifest
+	c.Check(importEntries(dir, map[string]string{"files/a": "a"}), check.NotNil)
+
+	// the entries out of the files directory are ignored
+	err = importEntries(dir, map[string]string{
+		"../../escaped":         "x",
+		"files/../../escaped":   "x",
+		config.SeedManifestFile: `{"artifacts": [{"url": "http://host/x", "path": "../../escaped"}]}`,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(fileutils.PathExist(filepath.Join(s.workHome, "escaped")), check.Equals, false)
+	manifest, err := loadSeedManifest(dir)
+	c.Assert(err, check.IsNil)
+	c.Check(manifest.Artifacts, check.HasLen, 0)
+}
+
+func importEntries(dir string, entries map[string]string) error {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range entries {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+
+	_, err := ImportCache(buf, dir)
+	return err
+}
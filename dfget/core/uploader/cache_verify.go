@@ -0,0 +1,276 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/lazyfile"
+	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
+	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyCacheOptions specifies which task files are verified by VerifyCache and how.
+type VerifyCacheOptions struct {
+	// TaskIDs are the tasks whose files are verified, and all are verified if it's empty.
+	TaskIDs []string
+	// Concurrency is the number of the task files verified in parallel.
+	Concurrency int
+	// Rate is the max number of the bytes read from the task files per second in total,
+	// it's unlimited if it's not positive.
+	Rate int64
+
+	// Repair re-fetches the corrupt pieces from the CDN of the supernodes Nodes,
+	// which are tried in order.
+	Repair bool
+	Nodes  []string
+}
+
+// VerifyCacheResult is the result of verifying a task file.
+type VerifyCacheResult struct {
+	TaskID string
+	Path   string
+
+	// Skipped is true if the task file can't be verified,
+	// since neither its piece index nor its md5 is stored.
+	Skipped bool
+	// Err is why the task file is corrupt, it's nil if the task file is intact.
+	Err error
+	// BadPieces are the numbers of the corrupt pieces, which are known if the task file
+	// is verified against its piece index or repaired.
+	BadPieces []int
+
+	// Repaired is true if the corrupt pieces are re-fetched and the task file is
+	// verified again successfully, and RepairErr is why it fails otherwise.
+	Repaired  bool
+	RepairErr error
+}
+
+// Corrupt returns whether the task file is still corrupt after the verification.
+func (r *VerifyCacheResult) Corrupt() bool {
+	return r.Err != nil && !r.Repaired
+}
+
+// VerifyCache re-reads the task files served by the running peer server in parallel, and verifies
+// them against their piece indexes next to them if exist, or else against their md5s. The corrupt
+// ones are repaired in place if opts.Repair is set, by re-fetching the pieces which don't match
+// the piece md5s of the task published by supernode, and then verified again.
+// The results are in the order of the task IDs.
+func VerifyCache(cfg *config.Config, opts *VerifyCacheOptions) ([]*VerifyCacheResult, error) {
+	tasks, err := listCachedTasks(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.TaskIDs) > 0 {
+		selected := make(map[string]bool)
+		for _, id := range opts.TaskIDs {
+			selected[id] = true
+		}
+		var filtered []*api.CachedTask
+		for _, task := range tasks {
+			if selected[task.TaskID] {
+				filtered = append(filtered, task)
+			}
+		}
+		tasks = filtered
+	}
+
+	v := &cacheVerifier{}
+	if opts.Rate > 0 {
+		v.limiter = ratelimiter.NewRateLimiter(ratelimiter.TransRate(opts.Rate), 2)
+	}
+	if opts.Repair {
+		dir, err := ioutil.TempDir(cfg.WorkHome, "verify-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		files := lazyfile.NewManager(opts.Nodes, dir)
+		defer files.Close()
+		v.open = files.Open
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var (
+		results = make([]*VerifyCacheResult, len(tasks))
+		indexes = make(chan int)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = v.verify(tasks[i], opts.Repair)
+			}
+		}()
+	}
+	for i := range tasks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+// cacheVerifier verifies and repairs the task files.
+type cacheVerifier struct {
+	// limiter limits the bytes read from the task files, it's nil if unlimited.
+	limiter *ratelimiter.RateLimiter
+	// open opens the task on supernode to fetch the pieces which repair the task file,
+	// it's nil if the task files aren't repaired.
+	open func(taskID string) (*lazyfile.File, error)
+}
+
+func (v *cacheVerifier) verify(task *api.CachedTask, repair bool) *VerifyCacheResult {
+	result := &VerifyCacheResult{TaskID: task.TaskID, Path: task.Path}
+	if result.BadPieces, result.Err = v.check(task); result.Err == errNotVerifiable {
+		result.Skipped, result.Err = true, nil
+	}
+	if result.Err == nil || !repair {
+		return result
+	}
+
+	logrus.Warnf("repair task file %s of task %s: %v", task.Path, task.TaskID, result.Err)
+	if result.BadPieces, result.RepairErr = v.repair(task); result.RepairErr == nil {
+		if _, err := v.check(task); err != nil && err != errNotVerifiable {
+			result.RepairErr = fmt.Errorf("still corrupt after repaired: %v", err)
+		}
+	}
+	result.Repaired = result.RepairErr == nil
+	return result
+}
+
+var errNotVerifiable = errors.New("neither piece index nor md5 is stored")
+
+// check verifies the task file against its piece index if it's stored, and the numbers
+// of the pieces which don't match are returned. Otherwise it's verified against its md5.
+func (v *cacheVerifier) check(task *api.CachedTask) ([]int, error) {
+	idx, err := readPieceIndex(task.Path)
+	if err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("failed to read the piece index of %s: %v", task.Path, err)
+	}
+	if err != nil && task.Md5 == "" {
+		return nil, errNotVerifiable
+	}
+
+	f, err := os.Open(task.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if idx == nil {
+		h := md5.New()
+		if _, err := io.Copy(h, v.reader(f)); err != nil {
+			return nil, err
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != task.Md5 {
+			return nil, fmt.Errorf("md5 %s doesn't match the expected %s", sum, task.Md5)
+		}
+		return nil, nil
+	}
+
+	entries, err := scanPieces(v.reader(f), idx.pieceSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != len(idx.entries) {
+		return nil, fmt.Errorf("%d pieces don't match %d pieces of the piece index", len(entries), len(idx.entries))
+	}
+	var bad []int
+	for i := range idx.entries {
+		if entries[i] != idx.entries[i] {
+			bad = append(bad, i)
+		}
+	}
+	if len(bad) > 0 {
+		return bad, fmt.Errorf("%d pieces don't match the piece index", len(bad))
+	}
+	return nil, nil
+}
+
+// repair compares the pieces of the task file with the piece md5s published by supernode,
+// and overwrites the ones which don't match with the pieces fetched from the CDN of supernode.
+// The numbers of the overwritten pieces are returned.
+func (v *cacheVerifier) repair(task *api.CachedTask) ([]int, error) {
+	lf, err := v.open(task.TaskID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(task.Path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != lf.Size() {
+		return nil, fmt.Errorf("file length %d doesn't match %d of the task", info.Size(), lf.Size())
+	}
+
+	entries, err := scanPieces(v.reader(f), lf.PieceSize())
+	if err != nil {
+		return nil, err
+	}
+	var repaired []int
+	for i, e := range entries {
+		expected, err := lf.PieceMD5(i)
+		if err != nil {
+			return repaired, err
+		}
+		if strings.Split(expected, ":")[0] == hex.EncodeToString(e.md5[:]) {
+			continue
+		}
+		data := make([]byte, e.length)
+		if _, err := lf.ReadAt(data, e.offset); err != nil && err != io.EOF {
+			return repaired, err
+		}
+		if _, err := f.WriteAt(data, e.offset); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, i)
+	}
+	logrus.Infof("re-fetch %d pieces of task file %s of task %s", len(repaired), task.Path, task.TaskID)
+	return repaired, f.Sync()
+}
+
+// reader returns the reader of the task file limited by the rate of the verifier.
+func (v *cacheVerifier) reader(f *os.File) io.Reader {
+	if v.limiter == nil {
+		return f
+	}
+	return limitreader.NewLimitReaderWithLimiter(v.limiter, f, false)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/lazyfile"
+	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&CacheVerifyTestSuite{})
+}
+
+type CacheVerifyTestSuite struct {
+	workHome string
+}
+
+func (s *CacheVerifyTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-CacheVerifyTestSuite-")
+}
+
+func (s *CacheVerifyTestSuite) TearDownTest(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+// 3 pieces with the data size of 5
+var verifyData = []byte("0123456789abcde")
+
+func (s *CacheVerifyTestSuite) writeTaskFile(c *check.C, name string, data []byte) *api.CachedTask {
+	path := filepath.Join(s.workHome, name)
+	c.Assert(ioutil.WriteFile(path, data, 0644), check.IsNil)
+	return &api.CachedTask{TaskID: name, Path: path}
+}
+
+func (s *CacheVerifyTestSuite) TestCheck(c *check.C) {
+	v := &cacheVerifier{limiter: ratelimiter.NewRateLimiter(ratelimiter.TransRate(1024*1024), 2)}
+
+	task := s.writeTaskFile(c, "md5", verifyData)
+	task.Md5 = fmt.Sprintf("%x", md5.Sum(verifyData))
+	bad, err := v.check(task)
+	c.Check(err, check.IsNil)
+	c.Check(bad, check.IsNil)
+
+	corrupt := []byte("0123456789abcdX")
+	c.Assert(ioutil.WriteFile(task.Path, corrupt, 0644), check.IsNil)
+	_, err = v.check(task)
+	c.Check(err, check.ErrorMatches, "md5 .* doesn't match the expected .*")
+
+	// the piece index is preferred to the md5
+	c.Assert(ioutil.WriteFile(task.Path, verifyData, 0644), check.IsNil)
+	idx, err := buildPieceIndex(task.Path, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(writePieceIndex(task.Path, idx), check.IsNil)
+	task.Md5 = "foo"
+	bad, err = v.check(task)
+	c.Check(err, check.IsNil)
+	c.Check(bad, check.IsNil)
+	c.Assert(ioutil.WriteFile(task.Path, []byte("0123X56789abcdX"), 0644), check.IsNil)
+	bad, err = v.check(task)
+	c.Check(err, check.ErrorMatches, "2 pieces don't match the piece index")
+	c.Check(bad, check.DeepEquals, []int{0, 2})
+
+	result := v.verify(s.writeTaskFile(c, "unknown", verifyData), false)
+	c.Check(result.Skipped, check.Equals, true)
+	c.Check(result.Corrupt(), check.Equals, false)
+}
+
+func (s *CacheVerifyTestSuite) TestRepair(c *check.C) {
+	// the CDN file of supernode with the pieces wrapped by the piece head and tail
+	var cdnFile bytes.Buffer
+	for i := 0; i < len(verifyData); i += 5 {
+		binary.Write(&cdnFile, binary.BigEndian, uint32(5|10<<4))
+		cdnFile.Write(verifyData[i : i+5])
+		cdnFile.WriteByte(config.PieceTailChar)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(cdnFile.Bytes()))
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	peerPort, _ := strconv.Atoi(port)
+
+	good := s.writeTaskFile(c, "good", verifyData)
+	idx, err := buildPieceIndex(good.Path, 10)
+	c.Assert(err, check.IsNil)
+	supernodeAPI := &helper.MockSupernodeAPI{
+		GetPieceMD5sFunc: func(node string, taskID string, start int, limit int, groupSize int) (*apiTypes.TaskPieceMD5s, error) {
+			return &apiTypes.TaskPieceMD5s{
+				TaskID:     taskID,
+				PieceSize:  10,
+				FileLength: int64(len(verifyData)),
+				PieceMD5s:  idx.pieceMD5s(),
+				PieceTotal: int32(len(idx.entries)),
+				Path:       "/download/foo",
+				PeerIP:     host,
+				PeerPort:   int32(peerPort),
+			}, nil
+		},
+	}
+	cacheDir := filepath.Join(s.workHome, "lazy")
+	c.Assert(os.Mkdir(cacheDir, 0755), check.IsNil)
+	v := &cacheVerifier{open: func(taskID string) (*lazyfile.File, error) {
+		return lazyfile.Open(supernodeAPI, api.NewDownloadAPI(), "node", taskID, cacheDir)
+	}}
+
+	task := s.writeTaskFile(c, "corrupt", []byte("0123456X89abcde"))
+	task.Md5 = fmt.Sprintf("%x", md5.Sum(verifyData))
+	result := v.verify(task, true)
+	c.Check(result.Err, check.NotNil)
+	c.Check(result.RepairErr, check.IsNil)
+	c.Check(result.Repaired, check.Equals, true)
+	c.Check(result.Corrupt(), check.Equals, false)
+	c.Check(result.BadPieces, check.DeepEquals, []int{1})
+	content, err := ioutil.ReadFile(task.Path)
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, string(verifyData))
+
+	// the task file of another length isn't repaired
+	task = s.writeTaskFile(c, "truncated", verifyData[:12])
+	task.Md5 = fmt.Sprintf("%x", md5.Sum(verifyData))
+	result = v.verify(task, true)
+	c.Check(result.RepairErr, check.ErrorMatches, "file length 12 doesn't match 15 of the task")
+	c.Check(result.Corrupt(), check.Equals, true)
+}
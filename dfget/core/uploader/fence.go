@@ -0,0 +1,238 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fenceRecord is the content of the fence file left by the uploader fenced for its disk failures.
+type fenceRecord struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// readFence reads the fence file next to the meta file, and returns an error if it
+// doesn't exist. The fence is in effect as long as the file exists, even if its
+// content can't be parsed.
+func readFence(metaPath string) (*fenceRecord, error) {
+	path := config.GetFenceFile(metaPath)
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &fenceRecord{}
+	if err := json.Unmarshal(data, f); err != nil {
+		f.Reason = fmt.Sprintf("invalid fence file: %v", err)
+	}
+	return f, nil
+}
+
+// diskReader records the error of reading a task file other than EOF,
+// which tells the disk failures from the failures of sending the data.
+type diskReader struct {
+	r   io.Reader
+	err error
+}
+
+func (d *diskReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF {
+		d.err = err
+	}
+	return n, err
+}
+
+// isDiskError returns whether the error of opening a task file comes from the disk,
+// rather than the file missing or being inaccessible.
+func isDiskError(err error) bool {
+	_, ok := err.(*os.PathError)
+	return ok && !os.IsNotExist(err) && !os.IsPermission(err)
+}
+
+// expectedPieceMD5 returns the md5 in the piece index of the task which the whole piece
+// to be sent should match, it's nil if the piece can't be verified, such as a piece
+// of the task file without index or one resumed from an offset.
+func expectedPieceMD5(task *taskConfig, up *uploadParam) []byte {
+	if task == nil {
+		return nil
+	}
+	idx := task.getIndex()
+	if idx == nil || up.padSize == 0 || up.offset > 0 || up.pieceSize != int64(idx.pieceSize) {
+		return nil
+	}
+	e, ok := idx.piece(int(up.pieceNum))
+	if !ok || e.offset != up.start || int64(e.length) != up.length-up.padSize {
+		return nil
+	}
+	return e.md5[:]
+}
+
+// isFenced returns whether the peer server has fenced itself for its disk failures.
+func (ps *peerServer) isFenced() bool {
+	return atomic.LoadInt32(&ps.fenced) == 1
+}
+
+// rejectFenced responds 503 to the request if the peer server is fenced,
+// so that the pieces are requested from the other peers instead.
+func (ps *peerServer) rejectFenced(w http.ResponseWriter) bool {
+	if !ps.isFenced() {
+		return false
+	}
+	http.Error(w, "peer server is fenced for its disk failures", http.StatusServiceUnavailable)
+	return true
+}
+
+// recordDiskFailure records a read error or a checksum failure of the task file, and
+// fences the peer server once DiskFailureLimit of them happen within DiskFailureWindow.
+func (ps *peerServer) recordDiskFailure(path string, err error) {
+	logrus.Errorf("disk failure of task file %s: %v", path, err)
+	limit := ps.cfg.RV.DiskFailureLimit
+	if limit <= 0 || ps.isFenced() {
+		return
+	}
+
+	ps.diskLock.Lock()
+	now := time.Now()
+	recent := ps.diskFailures[:0]
+	for _, t := range ps.diskFailures {
+		if now.Sub(t) < config.DiskFailureWindow {
+			recent = append(recent, t)
+		}
+	}
+	ps.diskFailures = append(recent, now)
+	reached := len(ps.diskFailures) >= limit
+	ps.diskLock.Unlock()
+
+	if reached {
+		ps.fence(fmt.Sprintf("%d disk failures within %v, the last one of %s: %v",
+			limit, config.DiskFailureWindow, path, err))
+	}
+}
+
+// fence stops the peer server serving and receiving the pieces, and tells the supernodes
+// that the finished task files aren't served any more. No heart beat is sent by the fenced
+// peer server, so the supernodes treat its peers as dead and stop relying on it.
+// The fence file is left next to the meta file, so that the following downloads use
+// the cdn pattern rather than starting a new uploader on the same disk.
+func (ps *peerServer) fence(reason string) {
+	if !atomic.CompareAndSwapInt32(&ps.fenced, 0, 1) {
+		return
+	}
+	logrus.Errorf("fence the peer server: %s", reason)
+
+	if path := config.GetFenceFile(ps.cfg.RV.MetaPath); path != "" {
+		data, _ := json.Marshal(&fenceRecord{Time: time.Now(), Reason: reason})
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			logrus.Warnf("failed to write the fence file %s: %v", path, err)
+		}
+	}
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		if task, ok := value.(*taskConfig); ok {
+			if node, taskID, cid := task.registration(); node != "" {
+				ps.api.ServiceDown(node, taskID, cid)
+			}
+		}
+		return true
+	})
+
+	if ps.cfg.RV.ReverifyOnFence {
+		go ps.reverifyCache()
+	}
+}
+
+// reverifyCache reads all the finished task files served by the fenced peer server,
+// and drops the ones which can't be read or don't match their md5s. The dropped files
+// in the data directories are removed, while the staged ones are left since they're read-only.
+func (ps *peerServer) reverifyCache() (total, dropped int) {
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		task, ok := value.(*taskConfig)
+		if !ok || !task.isFinished() {
+			return true
+		}
+		total++
+		taskFileName := key.(string)
+		if err := ps.verifyTaskFile(taskFileName, task); err != nil {
+			logrus.Errorf("drop task file %s of task %s: %v", taskFileName, task.getTaskID(), err)
+			ps.syncTaskMap.Delete(taskFileName)
+			if task.servicePath == "" {
+				removeServiceFile(helper.GetServiceFile(taskFileName, task.dataDir))
+			}
+			dropped++
+		}
+		return true
+	})
+	logrus.Infof("re-verify %d task files of the fenced peer server, %d of them are dropped", total, dropped)
+	return total, dropped
+}
+
+// verifyTaskFile reads the whole task file, and verifies it against its piece index if
+// it's staged with one, or against the md5 of the file if it's known.
+func (ps *peerServer) verifyTaskFile(taskFileName string, task *taskConfig) error {
+	task.lock.RLock()
+	index, expected := task.index, task.md5
+	task.lock.RUnlock()
+	if index != nil {
+		idx, err := buildPieceIndex(task.servicePath, index.pieceSize)
+		if err != nil {
+			return err
+		}
+		if !idx.equal(index) {
+			return fmt.Errorf("the pieces don't match its index")
+		}
+		return nil
+	}
+
+	fc, err := ps.getFileCipher(taskFileName)
+	if err != nil {
+		return err
+	}
+	path := task.servicePath
+	if path == "" {
+		path = helper.GetServiceFile(taskFileName, task.dataDir)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, fc.Reader(f, 0)); err != nil {
+		return err
+	}
+	if sum := fmt.Sprintf("%x", h.Sum(nil)); expected != "" && sum != expected {
+		return fmt.Errorf("md5 %s doesn't match the expected %s", sum, expected)
+	}
+	return nil
+}
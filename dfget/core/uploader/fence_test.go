@@ -0,0 +1,177 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&FenceTestSuite{})
+}
+
+type FenceTestSuite struct {
+	workHome string
+}
+
+func (s *FenceTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-FenceTestSuite-")
+}
+
+func (s *FenceTestSuite) TearDownTest(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+func (s *FenceTestSuite) TestRecordDiskFailure(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	cfg.RV.DiskFailureLimit = 2
+	ps := newPeerServer(cfg, 0)
+	var downs []string
+	ps.api = &helper.MockSupernodeAPI{
+		ServiceDownFunc: func(ip string, taskID string, cid string) (*types.BaseResponse, error) {
+			downs = append(downs, ip+"/"+taskID)
+			return nil, nil
+		},
+	}
+	initHelper(ps, "running", cfg.RV.SystemDataDir, "running")
+	ps.syncTaskMap.Store("finished", &taskConfig{taskID: "t1", superNode: "node1", finished: true})
+
+	// the failures out of the window are forgotten
+	ps.diskFailures = []time.Time{time.Now().Add(-config.DiskFailureWindow)}
+	ps.recordDiskFailure("a", fmt.Errorf("input/output error"))
+	c.Check(ps.isFenced(), check.Equals, false)
+	c.Check(ps.diskFailures, check.HasLen, 1)
+
+	ps.recordDiskFailure("b", fmt.Errorf("input/output error"))
+	c.Assert(ps.isFenced(), check.Equals, true)
+	c.Check(downs, check.DeepEquals, []string{"node1/t1"})
+	f, err := readFence(cfg.RV.MetaPath)
+	c.Assert(err, check.IsNil)
+	c.Check(strings.Contains(f.Reason, "the last one of b"), check.Equals, true)
+
+	// the fenced peer server serves nothing
+	for _, url := range []string{config.PeerHTTPPathPrefix + "running", config.LocalHTTPPathCheck + "running"} {
+		rr, err := testHandlerHelper(ps, &HandlerHelper{method: http.MethodGet, url: url})
+		c.Assert(err, check.IsNil)
+		c.Check(rr.Code, check.Equals, http.StatusServiceUnavailable, check.Commentf("url: %s", url))
+	}
+
+	// no more peer server is started on the fenced disk
+	_, err = StartPeerServerProcess(cfg)
+	c.Assert(err, check.NotNil)
+	c.Check(strings.Contains(err.Error(), "fenced"), check.Equals, true)
+}
+
+func (s *FenceTestSuite) TestRecordDiskFailureDisabled(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	ps := newPeerServer(cfg, 0)
+	for i := 0; i < config.DefaultDiskFailureLimit; i++ {
+		ps.recordDiskFailure("a", fmt.Errorf("input/output error"))
+	}
+	c.Check(ps.isFenced(), check.Equals, false)
+	c.Check(fileutils.PathExist(config.GetFenceFile(cfg.RV.MetaPath)), check.Equals, false)
+}
+
+func (s *FenceTestSuite) TestUploadVerifiedPiece(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	cfg.RV.DiskFailureLimit = 1
+	ps := newPeerServer(cfg, 0)
+	ps.api = &helper.MockSupernodeAPI{}
+
+	servicePath := filepath.Join(s.workHome, "staged")
+	c.Assert(ioutil.WriteFile(servicePath, []byte("hello world"), 0644), check.IsNil)
+	idx, err := buildPieceIndex(servicePath, 10)
+	c.Assert(err, check.IsNil)
+	ps.syncTaskMap.Store("staged", &taskConfig{servicePath: servicePath, finished: true, index: idx})
+
+	upload := func(pieceNum int, rangeStr string) int {
+		rr, err := testHandlerHelper(ps, &HandlerHelper{
+			method: http.MethodGet,
+			url:    config.PeerHTTPPathPrefix + "staged",
+			headers: map[string]string{
+				config.StrPieceSize: "10",
+				config.StrPieceNum:  fmt.Sprint(pieceNum),
+				"range":             rangeStr,
+			},
+		})
+		c.Assert(err, check.IsNil)
+		return rr.Code
+	}
+	c.Check(upload(1, "bytes=10-19"), check.Equals, http.StatusPartialContent)
+	c.Check(ps.isFenced(), check.Equals, false)
+
+	// the data of the second piece is corrupted on the disk
+	c.Assert(ioutil.WriteFile(servicePath, []byte("hello wOrld"), 0644), check.IsNil)
+	c.Check(upload(1, "bytes=10-19"), check.Equals, http.StatusPartialContent)
+	c.Check(ps.isFenced(), check.Equals, true)
+	c.Check(upload(0, "bytes=0-9"), check.Equals, http.StatusServiceUnavailable)
+}
+
+func (s *FenceTestSuite) TestReverifyCache(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	ps := newPeerServer(cfg, 0)
+	dataDir := cfg.RV.SystemDataDir
+
+	store := func(name, content, md5 string) string {
+		path := helper.GetServiceFile(name, dataDir)
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0644), check.IsNil)
+		ps.syncTaskMap.Store(name, &taskConfig{taskID: name, dataDir: dataDir, md5: md5, finished: true})
+		return path
+	}
+	sum := fmt.Sprintf("%x", md5.Sum([]byte("sound")))
+	sound := store("sound", "sound", sum)
+	unknown := store("unknown", "unknown", "")
+	corrupted := store("corrupted", "c0rrupted", fmt.Sprintf("%x", md5.Sum([]byte("corrupted"))))
+	// the running download isn't verified
+	running := helper.GetServiceFile("running", dataDir)
+	c.Assert(ioutil.WriteFile(running, []byte("running"), 0644), check.IsNil)
+	ps.syncTaskMap.Store("running", &taskConfig{dataDir: dataDir, md5: sum})
+	// the staged file is verified against its index and never removed
+	staged := filepath.Join(s.workHome, "staged")
+	c.Assert(ioutil.WriteFile(staged, []byte("staged"), 0644), check.IsNil)
+	idx, err := buildPieceIndex(staged, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(ioutil.WriteFile(staged, []byte("stAged"), 0644), check.IsNil)
+	ps.syncTaskMap.Store("staged", &taskConfig{servicePath: staged, finished: true, index: idx})
+
+	total, dropped := ps.reverifyCache()
+	c.Check(total, check.Equals, 4)
+	c.Check(dropped, check.Equals, 2)
+	for path, exist := range map[string]bool{sound: true, unknown: true, corrupted: false, running: true, staged: true} {
+		c.Check(fileutils.PathExist(path), check.Equals, exist, check.Commentf("path: %s", path))
+	}
+	for name, served := range map[string]bool{"sound": true, "unknown": true, "corrupted": false, "running": true, "staged": false} {
+		_, ok := ps.syncTaskMap.Load(name)
+		c.Check(ok, check.Equals, served, check.Commentf("task file: %s", name))
+	}
+}
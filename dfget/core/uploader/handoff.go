@@ -0,0 +1,166 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// localHandler returns the handler of the requests on the unix domain socket,
+// which serves the hand-offs in addition to the routes of the peer server.
+// The hand-offs read the files from the local paths in the requests, so they're
+// never served on the peer port.
+func (ps *peerServer) localHandler() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc(config.LocalHTTPPathClient+"handoff", ps.handOffHandler).Methods("POST")
+	r.NotFoundHandler = markLocal(ps.Handler)
+	return r
+}
+
+// handOffHandler takes over the seeding of a file downloaded by a dfget process
+// which is going to exit, such as the one run by a short-lived CI job, and
+// writes the taskID which the file is seeded as.
+func (ps *peerServer) handOffHandler(w http.ResponseWriter, r *http.Request) {
+	req := &api.HandOffRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		sendHeader(w, http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	taskID, err := ps.handOff(req)
+	if err != nil {
+		logrus.Errorf("failed to take over the seeding of %s: %v", req.Path, err)
+		sendHeader(w, http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	sendSuccess(w)
+	fmt.Fprint(w, taskID)
+}
+
+// handOff links the file into the data directory, or copies it if they're on
+// different file systems, so that it's still served after the file is moved or
+// removed by its owner. Then the file is registered to the supernodes and the peer
+// is reported as a seeder of it in the same way as the files in the seed directory.
+// The file is seeded as the other finished tasks in the data directory afterwards,
+// which follows the seeding policies of the peer server.
+func (ps *peerServer) handOff(req *api.HandOffRequest) (string, error) {
+	if req.URL == "" || req.TaskFileName == "" || !filepath.IsAbs(req.Path) {
+		return "", fmt.Errorf("url, taskFileName and an absolute path are required")
+	}
+	if filepath.Base(req.TaskFileName) != req.TaskFileName {
+		return "", fmt.Errorf("invalid taskFileName %s", req.TaskFileName)
+	}
+	if len(ps.cfg.Nodes) == 0 {
+		return "", fmt.Errorf("no supernode is specified")
+	}
+	info, err := os.Stat(req.Path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", req.Path)
+	}
+
+	// the unfinished placeholder keeps the service file from being collected
+	// as an expired one before the task is reported.
+	dataDir := ps.cfg.RV.SystemDataDir
+	if _, loaded := ps.syncTaskMap.LoadOrStore(req.TaskFileName, &taskConfig{dataDir: dataDir}); loaded {
+		return "", fmt.Errorf("task file %s is already served", req.TaskFileName)
+	}
+	serviceFile := helper.GetServiceFile(req.TaskFileName, dataDir)
+	fail := func(err error) (string, error) {
+		ps.syncTaskMap.Delete(req.TaskFileName)
+		removeServiceFile(serviceFile)
+		return "", err
+	}
+	if fileutils.PathExist(serviceFile) {
+		ps.syncTaskMap.Delete(req.TaskFileName)
+		return "", fmt.Errorf("service file %s already exists", serviceFile)
+	}
+	if err := os.Link(req.Path, serviceFile); err != nil {
+		if err := fileutils.CopyFile(req.Path, serviceFile); err != nil {
+			return fail(err)
+		}
+	}
+
+	cid := ps.seedCid()
+	artifact := &seedArtifact{
+		URL:        req.URL,
+		Path:       req.Path,
+		TaskURL:    req.TaskURL,
+		Md5:        req.Md5,
+		Digest:     req.Digest,
+		Identifier: req.Identifier,
+		Headers:    req.Headers,
+	}
+	regReq := ps.newSeedRegisterRequest(req.TaskFileName, cid, artifact)
+	node, data, err := ps.registerSeed(regReq)
+	if err != nil {
+		return fail(err)
+	}
+	if data.CDNSource == apiTypes.CdnSourceSource {
+		ps.api.ServiceDown(node, data.TaskID, cid)
+		return fail(fmt.Errorf("supernode %s downloads the task from source directly", node))
+	}
+	if data.FileLength != info.Size() {
+		ps.api.ServiceDown(node, data.TaskID, cid)
+		return fail(fmt.Errorf("the file length is %d but the task's is %d", info.Size(), data.FileLength))
+	}
+
+	idx, _, err := loadPieceIndex(serviceFile, data.PieceSize)
+	if err != nil {
+		ps.api.ServiceDown(node, data.TaskID, cid)
+		return fail(err)
+	}
+
+	task := &taskConfig{
+		taskID:     data.TaskID,
+		cid:        cid,
+		dataDir:    dataDir,
+		superNode:  node,
+		rawURL:     req.URL,
+		taskURL:    regReq.TaskURL,
+		md5:        req.Md5,
+		identifier: req.Identifier,
+		finished:   true,
+		finishTime: time.Now(),
+		accessTime: time.Now(),
+	}
+	if err := ps.reportSeed(req.TaskFileName, task, idx); err != nil {
+		removeServiceFile(serviceFile)
+		return "", err
+	}
+
+	logrus.Infof("take over the seeding of %s as task %s of supernode %s", req.Path, data.TaskID, node)
+	return data.TaskID, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&HandOffTestSuite{})
+}
+
+type HandOffTestSuite struct {
+	workHome string
+}
+
+func (s *HandOffTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-HandOffTestSuite-")
+}
+
+func (s *HandOffTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+func (s *HandOffTestSuite) TestHandOff(c *check.C) {
+	if !peerCredSupported {
+		c.Skip("the credentials of the unix domain socket peers can't be checked")
+	}
+	target := filepath.Join(s.workHome, "target")
+	c.Assert(ioutil.WriteFile(target, []byte("hello"), 0644), check.IsNil)
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.RV.LocalIP = "127.0.0.1"
+	cfg.Nodes = []string{"node"}
+	ps := newPeerServer(cfg, 15001)
+
+	var (
+		registered []*types.RegisterRequest
+		seeds      []*apiTypes.PeerSeedRequest
+	)
+	ps.api = &helper.MockSupernodeAPI{
+		RegisterFunc: func(node string, req *types.RegisterRequest) (*types.RegisterResponse, error) {
+			registered = append(registered, req)
+			return &types.RegisterResponse{
+				BaseResponse: &types.BaseResponse{Code: constants.Success},
+				Data: &types.RegisterResponseData{
+					TaskID:     "task",
+					FileLength: 5,
+					PieceSize:  10,
+				},
+			}, nil
+		},
+		ReportSeedFunc: func(node string, req *apiTypes.PeerSeedRequest) (*types.BaseResponse, error) {
+			seeds = append(seeds, req)
+			return &types.BaseResponse{Code: constants.Success}, nil
+		},
+	}
+
+	path := filepath.Join(s.workHome, config.UploaderSocketFile)
+	c.Assert(ps.serveLocal(path), check.IsNil)
+	defer ps.localServer.Close()
+
+	req := &api.HandOffRequest{
+		TaskFileName: "target-sign",
+		Path:         target,
+		URL:          "http://host/target",
+		Digest:       "sha256:foo",
+	}
+	taskID, err := api.HandOff(path, req, httputils.DefaultTimeout)
+	c.Assert(err, check.IsNil)
+	c.Check(taskID, check.Equals, "task")
+	c.Assert(registered, check.HasLen, 1)
+	c.Check(registered[0].TaskURL, check.Equals, "http://host/target")
+	c.Check(registered[0].Digest, check.Equals, "sha256:foo")
+	c.Check(registered[0].Path, check.Equals, config.PeerHTTPPathPrefix+"target-sign")
+	c.Assert(seeds, check.HasLen, 1)
+	c.Check(seeds[0].PieceMD5s, check.HasLen, 1)
+
+	// the file is still served after the target is removed
+	c.Assert(os.Remove(target), check.IsNil)
+	data, err := ioutil.ReadFile(helper.GetServiceFile("target-sign", cfg.RV.SystemDataDir))
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "hello")
+	v, ok := ps.syncTaskMap.Load("target-sign")
+	c.Assert(ok, check.Equals, true)
+	c.Check(v.(*taskConfig).finished, check.Equals, true)
+	c.Check(v.(*taskConfig).servicePath, check.Equals, "")
+
+	// the same task file can't be handed off twice
+	_, err = api.HandOff(path, req, httputils.DefaultTimeout)
+	c.Check(err, check.NotNil)
+}
+
+func (s *HandOffTestSuite) TestHandOffNotServedOnPort(c *check.C) {
+	cfg := helper.CreateConfig(nil, s.workHome)
+	ps := newPeerServer(cfg, 15001)
+
+	body := `{"taskFileName": "a", "path": "/etc/passwd", "url": "http://host/a"}`
+	w := httptest.NewRecorder()
+	ps.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+		config.LocalHTTPPathClient+"handoff", strings.NewReader(body)))
+	c.Check(w.Code, check.Not(check.Equals), http.StatusOK)
+	_, ok := ps.syncTaskMap.Load("a")
+	c.Check(ok, check.Equals, false)
+
+	// the invalid requests are rejected on the socket as well
+	for _, body := range []string{
+		"invalid",
+		`{"taskFileName": "a", "path": "relative", "url": "http://host/a"}`,
+		`{"taskFileName": "../a", "path": "/etc/passwd", "url": "http://host/a"}`,
+	} {
+		w := httptest.NewRecorder()
+		ps.localHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+			config.LocalHTTPPathClient+"handoff", strings.NewReader(body)))
+		c.Check(w.Code, check.Equals, http.StatusBadRequest, check.Commentf("body: %s", body))
+	}
+}
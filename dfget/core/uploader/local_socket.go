@@ -0,0 +1,83 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// serveLocal serves the requests of the local dfget processes on the unix domain socket,
+// which doesn't conflict with the ports of the other processes. Only the connections
+// from the processes of the same user as the uploader or root are accepted.
+func (ps *peerServer) serveLocal(path string) error {
+	if !peerCredSupported {
+		return fmt.Errorf("the credentials of the unix domain socket peers can't be checked on this platform")
+	}
+
+	// the socket file is left if the last uploader using the same meta file crashed
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+
+	ps.localServer = &http.Server{Handler: ps.localHandler()}
+	ps.localPath = path
+	go func() {
+		if err := ps.localServer.Serve(&credListener{Listener: ln, uid: os.Getuid()}); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("failed to serve local requests on %s: %v", path, err)
+		}
+	}()
+	logrus.Infof("serve local requests on %s", path)
+	return nil
+}
+
+// credListener accepts the connections from the processes of the user or root.
+type credListener struct {
+	net.Listener
+	uid int
+}
+
+func (l *credListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		uc, ok := conn.(*net.UnixConn)
+		if !ok {
+			return conn, nil
+		}
+		uid, err := peerUID(uc)
+		if err == nil && (uid == l.uid || uid == 0) {
+			return conn, nil
+		}
+		logrus.Warnf("reject the local connection from uid %d: %v", uid, err)
+		conn.Close()
+	}
+}
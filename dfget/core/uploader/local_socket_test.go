@@ -0,0 +1,91 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&LocalSocketTestSuite{})
+}
+
+type LocalSocketTestSuite struct {
+	workHome string
+}
+
+func (s *LocalSocketTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-LocalSocketTestSuite-")
+}
+
+func (s *LocalSocketTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+func (s *LocalSocketTestSuite) TestServeLocal(c *check.C) {
+	if !peerCredSupported {
+		c.Skip("the credentials of the unix domain socket peers can't be checked")
+	}
+	srv := newTestPeerServer(s.workHome)
+	initHelper(srv, commonFile, s.workHome, commonFileContent)
+	path := filepath.Join(s.workHome, config.UploaderSocketFile)
+
+	// the stale socket file is replaced
+	c.Assert(ioutil.WriteFile(path, nil, 0600), check.IsNil)
+	c.Assert(srv.serveLocal(path), check.IsNil)
+	defer srv.localServer.Close()
+
+	info, err := os.Stat(path)
+	c.Assert(err, check.IsNil)
+	c.Check(info.Mode()&os.ModeSocket, check.Equals, os.ModeSocket)
+	c.Check(info.Mode().Perm(), check.Equals, os.FileMode(0600))
+
+	// nothing listens on the port, so the requests can only be served by the socket
+	uploaderAPI := api.NewUploaderAPIWithSocket(httputils.DefaultTimeout, path)
+	result, err := uploaderAPI.CheckServer("127.0.0.1", 1, &api.CheckServerRequest{
+		TaskFileName: commonFile,
+		DataDir:      s.workHome,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(result, check.Not(check.Equals), "")
+
+	_, err = uploaderAPI.ListTasks("127.0.0.1", 1)
+	c.Check(err, check.IsNil)
+}
+
+func (s *LocalSocketTestSuite) TestFallbackToPort(c *check.C) {
+	srv := newTestPeerServer(s.workHome)
+	ip, port, server := startTestServer(srv.Handler)
+	defer stopTestServer(server)
+
+	uploaderAPI := api.NewUploaderAPIWithSocket(httputils.DefaultTimeout,
+		filepath.Join(s.workHome, config.UploaderSocketFile))
+	for i := 0; i < 50 && !uploaderAPI.PingServer(ip, port); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	_, err := uploaderAPI.ListTasks(ip, port)
+	c.Check(err, check.IsNil)
+}
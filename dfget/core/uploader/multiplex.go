@@ -0,0 +1,106 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/diagnostics"
+)
+
+// diagnosticsPathPrefix is the prefix of the paths of the diagnostics endpoints,
+// which are served on the peer port when the surfaces are multiplexed.
+const diagnosticsPathPrefix = "/debug/"
+
+// localRequestKey marks the requests received on the unix domain socket,
+// whose peers have been authorized by their credentials.
+type localRequestKey struct{}
+
+// markLocal marks the requests handled by h as the local ones.
+func markLocal(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), localRequestKey{}, true)))
+	})
+}
+
+// controlSurface returns the handler of a control endpoint, which is only authorized
+// for the local processes or the bearer ControlToken when the surfaces are multiplexed.
+// The control endpoints are open as before if they aren't multiplexed.
+func (ps *peerServer) controlSurface(h http.HandlerFunc) http.Handler {
+	if !ps.cfg.RV.Multiplex {
+		return h
+	}
+	return authorize(h, ps.cfg.ControlToken, true)
+}
+
+// adminSurface returns the handler of the diagnostics endpoints, which is only authorized
+// for the bearer AdminToken, or the local processes if it's empty.
+func (ps *peerServer) adminSurface() http.Handler {
+	token := ps.cfg.AdminToken
+	return authorize(diagnostics.Handler(), token, token == "")
+}
+
+// authorize returns the handler which rejects the requests unless they carry the bearer token,
+// or they're sent by the local processes and allowLocal is true.
+func authorize(h http.Handler, token string, allowLocal bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowLocal && isLocalRequest(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isLocalRequest returns whether the request is sent from the unix domain socket,
+// the loopback address or any other address of this host.
+func isLocalRequest(r *http.Request) bool {
+	if local, _ := r.Context().Value(localRequestKey{}).(bool); local {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&MultiplexTestSuite{})
+}
+
+type MultiplexTestSuite struct {
+	workHome string
+}
+
+func (s *MultiplexTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-MultiplexTestSuite-")
+}
+
+func (s *MultiplexTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+func (s *MultiplexTestSuite) TestSurfaces(c *check.C) {
+	// 192.0.2.1 is reserved for documentation, so it's never an address of this host
+	const remote, local = "192.0.2.1:10000", "127.0.0.1:10000"
+	do := func(srv *peerServer, path, remoteAddr, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// the surfaces aren't multiplexed
+	srv := newTestPeerServer(s.workHome)
+	c.Check(do(srv, config.LocalHTTPPathClient+"tasks", remote, ""), check.Equals, http.StatusOK)
+	c.Check(do(srv, "/debug/vars", local, ""), check.Equals, http.StatusNotFound)
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.RV.Multiplex = true
+	cfg.ControlToken = "control"
+	srv = newPeerServer(cfg, 0)
+
+	// the health is open
+	c.Check(do(srv, config.LocalHTTPPing, remote, ""), check.Equals, http.StatusOK)
+
+	// the control endpoints are open to the local processes or with the control token
+	c.Check(do(srv, config.LocalHTTPPathClient+"tasks", local, ""), check.Equals, http.StatusOK)
+	c.Check(do(srv, config.LocalHTTPPathClient+"tasks", remote, ""), check.Equals, http.StatusUnauthorized)
+	c.Check(do(srv, config.LocalHTTPPathClient+"tasks", remote, "admin"), check.Equals, http.StatusUnauthorized)
+	c.Check(do(srv, config.LocalHTTPPathClient+"tasks", remote, "control"), check.Equals, http.StatusOK)
+
+	// the diagnostics are only open to the local processes without the admin token
+	c.Check(do(srv, "/debug/vars", local, ""), check.Equals, http.StatusOK)
+	c.Check(do(srv, "/debug/vars", remote, "control"), check.Equals, http.StatusUnauthorized)
+
+	cfg.AdminToken = "admin"
+	srv = newPeerServer(cfg, 0)
+	c.Check(do(srv, "/debug/vars", local, ""), check.Equals, http.StatusUnauthorized)
+	c.Check(do(srv, "/debug/vars", remote, "admin"), check.Equals, http.StatusOK)
+	c.Check(do(srv, "/unknown", remote, "admin"), check.Equals, http.StatusNotFound)
+}
@@ -17,28 +17,38 @@
 package uploader
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/accesslog"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
 	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
 	"github.com/dragonflyoss/Dragonfly/version"
 
+	"github.com/go-openapi/strfmt"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
@@ -48,15 +58,25 @@ func newPeerServer(cfg *config.Config, port int) *peerServer {
 	s := &peerServer{
 		cfg:      cfg,
 		finished: make(chan struct{}),
-		host:     cfg.RV.LocalIP,
+		host:     cfg.PeerIP(),
 		port:     port,
-		api:      api.NewSupernodeAPI(),
+		api:      api.NewSupernodeAPIWithToken(cfg.PeerToken),
+
+		shareLinks:      make(map[string]*shareGrant),
+		shareRejections: make(map[string]int64),
+	}
+	s.replicate = runDfget
+	if secret, err := newShareSecret(cfg); err != nil {
+		logrus.Errorf("disable the share links: %v", err)
+	} else {
+		s.shareSecret = secret
 	}
+	s.accessLog = accesslog.New("uploader", cfg.RV.AccessLogSampleRate, identifyRequest)
 
 	r := s.initRouter()
 	s.Server = &http.Server{
 		Addr:    net.JoinHostPort(s.host, strconv.Itoa(port)),
-		Handler: r,
+		Handler: s.accessLog.Handler(r),
 	}
 
 	return s
@@ -79,23 +99,145 @@ type peerServer struct {
 
 	api         api.SupernodeAPI
 	rateLimiter *ratelimiter.RateLimiter
+	accessLog   *accesslog.Logger
 
 	// totalLimitRate is the total network bandwidth shared by tasks on the same host
 	totalLimitRate int
 
 	// syncTaskMap stores the meta name of tasks on the host
 	syncTaskMap sync.Map
+
+	// uploadingCount is the number of pieces being uploaded,
+	// which is reported to supernodes as the load of this peer.
+	uploadingCount int32
+
+	// localServer serves the requests of the local dfget processes on the
+	// unix domain socket localPath, it's nil if the socket isn't served.
+	localServer *http.Server
+	localPath   string
+
+	// ciphers decrypt the task files of the namespaces, which are loaded
+	// from the cache keys when the peer server starts.
+	ciphers map[string]*helper.CacheCipher
+
+	// replicating stores the IDs of the tasks being replicated, and replicate
+	// downloads a task with the given arguments of dfget, one at a time by replicateLock.
+	replicating   sync.Map
+	replicateLock sync.Mutex
+	replicate     func(args []string) error
+
+	// purged stores the IDs of the tasks purged by every supernode since the last
+	// heart beat, which are reported to it by purgedTaskIDs.
+	purged     map[string][]string
+	purgedLock sync.Mutex
+
+	// fenced is set to 1 atomically once the peer server fences itself for the disk
+	// failures, and diskFailures are the times of the recent ones within DiskFailureWindow.
+	fenced       int32
+	diskFailures []time.Time
+	diskLock     sync.Mutex
+
+	// shareSecret is the key signing the share links of the task files,
+	// the share links are disabled if it's nil.
+	shareSecret []byte
+
+	// shareLinks stores the share links not expired by their nonces, and
+	// shareRejections counts the rejected requests of them by reason.
+	shareLinks      map[string]*shareGrant
+	shareRejections map[string]int64
+	shareLock       sync.Mutex
 }
 
 // taskConfig refers to some name about peer task.
 type taskConfig struct {
+	// uploadedBytes is the number of bytes uploaded to other peers,
+	// it must be accessed atomically.
+	uploadedBytes int64
+	// stopSeeding is set to 1 atomically when the supernode signals
+	// that the task doesn't need to be seeded any more.
+	stopSeeding int32
+	// paused is set to 1 atomically when the download of the task is paused
+	// by the control API, and the downloaded pieces are still served.
+	paused int32
+
+	// lastPieceNum is the number of the piece requested last time and
+	// readAheadEnd is the offset of the task file up to which it has been read ahead,
+	// which are used to read ahead the pieces of the sequential requests.
+	// They must be accessed atomically.
+	lastPieceNum int64
+	readAheadEnd int64
+
+	dataDir string
+
+	// servicePath is the path of the task file staged in the seed directory,
+	// which is read-only and never removed by the uploader.
+	// The task file is in dataDir if it's empty.
+	servicePath string
+
+	// acceptPush indicates whether the running download of the task file accepts
+	// the pieces pushed by the other peers.
+	acceptPush bool
+
+	// lock protects the fields from taskID to index, which are updated when the download
+	// of the task finishes or the task file is accessed while the other goroutines read
+	// them. The fields above are set before the task is stored into syncTaskMap.
+	lock       sync.RWMutex
 	taskID     string
 	rateLimit  int
 	cid        string
-	dataDir    string
 	superNode  string
 	finished   bool
+	finishTime time.Time
 	accessTime time.Time
+
+	// the source of the task, which is used to export the task file.
+	rawURL     string
+	taskURL    string
+	md5        string
+	identifier string
+
+	// namespace is the namespace whose key encrypts the task file,
+	// the task file isn't encrypted if it's empty.
+	namespace string
+
+	// index is the piece index of the task file, by which the pieces are located
+	// and verified as they're sent. It's nil until the index of a finished download
+	// is loaded, and the encrypted task files are never indexed.
+	index *pieceIndex
+
+	// target is the status of moving the running download to another target path,
+	// which is requested by the control API and reported by dfget.
+	target     api.TargetStatus
+	targetLock sync.Mutex
+}
+
+// isFinished returns whether the download of the task has finished.
+func (t *taskConfig) isFinished() bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.finished
+}
+
+// getTaskID returns the ID of the task, which is unknown until the download finishes.
+func (t *taskConfig) getTaskID() string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.taskID
+}
+
+// registration returns the supernode, the task ID and the CID by which the task
+// file is registered as served by this peer, in the order of the arguments of ServiceDown.
+func (t *taskConfig) registration() (superNode, taskID, cid string) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.superNode, t.taskID, t.cid
+}
+
+// getIndex returns the piece index of the task file, it's nil if there's none.
+func (t *taskConfig) getIndex() *pieceIndex {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.index
 }
 
 // uploadParam refers to all params needed in the handler of upload.
@@ -106,32 +248,109 @@ type uploadParam struct {
 
 	pieceSize int64
 	pieceNum  int64
+
+	// offset is the number of the bytes of the wrapped piece which the downloader
+	// has received before being interrupted, and only the rest of the piece is sent.
+	offset int64
+
+	// hash computes the md5 of the piece wrapped by the meta data as it's sent,
+	// it's nil if the piece isn't verified.
+	hash hash.Hash
 }
 
 // ----------------------------------------------------------------------------
 // init method of peerServer
 
+// ListenAndServe listens on the host and the other addresses advertised to supernode,
+// and serves the requests on all of them until the server is shutdown. The other
+// addresses aren't listened on if the host is unspecified, since it covers them.
+func (ps *peerServer) ListenAndServe() error {
+	addrs := []string{ps.Addr}
+	if ip := net.ParseIP(ps.host); ip != nil && !ip.IsUnspecified() {
+		for _, addr := range ps.cfg.PeerAddresses() {
+			addrs = append(addrs, net.JoinHostPort(addr, strconv.Itoa(ps.port)))
+		}
+	}
+
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	for _, ln := range listeners[1:] {
+		go func(ln net.Listener) {
+			if err := ps.Serve(ln); err != nil && err != http.ErrServerClosed {
+				logrus.Errorf("failed to serve on %s: %v", ln.Addr(), err)
+			}
+		}(ln)
+	}
+	return ps.Serve(listeners[0])
+}
+
 func (ps *peerServer) initRouter() *mux.Router {
 	r := mux.NewRouter()
 	r.HandleFunc(config.PeerHTTPPathPrefix+"{commonFile:.*}", ps.uploadHandler).Methods("GET")
-	r.HandleFunc(config.LocalHTTPPathRate+"{commonFile:.*}", ps.parseRateHandler).Methods("GET")
-	r.HandleFunc(config.LocalHTTPPathCheck+"{commonFile:.*}", ps.checkHandler).Methods("GET")
-	r.HandleFunc(config.LocalHTTPPathClient+"finish", ps.oneFinishHandler).Methods("GET")
+	r.HandleFunc(config.PushHTTPPathPrefix+"{commonFile:.*}", ps.pushHandler).Methods("PUT")
+	r.Handle(config.LocalHTTPPathRate+"{commonFile:.*}", ps.controlSurface(ps.parseRateHandler)).Methods("GET")
+	r.Handle(config.LocalHTTPPathCheck+"{commonFile:.*}", ps.controlSurface(ps.checkHandler)).Methods("GET")
+	r.Handle(config.LocalHTTPPathClient+"finish", ps.controlSurface(ps.oneFinishHandler)).Methods("GET")
+	r.Handle(config.LocalHTTPPathClient+"tasks", ps.controlSurface(ps.listTasksHandler)).Methods("GET")
+	r.Handle(config.LocalHTTPPathClient+"pause", ps.controlSurface(ps.pauseHandler)).Methods("GET", "PUT")
+	r.Handle(config.LocalHTTPPathClient+"resume", ps.controlSurface(ps.resumeHandler)).Methods("PUT")
+	r.Handle(config.LocalHTTPPathClient+"target", ps.controlSurface(ps.targetHandler)).Methods("GET", "PUT")
+	if ps.shareSecret != nil {
+		r.Handle(config.LocalHTTPPathClient+"share", authorize(http.HandlerFunc(ps.createShareHandler), ps.cfg.ControlToken, true)).Methods("POST")
+		r.HandleFunc(config.ShareHTTPPathPrefix+"{commonFile:.*}", ps.shareHandler).Methods("GET", "HEAD")
+	}
 	r.HandleFunc(config.LocalHTTPPing, ps.pingHandler).Methods("GET")
+	if ps.accessLog != nil {
+		r.Handle(config.LocalHTTPPathClient+"accesslog", ps.controlSurface(ps.accessLog.ConfigHandler())).Methods("GET", "PUT")
+	}
+	if ps.cfg.RV.Multiplex {
+		r.PathPrefix(diagnosticsPathPrefix).Handler(ps.adminSurface())
+	}
 
 	return r
 }
 
+// identifyRequest identifies the downloading peer by its IP
+// and the task by the task file name in the request path.
+func identifyRequest(r *http.Request) (peer, taskID string) {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	for _, prefix := range []string{config.PeerHTTPPathPrefix, config.LocalHTTPPathRate, config.LocalHTTPPathCheck} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return peer, strings.TrimPrefix(r.URL.Path, prefix)
+		}
+	}
+	return peer, r.FormValue(config.StrTaskFileName)
+}
+
 // ----------------------------------------------------------------------------
 // peerServer handlers
 
 // uploadHandler uses to upload a task file when other peers download from it.
 func (ps *peerServer) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if ps.rejectFenced(w) {
+		return
+	}
 	sendAlive(ps.cfg)
+	atomic.AddInt32(&ps.uploadingCount, 1)
+	defer atomic.AddInt32(&ps.uploadingCount, -1)
 
 	var (
 		up   *uploadParam
 		f    *os.File
+		fc   *helper.FileCipher
 		size int64
 		err  error
 	)
@@ -140,34 +359,74 @@ func (ps *peerServer) uploadHandler(w http.ResponseWriter, r *http.Request) {
 	rangeStr := r.Header.Get(config.StrRange)
 	cdnSource := r.Header.Get(config.StrCDNSource)
 
-	logrus.Debugf("upload file:%s to %s, req:%v", taskFileName, r.RemoteAddr, jsonStr(r.Header))
-
 	// Step1: parse param
 	if up, err = parseParams(rangeStr, r.Header.Get(config.StrPieceNum),
 		r.Header.Get(config.StrPieceSize)); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		logrus.Warnf("invalid param file:%s req:%v, %v", taskFileName, r.Header, err)
+		logrus.Warnf("invalid param file:%s req:%v, %v", taskFileName, httputils.RedactHTTPHeader(r.Header), err)
 		return
 	}
+	if offset := r.Header.Get(config.StrPieceOffset); offset != "" {
+		if up.offset, err = strconv.ParseInt(offset, 10, 64); err != nil || up.offset < 0 {
+			http.Error(w, fmt.Sprintf("invalid piece offset: %s", offset), http.StatusBadRequest)
+			logrus.Warnf("invalid piece offset file:%s req:%v", taskFileName, httputils.RedactHTTPHeader(r.Header))
+			return
+		}
+	}
 
 	// Step2: get task file
+	if fc, err = ps.getFileCipher(taskFileName); err != nil {
+		rangeErrorResponse(w, err)
+		logrus.Errorf("failed to decrypt file:%s, %v", taskFileName, err)
+		return
+	}
 	if f, size, err = ps.getTaskFile(taskFileName); err != nil {
 		rangeErrorResponse(w, err)
 		logrus.Errorf("failed to open file:%s, %v", taskFileName, err)
+		if isDiskError(err) {
+			ps.recordDiskFailure(taskFileName, err)
+		}
 		return
 	}
 	defer f.Close()
 
-	// Step3: amend range with piece meta data
-	if err = amendRange(size, cdnSource != string(apiTypes.CdnSourceSource), up); err != nil {
-		rangeErrorResponse(w, err)
-		logrus.Errorf("failed to amend range of file %s: %v", taskFileName, err)
+	// Step3: locate the piece by the piece index of the task file,
+	// or amend range with piece meta data if it isn't indexed
+	var task *taskConfig
+	if v, ok := ps.syncTaskMap.Load(taskFileName); ok {
+		task = v.(*taskConfig)
+	}
+	needPad := cdnSource != string(apiTypes.CdnSourceSource)
+	if task == nil || !locatePiece(task.getIndex(), needPad, up) {
+		if err = amendRange(size, needPad, up); err != nil {
+			rangeErrorResponse(w, err)
+			logrus.Errorf("failed to amend range of file %s: %v", taskFileName, err)
+			return
+		}
+	}
+	if up.offset >= up.length {
+		rangeErrorResponse(w, errortypes.ErrRangeNotSatisfiable)
+		logrus.Errorf("piece offset %d of file %s is out of range", up.offset, taskFileName)
 		return
 	}
+	if task != nil {
+		ps.readAhead(task, f.Name(), size, up)
+	}
+	expected := expectedPieceMD5(task, up)
+	if expected != nil {
+		up.hash = md5.New()
+	}
 
 	// Step4: send piece wrapped by meta data
-	if err := ps.uploadPiece(f, w, up); err != nil {
+	if err := ps.uploadPiece(f, w, up, fc); err != nil {
 		logrus.Errorf("failed to send range(%s) of file(%s): %v", rangeStr, taskFileName, err)
+		return
+	}
+	if expected != nil && !bytes.Equal(up.hash.Sum(nil), expected) {
+		ps.recordDiskFailure(f.Name(), fmt.Errorf("md5 of piece %d doesn't match its index", up.pieceNum))
+	}
+	if task != nil {
+		atomic.AddInt64(&task.uploadedBytes, up.length-up.offset)
 	}
 }
 
@@ -189,7 +448,9 @@ func (ps *peerServer) parseRateHandler(w http.ResponseWriter, r *http.Request) {
 	// update the rateLimit of commonFile
 	if v, ok := ps.syncTaskMap.Load(taskFileName); ok {
 		param := v.(*taskConfig)
+		param.lock.Lock()
 		param.rateLimit = clientRate
+		param.lock.Unlock()
 	}
 
 	// no need to calculate rate when totalLimitRate less than or equals zero.
@@ -206,6 +467,9 @@ func (ps *peerServer) parseRateHandler(w http.ResponseWriter, r *http.Request) {
 // checkHandler is used to check the server status.
 // TODO: Disassemble this function for too many things done.
 func (ps *peerServer) checkHandler(w http.ResponseWriter, r *http.Request) {
+	if ps.rejectFenced(w) {
+		return
+	}
 	sendAlive(ps.cfg)
 	sendSuccess(w)
 
@@ -226,7 +490,13 @@ func (ps *peerServer) checkHandler(w http.ResponseWriter, r *http.Request) {
 	dataDir := r.Header.Get(config.StrDataDir)
 
 	param := &taskConfig{
-		dataDir: dataDir,
+		dataDir:    dataDir,
+		namespace:  r.Header.Get(config.StrNamespace),
+		acceptPush: r.Header.Get(config.StrAcceptPush) == "true",
+	}
+	if _, ok := ps.ciphers[param.namespace]; param.namespace != "" && !ok {
+		logrus.Warnf("no cache key of namespace %s is loaded, the file %s can't be uploaded",
+			param.namespace, taskFileName)
 	}
 	ps.syncTaskMap.Store(taskFileName, param)
 	fmt.Fprintf(w, "%s@%s", taskFileName, version.DFGetVersion)
@@ -250,28 +520,198 @@ func (ps *peerServer) oneFinishHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if v, ok := ps.syncTaskMap.Load(taskFileName); ok {
-		task := v.(*taskConfig)
+	now := time.Now()
+	finish := func(task *taskConfig) {
 		task.taskID = taskID
 		task.rateLimit = 0
 		task.cid = cid
 		task.superNode = superNode
+		if !task.finished {
+			task.finishTime = now
+		}
 		task.finished = true
-		task.accessTime = time.Now()
-	} else {
-		ps.syncTaskMap.Store(taskFileName, &taskConfig{
-			taskID:     taskID,
-			cid:        cid,
-			dataDir:    ps.cfg.RV.SystemDataDir,
-			superNode:  superNode,
-			finished:   true,
-			accessTime: time.Now(),
-		})
+		task.accessTime = now
+		task.rawURL = r.FormValue(config.StrURL)
+		task.taskURL = r.FormValue(config.StrTaskURL)
+		task.md5 = r.FormValue(config.StrMd5)
+		task.identifier = r.FormValue(config.StrIdentifier)
+		task.namespace = r.FormValue(config.StrNamespace)
+	}
+
+	// the new task is stored only after it's filled, and the stored one
+	// is updated under its lock since it's read by the other goroutines.
+	task := &taskConfig{dataDir: ps.findDataDir(taskFileName)}
+	finish(task)
+	if v, loaded := ps.syncTaskMap.LoadOrStore(taskFileName, task); loaded {
+		task = v.(*taskConfig)
+		task.lock.Lock()
+		finish(task)
+		task.lock.Unlock()
+	}
+	if pieceSize, err := strconv.Atoi(r.FormValue(config.StrPieceSize)); err == nil && pieceSize > 0 {
+		go ps.indexTaskFile(taskFileName, task, int32(pieceSize))
 	}
 	sendSuccess(w)
 	fmt.Fprintf(w, "success")
 }
 
+// pauseHandler pauses the download of the running task if the method is PUT,
+// and then writes whether the download of the task is paused.
+// The task is specified by the query taskFileName.
+func (ps *peerServer) pauseHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := ps.loadRunningTask(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodPut && atomic.CompareAndSwapInt32(&task.paused, 0, 1) {
+		logrus.Infof("pause the download of file %s", r.FormValue(config.StrTaskFileName))
+	}
+	sendSuccess(w)
+	fmt.Fprint(w, strconv.FormatBool(atomic.LoadInt32(&task.paused) == 1))
+}
+
+// resumeHandler resumes the download of the paused task which is specified
+// by the query taskFileName.
+func (ps *peerServer) resumeHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := ps.loadRunningTask(w, r)
+	if !ok {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&task.paused, 1, 0) {
+		logrus.Infof("resume the download of file %s", r.FormValue(config.StrTaskFileName))
+	}
+	sendSuccess(w)
+	fmt.Fprint(w, "false")
+}
+
+// targetHandler requests to move the download of the running task to the target path
+// in the query target if the method is PUT. Otherwise the current target path and the
+// result of the last request are recorded if they're reported by dfget in the queries
+// current, requestID and error. And then it writes the status of the move in json.
+// The task is specified by the query taskFileName.
+func (ps *peerServer) targetHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := ps.loadRunningTask(w, r)
+	if !ok {
+		return
+	}
+
+	task.targetLock.Lock()
+	if r.Method == http.MethodPut {
+		target := r.FormValue(config.StrTarget)
+		if !filepath.IsAbs(target) {
+			task.targetLock.Unlock()
+			sendHeader(w, http.StatusBadRequest)
+			fmt.Fprintf(w, "target %q isn't an absolute path", target)
+			return
+		}
+		task.target.Target = filepath.Clean(target)
+		task.target.RequestID++
+		task.target.Error = ""
+		logrus.Infof("move the download of file %s to %s", r.FormValue(config.StrTaskFileName), task.target.Target)
+	} else if current := r.FormValue(config.StrCurrent); current != "" {
+		task.target.Current = current
+		if id, _ := strconv.ParseInt(r.FormValue(config.StrRequestID), 10, 64); id == task.target.RequestID {
+			task.target.Error = r.FormValue(config.StrError)
+		}
+	}
+	status := task.target
+	task.targetLock.Unlock()
+
+	w.Header().Set(config.StrContentType, "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+// loadRunningTask loads the task specified by the query taskFileName whose
+// download hasn't finished, and it writes the error response if it isn't found.
+func (ps *peerServer) loadRunningTask(w http.ResponseWriter, r *http.Request) (*taskConfig, bool) {
+	taskFileName := r.FormValue(config.StrTaskFileName)
+	if taskFileName == "" {
+		sendHeader(w, http.StatusBadRequest)
+		fmt.Fprint(w, "invalid params")
+		return nil, false
+	}
+	v, ok := ps.syncTaskMap.Load(taskFileName)
+	if !ok {
+		sendHeader(w, http.StatusNotFound)
+		fmt.Fprintf(w, "task file %s not found", taskFileName)
+		return nil, false
+	}
+	task := v.(*taskConfig)
+	if task.isFinished() {
+		sendHeader(w, http.StatusConflict)
+		fmt.Fprintf(w, "download of task file %s has finished", taskFileName)
+		return nil, false
+	}
+	return task, true
+}
+
+// writeStatus writes the status of the peer server and its tasks in a human-readable format.
+func (ps *peerServer) writeStatus(w io.Writer) {
+	fmt.Fprintf(w, "address: %s:%d\n", ps.host, ps.port)
+	fmt.Fprintf(w, "uploading pieces: %d\n", atomic.LoadInt32(&ps.uploadingCount))
+	fmt.Fprintf(w, "total limit: %d bytes/s\n", int64(ps.cfg.TotalLimit))
+	fmt.Fprintf(w, "fenced: %t\n", ps.isFenced())
+	if ps.shareSecret != nil {
+		fmt.Fprintf(w, "share links rejected: %s\n", ps.shareRejectionCounts())
+	}
+
+	var lines []string
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		if task, ok := value.(*taskConfig); ok {
+			task.lock.RLock()
+			lines = append(lines, fmt.Sprintf("  %s: taskID:%s supernode:%s finished:%t paused:%t uploaded:%d",
+				key, task.taskID, task.superNode, task.finished, atomic.LoadInt32(&task.paused) == 1,
+				atomic.LoadInt64(&task.uploadedBytes)))
+			task.lock.RUnlock()
+		}
+		return true
+	})
+	sort.Strings(lines)
+	fmt.Fprintf(w, "tasks: %d\n", len(lines))
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+}
+
+// listTasksHandler lists the finished tasks whose source is known,
+// which is used to export the task files.
+func (ps *peerServer) listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	tasks := make([]*api.CachedTask, 0)
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		task, ok := value.(*taskConfig)
+		if !ok {
+			return true
+		}
+		task.lock.RLock()
+		defer task.lock.RUnlock()
+		// the encrypted task files are never exported
+		if !task.finished || task.rawURL == "" || task.namespace != "" {
+			return true
+		}
+		path := task.servicePath
+		if path == "" {
+			path = helper.GetServiceFile(key.(string), task.dataDir)
+		}
+		tasks = append(tasks, &api.CachedTask{
+			TaskID:     task.taskID,
+			URL:        task.rawURL,
+			TaskURL:    task.taskURL,
+			Md5:        task.md5,
+			Identifier: task.identifier,
+			Path:       path,
+		})
+		return true
+	})
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].TaskID < tasks[j].TaskID
+	})
+
+	w.Header().Set(config.StrContentType, "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tasks)
+}
+
 func (ps *peerServer) pingHandler(w http.ResponseWriter, r *http.Request) {
 	sendSuccess(w)
 	fmt.Fprintf(w, "success")
@@ -294,9 +734,14 @@ func (ps *peerServer) getTaskFile(taskFileName string) (*os.File, int64, error)
 	}
 
 	// update the accessTime of taskFileName
+	tc.lock.Lock()
 	tc.accessTime = time.Now()
+	tc.lock.Unlock()
 
-	taskPath := helper.GetServiceFile(taskFileName, tc.dataDir)
+	taskPath := tc.servicePath
+	if taskPath == "" {
+		taskPath = helper.GetServiceFile(taskFileName, tc.dataDir)
+	}
 
 	fileInfo, err := os.Stat(taskPath)
 	if err != nil {
@@ -310,6 +755,34 @@ func (ps *peerServer) getTaskFile(taskFileName string) (*os.File, int64, error)
 	return taskFile, fileInfo.Size(), nil
 }
 
+// getFileCipher returns the FileCipher which decrypts the task file with the nonce
+// stored along with it, it's nil if the task file isn't encrypted.
+func (ps *peerServer) getFileCipher(taskFileName string) (*helper.FileCipher, error) {
+	v, ok := ps.syncTaskMap.Load(taskFileName)
+	if !ok {
+		return nil, nil
+	}
+	tc, ok := v.(*taskConfig)
+	if !ok {
+		return nil, nil
+	}
+	tc.lock.RLock()
+	namespace := tc.namespace
+	tc.lock.RUnlock()
+	if namespace == "" {
+		return nil, nil
+	}
+	c, ok := ps.ciphers[namespace]
+	if !ok {
+		return nil, fmt.Errorf("no cache key of namespace %s is loaded", namespace)
+	}
+	taskPath := tc.servicePath
+	if taskPath == "" {
+		taskPath = helper.GetServiceFile(taskFileName, tc.dataDir)
+	}
+	return c.OpenFile(taskPath)
+}
+
 func amendRange(size int64, needPad bool, up *uploadParam) error {
 	up.padSize = 0
 	if needPad {
@@ -377,27 +850,52 @@ func parseParams(rangeVal, pieceNumStr, pieceSizeStr string) (*uploadParam, erro
 }
 
 // uploadPiece sends a piece of the file to the remote peer.
-func (ps *peerServer) uploadPiece(f *os.File, w http.ResponseWriter, up *uploadParam) (e error) {
-	w.Header().Set(config.StrContentLength, strconv.FormatInt(up.length, 10))
+func (ps *peerServer) uploadPiece(f *os.File, w http.ResponseWriter, up *uploadParam, fc *helper.FileCipher) error {
+	w.Header().Set(config.StrContentLength, strconv.FormatInt(up.length-up.offset, 10))
+	if up.offset > 0 {
+		// tell the downloader that the piece is resumed from the offset
+		w.Header().Set(config.StrPieceOffset, strconv.FormatInt(up.offset, 10))
+	}
 	sendHeader(w, http.StatusPartialContent)
+	return ps.writePiece(f, w, up, fc)
+}
 
+// writePiece writes the piece of the file wrapped by the meta data from the offset.
+func (ps *peerServer) writePiece(f *os.File, w io.Writer, up *uploadParam, fc *helper.FileCipher) (e error) {
 	readLen := up.length - up.padSize
 	buf := make([]byte, 256*1024)
+	if up.hash != nil {
+		w = io.MultiWriter(w, up.hash)
+	}
 
+	// skip is the number of the bytes of the file data which have been received
+	skip := up.offset
 	if up.padSize > 0 {
 		binary.BigEndian.PutUint32(buf, uint32((readLen)|(up.pieceSize)<<4))
-		w.Write(buf[:config.PieceHeadSize])
+		if skip < config.PieceHeadSize {
+			w.Write(buf[skip:config.PieceHeadSize])
+			skip = 0
+		} else {
+			skip -= config.PieceHeadSize
+		}
 		defer w.Write([]byte{config.PieceTailChar})
 	}
 
-	f.Seek(up.start, 0)
-	r := io.LimitReader(f, readLen)
+	if _, e = f.Seek(up.start+skip, 0); e != nil {
+		ps.recordDiskFailure(f.Name(), e)
+		return
+	}
+	dr := &diskReader{r: io.LimitReader(f, readLen-skip)}
+	r := fc.Reader(dr, up.start+skip)
 	if ps.rateLimiter != nil {
 		lr := limitreader.NewLimitReaderWithLimiter(ps.rateLimiter, r, false)
 		_, e = io.CopyBuffer(w, lr, buf)
 	} else {
 		_, e = io.CopyBuffer(w, r, buf)
 	}
+	if dr.err != nil {
+		ps.recordDiskFailure(f.Name(), dr.err)
+	}
 
 	return
 }
@@ -409,9 +907,11 @@ func (ps *peerServer) calculateRateLimit(clientRate int) int {
 	// for each key and value present in the map
 	f := func(key, value interface{}) bool {
 		if task, ok := value.(*taskConfig); ok {
+			task.lock.RLock()
 			if !task.finished {
 				total += task.rateLimit
 			}
+			task.lock.RUnlock()
 		}
 		return true
 	}
@@ -465,54 +965,233 @@ func (ps *peerServer) shutdown() {
 	ps.syncTaskMap.Range(func(key, value interface{}) bool {
 		task, ok := value.(*taskConfig)
 		if ok {
-			ps.api.ServiceDown(task.superNode, task.taskID, task.cid)
+			ps.api.ServiceDown(task.registration())
+			if task.servicePath != "" {
+				return true
+			}
 			serviceFile := helper.GetServiceFile(key.(string), task.dataDir)
-			os.Remove(serviceFile)
+			removeServiceFile(serviceFile)
 			logrus.Infof("shutdown, remove task id:%s file:%s",
-				task.taskID, serviceFile)
+				task.getTaskID(), serviceFile)
 		}
 		return true
 	})
 
 	c, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Minute))
 	ps.Shutdown(c)
+	if ps.localServer != nil {
+		ps.localServer.Shutdown(c)
+		os.Remove(ps.localPath)
+	}
 	cancel()
 	updateServicePortInMeta(ps.cfg.RV.MetaPath, 0)
 	logrus.Info("peer server is shutdown.")
 	ps.setFinished()
 }
 
+// heartbeat sends heart beats to the supernodes by the interval
+// until the peer server is shutdown.
+func (ps *peerServer) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ps.finished:
+			return
+		case <-ticker.C:
+			ps.sendHeartBeat()
+		}
+	}
+}
+
+// sendHeartBeat reports the load and the cache utilization of this peer and the tasks
+// it seeds to every supernode which the finished tasks served by this peer server belong to.
+// The cache is evicted down to the CacheSize before that.
+func (ps *peerServer) sendHeartBeat() {
+	// the fenced peer server keeps silent, so that the supernodes treat its peers as dead
+	if ps.isFenced() {
+		return
+	}
+	cacheUsed := ps.evictCache()
+	var taskCount int32
+	tasksByNode := make(map[string]map[string]*taskConfig)
+	uploadedByNode := make(map[string]map[string]int64)
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		task, ok := value.(*taskConfig)
+		if !ok {
+			return true
+		}
+		if node, taskID, _ := task.registration(); node != "" {
+			if tasksByNode[node] == nil {
+				tasksByNode[node] = make(map[string]*taskConfig)
+				uploadedByNode[node] = make(map[string]int64)
+			}
+			tasksByNode[node][taskID] = task
+			uploadedByNode[node][taskID] += atomic.LoadInt64(&task.uploadedBytes)
+			taskCount++
+		}
+		return true
+	})
+	// the purged tasks are reported even if the supernode has no task served any more
+	purged := ps.takePurged()
+	for node := range purged {
+		if tasksByNode[node] == nil {
+			tasksByNode[node] = make(map[string]*taskConfig)
+		}
+	}
+
+	load := atomic.LoadInt32(&ps.uploadingCount)
+	for node, tasks := range tasksByNode {
+		req := &apiTypes.HeartBeatRequest{
+			IP:        strfmt.IPv4(ps.host),
+			Port:      int32(ps.port),
+			Load:      load,
+			TaskCount: taskCount,
+
+			CacheCapacity: int64(ps.cfg.RV.CacheSize),
+			CacheUsed:     cacheUsed,
+			PurgedTaskIds: purged[node],
+			StandbyOf:     ps.cfg.StandbyOf,
+		}
+		for taskID := range tasks {
+			req.TaskIds = append(req.TaskIds, taskID)
+			if uploaded := uploadedByNode[node][taskID]; uploaded > 0 {
+				if req.TaskUploadedBytes == nil {
+					req.TaskUploadedBytes = make(map[string]int64)
+				}
+				req.TaskUploadedBytes[taskID] = uploaded
+			}
+		}
+		sort.Strings(req.TaskIds)
+
+		resp, err := ps.api.HeartBeat(node, req)
+		if err != nil {
+			logrus.Warnf("failed to send heart beat to supernode %s: %v", node, err)
+			ps.addPurged(node, purged[node]...)
+			continue
+		}
+		if resp == nil {
+			continue
+		}
+		if resp.NeedRegister {
+			logrus.Infof("supernode %s treats this peer as unregistered or dead", node)
+		}
+		for _, taskID := range resp.StopSeedingTaskIds {
+			if task, ok := tasks[taskID]; ok {
+				atomic.StoreInt32(&task.stopSeeding, 1)
+			}
+		}
+		ps.purgeTasks(node, resp.PurgeTaskIds)
+		ps.replicateTasks(node, resp.ReplicateTasks)
+		ps.pushPieces(resp.PushTasks)
+	}
+	ps.removeStoppedSeeds()
+}
+
+// shouldStopSeeding checks the seeding policies against a finished task,
+// and returns the reason if its file should not be seeded any more.
+//
+// The policies are checked in order:
+//  1. the file is always seeded within MinSeedTime after the download finished;
+//  2. stop seeding if the supernode doesn't need it;
+//  3. stop seeding if the uploaded bytes reach SeedRatio of the file length;
+//  4. stop seeding if the file isn't accessed within expireTime.
+func (ps *peerServer) shouldStopSeeding(task *taskConfig, info os.FileInfo,
+	expireTime time.Duration) (reason string, stop bool) {
+	task.lock.RLock()
+	finishTime, accessTime := task.finishTime, task.accessTime
+	task.lock.RUnlock()
+	if ps.cfg.RV.MinSeedTime > 0 && time.Since(finishTime) < ps.cfg.RV.MinSeedTime {
+		return "", false
+	}
+
+	if atomic.LoadInt32(&task.stopSeeding) == 1 {
+		return "stopped by supernode", true
+	}
+
+	if ratio := ps.cfg.RV.SeedRatio; ratio > 0 && info.Size() > 0 &&
+		float64(atomic.LoadInt64(&task.uploadedBytes)) >= ratio*float64(info.Size()) {
+		return fmt.Sprintf("seed ratio %v reached", ratio), true
+	}
+
+	// the task is expired only if both the access time and the modify time are
+	// expireTime ago. The access time is checked separately by the monotonic clock,
+	// so a forward step of the wall clock doesn't expire the accessed task spuriously.
+	if time.Since(accessTime) > expireTime && time.Since(info.ModTime()) > expireTime {
+		return "expired", true
+	}
+	return "", false
+}
+
+// inMinSeedTime returns whether any finished task is still within MinSeedTime,
+// during which the peer server should not exit.
+func (ps *peerServer) inMinSeedTime() bool {
+	if ps.cfg.RV.MinSeedTime <= 0 {
+		return false
+	}
+
+	var result bool
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		if task, ok := value.(*taskConfig); ok {
+			task.lock.RLock()
+			result = task.finished && time.Since(task.finishTime) < ps.cfg.RV.MinSeedTime
+			task.lock.RUnlock()
+		}
+		return !result
+	})
+	return result
+}
+
 func (ps *peerServer) deleteExpiredFile(path string, info os.FileInfo,
 	expireTime time.Duration) bool {
+	// the index file and the nonce file are removed along with their service file,
+	// unless the service file has been removed without them.
+	for _, suffix := range []string{pieceIndexSuffix, helper.CipherNonceSuffix} {
+		if !strings.HasSuffix(info.Name(), suffix) {
+			continue
+		}
+		if fileutils.PathExist(strings.TrimSuffix(path, suffix)) {
+			return false
+		}
+		os.Remove(path)
+		return true
+	}
+
 	taskName := helper.GetTaskName(info.Name())
 	if v, ok := ps.syncTaskMap.Load(taskName); ok {
 		task, ok := v.(*taskConfig)
-		if ok && !task.finished {
+		if ok && !task.isFinished() {
 			return false
 		}
 
-		var lastAccessTime = task.accessTime
-		// use the bigger of access time and modify time to
-		// check whether the task is expired
-		if task.accessTime.Sub(info.ModTime()) < 0 {
-			lastAccessTime = info.ModTime()
-		}
-		// if the last access time is expireTime ago
-		if time.Since(lastAccessTime) > expireTime {
+		if reason, stop := ps.shouldStopSeeding(task, info, expireTime); stop {
+			logrus.Infof("stop seeding task %s: %s", task.getTaskID(), reason)
 			if ok {
-				ps.api.ServiceDown(task.superNode, task.taskID, task.cid)
+				ps.api.ServiceDown(task.registration())
 			}
-			os.Remove(path)
+			removeServiceFile(path)
 			ps.syncTaskMap.Delete(taskName)
 			return true
 		}
 	} else {
-		os.Remove(path)
+		removeServiceFile(path)
 		return true
 	}
 	return false
 }
 
+// findDataDir returns the data directory which holds the service file
+// of the taskFileName, and the SystemDataDir is returned if it's not found.
+func (ps *peerServer) findDataDir(taskFileName string) string {
+	for _, dir := range ps.cfg.DataDirs {
+		if fileutils.PathExist(helper.GetServiceFile(taskFileName, dir.Path)) {
+			return dir.Path
+		}
+	}
+	return ps.cfg.RV.SystemDataDir
+}
+
 // ----------------------------------------------------------------------------
 // helper functions
 
@@ -536,8 +1215,3 @@ func rangeErrorResponse(w http.ResponseWriter, err error) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
-
-func jsonStr(v interface{}) string {
-	b, _ := json.Marshal(v)
-	return string(b)
-}
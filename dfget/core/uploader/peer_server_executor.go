@@ -22,6 +22,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -52,6 +53,11 @@ func GetPeerServerExecutor() PeerServerExecutor {
 // if it doesn't exist.
 // This function is invoked when dfget starts to download files in p2p pattern.
 func StartPeerServerProcess(cfg *config.Config) (port int, err error) {
+	if f, err := readFence(cfg.RV.MetaPath); err == nil {
+		return 0, fmt.Errorf("peer server is fenced at %s: %s, remove %s to lift the fence",
+			f.Time.Format(time.RFC3339), f.Reason, config.GetFenceFile(cfg.RV.MetaPath))
+	}
+	useUploaderSocket(config.GetUploaderSocket(cfg.RV.MetaPath))
 	if defaultExecutor != nil {
 		return defaultExecutor.StartPeerServerProcess(cfg)
 	}
@@ -93,7 +99,48 @@ func (pe *peerServerExecutor) StartPeerServerProcess(cfg *config.Config) (port i
 		"--data", cfg.RV.SystemDataDir,
 		"--home", cfg.WorkHome,
 		"--expiretime", cfg.RV.DataExpireTime.String(),
-		"--alivetime", cfg.RV.ServerAliveTime.String())
+		"--alivetime", cfg.RV.ServerAliveTime.String(),
+		"--minseedtime", cfg.RV.MinSeedTime.String(),
+		"--seedratio", strconv.FormatFloat(cfg.RV.SeedRatio, 'f', -1, 64),
+		"--cachesize", cfg.RV.CacheSize.String(),
+		"--readahead", strconv.Itoa(cfg.RV.ReadAheadPieces),
+		"--disk-failure-limit", strconv.Itoa(cfg.RV.DiskFailureLimit),
+		"--access-log-sample-rate", strconv.FormatFloat(cfg.RV.AccessLogSampleRate, 'f', -1, 64),
+		"--admin-port", strconv.Itoa(cfg.RV.AdminPort))
+	// seed the task files imported from the cache archives
+	cacheDir := filepath.Join(cfg.WorkHome, config.CacheDirName)
+	if fileutils.PathExist(filepath.Join(cacheDir, config.SeedManifestFile)) {
+		cmd.Args = append(cmd.Args, "--seeddir", cacheDir)
+		if len(cfg.Supernodes) > 0 {
+			cmd.Args = append(cmd.Args, "--node",
+				config.NewSupernodesValue(new([]*config.NodeWeight), cfg.Supernodes).String())
+		}
+	}
+	if cfg.P2PIP != "" {
+		cmd.Args = append(cmd.Args, "--p2p-ip", cfg.P2PIP)
+	}
+	if len(cfg.AdvertiseIPs) > 0 {
+		cmd.Args = append(cmd.Args, "--advertise-ip", strings.Join(cfg.AdvertiseIPs, ","))
+	}
+	if cfg.StandbyOf != "" {
+		cmd.Args = append(cmd.Args, "--standby-of", cfg.StandbyOf)
+	}
+	if len(cfg.DataDirs) > 0 {
+		cmd.Args = append(cmd.Args, "--datadirs",
+			config.NewDataDirsValue(new([]*config.DataDirWeight), cfg.DataDirs).String())
+	}
+	if !cfg.PeerPortRange.IsEmpty() {
+		cmd.Args = append(cmd.Args, "--port-range", cfg.PeerPortRange.String())
+	}
+	if len(cfg.CacheKeys) > 0 {
+		cmd.Args = append(cmd.Args, "--cache-keys", formatCacheKeys(cfg.CacheKeys))
+	}
+	if cfg.RV.Multiplex {
+		cmd.Args = append(cmd.Args, "--multiplex")
+	}
+	if cfg.RV.ReverifyOnFence {
+		cmd.Args = append(cmd.Args, "--reverify-on-fence")
+	}
 	if cfg.Verbose {
 		cmd.Args = append(cmd.Args, "--verbose")
 	}
@@ -103,6 +150,12 @@ func (pe *peerServerExecutor) StartPeerServerProcess(cfg *config.Config) (port i
 		return 0, err
 	}
 	if err = cmd.Start(); err == nil {
+		// the peer server outlives the download, so it's released from the cgroup of the download
+		if cfg.RV.Cgroup != nil {
+			if e := cfg.RV.Cgroup.Release(cmd.Process.Pid); e != nil {
+				logrus.Warnf("failed to release the peer server from the cgroup %s: %v", cfg.RV.Cgroup.Path, e)
+			}
+		}
 		port, err = readPort(stdout)
 	}
 	if err == nil && pe.checkPeerServerExist(cfg, port) <= 0 {
@@ -154,7 +207,8 @@ func (pe *peerServerExecutor) checkPeerServerExist(cfg *config.Config, port int)
 	}
 
 	// check the peer server whether is available
-	result, err := checkServer(cfg.RV.LocalIP, port, cfg.RV.DataDir, taskFileName, int(cfg.TotalLimit))
+	result, err := checkServer(cfg.PeerIP(), port, cfg.RV.DataDir, taskFileName, int(cfg.TotalLimit), cfg.Namespace,
+		cfg.AcceptPush)
 	logrus.Infof("local http result:%s err:%v, port:%d path:%s",
 		result, err, port, config.LocalHTTPPathCheck)
 
@@ -167,3 +221,44 @@ func (pe *peerServerExecutor) checkPeerServerExist(cfg *config.Config, port int)
 	}
 	return 0
 }
+
+// ---------------------------------------------------------------------------
+// PeerServerExecutor in-process implementation
+
+// NewInProcessExecutor returns a PeerServerExecutor which never starts a new process.
+// It uses the peer server launched by LaunchPeerServer in the current process, or
+// the one recorded in the meta file if the port has been used by another process.
+// It's used by the programs which run the downloads of dfget in their own processes.
+func NewInProcessExecutor() PeerServerExecutor {
+	return &inProcessExecutor{}
+}
+
+type inProcessExecutor struct {
+	peerServerExecutor
+}
+
+func (ie *inProcessExecutor) StartPeerServerProcess(cfg *config.Config) (port int, err error) {
+	if isRunning() {
+		port = p2p.port
+	}
+	if port = ie.checkPeerServerExist(cfg, port); port > 0 {
+		return port, nil
+	}
+	return 0, fmt.Errorf("no peer server is available in the process")
+}
+
+// formatCacheKeys formats the cache keys as the value of the flag --cache-keys
+// in the order of the namespaces.
+func formatCacheKeys(keys map[string]string) string {
+	namespaces := make([]string, 0, len(keys))
+	for ns := range keys {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	pairs := make([]string, 0, len(keys))
+	for _, ns := range namespaces {
+		pairs = append(pairs, ns+"="+keys[ns])
+	}
+	return strings.Join(pairs, ",")
+}
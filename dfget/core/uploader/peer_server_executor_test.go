@@ -115,6 +115,38 @@ func (s *PeerServerExecutorTestSuite) TestStartPeerServerProcess(c *check.C) {
 	c.Assert(e, check.IsNil)
 }
 
+func (s *PeerServerExecutorTestSuite) TestInProcessExecutor(c *check.C) {
+	originP2P := p2p
+	defer func() { p2p = originP2P }()
+	p2p = nil
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.RV.LocalIP = s.ip
+	os.Args[0] = s.script
+	// the script is never executed by the in-process executor
+	s.writeScript(fmt.Sprintf("echo %d", s.port))
+	defer s.writeScript("")
+	os.Remove(cfg.RV.MetaPath)
+	pe := NewInProcessExecutor()
+
+	port, e := pe.StartPeerServerProcess(cfg)
+	c.Assert(port, check.Equals, 0)
+	c.Assert(e, check.NotNil)
+
+	// use the server recorded in the meta file
+	updateServicePortInMeta(cfg.RV.MetaPath, s.port)
+	port, e = pe.StartPeerServerProcess(cfg)
+	c.Assert(port, check.Equals, s.port)
+	c.Assert(e, check.IsNil)
+
+	// use the server launched in the process
+	os.Remove(cfg.RV.MetaPath)
+	p2p = &peerServer{port: s.port, finished: make(chan struct{})}
+	port, e = pe.StartPeerServerProcess(cfg)
+	c.Assert(port, check.Equals, s.port)
+	c.Assert(e, check.IsNil)
+}
+
 func (s *PeerServerExecutorTestSuite) TestReadPort(c *check.C) {
 	port := 39480
 	reader := strings.NewReader("dfget uploader server port is " + strconv.Itoa(port) + "\n")
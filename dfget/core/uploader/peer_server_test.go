@@ -17,17 +17,22 @@
 package uploader
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-check/check"
 
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
@@ -124,7 +129,7 @@ func (s *PeerServerTestSuite) TestUploadPiece(c *check.C) {
 	for _, v := range cases {
 		rr := httptest.NewRecorder()
 		p := up(v.start, v.end-v.start+1, v.pad)
-		err := s.srv.uploadPiece(f, rr, p)
+		err := s.srv.uploadPiece(f, rr, p, nil)
 		c.Check(err, check.IsNil)
 		cmt := check.Commentf("content:'%s' start:%d end:%d pad:%v",
 			commonFileContent, v.start, v.end, v.pad)
@@ -137,6 +142,86 @@ func (s *PeerServerTestSuite) TestUploadPiece(c *check.C) {
 	}
 }
 
+func (s *PeerServerTestSuite) TestUploadResumedPiece(c *check.C) {
+	f, size, _ := s.srv.getTaskFile(commonFile)
+	defer f.Close()
+
+	var up = func(pad bool, offset int64) *uploadParam {
+		up := &uploadParam{
+			start:     0,
+			length:    16,
+			pieceNum:  0,
+			pieceSize: defaultPieceSize,
+		}
+		amendRange(size, pad, up)
+		up.offset = offset
+		return up
+	}
+
+	full := pieceContent(defaultPieceSize, commonFileContent)
+	for _, offset := range []int64{0, 2, 4, 7, int64(len(full)) - 1} {
+		rr := httptest.NewRecorder()
+		c.Check(s.srv.uploadPiece(f, rr, up(true, offset), nil), check.IsNil)
+		cmt := check.Commentf("offset:%d", offset)
+		c.Check(rr.Body.String(), check.Equals, full[offset:], cmt)
+		if offset > 0 {
+			c.Check(rr.Header().Get(config.StrPieceOffset), check.Equals, fmt.Sprint(offset), cmt)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	c.Check(s.srv.uploadPiece(f, rr, up(false, 3), nil), check.IsNil)
+	c.Check(rr.Body.String(), check.Equals, commonFileContent[3:])
+}
+
+func (s *PeerServerTestSuite) TestUploadEncryptedPiece(c *check.C) {
+	cc, err := helper.NewCacheCipher([]byte("0123456789abcdef"))
+	c.Assert(err, check.IsNil)
+	srv := newTestPeerServer(s.workHome)
+	srv.ciphers = map[string]*helper.CacheCipher{"foo": cc}
+
+	fileName := "encryptedFile"
+	serviceFile := helper.GetServiceFile(fileName, s.workHome)
+	fc, err := cc.NewFile(serviceFile)
+	c.Assert(err, check.IsNil)
+	f, err := os.Create(serviceFile)
+	c.Assert(err, check.IsNil)
+	_, err = fc.Writer(f, 0).Write([]byte(file2000Content))
+	f.Close()
+	c.Assert(err, check.IsNil)
+
+	// the task file isn't decrypted without the key of its namespace
+	srv.syncTaskMap.Store(fileName, &taskConfig{dataDir: s.workHome, namespace: "bar"})
+	_, err = srv.getFileCipher(fileName)
+	c.Check(err, check.NotNil)
+
+	srv.syncTaskMap.Store(fileName, &taskConfig{dataDir: s.workHome, namespace: "foo"})
+	fc, err = srv.getFileCipher(fileName)
+	c.Assert(err, check.IsNil)
+	f, _, err = srv.getTaskFile(fileName)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	rr := httptest.NewRecorder()
+	err = srv.uploadPiece(f, rr, &uploadParam{start: 1001, length: 500}, fc)
+	c.Check(err, check.IsNil)
+	c.Check(rr.Body.String(), check.Equals, file2000Content[1001:1501])
+
+	// the nonce file is removed along with the service file, or as an orphan
+	nonceFile := helper.GetCipherNonceFile(serviceFile)
+	info, err := os.Stat(nonceFile)
+	c.Assert(err, check.IsNil)
+	c.Check(srv.deleteExpiredFile(nonceFile, info, time.Hour), check.Equals, false)
+	c.Check(removeServiceFile(serviceFile), check.IsNil)
+	c.Check(fileutils.PathExist(nonceFile), check.Equals, false)
+
+	c.Assert(ioutil.WriteFile(nonceFile, []byte("orphan"), 0600), check.IsNil)
+	info, err = os.Stat(nonceFile)
+	c.Assert(err, check.IsNil)
+	c.Check(srv.deleteExpiredFile(nonceFile, info, time.Hour), check.Equals, true)
+	c.Check(fileutils.PathExist(nonceFile), check.Equals, false)
+}
+
 func (s *PeerServerTestSuite) TestAmendRange(c *check.C) {
 	var p = func() *uploadParamBuilder {
 		return &uploadParamBuilder{
@@ -327,6 +412,163 @@ func (s *PeerServerTestSuite) TestShutdown(c *check.C) {
 	c.Assert(getPortFromMeta(cfg.RV.MetaPath), check.Equals, 0)
 }
 
+func (s *PeerServerTestSuite) TestListenAndServeAdvertised(c *check.C) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	cfg := createConfig(s.workHome, port)
+	cfg.RV.LocalIP = "127.0.0.1"
+	cfg.AdvertiseIPs = []string{"127.0.0.1", "127.0.0.2"}
+	c.Assert(cfg.PeerAddresses(), check.DeepEquals, []string{"127.0.0.2"})
+
+	ps := newPeerServer(cfg, port)
+	go ps.ListenAndServe()
+	defer ps.Close()
+
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+		var alive bool
+		for i := 0; i < 50 && !alive; i++ {
+			alive = api.NewUploaderAPI(httputils.DefaultTimeout).PingServer(ip, port)
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Check(alive, check.Equals, true, check.Commentf("ip: %s", ip))
+	}
+}
+
+func (s *PeerServerTestSuite) TestSendHeartBeat(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	cfg.RV.LocalIP = "127.0.0.1"
+	ps := newPeerServer(cfg, 15001)
+	ps.syncTaskMap.Store("a", &taskConfig{taskID: "a", superNode: "node1", uploadedBytes: 100})
+	ps.syncTaskMap.Store("b", &taskConfig{taskID: "b", superNode: "node2"})
+	ps.syncTaskMap.Store("c", &taskConfig{taskID: "c", superNode: "node1"})
+	// the supernode of an unfinished task is unknown
+	ps.syncTaskMap.Store("d", &taskConfig{})
+	ps.uploadingCount = 2
+
+	nodes := make(map[string]*apiTypes.HeartBeatRequest)
+	ps.api = &helper.MockSupernodeAPI{
+		HeartBeatFunc: func(node string, req *apiTypes.HeartBeatRequest) (*apiTypes.HeartBeatResponse, error) {
+			nodes[node] = req
+			return &apiTypes.HeartBeatResponse{StopSeedingTaskIds: []string{"b", "c"}}, nil
+		},
+	}
+
+	ps.sendHeartBeat()
+	c.Assert(nodes, check.HasLen, 2)
+	req := nodes["node1"]
+	c.Assert(req, check.NotNil)
+	c.Check(req.IP.String(), check.Equals, "127.0.0.1")
+	c.Check(req.Port, check.Equals, int32(15001))
+	c.Check(req.Load, check.Equals, int32(2))
+	c.Check(req.TaskCount, check.Equals, int32(3))
+	c.Check(req.TaskIds, check.DeepEquals, []string{"a", "c"})
+	c.Check(req.TaskUploadedBytes, check.DeepEquals, map[string]int64{"a": 100})
+	c.Assert(nodes["node2"], check.NotNil)
+	c.Check(nodes["node2"].TaskIds, check.DeepEquals, []string{"b"})
+	c.Check(nodes["node2"].TaskUploadedBytes, check.IsNil)
+
+	// only the tasks of the supernode sending the signal stop seeding
+	for name, expected := range map[string]int32{"a": 0, "b": 1, "c": 1} {
+		v, _ := ps.syncTaskMap.Load(name)
+		c.Check(v.(*taskConfig).stopSeeding, check.Equals, expected, check.Commentf("task %s", name))
+	}
+}
+
+func (s *PeerServerTestSuite) TestPurgeTasks(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	cfg.RV.LocalIP = "127.0.0.1"
+	ps := newPeerServer(cfg, 15001)
+	dataDir := filepath.Join(s.workHome, "TestPurgeTasks")
+	c.Assert(os.MkdirAll(dataDir, 0755), check.IsNil)
+	defer os.RemoveAll(dataDir)
+	serviceFile := helper.GetServiceFile("a", dataDir)
+	c.Assert(ioutil.WriteFile(serviceFile, []byte("a"), 0644), check.IsNil)
+	ps.syncTaskMap.Store("a", &taskConfig{taskID: "a", superNode: "node1", dataDir: dataDir})
+
+	var requests []*apiTypes.HeartBeatRequest
+	ps.api = &helper.MockSupernodeAPI{
+		HeartBeatFunc: func(node string, req *apiTypes.HeartBeatRequest) (*apiTypes.HeartBeatResponse, error) {
+			requests = append(requests, req)
+			return &apiTypes.HeartBeatResponse{PurgeTaskIds: []string{"a", "x"}}, nil
+		},
+	}
+
+	// the files are deleted regardless of the seeding policies
+	ps.sendHeartBeat()
+	c.Check(fileutils.PathExist(serviceFile), check.Equals, false)
+	_, ok := ps.syncTaskMap.Load("a")
+	c.Check(ok, check.Equals, false)
+
+	// the purged tasks are reported even if no task of the supernode is served
+	ps.sendHeartBeat()
+	c.Assert(requests, check.HasLen, 2)
+	c.Check(requests[0].PurgedTaskIds, check.IsNil)
+	c.Check(requests[1].TaskIds, check.IsNil)
+	c.Check(requests[1].PurgedTaskIds, check.DeepEquals, []string{"a", "x"})
+}
+
+func (s *PeerServerTestSuite) TestShouldStopSeeding(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	ps := newPeerServer(cfg, 0)
+
+	tmpFile := filepath.Join(s.workHome, "TestShouldStopSeeding")
+	ioutil.WriteFile(tmpFile, []byte("0123456789"), os.ModePerm)
+	info, _ := os.Stat(tmpFile)
+
+	var cases = []struct {
+		minSeedTime time.Duration
+		seedRatio   float64
+		task        *taskConfig
+		expire      time.Duration
+		stop        bool
+	}{
+		// accessed recently
+		{task: &taskConfig{accessTime: time.Now()}, expire: time.Hour, stop: false},
+		// not accessed within expire time
+		{task: &taskConfig{}, expire: 0, stop: true},
+		// within the minimum seed time
+		{minSeedTime: time.Hour, task: &taskConfig{finishTime: time.Now()}, expire: 0, stop: false},
+		{minSeedTime: time.Hour, task: &taskConfig{finishTime: time.Now(), stopSeeding: 1}, expire: 0, stop: false},
+		// beyond the minimum seed time
+		{minSeedTime: time.Second, task: &taskConfig{finishTime: time.Now().Add(-time.Minute)}, expire: 0, stop: true},
+		// signaled by supernode
+		{task: &taskConfig{accessTime: time.Now(), stopSeeding: 1}, expire: time.Hour, stop: true},
+		// seed ratio
+		{seedRatio: 2, task: &taskConfig{accessTime: time.Now(), uploadedBytes: 19}, expire: time.Hour, stop: false},
+		{seedRatio: 2, task: &taskConfig{accessTime: time.Now(), uploadedBytes: 20}, expire: time.Hour, stop: true},
+	}
+
+	for i, v := range cases {
+		cfg.RV.MinSeedTime = v.minSeedTime
+		cfg.RV.SeedRatio = v.seedRatio
+		reason, stop := ps.shouldStopSeeding(v.task, info, v.expire)
+		c.Check(stop, check.Equals, v.stop, check.Commentf("case %d: %s", i, reason))
+	}
+
+	cfg.RV.MinSeedTime = time.Hour
+	ps.syncTaskMap.Store("a", &taskConfig{finished: true, finishTime: time.Now().Add(-2 * time.Hour)})
+	c.Check(ps.inMinSeedTime(), check.Equals, false)
+	ps.syncTaskMap.Store("b", &taskConfig{finished: true, finishTime: time.Now()})
+	c.Check(ps.inMinSeedTime(), check.Equals, true)
+}
+
+func (s *PeerServerTestSuite) TestFindDataDir(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	cfg.DataDirs = []*config.DataDirWeight{
+		{Path: filepath.Join(s.workHome, "data1"), Weight: 1},
+		{Path: filepath.Join(s.workHome, "data2"), Weight: 1},
+	}
+	ps := newPeerServer(cfg, 0)
+
+	c.Assert(os.MkdirAll(cfg.DataDirs[1].Path, 0755), check.IsNil)
+	c.Assert(helper.CreateTestFile(helper.GetServiceFile("TestFindDataDir", cfg.DataDirs[1].Path), ""), check.IsNil)
+	c.Check(ps.findDataDir("TestFindDataDir"), check.Equals, cfg.DataDirs[1].Path)
+	c.Check(ps.findDataDir("TestFindDataDir-x"), check.Equals, cfg.RV.SystemDataDir)
+}
+
 func (s *PeerServerTestSuite) TestDeleteExpiredFile(c *check.C) {
 	cfg := createConfig(s.workHome, 0)
 	mark := make(map[string]bool)
@@ -547,6 +789,135 @@ func (s *PeerServerTestSuite) TestOneFinishHandler(c *check.C) {
 	}
 }
 
+// TestOneFinishHandlerConcurrently finishes the tasks while the other goroutines read them,
+// which is meaningful with the race detector.
+func (s *PeerServerTestSuite) TestOneFinishHandlerConcurrently(c *check.C) {
+	srv := newTestPeerServer(s.workHome)
+	srv.api = &helper.MockSupernodeAPI{
+		HeartBeatFunc: func(node string, req *apiTypes.HeartBeatRequest) (*apiTypes.HeartBeatResponse, error) {
+			return &apiTypes.HeartBeatResponse{}, nil
+		},
+	}
+	srv.syncTaskMap.Store("running", &taskConfig{dataDir: s.workHome})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			req := &api.FinishTaskRequest{
+				TaskFileName: "running",
+				TaskID:       fmt.Sprintf("task%d", i),
+				ClientID:     "cid",
+				Node:         "127.0.0.1",
+				URL:          "http://host/file",
+			}
+			if i%2 == 0 {
+				req.TaskFileName = fmt.Sprintf("new%d", i)
+			}
+			testHandlerHelper(srv, &HandlerHelper{
+				method: http.MethodGet,
+				url:    config.LocalHTTPPathClient + "finish?" + httputils.ParseQuery(req),
+			})
+		}(i)
+		go func() {
+			defer wg.Done()
+			srv.sendHeartBeat()
+			srv.writeStatus(ioutil.Discard)
+			srv.loadSharedTask("running")
+			testHandlerHelper(srv, &HandlerHelper{
+				method: http.MethodGet,
+				url:    config.LocalHTTPPathClient + "tasks",
+			})
+		}()
+	}
+	wg.Wait()
+
+	v, ok := srv.syncTaskMap.Load("running")
+	c.Assert(ok, check.Equals, true)
+	c.Check(v.(*taskConfig).isFinished(), check.Equals, true)
+	c.Check(v.(*taskConfig).rawURL, check.Equals, "http://host/file")
+}
+
+func (s *PeerServerTestSuite) TestPauseHandler(c *check.C) {
+	srv := newTestPeerServer(s.workHome)
+	srv.syncTaskMap.Store("running", &taskConfig{})
+	srv.syncTaskMap.Store("finished", &taskConfig{finished: true})
+
+	var cases = []struct {
+		method string
+		path   string
+		file   string
+		code   int
+		body   string
+	}{
+		{method: http.MethodGet, path: "pause", file: "running", code: http.StatusOK, body: "false"},
+		{method: http.MethodPut, path: "pause", file: "running", code: http.StatusOK, body: "true"},
+		{method: http.MethodGet, path: "pause", file: "running", code: http.StatusOK, body: "true"},
+		{method: http.MethodPut, path: "resume", file: "running", code: http.StatusOK, body: "false"},
+		{method: http.MethodGet, path: "pause", file: "running", code: http.StatusOK, body: "false"},
+		{method: http.MethodPut, path: "pause", file: "finished", code: http.StatusConflict},
+		{method: http.MethodPut, path: "pause", file: "foo", code: http.StatusNotFound},
+		{method: http.MethodPut, path: "resume", file: "", code: http.StatusBadRequest},
+	}
+
+	for _, v := range cases {
+		rr, err := testHandlerHelper(srv, &HandlerHelper{
+			method: v.method,
+			url:    config.LocalHTTPPathClient + v.path + "?" + config.StrTaskFileName + "=" + v.file,
+		})
+		c.Assert(err, check.IsNil)
+		cmt := check.Commentf("%s %s %s", v.method, v.path, v.file)
+		c.Check(rr.Code, check.Equals, v.code, cmt)
+		if v.code == http.StatusOK {
+			c.Check(rr.Body.String(), check.Equals, v.body, cmt)
+		}
+	}
+}
+
+func (s *PeerServerTestSuite) TestTargetHandler(c *check.C) {
+	srv := newTestPeerServer(s.workHome)
+	srv.syncTaskMap.Store("running", &taskConfig{})
+
+	var cases = []struct {
+		method string
+		query  string
+		code   int
+		status api.TargetStatus
+	}{
+		{method: http.MethodGet, query: "", code: http.StatusOK},
+		{method: http.MethodGet, query: "&current=/a", code: http.StatusOK,
+			status: api.TargetStatus{Current: "/a"}},
+		{method: http.MethodPut, query: "&target=b", code: http.StatusBadRequest},
+		{method: http.MethodPut, query: "&target=/b/", code: http.StatusOK,
+			status: api.TargetStatus{Target: "/b", RequestID: 1, Current: "/a"}},
+		{method: http.MethodPut, query: "&target=/c", code: http.StatusOK,
+			status: api.TargetStatus{Target: "/c", RequestID: 2, Current: "/a"}},
+		// the error of the request which isn't the last one is ignored
+		{method: http.MethodGet, query: "&current=/a&requestID=1&error=failed", code: http.StatusOK,
+			status: api.TargetStatus{Target: "/c", RequestID: 2, Current: "/a"}},
+		{method: http.MethodGet, query: "&current=/a&requestID=2&error=failed", code: http.StatusOK,
+			status: api.TargetStatus{Target: "/c", RequestID: 2, Current: "/a", Error: "failed"}},
+		{method: http.MethodGet, query: "&current=/c&requestID=2", code: http.StatusOK,
+			status: api.TargetStatus{Target: "/c", RequestID: 2, Current: "/c"}},
+	}
+
+	for _, v := range cases {
+		rr, err := testHandlerHelper(srv, &HandlerHelper{
+			method: v.method,
+			url:    config.LocalHTTPPathClient + "target?" + config.StrTaskFileName + "=running" + v.query,
+		})
+		c.Assert(err, check.IsNil)
+		cmt := check.Commentf("%s %s", v.method, v.query)
+		c.Assert(rr.Code, check.Equals, v.code, cmt)
+		if v.code == http.StatusOK {
+			var status api.TargetStatus
+			c.Assert(json.Unmarshal(rr.Body.Bytes(), &status), check.IsNil, cmt)
+			c.Check(status, check.DeepEquals, v.status, cmt)
+		}
+	}
+}
+
 // -----------------------------------------------------------------------------
 // helper functions
 
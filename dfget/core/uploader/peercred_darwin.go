@@ -0,0 +1,32 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredSupported is false since SO_PEERCRED isn't supported on darwin,
+// and the local requests are sent to the TCP port instead.
+const peerCredSupported = false
+
+// peerUID returns the uid of the process on the other side of the connection.
+// It's not supported on darwin yet.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return -1, syscall.ENOTSUP
+}
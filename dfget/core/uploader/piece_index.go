@@ -0,0 +1,354 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The service files with an index file next to them are in the v2 layout,
+// and the ones without it are in the v1 layout. The data of both is the same,
+// so a v1 file is migrated by building its index when it's loaded, which happens
+// when a staged file is imported or the download of a task file finishes.
+const (
+	pieceIndexSuffix  = ".idx"
+	pieceIndexMagic   = "DFPI"
+	pieceIndexVersion = 2
+
+	// pieceIndexHeaderSize is the size of the header of an index file:
+	//    magic(4) | version(4) | pieceSize(4) | fileLength(8) | modTime(8) | pieceCount(4)
+	pieceIndexHeaderSize = 32
+
+	// pieceIndexEntrySize is the size of an entry of an index file:
+	//    offset(8) | md5(16) | length(4) | flags(1)
+	pieceIndexEntrySize = 29
+
+	// pieceIndexChecksumSize is the size of the crc32 at the end of an index file,
+	// which is the checksum of the header and the entries.
+	pieceIndexChecksumSize = 4
+)
+
+const (
+	// pieceFlagComplete indicates all the data of the piece is in the service file.
+	pieceFlagComplete uint8 = 1 << iota
+)
+
+// pieceIndex describes where the pieces of a service file are and their md5s,
+// so that any piece can be located without reading the service file.
+type pieceIndex struct {
+	pieceSize  int32
+	fileLength int64
+	// modTime is the modification time of the service file in nanoseconds
+	// when the index is built, which invalidates the index if the file is changed.
+	modTime int64
+	entries []pieceIndexEntry
+}
+
+// pieceIndexEntry describes a piece of the service file, the data of which
+// starts from the offset and isn't wrapped by the piece head and tail.
+type pieceIndexEntry struct {
+	offset int64
+	md5    [md5.Size]byte
+	length int32
+	flags  uint8
+}
+
+// getPieceIndexFile returns the path of the index file of the service file.
+func getPieceIndexFile(servicePath string) string {
+	return servicePath + pieceIndexSuffix
+}
+
+// removeServiceFile removes the service file along with its index file and nonce file.
+func removeServiceFile(path string) error {
+	err := os.Remove(path)
+	for _, f := range []string{getPieceIndexFile(path), helper.GetCipherNonceFile(path)} {
+		if e := os.Remove(f); err == nil && e != nil && !os.IsNotExist(e) {
+			err = e
+		}
+	}
+	return err
+}
+
+// piece returns the entry of the piece in O(1).
+func (idx *pieceIndex) piece(pieceNum int) (*pieceIndexEntry, bool) {
+	if pieceNum < 0 || pieceNum >= len(idx.entries) {
+		return nil, false
+	}
+	return &idx.entries[pieceNum], true
+}
+
+// pieceMD5s returns the md5s of the pieces in the format of supernode,
+// each of which is the md5 of the piece wrapped by the piece head and tail
+// followed by its wrapped length.
+func (idx *pieceIndex) pieceMD5s() []string {
+	result := make([]string, 0, len(idx.entries))
+	for _, e := range idx.entries {
+		result = append(result, fmt.Sprintf("%x:%d", e.md5, e.length+config.PieceMetaSize))
+	}
+	return result
+}
+
+// matches returns whether the index describes the service file with the info.
+func (idx *pieceIndex) matches(pieceSize int32, info os.FileInfo) bool {
+	return idx.pieceSize == pieceSize && idx.fileLength == info.Size() &&
+		idx.modTime == info.ModTime().UnixNano()
+}
+
+// marshal encodes the index in the format of the index file.
+func (idx *pieceIndex) marshal() []byte {
+	size := pieceIndexHeaderSize + len(idx.entries)*pieceIndexEntrySize
+	buf := make([]byte, size+pieceIndexChecksumSize)
+	copy(buf, pieceIndexMagic)
+	binary.BigEndian.PutUint32(buf[4:], pieceIndexVersion)
+	binary.BigEndian.PutUint32(buf[8:], uint32(idx.pieceSize))
+	binary.BigEndian.PutUint64(buf[12:], uint64(idx.fileLength))
+	binary.BigEndian.PutUint64(buf[20:], uint64(idx.modTime))
+	binary.BigEndian.PutUint32(buf[28:], uint32(len(idx.entries)))
+
+	for i, e := range idx.entries {
+		b := buf[pieceIndexHeaderSize+i*pieceIndexEntrySize:]
+		binary.BigEndian.PutUint64(b, uint64(e.offset))
+		copy(b[8:], e.md5[:])
+		binary.BigEndian.PutUint32(b[24:], uint32(e.length))
+		b[28] = e.flags
+	}
+	binary.BigEndian.PutUint32(buf[size:], crc32.ChecksumIEEE(buf[:size]))
+	return buf
+}
+
+// unmarshalPieceIndex decodes the index from the content of an index file.
+func unmarshalPieceIndex(data []byte) (*pieceIndex, error) {
+	if len(data) < pieceIndexHeaderSize || !bytes.Equal(data[:4], []byte(pieceIndexMagic)) {
+		return nil, fmt.Errorf("invalid piece index")
+	}
+	if v := binary.BigEndian.Uint32(data[4:]); v != pieceIndexVersion {
+		return nil, fmt.Errorf("unsupported version %d of piece index", v)
+	}
+	count := int(binary.BigEndian.Uint32(data[28:]))
+	size := pieceIndexHeaderSize + count*pieceIndexEntrySize
+	if len(data) != size+pieceIndexChecksumSize {
+		return nil, fmt.Errorf("truncated piece index with %d pieces", count)
+	}
+	if crc32.ChecksumIEEE(data[:size]) != binary.BigEndian.Uint32(data[size:]) {
+		return nil, fmt.Errorf("checksum mismatch of piece index")
+	}
+
+	idx := &pieceIndex{
+		pieceSize:  int32(binary.BigEndian.Uint32(data[8:])),
+		fileLength: int64(binary.BigEndian.Uint64(data[12:])),
+		modTime:    int64(binary.BigEndian.Uint64(data[20:])),
+		entries:    make([]pieceIndexEntry, count),
+	}
+	for i := range idx.entries {
+		b := data[pieceIndexHeaderSize+i*pieceIndexEntrySize:]
+		e := &idx.entries[i]
+		e.offset = int64(binary.BigEndian.Uint64(b))
+		copy(e.md5[:], b[8:24])
+		e.length = int32(binary.BigEndian.Uint32(b[24:]))
+		e.flags = b[28]
+	}
+	return idx, nil
+}
+
+// buildPieceIndex reads the service file and computes the md5 of every piece in the
+// same way as the CDN of supernode, which is wrapped by the piece head and tail.
+func buildPieceIndex(path string, pieceSize int32) (*pieceIndex, error) {
+	pieceContSize := pieceSize - config.PieceMetaSize
+	if pieceContSize <= 0 {
+		return nil, fmt.Errorf("invalid piece size %d", pieceSize)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &pieceIndex{
+		pieceSize:  pieceSize,
+		fileLength: info.Size(),
+		modTime:    info.ModTime().UnixNano(),
+	}
+	if idx.entries, err = scanPieces(f, pieceSize); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// scanPieces reads the service file from r and returns the entries of its pieces, whose md5s
+// are computed in the same way as the CDN of supernode, wrapped by the piece head and tail.
+func scanPieces(r io.Reader, pieceSize int32) ([]pieceIndexEntry, error) {
+	pieceContSize := pieceSize - config.PieceMetaSize
+	if pieceContSize <= 0 {
+		return nil, fmt.Errorf("invalid piece size %d", pieceSize)
+	}
+
+	var (
+		entries []pieceIndexEntry
+		offset  int64
+		head    = make([]byte, config.PieceHeadSize)
+		buf     = make([]byte, pieceContSize)
+	)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(head, uint32(int32(n)|pieceSize<<4))
+			h := md5.New()
+			h.Write(head)
+			h.Write(buf[:n])
+			h.Write([]byte{config.PieceTailChar})
+
+			e := pieceIndexEntry{offset: offset, length: int32(n), flags: pieceFlagComplete}
+			copy(e.md5[:], h.Sum(nil))
+			entries = append(entries, e)
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writePieceIndex writes the index file of the service file atomically.
+func writePieceIndex(servicePath string, idx *pieceIndex) error {
+	path := getPieceIndexFile(servicePath)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(idx.marshal()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readPieceIndex reads the index file of the service file.
+func readPieceIndex(servicePath string) (*pieceIndex, error) {
+	data, err := ioutil.ReadFile(getPieceIndexFile(servicePath))
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalPieceIndex(data)
+}
+
+// loadPieceIndex returns the index of the service file, which is read from its index
+// file if it's up to date. Otherwise the index is built from the service file and
+// written to the index file, which migrates the service file to the v2 layout.
+// The failure of writing the index file is ignored since the service file could
+// be in a read-only directory, and the index is built again next time.
+// The built is false if the index is read from the index file, whose md5s
+// aren't verified against the data of the service file.
+func loadPieceIndex(servicePath string, pieceSize int32) (idx *pieceIndex, built bool, err error) {
+	info, err := os.Stat(servicePath)
+	if err != nil {
+		return nil, false, err
+	}
+	if idx, err := readPieceIndex(servicePath); err == nil && idx.matches(pieceSize, info) {
+		return idx, false, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("rebuild the piece index of %s: %v", servicePath, err)
+	}
+
+	if idx, err = buildPieceIndex(servicePath, pieceSize); err != nil {
+		return nil, false, errors.Wrapf(err, "failed to build the piece index of %s", servicePath)
+	}
+	if err := writePieceIndex(servicePath, idx); err != nil {
+		logrus.Warnf("failed to write the piece index of %s: %v", servicePath, err)
+	}
+	return idx, true, nil
+}
+
+// equal returns whether the other index describes the same pieces.
+func (idx *pieceIndex) equal(other *pieceIndex) bool {
+	if idx.pieceSize != other.pieceSize || len(idx.entries) != len(other.entries) {
+		return false
+	}
+	for i := range idx.entries {
+		if idx.entries[i] != other.entries[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// locatePiece sets the range of the requested piece to where it's stored in the task
+// file by the index, rather than computing it from the requested range. It returns false
+// if the piece can't be located by the index, such as the ones requested in another piece
+// size or without the piece head and tail.
+func locatePiece(idx *pieceIndex, needPad bool, up *uploadParam) bool {
+	if idx == nil || !needPad || up.pieceSize != int64(idx.pieceSize) {
+		return false
+	}
+	e, ok := idx.piece(int(up.pieceNum))
+	if !ok {
+		return false
+	}
+	up.padSize = config.PieceMetaSize
+	up.start = e.offset
+	up.length = int64(e.length) + up.padSize
+	return true
+}
+
+// indexTaskFile loads the piece index of the finished task file in the data directory,
+// by which its pieces are located and verified as they're sent. The index file written
+// before is reused if it's up to date, otherwise the index is built and written.
+// The encrypted task files aren't indexed since the md5s of the pieces are computed from
+// their plain text, and the staged ones are indexed when they're imported.
+func (ps *peerServer) indexTaskFile(taskFileName string, task *taskConfig, pieceSize int32) {
+	task.lock.RLock()
+	skip := task.namespace != "" || task.index != nil && task.index.pieceSize == pieceSize
+	task.lock.RUnlock()
+	if skip || task.servicePath != "" {
+		return
+	}
+
+	idx, _, err := loadPieceIndex(helper.GetServiceFile(taskFileName, task.dataDir), pieceSize)
+	if err != nil {
+		logrus.Warnf("failed to index the pieces of task file %s: %v", taskFileName, err)
+		return
+	}
+	task.lock.Lock()
+	task.index = idx
+	task.lock.Unlock()
+}
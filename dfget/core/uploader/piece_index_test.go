@@ -0,0 +1,248 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&PieceIndexTestSuite{})
+}
+
+type PieceIndexTestSuite struct {
+	workHome string
+}
+
+func (s *PieceIndexTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-PieceIndexTestSuite-")
+}
+
+func (s *PieceIndexTestSuite) TearDownTest(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+func (s *PieceIndexTestSuite) TestBuildPieceIndex(c *check.C) {
+	path := filepath.Join(s.workHome, "file")
+	c.Assert(ioutil.WriteFile(path, []byte(helper.CreateRandomString(25)), 0644), check.IsNil)
+
+	idx, err := buildPieceIndex(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Check(idx.fileLength, check.Equals, int64(25))
+	c.Assert(idx.entries, check.HasLen, 3)
+
+	e, ok := idx.piece(2)
+	c.Assert(ok, check.Equals, true)
+	c.Check(e.offset, check.Equals, int64(20))
+	c.Check(e.length, check.Equals, int32(5))
+	c.Check(e.flags&pieceFlagComplete, check.Equals, pieceFlagComplete)
+	_, ok = idx.piece(3)
+	c.Check(ok, check.Equals, false)
+
+	pieceMD5s, err := ComputePieceMD5s(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Check(idx.pieceMD5s(), check.DeepEquals, pieceMD5s)
+
+	decoded, err := unmarshalPieceIndex(idx.marshal())
+	c.Assert(err, check.IsNil)
+	c.Check(decoded, check.DeepEquals, idx)
+	c.Check(decoded.equal(idx), check.Equals, true)
+
+	_, err = unmarshalPieceIndex(idx.marshal()[:pieceIndexHeaderSize+1])
+	c.Check(err, check.NotNil)
+	_, err = unmarshalPieceIndex([]byte("invalid"))
+	c.Check(err, check.NotNil)
+
+	// the corrupted entries are detected by the checksum
+	data := idx.marshal()
+	data[pieceIndexHeaderSize]++
+	_, err = unmarshalPieceIndex(data)
+	c.Check(err, check.NotNil)
+}
+
+func (s *PieceIndexTestSuite) TestLoadPieceIndex(c *check.C) {
+	path := filepath.Join(s.workHome, "file")
+	c.Assert(ioutil.WriteFile(path, []byte(helper.CreateRandomString(25)), 0644), check.IsNil)
+
+	// the file without an index is migrated by writing its index
+	idx, built, err := loadPieceIndex(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Check(built, check.Equals, true)
+	stored, err := readPieceIndex(path)
+	c.Assert(err, check.IsNil)
+	c.Check(stored, check.DeepEquals, idx)
+
+	// the index is read from the index file instead of being built again
+	stored.entries[0].md5[0]++
+	c.Assert(writePieceIndex(path, stored), check.IsNil)
+	loaded, built, err := loadPieceIndex(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Check(built, check.Equals, false)
+	c.Check(loaded, check.DeepEquals, stored)
+	c.Check(loaded.equal(idx), check.Equals, false)
+
+	// the index is rebuilt with a different piece size
+	loaded, _, err = loadPieceIndex(path, 20)
+	c.Assert(err, check.IsNil)
+	c.Check(loaded.entries, check.HasLen, 2)
+
+	// the index is rebuilt if the file is changed
+	c.Assert(ioutil.WriteFile(path, []byte(helper.CreateRandomString(30)), 0644), check.IsNil)
+	future := time.Now().Add(time.Minute)
+	c.Assert(os.Chtimes(path, future, future), check.IsNil)
+	loaded, _, err = loadPieceIndex(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Check(loaded.fileLength, check.Equals, int64(30))
+	c.Check(loaded.entries, check.HasLen, 3)
+
+	// the corrupted index is rebuilt
+	c.Assert(ioutil.WriteFile(getPieceIndexFile(path), []byte("invalid"), 0644), check.IsNil)
+	loaded, _, err = loadPieceIndex(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Check(loaded.entries, check.HasLen, 3)
+
+	_, _, err = loadPieceIndex(filepath.Join(s.workHome, "not-exist"), 15)
+	c.Check(err, check.NotNil)
+}
+
+func (s *PieceIndexTestSuite) TestIndexTaskFile(c *check.C) {
+	ps := newTestPeerServer(s.workHome)
+	dataDir := ps.cfg.RV.SystemDataDir
+	finish := func(taskFileName, namespace string) *taskConfig {
+		rr, err := testHandlerHelper(ps, &HandlerHelper{
+			method: http.MethodGet,
+			url: config.LocalHTTPPathClient + "finish?" + httputils.ParseQuery(&api.FinishTaskRequest{
+				TaskFileName: taskFileName,
+				TaskID:       taskFileName,
+				ClientID:     "cid",
+				Namespace:    namespace,
+				PieceSize:    15,
+			}),
+		})
+		c.Assert(err, check.IsNil)
+		c.Assert(rr.Code, check.Equals, http.StatusOK)
+		v, _ := ps.syncTaskMap.Load(taskFileName)
+		return v.(*taskConfig)
+	}
+	waitIndex := func(task *taskConfig) *pieceIndex {
+		for i := 0; i < 100 && task.getIndex() == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return task.getIndex()
+	}
+
+	// the index of the downloaded file is written when the download finishes
+	helper.CreateTestFile(helper.GetServiceFile("downloaded", dataDir), helper.CreateRandomString(25))
+	path := helper.GetServiceFile("downloaded", dataDir)
+	idx := waitIndex(finish("downloaded", ""))
+	c.Assert(idx, check.NotNil)
+	c.Check(idx.entries, check.HasLen, 3)
+	stored, err := readPieceIndex(path)
+	c.Assert(err, check.IsNil)
+	c.Check(stored, check.DeepEquals, idx)
+
+	// the up-to-date index of the file served before is reused instead of being rebuilt
+	ps.syncTaskMap.Delete("downloaded")
+	stored.entries[0].md5[0]++
+	c.Assert(writePieceIndex(path, stored), check.IsNil)
+	c.Check(waitIndex(finish("downloaded", "")), check.DeepEquals, stored)
+
+	// the encrypted file isn't indexed
+	helper.CreateTestFile(helper.GetServiceFile("encrypted", dataDir), helper.CreateRandomString(25))
+	task := finish("encrypted", "foo")
+	time.Sleep(50 * time.Millisecond)
+	c.Check(task.getIndex(), check.IsNil)
+	c.Check(fileutils.PathExist(getPieceIndexFile(helper.GetServiceFile("encrypted", dataDir))), check.Equals, false)
+}
+
+func (s *PieceIndexTestSuite) TestUploadLocatedPiece(c *check.C) {
+	ps := newTestPeerServer(s.workHome)
+	dataDir := ps.cfg.RV.SystemDataDir
+	path := helper.GetServiceFile("indexed", dataDir)
+	helper.CreateTestFile(path, "hello world")
+	idx, err := buildPieceIndex(path, 10)
+	c.Assert(err, check.IsNil)
+	ps.syncTaskMap.Store("indexed", &taskConfig{dataDir: dataDir, finished: true, index: idx})
+
+	// the piece is located by the index rather than the requested range
+	rr, err := testHandlerHelper(ps, &HandlerHelper{
+		method: http.MethodGet,
+		url:    config.PeerHTTPPathPrefix + "indexed",
+		headers: map[string]string{
+			config.StrPieceSize: "10",
+			config.StrPieceNum:  "1",
+			"range":             "bytes=0-9",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rr.Code, check.Equals, http.StatusPartialContent)
+	body := rr.Body.Bytes()
+	c.Assert(len(body), check.Equals, 5+config.PieceMetaSize)
+	c.Check(string(body[config.PieceHeadSize:len(body)-1]), check.Equals, " worl")
+	c.Check(ps.isFenced(), check.Equals, false)
+}
+
+func (s *PieceIndexTestSuite) TestCollectPieceIndex(c *check.C) {
+	ps := newTestPeerServer(s.workHome)
+	dataDir := ps.cfg.RV.SystemDataDir
+	gc := func(path string) bool {
+		info, err := os.Stat(path)
+		c.Assert(err, check.IsNil)
+		return ps.deleteExpiredFile(path, info, time.Hour)
+	}
+
+	// the index file of a served file is kept
+	served := helper.GetServiceFile("served", dataDir)
+	helper.CreateTestFile(served, "served")
+	ps.syncTaskMap.Store("served", &taskConfig{dataDir: dataDir, finished: true, accessTime: time.Now()})
+	idx, _, err := loadPieceIndex(served, 10)
+	c.Assert(err, check.IsNil)
+	c.Check(idx.entries, check.HasLen, 2)
+	c.Check(gc(getPieceIndexFile(served)), check.Equals, false)
+	c.Check(gc(served), check.Equals, false)
+
+	// the unknown file is removed along with its index file
+	unknown := helper.GetServiceFile("unknown", dataDir)
+	helper.CreateTestFile(unknown, "unknown")
+	_, _, err = loadPieceIndex(unknown, 10)
+	c.Assert(err, check.IsNil)
+	c.Check(gc(unknown), check.Equals, true)
+	c.Check(fileutils.PathExist(getPieceIndexFile(unknown)), check.Equals, false)
+
+	// the index file left behind by its service file is removed
+	orphan := helper.GetServiceFile("orphan", dataDir)
+	helper.CreateTestFile(orphan, "orphan")
+	_, _, err = loadPieceIndex(orphan, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(os.Remove(orphan), check.IsNil)
+	c.Check(gc(getPieceIndexFile(orphan)), check.Equals, true)
+	c.Check(fileutils.PathExist(getPieceIndexFile(orphan)), check.Equals, false)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"os"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+
+	"github.com/sirupsen/logrus"
+)
+
+// purgeTasks deletes the files of the tasks purged by the supernode node immediately
+// regardless of the seeding policies, and the deleted ones are reported to it
+// by the next heart beat. The ones failing to be deleted are purged again
+// when the supernode instructs it next time.
+func (ps *peerServer) purgeTasks(node string, taskIDs []string) {
+	for _, taskID := range taskIDs {
+		if err := ps.purgeTask(taskID); err != nil {
+			logrus.Errorf("failed to purge task %s: %v", taskID, err)
+			continue
+		}
+		ps.addPurged(node, taskID)
+	}
+}
+
+// purgeTask deletes the task files of the task and their piece indexes,
+// including the ones staged in the seed directory.
+func (ps *peerServer) purgeTask(taskID string) (err error) {
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		task, ok := value.(*taskConfig)
+		if !ok || task.getTaskID() != taskID {
+			return true
+		}
+		path := task.servicePath
+		if path == "" {
+			path = helper.GetServiceFile(key.(string), task.dataDir)
+		}
+		for _, file := range []string{path, getPieceIndexFile(path)} {
+			if e := os.Remove(file); e != nil && !os.IsNotExist(e) {
+				err = e
+				return true
+			}
+		}
+		ps.syncTaskMap.Delete(key)
+		logrus.Infof("purge task id:%s file:%s", taskID, path)
+		return true
+	})
+	return err
+}
+
+// addPurged records the task purged by the supernode node to be reported to it.
+func (ps *peerServer) addPurged(node string, taskIDs ...string) {
+	if len(taskIDs) == 0 {
+		return
+	}
+	ps.purgedLock.Lock()
+	defer ps.purgedLock.Unlock()
+	if ps.purged == nil {
+		ps.purged = make(map[string][]string)
+	}
+	ps.purged[node] = append(ps.purged[node], taskIDs...)
+}
+
+// takePurged returns the tasks purged by the supernode nodes since the last call.
+func (ps *peerServer) takePurged() map[string][]string {
+	ps.purgedLock.Lock()
+	defer ps.purgedLock.Unlock()
+	purged := ps.purged
+	ps.purged = nil
+	return purged
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// pushClient sends the pushed pieces to the uploaders of the other peers,
+// whose connections are reused by the pieces pushed to the same peer.
+var pushClient = httputils.NewClient()
+
+// pushPieces pushes the pieces assigned by the supernode to the uploaders of the peers
+// whose downloads stall, in the background. The tasks not served by this peer are skipped.
+func (ps *peerServer) pushPieces(tasks []*apiTypes.PushTask) {
+	for _, task := range tasks {
+		if task == nil || task.TargetFileName == "" || task.PieceSize <= config.PieceMetaSize {
+			continue
+		}
+		taskFileName, ok := ps.findTaskFile(task.TaskID)
+		if !ok {
+			continue
+		}
+		go func(task *apiTypes.PushTask) {
+			for _, pieceNum := range task.PieceNums {
+				if err := ps.pushPiece(taskFileName, task, int64(pieceNum)); err != nil {
+					logrus.Warnf("failed to push piece %d of task %s to %s:%d: %v",
+						pieceNum, task.TaskID, task.TargetIP, task.TargetPort, err)
+				}
+			}
+		}(task)
+	}
+}
+
+// findTaskFile returns the name of the finished task file of the task served by this peer.
+func (ps *peerServer) findTaskFile(taskID string) (taskFileName string, found bool) {
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		if task, ok := value.(*taskConfig); ok && task.isFinished() && task.getTaskID() == taskID {
+			taskFileName, found = key.(string), true
+		}
+		return !found
+	})
+	return taskFileName, found
+}
+
+// pushPiece sends the piece of the task file wrapped by the meta data to the uploader
+// of the target by PUT, the same as it's uploaded to the peers downloading it.
+func (ps *peerServer) pushPiece(taskFileName string, task *apiTypes.PushTask, pieceNum int64) error {
+	pieceSize := int64(task.PieceSize)
+	up := &uploadParam{
+		start:     pieceNum * pieceSize,
+		length:    pieceSize,
+		pieceNum:  pieceNum,
+		pieceSize: pieceSize,
+	}
+	fc, err := ps.getFileCipher(taskFileName)
+	if err != nil {
+		return err
+	}
+	f, size, err := ps.getTaskFile(taskFileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := amendRange(size, true, up); err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ps.writePiece(f, buf, up, fc); err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s%s%s", net.JoinHostPort(task.TargetIP, strconv.Itoa(int(task.TargetPort))),
+		config.PushHTTPPathPrefix, task.TargetFileName)
+	headers := map[string]string{
+		config.StrPieceNum:  strconv.FormatInt(pieceNum, 10),
+		config.StrPieceSize: strconv.FormatInt(pieceSize, 10),
+	}
+	timeout := netutils.CalculateTimeout(pieceSize, ps.cfg.MinRate, config.DefaultMinRate, 10*time.Second)
+	resp, err := pushClient.DoWithBody(http.MethodPut, url, headers, buf.Bytes(), timeout)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	}
+	if v, ok := ps.syncTaskMap.Load(taskFileName); ok {
+		atomic.AddInt64(&v.(*taskConfig).uploadedBytes, up.length)
+	}
+	return nil
+}
+
+// pushHandler receives a piece pushed by another peer as instructed by the supernode,
+// if the running download of the task file accepts the pushed pieces. The piece is
+// staged in the push directory of the work home, and the download verifies it against
+// its md5 before using it.
+func (ps *peerServer) pushHandler(w http.ResponseWriter, r *http.Request) {
+	if ps.rejectFenced(w) {
+		return
+	}
+	sendAlive(ps.cfg)
+	taskFileName := mux.Vars(r)["commonFile"]
+	v, ok := ps.syncTaskMap.Load(taskFileName)
+	if task, _ := v.(*taskConfig); !ok || task == nil || task.isFinished() || !task.acceptPush {
+		http.Error(w, fmt.Sprintf("task file %s doesn't accept the pushed pieces", taskFileName), http.StatusForbidden)
+		return
+	}
+
+	pieceNum, err := strconv.Atoi(r.Header.Get(config.StrPieceNum))
+	if err != nil || pieceNum < 0 {
+		http.Error(w, fmt.Sprintf("invalid piece num: %s", r.Header.Get(config.StrPieceNum)), http.StatusBadRequest)
+		return
+	}
+	pieceSize, err := strconv.ParseInt(r.Header.Get(config.StrPieceSize), 10, 64)
+	if err != nil || pieceSize <= config.PieceMetaSize {
+		http.Error(w, fmt.Sprintf("invalid piece size: %s", r.Header.Get(config.StrPieceSize)), http.StatusBadRequest)
+		return
+	}
+	if r.ContentLength > pieceSize {
+		http.Error(w, fmt.Sprintf("piece is larger than %d bytes", pieceSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	path := helper.GetPushedPieceFile(ps.cfg.WorkHome, taskFileName, pieceNum)
+	if err := receivePiece(path, http.MaxBytesReader(w, r.Body, pieceSize)); err != nil {
+		logrus.Warnf("failed to receive the pushed piece %d of file %s: %v", pieceNum, taskFileName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logrus.Debugf("receive the pushed piece %d of file %s from %s", pieceNum, taskFileName, r.RemoteAddr)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// receivePiece writes the piece into a temp file and renames it to the path,
+// so that a partially received piece is never read by the download.
+func receivePiece(path string, r io.Reader) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".push-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+
+	"github.com/go-check/check"
+)
+
+func (s *PeerServerTestSuite) TestPushPieces(c *check.C) {
+	workHome, err := ioutil.TempDir("/tmp", "dfget-TestPushPieces-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(workHome)
+
+	target := newTestPeerServer(workHome)
+	initHelper(target, "stalled", workHome, "")
+	v, _ := target.syncTaskMap.Load("stalled")
+	v.(*taskConfig).acceptPush = true
+	initHelper(target, "rejected", workHome, "")
+	ts := httptest.NewServer(target.initRouter())
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(ts.URL, "http://"))
+	targetPort, _ := strconv.Atoi(port)
+
+	v, _ = s.srv.syncTaskMap.Load(commonFile)
+	v.(*taskConfig).taskID = "common"
+	v.(*taskConfig).finished = true
+	defer func() {
+		v.(*taskConfig).taskID = ""
+		v.(*taskConfig).finished = false
+	}()
+
+	pieceSize := int32(config.PieceMetaSize + 4)
+	s.srv.pushPieces([]*apiTypes.PushTask{
+		{TaskID: "common", PieceNums: []int32{0, 2}, PieceSize: pieceSize,
+			TargetFileName: "stalled", TargetIP: host, TargetPort: int32(targetPort)},
+		// the task not served is skipped
+		{TaskID: "unknown", PieceNums: []int32{1}, PieceSize: pieceSize,
+			TargetFileName: "stalled", TargetIP: host, TargetPort: int32(targetPort)},
+	})
+
+	read := func(pieceNum int) string {
+		for i := 0; i < 100; i++ {
+			if data, err := ioutil.ReadFile(helper.GetPushedPieceFile(workHome, "stalled", pieceNum)); err == nil {
+				return string(data)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return ""
+	}
+	c.Check(read(0), check.Equals, pieceContent(int64(pieceSize), commonFileContent[:4]))
+	c.Check(read(2), check.Equals, pieceContent(int64(pieceSize), commonFileContent[8:]))
+	_, err = os.Stat(helper.GetPushedPieceFile(workHome, "stalled", 1))
+	c.Check(os.IsNotExist(err), check.Equals, true)
+
+	// the pieces aren't accepted by the download which doesn't accept them or the oversized ones
+	put := func(taskFileName, body string) int {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+config.PushHTTPPathPrefix+taskFileName, strings.NewReader(body))
+		req.Header.Set(config.StrPieceNum, "3")
+		req.Header.Set(config.StrPieceSize, strconv.Itoa(int(pieceSize)))
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	c.Check(put("rejected", "data"), check.Equals, http.StatusForbidden)
+	c.Check(put("unknown", "data"), check.Equals, http.StatusForbidden)
+	c.Check(put("stalled", strings.Repeat("x", int(pieceSize)+1)), check.Equals, http.StatusRequestEntityTooLarge)
+	c.Check(put("stalled", "data"), check.Equals, http.StatusCreated)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readAhead reads the following pieces of the task file into the page cache
+// in the background if the piece requests of the task are sequential,
+// so that the next requests from the swarm are served from memory instead of the disk.
+// The requests are regarded as sequential if each one moves forward within
+// the read-ahead window, which tolerates the interleaved requests of multiple peers.
+func (ps *peerServer) readAhead(task *taskConfig, path string, size int64, up *uploadParam) {
+	count := int64(ps.cfg.RV.ReadAheadPieces)
+	if count <= 0 {
+		return
+	}
+	last := atomic.SwapInt64(&task.lastPieceNum, up.pieceNum)
+	if diff := up.pieceNum - last; diff <= 0 || diff > count {
+		return
+	}
+
+	pieceContSize := up.pieceSize - up.padSize
+	if pieceContSize <= 0 {
+		return
+	}
+	start := up.start + up.length - up.padSize
+	end := start + count*pieceContSize
+	if end > size {
+		end = size
+	}
+
+	// skip the range which has been read ahead by the previous requests
+	for {
+		readAheadEnd := atomic.LoadInt64(&task.readAheadEnd)
+		if readAheadEnd >= end {
+			return
+		}
+		if readAheadEnd > start {
+			start = readAheadEnd
+		}
+		if atomic.CompareAndSwapInt64(&task.readAheadEnd, readAheadEnd, end) {
+			break
+		}
+	}
+	go readFileRange(path, start, end-start)
+}
+
+// readFileRange reads the range of the file and discards the data,
+// which makes the range be cached by the OS.
+func readFileRange(path string, offset, length int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		logrus.Debugf("failed to open file %s to read ahead: %v", path, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(ioutil.Discard, io.NewSectionReader(f, offset, length)); err != nil {
+		logrus.Debugf("failed to read ahead range(%d-%d) of file %s: %v", offset, offset+length-1, path, err)
+	}
+}
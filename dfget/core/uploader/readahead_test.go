@@ -0,0 +1,74 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/go-check/check"
+)
+
+func (s *PeerServerTestSuite) TestReadAhead(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	cfg.RV.ReadAheadPieces = 2
+	ps := newPeerServer(cfg, 0)
+	size := int64(1000)
+
+	var up = func(pieceNum int64) *uploadParam {
+		// the piece size includes the piece meta data
+		pieceSize := int64(100 + config.PieceMetaSize)
+		return &uploadParam{
+			padSize:   config.PieceMetaSize,
+			start:     pieceNum * 100,
+			length:    pieceSize,
+			pieceSize: pieceSize,
+			pieceNum:  pieceNum,
+		}
+	}
+
+	var cases = []struct {
+		pieceNum        int64
+		expectedAheadTo int64
+	}{
+		// not sequential
+		{pieceNum: 0, expectedAheadTo: 0},
+		// read ahead the piece 2 and 3
+		{pieceNum: 1, expectedAheadTo: 400},
+		// read ahead the piece 4 only
+		{pieceNum: 2, expectedAheadTo: 500},
+		// jump out of the window
+		{pieceNum: 5, expectedAheadTo: 500},
+		// backward
+		{pieceNum: 3, expectedAheadTo: 500},
+		// limited by the file size
+		{pieceNum: 4, expectedAheadTo: 700},
+		{pieceNum: 6, expectedAheadTo: 900},
+		{pieceNum: 8, expectedAheadTo: 1000},
+	}
+
+	task := &taskConfig{}
+	for _, v := range cases {
+		ps.readAhead(task, "not-exist", size, up(v.pieceNum))
+		c.Check(task.readAheadEnd, check.Equals, v.expectedAheadTo,
+			check.Commentf("piece:%d", v.pieceNum))
+	}
+
+	cfg.RV.ReadAheadPieces = 0
+	task = &taskConfig{}
+	ps.readAhead(task, "not-exist", size, up(1))
+	c.Check(task.readAheadEnd, check.Equals, int64(0))
+}
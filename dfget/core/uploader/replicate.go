@@ -0,0 +1,104 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// replicateTasks downloads the tasks assigned by the supernode node in the background,
+// so that their pieces are served by this peer. The tasks already served or being
+// replicated are skipped.
+func (ps *peerServer) replicateTasks(node string, tasks []*apiTypes.ReplicateTask) {
+	for _, task := range tasks {
+		if task == nil || task.TaskID == "" || task.RawURL == "" || ps.isServing(task.TaskID) {
+			continue
+		}
+		if _, loaded := ps.replicating.LoadOrStore(task.TaskID, true); loaded {
+			continue
+		}
+		go func(task *apiTypes.ReplicateTask) {
+			defer ps.replicating.Delete(task.TaskID)
+			ps.replicateLock.Lock()
+			defer ps.replicateLock.Unlock()
+
+			output := filepath.Join(ps.cfg.WorkHome, config.ReplicaDirName, task.TaskID)
+			defer os.Remove(output)
+			logrus.Infof("start replicating task %s assigned by supernode %s", task.TaskID, node)
+			if err := ps.replicate(replicateArgs(node, output, ps.cfg.WorkHome, task)); err != nil {
+				logrus.Warnf("failed to replicate task %s: %v", task.TaskID, err)
+				return
+			}
+			logrus.Infof("success to replicate task %s", task.TaskID)
+		}(task)
+	}
+}
+
+// isServing returns whether the pieces of the task are served by this peer.
+func (ps *peerServer) isServing(taskID string) (serving bool) {
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		if task, ok := value.(*taskConfig); ok && task.getTaskID() == taskID {
+			serving = true
+		}
+		return !serving
+	})
+	return serving
+}
+
+// replicateArgs returns the arguments of dfget to download the replicated task
+// from the peers only, at the low priority.
+func replicateArgs(node, output, workHome string, task *apiTypes.ReplicateTask) []string {
+	args := []string{
+		"--url", task.RawURL,
+		"--output", output,
+		"--node", node,
+		"--home", workHome,
+		"--notbs",
+		"--priority", config.PriorityLow,
+		"--callsystem", "replication",
+	}
+	if task.Md5 != "" {
+		args = append(args, "--md5", task.Md5)
+	}
+	if task.Digest != "" {
+		args = append(args, "--digest", task.Digest)
+	}
+	if task.Identifier != "" {
+		args = append(args, "--identifier", task.Identifier)
+	}
+	if len(task.Filter) > 0 {
+		args = append(args, "--filter", strings.Join(task.Filter, "&"))
+	}
+	if task.Range != "" {
+		args = append(args, "--header", config.StrRange+": "+task.Range)
+	}
+	return args
+}
+
+// runDfget runs dfget with the arguments and waits for it to exit.
+func runDfget(args []string) error {
+	cmd := exec.Command(os.Args[0], args...)
+	return cmd.Run()
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"path/filepath"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"github.com/go-check/check"
+)
+
+func (s *PeerServerTestSuite) TestReplicateTasks(c *check.C) {
+	cfg := createConfig(s.workHome, 0)
+	ps := newPeerServer(cfg, 0)
+	ps.syncTaskMap.Store("a", &taskConfig{taskID: "a", superNode: "node1"})
+
+	done := make(chan []string, 3)
+	ps.replicate = func(args []string) error {
+		done <- args
+		return nil
+	}
+	ps.replicateTasks("node1", []*apiTypes.ReplicateTask{
+		// the task already served is skipped
+		{TaskID: "a", RawURL: "http://a"},
+		{TaskID: "b", RawURL: "http://b?token=x", Md5: "md5", Filter: []string{"token", "sign"},
+			Range: "bytes=0-99"},
+		{TaskID: "c"},
+	})
+
+	select {
+	case args := <-done:
+		c.Check(args, check.DeepEquals, []string{
+			"--url", "http://b?token=x",
+			"--output", filepath.Join(cfg.WorkHome, config.ReplicaDirName, "b"),
+			"--node", "node1",
+			"--home", cfg.WorkHome,
+			"--notbs",
+			"--priority", config.PriorityLow,
+			"--callsystem", "replication",
+			"--md5", "md5",
+			"--filter", "token&sign",
+			"--header", "Range: bytes=0-99",
+		})
+	case <-time.After(5 * time.Second):
+		c.Fatal("task b isn't replicated")
+	}
+	select {
+	case args := <-done:
+		c.Fatalf("unexpected replication: %v", args)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the replicator logs after the replication, which races with the other tests
+	// setting up the logger, so wait for it to finish
+	deadline := time.Now().Add(5 * time.Second)
+	for ps.isReplicating() {
+		if time.Now().After(deadline) {
+			c.Fatal("the replication doesn't finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (ps *peerServer) isReplicating() (replicating bool) {
+	ps.replicating.Range(func(key, value interface{}) bool {
+		replicating = true
+		return false
+	})
+	return replicating
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/version"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// seedImportWorkers is the number of the task files imported concurrently,
+// most time of which is spent on registering them to the supernodes.
+var seedImportWorkers = 8
+
+// seedManifest describes the task files staged in the seed directory.
+type seedManifest struct {
+	Artifacts []*seedArtifact `json:"artifacts"`
+}
+
+// seedArtifact is a task file staged in the seed directory.
+// The fields identifying the task should be the same as the ones
+// used by dfget to download it, otherwise they are different tasks.
+type seedArtifact struct {
+	URL string `json:"url"`
+
+	// Path is the path of the file relative to the seed directory.
+	Path string `json:"path"`
+
+	// TaskURL is the url of the task whose volatile queries are filtered,
+	// it's generated from the URL with the Filter if it's empty.
+	TaskURL string `json:"taskURL,omitempty"`
+
+	Filter     []string `json:"filter,omitempty"`
+	Md5        string   `json:"md5,omitempty"`
+	Digest     string   `json:"digest,omitempty"`
+	Identifier string   `json:"identifier,omitempty"`
+	Headers    []string `json:"headers,omitempty"`
+}
+
+// loadSeedManifest reads the manifest file in the seed directory.
+func loadSeedManifest(seedDir string) (*seedManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(seedDir, config.SeedManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &seedManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the manifest of seed directory %s", seedDir)
+	}
+	return manifest, nil
+}
+
+// importSeeds registers the task files staged in the seed directory to the supernodes,
+// and reports the peer as a seeder of them, so that other peers could download them
+// from this peer without it downloading them first.
+// The task files are imported by seedImportWorkers concurrently, and the ones
+// whose piece md5s are read from their index files are served at once and
+// verified against their data afterwards.
+// It returns the number of the task files imported successfully.
+func (ps *peerServer) importSeeds() int {
+	seedDir := ps.cfg.RV.SeedDir
+	manifest, err := loadSeedManifest(seedDir)
+	if err != nil {
+		logrus.Errorf("failed to load seed manifest: %v", err)
+		return 0
+	}
+
+	var (
+		count      int32
+		lock       sync.Mutex
+		unverified []*unverifiedSeed
+		wg         sync.WaitGroup
+		jobs       = make(chan int)
+	)
+	for i := 0; i < seedImportWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				artifact := manifest.Artifacts[i]
+				seed, err := ps.importSeed(i, artifact)
+				if err != nil {
+					logrus.Errorf("failed to import seed %s from %s: %v", artifact.Path, artifact.URL, err)
+					continue
+				}
+				atomic.AddInt32(&count, 1)
+				if seed != nil {
+					lock.Lock()
+					unverified = append(unverified, seed)
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range manifest.Artifacts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	logrus.Infof("import %d/%d seeds from %s", count, len(manifest.Artifacts), seedDir)
+
+	ps.verifySeeds(unverified)
+	return int(count)
+}
+
+// importSeed imports the task file, and returns it if it's imported with
+// the piece index read from its index file.
+func (ps *peerServer) importSeed(index int, artifact *seedArtifact) (*unverifiedSeed, error) {
+	if artifact.URL == "" || artifact.Path == "" {
+		return nil, fmt.Errorf("both url and path are required")
+	}
+	if len(ps.cfg.Nodes) == 0 {
+		return nil, fmt.Errorf("no supernode is specified")
+	}
+
+	// the path is always cleaned as an absolute one to keep it in the seed directory
+	servicePath := filepath.Join(ps.cfg.RV.SeedDir, filepath.Clean("/"+artifact.Path))
+	info, err := os.Stat(servicePath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", servicePath)
+	}
+
+	taskFileName := fmt.Sprintf("%s-%s-%d", filepath.Base(servicePath), ps.cfg.Sign, index)
+	cid := ps.seedCid()
+	req := ps.newSeedRegisterRequest(taskFileName, cid, artifact)
+	node, data, err := ps.registerSeed(req)
+	if err != nil {
+		return nil, err
+	}
+	if data.CDNSource == apiTypes.CdnSourceSource {
+		ps.api.ServiceDown(node, data.TaskID, cid)
+		return nil, fmt.Errorf("supernode %s downloads the task from source directly", node)
+	}
+	if data.FileLength != info.Size() {
+		ps.api.ServiceDown(node, data.TaskID, cid)
+		return nil, fmt.Errorf("the file length is %d but the task's is %d", info.Size(), data.FileLength)
+	}
+
+	// the piece md5s are read from the index of the file unless it's changed
+	idx, built, err := loadPieceIndex(servicePath, data.PieceSize)
+	if err != nil {
+		ps.api.ServiceDown(node, data.TaskID, cid)
+		return nil, err
+	}
+
+	// the task file must be able to be served before reporting the peer as a seeder
+	task := &taskConfig{
+		taskID:      data.TaskID,
+		cid:         cid,
+		superNode:   node,
+		servicePath: servicePath,
+		rawURL:      artifact.URL,
+		taskURL:     req.TaskURL,
+		md5:         artifact.Md5,
+		identifier:  artifact.Identifier,
+		finished:    true,
+		finishTime:  time.Now(),
+		accessTime:  time.Now(),
+	}
+	if err := ps.reportSeed(taskFileName, task, idx); err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("import seed %s as task %s of supernode %s", servicePath, data.TaskID, node)
+	if built {
+		return nil, nil
+	}
+	return &unverifiedSeed{taskFileName: taskFileName, task: task, index: idx}, nil
+}
+
+// seedCid returns the CID of this peer for the seeded task files.
+func (ps *peerServer) seedCid() string {
+	return ps.cfg.RV.LocalIP + "-" + ps.cfg.Sign
+}
+
+// newSeedRegisterRequest constructs the request which registers the task file
+// of the artifact to the supernodes as a task of this peer.
+func (ps *peerServer) newSeedRegisterRequest(taskFileName, cid string, artifact *seedArtifact) *types.RegisterRequest {
+	hostname, _ := os.Hostname()
+	req := &types.RegisterRequest{
+		RawURL:     artifact.URL,
+		TaskURL:    artifact.TaskURL,
+		Cid:        cid,
+		IP:         ps.cfg.PeerIP(),
+		Addresses:  ps.cfg.PeerAddresses(),
+		Transports: api.PieceTransports(),
+		HostName:   hostname,
+		Port:       ps.port,
+		Path:       config.PeerHTTPPathPrefix + taskFileName,
+		Version:    version.DFGetVersion,
+		CallSystem: ps.cfg.CallSystem,
+		Headers:    artifact.Headers,
+	}
+	if req.TaskURL == "" {
+		req.TaskURL = netutils.FilterURLParam(artifact.URL, artifact.Filter)
+	}
+	if artifact.Md5 != "" {
+		req.Md5 = artifact.Md5
+	} else if artifact.Digest != "" {
+		req.Digest = artifact.Digest
+	} else if artifact.Identifier != "" {
+		req.Identifier = artifact.Identifier
+	}
+	return req
+}
+
+// reportSeed serves the task file and reports the peer as a seeder of the task
+// with the piece md5s of the file, and it stops serving the file if it fails.
+func (ps *peerServer) reportSeed(taskFileName string, task *taskConfig, idx *pieceIndex) error {
+	task.index = idx
+	ps.syncTaskMap.Store(taskFileName, task)
+
+	resp, err := ps.api.ReportSeed(task.superNode, &apiTypes.PeerSeedRequest{
+		TaskID:    task.taskID,
+		CID:       task.cid,
+		PieceMD5s: idx.pieceMD5s(),
+	})
+	if err == nil && resp != nil && resp.Code != constants.Success {
+		err = fmt.Errorf("%d:%s", resp.Code, resp.Msg)
+	}
+	if err != nil {
+		ps.syncTaskMap.Delete(taskFileName)
+		ps.api.ServiceDown(task.superNode, task.taskID, task.cid)
+		return errors.Wrapf(err, "failed to report seed to supernode %s", task.superNode)
+	}
+	return nil
+}
+
+// registerSeed registers the task to the supernodes in order until one succeeds.
+func (ps *peerServer) registerSeed(req *types.RegisterRequest) (string, *types.RegisterResponseData, error) {
+	var lastErr error
+	for _, node := range ps.cfg.Nodes {
+		req.SupernodeIP = netutils.ExtractHost(node)
+		resp, err := ps.api.Register(node, req)
+		if err == nil && resp != nil && resp.Code != constants.Success {
+			err = fmt.Errorf("%d:%s", resp.Code, resp.Msg)
+		}
+		if err == nil && (resp == nil || resp.Data == nil) {
+			err = fmt.Errorf("empty response")
+		}
+		if err != nil {
+			lastErr = errors.Wrapf(err, "failed to register to supernode %s", node)
+			logrus.Warn(lastErr)
+			continue
+		}
+		return node, resp.Data, nil
+	}
+	return "", nil, lastErr
+}
+
+// ComputePieceMD5s computes the md5 of every piece of the file in the same way
+// as the CDN of supernode, which is wrapped by the piece head and tail.
+func ComputePieceMD5s(path string, pieceSize int32) ([]string, error) {
+	idx, err := buildPieceIndex(path, pieceSize)
+	if err != nil {
+		return nil, err
+	}
+	return idx.pieceMD5s(), nil
+}
+
+// unverifiedSeed is a task file imported with the piece index read from its index file.
+type unverifiedSeed struct {
+	taskFileName string
+	task         *taskConfig
+	index        *pieceIndex
+}
+
+// verifySeeds verifies the data of the task files against their piece indexes
+// one by one, and stops seeding the ones which don't match, since they're changed
+// without updating their modification time or their index files are stale.
+// Their index files are rebuilt so that their real md5s are reported next time.
+func (ps *peerServer) verifySeeds(seeds []*unverifiedSeed) {
+	for _, seed := range seeds {
+		if _, ok := ps.syncTaskMap.Load(seed.taskFileName); !ok {
+			continue
+		}
+		servicePath := seed.task.servicePath
+		idx, err := buildPieceIndex(servicePath, seed.index.pieceSize)
+		if err != nil {
+			logrus.Warnf("failed to verify seed %s: %v", servicePath, err)
+			continue
+		}
+		if idx.equal(seed.index) {
+			continue
+		}
+
+		logrus.Errorf("stop seeding staged file %s of task %s: the pieces don't match its index",
+			servicePath, seed.task.taskID)
+		ps.syncTaskMap.Delete(seed.taskFileName)
+		ps.api.ServiceDown(seed.task.registration())
+		if err := writePieceIndex(servicePath, idx); err != nil {
+			logrus.Warnf("failed to write the piece index of %s: %v", servicePath, err)
+		}
+		ps.recordDiskFailure(servicePath, fmt.Errorf("the pieces don't match its index"))
+	}
+}
+
+// seedingStaged returns whether any task file staged in the seed directory is
+// being seeded, during which the peer server should not exit.
+func (ps *peerServer) seedingStaged() bool {
+	var result bool
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		if task, ok := value.(*taskConfig); ok && task.servicePath != "" {
+			result = true
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// removeStoppedSeeds stops serving the staged task files which the supernodes
+// don't need any more. The files are left in the read-only seed directory.
+func (ps *peerServer) removeStoppedSeeds() {
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		if task, ok := value.(*taskConfig); ok && task.servicePath != "" &&
+			atomic.LoadInt32(&task.stopSeeding) == 1 {
+			logrus.Infof("stop seeding staged file %s of task %s: stopped by supernode",
+				task.servicePath, task.getTaskID())
+			ps.syncTaskMap.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	apiTypes "github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&SeedTestSuite{})
+}
+
+type SeedTestSuite struct {
+	workHome string
+}
+
+func (s *SeedTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-SeedTestSuite-")
+}
+
+func (s *SeedTestSuite) TearDownTest(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+func (s *SeedTestSuite) TestComputePieceMD5s(c *check.C) {
+	path := filepath.Join(s.workHome, "file")
+	content := helper.CreateRandomString(25)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), check.IsNil)
+
+	pieceMD5s, err := ComputePieceMD5s(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Assert(pieceMD5s, check.HasLen, 3)
+	for i, expected := range []string{content[:10], content[10:20], content[20:]} {
+		sum := fmt.Sprintf("%x", md5.Sum([]byte(pieceContent(15, expected))))
+		c.Check(pieceMD5s[i], check.Equals, fmt.Sprintf("%s:%d", sum, len(expected)+config.PieceMetaSize))
+	}
+
+	_, err = ComputePieceMD5s(path, config.PieceMetaSize)
+	c.Check(err, check.NotNil)
+}
+
+func (s *SeedTestSuite) TestImportSeeds(c *check.C) {
+	seedDir := filepath.Join(s.workHome, "seed")
+	c.Assert(os.MkdirAll(filepath.Join(seedDir, "data"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(seedDir, "data", "a"), []byte("hello"), 0644), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(seedDir, "b"), []byte("world!"), 0644), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(seedDir, config.SeedManifestFile), []byte(`{"artifacts": [
+		{"url": "http://host/a?t=1", "path": "data/a", "filter": ["t"]},
+		{"url": "http://host/b", "path": "b"},
+		{"url": "http://host/c", "path": "../c"}
+	]}`), 0644), check.IsNil)
+	// the file out of the seed directory must not be served
+	c.Assert(ioutil.WriteFile(filepath.Join(s.workHome, "c"), []byte("c"), 0644), check.IsNil)
+
+	// import the seeds in order
+	defer func(n int) { seedImportWorkers = n }(seedImportWorkers)
+	seedImportWorkers = 1
+
+	cfg := helper.CreateConfig(nil, s.workHome)
+	cfg.RV.LocalIP = "127.0.0.1"
+	cfg.RV.SeedDir = seedDir
+	cfg.Nodes = []string{"node1", "node2"}
+	ps := newPeerServer(cfg, 15001)
+
+	var (
+		registered []*types.RegisterRequest
+		seeds      []*apiTypes.PeerSeedRequest
+		downs      []string
+	)
+	ps.api = &helper.MockSupernodeAPI{
+		RegisterFunc: func(node string, req *types.RegisterRequest) (*types.RegisterResponse, error) {
+			if node == "node1" {
+				return nil, fmt.Errorf("connection refused")
+			}
+			registered = append(registered, req)
+			// the supernode knows a different length of b
+			return &types.RegisterResponse{
+				BaseResponse: &types.BaseResponse{Code: constants.Success},
+				Data: &types.RegisterResponseData{
+					TaskID:     "task-" + req.TaskURL,
+					FileLength: 5,
+					PieceSize:  10,
+				},
+			}, nil
+		},
+		ReportSeedFunc: func(node string, req *apiTypes.PeerSeedRequest) (*types.BaseResponse, error) {
+			c.Check(node, check.Equals, "node2")
+			seeds = append(seeds, req)
+			return &types.BaseResponse{Code: constants.Success}, nil
+		},
+		ServiceDownFunc: func(node string, taskID string, cid string) (*types.BaseResponse, error) {
+			downs = append(downs, taskID)
+			return nil, nil
+		},
+	}
+
+	c.Check(ps.importSeeds(), check.Equals, 1)
+	c.Assert(registered, check.HasLen, 2)
+	c.Check(registered[0].TaskURL, check.Equals, "http://host/a")
+	c.Check(registered[0].Port, check.Equals, 15001)
+	c.Check(downs, check.DeepEquals, []string{"task-http://host/b"})
+
+	c.Assert(seeds, check.HasLen, 1)
+	c.Check(seeds[0].TaskID, check.Equals, "task-http://host/a")
+	c.Check(seeds[0].CID, check.Equals, "127.0.0.1-"+cfg.Sign)
+	c.Check(seeds[0].PieceMD5s, check.HasLen, 1)
+	// the piece index of the staged file is written for the next import
+	_, err := os.Stat(filepath.Join(seedDir, "data", "a"+pieceIndexSuffix))
+	c.Check(err, check.IsNil)
+	c.Check(ps.seedingStaged(), check.Equals, true)
+
+	// the staged file is served from the seed directory
+	taskFileName := registered[0].Path[len(config.PeerHTTPPathPrefix):]
+	f, size, err := ps.getTaskFile(taskFileName)
+	c.Assert(err, check.IsNil)
+	c.Check(size, check.Equals, int64(5))
+	f.Close()
+
+	// the staged file is left when the supernode stops the seeding
+	ps.api = &helper.MockSupernodeAPI{
+		HeartBeatFunc: func(node string, req *apiTypes.HeartBeatRequest) (*apiTypes.HeartBeatResponse, error) {
+			c.Check(req.TaskIds, check.DeepEquals, []string{"task-http://host/a"})
+			return &apiTypes.HeartBeatResponse{StopSeedingTaskIds: req.TaskIds}, nil
+		},
+	}
+	ps.sendHeartBeat()
+	c.Check(ps.seedingStaged(), check.Equals, false)
+	_, err = os.Stat(filepath.Join(seedDir, "data", "a"))
+	c.Check(err, check.IsNil)
+}
+
+func (s *SeedTestSuite) TestImportSeedsWithIndex(c *check.C) {
+	seedDir := filepath.Join(s.workHome, "seed")
+	c.Assert(os.MkdirAll(seedDir, 0755), check.IsNil)
+	var artifacts []string
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("f%d", i)
+		c.Assert(ioutil.WriteFile(filepath.Join(seedDir, name), []byte(helper.CreateRandomString(25)), 0644), check.IsNil)
+		artifacts = append(artifacts, fmt.Sprintf(`{"url": "http://host/%s", "path": "%s"}`, name, name))
+	}
+	c.Assert(ioutil.WriteFile(filepath.Join(seedDir, config.SeedManifestFile),
+		[]byte(`{"artifacts": [`+strings.Join(artifacts, ",")+`]}`), 0644), check.IsNil)
+
+	var (
+		lock  sync.Mutex
+		downs []string
+	)
+	newServer := func() *peerServer {
+		cfg := helper.CreateConfig(nil, s.workHome)
+		cfg.RV.LocalIP = "127.0.0.1"
+		cfg.RV.SeedDir = seedDir
+		cfg.Nodes = []string{"node"}
+		ps := newPeerServer(cfg, 15001)
+		ps.api = &helper.MockSupernodeAPI{
+			RegisterFunc: func(node string, req *types.RegisterRequest) (*types.RegisterResponse, error) {
+				return &types.RegisterResponse{
+					BaseResponse: &types.BaseResponse{Code: constants.Success},
+					Data: &types.RegisterResponseData{
+						TaskID:     "task-" + req.TaskURL,
+						FileLength: 25,
+						PieceSize:  15,
+					},
+				}, nil
+			},
+			ReportSeedFunc: func(node string, req *apiTypes.PeerSeedRequest) (*types.BaseResponse, error) {
+				return &types.BaseResponse{Code: constants.Success}, nil
+			},
+			ServiceDownFunc: func(node string, taskID string, cid string) (*types.BaseResponse, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				downs = append(downs, taskID)
+				return nil, nil
+			},
+		}
+		return ps
+	}
+
+	// the index files are written at the first import
+	c.Check(newServer().importSeeds(), check.Equals, 4)
+	c.Check(downs, check.HasLen, 0)
+
+	// change a file without changing its size and modification time
+	path := filepath.Join(seedDir, "f2")
+	info, err := os.Stat(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte(helper.CreateRandomString(25)), 0644), check.IsNil)
+	c.Assert(os.Chtimes(path, info.ModTime(), info.ModTime()), check.IsNil)
+
+	// the changed file is imported with its stale index and stopped after being verified
+	ps := newServer()
+	c.Check(ps.importSeeds(), check.Equals, 4)
+	c.Check(downs, check.DeepEquals, []string{"task-http://host/f2"})
+	var served int
+	ps.syncTaskMap.Range(func(key, value interface{}) bool {
+		served++
+		return true
+	})
+	c.Check(served, check.Equals, 3)
+
+	// the index of the changed file is rebuilt
+	idx, err := readPieceIndex(path)
+	c.Assert(err, check.IsNil)
+	expected, err := buildPieceIndex(path, 15)
+	c.Assert(err, check.IsNil)
+	c.Check(idx.equal(expected), check.Equals, true)
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// shareLink is a time-limited link of a task file, with which a client without
+// dfget downloads the file from the peer server over plain HTTP.
+type shareLink struct {
+	URL string `json:"url"`
+	// Expires is the unix time in seconds after which the link is rejected.
+	Expires int64 `json:"expires"`
+}
+
+// maxShareLinks is the max number of the share links not expired, which bounds
+// the memory taken by the nonces of them.
+const maxShareLinks = 4096
+
+// the reasons why the requests of the share links are rejected.
+const (
+	shareRejectInvalid   = "invalid-signature"
+	shareRejectExpired   = "expired"
+	shareRejectUnknown   = "unknown-nonce"
+	shareRejectTaskEnded = "task-ended"
+)
+
+// shareGrant is a share link created by the peer server, which is accepted only
+// while the task it's created for is still held by the peer server.
+type shareGrant struct {
+	taskFileName string
+	expires      int64
+	task         *taskConfig
+}
+
+// randRead fills the random secret and the nonces of the share links, which is replaced in the tests.
+var randRead = rand.Read
+
+// newShareSecret returns the key signing the share links, which is ShareSecret
+// if it's set, or a random one which invalidates the links once the peer server exits.
+// It fails if no random one can be generated, rather than signing with a known key.
+func newShareSecret(cfg *config.Config) ([]byte, error) {
+	if cfg.ShareSecret != "" {
+		return []byte(cfg.ShareSecret), nil
+	}
+	secret := make([]byte, 32)
+	if _, err := randRead(secret); err != nil {
+		return nil, errors.Wrap(err, "failed to generate the secret of the share links")
+	}
+	return secret, nil
+}
+
+// signShare returns the signature of the share link of the task file expiring at expires.
+func signShare(secret []byte, taskFileName string, expires int64, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%d\n%s", taskFileName, expires, nonce)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyShare checks the signature and the expiry of the share link of the task file,
+// and returns the reason why it's rejected, which is empty if it's valid.
+// The expiry is checked by the clock of the peer server which signs it, so no clock skew is tolerated.
+func verifyShare(secret []byte, taskFileName, expires, nonce, sig string, now time.Time) string {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || nonce == "" || !hmac.Equal([]byte(sig), []byte(signShare(secret, taskFileName, exp, nonce))) {
+		return shareRejectInvalid
+	}
+	if now.Unix() > exp {
+		return shareRejectExpired
+	}
+	return ""
+}
+
+// grantShare stores a new share link of the task which expires at expires and returns its nonce.
+// The expired links are dropped first, and it fails if there are still maxShareLinks ones.
+func (ps *peerServer) grantShare(taskFileName string, task *taskConfig, expires int64, now time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := randRead(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate the nonce of the share link")
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	ps.shareLock.Lock()
+	defer ps.shareLock.Unlock()
+	for k, g := range ps.shareLinks {
+		if now.Unix() > g.expires {
+			delete(ps.shareLinks, k)
+		}
+	}
+	if len(ps.shareLinks) >= maxShareLinks {
+		return "", fmt.Errorf("too many share links, the max is %d", maxShareLinks)
+	}
+	ps.shareLinks[nonce] = &shareGrant{taskFileName: taskFileName, expires: expires, task: task}
+	return nonce, nil
+}
+
+// checkShare checks the request of the share link of the task file, and returns the reason
+// why it's rejected, which is empty if it's accepted. Besides the signature and the expiry,
+// the nonce must be one created by the peer server for the task it holds now, so a captured
+// link can't be replayed once the task ends or the peer server restarts, even if it's signed
+// by shareSecret and not expired. The link is dropped once its task ends.
+func (ps *peerServer) checkShare(taskFileName string, q url.Values, now time.Time) string {
+	nonce := q.Get(config.StrNonce)
+	reason := verifyShare(ps.shareSecret, taskFileName, q.Get(config.StrExpires), nonce, q.Get(config.StrSignature), now)
+
+	ps.shareLock.Lock()
+	defer ps.shareLock.Unlock()
+	if reason == "" {
+		g, ok := ps.shareLinks[nonce]
+		if !ok || g.taskFileName != taskFileName {
+			reason = shareRejectUnknown
+		} else if v, ok := ps.syncTaskMap.Load(taskFileName); !ok || v.(*taskConfig) != g.task {
+			delete(ps.shareLinks, nonce)
+			reason = shareRejectTaskEnded
+		}
+	}
+	if reason != "" {
+		ps.shareRejections[reason]++
+	}
+	return reason
+}
+
+// shareRejectionCounts formats the numbers of the rejected requests of the share links by reason.
+func (ps *peerServer) shareRejectionCounts() string {
+	ps.shareLock.Lock()
+	defer ps.shareLock.Unlock()
+	items := make([]string, 0, len(ps.shareRejections))
+	for reason, n := range ps.shareRejections {
+		items = append(items, fmt.Sprintf("%s:%d", reason, n))
+	}
+	if len(items) == 0 {
+		return "none"
+	}
+	sort.Strings(items)
+	return strings.Join(items, " ")
+}
+
+// createShareHandler creates the share link of the finished task file specified by
+// the query taskFileName, which expires after the query ttl, such as 10m.
+func (ps *peerServer) createShareHandler(w http.ResponseWriter, r *http.Request) {
+	taskFileName := r.FormValue(config.StrTaskFileName)
+	ttl := config.DefaultShareLinkTTL
+	if v := r.FormValue(config.StrTTL); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > config.MaxShareLinkTTL {
+			sendHeader(w, http.StatusBadRequest)
+			fmt.Fprintf(w, "ttl must be in (0, %v]: %s", config.MaxShareLinkTTL, v)
+			return
+		}
+		ttl = d
+	}
+	task, code, err := ps.loadSharedTask(taskFileName)
+	if err != nil {
+		sendHeader(w, code)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(ttl).Unix()
+	nonce, err := ps.grantShare(taskFileName, task, expires, now)
+	if err != nil {
+		sendHeader(w, http.StatusServiceUnavailable)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	q := url.Values{}
+	q.Set(config.StrExpires, strconv.FormatInt(expires, 10))
+	q.Set(config.StrNonce, nonce)
+	q.Set(config.StrSignature, signShare(ps.shareSecret, taskFileName, expires, nonce))
+	link := &shareLink{
+		URL: fmt.Sprintf("http://%s%s%s?%s", net.JoinHostPort(ps.host, strconv.Itoa(ps.port)),
+			config.ShareHTTPPathPrefix, url.PathEscape(taskFileName), q.Encode()),
+		Expires: expires,
+	}
+	logrus.Infof("create the share link of file %s expiring at %s", taskFileName, time.Unix(expires, 0))
+
+	w.Header().Set(config.StrContentType, "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(link)
+}
+
+// shareHandler serves the task file of a share link as a plain file, which supports
+// the Range requests and the conditional requests.
+func (ps *peerServer) shareHandler(w http.ResponseWriter, r *http.Request) {
+	if ps.rejectFenced(w) {
+		return
+	}
+	taskFileName := mux.Vars(r)["commonFile"]
+	if reason := ps.checkShare(taskFileName, r.URL.Query(), time.Now()); reason != "" {
+		logrus.Debugf("reject the share link of file %s: %s", taskFileName, reason)
+		http.Error(w, "the share link is invalid or expired", http.StatusForbidden)
+		return
+	}
+	if _, code, err := ps.loadSharedTask(taskFileName); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	f, _, err := ps.getTaskFile(taskFileName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		if isDiskError(err) {
+			ps.recordDiskFailure(taskFileName, err)
+		}
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	atomic.AddInt32(&ps.uploadingCount, 1)
+	defer atomic.AddInt32(&ps.uploadingCount, -1)
+	http.ServeContent(w, r, "", fi.ModTime(), &shareReader{File: f, rl: ps.rateLimiter})
+}
+
+// loadSharedTask loads the task file which can be shared, and returns the status code
+// of the error if it can't. Only the finished task files not encrypted can be shared.
+func (ps *peerServer) loadSharedTask(taskFileName string) (*taskConfig, int, error) {
+	if taskFileName == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid params")
+	}
+	v, ok := ps.syncTaskMap.Load(taskFileName)
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("task file %s not found", taskFileName)
+	}
+	task := v.(*taskConfig)
+	task.lock.RLock()
+	finished, namespace := task.finished, task.namespace
+	task.lock.RUnlock()
+	if !finished {
+		return nil, http.StatusConflict, fmt.Errorf("download of task file %s hasn't finished", taskFileName)
+	}
+	if namespace != "" {
+		return nil, http.StatusForbidden, fmt.Errorf("task file %s is encrypted", taskFileName)
+	}
+	return task, 0, nil
+}
+
+// shareReader reads the task file of a share link limited by the rate limiter
+// of the peer server, the same as the pieces uploaded to the peers.
+type shareReader struct {
+	*os.File
+	rl *ratelimiter.RateLimiter
+}
+
+func (sr *shareReader) Read(p []byte) (int, error) {
+	n, err := sr.File.Read(p)
+	if n > 0 && sr.rl != nil {
+		sr.rl.AcquireBlocking(int64(n))
+	}
+	return n, err
+}
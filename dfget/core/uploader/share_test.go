@@ -0,0 +1,214 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&ShareTestSuite{})
+}
+
+type ShareTestSuite struct {
+	workHome string
+}
+
+func (s *ShareTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "dfget-ShareTestSuite-")
+}
+
+func (s *ShareTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+func (s *ShareTestSuite) TestVerifyShare(c *check.C) {
+	secret := []byte("secret")
+	now := time.Now()
+	expires := now.Add(time.Minute).Unix()
+	sig := signShare(secret, "foo", expires, "nonce")
+	exp := strconv.FormatInt(expires, 10)
+
+	c.Check(verifyShare(secret, "foo", exp, "nonce", sig, now), check.Equals, "")
+	c.Check(verifyShare(secret, "foo", exp, "nonce", sig, now.Add(2*time.Minute)), check.Equals, shareRejectExpired)
+	c.Check(verifyShare(secret, "bar", exp, "nonce", sig, now), check.Equals, shareRejectInvalid)
+	c.Check(verifyShare(secret, "foo", exp, "other", sig, now), check.Equals, shareRejectInvalid)
+	c.Check(verifyShare(secret, "foo", exp, "", signShare(secret, "foo", expires, ""), now), check.Equals, shareRejectInvalid)
+	c.Check(verifyShare([]byte("other"), "foo", exp, "nonce", sig, now), check.Equals, shareRejectInvalid)
+	c.Check(verifyShare(secret, "foo", strconv.FormatInt(expires+1, 10), "nonce", sig, now), check.Equals, shareRejectInvalid)
+	c.Check(verifyShare(secret, "foo", "x", "nonce", sig, now), check.Equals, shareRejectInvalid)
+}
+
+func (s *ShareTestSuite) TestShareHandler(c *check.C) {
+	srv := newTestPeerServer(s.workHome)
+	srv.cfg.ControlToken = "token"
+	helper.CreateTestFile(helper.GetServiceFile("finished", s.workHome), "hello world")
+	srv.syncTaskMap.Store("finished", &taskConfig{dataDir: s.workHome, finished: true})
+	srv.syncTaskMap.Store("running", &taskConfig{dataDir: s.workHome})
+	srv.syncTaskMap.Store("encrypted", &taskConfig{dataDir: s.workHome, finished: true, namespace: "foo"})
+	auth := map[string]string{"Authorization": "Bearer token"}
+
+	create := func(file, ttl string, headers map[string]string) (int, *shareLink) {
+		rr, err := testHandlerHelper(srv, &HandlerHelper{
+			method:  http.MethodPost,
+			url:     config.LocalHTTPPathClient + "share?taskFileName=" + file + "&ttl=" + ttl,
+			headers: headers,
+		})
+		c.Assert(err, check.IsNil)
+		link := &shareLink{}
+		if rr.Code == http.StatusOK {
+			c.Assert(json.Unmarshal(rr.Body.Bytes(), link), check.IsNil)
+		}
+		return rr.Code, link
+	}
+	var cases = []struct {
+		file string
+		ttl  string
+		code int
+	}{
+		{file: "running", code: http.StatusConflict},
+		{file: "encrypted", code: http.StatusForbidden},
+		{file: "foo", code: http.StatusNotFound},
+		{file: "finished", ttl: "48h", code: http.StatusBadRequest},
+		{file: "finished", ttl: "x", code: http.StatusBadRequest},
+	}
+	for _, v := range cases {
+		code, _ := create(v.file, v.ttl, auth)
+		c.Check(code, check.Equals, v.code, check.Commentf("%+v", v))
+	}
+	code, _ := create("finished", "", nil)
+	c.Check(code, check.Equals, http.StatusUnauthorized)
+
+	code, link := create("finished", "10m", auth)
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(link.Expires-time.Now().Unix() <= int64(10*time.Minute/time.Second), check.Equals, true)
+	u, err := url.Parse(link.URL)
+	c.Assert(err, check.IsNil)
+	c.Check(u.Path, check.Equals, config.ShareHTTPPathPrefix+"finished")
+
+	get := func(rawQuery string, headers map[string]string) (int, string) {
+		rr, err := testHandlerHelper(srv, &HandlerHelper{
+			method:  http.MethodGet,
+			url:     u.Path + "?" + rawQuery,
+			headers: headers,
+		})
+		c.Assert(err, check.IsNil)
+		return rr.Code, rr.Body.String()
+	}
+	code, body := get(u.RawQuery, nil)
+	c.Check(code, check.Equals, http.StatusOK)
+	c.Check(body, check.Equals, "hello world")
+	code, body = get(u.RawQuery, map[string]string{"Range": "bytes=6-"})
+	c.Check(code, check.Equals, http.StatusPartialContent)
+	c.Check(body, check.Equals, "world")
+
+	q := u.Query()
+	q.Set(config.StrExpires, strconv.FormatInt(link.Expires+3600, 10))
+	code, _ = get(q.Encode(), nil)
+	c.Check(code, check.Equals, http.StatusForbidden, check.Commentf("the expiry is signed"))
+
+	expired := time.Now().Add(-time.Second).Unix()
+	q.Set(config.StrExpires, strconv.FormatInt(expired, 10))
+	q.Set(config.StrSignature, signShare(srv.shareSecret, "finished", expired, q.Get(config.StrNonce)))
+	code, _ = get(q.Encode(), nil)
+	c.Check(code, check.Equals, http.StatusForbidden)
+
+	// a link signed by the secret but not created by the peer server is rejected
+	q.Set(config.StrExpires, strconv.FormatInt(link.Expires, 10))
+	q.Set(config.StrNonce, "forged")
+	q.Set(config.StrSignature, signShare(srv.shareSecret, "finished", link.Expires, "forged"))
+	code, _ = get(q.Encode(), nil)
+	c.Check(code, check.Equals, http.StatusForbidden)
+
+	// the link can't be replayed once the task ends, even if it's downloaded again
+	srv.syncTaskMap.Store("finished", &taskConfig{dataDir: s.workHome, finished: true})
+	code, _ = get(u.RawQuery, nil)
+	c.Check(code, check.Equals, http.StatusForbidden)
+	code, _ = get(u.RawQuery, nil)
+	c.Check(code, check.Equals, http.StatusForbidden)
+	c.Check(srv.shareLinks, check.HasLen, 0)
+
+	c.Check(srv.shareRejectionCounts(), check.Equals, "expired:1 invalid-signature:1 task-ended:1 unknown-nonce:2")
+	buf := &bytes.Buffer{}
+	srv.writeStatus(buf)
+	c.Check(strings.Contains(buf.String(), "share links rejected: expired:1"), check.Equals, true)
+}
+
+func (s *ShareTestSuite) TestGrantShare(c *check.C) {
+	srv := newTestPeerServer(s.workHome)
+	task := &taskConfig{dataDir: s.workHome, finished: true}
+	now := time.Now()
+
+	expired, err := srv.grantShare("foo", task, now.Unix()-1, now)
+	c.Assert(err, check.IsNil)
+	for i := 1; i < maxShareLinks; i++ {
+		_, err := srv.grantShare("foo", task, now.Unix()+60, now)
+		c.Assert(err, check.IsNil)
+	}
+	// the expired one is dropped to make room
+	_, err = srv.grantShare("foo", task, now.Unix()+60, now)
+	c.Check(err, check.IsNil)
+	c.Check(srv.shareLinks[expired], check.IsNil)
+	_, err = srv.grantShare("foo", task, now.Unix()+60, now)
+	c.Check(err, check.NotNil)
+}
+
+func (s *ShareTestSuite) TestShareDisabledWithoutSecret(c *check.C) {
+	defer func(read func([]byte) (int, error)) { randRead = read }(randRead)
+	randRead = func(b []byte) (int, error) { return 0, fmt.Errorf("no entropy") }
+
+	cfg := &config.Config{}
+	_, err := newShareSecret(cfg)
+	c.Check(err, check.NotNil)
+	cfg.ShareSecret = "secret"
+	secret, err := newShareSecret(cfg)
+	c.Check(err, check.IsNil)
+	c.Check(string(secret), check.Equals, "secret")
+
+	// the share links are never signed with a known key
+	srv := newTestPeerServer(s.workHome)
+	c.Check(srv.shareSecret, check.IsNil)
+	helper.CreateTestFile(helper.GetServiceFile("finished", s.workHome), "hello world")
+	srv.syncTaskMap.Store("finished", &taskConfig{dataDir: s.workHome, finished: true})
+	expires := time.Now().Add(time.Minute).Unix()
+	q := url.Values{}
+	q.Set(config.StrExpires, strconv.FormatInt(expires, 10))
+	q.Set(config.StrNonce, "nonce")
+	q.Set(config.StrSignature, signShare(make([]byte, 32), "finished", expires, "nonce"))
+	for _, hh := range []*HandlerHelper{
+		{method: http.MethodPost, url: config.LocalHTTPPathClient + "share?taskFileName=finished"},
+		{method: http.MethodGet, url: config.ShareHTTPPathPrefix + "finished?" + q.Encode()},
+	} {
+		rr, err := testHandlerHelper(srv, hh)
+		c.Assert(err, check.IsNil)
+		c.Check(rr.Code, check.Equals, http.StatusNotFound, check.Commentf("%s %s", hh.method, hh.url))
+	}
+}
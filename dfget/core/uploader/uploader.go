@@ -25,6 +25,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -32,6 +33,8 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/pkg/diagnostics"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/queue"
 
@@ -47,8 +50,13 @@ var (
 )
 
 var (
-	aliveQueue  = queue.NewQueue(0)
-	uploaderAPI = api.NewUploaderAPI(httputils.DefaultTimeout)
+	aliveQueue = queue.NewQueue(0)
+
+	// localAPI sends the requests to the local peer server,
+	// on the unix domain socket localSocket if it's set.
+	localAPI     = api.NewUploaderAPI(httputils.DefaultTimeout)
+	localSocket  string
+	localAPILock sync.RWMutex
 )
 
 // -----------------------------------------------------------------------------
@@ -61,6 +69,15 @@ func WaitForShutdown() {
 	}
 }
 
+// PeerServerAddr returns the address of the peer server launched in the process,
+// or an empty string if it isn't running.
+func PeerServerAddr() string {
+	if !isRunning() {
+		return ""
+	}
+	return p2p.Addr
+}
+
 // LaunchPeerServer launches a server to send piece data.
 func LaunchPeerServer(cfg *config.Config) (int, error) {
 	// avoid data race caused by reading and writing variable 'p2p'
@@ -70,9 +87,14 @@ func LaunchPeerServer(cfg *config.Config) (int, error) {
 	logrus.Infof("********************")
 	logrus.Infof("start peer server...")
 
+	ciphers, err := helper.LoadCacheCiphers(cfg.CacheKeys)
+	if err != nil {
+		return 0, err
+	}
+
 	res := make(chan error)
 	go func() {
-		res <- launch(cfg, &p2pPtr)
+		res <- launch(cfg, ciphers, &p2pPtr)
 	}()
 
 	if err := waitForStartup(res, &p2pPtr); err != nil {
@@ -81,43 +103,50 @@ func LaunchPeerServer(cfg *config.Config) (int, error) {
 	}
 
 	p2p = loadSrvPtr(&p2pPtr)
+	if last := getPortFromMeta(cfg.RV.MetaPath); last > 0 && last != p2p.port {
+		logrus.Warnf("peer server port changes from %d to %d, "+
+			"the firewall rules for the port should be updated", last, p2p.port)
+	}
 	updateServicePortInMeta(cfg.RV.MetaPath, p2p.port)
+	updateServiceIPInMeta(cfg.RV.MetaPath, p2p.host)
 	logrus.Infof("start peer server success, host:%s, port:%d",
 		p2p.host, p2p.port)
-	go monitorAlive(cfg, 15*time.Second)
+	if _, err := diagnostics.Serve("uploader", cfg.RV.AdminPort); err != nil {
+		logrus.Warnf("failed to start diagnostics server: %v", err)
+	}
+	diagnostics.RegisterStatus("uploader", p2p.writeStatus)
+	diagnostics.WatchStatusSignals("uploader")
+	go monitorAlive(p2p, cfg, 15*time.Second)
+	if path := config.GetUploaderSocket(cfg.RV.MetaPath); path != "" && isRunning() {
+		if err := p2p.serveLocal(path); err != nil {
+			logrus.Warnf("failed to serve local requests on %s, they're served on the port only: %v", path, err)
+		}
+	}
+	if cfg.RV.SeedDir != "" && isRunning() {
+		go p2p.importSeeds()
+	}
 	return p2p.port, nil
 }
 
-func launch(cfg *config.Config, p2pPtr *unsafe.Pointer) error {
-	var (
-		retryCount         = 10
-		port               = 0
-		shouldGeneratePort = true
-	)
-	if cfg.RV.PeerPort > 0 {
-		retryCount = 1
-		port = cfg.RV.PeerPort
-		shouldGeneratePort = false
-	}
-	for i := 0; i < retryCount; i++ {
-		if shouldGeneratePort {
-			port = generatePort(i)
-		}
+func launch(cfg *config.Config, ciphers map[string]*helper.CacheCipher, p2pPtr *unsafe.Pointer) error {
+	ports := candidatePorts(cfg)
+	for i, port := range ports {
 		tmp := newPeerServer(cfg, port)
+		tmp.ciphers = ciphers
 		storeSrvPtr(p2pPtr, tmp)
 		if err := tmp.ListenAndServe(); err != nil {
 			if !strings.Contains(err.Error(), "address already in use") {
 				// start failed or shutdown
 				return err
-			} else if uploaderAPI.PingServer(tmp.host, tmp.port) {
+			} else if uploaderAPI().PingServer(tmp.host, tmp.port) {
 				// a peer server is already existing
 				return nil
 			}
 			logrus.Warnf("start error:%v, remain retry times:%d",
-				err, retryCount-i)
+				err, len(ports)-i-1)
 		}
 	}
-	return fmt.Errorf("start peer server error and retried at most %d times", retryCount)
+	return fmt.Errorf("start peer server error and retried at most %d times", len(ports))
 }
 
 // waitForStartup It's a goal to start 'dfget server' process and make it working
@@ -142,7 +171,7 @@ func waitForStartup(result chan error, p2pPtr *unsafe.Pointer) (err error) {
 		select {
 		case <-ticker.C:
 			tmp := loadSrvPtr(p2pPtr)
-			if tmp != nil && uploaderAPI.PingServer(tmp.host, tmp.port) {
+			if tmp != nil && uploaderAPI().PingServer(tmp.host, tmp.port) {
 				return nil
 			}
 		case err = <-result:
@@ -160,7 +189,7 @@ func waitForStartup(result chan error, p2pPtr *unsafe.Pointer) (err error) {
 			if tmp == nil {
 				return fmt.Errorf("initialize peer server error")
 			}
-			if !uploaderAPI.PingServer(tmp.host, tmp.port) {
+			if !uploaderAPI().PingServer(tmp.host, tmp.port) {
 				return fmt.Errorf("can't ping port:%d", tmp.port)
 			}
 			return nil
@@ -168,54 +197,64 @@ func waitForStartup(result chan error, p2pPtr *unsafe.Pointer) (err error) {
 	}
 }
 
-func serverGC(cfg *config.Config, interval time.Duration) {
+// serverGC removes the expired files served by srv until it's finished. The server is
+// passed in rather than read from p2p, which is replaced by the peer server launched later.
+func serverGC(srv *peerServer, cfg *config.Config, interval time.Duration) {
 	logrus.Info("start server gc, expireTime:", cfg.RV.DataExpireTime)
 
-	var walkFn filepath.WalkFunc = func(path string, info os.FileInfo, err error) error {
-		if path == cfg.RV.SystemDataDir || info == nil || err != nil {
+	dataDirs := []string{cfg.RV.SystemDataDir}
+	for _, dir := range cfg.DataDirs {
+		dataDirs = append(dataDirs, dir.Path)
+	}
+	var walkFn = func(root string) filepath.WalkFunc {
+		return func(path string, info os.FileInfo, err error) error {
+			if path == root || info == nil || err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				os.RemoveAll(path)
+				return filepath.SkipDir
+			}
+			if srv.deleteExpiredFile(path, info, cfg.RV.DataExpireTime) {
+				logrus.Info("server gc, delete file:", path)
+			}
 			return nil
 		}
-		if info.IsDir() {
-			os.RemoveAll(path)
-			return filepath.SkipDir
-		}
-		if p2p != nil && p2p.deleteExpiredFile(path, info, cfg.RV.DataExpireTime) {
-			logrus.Info("server gc, delete file:", path)
-		}
-		return nil
 	}
 
 	for {
-		if !isRunning() {
+		if srv.isFinished() {
 			return
 		}
-		if err := filepath.Walk(cfg.RV.SystemDataDir, walkFn); err != nil {
-			logrus.Warnf("server gc error:%v", err)
+		for _, dir := range dataDirs {
+			if err := filepath.Walk(dir, walkFn(dir)); err != nil {
+				logrus.Warnf("server gc error:%v", err)
+			}
 		}
 		time.Sleep(interval)
 	}
 }
 
-func captureQuitSignal() {
+func captureQuitSignal(srv *peerServer) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 	s := <-c
 	logrus.Infof("capture stop signal: %s, will shutdown...", s)
 
-	if p2p != nil {
-		p2p.shutdown()
-	}
+	srv.shutdown()
 }
 
-func monitorAlive(cfg *config.Config, interval time.Duration) {
-	if !isRunning() {
+// monitorAlive shuts srv down once no task is downloaded within ServerAliveTime.
+func monitorAlive(srv *peerServer, cfg *config.Config, interval time.Duration) {
+	if srv == nil || srv.isFinished() {
 		return
 	}
 
 	logrus.Info("monitor peer server whether is alive, aliveTime:",
 		cfg.RV.ServerAliveTime)
-	go serverGC(cfg, interval)
-	go captureQuitSignal()
+	go serverGC(srv, cfg, interval)
+	go captureQuitSignal(srv)
+	go srv.heartbeat(config.HeartBeatInterval)
 
 	if cfg.RV.ServerAliveTime <= 0 {
 		return
@@ -226,10 +265,13 @@ func monitorAlive(cfg *config.Config, interval time.Duration) {
 			if aliveQueue.Len() > 0 {
 				continue
 			}
-			if p2p != nil {
-				logrus.Info("no more task, peer server will stop...")
-				p2p.shutdown()
+			// keep alive to seed the files within the minimum seed time
+			// and the files staged in the seed directory
+			if srv.inMinSeedTime() || srv.seedingStaged() {
+				continue
 			}
+			logrus.Info("no more task, peer server will stop...")
+			srv.shutdown()
 			return
 		}
 	}
@@ -236,7 +236,7 @@ func (s *UploaderTestSuite) TestServerGC(c *check.C) {
 		p2p.setFinished()
 	})
 
-	serverGC(cfg, time.Second)
+	serverGC(p2p, cfg, time.Second)
 	p2p = nil
 }
 
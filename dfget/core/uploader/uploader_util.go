@@ -22,33 +22,57 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/version"
 )
 
-// FinishTask reports a finished task to peer server.
-func FinishTask(ip string, port int, taskFileName, cid, taskID, node string) error {
-	req := &api.FinishTaskRequest{
-		TaskFileName: taskFileName,
-		TaskID:       taskID,
-		ClientID:     cid,
-		Node:         node,
+const (
+	// defaultPortRetryCount is the number of the generated ports to try
+	// if the PeerPortRange is not set.
+	defaultPortRetryCount = 10
+
+	// maxPortRetryCount is the max number of the ports in the PeerPortRange to try.
+	maxPortRetryCount = 100
+)
+
+// uploaderAPI returns the api.UploaderAPI which sends the requests to the local peer server.
+func uploaderAPI() api.UploaderAPI {
+	localAPILock.RLock()
+	defer localAPILock.RUnlock()
+	return localAPI
+}
+
+// useUploaderSocket sends the local requests to the peer server on the unix domain socket path,
+// and they're sent to the port of the peer server if the socket isn't served.
+func useUploaderSocket(path string) {
+	localAPILock.Lock()
+	defer localAPILock.Unlock()
+	if path != localSocket {
+		localSocket = path
+		localAPI = api.NewUploaderAPIWithSocket(httputils.DefaultTimeout, path)
 	}
+}
 
-	return uploaderAPI.FinishTask(ip, port, req)
+// FinishTask reports a finished task to peer server.
+func FinishTask(ip string, port int, req *api.FinishTaskRequest) error {
+	return uploaderAPI().FinishTask(ip, port, req)
 }
 
 // checkServer checks if the server is available.
-func checkServer(ip string, port int, dataDir, taskFileName string, totalLimit int) (string, error) {
+func checkServer(ip string, port int, dataDir, taskFileName string, totalLimit int, namespace string,
+	acceptPush bool) (string, error) {
 
 	// prepare the request body
 	req := &api.CheckServerRequest{
 		TaskFileName: taskFileName,
 		TotalLimit:   totalLimit,
 		DataDir:      dataDir,
+		Namespace:    namespace,
+		AcceptPush:   acceptPush,
 	}
 
 	// send the request
-	result, err := uploaderAPI.CheckServer(ip, port, req)
+	result, err := uploaderAPI().CheckServer(ip, port, req)
 	if err != nil {
 		return "", err
 	}
@@ -67,6 +91,51 @@ func generatePort(inc int) int {
 	return int(time.Now().Unix()/300)%(upperLimit-lowerLimit) + lowerLimit + inc
 }
 
+// candidatePorts returns the ports which the peer server tries to listen on in order.
+// The port specified by user is the only candidate if it's set. Otherwise the port
+// selected last time and persisted in the meta file is preferred, followed by the
+// ports generated in the PeerPortRange or the default range.
+func candidatePorts(cfg *config.Config) []int {
+	if cfg.RV.PeerPort > 0 {
+		return []int{cfg.RV.PeerPort}
+	}
+
+	var (
+		portRange = cfg.PeerPortRange
+		ports     []int
+		last      = getPortFromMeta(cfg.RV.MetaPath)
+	)
+	if last > 0 && (portRange.IsEmpty() || portRange.Contains(last)) {
+		ports = append(ports, last)
+	}
+
+	if portRange.IsEmpty() {
+		for i := 0; i < defaultPortRetryCount; i++ {
+			if port := generatePort(i); port != last {
+				ports = append(ports, port)
+			}
+		}
+		return ports
+	}
+
+	count := portRange.Size()
+	if count > maxPortRetryCount {
+		count = maxPortRetryCount
+	}
+	for i := 0; i < count; i++ {
+		if port := generatePortInRange(portRange, i); port != last {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// generatePortInRange generates the port in the range in the same way as generatePort,
+// and the ports wrap around within the range.
+func generatePortInRange(portRange config.PortRange, inc int) int {
+	return (int(time.Now().Unix()/300)+inc)%portRange.Size() + portRange.Lower
+}
+
 func getPortFromMeta(metaPath string) int {
 	meta := config.NewMetaData(metaPath)
 	if err := meta.Load(); err != nil {
@@ -75,6 +144,23 @@ func getPortFromMeta(metaPath string) int {
 	return meta.ServicePort
 }
 
+func getServiceIPFromMeta(metaPath string) string {
+	meta := config.NewMetaData(metaPath)
+	if err := meta.Load(); err != nil {
+		return ""
+	}
+	return meta.ServiceIP
+}
+
+func updateServiceIPInMeta(metaPath string, ip string) {
+	meta := config.NewMetaData(metaPath)
+	meta.Load()
+	if meta.ServiceIP != ip {
+		meta.ServiceIP = ip
+		meta.Persist()
+	}
+}
+
 func updateServicePortInMeta(metaPath string, port int) {
 	meta := config.NewMetaData(metaPath)
 	meta.Load()
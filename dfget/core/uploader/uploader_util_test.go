@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
 	"github.com/dragonflyoss/Dragonfly/version"
 
 	"github.com/go-check/check"
@@ -59,22 +60,22 @@ func (s *UploaderUtilTestSuite) TearDownSuite(c *check.C) {
 // tests
 
 func (s *UploaderUtilTestSuite) TestFinishTask(c *check.C) {
-	e := FinishTask(s.ip, s.port, "a", "", "", "")
+	e := FinishTask(s.ip, s.port, &api.FinishTaskRequest{TaskFileName: "a"})
 	c.Assert(e, check.IsNil)
 
-	e = FinishTask(s.ip, s.port, "b", "", "", "")
+	e = FinishTask(s.ip, s.port, &api.FinishTaskRequest{TaskFileName: "b"})
 	c.Assert(e, check.NotNil)
 	c.Assert(e.Error(), check.Equals, "400:bad request")
 }
 
 func (s *UploaderUtilTestSuite) TestCheckServer(c *check.C) {
 	// normal test
-	result, err := checkServer(s.ip, s.port, s.workHome, commonFile, 0)
+	result, err := checkServer(s.ip, s.port, s.workHome, commonFile, 0, "", false)
 	c.Check(err, check.IsNil)
 	c.Check(result, check.Equals, commonFile)
 
 	// error url test
-	result, err = checkServer(s.ip+"1", s.port, s.workHome, commonFile, 0)
+	result, err = checkServer(s.ip+"1", s.port, s.workHome, commonFile, 0, "", false)
 	c.Check(err, check.NotNil)
 	c.Check(result, check.Equals, "")
 }
@@ -85,6 +86,45 @@ func (s *UploaderUtilTestSuite) TestGeneratePort(c *check.C) {
 	c.Assert(port <= config.ServerPortUpperLimit, check.Equals, true)
 }
 
+func (s *UploaderUtilTestSuite) TestCandidatePorts(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.RV.MetaPath = filepath.Join(s.workHome, "candidate.meta")
+
+	// the port specified by user is the only candidate
+	cfg.RV.PeerPort = 8080
+	c.Check(candidatePorts(cfg), check.DeepEquals, []int{8080})
+	cfg.RV.PeerPort = 0
+
+	ports := candidatePorts(cfg)
+	c.Assert(ports, check.HasLen, defaultPortRetryCount)
+	c.Check(ports[0], check.Equals, generatePort(0))
+
+	cfg.PeerPortRange = config.PortRange{Lower: 16000, Upper: 16004}
+	ports = candidatePorts(cfg)
+	c.Assert(ports, check.HasLen, 5)
+	seen := make(map[int]bool)
+	for _, port := range ports {
+		c.Check(cfg.PeerPortRange.Contains(port), check.Equals, true)
+		seen[port] = true
+	}
+	c.Check(seen, check.HasLen, 5)
+
+	// the port selected last time is preferred
+	updateServicePortInMeta(cfg.RV.MetaPath, 16003)
+	ports = candidatePorts(cfg)
+	c.Assert(ports, check.HasLen, 5)
+	c.Check(ports[0], check.Equals, 16003)
+
+	// the port out of the range is ignored
+	updateServicePortInMeta(cfg.RV.MetaPath, 8080)
+	ports = candidatePorts(cfg)
+	c.Assert(ports, check.HasLen, 5)
+	c.Check(cfg.PeerPortRange.Contains(ports[0]), check.Equals, true)
+
+	cfg.PeerPortRange = config.PortRange{Lower: 16000, Upper: 26000}
+	c.Check(candidatePorts(cfg), check.HasLen, maxPortRetryCount)
+}
+
 func (s *UploaderUtilTestSuite) TestGetPort(c *check.C) {
 	metaPath := filepath.Join(s.workHome, "meta")
 	port := getPortFromMeta(metaPath)
@@ -0,0 +1,227 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/regist"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/uploader"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/printer"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// pieceMD5sRetryInterval is the interval of getting the piece md5s
+// when the CDN of the task has not finished.
+var pieceMD5sRetryInterval = time.Second
+
+// pieceGroupSize is the number of the consecutive pieces in a group
+// whose SHA-1 is compared before fetching the md5s of its pieces,
+// so only the md5s of the differing groups are transferred for the large files.
+var pieceGroupSize = 256
+
+// byteRange is a closed interval of bytes in the file.
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+func (r *byteRange) String() string {
+	return fmt.Sprintf("%d-%d", r.start, r.end)
+}
+
+// verifyFile verifies the existing target against the md5 of all pieces of the task
+// computed by supernode, and reports the byte ranges which differ.
+// The data of the task is never downloaded.
+func verifyFile(cfg *config.Config, supernodeAPI api.SupernodeAPI, register regist.SupernodeRegister) error {
+	if !cfg.RV.BlockDevice {
+		os.Remove(cfg.RV.TempTarget)
+	}
+	if !fileutils.IsRegularFile(cfg.Output) {
+		return fmt.Errorf("target %s is not a regular file", cfg.Output)
+	}
+
+	// the peer server is not launched since nothing will be uploaded
+	result, e := register.Register(0)
+	if e != nil {
+		return e
+	}
+	defer supernodeAPI.ServiceDown(result.Node, result.TaskID, cfg.RV.Cid)
+
+	manifest, err := getPieceMD5s(supernodeAPI, result.Node, result.TaskID, calculateTimeout(cfg))
+	if err != nil {
+		return err
+	}
+
+	local, err := uploader.ComputePieceMD5s(cfg.Output, manifest.PieceSize)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute the piece md5s of %s", cfg.Output)
+	}
+	expected, err := expectedPieceMD5s(supernodeAPI, result.Node, manifest, local)
+	if err != nil {
+		return err
+	}
+	diffs := diffPieces(expected, local, manifest.PieceSize)
+	if len(diffs) == 0 {
+		printer.Printf("target %s matches the task %s", cfg.Output, result.TaskID)
+		return nil
+	}
+
+	var ranges []string
+	for _, r := range diffs {
+		printer.Printf("differ: bytes %s", r)
+		ranges = append(ranges, r.String())
+	}
+	logrus.Warnf("target %s differs from the task %s in bytes: %s",
+		cfg.Output, result.TaskID, strings.Join(ranges, ","))
+	return fmt.Errorf("%d byte ranges of target %s differ from the task %s",
+		len(diffs), cfg.Output, result.TaskID)
+}
+
+// getPieceMD5s gets the piece groups of the task until its CDN finishes or timeout.
+func getPieceMD5s(supernodeAPI api.SupernodeAPI, node, taskID string, timeout time.Duration) (*types.TaskPieceMD5s, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		manifest, err := supernodeAPI.GetPieceMD5s(node, taskID, 0, 0, pieceGroupSize)
+		if err == nil && manifest != nil && manifest.PieceSize > 0 {
+			return manifest, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("invalid piece md5s: %+v", manifest)
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Wrapf(err, "failed to get the piece md5s of task %s from %s", taskID, node)
+		}
+		logrus.Debugf("failed to get the piece md5s of task %s, retry later: %v", taskID, err)
+		time.Sleep(pieceMD5sRetryInterval)
+	}
+}
+
+// expectedPieceMD5s assembles the piece md5s of all pieces of the task.
+// The md5s of the groups which match the local pieces are taken from the local ones,
+// and the others are fetched from supernode group by group.
+func expectedPieceMD5s(supernodeAPI api.SupernodeAPI, node string, manifest *types.TaskPieceMD5s, local []string) ([]string, error) {
+	// the supernode which doesn't support piece groups returns all piece md5s
+	groupSize := int(manifest.GroupSize)
+	if groupSize <= 0 {
+		return manifest.PieceMD5s, nil
+	}
+
+	var (
+		total       = int(manifest.PieceTotal)
+		expected    = make([]string, 0, total)
+		localGroups = digest.GroupSha1(local, groupSize)
+	)
+	for i, group := range manifest.PieceGroups {
+		start := i * groupSize
+		end := start + groupSize
+		if end > total {
+			end = total
+		}
+		if i < len(localGroups) && localGroups[i] == group && end <= len(local) {
+			expected = append(expected, local[start:end]...)
+			continue
+		}
+
+		page, err := supernodeAPI.GetPieceMD5s(node, manifest.TaskID, start, end-start, 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the piece md5s of task %s from %d", manifest.TaskID, start)
+		}
+		if len(page.PieceMD5s) != end-start {
+			return nil, fmt.Errorf("invalid piece md5s of task %s from %d: expected %d, got %d",
+				manifest.TaskID, start, end-start, len(page.PieceMD5s))
+		}
+		expected = append(expected, page.PieceMD5s...)
+	}
+	if len(expected) != total {
+		return nil, fmt.Errorf("invalid piece groups of task %s: expected %d pieces, got %d",
+			manifest.TaskID, total, len(expected))
+	}
+	return expected, nil
+}
+
+// diffPieces compares the local piece md5s with the expected ones, and returns
+// the merged byte ranges of the pieces which differ or are missing in the local file.
+// The extra bytes at the end of the local file are also reported.
+func diffPieces(expected, local []string, pieceSize int32) []*byteRange {
+	var (
+		diffs         []*byteRange
+		pieceContSize = int64(pieceSize - config.PieceMetaSize)
+		offset        int64
+	)
+	add := func(start, length int64) {
+		if length <= 0 {
+			return
+		}
+		if n := len(diffs); n > 0 && diffs[n-1].end+1 == start {
+			diffs[n-1].end = start + length - 1
+			return
+		}
+		diffs = append(diffs, &byteRange{start: start, end: start + length - 1})
+	}
+
+	for i := 0; i < len(expected) || i < len(local); i++ {
+		var length int64
+		switch {
+		case i >= len(local):
+			length = pieceContentLength(expected[i], pieceContSize)
+			add(offset, length)
+		case i >= len(expected):
+			length = pieceContentLength(local[i], pieceContSize)
+			add(offset, length)
+		default:
+			length = pieceContentLength(expected[i], pieceContSize)
+			if expected[i] != local[i] {
+				// the local piece may be longer if it's the last one
+				add(offset, max(length, pieceContentLength(local[i], pieceContSize)))
+			}
+		}
+		offset += length
+	}
+	return diffs
+}
+
+// pieceContentLength parses the length of data in the piece md5 formatted as "md5:pieceLength".
+func pieceContentLength(pieceMD5 string, defaultLength int64) int64 {
+	kv := strings.SplitN(pieceMD5, ":", 2)
+	if len(kv) != 2 {
+		return defaultLength
+	}
+	length, err := strconv.ParseInt(kv[1], 10, 64)
+	if err != nil || length < config.PieceMetaSize {
+		return defaultLength
+	}
+	return length - config.PieceMetaSize
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -39,9 +39,9 @@ var mutex sync.Mutex
 // in the config file is empty.
 var DefaultBuilder Builder = func(cfg *config.Config) SupernodeLocator {
 	if cfg == nil || len(cfg.Nodes) == 0 {
-		return NewStaticLocator(GroupDefaultName, config.GetDefaultSupernodesValue())
+		return NewWeightedLocator(GroupDefaultName, config.GetDefaultSupernodesValue())
 	}
-	locator, _ := NewStaticLocatorFromStr(GroupConfigName, cfg.Nodes)
+	locator, _ := NewWeightedLocatorFromStr(GroupConfigName, cfg.Nodes)
 	return locator
 }
 
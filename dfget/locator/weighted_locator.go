@@ -0,0 +1,311 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package locator
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+)
+
+const (
+	// MetricsKeyHealthy is the key of the metrics reported to WeightedLocator
+	// which tells whether the supernode is healthy, its value should be a bool.
+	MetricsKeyHealthy = "healthy"
+
+	// MetricsKeyTaskID is the key of the metrics reported to WeightedLocator
+	// which binds the task to the supernode, its value should be a string.
+	MetricsKeyTaskID = "taskID"
+
+	// DefaultUnhealthyDuration is the duration during which an unhealthy supernode
+	// is chosen only after all the healthy ones have been tried.
+	DefaultUnhealthyDuration = 30 * time.Second
+)
+
+var _ SupernodeLocator = &WeightedLocator{}
+
+// WeightedLocator uses the nodes passed from configuration or CLI, and chooses
+// them randomly according to their weights. The supernodes reported unhealthy
+// are chosen after the healthy ones, and the supernode a task is registered to
+// is selected by the taskID, so that the requests of the task are always sent
+// to the supernode which schedules it.
+type WeightedLocator struct {
+	Group *SupernodeGroup
+
+	// UnhealthyDuration is how long a supernode stays unhealthy after it's reported,
+	// DefaultUnhealthyDuration is used if it's not positive.
+	UnhealthyDuration time.Duration
+
+	mutex     sync.Mutex
+	current   *Supernode
+	tried     map[*Supernode]bool
+	unhealthy map[string]time.Time
+	sticky    map[string]*Supernode
+}
+
+// ----------------------------------------------------------------------------
+// constructors
+
+// NewWeightedLocator constructs WeightedLocator which uses the nodes passed from
+// configuration or CLI.
+func NewWeightedLocator(groupName string, nodes []*config.NodeWeight) *WeightedLocator {
+	locator := &WeightedLocator{
+		tried:     make(map[*Supernode]bool),
+		unhealthy: make(map[string]time.Time),
+		sticky:    make(map[string]*Supernode),
+	}
+	if len(nodes) == 0 {
+		return locator
+	}
+	group := &SupernodeGroup{
+		Name: groupName,
+	}
+	exists := make(map[string]*Supernode)
+	for _, node := range nodes {
+		ip, port := netutils.GetIPAndPortFromNode(node.Node, config.DefaultSupernodePort)
+		if ip == "" {
+			continue
+		}
+		weight := node.Weight
+		if weight <= 0 {
+			weight = config.DefaultSupernodeWeight
+		}
+		supernode := &Supernode{
+			Schema:    config.DefaultSupernodeSchema,
+			IP:        ip,
+			Port:      port,
+			Weight:    weight,
+			GroupName: groupName,
+		}
+		// the weights of the duplicated nodes are accumulated
+		if n, ok := exists[supernode.String()]; ok {
+			n.Weight += weight
+			continue
+		}
+		exists[supernode.String()] = supernode
+		group.Nodes = append(group.Nodes, supernode)
+	}
+	if len(group.Nodes) > 0 {
+		locator.Group = group
+	}
+	return locator
+}
+
+// NewWeightedLocatorFromStr constructs WeightedLocator from string list.
+// The format of nodes is: ip:port=weight
+func NewWeightedLocatorFromStr(groupName string, nodes []string) (*WeightedLocator, error) {
+	nodeWeight, err := config.ParseNodesSlice(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return NewWeightedLocator(groupName, nodeWeight), nil
+}
+
+// ----------------------------------------------------------------------------
+// implement api methods
+
+// Get returns the current selected supernode, it should be idempotent.
+// It should return nil before first calling the Next method.
+func (w *WeightedLocator) Get() *Supernode {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.current
+}
+
+// Next chooses the next supernode which hasn't been tried since the last
+// refreshing, randomly according to the weights. The healthy supernodes
+// are chosen before the unhealthy ones, and nil is returned after all the
+// supernodes have been tried.
+func (w *WeightedLocator) Next() *Supernode {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.Group == nil {
+		return nil
+	}
+
+	var healthy, unhealthy []*Supernode
+	now := time.Now()
+	for _, n := range w.Group.Nodes {
+		if w.tried[n] {
+			continue
+		}
+		if until, ok := w.unhealthy[n.String()]; ok && now.Before(until) {
+			unhealthy = append(unhealthy, n)
+		} else {
+			healthy = append(healthy, n)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = unhealthy
+	}
+
+	w.current = chooseByWeight(candidates)
+	if w.current != nil {
+		w.tried[w.current] = true
+	}
+	return w.current
+}
+
+// Select returns the supernode which the task with the giving taskID has been
+// registered to, and nil if the key isn't a taskID reported before.
+// It doesn't affect the result of method 'Get()'.
+func (w *WeightedLocator) Select(key interface{}) *Supernode {
+	taskID, ok := key.(string)
+	if !ok {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.sticky[taskID]
+}
+
+// GetGroup returns the group with the giving name.
+func (w *WeightedLocator) GetGroup(name string) *SupernodeGroup {
+	if w.Group == nil || w.Group.Name != name {
+		return nil
+	}
+	return w.Group
+}
+
+// All returns all the supernodes.
+func (w *WeightedLocator) All() []*SupernodeGroup {
+	if w.Group == nil {
+		return nil
+	}
+	return []*SupernodeGroup{w.Group}
+}
+
+// Size returns the number of all supernodes.
+func (w *WeightedLocator) Size() int {
+	if w.Group == nil {
+		return 0
+	}
+	return len(w.Group.Nodes)
+}
+
+// Report records the health of the supernode by MetricsKeyHealthy, and binds
+// the task to the supernode by MetricsKeyTaskID.
+func (w *WeightedLocator) Report(node string, metrics *SupernodeMetrics) {
+	if metrics == nil || w.Group == nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var supernode *Supernode
+	for _, n := range w.Group.Nodes {
+		if n.String() == node {
+			supernode = n
+			break
+		}
+	}
+	if supernode == nil {
+		return
+	}
+
+	if healthy, ok := metrics.Metrics[MetricsKeyHealthy].(bool); ok {
+		if healthy {
+			delete(w.unhealthy, node)
+		} else {
+			w.unhealthy[node] = time.Now().Add(w.unhealthyDuration())
+		}
+	}
+	if taskID, ok := metrics.Metrics[MetricsKeyTaskID].(string); ok && taskID != "" {
+		w.sticky[taskID] = supernode
+	}
+}
+
+// Refresh makes all the supernodes available to be chosen again by Next.
+// The health of the supernodes and the bound tasks are kept.
+func (w *WeightedLocator) Refresh() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.current = nil
+	w.tried = make(map[*Supernode]bool)
+	return true
+}
+
+func (w *WeightedLocator) String() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.Group == nil || len(w.tried) >= len(w.Group.Nodes) {
+		return "empty"
+	}
+
+	var nodes []string
+	for _, n := range w.Group.Nodes {
+		if !w.tried[n] {
+			nodes = append(nodes, fmt.Sprintf("%s:%d=%d", n.IP, n.Port, n.Weight))
+		}
+	}
+	return w.Group.Name + ":" + fmt.Sprintf("%v", nodes)
+}
+
+// ----------------------------------------------------------------------------
+// private methods of WeightedLocator
+
+func (w *WeightedLocator) unhealthyDuration() time.Duration {
+	if w.UnhealthyDuration > 0 {
+		return w.UnhealthyDuration
+	}
+	return DefaultUnhealthyDuration
+}
+
+// ----------------------------------------------------------------------------
+// helper functions
+
+// ReportHealth reports the health of the supernode to the locator.
+func ReportHealth(locator SupernodeLocator, node string, healthy bool) {
+	if locator == nil {
+		return
+	}
+	locator.Report(node, &SupernodeMetrics{
+		Metrics: map[string]interface{}{MetricsKeyHealthy: healthy},
+	})
+}
+
+// ReportTask reports the healthy supernode which the task is registered to.
+func ReportTask(locator SupernodeLocator, node string, taskID string) {
+	if locator == nil {
+		return
+	}
+	locator.Report(node, &SupernodeMetrics{
+		Metrics: map[string]interface{}{MetricsKeyHealthy: true, MetricsKeyTaskID: taskID},
+	})
+}
+
+func chooseByWeight(nodes []*Supernode) *Supernode {
+	total := 0
+	for _, n := range nodes {
+		total += n.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	r := rand.Intn(total)
+	for _, n := range nodes {
+		if r -= n.Weight; r < 0 {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package locator
+
+import (
+	"time"
+
+	"github.com/go-check/check"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/config"
+)
+
+type WeightedLocatorTestSuite struct {
+}
+
+func init() {
+	check.Suite(&WeightedLocatorTestSuite{})
+}
+
+func (s *WeightedLocatorTestSuite) Test_NewWeightedLocator(c *check.C) {
+	l := NewWeightedLocator(testGroupName, nil)
+	c.Assert(l, check.NotNil)
+	c.Assert(l.Group, check.IsNil)
+	c.Assert(l.Next(), check.IsNil)
+	c.Assert(l.String(), check.Equals, "empty")
+
+	l = NewWeightedLocator(testGroupName, []*config.NodeWeight{
+		{Node: "a:80", Weight: 1},
+		{Node: "a:81", Weight: 2},
+		{Node: "a:80", Weight: 3},
+	})
+	c.Assert(l.Group, check.DeepEquals, &SupernodeGroup{
+		Name: testGroupName,
+		Nodes: []*Supernode{
+			create("a", 80, 4),
+			create("a", 81, 2),
+		},
+	})
+	c.Assert(l.Size(), check.Equals, 2)
+	c.Assert(l.String(), check.Equals, "test-group:[a:80=4 a:81=2]")
+
+	_, err := NewWeightedLocatorFromStr(testGroupName, []string{":80=1"})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *WeightedLocatorTestSuite) Test_Next(c *check.C) {
+	l, _ := NewWeightedLocatorFromStr(testGroupName, []string{"a:80=1", "a:81=2", "a:82=3"})
+	c.Assert(l.Get(), check.IsNil)
+
+	// every node is chosen once
+	chosen := make(map[string]bool)
+	for i := 0; i < l.Size(); i++ {
+		n := l.Next()
+		c.Assert(n, check.NotNil)
+		c.Assert(l.Get(), check.Equals, n)
+		chosen[n.String()] = true
+	}
+	c.Assert(chosen, check.HasLen, 3)
+	c.Assert(l.Next(), check.IsNil)
+	c.Assert(l.Get(), check.IsNil)
+
+	c.Assert(l.Refresh(), check.Equals, true)
+	c.Assert(l.Get(), check.IsNil)
+	c.Assert(l.Next(), check.NotNil)
+
+	// the nodes are chosen according to their weights
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		l.Refresh()
+		counts[l.Next().String()]++
+	}
+	c.Assert(counts["a:80"] < counts["a:81"], check.Equals, true)
+	c.Assert(counts["a:81"] < counts["a:82"], check.Equals, true)
+}
+
+func (s *WeightedLocatorTestSuite) Test_Failover(c *check.C) {
+	l, _ := NewWeightedLocatorFromStr(testGroupName, []string{"a:80=1", "a:81=100"})
+
+	ReportHealth(l, "a:81", false)
+	ReportHealth(l, "b:80", false)
+	c.Assert(l.Next().String(), check.Equals, "a:80")
+	// the unhealthy node is chosen after all the healthy ones have been tried
+	c.Assert(l.Next().String(), check.Equals, "a:81")
+	c.Assert(l.Next(), check.IsNil)
+
+	ReportHealth(l, "a:81", true)
+	l.Refresh()
+	ReportHealth(l, "a:80", false)
+	c.Assert(l.Next().String(), check.Equals, "a:81")
+
+	// the node recovers after the unhealthy duration
+	l.UnhealthyDuration = time.Millisecond
+	l.Refresh()
+	ReportHealth(l, "a:81", false)
+	time.Sleep(5 * time.Millisecond)
+	ReportHealth(l, "a:80", false)
+	c.Assert(l.Next().String(), check.Equals, "a:81")
+}
+
+func (s *WeightedLocatorTestSuite) Test_Select(c *check.C) {
+	l, _ := NewWeightedLocatorFromStr(testGroupName, []string{"a:80=1", "a:81=1"})
+	c.Assert(l.Select("task"), check.IsNil)
+	c.Assert(l.Select(1), check.IsNil)
+
+	ReportHealth(l, "a:81", false)
+	ReportTask(l, "a:81", "task")
+	l.Report("a:80", nil)
+	c.Assert(l.Select("task"), check.DeepEquals, create("a", 81, 1))
+	c.Assert(l.Get(), check.IsNil)
+
+	// reporting the task makes the node healthy again
+	ReportHealth(l, "a:80", false)
+	c.Assert(l.Next().String(), check.Equals, "a:81")
+	c.Assert(l.Select("task"), check.DeepEquals, create("a", 81, 1))
+}
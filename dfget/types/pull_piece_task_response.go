@@ -71,6 +71,10 @@ func (res *PullPieceTaskResponse) ContinueData() []*PullPieceTaskResponseContinu
 type PullPieceTaskResponseFinishData struct {
 	Md5        string `json:"md5"`
 	FileLength int64  `json:"fileLength"`
+
+	// Sha256 is the sha256 digest of the file calculated by supernode CDN
+	// when it's fetched from the source, which is used to verify the downloaded file.
+	Sha256 string `json:"sha256,omitempty"`
 }
 
 func (data *PullPieceTaskResponseFinishData) String() string {
@@ -81,15 +85,25 @@ func (data *PullPieceTaskResponseFinishData) String() string {
 // PullPieceTaskResponseContinueData is the data when successfully pulling piece task
 // and the task is continuing.
 type PullPieceTaskResponseContinueData struct {
-	Range     string `json:"range"`
-	PieceNum  int    `json:"pieceNum"`
-	PieceSize int32  `json:"pieceSize"`
-	PieceMd5  string `json:"pieceMd5"`
-	Cid       string `json:"cid"`
-	PeerIP    string `json:"peerIp"`
-	PeerPort  int    `json:"peerPort"`
-	Path      string `json:"path"`
-	DownLink  int    `json:"downLink"`
+	Range     string   `json:"range"`
+	PieceNum  int      `json:"pieceNum"`
+	PieceSize int32    `json:"pieceSize"`
+	PieceMd5  string   `json:"pieceMd5"`
+	Cid       string   `json:"cid"`
+	PeerIP    string   `json:"peerIp"`
+	PeerAddrs []string `json:"peerAddrs,omitempty"`
+	PeerPort  int      `json:"peerPort"`
+	// PeerTransports are the names of the piece transports served by the uploader
+	// of the peer, by which the transport to fetch the piece with is chosen.
+	PeerTransports []string `json:"peerTransports,omitempty"`
+	Path           string   `json:"path"`
+	DownLink       int      `json:"downLink"`
+	// BoostLink is the download rate limit in KB/s of the bandwidth boost granted to the task
+	// by supernode, which raises the local limits until the boost expires.
+	BoostLink int `json:"boostLink,omitempty"`
+	// EdgeURLs are the URLs of the file in the external edge caches,
+	// from which the piece is fetched by a ranged request before the peer.
+	EdgeURLs []string `json:"edgeURLs,omitempty"`
 }
 
 func (data *PullPieceTaskResponseContinueData) String() string {
@@ -18,6 +18,8 @@ package types
 
 import (
 	"encoding/json"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 )
 
 // RegisterRequest contains all the parameters that need to be passed to the
@@ -28,13 +30,18 @@ type RegisterRequest struct {
 	TaskURL     string   `json:"taskUrl"`
 	Cid         string   `json:"cid"`
 	IP          string   `json:"ip"`
+	Addresses   []string `json:"addresses,omitempty"`
+	Transports  []string `json:"transports,omitempty"`
+	AcceptPush  bool     `json:"acceptPush,omitempty"`
 	HostName    string   `json:"hostName"`
 	Port        int      `json:"port"`
 	Path        string   `json:"path"`
 	Version     string   `json:"version,omitempty"`
 	Md5         string   `json:"md5,omitempty"`
+	Digest      string   `json:"digest,omitempty"`
 	Identifier  string   `json:"identifier,omitempty"`
 	CallSystem  string   `json:"callSystem,omitempty"`
+	ClientTime  int64    `json:"clientTime,omitempty"`
 	Headers     []string `json:"headers,omitempty"`
 	Dfdaemon    bool     `json:"dfdaemon,omitempty"`
 	Insecure    bool     `json:"insecure,omitempty"`
@@ -42,10 +49,24 @@ type RegisterRequest struct {
 	TaskID      string   `json:"taskId,omitempty"`
 	FileLength  int64    `json:"fileLength,omitempty"`
 	AsSeed      bool     `json:"asSeed,omitempty"`
+	Filter      []string `json:"filter,omitempty"`
+	PieceSize   int32    `json:"pieceSize,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+
+	Group         string `json:"group,omitempty"`
+	GroupDeadline int64  `json:"groupDeadline,omitempty"`
+
+	RangeOffset int64 `json:"rangeOffset,omitempty"`
+	RangeLength int64 `json:"rangeLength,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
+// String returns the request in JSON, in which the values of the sensitive headers are redacted.
 func (r *RegisterRequest) String() string {
-	if b, e := json.Marshal(r); e == nil {
+	req := *r
+	req.Headers = httputils.RedactHeaderLines(r.Headers)
+	if b, e := json.Marshal(&req); e == nil {
 		return string(b)
 	}
 	return ""
@@ -47,4 +47,11 @@ type RegisterResponseData struct {
 
 	// in seed pattern, if as seed, SeedTaskID is the taskID of seed file.
 	SeedTaskID string `json:"seedTaskID"`
+
+	// ServerTime is the unix time in milliseconds of supernode when responding.
+	ServerTime int64 `json:"serverTime,omitempty"`
+
+	// ResponseHeaders are the headers of the response of the source kept with the task,
+	// which are replayed by dfdaemon on the responses served from the P2P network.
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
 }
@@ -0,0 +1,196 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package accesslog implements an HTTP middleware shared by the HTTP servers
+// of supernode, dfget uploader and dfdaemon, which writes the sampled access logs.
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConfigPath is the path of the handler to get and update the sample rate at runtime.
+const ConfigPath = "/debug/accesslog"
+
+// IdentifyFunc returns the identity of the peer and the task ID of the request.
+type IdentifyFunc func(r *http.Request) (peer, taskID string)
+
+// Logger writes the access logs of the requests which are sampled by the sample rate.
+// The requests failed with a server error are always logged unless it's disabled.
+type Logger struct {
+	component string
+	identify  IdentifyFunc
+	logger    *logrus.Logger
+
+	// sampleRate is the bits of a float64 in [0, 1], it must be accessed atomically.
+	sampleRate uint64
+}
+
+// New creates a Logger for the component with the sample rate.
+// The sample rate is in [0, 1] and 0 means that the access log is disabled.
+// The identify is used to get the peer and the task of a request,
+// and DefaultIdentify is used if it's nil.
+func New(component string, sampleRate float64, identify IdentifyFunc) *Logger {
+	if identify == nil {
+		identify = DefaultIdentify
+	}
+	l := &Logger{
+		component: component,
+		identify:  identify,
+		logger:    logrus.StandardLogger(),
+	}
+	l.SetSampleRate(sampleRate)
+	return l
+}
+
+// SampleRate returns the current sample rate.
+func (l *Logger) SampleRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&l.sampleRate))
+}
+
+// SetSampleRate updates the sample rate, which is limited in [0, 1].
+func (l *Logger) SetSampleRate(rate float64) {
+	if rate < 0 || math.IsNaN(rate) {
+		rate = 0
+	} else if rate > 1 {
+		rate = 1
+	}
+	atomic.StoreUint64(&l.sampleRate, math.Float64bits(rate))
+}
+
+// Handler wraps the next handler to write the access logs.
+func (l *Logger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate := l.SampleRate()
+		if rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		if rw.status < http.StatusInternalServerError && rand.Float64() >= rate {
+			return
+		}
+		peer, taskID := l.identify(r)
+		l.logger.WithFields(logrus.Fields{
+			"component": l.component,
+			"method":    r.Method,
+			"uri":       r.URL.RequestURI(),
+			"remote":    r.RemoteAddr,
+			"peer":      peer,
+			"task":      taskID,
+			"status":    rw.status,
+			"reqBytes":  r.ContentLength,
+			"respBytes": rw.size,
+			"latency":   time.Since(start).Seconds(),
+		}).Info("access")
+	})
+}
+
+// ConfigHandler returns a handler to get the sample rate by GET
+// and update it by PUT with the query parameter sampleRate.
+func (l *Logger) ConfigHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			rate, err := strconv.ParseFloat(r.URL.Query().Get("sampleRate"), 64)
+			if err != nil || rate < 0 || rate > 1 {
+				http.Error(w, fmt.Sprintf("invalid sampleRate: %s, it must be in [0, 1]",
+					r.URL.Query().Get("sampleRate")), http.StatusBadRequest)
+				return
+			}
+			l.SetSampleRate(rate)
+			logrus.Infof("update the sample rate of access log to %v", rate)
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]float64{"sampleRate": l.SampleRate()})
+	}
+}
+
+// DefaultIdentify gets the peer and the task ID from the query parameters
+// used by the APIs of supernode.
+func DefaultIdentify(r *http.Request) (peer, taskID string) {
+	query := r.URL.Query()
+	for _, k := range []string{"cid", "peerID", "srcCid"} {
+		if peer = query.Get(k); peer != "" {
+			break
+		}
+	}
+	for _, k := range []string{"taskId", "taskID"} {
+		if taskID = query.Get(k); taskID != "" {
+			break
+		}
+	}
+	return peer, taskID
+}
+
+// responseWriter records the status code and the size of the response.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Flush implements the http.Flusher interface.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface, which is required by the https proxy of dfdaemon.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer doesn't support hijacking")
+	}
+	return h.Hijack()
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-check/check"
+	"github.com/sirupsen/logrus"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type AccessLogTestSuite struct{}
+
+func init() {
+	check.Suite(&AccessLogTestSuite{})
+}
+
+func newTestLogger(rate float64) (*Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := New("test", rate, nil)
+	l.logger = &logrus.Logger{
+		Out:       buf,
+		Formatter: &logrus.JSONFormatter{},
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.InfoLevel,
+	}
+	return l, buf
+}
+
+func (s *AccessLogTestSuite) TestHandler(c *check.C) {
+	l, buf := newTestLogger(0)
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte("hello"))
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// disabled
+	c.Check(serve("/fail").Code, check.Equals, http.StatusInternalServerError)
+	c.Check(buf.Len(), check.Equals, 0)
+
+	// the server errors are always logged
+	l.SetSampleRate(0.000001)
+	serve("/fail")
+	c.Check(strings.Count(buf.String(), "\n"), check.Equals, 1)
+	c.Check(strings.Contains(buf.String(), `"status":500`), check.Equals, true)
+
+	buf.Reset()
+	l.SetSampleRate(1)
+	w := serve("/ok?cid=foo&taskId=bar")
+	c.Check(w.Body.String(), check.Equals, "hello")
+	out := buf.String()
+	c.Check(strings.Contains(out, `"status":200`), check.Equals, true)
+	c.Check(strings.Contains(out, `"respBytes":5`), check.Equals, true)
+	c.Check(strings.Contains(out, `"peer":"foo"`), check.Equals, true)
+	c.Check(strings.Contains(out, `"task":"bar"`), check.Equals, true)
+	c.Check(strings.Contains(out, `"component":"test"`), check.Equals, true)
+}
+
+func (s *AccessLogTestSuite) TestSetSampleRate(c *check.C) {
+	l, _ := newTestLogger(2)
+	c.Check(l.SampleRate(), check.Equals, 1.0)
+	l.SetSampleRate(-1)
+	c.Check(l.SampleRate(), check.Equals, 0.0)
+	l.SetSampleRate(0.5)
+	c.Check(l.SampleRate(), check.Equals, 0.5)
+}
+
+func (s *AccessLogTestSuite) TestConfigHandler(c *check.C) {
+	l, _ := newTestLogger(0.1)
+	h := l.ConfigHandler()
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, ConfigPath)
+	c.Check(w.Code, check.Equals, http.StatusOK)
+	c.Check(strings.TrimSpace(w.Body.String()), check.Equals, `{"sampleRate":0.1}`)
+
+	w = serve(http.MethodPut, ConfigPath+"?sampleRate=0.5")
+	c.Check(w.Code, check.Equals, http.StatusOK)
+	c.Check(l.SampleRate(), check.Equals, 0.5)
+
+	for _, v := range []string{"", "x", "1.5", "-1"} {
+		w = serve(http.MethodPut, ConfigPath+"?sampleRate="+v)
+		c.Check(w.Code, check.Equals, http.StatusBadRequest)
+	}
+	c.Check(l.SampleRate(), check.Equals, 0.5)
+
+	c.Check(serve(http.MethodPost, ConfigPath).Code, check.Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *AccessLogTestSuite) TestDefaultIdentify(c *check.C) {
+	peer, taskID := DefaultIdentify(httptest.NewRequest(http.MethodGet, "/peer/piece/suc?srcCid=a&dstCid=b&taskID=t", nil))
+	c.Check(peer, check.Equals, "a")
+	c.Check(taskID, check.Equals, "t")
+
+	peer, taskID = DefaultIdentify(httptest.NewRequest(http.MethodGet, "/", nil))
+	c.Check(peer, check.Equals, "")
+	c.Check(taskID, check.Equals, "")
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cgroup places the processes under the cgroups v2 created with the limits
+// of the CPU, the memory and the I/O, which isolates the heavy downloads from the
+// latency-sensitive workloads on the same host.
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuPeriod is the period in microseconds of the CPU quota written to cpu.max.
+const cpuPeriod = 100000
+
+// Limits are the limits of the resources of a cgroup, and the zero values mean unlimited.
+type Limits struct {
+	// CPU is the max number of the CPU cores used, such as 0.5.
+	CPU float64
+
+	// CPUWeight is the relative share of the CPU time in [1, 10000] when the CPU is contended.
+	CPUWeight int
+
+	// Memory is the max number of the bytes of the memory used, including the page cache
+	// of the files written.
+	Memory int64
+
+	// IOWeight is the relative share of the I/O in [1, 10000] when the disks are contended.
+	IOWeight int
+
+	// IOReadBPS and IOWriteBPS are the max bytes per second read from and written to
+	// the block devices of the paths in IODevices.
+	IOReadBPS  int64
+	IOWriteBPS int64
+	IODevices  []string
+}
+
+// controllers returns the controllers which are required to apply the limits.
+func (l *Limits) controllers() []string {
+	var result []string
+	if l.CPU > 0 || l.CPUWeight > 0 {
+		result = append(result, "cpu")
+	}
+	if l.IOWeight > 0 || l.IOReadBPS > 0 || l.IOWriteBPS > 0 {
+		result = append(result, "io")
+	}
+	if l.Memory > 0 {
+		result = append(result, "memory")
+	}
+	return result
+}
+
+// files returns the contents of the interface files of the cgroup which apply the limits,
+// devices are the numbers of the block devices in the form of major:minor.
+func (l *Limits) files(devices []string) map[string]string {
+	files := make(map[string]string)
+	if l.CPU > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(l.CPU*cpuPeriod), cpuPeriod)
+	}
+	if l.CPUWeight > 0 {
+		files["cpu.weight"] = strconv.Itoa(l.CPUWeight)
+	}
+	if l.Memory > 0 {
+		files["memory.max"] = strconv.FormatInt(l.Memory, 10)
+	}
+	if l.IOWeight > 0 {
+		files["io.weight"] = "default " + strconv.Itoa(l.IOWeight)
+	}
+	if (l.IOReadBPS > 0 || l.IOWriteBPS > 0) && len(devices) > 0 {
+		var lines []string
+		for _, dev := range devices {
+			line := dev
+			if l.IOReadBPS > 0 {
+				line += " rbps=" + strconv.FormatInt(l.IOReadBPS, 10)
+			}
+			if l.IOWriteBPS > 0 {
+				line += " wbps=" + strconv.FormatInt(l.IOWriteBPS, 10)
+			}
+			lines = append(lines, line)
+		}
+		// the kernel accepts one device per write
+		files["io.max"] = strings.Join(lines, "\n")
+	}
+	return files
+}
+
+// Group is a cgroup created for the downloads of a process.
+type Group struct {
+	// Path is the directory of the cgroup in the cgroup file system.
+	Path string
+
+	// origin is the directory of the cgroup which the process is in before it joins the group.
+	origin string
+}
+
+func writeFile(dir, name, content string) error {
+	for _, line := range strings.Split(content, "\n") {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(line), 0644); err != nil {
+			return fmt.Errorf("failed to write %q to %s: %v", line, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cgroup
+
+import (
+	"syscall"
+)
+
+// Create creates the cgroup name under the parent with the limits.
+// It's not supported on darwin.
+func Create(parent, name string, limits *Limits) (*Group, error) {
+	return nil, syscall.ENOTSUP
+}
+
+// Join moves the current process into the group.
+func (g *Group) Join() error {
+	return syscall.ENOTSUP
+}
+
+// Release moves the process pid started after joining back to the cgroup of the current
+// process before it joined.
+func (g *Group) Release(pid int) error {
+	return nil
+}
+
+// Remove removes the group.
+func (g *Group) Remove() error {
+	return nil
+}
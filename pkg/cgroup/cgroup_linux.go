@@ -0,0 +1,197 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cgroup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cgroup2SuperMagic is the magic number of the cgroup v2 file system.
+const cgroup2SuperMagic = 0x63677270
+
+// Create creates the cgroup name under the parent with the limits. The parent is created
+// if it doesn't exist, and the controllers required by the limits are enabled in it.
+// The parent must be in a cgroup v2 file system, and it mustn't contain processes.
+func Create(parent, name string, limits *Limits) (*Group, error) {
+	if !isCgroup2(existingAncestor(parent)) {
+		return nil, fmt.Errorf("%s isn't in a cgroup v2 file system", parent)
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	if err := enableControllers(parent, limits.controllers()); err != nil {
+		return nil, err
+	}
+
+	g := &Group{Path: filepath.Join(parent, name)}
+	if err := os.Mkdir(g.Path, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	for file, content := range limits.files(blockDevices(limits.IODevices)) {
+		if err := writeFile(g.Path, file, content); err != nil {
+			os.Remove(g.Path)
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Join moves the current process into the group, and the processes started by it
+// later are in the group as well unless they're released.
+func (g *Group) Join() error {
+	origin, err := currentCgroup(g.Path)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(g.Path, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return err
+	}
+	g.origin = origin
+	return nil
+}
+
+// Release moves the process pid started after joining back to the cgroup of the current
+// process before it joined, such as a daemon which outlives the group.
+func (g *Group) Release(pid int) error {
+	if g.origin == "" {
+		return nil
+	}
+	return writeFile(g.origin, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// Remove moves the current process back if it has joined the group, and removes the group.
+// It fails if there are still other processes in the group.
+func (g *Group) Remove() error {
+	if err := g.Release(os.Getpid()); err != nil {
+		return err
+	}
+	g.origin = ""
+	return os.Remove(g.Path)
+}
+
+func isCgroup2(path string) bool {
+	var fs syscall.Statfs_t
+	return syscall.Statfs(path, &fs) == nil && int64(fs.Type) == cgroup2SuperMagic
+}
+
+// existingAncestor returns the path or the nearest ancestor of it which exists.
+func existingAncestor(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			return path
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// mountPoint returns the mount point of the cgroup v2 file system which the path is in.
+func mountPoint(path string) string {
+	path = filepath.Clean(path)
+	for filepath.Dir(path) != path && isCgroup2(filepath.Dir(path)) {
+		path = filepath.Dir(path)
+	}
+	return path
+}
+
+// currentCgroup returns the directory of the cgroup of the current process
+// in the cgroup v2 file system which the path is in.
+func currentCgroup(path string) (string, error) {
+	b, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		// the line of the cgroup v2 hierarchy is 0::/path
+		if line := scanner.Text(); strings.HasPrefix(line, "0::") {
+			return filepath.Join(mountPoint(path), strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+	return "", fmt.Errorf("the process isn't in a cgroup v2 hierarchy")
+}
+
+// enableControllers enables the controllers for the children of the cgroup dir.
+func enableControllers(dir string, controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return err
+	}
+	enabled := strings.Fields(string(b))
+	var missing []string
+	for _, c := range controllers {
+		if !contains(enabled, c) {
+			missing = append(missing, "+"+c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return writeFile(dir, "cgroup.subtree_control", strings.Join(missing, " "))
+}
+
+// blockDevices returns the numbers of the disks which the paths are on in the form of
+// major:minor. The limits of the I/O are only applied to the whole disks rather than
+// the partitions, and the paths which aren't on any block device, such as the ones
+// on tmpfs and overlayfs, are ignored.
+func blockDevices(paths []string) []string {
+	var result []string
+	for _, path := range paths {
+		var st syscall.Stat_t
+		if err := syscall.Stat(existingAncestor(path), &st); err != nil {
+			continue
+		}
+		dev := uint64(st.Dev)
+		major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+		minor := dev&0xff | (dev>>12)&^0xff
+		if major == 0 {
+			continue
+		}
+		number := fmt.Sprintf("%d:%d", major, minor)
+		if sys, err := filepath.EvalSymlinks(filepath.Join("/sys/dev/block", number)); err == nil {
+			if _, err := os.Stat(filepath.Join(sys, "partition")); err == nil {
+				if b, err := ioutil.ReadFile(filepath.Join(filepath.Dir(sys), "dev")); err == nil {
+					number = strings.TrimSpace(string(b))
+				}
+			}
+		}
+		if !contains(result, number) {
+			result = append(result, number)
+		}
+	}
+	return result
+}
+
+func contains(values []string, v string) bool {
+	for _, e := range values {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
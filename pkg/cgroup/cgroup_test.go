@@ -0,0 +1,88 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type CgroupSuite struct{}
+
+func init() {
+	check.Suite(&CgroupSuite{})
+}
+
+func (s *CgroupSuite) TestFiles(c *check.C) {
+	limits := &Limits{}
+	c.Check(limits.controllers(), check.HasLen, 0)
+	c.Check(limits.files(nil), check.HasLen, 0)
+
+	limits = &Limits{
+		CPU:        1.5,
+		CPUWeight:  50,
+		Memory:     512 << 20,
+		IOWeight:   10,
+		IOReadBPS:  100 << 20,
+		IOWriteBPS: 50 << 20,
+	}
+	c.Check(limits.controllers(), check.DeepEquals, []string{"cpu", "io", "memory"})
+	c.Check(limits.files([]string{"8:0", "259:0"}), check.DeepEquals, map[string]string{
+		"cpu.max":    "150000 100000",
+		"cpu.weight": "50",
+		"memory.max": "536870912",
+		"io.weight":  "default 10",
+		"io.max":     "8:0 rbps=104857600 wbps=52428800\n259:0 rbps=104857600 wbps=52428800",
+	})
+
+	// io.max isn't written without the devices
+	_, ok := limits.files(nil)["io.max"]
+	c.Check(ok, check.Equals, false)
+}
+
+func (s *CgroupSuite) TestCreate(c *check.C) {
+	tmpDir, err := ioutil.TempDir("", "cgroup-TestCreate-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(tmpDir)
+
+	// a cgroup can't be created outside the cgroup v2 file systems
+	_, err = Create(filepath.Join(tmpDir, "dragonfly"), "dfget", &Limits{CPU: 1})
+	c.Check(err, check.NotNil)
+	_, err = os.Stat(filepath.Join(tmpDir, "dragonfly"))
+	c.Check(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *CgroupSuite) TestWriteFile(c *check.C) {
+	tmpDir, err := ioutil.TempDir("", "cgroup-TestWriteFile-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(tmpDir)
+
+	c.Assert(writeFile(tmpDir, "io.max", "8:0 rbps=1\n259:0 rbps=1"), check.IsNil)
+	b, err := ioutil.ReadFile(filepath.Join(tmpDir, "io.max"))
+	c.Assert(err, check.IsNil)
+	// every device is written separately, so only the last one remains in a regular file
+	c.Check(string(b), check.Equals, "259:0 rbps=1")
+	c.Check(writeFile(filepath.Join(tmpDir, "notexist"), "cpu.max", "max"), check.NotNil)
+}
@@ -26,8 +26,10 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-// NewConfigCommand returns cobra.Command for "<component> config" command
-func NewConfigCommand(componentName string, defaultComponentConfigFunc func() (interface{}, error)) *cobra.Command {
+// NewConfigCommand returns cobra.Command for "<component> config" command.
+// The "validate" subcommand is added if validateComponentConfigFunc isn't nil.
+func NewConfigCommand(componentName string, defaultComponentConfigFunc func() (interface{}, error),
+	validateComponentConfigFunc func(path string) error) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "config",
 		Short: fmt.Sprintf("Manage the configurations of %s", componentName),
@@ -35,6 +37,9 @@ func NewConfigCommand(componentName string, defaultComponentConfigFunc func() (i
 	}
 
 	cmd.AddCommand(newConfigPrintDefaultCommand(componentName, defaultComponentConfigFunc))
+	if validateComponentConfigFunc != nil {
+		cmd.AddCommand(newConfigValidateCommand(componentName, validateComponentConfigFunc))
+	}
 	return cmd
 }
 
@@ -65,3 +70,29 @@ func runConfigPrintDefault(defaultComponentConfigFunc func() (interface{}, error
 	printer.Print(string(d))
 	return nil
 }
+
+// newConfigValidateCommand returns cobra.Command for "<component> config validate" command
+func newConfigValidateCommand(componentName string, validateComponentConfigFunc func(path string) error) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate <config file>",
+		Short: fmt.Sprintf("Validate the config file of %s", componentName),
+		Long: fmt.Sprintf("Validate the config file of %s without starting it. "+
+			"The fields unknown to %s, the values out of range and the conflicting values are all reported as errors.",
+			componentName, componentName),
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigValidate(args[0], validateComponentConfigFunc)
+		},
+	}
+	return cmd
+}
+
+func runConfigValidate(path string, validateComponentConfigFunc func(path string) error) error {
+	if err := validateComponentConfigFunc(path); err != nil {
+		return errors.Wrapf(err, "invalid config file %s", path)
+	}
+	printer.Printf("%s is valid", path)
+	return nil
+}
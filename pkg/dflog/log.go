@@ -19,6 +19,7 @@ package dflog
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -35,10 +36,23 @@ type LogConfig struct {
 	// MaxBackups is the maximum number of old log files to retain.
 	// The default value is 1.
 	MaxBackups int `yaml:"maxBackups" json:"maxBackups"`
+	// MaxAge is the maximum number of days to retain the old log files,
+	// and they are not removed due to age if it's 0.
+	MaxAge int `yaml:"maxAge" json:"maxAge"`
+	// Compress determines whether the rotated log files are compressed with gzip.
+	Compress bool `yaml:"compress" json:"compress"`
 
 	// Path is the location of log file
 	// The default value is logs/dfdaemon.log
 	Path string `yaml:"path" json:"path"`
+
+	// Target is where the logs are written, must be file/syslog/journald.
+	// The rotation of the log file is ignored if it's not file.
+	// The default value is file.
+	Target string `yaml:"target" json:"target"`
+	// ShipURL is the HTTP endpoint of a GELF input, such as http://graylog:12201/gelf,
+	// to which the logs are also shipped besides the target. It's disabled if empty.
+	ShipURL string `yaml:"shipURL" json:"shipURL"`
 }
 
 // DefaultLogTimeFormat defines the timestamp format.
@@ -111,6 +125,101 @@ func WithMaxSizeMB(max uint) Option {
 	}
 }
 
+// WithMaxAge sets the maximum number of days to retain the old log files.
+// If the logger is not configured to use a log file, an error is returned.
+func WithMaxAge(days uint) Option {
+	return func(l *logrus.Logger) error {
+		if logger := getLumberjack(l); logger != nil {
+			logger.MaxAge = int(days)
+			return nil
+		}
+		return errors.Errorf("lumberjack is not configured")
+	}
+}
+
+// WithCompress sets whether the rotated log files are compressed with gzip.
+// If the logger is not configured to use a log file, an error is returned.
+func WithCompress(compress bool) Option {
+	return func(l *logrus.Logger) error {
+		if logger := getLumberjack(l); logger != nil {
+			logger.Compress = compress
+			return nil
+		}
+		return errors.Errorf("lumberjack is not configured")
+	}
+}
+
+// WithLogConfig sets the logger to output to the target of the given config.
+//
+// If the target is file, the logs are written to the path of config with the rotation
+// and retention of it, and nothing will be done if the path is empty.
+// The logs are also shipped to the ShipURL if it's set.
+func WithLogConfig(c LogConfig) Option {
+	return func(l *logrus.Logger) error {
+		var opts []Option
+		switch c.Target {
+		case "", TargetFile:
+			if c.Path != "" {
+				opts = append(opts, WithLogFile(c.Path, c.MaxSize, c.MaxBackups), WithCompress(c.Compress))
+				if c.MaxAge > 0 {
+					opts = append(opts, WithMaxAge(uint(c.MaxAge)))
+				}
+			}
+		case TargetSyslog:
+			opts = append(opts, WithSyslog())
+		case TargetJournald:
+			opts = append(opts, WithJournald())
+		default:
+			return errors.Errorf("invalid log target %s, must be %s/%s/%s",
+				c.Target, TargetFile, TargetSyslog, TargetJournald)
+		}
+		if c.ShipURL != "" {
+			opts = append(opts, WithShipper(c.ShipURL))
+		}
+
+		for _, opt := range opts {
+			if err := opt(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithSyslog sets the logger to output to the local syslog daemon instead of a file.
+func WithSyslog() Option {
+	return func(l *logrus.Logger) error {
+		hook, err := NewSyslogHook(identifier())
+		if err != nil {
+			return errors.Wrap(err, "connect to syslog")
+		}
+		l.SetOutput(ioutil.Discard)
+		l.AddHook(hook)
+		return nil
+	}
+}
+
+// WithJournald sets the logger to output to the systemd journal instead of a file.
+func WithJournald() Option {
+	return func(l *logrus.Logger) error {
+		hook, err := NewJournaldHook(identifier())
+		if err != nil {
+			return errors.Wrap(err, "connect to journald")
+		}
+		l.SetOutput(ioutil.Discard)
+		l.AddHook(hook)
+		return nil
+	}
+}
+
+// WithShipper adds a hook to ship logs to the HTTP input of a GELF server.
+func WithShipper(url string) Option {
+	return func(l *logrus.Logger) error {
+		l.AddHook(NewShipperHook(url))
+		return nil
+	}
+}
+
 // WithConsole adds a hook to output logs to stdout.
 func WithConsole() Option {
 	return func(l *logrus.Logger) error {
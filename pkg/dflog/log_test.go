@@ -18,10 +18,16 @@ package dflog
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/pborman/uuid"
 	"github.com/sirupsen/logrus"
@@ -72,6 +78,83 @@ func (ts *logTestSuite) TestMaxSizeMB() {
 	r.Equal(20, lumberjack.MaxSize)
 }
 
+func (ts *logTestSuite) TestLogConfig() {
+	r := ts.Require()
+
+	f, err := ioutil.TempFile("", "")
+	r.Nil(err)
+	defer os.RemoveAll(f.Name())
+
+	l := logrus.New()
+	r.Nil(Init(l, WithLogConfig(LogConfig{})))
+	r.Nil(getLumberjack(l))
+	r.NotNil(Init(l, WithMaxAge(7)))
+
+	r.Nil(Init(l, WithLogConfig(LogConfig{Path: f.Name(), MaxSize: 10, MaxAge: 7, Compress: true})))
+	lumberjack := getLumberjack(l)
+	r.NotNil(lumberjack)
+	r.Equal(10, lumberjack.MaxSize)
+	r.Equal(1, lumberjack.MaxBackups)
+	r.Equal(7, lumberjack.MaxAge)
+	r.True(lumberjack.Compress)
+}
+
+func (ts *logTestSuite) TestLogTarget() {
+	r := ts.Require()
+
+	l := logrus.New()
+	r.NotNil(Init(l, WithLogConfig(LogConfig{Target: "foo"})))
+}
+
+func (ts *logTestSuite) TestJournald() {
+	r := ts.Require()
+
+	dir, err := ioutil.TempDir("", "")
+	r.Nil(err)
+	defer os.RemoveAll(dir)
+	journalSocket = filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	r.Nil(err)
+	defer conn.Close()
+
+	l := logrus.New()
+	r.Nil(Init(l, WithLogConfig(LogConfig{Target: TargetJournald})))
+	l.WithField("taskID", "foo").Warn("hello\nworld")
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	r.Nil(err)
+	msg := string(buf[:n])
+	r.Contains(msg, "MESSAGE\n\x0b\x00\x00\x00\x00\x00\x00\x00hello\nworld\n")
+	r.Contains(msg, "PRIORITY=4\n")
+	r.Contains(msg, "F_TASKID=foo\n")
+}
+
+func (ts *logTestSuite) TestShipper() {
+	r := ts.Require()
+
+	messages := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		msg := make(map[string]interface{})
+		json.NewDecoder(req.Body).Decode(&msg)
+		messages <- msg
+	}))
+	defer server.Close()
+
+	l := logrus.New()
+	r.Nil(Init(l, WithLogConfig(LogConfig{ShipURL: server.URL})))
+	l.WithField("taskID", "foo").Error("hello")
+
+	select {
+	case msg := <-messages:
+		r.Equal("hello", msg["short_message"])
+		r.Equal("foo", msg["_taskID"])
+		r.Equal(float64(3), msg["level"])
+	case <-time.After(5 * time.Second):
+		r.Fail("the log isn't shipped")
+	}
+}
+
 func (ts *logTestSuite) TestConsole() {
 	r := ts.Require()
 
@@ -0,0 +1,116 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dflog
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// shipperBufferSize is the number of the log entries buffered for shipping,
+	// and the later entries are dropped when the buffer is full.
+	shipperBufferSize = 1024
+
+	shipperTimeout = 5 * time.Second
+)
+
+// ShipperHook ships logs to the HTTP input of a GELF server such as Graylog asynchronously.
+// The entries are buffered in memory, so the logging is never blocked by the server,
+// and the entries are dropped if the server can't keep up with them.
+type ShipperHook struct {
+	url     string
+	host    string
+	client  *httputils.Client
+	entries chan []byte
+
+	// dropped is the number of the entries dropped because the buffer is full.
+	dropped int64
+}
+
+// NewShipperHook returns a ShipperHook which posts the entries to the given url.
+func NewShipperHook(url string) *ShipperHook {
+	host, _ := os.Hostname()
+	sh := &ShipperHook{
+		url:     url,
+		host:    host,
+		client:  httputils.NewClient(httputils.WithRequestTimeout(shipperTimeout)),
+		entries: make(chan []byte, shipperBufferSize),
+	}
+	go sh.run()
+	return sh
+}
+
+// gelfMessage is the message defined by GELF 1.1,
+// and the fields of the entry are added as additional fields prefixed with an underscore.
+type gelfMessage map[string]interface{}
+
+// Fire implements Hook#Fire.
+func (sh *ShipperHook) Fire(entry *logrus.Entry) error {
+	msg := gelfMessage{
+		"version":       "1.1",
+		"host":          sh.host,
+		"short_message": entry.Message,
+		"timestamp":     float64(entry.Time.UnixNano()) / float64(time.Second),
+		"level":         priority(entry.Level),
+		"_program":      identifier(),
+	}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		msg["_"+k] = v
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case sh.entries <- b:
+	default:
+		atomic.AddInt64(&sh.dropped, 1)
+	}
+	return nil
+}
+
+// Levels implements Hook#Levels().
+func (sh *ShipperHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Dropped returns the number of the entries dropped because the buffer is full.
+func (sh *ShipperHook) Dropped() int64 {
+	return atomic.LoadInt64(&sh.dropped)
+}
+
+func (sh *ShipperHook) run() {
+	for b := range sh.entries {
+		// the errors are ignored since they can't be logged without shipping again.
+		resp, err := sh.client.DoWithBody(http.MethodPost, sh.url, map[string]string{"Content-Type": "application/json"}, b, 0)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+}
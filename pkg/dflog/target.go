@@ -0,0 +1,177 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dflog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The targets to which the logs are written.
+const (
+	// TargetFile writes the logs to the rotated log file.
+	TargetFile = "file"
+	// TargetSyslog writes the logs to the local syslog daemon.
+	TargetSyslog = "syslog"
+	// TargetJournald writes the logs to the systemd journal with its native protocol.
+	TargetJournald = "journald"
+)
+
+// journalSocket is the socket on which systemd-journald receives the native messages.
+var journalSocket = "/run/systemd/journal/socket"
+
+// identifier returns the name which the logs are tagged with in syslog and journald.
+func identifier() string {
+	return filepath.Base(os.Args[0])
+}
+
+// priority maps the level of logrus to the priority of syslog.
+func priority(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return int(syslog.LOG_CRIT)
+	case logrus.ErrorLevel:
+		return int(syslog.LOG_ERR)
+	case logrus.WarnLevel:
+		return int(syslog.LOG_WARNING)
+	case logrus.InfoLevel:
+		return int(syslog.LOG_INFO)
+	default:
+		return int(syslog.LOG_DEBUG)
+	}
+}
+
+// SyslogHook writes logs to the local syslog daemon.
+type SyslogHook struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogHook connects to the local syslog daemon.
+func NewSyslogHook(tag string) (*SyslogHook, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogHook{writer: w}, nil
+}
+
+// Fire implements Hook#Fire.
+func (sh *SyslogHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return sh.writer.Crit(line)
+	case logrus.ErrorLevel:
+		return sh.writer.Err(line)
+	case logrus.WarnLevel:
+		return sh.writer.Warning(line)
+	case logrus.InfoLevel:
+		return sh.writer.Info(line)
+	default:
+		return sh.writer.Debug(line)
+	}
+}
+
+// Levels implements Hook#Levels().
+func (sh *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// JournaldHook writes logs to the systemd journal with its native protocol,
+// and the fields of the entries are kept as the fields of the journal.
+type JournaldHook struct {
+	conn *net.UnixConn
+	tag  string
+}
+
+// NewJournaldHook connects to the socket of systemd-journald.
+func NewJournaldHook(tag string) (*JournaldHook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournaldHook{conn: conn, tag: tag}, nil
+}
+
+// Fire implements Hook#Fire.
+func (jh *JournaldHook) Fire(entry *logrus.Entry) error {
+	b := &bytes.Buffer{}
+	appendJournalField(b, "MESSAGE", entry.Message)
+	appendJournalField(b, "PRIORITY", fmt.Sprint(priority(entry.Level)))
+	appendJournalField(b, "SYSLOG_IDENTIFIER", jh.tag)
+
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		appendJournalField(b, journalFieldName(k), fmt.Sprint(entry.Data[k]))
+	}
+
+	_, err := jh.conn.Write(b.Bytes())
+	return err
+}
+
+// Levels implements Hook#Levels().
+func (jh *JournaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// appendJournalField appends a field in the format of the native protocol of journald,
+// the values containing newlines are serialized with their lengths.
+func appendJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName converts the key of a logrus field to a valid journal field name,
+// which only consists of uppercase letters, digits and underscores.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	// the fields starting with underscores are trusted fields reserved for journald.
+	return "F_" + strings.TrimLeft(name, "_")
+}
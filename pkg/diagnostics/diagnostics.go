@@ -0,0 +1,87 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package diagnostics serves the runtime diagnostics endpoints, such as pprof,
+// expvar and the goroutine dump, on an admin port of the Dragonfly components,
+// and collects them into a support bundle.
+package diagnostics
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PprofPath is the path prefix of the pprof endpoints.
+	PprofPath = "/debug/pprof/"
+
+	// VarsPath is the path of the expvar endpoint.
+	VarsPath = "/debug/vars"
+
+	// GoroutinesPath is the path of the endpoint which dumps the stacks of all goroutines.
+	GoroutinesPath = "/debug/goroutines"
+)
+
+// Handler returns the handler of the diagnostics endpoints.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PprofPath, pprof.Index)
+	mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+	mux.Handle(VarsPath, expvar.Handler())
+	mux.HandleFunc(GoroutinesPath, goroutinesHandler)
+	mux.HandleFunc(StatusPath, statusHandler)
+	return mux
+}
+
+// Serve serves the diagnostics endpoints of the component on the loopback address
+// with the port in background. It does nothing if the port is not positive.
+func Serve(component string, port int) (*http.Server, error) {
+	if port <= 0 {
+		return nil, nil
+	}
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on admin address %s: %v", addr, err)
+	}
+
+	server := &http.Server{Handler: Handler()}
+	go func() {
+		logrus.Infof("start %s diagnostics server on %s", component, addr)
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("failed to serve %s diagnostics: %v", component, err)
+		}
+	}()
+	return server, nil
+}
+
+func goroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "goroutines: %d\n\n", runtime.NumGoroutine())
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diagnostics
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type DiagnosticsTestSuite struct{}
+
+func init() {
+	check.Suite(&DiagnosticsTestSuite{})
+}
+
+func (s *DiagnosticsTestSuite) TestServe(c *check.C) {
+	server, err := Serve("test", 0)
+	c.Check(server, check.IsNil)
+	c.Check(err, check.IsNil)
+}
+
+func (s *DiagnosticsTestSuite) TestDump(c *check.C) {
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	buf := &bytes.Buffer{}
+	collected, err := Dump(buf, addr, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(collected, check.HasLen, len(dumpItems))
+
+	entries := readArchive(c, buf)
+	c.Check(strings.Contains(entries["goroutines.txt"], "goroutines:"), check.Equals, true)
+	c.Check(strings.Contains(entries["vars.json"], "memstats"), check.Equals, true)
+	_, ok := entries["errors.txt"]
+	c.Check(ok, check.Equals, false)
+
+	_, err = Dump(&bytes.Buffer{}, "127.0.0.1:0", 0)
+	c.Check(err, check.NotNil)
+}
+
+func readArchive(c *check.C, r io.Reader) map[string]string {
+	gr, err := gzip.NewReader(r)
+	c.Assert(err, check.IsNil)
+	tr := tar.NewReader(gr)
+
+	entries := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		data, err := ioutil.ReadAll(tr)
+		c.Assert(err, check.IsNil)
+		entries[hdr.Name] = string(data)
+	}
+	return entries
+}
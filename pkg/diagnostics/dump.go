@@ -0,0 +1,135 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+)
+
+// dumpTimeout is the timeout to collect an item except the CPU profile.
+const dumpTimeout = 30 * time.Second
+
+// cpuProfileName is the name of the CPU profile, which is collected for the given
+// seconds in addition to dumpTimeout.
+const cpuProfileName = "cpu.pprof"
+
+// dumpItem is an item collected into the support bundle.
+type dumpItem struct {
+	name string
+	path string
+}
+
+var dumpItems = []dumpItem{
+	{"goroutines.txt", GoroutinesPath},
+	{"status.txt", StatusPath},
+	{"vars.json", VarsPath},
+	{"cmdline.txt", PprofPath + "cmdline"},
+	{"heap.pprof", PprofPath + "heap"},
+	{"allocs.pprof", PprofPath + "allocs"},
+	{"block.pprof", PprofPath + "block"},
+	{"mutex.pprof", PprofPath + "mutex"},
+	{"threadcreate.pprof", PprofPath + "threadcreate"},
+}
+
+// Dump collects the diagnostics from the admin server at addr and writes them
+// into w as a gzipped tar archive. The CPU profile is collected for cpuSeconds
+// if it's positive. The items failed to collect are recorded in errors.txt of
+// the archive instead of aborting the dump, and it returns the names of
+// the collected items.
+func Dump(w io.Writer, addr string, cpuSeconds int) ([]string, error) {
+	items := append([]dumpItem{}, dumpItems...)
+	if cpuSeconds > 0 {
+		items = append(items, dumpItem{cpuProfileName, fmt.Sprintf("%sprofile?seconds=%d", PprofPath, cpuSeconds)})
+	}
+	client := httputils.NewClient(httputils.WithRequestTimeout(dumpTimeout))
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	var (
+		collected []string
+		failures  []string
+	)
+	for _, item := range items {
+		timeout := dumpTimeout
+		if item.name == cpuProfileName {
+			timeout += time.Duration(cpuSeconds) * time.Second
+		}
+		data, err := fetch(client, "http://"+addr+item.path, timeout)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", item.name, err))
+			continue
+		}
+		if err := writeEntry(tw, item.name, data); err != nil {
+			return collected, err
+		}
+		collected = append(collected, item.name)
+	}
+
+	if len(collected) == 0 {
+		return nil, fmt.Errorf("failed to collect diagnostics from %s: %s", addr, strings.Join(failures, "; "))
+	}
+	if len(failures) > 0 {
+		if err := writeEntry(tw, "errors.txt", []byte(strings.Join(failures, "\n")+"\n")); err != nil {
+			return collected, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return collected, err
+	}
+	return collected, gw.Close()
+}
+
+func fetch(client *httputils.Client, url string, timeout time.Duration) ([]byte, error) {
+	resp, err := client.Get(url, nil, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
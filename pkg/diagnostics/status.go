@@ -0,0 +1,129 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diagnostics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StatusPath is the path of the endpoint which writes the status snapshot.
+const StatusPath = "/debug/status"
+
+// StatusFunc writes the status of a part of the component in a human-readable format.
+// It must not block, since it's called when the component may be hung.
+type StatusFunc func(w io.Writer)
+
+var (
+	statusLock  sync.RWMutex
+	statusFuncs = make(map[string]StatusFunc)
+
+	startTime = time.Now()
+)
+
+// RegisterStatus registers the StatusFunc of the section with the name into the
+// status snapshot, and the existing one with the same name is replaced.
+func RegisterStatus(name string, f StatusFunc) {
+	statusLock.Lock()
+	statusFuncs[name] = f
+	statusLock.Unlock()
+}
+
+// UnregisterStatus removes the section with the name from the status snapshot.
+func UnregisterStatus(name string) {
+	statusLock.Lock()
+	delete(statusFuncs, name)
+	statusLock.Unlock()
+}
+
+// WriteStatus writes the status snapshot of the component into w, which consists of
+// the runtime status of the process and the registered sections sorted by name.
+func WriteStatus(w io.Writer, component string) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fmt.Fprintf(w, "component: %s\n", component)
+	fmt.Fprintf(w, "pid: %d\n", os.Getpid())
+	fmt.Fprintf(w, "uptime: %s\n", time.Since(startTime).Round(time.Second))
+	fmt.Fprintf(w, "goroutines: %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "heap: %d bytes in use, %d objects\n", m.HeapInuse, m.HeapObjects)
+
+	statusLock.RLock()
+	names := make([]string, 0, len(statusFuncs))
+	for name := range statusFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	funcs := make([]StatusFunc, len(names))
+	for i, name := range names {
+		funcs[i] = statusFuncs[name]
+	}
+	statusLock.RUnlock()
+
+	for i, name := range names {
+		fmt.Fprintf(w, "\n[%s]\n", name)
+		funcs[i](w)
+	}
+}
+
+// WatchStatusSignals logs the status snapshot of the component whenever the process
+// receives SIGQUIT or SIGUSR1, which helps to triage the hung processes in production.
+// It overrides the default behavior of SIGQUIT which dumps the goroutines and exits,
+// and the process keeps running. The returned function stops the watching.
+func WatchStatusSignals(component string) (stop func()) {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, syscall.SIGQUIT, syscall.SIGUSR1)
+	go func() {
+		for {
+			select {
+			case sig := <-c:
+				buf := &bytes.Buffer{}
+				WriteStatus(buf, component)
+				logrus.Infof("received signal %v, status of %s:\n%s", sig, component, buf.String())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
+
+// statusHandler writes the status snapshot. The component is unknown to the handler,
+// so the name of the executable is used instead.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	WriteStatus(w, filepath.Base(os.Args[0]))
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diagnostics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-check/check"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *DiagnosticsTestSuite) TestWriteStatus(c *check.C) {
+	RegisterStatus("b", func(w io.Writer) { fmt.Fprintln(w, "status of b") })
+	RegisterStatus("a", func(w io.Writer) { fmt.Fprintln(w, "status of a") })
+	defer UnregisterStatus("a")
+	defer UnregisterStatus("b")
+
+	buf := &bytes.Buffer{}
+	WriteStatus(buf, "test")
+	out := buf.String()
+	c.Check(strings.HasPrefix(out, "component: test\n"), check.Equals, true)
+	c.Check(strings.Contains(out, "goroutines: "), check.Equals, true)
+	c.Check(strings.Index(out, "[a]\nstatus of a\n") < strings.Index(out, "[b]\nstatus of b\n"), check.Equals, true)
+
+	UnregisterStatus("b")
+	buf.Reset()
+	WriteStatus(buf, "test")
+	c.Check(strings.Contains(buf.String(), "[b]"), check.Equals, false)
+}
+
+func (s *DiagnosticsTestSuite) TestWatchStatusSignals(c *check.C) {
+	buf := &syncBuffer{}
+	origin := logrus.StandardLogger().Out
+	logrus.SetOutput(buf)
+	defer logrus.SetOutput(origin)
+
+	stop := WatchStatusSignals("test")
+	defer stop()
+	c.Assert(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1), check.IsNil)
+
+	for i := 0; i < 100 && !strings.Contains(buf.String(), "component: test"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(strings.Contains(buf.String(), "status of test"), check.Equals, true)
+}
+
+// syncBuffer is a bytes.Buffer safe to write by the watching goroutine.
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
@@ -17,12 +17,66 @@
 package digest
 
 import (
+	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"hash"
 	"io"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// the algorithms of the digests of the files
+const (
+	AlgorithmMD5    = "md5"
+	AlgorithmSHA256 = "sha256"
+	AlgorithmSHA512 = "sha512"
 )
 
+var hashes = map[string]func() hash.Hash{
+	AlgorithmMD5:    md5.New,
+	AlgorithmSHA256: sha256.New,
+	AlgorithmSHA512: sha512.New,
+}
+
+// Parse parses the digest in the form of "algo:hex" into its algorithm and
+// the lowercase hex encoded value. A digest without the algorithm is taken
+// as md5 to be compatible with the md5 used before.
+func Parse(digest string) (algo, encoded string, err error) {
+	algo, encoded = AlgorithmMD5, digest
+	if kv := strings.SplitN(digest, ":", 2); len(kv) == 2 {
+		algo, encoded = strings.ToLower(kv[0]), kv[1]
+	}
+	encoded = strings.ToLower(encoded)
+
+	newHash, ok := hashes[algo]
+	if !ok {
+		return "", "", errors.Wrapf(errortypes.ErrInvalidValue, "unsupported digest algorithm: %s", algo)
+	}
+	if b, e := hex.DecodeString(encoded); e != nil || len(b) != newHash().Size() {
+		return "", "", errors.Wrapf(errortypes.ErrInvalidValue, "invalid %s digest: %s", algo, encoded)
+	}
+	return algo, encoded, nil
+}
+
+// String returns the digest in the form of "algo:hex".
+func String(algo, encoded string) string {
+	return algo + ":" + encoded
+}
+
+// NewHash returns a new hash of the algorithm, and nil if it's not supported.
+func NewHash(algo string) hash.Hash {
+	if newHash, ok := hashes[algo]; ok {
+		return newHash()
+	}
+	return nil
+}
+
 // Sha256 returns the SHA-256 checksum of the data.
 func Sha256(value string) string {
 	h := sha256.New()
@@ -38,3 +92,20 @@ func Sha1(contents []string) string {
 	}
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// GroupSha1 splits the contents into the groups of size in order,
+// and returns the SHA-1 checksum of each group. The last group may be smaller.
+func GroupSha1(contents []string, size int) []string {
+	if size <= 0 {
+		return nil
+	}
+	var result []string
+	for start := 0; start < len(contents); start += size {
+		end := start + size
+		if end > len(contents) {
+			end = len(contents)
+		}
+		result = append(result, Sha1(contents[start:end]))
+	}
+	return result
+}
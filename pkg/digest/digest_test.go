@@ -17,6 +17,8 @@
 package digest
 
 import (
+	"encoding/hex"
+	"strings"
 	"testing"
 
 	"github.com/go-check/check"
@@ -37,7 +39,76 @@ func (suite *DigestUtilSuite) TestSha256(c *check.C) {
 	c.Check(result, check.Equals, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
 }
 
+func (suite *DigestUtilSuite) TestParse(c *check.C) {
+	md5Hex := "098f6bcd4621d373cade4e832627b4f6"
+	sha256Hex := Sha256("test")
+	cases := []struct {
+		digest  string
+		algo    string
+		encoded string
+		err     bool
+	}{
+		{md5Hex, AlgorithmMD5, md5Hex, false},
+		{"MD5:" + strings.ToUpper(md5Hex), AlgorithmMD5, md5Hex, false},
+		{"sha256:" + sha256Hex, AlgorithmSHA256, sha256Hex, false},
+		{"sha512:" + strings.Repeat("a", 128), AlgorithmSHA512, strings.Repeat("a", 128), false},
+		{"sha256:" + md5Hex, "", "", true},
+		{"sha1:" + Sha1([]string{"test"}), "", "", true},
+		{"md5:xyz", "", "", true},
+		{"", "", "", true},
+	}
+	for _, v := range cases {
+		algo, encoded, err := Parse(v.digest)
+		c.Check(err != nil, check.Equals, v.err, check.Commentf(v.digest))
+		c.Check(algo, check.Equals, v.algo)
+		c.Check(encoded, check.Equals, v.encoded)
+	}
+}
+
+func (suite *DigestUtilSuite) TestNewHash(c *check.C) {
+	h := NewHash(AlgorithmSHA256)
+	c.Assert(h, check.NotNil)
+	h.Write([]byte("test"))
+	c.Check(String(AlgorithmSHA256, hex.EncodeToString(h.Sum(nil))), check.Equals, "sha256:"+Sha256("test"))
+	c.Check(NewHash(AlgorithmSHA512).Size(), check.Equals, 64)
+	c.Check(NewHash("sha1"), check.IsNil)
+}
+
 func (suite *DigestUtilSuite) TestSha1(c *check.C) {
 	result := Sha1([]string{"test1", "test2"})
 	c.Check(result, check.Equals, "dff964f6e3c1761b6288f5c75c319d36fb09b2b9")
 }
+
+func (suite *DigestUtilSuite) TestGroupSha1(c *check.C) {
+	result := GroupSha1([]string{"test1", "test2", "test3"}, 2)
+	c.Check(result, check.DeepEquals, []string{Sha1([]string{"test1", "test2"}), Sha1([]string{"test3"})})
+	c.Check(GroupSha1([]string{"test1"}, 0), check.IsNil)
+	c.Check(GroupSha1(nil, 2), check.IsNil)
+}
+
+func (suite *DigestUtilSuite) TestMerkleRange(c *check.C) {
+	var contents []string
+	for i := 0; i < 7; i++ {
+		contents = append(contents, strings.Repeat("a", i))
+	}
+	root := MerkleRoot(contents)
+	c.Check(root, check.Not(check.Equals), MerkleRoot(contents[:6]))
+	// the root of the empty tree is the SHA-256 of nothing
+	c.Check(MerkleRoot(nil), check.Equals, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+
+	for start := 0; start < len(contents); start++ {
+		for end := start + 1; end <= len(contents); end++ {
+			proof := MerkleRangeProof(contents, start, end)
+			c.Check(VerifyMerkleRange(root, len(contents), start, contents[start:end], proof), check.Equals, true,
+				check.Commentf("[%d, %d)", start, end))
+		}
+	}
+
+	proof := MerkleRangeProof(contents, 2, 4)
+	c.Check(VerifyMerkleRange(root, len(contents), 2, []string{"aa", "x"}, proof), check.Equals, false)
+	c.Check(VerifyMerkleRange(root, len(contents), 3, contents[2:4], proof), check.Equals, false)
+	c.Check(VerifyMerkleRange(root, len(contents), 2, contents[2:4], proof[1:]), check.Equals, false)
+	c.Check(VerifyMerkleRange(root, len(contents)+1, 6, contents[6:], MerkleRangeProof(contents, 6, 7)), check.Equals, false)
+	c.Check(VerifyMerkleRange(root, len(contents), 2, contents[2:4], append(proof, root)), check.Equals, false)
+	c.Check(VerifyMerkleRange(root, len(contents), 0, contents, nil), check.Equals, true)
+}
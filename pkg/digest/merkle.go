@@ -0,0 +1,128 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package digest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// The Merkle tree of the contents is built in the same way as RFC 6962. The hash of a leaf
+// is the SHA-256 of 0x00 followed by the content, the hash of a node is the SHA-256 of 0x01
+// followed by the hashes of its children, and the left child of a node of n leaves holds
+// the largest power of 2 less than n leaves.
+
+// MerkleRoot returns the hex encoded root hash of the Merkle tree of the contents.
+func MerkleRoot(contents []string) string {
+	return hex.EncodeToString(merkleHash(contents))
+}
+
+// MerkleRangeProof returns the proof of the contents in [start, end), which is the hex encoded
+// hashes of the subtrees out of the range in the order of the depth-first traversal.
+// The root hash is computed from the contents in the range and the proof by VerifyMerkleRange.
+func MerkleRangeProof(contents []string, start, end int) []string {
+	var proof []string
+	var walk func(lo int, leaves []string)
+	walk = func(lo int, leaves []string) {
+		hi := lo + len(leaves)
+		if hi <= start || lo >= end {
+			proof = append(proof, hex.EncodeToString(merkleHash(leaves)))
+			return
+		}
+		if lo >= start && hi <= end {
+			return
+		}
+		k := merkleSplit(len(leaves))
+		walk(lo, leaves[:k])
+		walk(lo+k, leaves[k:])
+	}
+	if start < end && len(contents) > 0 {
+		walk(0, contents)
+	}
+	return proof
+}
+
+// VerifyMerkleRange checks whether the contents are the ones in [start, start+len(contents))
+// of the Merkle tree of the total contents whose hex encoded root hash is root,
+// with the proof returned by MerkleRangeProof. The total isn't covered by the root hash,
+// so it must be known by the caller in other ways.
+func VerifyMerkleRange(root string, total, start int, contents []string, proof []string) bool {
+	end := start + len(contents)
+	if start < 0 || len(contents) == 0 || end > total {
+		return false
+	}
+
+	failed := false
+	var walk func(lo, n int) []byte
+	walk = func(lo, n int) []byte {
+		if lo+n <= start || lo >= end {
+			if len(proof) == 0 {
+				failed = true
+				return nil
+			}
+			h, err := hex.DecodeString(proof[0])
+			failed = failed || err != nil
+			proof = proof[1:]
+			return h
+		}
+		if n == 1 {
+			return merkleLeafHash(contents[lo-start])
+		}
+		k := merkleSplit(n)
+		left := walk(lo, k)
+		return merkleNodeHash(left, walk(lo+k, n-k))
+	}
+	h := walk(0, total)
+	return !failed && len(proof) == 0 && hex.EncodeToString(h) == strings.ToLower(root)
+}
+
+func merkleHash(leaves []string) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return merkleLeafHash(leaves[0])
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(merkleHash(leaves[:k]), merkleHash(leaves[k:]))
+}
+
+func merkleLeafHash(content string) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write([]byte(content))
+	return h.Sum(nil)
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleSplit returns the largest power of 2 less than n, which is at least 2.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package errortypes
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The reasons are the stable and machine-readable names of errors which are
+// shared by dfget, dfdaemon and supernode. The clients should use them
+// instead of the error messages to distinguish the errors.
+const (
+	ReasonUnknown                = "Unknown"
+	ReasonDataNotFound           = "DataNotFound"
+	ReasonEmptyValue             = "EmptyValue"
+	ReasonInvalidValue           = "InvalidValue"
+	ReasonNotInitialized         = "NotInitialized"
+	ReasonConvertFailed          = "ConvertFailed"
+	ReasonRangeNotSatisfiable    = "RangeNotSatisfiable"
+	ReasonSystemError            = "SystemError"
+	ReasonCDNFail                = "CDNFail"
+	ReasonCDNWait                = "CDNWait"
+	ReasonPeerWait               = "PeerWait"
+	ReasonPeerContinue           = "PeerContinue"
+	ReasonURLNotReachable        = "URLNotReachable"
+	ReasonTaskIDDuplicate        = "TaskIDDuplicate"
+	ReasonAuthenticationRequired = "AuthenticationRequired"
+	ReasonTimeout                = "Timeout"
+	ReasonUnavailable            = "Unavailable"
+	ReasonPermissionDenied       = "PermissionDenied"
+	ReasonSizeLimitExceeded      = "SizeLimitExceeded"
+	ReasonSourceChanged          = "SourceChanged"
+	ReasonDigestMismatch         = "DigestMismatch"
+	ReasonTruncated              = "Truncated"
+	ReasonShortWrite             = "ShortWrite"
+)
+
+// codeDescriptor describes how an error code should be handled by clients.
+type codeDescriptor struct {
+	reason     string
+	httpStatus int
+	retryable  bool
+}
+
+var descriptors = map[int]codeDescriptor{
+	codeDataNotFound:           {ReasonDataNotFound, http.StatusNotFound, false},
+	codeEmptyValue:             {ReasonEmptyValue, http.StatusBadRequest, false},
+	codeInvalidValue:           {ReasonInvalidValue, http.StatusBadRequest, false},
+	codeNotInitialized:         {ReasonNotInitialized, http.StatusInternalServerError, false},
+	codeConvertFailed:          {ReasonConvertFailed, http.StatusInternalServerError, false},
+	codeRangeNotSatisfiable:    {ReasonRangeNotSatisfiable, http.StatusRequestedRangeNotSatisfiable, false},
+	codeSystemError:            {ReasonSystemError, http.StatusInternalServerError, true},
+	codeCDNFail:                {ReasonCDNFail, http.StatusInternalServerError, true},
+	codeCDNWait:                {ReasonCDNWait, http.StatusServiceUnavailable, true},
+	codePeerWait:               {ReasonPeerWait, http.StatusServiceUnavailable, true},
+	codeUnknownError:           {ReasonUnknown, http.StatusInternalServerError, false},
+	codePeerContinue:           {ReasonPeerContinue, http.StatusInternalServerError, true},
+	codeURLNotReachable:        {ReasonURLNotReachable, http.StatusBadGateway, false},
+	codeTaskIDDuplicate:        {ReasonTaskIDDuplicate, http.StatusConflict, false},
+	codeAuthenticationRequired: {ReasonAuthenticationRequired, http.StatusUnauthorized, false},
+	codeTimeout:                {ReasonTimeout, http.StatusGatewayTimeout, true},
+	codeUnavailable:            {ReasonUnavailable, http.StatusServiceUnavailable, true},
+	codePermissionDenied:       {ReasonPermissionDenied, http.StatusForbidden, false},
+	codeSizeLimitExceeded:      {ReasonSizeLimitExceeded, http.StatusBadGateway, false},
+	codeSourceChanged:          {ReasonSourceChanged, http.StatusConflict, true},
+	codeDigestMismatch:         {ReasonDigestMismatch, http.StatusBadGateway, false},
+	codeTruncated:              {ReasonTruncated, http.StatusBadGateway, true},
+	codeShortWrite:             {ReasonShortWrite, http.StatusInternalServerError, false},
+}
+
+// Reason returns the machine-readable name of the error.
+func Reason(err error) string {
+	return describe(err).reason
+}
+
+// IsRetryable reports whether the operation which returns err
+// may succeed if the operation is retried later.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	return describe(err).retryable
+}
+
+// HTTPStatus returns the http status code that should be responded for err.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return describe(err).httpStatus
+}
+
+func describe(err error) codeDescriptor {
+	unknown := codeDescriptor{ReasonUnknown, http.StatusInternalServerError, false}
+	if err == nil {
+		return unknown
+	}
+
+	cause := errors.Cause(err)
+	switch e := cause.(type) {
+	case DfError:
+		if d, ok := descriptors[e.Code]; ok {
+			return d
+		}
+	case *DfError:
+		if d, ok := descriptors[e.Code]; ok {
+			return d
+		}
+	case HTTPError:
+		return describeHTTPStatus(e.Code)
+	case *HTTPError:
+		return describeHTTPStatus(e.Code)
+	case net.Error:
+		if e.Timeout() {
+			return descriptors[codeTimeout]
+		}
+		return codeDescriptor{ReasonUnavailable, http.StatusBadGateway, true}
+	}
+
+	if cause == context.DeadlineExceeded {
+		return descriptors[codeTimeout]
+	}
+	return unknown
+}
+
+func describeHTTPStatus(code int) codeDescriptor {
+	reason := strings.Replace(http.StatusText(code), " ", "", -1)
+	if reason == "" {
+		reason = ReasonUnknown
+	}
+	return codeDescriptor{
+		reason:     reason,
+		httpStatus: code,
+		retryable:  code >= http.StatusInternalServerError || code == http.StatusTooManyRequests,
+	}
+}
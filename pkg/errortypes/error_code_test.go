@@ -0,0 +1,68 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package errortypes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-check/check"
+	"github.com/pkg/errors"
+)
+
+func (suite *ErrorTestSuite) TestErrorCode(c *check.C) {
+	var cases = []struct {
+		err        error
+		reason     string
+		httpStatus int
+		retryable  bool
+	}{
+		{ErrDataNotFound, ReasonDataNotFound, http.StatusNotFound, false},
+		{errors.Wrap(ErrInvalidValue, "url"), ReasonInvalidValue, http.StatusBadRequest, false},
+		{errors.Wrapf(ErrTimeout, "download"), ReasonTimeout, http.StatusGatewayTimeout, true},
+		{New(codeUnavailable, "busy"), ReasonUnavailable, http.StatusServiceUnavailable, true},
+		{ErrAuthenticationRequired, ReasonAuthenticationRequired, http.StatusUnauthorized, false},
+		{errors.Wrap(ErrSizeLimitExceeded, "source"), ReasonSizeLimitExceeded, http.StatusBadGateway, false},
+		{errors.Wrap(ErrDigestMismatch, "md5"), ReasonDigestMismatch, http.StatusBadGateway, false},
+		{errors.Wrap(ErrTruncated, "body"), ReasonTruncated, http.StatusBadGateway, true},
+		{errors.Wrap(ErrShortWrite, "piece"), ReasonShortWrite, http.StatusInternalServerError, false},
+		{NewHTTPError(http.StatusTooManyRequests, "limited"), "TooManyRequests", http.StatusTooManyRequests, true},
+		{*NewHTTPError(http.StatusForbidden, "denied"), "Forbidden", http.StatusForbidden, false},
+		{context.DeadlineExceeded, ReasonTimeout, http.StatusGatewayTimeout, true},
+		{&net.OpError{Op: "dial", Err: fmt.Errorf("refused")}, ReasonUnavailable, http.StatusBadGateway, true},
+		{fmt.Errorf("unknown"), ReasonUnknown, http.StatusInternalServerError, false},
+		{New(999, "undefined"), ReasonUnknown, http.StatusInternalServerError, false},
+	}
+
+	for _, v := range cases {
+		c.Check(Reason(v.err), check.Equals, v.reason, check.Commentf("%v", v.err))
+		c.Check(HTTPStatus(v.err), check.Equals, v.httpStatus, check.Commentf("%v", v.err))
+		c.Check(IsRetryable(v.err), check.Equals, v.retryable, check.Commentf("%v", v.err))
+	}
+
+	c.Check(IsRetryable(nil), check.Equals, false)
+	c.Check(HTTPStatus(nil), check.Equals, http.StatusOK)
+}
+
+func (suite *ErrorTestSuite) TestIsTimeout(c *check.C) {
+	c.Check(IsTimeout(errors.Wrap(ErrTimeout, "test")), check.Equals, true)
+	c.Check(IsUnavailable(ErrUnavailable), check.Equals, true)
+	c.Check(IsPermissionDenied(ErrPermissionDenied), check.Equals, true)
+	c.Check(IsTimeout(ErrUnavailable), check.Equals, false)
+}
@@ -41,6 +41,31 @@ var (
 
 	// ErrRangeNotSatisfiable represents the length of file is insufficient.
 	ErrRangeNotSatisfiable = DfError{codeRangeNotSatisfiable, "range not satisfiable"}
+
+	// ErrTimeout represents the operation is timeout.
+	ErrTimeout = DfError{codeTimeout, "timeout"}
+
+	// ErrUnavailable represents the service is unavailable temporarily.
+	ErrUnavailable = DfError{codeUnavailable, "service unavailable"}
+
+	// ErrPermissionDenied represents the operation is not permitted.
+	ErrPermissionDenied = DfError{codePermissionDenied, "permission denied"}
+
+	// ErrSizeLimitExceeded represents more data than allowed is read, such as
+	// the source sends more data than its Content-Length.
+	ErrSizeLimitExceeded = DfError{codeSizeLimitExceeded, "size limit exceeded"}
+
+	// ErrDigestMismatch represents the data doesn't match the expected md5 or digest.
+	ErrDigestMismatch = DfError{codeDigestMismatch, "digest mismatch"}
+
+	// ErrTruncated represents less data than expected is read, such as
+	// the source closes the connection before sending all of its Content-Length.
+	ErrTruncated = DfError{codeTruncated, "truncated"}
+
+	// ErrShortWrite represents the data written to disk is less than or differs from
+	// the expected one, which is detected by the writers of dfget and CDN before
+	// the corrupted pieces are served.
+	ErrShortWrite = DfError{codeShortWrite, "short write"}
 )
 
 const (
@@ -61,6 +86,15 @@ const (
 	codeURLNotReachable
 	codeTaskIDDuplicate
 	codeAuthenticationRequired
+
+	codeTimeout
+	codeUnavailable
+	codePermissionDenied
+	codeSizeLimitExceeded
+	codeSourceChanged
+	codeDigestMismatch
+	codeTruncated
+	codeShortWrite
 )
 
 // DfError represents a Dragonfly error.
@@ -128,6 +162,41 @@ func IsRangeNotSatisfiable(err error) bool {
 	return checkError(err, codeRangeNotSatisfiable)
 }
 
+// IsTimeout checks the error is a timeout error or not.
+func IsTimeout(err error) bool {
+	return checkError(err, codeTimeout)
+}
+
+// IsUnavailable checks the error is an unavailable error or not.
+func IsUnavailable(err error) bool {
+	return checkError(err, codeUnavailable)
+}
+
+// IsPermissionDenied checks the error is a permission denied error or not.
+func IsPermissionDenied(err error) bool {
+	return checkError(err, codePermissionDenied)
+}
+
+// IsSizeLimitExceeded checks the error is a size limit exceeded error or not.
+func IsSizeLimitExceeded(err error) bool {
+	return checkError(err, codeSizeLimitExceeded)
+}
+
+// IsDigestMismatch checks the error is a digest mismatch error or not.
+func IsDigestMismatch(err error) bool {
+	return checkError(err, codeDigestMismatch)
+}
+
+// IsTruncated checks the error is a truncated error or not.
+func IsTruncated(err error) bool {
+	return checkError(err, codeTruncated)
+}
+
+// IsShortWrite checks the error is a short write error or not.
+func IsShortWrite(err error) bool {
+	return checkError(err, codeShortWrite)
+}
+
 func checkError(err error, code int) bool {
 	e, ok := errors.Cause(err).(DfError)
 	return ok && e.Code == code
@@ -45,6 +45,9 @@ var (
 
 	// ErrAuthenticationRequired represents the authentication is required.
 	ErrAuthenticationRequired = DfError{codeAuthenticationRequired, "authentication required"}
+
+	// ErrSourceChanged represents the file of the source has changed since it was fetched first.
+	ErrSourceChanged = DfError{codeSourceChanged, "source changed"}
 )
 
 // IsSystemError checks the error is a system error or not.
@@ -91,3 +94,8 @@ func IsTaskIDDuplicate(err error) bool {
 func IsAuthenticationRequired(err error) bool {
 	return checkError(err, codeAuthenticationRequired)
 }
+
+// IsSourceChanged checks the error is a SourceChanged error or not.
+func IsSourceChanged(err error) bool {
+	return checkError(err, codeSourceChanged)
+}
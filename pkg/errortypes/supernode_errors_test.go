@@ -18,6 +18,7 @@ package errortypes
 
 import (
 	"github.com/go-check/check"
+	"github.com/pkg/errors"
 )
 
 type SupernodeErrorTestSuite struct{}
@@ -88,3 +89,8 @@ func (suite *SupernodeErrorTestSuite) TestIsAuthenticationRequired(c *check.C) {
 	c.Assert(IsAuthenticationRequired(*err1), check.Equals, true)
 	c.Assert(IsAuthenticationRequired(*err2), check.Equals, false)
 }
+
+func (suite *SupernodeErrorTestSuite) TestIsSourceChanged(c *check.C) {
+	c.Assert(IsSourceChanged(errors.Wrap(ErrSourceChanged, "etag")), check.Equals, true)
+	c.Assert(IsSourceChanged(ErrCDNFail), check.Equals, false)
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ficloneRange is the FICLONERANGE ioctl request, _IOW(0x94, 13, struct file_clone_range).
+const ficloneRange = 0x4020940d
+
+// fileCloneRange is the argument of FICLONERANGE.
+type fileCloneRange struct {
+	srcFd     int64
+	srcOffset uint64
+	srcLength uint64
+	dstOffset uint64
+}
+
+// CloneRange makes the length bytes of dst starting at dstOffset share the data
+// of src starting at srcOffset, without copying it on the file systems
+// which support reflinks, such as btrfs and xfs.
+// The offsets and the length must be aligned to the block size of the file system,
+// and syscall.ENOTSUP is returned if the file system doesn't support it.
+func CloneRange(src *os.File, srcOffset int64, dst *os.File, dstOffset, length int64) error {
+	arg := &fileCloneRange{
+		srcFd:     int64(src.Fd()),
+		srcOffset: uint64(srcOffset),
+		srcLength: uint64(length),
+		dstOffset: uint64(dstOffset),
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficloneRange, uintptr(unsafe.Pointer(arg)))
+	switch errno {
+	case 0:
+		return nil
+	case syscall.EOPNOTSUPP, syscall.EXDEV, syscall.ENOTTY, syscall.ENOSYS:
+		return syscall.ENOTSUP
+	default:
+		return errno
+	}
+}
@@ -14,12 +14,15 @@
  * limitations under the License.
  */
 
-package types
+package fileutils
 
-import "github.com/dragonflyoss/Dragonfly/apis/types"
+import (
+	"os"
+	"syscall"
+)
 
-// HeartBeatResponse is the response of heart beat.
-type HeartBeatResponse struct {
-	*BaseResponse
-	Data *types.HeartBeatResponse `json:"data,omitempty"`
+// Preallocate allocates the disk space of the file without changing its size.
+// It's not supported on darwin yet.
+func Preallocate(f *os.File, offset, length int64) error {
+	return syscall.ENOTSUP
 }
@@ -0,0 +1,39 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE which allocates the space without changing the file size.
+const fallocKeepSize = 0x1
+
+// Preallocate allocates the disk space of the file for the length bytes starting
+// at offset without changing its size, which makes the following writes contiguous
+// on the disk and never fail with no space left.
+// The syscall.ENOTSUP is returned if the file system doesn't support it.
+func Preallocate(f *os.File, offset, length int64) error {
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize, offset, length)
+	switch err {
+	case syscall.EOPNOTSUPP, syscall.ENOSYS:
+		return syscall.ENOTSUP
+	default:
+		return err
+	}
+}
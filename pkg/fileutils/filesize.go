@@ -60,6 +60,26 @@ func (f *Fsize) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// Set implements pflag/flag.Value.
+func (f *Fsize) Set(s string) error {
+	fsize, err := StringToFSize(s)
+	if err != nil {
+		return err
+	}
+	*f = fsize
+	return nil
+}
+
+// Type implements pflag.Value.
+func (f *Fsize) Type() string {
+	return "size"
+}
+
+// String implements pflag.Value.
+func (f Fsize) String() string {
+	return FsizeToString(f)
+}
+
 // FsizeToString parses a Fsize value into string.
 func FsizeToString(fsize Fsize) string {
 	var (
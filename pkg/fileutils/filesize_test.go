@@ -109,3 +109,12 @@ func (suite *FsizeTestSuite) TestUnMarshalYAML(c *check.C) {
 		c.Check(output, check.Equals, ca.output)
 	}
 }
+
+func (suite *FsizeTestSuite) TestSet(c *check.C) {
+	var f Fsize
+	c.Check(f.Set("5M"), check.IsNil)
+	c.Check(f, check.Equals, 5*MB)
+	c.Check(f.String(), check.Equals, "5MB")
+	c.Check(f.Set("x"), check.NotNil)
+	c.Check(f, check.Equals, 5*MB)
+}
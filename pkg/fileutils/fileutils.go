@@ -19,6 +19,8 @@ package fileutils
 import (
 	"bufio"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
@@ -26,6 +28,7 @@ import (
 	"os"
 	"path/filepath"
 	"syscall"
+	"unsafe"
 
 	"gopkg.in/yaml.v2"
 )
@@ -152,6 +155,9 @@ func CopyFile(src string, dst string) (err error) {
 }
 
 // MoveFile moves the file src to dst.
+// If src and dst are on different file systems, src is copied to a temp file
+// in the directory of dst which is then renamed to dst, so that a partial dst
+// is never observed.
 func MoveFile(src string, dst string) error {
 	if !IsRegularFile(src) {
 		return fmt.Errorf("failed to move %s to %s: src is not a regular file", src, dst)
@@ -161,7 +167,53 @@ func MoveFile(src string, dst string) error {
 			return fmt.Errorf("failed to move %s to %s when deleting dst file: %v", src, dst, err)
 		}
 	}
-	return os.Rename(src, dst)
+	err := os.Rename(src, dst)
+	if le, ok := err.(*os.LinkError); ok && le.Err == syscall.EXDEV {
+		return moveAcrossDevices(src, dst)
+	}
+	return err
+}
+
+// moveAcrossDevices moves the file src to dst which is on another file system
+// by copying it.
+func moveAcrossDevices(src string, dst string) (err error) {
+	s, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s when opening source file: %v", src, dst, err)
+	}
+	defer s.Close()
+	info, err := s.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s when getting source file info: %v", src, dst, err)
+	}
+
+	d, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".moving-")
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s when creating temp file: %v", src, dst, err)
+	}
+	defer func() {
+		if err != nil {
+			d.Close()
+			os.Remove(d.Name())
+		}
+	}()
+
+	if _, err = io.CopyBuffer(d, s, make([]byte, BufferSize)); err != nil {
+		return fmt.Errorf("failed to move %s to %s when copying file: %v", src, dst, err)
+	}
+	if err = d.Chmod(info.Mode()); err != nil {
+		return fmt.Errorf("failed to move %s to %s when changing file mode: %v", src, dst, err)
+	}
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("failed to move %s to %s when syncing file: %v", src, dst, err)
+	}
+	if err = d.Close(); err != nil {
+		return fmt.Errorf("failed to move %s to %s when closing file: %v", src, dst, err)
+	}
+	if err = os.Rename(d.Name(), dst); err != nil {
+		return fmt.Errorf("failed to move %s to %s when renaming temp file: %v", src, dst, err)
+	}
+	return os.Remove(src)
 }
 
 // MoveFileAfterCheckMd5 will check whether the file's md5 is equals to the param md5
@@ -203,25 +255,71 @@ func IsRegularFile(name string) bool {
 	return f.Mode().IsRegular()
 }
 
+// IsBlockDevice reports whether the name is a block device, such as a disk or a raw partition.
+func IsBlockDevice(name string) bool {
+	f, e := os.Stat(name)
+	if e != nil {
+		return false
+	}
+	mode := f.Mode()
+	return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
+}
+
+// DirectAlignment is the alignment of the buffer, the offset and the size
+// for the I/O on the file opened by OpenDirect.
+const DirectAlignment = 4096
+
+// AlignedBuffer returns a buffer of size whose address is aligned to DirectAlignment.
+// The size should be a multiple of DirectAlignment.
+func AlignedBuffer(size int) []byte {
+	buf := make([]byte, size+DirectAlignment)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (DirectAlignment - 1)); rem != 0 {
+		offset = DirectAlignment - rem
+	}
+	return buf[offset : offset+size]
+}
+
 // Md5Sum generates md5 for a given file.
 func Md5Sum(name string) string {
-	if !IsRegularFile(name) {
+	h := md5.New()
+	if !sumFile(name, h) {
 		return ""
 	}
+	return GetMd5Sum(h, nil)
+}
+
+// Sha256Sum generates sha256 for a given file.
+func Sha256Sum(name string) string {
+	h := sha256.New()
+	if !sumFile(name, h) {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sum generates the hex encoded digest of a given file with the hash h.
+func Sum(name string, h hash.Hash) string {
+	if !sumFile(name, h) {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sumFile writes the content of the regular file into h.
+func sumFile(name string, h hash.Hash) bool {
+	if !IsRegularFile(name) {
+		return false
+	}
 	f, err := os.Open(name)
 	if err != nil {
-		return ""
+		return false
 	}
 	defer f.Close()
 	r := bufio.NewReaderSize(f, BufferSize)
-	h := md5.New()
 
 	_, err = io.Copy(h, r)
-	if err != nil {
-		return ""
-	}
-
-	return GetMd5Sum(h, nil)
+	return err == nil
 }
 
 // GetMd5Sum gets md5 sum as a string and appends the current hash to b.
@@ -247,6 +345,19 @@ func LoadYaml(path string, out interface{}) error {
 	return nil
 }
 
+// LoadYamlStrict loads yaml config file like LoadYaml, but it fails if the file
+// contains any field unknown to out or any duplicated field.
+func LoadYamlStrict(path string, out interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load yaml %s when reading file: %v", path, err)
+	}
+	if err = yaml.UnmarshalStrict(content, out); err != nil {
+		return fmt.Errorf("failed to load yaml %s: %v", path, err)
+	}
+	return nil
+}
+
 // GetFreeSpace gets the free disk space of the path.
 func GetFreeSpace(path string) (Fsize, error) {
 	fs := syscall.Statfs_t{}
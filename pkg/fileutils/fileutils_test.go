@@ -23,6 +23,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"testing"
+	"unsafe"
 
 	"github.com/go-check/check"
 )
@@ -131,6 +132,7 @@ func (s *FileUtilTestSuite) TestMoveFile(c *check.C) {
 
 	f2Md5 := Md5Sum(f2)
 	c.Assert(f1Md5, check.Equals, f2Md5)
+	c.Assert(Sha256Sum(f2), check.Equals, "91152adc47c20aa28754dd68b572255aaa86ee5f4048e2dc1c260149e8241acf")
 
 	f3 := filepath.Join(s.tmpDir, "TestMovefileSrc02")
 	f4 := filepath.Join(s.tmpDir, "TestMovefileDstNonExist")
@@ -229,6 +231,25 @@ func (s *FileUtilTestSuite) TestCopyFile(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *FileUtilTestSuite) TestMoveAcrossDevices(c *check.C) {
+	src := filepath.Join(s.tmpDir, "TestMoveAcrossDevicesSrc")
+	dst := filepath.Join(s.tmpDir, "TestMoveAcrossDevicesDst")
+	ioutil.WriteFile(src, []byte("Test move file across devices"), 0644)
+	ioutil.WriteFile(dst, []byte("old"), 0644)
+	srcMd5 := Md5Sum(src)
+
+	err := moveAcrossDevices(src, dst)
+	c.Assert(err, check.IsNil)
+	c.Check(Md5Sum(dst), check.Equals, srcMd5)
+	c.Check(PathExist(src), check.Equals, false)
+
+	files, _ := filepath.Glob(filepath.Join(s.tmpDir, ".TestMoveAcrossDevicesDst.moving-*"))
+	c.Check(files, check.HasLen, 0)
+
+	err = moveAcrossDevices(src, dst)
+	c.Check(err, check.NotNil)
+}
+
 func (s *FileUtilTestSuite) TestMoveFileAfterCheckMd5(c *check.C) {
 	srcPath := filepath.Join(s.tmpDir, "TestMoveFileAfterCheckMd5Src")
 	dstPath := filepath.Join(s.tmpDir, "TestMoveFileAfterCheckMd5Dst")
@@ -308,6 +329,25 @@ func (s *FileUtilTestSuite) TestLoadYaml(c *check.C) {
 	}
 }
 
+func (s *FileUtilTestSuite) TestLoadYamlStrict(c *check.C) {
+	type T struct {
+		A int `yaml:"a"`
+	}
+	filename := filepath.Join(s.tmpDir, "test-strict")
+
+	ioutil.WriteFile(filename, []byte("a: 1"), os.ModePerm)
+	var t T
+	c.Assert(LoadYamlStrict(filename, &t), check.IsNil)
+	c.Assert(t.A, check.Equals, 1)
+
+	ioutil.WriteFile(filename, []byte("a: 1\nb: x"), os.ModePerm)
+	c.Assert(LoadYamlStrict(filename, &t), check.ErrorMatches, "(?s).*field b not found.*")
+	c.Assert(LoadYaml(filename, &t), check.IsNil)
+
+	ioutil.WriteFile(filename, []byte("a: 1\na: 2"), os.ModePerm)
+	c.Assert(LoadYamlStrict(filename, &t), check.ErrorMatches, "(?s).*already set.*")
+}
+
 func (s *FileUtilTestSuite) TestIsRegularFile(c *check.C) {
 	pathStr := filepath.Join(s.tmpDir, "TestIsRegularFile")
 	c.Assert(IsRegularFile(pathStr), check.Equals, false)
@@ -322,6 +362,26 @@ func (s *FileUtilTestSuite) TestIsRegularFile(c *check.C) {
 	os.Remove(pathStr)
 }
 
+func (s *FileUtilTestSuite) TestIsBlockDevice(c *check.C) {
+	pathStr := filepath.Join(s.tmpDir, "TestIsBlockDevice")
+	c.Assert(IsBlockDevice(pathStr), check.Equals, false)
+
+	os.Create(pathStr)
+	c.Assert(IsBlockDevice(pathStr), check.Equals, false)
+	os.Remove(pathStr)
+
+	// a character device isn't a block device
+	c.Assert(IsBlockDevice("/dev/null"), check.Equals, false)
+}
+
+func (s *FileUtilTestSuite) TestAlignedBuffer(c *check.C) {
+	for _, size := range []int{DirectAlignment, 4 * DirectAlignment} {
+		buf := AlignedBuffer(size)
+		c.Assert(buf, check.HasLen, size)
+		c.Assert(uintptr(unsafe.Pointer(&buf[0]))%DirectAlignment, check.Equals, uintptr(0))
+	}
+}
+
 func (s *FileUtilTestSuite) TestIsEmptyDir(c *check.C) {
 	pathStr := filepath.Join(s.tmpDir, "TestIsEmptyDir")
 
@@ -0,0 +1,42 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fileutils
+
+import (
+	"syscall"
+)
+
+// GetXattr returns the value of the extended attribute name of the file.
+func GetXattr(path, name string) (string, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return "", err
+	}
+	if size == 0 {
+		return "", nil
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Getxattr(path, name, buf); err != nil {
+		return "", err
+	}
+	return string(buf[:size]), nil
+}
+
+// SetXattr sets the value of the extended attribute name of the file.
+func SetXattr(path, name, value string) error {
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
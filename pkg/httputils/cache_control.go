@@ -0,0 +1,93 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl is the caching directives of a response which are parsed from
+// the Cache-Control and Expires headers.
+type CacheControl struct {
+	// NoStore means that the response must not be stored by any cache.
+	NoStore bool
+
+	// NoCache means that the response must be validated by the origin before every reuse.
+	// It's also true for the private response since the caller is treated as a shared cache.
+	NoCache bool
+
+	// MaxAge is the freshness lifetime of the response, it's only valid if HasMaxAge is true.
+	MaxAge    time.Duration
+	HasMaxAge bool
+}
+
+// ParseCacheControl parses the caching directives of a response for a shared cache,
+// which means that s-maxage takes precedence over max-age, and the Expires header
+// is only used when neither of them is present.
+func ParseCacheControl(header http.Header) *CacheControl {
+	cc := &CacheControl{}
+
+	var maxAge, sMaxAge = -1, -1
+	for _, directive := range strings.Split(strings.Join(header["Cache-Control"], ","), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		kv := strings.SplitN(directive, "=", 2)
+		switch kv[0] {
+		case "no-store":
+			cc.NoStore = true
+		case "no-cache", "private":
+			cc.NoCache = true
+		case "max-age", "s-maxage":
+			if len(kv) != 2 {
+				continue
+			}
+			seconds, err := strconv.Atoi(strings.Trim(kv[1], `"`))
+			if err != nil || seconds < 0 {
+				continue
+			}
+			if kv[0] == "max-age" {
+				maxAge = seconds
+			} else {
+				sMaxAge = seconds
+			}
+		}
+	}
+
+	switch {
+	case sMaxAge >= 0:
+		cc.MaxAge, cc.HasMaxAge = time.Duration(sMaxAge)*time.Second, true
+	case maxAge >= 0:
+		cc.MaxAge, cc.HasMaxAge = time.Duration(maxAge)*time.Second, true
+	case header.Get("Expires") != "":
+		cc.HasMaxAge = true
+		// an invalid Expires such as "0" means that it has already expired
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err != nil {
+			break
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		if expires.After(date) {
+			cc.MaxAge = expires.Sub(date)
+		}
+	}
+	return cc
+}
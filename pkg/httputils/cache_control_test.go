@@ -0,0 +1,78 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+type CacheControlTestSuite struct{}
+
+func init() {
+	check.Suite(&CacheControlTestSuite{})
+}
+
+func (s *CacheControlTestSuite) TestParseCacheControl(c *check.C) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var cases = []struct {
+		header   http.Header
+		expected *CacheControl
+	}{
+		{header: http.Header{}, expected: &CacheControl{}},
+		{
+			header:   http.Header{"Cache-Control": {"public, max-age=60"}},
+			expected: &CacheControl{MaxAge: time.Minute, HasMaxAge: true},
+		},
+		{
+			header:   http.Header{"Cache-Control": {"max-age=60", "s-maxage=10"}},
+			expected: &CacheControl{MaxAge: 10 * time.Second, HasMaxAge: true},
+		},
+		{
+			header:   http.Header{"Cache-Control": {"No-Store"}},
+			expected: &CacheControl{NoStore: true},
+		},
+		{
+			header:   http.Header{"Cache-Control": {"private, max-age=invalid"}},
+			expected: &CacheControl{NoCache: true},
+		},
+		{
+			header: http.Header{
+				"Date":    {date.Format(http.TimeFormat)},
+				"Expires": {date.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			expected: &CacheControl{MaxAge: time.Hour, HasMaxAge: true},
+		},
+		{
+			header: http.Header{
+				"Cache-Control": {"max-age=0"},
+				"Expires":       {date.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			expected: &CacheControl{HasMaxAge: true},
+		},
+		{
+			header:   http.Header{"Expires": {"0"}},
+			expected: &CacheControl{HasMaxAge: true},
+		},
+	}
+
+	for _, v := range cases {
+		c.Check(ParseCacheControl(v.header), check.DeepEquals, v.expected, check.Commentf("header: %v", v.header))
+	}
+}
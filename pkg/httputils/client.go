@@ -0,0 +1,487 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	netUrl "net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDialTimeout is the default timeout of establishing a connection.
+	DefaultDialTimeout = 30 * time.Second
+
+	// DefaultTLSHandshakeTimeout is the default timeout of the TLS handshake.
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// RetryPolicy describes how a Client retries a failed request.
+// Only requests without body are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts including the first one.
+	// A value <= 1 disables the retry.
+	MaxAttempts int
+
+	// Backoff is the interval between two attempts.
+	Backoff time.Duration
+
+	// BackoffFunc returns the interval before the n-th retry which starts from 1,
+	// such as the jittered exponential backoff. It overrides Backoff if it's not nil.
+	BackoffFunc func(n int) time.Duration
+
+	// ShouldRetry decides whether the request should be retried.
+	// If it's nil, the request is retried only when err is not nil
+	// or the status code is 5xx.
+	ShouldRetry func(resp *http.Response, err error) bool
+}
+
+func (p *RetryPolicy) sleep(n int) {
+	backoff := p.Backoff
+	if p.BackoffFunc != nil {
+		backoff = p.BackoffFunc(n)
+	}
+	if backoff > 0 {
+		time.Sleep(backoff)
+	}
+}
+
+func (p *RetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(resp, err)
+	}
+	return err != nil || (resp != nil && resp.StatusCode >= http.StatusInternalServerError)
+}
+
+// MetricsHook is called after every attempt of a request sent by Client.
+// The code is 0 if the err is not nil.
+type MetricsHook func(method, host string, code int, cost time.Duration, err error)
+
+// ClientOption is a functional configuration for the Client.
+type ClientOption func(c *Client)
+
+// WithDialTimeout sets the timeout of establishing a connection.
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.dialTimeout = timeout
+		}
+	}
+}
+
+// WithRequestTimeout sets the default timeout of a whole request
+// which is used when the timeout passed to Do is <= 0.
+func WithRequestTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.requestTimeout = timeout
+	}
+}
+
+// WithRetryPolicy sets the retry policy of the Client.
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithMetricsHook sets the hook which is called after every attempt.
+func WithMetricsHook(hook MetricsHook) ClientOption {
+	return func(c *Client) {
+		c.metricsHook = hook
+	}
+}
+
+// WithTLSConfig sets the default TLS config which is used by the destinations
+// that have not been registered by RegisterTLSConfig.
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithTransportWrapper sets a function to wrap the transport of every destination,
+// it's useful to inject the custom round trippers.
+func WithTransportWrapper(wrapper func(http.RoundTripper) http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.wrapper = wrapper
+	}
+}
+
+// WithMaxRedirects sets the max number of redirects followed by a request,
+// the last response is returned without following if it's negative.
+// The default policy of net/http which follows at most 10 redirects is used if it's 0.
+func WithMaxRedirects(maxRedirects int) ClientOption {
+	return func(c *Client) {
+		c.maxRedirects = maxRedirects
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the max number of idle connections kept for
+// every host, the default value of net/http which is 2 is used if it's <= 0.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(c *Client) {
+		c.maxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost sets the max number of connections to every host including the
+// ones in use, the requests wait for a connection to be released once it's reached.
+// There is no limit if it's <= 0.
+func WithMaxConnsPerHost(n int) ClientOption {
+	return func(c *Client) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// WithDisableKeepAlives makes every request sent by a new connection which is closed
+// after the request, such as the health checks that should detect a hung listener.
+func WithDisableKeepAlives(disable bool) ClientOption {
+	return func(c *Client) {
+		c.disableKeepAlives = disable
+	}
+}
+
+// WithCookieJar sets the cookie jar which stores the cookies set by the responses
+// and sends them with the later requests to the same destinations.
+func WithCookieJar(jar http.CookieJar) ClientOption {
+	return func(c *Client) {
+		c.jar = jar
+	}
+}
+
+// WithUnixSocket makes all the connections dialed to the unix domain socket
+// whatever the hosts of the requests are, and no proxy is used.
+func WithUnixSocket(path string) ClientOption {
+	return func(c *Client) {
+		c.unixSocket = path
+	}
+}
+
+// WithProxy sets the function which returns the proxy of a request, nil url means
+// no proxy. The proxies are read from the environment variables if it's not set.
+func WithProxy(proxy func(*http.Request) (*netUrl.URL, error)) ClientOption {
+	return func(c *Client) {
+		c.proxy = proxy
+	}
+}
+
+// WithDialContext sets the function which establishes the connections, such as
+// the one resolving the hosts with a DNS cache. The dial timeout isn't applied to it.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ClientOption {
+	return func(c *Client) {
+		c.dialContext = dial
+	}
+}
+
+// Client is a configurable http client which supports per-destination TLS config,
+// dial and request timeouts, retry policy and metrics hook.
+// It's safe for concurrent use.
+type Client struct {
+	dialTimeout    time.Duration
+	requestTimeout time.Duration
+	retry          *RetryPolicy
+	metricsHook    MetricsHook
+	tlsConfig      *tls.Config
+	wrapper        func(http.RoundTripper) http.RoundTripper
+	maxRedirects   int
+
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	disableKeepAlives   bool
+	jar                 http.CookieJar
+	unixSocket          string
+	proxy               func(*http.Request) (*netUrl.URL, error)
+	dialContext         func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	defaultClient *http.Client
+
+	// clients stores the http clients for specified destinations.
+	// key: host, value: *hostClient
+	clients sync.Map
+}
+
+// hostClient is the http client registered for a destination.
+type hostClient struct {
+	tlsConfig *tls.Config
+	client    *http.Client
+}
+
+// NewClient creates a Client with the given options.
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		dialTimeout: DefaultDialTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.defaultClient = c.newHTTPClient(c.tlsConfig)
+	return c
+}
+
+// RegisterTLSConfig sets the TLS config for the given host.
+// The host should be in format of "host" or "host:port" the same as url.Host.
+// The connections to the host are kept if the same TLS config has been registered,
+// so it's cheap to register the config returned by GetTLSConfig repeatedly.
+func (c *Client) RegisterTLSConfig(host string, tlsConfig *tls.Config) {
+	if v, ok := c.clients.Load(host); ok && v.(*hostClient).tlsConfig == tlsConfig {
+		return
+	}
+	old, loaded := c.clients.Load(host)
+	c.clients.Store(host, &hostClient{tlsConfig: tlsConfig, client: c.newHTTPClient(tlsConfig)})
+	if loaded {
+		old.(*hostClient).client.CloseIdleConnections()
+	}
+}
+
+// RegisterTLSConfigByURL sets the TLS config for the host of the given url.
+func (c *Client) RegisterTLSConfigByURL(rawURL string, tlsConfig *tls.Config) error {
+	u, err := netUrl.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	c.RegisterTLSConfig(u.Host, tlsConfig)
+	return nil
+}
+
+// Get sends a GET request with headers.
+func (c *Client) Get(url string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
+	return c.Do(http.MethodGet, url, headers, timeout)
+}
+
+// Do sends an HTTP request with headers and specified method.
+// When timeout <= 0, the default request timeout of Client is used, and it
+// will block until receiving response from server if both of them are <= 0.
+func (c *Client) Do(method, url string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
+	return c.DoContext(context.Background(), method, url, headers, timeout)
+}
+
+// DoContext is the same as Do, except that the request is canceled once ctx is done.
+func (c *Client) DoContext(ctx context.Context, method, url string, headers map[string]string,
+	timeout time.Duration) (*http.Response, error) {
+	attempts := 1
+	if c.retry != nil && c.retry.MaxAttempts > 1 {
+		attempts = c.retry.MaxAttempts
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			c.retry.sleep(i)
+		}
+		resp, err = c.doOnce(ctx, method, url, headers, nil, timeout)
+		if i == attempts-1 || !c.retry.shouldRetry(resp, err) {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// DoWithBody sends an HTTP request with the body, which is never retried.
+func (c *Client) DoWithBody(method, url string, headers map[string]string, body []byte, timeout time.Duration) (*http.Response, error) {
+	return c.doOnce(context.Background(), method, url, headers, body, timeout)
+}
+
+func (c *Client) doOnce(ctx context.Context, method, url string, headers map[string]string, body []byte,
+	timeout time.Duration) (*http.Response, error) {
+	var cancel func()
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+	identify(func(key string) bool {
+		return req.Header.Get(key) != ""
+	}, req.Header.Set)
+
+	if timeout <= 0 {
+		timeout = c.requestTimeout
+	}
+	if timeout > 0 {
+		timeoutCtx, cancelFunc := context.WithTimeout(ctx, timeout)
+		req = req.WithContext(timeoutCtx)
+		cancel = cancelFunc
+	} else {
+		req = req.WithContext(ctx)
+	}
+
+	start := time.Now()
+	res, err := c.clientFor(req.URL.Host).Do(req)
+	c.observe(method, req.URL.Host, res, start, err)
+	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+
+	if cancel == nil {
+		return res, nil
+	}
+
+	// do cancel() when close the body.
+	res.Body = newWithFuncReadCloser(res.Body, cancel)
+	return res, nil
+}
+
+// RoundTrip implements http.RoundTripper. It sends the request as is by the transport
+// of its destination, without following the redirects or retrying, so that the Client
+// can be used by the proxies. The metrics hook is called after it.
+func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := c.clientFor(req.URL.Host).Transport.RoundTrip(req)
+	c.observe(req.Method, req.URL.Host, res, start, err)
+	return res, err
+}
+
+func (c *Client) observe(method, host string, res *http.Response, start time.Time, err error) {
+	if c.metricsHook == nil {
+		return
+	}
+	code := 0
+	if res != nil {
+		code = res.StatusCode
+	}
+	c.metricsHook(method, host, code, time.Since(start), err)
+}
+
+// CloseIdleConnections closes the idle connections of all destinations,
+// the connections in use are not interrupted.
+func (c *Client) CloseIdleConnections() {
+	c.defaultClient.CloseIdleConnections()
+	c.clients.Range(func(_, v interface{}) bool {
+		v.(*hostClient).client.CloseIdleConnections()
+		return true
+	})
+}
+
+func (c *Client) clientFor(host string) *http.Client {
+	if v, ok := c.clients.Load(host); ok {
+		return v.(*hostClient).client
+	}
+	return c.defaultClient
+}
+
+func (c *Client) newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   c.dialTimeout,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   c.maxIdleConnsPerHost,
+		MaxConnsPerHost:       c.maxConnsPerHost,
+		DisableKeepAlives:     c.disableKeepAlives,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+	if c.proxy != nil {
+		transport.Proxy = c.proxy
+	}
+	if c.dialContext != nil {
+		transport.DialContext = c.dialContext
+	}
+	if c.unixSocket != "" {
+		dialer := &net.Dialer{Timeout: c.dialTimeout}
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", c.unixSocket)
+		}
+	}
+	RegisterProtocolOnTransport(transport)
+
+	var rt http.RoundTripper = transport
+	if c.wrapper != nil {
+		rt = c.wrapper(rt)
+	}
+	client := &http.Client{
+		Transport: rt,
+		Jar:       c.jar,
+	}
+	if c.maxRedirects != 0 {
+		client.CheckRedirect = c.checkRedirect
+	}
+	return client
+}
+
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if c.maxRedirects < 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > c.maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", c.maxRedirects)
+	}
+	return nil
+}
+
+// NewTLSConfig creates a TLS config with the PEM encoded CA certificates.
+// The RootCAs is left as nil if no certificate is appended successfully,
+// and then the host's root CA set will be used.
+// The TLS sessions are cached by the config to resume the later handshakes.
+func NewTLSConfig(caBlocks [][]byte, insecure bool) *tls.Config {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+	appendSuccess := false
+	roots := x509.NewCertPool()
+	for _, caBytes := range caBlocks {
+		appendSuccess = roots.AppendCertsFromPEM(caBytes) || appendSuccess
+	}
+	if appendSuccess {
+		tlsConfig.RootCAs = roots
+	}
+	return tlsConfig
+}
+
+// NewTLSConfigFromFiles creates a TLS config with the CA certificate files.
+func NewTLSConfigFromFiles(cacerts []string, insecure bool) (*tls.Config, error) {
+	var caBlocks [][]byte
+	for _, certPath := range cacerts {
+		certBytes, err := ioutil.ReadFile(certPath)
+		if err != nil {
+			return nil, err
+		}
+		caBlocks = append(caBlocks, certBytes)
+	}
+	return NewTLSConfig(caBlocks, insecure), nil
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+type ClientTestSuite struct{}
+
+func init() {
+	check.Suite(&ClientTestSuite{})
+}
+
+func (s *ClientTestSuite) TestClientDo(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Test")))
+	}))
+	defer ts.Close()
+
+	var hookCalled int32
+	client := NewClient(WithMetricsHook(func(method, host string, code int, cost time.Duration, err error) {
+		atomic.AddInt32(&hookCalled, 1)
+		c.Check(method, check.Equals, http.MethodGet)
+		c.Check(code, check.Equals, http.StatusOK)
+	}))
+
+	resp, err := client.Get(ts.URL, map[string]string{"X-Test": "value"}, time.Second)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, "value")
+	c.Check(atomic.LoadInt32(&hookCalled), check.Equals, int32(1))
+}
+
+func (s *ClientTestSuite) TestClientDialContext(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer ts.Close()
+
+	var dialed []string
+	client := NewClient(WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return net.Dial(network, ts.Listener.Addr().String())
+	}))
+
+	resp, err := client.Get("http://peer.invalid:8080/", nil, time.Second)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, "peer.invalid:8080")
+	c.Check(dialed, check.DeepEquals, []string{"peer.invalid:8080"})
+}
+
+func (s *ClientTestSuite) TestClientRetry(c *check.C) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := NewClient(WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	resp, err := client.Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(atomic.LoadInt32(&count), check.Equals, int32(3))
+
+	atomic.StoreInt32(&count, 0)
+	client = NewClient(WithRetryPolicy(&RetryPolicy{MaxAttempts: 2}))
+	resp, err = client.Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Check(atomic.LoadInt32(&count), check.Equals, int32(2))
+
+	atomic.StoreInt32(&count, 0)
+	var retries []int
+	client = NewClient(WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, BackoffFunc: func(n int) time.Duration {
+		retries = append(retries, n)
+		return time.Millisecond
+	}}))
+	resp, err = client.Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(retries, check.DeepEquals, []int{1, 2})
+}
+
+func (s *ClientTestSuite) TestClientRequestTimeout(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client := NewClient(WithRequestTimeout(20 * time.Millisecond))
+	_, err := client.Get(ts.URL, nil, 0)
+	c.Check(err, check.NotNil)
+
+	resp, err := client.Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+
+	// the request is canceled with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.DoContext(ctx, http.MethodGet, ts.URL, nil, time.Second)
+	c.Check(err, check.NotNil)
+}
+
+func (s *ClientTestSuite) TestClientMaxRedirects(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := NewClient(WithMaxRedirects(2)).Get(ts.URL+"/a", nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+
+	_, err = NewClient(WithMaxRedirects(1)).Get(ts.URL+"/a", nil, time.Second)
+	c.Check(err, check.NotNil)
+
+	resp, err = NewClient(WithMaxRedirects(-1)).Get(ts.URL+"/a", nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusFound)
+}
+
+func (s *ClientTestSuite) TestClientRoundTrip(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	var codes []int
+	client := NewClient(WithMetricsHook(func(method, host string, code int, cost time.Duration, err error) {
+		codes = append(codes, code)
+	}))
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/a", nil)
+	c.Assert(err, check.IsNil)
+	// the redirects are returned to the caller as is
+	resp, err := client.RoundTrip(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusFound)
+	c.Check(codes, check.DeepEquals, []int{http.StatusFound})
+}
+
+func (s *ClientTestSuite) TestRegisterTLSConfig(c *check.C) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := NewClient()
+	_, err := client.Get(ts.URL, nil, time.Second)
+	c.Check(err, check.NotNil)
+
+	c.Assert(client.RegisterTLSConfigByURL(ts.URL, NewTLSConfig(nil, true)), check.IsNil)
+	resp, err := client.Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+}
+
+func (s *ClientTestSuite) TestNewTLSConfig(c *check.C) {
+	tlsConfig := NewTLSConfig([][]byte{[]byte("invalid")}, false)
+	c.Check(tlsConfig.RootCAs, check.IsNil)
+	c.Check(tlsConfig.InsecureSkipVerify, check.Equals, false)
+
+	_, err := NewTLSConfigFromFiles([]string{"/non-exist-cert"}, true)
+	c.Check(err, check.NotNil)
+}
+
+func (s *ClientTestSuite) TestGetTLSConfig(c *check.C) {
+	cfg := GetTLSConfig(nil, true)
+	c.Check(GetTLSConfig(nil, true), check.Equals, cfg)
+	c.Check(GetTLSConfig(nil, false), check.Not(check.Equals), cfg)
+	c.Check(GetTLSConfig([][]byte{[]byte("invalid")}, true), check.Not(check.Equals), cfg)
+
+	_, err := GetTLSConfigFromFiles([]string{"/non-exist-cert"}, true)
+	c.Check(err, check.NotNil)
+
+	// the requests with the same TLS config share a Client
+	client := getTLSClient(cfg)
+	c.Check(getTLSClient(cfg), check.Equals, client)
+	c.Check(getTLSClient(GetTLSConfig(nil, false)), check.Not(check.Equals), client)
+}
+
+func (s *ClientTestSuite) TestTLSSessionResumption(c *check.C) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := NewClient()
+	c.Assert(client.RegisterTLSConfigByURL(ts.URL, GetTLSConfig(nil, true)), check.IsNil)
+	resp, err := client.Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// the client of the host is kept by registering the same config again,
+	// and the new connection resumes the cached session
+	c.Assert(client.RegisterTLSConfigByURL(ts.URL, GetTLSConfig(nil, true)), check.IsNil)
+	client.CloseIdleConnections()
+
+	resp, err = client.Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(resp.TLS.DidResume, check.Equals, true)
+}
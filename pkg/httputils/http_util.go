@@ -18,13 +18,10 @@ package httputils
 
 import (
 	"bytes"
-	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"reflect"
@@ -60,6 +57,10 @@ var (
 
 	// DefaultBuiltInHTTPClient is the http client for HTTPWithHeaders.
 	DefaultBuiltInHTTPClient *http.Client
+
+	// DefaultClient is the configurable client used by HTTPWithHeaders
+	// when no TLS config is specified.
+	DefaultClient *Client
 )
 
 // DefaultHTTPClient is the default implementation of SimpleHTTPClient.
@@ -113,6 +114,9 @@ func init() {
 	}
 
 	RegisterProtocolOnTransport(DefaultBuiltInTransport)
+
+	DefaultClient = NewClient()
+	DefaultClient.defaultClient = DefaultBuiltInHTTPClient
 }
 
 // ----------------------------------------------------------------------------
@@ -134,10 +138,7 @@ func (c *defaultHTTPClient) PostJSON(url string, body interface{}, timeout time.
 // When timeout <= 0, it will block until receiving response from server.
 func (c *defaultHTTPClient) Get(url string, timeout time.Duration) (
 	code int, body []byte, e error) {
-	if timeout > 0 {
-		return fasthttp.GetTimeout(nil, url, timeout)
-	}
-	return fasthttp.Get(nil, url)
+	return do(url, nil, timeout, nil)
 }
 
 // PostJSONWithHeaders sends a POST request with headers whose content-type is 'application/json;charset=utf-8'.
@@ -181,6 +182,13 @@ func do(url string, headers map[string]string, timeout time.Duration, rsf reques
 	for k, v := range headers {
 		req.Header.Add(k, v)
 	}
+	identify(func(key string) bool {
+		return len(req.Header.Peek(key)) > 0
+	}, req.Header.Set)
+	// the large responses of supernode are compressed if gzip is accepted
+	if len(req.Header.Peek("Accept-Encoding")) == 0 {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
 	// set request
 	if rsf != nil {
 		err = rsf(req)
@@ -203,6 +211,11 @@ func do(url string, headers map[string]string, timeout time.Duration, rsf reques
 	}
 
 	statusCode = resp.StatusCode()
+	if bytes.Equal(resp.Header.Peek("Content-Encoding"), []byte("gzip")) {
+		// the gunzipped body isn't shared with the released response
+		body, err = resp.BodyGunzip()
+		return
+	}
 	data := resp.Body()
 	body = make([]byte, len(data))
 	copy(body, data)
@@ -263,83 +276,21 @@ func HTTPGetTimeout(url string, headers map[string]string, timeout time.Duration
 
 // HTTPGetWithTLS sends an HTTP GET request with TLS config.
 func HTTPGetWithTLS(url string, headers map[string]string, timeout time.Duration, cacerts []string, insecure bool) (*http.Response, error) {
-	roots := x509.NewCertPool()
-	appendSuccess := false
-	for _, certPath := range cacerts {
-		certBytes, err := ioutil.ReadFile(certPath)
-		if err != nil {
-			return nil, err
-		}
-		appendSuccess = appendSuccess || roots.AppendCertsFromPEM(certBytes)
-	}
-
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: insecure,
-	}
-	if appendSuccess {
-		tlsConfig.RootCAs = roots
+	ct, err := getCachedTLSConfigFromFiles(cacerts, insecure)
+	if err != nil {
+		return nil, err
 	}
-	return HTTPWithHeaders("GET", url, headers, timeout, tlsConfig)
+	return getTLSClient(ct.config).Do("GET", url, headers, timeout)
 }
 
 // HTTPWithHeaders sends an HTTP request with headers and specified method.
+// The requests with the same TLS config share a Client and its connections.
 func HTTPWithHeaders(method, url string, headers map[string]string, timeout time.Duration, tlsConfig *tls.Config) (*http.Response, error) {
-	var (
-		cancel func()
-	)
-
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	for k, v := range headers {
-		req.Header.Add(k, v)
-	}
-
-	if timeout > 0 {
-		timeoutCtx, cancelFunc := context.WithTimeout(context.Background(), timeout)
-		req = req.WithContext(timeoutCtx)
-		cancel = cancelFunc
-	}
-
-	var c = DefaultBuiltInHTTPClient
-
+	var c = DefaultClient
 	if tlsConfig != nil {
-		// copy from http.DefaultTransport
-		transport := &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		}
-
-		RegisterProtocolOnTransport(transport)
-		transport.TLSClientConfig = tlsConfig
-
-		c = &http.Client{
-			Transport: transport,
-		}
-	}
-
-	res, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	if cancel == nil {
-		return res, nil
+		c = getTLSClient(tlsConfig)
 	}
-
-	// do cancel() when close the body.
-	res.Body = newWithFuncReadCloser(res.Body, cancel)
-	return res, nil
+	return c.Do(method, url, headers, timeout)
 }
 
 // HTTPStatusOk reports whether the http response code is 200.
@@ -383,7 +334,7 @@ func CheckConnect(ip string, port int, timeout int) (localIP string, e error) {
 	}
 
 	var conn net.Conn
-	addr := fmt.Sprintf("%s:%d", ip, port)
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
 	// Just temporarily limit users can only use IP addr for IPv4 format.
 	// In the near future, if we want to support IPv6, we can revise logic as below.
 	if conn, e = net.DialTimeout("tcp4", addr, t); e == nil {
@@ -533,8 +484,11 @@ func handlePairRange(rangeStr string, length int64) (*RangeStruct, error) {
 //   newTransport := funcNewTransport
 //   httputils.RegisterProtocol(protocols, newTransport)
 // RegisterProtocol must be called before initialise dfget or supernode instances.
+// Registering a scheme again replaces its round tripper.
 func RegisterProtocol(scheme string, rt http.RoundTripper) {
-	validURLSchemas += "|" + scheme
+	if _, ok := protocols.Load(scheme); !ok {
+		validURLSchemas += "|" + scheme
+	}
 	protocols.Store(scheme, rt)
 }
 
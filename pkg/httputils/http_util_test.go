@@ -17,6 +17,7 @@
 package httputils
 
 import (
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"encoding/json"
@@ -25,6 +26,7 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
@@ -101,6 +103,29 @@ func (s *HTTPUtilTestSuite) TestGet(c *check.C) {
 	c.Assert(e.Error(), check.Equals, "timeout")
 }
 
+func (s *HTTPUtilTestSuite) TestGetGzip(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte("plain"))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte("compressed"))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	code, body, e := Get(server.URL, time.Second)
+	c.Assert(e, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	c.Check(string(body), check.Equals, "compressed")
+
+	_, body, e = GetWithHeaders(server.URL, map[string]string{"Accept-Encoding": "identity"}, time.Second)
+	c.Assert(e, check.IsNil)
+	c.Check(string(body), check.Equals, "plain")
+}
+
 func (s *HTTPUtilTestSuite) TestHTTPStatusOk(c *check.C) {
 	for i := fasthttp.StatusContinue; i <= fasthttp.StatusNetworkAuthenticationRequired; i++ {
 		c.Assert(HTTPStatusOk(i), check.Equals, i == fasthttp.StatusOK)
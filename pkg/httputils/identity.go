@@ -0,0 +1,99 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"sync/atomic"
+)
+
+/* the headers identifying the requests sent by Dragonfly */
+const (
+	// HeaderCluster is the header carrying the cluster which the sender belongs to.
+	HeaderCluster = "X-Dragonfly-Cluster"
+
+	// HeaderNode is the header carrying the node which sends the request.
+	HeaderNode = "X-Dragonfly-Node"
+
+	// HeaderTask is the header carrying the task which the request is sent for.
+	HeaderTask = "X-Dragonfly-Task"
+)
+
+// Identity identifies the Dragonfly component which sends the requests, so the operators
+// of the origins can attribute the traffic of Dragonfly and apply the server-side policies.
+type Identity struct {
+	// UserAgent replaces the default User-Agent of the requests if it's not empty.
+	UserAgent string
+
+	// Cluster is the name of the cluster which the component belongs to.
+	// The identification headers are injected only if it's not empty.
+	Cluster string
+
+	// Node identifies the node in the cluster, such as the IP address.
+	Node string
+}
+
+// identity stores the *Identity set by SetIdentity.
+var identity atomic.Value
+
+// SetIdentity sets the identity of the requests sent by this process,
+// it's applied to the requests sent by Client and the functions of this package.
+// The headers specified by the requests explicitly are never replaced.
+func SetIdentity(id Identity) {
+	identity.Store(&id)
+}
+
+func getIdentity() *Identity {
+	id, _ := identity.Load().(*Identity)
+	return id
+}
+
+// identify calls set with the identification headers which are absent.
+func identify(has func(key string) bool, set func(key, value string)) {
+	id := getIdentity()
+	if id == nil {
+		return
+	}
+	if id.UserAgent != "" && !has("User-Agent") {
+		set("User-Agent", id.UserAgent)
+	}
+	if id.Cluster == "" {
+		return
+	}
+	if !has(HeaderCluster) {
+		set(HeaderCluster, id.Cluster)
+	}
+	if id.Node != "" && !has(HeaderNode) {
+		set(HeaderNode, id.Node)
+	}
+}
+
+// WithTaskHeader returns a copy of the headers with the task header set
+// if the identification headers are enabled by SetIdentity, otherwise
+// the headers are returned directly.
+func WithTaskHeader(headers map[string]string, taskID string) map[string]string {
+	if id := getIdentity(); id == nil || id.Cluster == "" || taskID == "" {
+		return headers
+	}
+	copied := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		copied[k] = v
+	}
+	if _, ok := copied[HeaderTask]; !ok {
+		copied[HeaderTask] = taskID
+	}
+	return copied
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+type IdentityTestSuite struct{}
+
+func init() {
+	check.Suite(&IdentityTestSuite{})
+}
+
+func (s *IdentityTestSuite) TearDownTest(c *check.C) {
+	SetIdentity(Identity{})
+}
+
+func (s *IdentityTestSuite) TestIdentify(c *check.C) {
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer ts.Close()
+
+	headers := map[string]string{"foo": "bar"}
+	c.Check(WithTaskHeader(headers, "task"), check.DeepEquals, headers)
+
+	SetIdentity(Identity{UserAgent: "dfget/test"})
+	c.Check(WithTaskHeader(headers, "task"), check.DeepEquals, headers)
+	resp, err := NewClient().Get(ts.URL, nil, time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(header.Get("User-Agent"), check.Equals, "dfget/test")
+	c.Check(header.Get(HeaderCluster), check.Equals, "")
+
+	SetIdentity(Identity{UserAgent: "dfget/test", Cluster: "c1", Node: "127.0.0.1"})
+	resp, err = NewClient().Get(ts.URL, WithTaskHeader(map[string]string{"User-Agent": "curl"}, "task"), time.Second)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(header.Get("User-Agent"), check.Equals, "curl")
+	c.Check(header.Get(HeaderCluster), check.Equals, "c1")
+	c.Check(header.Get(HeaderNode), check.Equals, "127.0.0.1")
+	c.Check(header.Get(HeaderTask), check.Equals, "task")
+
+	_, _, err = Get(ts.URL, time.Second)
+	c.Assert(err, check.IsNil)
+	c.Check(header.Get("User-Agent"), check.Equals, "dfget/test")
+	c.Check(header.Get(HeaderCluster), check.Equals, "c1")
+	c.Check(header.Get(HeaderTask), check.Equals, "")
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// PinPrefix is the optional prefix of the pins accepted by PinPublicKeys.
+const PinPrefix = "sha256/"
+
+// PublicKeyPin returns the pin of the public key of the certificate, which is the
+// base64-encoded SHA-256 digest of its SubjectPublicKeyInfo, the same as the
+// pin-sha256 of HPKP.
+func PublicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// PinPublicKeys makes the handshakes with the tlsConfig fail unless a certificate
+// presented by the server, or of the verified chains if the chains are verified,
+// has the public key of one of the pins. A pin is the base64-encoded SHA-256 digest
+// of the SubjectPublicKeyInfo which may be prefixed with PinPrefix.
+// The pins work together with the verification of the chains unless
+// InsecureSkipVerify is set, and then they're the only check of the server.
+func PinPublicKeys(tlsConfig *tls.Config, pins []string) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	var digests [][]byte
+	for _, pin := range pins {
+		d, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, PinPrefix))
+		if err != nil || len(d) != sha256.Size {
+			return fmt.Errorf("invalid pin %q: must be a base64-encoded sha256 digest", pin)
+		}
+		digests = append(digests, d)
+	}
+
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(verifiedChains) == 0 {
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+		}
+		for _, cert := range certs {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, d := range digests {
+				if bytes.Equal(sum[:], d) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("none of the certificates of the server matches the pins")
+	}
+	return nil
+}
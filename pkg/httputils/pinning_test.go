@@ -0,0 +1,71 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-check/check"
+)
+
+type PinningTestSuite struct{}
+
+func init() {
+	check.Suite(&PinningTestSuite{})
+}
+
+func (s *PinningTestSuite) TestPinPublicKeys(c *check.C) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	pin := PublicKeyPin(ts.Certificate())
+
+	get := func(tlsConfig *tls.Config) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(ts.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	var cases = []struct {
+		pins     []string
+		insecure bool
+		ok       bool
+	}{
+		{pins: nil, ok: true},
+		{pins: []string{pin}, ok: true},
+		{pins: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", PinPrefix + pin}, ok: true},
+		{pins: []string{pin}, insecure: true, ok: true},
+		{pins: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}, ok: false},
+		{pins: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}, insecure: true, ok: false},
+	}
+	for _, v := range cases {
+		tlsConfig := &tls.Config{RootCAs: roots, InsecureSkipVerify: v.insecure}
+		c.Assert(PinPublicKeys(tlsConfig, v.pins), check.IsNil)
+		err := get(tlsConfig)
+		c.Check(err == nil, check.Equals, v.ok, check.Commentf("pins: %v, insecure: %v, err: %v", v.pins, v.insecure, err))
+	}
+
+	c.Check(PinPublicKeys(&tls.Config{}, []string{"invalid"}), check.NotNil)
+	c.Check(PinPublicKeys(&tls.Config{}, []string{"AAAA"}), check.NotNil)
+}
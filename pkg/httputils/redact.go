@@ -0,0 +1,124 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RedactedValue replaces the values of the sensitive headers in the logs and the reports.
+const RedactedValue = "<redacted>"
+
+// sensitiveHeaderKeywords are the keywords in the lowercase keys of the sensitive headers,
+// such as Authorization, Proxy-Authorization, Cookie and X-Amz-Security-Token.
+var sensitiveHeaderKeywords = []string{
+	"auth",
+	"cookie",
+	"token",
+	"secret",
+	"password",
+	"credential",
+	"api-key",
+	"apikey",
+	"signature",
+}
+
+// IsSensitiveHeader returns whether the value of the header key is a credential
+// which mustn't be revealed in the logs and the reports. The key is case-insensitive.
+func IsSensitiveHeader(key string) bool {
+	key = strings.ToLower(key)
+	for _, keyword := range sensitiveHeaderKeywords {
+		if strings.Contains(key, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeaders returns a copy of headers whose sensitive values are replaced by RedactedValue.
+// The headers are returned directly if there is no sensitive header.
+func RedactHeaders(headers map[string]string) map[string]string {
+	var result map[string]string
+	for k := range headers {
+		if !IsSensitiveHeader(k) {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]string, len(headers))
+			for k, v := range headers {
+				result[k] = v
+			}
+		}
+		result[k] = RedactedValue
+	}
+	if result == nil {
+		return headers
+	}
+	return result
+}
+
+// RedactHTTPHeader returns a copy of header whose sensitive values are replaced by RedactedValue.
+func RedactHTTPHeader(header http.Header) http.Header {
+	result := make(http.Header, len(header))
+	for k, v := range header {
+		if IsSensitiveHeader(k) {
+			v = []string{RedactedValue}
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// RedactHeaderLines returns a copy of the headers in the form of 'key:value',
+// such as the ones of the flag --header of dfget, whose sensitive values are
+// replaced by RedactedValue.
+func RedactHeaderLines(lines []string) []string {
+	if len(lines) == 0 {
+		return lines
+	}
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = redactHeaderLine(line)
+	}
+	return result
+}
+
+// RedactHeaderArgs returns a copy of the command-line arguments whose values of
+// the flag --header are redacted, so that the arguments could be logged.
+func RedactHeaderArgs(args []string) []string {
+	result := make([]string, len(args))
+	for i := 0; i < len(args); i++ {
+		result[i] = args[i]
+		switch {
+		case args[i] == "--header" && i+1 < len(args):
+			i++
+			result[i] = redactHeaderLine(args[i])
+		case strings.HasPrefix(args[i], "--header="):
+			result[i] = "--header=" + redactHeaderLine(strings.TrimPrefix(args[i], "--header="))
+		}
+	}
+	return result
+}
+
+func redactHeaderLine(line string) string {
+	idx := strings.Index(line, ":")
+	if idx < 0 || !IsSensitiveHeader(strings.TrimSpace(line[:idx])) {
+		return line
+	}
+	return line[:idx+1] + " " + RedactedValue
+}
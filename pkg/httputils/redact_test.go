@@ -0,0 +1,51 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+
+	"github.com/go-check/check"
+)
+
+func (s *HTTPUtilTestSuite) TestRedactHeaders(c *check.C) {
+	c.Check(IsSensitiveHeader("authorization"), check.Equals, true)
+	c.Check(IsSensitiveHeader("X-Amz-Security-Token"), check.Equals, true)
+	c.Check(IsSensitiveHeader("Range"), check.Equals, false)
+
+	headers := map[string]string{"Range": "bytes=0-1"}
+	c.Check(RedactHeaders(headers), check.DeepEquals, headers)
+	headers["Cookie"] = "session=s1"
+	c.Check(RedactHeaders(headers), check.DeepEquals, map[string]string{
+		"Range":  "bytes=0-1",
+		"Cookie": RedactedValue,
+	})
+	c.Check(headers["Cookie"], check.Equals, "session=s1")
+
+	header := http.Header{"Authorization": {"Bearer t1"}, "Accept": {"*"}}
+	c.Check(RedactHTTPHeader(header), check.DeepEquals, http.Header{
+		"Authorization": {RedactedValue},
+		"Accept":        {"*"},
+	})
+
+	c.Check(RedactHeaderLines([]string{"Authorization: Bearer t1", "Accept:*", "invalid"}), check.DeepEquals,
+		[]string{"Authorization: " + RedactedValue, "Accept:*", "invalid"})
+	c.Check(RedactHeaderArgs([]string{"dfget", "--header", "X-Api-Key:k1", "--header=Accept: *",
+		"--header=Cookie:c1", "--header-file", "/tmp/headers"}), check.DeepEquals,
+		[]string{"dfget", "--header", "X-Api-Key: " + RedactedValue, "--header=Accept: *",
+			"--header=Cookie: " + RedactedValue, "--header-file", "/tmp/headers"})
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"io/ioutil"
+	"sync"
+)
+
+// maxCachedTLSConfigs is the max number of the TLS configs cached by GetTLSConfig,
+// the cache is reset when it's exceeded.
+const maxCachedTLSConfigs = 256
+
+var (
+	tlsConfigsLock sync.Mutex
+	// tlsConfigs caches the TLS configs by the digest of the CA certificates.
+	// key: digest, value: *cachedTLSConfig
+	tlsConfigs = make(map[string]*cachedTLSConfig)
+
+	tlsClientsLock sync.Mutex
+	// tlsClients caches the Clients used by HTTPWithHeaders and HTTPGetWithTLS
+	// by their TLS configs, so the connections are reused by the later requests.
+	// key: *tls.Config, value: *Client
+	tlsClients = make(map[*tls.Config]*Client)
+)
+
+type cachedTLSConfig struct {
+	config *tls.Config
+}
+
+// getTLSClient returns the Client using the TLS config, which is created when
+// the config is used for the first time. The cache is reset and the idle
+// connections of the cached Clients are closed when it's full.
+func getTLSClient(tlsConfig *tls.Config) *Client {
+	tlsClientsLock.Lock()
+	defer tlsClientsLock.Unlock()
+	if c, ok := tlsClients[tlsConfig]; ok {
+		return c
+	}
+	if len(tlsClients) >= maxCachedTLSConfigs {
+		for _, c := range tlsClients {
+			c.CloseIdleConnections()
+		}
+		tlsClients = make(map[*tls.Config]*Client)
+	}
+	c := NewClient(WithTLSConfig(tlsConfig))
+	tlsClients[tlsConfig] = c
+	return c
+}
+
+// GetTLSConfig returns the TLS config with the PEM encoded CA certificates like
+// NewTLSConfig, but the same config is returned for the same certificates and insecure,
+// so the parsed CA pool and the cached TLS sessions are shared by the requests to
+// the same origin rather than rebuilt for every request.
+// The returned config must not be modified.
+func GetTLSConfig(caBlocks [][]byte, insecure bool) *tls.Config {
+	return getCachedTLSConfig(caBlocks, insecure).config
+}
+
+// GetTLSConfigFromFiles returns the TLS config with the CA certificate files by GetTLSConfig.
+// The files are read every time, so the updated certificates take effect.
+func GetTLSConfigFromFiles(cacerts []string, insecure bool) (*tls.Config, error) {
+	ct, err := getCachedTLSConfigFromFiles(cacerts, insecure)
+	if err != nil {
+		return nil, err
+	}
+	return ct.config, nil
+}
+
+func getCachedTLSConfigFromFiles(cacerts []string, insecure bool) (*cachedTLSConfig, error) {
+	var caBlocks [][]byte
+	for _, certPath := range cacerts {
+		certBytes, err := ioutil.ReadFile(certPath)
+		if err != nil {
+			return nil, err
+		}
+		caBlocks = append(caBlocks, certBytes)
+	}
+	return getCachedTLSConfig(caBlocks, insecure), nil
+}
+
+func getCachedTLSConfig(caBlocks [][]byte, insecure bool) *cachedTLSConfig {
+	key := tlsConfigKey(caBlocks, insecure)
+
+	tlsConfigsLock.Lock()
+	defer tlsConfigsLock.Unlock()
+	if ct, ok := tlsConfigs[key]; ok {
+		return ct
+	}
+	if len(tlsConfigs) >= maxCachedTLSConfigs {
+		tlsConfigs = make(map[string]*cachedTLSConfig)
+	}
+	ct := &cachedTLSConfig{config: NewTLSConfig(caBlocks, insecure)}
+	tlsConfigs[key] = ct
+	return ct
+}
+
+func tlsConfigKey(caBlocks [][]byte, insecure bool) string {
+	h := sha256.New()
+	if insecure {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	for _, block := range caBlocks {
+		sum := sha256.Sum256(block)
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
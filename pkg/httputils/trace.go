@@ -0,0 +1,108 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TraceHeaders are the keys of the headers which identify a request across
+// dfdaemon, dfget, supernode and the origin, including the request ID and
+// the trace context of W3C and Zipkin B3.
+var TraceHeaders = []string{
+	"X-Request-Id",
+	"Traceparent",
+	"Tracestate",
+	"X-B3-Traceid",
+	"X-B3-Spanid",
+	"X-B3-Parentspanid",
+	"X-B3-Sampled",
+}
+
+// ExtractTraceHeaders returns the trace headers in headers with the canonical keys.
+// The keys in headers are case-insensitive. It returns nil if there is no trace header.
+func ExtractTraceHeaders(headers map[string]string) map[string]string {
+	var result map[string]string
+	for k, v := range headers {
+		if !isTraceHeader(k) || v == "" {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]string)
+		}
+		result[http.CanonicalHeaderKey(k)] = v
+	}
+	return result
+}
+
+// ExtractHTTPTraceHeaders returns the trace headers in the header of an HTTP request.
+// It returns nil if there is no trace header.
+func ExtractHTTPTraceHeaders(header http.Header) map[string]string {
+	var result map[string]string
+	for _, k := range TraceHeaders {
+		if v := header.Get(k); v != "" {
+			if result == nil {
+				result = make(map[string]string)
+			}
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// ReplaceTraceHeaders returns a copy of headers whose trace headers are replaced
+// by the traceHeaders, and the other headers remain unchanged.
+// The headers are returned directly if traceHeaders is empty.
+func ReplaceTraceHeaders(headers, traceHeaders map[string]string) map[string]string {
+	if len(traceHeaders) == 0 {
+		return headers
+	}
+
+	result := make(map[string]string, len(headers)+len(traceHeaders))
+	for k, v := range headers {
+		if !isTraceHeader(k) {
+			result[k] = v
+		}
+	}
+	for k, v := range traceHeaders {
+		result[k] = v
+	}
+	return result
+}
+
+// FormatTraceHeaders formats the trace headers in headers as "key=value"
+// separated by space in order, which is used in the logs.
+func FormatTraceHeaders(headers map[string]string) string {
+	traceHeaders := ExtractTraceHeaders(headers)
+	items := make([]string, 0, len(traceHeaders))
+	for k, v := range traceHeaders {
+		items = append(items, k+"="+v)
+	}
+	sort.Strings(items)
+	return strings.Join(items, " ")
+}
+
+func isTraceHeader(key string) bool {
+	for _, h := range TraceHeaders {
+		if strings.EqualFold(h, key) {
+			return true
+		}
+	}
+	return false
+}
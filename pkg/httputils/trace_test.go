@@ -0,0 +1,54 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+
+	"github.com/go-check/check"
+)
+
+func (s *HTTPUtilTestSuite) TestTraceHeaders(c *check.C) {
+	headers := map[string]string{
+		"x-request-id": "r1",
+		"traceparent":  "00-t1-s1-01",
+		"X-B3-Sampled": "",
+		"Range":        "bytes=0-1",
+	}
+
+	c.Check(ExtractTraceHeaders(headers), check.DeepEquals, map[string]string{
+		"X-Request-Id": "r1",
+		"Traceparent":  "00-t1-s1-01",
+	})
+	c.Check(ExtractTraceHeaders(map[string]string{"Range": "bytes=0-1"}), check.IsNil)
+	c.Check(FormatTraceHeaders(headers), check.Equals, "Traceparent=00-t1-s1-01 X-Request-Id=r1")
+
+	replaced := ReplaceTraceHeaders(headers, map[string]string{"X-Request-Id": "r2"})
+	c.Check(replaced, check.DeepEquals, map[string]string{
+		"X-Request-Id": "r2",
+		"Range":        "bytes=0-1",
+	})
+	// the original headers are not changed
+	c.Check(headers["x-request-id"], check.Equals, "r1")
+	c.Check(ReplaceTraceHeaders(headers, nil), check.DeepEquals, headers)
+
+	header := http.Header{}
+	c.Check(ExtractHTTPTraceHeaders(header), check.IsNil)
+	header.Set("x-request-id", "r3")
+	header.Set("Accept", "*")
+	c.Check(ExtractHTTPTraceHeaders(header), check.DeepEquals, map[string]string{"X-Request-Id": "r3"})
+}
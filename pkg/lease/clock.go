@@ -0,0 +1,119 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lease implements the leases expired by a logical clock, which are
+// robust against the jumps of the wall clock and the pauses of the process,
+// such as suspending and resuming the VM.
+package lease
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Clock is a logical clock which advances by the monotonic time elapsed between
+// two readings, but never more than maxStep at a time. It's read periodically by Run,
+// so any gap longer than maxStep between two readings is caused by a pause of the
+// process or a jump of the clock, and only maxStep of it is counted.
+type Clock struct {
+	maxStep time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	last      time.Time
+	elapsed   time.Duration
+	discarded time.Duration
+}
+
+// NewClock creates a logical clock which advances by at most maxStep at a time.
+// 0 means the steps are not limited and the clock follows the monotonic time exactly.
+func NewClock(maxStep time.Duration) *Clock {
+	return NewClockWithSource(maxStep, time.Now)
+}
+
+// NewClockWithSource creates a logical clock reading the time from now,
+// which is used to simulate the pauses in tests.
+func NewClockWithSource(maxStep time.Duration, now func() time.Time) *Clock {
+	return &Clock{
+		maxStep: maxStep,
+		now:     now,
+		last:    now(),
+	}
+}
+
+// Now returns the logical time elapsed since the clock is created.
+func (c *Clock) Now() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	return c.elapsed
+}
+
+// Since returns the logical time elapsed since t, which is read from Now.
+func (c *Clock) Since(t time.Duration) time.Duration {
+	return c.Now() - t
+}
+
+// Discarded returns the total time not counted by the clock, which is
+// frozen by the pauses of the process or the jumps of the clock.
+func (c *Clock) Discarded() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	return c.discarded
+}
+
+// Run reads the clock 4 times every maxStep until done is closed,
+// so the clock keeps advancing while no lease is renewed.
+func (c *Clock) Run(done <-chan struct{}) {
+	if c.maxStep <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.maxStep / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if step := c.advance(); step > 0 {
+				logrus.Warnf("logical clock: discard %v frozen by a pause or a clock jump", step)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// advance moves the clock forward to the current time, and returns the time
+// discarded by the step. It must be called with the lock held.
+func (c *Clock) advance() (discarded time.Duration) {
+	now := c.now()
+	step := now.Sub(c.last)
+	c.last = now
+	if step < 0 {
+		// the monotonic time never goes back, but the source of tests may
+		discarded, step = -step, 0
+	}
+	if c.maxStep > 0 && step > c.maxStep {
+		discarded, step = step-c.maxStep, c.maxStep
+	}
+	c.elapsed += step
+	c.discarded += discarded
+	return discarded
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lease
+
+import (
+	"sync"
+	"time"
+)
+
+// Lease is a lease of a key, which is renewed by the heart beats or the accesses of it.
+type Lease struct {
+	// Token identifies the lease. It stays the same while the lease is renewed,
+	// and a new one is issued once the lease is removed and granted again.
+	Token uint64
+
+	// Renewed is the logical time the lease is renewed last.
+	Renewed time.Duration
+}
+
+// Table holds the leases of the keys expired by a logical clock.
+type Table struct {
+	clock *Clock
+
+	mu        sync.Mutex
+	leases    map[string]Lease
+	lastToken uint64
+}
+
+// NewTable creates a table of the leases expired by clock.
+func NewTable(clock *Clock) *Table {
+	return &Table{
+		clock:  clock,
+		leases: make(map[string]Lease),
+	}
+}
+
+// Renew renews the lease of key, which is granted if it doesn't exist.
+func (t *Table) Renew(key string) Lease {
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.leases[key]
+	if !ok {
+		t.lastToken++
+		l.Token = t.lastToken
+	}
+	l.Renewed = now
+	t.leases[key] = l
+	return l
+}
+
+// Age returns the logical time elapsed since the lease of key is renewed last,
+// and false if there's no lease of key.
+func (t *Table) Age(key string) (time.Duration, bool) {
+	t.mu.Lock()
+	l, ok := t.leases[key]
+	t.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	return t.clock.Since(l.Renewed), true
+}
+
+// Get returns the lease of key.
+func (t *Table) Get(key string) (Lease, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.leases[key]
+	return l, ok
+}
+
+// Remove removes the lease of key.
+func (t *Table) Remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.leases, key)
+}
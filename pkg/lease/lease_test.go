@@ -0,0 +1,119 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lease
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type LeaseSuite struct{}
+
+func init() {
+	check.Suite(&LeaseSuite{})
+}
+
+type fakeTime struct {
+	t time.Time
+}
+
+func (f *fakeTime) now() time.Time {
+	return f.t
+}
+
+func (f *fakeTime) add(d time.Duration) {
+	f.t = f.t.Add(d)
+}
+
+func (suite *LeaseSuite) TestClock(c *check.C) {
+	ft := &fakeTime{t: time.Unix(1000, 0)}
+	clock := NewClockWithSource(10*time.Second, ft.now)
+	c.Check(clock.Now(), check.Equals, time.Duration(0))
+
+	ft.add(3 * time.Second)
+	c.Check(clock.Now(), check.Equals, 3*time.Second)
+
+	// a pause of the VM only counts as a step
+	ft.add(time.Hour)
+	c.Check(clock.Now(), check.Equals, 13*time.Second)
+	c.Check(clock.Discarded(), check.Equals, time.Hour-10*time.Second)
+
+	// so does the wall clock going back
+	ft.add(-time.Minute)
+	c.Check(clock.Since(3*time.Second), check.Equals, 10*time.Second)
+	c.Check(clock.Discarded(), check.Equals, time.Hour+50*time.Second)
+
+	ft = &fakeTime{t: time.Unix(1000, 0)}
+	clock = NewClockWithSource(0, ft.now)
+	ft.add(time.Hour)
+	c.Check(clock.Now(), check.Equals, time.Hour)
+	c.Check(clock.Discarded(), check.Equals, time.Duration(0))
+}
+
+func (suite *LeaseSuite) TestTable(c *check.C) {
+	ft := &fakeTime{t: time.Unix(1000, 0)}
+	table := NewTable(NewClockWithSource(10*time.Second, ft.now))
+
+	_, ok := table.Age("foo")
+	c.Check(ok, check.Equals, false)
+
+	l := table.Renew("foo")
+	c.Check(l.Token, check.Equals, uint64(1))
+	c.Check(table.Renew("bar").Token, check.Equals, uint64(2))
+
+	ft.add(5 * time.Second)
+	age, ok := table.Age("foo")
+	c.Check(ok, check.Equals, true)
+	c.Check(age, check.Equals, 5*time.Second)
+
+	// a renewal keeps the token
+	ft.add(time.Hour)
+	renewed := table.Renew("foo")
+	c.Check(renewed.Token, check.Equals, l.Token)
+	c.Check(renewed.Renewed, check.Equals, 15*time.Second)
+	age, _ = table.Age("bar")
+	c.Check(age, check.Equals, 15*time.Second)
+
+	// a new token is issued once the lease is granted again
+	table.Remove("foo")
+	_, ok = table.Get("foo")
+	c.Check(ok, check.Equals, false)
+	c.Check(table.Renew("foo").Token, check.Equals, uint64(3))
+}
+
+func (suite *LeaseSuite) TestRun(c *check.C) {
+	clock := NewClock(40 * time.Millisecond)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		clock.Run(done)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(done)
+	<-stopped
+	c.Check(clock.Now() > 0, check.Equals, true)
+
+	// the clock isn't run if the steps aren't limited
+	NewClock(0).Run(nil)
+}
@@ -18,9 +18,13 @@ package limitreader
 
 import (
 	"crypto/md5"
+	"encoding"
+	"encoding/hex"
+	"fmt"
 	"hash"
 	"io"
 
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
 )
@@ -43,7 +47,21 @@ func NewLimitReaderWithLimiter(rl *ratelimiter.RateLimiter, src io.Reader, calcu
 	return &LimitReader{
 		Src:     src,
 		Limiter: rl,
-		md5sum:  md5sum,
+		sum:     md5sum,
+		algo:    digest.AlgorithmMD5,
+	}
+}
+
+// NewLimitReaderWithDigest creates LimitReader which calculates the digest
+// of the algorithm, and nothing is calculated if the algorithm is empty.
+// src: reader
+// rate: bytes/second
+func NewLimitReaderWithDigest(src io.Reader, rate int64, algo string) *LimitReader {
+	return &LimitReader{
+		Src:     src,
+		Limiter: newRateLimiterWithDefaultWindow(rate),
+		sum:     digest.NewHash(algo),
+		algo:    algo,
 	}
 }
 
@@ -61,7 +79,8 @@ func NewLimitReaderWithLimiterAndMD5Sum(src io.Reader, rl *ratelimiter.RateLimit
 	return &LimitReader{
 		Src:     src,
 		Limiter: rl,
-		md5sum:  md5sum,
+		sum:     md5sum,
+		algo:    digest.AlgorithmMD5,
 	}
 }
 
@@ -73,18 +92,23 @@ func newRateLimiterWithDefaultWindow(rate int64) *ratelimiter.RateLimiter {
 type LimitReader struct {
 	Src     io.Reader
 	Limiter *ratelimiter.RateLimiter
-	md5sum  hash.Hash
+
+	// sum calculates the digest of the algorithm algo.
+	sum  hash.Hash
+	algo string
 }
 
 func (lr *LimitReader) Read(p []byte) (n int, err error) {
 	n, e := lr.Src.Read(p)
+	// the bytes returned with an error are also calculated, since they may be
+	// consumed by the caller, such as io.Copy
+	if n > 0 && lr.sum != nil {
+		lr.sum.Write(p[:n])
+	}
 	if e != nil && e != io.EOF {
 		return n, e
 	}
 	if n > 0 {
-		if lr.md5sum != nil {
-			lr.md5sum.Write(p[:n])
-		}
 		lr.Limiter.AcquireBlocking(int64(n))
 	}
 	return n, e
@@ -92,8 +116,41 @@ func (lr *LimitReader) Read(p []byte) (n int, err error) {
 
 // Md5 calculates the md5 of all contents read.
 func (lr *LimitReader) Md5() string {
-	if lr.md5sum != nil {
-		return fileutils.GetMd5Sum(lr.md5sum, nil)
+	if lr.sum != nil && lr.algo == digest.AlgorithmMD5 {
+		return fileutils.GetMd5Sum(lr.sum, nil)
 	}
 	return ""
 }
+
+// Digest returns the digest of all contents read in the form of "algo:hex",
+// and it's empty if the digest isn't calculated.
+func (lr *LimitReader) Digest() string {
+	if lr.sum == nil {
+		return ""
+	}
+	return digest.String(lr.algo, hex.EncodeToString(lr.sum.Sum(nil)))
+}
+
+// Md5State returns the serialized state of the md5 of all contents read, with which
+// the md5 could be resumed by RestoreMd5 later, even in another process.
+// It returns nil if the md5 isn't calculated.
+func (lr *LimitReader) Md5State() ([]byte, error) {
+	if lr.sum == nil || lr.algo != digest.AlgorithmMD5 {
+		return nil, nil
+	}
+	m, ok := lr.sum.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("the state of %T can't be saved", lr.sum)
+	}
+	return m.MarshalBinary()
+}
+
+// RestoreMd5 restores the md5 from the state returned by Md5State,
+// which could be passed to NewLimitReaderWithMD5Sum to continue calculating.
+func RestoreMd5(state []byte) (hash.Hash, error) {
+	md5sum := md5.New()
+	if err := md5sum.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return md5sum, nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package limitreader
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+
+	"github.com/go-check/check"
+)
+
+type LimitReaderTestSuite struct{}
+
+func init() {
+	check.Suite(&LimitReaderTestSuite{})
+}
+
+func (s *LimitReaderTestSuite) TestMd5State(c *check.C) {
+	content := "resume the md5 from the state"
+	expected := fmt.Sprintf("%x", md5.Sum([]byte(content)))
+
+	lr := NewLimitReader(strings.NewReader(content[:10]), 0, true)
+	_, err := ioutil.ReadAll(lr)
+	c.Assert(err, check.IsNil)
+	state, err := lr.Md5State()
+	c.Assert(err, check.IsNil)
+
+	md5sum, err := RestoreMd5(state)
+	c.Assert(err, check.IsNil)
+	lr = NewLimitReaderWithMD5Sum(strings.NewReader(content[10:]), 0, md5sum)
+	_, err = ioutil.ReadAll(lr)
+	c.Assert(err, check.IsNil)
+	c.Check(lr.Md5(), check.Equals, expected)
+
+	state, err = NewLimitReader(strings.NewReader(content), 0, false).Md5State()
+	c.Check(err, check.IsNil)
+	c.Check(state, check.IsNil)
+
+	_, err = RestoreMd5([]byte("invalid"))
+	c.Check(err, check.NotNil)
+}
+
+func (s *LimitReaderTestSuite) TestDigest(c *check.C) {
+	content := "calculate the digest"
+
+	lr := NewLimitReaderWithDigest(strings.NewReader(content), 0, digest.AlgorithmSHA256)
+	_, err := ioutil.ReadAll(lr)
+	c.Assert(err, check.IsNil)
+	c.Check(lr.Digest(), check.Equals, "sha256:"+digest.Sha256(content))
+	c.Check(lr.Md5(), check.Equals, "")
+
+	lr = NewLimitReader(strings.NewReader(content), 0, true)
+	_, err = ioutil.ReadAll(lr)
+	c.Assert(err, check.IsNil)
+	c.Check(lr.Digest(), check.Equals, "md5:"+lr.Md5())
+
+	c.Check(NewLimitReaderWithDigest(strings.NewReader(content), 0, "").Digest(), check.Equals, "")
+}
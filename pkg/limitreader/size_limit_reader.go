@@ -0,0 +1,68 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package limitreader
+
+import (
+	"io"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// SizeLimit returns the max number of the bytes allowed to read from a response
+// whose content length is contentLength, which exceeds contentLength by the ratio margin,
+// and is capped by maxSize if it's positive. The content length is unknown if it's negative,
+// then only maxSize is applied. A negative limit is returned if it's unlimited.
+func SizeLimit(contentLength int64, margin float64, maxSize int64) int64 {
+	limit := int64(-1)
+	if maxSize > 0 {
+		limit = maxSize
+	}
+	if contentLength >= 0 {
+		if l := contentLength + int64(float64(contentLength)*margin); limit < 0 || l < limit {
+			limit = l
+		}
+	}
+	return limit
+}
+
+// NewSizeLimitReader returns a reader which fails with errortypes.ErrSizeLimitExceeded
+// once more than limit bytes are read from src, so that a source sending more data than
+// it claims can't fill the disk. src is returned as is if limit is negative.
+func NewSizeLimitReader(src io.Reader, limit int64) io.Reader {
+	if limit < 0 {
+		return src
+	}
+	return &sizeLimitReader{src: src, limit: limit}
+}
+
+type sizeLimitReader struct {
+	src   io.Reader
+	limit int64
+	read  int64
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		return n - int(r.read-r.limit), errors.Wrapf(errortypes.ErrSizeLimitExceeded,
+			"read more than %d bytes", r.limit)
+	}
+	return n, err
+}
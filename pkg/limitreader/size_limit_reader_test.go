@@ -0,0 +1,71 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package limitreader
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type SizeLimitReaderTestSuite struct{}
+
+func init() {
+	check.Suite(&SizeLimitReaderTestSuite{})
+}
+
+func (s *SizeLimitReaderTestSuite) TestSizeLimit(c *check.C) {
+	var cases = []struct {
+		contentLength int64
+		margin        float64
+		maxSize       int64
+		expected      int64
+	}{
+		{-1, 0, 0, -1},
+		{-1, 0.1, 100, 100},
+		{0, 0.1, 0, 0},
+		{100, 0, 0, 100},
+		{100, 0.1, 0, 110},
+		{100, 0.1, 105, 105},
+		{100, 0.1, 200, 110},
+	}
+	for _, v := range cases {
+		c.Check(SizeLimit(v.contentLength, v.margin, v.maxSize), check.Equals, v.expected)
+	}
+}
+
+func (s *SizeLimitReaderTestSuite) TestSizeLimitReader(c *check.C) {
+	data, err := ioutil.ReadAll(NewSizeLimitReader(strings.NewReader("hello"), -1))
+	c.Check(err, check.IsNil)
+	c.Check(string(data), check.Equals, "hello")
+
+	data, err = ioutil.ReadAll(NewSizeLimitReader(strings.NewReader("hello"), 5))
+	c.Check(err, check.IsNil)
+	c.Check(string(data), check.Equals, "hello")
+
+	data, err = ioutil.ReadAll(NewSizeLimitReader(strings.NewReader("hello world"), 5))
+	c.Check(errortypes.IsSizeLimitExceeded(err), check.Equals, true)
+	c.Check(string(data), check.Equals, "hello")
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsutils
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultExportInterval is the default interval of pushing the metrics to the backends.
+const DefaultExportInterval = 10 * time.Second
+
+// ExporterConfig is the config of pushing the metrics to a backend other than Prometheus.
+// The metrics are always served by /metrics for Prometheus no matter whether they're
+// pushed to the other backends.
+type ExporterConfig struct {
+	// Backend is the backend which the metrics are pushed to,
+	// the built-in ones are statsd, dogstatsd and otlp.
+	Backend string `yaml:"backend" json:"backend"`
+
+	// Address is the address of the backend, which is the host:port of the UDP listener
+	// of statsd and dogstatsd, or the url of the OTLP/HTTP receiver such as http://collector:4318.
+	Address string `yaml:"address" json:"address"`
+
+	// Interval is the interval of pushing the metrics.
+	// default: 10s
+	Interval time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+
+	// Tags are attached to all the metrics pushed, such as the cluster of the component.
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// Exporter pushes the metrics gathered from the Prometheus registry to a backend.
+type Exporter interface {
+	// Export pushes the current values of the metric families.
+	Export(families []*dto.MetricFamily) error
+
+	// Close releases the resources of the exporter.
+	Close() error
+}
+
+// ExporterFactory creates an Exporter of the component named service with the config.
+type ExporterFactory func(service string, cfg *ExporterConfig) (Exporter, error)
+
+var (
+	exportersMutex sync.RWMutex
+	exporters      = make(map[string]ExporterFactory)
+)
+
+func init() {
+	RegisterExporter("statsd", newStatsdExporter(false))
+	RegisterExporter("dogstatsd", newStatsdExporter(true))
+	RegisterExporter("otlp", newOTLPExporter)
+}
+
+// RegisterExporter registers the factory of the exporters of the backend,
+// which replaces the one registered before.
+func RegisterExporter(backend string, factory ExporterFactory) {
+	exportersMutex.Lock()
+	defer exportersMutex.Unlock()
+	exporters[backend] = factory
+}
+
+// StartExporters starts pushing the metrics gathered by the gatherer to the backends
+// of the configs periodically, and service is the name of the component pushing them.
+// It returns the function which stops the exporters after pushing for the last time.
+func StartExporters(service string, gatherer prometheus.Gatherer, configs []*ExporterConfig) (func(), error) {
+	var started []Exporter
+	closeAll := func() {
+		for _, e := range started {
+			e.Close()
+		}
+	}
+
+	var intervals []time.Duration
+	for _, cfg := range configs {
+		exportersMutex.RLock()
+		factory, ok := exporters[cfg.Backend]
+		exportersMutex.RUnlock()
+		if !ok {
+			closeAll()
+			return nil, fmt.Errorf("unknown metrics backend: %s", cfg.Backend)
+		}
+		e, err := factory(service, cfg)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		started = append(started, e)
+
+		interval := cfg.Interval
+		if interval <= 0 {
+			interval = DefaultExportInterval
+		}
+		intervals = append(intervals, interval)
+	}
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i, e := range started {
+		wg.Add(1)
+		go func(backend string, e Exporter, interval time.Duration) {
+			defer wg.Done()
+			defer e.Close()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-stop:
+					export(backend, gatherer, e)
+					return
+				}
+				export(backend, gatherer, e)
+			}
+		}(configs[i].Backend, e, intervals[i])
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			wg.Wait()
+		})
+	}, nil
+}
+
+func export(backend string, gatherer prometheus.Gatherer, e Exporter) {
+	// the families gathered successfully are still exported if some of them fail
+	families, err := gatherer.Gather()
+	if err != nil {
+		logrus.Warnf("failed to gather some metrics for %s: %v", backend, err)
+	}
+	if err := e.Export(families); err != nil {
+		logrus.Warnf("failed to export the metrics to %s: %v", backend, err)
+	}
+}
+
+// labelsOf returns the labels of the metric with the tags.
+func labelsOf(m *dto.Metric, tags map[string]string) map[string]string {
+	labels := make(map[string]string, len(m.GetLabel())+len(tags))
+	for k, v := range tags {
+		labels[k] = v
+	}
+	for _, l := range m.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsutils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&ExporterTestSuite{})
+}
+
+type ExporterTestSuite struct{}
+
+func newTestRegistry() (*prometheus.Registry, *prometheus.CounterVec, *prometheus.HistogramVec) {
+	reg := prometheus.NewRegistry()
+	counter := NewCounter("test", "requests_total", "Total requests.", []string{"code"}, reg)
+	gauge := NewGauge("test", "peers", "Peers.", []string{}, reg)
+	histogram := NewHistogram("test", "duration_seconds", "Duration.", []string{}, []float64{1, 5}, reg)
+	gauge.WithLabelValues().Set(3)
+	return reg, counter, histogram
+}
+
+func (s *ExporterTestSuite) TestStatsdExporter(c *check.C) {
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer ln.Close()
+
+	reg, counter, histogram := newTestRegistry()
+	read := func() []string {
+		buf := make([]byte, maxStatsdPacketSize)
+		ln.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := ln.ReadFrom(buf)
+		c.Assert(err, check.IsNil)
+		lines := strings.Split(string(buf[:n]), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+
+	e, err := newStatsdExporter(true)("test", &ExporterConfig{Address: ln.LocalAddr().String(), Tags: map[string]string{"env": "prod"}})
+	c.Assert(err, check.IsNil)
+	defer e.Close()
+
+	counter.WithLabelValues("200").Add(2)
+	histogram.WithLabelValues().Observe(2)
+	families, _ := reg.Gather()
+	c.Assert(e.Export(families), check.IsNil)
+	c.Check(read(), check.DeepEquals, []string{
+		"dragonfly_test_duration_seconds_count:1|c|#env:prod",
+		"dragonfly_test_duration_seconds_sum:2|c|#env:prod",
+		"dragonfly_test_peers:3|g|#env:prod",
+		"dragonfly_test_requests_total:2|c|#code:200,env:prod",
+	})
+
+	// only the increases of the counters are sent
+	counter.WithLabelValues("200").Add(3)
+	families, _ = reg.Gather()
+	c.Assert(e.Export(families), check.IsNil)
+	c.Check(read(), check.DeepEquals, []string{
+		"dragonfly_test_peers:3|g|#env:prod",
+		"dragonfly_test_requests_total:3|c|#code:200,env:prod",
+	})
+
+	e, err = newStatsdExporter(false)("test", &ExporterConfig{Address: ln.LocalAddr().String(), Tags: map[string]string{"env": "prod"}})
+	c.Assert(err, check.IsNil)
+	defer e.Close()
+	c.Assert(e.Export(families), check.IsNil)
+	c.Check(read(), check.DeepEquals, []string{
+		"dragonfly_test_duration_seconds_count.prod:1|c",
+		"dragonfly_test_duration_seconds_sum.prod:2|c",
+		"dragonfly_test_peers.prod:3|g",
+		"dragonfly_test_requests_total.200.prod:5|c",
+	})
+}
+
+func (s *ExporterTestSuite) TestOTLPExporter(c *check.C) {
+	var requests int32
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		c.Check(r.URL.Path, check.Equals, otlpMetricsPath)
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	reg, counter, histogram := newTestRegistry()
+	counter.WithLabelValues("200").Add(2)
+	histogram.WithLabelValues().Observe(0.5)
+	histogram.WithLabelValues().Observe(2)
+	histogram.WithLabelValues().Observe(10)
+
+	_, err := StartExporters("test", reg, []*ExporterConfig{{Backend: "unknown"}})
+	c.Check(err, check.NotNil)
+
+	// the metrics are pushed for the last time when the exporters are stopped
+	stop, err := StartExporters("test", reg, []*ExporterConfig{{Backend: "otlp", Address: ts.URL, Interval: time.Hour}})
+	c.Assert(err, check.IsNil)
+	stop()
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+
+	req := &otlpRequest{}
+	c.Assert(json.Unmarshal(body, req), check.IsNil)
+	c.Assert(req.ResourceMetrics, check.HasLen, 1)
+	rm := req.ResourceMetrics[0]
+	c.Check(rm.Resource.Attributes[0].Key, check.Equals, "service.name")
+	c.Check(rm.Resource.Attributes[0].Value.StringValue, check.Equals, "test")
+
+	metrics := make(map[string]*otlpMetric)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	sum := metrics["dragonfly_test_requests_total"].Sum
+	c.Assert(sum, check.NotNil)
+	c.Check(sum.IsMonotonic, check.Equals, true)
+	c.Check(sum.DataPoints[0].AsDouble, check.Equals, float64(2))
+	c.Check(sum.DataPoints[0].Attributes[0].Key, check.Equals, "code")
+
+	c.Check(metrics["dragonfly_test_peers"].Gauge.DataPoints[0].AsDouble, check.Equals, float64(3))
+
+	h := metrics["dragonfly_test_duration_seconds"].Histogram.DataPoints[0]
+	c.Check(h.Count, check.Equals, "3")
+	c.Check(h.ExplicitBounds, check.DeepEquals, []float64{1, 5})
+	c.Check(h.BucketCounts, check.DeepEquals, []string{"1", "1", "1"})
+}
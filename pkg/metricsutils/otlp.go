@@ -0,0 +1,303 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	otlpMetricsPath = "/v1/metrics"
+	otlpTimeout     = 10 * time.Second
+
+	// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE, the same as Prometheus.
+	otlpCumulative = 2
+)
+
+// otlpExporter pushes the metrics to an OpenTelemetry collector by OTLP/HTTP
+// with the JSON encoding, and the service is the service.name of the resource.
+type otlpExporter struct {
+	url     string
+	service string
+	tags    map[string]string
+	start   time.Time
+	client  *httputils.Client
+}
+
+func newOTLPExporter(service string, cfg *ExporterConfig) (Exporter, error) {
+	u, err := url.Parse(cfg.Address)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid otlp address: %s", cfg.Address)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpMetricsPath
+	}
+	return &otlpExporter{
+		url:     u.String(),
+		service: service,
+		tags:    cfg.Tags,
+		start:   time.Now(),
+		client:  httputils.NewClient(httputils.WithRequestTimeout(otlpTimeout)),
+	}, nil
+}
+
+// The types below are the JSON encoding of the messages of OTLP metrics,
+// in which the 64-bit integers are encoded as strings.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	Summary     *otlpSummary   `json:"summary,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryPoint `json:"dataPoints"`
+}
+
+type otlpPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+}
+
+type otlpNumberPoint struct {
+	otlpPoint
+	AsDouble float64 `json:"asDouble"`
+}
+
+type otlpHistogramPoint struct {
+	otlpPoint
+	Count          string    `json:"count"`
+	Sum            float64   `json:"sum"`
+	BucketCounts   []string  `json:"bucketCounts"`
+	ExplicitBounds []float64 `json:"explicitBounds"`
+}
+
+type otlpSummaryPoint struct {
+	otlpPoint
+	Count          string              `json:"count"`
+	Sum            float64             `json:"sum"`
+	QuantileValues []otlpQuantileValue `json:"quantileValues"`
+}
+
+type otlpQuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+func (e *otlpExporter) Export(families []*dto.MetricFamily) error {
+	now := time.Now()
+	var metrics []*otlpMetric
+	for _, f := range families {
+		if m := e.convert(f, now); m != nil {
+			metrics = append(metrics, m)
+		}
+	}
+
+	rm := otlpResourceMetrics{}
+	rm.Resource.Attributes = otlpAttributes(map[string]string{"service.name": e.service})
+	sm := otlpScopeMetrics{Metrics: metrics}
+	sm.Scope.Name = namespace
+	rm.ScopeMetrics = []otlpScopeMetrics{sm}
+
+	body, err := json.Marshal(&otlpRequest{ResourceMetrics: []otlpResourceMetrics{rm}})
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.DoWithBody(http.MethodPost, e.url, map[string]string{"Content-Type": "application/json"}, body, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code of otlp receiver: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// convert converts the metric family of Prometheus into the metric of OTLP,
+// and the values of NaN and Inf are dropped since they can't be encoded by JSON.
+func (e *otlpExporter) convert(f *dto.MetricFamily, now time.Time) *otlpMetric {
+	m := &otlpMetric{Name: f.GetName(), Description: f.GetHelp()}
+	for _, metric := range f.GetMetric() {
+		point := otlpPoint{
+			Attributes:        otlpAttributes(labelsOf(metric, e.tags)),
+			StartTimeUnixNano: formatUnixNano(e.start),
+			TimeUnixNano:      formatUnixNano(now),
+		}
+		switch f.GetType() {
+		case dto.MetricType_COUNTER:
+			if m.Sum == nil {
+				m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			}
+			if v := metric.GetCounter().GetValue(); isFinite(v) {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberPoint{point, v})
+			}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			if m.Gauge == nil {
+				m.Gauge = &otlpGauge{}
+			}
+			v := metric.GetGauge().GetValue()
+			if f.GetType() == dto.MetricType_UNTYPED {
+				v = metric.GetUntyped().GetValue()
+			}
+			point.StartTimeUnixNano = ""
+			if isFinite(v) {
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberPoint{point, v})
+			}
+		case dto.MetricType_HISTOGRAM:
+			if m.Histogram == nil {
+				m.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+			}
+			m.Histogram.DataPoints = append(m.Histogram.DataPoints, convertHistogram(point, metric.GetHistogram()))
+		case dto.MetricType_SUMMARY:
+			if m.Summary == nil {
+				m.Summary = &otlpSummary{}
+			}
+			m.Summary.DataPoints = append(m.Summary.DataPoints, convertSummary(point, metric.GetSummary()))
+		default:
+			return nil
+		}
+	}
+	return m
+}
+
+// convertHistogram converts the cumulative buckets of Prometheus into the
+// bucket counts of OTLP, the last of which counts the samples above all the bounds.
+func convertHistogram(point otlpPoint, h *dto.Histogram) otlpHistogramPoint {
+	p := otlpHistogramPoint{
+		otlpPoint: point,
+		Count:     strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:       finiteOrZero(h.GetSampleSum()),
+	}
+	var cumulative uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		p.ExplicitBounds = append(p.ExplicitBounds, b.GetUpperBound())
+		p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-cumulative, 10))
+		cumulative = b.GetCumulativeCount()
+	}
+	p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(h.GetSampleCount()-cumulative, 10))
+	return p
+}
+
+func convertSummary(point otlpPoint, s *dto.Summary) otlpSummaryPoint {
+	p := otlpSummaryPoint{
+		otlpPoint: point,
+		Count:     strconv.FormatUint(s.GetSampleCount(), 10),
+		Sum:       finiteOrZero(s.GetSampleSum()),
+	}
+	for _, q := range s.GetQuantile() {
+		if isFinite(q.GetValue()) {
+			p.QuantileValues = append(p.QuantileValues, otlpQuantileValue{q.GetQuantile(), q.GetValue()})
+		}
+	}
+	return p
+}
+
+func otlpAttributes(labels map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		attr := otlpAttribute{Key: k}
+		attr.Value.StringValue = labels[k]
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+func formatUnixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func finiteOrZero(v float64) float64 {
+	if isFinite(v) {
+		return v
+	}
+	return 0
+}
+
+func (e *otlpExporter) Close() error {
+	return nil
+}
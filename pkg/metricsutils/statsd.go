@@ -0,0 +1,182 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsutils
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// maxStatsdPacketSize is the max size of a UDP packet sent to statsd,
+// which fits in the MTU of the most networks.
+const maxStatsdPacketSize = 1432
+
+// statsdExporter pushes the metrics to statsd by UDP. The labels are folded into
+// the names for statsd, and they're sent as the tags for dogstatsd.
+// Prometheus counters are cumulative, so their increases since the last push are
+// sent as the statsd counters, and the histograms and summaries are sent as the
+// counters of their _count and _sum.
+type statsdExporter struct {
+	conn      net.Conn
+	dogstatsd bool
+	tags      map[string]string
+
+	// last stores the values of the counters pushed last time.
+	last map[string]float64
+}
+
+func newStatsdExporter(dogstatsd bool) ExporterFactory {
+	return func(service string, cfg *ExporterConfig) (Exporter, error) {
+		conn, err := net.Dial("udp", cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		return &statsdExporter{
+			conn:      conn,
+			dogstatsd: dogstatsd,
+			tags:      cfg.Tags,
+			last:      make(map[string]float64),
+		}, nil
+	}
+}
+
+func (e *statsdExporter) Export(families []*dto.MetricFamily) error {
+	var lines []string
+	for _, f := range families {
+		name := f.GetName()
+		for _, m := range f.GetMetric() {
+			labels := labelsOf(m, e.tags)
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = e.appendCounter(lines, name, labels, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				lines = e.appendLine(lines, name, labels, m.GetGauge().GetValue(), "g")
+			case dto.MetricType_UNTYPED:
+				lines = e.appendLine(lines, name, labels, m.GetUntyped().GetValue(), "g")
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				lines = e.appendCounter(lines, name+"_count", labels, float64(h.GetSampleCount()))
+				lines = e.appendCounter(lines, name+"_sum", labels, h.GetSampleSum())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				lines = e.appendCounter(lines, name+"_count", labels, float64(s.GetSampleCount()))
+				lines = e.appendCounter(lines, name+"_sum", labels, s.GetSampleSum())
+			}
+		}
+	}
+	return e.send(lines)
+}
+
+// appendCounter appends the increase of the counter since the last push.
+// The counter is regarded as reset if it decreases.
+func (e *statsdExporter) appendCounter(lines []string, name string, labels map[string]string, value float64) []string {
+	key := name + e.suffix(labels)
+	delta := value - e.last[key]
+	if delta < 0 {
+		delta = value
+	}
+	e.last[key] = value
+	if delta == 0 {
+		return lines
+	}
+	return e.appendLine(lines, name, labels, delta, "c")
+}
+
+func (e *statsdExporter) appendLine(lines []string, name string, labels map[string]string, value float64, typ string) []string {
+	if !isFinite(value) {
+		return lines
+	}
+	v := strconv.FormatFloat(value, 'f', -1, 64)
+	if e.dogstatsd {
+		line := name + ":" + v + "|" + typ
+		if tags := e.suffix(labels); tags != "" {
+			line += "|#" + tags
+		}
+		return append(lines, line)
+	}
+	return append(lines, name+e.suffix(labels)+":"+v+"|"+typ)
+}
+
+// suffix returns the labels sorted by their names, as the tags of dogstatsd
+// in format of k1:v1,k2:v2, or the suffix of the name of statsd in format of .v1.v2.
+func (e *statsdExporter) suffix(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if e.dogstatsd {
+			parts = append(parts, sanitizeStatsd(k, false)+":"+sanitizeStatsd(labels[k], false))
+			continue
+		}
+		parts = append(parts, "."+sanitizeStatsd(labels[k], true))
+	}
+	if e.dogstatsd {
+		return strings.Join(parts, ",")
+	}
+	return strings.Join(parts, "")
+}
+
+// send sends the lines in the packets no larger than maxStatsdPacketSize.
+func (e *statsdExporter) send(lines []string) error {
+	buf := &bytes.Buffer{}
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxStatsdPacketSize {
+			if _, err := e.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := e.conn.Write(buf.Bytes())
+	return err
+}
+
+func (e *statsdExporter) Close() error {
+	return e.conn.Close()
+}
+
+// sanitizeStatsd replaces the characters which are reserved by the statsd protocol,
+// including the dots separating the segments if s is a part of a name.
+func sanitizeStatsd(s string, name bool) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '#', '@', '\n', ' ':
+			return '_'
+		case '.':
+			if name {
+				return '_'
+			}
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package netutils
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCacheMaxEntries is the number of the entries above which
+// the expired ones are removed from a DNSCache.
+const dnsCacheMaxEntries = 1024
+
+// DNSCache caches the addresses of the hostnames for TTL, and the failures of
+// resolving the hostnames which have never been resolved for NegativeTTL.
+// The failure of resolving a hostname whose addresses were resolved before is
+// treated as transient, and the addresses resolved last time are used until it's
+// resolved again, which avoids flapping on the unstable DNS servers.
+// It's safe for concurrent use.
+type DNSCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// lookup resolves the hostname, it's net.DefaultResolver.LookupHost
+	// by default and replaced in the tests.
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	mu      sync.Mutex
+	entries map[string]*dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	addrs  []string
+	err    error
+	expire time.Time
+}
+
+// NewDNSCache creates a DNSCache. Nothing is cached if the ttl is <= 0,
+// and the failures aren't cached if the negativeTTL is <= 0.
+func NewDNSCache(ttl, negativeTTL time.Duration) *DNSCache {
+	return &DNSCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		lookup:      net.DefaultResolver.LookupHost,
+		entries:     make(map[string]*dnsCacheEntry),
+	}
+}
+
+var (
+	dnsCachesLock sync.Mutex
+	dnsCaches     = make(map[[2]time.Duration]*DNSCache)
+)
+
+// GetDNSCache returns the DNSCache shared in the process by the callers with the same
+// TTLs, so that the hostnames are resolved once for all the downloads.
+// It returns nil if both the TTLs are <= 0, which means that the DNS cache is disabled.
+func GetDNSCache(ttl, negativeTTL time.Duration) *DNSCache {
+	if ttl <= 0 && negativeTTL <= 0 {
+		return nil
+	}
+
+	dnsCachesLock.Lock()
+	defer dnsCachesLock.Unlock()
+	key := [2]time.Duration{ttl, negativeTTL}
+	c, ok := dnsCaches[key]
+	if !ok {
+		c = NewDNSCache(ttl, negativeTTL)
+		dnsCaches[key] = c
+	}
+	return c
+}
+
+// LookupHost returns the addresses of the host, which is returned directly if it's an IP.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && now.Before(e.expire) {
+		return e.addrs, e.err
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		// the failure caused by the caller isn't cached
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if ok && len(e.addrs) > 0 {
+			addrs, err = e.addrs, nil
+		}
+		c.store(host, &dnsCacheEntry{addrs: addrs, err: err, expire: now.Add(c.negativeTTL)})
+		return addrs, err
+	}
+	c.store(host, &dnsCacheEntry{addrs: addrs, expire: now.Add(c.ttl)})
+	return addrs, nil
+}
+
+// Len returns the number of the hostnames cached, including the expired ones
+// which haven't been evicted yet.
+func (c *DNSCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Flush removes all the cached hostnames, so that they're resolved again
+// by the next lookups.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*dnsCacheEntry)
+}
+
+// store caches the entry of the host unless it has expired,
+// in which case the entry cached before is kept.
+func (c *DNSCache) store(host string, e *dnsCacheEntry) {
+	now := time.Now()
+	if !now.Before(e.expire) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= dnsCacheMaxEntries {
+		for k, v := range c.entries {
+			if !now.Before(v.expire) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[host] = e
+}
+
+// DialContext returns a function which dials the address with the dialer after
+// resolving its host by the DNSCache. The resolved addresses are tried in order
+// until one of them is connected.
+func (c *DNSCache) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := c.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var conn net.Conn
+		for _, ip := range addrs {
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+				return conn, nil
+			}
+		}
+		if err == nil {
+			err = &net.DNSError{Err: "no such host", Name: host}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package netutils
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+type DNSCacheSuite struct{}
+
+func init() {
+	check.Suite(&DNSCacheSuite{})
+}
+
+// newTestDNSCache returns a DNSCache which resolves the hosts with the results,
+// and counts the lookups.
+func newTestDNSCache(ttl, negativeTTL time.Duration, results map[string][]string, lookups *int32) *DNSCache {
+	dc := NewDNSCache(ttl, negativeTTL)
+	dc.lookup = func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(lookups, 1)
+		if addrs, ok := results[host]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	return dc
+}
+
+func (suite *DNSCacheSuite) TestLookupHost(c *check.C) {
+	var lookups int32
+	results := map[string][]string{"peer": {"10.0.0.1"}}
+	dc := newTestDNSCache(time.Hour, time.Hour, results, &lookups)
+	ctx := context.Background()
+
+	// the IP isn't resolved
+	addrs, err := dc.LookupHost(ctx, "127.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Check(addrs, check.DeepEquals, []string{"127.0.0.1"})
+	c.Check(atomic.LoadInt32(&lookups), check.Equals, int32(0))
+
+	// positive
+	for i := 0; i < 2; i++ {
+		addrs, err = dc.LookupHost(ctx, "peer")
+		c.Assert(err, check.IsNil)
+		c.Check(addrs, check.DeepEquals, []string{"10.0.0.1"})
+	}
+	c.Check(atomic.LoadInt32(&lookups), check.Equals, int32(1))
+
+	// negative
+	for i := 0; i < 2; i++ {
+		_, err = dc.LookupHost(ctx, "unknown")
+		c.Check(err, check.NotNil)
+	}
+	c.Check(atomic.LoadInt32(&lookups), check.Equals, int32(2))
+
+	// the failure caused by the canceled context isn't cached
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	dc.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return nil, ctx.Err()
+	}
+	_, err = dc.LookupHost(canceled, "other")
+	c.Check(err, check.NotNil)
+	_, ok := dc.entries["other"]
+	c.Check(ok, check.Equals, false)
+}
+
+func (suite *DNSCacheSuite) TestLookupHostExpired(c *check.C) {
+	var lookups int32
+	results := map[string][]string{"peer": {"10.0.0.1"}}
+	dc := newTestDNSCache(time.Hour, 0, results, &lookups)
+	ctx := context.Background()
+
+	_, err := dc.LookupHost(ctx, "peer")
+	c.Assert(err, check.IsNil)
+
+	// the addresses resolved last time are used if the host fails to be resolved
+	dc.entries["peer"].expire = time.Now()
+	delete(results, "peer")
+	addrs, err := dc.LookupHost(ctx, "peer")
+	c.Assert(err, check.IsNil)
+	c.Check(addrs, check.DeepEquals, []string{"10.0.0.1"})
+	c.Check(atomic.LoadInt32(&lookups), check.Equals, int32(2))
+
+	// the new addresses are cached once the host is resolved again
+	results["peer"] = []string{"10.0.0.2"}
+	addrs, err = dc.LookupHost(ctx, "peer")
+	c.Assert(err, check.IsNil)
+	c.Check(addrs, check.DeepEquals, []string{"10.0.0.2"})
+
+	// the failure isn't cached without the negative ttl
+	for i := 0; i < 2; i++ {
+		_, err = dc.LookupHost(ctx, "unknown")
+		c.Check(err, check.NotNil)
+	}
+	c.Check(atomic.LoadInt32(&lookups), check.Equals, int32(5))
+}
+
+func (suite *DNSCacheSuite) TestFlush(c *check.C) {
+	var lookups int32
+	results := map[string][]string{"peer": {"10.0.0.1"}}
+	dc := newTestDNSCache(time.Hour, time.Hour, results, &lookups)
+	ctx := context.Background()
+
+	_, err := dc.LookupHost(ctx, "peer")
+	c.Assert(err, check.IsNil)
+	_, err = dc.LookupHost(ctx, "unknown")
+	c.Check(err, check.NotNil)
+	c.Check(dc.Len(), check.Equals, 2)
+
+	dc.Flush()
+	c.Check(dc.Len(), check.Equals, 0)
+	_, err = dc.LookupHost(ctx, "peer")
+	c.Assert(err, check.IsNil)
+	c.Check(atomic.LoadInt32(&lookups), check.Equals, int32(3))
+}
+
+func (suite *DNSCacheSuite) TestDNSCacheDialContext(c *check.C) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	var lookups int32
+	// the first address refuses the connection since nothing listens on it
+	results := map[string][]string{"peer": {"127.0.0.2", "127.0.0.1"}}
+	dc := newTestDNSCache(time.Hour, time.Hour, results, &lookups)
+	dial := dc.DialContext(&net.Dialer{Timeout: time.Second})
+
+	conn, err := dial(context.Background(), "tcp", net.JoinHostPort("peer", port))
+	c.Assert(err, check.IsNil)
+	c.Check(conn.RemoteAddr().String(), check.Equals, ln.Addr().String())
+	conn.Close()
+
+	_, err = dial(context.Background(), "tcp", net.JoinHostPort("unknown", port))
+	c.Check(err, check.NotNil)
+	_, err = dial(context.Background(), "tcp", "peer")
+	c.Check(err, check.NotNil)
+}
+
+func (suite *DNSCacheSuite) TestGetDNSCache(c *check.C) {
+	c.Check(GetDNSCache(0, 0), check.IsNil)
+	dc := GetDNSCache(time.Minute, time.Second)
+	c.Assert(dc, check.NotNil)
+	c.Check(GetDNSCache(time.Minute, time.Second), check.Equals, dc)
+	c.Check(GetDNSCache(time.Minute, 0) == dc, check.Equals, false)
+	c.Check(dc.ttl, check.Equals, time.Minute)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package netutils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// DefaultConnectionAttemptDelay is the delay recommended by RFC 8305 after which
+// the connection attempt to the next address is started if the previous one
+// hasn't finished.
+const DefaultConnectionAttemptDelay = 250 * time.Millisecond
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// DialRace dials the addresses with the happy eyeballs algorithm of RFC 8305 and
+// returns the first established connection, the others are closed. The addresses
+// are host:port pairs, and they're reordered by InterleaveFamilies before dialing.
+// The attempt to the next address is started once the previous one fails or
+// doesn't finish within the delay, and the error of the first failed attempt is
+// returned if none of them succeeds.
+func DialRace(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	network string, addrs []string, delay time.Duration) (net.Conn, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no address to dial")
+	}
+	addrs = InterleaveFamilies(addrs)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(addrs))
+	next, pending := 0, 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dial(ctx, network, addr)
+			results <- dialResult{conn: conn, err: err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go closeLosers(results, pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(addrs) {
+				start()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				timer.Reset(delay)
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+// closeLosers closes the connections established by the n pending attempts
+// which lost the race.
+func closeLosers(results <-chan dialResult, n int) {
+	for i := 0; i < n; i++ {
+		if r := <-results; r.conn != nil {
+			r.conn.Close()
+		}
+	}
+}
+
+// InterleaveFamilies reorders the host:port addresses to alternate between the address
+// families as RFC 8305 suggests, starting with the family of the first address and
+// keeping the order of the addresses in each family. The hostnames are treated as
+// the addresses of the IPv4 family.
+func InterleaveFamilies(addrs []string) []string {
+	var v4, v6 []string
+	for _, addr := range addrs {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+	if len(v4) == 0 || len(v6) == 0 {
+		return addrs
+	}
+
+	first, second := v4, v6
+	if v6[0] == addrs[0] {
+		first, second = v6, v4
+	}
+	result := make([]string, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			result = append(result, first[i])
+		}
+		if i < len(second) {
+			result = append(result, second[i])
+		}
+	}
+	return result
+}
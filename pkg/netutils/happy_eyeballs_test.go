@@ -0,0 +1,82 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package netutils
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+type HappyEyeballsSuite struct{}
+
+func init() {
+	check.Suite(&HappyEyeballsSuite{})
+}
+
+func (suite *HappyEyeballsSuite) TestInterleaveFamilies(c *check.C) {
+	c.Check(InterleaveFamilies([]string{"10.0.0.1:80", "10.0.0.2:80", "[fd00::1]:80", "[fd00::2]:80", "[fd00::3]:80"}),
+		check.DeepEquals, []string{"10.0.0.1:80", "[fd00::1]:80", "10.0.0.2:80", "[fd00::2]:80", "[fd00::3]:80"})
+	c.Check(InterleaveFamilies([]string{"[fd00::1]:80", "10.0.0.1:80", "[fd00::2]:80", "peer:80"}),
+		check.DeepEquals, []string{"[fd00::1]:80", "10.0.0.1:80", "[fd00::2]:80", "peer:80"})
+	c.Check(InterleaveFamilies([]string{"10.0.0.2:80", "10.0.0.1:80"}),
+		check.DeepEquals, []string{"10.0.0.2:80", "10.0.0.1:80"})
+}
+
+func (suite *HappyEyeballsSuite) TestDialRace(c *check.C) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer ln.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	dialer := &net.Dialer{Timeout: time.Second}
+	// the connection to the blackhole hangs until the attempt is canceled
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == "blackhole:80" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	// the next address is dialed after the delay if the previous one hangs
+	start := time.Now()
+	conn, err := DialRace(context.Background(), dial, "tcp", []string{"blackhole:80", ln.Addr().String()}, 50*time.Millisecond)
+	c.Assert(err, check.IsNil)
+	c.Check(conn.RemoteAddr().String(), check.Equals, ln.Addr().String())
+	c.Check(time.Since(start) >= 50*time.Millisecond, check.Equals, true)
+	conn.Close()
+
+	// the next address is dialed immediately if the previous one fails
+	start = time.Now()
+	conn, err = DialRace(context.Background(), dial, "tcp", []string{closedAddr, ln.Addr().String()}, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Check(conn.RemoteAddr().String(), check.Equals, ln.Addr().String())
+	c.Check(time.Since(start) < 10*time.Second, check.Equals, true)
+	conn.Close()
+
+	_, err = DialRace(context.Background(), dial, "tcp", []string{closedAddr}, 50*time.Millisecond)
+	c.Check(err, check.NotNil)
+	_, err = DialRace(context.Background(), dial, "tcp", nil, 50*time.Millisecond)
+	c.Check(err, check.NotNil)
+}
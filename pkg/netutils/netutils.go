@@ -158,6 +158,8 @@ func GetIPAndPortFromNode(node string, defaultPort int) (string, int) {
 //     filter: key2
 // and then you will get the following value as the return:
 //     http://a.b.com/locate?key1=value1&key3=value3
+// A filter ending with '*' filters all the queries with the prefix before it,
+// such as 'X-Amz-*' for the queries of the AWS signed urls.
 func FilterURLParam(url string, filters []string) string {
 	rawUrls := strings.SplitN(url, "?", 2)
 	if len(filters) <= 0 || len(rawUrls) != 2 || strings.TrimSpace(rawUrls[1]) == "" {
@@ -168,7 +170,7 @@ func FilterURLParam(url string, filters []string) string {
 	var params []string
 	for _, param := range strings.Split(rawUrls[1], separator) {
 		kv := strings.SplitN(param, "=", 2)
-		if !(len(kv) >= 1 && isExist(filtersMap, kv[0])) {
+		if !(len(kv) >= 1 && (isExist(filtersMap, kv[0]) || hasFilterPrefix(filters, kv[0]))) {
 			params = append(params, param)
 		}
 	}
@@ -294,6 +296,16 @@ func isExist(mmap map[string]bool, key string) bool {
 	return false
 }
 
+// hasFilterPrefix returns whether the key matches any of the filters ending with '*'.
+func hasFilterPrefix(filters []string, key string) bool {
+	for _, f := range filters {
+		if strings.HasSuffix(f, "*") && strings.HasPrefix(key, strings.TrimSuffix(f, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
 // CalculateTimeout calculates the timeout(in seconds) according to the fileLength and the min rate of network.
 //
 // The 0 will be returned when both minRate and defaultMinRate both are <=0.
@@ -120,6 +120,16 @@ func (suite *NetUtilSuite) TestFilterURLParam(c *check.C) {
 			filter:   []string{"key1"},
 			expected: "http://www.a.b.com?key2=value2",
 		},
+		{
+			url:      "http://www.a.b.com?X-Amz-Date=1&key=value&X-Amz-Signature=2",
+			filter:   []string{"X-Amz-*"},
+			expected: "http://www.a.b.com?key=value",
+		},
+		{
+			url:      "http://www.a.b.com?key1=value1&key2=value2",
+			filter:   []string{"*"},
+			expected: "http://www.a.b.com",
+		},
 	}
 	for _, v := range cases {
 		result := FilterURLParam(v.url, v.filter)
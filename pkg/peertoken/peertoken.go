@@ -0,0 +1,45 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package peertoken signs and verifies the tokens which bind the peers to their nodes,
+// so that supernode can reject the requests of the processes impersonating the peers.
+package peertoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Header is the http header which carries the token of the node in the requests
+// from dfget to supernode.
+const Header = "X-Dragonfly-Peer-Token"
+
+// Sign returns the token of the node with the ip, which is the hex encoded
+// HMAC-SHA256 of the ip with the secret shared by the supernodes.
+func Sign(secret, ip string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the token is signed for the node with the ip by the secret.
+func Verify(secret, ip, token string) bool {
+	if token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(Sign(secret, ip)))
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package peertoken
+
+import (
+	"testing"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type PeerTokenSuite struct{}
+
+func init() {
+	check.Suite(&PeerTokenSuite{})
+}
+
+func (suite *PeerTokenSuite) TestVerify(c *check.C) {
+	token := Sign("secret", "10.0.0.1")
+	c.Check(token, check.HasLen, 64)
+	c.Check(Verify("secret", "10.0.0.1", token), check.Equals, true)
+	c.Check(Verify("secret", "10.0.0.2", token), check.Equals, false)
+	c.Check(Verify("other", "10.0.0.1", token), check.Equals, false)
+	c.Check(Verify("secret", "10.0.0.1", ""), check.Equals, false)
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package printer
+
+// zhCatalog is the Simplified Chinese translations of the user-facing messages.
+// The verbs of a translation can be reordered with the explicit argument indexes such as %[2]s.
+var zhCatalog = map[string]string{
+	"dfget version:%s":   "dfget 版本:%s",
+	"workspace:%s":       "工作目录:%s",
+	"sign:%s":            "签名:%s",
+	"get user error: %s": "获取用户失败: %s",
+
+	"client:%s connected to node:%s":                                             "客户端:%s 已连接到节点:%s",
+	"migrated to node:%s":                                                        "已迁移到节点:%s",
+	"start download by dragonfly...":                                             "开始通过 dragonfly 下载...",
+	"start download %s from the source station":                                  "开始从源站下载 %s",
+	"failed to download by dragonfly: %v, and start try to download from source": "通过 dragonfly 下载失败: %v, 开始尝试从源站下载",
+
+	"target %s already exists and matches, skip downloading": "目标文件 %s 已存在且一致, 跳过下载",
+	"target %s matches the task %s":                          "目标文件 %s 与任务 %s 一致",
+	"differ: bytes %s":                                       "不一致: 字节 %s",
+
+	"download SUCCESS cost:%.3fs length:%d reason:%d":           "下载成功 耗时:%.3fs 长度:%d 原因:%d",
+	"download FAIL(%d) cost:%.3fs length:%d reason:%d error:%v": "下载失败(%d) 耗时:%.3fs 长度:%d 原因:%d 错误:%v",
+
+	"summary cost:%.3fs speed:%.3fMB/s peer:%d supernode:%d source:%d retries:%d verification:%s": "汇总 耗时:%.3fs 速度:%.3fMB/s 节点:%d 超级节点:%d 源站:%d 重试:%d 校验:%s",
+
+	"export %d task files to %s":       "已导出 %d 个任务文件到 %s",
+	"import %d task files into %s":     "已导入 %d 个任务文件到 %s",
+	"collect %d items from %s into %s": "已从 %[2]s 收集 %[1]d 项到 %[3]s",
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package printer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+/* locales */
+const (
+	// LocaleAuto detects the locale from the environment variables
+	// LC_ALL, LC_MESSAGES and LANG.
+	LocaleAuto = "auto"
+
+	// LocaleEN outputs the messages in English.
+	LocaleEN = "en"
+
+	// LocaleZH outputs the messages in Simplified Chinese.
+	LocaleZH = "zh"
+)
+
+// catalogs maps a locale to the translations of the message formats in English.
+// The messages missing in the catalog of a locale are output in English.
+var catalogs = map[string]map[string]string{
+	LocaleZH: zhCatalog,
+}
+
+// catalog is the translations of the current locale, it's nil for English.
+var catalog map[string]string
+
+// SetLocale selects the locale of the user-facing messages.
+// The locale is detected from the environment if it's empty or LocaleAuto.
+//
+// Only the messages output on console are translated, the logs are always in English.
+func SetLocale(locale string) error {
+	if locale == "" || locale == LocaleAuto {
+		locale = DetectLocale()
+	}
+	if locale != LocaleEN && catalogs[locale] == nil {
+		return fmt.Errorf("unknown locale: %s, must be %s/%s/%s", locale, LocaleAuto, LocaleEN, LocaleZH)
+	}
+
+	mu.Lock()
+	catalog = catalogs[locale]
+	mu.Unlock()
+	return nil
+}
+
+// DetectLocale returns the supported locale according to the environment variables
+// in the order of LC_ALL, LC_MESSAGES and LANG, such as zh_CN.UTF-8.
+// It returns LocaleEN if none of them is supported.
+func DetectLocale() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		parts := strings.FieldsFunc(os.Getenv(key), func(r rune) bool {
+			return r == '_' || r == '-' || r == '.' || r == '@'
+		})
+		if len(parts) == 0 {
+			continue
+		}
+		if lang := strings.ToLower(parts[0]); catalogs[lang] != nil {
+			return lang
+		}
+		return LocaleEN
+	}
+	return LocaleEN
+}
+
+// Translate returns the translation of the message format in the current locale.
+func Translate(format string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if t, ok := catalog[format]; ok {
+		return t
+	}
+	return format
+}
+
+// Sprintf formats according to the translation of the format specifier.
+func Sprintf(format string, a ...interface{}) string {
+	return fmt.Sprintf(Translate(format), a...)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package printer
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/go-check/check"
+)
+
+func (s *PrinterTestSuite) TestSetLocale(c *check.C) {
+	origin := Get()
+	defer SetPrinter(origin)
+	defer SetLocale(LocaleEN)
+
+	buf := &bytes.Buffer{}
+	SetPrinter(&StdPrinter{Out: buf})
+
+	c.Assert(SetLocale(LocaleZH), check.IsNil)
+	Printf("workspace:%s", "/tmp")
+	Printf("unknown:%d", 1)
+	c.Check(buf.String(), check.Equals, "工作目录:/tmp\nunknown:1\n")
+	c.Check(Sprintf("collect %d items from %s into %s", 2, "a", "b"), check.Equals, "已从 a 收集 2 项到 b")
+
+	c.Assert(SetLocale(LocaleEN), check.IsNil)
+	c.Check(Sprintf("workspace:%s", "/tmp"), check.Equals, "workspace:/tmp")
+
+	c.Check(SetLocale("fr"), check.NotNil)
+}
+
+func (s *PrinterTestSuite) TestDetectLocale(c *check.C) {
+	keys := []string{"LC_ALL", "LC_MESSAGES", "LANG"}
+	origin := make(map[string]string)
+	for _, k := range keys {
+		origin[k] = os.Getenv(k)
+		os.Unsetenv(k)
+	}
+	defer func() {
+		for k, v := range origin {
+			os.Setenv(k, v)
+		}
+	}()
+
+	c.Check(DetectLocale(), check.Equals, LocaleEN)
+	os.Setenv("LANG", "zh_CN.UTF-8")
+	c.Check(DetectLocale(), check.Equals, LocaleZH)
+	os.Setenv("LC_MESSAGES", "C")
+	c.Check(DetectLocale(), check.Equals, LocaleEN)
+	os.Setenv("LC_ALL", "zh_TW")
+	c.Check(DetectLocale(), check.Equals, LocaleZH)
+}
+
+// TestZHCatalog checks that the translations keep the verbs of the original formats.
+func (s *PrinterTestSuite) TestZHCatalog(c *check.C) {
+	for format, t := range zhCatalog {
+		c.Check(strings.Count(t, "%"), check.Equals, strings.Count(format, "%"), check.Commentf(format))
+	}
+}
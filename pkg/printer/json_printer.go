@@ -0,0 +1,103 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package printer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONLine is a line output by JSONPrinter.
+type JSONLine struct {
+	Time      string `json:"time"`
+	Type      string `json:"type"`
+	Msg       string `json:"msg,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+}
+
+/* the types of JSONLine */
+const (
+	JSONTypeMessage  = "message"
+	JSONTypeProgress = "progress"
+	JSONTypeFinish   = "finish"
+)
+
+// JSONPrinter outputs one JSON object per line which is easy to
+// be parsed by other programs.
+type JSONPrinter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+
+	// interval is the min interval between two progress lines.
+	interval     time.Duration
+	lastProgress time.Time
+}
+
+var _ Printer = &JSONPrinter{}
+
+// NewJSONPrinter creates a JSONPrinter.
+func NewJSONPrinter(out io.Writer) *JSONPrinter {
+	return &JSONPrinter{
+		enc:      json.NewEncoder(out),
+		interval: time.Second,
+	}
+}
+
+// Print outputs msg as a message line.
+func (jp *JSONPrinter) Print(msg string) {
+	jp.write(&JSONLine{Type: JSONTypeMessage, Msg: strings.TrimRight(msg, "\n")})
+}
+
+// Println outputs msg as a message line.
+func (jp *JSONPrinter) Println(msg string) {
+	jp.Print(msg)
+}
+
+// Printf outputs the formatted msg as a message line.
+func (jp *JSONPrinter) Printf(format string, a ...interface{}) {
+	jp.Print(fmt.Sprintf(format, a...))
+}
+
+// Progress outputs a progress line at most once per interval.
+func (jp *JSONPrinter) Progress(completed, total int64) {
+	jp.mu.Lock()
+	now := time.Now()
+	if now.Sub(jp.lastProgress) < jp.interval && completed != total {
+		jp.mu.Unlock()
+		return
+	}
+	jp.lastProgress = now
+	jp.mu.Unlock()
+	jp.write(&JSONLine{Type: JSONTypeProgress, Completed: completed, Total: total})
+}
+
+// FinishProgress outputs a finish line.
+func (jp *JSONPrinter) FinishProgress() {
+	jp.write(&JSONLine{Type: JSONTypeFinish})
+}
+
+func (jp *JSONPrinter) write(line *JSONLine) {
+	line.Time = time.Now().Format(time.RFC3339Nano)
+	jp.mu.Lock()
+	jp.enc.Encode(line)
+	jp.mu.Unlock()
+}
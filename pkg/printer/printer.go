@@ -16,24 +16,118 @@
 
 // Package printer carries a stdout fd. It helps caller to print message on console
 // even if it has set the log fd redirect.
+//
+// The output is pluggable: the global printer can be replaced by SetPrinter,
+// for example with a QuietPrinter when used as a library.
+// The formats passed to Printf are translated to the locale selected by SetLocale.
 package printer
 
 import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
+)
+
+// Printer outputs the user-facing messages and the download progress.
+type Printer interface {
+	// Print outputs msg directly.
+	Print(msg string)
+
+	// Println outputs msg and a newline.
+	Println(msg string)
+
+	// Printf formats according to a format specifier and appends a newline.
+	Printf(format string, a ...interface{})
+
+	// Progress reports that completed bytes of total have been downloaded.
+	// The total is less than 0 if the length is unknown.
+	Progress(completed, total int64)
+
+	// FinishProgress ends the progress output.
+	FinishProgress()
+}
+
+/* output formats */
+const (
+	// FormatAuto selects the progress bar when the output is a terminal
+	// and a progress bar is required, otherwise the plain text.
+	FormatAuto = "auto"
+
+	// FormatText outputs plain text.
+	FormatText = "text"
+
+	// FormatJSON outputs one JSON object per line.
+	FormatJSON = "json"
+
+	// FormatQuiet outputs nothing.
+	FormatQuiet = "quiet"
 )
 
 var (
-	// Printer is global StdPrinter.
-	Printer = &StdPrinter{Out: os.Stdout}
+	mu sync.RWMutex
+
+	// std is the global Printer.
+	std Printer = &StdPrinter{Out: os.Stdout}
 )
 
+// SetPrinter replaces the global Printer.
+// A nil p is treated as a QuietPrinter.
+func SetPrinter(p Printer) {
+	if p == nil {
+		p = &QuietPrinter{}
+	}
+	mu.Lock()
+	std = p
+	mu.Unlock()
+}
+
+// Get returns the global Printer.
+func Get() Printer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return std
+}
+
+// New creates a Printer according to the format.
+// The showBar indicates whether a progress bar is required, it only works
+// with FormatAuto and a terminal out.
+func New(format string, out *os.File, showBar bool) (Printer, error) {
+	switch format {
+	case FormatQuiet:
+		return &QuietPrinter{}, nil
+	case FormatJSON:
+		return NewJSONPrinter(out), nil
+	case FormatText:
+		return &StdPrinter{Out: out}, nil
+	case "", FormatAuto:
+		if showBar && IsTerminal(out) {
+			return NewProgressBarPrinter(out), nil
+		}
+		return &StdPrinter{Out: out}, nil
+	}
+	return nil, fmt.Errorf("unknown output format: %s", format)
+}
+
+// IsTerminal reports whether the f is a terminal.
+func IsTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
 // StdPrinter outputs info to console directly.
 type StdPrinter struct {
 	Out io.Writer
 }
 
+var _ Printer = &StdPrinter{}
+
 // Print outputs info to console directly.
 func (sp *StdPrinter) Print(msg string) {
 	if sp.Out != nil {
@@ -55,23 +149,56 @@ func (sp *StdPrinter) Printf(format string, a ...interface{}) {
 	}
 }
 
+// Progress does nothing because the plain text doesn't show progress.
+func (sp *StdPrinter) Progress(completed, total int64) {
+}
+
+// FinishProgress does nothing.
+func (sp *StdPrinter) FinishProgress() {
+}
+
+// QuietPrinter discards all output.
+type QuietPrinter struct{}
+
+var _ Printer = &QuietPrinter{}
+
+// Print does nothing.
+func (qp *QuietPrinter) Print(msg string) {}
+
+// Println does nothing.
+func (qp *QuietPrinter) Println(msg string) {}
+
+// Printf does nothing.
+func (qp *QuietPrinter) Printf(format string, a ...interface{}) {}
+
+// Progress does nothing.
+func (qp *QuietPrinter) Progress(completed, total int64) {}
+
+// FinishProgress does nothing.
+func (qp *QuietPrinter) FinishProgress() {}
+
 // Print outputs info to console directly.
 func Print(msg string) {
-	if Printer.Out != nil {
-		fmt.Fprint(Printer.Out, msg)
-	}
+	Get().Print(msg)
 }
 
 // Println outputs info to console directly.
 func Println(msg string) {
-	if Printer.Out != nil {
-		fmt.Fprintln(Printer.Out, msg)
-	}
+	Get().Println(msg)
 }
 
-// Printf formats according to a format specifier.
+// Printf formats according to the translation of the format specifier
+// in the current locale.
 func Printf(format string, a ...interface{}) {
-	if Printer.Out != nil {
-		fmt.Fprintf(Printer.Out, format+"\n", a...)
-	}
+	Get().Printf(Translate(format), a...)
+}
+
+// Progress reports the download progress to the global Printer.
+func Progress(completed, total int64) {
+	Get().Progress(completed, total)
+}
+
+// FinishProgress ends the progress output of the global Printer.
+func FinishProgress() {
+	Get().FinishProgress()
 }
@@ -0,0 +1,131 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type PrinterTestSuite struct{}
+
+func init() {
+	check.Suite(&PrinterTestSuite{})
+}
+
+func (s *PrinterTestSuite) TestSetPrinter(c *check.C) {
+	origin := Get()
+	defer SetPrinter(origin)
+
+	buf := &bytes.Buffer{}
+	SetPrinter(&StdPrinter{Out: buf})
+	Printf("a:%d", 1)
+	Println("b")
+	Print("c")
+	Progress(1, 2)
+	c.Check(buf.String(), check.Equals, "a:1\nb\nc")
+
+	SetPrinter(nil)
+	_, ok := Get().(*QuietPrinter)
+	c.Check(ok, check.Equals, true)
+}
+
+func (s *PrinterTestSuite) TestNew(c *check.C) {
+	f, err := ioutil.TempFile("", "printer")
+	c.Assert(err, check.IsNil)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var cases = []struct {
+		format   string
+		showBar  bool
+		expected Printer
+	}{
+		{FormatAuto, true, &StdPrinter{}},
+		{FormatText, false, &StdPrinter{}},
+		{FormatJSON, false, &JSONPrinter{}},
+		{FormatQuiet, true, &QuietPrinter{}},
+	}
+	for _, v := range cases {
+		p, err := New(v.format, f, v.showBar)
+		c.Assert(err, check.IsNil)
+		c.Check(p, check.FitsTypeOf, v.expected)
+	}
+
+	_, err = New("unknown", f, false)
+	c.Check(err, check.NotNil)
+	c.Check(IsTerminal(f), check.Equals, false)
+}
+
+func (s *PrinterTestSuite) TestJSONPrinter(c *check.C) {
+	buf := &bytes.Buffer{}
+	jp := NewJSONPrinter(buf)
+	jp.Printf("hello %s", "world")
+	jp.Progress(1, 10)
+	// dropped because of the interval
+	jp.Progress(2, 10)
+	jp.Progress(10, 10)
+	jp.FinishProgress()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(len(lines), check.Equals, 4)
+	var expected = []JSONLine{
+		{Type: JSONTypeMessage, Msg: "hello world"},
+		{Type: JSONTypeProgress, Completed: 1, Total: 10},
+		{Type: JSONTypeProgress, Completed: 10, Total: 10},
+		{Type: JSONTypeFinish},
+	}
+	for i, l := range lines {
+		line := JSONLine{}
+		c.Assert(json.Unmarshal([]byte(l), &line), check.IsNil)
+		line.Time = ""
+		c.Check(line, check.DeepEquals, expected[i])
+	}
+}
+
+func (s *PrinterTestSuite) TestProgressBarPrinter(c *check.C) {
+	buf := &bytes.Buffer{}
+	pp := NewProgressBarPrinter(buf)
+	pp.Progress(5, 10)
+	pp.Println("msg")
+	pp.FinishProgress()
+
+	out := buf.String()
+	c.Check(strings.Contains(out, " 50% "), check.Equals, true)
+	c.Check(strings.Contains(out, "msg\n"), check.Equals, true)
+	c.Check(strings.HasSuffix(out, "\n"), check.Equals, true)
+}
+
+func (s *PrinterTestSuite) TestRenderProgressBar(c *check.C) {
+	line := renderProgressBar(512, 1024, time.Second)
+	c.Check(strings.HasPrefix(line, "["+strings.Repeat("=", 20)+">"), check.Equals, true)
+	c.Check(strings.HasSuffix(line, "512.0B/1.0KB 512.0B/s ETA 1s"), check.Equals, true)
+
+	c.Check(renderProgressBar(2048, -1, time.Second), check.Equals, "2.0KB 2.0KB/s")
+	c.Check(strings.HasSuffix(renderProgressBar(0, 10, 0), "ETA --"), check.Equals, true)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package printer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth = 40
+
+	// progressRefreshInterval is the min interval to redraw the bar.
+	progressRefreshInterval = 200 * time.Millisecond
+)
+
+// ProgressBarPrinter draws a progress bar with ETA in the last line of
+// a terminal, and the messages are printed above it.
+type ProgressBarPrinter struct {
+	mu  sync.Mutex
+	out io.Writer
+
+	start    time.Time
+	lastDraw time.Time
+	// drawn indicates whether the bar is on the screen now.
+	drawn bool
+	// completed and total record the latest progress.
+	completed int64
+	total     int64
+}
+
+var _ Printer = &ProgressBarPrinter{}
+
+// NewProgressBarPrinter creates a ProgressBarPrinter.
+func NewProgressBarPrinter(out io.Writer) *ProgressBarPrinter {
+	return &ProgressBarPrinter{
+		out:   out,
+		start: time.Now(),
+		total: -1,
+	}
+}
+
+// Print outputs msg above the progress bar.
+func (pp *ProgressBarPrinter) Print(msg string) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.clearLocked()
+	fmt.Fprint(pp.out, msg)
+	if pp.drawn {
+		pp.drawLocked()
+	}
+}
+
+// Println outputs msg above the progress bar.
+func (pp *ProgressBarPrinter) Println(msg string) {
+	pp.Print(msg + "\n")
+}
+
+// Printf outputs the formatted msg above the progress bar.
+func (pp *ProgressBarPrinter) Printf(format string, a ...interface{}) {
+	pp.Print(fmt.Sprintf(format+"\n", a...))
+}
+
+// Progress redraws the progress bar.
+func (pp *ProgressBarPrinter) Progress(completed, total int64) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.completed = completed
+	pp.total = total
+	now := time.Now()
+	if pp.drawn && now.Sub(pp.lastDraw) < progressRefreshInterval && completed != total {
+		return
+	}
+	pp.lastDraw = now
+	pp.clearLocked()
+	pp.drawLocked()
+	pp.drawn = true
+}
+
+// FinishProgress draws the final state of the bar and moves to a new line.
+func (pp *ProgressBarPrinter) FinishProgress() {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if !pp.drawn {
+		return
+	}
+	pp.clearLocked()
+	pp.drawLocked()
+	fmt.Fprint(pp.out, "\n")
+	pp.drawn = false
+}
+
+func (pp *ProgressBarPrinter) clearLocked() {
+	if pp.drawn {
+		fmt.Fprint(pp.out, "\r\033[K")
+	}
+}
+
+func (pp *ProgressBarPrinter) drawLocked() {
+	fmt.Fprint(pp.out, renderProgressBar(pp.completed, pp.total, time.Since(pp.start)))
+}
+
+// renderProgressBar returns a line like:
+// [=====================>                  ]  55% 22.0MB/40.0MB 10.2MB/s ETA 2s
+func renderProgressBar(completed, total int64, cost time.Duration) string {
+	var speed float64
+	if cost > 0 {
+		speed = float64(completed) / cost.Seconds()
+	}
+
+	if total <= 0 {
+		return fmt.Sprintf("%s %s/s", formatBytes(float64(completed)), formatBytes(speed))
+	}
+
+	if completed > total {
+		completed = total
+	}
+	percent := float64(completed) / float64(total)
+	filled := int(percent * progressBarWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+
+	eta := "--"
+	if speed > 0 {
+		eta = (time.Duration(float64(total-completed)/speed) * time.Second).Round(time.Second).String()
+	}
+	return fmt.Sprintf("[%s] %3d%% %s/%s %s/s ETA %s", bar, int(percent*100),
+		formatBytes(float64(completed)), formatBytes(float64(total)), formatBytes(speed), eta)
+}
+
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
+
+// NewProgressReader returns a reader which reports the progress to the global
+// Printer when reading from r.
+func NewProgressReader(r io.Reader, total int64) io.Reader {
+	return &progressReader{r: r, total: total}
+}
+
+type progressReader struct {
+	r         io.Reader
+	completed int64
+	total     int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.completed += int64(n)
+		Progress(pr.completed, pr.total)
+	}
+	return n, err
+}
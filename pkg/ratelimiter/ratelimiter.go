@@ -18,6 +18,7 @@ package ratelimiter
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/util"
@@ -66,11 +67,17 @@ func (rl *RateLimiter) AcquireNonBlocking(token int64) int64 {
 func (rl *RateLimiter) SetRate(rate int64) {
 	if rl.rate != rate {
 		rl.capacity = rate
-		rl.rate = rate
+		atomic.StoreInt64(&rl.rate, rate)
 		rl.computeRatePerWindow()
 	}
 }
 
+// Rate returns how many tokens are generated per second, 0 means that the rate isn't limited.
+// It doesn't wait for the blocking acquisitions, so it's safe to call at any time.
+func (rl *RateLimiter) Rate() int64 {
+	return atomic.LoadInt64(&rl.rate)
+}
+
 func (rl *RateLimiter) acquire(token int64, blocking bool) int64 {
 	if rl.capacity <= 0 || token < 1 {
 		return token
@@ -51,6 +51,7 @@ func (suite *RateLimiterSuite) TestNewRateLimiter(c *check.C) {
 		c.Assert(rl.capacity, check.Equals, cc.e.rate)
 		c.Assert(rl.bucket, check.Equals, int64(0))
 		c.Assert(rl.rate, check.Equals, cc.e.rate)
+		c.Assert(rl.Rate(), check.Equals, cc.e.rate)
 		c.Assert(rl.window, check.Equals, cc.e.window)
 		c.Assert(rl.ratePerWindow, check.Equals, cc.e.ratePerWindow)
 	}
@@ -76,6 +77,7 @@ func (suite *RateLimiterSuite) TestRateLimiter_SetRate(c *check.C) {
 		rl.SetRate(cc.nr)
 		c.Assert(rl.capacity, check.Equals, cc.e.rate)
 		c.Assert(rl.rate, check.Equals, cc.e.rate)
+		c.Assert(rl.Rate(), check.Equals, cc.e.rate)
 		c.Assert(rl.window, check.Equals, cc.e.window)
 		c.Assert(rl.ratePerWindow, check.Equals, cc.e.ratePerWindow)
 	}
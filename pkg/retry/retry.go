@@ -0,0 +1,159 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package retry provides the retry policy of the failed operations, with which
+// the interval between two attempts grows exponentially and is randomized by a jitter,
+// so that the clients which fail at the same time don't retry in lockstep.
+package retry
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxAttempts is the default max number of attempts including the first one.
+	DefaultMaxAttempts = 3
+
+	// DefaultBackoffBase is the default interval before the first retry.
+	DefaultBackoffBase = 300 * time.Millisecond
+
+	// DefaultBackoffCap is the default max interval between two attempts.
+	DefaultBackoffCap = 5 * time.Second
+
+	// DefaultJitter is the default fraction by which the intervals are randomized.
+	DefaultJitter = 0.8
+)
+
+// Policy describes how a failed operation is retried.
+// The zero value makes only one attempt without any retry.
+type Policy struct {
+	// MaxAttempts is the max number of attempts including the first one.
+	// The operation isn't retried if it's not greater than 1.
+	MaxAttempts int `yaml:"maxAttempts,omitempty" json:"maxAttempts,omitempty"`
+
+	// BackoffBase is the interval before the first retry, and it's doubled for every next retry.
+	BackoffBase time.Duration `yaml:"backoffBase,omitempty" json:"backoffBase,omitempty"`
+
+	// BackoffCap is the max interval between two attempts, the intervals aren't capped if it's 0.
+	BackoffCap time.Duration `yaml:"backoffCap,omitempty" json:"backoffCap,omitempty"`
+
+	// Jitter is the fraction in [0, 1] by which the intervals are randomized, an interval d
+	// is chosen from [d*(1-Jitter), d*(1+Jitter)] uniformly.
+	Jitter float64 `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+}
+
+// DefaultPolicy returns the default retry policy.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: DefaultMaxAttempts,
+		BackoffBase: DefaultBackoffBase,
+		BackoffCap:  DefaultBackoffCap,
+		Jitter:      DefaultJitter,
+	}
+}
+
+// Validate checks whether the policy is valid.
+func (p Policy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "maxAttempts %d", p.MaxAttempts)
+	}
+	if p.BackoffBase < 0 || p.BackoffCap < 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "backoffBase %v and backoffCap %v must not be negative",
+			p.BackoffBase, p.BackoffCap)
+	}
+	if p.BackoffCap > 0 && p.BackoffCap < p.BackoffBase {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "backoffCap %v is less than backoffBase %v",
+			p.BackoffCap, p.BackoffBase)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "jitter %v must be in [0, 1]", p.Jitter)
+	}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+// The fields which are absent keep their values.
+func (p *Policy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type policy Policy
+	v := policy(*p)
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	if err := Policy(v).Validate(); err != nil {
+		return err
+	}
+	*p = Policy(v)
+	return nil
+}
+
+// Backoff returns the interval before the n-th retry, n starts from 1.
+func (p Policy) Backoff(n int) time.Duration {
+	if n < 1 || p.BackoffBase <= 0 {
+		return 0
+	}
+	d := p.BackoffBase
+	for i := 1; i < n && (p.BackoffCap <= 0 || d < p.BackoffCap); i++ {
+		d *= 2
+	}
+	if p.BackoffCap > 0 && d > p.BackoffCap {
+		d = p.BackoffCap
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 - p.Jitter + 2*p.Jitter*rand.Float64()))
+	}
+	return d
+}
+
+// Do calls f until it succeeds or the attempts are used up, and sleeps for the
+// backoff between two attempts. The attempt passed to f starts from 1.
+// It returns the error of the last attempt, and it stops retrying if f returns
+// an error wrapped by Stop.
+func (p Policy) Do(f func(attempt int) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = f(attempt); err == nil {
+			return nil
+		}
+		if e, ok := err.(*stopError); ok {
+			return e.err
+		}
+		if attempt >= p.MaxAttempts {
+			return err
+		}
+		time.Sleep(p.Backoff(attempt))
+	}
+}
+
+// Stop wraps the err to make Do stop retrying and return the err.
+func Stop(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &stopError{err: err}
+}
+
+type stopError struct {
+	err error
+}
+
+func (e *stopError) Error() string {
+	return e.err.Error()
+}
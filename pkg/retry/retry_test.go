@@ -0,0 +1,116 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+	"gopkg.in/yaml.v2"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type RetrySuite struct{}
+
+func init() {
+	check.Suite(&RetrySuite{})
+}
+
+func (suite *RetrySuite) TestBackoff(c *check.C) {
+	p := Policy{BackoffBase: 100 * time.Millisecond, BackoffCap: time.Second}
+	var cases = []struct {
+		n        int
+		expected time.Duration
+	}{
+		{0, 0},
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, v := range cases {
+		c.Check(p.Backoff(v.n), check.Equals, v.expected, check.Commentf("n:%d", v.n))
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(2)
+		c.Check(d >= 100*time.Millisecond && d <= 300*time.Millisecond, check.Equals, true, check.Commentf("%v", d))
+	}
+	c.Check(Policy{}.Backoff(1), check.Equals, time.Duration(0))
+}
+
+func (suite *RetrySuite) TestDo(c *check.C) {
+	p := Policy{MaxAttempts: 3, BackoffBase: time.Millisecond}
+
+	var attempts []int
+	err := p.Do(func(attempt int) error {
+		attempts = append(attempts, attempt)
+		if attempt < 2 {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	c.Check(err, check.IsNil)
+	c.Check(attempts, check.DeepEquals, []int{1, 2})
+
+	count := 0
+	err = p.Do(func(attempt int) error {
+		count++
+		return fmt.Errorf("failed %d", attempt)
+	})
+	c.Check(err, check.ErrorMatches, "failed 3")
+	c.Check(count, check.Equals, 3)
+
+	count = 0
+	err = p.Do(func(attempt int) error {
+		count++
+		return Stop(fmt.Errorf("permanent"))
+	})
+	c.Check(err, check.ErrorMatches, "permanent")
+	c.Check(count, check.Equals, 1)
+
+	// the zero policy makes only one attempt
+	count = 0
+	Policy{}.Do(func(attempt int) error {
+		count++
+		return fmt.Errorf("failed")
+	})
+	c.Check(count, check.Equals, 1)
+}
+
+func (suite *RetrySuite) TestUnmarshalYAML(c *check.C) {
+	p := DefaultPolicy()
+	c.Assert(yaml.Unmarshal([]byte("maxAttempts: 5\nbackoffBase: 1s"), &p), check.IsNil)
+	c.Check(p, check.DeepEquals, Policy{
+		MaxAttempts: 5,
+		BackoffBase: time.Second,
+		BackoffCap:  DefaultBackoffCap,
+		Jitter:      DefaultJitter,
+	})
+
+	for _, s := range []string{"maxAttempts: -1", "jitter: 2", "backoffBase: 10s", "backoffCap: -1s"} {
+		p := DefaultPolicy()
+		c.Check(yaml.Unmarshal([]byte(s), &p), check.NotNil, check.Commentf(s))
+	}
+}
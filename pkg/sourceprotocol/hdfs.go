@@ -0,0 +1,189 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sourceprotocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+
+	"github.com/pkg/errors"
+)
+
+const defaultWebHDFSPort = 9870
+
+// HDFSConfig is the config of reading the hdfs:// urls by WebHDFS of the namenodes.
+type HDFSConfig struct {
+	// WebPort is the port of WebHDFS of the namenodes, the port of an url is ignored
+	// since it's usually the port of RPC.
+	// default: 9870
+	WebPort int `yaml:"webPort,omitempty" json:"webPort,omitempty"`
+
+	// TLS sets whether to request WebHDFS by https.
+	TLS bool `yaml:"tls,omitempty" json:"tls,omitempty"`
+
+	// User is the user reading the files with the simple authentication.
+	User string `yaml:"user,omitempty" json:"user,omitempty"`
+}
+
+// HDFSRoundTripper translates the requests of the hdfs:// urls into the requests of WebHDFS.
+// WebHDFS doesn't support the range requests and the validation, so they're emulated by
+// the status of the files: the ranges are read by the offset and the length, and the
+// ETag is derived from the length and the modification time of a file.
+type HDFSRoundTripper struct {
+	webPort int
+	scheme  string
+	user    string
+
+	client *httputils.Client
+}
+
+// fileStatus is the response of GETFILESTATUS of WebHDFS.
+type fileStatus struct {
+	FileStatus struct {
+		Length           int64  `json:"length"`
+		ModificationTime int64  `json:"modificationTime"`
+		Type             string `json:"type"`
+	} `json:"FileStatus"`
+}
+
+// NewHDFSRoundTripper creates an HDFSRoundTripper with the config, which may be nil.
+func NewHDFSRoundTripper(cfg *HDFSConfig) (*HDFSRoundTripper, error) {
+	if cfg == nil {
+		cfg = &HDFSConfig{}
+	}
+
+	rt := &HDFSRoundTripper{
+		webPort: cfg.WebPort,
+		scheme:  "http",
+		user:    cfg.User,
+		// the OPEN requests are redirected to the datanodes
+		client: newClient(),
+	}
+	if rt.webPort == 0 {
+		rt.webPort = defaultWebHDFSPort
+	}
+	if cfg.TLS {
+		rt.scheme = "https"
+	}
+	return rt, nil
+}
+
+// RoundTrip implements the http.RoundTripper.
+func (rt *HDFSRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, resp, err := rt.getFileStatus(req)
+	if err != nil || resp != nil {
+		return resp, err
+	}
+
+	length := status.FileStatus.Length
+	lastModified := time.Unix(0, status.FileStatus.ModificationTime*int64(time.Millisecond)).UTC()
+	header := make(http.Header)
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("ETag", fmt.Sprintf(`"%x-%x"`, length, status.FileStatus.ModificationTime))
+	header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	if notModified(req, header, lastModified) {
+		return newResponse(req, http.StatusNotModified, header, 0, nil), nil
+	}
+
+	code := http.StatusOK
+	offset, size := int64(0), length
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		ranges, err := httputils.GetRangeSE(rangeHeader, length)
+		if err != nil || len(ranges) != 1 || ranges[0].StartIndex >= length {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+			return newResponse(req, http.StatusRequestedRangeNotSatisfiable, header, 0, nil), nil
+		}
+		end := ranges[0].EndIndex
+		if end >= length {
+			end = length - 1
+		}
+		code = http.StatusPartialContent
+		offset, size = ranges[0].StartIndex, end-ranges[0].StartIndex+1
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end, length))
+	}
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	if req.Method == http.MethodHead {
+		return newResponse(req, code, header, size, nil), nil
+	}
+
+	query := url.Values{"op": {"OPEN"}, "offset": {strconv.FormatInt(offset, 10)}}
+	if code == http.StatusPartialContent {
+		query.Set("length", strconv.FormatInt(size, 10))
+	}
+	open, err := rt.do(req, query)
+	if err != nil {
+		return nil, err
+	}
+	if open.StatusCode != http.StatusOK {
+		return open, nil
+	}
+	return newResponse(req, code, header, size, open.Body), nil
+}
+
+// getFileStatus gets the status of the file from the namenode. The response of the
+// namenode is returned if the status isn't got successfully, such as 404.
+func (rt *HDFSRoundTripper) getFileStatus(req *http.Request) (*fileStatus, *http.Response, error) {
+	resp, err := rt.do(req, url.Values{"op": {"GETFILESTATUS"}})
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp, nil
+	}
+	defer resp.Body.Close()
+
+	status := &fileStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to decode the status of %s", req.URL)
+	}
+	if status.FileStatus.Type != "FILE" {
+		return nil, newResponse(req, http.StatusNotFound, nil, 0, nil), nil
+	}
+	return status, nil, nil
+}
+
+// do sends the request of the operation of WebHDFS on the file of req.
+func (rt *HDFSRoundTripper) do(req *http.Request, query url.Values) (*http.Response, error) {
+	if rt.user != "" {
+		query.Set("user.name", rt.user)
+	}
+	host := net.JoinHostPort(req.URL.Hostname(), strconv.Itoa(rt.webPort))
+	u := rt.scheme + "://" + host + "/webhdfs/v1" + escapePath(req.URL.Path) + "?" + query.Encode()
+
+	return rt.client.DoContext(req.Context(), http.MethodGet, u, nil, 0)
+}
+
+// notModified reports whether the file is not modified according to the conditional headers.
+func notModified(req *http.Request, header http.Header, lastModified time.Time) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return inm == header.Get("ETag") || inm == "*"
+	}
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sourceprotocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const defaultOSSEndpoint = "https://oss-cn-hangzhou.aliyuncs.com"
+
+// ossSubResources are the queries of the GET object requests which are signed.
+var ossSubResources = map[string]bool{
+	"versionId":                    true,
+	"response-cache-control":       true,
+	"response-content-disposition": true,
+	"response-content-encoding":    true,
+	"response-content-language":    true,
+	"response-content-type":        true,
+	"response-expires":             true,
+}
+
+// OSSConfig is the endpoint and the credentials of Aliyun OSS.
+// The credentials are read from the environment variables ALIBABA_CLOUD_ACCESS_KEY_ID,
+// ALIBABA_CLOUD_ACCESS_KEY_SECRET and ALIBABA_CLOUD_SECURITY_TOKEN if AccessKeyID is empty,
+// and the objects are requested anonymously if there's no credential.
+type OSSConfig struct {
+	// Endpoint is the url of the region of the buckets.
+	// default: https://oss-cn-hangzhou.aliyuncs.com
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+
+	AccessKeyID     string `yaml:"accessKeyID,omitempty" json:"accessKeyID,omitempty"`
+	AccessKeySecret string `yaml:"accessKeySecret,omitempty" json:"-"`
+	SecurityToken   string `yaml:"securityToken,omitempty" json:"-"`
+}
+
+// OSSRoundTripper translates the requests of the oss:// urls into the requests of the
+// objects signed by the OSS signature in the Authorization header.
+type OSSRoundTripper struct {
+	endpoint *url.URL
+
+	accessKeyID     string
+	accessKeySecret string
+	securityToken   string
+
+	transport http.RoundTripper
+	now       func() time.Time
+}
+
+// NewOSSRoundTripper creates an OSSRoundTripper with the config, which may be nil.
+func NewOSSRoundTripper(cfg *OSSConfig) (*OSSRoundTripper, error) {
+	if cfg == nil {
+		cfg = &OSSConfig{}
+	}
+
+	rt := &OSSRoundTripper{
+		accessKeyID:     cfg.AccessKeyID,
+		accessKeySecret: cfg.AccessKeySecret,
+		securityToken:   cfg.SecurityToken,
+		transport:       newClient(),
+		now:             time.Now,
+	}
+	if rt.accessKeyID == "" {
+		rt.accessKeyID = os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID")
+		rt.accessKeySecret = os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET")
+		rt.securityToken = os.Getenv("ALIBABA_CLOUD_SECURITY_TOKEN")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = defaultOSSEndpoint
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "oss endpoint: %s", endpoint)
+	}
+	rt.endpoint = u
+	return rt, nil
+}
+
+// RoundTrip implements the http.RoundTripper.
+func (rt *OSSRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	bucket := req.URL.Host
+	if bucket == "" {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bucket of url: %s", req.URL)
+	}
+
+	u := rt.endpoint.Scheme + "://" + bucket + "." + rt.endpoint.Host + escapePath(req.URL.Path)
+	if req.URL.RawQuery != "" {
+		u += "?" + req.URL.RawQuery
+	}
+	out, err := newRequest(req, u)
+	if err != nil {
+		return nil, err
+	}
+	if rt.accessKeyID != "" {
+		rt.sign(out, bucket, req.URL.Path, rt.now().UTC())
+	}
+	return rt.transport.RoundTrip(out)
+}
+
+// sign signs the request of the object by the OSS signature.
+func (rt *OSSRoundTripper) sign(req *http.Request, bucket, key string, now time.Time) {
+	date := now.Format(http.TimeFormat)
+	req.Header.Set("Date", date)
+	if rt.securityToken != "" {
+		req.Header.Set("X-Oss-Security-Token", rt.securityToken)
+	}
+
+	var names []string
+	values := make(map[string]string)
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if !strings.HasPrefix(name, "x-oss-") {
+			continue
+		}
+		values[name] = strings.TrimSpace(strings.Join(v, ","))
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	resource := "/" + bucket + key
+	var subResources []string
+	for k, v := range req.URL.Query() {
+		if !ossSubResources[k] {
+			continue
+		}
+		if len(v) == 0 || v[0] == "" {
+			subResources = append(subResources, k)
+			continue
+		}
+		subResources = append(subResources, k+"="+v[0])
+	}
+	if len(subResources) > 0 {
+		sort.Strings(subResources)
+		resource += "?" + strings.Join(subResources, "&")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		date,
+		headers.String() + resource,
+	}, "\n")
+	h := hmac.New(sha1.New, []byte(rt.accessKeySecret))
+	h.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	req.Header.Set("Authorization", fmt.Sprintf("OSS %s:%s", rt.accessKeyID, signature))
+}
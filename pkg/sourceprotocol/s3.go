@@ -0,0 +1,237 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sourceprotocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+
+	// emptyPayloadHash is the sha256 of the empty payload of the GET and HEAD requests.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	amzDateFormat = "20060102T150405Z"
+)
+
+// S3Config is the endpoint and the credentials of Amazon S3 or an S3 compatible store.
+// The credentials are read from the environment variables AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN if AccessKeyID is empty, and the
+// objects are requested anonymously if there's no credential.
+type S3Config struct {
+	// Endpoint is the url of the service, such as http://minio:9000 for an S3 compatible store.
+	// default: https://s3.{region}.amazonaws.com
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+
+	// Region is the region of the buckets, which signs the requests.
+	// default: the environment variable AWS_REGION, or us-east-1
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+
+	// PathStyle sets whether to address a bucket by the path of the endpoint rather
+	// than its host, which is required by the most S3 compatible stores.
+	PathStyle bool `yaml:"pathStyle,omitempty" json:"pathStyle,omitempty"`
+
+	AccessKeyID     string `yaml:"accessKeyID,omitempty" json:"accessKeyID,omitempty"`
+	SecretAccessKey string `yaml:"secretAccessKey,omitempty" json:"-"`
+	SessionToken    string `yaml:"sessionToken,omitempty" json:"-"`
+}
+
+// S3RoundTripper translates the requests of the s3:// urls into the requests of the
+// objects signed by AWS Signature Version 4.
+type S3RoundTripper struct {
+	endpoint  *url.URL
+	region    string
+	pathStyle bool
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+
+	transport http.RoundTripper
+	now       func() time.Time
+}
+
+// NewS3RoundTripper creates an S3RoundTripper with the config, which may be nil.
+func NewS3RoundTripper(cfg *S3Config) (*S3RoundTripper, error) {
+	if cfg == nil {
+		cfg = &S3Config{}
+	}
+
+	rt := &S3RoundTripper{
+		region:          cfg.Region,
+		pathStyle:       cfg.PathStyle,
+		accessKeyID:     cfg.AccessKeyID,
+		secretAccessKey: cfg.SecretAccessKey,
+		sessionToken:    cfg.SessionToken,
+		transport:       newClient(),
+		now:             time.Now,
+	}
+	if rt.region == "" {
+		rt.region = os.Getenv("AWS_REGION")
+	}
+	if rt.region == "" {
+		rt.region = defaultS3Region
+	}
+	if rt.accessKeyID == "" {
+		rt.accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		rt.secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		rt.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", rt.region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "s3 endpoint: %s", endpoint)
+	}
+	rt.endpoint = u
+	return rt, nil
+}
+
+// RoundTrip implements the http.RoundTripper.
+func (rt *S3RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	bucket := req.URL.Host
+	if bucket == "" {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bucket of url: %s", req.URL)
+	}
+
+	host := bucket + "." + rt.endpoint.Host
+	path := strings.TrimSuffix(rt.endpoint.Path, "/") + req.URL.Path
+	if rt.pathStyle {
+		host = rt.endpoint.Host
+		path = strings.TrimSuffix(rt.endpoint.Path, "/") + "/" + bucket + req.URL.Path
+	}
+	u := rt.endpoint.Scheme + "://" + host + escapePath(path)
+	if query := canonicalQuery(req.URL.Query()); query != "" {
+		u += "?" + query
+	}
+
+	out, err := newRequest(req, u)
+	if err != nil {
+		return nil, err
+	}
+	if rt.accessKeyID != "" {
+		rt.sign(out, rt.now().UTC())
+	}
+	return rt.transport.RoundTrip(out)
+}
+
+// sign signs the request by AWS Signature Version 4, with the host, the range and
+// all the x-amz-* headers of the request.
+func (rt *S3RoundTripper) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if rt.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", rt.sessionToken)
+	}
+
+	values := map[string]string{"host": req.URL.Host}
+	names := []string{"host"}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if name != "range" && !strings.HasPrefix(name, "x-amz-") {
+			continue
+		}
+		values[name] = strings.TrimSpace(strings.Join(v, ","))
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, rt.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := []byte("AWS4" + rt.secretAccessKey)
+	for _, s := range []string{date, rt.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		rt.accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes the query sorted by the keys with escapePath, which is
+// both the canonical query of the signature and the query sent.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, escapeQueryComponent(k)+"="+escapeQueryComponent(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func escapeQueryComponent(s string) string {
+	return strings.Replace(escapePath(s), "/", "%2F", -1)
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sourceprotocol implements the source protocols other than http, including
+// s3, oss and hdfs, as the round trippers registered by httputils.RegisterProtocol.
+// A request of their urls is translated into the http requests of the service, and the
+// responses keep the semantics of http, such as the range requests and the validation
+// by ETag and Last-Modified. So both the back source of dfget and the CDN of supernode
+// download the files from them the same as from the http sources.
+package sourceprotocol
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+)
+
+const (
+	// SchemeS3 is the scheme of the urls of Amazon S3 and the S3 compatible stores,
+	// in format of s3://{bucket}/{key}.
+	SchemeS3 = "s3"
+
+	// SchemeOSS is the scheme of the urls of Aliyun OSS, in format of oss://{bucket}/{key}.
+	SchemeOSS = "oss"
+
+	// SchemeHDFS is the scheme of the urls of HDFS, in format of hdfs://{namenode}/{path},
+	// which are read by WebHDFS.
+	SchemeHDFS = "hdfs"
+)
+
+// Config is the endpoints and the credentials of the source protocols.
+type Config struct {
+	// S3 is the config of the s3:// urls.
+	S3 *S3Config `yaml:"s3,omitempty" json:"s3,omitempty"`
+
+	// OSS is the config of the oss:// urls.
+	OSS *OSSConfig `yaml:"oss,omitempty" json:"oss,omitempty"`
+
+	// HDFS is the config of the hdfs:// urls.
+	HDFS *HDFSConfig `yaml:"hdfs,omitempty" json:"hdfs,omitempty"`
+}
+
+// Register registers the round trippers of all the source protocols with the config,
+// the defaults are used for the protocols which aren't configured.
+// It must be called before creating the http clients, the same as httputils.RegisterProtocol.
+func Register(cfg *Config) error {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	s3, err := NewS3RoundTripper(cfg.S3)
+	if err != nil {
+		return err
+	}
+	oss, err := NewOSSRoundTripper(cfg.OSS)
+	if err != nil {
+		return err
+	}
+	hdfs, err := NewHDFSRoundTripper(cfg.HDFS)
+	if err != nil {
+		return err
+	}
+
+	httputils.RegisterProtocol(SchemeS3, s3)
+	httputils.RegisterProtocol(SchemeOSS, oss)
+	httputils.RegisterProtocol(SchemeHDFS, hdfs)
+	return nil
+}
+
+// newClient creates the client sending the translated requests to the services,
+// which follows the redirects, such as the ones of WebHDFS to the datanodes.
+func newClient() *httputils.Client {
+	return httputils.NewClient()
+}
+
+// newRequest creates the request to the url with the method, the headers and the context of req.
+func newRequest(req *http.Request, url string) (*http.Request, error) {
+	out, err := http.NewRequest(req.Method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Header {
+		out.Header[k] = append([]string(nil), v...)
+	}
+	return out.WithContext(req.Context()), nil
+}
+
+// newResponse creates the response of req which isn't returned by the service directly.
+func newResponse(req *http.Request, code int, header http.Header, length int64, body io.ReadCloser) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	if body == nil {
+		body = http.NoBody
+	}
+	return &http.Response{
+		Status:        http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+}
+
+// escapePath escapes every byte of the path except the unreserved characters and '/',
+// which is required by the signatures of S3 and OSS.
+func escapePath(path string) string {
+	const hex = "0123456789ABCDEF"
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		b := path[i]
+		if isUnreserved(b) || b == '/' {
+			buf = append(buf, b)
+			continue
+		}
+		buf = append(buf, '%', hex[b>>4], hex[b&15])
+	}
+	return string(buf)
+}
+
+func isUnreserved(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '-' || b == '_' || b == '.' || b == '~'
+}
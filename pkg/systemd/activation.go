@@ -0,0 +1,69 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd
+// with the socket activation, the ones before it are stdin, stdout and stderr.
+const listenFdsStart = 3
+
+// Listeners returns the listeners of the sockets passed by systemd with the
+// socket activation, in the order of ListenStream of the socket unit.
+// It returns nil if no socket is passed to the process. The environment
+// variables of the activation are unset, so they're not inherited by the
+// child processes.
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		// the listener holds a dup of the fd
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.Wrapf(err, "listen on fd %d", fd)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
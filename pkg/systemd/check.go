@@ -0,0 +1,66 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package systemd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+)
+
+// minCheckTimeout is the min timeout of the request sent by HTTPCheck.
+const minCheckTimeout = time.Second
+
+// HTTPCheck returns a check of RunWatchdog, which fails if a GET request of
+// the url isn't responded with 2xx in a quarter of the interval of the watchdog.
+// So the watchdog isn't pinged when the server hangs, even though the other
+// goroutines of the process are still running.
+func HTTPCheck(url string, tlsConfig *tls.Config) func() error {
+	timeout := WatchdogInterval() / 4
+	if timeout < minCheckTimeout {
+		timeout = minCheckTimeout
+	}
+	client := httputils.NewClient(httputils.WithTLSConfig(tlsConfig), httputils.WithRequestTimeout(timeout),
+		httputils.WithDisableKeepAlives(true))
+	return func() error {
+		resp, err := client.Get(url, nil, 0)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("unexpected status code %d of %s", resp.StatusCode, url)
+		}
+		return nil
+	}
+}
+
+// LoopbackURL returns the url of the path served on the listened address,
+// and the unspecified IP of the address is replaced with the loopback one.
+func LoopbackURL(scheme string, addr net.Addr, path string) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return fmt.Sprintf("%s://%s%s", scheme, addr, path)
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, port), path)
+}
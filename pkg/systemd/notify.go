@@ -0,0 +1,101 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package systemd implements the integration with systemd, such as the
+// notifications of the service state, the socket activation and the units
+// which run the components as services.
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The states sent to systemd by Notify.
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Notify sends the state to the socket of systemd told by $NOTIFY_SOCKET.
+// It returns false if the process isn't supervised by systemd with a notify socket.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// the name of an abstract socket starts with '@' in $NOTIFY_SOCKET
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, errors.Wrapf(err, "dial notify socket %s", socket)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, errors.Wrap(err, "send state")
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the timeout of the watchdog set by WatchdogSec of
+// the unit, before which StateWatchdog must be sent to keep the process alive.
+// It returns 0 if the watchdog isn't enabled for the process.
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog sends StateWatchdog at half the interval of the watchdog until
+// done is closed. The ping is skipped if check returns an error, so that a
+// process which is alive but can't serve any more is restarted by systemd.
+// It returns immediately if the watchdog isn't enabled.
+func RunWatchdog(done <-chan struct{}, check func() error) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if check != nil {
+				if err := check(); err != nil {
+					logrus.Warnf("skip pinging the watchdog of systemd: %v", err)
+					continue
+				}
+			}
+			Notify(StateWatchdog)
+		}
+	}
+}
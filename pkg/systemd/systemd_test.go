@@ -0,0 +1,207 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package systemd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type SystemdSuite struct{}
+
+func init() {
+	check.Suite(&SystemdSuite{})
+}
+
+func (s *SystemdSuite) TestNotify(c *check.C) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	sent, err := Notify(StateReady)
+	c.Check(sent, check.Equals, false)
+	c.Check(err, check.IsNil)
+
+	dir, err := ioutil.TempDir("/tmp", "systemd-SystemdSuite-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	sent, err = Notify(StateReady)
+	c.Check(sent, check.Equals, true)
+	c.Assert(err, check.IsNil)
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	c.Assert(err, check.IsNil)
+	c.Check(string(buf[:n]), check.Equals, StateReady)
+}
+
+func (s *SystemdSuite) TestWatchdogInterval(c *check.C) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Unsetenv("WATCHDOG_USEC")
+	c.Check(WatchdogInterval(), check.Equals, time.Duration(0))
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	c.Check(WatchdogInterval(), check.Equals, 30*time.Second)
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	c.Check(WatchdogInterval(), check.Equals, 30*time.Second)
+
+	os.Setenv("WATCHDOG_PID", "1")
+	c.Check(WatchdogInterval(), check.Equals, time.Duration(0))
+}
+
+func (s *SystemdSuite) TestListeners(c *check.C) {
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	listeners, err := Listeners()
+	c.Check(err, check.IsNil)
+	c.Check(listeners, check.IsNil)
+	c.Check(os.Getenv("LISTEN_FDS"), check.Equals, "")
+}
+
+func (s *SystemdSuite) TestRenderService(c *check.C) {
+	u := &ServiceUnit{
+		Description:    "dfdaemon",
+		ExecStart:      []string{"/usr/local/bin/dfdaemon", "--config", "/etc/dragonfly/my dfdaemon.yml", "--verbose=100%"},
+		WatchdogSec:    1500 * time.Millisecond,
+		ReadWritePaths: []string{"/root/.small-dragonfly", "/data"},
+		Socket:         "dfdaemon.socket",
+	}
+	buf := &bytes.Buffer{}
+	c.Assert(u.Render(buf), check.IsNil)
+	text := buf.String()
+	for _, line := range []string{
+		`ExecStart=/usr/local/bin/dfdaemon --config "/etc/dragonfly/my dfdaemon.yml" --verbose=100%%`,
+		"Type=notify",
+		"WatchdogSec=2",
+		"ReadWritePaths=/root/.small-dragonfly /data",
+		"Requires=dfdaemon.socket",
+		"After=network-online.target dfdaemon.socket",
+		"ProtectSystem=strict",
+	} {
+		c.Check(strings.Contains(text, line+"\n"), check.Equals, true, check.Commentf("missing %q in\n%s", line, text))
+	}
+	c.Check(strings.Contains(text, "User="), check.Equals, false)
+
+	u = &ServiceUnit{Description: "dfdaemon", ExecStart: []string{"/usr/local/bin/dfdaemon"}}
+	buf.Reset()
+	c.Assert(u.Render(buf), check.IsNil)
+	c.Check(strings.Contains(buf.String(), "WatchdogSec"), check.Equals, false)
+	c.Check(strings.Contains(buf.String(), "Requires="), check.Equals, false)
+}
+
+func (s *SystemdSuite) TestRenderSocket(c *check.C) {
+	u := &SocketUnit{
+		Description:  "dfdaemon socket",
+		ListenStream: []string{"127.0.0.1:65001"},
+		Service:      "dfdaemon.service",
+	}
+	buf := &bytes.Buffer{}
+	c.Assert(u.Render(buf), check.IsNil)
+	c.Check(strings.Contains(buf.String(), "\nListenStream=127.0.0.1:65001\n"), check.Equals, true)
+	c.Check(strings.Contains(buf.String(), "\nService=dfdaemon.service\n"), check.Equals, true)
+}
+
+func (s *SystemdSuite) TestRunWatchdog(c *check.C) {
+	dir, err := ioutil.TempDir("/tmp", "systemd-SystemdSuite-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("WATCHDOG_USEC", "20000")
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	healthy := make(chan bool, 1)
+	healthy <- false
+	done := make(chan struct{})
+	go RunWatchdog(done, func() error {
+		select {
+		case h := <-healthy:
+			if !h {
+				return fmt.Errorf("unhealthy")
+			}
+		default:
+		}
+		return nil
+	})
+	defer close(done)
+
+	// the first check fails and is skipped, the next one pings the watchdog
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	c.Assert(err, check.IsNil)
+	c.Check(string(buf[:n]), check.Equals, StateWatchdog)
+	c.Check(len(healthy), check.Equals, 0)
+}
+
+func (s *SystemdSuite) TestHTTPCheck(c *check.C) {
+	status := http.StatusOK
+	ln, err := net.Listen("tcp", "0.0.0.0:0")
+	c.Assert(err, check.IsNil)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/_ping")
+		w.WriteHeader(status)
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	url := LoopbackURL("http", ln.Addr(), "/_ping")
+	c.Check(strings.HasPrefix(url, "http://127.0.0.1:"), check.Equals, true)
+
+	check200 := HTTPCheck(url, nil)
+	c.Check(check200(), check.IsNil)
+	status = http.StatusServiceUnavailable
+	c.Check(check200(), check.NotNil)
+
+	server.Close()
+	c.Check(check200(), check.NotNil)
+}
+
+func (s *SystemdSuite) TestLoopbackURL(c *check.C) {
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 65001}
+	c.Check(LoopbackURL("https", addr, "/version"), check.Equals, "https://10.0.0.1:65001/version")
+	addr = &net.TCPAddr{IP: net.IPv6zero, Port: 65001}
+	c.Check(LoopbackURL("http", addr, "/version"), check.Equals, "http://127.0.0.1:65001/version")
+}
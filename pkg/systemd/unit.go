@@ -0,0 +1,150 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package systemd
+
+import (
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ServiceUnit describes a service unit which runs a component of Dragonfly.
+type ServiceUnit struct {
+	// Description is the description of the unit.
+	Description string
+
+	// ExecStart is the command line of the service, starting with the absolute
+	// path of the executable.
+	ExecStart []string
+
+	// User is the user which the service runs as, empty means root.
+	User string
+
+	// WatchdogSec is the timeout of the watchdog, before which the service
+	// must notify systemd that it's alive. 0 means the watchdog is disabled.
+	WatchdogSec time.Duration
+
+	// ReadWritePaths are the paths which the service writes to. All other
+	// paths of the file system are read-only to the service.
+	ReadWritePaths []string
+
+	// Socket is the name of the socket unit which activates the service,
+	// empty means the service listens on the ports itself.
+	Socket string
+}
+
+// SocketUnit describes a socket unit which activates a service.
+type SocketUnit struct {
+	// Description is the description of the unit.
+	Description string
+
+	// ListenStream are the addresses of the TCP sockets, such as "65001"
+	// or "127.0.0.1:65001".
+	ListenStream []string
+
+	// Service is the name of the service unit activated by the socket.
+	Service string
+}
+
+var serviceTemplate = template.Must(template.New("service").Funcs(template.FuncMap{
+	"join":    strings.Join,
+	"cmdline": cmdline,
+	"seconds": func(d time.Duration) int64 { return int64((d + time.Second - 1) / time.Second) },
+}).Parse(`[Unit]
+Description={{.Description}}
+Documentation=https://d7y.io
+After=network-online.target{{if .Socket}} {{.Socket}}{{end}}
+Wants=network-online.target
+{{- if .Socket}}
+Requires={{.Socket}}
+{{- end}}
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{cmdline .ExecStart}}
+Restart=on-failure
+RestartSec=5
+LimitNOFILE=65536
+{{- if .User}}
+User={{.User}}
+{{- end}}
+{{- if .WatchdogSec}}
+WatchdogSec={{seconds .WatchdogSec}}
+{{- end}}
+
+NoNewPrivileges=true
+PrivateTmp=true
+PrivateDevices=true
+ProtectSystem=strict
+ProtectHome=read-only
+ProtectKernelTunables=true
+ProtectKernelModules=true
+ProtectControlGroups=true
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+RestrictNamespaces=true
+RestrictRealtime=true
+LockPersonality=true
+{{- if .ReadWritePaths}}
+ReadWritePaths={{join .ReadWritePaths " "}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+var socketTemplate = template.Must(template.New("socket").Parse(`[Unit]
+Description={{.Description}}
+PartOf={{.Service}}
+
+[Socket]
+{{- range .ListenStream}}
+ListenStream={{.}}
+{{- end}}
+NoDelay=true
+Service={{.Service}}
+
+[Install]
+WantedBy=sockets.target
+`))
+
+// Render writes the text of the unit to w.
+func (u *ServiceUnit) Render(w io.Writer) error {
+	return serviceTemplate.Execute(w, u)
+}
+
+// Render writes the text of the unit to w.
+func (u *SocketUnit) Render(w io.Writer) error {
+	return socketTemplate.Execute(w, u)
+}
+
+// cmdline joins the args into a command line of systemd, quoting the ones
+// which contain the spaces or the quotes. The '%' is escaped since it starts
+// the specifiers of systemd.
+func cmdline(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.Replace(arg, "%", "%%", -1)
+		if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
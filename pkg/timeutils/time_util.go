@@ -29,3 +29,24 @@ func GetCurrentTimeMillis() int64 {
 func SinceInMilliseconds(start time.Time) float64 {
 	return float64(time.Since(start).Nanoseconds()) / float64(time.Millisecond.Nanoseconds())
 }
+
+// MillisToTime converts the unix time in milliseconds to time.Time.
+func MillisToTime(millis int64) time.Time {
+	return time.Unix(0, millis*time.Millisecond.Nanoseconds())
+}
+
+// TimeToMillis converts the time to the unix time in milliseconds.
+func TimeToMillis(t time.Time) int64 {
+	return t.UnixNano() / time.Millisecond.Nanoseconds()
+}
+
+// ClockOffset estimates how far the remote clock is ahead of the local one,
+// where remote is the time read from the remote clock while the request sent at
+// sent is being handled and the response is received at received.
+// The remote time is assumed to be read in the middle of the round trip, which is
+// measured by the monotonic clock, so the error of the estimation is at most half
+// of the round trip.
+func ClockOffset(sent, received, remote time.Time) time.Duration {
+	middle := sent.Add(received.Sub(sent) / 2)
+	return remote.Sub(middle.Round(0))
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timeutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type TimeUtilSuite struct{}
+
+func init() {
+	check.Suite(&TimeUtilSuite{})
+}
+
+func (s *TimeUtilSuite) TestMillisToTime(c *check.C) {
+	now := time.Now()
+	millis := now.UnixNano() / time.Millisecond.Nanoseconds()
+	c.Check(MillisToTime(millis).Equal(now.Truncate(time.Millisecond)), check.Equals, true)
+	c.Check(TimeToMillis(MillisToTime(millis)), check.Equals, millis)
+}
+
+func (s *TimeUtilSuite) TestClockOffset(c *check.C) {
+	sent := time.Now()
+	received := sent.Add(2 * time.Second)
+
+	c.Check(ClockOffset(sent, received, sent.Add(time.Second)), check.Equals, time.Duration(0))
+	c.Check(ClockOffset(sent, received, sent.Add(time.Minute)), check.Equals, time.Minute-time.Second)
+	c.Check(ClockOffset(sent, received, sent.Add(-time.Minute)), check.Equals, -time.Minute-time.Second)
+}
@@ -24,7 +24,10 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/pkg/dflog"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/lease"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+	"github.com/dragonflyoss/Dragonfly/pkg/sourceprotocol"
 
 	"gopkg.in/yaml.v2"
 )
@@ -86,10 +89,63 @@ func (c *Config) IsSuperPID(peerID string) bool {
 	return peerID == c.superNodePID
 }
 
+// SetClock sets the logical clock of supernode.
+func (c *Config) SetClock(clock *lease.Clock) {
+	c.clock = clock
+}
+
+// GetClock returns the logical clock of supernode, which is created
+// with ClockMaxStep at the first call unless it's set.
+func (c *Config) GetClock() *lease.Clock {
+	if c.clock == nil {
+		c.clock = lease.NewClock(c.ClockMaxStep)
+	}
+	return c.clock
+}
+
+// GetMetaStorePath returns the path of the meta store.
+func (c *Config) GetMetaStorePath() string {
+	return filepath.Join(c.HomeDir, MetaStoreFile)
+}
+
+// Features returns the optional features enabled by the config.
+func (c *Config) Features() []string {
+	var features []string
+	enabled := func(feature string, on bool) {
+		if on {
+			features = append(features, feature)
+		}
+	}
+	enabled("scheduler-audit", c.SchedulerAuditSize > 0 || c.SchedulerAuditFile != "")
+	enabled("scheduler-canary", c.SchedulerCanaryStrategy != "" && c.SchedulerCanaryPercent > 0)
+	enabled("incentive", c.IncentiveWeight > 0)
+	enabled("replication", c.ReplicationFactor > 0)
+	enabled("push", c.PushThreshold > 0 && c.CDNPattern != CDNPatternSource)
+	enabled("low-priority", c.LowPriorityRatio > 0 && c.LowPriorityRatio < 1)
+	enabled("dispatch-weights", c.DispatchWorkers > 0 && len(c.DispatchWeights) > 0)
+	enabled("event-log", c.EventLogSize > 0)
+	enabled("anomaly-webhook", c.AnomalyWebhook != "")
+	enabled("persist-task-meta", c.PersistTaskMeta)
+	enabled("bundles", c.BundleSecret != "")
+	enabled("peer-tokens", c.PeerTokenSecret != "")
+	enabled("cache-ttl", c.CacheTTL > 0 || len(c.CacheTTLRules) > 0)
+	enabled("task-id-rules", len(c.TaskIDRules) > 0)
+	enabled("origin-logins", len(c.OriginLogins) > 0)
+	enabled("origin-proxies", len(c.OriginProxies) > 0)
+	enabled("origin-mirrors", len(c.OriginMirrors) > 0)
+	enabled("edge-caches", len(c.EdgeCaches) > 0)
+	enabled("source-protocols", c.SourceProtocols != nil)
+	enabled("piece-dedup", c.PieceDedup)
+	enabled("storage-forecast", c.StorageForecastHorizon > 0 && c.CDNPattern != CDNPatternSource)
+	enabled("profiler", c.EnableProfiler)
+	return features
+}
+
 // NewBaseProperties creates an instant with default values.
 func NewBaseProperties() *BaseProperties {
 	home := filepath.Join(string(filepath.Separator), "home", "admin", "supernode")
 	return &BaseProperties{
+		CDNPattern:              CDNPatternLocal,
 		ListenPort:              DefaultListenPort,
 		DownloadPort:            DefaultDownloadPort,
 		HomeDir:                 home,
@@ -113,10 +169,130 @@ func NewBaseProperties() *BaseProperties {
 		IntervalThreshold:       DefaultIntervalThreshold,
 		TaskExpireTime:          DefaultTaskExpireTime,
 		PeerGCDelay:             DefaultPeerGCDelay,
+		PeerSuspectTimeout:      DefaultPeerSuspectTimeout,
+		PeerDeadTimeout:         DefaultPeerDeadTimeout,
+		ClientProgressGrace:     DefaultClientProgressGrace,
+		MaxProgressExtensions:   DefaultMaxProgressExtensions,
+		ClockSkewTolerance:      DefaultClockSkewTolerance,
+		ClockMaxStep:            DefaultClockMaxStep,
+		OriginFailoverCooldown:  DefaultOriginFailoverCooldown,
+		PassThroughHeaders:      append([]string(nil), DefaultPassThroughHeaders...),
 		CleanRatio:              DefaultCleanRatio,
+		StorageForecastWindow:   DefaultStorageForecastWindow,
+		CDNHashWorkers:          DefaultCDNHashWorkers,
+		CacheScanWorkers:        DefaultCacheScanWorkers,
+		DispatchWorkers:         DefaultDispatchWorkers,
+		DispatchQueueSize:       DefaultDispatchQueueSize,
+		EventLogSize:            DefaultEventLogSize,
+		LowPriorityRatio:        DefaultLowPriorityRatio,
+		GroupUrgentWindow:       DefaultGroupUrgentWindow,
+		SchedulerStrategy:       SchedulerStrategyRarestFirst,
+		PeerCacheFullRatio:      DefaultPeerCacheFullRatio,
+		ReplicationInterval:     DefaultReplicationInterval,
+		PushInterval:            DefaultPushInterval,
+		PushMaxPieces:           DefaultPushMaxPieces,
+		AnalyticsInterval:       DefaultAnalyticsInterval,
+		AnomalyWindow:           DefaultAnomalyWindow,
+		AnomalyMinSamples:       DefaultAnomalyMinSamples,
+		AnomalyThreshold:        DefaultAnomalyThreshold,
 	}
 }
 
+// CacheTTLRule specifies the freshness lifetime of the cached files whose URLs
+// match the URLPattern, which ignores the caching directives of the origin.
+type CacheTTLRule struct {
+	// URLPattern is a regular expression matched against the raw URL of a task.
+	URLPattern string `yaml:"urlPattern"`
+
+	// TTL is the time that the cached file keeps fresh, 0 means that the file
+	// is always validated by the source before being reused.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// TaskIDRule specifies the queries which are removed from the urls matching the pattern
+// before generating the taskIDs, such as the tokens of the signed urls. The rotating tokens
+// would otherwise fragment the cache into many tasks of the same content.
+type TaskIDRule struct {
+	// URLPattern is a regular expression matched against the task url of a task.
+	URLPattern string `yaml:"urlPattern"`
+
+	// Queries are the names of the queries to remove, a name ending with '*'
+	// removes all the queries with the prefix before it.
+	Queries []string `yaml:"queries"`
+}
+
+// OriginLogin is the login request which an origin requires before downloading,
+// and the cookies set by its responses are sent with the later requests to the origin.
+type OriginLogin struct {
+	// Host is the host of the origin in format of "host" or "host:port" the same as url.Host.
+	Host string `yaml:"host"`
+
+	// URL is the url which the login request is sent to.
+	URL string `yaml:"url"`
+
+	// Method is the method of the login request.
+	// default: POST
+	Method string `yaml:"method,omitempty"`
+
+	// Headers are the headers of the login request, such as Content-Type.
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Body is the body of the login request, such as the form with the credentials.
+	Body string `yaml:"body,omitempty"`
+
+	// TTL is the time after which the login is performed again. 0 means that it's
+	// performed again only when the origin responds 401 or 403.
+	TTL time.Duration `yaml:"ttl,omitempty"`
+}
+
+// OriginMirror specifies the mirrors of the origins whose URLs match the URLPattern,
+// which serve the same files as the origins.
+type OriginMirror struct {
+	// URLPattern is a regular expression matched against the raw URL of a task.
+	URLPattern string `yaml:"urlPattern"`
+
+	// Mirrors replace the part of the URL matched by the URLPattern to get the URLs of the
+	// mirrors, they may refer to the submatches by $1, $2 and so on. They're tried in order
+	// when the origin fails, the headers of the task are sent to them as well.
+	Mirrors []string `yaml:"mirrors"`
+}
+
+// EdgeCache is the rule of the external caches which hold the files of the tasks whose
+// URLs match the URLPattern, such as the artifact caches in the offices. They're advertised
+// to dfget with the piece tasks, and dfget fetches the pieces from them by ranged requests
+// before the peers.
+type EdgeCache struct {
+	// URLPattern is a regular expression matched against the raw URL of a task.
+	URLPattern string `yaml:"urlPattern"`
+
+	// URLs replace the part of the URL matched by the URLPattern to get the URLs of the
+	// file in the edge caches, they may refer to the submatches by $1, $2 and so on.
+	// They're tried by dfget in order, the headers of the task are sent to them as well.
+	URLs []string `yaml:"urls"`
+}
+
+// OriginProxy is the egress proxy through which supernode requests the origins whose
+// hosts match the HostPattern, such as the central proxy of a corporate network.
+// It's only used by supernode to fetch the files, and the peers aren't affected.
+type OriginProxy struct {
+	// HostPattern is a regular expression matched against the host of the origin
+	// in format of "host" or "host:port" the same as url.Host.
+	HostPattern string `yaml:"hostPattern"`
+
+	// URL is the url of the proxy, such as "http://proxy.example.com:3128".
+	// It's ignored if Direct is true.
+	URL string `yaml:"url,omitempty"`
+
+	// Username and Password are the credentials of an authenticated proxy,
+	// which are sent by the basic authentication.
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	// Direct indicates whether to request the matched origins directly without any proxy,
+	// including the ones set by the environment variables.
+	Direct bool `yaml:"direct,omitempty"`
+}
+
 type CDNPattern string
 
 const (
@@ -208,6 +384,291 @@ type BaseProperties struct {
 	// default: 3
 	FailAccessInterval time.Duration `yaml:"failAccessInterval"`
 
+	// SchedulerAuditSize is the number of the latest scheduler decisions kept
+	// in memory which can be dumped by API. 0 means disabled.
+	// default: 0
+	SchedulerAuditSize int `yaml:"schedulerAuditSize"`
+
+	// SchedulerAuditFile is the file to record all scheduler decisions as JSON lines,
+	// which can be analyzed offline by "supernode scheduler-replay". Empty means disabled.
+	// default: ""
+	SchedulerAuditFile string `yaml:"schedulerAuditFile"`
+
+	// SchedulerStrategy is the strategy of the scheduler to prioritize the pieces,
+	// one of "rarest-first" and "sequential".
+	// default: rarest-first
+	SchedulerStrategy string `yaml:"schedulerStrategy"`
+
+	// SchedulerCanaryStrategy is the strategy which schedules the pieces of part of the tasks
+	// side by side with the SchedulerStrategy, so that it can be validated by comparing the
+	// metrics of both before the full rollout. Empty means disabled.
+	// default: ""
+	SchedulerCanaryStrategy string `yaml:"schedulerCanaryStrategy"`
+
+	// SchedulerCanaryPercent is the percent in [0, 100] of the tasks, chosen by the hash of
+	// the taskID, which are scheduled with the SchedulerCanaryStrategy.
+	// default: 0
+	SchedulerCanaryPercent int `yaml:"schedulerCanaryPercent"`
+
+	// EventLogSize is the number of the latest event logs of the downloads uploaded by dfget
+	// kept in memory, which can be retrieved by the taskID. 0 means that they're dropped.
+	// default: 1000
+	EventLogSize int `yaml:"eventLogSize"`
+
+	// IncentiveWeight is the weight in [0, 1] of the contribution of a node when
+	// the scheduler assigns peers to it. The node which uploads less than it downloads
+	// can only use part of the upload slots of other peers, and that part shrinks
+	// as the weight grows. 0 means disabled.
+	// default: 0
+	IncentiveWeight float64 `yaml:"incentiveWeight"`
+
+	// PeerCacheFullRatio is the ratio in (0, 1] of the cache utilization advertised by
+	// a peer beyond which the cache of the peer is treated as nearly full. The scheduler
+	// tries such peers after the others, and prioritizes the pieces only owned by them,
+	// so that the pieces are replicated to the other peers before they're evicted.
+	// 0 means disabled.
+	// default: 0.9
+	PeerCacheFullRatio float64 `yaml:"peerCacheFullRatio"`
+
+	// ReplicationFactor is the number of the alive peers which should own every piece of
+	// the long-lived tasks. The uploaders of more peers are instructed by the heart beats to
+	// download a task whose pieces are owned by less peers. 0 means disabled.
+	// default: 0
+	ReplicationFactor int `yaml:"replicationFactor"`
+
+	// ReplicationTasks are the regular expressions of the taskURLs of the long-lived tasks
+	// which are replicated to ReplicationFactor peers. All tasks are replicated if it's empty.
+	// default: []
+	ReplicationTasks []string `yaml:"replicationTasks,omitempty"`
+
+	// ReplicationInterval is the interval of checking the replicas of the long-lived tasks.
+	// default: 1m
+	ReplicationInterval time.Duration `yaml:"replicationInterval"`
+
+	// PushThreshold is the ratio in (0, 1] of the pieces downloaded by a peer beyond which
+	// the peer is treated as a straggler if it makes no progress in a PushInterval. The
+	// uploaders of the seeders owning the missing pieces are instructed by the heart beats
+	// to push them to the straggler, if its uploader accepts the pushed pieces.
+	// 0 means disabled.
+	// default: 0
+	PushThreshold float64 `yaml:"pushThreshold"`
+
+	// PushInterval is the interval of checking the progress of the peers accepting the
+	// pushed pieces.
+	// default: 10s
+	PushInterval time.Duration `yaml:"pushInterval"`
+
+	// PushMaxPieces is the max number of the missing pieces of a straggler pushed in
+	// a PushInterval.
+	// default: 16
+	PushMaxPieces int `yaml:"pushMaxPieces"`
+
+	// LowPriorityRatio is the ratio in (0, 1) of the resources which the downloads of
+	// a lower priority can take, so that the interactive pulls aren't delayed behind
+	// the mass preheats. The clients of low priority can only use that ratio of the
+	// upload slots of every peer and supernode, and the CDN downloads of a priority
+	// can only use that ratio of the origin bandwidth while there are the ones of a
+	// higher priority. 0 or 1 means disabled.
+	// default: 0.25
+	LowPriorityRatio float64 `yaml:"lowPriorityRatio"`
+
+	// GroupUrgentWindow is the time before the deadline of a task group within which
+	// the downloads of the group are scheduled as the high priority, no matter which
+	// priority they're registered with, so the related files such as the layers of an
+	// image finish together in time. 0 means disabled.
+	// default: 1m
+	GroupUrgentWindow time.Duration `yaml:"groupUrgentWindow"`
+
+	// AnalyticsInterval is the interval of the job which aggregates the downloads
+	// reported by dfget into the daily and weekly usage summaries.
+	// default: 1m
+	AnalyticsInterval time.Duration `yaml:"analyticsInterval"`
+
+	// AnomalyWebhook is the url which the anomaly alerts are posted to in json.
+	// The alerts are only logged and listed by the api if it's empty.
+	// default: ""
+	AnomalyWebhook string `yaml:"anomalyWebhook"`
+
+	// AnomalyWindow is the window in which the back-source rate and the piece failure
+	// rate of every task and peer label are calculated and compared with the baseline.
+	// default: 1m
+	AnomalyWindow time.Duration `yaml:"anomalyWindow"`
+
+	// AnomalyMinSamples is the minimal number of the downloads or pieces in a window
+	// for the rate of a group to be checked.
+	// default: 20
+	AnomalyMinSamples int `yaml:"anomalyMinSamples"`
+
+	// AnomalyThreshold is how much the rate in a window must exceed the baseline
+	// for an alert to be fired.
+	// default: 0.3
+	AnomalyThreshold float64 `yaml:"anomalyThreshold"`
+
+	// PersistTaskMeta sets whether to persist the metadata of tasks into
+	// the meta store under HomeDir, so that the cached tasks can be recovered
+	// after supernode restarts.
+	// default: false
+	PersistTaskMeta bool `yaml:"persistTaskMeta"`
+
+	// BundleSecret is the secret shared by the supernodes to sign and verify the
+	// bundles of tasks with HMAC-SHA256, so that a bundle exported by a supernode
+	// can only be imported by the supernodes with the same secret.
+	// default: ""
+	BundleSecret string `yaml:"bundleSecret"`
+
+	// PeerTokenSecret is the secret shared by the supernodes to verify the tokens
+	// of the nodes, which are issued by "supernode peer-token" and bound to the ip
+	// of each node. If it's set, the requests of the peers must carry the token of
+	// the node which they are sent from, and a node can only register the peers of
+	// its own ip and report the pieces of its own clients.
+	// default: ""
+	PeerTokenSecret string `yaml:"peerTokenSecret"`
+
+	// AccessLogSampleRate is the rate in [0, 1] of the requests written to the access log,
+	// and the requests failed with a server error are always logged unless it's 0.
+	// It can be changed at runtime by the API /debug/accesslog.
+	// default: 0
+	AccessLogSampleRate float64 `yaml:"accessLogSampleRate"`
+
+	// AdminPort is the port on the loopback address to serve the diagnostics endpoints,
+	// such as pprof, expvar and the goroutine dump. 0 means that it's disabled.
+	// default: 0
+	AdminPort int `yaml:"adminPort"`
+
+	// CacheTTL is the time that the cached file of a task keeps fresh if the origin
+	// response has neither a Cache-Control max-age nor an Expires header.
+	// The fresh file is reused without being validated by the source, otherwise the
+	// source is requested to check whether it has been modified before reusing.
+	// default: 0
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+
+	// CacheTTLRules override the freshness lifetime of the cached files told by the
+	// origin for the URLs matching the patterns, and the first matched one is applied.
+	CacheTTLRules []*CacheTTLRule `yaml:"cacheTTLRules,omitempty"`
+
+	// TaskIDRules remove the queries from the urls matching the patterns before generating
+	// the taskIDs, in addition to the filter of dfget, and all the matched rules are applied.
+	// Only the Range header takes part in the taskIDs, so the credentials in the other
+	// headers never split the tasks.
+	TaskIDRules []*TaskIDRule `yaml:"taskIDRules,omitempty"`
+
+	// OriginLogins are the login requests of the origins which require to log in
+	// before downloading, the cookies set by the logins are kept in a cookie jar.
+	OriginLogins []*OriginLogin `yaml:"originLogins,omitempty"`
+
+	// OriginProxies are the egress proxies of the origins, the first one whose hostPattern
+	// matches the host of an origin is used. The proxies set by the environment variables
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used for the origins matching none of them.
+	OriginProxies []*OriginProxy `yaml:"originProxies,omitempty"`
+
+	// OriginMirrors are the mirrors of the origins which the CDN fails over to when
+	// the origin of a task fails, the first one whose urlPattern matches the URL is used.
+	OriginMirrors []*OriginMirror `yaml:"originMirrors,omitempty"`
+
+	// EdgeCaches are the external caches holding the files of the tasks, which are advertised
+	// to dfget as the alternative sources of the pieces, the first one whose urlPattern matches
+	// the URL is used.
+	EdgeCaches []*EdgeCache `yaml:"edgeCaches,omitempty"`
+
+	// OriginFailoverCooldown is the time that an origin or a mirror failing to be fetched
+	// is tried after the healthy ones, before it's probed again by the downloads.
+	// default: 1m
+	OriginFailoverCooldown time.Duration `yaml:"originFailoverCooldown"`
+
+	// PassThroughHeaders are the names of the headers of the responses of the origins
+	// which are kept with the tasks when they're registered, and replayed by dfdaemon on
+	// the responses served from the P2P network, since some clients depend on them.
+	// The headers describing the framing of the responses, such as Content-Length,
+	// can't be passed through. An empty list passes through no header.
+	// default: [Content-Type, Docker-Content-Digest]
+	PassThroughHeaders []string `yaml:"passThroughHeaders"`
+
+	// SourceProtocols are the endpoints and the credentials of the origins other than http,
+	// such as s3, oss and hdfs, which are fetched by the CDN the same as dfget downloading
+	// from the source station. OriginProxies don't apply to them.
+	SourceProtocols *sourceprotocol.Config `yaml:"sourceProtocols,omitempty"`
+
+	// MetricsExporters are the backends which the metrics are pushed to in addition to
+	// being served by /metrics for Prometheus, such as statsd, dogstatsd and otlp.
+	MetricsExporters []*metricsutils.ExporterConfig `yaml:"metricsExporters,omitempty"`
+
+	// PieceDedup sets whether to store the identical pieces of the tasks once,
+	// which share the data by reflinks, so it only works when the storage of
+	// the CDN is on a file system supporting reflinks, such as btrfs and xfs.
+	// default: false
+	PieceDedup bool `yaml:"pieceDedup"`
+
+	// CDNHashWorkers is the number of the workers which hash and write the pieces
+	// of a task concurrently when the CDN fetches it from the source. Every worker
+	// holds at most one piece in memory.
+	// default: 4
+	CDNHashWorkers int `yaml:"cdnHashWorkers"`
+
+	// CDNPreallocate indicates whether to allocate the disk space of a task file
+	// before the CDN writes its pieces, if the file length of the task is known.
+	// The pieces of a task are always stored in one file at their offsets,
+	// so the preallocation makes the file contiguous on the disk without changing
+	// its layout, and it can be switched on or off without migrating the files.
+	// It's ignored if the file system doesn't support it.
+	// default: false
+	CDNPreallocate bool `yaml:"cdnPreallocate"`
+
+	// CDNVerifyWrite indicates whether to read back every piece written by the CDN
+	// and compare it with the fetched one, which detects the storage corrupting the
+	// data silently at the cost of reading every piece once more. The short writes
+	// are always detected, and the CDN of the task fails if a piece can't be written.
+	// default: false
+	CDNVerifyWrite bool `yaml:"cdnVerifyWrite"`
+
+	// CacheScanWorkers is the number of the workers which scan the directories of the
+	// cached files in parallel in the background after supernode starts, and remove the
+	// files which can't be reused, such as the ones without the metadata or the finished
+	// ones whose sizes don't match the metadata. 0 means that the scan is disabled and
+	// the files are only validated when they're downloaded.
+	// default: 8
+	CacheScanWorkers int `yaml:"cacheScanWorkers"`
+
+	// UserAgent is the User-Agent of the requests sent to the origins by supernode,
+	// the default one of Go is used if it's empty.
+	// default: ""
+	UserAgent string `yaml:"userAgent"`
+
+	// Cluster is the name of the cluster which supernode belongs to. If it's not empty,
+	// the requests sent to the origins carry the identification headers X-Dragonfly-Cluster,
+	// X-Dragonfly-Node with the AdvertiseIP and X-Dragonfly-Task with the taskID, so the
+	// operators of the origins can attribute the traffic of Dragonfly.
+	// default: ""
+	Cluster string `yaml:"cluster"`
+
+	// MaxSourceSize is the max number of the bytes fetched from the source by the CDN for a task,
+	// which guards the disk against the sources sending the unbounded data without Content-Length.
+	// 0 means unlimited.
+	// default: 0
+	MaxSourceSize fileutils.Fsize `yaml:"maxSourceSize"`
+
+	// SourceSizeMargin is the ratio by which the data fetched from the source by the CDN
+	// may exceed the Content-Length of the task before the CDN is aborted.
+	// default: 0
+	SourceSizeMargin float64 `yaml:"sourceSizeMargin"`
+
+	// DispatchWorkers is the number of the workers which dispatch the piece tasks pulled by dfget,
+	// decoupled from the goroutines handling the HTTP requests. 0 means that the piece tasks are
+	// dispatched in the HTTP handlers directly.
+	// default: 64
+	DispatchWorkers int `yaml:"dispatchWorkers"`
+
+	// DispatchQueueSize is the max number of the pulls of piece tasks waiting for the dispatch workers,
+	// beyond which the pulls are shed and dfget is told to wait and retry.
+	// default: 1024
+	DispatchQueueSize int `yaml:"dispatchQueueSize"`
+
+	// DispatchWeights are the weights of the tasks in the dispatch of the piece tasks by the
+	// priorities of the dfget tasks pulling them, which must be high, normal or low. The tasks
+	// take turns to dispatch as many pulls as their weights, so the pulls of the small tasks
+	// aren't starved by the huge tasks with thousands of peers. The weight of a task is 1 if
+	// its priority is absent.
+	DispatchWeights map[string]int `yaml:"dispatchWeights,omitempty"`
+
 	// cIDPrefix is a prefix string used to indicate that the CID is supernode.
 	cIDPrefix string
 
@@ -233,6 +694,51 @@ type BaseProperties struct {
 	// default: 3min
 	PeerGCDelay time.Duration `yaml:"peerGCDelay"`
 
+	// PeerSuspectTimeout is the time after the last heart beat of a peer that
+	// the peer is treated as suspect, and scheduler will not assign pieces to it.
+	// default: 30s
+	PeerSuspectTimeout time.Duration `yaml:"peerSuspectTimeout"`
+
+	// PeerDeadTimeout is the time after the last heart beat of a peer that
+	// the peer is treated as dead, and it will be cleaned up with its pieces.
+	// 0 means the liveness of peers is not checked by heart beats.
+	// default: 90s
+	PeerDeadTimeout time.Duration `yaml:"peerDeadTimeout"`
+
+	// ClientProgressTimeout is the time after the last piece downloaded successfully
+	// by a dfget task that the dfget task is kicked from the task, unless the client
+	// has been granted an extension of the deadline.
+	// 0 means the progress of dfget tasks is not checked.
+	// default: 0
+	ClientProgressTimeout time.Duration `yaml:"clientProgressTimeout"`
+
+	// ClientProgressGrace is how long the deadline of a dfget task is extended
+	// every time an extension is granted.
+	// default: 1m
+	ClientProgressGrace time.Duration `yaml:"clientProgressGrace"`
+
+	// MaxProgressExtensions is the max number of the extensions granted to a dfget task
+	// since its last piece downloaded successfully.
+	// default: 5
+	MaxProgressExtensions int `yaml:"maxProgressExtensions"`
+
+	// ClockSkewTolerance is the max skew of the clock of a peer from supernode detected
+	// at the registration, beyond which a warning is logged.
+	// 0 means the clock skew is not checked.
+	// default: 5s
+	ClockSkewTolerance time.Duration `yaml:"clockSkewTolerance"`
+
+	// ClockMaxStep is the max time the logical clock of supernode advances at a time,
+	// which expires the peers by peerSuspectTimeout and peerDeadTimeout and the tasks
+	// by taskExpireTime. The time beyond it, such as the time frozen by suspending the VM,
+	// isn't counted, so the peers and the tasks aren't expired at once after a resume.
+	// 0 means the time isn't limited.
+	// default: 5s
+	ClockMaxStep time.Duration `yaml:"clockMaxStep"`
+
+	// clock is the logical clock of supernode created with ClockMaxStep.
+	clock *lease.Clock
+
 	// GCDiskInterval is the interval time to execute GC disk.
 	// default: 15s
 	GCDiskInterval time.Duration `yaml:"gcDiskInterval"`
@@ -259,5 +765,18 @@ type BaseProperties struct {
 	// default: 1
 	CleanRatio int
 
+	// StorageForecastHorizon is how far ahead the free disk is forecasted from the
+	// growth rate of the cache and the tasks whose CDN is fetching. A young GC is
+	// triggered preemptively if the free disk is forecasted to drop below
+	// YoungGCThreshold within the horizon, and a warning is logged if it's
+	// forecasted to drop below FullGCThreshold.
+	// 0 means the free disk is not forecasted.
+	// default: 0
+	StorageForecastHorizon time.Duration `yaml:"storageForecastHorizon"`
+
+	// StorageForecastWindow is the window over which the growth rate of the cache is estimated.
+	// default: 30m
+	StorageForecastWindow time.Duration `yaml:"storageForecastWindow"`
+
 	LogConfig dflog.LogConfig `yaml:"logConfig" json:"logConfig"`
 }
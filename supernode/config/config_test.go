@@ -121,3 +121,17 @@ func (s *SupernodeConfigTestSuite) TestIsSuperPID(c *check.C) {
 	c.Assert(conf.IsSuperPID("superNodePID"), check.DeepEquals, true)
 	c.Assert(conf.IsSuperPID("Test"), check.DeepEquals, false)
 }
+
+func (s *SupernodeConfigTestSuite) TestFeatures(c *check.C) {
+	conf := NewConfig()
+	c.Assert(conf.Features(), check.DeepEquals, []string{"low-priority", "event-log"})
+
+	conf.SchedulerCanaryStrategy = SchedulerStrategySequential
+	c.Assert(conf.Features(), check.DeepEquals, []string{"low-priority", "event-log"},
+		check.Commentf("the canary without percent isn't enabled"))
+	conf.SchedulerCanaryPercent = 10
+	conf.ReplicationFactor = 2
+	conf.PeerTokenSecret = "secret"
+	c.Assert(conf.Features(), check.DeepEquals,
+		[]string{"scheduler-canary", "replication", "low-priority", "event-log", "peer-tokens"})
+}
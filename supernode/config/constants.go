@@ -38,6 +38,9 @@ const (
 
 	// SuperNodeCIdPrefix is a string as the prefix of the supernode.
 	SuperNodeCIdPrefix = "cdnnode:"
+
+	// MetaStoreFile is the path of the meta store relative to the HomeDir.
+	MetaStoreFile = "meta/tasks.db"
 )
 
 // PieceStatus code
@@ -61,6 +64,41 @@ const (
 
 	// DefaultPeerDownLimit indicates the default limit of the download task count as a client.
 	DefaultPeerDownLimit = 4
+
+	// DefaultLowPriorityRatio indicates the default ratio of the upload slots and the origin
+	// bandwidth which the downloads of a lower priority can take.
+	DefaultLowPriorityRatio = 0.25
+
+	// DefaultGroupUrgentWindow is the default time before the deadline of a task group
+	// within which the downloads of the group are scheduled as the high priority.
+	DefaultGroupUrgentWindow = time.Minute
+
+	// DefaultPeerCacheFullRatio indicates the default ratio of the cache utilization
+	// beyond which the cache of a peer is treated as nearly full.
+	DefaultPeerCacheFullRatio = 0.9
+
+	// DefaultReplicationInterval indicates the default interval of checking the replicas
+	// of the long-lived tasks.
+	DefaultReplicationInterval = time.Minute
+
+	// DefaultPushInterval indicates the default interval of checking the progress
+	// of the peers accepting the pushed pieces.
+	DefaultPushInterval = 10 * time.Second
+
+	// DefaultPushMaxPieces indicates the default max number of the missing pieces
+	// of a straggler pushed in an interval.
+	DefaultPushMaxPieces = 16
+)
+
+// The strategies of the scheduler.
+const (
+	// SchedulerStrategyRarestFirst prioritizes the pieces least distributed in the network,
+	// and then the ones closest to the pieces running on the client.
+	SchedulerStrategyRarestFirst = "rarest-first"
+
+	// SchedulerStrategySequential prioritizes the pieces in the order of the piece numbers,
+	// which lets the clients consume the file while downloading it.
+	SchedulerStrategySequential = "sequential"
 )
 
 const (
@@ -70,6 +108,9 @@ const (
 	// DefaultPieceSizeLimit 15M
 	DefaultPieceSizeLimit = 15 * 1024 * 1024
 
+	// MinPieceSize is the min piece size which the clients can choose, 256K
+	MinPieceSize = 256 * 1024
+
 	// PieceHeadSize 4 bytes
 	PieceHeadSize = 4
 
@@ -83,6 +124,10 @@ const (
 const (
 	// CDNWriterRoutineLimit 4
 	CDNWriterRoutineLimit = 4
+
+	// CDNPieceWriteAttempts is the max number of the attempts of writing a piece
+	// fetched by the CDN to the storage.
+	CDNPieceWriteAttempts = 2
 )
 
 const (
@@ -109,6 +154,56 @@ const (
 
 	// DefaultPeerGCDelay is the delay time to execute the GC after the peer has reported the offline.
 	DefaultPeerGCDelay = 3 * time.Minute
+
+	// DefaultPeerSuspectTimeout is the time after the last heart beat of a peer
+	// that the peer is treated as suspect.
+	DefaultPeerSuspectTimeout = 30 * time.Second
+
+	// DefaultPeerDeadTimeout is the time after the last heart beat of a peer
+	// that the peer is treated as dead.
+	DefaultPeerDeadTimeout = 90 * time.Second
+
+	// DefaultClientProgressGrace is how long the progress deadline of a dfget task
+	// is extended by an extension.
+	DefaultClientProgressGrace = time.Minute
+
+	// DefaultMaxProgressExtensions is the max number of the extensions granted to
+	// a dfget task since its last piece downloaded successfully.
+	DefaultMaxProgressExtensions = 5
+
+	// DefaultClockSkewTolerance is the max skew of the clock of a peer from supernode
+	// beyond which a warning is logged.
+	DefaultClockSkewTolerance = 5 * time.Second
+
+	// DefaultClockMaxStep is the max time the logical clock of supernode advances at a time.
+	DefaultClockMaxStep = 5 * time.Second
+
+	// DefaultOriginFailoverCooldown is the time that a failed origin is tried after the healthy ones.
+	DefaultOriginFailoverCooldown = time.Minute
+
+	// DefaultAnalyticsInterval is the interval of aggregating the usage summaries.
+	DefaultAnalyticsInterval = time.Minute
+
+	// DefaultAnomalyWindow is the window of detecting the abnormal rates.
+	DefaultAnomalyWindow = time.Minute
+
+	// DefaultAnomalyMinSamples is the minimal number of the samples in a window
+	// for the rate of a group to be checked.
+	DefaultAnomalyMinSamples = 20
+
+	// DefaultAnomalyThreshold is how much the rate must exceed the baseline to fire an alert.
+	DefaultAnomalyThreshold = 0.3
+
+	// DefaultDispatchWorkers is the default number of the workers which dispatch the piece tasks.
+	DefaultDispatchWorkers = 64
+
+	// DefaultDispatchQueueSize is the default max number of the pulls of piece tasks
+	// waiting for the dispatch workers.
+	DefaultDispatchQueueSize = 1024
+
+	// DefaultEventLogSize is the default number of the latest event logs of the downloads
+	// kept in memory.
+	DefaultEventLogSize = 1000
 )
 
 // Default config value for gc disk
@@ -122,6 +217,18 @@ const (
 	DefaultGCDiskInterval = 15 * time.Second
 
 	DefaultCleanRatio = 1
+
+	// DefaultStorageForecastWindow is the default window over which the growth
+	// rate of the cache is estimated to forecast the free disk.
+	DefaultStorageForecastWindow = 30 * time.Minute
+
+	// DefaultCDNHashWorkers is the default number of the workers which hash and
+	// write the pieces of a task concurrently when the CDN fetches it from the source.
+	DefaultCDNHashWorkers = CDNWriterRoutineLimit
+
+	// DefaultCacheScanWorkers is the default number of the workers which scan
+	// the directories of the cached files in parallel after supernode starts.
+	DefaultCacheScanWorkers = 8
 )
 
 const (
@@ -136,3 +243,31 @@ const (
 	// unit: MB/s
 	DefaultMaxBandwidth = 200 * rate.MB
 )
+
+// DefaultPassThroughHeaders are the default headers of the responses of the origins
+// which are kept with the tasks and replayed by dfdaemon.
+var DefaultPassThroughHeaders = []string{"Content-Type", "Docker-Content-Digest"}
+
+// framingHeaders are the headers describing how a response is transferred rather than
+// the file, which are set by whoever serves the response and can't be passed through.
+var framingHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Content-Range":     true,
+	"Keep-Alive":        true,
+	"Set-Cookie":        true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+const (
+	// DefaultBandwidthProbeSize is the default number of the bytes sent for
+	// a bandwidth probe of dfget which doesn't specify the size.
+	DefaultBandwidthProbeSize = 4 * fileutils.MB
+
+	// MaxBandwidthProbeSize is the max number of the bytes sent for a bandwidth probe,
+	// so that the probes can't keep supernode busy sending data.
+	MaxBandwidthProbeSize = 16 * fileutils.MB
+)
@@ -20,4 +20,8 @@ var (
 	// DownloadHome is the parent directory where the downloaded files are stored
 	// which is a relative path.
 	DownloadHome = "download"
+
+	// PieceHome is the parent directory where the content-addressed pieces are stored
+	// to dedup the identical pieces of the tasks, which is a relative path.
+	PieceHome = "pieces"
 )
@@ -0,0 +1,189 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// Validate checks the ranges of the properties and the constraints between them,
+// and returns the first invalid one. It's used to check the config file before
+// deploying, so the problems found at starting are reported in advance.
+func (c *Config) Validate() error {
+	if c.BaseProperties == nil {
+		return errors.Wrap(errortypes.ErrEmptyValue, "base")
+	}
+	b := c.BaseProperties
+
+	switch b.CDNPattern {
+	case CDNPatternLocal, CDNPatternSource:
+	default:
+		return invalid("cdnPattern", "must be local or source: %s", b.CDNPattern)
+	}
+
+	for name, port := range map[string]int{"listenPort": b.ListenPort, "downloadPort": b.DownloadPort} {
+		if port <= 0 || port > 65535 {
+			return invalid(name, "out of range: %d", port)
+		}
+	}
+	if b.AdminPort < 0 || b.AdminPort > 65535 {
+		return invalid("adminPort", "out of range: %d", b.AdminPort)
+	}
+	if b.AdminPort > 0 && b.AdminPort == b.ListenPort {
+		return invalid("adminPort", "conflicts with listenPort %d", b.ListenPort)
+	}
+
+	for name, v := range map[string]int{
+		"schedulerCorePoolSize": b.SchedulerCorePoolSize,
+		"peerUpLimit":           b.PeerUpLimit,
+		"peerDownLimit":         b.PeerDownLimit,
+		"eliminationLimit":      b.EliminationLimit,
+		"failureCountLimit":     b.FailureCountLimit,
+		"schedulerAuditSize":    b.SchedulerAuditSize,
+		"eventLogSize":          b.EventLogSize,
+		"replicationFactor":     b.ReplicationFactor,
+		"pushMaxPieces":         b.PushMaxPieces,
+		"anomalyMinSamples":     b.AnomalyMinSamples,
+		"cdnHashWorkers":        b.CDNHashWorkers,
+		"cacheScanWorkers":      b.CacheScanWorkers,
+		"dispatchWorkers":       b.DispatchWorkers,
+		"dispatchQueueSize":     b.DispatchQueueSize,
+		"maxProgressExtensions": b.MaxProgressExtensions,
+	} {
+		if v < 0 {
+			return invalid(name, "must not be negative: %d", v)
+		}
+	}
+
+	for name, v := range map[string]float64{
+		"peerCacheFullRatio":  b.PeerCacheFullRatio,
+		"lowPriorityRatio":    b.LowPriorityRatio,
+		"accessLogSampleRate": b.AccessLogSampleRate,
+		"pushThreshold":       b.PushThreshold,
+	} {
+		if v < 0 || v > 1 {
+			return invalid(name, "must be in [0, 1]: %v", v)
+		}
+	}
+	if b.IncentiveWeight < 0 {
+		return invalid("incentiveWeight", "must not be negative: %v", b.IncentiveWeight)
+	}
+	if b.SourceSizeMargin < 0 {
+		return invalid("sourceSizeMargin", "must not be negative: %v", b.SourceSizeMargin)
+	}
+	if b.CleanRatio < 1 || b.CleanRatio > 10 {
+		return invalid("cleanRatio", "must be in [1, 10]: %d", b.CleanRatio)
+	}
+	if b.SchedulerCanaryPercent < 0 || b.SchedulerCanaryPercent > 100 {
+		return invalid("schedulerCanaryPercent", "must be in [0, 100]: %d", b.SchedulerCanaryPercent)
+	}
+	if b.SchedulerCanaryPercent > 0 && b.SchedulerCanaryStrategy == "" {
+		return invalid("schedulerCanaryStrategy", "must be set when schedulerCanaryPercent is %d", b.SchedulerCanaryPercent)
+	}
+
+	if b.PeerSuspectTimeout > 0 && b.PeerDeadTimeout > 0 && b.PeerSuspectTimeout >= b.PeerDeadTimeout {
+		return invalid("peerSuspectTimeout", "must be less than peerDeadTimeout %v: %v", b.PeerDeadTimeout, b.PeerSuspectTimeout)
+	}
+	if b.FullGCThreshold > b.YoungGCThreshold {
+		return invalid("fullGCThreshold", "must not be greater than youngGCThreshold %v: %v", b.YoungGCThreshold, b.FullGCThreshold)
+	}
+	if b.GroupUrgentWindow < 0 {
+		return invalid("groupUrgentWindow", "must not be negative: %v", b.GroupUrgentWindow)
+	}
+	if b.ClockMaxStep < 0 {
+		return invalid("clockMaxStep", "must not be negative: %v", b.ClockMaxStep)
+	}
+	if b.StorageForecastHorizon < 0 {
+		return invalid("storageForecastHorizon", "must not be negative: %v", b.StorageForecastHorizon)
+	}
+	if b.StorageForecastHorizon > 0 && b.StorageForecastWindow <= 0 {
+		return invalid("storageForecastWindow", "must be positive when storageForecastHorizon is %v: %v",
+			b.StorageForecastHorizon, b.StorageForecastWindow)
+	}
+
+	for priority, weight := range b.DispatchWeights {
+		switch types.Priority(priority) {
+		case types.PriorityHigh, types.PriorityNormal, types.PriorityLow:
+		default:
+			return invalid("dispatchWeights", "unknown priority: %s", priority)
+		}
+		if weight <= 0 {
+			return invalid("dispatchWeights", "weight of %s must be positive: %d", priority, weight)
+		}
+	}
+
+	for _, name := range b.PassThroughHeaders {
+		if !headerNamePattern.MatchString(name) {
+			return invalid("passThroughHeaders", "invalid header name: %q", name)
+		}
+		if framingHeaders[http.CanonicalHeaderKey(name)] {
+			return invalid("passThroughHeaders", "can't pass through %s", name)
+		}
+	}
+
+	return validatePatterns(b)
+}
+
+// validatePatterns checks the regular expressions in the properties.
+func validatePatterns(b *BaseProperties) error {
+	var patterns []string
+	patterns = append(patterns, b.ReplicationTasks...)
+	for _, r := range b.CacheTTLRules {
+		if r != nil {
+			patterns = append(patterns, r.URLPattern)
+		}
+	}
+	for _, r := range b.TaskIDRules {
+		if r != nil {
+			patterns = append(patterns, r.URLPattern)
+		}
+	}
+	for _, p := range b.OriginProxies {
+		if p != nil {
+			patterns = append(patterns, p.HostPattern)
+		}
+	}
+	for _, m := range b.OriginMirrors {
+		if m != nil {
+			patterns = append(patterns, m.URLPattern)
+		}
+	}
+	for _, e := range b.EdgeCaches {
+		if e != nil {
+			patterns = append(patterns, e.URLPattern)
+		}
+	}
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return invalid("pattern", "%s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// headerNamePattern matches the valid names of the http headers, which are tokens of RFC 7230.
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+func invalid(name, format string, args ...interface{}) error {
+	return errors.Wrapf(errortypes.ErrInvalidValue, name+": "+format, args...)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"time"
+
+	"github.com/go-check/check"
+)
+
+func (s *SupernodeConfigTestSuite) TestValidate(c *check.C) {
+	c.Assert(NewConfig().Validate(), check.IsNil)
+	c.Assert((&Config{}).Validate(), check.NotNil)
+
+	var cases = []struct {
+		modify func(b *BaseProperties)
+		errMsg string
+	}{
+		{func(b *BaseProperties) { b.CDNPattern = "p2p" }, "cdnPattern: .*"},
+		{func(b *BaseProperties) { b.ListenPort = 65536 }, "listenPort: .*"},
+		{func(b *BaseProperties) { b.AdminPort = b.ListenPort }, "adminPort: .*"},
+		{func(b *BaseProperties) { b.PeerUpLimit = -1 }, "peerUpLimit: .*"},
+		{func(b *BaseProperties) { b.LowPriorityRatio = 1.5 }, "lowPriorityRatio: .*"},
+		{func(b *BaseProperties) { b.CleanRatio = 0 }, "cleanRatio: .*"},
+		{func(b *BaseProperties) { b.SchedulerCanaryPercent = 10 }, "schedulerCanaryStrategy: .*"},
+		{func(b *BaseProperties) {
+			b.PeerSuspectTimeout, b.PeerDeadTimeout = time.Minute, time.Second
+		}, "peerSuspectTimeout: .*"},
+		{func(b *BaseProperties) { b.GroupUrgentWindow = -time.Second }, "groupUrgentWindow: .*"},
+		{func(b *BaseProperties) { b.ClockMaxStep = -time.Second }, "clockMaxStep: .*"},
+		{func(b *BaseProperties) {
+			b.StorageForecastHorizon, b.StorageForecastWindow = time.Hour, 0
+		}, "storageForecastWindow: .*"},
+		{func(b *BaseProperties) { b.DispatchWeights = map[string]int{"urgent": 1} }, "dispatchWeights: .*"},
+		{func(b *BaseProperties) { b.PassThroughHeaders = []string{"X Bad"} }, "passThroughHeaders: .*"},
+		{func(b *BaseProperties) { b.PassThroughHeaders = []string{"content-length"} }, "passThroughHeaders: .*"},
+		{func(b *BaseProperties) { b.ReplicationTasks = []string{"("} }, "pattern: .*"},
+	}
+	for _, v := range cases {
+		cfg := NewConfig()
+		v.modify(cfg.BaseProperties)
+		c.Check(cfg.Validate(), check.ErrorMatches, v.errMsg)
+	}
+}
@@ -0,0 +1,430 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var _ mgr.AnalyticsMgr = &Manager{}
+
+const (
+	// retentionDays is the number of the days whose statistics are kept,
+	// which covers the last four complete weeks.
+	retentionDays = 35
+
+	// topURLsLimit is the max number of the urls in a summary.
+	topURLsLimit = 10
+
+	// noBackSourceReason is the back-source reason of the downloads from the p2p network.
+	noBackSourceReason = "0"
+
+	// maxBackSourceCauses is the max number of the back-source causes kept, beyond which
+	// the causes of the new groups are counted in the group "<kind>:other".
+	maxBackSourceCauses = 10000
+	otherGroup          = "other"
+)
+
+type causeKey struct {
+	group  string
+	reason string
+}
+
+// causeStat is the statistics of the downloads of a group backing to the source for a reason.
+type causeStat struct {
+	downloads     int64
+	failures      int64
+	afterTotal    float64
+	durationTotal float64
+}
+
+type urlStat struct {
+	downloads int64
+	bytes     int64
+}
+
+// dayStat is the statistics of the downloads reported in a day.
+type dayStat struct {
+	downloads       int64
+	failures        int64
+	backSourced     int64
+	deliveredBytes  int64
+	backSourceBytes int64
+	sourceBytes     int64
+	failureReasons  map[string]int64
+	urls            map[string]*urlStat
+}
+
+func newDayStat() *dayStat {
+	return &dayStat{
+		failureReasons: make(map[string]int64),
+		urls:           make(map[string]*urlStat),
+	}
+}
+
+// add adds the statistics of another day into d.
+func (d *dayStat) add(o *dayStat) {
+	d.downloads += o.downloads
+	d.failures += o.failures
+	d.backSourced += o.backSourced
+	d.deliveredBytes += o.deliveredBytes
+	d.backSourceBytes += o.backSourceBytes
+	d.sourceBytes += o.sourceBytes
+	for reason, n := range o.failureReasons {
+		d.failureReasons[reason] += n
+	}
+	for url, s := range o.urls {
+		d.getOrCreateURL(url).add(s)
+	}
+}
+
+func (d *dayStat) getOrCreateURL(url string) *urlStat {
+	s, ok := d.urls[url]
+	if !ok {
+		s = &urlStat{}
+		d.urls[url] = s
+	}
+	return s
+}
+
+func (s *urlStat) add(o *urlStat) {
+	s.downloads += o.downloads
+	s.bytes += o.bytes
+}
+
+// Manager is an implementation of the interface of AnalyticsMgr.
+type Manager struct {
+	sync.Mutex
+
+	cfg             *config.Config
+	taskMgr         mgr.TaskMgr
+	contributionMgr mgr.ContributionMgr
+
+	// days maps the start of a day to the statistics of the downloads in the day.
+	days map[time.Time]*dayStat
+	// lastSourceBytes is the total bytes fetched from the source at the last aggregation,
+	// which is used to calculate the bytes fetched in the current day.
+	lastSourceBytes int64
+
+	// summaries maps the period to the summaries aggregated by the last run of the job.
+	summaries map[string][]*types.UsageSummary
+
+	// causes is the statistics of the back-source causes of every group since supernode started.
+	causes map[causeKey]*causeStat
+
+	now func() time.Time
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config, taskMgr mgr.TaskMgr, contributionMgr mgr.ContributionMgr) (*Manager, error) {
+	return &Manager{
+		cfg:             cfg,
+		taskMgr:         taskMgr,
+		contributionMgr: contributionMgr,
+		days:            make(map[time.Time]*dayStat),
+		summaries:       make(map[string][]*types.UsageSummary),
+		causes:          make(map[causeKey]*causeStat),
+		now:             time.Now,
+	}, nil
+}
+
+// RecordDownload records a download reported by dfget into the statistics of the current day.
+// The downloads are grouped by the url of the task, and the taskID is used if the task is not found.
+// The cause of the download backing to the source is also recorded for the task and every label
+// of the peer.
+func (m *Manager) RecordDownload(ctx context.Context, request *types.TaskMetricsRequest, labels map[string]string) {
+	if request == nil {
+		return
+	}
+	url := request.TaskID
+	if m.taskMgr != nil {
+		if task, err := m.taskMgr.Get(ctx, request.TaskID); err == nil && task.TaskURL != "" {
+			url = task.TaskURL
+		}
+	}
+	reason := request.BacksourceReason
+	if reason == "" {
+		reason = noBackSourceReason
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if reason != noBackSourceReason {
+		m.recordCause(mgr.BackSourceGroupTask, request.TaskID, reason, request)
+		for k, v := range labels {
+			m.recordCause(mgr.BackSourceGroupLabel, k+"="+v, reason, request)
+		}
+	}
+
+	day := m.getOrCreateDay(m.now())
+	if !request.Success {
+		day.failures++
+		day.failureReasons[reason]++
+		return
+	}
+	day.downloads++
+	day.deliveredBytes += request.FileLength
+	if reason != noBackSourceReason {
+		day.backSourced++
+		day.backSourceBytes += request.FileLength
+	}
+	s := day.getOrCreateURL(url)
+	s.downloads++
+	s.bytes += request.FileLength
+}
+
+// recordCause records the back-source cause of the download into the group of the kind.
+// It must be called with the lock held.
+func (m *Manager) recordCause(kind, name, reason string, request *types.TaskMetricsRequest) {
+	key := causeKey{group: kind + ":" + name, reason: reason}
+	s, ok := m.causes[key]
+	if !ok {
+		if len(m.causes) >= maxBackSourceCauses {
+			key.group = kind + ":" + otherGroup
+			s = m.causes[key]
+		}
+		if s == nil {
+			s = &causeStat{}
+			m.causes[key] = s
+		}
+	}
+	s.downloads++
+	if !request.Success {
+		s.failures++
+	}
+	s.afterTotal += request.BacksourceAfter
+	s.durationTotal += request.BacksourceDuration
+}
+
+// ListBackSourceCauses returns the back-source causes of the groups of the kind,
+// sorted by the number of the downloads, and then by the group and the reason.
+func (m *Manager) ListBackSourceCauses(ctx context.Context, kind string) ([]*types.BackSourceCause, error) {
+	switch kind {
+	case "", mgr.BackSourceGroupTask, mgr.BackSourceGroupLabel:
+	default:
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "group: %s", kind)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*types.BackSourceCause, 0)
+	for key, s := range m.causes {
+		if kind != "" && !strings.HasPrefix(key.group, kind+":") {
+			continue
+		}
+		result = append(result, &types.BackSourceCause{
+			Group:        key.group,
+			Reason:       key.reason,
+			Downloads:    s.downloads,
+			Failures:     s.failures,
+			MeanAfter:    s.afterTotal / float64(s.downloads),
+			MeanDuration: s.durationTotal / float64(s.downloads),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Downloads != result[j].Downloads {
+			return result[i].Downloads > result[j].Downloads
+		}
+		if result[i].Group != result[j].Group {
+			return result[i].Group < result[j].Group
+		}
+		return result[i].Reason < result[j].Reason
+	})
+	return result, nil
+}
+
+// StartAggregation starts the job which aggregates the statistics into the summaries
+// every AnalyticsInterval.
+func (m *Manager) StartAggregation(ctx context.Context) {
+	interval := m.cfg.AnalyticsInterval
+	if interval <= 0 {
+		interval = config.DefaultAnalyticsInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.aggregate(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// GetSummaries returns the summaries of the period aggregated by the last run of the job.
+func (m *Manager) GetSummaries(ctx context.Context, period string) ([]*types.UsageSummary, error) {
+	switch period {
+	case types.UsageSummaryPeriodDaily, types.UsageSummaryPeriodWeekly:
+	default:
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "period: %s", period)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	summaries := m.summaries[period]
+	if summaries == nil {
+		return []*types.UsageSummary{}, nil
+	}
+	return summaries, nil
+}
+
+// aggregate accounts the bytes fetched from the source since the last run into
+// the current day, removes the expired days and rebuilds the summaries.
+func (m *Manager) aggregate(ctx context.Context) {
+	var sourceBytes int64
+	if m.contributionMgr != nil {
+		sourceBytes = m.contributionMgr.GetSavings(ctx).SourceBytes
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	now := m.now()
+	if delta := sourceBytes - m.lastSourceBytes; delta > 0 {
+		m.getOrCreateDay(now).sourceBytes += delta
+	}
+	m.lastSourceBytes = sourceBytes
+
+	expired := startOfDay(now).AddDate(0, 0, -retentionDays+1)
+	weeks := make(map[time.Time]*dayStat)
+	var daily []*types.UsageSummary
+	for start, day := range m.days {
+		if start.Before(expired) {
+			delete(m.days, start)
+			continue
+		}
+		daily = append(daily, newSummary(types.UsageSummaryPeriodDaily, start, minTime(start.AddDate(0, 0, 1), now), day))
+
+		week := startOfWeek(start)
+		if _, ok := weeks[week]; !ok {
+			weeks[week] = newDayStat()
+		}
+		weeks[week].add(day)
+	}
+
+	var weekly []*types.UsageSummary
+	for start, week := range weeks {
+		weekly = append(weekly, newSummary(types.UsageSummaryPeriodWeekly, start, minTime(start.AddDate(0, 0, 7), now), week))
+	}
+	sortSummaries(daily)
+	sortSummaries(weekly)
+	m.summaries[types.UsageSummaryPeriodDaily] = daily
+	m.summaries[types.UsageSummaryPeriodWeekly] = weekly
+	logrus.Debugf("aggregate the usage of %d days into %d weekly summaries", len(daily), len(weekly))
+}
+
+// getOrCreateDay returns the statistics of the day of t. It must be called with the lock held.
+func (m *Manager) getOrCreateDay(t time.Time) *dayStat {
+	start := startOfDay(t)
+	day, ok := m.days[start]
+	if !ok {
+		day = newDayStat()
+		m.days[start] = day
+	}
+	return day
+}
+
+func newSummary(period string, start, end time.Time, stat *dayStat) *types.UsageSummary {
+	s := &types.UsageSummary{
+		Period:          period,
+		StartTime:       strfmt.DateTime(start),
+		EndTime:         strfmt.DateTime(end),
+		Downloads:       stat.downloads,
+		Failures:        stat.failures,
+		DeliveredBytes:  stat.deliveredBytes,
+		BackSourceBytes: stat.backSourceBytes,
+		SourceBytes:     stat.sourceBytes,
+		SavedBytes:      stat.deliveredBytes - stat.sourceBytes,
+		TopURLs:         topURLs(stat.urls, topURLsLimit),
+	}
+	if stat.downloads > 0 {
+		s.BackSourceRate = float64(stat.backSourced) / float64(stat.downloads)
+	}
+	if len(stat.failureReasons) > 0 {
+		s.FailureReasons = make(map[string]int64, len(stat.failureReasons))
+		for reason, n := range stat.failureReasons {
+			s.FailureReasons[reason] = n
+		}
+	}
+	return s
+}
+
+// topURLs returns the limit urls with the most downloads, and then the most bytes.
+func topURLs(urls map[string]*urlStat, limit int) []*types.URLUsage {
+	result := make([]*types.URLUsage, 0, len(urls))
+	for url, s := range urls {
+		result = append(result, &types.URLUsage{URL: url, Downloads: s.downloads, Bytes: s.bytes})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Downloads != result[j].Downloads {
+			return result[i].Downloads > result[j].Downloads
+		}
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].URL < result[j].URL
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// sortSummaries sorts the summaries with the latest first.
+func sortSummaries(summaries []*types.UsageSummary) {
+	sort.Slice(summaries, func(i, j int) bool {
+		return time.Time(summaries[i].StartTime).After(time.Time(summaries[j].StartTime))
+	})
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the start of the week of t, which starts on Monday.
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
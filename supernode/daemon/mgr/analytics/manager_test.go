@@ -0,0 +1,142 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&AnalyticsManagerTestSuite{})
+}
+
+type AnalyticsManagerTestSuite struct{}
+
+func (s *AnalyticsManagerTestSuite) TestAggregate(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	contributionMgr := mock.NewMockContributionMgr(ctl)
+
+	manager, _ := NewManager(config.NewConfig(), nil, contributionMgr)
+	// 2020-01-06 is a Monday
+	now := time.Date(2020, 1, 6, 12, 0, 0, 0, time.Local)
+	manager.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	record := func(taskID string, length int64, success bool, reason string) {
+		manager.RecordDownload(ctx, &types.TaskMetricsRequest{
+			TaskID: taskID, FileLength: length, Success: success, BacksourceReason: reason}, nil)
+	}
+
+	// the days of the last week
+	contributionMgr.EXPECT().GetSavings(gomock.Any()).Return(&types.BandwidthSavings{SourceBytes: 100})
+	now = now.AddDate(0, 0, -1)
+	record("a", 100, true, "0")
+	record("a", 100, true, "")
+	manager.aggregate(ctx)
+
+	// the current day
+	contributionMgr.EXPECT().GetSavings(gomock.Any()).Return(&types.BandwidthSavings{SourceBytes: 300})
+	now = now.AddDate(0, 0, 1)
+	record("b", 200, true, "3")
+	record("a", 100, true, "0")
+	record("b", 0, false, "3")
+	manager.aggregate(ctx)
+
+	daily, err := manager.GetSummaries(ctx, types.UsageSummaryPeriodDaily)
+	c.Assert(err, check.IsNil)
+	c.Assert(daily, check.HasLen, 2)
+	today := daily[0]
+	c.Check(time.Time(today.StartTime).Equal(time.Date(2020, 1, 6, 0, 0, 0, 0, time.Local)), check.Equals, true)
+	c.Check(time.Time(today.EndTime).Equal(now), check.Equals, true)
+	c.Check(today.Downloads, check.Equals, int64(2))
+	c.Check(today.Failures, check.Equals, int64(1))
+	c.Check(today.FailureReasons, check.DeepEquals, map[string]int64{"3": 1})
+	c.Check(today.BackSourceRate, check.Equals, 0.5)
+	c.Check(today.BackSourceBytes, check.Equals, int64(200))
+	c.Check(today.DeliveredBytes, check.Equals, int64(300))
+	c.Check(today.SourceBytes, check.Equals, int64(200))
+	c.Check(today.SavedBytes, check.Equals, int64(100))
+	c.Assert(today.TopURLs, check.HasLen, 2)
+	c.Check(today.TopURLs[0].URL, check.Equals, "b")
+
+	yesterday := daily[1]
+	c.Check(yesterday.Downloads, check.Equals, int64(2))
+	c.Check(yesterday.SavedBytes, check.Equals, int64(100))
+	c.Check(yesterday.TopURLs, check.DeepEquals, []*types.URLUsage{{URL: "a", Downloads: 2, Bytes: 200}})
+
+	weekly, err := manager.GetSummaries(ctx, types.UsageSummaryPeriodWeekly)
+	c.Assert(err, check.IsNil)
+	c.Assert(weekly, check.HasLen, 2)
+	c.Check(time.Time(weekly[0].StartTime).Equal(time.Time(today.StartTime)), check.Equals, true)
+	c.Check(time.Time(weekly[1].StartTime).Equal(time.Date(2019, 12, 30, 0, 0, 0, 0, time.Local)), check.Equals, true)
+
+	// the expired days are removed
+	contributionMgr.EXPECT().GetSavings(gomock.Any()).Return(&types.BandwidthSavings{SourceBytes: 300})
+	now = now.AddDate(0, 0, retentionDays)
+	manager.aggregate(ctx)
+	daily, _ = manager.GetSummaries(ctx, types.UsageSummaryPeriodDaily)
+	c.Check(daily, check.HasLen, 0)
+
+	_, err = manager.GetSummaries(ctx, "monthly")
+	c.Check(err, check.NotNil)
+}
+
+func (s *AnalyticsManagerTestSuite) TestListBackSourceCauses(c *check.C) {
+	manager, _ := NewManager(config.NewConfig(), nil, nil)
+	ctx := context.Background()
+
+	labels := map[string]string{"idc": "hz"}
+	manager.RecordDownload(ctx, &types.TaskMetricsRequest{TaskID: "a", Success: true}, labels)
+	manager.RecordDownload(ctx, &types.TaskMetricsRequest{TaskID: "a", Success: true,
+		BacksourceReason: "3", BacksourceAfter: 2, BacksourceDuration: 4}, labels)
+	manager.RecordDownload(ctx, &types.TaskMetricsRequest{TaskID: "a", Success: false,
+		BacksourceReason: "3", BacksourceAfter: 4, BacksourceDuration: 2}, labels)
+	manager.RecordDownload(ctx, &types.TaskMetricsRequest{TaskID: "b", Success: true,
+		BacksourceReason: "1"}, labels)
+
+	causes, err := manager.ListBackSourceCauses(ctx, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(causes, check.HasLen, 4)
+	c.Check(causes[0], check.DeepEquals, &types.BackSourceCause{Group: "label:idc=hz", Reason: "3",
+		Downloads: 2, Failures: 1, MeanAfter: 3, MeanDuration: 3})
+	c.Check(causes[1].Group, check.Equals, "task:a")
+	c.Check(causes[2], check.DeepEquals, &types.BackSourceCause{Group: "label:idc=hz", Reason: "1", Downloads: 1})
+
+	causes, err = manager.ListBackSourceCauses(ctx, "task")
+	c.Assert(err, check.IsNil)
+	c.Assert(causes, check.HasLen, 2)
+	c.Check(causes[0].Group, check.Equals, "task:a")
+	c.Check(causes[0].Downloads, check.Equals, int64(2))
+	c.Check(causes[1].Group, check.Equals, "task:b")
+
+	_, err = manager.ListBackSourceCauses(ctx, "peer")
+	c.Check(err, check.NotNil)
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+const (
+	// BackSourceGroupTask groups the back-source causes by task.
+	BackSourceGroupTask = "task"
+
+	// BackSourceGroupLabel groups the back-source causes by the labels of the peers.
+	BackSourceGroupLabel = "label"
+)
+
+// AnalyticsMgr as an interface defines all operations to aggregate the downloads
+// reported by dfget into the daily and weekly usage summaries.
+type AnalyticsMgr interface {
+	// RecordDownload records a download reported by dfget of the peer with the labels
+	// when it finishes.
+	RecordDownload(ctx context.Context, request *types.TaskMetricsRequest, labels map[string]string)
+
+	// ListBackSourceCauses returns the causes of the downloads backing to the source
+	// per task and per peer label since supernode started, the most frequent first.
+	// Only the groups of the kind are returned if kind is BackSourceGroupTask or
+	// BackSourceGroupLabel, and all are returned if it's empty.
+	ListBackSourceCauses(ctx context.Context, kind string) ([]*types.BackSourceCause, error)
+
+	// StartAggregation starts the job which aggregates the recorded downloads
+	// into the summaries periodically.
+	StartAggregation(ctx context.Context)
+
+	// GetSummaries returns the summaries of the period aggregated by the last run
+	// of the job, the latest first. The period must be daily or weekly.
+	GetSummaries(ctx context.Context, period string) ([]*types.UsageSummary, error)
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anomaly
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/sirupsen/logrus"
+)
+
+var _ mgr.AnomalyMgr = &Manager{}
+
+const (
+	// baselineWeight is the weight of the last window in the moving average of the rate.
+	baselineWeight = 0.3
+
+	// maxIdleWindows is the number of the windows without any sample
+	// after which the baseline of a group is dropped.
+	maxIdleWindows = 60
+
+	// maxAlerts is the max number of the latest alerts which are kept.
+	maxAlerts = 100
+
+	// webhookTimeout is the timeout of posting an alert to the webhook.
+	webhookTimeout = 5 * time.Second
+)
+
+type seriesKey struct {
+	kind  string
+	group string
+}
+
+type counter struct {
+	bad   int64
+	total int64
+}
+
+// series is the state of the rate of a group among the windows.
+type series struct {
+	baseline float64
+	firing   bool
+	idle     int
+}
+
+// Manager is an implementation of the interface of AnomalyMgr.
+type Manager struct {
+	sync.Mutex
+
+	cfg *config.Config
+
+	// current counts the samples observed in the current window.
+	current map[seriesKey]*counter
+	series  map[seriesKey]*series
+	alerts  []*mgr.AnomalyAlert
+
+	post func(url string, body interface{}, timeout time.Duration) (int, []byte, error)
+	now  func() time.Time
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config) (*Manager, error) {
+	return &Manager{
+		cfg:     cfg,
+		current: make(map[seriesKey]*counter),
+		series:  make(map[seriesKey]*series),
+		post:    httputils.PostJSON,
+		now:     time.Now,
+	}, nil
+}
+
+// ObserveDownload observes a download into the back-source rate of the task
+// and every label of the peer.
+func (m *Manager) ObserveDownload(ctx context.Context, taskID string, labels map[string]string, backSourced bool) {
+	m.observe(mgr.AnomalyKindBackSource, taskID, labels, backSourced)
+}
+
+// ObservePiece observes a piece into the piece failure rate of the task
+// and every label of the peer.
+func (m *Manager) ObservePiece(ctx context.Context, taskID string, labels map[string]string, success bool) {
+	m.observe(mgr.AnomalyKindPieceFailure, taskID, labels, !success)
+}
+
+func (m *Manager) observe(kind, taskID string, labels map[string]string, bad bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.count(seriesKey{kind: kind, group: "task:" + taskID}, bad)
+	for k, v := range labels {
+		m.count(seriesKey{kind: kind, group: "label:" + k + "=" + v}, bad)
+	}
+}
+
+// count must be called with the lock held.
+func (m *Manager) count(key seriesKey, bad bool) {
+	c, ok := m.current[key]
+	if !ok {
+		c = &counter{}
+		m.current[key] = c
+	}
+	c.total++
+	if bad {
+		c.bad++
+	}
+}
+
+// StartMonitor starts the job which checks the rates every AnomalyWindow.
+func (m *Manager) StartMonitor(ctx context.Context) {
+	window := m.cfg.AnomalyWindow
+	if window <= 0 {
+		window = config.DefaultAnomalyWindow
+	}
+
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.notify(m.check())
+			}
+		}
+	}()
+}
+
+// ListAlerts returns at most limit latest alerts, the latest first.
+func (m *Manager) ListAlerts(ctx context.Context, limit int) []*mgr.AnomalyAlert {
+	m.Lock()
+	defer m.Unlock()
+
+	n := len(m.alerts)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	result := make([]*mgr.AnomalyAlert, 0, n)
+	for i := len(m.alerts) - 1; i >= len(m.alerts)-n; i-- {
+		result = append(result, m.alerts[i])
+	}
+	return result
+}
+
+// check closes the current window and compares the rate of every group in it
+// with the baseline. An alert is fired when the rate exceeds the baseline by
+// AnomalyThreshold with at least AnomalyMinSamples samples, and it's resolved
+// when the rate falls back. The baseline isn't updated while the group is abnormal,
+// so that a lasting spike doesn't become the new normal.
+func (m *Manager) check() []*mgr.AnomalyAlert {
+	minSamples := int64(m.cfg.AnomalyMinSamples)
+	if minSamples <= 0 {
+		minSamples = config.DefaultAnomalyMinSamples
+	}
+	threshold := m.cfg.AnomalyThreshold
+	if threshold <= 0 {
+		threshold = config.DefaultAnomalyThreshold
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	current := m.current
+	m.current = make(map[seriesKey]*counter)
+	for key := range current {
+		if _, ok := m.series[key]; !ok {
+			m.series[key] = &series{}
+		}
+	}
+
+	now := m.now()
+	var alerts []*mgr.AnomalyAlert
+	for key, s := range m.series {
+		c, ok := current[key]
+		if !ok {
+			if s.idle++; s.idle >= maxIdleWindows && !s.firing {
+				delete(m.series, key)
+			}
+			continue
+		}
+		s.idle = 0
+		if c.total < minSamples {
+			continue
+		}
+
+		rate := float64(c.bad) / float64(c.total)
+		abnormal := rate >= s.baseline+threshold
+		if abnormal != s.firing {
+			state := mgr.AnomalyStateFiring
+			if !abnormal {
+				state = mgr.AnomalyStateResolved
+			}
+			alerts = append(alerts, &mgr.AnomalyAlert{
+				Time:     now,
+				Kind:     key.kind,
+				State:    state,
+				Group:    key.group,
+				Rate:     rate,
+				Baseline: s.baseline,
+				Samples:  c.total,
+			})
+			s.firing = abnormal
+		}
+		if !abnormal {
+			s.baseline = s.baseline*(1-baselineWeight) + rate*baselineWeight
+		}
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Kind != alerts[j].Kind {
+			return alerts[i].Kind < alerts[j].Kind
+		}
+		return alerts[i].Group < alerts[j].Group
+	})
+	m.alerts = append(m.alerts, alerts...)
+	if len(m.alerts) > maxAlerts {
+		m.alerts = append([]*mgr.AnomalyAlert(nil), m.alerts[len(m.alerts)-maxAlerts:]...)
+	}
+	return alerts
+}
+
+// notify logs the alerts and posts them to the webhook one by one if it's configured.
+func (m *Manager) notify(alerts []*mgr.AnomalyAlert) {
+	for _, alert := range alerts {
+		logrus.Warnf("anomaly %s of %s: %s, rate %.2f, baseline %.2f, samples %d",
+			alert.Kind, alert.Group, alert.State, alert.Rate, alert.Baseline, alert.Samples)
+		if m.cfg.AnomalyWebhook == "" {
+			continue
+		}
+		code, _, err := m.post(m.cfg.AnomalyWebhook, alert, webhookTimeout)
+		if err != nil {
+			logrus.Errorf("failed to post the anomaly alert to the webhook: %v", err)
+		} else if code >= 300 {
+			logrus.Errorf("failed to post the anomaly alert to the webhook: status code %d", code)
+		}
+	}
+}
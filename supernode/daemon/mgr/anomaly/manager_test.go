@@ -0,0 +1,120 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&AnomalyManagerTestSuite{})
+}
+
+type AnomalyManagerTestSuite struct{}
+
+func (s *AnomalyManagerTestSuite) TestCheck(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.AnomalyMinSamples = 10
+	manager, _ := NewManager(cfg)
+	ctx := context.Background()
+	labels := map[string]string{"idc": "a"}
+
+	observe := func(n, backSourced int) {
+		for i := 0; i < n; i++ {
+			manager.ObserveDownload(ctx, "foo", labels, i < backSourced)
+		}
+	}
+
+	// too few samples to be checked
+	observe(5, 5)
+	c.Check(manager.check(), check.HasLen, 0)
+
+	// a normal rate builds the baseline
+	observe(10, 1)
+	c.Check(manager.check(), check.HasLen, 0)
+
+	observe(10, 8)
+	alerts := manager.check()
+	c.Assert(alerts, check.HasLen, 2)
+	c.Check(alerts[0].Group, check.Equals, "label:idc=a")
+	c.Check(alerts[1].Group, check.Equals, "task:foo")
+	c.Check(alerts[1].Kind, check.Equals, mgr.AnomalyKindBackSource)
+	c.Check(alerts[1].State, check.Equals, mgr.AnomalyStateFiring)
+	c.Check(alerts[1].Rate, check.Equals, 0.8)
+	c.Check(alerts[1].Samples, check.Equals, int64(10))
+
+	// the lasting spike doesn't fire again
+	observe(10, 8)
+	c.Check(manager.check(), check.HasLen, 0)
+
+	observe(10, 1)
+	alerts = manager.check()
+	c.Assert(alerts, check.HasLen, 2)
+	c.Check(alerts[0].State, check.Equals, mgr.AnomalyStateResolved)
+
+	for i := 0; i < 10; i++ {
+		manager.ObservePiece(ctx, "bar", nil, i%2 == 0)
+	}
+	alerts = manager.check()
+	c.Assert(alerts, check.HasLen, 1)
+	c.Check(alerts[0].Kind, check.Equals, mgr.AnomalyKindPieceFailure)
+	c.Check(alerts[0].Group, check.Equals, "task:bar")
+
+	latest := manager.ListAlerts(ctx, 2)
+	c.Assert(latest, check.HasLen, 2)
+	c.Check(latest[0].Group, check.Equals, "task:bar")
+	c.Check(manager.ListAlerts(ctx, 0), check.HasLen, 5)
+}
+
+func (s *AnomalyManagerTestSuite) TestNotify(c *check.C) {
+	received := make(chan *mgr.AnomalyAlert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		alert := &mgr.AnomalyAlert{}
+		json.Unmarshal(body, alert)
+		received <- alert
+	}))
+	defer server.Close()
+
+	cfg := config.NewConfig()
+	cfg.AnomalyWebhook = server.URL
+	manager, _ := NewManager(cfg)
+	manager.notify([]*mgr.AnomalyAlert{{
+		Kind:  mgr.AnomalyKindBackSource,
+		State: mgr.AnomalyStateFiring,
+		Group: "task:foo",
+		Rate:  0.5,
+	}})
+
+	alert := <-received
+	c.Check(alert.Group, check.Equals, "task:foo")
+	c.Check(alert.Rate, check.Equals, 0.5)
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// AnomalyKindBackSource is the kind of the alerts on the rate of the downloads
+	// which back to the source.
+	AnomalyKindBackSource = "back-source"
+
+	// AnomalyKindPieceFailure is the kind of the alerts on the rate of the pieces
+	// which fail to be downloaded from the peers.
+	AnomalyKindPieceFailure = "piece-failure"
+
+	// AnomalyStateFiring means that the rate of the group is abnormal.
+	AnomalyStateFiring = "firing"
+
+	// AnomalyStateResolved means that the rate of the group has recovered
+	// since the last firing alert.
+	AnomalyStateResolved = "resolved"
+)
+
+// AnomalyAlert is emitted when the rate of a group starts or stops being abnormal.
+type AnomalyAlert struct {
+	Time time.Time `json:"time"`
+
+	// Kind is one of AnomalyKindBackSource and AnomalyKindPieceFailure.
+	Kind string `json:"kind"`
+
+	// State is one of AnomalyStateFiring and AnomalyStateResolved.
+	State string `json:"state"`
+
+	// Group is "task:<taskID>" for a task, or "label:<key>=<value>" for the peers
+	// with the label.
+	Group string `json:"group"`
+
+	// Rate is the rate of the failed ones in the last window.
+	Rate float64 `json:"rate"`
+
+	// Baseline is the moving average of the rate in the previous windows.
+	Baseline float64 `json:"baseline"`
+
+	// Samples is the number of the downloads or pieces observed in the last window.
+	Samples int64 `json:"samples"`
+}
+
+// AnomalyMgr as an interface defines all operations to detect the abnormal spikes
+// in the back-source rate and the piece failure rate per task and per peer label.
+type AnomalyMgr interface {
+	// ObserveDownload observes a download reported by dfget of the peer with the labels.
+	ObserveDownload(ctx context.Context, taskID string, labels map[string]string, backSourced bool)
+
+	// ObservePiece observes the result of a piece downloaded by the peer with the labels.
+	ObservePiece(ctx context.Context, taskID string, labels map[string]string, success bool)
+
+	// StartMonitor starts the job which checks the observed rates every window
+	// and emits the alerts to the webhook.
+	StartMonitor(ctx context.Context)
+
+	// ListAlerts returns at most limit latest alerts, the latest first.
+	// All are returned if limit is not positive.
+	ListAlerts(ctx context.Context, limit int) []*AnomalyAlert
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// bundleVersion is the version of the bundle format.
+const bundleVersion = 1
+
+// The entries of a bundle in order.
+const (
+	bundleManifestName  = "manifest.json"
+	bundleSignatureName = "signature"
+	bundleDataName      = "data"
+)
+
+// bundleManifest describes the task in a bundle.
+type bundleManifest struct {
+	Version      int             `json:"version"`
+	Task         *types.TaskInfo `json:"task"`
+	LastModified int64           `json:"lastModified"`
+	ETag         string          `json:"eTag"`
+	PieceMD5s    []string        `json:"pieceMD5s"`
+
+	// DataLength and DataSHA256 are the length and the SHA-256 digest of
+	// the cached file which is made up of the wrapped pieces.
+	DataLength int64  `json:"dataLength"`
+	DataSHA256 string `json:"dataSHA256"`
+}
+
+// ExportBundle writes the cached file of the task together with its manifest
+// and the signature of the manifest to w as a gzipped tar archive.
+func (cm *Manager) ExportBundle(ctx context.Context, task *types.TaskInfo, w io.Writer) error {
+	cm.cdnLocker.GetLock(task.ID, true)
+	defer cm.cdnLocker.ReleaseLock(task.ID, true)
+
+	metaData, err := cm.metaDataManager.readFileMetaData(ctx, task.ID)
+	if err != nil {
+		return err
+	}
+	if !metaData.Finish || !metaData.Success {
+		return errors.Wrapf(errortypes.ErrCDNWait, "taskID %s", task.ID)
+	}
+	pieceMD5s, err := cm.metaDataManager.readPieceMD5s(ctx, task.ID, metaData.RealMd5)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read piece md5s")
+	}
+	if len(pieceMD5s) == 0 {
+		return errors.Wrapf(errortypes.ErrDataNotFound, "piece md5s of taskID %s", task.ID)
+	}
+
+	// the digest is computed in advance because the manifest is written before the data
+	reader, err := cm.cacheStore.Get(ctx, getDownloadRawFunc(task.ID))
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	dataLength, err := io.Copy(hash, reader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the cached file")
+	}
+
+	manifest := &bundleManifest{
+		Version: bundleVersion,
+		// the headers are left out since they may contain credentials
+		Task: &types.TaskInfo{
+			ID:             task.ID,
+			FileLength:     metaData.FileLength,
+			HTTPFileLength: task.HTTPFileLength,
+			Identifier:     task.Identifier,
+			Md5:            task.Md5,
+			PieceSize:      task.PieceSize,
+			PieceTotal:     task.PieceTotal,
+			RawURL:         task.RawURL,
+			RealMd5:        metaData.RealMd5,
+			TaskURL:        task.TaskURL,
+		},
+		LastModified: metaData.LastModified,
+		ETag:         metaData.ETag,
+		PieceMD5s:    pieceMD5s,
+		DataLength:   dataLength,
+		DataSHA256:   hex.EncodeToString(hash.Sum(nil)),
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal bundle manifest")
+	}
+	signature := signBundle(cm.cfg.BundleSecret, manifestData)
+
+	if reader, err = cm.cacheStore.Get(ctx, getDownloadRawFunc(task.ID)); err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	if err := writeBundleEntry(tw, bundleManifestName, bytes.NewReader(manifestData), int64(len(manifestData))); err != nil {
+		return err
+	}
+	if err := writeBundleEntry(tw, bundleSignatureName, bytes.NewReader(signature), int64(len(signature))); err != nil {
+		return err
+	}
+	if err := writeBundleEntry(tw, bundleDataName, reader, dataLength); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// ImportBundle verifies the bundle read from r and stores the cached file and
+// the metadata of it, and then returns the task described by the bundle.
+//
+// The imported cached file is never treated as expired, since the source
+// is usually unreachable in the environments where the bundles are used.
+func (cm *Manager) ImportBundle(ctx context.Context, r io.Reader) (*types.TaskInfo, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bundle: %v", err)
+	}
+	tr := tar.NewReader(gr)
+
+	manifestData, err := readBundleEntry(tr, bundleManifestName)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := readBundleEntry(tr, bundleSignatureName)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(signature, signBundle(cm.cfg.BundleSecret, manifestData)) {
+		return nil, errors.Wrapf(errortypes.ErrPermissionDenied, "invalid bundle signature")
+	}
+
+	manifest := &bundleManifest{}
+	if err := json.Unmarshal(manifestData, manifest); err != nil {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bundle manifest: %v", err)
+	}
+	if err := validateBundleManifest(manifest); err != nil {
+		return nil, err
+	}
+	task := manifest.Task
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != bundleDataName {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bundle: missing %s", bundleDataName)
+	}
+
+	cm.cdnLocker.GetLock(task.ID, false)
+	defer cm.cdnLocker.ReleaseLock(task.ID, false)
+
+	if err := cm.removeTaskCache(ctx, task.ID); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	raw := getDownloadRawFunc(task.ID)
+	raw.Length = manifest.DataLength
+	if err := cm.cacheStore.Put(ctx, raw, io.TeeReader(tr, hash)); err != nil {
+		cm.removeTaskCache(ctx, task.ID)
+		return nil, errors.Wrapf(err, "failed to write the cached file")
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != manifest.DataSHA256 {
+		cm.removeTaskCache(ctx, task.ID)
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bundle: mismatched digest of %s", bundleDataName)
+	}
+
+	if err := cm.metaDataManager.writeFileMetaData(ctx, &fileMetaData{
+		TaskID:       task.ID,
+		URL:          task.TaskURL,
+		PieceSize:    task.PieceSize,
+		HTTPFileLen:  task.HTTPFileLength,
+		Identifier:   task.Identifier,
+		AccessTime:   getCurrentTimeMillisFunc(),
+		FileLength:   task.FileLength,
+		Md5:          task.Md5,
+		RealMd5:      task.RealMd5,
+		LastModified: manifest.LastModified,
+		ETag:         manifest.ETag,
+		Finish:       true,
+		Success:      true,
+		Imported:     true,
+	}); err != nil {
+		cm.removeTaskCache(ctx, task.ID)
+		return nil, errors.Wrapf(err, "failed to write metadata")
+	}
+	if err := cm.metaDataManager.writePieceMD5s(ctx, task.ID, task.RealMd5, manifest.PieceMD5s); err != nil {
+		cm.removeTaskCache(ctx, task.ID)
+		return nil, errors.Wrapf(err, "failed to write piece md5s")
+	}
+
+	logrus.Infof("success to import bundle of taskID %s with %d pieces", task.ID, len(manifest.PieceMD5s))
+	task.CdnStatus = types.TaskInfoCdnStatusWAITING
+	return task, nil
+}
+
+// removeTaskCache removes all the cached data of the task
+// before the cached file is replaced.
+func (cm *Manager) removeTaskCache(ctx context.Context, taskID string) error {
+	if err := cm.pieceMD5Manager.removePieceMD5sByTaskID(taskID); err != nil &&
+		!errortypes.IsDataNotFound(err) {
+		return err
+	}
+	if err := cm.metaDataManager.removePieceMD5Manifest(taskID); err != nil {
+		return err
+	}
+	return deleteTaskFiles(ctx, cm.cacheStore, taskID)
+}
+
+func validateBundleManifest(manifest *bundleManifest) error {
+	if manifest.Version != bundleVersion {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "bundle version: %d", manifest.Version)
+	}
+
+	task := manifest.Task
+	if task == nil || stringutils.IsEmptyStr(task.ID) || stringutils.IsEmptyStr(task.TaskURL) {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "bundle task: %+v", task)
+	}
+	if stringutils.IsEmptyStr(task.RealMd5) || task.PieceSize <= 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "bundle task: %+v", task)
+	}
+	if len(manifest.PieceMD5s) == 0 || manifest.DataLength <= 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "bundle: empty data")
+	}
+	return nil
+}
+
+// signBundle returns the hex-encoded HMAC-SHA256 of the manifest with secret.
+func signBundle(secret string, manifestData []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(manifestData)
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
+}
+
+func writeBundleEntry(tw *tar.Writer, name string, r io.Reader, size int64) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	return nil
+}
+
+// readBundleEntry reads the next entry of the bundle which should be the given name.
+func readBundleEntry(tr *tar.Reader, name string) ([]byte, error) {
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != name {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bundle: missing %s", name)
+	}
+	data, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bundle: failed to read %s: %v", name, err)
+	}
+	return data, nil
+}
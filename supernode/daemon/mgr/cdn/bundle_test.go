@@ -0,0 +1,183 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	check.Suite(&BundleTestSuite{})
+}
+
+type BundleTestSuite struct {
+	workHome string
+}
+
+func (s *BundleTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "supernode-cdn-BundleTestSuite-")
+}
+
+func (s *BundleTestSuite) TearDownTest(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+func (s *BundleTestSuite) newManager(c *check.C, name, secret string) *Manager {
+	cacheStore, err := store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, "baseDir: "+s.workHome+"/"+name)
+	c.Assert(err, check.IsNil)
+	cfg := config.NewConfig()
+	cfg.BundleSecret = secret
+	cm, err := newManager(cfg, cacheStore, nil, nil, nil, httpclient.NewOriginClient(), prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	return cm
+}
+
+func (s *BundleTestSuite) TestExportAndImportBundle(c *check.C) {
+	ctx := context.TODO()
+	task := &types.TaskInfo{
+		ID:             taskID,
+		CdnStatus:      types.TaskInfoCdnStatusSUCCESS,
+		Headers:        map[string]string{"Authorization": "secret"},
+		HTTPFileLength: 3,
+		PieceSize:      config.DefaultPieceSize,
+		PieceTotal:     1,
+		RawURL:         "http://aa.bb.com/a?t=1",
+		TaskURL:        "http://aa.bb.com/a",
+	}
+	data := "header-abc-tailer"
+
+	src := s.newManager(c, "src", "secret")
+	c.Check(src.ExportBundle(ctx, task, ioutil.Discard), check.NotNil)
+
+	c.Assert(src.cacheStore.PutBytes(ctx, getDownloadRawFunc(taskID), []byte(data)), check.IsNil)
+	c.Assert(src.metaDataManager.writeFileMetaData(ctx, &fileMetaData{
+		TaskID:     taskID,
+		URL:        task.TaskURL,
+		PieceSize:  task.PieceSize,
+		FileLength: int64(len(data)),
+		RealMd5:    "realMd5",
+		ETag:       "etag",
+	}), check.IsNil)
+	err := src.ExportBundle(ctx, task, ioutil.Discard)
+	c.Check(errortypes.IsCDNWait(err), check.Equals, true)
+
+	c.Assert(src.metaDataManager.updateStatusAndResult(ctx, taskID, &fileMetaData{
+		Finish:     true,
+		Success:    true,
+		RealMd5:    "realMd5",
+		FileLength: int64(len(data)),
+	}), check.IsNil)
+	c.Assert(src.metaDataManager.writePieceMD5s(ctx, taskID, "realMd5", []string{"pieceMd5"}), check.IsNil)
+	buf := &bytes.Buffer{}
+	c.Assert(src.ExportBundle(ctx, task, buf), check.IsNil)
+	bundle := buf.Bytes()
+
+	// the bundle signed with another secret is rejected
+	_, err = s.newManager(c, "other", "other").ImportBundle(ctx, bytes.NewReader(bundle))
+	c.Check(errortypes.IsPermissionDenied(err), check.Equals, true)
+
+	dst := s.newManager(c, "dst", "secret")
+	_, err = dst.ImportBundle(ctx, strings.NewReader("invalid"))
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+
+	imported, err := dst.ImportBundle(ctx, bytes.NewReader(bundle))
+	c.Assert(err, check.IsNil)
+	c.Check(imported.ID, check.Equals, taskID)
+	c.Check(imported.CdnStatus, check.Equals, types.TaskInfoCdnStatusWAITING)
+	c.Check(imported.RealMd5, check.Equals, "realMd5")
+	c.Check(imported.Headers, check.IsNil)
+
+	content, err := dst.cacheStore.GetBytes(ctx, getDownloadRawFunc(taskID))
+	c.Assert(err, check.IsNil)
+	c.Check(string(content), check.Equals, data)
+	metaData, err := dst.metaDataManager.readFileMetaData(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.Imported, check.Equals, true)
+	c.Check(metaData.ETag, check.Equals, "etag")
+	pieceMD5s, err := dst.metaDataManager.readPieceMD5s(ctx, taskID, "realMd5")
+	c.Assert(err, check.IsNil)
+	c.Check(pieceMD5s, check.DeepEquals, []string{"pieceMd5"})
+
+	// the imported file is a full cache hit without checking the source
+	c.Check(dst.detector.parseBreakNum(ctx, imported, metaData), check.Equals, -1)
+}
+
+func (s *BundleTestSuite) TestImportTamperedBundle(c *check.C) {
+	ctx := context.TODO()
+	task := &types.TaskInfo{ID: taskID, PieceSize: config.DefaultPieceSize, TaskURL: "http://aa.bb.com/a"}
+
+	src := s.newManager(c, "src", "")
+	c.Assert(src.cacheStore.PutBytes(ctx, getDownloadRawFunc(taskID), []byte("abc")), check.IsNil)
+	c.Assert(src.metaDataManager.writeFileMetaData(ctx, &fileMetaData{
+		TaskID:  taskID,
+		Finish:  true,
+		Success: true,
+		RealMd5: "realMd5",
+	}), check.IsNil)
+	c.Assert(src.metaDataManager.writePieceMD5s(ctx, taskID, "realMd5", []string{"pieceMd5"}), check.IsNil)
+	buf := &bytes.Buffer{}
+	c.Assert(src.ExportBundle(ctx, task, buf), check.IsNil)
+
+	// replace the data of the bundle but keep the signed manifest
+	gr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, check.IsNil)
+	tr := tar.NewReader(gr)
+	tampered := &bytes.Buffer{}
+	gw := gzip.NewWriter(tampered)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		var r io.Reader = tr
+		if hdr.Name == bundleDataName {
+			r = strings.NewReader("xyz")
+		}
+		c.Assert(writeBundleEntry(tw, hdr.Name, r, hdr.Size), check.IsNil)
+	}
+	c.Assert(tw.Close(), check.IsNil)
+	c.Assert(gw.Close(), check.IsNil)
+
+	dst := s.newManager(c, "dst", "")
+	_, err = dst.ImportBundle(ctx, bytes.NewReader(tampered.Bytes()))
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+	c.Check(dst.CheckFile(ctx, taskID), check.Equals, false)
+
+	_, err = dst.ImportBundle(ctx, bytes.NewReader(buf.Bytes()))
+	c.Check(err, check.IsNil)
+	c.Check(dst.CheckFile(ctx, taskID), check.Equals, true)
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
@@ -71,7 +72,20 @@ func (cd *cacheDetector) detectCache(ctx context.Context, task *types.TaskInfo)
 }
 
 func (cd *cacheDetector) parseBreakNum(ctx context.Context, task *types.TaskInfo, metaData *fileMetaData) int {
-	expired, err := cd.originClient.IsExpired(task.RawURL, task.Headers, metaData.LastModified, metaData.ETag)
+	// the file imported from a bundle is trusted without checking the source
+	if metaData.Imported && metaData.Finish && metaData.Success {
+		return -1
+	}
+
+	if metaData.NoStore {
+		return 0
+	}
+	// the fresh file is reused without being validated by the source
+	if metaData.Finish && metaData.Success && metaData.ExpireTime > getCurrentTimeMillisFunc() {
+		return -1
+	}
+
+	expired, err := cd.originClient.IsExpired(task.RawURL, httputils.WithTaskHeader(task.Headers, task.ID), metaData.LastModified, metaData.ETag)
 	if err != nil {
 		logrus.Errorf("failed to check whether the task(%s) has expired: %v", task.ID, err)
 	}
@@ -88,7 +102,7 @@ func (cd *cacheDetector) parseBreakNum(ctx context.Context, task *types.TaskInfo
 		return 0
 	}
 
-	supportRange, err := cd.originClient.IsSupportRange(task.TaskURL, task.Headers)
+	supportRange, err := cd.originClient.IsSupportRange(task.RawURL, httputils.WithTaskHeader(task.Headers, task.ID))
 	if err != nil {
 		logrus.Errorf("failed to check whether the task(%s) supports partial requests: %v", task.ID, err)
 	}
@@ -99,23 +113,43 @@ func (cd *cacheDetector) parseBreakNum(ctx context.Context, task *types.TaskInfo
 	return cd.parseBreakNumByCheckFile(ctx, task.ID)
 }
 
+// parseBreakNumByCheckFile returns the number of the leading pieces in the cache file
+// which could be reused when resuming the fetch from the source.
+//
+// The md5 of every piece read from the file is validated against the one recorded in
+// the progress file when the piece was fetched, so that the pieces partially written
+// before supernode restarts are fetched again. The file cached by the previous versions
+// without the progress file is only checked by its structure.
 func (cd *cacheDetector) parseBreakNumByCheckFile(ctx context.Context, taskID string) int {
 	cacheReader := newSuperReader()
 
+	recorded, err := cd.metaDataManager.readPieceProgress(ctx, taskID)
+	if err != nil && !store.IsKeyNotFound(err) {
+		logrus.Errorf("taskID: %s, failed to read progress file: %v", taskID, err)
+		return 0
+	}
+	validate := err == nil
+
 	reader, err := cd.cacheStore.Get(ctx, getDownloadRawFunc(taskID))
 	if err != nil {
 		logrus.Errorf("taskID: %s, failed to read key file: %v", taskID, err)
 		return 0
 	}
-	result, err := cacheReader.readFile(ctx, reader, false, false)
+	result, err := cacheReader.readFile(ctx, reader, validate, false)
 	if err != nil {
 		logrus.Errorf("taskID: %s, read file gets error: %v", taskID, err)
 	}
-	if result != nil {
+	if result == nil {
+		return 0
+	}
+	if !validate {
 		return result.pieceCount
 	}
 
-	return 0
+	breakNum := countValidPieces(recorded, result.pieceMd5s)
+	logrus.Infof("taskID: %s, %d of %d pieces in the cache file are validated by the progress",
+		taskID, breakNum, result.pieceCount)
+	return breakNum
 }
 
 func (cd *cacheDetector) resetRepo(ctx context.Context, task *types.TaskInfo) (*fileMetaData, error) {
@@ -123,6 +157,9 @@ func (cd *cacheDetector) resetRepo(ctx context.Context, task *types.TaskInfo) (*
 	if err := deleteTaskFiles(ctx, cd.cacheStore, task.ID); err != nil {
 		logrus.Errorf("reset repo: failed to delete task(%s) files: %v", task.ID, err)
 	}
+	if err := cd.metaDataManager.removePieceMD5Manifest(task.ID); err != nil {
+		logrus.Errorf("reset repo: failed to remove the piece md5 manifest of task(%s): %v", task.ID, err)
+	}
 
 	return cd.metaDataManager.writeFileMetaDataByTask(ctx, task)
 }
@@ -0,0 +1,78 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+// cachePolicy decides how long the cached file of a task keeps fresh according to
+// the caching directives of the origin response and the rules configured.
+type cachePolicy struct {
+	defaultTTL time.Duration
+	rules      []*cacheTTLRule
+}
+
+type cacheTTLRule struct {
+	pattern *regexp.Regexp
+	ttl     time.Duration
+}
+
+func newCachePolicy(cfg *config.Config) (*cachePolicy, error) {
+	policy := &cachePolicy{
+		defaultTTL: cfg.CacheTTL,
+	}
+	for _, r := range cfg.CacheTTLRules {
+		pattern, err := regexp.Compile(r.URLPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid url pattern of cache ttl rule: %s", r.URLPattern)
+		}
+		policy.rules = append(policy.rules, &cacheTTLRule{
+			pattern: pattern,
+			ttl:     r.TTL,
+		})
+	}
+	return policy, nil
+}
+
+// freshness returns the freshness lifetime of the response of the url,
+// and noStore reports whether the response should not be reused at all.
+func (p *cachePolicy) freshness(url string, header http.Header) (ttl time.Duration, noStore bool) {
+	for _, r := range p.rules {
+		if r.pattern.MatchString(url) {
+			return r.ttl, false
+		}
+	}
+
+	cc := httputils.ParseCacheControl(header)
+	switch {
+	case cc.NoStore:
+		return 0, true
+	case cc.NoCache:
+		return 0, false
+	case cc.HasMaxAge:
+		return cc.MaxAge, false
+	}
+	return p.defaultTTL, false
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+type CachePolicyTestSuite struct{}
+
+func init() {
+	check.Suite(&CachePolicyTestSuite{})
+}
+
+func (s *CachePolicyTestSuite) TestFreshness(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.CacheTTL = time.Minute
+	cfg.CacheTTLRules = []*config.CacheTTLRule{
+		{URLPattern: "/blobs/sha256:", TTL: time.Hour},
+		{URLPattern: "/manifests/", TTL: 0},
+	}
+	policy, err := newCachePolicy(cfg)
+	c.Assert(err, check.IsNil)
+
+	var cases = []struct {
+		url     string
+		header  http.Header
+		ttl     time.Duration
+		noStore bool
+	}{
+		{url: "http://a.com/file", header: http.Header{}, ttl: time.Minute},
+		{url: "http://a.com/file", header: http.Header{"Cache-Control": {"max-age=10"}}, ttl: 10 * time.Second},
+		{url: "http://a.com/file", header: http.Header{"Cache-Control": {"no-cache, max-age=10"}}, ttl: 0},
+		{url: "http://a.com/file", header: http.Header{"Cache-Control": {"no-store"}}, ttl: 0, noStore: true},
+		{url: "http://a.com/v2/blobs/sha256:xx", header: http.Header{"Cache-Control": {"no-store"}}, ttl: time.Hour},
+		{url: "http://a.com/v2/manifests/latest", header: http.Header{"Cache-Control": {"max-age=10"}}, ttl: 0},
+	}
+	for _, v := range cases {
+		ttl, noStore := policy.freshness(v.url, v.header)
+		c.Check(ttl, check.Equals, v.ttl, check.Commentf("url: %s header: %v", v.url, v.header))
+		c.Check(noStore, check.Equals, v.noStore, check.Commentf("url: %s header: %v", v.url, v.header))
+	}
+
+	cfg.CacheTTLRules = []*config.CacheTTLRule{{URLPattern: "("}}
+	_, err = newCachePolicy(cfg)
+	c.Check(err, check.NotNil)
+}
+
+func (s *CachePolicyTestSuite) TestParseBreakNumByFreshness(c *check.C) {
+	// the origin is never requested for the fresh file or the one forbidden to be reused
+	detector := newCacheDetector(nil, nil, nil)
+	task := &types.TaskInfo{ID: "freshness"}
+	now := getCurrentTimeMillisFunc()
+
+	fresh := &fileMetaData{Finish: true, Success: true, ExpireTime: now + 1000}
+	c.Check(detector.parseBreakNum(context.TODO(), task, fresh), check.Equals, -1)
+
+	noStore := &fileMetaData{Finish: true, Success: true, NoStore: true}
+	c.Check(detector.parseBreakNum(context.TODO(), task, noStore), check.Equals, 0)
+}
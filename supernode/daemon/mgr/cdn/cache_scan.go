@@ -0,0 +1,267 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+	"github.com/dragonflyoss/Dragonfly/supernode/util"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/sirupsen/logrus"
+)
+
+// cacheScanner scans the files cached by the CDN in the background after supernode starts,
+// and removes the inconsistent ones left by the crashes or the manual operations, so that
+// the disk isn't taken by the files which can never be reused.
+//
+// The directories of the files are scanned by a pool of workers in parallel. Only the cheap
+// checks of the metadata and the sizes are done by the scan, and the pieces are validated
+// when the task is downloaded, so supernode serves the downloads during the scan. The tasks
+// triggered before the scan reaches them are skipped since they have been validated then.
+type cacheScanner struct {
+	cacheStore      *store.Store
+	metaDataManager *fileMetaDataManager
+	cdnLocker       *util.LockerPool
+	workers         int
+
+	// triggered records the tasks triggered since supernode starts until the scan finishes.
+	triggered sync.Map
+	finished  int32
+
+	directories        int64
+	scannedDirectories int64
+	scannedTasks       int64
+	repairedTasks      int64
+	startTime          atomic.Value
+	finishTime         atomic.Value
+}
+
+func newCacheScanner(cacheStore *store.Store, metaDataManager *fileMetaDataManager, cdnLocker *util.LockerPool, workers int) *cacheScanner {
+	cs := &cacheScanner{
+		cacheStore:      cacheStore,
+		metaDataManager: metaDataManager,
+		cdnLocker:       cdnLocker,
+		workers:         workers,
+	}
+	if workers <= 0 {
+		cs.finished = 1
+	}
+	return cs
+}
+
+// start scans the cached files in the background.
+// It does nothing if the scan is disabled.
+func (cs *cacheScanner) start(ctx context.Context) {
+	if atomic.LoadInt32(&cs.finished) == 1 {
+		return
+	}
+	go cs.scan(ctx)
+}
+
+// trigger records that the task is triggered, which is validated by the cache detector
+// and needn't be scanned any more.
+func (cs *cacheScanner) trigger(taskID string) {
+	if atomic.LoadInt32(&cs.finished) == 1 {
+		return
+	}
+	cs.triggered.Store(taskID, true)
+}
+
+func (cs *cacheScanner) status() *types.CacheScanStatus {
+	status := &types.CacheScanStatus{
+		Finished:           atomic.LoadInt32(&cs.finished) == 1,
+		Directories:        atomic.LoadInt64(&cs.directories),
+		ScannedDirectories: atomic.LoadInt64(&cs.scannedDirectories),
+		ScannedTasks:       atomic.LoadInt64(&cs.scannedTasks),
+		RepairedTasks:      atomic.LoadInt64(&cs.repairedTasks),
+	}
+	if t, ok := cs.startTime.Load().(time.Time); ok {
+		status.StartTime = strfmt.DateTime(t)
+	}
+	if t, ok := cs.finishTime.Load().(time.Time); ok {
+		status.FinishTime = strfmt.DateTime(t)
+	}
+	return status
+}
+
+func (cs *cacheScanner) scan(ctx context.Context) {
+	start := time.Now()
+	cs.startTime.Store(start)
+	defer func() {
+		cs.finishTime.Store(time.Now())
+		atomic.StoreInt32(&cs.finished, 1)
+		cs.triggered.Range(func(key, value interface{}) bool {
+			cs.triggered.Delete(key)
+			return true
+		})
+	}()
+
+	dirs, err := cs.listDirectories(ctx)
+	if err != nil {
+		logrus.Errorf("failed to list the directories of the cached files: %v", err)
+		return
+	}
+	atomic.StoreInt64(&cs.directories, int64(len(dirs)))
+	logrus.Infof("start to scan %d directories of the cached files with %d workers", len(dirs), cs.workers)
+
+	dirCh := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < cs.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range dirCh {
+				cs.scanDirectory(ctx, dir)
+				atomic.AddInt64(&cs.scannedDirectories, 1)
+			}
+		}()
+	}
+	for _, dir := range dirs {
+		dirCh <- dir
+	}
+	close(dirCh)
+	wg.Wait()
+
+	logrus.Infof("success to scan %d tasks of the cached files in %v, %d of them are repaired",
+		atomic.LoadInt64(&cs.scannedTasks), time.Since(start), atomic.LoadInt64(&cs.repairedTasks))
+}
+
+// listDirectories lists the parent directories of the cached files without walking into them.
+func (cs *cacheScanner) listDirectories(ctx context.Context) ([]string, error) {
+	var dirs []string
+	home := ""
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if home == "" {
+			home = path
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, info.Name())
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	err := cs.cacheStore.Walk(ctx, &store.Raw{Bucket: config.DownloadHome, WalkFn: walkFn})
+	if err != nil && !store.IsKeyNotFound(err) {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+func (cs *cacheScanner) scanDirectory(ctx context.Context, dir string) {
+	var taskIDs []string
+	seen := make(map[string]bool)
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		taskID := strings.Split(info.Name(), ".")[0]
+		if !seen[taskID] {
+			seen[taskID] = true
+			taskIDs = append(taskIDs, taskID)
+		}
+		return nil
+	}
+	// the files are walked before being checked, since the files may be removed
+	// by the checks, which would break the walk.
+	if err := cs.cacheStore.Walk(ctx, &store.Raw{Bucket: config.DownloadHome, Key: dir, WalkFn: walkFn}); err != nil {
+		logrus.Errorf("failed to walk the directory(%s) of the cached files: %v", dir, err)
+	}
+
+	for _, taskID := range taskIDs {
+		if _, ok := cs.triggered.Load(taskID); ok {
+			continue
+		}
+		atomic.AddInt64(&cs.scannedTasks, 1)
+		if cs.checkTask(ctx, taskID) {
+			atomic.AddInt64(&cs.repairedTasks, 1)
+		}
+	}
+}
+
+// checkTask checks the cached files of the task and removes them if they're inconsistent.
+// It returns true if the files are removed.
+func (cs *cacheScanner) checkTask(ctx context.Context, taskID string) bool {
+	cs.cdnLocker.GetLock(taskID, false)
+	defer cs.cdnLocker.ReleaseLock(taskID, false)
+	// the task is triggered while waiting for the lock
+	if _, ok := cs.triggered.Load(taskID); ok {
+		return false
+	}
+
+	reason := cs.inconsistency(ctx, taskID)
+	if reason == "" {
+		return false
+	}
+	logrus.Warnf("taskID: %s, remove the cached files since %s", taskID, reason)
+	if err := cs.metaDataManager.removePieceMD5Manifest(taskID); err != nil {
+		logrus.Errorf("taskID: %s, failed to remove the piece md5 manifest: %v", taskID, err)
+	}
+	if err := deleteTaskFiles(ctx, cs.cacheStore, taskID); err != nil {
+		logrus.Errorf("taskID: %s, failed to remove the cached files: %v", taskID, err)
+		return false
+	}
+	return true
+}
+
+// inconsistency returns why the cached files of the task can't be reused,
+// and empty if they're consistent as far as the scan can tell.
+func (cs *cacheScanner) inconsistency(ctx context.Context, taskID string) string {
+	metaData, err := cs.metaDataManager.readFileMetaData(ctx, taskID)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return "the metadata is missing"
+		}
+		return "the metadata is unreadable: " + err.Error()
+	}
+	if metaData.TaskID != taskID {
+		return "the metadata belongs to taskID " + metaData.TaskID
+	}
+	if !metaData.Finish || !metaData.Success {
+		// the pieces of the unfinished file are validated by the progress
+		// when the fetch is resumed.
+		return ""
+	}
+
+	info, err := cs.cacheStore.Stat(ctx, getDownloadRawFunc(taskID))
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return "the file of the finished task is missing"
+		}
+		return "the file of the finished task is inaccessible: " + err.Error()
+	}
+	if metaData.FileLength > 0 && info.Size != metaData.FileLength {
+		return "the size of the file of the finished task doesn't match the metadata"
+	}
+	return ""
+}
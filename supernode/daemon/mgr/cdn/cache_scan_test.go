@@ -0,0 +1,116 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+	"github.com/dragonflyoss/Dragonfly/supernode/util"
+
+	"github.com/go-check/check"
+)
+
+type CacheScanTestSuite struct {
+	workHome   string
+	cacheStore *store.Store
+	metaData   *fileMetaDataManager
+}
+
+func init() {
+	check.Suite(&CacheScanTestSuite{})
+}
+
+func (s *CacheScanTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "supernode-cdn-CacheScanTestSuite-")
+	cacheStore, err := store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, "baseDir: "+s.workHome)
+	c.Assert(err, check.IsNil)
+	s.cacheStore = cacheStore
+	s.metaData = newFileMetaDataManager(cacheStore, nil)
+}
+
+func (s *CacheScanTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+func (s *CacheScanTestSuite) putTask(c *check.C, taskID, data string, metaData *fileMetaData) {
+	ctx := context.Background()
+	c.Assert(s.cacheStore.PutBytes(ctx, getDownloadRaw(taskID), []byte(data)), check.IsNil)
+	if metaData != nil {
+		metaData.TaskID = taskID
+		c.Assert(s.metaData.writeFileMetaData(ctx, metaData), check.IsNil)
+	}
+}
+
+func (s *CacheScanTestSuite) exists(taskID string) bool {
+	_, err := s.cacheStore.Stat(context.Background(), getDownloadRaw(taskID))
+	return err == nil
+}
+
+func (s *CacheScanTestSuite) TestScan(c *check.C) {
+	s.putTask(c, "aaa1", "12345", &fileMetaData{Finish: true, Success: true, FileLength: 5})
+	s.putTask(c, "aaa2", "123", &fileMetaData{Finish: true, Success: true, FileLength: 5})
+	s.putTask(c, "bbb1", "12", &fileMetaData{})
+	s.putTask(c, "bbb2", "12345", nil)
+	s.putTask(c, "ccc1", "12345", nil)
+	// the metadata of a finished task whose file is missing
+	c.Assert(s.metaData.writeFileMetaData(context.Background(),
+		&fileMetaData{TaskID: "ddd1", Finish: true, Success: true, FileLength: 5}), check.IsNil)
+
+	cs := newCacheScanner(s.cacheStore, s.metaData, util.NewLockerPool(), 2)
+	// the triggered task is validated by the cache detector rather than the scan
+	cs.trigger("ccc1")
+	c.Check(cs.status().Finished, check.Equals, false)
+	cs.start(context.Background())
+	for !cs.status().Finished {
+		runtime.Gosched()
+	}
+
+	status := cs.status()
+	c.Check(status.Directories, check.Equals, int64(4))
+	c.Check(status.ScannedDirectories, check.Equals, int64(4))
+	c.Check(status.ScannedTasks, check.Equals, int64(5))
+	c.Check(status.RepairedTasks, check.Equals, int64(3))
+	c.Check(status.StartTime.String() != "", check.Equals, true)
+
+	c.Check(s.exists("aaa1"), check.Equals, true)
+	c.Check(s.exists("aaa2"), check.Equals, false)
+	c.Check(s.exists("bbb1"), check.Equals, true)
+	c.Check(s.exists("bbb2"), check.Equals, false)
+	c.Check(s.exists("ccc1"), check.Equals, true)
+	_, err := s.metaData.readFileMetaData(context.Background(), "ddd1")
+	c.Check(store.IsKeyNotFound(err), check.Equals, true)
+
+	// the tasks triggered after the scan aren't recorded
+	cs.trigger("eee1")
+	_, ok := cs.triggered.Load("eee1")
+	c.Check(ok, check.Equals, false)
+}
+
+func (s *CacheScanTestSuite) TestScanDisabled(c *check.C) {
+	s.putTask(c, "bbb2", "12345", nil)
+
+	cs := newCacheScanner(s.cacheStore, s.metaData, util.NewLockerPool(), 0)
+	cs.start(context.Background())
+	c.Check(cs.status().Finished, check.Equals, true)
+	c.Check(atomic.LoadInt64(&cs.scannedTasks), check.Equals, int64(0))
+	c.Check(s.exists("bbb2"), check.Equals, true)
+}
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
@@ -35,9 +36,10 @@ import (
 
 // GetGCTaskIDs returns the taskIDs that should exec GC operations as a string slice.
 //
-// It should return nil when the free disk of cdn storage is lager than config.YoungGCThreshold.
+// It should return nil when the free disk of cdn storage is lager than config.YoungGCThreshold,
+// unless preemptive is true, which means the free disk is forecasted to drop below it soon.
 // It should return all taskIDs that are not running when the free disk of cdn storage is less than config.FullGCThreshold.
-func (cm *Manager) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr) ([]string, error) {
+func (cm *Manager) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr, preemptive bool) ([]string, error) {
 	var gcTaskIDs []string
 
 	freeDisk, err := cm.cacheStore.GetAvailSpace(ctx, getHomeRawFunc())
@@ -47,7 +49,7 @@ func (cm *Manager) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr) ([]str
 		}
 		return nil, errors.Wrapf(err, "failed to get avail space")
 	}
-	if freeDisk > cm.cfg.YoungGCThreshold {
+	if freeDisk > cm.cfg.YoungGCThreshold && !preemptive {
 		return nil, nil
 	}
 
@@ -56,6 +58,7 @@ func (cm *Manager) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr) ([]str
 		fullGC = true
 	}
 	logrus.Debugf("start to exec gc with fullGC: %t", fullGC)
+	cm.writer.dedup.gc(ctx, fullGC, cm.cfg.TaskExpireTime)
 
 	gapTasks := treemap.NewWith(godsutils.Int64Comparator)
 	intervalTasks := treemap.NewWith(godsutils.Int64Comparator)
@@ -124,6 +127,11 @@ func (cm *Manager) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr) ([]str
 	return gcTaskIDs, nil
 }
 
+// GetAvailSpace returns the free disk of cdn storage.
+func (cm *Manager) GetAvailSpace(ctx context.Context) (fileutils.Fsize, error) {
+	return cm.cacheStore.GetAvailSpace(ctx, getHomeRawFunc())
+}
+
 func (cm *Manager) sortInert(ctx context.Context, gapTasks, intervalTasks *treemap.Map, metaData *fileMetaData) error {
 	gap := getCurrentTimeMillisFunc() - metaData.AccessTime
 
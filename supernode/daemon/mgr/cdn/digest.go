@@ -0,0 +1,74 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"hash"
+	"sync"
+)
+
+// digestQueueSize is the number of the chunks queued for every hash of a parallelDigest.
+const digestQueueSize = 4
+
+// parallelDigest is an io.Writer which feeds the data written to it to every hash
+// in its own goroutine, so that the digests of a stream are calculated in parallel
+// with each other and with the reading of the stream. At most queueSize chunks are
+// queued for every hash, which bounds the memory used by the slow hashes.
+type parallelDigest struct {
+	queues []chan []byte
+	wg     sync.WaitGroup
+}
+
+func newParallelDigest(queueSize int, hashes ...hash.Hash) *parallelDigest {
+	d := &parallelDigest{}
+	for _, h := range hashes {
+		q := make(chan []byte, queueSize)
+		d.queues = append(d.queues, q)
+		d.wg.Add(1)
+		go func(h hash.Hash, q chan []byte) {
+			defer d.wg.Done()
+			for b := range q {
+				h.Write(b)
+			}
+		}(h, q)
+	}
+	return d
+}
+
+// Write never fails. The p is copied since it's reused by the caller,
+// and the copy is shared by the hashes which never modify it.
+func (d *parallelDigest) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+	for _, q := range d.queues {
+		q <- b
+	}
+	return len(p), nil
+}
+
+// Close waits for all the data written to be hashed,
+// and the hashes mustn't be read before it returns.
+func (d *parallelDigest) Close() error {
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.wg.Wait()
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&DigestTestSuite{})
+}
+
+type DigestTestSuite struct{}
+
+func (s *DigestTestSuite) TestParallelDigest(c *check.C) {
+	data := make([]byte, 1<<20+7)
+	rand.Read(data)
+
+	fileMD5, fileSHA256 := md5.New(), sha256.New()
+	d := newParallelDigest(digestQueueSize, fileMD5, fileSHA256)
+	buf := make([]byte, 4096)
+	n, err := io.CopyBuffer(d, bytes.NewReader(data), buf)
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, int64(len(data)))
+	c.Check(d.Close(), check.IsNil)
+
+	expectedMD5 := md5.Sum(data)
+	expectedSHA256 := sha256.Sum256(data)
+	c.Check(fileMD5.Sum(nil), check.DeepEquals, expectedMD5[:])
+	c.Check(fileSHA256.Sum(nil), check.DeepEquals, expectedSHA256[:])
+}
+
+func (s *DigestTestSuite) TestCalculateRoutineCount(c *check.C) {
+	pieceSize := int32(10) + config.PieceWrapSize
+
+	c.Check(calculateRoutineCount(-1, pieceSize, 0), check.Equals, config.CDNWriterRoutineLimit)
+	c.Check(calculateRoutineCount(-1, pieceSize, 8), check.Equals, 8)
+	c.Check(calculateRoutineCount(0, pieceSize, 8), check.Equals, 1)
+	c.Check(calculateRoutineCount(25, pieceSize, 8), check.Equals, 3)
+	c.Check(calculateRoutineCount(1000, pieceSize, 8), check.Equals, 8)
+	c.Check(calculateRoutineCount(1000, pieceSize, 1), check.Equals, 1)
+}
+
+// BenchmarkFileDigest compares calculating the md5 and sha256 of a file
+// in the reading goroutine with calculating them by a parallelDigest.
+func BenchmarkFileDigest(b *testing.B) {
+	data := make([]byte, 64<<20)
+	rand.Read(data)
+	buf := make([]byte, 256<<10)
+
+	b.Run("serial", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			w := io.MultiWriter(md5.New(), sha256.New())
+			io.CopyBuffer(w, bytes.NewReader(data), buf)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			d := newParallelDigest(digestQueueSize, md5.New(), sha256.New())
+			io.CopyBuffer(d, bytes.NewReader(data), buf)
+			d.Close()
+		}
+	})
+}
+
+// BenchmarkStartWriter measures writing a file into the local storage of CDN
+// and hashing its pieces with the different numbers of hash workers.
+func BenchmarkStartWriter(b *testing.B) {
+	workHome, err := ioutil.TempDir("/tmp", "supernode-cdn-BenchmarkStartWriter-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(workHome)
+	fileStore, err := store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, "baseDir: "+workHome)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	const pieceContSize = 4 << 20
+	data := make([]byte, 64<<20)
+	rand.Read(data)
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			writer := newSuperWriter(fileStore, nil)
+			writer.hashWorkers = workers
+			task := &types.TaskInfo{
+				ID:        fmt.Sprintf("benchmark-start-writer-%d", workers),
+				PieceSize: pieceContSize + config.PieceWrapSize,
+			}
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := writer.startWriter(context.TODO(), nil, bytes.NewReader(data), task,
+					0, int64(len(data)), pieceContSize); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
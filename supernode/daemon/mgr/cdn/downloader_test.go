@@ -47,7 +47,7 @@ func init() {
 }
 
 func (s *CDNDownloadTestSuite) TestDownload(c *check.C) {
-	cm, _ := newManager(config.NewConfig(), nil, nil, httpclient.NewOriginClient(), prometheus.DefaultRegisterer)
+	cm, _ := newManager(config.NewConfig(), nil, nil, nil, nil, httpclient.NewOriginClient(), prometheus.DefaultRegisterer)
 	bytes := []byte("hello world")
 	bytesLength := int64(len(bytes))
 
@@ -118,6 +118,44 @@ func (s *CDNDownloadTestSuite) TestDownload(c *check.C) {
 	}
 }
 
+func (s *CDNDownloadTestSuite) TestSourceSizeLimit(c *check.C) {
+	cfg := config.NewConfig()
+	cm := &Manager{cfg: cfg}
+
+	c.Check(cm.sourceSizeLimit(&http.Response{ContentLength: -1}, -1, 0, 3), check.Equals, int64(-1))
+	c.Check(cm.sourceSizeLimit(&http.Response{ContentLength: 11}, 11, 0, 3), check.Equals, int64(11))
+	// the registered file length is expected without Content-Length
+	c.Check(cm.sourceSizeLimit(&http.Response{ContentLength: -1}, 11, 2, 3), check.Equals, int64(5))
+
+	cfg.SourceSizeMargin = 0.5
+	cfg.MaxSourceSize = 20
+	c.Check(cm.sourceSizeLimit(&http.Response{ContentLength: 10}, 10, 0, 3), check.Equals, int64(15))
+	c.Check(cm.sourceSizeLimit(&http.Response{ContentLength: -1}, -1, 0, 3), check.Equals, int64(20))
+}
+
+func (s *CDNDownloadTestSuite) TestCheckSourceVersion(c *check.C) {
+	newResp := func(statusCode int, contentLength int64, eTag string) *http.Response {
+		resp := &http.Response{StatusCode: statusCode, ContentLength: contentLength, Header: http.Header{}}
+		if eTag != "" {
+			resp.Header.Set("Etag", eTag)
+		}
+		return resp
+	}
+	metaData := &fileMetaData{HTTPFileLen: 11, ETag: "v1"}
+
+	c.Check(checkSourceVersion(nil, newResp(http.StatusOK, 12, "v2"), 0, 3), check.IsNil)
+	c.Check(checkSourceVersion(metaData, newResp(http.StatusOK, 11, "v1"), 0, 3), check.IsNil)
+	c.Check(checkSourceVersion(metaData, newResp(http.StatusOK, -1, ""), 0, 3), check.IsNil)
+	c.Check(checkSourceVersion(metaData, newResp(http.StatusPartialContent, 5, "v1"), 2, 3), check.IsNil)
+
+	err := checkSourceVersion(metaData, newResp(http.StatusPartialContent, 5, "v2"), 2, 3)
+	c.Check(errortypes.IsSourceChanged(err), check.Equals, true)
+	err = checkSourceVersion(metaData, newResp(http.StatusPartialContent, 8, "v1"), 2, 3)
+	c.Check(errortypes.IsSourceChanged(err), check.Equals, true)
+	err = checkSourceVersion(&fileMetaData{HTTPFileLen: 11}, newResp(http.StatusOK, 12, ""), 0, 3)
+	c.Check(errortypes.IsSourceChanged(err), check.Equals, true)
+}
+
 func Test_checkStatusCode(t *testing.T) {
 	type args struct {
 		statusCode       []int
@@ -0,0 +1,79 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+)
+
+// progressRecordSize is the size of a record in the progress file.
+// The record of the piece N is at the offset N*progressRecordSize,
+// so that the pieces written out of order could be recorded without
+// rewriting the whole file.
+const progressRecordSize = 64
+
+// writePieceProgress records the md5 of a piece fetched from the source into
+// the progress file of taskID, which is used to resume the fetch after supernode restarts.
+func (mm *fileMetaDataManager) writePieceProgress(ctx context.Context, taskID string, pieceNum int, pieceMD5 string) error {
+	if len(pieceMD5) >= progressRecordSize {
+		return fmt.Errorf("piece md5 %s is too long to record", pieceMD5)
+	}
+
+	raw := getProgressDataRawFunc(taskID)
+	raw.Offset = int64(pieceNum) * progressRecordSize
+	record := fmt.Sprintf("%-*s\n", progressRecordSize-1, pieceMD5)
+	return mm.fileStore.PutBytes(ctx, raw, []byte(record))
+}
+
+// readPieceProgress returns the md5s of the pieces recorded in the progress file of taskID
+// in order of the piece number. The md5 of a piece which is not recorded is empty.
+func (mm *fileMetaDataManager) readPieceProgress(ctx context.Context, taskID string) ([]string, error) {
+	data, err := mm.fileStore.GetBytes(ctx, getProgressDataRawFunc(taskID))
+	if err != nil {
+		return nil, err
+	}
+
+	pieceMD5s := make([]string, 0, len(data)/progressRecordSize)
+	for i := 0; i+progressRecordSize <= len(data); i += progressRecordSize {
+		// the pieces not recorded yet are holes filled with zero
+		pieceMD5s = append(pieceMD5s, strings.TrimRight(string(data[i:i+progressRecordSize]), " \n\x00"))
+	}
+	return pieceMD5s, nil
+}
+
+// removePieceProgress removes the progress file of taskID.
+func (mm *fileMetaDataManager) removePieceProgress(ctx context.Context, taskID string) error {
+	if err := mm.fileStore.Remove(ctx, getProgressDataRawFunc(taskID)); err != nil && !store.IsKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// countValidPieces returns the number of the leading pieces whose md5s read from
+// the cache file match the ones recorded in the progress, which means that they
+// have been fetched from the source completely.
+func countValidPieces(recorded, actual []string) int {
+	n := 0
+	for n < len(recorded) && n < len(actual) && recorded[n] != "" && recorded[n] == actual[n] {
+		n++
+	}
+	return n
+}
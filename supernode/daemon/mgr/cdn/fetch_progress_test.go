@@ -0,0 +1,122 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+)
+
+type FetchProgressTestSuite struct {
+	workHome string
+	store    *store.Store
+	detector *cacheDetector
+}
+
+func init() {
+	check.Suite(&FetchProgressTestSuite{})
+}
+
+func (s *FetchProgressTestSuite) SetUpSuite(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "supernode-cdn-FetchProgressTestSuite-")
+	fileStore, err := store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, "baseDir: "+s.workHome)
+	c.Assert(err, check.IsNil)
+	s.store = fileStore
+	s.detector = newCacheDetector(fileStore, newFileMetaDataManager(fileStore, nil), nil)
+}
+
+func (s *FetchProgressTestSuite) TearDownSuite(c *check.C) {
+	if s.workHome != "" {
+		if err := os.RemoveAll(s.workHome); err != nil {
+			fmt.Printf("remove path: %s error", s.workHome)
+		}
+	}
+}
+
+func (s *FetchProgressTestSuite) TestReadWritePieceProgress(c *check.C) {
+	ctx := context.TODO()
+	mm := s.detector.metaDataManager
+	id := "progress-read-write"
+
+	_, err := mm.readPieceProgress(ctx, id)
+	c.Check(store.IsKeyNotFound(err), check.Equals, true)
+
+	c.Assert(mm.writePieceProgress(ctx, id, 2, "md5-2:10"), check.IsNil)
+	c.Assert(mm.writePieceProgress(ctx, id, 0, "md5-0:10"), check.IsNil)
+	pieceMD5s, err := mm.readPieceProgress(ctx, id)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceMD5s, check.DeepEquals, []string{"md5-0:10", "", "md5-2:10"})
+
+	c.Check(mm.writePieceProgress(ctx, id, 1, string(make([]byte, progressRecordSize))), check.NotNil)
+
+	c.Assert(mm.removePieceProgress(ctx, id), check.IsNil)
+	c.Check(mm.removePieceProgress(ctx, id), check.IsNil)
+}
+
+func (s *FetchProgressTestSuite) TestCountValidPieces(c *check.C) {
+	c.Check(countValidPieces(nil, []string{"a"}), check.Equals, 0)
+	c.Check(countValidPieces([]string{"a", "b", "c"}, []string{"a", "b"}), check.Equals, 2)
+	c.Check(countValidPieces([]string{"a", "", "c"}, []string{"a", "b", "c"}), check.Equals, 1)
+	c.Check(countValidPieces([]string{"a", "x", "c"}, []string{"a", "b", "c"}), check.Equals, 1)
+}
+
+func (s *FetchProgressTestSuite) TestParseBreakNumByCheckFile(c *check.C) {
+	ctx := context.TODO()
+	mm := s.detector.metaDataManager
+	writer := newSuperWriter(s.store, nil)
+	id := "progress-break-num"
+	// the piece size is encoded into the piece header with the content size,
+	// so it should be large enough not to overlap with the content size.
+	pieceSize := int32(config.DefaultPieceSize)
+	pieceContSize := pieceSize - config.PieceWrapSize
+
+	var pieceMD5s []string
+	for i := 0; i < 3; i++ {
+		pieceMd5 := md5.New()
+		content := bytes.NewBuffer(bytes.Repeat([]byte{byte('a' + i)}, int(pieceContSize)))
+		c.Assert(writer.writeToFile(ctx, content, id, i, pieceContSize, pieceSize, pieceMd5), check.IsNil)
+		pieceMD5s = append(pieceMD5s, getPieceMd5Value(fileutils.GetMd5Sum(pieceMd5, nil), pieceSize))
+	}
+
+	// the file without the progress is only checked by its structure
+	c.Check(s.detector.parseBreakNumByCheckFile(ctx, id), check.Equals, 3)
+
+	c.Assert(mm.writePieceProgress(ctx, id, 0, pieceMD5s[0]), check.IsNil)
+	c.Assert(mm.writePieceProgress(ctx, id, 2, pieceMD5s[2]), check.IsNil)
+	c.Check(s.detector.parseBreakNumByCheckFile(ctx, id), check.Equals, 1)
+
+	c.Assert(mm.writePieceProgress(ctx, id, 1, pieceMD5s[1]), check.IsNil)
+	c.Check(s.detector.parseBreakNumByCheckFile(ctx, id), check.Equals, 3)
+
+	// the piece 1 is overwritten partially before restart
+	c.Assert(s.store.PutBytes(ctx, &store.Raw{
+		Bucket: config.DownloadHome,
+		Key:    getDownloadKey(id),
+		Offset: int64(pieceSize) + 5,
+	}, []byte("x")), check.IsNil)
+	c.Check(s.detector.parseBreakNumByCheckFile(ctx, id), check.Equals, 1)
+}
@@ -23,8 +23,10 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
@@ -44,22 +46,43 @@ type fileMetaData struct {
 	FileLength   int64  `json:"fileLength"`
 	Md5          string `json:"md5"`
 	RealMd5      string `json:"realMd5"`
+	RealSha256   string `json:"realSha256,omitempty"`
 	LastModified int64  `json:"lastModified"`
 	ETag         string `json:"eTag"`
 	Finish       bool   `json:"finish"`
 	Success      bool   `json:"success"`
+
+	// Imported means that the file is imported from a bundle.
+	Imported bool `json:"imported,omitempty"`
+
+	// ExpireTime is the time in milliseconds before which the file keeps fresh
+	// and could be reused without being validated by the source.
+	ExpireTime int64 `json:"expireTime,omitempty"`
+
+	// NoStore means that the origin forbids reusing the file.
+	NoStore bool `json:"noStore,omitempty"`
+}
+
+// pieceMD5Manifest is the record of piece md5s persisted into the meta store.
+type pieceMD5Manifest struct {
+	FileMD5   string   `json:"fileMD5"`
+	PieceMD5s []string `json:"pieceMD5s"`
 }
 
 // fileMetaDataManager manages the meta file and md5 file of each taskID.
 type fileMetaDataManager struct {
 	fileStore *store.Store
 	locker    *util.LockerPool
+
+	// metaStore persists the piece md5 manifests and it's optional.
+	metaStore *metastore.Store
 }
 
-func newFileMetaDataManager(store *store.Store) *fileMetaDataManager {
+func newFileMetaDataManager(store *store.Store, metaStore *metastore.Store) *fileMetaDataManager {
 	return &fileMetaDataManager{
 		fileStore: store,
 		locker:    util.NewLockerPool(),
+		metaStore: metaStore,
 	}
 }
 
@@ -148,6 +171,21 @@ func (mm *fileMetaDataManager) updateLastModifiedAndETag(ctx context.Context, ta
 	return mm.writeFileMetaData(ctx, originMetaData)
 }
 
+func (mm *fileMetaDataManager) updateFreshness(ctx context.Context, taskID string, expireTime int64, noStore bool) error {
+	mm.locker.GetLock(taskID, false)
+	defer mm.locker.ReleaseLock(taskID, false)
+
+	originMetaData, err := mm.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	originMetaData.ExpireTime = expireTime
+	originMetaData.NoStore = noStore
+
+	return mm.writeFileMetaData(ctx, originMetaData)
+}
+
 func (mm *fileMetaDataManager) updateStatusAndResult(ctx context.Context, taskID string, metaData *fileMetaData) error {
 	mm.locker.GetLock(taskID, false)
 	defer mm.locker.ReleaseLock(taskID, false)
@@ -164,6 +202,9 @@ func (mm *fileMetaDataManager) updateStatusAndResult(ctx context.Context, taskID
 		if !stringutils.IsEmptyStr(metaData.RealMd5) {
 			originMetaData.RealMd5 = metaData.RealMd5
 		}
+		if !stringutils.IsEmptyStr(metaData.RealSha256) {
+			originMetaData.RealSha256 = metaData.RealSha256
+		}
 	}
 
 	return mm.writeFileMetaData(ctx, originMetaData)
@@ -183,6 +224,13 @@ func (mm *fileMetaDataManager) writePieceMD5s(ctx context.Context, taskID, fileM
 	}
 
 	// append fileMD5
+	if mm.metaStore != nil {
+		manifest := &pieceMD5Manifest{FileMD5: fileMD5, PieceMD5s: pieceMD5s}
+		if err := mm.metaStore.Put(metastore.BucketPieceMD5, taskID, manifest); err != nil {
+			logrus.Errorf("failed to persist the piece md5 manifest for taskID %s: %v", taskID, err)
+		}
+	}
+
 	pieceMD5s = append(pieceMD5s, fileMD5)
 	// append the SHA-1 checksum of pieceMD5s
 	pieceMD5s = append(pieceMD5s, digest.Sha1(pieceMD5s))
@@ -192,11 +240,16 @@ func (mm *fileMetaDataManager) writePieceMD5s(ctx context.Context, taskID, fileM
 	return mm.fileStore.PutBytes(ctx, getMd5DataRawFunc(taskID), []byte(pieceMD5Str))
 }
 
-// readPieceMD5s reads the md5 file of the taskID and returns the pieceMD5s.
+// readPieceMD5s returns the pieceMD5s of the taskID.
+// It reads the piece md5 manifest in the meta store first and then the md5 file.
 func (mm *fileMetaDataManager) readPieceMD5s(ctx context.Context, taskID, fileMD5 string) (pieceMD5s []string, err error) {
 	mm.locker.GetLock(taskID, true)
 	defer mm.locker.ReleaseLock(taskID, true)
 
+	if pieceMD5s := mm.readPieceMD5Manifest(taskID, fileMD5); len(pieceMD5s) != 0 {
+		return pieceMD5s, nil
+	}
+
 	bytes, err := mm.fileStore.GetBytes(ctx, getMd5DataRawFunc(taskID))
 	if err != nil {
 		return nil, err
@@ -225,3 +278,30 @@ func (mm *fileMetaDataManager) readPieceMD5s(ctx context.Context, taskID, fileMD
 	}
 	return pieceMD5s[:pieceMD5sLength-2], nil
 }
+
+func (mm *fileMetaDataManager) readPieceMD5Manifest(taskID, fileMD5 string) []string {
+	if mm.metaStore == nil {
+		return nil
+	}
+
+	manifest := &pieceMD5Manifest{}
+	if err := mm.metaStore.Get(metastore.BucketPieceMD5, taskID, manifest); err != nil {
+		if !errortypes.IsDataNotFound(err) {
+			logrus.Errorf("failed to get the piece md5 manifest for taskID %s: %v", taskID, err)
+		}
+		return nil
+	}
+	if manifest.FileMD5 != fileMD5 {
+		logrus.Errorf("failed to validate the fileMD5 of manifest, expected: %s, real: %s", fileMD5, manifest.FileMD5)
+		return nil
+	}
+	return manifest.PieceMD5s
+}
+
+// removePieceMD5Manifest removes the piece md5 manifest of taskID from the meta store.
+func (mm *fileMetaDataManager) removePieceMD5Manifest(taskID string) error {
+	if mm.metaStore == nil {
+		return nil
+	}
+	return mm.metaStore.Delete(metastore.BucketPieceMD5, taskID)
+}
@@ -50,7 +50,7 @@ func (s *CDNFileMetaDataTestSuite) SetUpSuite(c *check.C) {
 	s.content = "baseDir: " + s.workHome
 	fileStore, err := store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, s.content)
 	c.Check(err, check.IsNil)
-	s.metaDataManager = newFileMetaDataManager(fileStore)
+	s.metaDataManager = newFileMetaDataManager(fileStore, nil)
 
 	s.metaDataPathStub = gostub.Stub(&getMetaDataRawFunc, func(taskID string) *store.Raw {
 		return &store.Raw{
@@ -19,19 +19,28 @@ package cdn
 import (
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"net/http"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
 	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rangeutils"
-	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
@@ -53,6 +62,11 @@ type metrics struct {
 	cdnCacheHitCount     *prometheus.CounterVec
 	cdnDownloadCount     *prometheus.CounterVec
 	cdnDownloadFailCount *prometheus.CounterVec
+	cdnSizeLimitCount    *prometheus.CounterVec
+	cdnShortWriteCount   *prometheus.CounterVec
+	cdnSourceChangeCount *prometheus.CounterVec
+
+	cdnOriginFailoverCount *prometheus.CounterVec
 }
 
 func newMetrics(register prometheus.Registerer) *metrics {
@@ -65,6 +79,18 @@ func newMetrics(register prometheus.Registerer) *metrics {
 
 		cdnDownloadFailCount: metricsutils.NewCounter(config.SubsystemSupernode, "cdn_download_failed_total",
 			"Total failure times of cdn download", []string{}, register),
+
+		cdnSizeLimitCount: metricsutils.NewCounter(config.SubsystemSupernode, "cdn_size_limit_exceeded_total",
+			"Total times of aborting cdn download since the source sends more data than allowed", []string{}, register),
+
+		cdnShortWriteCount: metricsutils.NewCounter(config.SubsystemSupernode, "cdn_short_write_total",
+			"Total times of failing cdn download since the pieces can't be written to the storage as they are", []string{}, register),
+
+		cdnSourceChangeCount: metricsutils.NewCounter(config.SubsystemSupernode, "cdn_source_changed_total",
+			"Total times of invalidating the task since the file of the source has changed", []string{}, register),
+
+		cdnOriginFailoverCount: metricsutils.NewCounter(config.SubsystemSupernode, "cdn_origin_failover_total",
+			"Total times of failing over to another origin or mirror since the origin fails", []string{}, register),
 	}
 }
 
@@ -76,43 +102,67 @@ func init() {
 type Manager struct {
 	cfg             *config.Config
 	cacheStore      *store.Store
-	limiter         *ratelimiter.RateLimiter
+	limiter         *originLimiter
 	cdnLocker       *util.LockerPool
 	progressManager mgr.ProgressMgr
+	contributionMgr mgr.ContributionMgr
 
 	metaDataManager *fileMetaDataManager
 	cdnReporter     *reporter
 	detector        *cacheDetector
 	originClient    httpclient.OriginHTTPClient
+	mirrors         *originMirrors
+	cachePolicy     *cachePolicy
 	pieceMD5Manager *pieceMD5Mgr
 	writer          *superWriter
+	scanner         *cacheScanner
 	metrics         *metrics
 }
 
 // NewManager returns a new Manager.
-func NewManager(cfg *config.Config, cacheStore *store.Store, progressManager mgr.ProgressMgr,
-	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (mgr.CDNMgr, error) {
-	return newManager(cfg, cacheStore, progressManager, originClient, register)
+func NewManager(cfg *config.Config, cacheStore *store.Store, metaStore *metastore.Store, progressManager mgr.ProgressMgr,
+	contributionManager mgr.ContributionMgr, originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (mgr.CDNMgr, error) {
+	return newManager(cfg, cacheStore, metaStore, progressManager, contributionManager, originClient, register)
 }
 
-func newManager(cfg *config.Config, cacheStore *store.Store, progressManager mgr.ProgressMgr,
-	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (*Manager, error) {
-	rateLimiter := ratelimiter.NewRateLimiter(ratelimiter.TransRate(int64(cfg.MaxBandwidth-cfg.SystemReservedBandwidth)), 2)
-	metaDataManager := newFileMetaDataManager(cacheStore)
+func newManager(cfg *config.Config, cacheStore *store.Store, metaStore *metastore.Store, progressManager mgr.ProgressMgr,
+	contributionManager mgr.ContributionMgr, originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (*Manager, error) {
+	limiter := newOriginLimiter(int64(cfg.MaxBandwidth-cfg.SystemReservedBandwidth), cfg.LowPriorityRatio)
+	metaDataManager := newFileMetaDataManager(cacheStore, metaStore)
 	pieceMD5Manager := newpieceMD5Mgr()
 	cdnReporter := newReporter(cfg, cacheStore, progressManager, metaDataManager, pieceMD5Manager)
+	cachePolicy, err := newCachePolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mirrors, err := newOriginMirrors(cfg)
+	if err != nil {
+		return nil, err
+	}
+	writer := newSuperWriter(cacheStore, cdnReporter)
+	writer.hashWorkers = cfg.CDNHashWorkers
+	writer.preallocate = cfg.CDNPreallocate
+	writer.verifyWrite = cfg.CDNVerifyWrite
+	if cfg.PieceDedup {
+		writer.dedup = newPieceDedup(cacheStore, register)
+	}
+	cdnLocker := util.NewLockerPool()
 	return &Manager{
 		cfg:             cfg,
 		cacheStore:      cacheStore,
-		limiter:         rateLimiter,
-		cdnLocker:       util.NewLockerPool(),
+		limiter:         limiter,
+		cdnLocker:       cdnLocker,
 		progressManager: progressManager,
+		contributionMgr: contributionManager,
 		metaDataManager: metaDataManager,
 		pieceMD5Manager: pieceMD5Manager,
 		cdnReporter:     cdnReporter,
 		detector:        newCacheDetector(cacheStore, metaDataManager, originClient),
 		originClient:    originClient,
-		writer:          newSuperWriter(cacheStore, cdnReporter),
+		mirrors:         mirrors,
+		cachePolicy:     cachePolicy,
+		writer:          writer,
+		scanner:         newCacheScanner(cacheStore, metaDataManager, cdnLocker, cfg.CacheScanWorkers),
 		metrics:         newMetrics(register),
 	}, nil
 }
@@ -124,6 +174,7 @@ func (cm *Manager) TriggerCDN(ctx context.Context, task *types.TaskInfo) (*types
 		httpFileLength = -1
 	}
 
+	cm.scanner.trigger(task.ID)
 	cm.cdnLocker.GetLock(task.ID, false)
 	defer cm.cdnLocker.ReleaseLock(task.ID, false)
 	// detect Cache
@@ -131,7 +182,7 @@ func (cm *Manager) TriggerCDN(ctx context.Context, task *types.TaskInfo) (*types
 	if err != nil {
 		logrus.Errorf("failed to detect cache for task %s: %v", task.ID, err)
 	}
-	fileMD5, updateTaskInfo, err := cm.cdnReporter.reportCache(ctx, task.ID, metaData, startPieceNum)
+	fileMD5, fileSHA256, updateTaskInfo, err := cm.cdnReporter.reportCache(ctx, task.ID, metaData, startPieceNum)
 	if err != nil {
 		logrus.Errorf("failed to report cache for taskId: %s : %v", task.ID, err)
 	}
@@ -141,16 +192,19 @@ func (cm *Manager) TriggerCDN(ctx context.Context, task *types.TaskInfo) (*types
 		cm.metrics.cdnCacheHitCount.WithLabelValues().Inc()
 		return updateTaskInfo, nil
 	}
+	if startPieceNum > 0 {
+		logrus.Infof("resume to fetch taskId:%s from the source at pieceNum %d", task.ID, startPieceNum)
+	}
 
-	if fileMD5 == nil {
-		fileMD5 = md5.New()
+	if fileMD5 == nil || fileSHA256 == nil {
+		fileMD5, fileSHA256 = md5.New(), sha256.New()
 	}
 
 	// get piece content size which not including the piece header and trailer
 	pieceContSize := task.PieceSize - config.PieceWrapSize
 
 	// start to download the source file
-	resp, err := cm.download(ctx, task.ID, task.RawURL, task.Headers, startPieceNum, httpFileLength, pieceContSize)
+	resp, err := cm.downloadFromOrigins(ctx, task, startPieceNum, httpFileLength, pieceContSize)
 	cm.metrics.cdnDownloadCount.WithLabelValues().Inc()
 	if err != nil {
 		cm.metrics.cdnDownloadFailCount.WithLabelValues().Inc()
@@ -158,21 +212,96 @@ func (cm *Manager) TriggerCDN(ctx context.Context, task *types.TaskInfo) (*types
 	}
 	defer resp.Body.Close()
 
+	// the pieces of the different versions of the file mustn't be mixed in the cache and the swarm
+	if err := checkSourceVersion(metaData, resp, startPieceNum, pieceContSize); err != nil {
+		cm.metrics.cdnSourceChangeCount.WithLabelValues().Inc()
+		logrus.Warnf("taskID: %s, the source has changed and the cache is reset: %v", task.ID, err)
+		if _, e := cm.detector.resetRepo(ctx, task); e != nil {
+			logrus.Errorf("taskID: %s, failed to reset repo: %v", task.ID, e)
+		}
+		return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+	}
+
 	cm.updateLastModifiedAndETag(ctx, task.ID, resp.Header.Get("Last-Modified"), resp.Header.Get("Etag"))
-	reader := limitreader.NewLimitReaderWithLimiterAndMD5Sum(resp.Body, cm.limiter, fileMD5)
+	cm.updateFreshness(ctx, task, resp.Header)
+	// the sha256 digest is calculated on the fly and published to the peers,
+	// so that they could verify the file even if the md5 is not provided.
+	// The file digests are calculated in parallel with reading the source.
+	digest := newParallelDigest(digestQueueSize, fileMD5, fileSHA256)
+	// the origin bandwidth is allocated by the priority of the task, which may be
+	// raised by the registrations of a higher priority during the download.
+	cm.limiter.start(task.ID, task.Priority)
+	defer cm.limiter.finish(task.ID)
+	body := limitreader.NewSizeLimitReader(resp.Body, cm.sourceSizeLimit(resp, httpFileLength, startPieceNum, pieceContSize))
+	reader := cm.limiter.reader(task.ID, io.TeeReader(body, digest))
 	downloadMetadata, err := cm.writer.startWriter(ctx, cm.cfg, reader, task, startPieceNum, httpFileLength, pieceContSize)
+	digest.Close()
 	if err != nil {
+		if errortypes.IsSizeLimitExceeded(err) {
+			cm.metrics.cdnSizeLimitCount.WithLabelValues().Inc()
+		}
+		if errortypes.IsShortWrite(err) {
+			cm.metrics.cdnShortWriteCount.WithLabelValues().Inc()
+		}
 		logrus.Errorf("failed to write for task %s: %v", task.ID, err)
 		return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
 	}
+	// the pieces before startPieceNum have been cached and are not fetched again
+	cm.contributionMgr.ReportSourceFetched(ctx, task.ID,
+		downloadMetadata.realHTTPFileLength-int64(startPieceNum)*int64(pieceContSize))
 
-	realMD5 := reader.Md5()
-	success, err := cm.handleCDNResult(ctx, task, realMD5, httpFileLength, downloadMetadata.realHTTPFileLength, downloadMetadata.realFileLength)
+	realMD5 := fileutils.GetMd5Sum(fileMD5, nil)
+	realSHA256 := hex.EncodeToString(fileSHA256.Sum(nil))
+	success, err := cm.handleCDNResult(ctx, task, realMD5, realSHA256, httpFileLength, downloadMetadata.realHTTPFileLength, downloadMetadata.realFileLength)
 	if err != nil || !success {
 		return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
 	}
 
-	return getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, realMD5, downloadMetadata.realFileLength), nil
+	updateTaskInfo = getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, realMD5, downloadMetadata.realFileLength)
+	updateTaskInfo.RealSha256 = realSHA256
+	return updateTaskInfo, nil
+}
+
+// sourceSizeLimit returns the max number of the bytes read from the response of the source,
+// which is fetched from startPieceNum. The registered file length of the task is expected
+// if the response doesn't carry the Content-Length.
+func (cm *Manager) sourceSizeLimit(resp *http.Response, httpFileLength int64, startPieceNum int, pieceContSize int32) int64 {
+	contentLength := resp.ContentLength
+	if contentLength < 0 && httpFileLength >= 0 {
+		contentLength = httpFileLength - int64(startPieceNum)*int64(pieceContSize)
+	}
+	return limitreader.SizeLimit(contentLength, cm.cfg.SourceSizeMargin, int64(cm.cfg.MaxSourceSize))
+}
+
+// checkSourceVersion checks whether the response of the source fetched from startPieceNum
+// is of the same version of the file as the one recorded in the metadata at the first fetch,
+// by comparing the ETag and the file length.
+func checkSourceVersion(metaData *fileMetaData, resp *http.Response, startPieceNum int, pieceContSize int32) error {
+	if metaData == nil {
+		return nil
+	}
+	if eTag := resp.Header.Get("Etag"); metaData.ETag != "" && eTag != "" && eTag != metaData.ETag {
+		return errors.Wrapf(errortypes.ErrSourceChanged, "etag changed from %s to %s", metaData.ETag, eTag)
+	}
+	if metaData.HTTPFileLen <= 0 || resp.ContentLength < 0 {
+		return nil
+	}
+	expected := metaData.HTTPFileLen
+	if resp.StatusCode == http.StatusPartialContent {
+		expected -= int64(startPieceNum) * int64(pieceContSize)
+	}
+	if resp.ContentLength != expected {
+		return errors.Wrapf(errortypes.ErrSourceChanged, "content length changed from %d to %d",
+			expected, resp.ContentLength)
+	}
+	return nil
+}
+
+// UpdatePriority raises the priority of the running CDN download of taskID,
+// and it's ignored if the CDN of taskID is not running.
+func (cm *Manager) UpdatePriority(ctx context.Context, taskID string, priority types.Priority) error {
+	cm.limiter.raise(taskID, priority)
+	return nil
 }
 
 // GetHTTPPath returns the http download path of taskID.
@@ -239,6 +368,36 @@ func (cm *Manager) GetPieceMD5(ctx context.Context, taskID string, pieceNum int,
 	return "", nil
 }
 
+// GetPieceMD5s gets the md5 of all pieces of the task from the meta data file.
+func (cm *Manager) GetPieceMD5s(ctx context.Context, taskID string) ([]string, error) {
+	fileMeta, err := cm.metaDataManager.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get file meta data taskID(%s)", taskID)
+	}
+	if !fileMeta.Finish || !fileMeta.Success {
+		return nil, errors.Wrapf(errortypes.ErrCDNWait, "taskID %s", taskID)
+	}
+
+	pieceMD5s, err := cm.metaDataManager.readPieceMD5s(ctx, taskID, fileMeta.RealMd5)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get piece MD5s from meta data taskID(%s)", taskID)
+	}
+	if len(pieceMD5s) == 0 {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "piece md5s of taskID %s", taskID)
+	}
+	return pieceMD5s, nil
+}
+
+// StartScan scans the cached files in the background and repairs the inconsistent ones.
+func (cm *Manager) StartScan(ctx context.Context) {
+	cm.scanner.start(ctx)
+}
+
+// GetScanStatus returns the progress of the scan of the cached files.
+func (cm *Manager) GetScanStatus(ctx context.Context) *types.CacheScanStatus {
+	return cm.scanner.status()
+}
+
 // CheckFile checks the file whether exists.
 func (cm *Manager) CheckFile(ctx context.Context, taskID string) bool {
 	if _, err := cm.cacheStore.Stat(ctx, getDownloadRaw(taskID)); err != nil {
@@ -254,15 +413,24 @@ func (cm *Manager) Delete(ctx context.Context, taskID string, force bool) error
 		return cm.pieceMD5Manager.removePieceMD5sByTaskID(taskID)
 	}
 
+	if err := cm.metaDataManager.removePieceMD5Manifest(taskID); err != nil {
+		return err
+	}
 	return deleteTaskFiles(ctx, cm.cacheStore, taskID)
 }
 
-func (cm *Manager) handleCDNResult(ctx context.Context, task *types.TaskInfo, realMd5 string, httpFileLength, realHTTPFileLength, realFileLength int64) (bool, error) {
+func (cm *Manager) handleCDNResult(ctx context.Context, task *types.TaskInfo, realMd5, realSha256 string, httpFileLength, realHTTPFileLength, realFileLength int64) (bool, error) {
 	var isSuccess = true
 	if !stringutils.IsEmptyStr(task.Md5) && task.Md5 != realMd5 {
 		logrus.Errorf("taskId:%s url:%s file md5 not match expected:%s real:%s", task.ID, task.TaskURL, task.Md5, realMd5)
 		isSuccess = false
 	}
+	// only the sha256 digests are computed by CDN, the others are verified by dfget.
+	if isSuccess && strings.HasPrefix(task.Digest, digest.AlgorithmSHA256+":") &&
+		task.Digest != digest.String(digest.AlgorithmSHA256, realSha256) {
+		logrus.Errorf("taskId:%s url:%s file digest not match expected:%s real:%s", task.ID, task.TaskURL, task.Digest, realSha256)
+		isSuccess = false
+	}
 	if isSuccess && httpFileLength >= 0 && httpFileLength != realHTTPFileLength {
 		logrus.Errorf("taskId:%s url:%s file length not match expected:%d real:%d", task.ID, task.TaskURL, httpFileLength, realHTTPFileLength)
 		isSuccess = false
@@ -275,6 +443,7 @@ func (cm *Manager) handleCDNResult(ctx context.Context, task *types.TaskInfo, re
 		Finish:     true,
 		Success:    isSuccess,
 		RealMd5:    realMd5,
+		RealSha256: realSha256,
 		FileLength: realFileLength,
 	}); err != nil {
 		return false, err
@@ -284,7 +453,7 @@ func (cm *Manager) handleCDNResult(ctx context.Context, task *types.TaskInfo, re
 		return false, nil
 	}
 
-	logrus.Infof("success to get taskID: %s fileLength: %d realMd5: %s", task.ID, realFileLength, realMd5)
+	logrus.Infof("success to get taskID: %s fileLength: %d realMd5: %s realSha256: %s", task.ID, realFileLength, realMd5, realSha256)
 
 	pieceMD5s, err := cm.pieceMD5Manager.getPieceMD5sByTaskID(task.ID)
 	if err != nil {
@@ -294,9 +463,24 @@ func (cm *Manager) handleCDNResult(ctx context.Context, task *types.TaskInfo, re
 	if err := cm.metaDataManager.writePieceMD5s(ctx, task.ID, realMd5, pieceMD5s); err != nil {
 		return false, err
 	}
+	// the progress is useless since the piece md5s have been written
+	if err := cm.metaDataManager.removePieceProgress(ctx, task.ID); err != nil {
+		logrus.Warnf("failed to remove the progress file of taskID %s: %v", task.ID, err)
+	}
 	return true, nil
 }
 
+func (cm *Manager) updateFreshness(ctx context.Context, task *types.TaskInfo, header http.Header) {
+	ttl, noStore := cm.cachePolicy.freshness(task.RawURL, header)
+	var expireTime int64
+	if ttl > 0 {
+		expireTime = getCurrentTimeMillisFunc() + int64(ttl/time.Millisecond)
+	}
+	if err := cm.metaDataManager.updateFreshness(ctx, task.ID, expireTime, noStore); err != nil {
+		logrus.Errorf("failed to update the freshness(ttl: %v, noStore: %t) for taskID %s: %v", ttl, noStore, task.ID, err)
+	}
+}
+
 func (cm *Manager) updateLastModifiedAndETag(ctx context.Context, taskID, lastModified, eTag string) {
 	lastModifiedInt, _ := netutils.ConvertTimeStringToInt(lastModified)
 	if err := cm.metaDataManager.updateLastModifiedAndETag(ctx, taskID, lastModifiedInt, eTag); err != nil {
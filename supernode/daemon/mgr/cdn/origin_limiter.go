@@ -0,0 +1,153 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"io"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+)
+
+// originLimiter allocates the origin bandwidth of supernode to the downloads of CDN
+// by their priorities. All the downloads share the limiter of the whole bandwidth,
+// and the downloads of a priority are additionally limited to the ratio of it while
+// there are the ones of a higher priority.
+type originLimiter struct {
+	total *ratelimiter.RateLimiter
+	rate  int64
+	ratio float64
+
+	mu sync.Mutex
+	// levels records the priority level of the running download of every task.
+	levels map[string]int
+	// running is the number of the running downloads of every level.
+	running [mgr.PriorityLevels]int
+	// limiters limit the downloads of every level which yields to a higher level,
+	// and it's nil if the level doesn't yield.
+	limiters [mgr.PriorityLevels]*ratelimiter.RateLimiter
+}
+
+func newOriginLimiter(rate int64, ratio float64) *originLimiter {
+	return &originLimiter{
+		total:  ratelimiter.NewRateLimiter(ratelimiter.TransRate(rate), 2),
+		rate:   rate,
+		ratio:  ratio,
+		levels: make(map[string]int),
+	}
+}
+
+// start registers the download of the task with the priority.
+func (ol *originLimiter) start(taskID string, priority types.Priority) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+
+	if _, ok := ol.levels[taskID]; ok {
+		return
+	}
+	level := mgr.PriorityLevel(priority)
+	ol.levels[taskID] = level
+	ol.running[level]++
+	ol.adjust()
+}
+
+// raise raises the priority of the running download of the task,
+// and it's ignored if the priority is not higher.
+func (ol *originLimiter) raise(taskID string, priority types.Priority) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+
+	current, ok := ol.levels[taskID]
+	level := mgr.PriorityLevel(priority)
+	if !ok || level <= current {
+		return
+	}
+	ol.levels[taskID] = level
+	ol.running[current]--
+	ol.running[level]++
+	ol.adjust()
+}
+
+// finish unregisters the download of the task.
+func (ol *originLimiter) finish(taskID string) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+
+	level, ok := ol.levels[taskID]
+	if !ok {
+		return
+	}
+	delete(ol.levels, taskID)
+	ol.running[level]--
+	ol.adjust()
+}
+
+// adjust updates the limiters of the levels after the running downloads change.
+// A new limiter is created when a level starts to yield, so that the rate of the
+// limiter being acquired is never changed.
+func (ol *originLimiter) adjust() {
+	if ol.ratio <= 0 || ol.ratio >= 1 {
+		return
+	}
+	higher := 0
+	for level := mgr.PriorityLevels - 1; level >= 0; level-- {
+		if higher == 0 || ol.running[level] == 0 {
+			ol.limiters[level] = nil
+		} else if ol.limiters[level] == nil {
+			ol.limiters[level] = ratelimiter.NewRateLimiter(
+				ratelimiter.TransRate(int64(float64(ol.rate)*ol.ratio)), 2)
+		}
+		higher += ol.running[level]
+	}
+}
+
+// acquire blocks until the download of the task is allowed to read n bytes.
+func (ol *originLimiter) acquire(taskID string, n int64) {
+	ol.mu.Lock()
+	var limiter *ratelimiter.RateLimiter
+	if level, ok := ol.levels[taskID]; ok {
+		limiter = ol.limiters[level]
+	}
+	ol.mu.Unlock()
+
+	if limiter != nil {
+		limiter.AcquireBlocking(n)
+	}
+	ol.total.AcquireBlocking(n)
+}
+
+// reader returns a reader which reads src limited by the bandwidth
+// allocated to the download of the task.
+func (ol *originLimiter) reader(taskID string, src io.Reader) io.Reader {
+	return &originLimitReader{limiter: ol, taskID: taskID, src: src}
+}
+
+type originLimitReader struct {
+	limiter *originLimiter
+	taskID  string
+	src     io.Reader
+}
+
+func (r *originLimitReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if n > 0 {
+		r.limiter.acquire(r.taskID, int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/rate"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&OriginLimiterTestSuite{})
+}
+
+type OriginLimiterTestSuite struct{}
+
+func (s *OriginLimiterTestSuite) TestYield(c *check.C) {
+	ol := newOriginLimiter(int64(100*rate.MB), 0.25)
+	yielding := func() (levels []bool) {
+		for _, l := range ol.limiters {
+			levels = append(levels, l != nil)
+		}
+		return levels
+	}
+
+	ol.start("low", types.PriorityLow)
+	c.Check(yielding(), check.DeepEquals, []bool{false, false, false})
+
+	// the low one yields to the normal one
+	ol.start("normal", "")
+	c.Check(yielding(), check.DeepEquals, []bool{true, false, false})
+	limiter := ol.limiters[0]
+	c.Check(limiter.Rate() < int64(100*rate.MB)/2, check.Equals, true)
+
+	// and both of them yield to the high one
+	ol.raise("normal", types.PriorityHigh)
+	ol.raise("low", types.PriorityNormal)
+	c.Check(yielding(), check.DeepEquals, []bool{false, true, false})
+
+	// a lower priority doesn't change the download
+	ol.raise("normal", types.PriorityLow)
+	c.Check(ol.levels["normal"], check.Equals, 2)
+
+	ol.finish("normal")
+	c.Check(yielding(), check.DeepEquals, []bool{false, false, false})
+	ol.finish("low")
+	c.Check(ol.levels, check.HasLen, 0)
+	c.Check(ol.running, check.DeepEquals, [3]int{0, 0, 0})
+}
+
+func (s *OriginLimiterTestSuite) TestDisabled(c *check.C) {
+	for _, ratio := range []float64{0, 1} {
+		ol := newOriginLimiter(int64(100*rate.MB), ratio)
+		ol.start("low", types.PriorityLow)
+		ol.start("high", types.PriorityHigh)
+		c.Check(ol.limiters[0], check.IsNil)
+	}
+}
+
+func (s *OriginLimiterTestSuite) TestReader(c *check.C) {
+	ol := newOriginLimiter(int64(100*rate.MB), 0.25)
+	ol.start("low", types.PriorityLow)
+	ol.start("high", types.PriorityHigh)
+
+	data := bytes.Repeat([]byte("x"), 1<<16)
+	for _, taskID := range []string{"low", "high", "unknown"} {
+		content, err := ioutil.ReadAll(ol.reader(taskID, bytes.NewReader(data)))
+		c.Assert(err, check.IsNil)
+		c.Check(content, check.DeepEquals, data)
+	}
+}
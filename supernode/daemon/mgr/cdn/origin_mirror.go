@@ -0,0 +1,263 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	netUrl "net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// originMirrors selects the origins of a task among its URL and the mirrors of it,
+// and tracks the health of the origins by their hosts.
+type originMirrors struct {
+	rules    []*originMirrorRule
+	cooldown time.Duration
+
+	mu sync.Mutex
+	// failed records the time that the hosts failed to be fetched at last.
+	failed map[string]time.Time
+}
+
+type originMirrorRule struct {
+	pattern *regexp.Regexp
+	mirrors []string
+}
+
+func newOriginMirrors(cfg *config.Config) (*originMirrors, error) {
+	om := &originMirrors{
+		cooldown: cfg.OriginFailoverCooldown,
+		failed:   make(map[string]time.Time),
+	}
+	for _, m := range cfg.OriginMirrors {
+		if m == nil {
+			continue
+		}
+		pattern, err := regexp.Compile(m.URLPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid url pattern of origin mirror: %s", m.URLPattern)
+		}
+		om.rules = append(om.rules, &originMirrorRule{
+			pattern: pattern,
+			mirrors: m.Mirrors,
+		})
+	}
+	return om, nil
+}
+
+// origins returns the URL and the URLs of its mirrors. The ones failing in the cooldown
+// are put after the healthy ones, otherwise they're in the order of the configuration.
+func (om *originMirrors) origins(url string) []string {
+	urls := []string{url}
+	for _, r := range om.rules {
+		loc := r.pattern.FindStringSubmatchIndex(url)
+		if loc == nil {
+			continue
+		}
+		for _, m := range r.mirrors {
+			mirror := url[:loc[0]] + string(r.pattern.ExpandString(nil, m, url, loc)) + url[loc[1]:]
+			if mirror != url {
+				urls = append(urls, mirror)
+			}
+		}
+		break
+	}
+	if len(urls) == 1 {
+		return urls
+	}
+
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	var healthy, failing []string
+	for _, u := range urls {
+		if t, ok := om.failed[originHost(u)]; ok && time.Since(t) < om.cooldown {
+			failing = append(failing, u)
+		} else {
+			healthy = append(healthy, u)
+		}
+	}
+	return append(healthy, failing...)
+}
+
+// report records the result of fetching the url.
+func (om *originMirrors) report(url string, err error) {
+	if len(om.rules) == 0 {
+		return
+	}
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	if err != nil {
+		om.failed[originHost(url)] = time.Now()
+	} else {
+		delete(om.failed, originHost(url))
+	}
+}
+
+func originHost(url string) string {
+	if u, err := netUrl.Parse(url); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return url
+}
+
+// downloadFromOrigins downloads the file of the task like download, and the mirrors of
+// its URL are tried in turn if the origin fails. If the task is fetched entirely, the body
+// of the response fails over to the other origins by the ranged requests from the offset
+// read so far when it fails to be read, so the download continues without restarting.
+func (cm *Manager) downloadFromOrigins(ctx context.Context, task *types.TaskInfo,
+	startPieceNum int, httpFileLength int64, pieceContSize int32) (*http.Response, error) {
+	origins := cm.mirrors.origins(task.RawURL)
+	var err error
+	for i, origin := range origins {
+		var resp *http.Response
+		resp, err = cm.download(ctx, task.ID, origin, task.Headers, startPieceNum, httpFileLength, pieceContSize)
+		cm.mirrors.report(origin, err)
+		if err != nil {
+			if i < len(origins)-1 {
+				logrus.Warnf("taskID: %s, failed to download from %s, fail over to %s: %v", task.ID, origin, origins[i+1], err)
+				cm.metrics.cdnOriginFailoverCount.WithLabelValues().Inc()
+			}
+			continue
+		}
+		if len(origins) > 1 && !hasRange(task.Headers) {
+			others := append(append([]string{}, origins[i+1:]...), origins[:i]...)
+			resp.Body = newFailoverBody(cm, task, resp, origin, others, int64(startPieceNum)*int64(pieceContSize), httpFileLength)
+		}
+		return resp, nil
+	}
+	return nil, err
+}
+
+// failoverBody is the body of the response from an origin, which fails over to the other
+// origins by the ranged requests from the offset read so far if it fails to be read.
+type failoverBody struct {
+	cm      *Manager
+	taskID  string
+	headers map[string]string
+
+	origin  string
+	origins []string
+	body    io.ReadCloser
+
+	// offset is the offset in the file of the next byte read from the body,
+	// and total is the length of the file, -1 if it's unknown.
+	offset int64
+	total  int64
+}
+
+func newFailoverBody(cm *Manager, task *types.TaskInfo, resp *http.Response, origin string, origins []string,
+	offset, httpFileLength int64) *failoverBody {
+	total := httpFileLength
+	if total < 0 {
+		total = contentTotal(resp)
+	}
+	return &failoverBody{
+		cm:      cm,
+		taskID:  task.ID,
+		headers: task.Headers,
+		origin:  origin,
+		origins: origins,
+		body:    resp.Body,
+		offset:  offset,
+		total:   total,
+	}
+}
+
+func (b *failoverBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == io.EOF && b.total >= 0 && b.offset < b.total {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || err == io.EOF || !b.failover(err) {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (b *failoverBody) Close() error {
+	return b.body.Close()
+}
+
+// failover replaces the failed body with the one of the next origin which succeeds
+// to respond the rest of the file, it returns false if none of them succeeds.
+func (b *failoverBody) failover(cause error) bool {
+	b.body.Close()
+	b.cm.mirrors.report(b.origin, cause)
+	for len(b.origins) > 0 {
+		origin := b.origins[0]
+		b.origins = b.origins[1:]
+		body, err := b.resume(origin)
+		b.cm.mirrors.report(origin, err)
+		if err != nil {
+			logrus.Warnf("taskID: %s, failed to resume from %s at offset %d: %v", b.taskID, origin, b.offset, err)
+			continue
+		}
+		logrus.Warnf("taskID: %s, fail over from %s to %s at offset %d: %v", b.taskID, b.origin, origin, b.offset, cause)
+		b.cm.metrics.cdnOriginFailoverCount.WithLabelValues().Inc()
+		b.origin, b.body = origin, body
+		return true
+	}
+	return false
+}
+
+// resume requests the rest of the file from the origin, and checks that
+// the response starts at the offset of the file of the same length.
+func (b *failoverBody) resume(origin string) (io.ReadCloser, error) {
+	headers := httpclient.CopyHeader(map[string]string{"Range": fmt.Sprintf("bytes=%d-", b.offset)}, b.headers)
+	resp, err := b.cm.originClient.Download(origin, httputils.WithTaskHeader(headers, b.taskID),
+		checkStatusCode([]int{http.StatusPartialContent}))
+	if err != nil {
+		return nil, err
+	}
+	var start, end, total int64
+	if n, _ := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); n != 3 ||
+		start != b.offset || (b.total >= 0 && total != b.total) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected content range: %s", resp.Header.Get("Content-Range"))
+	}
+	return resp.Body, nil
+}
+
+// contentTotal returns the length of the file told by the response, -1 if it's unknown.
+func contentTotal(resp *http.Response) int64 {
+	if resp.StatusCode == http.StatusOK {
+		return resp.ContentLength
+	}
+	var start, end, total int64
+	if n, _ := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); n == 3 {
+		return total
+	}
+	return -1
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	check.Suite(&OriginMirrorTestSuite{})
+}
+
+type OriginMirrorTestSuite struct{}
+
+func (s *OriginMirrorTestSuite) TestOrigins(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.OriginMirrors = []*config.OriginMirror{{
+		URLPattern: `^https://primary\.example\.com/(.*)$`,
+		Mirrors:    []string{"https://m1.example.com/$1", "https://m2.example.com/mirror/$1"},
+	}}
+	om, err := newOriginMirrors(cfg)
+	c.Assert(err, check.IsNil)
+
+	url := "https://primary.example.com/a/b?c=d"
+	c.Check(om.origins(url), check.DeepEquals,
+		[]string{url, "https://m1.example.com/a/b?c=d", "https://m2.example.com/mirror/a/b?c=d"})
+	c.Check(om.origins("https://other.example.com/a"), check.DeepEquals, []string{"https://other.example.com/a"})
+
+	// the failed origin is tried at last in the cooldown
+	om.report(url, errors.New("failed"))
+	c.Check(om.origins(url), check.DeepEquals,
+		[]string{"https://m1.example.com/a/b?c=d", "https://m2.example.com/mirror/a/b?c=d", url})
+	om.report("https://primary.example.com/other", nil)
+	c.Check(om.origins(url)[0], check.Equals, url)
+
+	om.cooldown = 0
+	om.report(url, errors.New("failed"))
+	c.Check(om.origins(url)[0], check.Equals, url)
+
+	cfg.OriginMirrors[0].URLPattern = "("
+	_, err = newOriginMirrors(cfg)
+	c.Check(err, check.NotNil)
+}
+
+func (s *OriginMirrorTestSuite) TestDownloadFromOrigins(c *check.C) {
+	data := []byte("0123456789abcdefghij")
+	var broken bool
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if broken {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// the connection is closed in the middle of the body
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data[:7])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer primary.Close()
+	var ranges []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer mirror.Close()
+
+	cfg := config.NewConfig()
+	cfg.OriginMirrors = []*config.OriginMirror{{
+		URLPattern: "^" + regexp.QuoteMeta(primary.URL),
+		Mirrors:    []string{mirror.URL},
+	}}
+	registry := prometheus.NewRegistry()
+	cm, err := newManager(cfg, nil, nil, nil, nil, httpclient.NewOriginClient(), registry)
+	c.Assert(err, check.IsNil)
+	task := &types.TaskInfo{ID: "foo", RawURL: primary.URL + "/foo"}
+
+	resp, err := cm.downloadFromOrigins(context.Background(), task, 0, int64(len(data)), 4)
+	c.Assert(err, check.IsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, string(data))
+	c.Check(ranges, check.DeepEquals, []string{"bytes=7-"})
+
+	// the primary is skipped in the cooldown, and it's still a fallback of the mirror
+	ranges = nil
+	broken = true
+	resp, err = cm.downloadFromOrigins(context.Background(), task, 1, int64(len(data)), 4)
+	c.Assert(err, check.IsNil)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(string(body), check.Equals, string(data[4:]))
+	c.Check(ranges, check.DeepEquals, []string{"bytes=4-19"})
+	c.Check(resp.Body.(*failoverBody).origins, check.DeepEquals, []string{task.RawURL})
+
+	cm.mirrors.cooldown = 0
+	resp, err = cm.downloadFromOrigins(context.Background(), task, 0, int64(len(data)), 4)
+	c.Assert(err, check.IsNil)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(string(body), check.Equals, string(data))
+}
@@ -30,6 +30,7 @@ import (
 var getDownloadRawFunc = getDownloadRaw
 var getMetaDataRawFunc = getMetaDataRaw
 var getMd5DataRawFunc = getMd5DataRaw
+var getProgressDataRawFunc = getProgressDataRaw
 var getHomeRawFunc = getHomeRaw
 
 func getDownloadKey(taskID string) string {
@@ -44,6 +45,10 @@ func getMd5DataKey(taskID string) string {
 	return path.Join(getParentKey(taskID), taskID+".md5")
 }
 
+func getProgressDataKey(taskID string) string {
+	return path.Join(getParentKey(taskID), taskID+".progress")
+}
+
 func getParentKey(taskID string) string {
 	return stringutils.SubString(taskID, 0, 3)
 }
@@ -71,6 +76,13 @@ func getMd5DataRaw(taskID string) *store.Raw {
 	}
 }
 
+func getProgressDataRaw(taskID string) *store.Raw {
+	return &store.Raw{
+		Bucket: config.DownloadHome,
+		Key:    getProgressDataKey(taskID),
+	}
+}
+
 func getParentRaw(taskID string) *store.Raw {
 	return &store.Raw{
 		Bucket: config.DownloadHome,
@@ -95,6 +107,11 @@ func deleteTaskFiles(ctx context.Context, cacheStore *store.Store, taskID string
 		return err
 	}
 
+	if err := cacheStore.Remove(ctx, getProgressDataRaw(taskID)); err != nil &&
+		!store.IsKeyNotFound(err) {
+		return err
+	}
+
 	if err := cacheStore.Remove(ctx, getDownloadRaw(taskID)); err != nil &&
 		!store.IsKeyNotFound(err) {
 		return err
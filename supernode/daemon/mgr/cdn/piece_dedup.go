@@ -0,0 +1,159 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// dedupBlockSize is the alignment of the pieces that can be deduplicated,
+// which is required by the reflinks of the file systems.
+const dedupBlockSize = 4096
+
+// pieceDedup stores the identical pieces of the tasks once.
+//
+// Each piece written to a task file is also referenced by a content-addressed blob
+// named by its sha256 under the PieceHome, which shares the data with the task file
+// by reflinks. When the same piece is written to another task, the data is cloned
+// from the blob instead of being written again, so that the identical pieces share
+// the disk space. The blobs only hold the data that is not referenced by any task
+// file anymore, since the data is shared, and they're removed by the disk GC.
+type pieceDedup struct {
+	cacheStore *store.Store
+
+	// disabled is set when the storage doesn't support reflinks.
+	disabled int32
+
+	dedupBytes *prometheus.CounterVec
+}
+
+func newPieceDedup(cacheStore *store.Store, register prometheus.Registerer) *pieceDedup {
+	return &pieceDedup{
+		cacheStore: cacheStore,
+		dedupBytes: metricsutils.NewCounter(config.SubsystemSupernode, "cdn_dedup_bytes_total",
+			"Total bytes of the pieces which share the data with the identical ones", []string{}, register),
+	}
+}
+
+// getPieceBlobRaw returns the raw of the blob which holds the data with the digest.
+func getPieceBlobRaw(digest string, length int64) *store.Raw {
+	return &store.Raw{
+		Bucket: config.PieceHome,
+		Key:    path.Join(digest[:3], fmt.Sprintf("%s-%d", digest, length)),
+		Length: length,
+	}
+}
+
+// available returns whether the piece written to dst can be deduplicated.
+func (pd *pieceDedup) available(dst *store.Raw, length int) bool {
+	return pd != nil && atomic.LoadInt32(&pd.disabled) == 0 &&
+		length > 0 && length%dedupBlockSize == 0 && dst.Offset%dedupBlockSize == 0
+}
+
+// write writes the data of a piece to dst by cloning it from the blob of the identical
+// piece, and returns false if the data should be written by the caller.
+// The blob returned should be passed to share after the data is written.
+func (pd *pieceDedup) write(ctx context.Context, dst *store.Raw, data []byte) (ok bool, blob *store.Raw) {
+	if !pd.available(dst, len(data)) {
+		return false, nil
+	}
+
+	blob = getPieceBlobRaw(fmt.Sprintf("%x", sha256.Sum256(data)), int64(len(data)))
+	if info, err := pd.cacheStore.Stat(ctx, blob); err != nil || info.Size != blob.Length {
+		return false, blob
+	}
+	if err := pd.cacheStore.Clone(ctx, blob, dst); err != nil {
+		pd.handleError(err)
+		return false, nil
+	}
+	pd.dedupBytes.WithLabelValues().Add(float64(blob.Length))
+	return true, nil
+}
+
+// share makes the blob share the data of the piece written to src.
+func (pd *pieceDedup) share(ctx context.Context, src, blob *store.Raw) {
+	if blob == nil {
+		return
+	}
+	raw := *src
+	raw.Length = blob.Length
+	dst := *blob
+	dst.Length = 0
+	if err := pd.cacheStore.Clone(ctx, &raw, &dst); err != nil {
+		pd.handleError(err)
+		pd.cacheStore.Remove(ctx, blob)
+	}
+}
+
+func (pd *pieceDedup) handleError(err error) {
+	if store.IsNotSupported(err) {
+		if atomic.CompareAndSwapInt32(&pd.disabled, 0, 1) {
+			logrus.Warnf("disable the dedup of pieces since the storage doesn't support reflinks: %v", err)
+		}
+		return
+	}
+	logrus.Warnf("failed to dedup the piece: %v", err)
+}
+
+// gc removes the blobs which are not modified within the expireTime,
+// or all of them if full is true.
+func (pd *pieceDedup) gc(ctx context.Context, full bool, expireTime time.Duration) {
+	if pd == nil {
+		return
+	}
+
+	var expired []string
+	deadline := time.Now().Add(-expireTime)
+	walkFn := func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if full || info.ModTime().Before(deadline) {
+			expired = append(expired, path.Join(path.Base(path.Dir(p)), info.Name()))
+		}
+		return nil
+	}
+	if err := pd.cacheStore.Walk(ctx, &store.Raw{Bucket: config.PieceHome, WalkFn: walkFn}); err != nil {
+		if !store.IsKeyNotFound(err) {
+			logrus.Warnf("failed to walk the blobs of pieces: %v", err)
+		}
+		return
+	}
+
+	for _, key := range expired {
+		if err := pd.cacheStore.Remove(ctx, &store.Raw{Bucket: config.PieceHome, Key: key}); err != nil &&
+			!store.IsKeyNotFound(err) {
+			logrus.Warnf("failed to remove the blob %s: %v", key, err)
+		}
+	}
+	if len(expired) > 0 {
+		logrus.Infof("gc %d blobs of pieces", len(expired))
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type PieceDedupTestSuite struct {
+	workHome string
+}
+
+func init() {
+	check.Suite(&PieceDedupTestSuite{})
+}
+
+func (s *PieceDedupTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "supernode-cdn-PieceDedupTestSuite-")
+}
+
+func (s *PieceDedupTestSuite) TearDownTest(c *check.C) {
+	os.RemoveAll(s.workHome)
+}
+
+// copyCloner clones the data by copying it, which simulates the storage supporting reflinks.
+type copyCloner struct {
+	store.StorageDriver
+	clones int
+}
+
+func (cc *copyCloner) Clone(ctx context.Context, src, dst *store.Raw) error {
+	cc.clones++
+	data, err := cc.GetBytes(ctx, src)
+	if err != nil {
+		return err
+	}
+	return cc.PutBytes(ctx, dst, data)
+}
+
+func (s *PieceDedupTestSuite) newWriter(c *check.C, cloner *copyCloner) *superWriter {
+	cfg := "baseDir: " + s.workHome
+	builder := store.NewLocalStorage
+	if cloner != nil {
+		builder = func(conf string) (store.StorageDriver, error) {
+			driver, err := store.NewLocalStorage(conf)
+			cloner.StorageDriver = driver
+			return cloner, err
+		}
+	}
+	cacheStore, err := store.NewStore(store.LocalStorageDriver, builder, cfg)
+	c.Assert(err, check.IsNil)
+	writer := newSuperWriter(cacheStore, nil)
+	writer.dedup = newPieceDedup(cacheStore, prometheus.NewRegistry())
+	return writer
+}
+
+func (s *PieceDedupTestSuite) writePieces(c *check.C, writer *superWriter, taskID string, pieces ...string) {
+	pieceSize := int32(dedupBlockSize)
+	for i, p := range pieces {
+		content := bytes.NewBufferString(p)
+		c.Assert(writer.writeToFile(context.TODO(), content, taskID, i, int32(len(p)), pieceSize, nil), check.IsNil)
+	}
+}
+
+func (s *PieceDedupTestSuite) TestDedup(c *check.C) {
+	cloner := &copyCloner{}
+	writer := s.newWriter(c, cloner)
+
+	full := string(bytes.Repeat([]byte("a"), dedupBlockSize-config.PieceWrapSize))
+	s.writePieces(c, writer, "task1", full, "tail")
+	// the data of the full piece is shared with a blob, while the tail is unaligned.
+	c.Check(cloner.clones, check.Equals, 1)
+
+	s.writePieces(c, writer, "task2", full, "other")
+	c.Check(cloner.clones, check.Equals, 2)
+
+	task1, err := writer.cdnStore.GetBytes(context.TODO(), getDownloadRaw("task1"))
+	c.Assert(err, check.IsNil)
+	task2, err := writer.cdnStore.GetBytes(context.TODO(), getDownloadRaw("task2"))
+	c.Assert(err, check.IsNil)
+	c.Check(task1[:dedupBlockSize], check.DeepEquals, task2[:dedupBlockSize])
+	c.Check(string(task2[dedupBlockSize+4:len(task2)-1]), check.Equals, "other")
+
+	writer.dedup.gc(context.TODO(), false, config.DefaultTaskExpireTime)
+	writer.dedup.gc(context.TODO(), true, 0)
+	s.writePieces(c, writer, "task3", full)
+	// the blob is created again after being removed by gc.
+	c.Check(cloner.clones, check.Equals, 3)
+}
+
+func (s *PieceDedupTestSuite) TestDedupNotSupported(c *check.C) {
+	writer := s.newWriter(c, nil)
+	full := string(bytes.Repeat([]byte("a"), dedupBlockSize-config.PieceWrapSize))
+	s.writePieces(c, writer, "task1", full)
+	s.writePieces(c, writer, "task2", full)
+	c.Check(writer.dedup.disabled, check.Equals, int32(1))
+
+	task2, err := writer.cdnStore.GetBytes(context.TODO(), getDownloadRaw("task2"))
+	c.Assert(err, check.IsNil)
+	c.Check(string(task2[4:len(task2)-1]), check.Equals, full)
+}
@@ -18,7 +18,9 @@ package cdn
 
 import (
 	"context"
+	"encoding/hex"
 	"hash"
+	"io"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
@@ -50,17 +52,19 @@ func newReporter(cfg *config.Config, cacheStore *store.Store, progressManager mg
 	}
 }
 
+// reportCache reports the pieces cached in the file. It returns the md5 and sha256
+// digests of the cached pieces if the fetch from the source should be resumed.
 func (re *reporter) reportCache(ctx context.Context, taskID string, metaData *fileMetaData,
-	breakNum int) (hash.Hash, *types.TaskInfo, error) {
+	breakNum int) (hash.Hash, hash.Hash, *types.TaskInfo, error) {
 	// cache not hit
 	if breakNum == 0 {
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	}
 
 	success, updateTaskInfo, err := re.processCacheByQuick(ctx, taskID, metaData, breakNum)
 	if err == nil && success {
 		// it is possible to succeed only if breakNum equals -1
-		return nil, updateTaskInfo, nil
+		return nil, nil, updateTaskInfo, nil
 	}
 	logrus.Errorf("failed to process cache by quick taskID(%s): %v", taskID, err)
 
@@ -99,13 +103,14 @@ func (re *reporter) processCacheByQuick(ctx context.Context, taskID string, meta
 		return false, nil, nil
 	}
 
-	return true, getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, metaData.Md5, metaData.FileLength),
-		re.reportPiecesStatus(ctx, taskID, pieceMd5s)
+	updateTaskInfo := getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, metaData.Md5, metaData.FileLength)
+	updateTaskInfo.RealSha256 = metaData.RealSha256
+	return true, updateTaskInfo, re.reportPiecesStatus(ctx, taskID, pieceMd5s)
 }
 
-func (re *reporter) processCacheByReadFile(ctx context.Context, taskID string, metaData *fileMetaData, breakNum int) (hash.Hash, *types.TaskInfo, error) {
+func (re *reporter) processCacheByReadFile(ctx context.Context, taskID string, metaData *fileMetaData, breakNum int) (hash.Hash, hash.Hash, *types.TaskInfo, error) {
 	var calculateFileMd5 = true
-	if breakNum == -1 && !stringutils.IsEmptyStr(metaData.RealMd5) {
+	if breakNum == -1 && !stringutils.IsEmptyStr(metaData.RealMd5) && !stringutils.IsEmptyStr(metaData.RealSha256) {
 		calculateFileMd5 = false
 	}
 
@@ -113,42 +118,53 @@ func (re *reporter) processCacheByReadFile(ctx context.Context, taskID string, m
 	reader, err := re.cacheStore.Get(ctx, getDownloadRawFunc(taskID))
 	if err != nil {
 		logrus.Errorf("failed to read key file taskID(%s): %v", taskID, err)
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	if breakNum > 0 {
+		// only the leading pieces before breakNum are reused,
+		// and the following ones may be written partially.
+		reader = io.LimitReader(reader, int64(breakNum)*int64(metaData.PieceSize))
 	}
 	result, err := cacheReader.readFile(ctx, reader, true, calculateFileMd5)
 	if err != nil {
 		logrus.Errorf("failed to read cache file taskID(%s): %v", taskID, err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	logrus.Infof("success to get cache result: %+v by read file", result)
 
 	if err := re.reportPiecesStatus(ctx, taskID, result.pieceMd5s); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if breakNum != -1 {
-		return result.fileMd5, nil, nil
+		return result.fileMd5, result.fileSha256, nil, nil
 	}
 
 	fileMd5Value := metaData.RealMd5
 	if stringutils.IsEmptyStr(fileMd5Value) {
 		fileMd5Value = fileutils.GetMd5Sum(result.fileMd5, nil)
 	}
+	fileSha256Value := metaData.RealSha256
+	if stringutils.IsEmptyStr(fileSha256Value) {
+		fileSha256Value = hex.EncodeToString(result.fileSha256.Sum(nil))
+	}
 
 	fmd := &fileMetaData{
 		Finish:     true,
 		Success:    true,
 		RealMd5:    fileMd5Value,
+		RealSha256: fileSha256Value,
 		FileLength: result.fileLength,
 	}
 	if err := re.metaDataManager.updateStatusAndResult(ctx, taskID, fmd); err != nil {
 		logrus.Errorf("failed to update status and result fileMetaData(%+v) for taskID(%s): %v", fmd, taskID, err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	logrus.Infof("success to update status and result fileMetaData(%+v) for taskID(%s)", fmd, taskID)
 
-	return nil, getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, fileMd5Value, result.fileLength),
-		re.metaDataManager.writePieceMD5s(ctx, taskID, fileMd5Value, result.pieceMd5s)
+	updateTaskInfo := getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, fileMd5Value, result.fileLength)
+	updateTaskInfo.RealSha256 = fileSha256Value
+	return nil, nil, updateTaskInfo, re.metaDataManager.writePieceMD5s(ctx, taskID, fileMd5Value, result.pieceMd5s)
 }
 
 func (re *reporter) reportPiecesStatus(ctx context.Context, taskID string, pieceMd5s []string) error {
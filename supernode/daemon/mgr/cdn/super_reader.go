@@ -19,6 +19,7 @@ package cdn
 import (
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"hash"
@@ -37,6 +38,7 @@ type cdnCacheResult struct {
 	fileLength int64
 	pieceMd5s  []string
 	fileMd5    hash.Hash
+	fileSha256 hash.Hash
 }
 
 type superReader struct{}
@@ -52,8 +54,12 @@ func (sr *superReader) readFile(ctx context.Context, reader io.Reader, calculate
 	if calculatePieceMd5 {
 		pieceMd5 = md5.New()
 	}
+	// the file digests are calculated together
+	var fileDigest io.Writer
 	if calculateFileMd5 {
 		result.fileMd5 = md5.New()
+		result.fileSha256 = sha256.New()
+		fileDigest = io.MultiWriter(result.fileMd5, result.fileSha256)
 	}
 
 	for {
@@ -71,7 +77,7 @@ func (sr *superReader) readFile(ctx context.Context, reader io.Reader, calculate
 		logrus.Debugf("get piece length: %d with count: %d from header", pieceLen, result.pieceCount)
 
 		// read content
-		if err := readContent(reader, pieceLen, pieceMd5, result.fileMd5); err != nil {
+		if err := readContent(reader, pieceLen, pieceMd5, fileDigest); err != nil {
 			logrus.Errorf("failed to read content for count %d: %v", result.pieceCount, err)
 			return result, err
 		}
@@ -112,7 +118,7 @@ func readHeader(reader io.Reader, pieceMd5 hash.Hash) (uint32, error) {
 	return binary.BigEndian.Uint32(header), nil
 }
 
-func readContent(reader io.Reader, pieceLen int32, pieceMd5 hash.Hash, fileMd5 hash.Hash) error {
+func readContent(reader io.Reader, pieceLen int32, pieceMd5 hash.Hash, fileMd5 io.Writer) error {
 	bufSize := int32(256 * 1024)
 	if pieceLen < bufSize {
 		bufSize = pieceLen
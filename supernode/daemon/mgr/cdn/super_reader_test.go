@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 
@@ -64,6 +65,10 @@ func (s *SuperReaderTestSuite) TestReadFile(c *check.C) {
 	md5Init.Write(testStr1)
 	md5Init.Write(testStr2)
 	c.Check(fileutils.GetMd5Sum(md5Init, nil), check.Equals, fileutils.GetMd5Sum(result.fileMd5, nil))
+	sha256Init := sha256.New()
+	sha256Init.Write(testStr1)
+	sha256Init.Write(testStr2)
+	c.Check(result.fileSha256.Sum(nil), check.DeepEquals, sha256Init.Sum(nil))
 }
 
 func (s *SuperReaderTestSuite) TestGetMD5ByReadFile(c *check.C) {
@@ -46,6 +46,20 @@ type downloadMetadata struct {
 type superWriter struct {
 	cdnStore    *store.Store
 	cdnReporter *reporter
+
+	// dedup is nil if the dedup of pieces is disabled.
+	dedup *pieceDedup
+
+	// hashWorkers is the max number of the writers of a task,
+	// which hash the pieces concurrently.
+	hashWorkers int
+
+	// preallocate indicates whether to allocate the disk space of
+	// the task file before writing the pieces.
+	preallocate bool
+
+	// verifyWrite indicates whether to read back the pieces after they're written.
+	verifyWrite bool
 }
 
 func newSuperWriter(cdnStore *store.Store, cdnReporter *reporter) *superWriter {
@@ -70,11 +84,19 @@ func (cw *superWriter) startWriter(ctx context.Context, cfg *config.Config, read
 	buf := make([]byte, pieceContSize)
 	var bb = &bytes.Buffer{}
 
+	if cw.preallocate {
+		cw.preallocateFile(ctx, task, realFileLength, httpFileLength, pieceContSize)
+	}
+
 	// start writer pool
-	routineCount := calculateRoutineCount(httpFileLength, task.PieceSize)
+	routineCount := calculateRoutineCount(httpFileLength, task.PieceSize, cw.hashWorkers)
 	var wg = &sync.WaitGroup{}
 	jobCh := make(chan *protocolContent)
-	cw.writerPool(ctx, wg, routineCount, jobCh)
+	var writeErr error
+	var once sync.Once
+	cw.writerPool(ctx, wg, routineCount, jobCh, func(err error) {
+		once.Do(func() { writeErr = err })
+	})
 
 	for {
 		n, e := reader.Read(buf)
@@ -135,6 +157,10 @@ func (cw *superWriter) startWriter(ctx context.Context, cfg *config.Config, read
 
 	close(jobCh)
 	wg.Wait()
+	// the task file can't be served if any piece isn't written
+	if writeErr != nil {
+		return nil, writeErr
+	}
 	return &downloadMetadata{
 		realFileLength:     realFileLength,
 		realHTTPFileLength: realHTTPFileLength,
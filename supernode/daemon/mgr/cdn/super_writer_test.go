@@ -20,11 +20,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 
@@ -79,6 +81,29 @@ func (s *SuperWriterTestSuite) TestStartWriter(c *check.C) {
 	checkFileSize(s.writer.cdnStore, task.ID, expectedSize, c)
 }
 
+func (s *SuperWriterTestSuite) TestStartWriterWithPreallocate(c *check.C) {
+	var pieceContSize = int32(10)
+	var pieceSize = pieceContSize + config.PieceWrapSize
+
+	testStr := "hello dragonfly"
+	var httpFileLen = int64(len(testStr))
+
+	task := &types.TaskInfo{
+		ID:        "5826501cbcc3bb92f0b645918c5a4b15495a63259e3e0363008f97e186509e9e",
+		PieceSize: pieceSize,
+	}
+
+	pieceCount := (httpFileLen + int64(pieceContSize-1)) / int64(pieceContSize)
+	expectedSize := httpFileLen + pieceCount*int64(config.PieceWrapSize)
+
+	writer := newSuperWriter(s.writer.cdnStore, nil)
+	writer.preallocate = true
+	downloadMetadata, err := writer.startWriter(context.TODO(), nil, strings.NewReader(testStr), task, 0, httpFileLen, pieceContSize)
+	c.Check(err, check.IsNil)
+	c.Check(downloadMetadata.realFileLength, check.Equals, expectedSize)
+	checkFileSize(s.writer.cdnStore, task.ID, expectedSize, c)
+}
+
 func (s *SuperWriterTestSuite) TestWriteToFile(c *check.C) {
 	var pieceContSize = int32(15)
 	var pieceSize = pieceContSize + config.PieceWrapSize
@@ -98,6 +123,44 @@ func (s *SuperWriterTestSuite) TestWriteToFile(c *check.C) {
 	checkFileSize(s.writer.cdnStore, task.ID, int64(pieceSize), c)
 }
 
+// corruptingStorage is a local storage which drops the last byte of the data put.
+type corruptingStorage struct {
+	store.StorageDriver
+}
+
+func (cs *corruptingStorage) Put(ctx context.Context, raw *store.Raw, data io.Reader) error {
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	return cs.StorageDriver.Put(ctx, raw, bytes.NewReader(b[:len(b)-1]))
+}
+
+func (s *SuperWriterTestSuite) TestStartWriterWithVerifyWrite(c *check.C) {
+	var pieceContSize = int32(10)
+	var pieceSize = pieceContSize + config.PieceWrapSize
+	testStr := "hello dragonfly"
+
+	task := &types.TaskInfo{
+		ID:        "5836501cbcc3bb92f0b645918c5a4b15495a63259e3e0363008f97e186509e9e",
+		PieceSize: pieceSize,
+	}
+	writer := newSuperWriter(s.writer.cdnStore, nil)
+	writer.verifyWrite = true
+	_, err := writer.startWriter(context.TODO(), nil, strings.NewReader(testStr), task, 0, int64(len(testStr)), pieceContSize)
+	c.Check(err, check.IsNil)
+
+	corrupting, err := store.NewStore(store.LocalStorageDriver, func(conf string) (store.StorageDriver, error) {
+		driver, err := store.NewLocalStorage(conf)
+		return &corruptingStorage{driver}, err
+	}, s.config)
+	c.Assert(err, check.IsNil)
+	writer = newSuperWriter(corrupting, nil)
+	writer.verifyWrite = true
+	_, err = writer.startWriter(context.TODO(), nil, strings.NewReader(testStr), task, 0, int64(len(testStr)), pieceContSize)
+	c.Check(errortypes.IsShortWrite(err), check.Equals, true)
+}
+
 func checkFileSize(cdnStore *store.Store, taskID string, expectedSize int64, c *check.C) {
 	storageInfo, err := cdnStore.Stat(context.TODO(), &store.Raw{
 		Bucket: config.DownloadHome,
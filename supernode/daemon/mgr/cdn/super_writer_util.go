@@ -21,18 +21,27 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/binary"
+	"fmt"
 	"hash"
 	"sync"
 
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-func calculateRoutineCount(httpFileLength int64, pieceSize int32) int {
-	routineSize := config.CDNWriterRoutineLimit
+// calculateRoutineCount returns the number of the writers of a task, which is
+// no more than the limit and the number of its pieces.
+func calculateRoutineCount(httpFileLength int64, pieceSize int32, limit int) int {
+	routineSize := limit
+	if routineSize <= 0 {
+		routineSize = config.CDNWriterRoutineLimit
+	}
 	if httpFileLength < 0 || pieceSize <= 0 {
 		return routineSize
 	}
@@ -52,7 +61,9 @@ func calculateRoutineCount(httpFileLength int64, pieceSize int32) int {
 	return routineSize
 }
 
-func (cw *superWriter) writerPool(ctx context.Context, wg *sync.WaitGroup, n int, jobCh chan *protocolContent) {
+// writerPool starts n writers which write the pieces from the jobCh,
+// and onError is called with the errors of writing the pieces.
+func (cw *superWriter) writerPool(ctx context.Context, wg *sync.WaitGroup, n int, jobCh chan *protocolContent, onError func(error)) {
 	for i := 0; i < n; i++ {
 		wg.Add(1)
 		go func(i int) {
@@ -60,7 +71,7 @@ func (cw *superWriter) writerPool(ctx context.Context, wg *sync.WaitGroup, n int
 				var pieceMd5 = md5.New()
 				if err := cw.writeToFile(ctx, job.pieceContent, job.taskID, job.pieceNum, job.pieceContentSize, job.pieceSize, pieceMd5); err != nil {
 					logrus.Errorf("failed to write taskID %s pieceNum %d file: %v", job.taskID, job.pieceNum, err)
-					// NOTE: should we redo the job?
+					onError(errors.Wrapf(err, "write pieceNum %d", job.pieceNum))
 					continue
 				}
 
@@ -68,6 +79,10 @@ func (cw *superWriter) writerPool(ctx context.Context, wg *sync.WaitGroup, n int
 				pieceSum := fileutils.GetMd5Sum(pieceMd5, nil)
 				pieceMd5Value := getPieceMd5Value(pieceSum, job.pieceContentSize+config.PieceWrapSize)
 				if cw.cdnReporter != nil {
+					// persist the progress to resume the fetch after supernode restarts
+					if err := cw.cdnReporter.metaDataManager.writePieceProgress(ctx, job.taskID, job.pieceNum, pieceMd5Value); err != nil {
+						logrus.Warnf("failed to record the progress of taskID %s pieceNum %d: %v", job.taskID, job.pieceNum, err)
+					}
 					if err := cw.cdnReporter.reportPieceStatus(ctx, job.taskID, job.pieceNum, pieceMd5Value, config.PieceSUCCESS); err != nil {
 						// NOTE: should we do this job again?
 						logrus.Errorf("failed to report piece status taskID %s pieceNum %d pieceMD5 %s: %v", job.taskID, job.pieceNum, pieceMd5Value, err)
@@ -80,6 +95,30 @@ func (cw *superWriter) writerPool(ctx context.Context, wg *sync.WaitGroup, n int
 	}
 }
 
+// preallocateFile allocates the disk space of the pieces of the task which start
+// at the offset, and does nothing if the file length is unknown.
+func (cw *superWriter) preallocateFile(ctx context.Context, task *types.TaskInfo, offset, httpFileLength int64, pieceContSize int32) {
+	if httpFileLength <= 0 || pieceContSize <= 0 {
+		return
+	}
+	pieceCount := (httpFileLength + int64(pieceContSize-1)) / int64(pieceContSize)
+	length := httpFileLength + pieceCount*int64(config.PieceWrapSize) - offset
+	if length <= 0 {
+		return
+	}
+
+	raw := getDownloadRawFunc(task.ID)
+	raw.Offset = offset
+	raw.Length = length
+	if err := cw.cdnStore.Preallocate(ctx, raw); err != nil {
+		if store.IsNotSupported(err) {
+			logrus.Debugf("skip preallocating the file of taskID %s: %v", task.ID, err)
+			return
+		}
+		logrus.Warnf("failed to preallocate %d bytes of the file of taskID %s: %v", length, task.ID, err)
+	}
+}
+
 // writeToFile wraps the piece content with piece header and tailer,
 // and then writes to the storage.
 func (cw *superWriter) writeToFile(ctx context.Context, bytesBuffer *bytes.Buffer, taskID string, pieceNum int, pieceContSize, pieceSize int32, pieceMd5 hash.Hash) error {
@@ -112,11 +151,53 @@ func (cw *superWriter) writeToFile(ctx context.Context, bytesBuffer *bytes.Buffe
 		}
 		pieceMd5.Write(tailer)
 	}
-	// write to the storage
-	return cw.cdnStore.Put(ctx, &store.Raw{
+	raw := &store.Raw{
 		Bucket: config.DownloadHome,
 		Key:    getDownloadKey(taskID),
 		Offset: int64(pieceNum) * int64(pieceSize),
 		Length: int64(pieceContSize) + config.PieceWrapSize,
-	}, resultBuf)
+	}
+	deduped, blob := cw.dedup.write(ctx, raw, resultBuf.Bytes())
+	if deduped {
+		return nil
+	}
+
+	// write to the storage
+	if err := cw.putPiece(ctx, raw, resultBuf.Bytes()); err != nil {
+		return err
+	}
+	cw.dedup.share(ctx, raw, blob)
+	return nil
+}
+
+// putPiece writes the data of a piece to the storage, and it's retried if the data
+// isn't written as it is. ErrShortWrite is returned if it fails after all attempts.
+func (cw *superWriter) putPiece(ctx context.Context, raw *store.Raw, data []byte) (err error) {
+	for attempt := 1; attempt <= config.CDNPieceWriteAttempts; attempt++ {
+		if err = cw.cdnStore.Put(ctx, raw, bytes.NewReader(data)); err == nil {
+			if !cw.verifyWrite {
+				return nil
+			}
+			err = cw.verifyPiece(ctx, raw, data)
+			if err == nil {
+				return nil
+			}
+		}
+		logrus.Warnf("failed to write %d bytes at offset %d of key %s (%d/%d): %v",
+			len(data), raw.Offset, raw.Key, attempt, config.CDNPieceWriteAttempts, err)
+	}
+	return errors.Wrapf(errortypes.ErrShortWrite, "%d bytes at offset %d of key %s: %v",
+		len(data), raw.Offset, raw.Key, err)
+}
+
+// verifyPiece reads the data of a piece back from the storage and compares it with the written one.
+func (cw *superWriter) verifyPiece(ctx context.Context, raw *store.Raw, data []byte) error {
+	written, err := cw.cdnStore.GetBytes(ctx, raw)
+	if err != nil {
+		return errors.Wrap(err, "read back")
+	}
+	if !bytes.Equal(written, data) {
+		return fmt.Errorf("the %d bytes read back differ from the written ones", len(written))
+	}
+	return nil
 }
@@ -19,17 +19,23 @@ package mgr
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-type CDNBuilder func(cfg *config.Config, cacheStore *store.Store, progressManager ProgressMgr,
-	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (CDNMgr, error)
+// CDNBuilder creates a CDNMgr. The metaStore is used to persist the metadata
+// of tasks and it's nil when the persistence is disabled. The contributionManager
+// accounts the bytes fetched from the source.
+type CDNBuilder func(cfg *config.Config, cacheStore *store.Store, metaStore *metastore.Store, progressManager ProgressMgr,
+	contributionManager ContributionMgr, originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (CDNMgr, error)
 
 var cdnBuilderMap = make(map[config.CDNPattern]CDNBuilder)
 
@@ -37,8 +43,8 @@ func Register(name config.CDNPattern, builder CDNBuilder) {
 	cdnBuilderMap[name] = builder
 }
 
-func GetCDNManager(cfg *config.Config, cacheStore *store.Store, progressManager ProgressMgr,
-	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (CDNMgr, error) {
+func GetCDNManager(cfg *config.Config, cacheStore *store.Store, metaStore *metastore.Store, progressManager ProgressMgr,
+	contributionManager ContributionMgr, originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (CDNMgr, error) {
 	name := cfg.CDNPattern
 	if name == "" {
 		name = config.CDNPatternLocal
@@ -49,7 +55,7 @@ func GetCDNManager(cfg *config.Config, cacheStore *store.Store, progressManager
 		return nil, fmt.Errorf("unexpected cdn pattern(%s) which must be in [\"local\", \"source\"]", name)
 	}
 
-	return cdnBuilder(cfg, cacheStore, progressManager, originClient, register)
+	return cdnBuilder(cfg, cacheStore, metaStore, progressManager, contributionManager, originClient, register)
 }
 
 // CDNMgr as an interface defines all operations against CDN and
@@ -65,6 +71,10 @@ type CDNMgr interface {
 	// In addition, it's not thread-safe.
 	TriggerCDN(ctx context.Context, taskInfo *types.TaskInfo) (*types.TaskInfo, error)
 
+	// UpdatePriority raises the priority of the running CDN download of taskID,
+	// which decides the share of the origin bandwidth it takes.
+	UpdatePriority(ctx context.Context, taskID string, priority types.Priority) error
+
 	// GetHTTPPath returns the http download path of taskID.
 	GetHTTPPath(ctx context.Context, taskInfo *types.TaskInfo) (path string, err error)
 
@@ -73,17 +83,39 @@ type CDNMgr interface {
 
 	// GetGCTaskIDs returns the taskIDs that should exec GC operations as a string slice.
 	//
-	// It should return nil when the free disk of cdn storage is lager than config.YoungGCThreshold.
+	// It should return nil when the free disk of cdn storage is lager than config.YoungGCThreshold,
+	// unless preemptive is true, which means the free disk is forecasted to drop below it soon.
 	// It should return all taskIDs that are not running when the free disk of cdn storage is less than config.FullGCThreshold.
-	GetGCTaskIDs(ctx context.Context, taskMgr TaskMgr) ([]string, error)
+	GetGCTaskIDs(ctx context.Context, taskMgr TaskMgr, preemptive bool) ([]string, error)
+
+	// GetAvailSpace returns the free disk of cdn storage.
+	GetAvailSpace(ctx context.Context) (fileutils.Fsize, error)
 
 	// GetPieceMD5 gets the piece Md5 accorrding to the specified taskID and pieceNum.
 	GetPieceMD5(ctx context.Context, taskID string, pieceNum int, pieceRange, source string) (pieceMd5 string, err error)
 
+	// GetPieceMD5s gets the md5 of all pieces of the task whose CDN has finished successfully.
+	GetPieceMD5s(ctx context.Context, taskID string) (pieceMD5s []string, err error)
+
+	// StartScan scans the cached files in the background after supernode starts,
+	// and removes the inconsistent ones which can't be reused.
+	StartScan(ctx context.Context)
+
+	// GetScanStatus returns the progress of the scan of the cached files.
+	GetScanStatus(ctx context.Context) *types.CacheScanStatus
+
 	// CheckFile checks the file whether exists.
 	CheckFile(ctx context.Context, taskID string) bool
 
 	// Delete the cdn meta with specified taskID.
 	// The file on the disk will be deleted when the force is true.
 	Delete(ctx context.Context, taskID string, force bool) error
+
+	// ExportBundle writes the cached file of the task with its metadata and
+	// signature to w as a bundle, which can be imported by another supernode.
+	ExportBundle(ctx context.Context, task *types.TaskInfo, w io.Writer) error
+
+	// ImportBundle verifies the bundle read from r and stores the cached file in it,
+	// and then returns the task described by the bundle.
+	ImportBundle(ctx context.Context, r io.Reader) (*types.TaskInfo, error)
 }
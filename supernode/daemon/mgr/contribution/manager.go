@@ -0,0 +1,304 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package contribution
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ mgr.ContributionMgr = &Manager{}
+
+type metrics struct {
+	sourceBytes    *prometheus.CounterVec
+	deliveredBytes *prometheus.CounterVec
+}
+
+func newMetrics(register prometheus.Registerer) *metrics {
+	return &metrics{
+		sourceBytes: metricsutils.NewCounter(config.SubsystemSupernode, "source_fetched_bytes_total",
+			"Total bytes fetched from the source by CDN and the nodes downloading from the source directly", []string{}, register),
+
+		deliveredBytes: metricsutils.NewCounter(config.SubsystemSupernode, "delivered_bytes_total",
+			"Total bytes downloaded by the nodes", []string{}, register),
+	}
+}
+
+type taskStat struct {
+	uploaded   int64
+	downloaded int64
+
+	// lastReported is the uploaded bytes of the task reported by the last heart beat,
+	// which is used to calculate the increment of the next one.
+	lastReported int64
+}
+
+// savingStat is the bytes fetched from the source against the ones delivered to the nodes.
+type savingStat struct {
+	source    int64
+	delivered int64
+}
+
+type nodeStat struct {
+	uploaded   int64
+	downloaded int64
+	tasks      map[string]*taskStat
+}
+
+// Manager is an implementation of the interface of ContributionMgr.
+type Manager struct {
+	sync.RWMutex
+
+	nodes map[string]*nodeStat
+
+	// savings is the total bandwidth savings and taskSavings is that of every task.
+	savings     savingStat
+	taskSavings map[string]*savingStat
+	metrics     *metrics
+}
+
+// NewManager returns a new Manager.
+func NewManager(register prometheus.Registerer) (*Manager, error) {
+	return &Manager{
+		nodes:       make(map[string]*nodeStat),
+		taskSavings: make(map[string]*savingStat),
+		metrics:     newMetrics(register),
+	}, nil
+}
+
+// ReportUploaded records the total bytes of every task that the uploader on the node
+// has uploaded since it started.
+// A value less than the last reported one means that the uploader has been restarted,
+// and then the whole value is treated as the increment.
+func (m *Manager) ReportUploaded(ctx context.Context, ip string, taskUploadedBytes map[string]int64) {
+	if ip == "" || len(taskUploadedBytes) == 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	node := m.getOrCreateNode(ip)
+	for taskID, total := range taskUploadedBytes {
+		if total <= 0 {
+			continue
+		}
+		task := node.getOrCreateTask(taskID)
+		delta := total - task.lastReported
+		if delta < 0 {
+			delta = total
+		}
+		task.lastReported = total
+		task.uploaded += delta
+		node.uploaded += delta
+	}
+}
+
+// ReportDownloaded records the bytes of a task that the node has downloaded from the p2p network.
+func (m *Manager) ReportDownloaded(ctx context.Context, ip, taskID string, bytes int64) {
+	if ip == "" || taskID == "" || bytes <= 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	node := m.getOrCreateNode(ip)
+	node.getOrCreateTask(taskID).downloaded += bytes
+	node.downloaded += bytes
+	m.addDelivered(taskID, bytes)
+}
+
+// ReportSourceFetched records the bytes of a task that CDN has fetched from the source.
+func (m *Manager) ReportSourceFetched(ctx context.Context, taskID string, bytes int64) {
+	if taskID == "" || bytes <= 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.addSource(taskID, bytes)
+}
+
+// ReportBacksourced records the bytes of a task that the node has downloaded
+// from the source directly, which are both fetched from the source and
+// delivered to the node, but not counted as the contribution of the node.
+func (m *Manager) ReportBacksourced(ctx context.Context, taskID string, bytes int64) {
+	if taskID == "" || bytes <= 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.addSource(taskID, bytes)
+	m.addDelivered(taskID, bytes)
+}
+
+// GetSavings returns the bandwidth savings globally and of every task sorted by taskID.
+func (m *Manager) GetSavings(ctx context.Context) *types.BandwidthSavings {
+	m.RLock()
+	defer m.RUnlock()
+
+	result := &types.BandwidthSavings{
+		SourceBytes:    m.savings.source,
+		DeliveredBytes: m.savings.delivered,
+		SavedBytes:     m.savings.delivered - m.savings.source,
+		Tasks:          make([]*types.TaskBandwidthSavings, 0, len(m.taskSavings)),
+	}
+	if result.DeliveredBytes > 0 {
+		result.Ratio = float64(result.SavedBytes) / float64(result.DeliveredBytes)
+	}
+
+	for taskID, saving := range m.taskSavings {
+		result.Tasks = append(result.Tasks, &types.TaskBandwidthSavings{
+			TaskID:         taskID,
+			SourceBytes:    saving.source,
+			DeliveredBytes: saving.delivered,
+			SavedBytes:     saving.delivered - saving.source,
+		})
+	}
+	sort.Slice(result.Tasks, func(i, j int) bool {
+		return result.Tasks[i].TaskID < result.Tasks[j].TaskID
+	})
+	return result
+}
+
+// Get returns the contribution statistics of the node.
+func (m *Manager) Get(ctx context.Context, ip string) (*types.NodeContribution, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	node, ok := m.nodes[ip]
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "contribution of node %s", ip)
+	}
+	return node.toContribution(ip), nil
+}
+
+// List returns the contribution statistics of all nodes,
+// the free-riders come first and then the nodes with lower ratio,
+// and the nodes which have never downloaded anything come last.
+func (m *Manager) List(ctx context.Context) []*types.NodeContribution {
+	m.RLock()
+	result := make([]*types.NodeContribution, 0, len(m.nodes))
+	for ip, node := range m.nodes {
+		result = append(result, node.toContribution(ip))
+	}
+	m.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].FreeRider != result[j].FreeRider {
+			return result[i].FreeRider
+		}
+		if di, dj := result[i].DownloadedBytes > 0, result[j].DownloadedBytes > 0; di != dj {
+			return di
+		}
+		if result[i].Ratio != result[j].Ratio {
+			return result[i].Ratio < result[j].Ratio
+		}
+		return result[i].IP < result[j].IP
+	})
+	return result
+}
+
+// DeleteTask deletes the per-task statistics of the task from all nodes
+// and the bandwidth savings of the task.
+func (m *Manager) DeleteTask(ctx context.Context, taskID string) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, node := range m.nodes {
+		delete(node.tasks, taskID)
+	}
+	delete(m.taskSavings, taskID)
+}
+
+func (m *Manager) addSource(taskID string, bytes int64) {
+	m.getOrCreateSaving(taskID).source += bytes
+	m.savings.source += bytes
+	m.metrics.sourceBytes.WithLabelValues().Add(float64(bytes))
+}
+
+func (m *Manager) addDelivered(taskID string, bytes int64) {
+	m.getOrCreateSaving(taskID).delivered += bytes
+	m.savings.delivered += bytes
+	m.metrics.deliveredBytes.WithLabelValues().Add(float64(bytes))
+}
+
+func (m *Manager) getOrCreateSaving(taskID string) *savingStat {
+	saving, ok := m.taskSavings[taskID]
+	if !ok {
+		saving = &savingStat{}
+		m.taskSavings[taskID] = saving
+	}
+	return saving
+}
+
+func (m *Manager) getOrCreateNode(ip string) *nodeStat {
+	node, ok := m.nodes[ip]
+	if !ok {
+		node = &nodeStat{tasks: make(map[string]*taskStat)}
+		m.nodes[ip] = node
+	}
+	return node
+}
+
+func (n *nodeStat) getOrCreateTask(taskID string) *taskStat {
+	task, ok := n.tasks[taskID]
+	if !ok {
+		task = &taskStat{}
+		n.tasks[taskID] = task
+	}
+	return task
+}
+
+func (n *nodeStat) toContribution(ip string) *types.NodeContribution {
+	c := &types.NodeContribution{
+		IP:              ip,
+		UploadedBytes:   n.uploaded,
+		DownloadedBytes: n.downloaded,
+		FreeRider:       n.downloaded > 0 && n.uploaded == 0,
+		Tasks:           make([]*types.TaskContribution, 0, len(n.tasks)),
+	}
+	if n.downloaded > 0 {
+		c.Ratio = float64(n.uploaded) / float64(n.downloaded)
+	}
+
+	for taskID, task := range n.tasks {
+		c.Tasks = append(c.Tasks, &types.TaskContribution{
+			TaskID:          taskID,
+			UploadedBytes:   task.uploaded,
+			DownloadedBytes: task.downloaded,
+		})
+	}
+	sort.Slice(c.Tasks, func(i, j int) bool {
+		return c.Tasks[i].TaskID < c.Tasks[j].TaskID
+	})
+	return c
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package contribution
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&ContributionMgrTestSuite{})
+}
+
+type ContributionMgrTestSuite struct{}
+
+func (s *ContributionMgrTestSuite) TestReport(c *check.C) {
+	ctx := context.Background()
+	manager, _ := NewManager(prometheus.NewRegistry())
+
+	manager.ReportDownloaded(ctx, "1.1.1.1", "foo", 100)
+	manager.ReportUploaded(ctx, "1.1.1.1", map[string]int64{"foo": 50})
+	manager.ReportUploaded(ctx, "1.1.1.1", map[string]int64{"foo": 80, "bar": 20})
+	// the uploader has been restarted
+	manager.ReportUploaded(ctx, "1.1.1.1", map[string]int64{"foo": 10})
+
+	contribution, err := manager.Get(ctx, "1.1.1.1")
+	c.Assert(err, check.IsNil)
+	c.Check(contribution.UploadedBytes, check.Equals, int64(110))
+	c.Check(contribution.DownloadedBytes, check.Equals, int64(100))
+	c.Check(contribution.Ratio, check.Equals, 1.1)
+	c.Check(contribution.FreeRider, check.Equals, false)
+	c.Assert(contribution.Tasks, check.HasLen, 2)
+	c.Check(contribution.Tasks[0].TaskID, check.Equals, "bar")
+	c.Check(contribution.Tasks[0].UploadedBytes, check.Equals, int64(20))
+	c.Check(contribution.Tasks[1].UploadedBytes, check.Equals, int64(90))
+	c.Check(contribution.Tasks[1].DownloadedBytes, check.Equals, int64(100))
+
+	manager.DeleteTask(ctx, "foo")
+	contribution, err = manager.Get(ctx, "1.1.1.1")
+	c.Assert(err, check.IsNil)
+	c.Check(contribution.UploadedBytes, check.Equals, int64(110))
+	c.Check(contribution.Tasks, check.HasLen, 1)
+
+	_, err = manager.Get(ctx, "2.2.2.2")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *ContributionMgrTestSuite) TestList(c *check.C) {
+	ctx := context.Background()
+	manager, _ := NewManager(prometheus.NewRegistry())
+
+	manager.ReportUploaded(ctx, "1.1.1.1", map[string]int64{"foo": 100})
+	manager.ReportDownloaded(ctx, "2.2.2.2", "foo", 100)
+	manager.ReportUploaded(ctx, "3.3.3.3", map[string]int64{"foo": 300})
+	manager.ReportDownloaded(ctx, "3.3.3.3", "foo", 100)
+	manager.ReportUploaded(ctx, "4.4.4.4", map[string]int64{"foo": 50})
+	manager.ReportDownloaded(ctx, "4.4.4.4", "foo", 100)
+	manager.ReportDownloaded(ctx, "5.5.5.5", "foo", 200)
+
+	var ips []string
+	for _, contribution := range manager.List(ctx) {
+		ips = append(ips, contribution.IP)
+	}
+	c.Check(ips, check.DeepEquals, []string{"2.2.2.2", "5.5.5.5", "4.4.4.4", "3.3.3.3", "1.1.1.1"})
+}
+
+func (s *ContributionMgrTestSuite) TestSavings(c *check.C) {
+	ctx := context.Background()
+	manager, _ := NewManager(prometheus.NewRegistry())
+
+	savings := manager.GetSavings(ctx)
+	c.Check(savings.Ratio, check.Equals, 0.0)
+	c.Check(savings.Tasks, check.HasLen, 0)
+
+	manager.ReportSourceFetched(ctx, "foo", 100)
+	manager.ReportDownloaded(ctx, "1.1.1.1", "foo", 100)
+	manager.ReportDownloaded(ctx, "2.2.2.2", "foo", 100)
+	manager.ReportDownloaded(ctx, "3.3.3.3", "foo", 100)
+	manager.ReportBacksourced(ctx, "foo", 100)
+	manager.ReportSourceFetched(ctx, "bar", 100)
+
+	savings = manager.GetSavings(ctx)
+	c.Check(savings.SourceBytes, check.Equals, int64(300))
+	c.Check(savings.DeliveredBytes, check.Equals, int64(400))
+	c.Check(savings.SavedBytes, check.Equals, int64(100))
+	c.Check(savings.Ratio, check.Equals, 0.25)
+	c.Check(savings.Tasks, check.DeepEquals, []*types.TaskBandwidthSavings{
+		{TaskID: "bar", SourceBytes: 100, SavedBytes: -100},
+		{TaskID: "foo", SourceBytes: 200, DeliveredBytes: 400, SavedBytes: 200},
+	})
+
+	// the back-sourced bytes are not the contribution of the node
+	_, err := manager.Get(ctx, "4.4.4.4")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	manager.DeleteTask(ctx, "foo")
+	savings = manager.GetSavings(ctx)
+	c.Check(savings.SavedBytes, check.Equals, int64(100))
+	c.Check(savings.Tasks, check.HasLen, 1)
+}
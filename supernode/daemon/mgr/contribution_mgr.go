@@ -0,0 +1,58 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// ContributionMgr as an interface defines all operations to account the bytes
+// which every node uploads to and downloads from the p2p network, and the bytes
+// fetched from the source against the ones delivered to the nodes.
+type ContributionMgr interface {
+	// ReportUploaded records the total bytes of every task that the uploader on the node
+	// has uploaded since it started, which are reported by heart beats.
+	ReportUploaded(ctx context.Context, ip string, taskUploadedBytes map[string]int64)
+
+	// ReportDownloaded records the bytes of a task that the node has downloaded from the p2p network.
+	ReportDownloaded(ctx context.Context, ip, taskID string, bytes int64)
+
+	// ReportSourceFetched records the bytes of a task that CDN has fetched from the source.
+	ReportSourceFetched(ctx context.Context, taskID string, bytes int64)
+
+	// ReportBacksourced records the bytes of a task that the node has downloaded
+	// from the source directly instead of the p2p network.
+	ReportBacksourced(ctx context.Context, taskID string, bytes int64)
+
+	// GetSavings returns the bytes fetched from the source against the ones
+	// delivered to the nodes, globally and for every task.
+	GetSavings(ctx context.Context) *types.BandwidthSavings
+
+	// Get returns the contribution statistics of the node.
+	Get(ctx context.Context, ip string) (*types.NodeContribution, error)
+
+	// List returns the contribution statistics of all nodes,
+	// the free-riders come first and then the nodes with lower ratio,
+	// and the nodes which have never downloaded anything come last.
+	List(ctx context.Context) []*types.NodeContribution
+
+	// DeleteTask deletes the per-task statistics of the task from all nodes,
+	// and the totals are kept.
+	DeleteTask(ctx context.Context, taskID string)
+}
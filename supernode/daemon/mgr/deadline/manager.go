@@ -0,0 +1,199 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ mgr.DeadlineMgr = &Manager{}
+
+const (
+	extensionGranted  = "granted"
+	extensionRejected = "rejected"
+)
+
+/* the reasons of rejecting an extension */
+const (
+	ReasonNoProgress    = "no progress since the last extension"
+	ReasonLimitExceeded = "the max number of extensions is exceeded"
+)
+
+type metrics struct {
+	extensions *prometheus.CounterVec
+}
+
+func newMetrics(register prometheus.Registerer) *metrics {
+	return &metrics{
+		extensions: metricsutils.NewCounter(config.SubsystemSupernode, "progress_extensions_total",
+			"Total number of the progress extensions requested by the dfget tasks", []string{"result"}, register),
+	}
+}
+
+type entry struct {
+	taskID   string
+	deadline time.Time
+
+	// extensions is the number of the extensions granted since the last piece
+	// downloaded successfully, and completedBytes is the max bytes reported so far.
+	extensions     int
+	completedBytes int64
+}
+
+// Manager is an implementation of the interface of DeadlineMgr.
+type Manager struct {
+	sync.Mutex
+
+	cfg     *config.Config
+	entries map[string]*entry
+	metrics *metrics
+
+	now func() time.Time
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config, register prometheus.Registerer) (*Manager, error) {
+	return &Manager{
+		cfg:     cfg,
+		entries: make(map[string]*entry),
+		metrics: newMetrics(register),
+		now:     time.Now,
+	}, nil
+}
+
+func (m *Manager) enabled() bool {
+	return m.cfg.ClientProgressTimeout > 0
+}
+
+// Track starts to track the progress deadline of the dfget task of cid,
+// and the deadline is ClientProgressTimeout after now.
+func (m *Manager) Track(ctx context.Context, taskID, cid string) {
+	if !m.enabled() {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.entries[cid] = &entry{
+		taskID:   taskID,
+		deadline: m.now().Add(m.cfg.ClientProgressTimeout),
+	}
+}
+
+// Progress pushes back the deadline of the dfget task of cid to ClientProgressTimeout
+// after now, and resets the number of its extensions.
+func (m *Manager) Progress(ctx context.Context, taskID, cid string) {
+	if !m.enabled() {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	e, ok := m.entries[cid]
+	if !ok || e.taskID != taskID {
+		return
+	}
+	if deadline := m.now().Add(m.cfg.ClientProgressTimeout); deadline.After(e.deadline) {
+		e.deadline = deadline
+	}
+	e.extensions = 0
+}
+
+// Extend requests an extension of the deadline of the dfget task of cid.
+// The request is granted without counting an extension if more than half of
+// ClientProgressGrace is left before the deadline. Otherwise the deadline is
+// extended to ClientProgressGrace after now only if completedBytes has grown since
+// the last request and MaxProgressExtensions is not reached.
+func (m *Manager) Extend(ctx context.Context, taskID, cid string, completedBytes int64) (*types.ProgressExtensionResponse, error) {
+	if !m.enabled() {
+		return &types.ProgressExtensionResponse{Granted: true}, nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	e, ok := m.entries[cid]
+	if !ok || e.taskID != taskID {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "progress deadline of cid %s and taskID %s", cid, taskID)
+	}
+
+	progressed := completedBytes > e.completedBytes
+	if progressed {
+		e.completedBytes = completedBytes
+	}
+
+	now := m.now()
+	resp := &types.ProgressExtensionResponse{}
+	switch {
+	case e.deadline.Sub(now) > m.cfg.ClientProgressGrace/2:
+		resp.Granted = true
+	case !progressed:
+		resp.Reason = ReasonNoProgress
+	case e.extensions >= m.cfg.MaxProgressExtensions:
+		resp.Reason = ReasonLimitExceeded
+	default:
+		resp.Granted = true
+		e.deadline = now.Add(m.cfg.ClientProgressGrace)
+		e.extensions++
+	}
+
+	if resp.Granted {
+		m.metrics.extensions.WithLabelValues(extensionGranted).Inc()
+	} else {
+		m.metrics.extensions.WithLabelValues(extensionRejected).Inc()
+	}
+	resp.Deadline = strfmt.DateTime(e.deadline)
+	if remaining := m.cfg.MaxProgressExtensions - e.extensions; remaining > 0 {
+		resp.Remaining = int32(remaining)
+	}
+	return resp, nil
+}
+
+// Expired returns the dfget tasks whose deadlines have passed as a map from cid to taskID,
+// and stops tracking them.
+func (m *Manager) Expired(ctx context.Context) map[string]string {
+	m.Lock()
+	defer m.Unlock()
+
+	now := m.now()
+	expired := make(map[string]string)
+	for cid, e := range m.entries {
+		if now.After(e.deadline) {
+			expired[cid] = e.taskID
+			delete(m.entries, cid)
+		}
+	}
+	return expired
+}
+
+// Untrack stops tracking the progress deadline of the dfget task of cid.
+func (m *Manager) Untrack(ctx context.Context, cid string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.entries, cid)
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&DeadlineMgrTestSuite{})
+}
+
+type DeadlineMgrTestSuite struct{}
+
+func newTestManager(now *time.Time) *Manager {
+	cfg := config.NewConfig()
+	cfg.ClientProgressTimeout = time.Minute
+	cfg.ClientProgressGrace = time.Minute
+	cfg.MaxProgressExtensions = 2
+	manager, _ := NewManager(cfg, prometheus.NewRegistry())
+	manager.now = func() time.Time { return *now }
+	return manager
+}
+
+func (s *DeadlineMgrTestSuite) TestDisabled(c *check.C) {
+	ctx := context.Background()
+	manager, _ := NewManager(config.NewConfig(), prometheus.NewRegistry())
+
+	manager.Track(ctx, "foo", "cid")
+	resp, err := manager.Extend(ctx, "foo", "cid", 100)
+	c.Assert(err, check.IsNil)
+	c.Check(resp.Granted, check.Equals, true)
+	c.Check(time.Time(resp.Deadline).IsZero(), check.Equals, true)
+	c.Check(manager.Expired(ctx), check.HasLen, 0)
+}
+
+func (s *DeadlineMgrTestSuite) TestExtend(c *check.C) {
+	ctx := context.Background()
+	now := time.Now()
+	manager := newTestManager(&now)
+
+	_, err := manager.Extend(ctx, "foo", "cid", 100)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	manager.Track(ctx, "foo", "cid")
+	_, err = manager.Extend(ctx, "bar", "cid", 100)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// far from the deadline, no extension is counted
+	resp, err := manager.Extend(ctx, "foo", "cid", 100)
+	c.Assert(err, check.IsNil)
+	c.Check(resp.Granted, check.Equals, true)
+	c.Check(time.Time(resp.Deadline).Equal(now.Add(time.Minute)), check.Equals, true)
+	c.Check(resp.Remaining, check.Equals, int32(2))
+
+	now = now.Add(50 * time.Second)
+	resp, _ = manager.Extend(ctx, "foo", "cid", 100)
+	c.Check(resp.Granted, check.Equals, false)
+	c.Check(resp.Reason, check.Equals, ReasonNoProgress)
+
+	resp, _ = manager.Extend(ctx, "foo", "cid", 200)
+	c.Check(resp.Granted, check.Equals, true)
+	c.Check(time.Time(resp.Deadline).Equal(now.Add(time.Minute)), check.Equals, true)
+	c.Check(resp.Remaining, check.Equals, int32(1))
+
+	now = now.Add(50 * time.Second)
+	resp, _ = manager.Extend(ctx, "foo", "cid", 300)
+	c.Check(resp.Granted, check.Equals, true)
+	c.Check(resp.Remaining, check.Equals, int32(0))
+
+	now = now.Add(50 * time.Second)
+	resp, _ = manager.Extend(ctx, "foo", "cid", 400)
+	c.Check(resp.Granted, check.Equals, false)
+	c.Check(resp.Reason, check.Equals, ReasonLimitExceeded)
+
+	// a piece downloaded successfully resets the extensions
+	manager.Progress(ctx, "foo", "cid")
+	now = now.Add(50 * time.Second)
+	resp, _ = manager.Extend(ctx, "foo", "cid", 500)
+	c.Check(resp.Granted, check.Equals, true)
+	c.Check(resp.Remaining, check.Equals, int32(1))
+}
+
+func (s *DeadlineMgrTestSuite) TestExpired(c *check.C) {
+	ctx := context.Background()
+	now := time.Now()
+	manager := newTestManager(&now)
+
+	manager.Track(ctx, "foo", "c1")
+	manager.Track(ctx, "foo", "c2")
+	manager.Track(ctx, "bar", "c3")
+	manager.Untrack(ctx, "c3")
+
+	now = now.Add(50 * time.Second)
+	manager.Progress(ctx, "foo", "c2")
+	c.Check(manager.Expired(ctx), check.HasLen, 0)
+
+	now = now.Add(20 * time.Second)
+	c.Check(manager.Expired(ctx), check.DeepEquals, map[string]string{"c1": "foo"})
+	c.Check(manager.Expired(ctx), check.HasLen, 0)
+
+	now = now.Add(time.Minute)
+	c.Check(manager.Expired(ctx), check.DeepEquals, map[string]string{"c2": "foo"})
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// DeadlineMgr as an interface defines all operations to track the progress deadlines
+// of the dfget tasks, and to grant the extensions of the deadlines to the clients
+// which are slow but still make progress.
+type DeadlineMgr interface {
+	// Track starts to track the progress deadline of the dfget task of cid.
+	Track(ctx context.Context, taskID, cid string)
+
+	// Progress pushes back the deadline of the dfget task of cid
+	// when it has downloaded a piece successfully.
+	Progress(ctx context.Context, taskID, cid string)
+
+	// Extend requests an extension of the deadline of the dfget task with the bytes
+	// which the client has downloaded of the task.
+	Extend(ctx context.Context, taskID, cid string, completedBytes int64) (*types.ProgressExtensionResponse, error)
+
+	// Expired returns the dfget tasks whose deadlines have passed as a map from cid to taskID,
+	// and stops tracking them.
+	Expired(ctx context.Context) map[string]string
+
+	// Untrack stops tracking the progress deadline of the dfget task of cid.
+	Untrack(ctx context.Context, cid string)
+}
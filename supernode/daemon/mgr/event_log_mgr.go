@@ -0,0 +1,57 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// TaskEventLog is the log of the events of a download uploaded by dfget when it finishes,
+// such as the schedule waits, the retries and the errors.
+type TaskEventLog struct {
+	// Time is when the log is uploaded.
+	Time   time.Time `json:"time"`
+	TaskID string    `json:"taskID"`
+	CID    string    `json:"cID"`
+	IP     string    `json:"IP"`
+
+	Success          bool   `json:"success"`
+	BacksourceReason string `json:"backsourceReason,omitempty"`
+
+	// Duration is the time in seconds taken by the download.
+	Duration float64 `json:"duration"`
+
+	Events []*types.TaskEvent `json:"events"`
+
+	// Dropped is the number of the events dropped by dfget or supernode
+	// since the log is full.
+	Dropped int32 `json:"dropped,omitempty"`
+}
+
+// EventLogMgr as an interface defines all operations to keep the event logs
+// of the downloads uploaded by dfget.
+type EventLogMgr interface {
+	// Record keeps the event log, the oldest one is evicted if there are too many.
+	Record(ctx context.Context, log *TaskEventLog)
+
+	// Get returns the event logs of the taskID in chronological order.
+	// Only the ones of the client are returned if cid isn't empty.
+	Get(ctx context.Context, taskID, cid string) ([]*TaskEventLog, error)
+}
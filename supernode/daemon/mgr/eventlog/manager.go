@@ -0,0 +1,91 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+var _ mgr.EventLogMgr = &Manager{}
+
+// maxEvents is the max number of the events kept for an event log,
+// which bounds the memory taken by the logs no matter what dfget uploads.
+const maxEvents = 256
+
+// Manager is an implementation of the interface of EventLogMgr.
+// It keeps the latest logs in a ring buffer.
+type Manager struct {
+	sync.RWMutex
+
+	size int
+	logs []*mgr.TaskEventLog
+	next int
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config) (*Manager, error) {
+	return &Manager{size: cfg.EventLogSize}, nil
+}
+
+// Record keeps the event log, the oldest one is evicted if there are too many.
+func (m *Manager) Record(ctx context.Context, log *mgr.TaskEventLog) {
+	if m.size <= 0 || log == nil {
+		return
+	}
+	if n := len(log.Events); n > maxEvents {
+		log.Dropped += int32(n - maxEvents)
+		log.Events = log.Events[:maxEvents]
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if len(m.logs) < m.size {
+		m.logs = append(m.logs, log)
+		return
+	}
+	m.logs[m.next] = log
+	m.next = (m.next + 1) % m.size
+}
+
+// Get returns the event logs of the taskID in chronological order.
+// Only the ones of the client are returned if cid isn't empty.
+func (m *Manager) Get(ctx context.Context, taskID, cid string) ([]*mgr.TaskEventLog, error) {
+	if m.size <= 0 {
+		return nil, errors.Wrap(errortypes.ErrNotInitialized, "event log is disabled")
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	var result []*mgr.TaskEventLog
+	for i := range m.logs {
+		log := m.logs[(m.next+i)%len(m.logs)]
+		if log.TaskID == taskID && (cid == "" || log.CID == cid) {
+			result = append(result, log)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "event log of task %s", taskID)
+	}
+	return result, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&EventLogManagerTestSuite{})
+}
+
+type EventLogManagerTestSuite struct{}
+
+func newManager(size int) *Manager {
+	cfg := config.NewConfig()
+	cfg.EventLogSize = size
+	m, _ := NewManager(cfg)
+	return m
+}
+
+func (s *EventLogManagerTestSuite) TestRecordAndGet(c *check.C) {
+	ctx := context.Background()
+	m := newManager(3)
+
+	_, err := m.Get(ctx, "foo", "")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	for _, cid := range []string{"c1", "c2", "c3", "c4"} {
+		m.Record(ctx, &mgr.TaskEventLog{TaskID: "foo", CID: cid})
+	}
+	m.Record(ctx, &mgr.TaskEventLog{TaskID: "bar", CID: "c1"})
+
+	logs, err := m.Get(ctx, "foo", "")
+	c.Assert(err, check.IsNil)
+	var cids []string
+	for _, l := range logs {
+		cids = append(cids, l.CID)
+	}
+	// the oldest ones are evicted
+	c.Check(cids, check.DeepEquals, []string{"c3", "c4"})
+
+	logs, err = m.Get(ctx, "foo", "c4")
+	c.Assert(err, check.IsNil)
+	c.Check(logs, check.HasLen, 1)
+
+	_, err = m.Get(ctx, "bar", "c2")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *EventLogManagerTestSuite) TestRecordTruncated(c *check.C) {
+	ctx := context.Background()
+	m := newManager(1)
+	events := make([]*types.TaskEvent, maxEvents+10)
+	m.Record(ctx, &mgr.TaskEventLog{TaskID: "foo", Events: events, Dropped: 1})
+
+	logs, err := m.Get(ctx, "foo", "")
+	c.Assert(err, check.IsNil)
+	c.Check(logs[0].Events, check.HasLen, maxEvents)
+	c.Check(logs[0].Dropped, check.Equals, int32(11))
+}
+
+func (s *EventLogManagerTestSuite) TestDisabled(c *check.C) {
+	ctx := context.Background()
+	m := newManager(0)
+	m.Record(ctx, &mgr.TaskEventLog{TaskID: "foo"})
+	_, err := m.Get(ctx, "foo", "")
+	c.Check(errortypes.IsNotInitialized(err), check.Equals, true)
+}
@@ -19,7 +19,10 @@ package gc
 import (
 	"context"
 
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 func (gcm *Manager) gcDfgetTasksWithTaskID(ctx context.Context, taskID string, cids []string) []error {
@@ -71,3 +74,27 @@ func (gcm *Manager) gcDfgetTasks(ctx context.Context, keys map[string]string, ci
 
 	return errSlice
 }
+
+// gcStalledClients kicks the running dfget tasks whose progress deadlines have passed,
+// so that they stop holding the upload slots of the peers. The client finds that
+// it has been kicked when pulling the next piece task.
+func (gcm *Manager) gcStalledClients(ctx context.Context) {
+	var kicked int
+	for cid, taskID := range gcm.deadlineMgr.Expired(ctx) {
+		dfgetTask, err := gcm.dfgetTaskMgr.Get(ctx, cid, taskID)
+		if err != nil {
+			continue
+		}
+		if dfgetTask.Status != types.DfGetTaskStatusWAITING && dfgetTask.Status != types.DfGetTaskStatusRUNNING {
+			continue
+		}
+
+		logrus.Warnf("gc stalled clients: kick dfgetTask(%s) of task(%s) for making no progress", cid, taskID)
+		gcm.gcDfgetTasks(ctx, map[string]string{cid: taskID}, []string{cid})
+		kicked++
+	}
+
+	if kicked > 0 {
+		gcm.metrics.gcStalledCount.WithLabelValues().Add(float64(kicked))
+	}
+}
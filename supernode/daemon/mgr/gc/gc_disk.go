@@ -26,7 +26,8 @@ import (
 )
 
 func (gcm *Manager) gcDisk(ctx context.Context) {
-	gcTaskIDs, err := gcm.cdnMgr.GetGCTaskIDs(ctx, gcm.taskMgr)
+	preemptive := gcm.forecaster != nil && gcm.forecastDisk(ctx)
+	gcTaskIDs, err := gcm.cdnMgr.GetGCTaskIDs(ctx, gcm.taskMgr, preemptive)
 	if err != nil {
 		logrus.Errorf("gc disk: failed to get gc tasks: %v", err)
 		return
@@ -37,6 +38,9 @@ func (gcm *Manager) gcDisk(ctx context.Context) {
 	}
 
 	logrus.Debugf("gc disk: success to get gcTaskIDs(%d)", len(gcTaskIDs))
+	if preemptive {
+		gcm.metrics.gcDisksPreemptiveCount.WithLabelValues().Inc()
+	}
 	gcm.deleteTaskDisk(ctx, gcTaskIDs)
 }
 
@@ -0,0 +1,149 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gc
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/sirupsen/logrus"
+)
+
+// diskSample is the free disk observed at a time.
+type diskSample struct {
+	time time.Time
+	free int64
+}
+
+// storageForecaster estimates the growth rate of the cache from the free disk
+// observed in the window, and forecasts when the free disk drops below a threshold.
+type storageForecaster struct {
+	window  time.Duration
+	samples []diskSample
+}
+
+func newStorageForecaster(window time.Duration) *storageForecaster {
+	return &storageForecaster{window: window}
+}
+
+// observe records the free disk and drops the samples out of the window.
+func (f *storageForecaster) observe(now time.Time, free int64) {
+	f.samples = append(f.samples, diskSample{time: now, free: free})
+	i := 0
+	for i < len(f.samples)-1 && now.Sub(f.samples[i].time) > f.window {
+		i++
+	}
+	f.samples = f.samples[i:]
+}
+
+// rate returns the bytes consumed per second in the window. The increases of
+// the free disk, such as the ones made by the gc, are ignored, so that the rate
+// is the growth rate of the cache rather than the net change of the free disk.
+func (f *storageForecaster) rate() float64 {
+	if len(f.samples) < 2 {
+		return 0
+	}
+	var consumed int64
+	for i := 1; i < len(f.samples); i++ {
+		if d := f.samples[i-1].free - f.samples[i].free; d > 0 {
+			consumed += d
+		}
+	}
+	span := f.samples[len(f.samples)-1].time.Sub(f.samples[0].time).Seconds()
+	if span <= 0 {
+		return 0
+	}
+	return float64(consumed) / span
+}
+
+// forecast returns the duration until the free disk drops below the threshold,
+// with the pending bytes regarded as consumed. It's 0 if the free disk is already
+// below the threshold, and negative if it's not forecasted to drop below it.
+func (f *storageForecaster) forecast(pending, threshold int64) time.Duration {
+	if len(f.samples) == 0 {
+		return -1
+	}
+	left := f.samples[len(f.samples)-1].free - pending - threshold
+	if left <= 0 {
+		return 0
+	}
+	rate := f.rate()
+	if rate <= 0 {
+		return -1
+	}
+	return time.Duration(float64(left) / rate * float64(time.Second))
+}
+
+// forecastDisk observes the free disk and returns whether a young gc should be
+// triggered preemptively, since the free disk is forecasted to drop below
+// YoungGCThreshold within StorageForecastHorizon.
+func (gcm *Manager) forecastDisk(ctx context.Context) bool {
+	free, err := gcm.cdnMgr.GetAvailSpace(ctx)
+	if err != nil {
+		logrus.Debugf("gc disk: failed to get avail space to forecast: %v", err)
+		return false
+	}
+	gcm.forecaster.observe(time.Now(), int64(free))
+	pending := gcm.pendingBytes(ctx)
+
+	young := gcm.forecaster.forecast(pending, int64(gcm.cfg.YoungGCThreshold))
+	full := gcm.forecaster.forecast(pending, int64(gcm.cfg.FullGCThreshold))
+	gcm.metrics.storageForecast.WithLabelValues("young").Set(forecastSeconds(young))
+	gcm.metrics.storageForecast.WithLabelValues("full").Set(forecastSeconds(full))
+
+	horizon := gcm.cfg.StorageForecastHorizon
+	if full >= 0 && full <= horizon {
+		logrus.Warnf("gc disk: free disk %v is forecasted to drop below fullGCThreshold %v in %v, "+
+			"with %d bytes being fetched by cdn", free, gcm.cfg.FullGCThreshold, full, pending)
+	}
+	// the young gc runs anyway once the free disk is below the threshold
+	if young < 0 || young > horizon || free <= gcm.cfg.YoungGCThreshold {
+		return false
+	}
+	logrus.Infof("gc disk: free disk %v is forecasted to drop below youngGCThreshold %v in %v, start gc preemptively",
+		free, gcm.cfg.YoungGCThreshold, young)
+	return true
+}
+
+// pendingBytes returns the total length of the files which are still being fetched by cdn.
+// They're counted with the full lengths though some of them have been written, which
+// makes the forecast a little pessimistic.
+func (gcm *Manager) pendingBytes(ctx context.Context) (pending int64) {
+	tasks, _, err := gcm.taskMgr.List(ctx, &mgr.TaskFilter{
+		CdnStatus: []string{types.TaskInfoCdnStatusWAITING, types.TaskInfoCdnStatusRUNNING},
+	})
+	if err != nil {
+		logrus.Warnf("gc disk: failed to list the tasks being fetched by cdn: %v", err)
+		return 0
+	}
+	for _, task := range tasks {
+		if task.HTTPFileLength > 0 {
+			pending += task.HTTPFileLength
+		}
+	}
+	return pending
+}
+
+func forecastSeconds(d time.Duration) float64 {
+	if d < 0 {
+		return -1
+	}
+	return d.Seconds()
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&ForecastTestSuite{})
+}
+
+type ForecastTestSuite struct{}
+
+// fakeTaskMgr lists the tasks being fetched by cdn, and the other methods of TaskMgr are not used.
+type fakeTaskMgr struct {
+	mgr.TaskMgr
+	tasks []*types.TaskInfo
+}
+
+func (f *fakeTaskMgr) List(ctx context.Context, filter *mgr.TaskFilter) ([]*types.TaskInfo, int, error) {
+	return f.tasks, len(f.tasks), nil
+}
+
+func (s *ForecastTestSuite) TestForecast(c *check.C) {
+	f := newStorageForecaster(time.Minute)
+	c.Check(f.forecast(0, 10), check.Equals, time.Duration(-1))
+
+	now := time.Now()
+	f.observe(now, 1000)
+	c.Check(f.rate(), check.Equals, float64(0))
+	c.Check(f.forecast(0, 100), check.Equals, time.Duration(-1))
+	c.Check(f.forecast(900, 100), check.Equals, time.Duration(0))
+
+	// the space freed by the gc doesn't count against the consumption
+	f.observe(now.Add(10*time.Second), 900)
+	f.observe(now.Add(20*time.Second), 950)
+	f.observe(now.Add(30*time.Second), 750)
+	c.Check(f.rate(), check.Equals, float64(10))
+	c.Check(f.forecast(0, 100), check.Equals, 65*time.Second)
+	c.Check(f.forecast(300, 100), check.Equals, 35*time.Second)
+
+	// the samples out of the window are dropped
+	f.observe(now.Add(100*time.Second), 750)
+	c.Check(f.samples, check.HasLen, 1)
+}
+
+func (s *ForecastTestSuite) TestGCDiskPreemptively(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	cdnMgr := mock.NewMockCDNMgr(ctl)
+	taskMgr := &fakeTaskMgr{tasks: []*types.TaskInfo{{ID: "foo", HTTPFileLength: int64(20 * fileutils.GB)}}}
+
+	cfg := config.NewConfig()
+	cfg.YoungGCThreshold = 100 * fileutils.GB
+	cfg.FullGCThreshold = 5 * fileutils.GB
+	cfg.StorageForecastHorizon = time.Hour
+	gcm, err := NewManager(cfg, taskMgr, nil, nil, nil, cdnMgr, nil, nil, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	c.Assert(gcm.forecaster, check.NotNil)
+	ctx := context.Background()
+
+	// the free disk stays above YoungGCThreshold with the task being fetched
+	cdnMgr.EXPECT().GetAvailSpace(ctx).Return(200*fileutils.GB, nil)
+	cdnMgr.EXPECT().GetGCTaskIDs(ctx, taskMgr, false).Return(nil, nil)
+	gcm.gcDisk(ctx)
+
+	// the free disk is forecasted to drop below YoungGCThreshold after the task is fetched
+	cdnMgr.EXPECT().GetAvailSpace(ctx).Return(110*fileutils.GB, nil)
+	cdnMgr.EXPECT().GetGCTaskIDs(ctx, taskMgr, true).Return(nil, nil)
+	gcm.gcDisk(ctx)
+
+	// the young gc runs anyway once the free disk is below the threshold
+	cdnMgr.EXPECT().GetAvailSpace(ctx).Return(90*fileutils.GB, nil)
+	cdnMgr.EXPECT().GetGCTaskIDs(ctx, taskMgr, false).Return(nil, nil)
+	gcm.gcDisk(ctx)
+
+	cfg.StorageForecastHorizon = 0
+	gcm, err = NewManager(cfg, taskMgr, nil, nil, nil, cdnMgr, nil, nil, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	c.Check(gcm.forecaster, check.IsNil)
+}
@@ -35,6 +35,10 @@ type metrics struct {
 	gcPeersCount    *prometheus.CounterVec
 	gcDisksCount    *prometheus.CounterVec
 	lastGCDisksTime *prometheus.GaugeVec
+	gcStalledCount  *prometheus.CounterVec
+
+	gcDisksPreemptiveCount *prometheus.CounterVec
+	storageForecast        *prometheus.GaugeVec
 }
 
 func newMetrics(register prometheus.Registerer) *metrics {
@@ -50,6 +54,16 @@ func newMetrics(register prometheus.Registerer) *metrics {
 
 		lastGCDisksTime: metricsutils.NewGauge(config.SubsystemSupernode, "last_gc_disks_timestamp_seconds",
 			"Timestamp of the last disk gc", []string{}, register),
+
+		gcStalledCount: metricsutils.NewCounter(config.SubsystemSupernode, "gc_stalled_clients_total",
+			"Total number of dfget tasks that have been kicked for making no progress", []string{}, register),
+
+		gcDisksPreemptiveCount: metricsutils.NewCounter(config.SubsystemSupernode, "gc_disks_preemptive_total",
+			"Total number of the disk gcs triggered by the storage forecast", []string{}, register),
+
+		storageForecast: metricsutils.NewGauge(config.SubsystemSupernode, "storage_forecast_seconds",
+			"Forecasted seconds until the free disk drops below the gc threshold, -1 if it isn't forecasted to",
+			[]string{"threshold"}, register),
 	}
 }
 
@@ -58,26 +72,38 @@ type Manager struct {
 	cfg *config.Config
 
 	// mgr objects
-	taskMgr      mgr.TaskMgr
-	peerMgr      mgr.PeerMgr
-	dfgetTaskMgr mgr.DfgetTaskMgr
-	progressMgr  mgr.ProgressMgr
-	cdnMgr       mgr.CDNMgr
-	metrics      *metrics
+	taskMgr         mgr.TaskMgr
+	peerMgr         mgr.PeerMgr
+	dfgetTaskMgr    mgr.DfgetTaskMgr
+	progressMgr     mgr.ProgressMgr
+	cdnMgr          mgr.CDNMgr
+	contributionMgr mgr.ContributionMgr
+	deadlineMgr     mgr.DeadlineMgr
+	metrics         *metrics
+
+	// forecaster is nil if the free disk is not forecasted.
+	forecaster *storageForecaster
 }
 
 // NewManager returns a new Manager.
 func NewManager(cfg *config.Config, taskMgr mgr.TaskMgr, peerMgr mgr.PeerMgr, dfgetTaskMgr mgr.DfgetTaskMgr,
-	progressMgr mgr.ProgressMgr, cdnMgr mgr.CDNMgr, register prometheus.Registerer) (*Manager, error) {
-	return &Manager{
-		cfg:          cfg,
-		taskMgr:      taskMgr,
-		peerMgr:      peerMgr,
-		dfgetTaskMgr: dfgetTaskMgr,
-		progressMgr:  progressMgr,
-		cdnMgr:       cdnMgr,
-		metrics:      newMetrics(register),
-	}, nil
+	progressMgr mgr.ProgressMgr, cdnMgr mgr.CDNMgr, contributionMgr mgr.ContributionMgr,
+	deadlineMgr mgr.DeadlineMgr, register prometheus.Registerer) (*Manager, error) {
+	gcm := &Manager{
+		cfg:             cfg,
+		taskMgr:         taskMgr,
+		peerMgr:         peerMgr,
+		dfgetTaskMgr:    dfgetTaskMgr,
+		progressMgr:     progressMgr,
+		cdnMgr:          cdnMgr,
+		contributionMgr: contributionMgr,
+		deadlineMgr:     deadlineMgr,
+		metrics:         newMetrics(register),
+	}
+	if cfg.StorageForecastHorizon > 0 && cfg.CDNPattern != config.CDNPatternSource {
+		gcm.forecaster = newStorageForecaster(cfg.StorageForecastWindow)
+	}
+	return gcm, nil
 }
 
 // StartGC starts to do the gc jobs.
@@ -108,6 +134,26 @@ func (gcm *Manager) StartGC(ctx context.Context) {
 		}
 	}()
 
+	// start a goroutine to gc the peers which are dead according to their heart beats
+	if gcm.cfg.PeerDeadTimeout > 0 {
+		go func() {
+			ticker := time.NewTicker(peerStatesInterval)
+			for range ticker.C {
+				gcm.gcDeadPeers(ctx)
+			}
+		}()
+	}
+
+	// start a goroutine to kick the dfget tasks which make no progress before their deadlines
+	if gcm.cfg.ClientProgressTimeout > 0 {
+		go func() {
+			ticker := time.NewTicker(peerStatesInterval)
+			for range ticker.C {
+				gcm.gcStalledClients(ctx)
+			}
+		}()
+	}
+
 	// start a goroutine to gc the disks
 	go func() {
 		// delay to execute GC after gcm.initialDelay
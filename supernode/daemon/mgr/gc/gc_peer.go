@@ -21,7 +21,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
 	"github.com/sirupsen/logrus"
@@ -31,6 +30,9 @@ const (
 	// gcPeersTimeout specifies the timeout for peers gc.
 	// If the actual execution time exceeds this threshold, a warning will be thrown.
 	gcPeersTimeout = 2.0 * time.Second
+
+	// peerStatesInterval is the interval time to update the liveness states of peers.
+	peerStatesInterval = 5 * time.Second
 )
 
 func (gcm *Manager) gcPeers(ctx context.Context) {
@@ -49,8 +51,7 @@ func (gcm *Manager) gcPeers(ctx context.Context) {
 			continue
 		}
 
-		if peerState.ServiceDownTime == 0 ||
-			timeutils.GetCurrentTimeMillis()-peerState.ServiceDownTime < int64(gcm.cfg.PeerGCDelay/time.Millisecond) {
+		if peerState.ServiceDownTime.IsZero() || time.Since(peerState.ServiceDownTime) < gcm.cfg.PeerGCDelay {
 			continue
 		}
 
@@ -68,6 +69,24 @@ func (gcm *Manager) gcPeers(ctx context.Context) {
 	logrus.Infof("gc peers: success to gc peer count(%d), remainder count(%d)", gcPeerCount, len(peerIDs)-gcPeerCount)
 }
 
+// gcDeadPeers updates the liveness states of peers by their heart beats,
+// and cleans up the dead ones in order.
+func (gcm *Manager) gcDeadPeers(ctx context.Context) {
+	var gcPeerCount int
+	for _, peerID := range gcm.peerMgr.UpdatePeerStates(ctx) {
+		if gcm.cfg.IsSuperPID(peerID) {
+			continue
+		}
+		gcm.gcPeer(ctx, peerID)
+		gcPeerCount++
+	}
+
+	if gcPeerCount > 0 {
+		gcm.metrics.gcPeersCount.WithLabelValues().Add(float64(gcPeerCount))
+		logrus.Infof("gc dead peers: success to gc peer count(%d)", gcPeerCount)
+	}
+}
+
 func (gcm *Manager) gcPeer(ctx context.Context, peerID string) {
 	logrus.Infof("gc peer: start to deal with peer: %s", peerID)
 
@@ -47,12 +47,12 @@ func (gcm *Manager) gcTasks(ctx context.Context) {
 	taskIDs := taskAccessMap.ListKeyAsStringSlice()
 	totalTaskNums := len(taskIDs)
 	for _, taskID := range taskIDs {
-		atime, err := taskAccessMap.GetAsTime(taskID)
+		idle, err := gcm.taskMgr.GetIdleTime(ctx, taskID)
 		if err != nil {
-			logrus.Errorf("gc tasks: failed to get access time taskID(%s): %v", taskID, err)
+			logrus.Errorf("gc tasks: failed to get idle time taskID(%s): %v", taskID, err)
 			continue
 		}
-		if time.Since(atime) < gcm.cfg.TaskExpireTime {
+		if idle < gcm.cfg.TaskExpireTime {
 			continue
 		}
 
@@ -131,4 +131,5 @@ func (gcm *Manager) gcTaskByTaskID(ctx context.Context, taskID string) {
 	if err := gcm.taskMgr.Delete(ctx, taskID); err != nil {
 		logrus.Errorf("gc task: failed to gc task info taskID(%s): %v", taskID, err)
 	}
+	gcm.contributionMgr.DeleteTask(ctx, taskID)
 }
@@ -0,0 +1,172 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package group
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+var _ mgr.GroupMgr = &Manager{}
+
+// member is a download of a group, it keeps the last status of the dfget task
+// seen, which is reported after the dfget task is removed from dfgetTaskMgr.
+type member struct {
+	taskID string
+	cid    string
+	last   *types.DfGetTask
+}
+
+type group struct {
+	deadline int64
+	members  []*member
+	lastJoin time.Time
+}
+
+// Manager is an implementation of the interface of GroupMgr.
+type Manager struct {
+	sync.Mutex
+
+	cfg          *config.Config
+	dfgetTaskMgr mgr.DfgetTaskMgr
+	groups       map[string]*group
+
+	now func() time.Time
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config, dfgetTaskMgr mgr.DfgetTaskMgr) (*Manager, error) {
+	return &Manager{
+		cfg:          cfg,
+		dfgetTaskMgr: dfgetTaskMgr,
+		groups:       make(map[string]*group),
+		now:          time.Now,
+	}, nil
+}
+
+// Join adds the dfget task of cid downloading taskID to the group. The deadline
+// of the group is the earliest one of its downloads. The groups which none has
+// joined within TaskExpireTime and have no running downloads are removed.
+func (m *Manager) Join(ctx context.Context, groupID, taskID, cid string, deadline int64) {
+	if groupID == "" {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	now := m.now()
+	m.gc(ctx, now)
+
+	g, ok := m.groups[groupID]
+	if !ok {
+		g = &group{}
+		m.groups[groupID] = g
+	}
+	g.lastJoin = now
+	if deadline > 0 && (g.deadline == 0 || deadline < g.deadline) {
+		g.deadline = deadline
+	}
+	for _, v := range g.members {
+		if v.cid == cid && v.taskID == taskID {
+			return
+		}
+	}
+	g.members = append(g.members, &member{taskID: taskID, cid: cid})
+}
+
+// Get returns the info of the group. The group is completed if all its downloads
+// have succeeded, and failed if any of them has failed.
+func (m *Manager) Get(ctx context.Context, groupID string) (*types.TaskGroupInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	now := m.now()
+	m.gc(ctx, now)
+
+	g, ok := m.groups[groupID]
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "task group %s", groupID)
+	}
+
+	info := &types.TaskGroupInfo{
+		ID:        groupID,
+		Deadline:  g.deadline,
+		Urgent:    mgr.GroupUrgent(g.deadline, m.cfg.GroupUrgentWindow, now),
+		Completed: true,
+	}
+	for _, v := range g.members {
+		m.refresh(ctx, v)
+		if v.last == nil {
+			info.Completed = false
+			continue
+		}
+		switch v.last.Status {
+		case types.DfGetTaskStatusSUCCESS:
+		case types.DfGetTaskStatusFAILED:
+			info.Completed = false
+			info.Failed = true
+		default:
+			info.Completed = false
+		}
+		download := *v.last
+		info.Downloads = append(info.Downloads, &download)
+	}
+	return info, nil
+}
+
+// refresh updates the last status of the member from dfgetTaskMgr,
+// and returns false if the dfget task has been removed.
+func (m *Manager) refresh(ctx context.Context, v *member) bool {
+	dfgetTask, err := m.dfgetTaskMgr.Get(ctx, v.cid, v.taskID)
+	if err != nil || dfgetTask == nil {
+		return false
+	}
+	last := *dfgetTask
+	v.last = &last
+	return true
+}
+
+func finished(status string) bool {
+	return status == types.DfGetTaskStatusSUCCESS || status == types.DfGetTaskStatusFAILED
+}
+
+// gc removes the groups which none has joined within TaskExpireTime
+// and whose downloads are all finished or removed.
+func (m *Manager) gc(ctx context.Context, now time.Time) {
+	for id, g := range m.groups {
+		if now.Sub(g.lastJoin) < m.cfg.TaskExpireTime {
+			continue
+		}
+		running := false
+		for _, v := range g.members {
+			if m.refresh(ctx, v) && !finished(v.last.Status) {
+				running = true
+				break
+			}
+		}
+		if !running {
+			delete(m.groups, id)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package group
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/dfgettask"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&GroupMgrTestSuite{})
+}
+
+type GroupMgrTestSuite struct{}
+
+func newTestManager(c *check.C, now *time.Time) (*Manager, *dfgettask.Manager) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	dfgetTaskMgr, err := dfgettask.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	manager, err := NewManager(cfg, dfgetTaskMgr)
+	c.Assert(err, check.IsNil)
+	manager.now = func() time.Time { return *now }
+	return manager, dfgetTaskMgr
+}
+
+func addDfgetTask(c *check.C, dfgetTaskMgr *dfgettask.Manager, cid, taskID string) {
+	c.Assert(dfgetTaskMgr.Add(context.Background(), &types.DfGetTask{
+		CID:    cid,
+		Path:   "/peer/file/" + taskID,
+		PeerID: "peer",
+		TaskID: taskID,
+		Status: types.DfGetTaskStatusWAITING,
+	}), check.IsNil)
+}
+
+func (s *GroupMgrTestSuite) TestGet(c *check.C) {
+	ctx := context.Background()
+	now := time.Now()
+	manager, dfgetTaskMgr := newTestManager(c, &now)
+
+	_, err := manager.Get(ctx, "image")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	addDfgetTask(c, dfgetTaskMgr, "cid1", "layer1")
+	addDfgetTask(c, dfgetTaskMgr, "cid2", "layer2")
+	deadline := timeutils.TimeToMillis(now.Add(2 * time.Minute))
+	manager.Join(ctx, "image", "layer1", "cid1", deadline)
+	manager.Join(ctx, "image", "layer2", "cid2", deadline-1000)
+	manager.Join(ctx, "image", "layer2", "cid2", 0)
+
+	info, err := manager.Get(ctx, "image")
+	c.Assert(err, check.IsNil)
+	c.Check(info.ID, check.Equals, "image")
+	c.Check(info.Deadline, check.Equals, deadline-1000)
+	c.Check(info.Urgent, check.Equals, false)
+	c.Check(info.Completed, check.Equals, false)
+	c.Check(info.Downloads, check.HasLen, 2)
+
+	c.Assert(dfgetTaskMgr.UpdateStatus(ctx, "cid1", "layer1", types.DfGetTaskStatusSUCCESS), check.IsNil)
+	c.Assert(dfgetTaskMgr.UpdateStatus(ctx, "cid2", "layer2", types.DfGetTaskStatusRUNNING), check.IsNil)
+	now = now.Add(90 * time.Second)
+	info, err = manager.Get(ctx, "image")
+	c.Assert(err, check.IsNil)
+	c.Check(info.Urgent, check.Equals, true)
+	c.Check(info.Completed, check.Equals, false)
+	c.Check(info.Failed, check.Equals, false)
+
+	// the last status is kept after the dfget task is removed
+	c.Assert(dfgetTaskMgr.UpdateStatus(ctx, "cid2", "layer2", types.DfGetTaskStatusFAILED), check.IsNil)
+	manager.Get(ctx, "image")
+	c.Assert(dfgetTaskMgr.Delete(ctx, "cid2", "layer2"), check.IsNil)
+	info, err = manager.Get(ctx, "image")
+	c.Assert(err, check.IsNil)
+	c.Check(info.Completed, check.Equals, false)
+	c.Check(info.Failed, check.Equals, true)
+	c.Check(info.Downloads, check.HasLen, 2)
+}
+
+func (s *GroupMgrTestSuite) TestGC(c *check.C) {
+	ctx := context.Background()
+	now := time.Now()
+	manager, dfgetTaskMgr := newTestManager(c, &now)
+
+	addDfgetTask(c, dfgetTaskMgr, "cid1", "layer1")
+	manager.Join(ctx, "image", "layer1", "cid1", 0)
+
+	// the running group is kept
+	now = now.Add(manager.cfg.TaskExpireTime)
+	_, err := manager.Get(ctx, "image")
+	c.Check(err, check.IsNil)
+
+	c.Assert(dfgetTaskMgr.UpdateStatus(ctx, "cid1", "layer1", types.DfGetTaskStatusSUCCESS), check.IsNil)
+	_, err = manager.Get(ctx, "image")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// the completed group is kept until TaskExpireTime after the last join
+	manager.Join(ctx, "image", "layer1", "cid1", 0)
+	info, err := manager.Get(ctx, "image")
+	c.Assert(err, check.IsNil)
+	c.Check(info.Completed, check.Equals, true)
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// GroupMgr as an interface defines all operations against the task groups.
+// A task group is a set of the related files registered together, such as all the
+// layers of an image, whose downloads share the deadline of the group and are
+// listed together to tell whether they've all finished.
+type GroupMgr interface {
+	// Join adds the dfget task of cid downloading taskID to the group,
+	// and the group is created if it doesn't exist. deadline is the unix time in
+	// milliseconds by which the downloads of the group should finish, 0 means none.
+	Join(ctx context.Context, groupID, taskID, cid string, deadline int64)
+
+	// Get returns the info of the group with the statuses of its downloads.
+	Get(ctx context.Context, groupID string) (*types.TaskGroupInfo, error)
+}
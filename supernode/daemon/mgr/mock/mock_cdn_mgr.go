@@ -6,11 +6,13 @@ package mock
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
 
 	types "github.com/dragonflyoss/Dragonfly/apis/types"
+	fileutils "github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	mgr "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 )
 
@@ -52,6 +54,20 @@ func (mr *MockCDNMgrMockRecorder) TriggerCDN(ctx, taskInfo interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TriggerCDN", reflect.TypeOf((*MockCDNMgr)(nil).TriggerCDN), ctx, taskInfo)
 }
 
+// UpdatePriority mocks base method
+func (m *MockCDNMgr) UpdatePriority(ctx context.Context, taskID string, priority types.Priority) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePriority", ctx, taskID, priority)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePriority indicates an expected call of UpdatePriority
+func (mr *MockCDNMgrMockRecorder) UpdatePriority(ctx, taskID, priority interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePriority", reflect.TypeOf((*MockCDNMgr)(nil).UpdatePriority), ctx, taskID, priority)
+}
+
 // GetHTTPPath mocks base method
 func (m *MockCDNMgr) GetHTTPPath(ctx context.Context, taskInfo *types.TaskInfo) (string, error) {
 	m.ctrl.T.Helper()
@@ -83,18 +99,33 @@ func (mr *MockCDNMgrMockRecorder) GetStatus(ctx, taskID interface{}) *gomock.Cal
 }
 
 // GetGCTaskIDs mocks base method
-func (m *MockCDNMgr) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr) ([]string, error) {
+func (m *MockCDNMgr) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr, preemptive bool) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetGCTaskIDs", ctx, taskMgr)
+	ret := m.ctrl.Call(m, "GetGCTaskIDs", ctx, taskMgr, preemptive)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetGCTaskIDs indicates an expected call of GetGCTaskIDs
-func (mr *MockCDNMgrMockRecorder) GetGCTaskIDs(ctx, taskMgr interface{}) *gomock.Call {
+func (mr *MockCDNMgrMockRecorder) GetGCTaskIDs(ctx, taskMgr, preemptive interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGCTaskIDs", reflect.TypeOf((*MockCDNMgr)(nil).GetGCTaskIDs), ctx, taskMgr, preemptive)
+}
+
+// GetAvailSpace mocks base method
+func (m *MockCDNMgr) GetAvailSpace(ctx context.Context) (fileutils.Fsize, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAvailSpace", ctx)
+	ret0, _ := ret[0].(fileutils.Fsize)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAvailSpace indicates an expected call of GetAvailSpace
+func (mr *MockCDNMgrMockRecorder) GetAvailSpace(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGCTaskIDs", reflect.TypeOf((*MockCDNMgr)(nil).GetGCTaskIDs), ctx, taskMgr)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAvailSpace", reflect.TypeOf((*MockCDNMgr)(nil).GetAvailSpace), ctx)
 }
 
 // GetPieceMD5 mocks base method
@@ -112,6 +143,47 @@ func (mr *MockCDNMgrMockRecorder) GetPieceMD5(ctx, taskID, pieceNum, pieceRange,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPieceMD5", reflect.TypeOf((*MockCDNMgr)(nil).GetPieceMD5), ctx, taskID, pieceNum, pieceRange, source)
 }
 
+// GetPieceMD5s mocks base method
+func (m *MockCDNMgr) GetPieceMD5s(ctx context.Context, taskID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPieceMD5s", ctx, taskID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPieceMD5s indicates an expected call of GetPieceMD5s
+func (mr *MockCDNMgrMockRecorder) GetPieceMD5s(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPieceMD5s", reflect.TypeOf((*MockCDNMgr)(nil).GetPieceMD5s), ctx, taskID)
+}
+
+// StartScan mocks base method
+func (m *MockCDNMgr) StartScan(ctx context.Context) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StartScan", ctx)
+}
+
+// StartScan indicates an expected call of StartScan
+func (mr *MockCDNMgrMockRecorder) StartScan(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartScan", reflect.TypeOf((*MockCDNMgr)(nil).StartScan), ctx)
+}
+
+// GetScanStatus mocks base method
+func (m *MockCDNMgr) GetScanStatus(ctx context.Context) *types.CacheScanStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScanStatus", ctx)
+	ret0, _ := ret[0].(*types.CacheScanStatus)
+	return ret0
+}
+
+// GetScanStatus indicates an expected call of GetScanStatus
+func (mr *MockCDNMgrMockRecorder) GetScanStatus(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScanStatus", reflect.TypeOf((*MockCDNMgr)(nil).GetScanStatus), ctx)
+}
+
 // CheckFile mocks base method
 func (m *MockCDNMgr) CheckFile(ctx context.Context, taskID string) bool {
 	m.ctrl.T.Helper()
@@ -139,3 +211,32 @@ func (mr *MockCDNMgrMockRecorder) Delete(ctx, taskID, force interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCDNMgr)(nil).Delete), ctx, taskID, force)
 }
+
+// ExportBundle mocks base method
+func (m *MockCDNMgr) ExportBundle(ctx context.Context, task *types.TaskInfo, w io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportBundle", ctx, task, w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportBundle indicates an expected call of ExportBundle
+func (mr *MockCDNMgrMockRecorder) ExportBundle(ctx, task, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportBundle", reflect.TypeOf((*MockCDNMgr)(nil).ExportBundle), ctx, task, w)
+}
+
+// ImportBundle mocks base method
+func (m *MockCDNMgr) ImportBundle(ctx context.Context, r io.Reader) (*types.TaskInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportBundle", ctx, r)
+	ret0, _ := ret[0].(*types.TaskInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportBundle indicates an expected call of ImportBundle
+func (mr *MockCDNMgrMockRecorder) ImportBundle(ctx, r interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportBundle", reflect.TypeOf((*MockCDNMgr)(nil).ImportBundle), ctx, r)
+}
@@ -109,3 +109,32 @@ func (mr *MockPeerMgrMockRecorder) List(ctx, filter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockPeerMgr)(nil).List), ctx, filter)
 }
+
+// Heartbeat mocks base method
+func (m *MockPeerMgr) Heartbeat(ctx context.Context, heartBeatRequest *types.HeartBeatRequest) (*types.HeartBeatResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Heartbeat", ctx, heartBeatRequest)
+	ret0, _ := ret[0].(*types.HeartBeatResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Heartbeat indicates an expected call of Heartbeat
+func (mr *MockPeerMgrMockRecorder) Heartbeat(ctx, heartBeatRequest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Heartbeat", reflect.TypeOf((*MockPeerMgr)(nil).Heartbeat), ctx, heartBeatRequest)
+}
+
+// UpdatePeerStates mocks base method
+func (m *MockPeerMgr) UpdatePeerStates(ctx context.Context) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePeerStates", ctx)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// UpdatePeerStates indicates an expected call of UpdatePeerStates
+func (mr *MockPeerMgrMockRecorder) UpdatePeerStates(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePeerStates", reflect.TypeOf((*MockPeerMgr)(nil).UpdatePeerStates), ctx)
+}
@@ -10,6 +10,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 
+	types "github.com/dragonflyoss/Dragonfly/apis/types"
 	mgr "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 )
 
@@ -37,16 +38,174 @@ func (m *MockSchedulerMgr) EXPECT() *MockSchedulerMgrMockRecorder {
 }
 
 // Schedule mocks base method
-func (m *MockSchedulerMgr) Schedule(ctx context.Context, taskID, clientID, peerID string) ([]*mgr.PieceResult, error) {
+func (m *MockSchedulerMgr) Schedule(ctx context.Context, taskID, clientID, peerID string, priority types.Priority, pieceRange *mgr.PieceRange) ([]*mgr.PieceResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Schedule", ctx, taskID, clientID, peerID)
+	ret := m.ctrl.Call(m, "Schedule", ctx, taskID, clientID, peerID, priority, pieceRange)
 	ret0, _ := ret[0].([]*mgr.PieceResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Schedule indicates an expected call of Schedule
-func (mr *MockSchedulerMgrMockRecorder) Schedule(ctx, taskID, clientID, peerID interface{}) *gomock.Call {
+func (mr *MockSchedulerMgrMockRecorder) Schedule(ctx, taskID, clientID, peerID, priority, pieceRange interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockSchedulerMgr)(nil).Schedule), ctx, taskID, clientID, peerID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockSchedulerMgr)(nil).Schedule), ctx, taskID, clientID, peerID, priority, pieceRange)
+}
+
+// GetDecisions mocks base method
+func (m *MockSchedulerMgr) GetDecisions(ctx context.Context, taskID string, limit int) ([]*mgr.SchedulerDecision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDecisions", ctx, taskID, limit)
+	ret0, _ := ret[0].([]*mgr.SchedulerDecision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDecisions indicates an expected call of GetDecisions
+func (mr *MockSchedulerMgrMockRecorder) GetDecisions(ctx, taskID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDecisions", reflect.TypeOf((*MockSchedulerMgr)(nil).GetDecisions), ctx, taskID, limit)
+}
+
+// GetStrategy mocks base method
+func (m *MockSchedulerMgr) GetStrategy(ctx context.Context, taskID string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStrategy", ctx, taskID)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetStrategy indicates an expected call of GetStrategy
+func (mr *MockSchedulerMgrMockRecorder) GetStrategy(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStrategy", reflect.TypeOf((*MockSchedulerMgr)(nil).GetStrategy), ctx, taskID)
+}
+
+// SetBrake mocks base method
+func (m *MockSchedulerMgr) SetBrake(ctx context.Context, brake *types.EmergencyBrake) (*types.EmergencyBrake, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBrake", ctx, brake)
+	ret0, _ := ret[0].(*types.EmergencyBrake)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetBrake indicates an expected call of SetBrake
+func (mr *MockSchedulerMgrMockRecorder) SetBrake(ctx, brake interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBrake", reflect.TypeOf((*MockSchedulerMgr)(nil).SetBrake), ctx, brake)
+}
+
+// GetBrake mocks base method
+func (m *MockSchedulerMgr) GetBrake(ctx context.Context) *types.EmergencyBrake {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBrake", ctx)
+	ret0, _ := ret[0].(*types.EmergencyBrake)
+	return ret0
+}
+
+// GetBrake indicates an expected call of GetBrake
+func (mr *MockSchedulerMgrMockRecorder) GetBrake(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBrake", reflect.TypeOf((*MockSchedulerMgr)(nil).GetBrake), ctx)
+}
+
+// ListBrakes mocks base method
+func (m *MockSchedulerMgr) ListBrakes(ctx context.Context) []*types.EmergencyBrake {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListBrakes", ctx)
+	ret0, _ := ret[0].([]*types.EmergencyBrake)
+	return ret0
+}
+
+// ListBrakes indicates an expected call of ListBrakes
+func (mr *MockSchedulerMgrMockRecorder) ListBrakes(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListBrakes", reflect.TypeOf((*MockSchedulerMgr)(nil).ListBrakes), ctx)
+}
+
+// DeleteBrake mocks base method
+func (m *MockSchedulerMgr) DeleteBrake(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteBrake", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteBrake indicates an expected call of DeleteBrake
+func (mr *MockSchedulerMgrMockRecorder) DeleteBrake(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBrake", reflect.TypeOf((*MockSchedulerMgr)(nil).DeleteBrake), ctx, name)
+}
+
+// GetPeerBrake mocks base method
+func (m *MockSchedulerMgr) GetPeerBrake(ctx context.Context, peerID string) *types.EmergencyBrake {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPeerBrake", ctx, peerID)
+	ret0, _ := ret[0].(*types.EmergencyBrake)
+	return ret0
+}
+
+// GetPeerBrake indicates an expected call of GetPeerBrake
+func (mr *MockSchedulerMgrMockRecorder) GetPeerBrake(ctx, peerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeerBrake", reflect.TypeOf((*MockSchedulerMgr)(nil).GetPeerBrake), ctx, peerID)
+}
+
+// SetBoost mocks base method
+func (m *MockSchedulerMgr) SetBoost(ctx context.Context, taskID string, boost *types.TaskBoost) (*types.TaskBoost, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBoost", ctx, taskID, boost)
+	ret0, _ := ret[0].(*types.TaskBoost)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetBoost indicates an expected call of SetBoost
+func (mr *MockSchedulerMgrMockRecorder) SetBoost(ctx, taskID, boost interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBoost", reflect.TypeOf((*MockSchedulerMgr)(nil).SetBoost), ctx, taskID, boost)
+}
+
+// GetBoost mocks base method
+func (m *MockSchedulerMgr) GetBoost(ctx context.Context, taskID string) (*types.TaskBoost, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBoost", ctx, taskID)
+	ret0, _ := ret[0].(*types.TaskBoost)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBoost indicates an expected call of GetBoost
+func (mr *MockSchedulerMgrMockRecorder) GetBoost(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBoost", reflect.TypeOf((*MockSchedulerMgr)(nil).GetBoost), ctx, taskID)
+}
+
+// ListBoosts mocks base method
+func (m *MockSchedulerMgr) ListBoosts(ctx context.Context) []*types.TaskBoost {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListBoosts", ctx)
+	ret0, _ := ret[0].([]*types.TaskBoost)
+	return ret0
+}
+
+// ListBoosts indicates an expected call of ListBoosts
+func (mr *MockSchedulerMgrMockRecorder) ListBoosts(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListBoosts", reflect.TypeOf((*MockSchedulerMgr)(nil).ListBoosts), ctx)
+}
+
+// DeleteBoost mocks base method
+func (m *MockSchedulerMgr) DeleteBoost(ctx context.Context, taskID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteBoost", ctx, taskID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteBoost indicates an expected call of DeleteBoost
+func (mr *MockSchedulerMgrMockRecorder) DeleteBoost(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBoost", reflect.TypeOf((*MockSchedulerMgr)(nil).DeleteBoost), ctx, taskID)
 }
@@ -19,10 +19,13 @@ package peer
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/lease"
 	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
@@ -34,32 +37,44 @@ import (
 	"github.com/go-openapi/strfmt"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
 var _ mgr.PeerMgr = &Manager{}
 
 type metrics struct {
-	peers *prometheus.GaugeVec
+	peers             *prometheus.GaugeVec
+	standbyPromotions *prometheus.CounterVec
 }
 
 func newMetrics(register prometheus.Registerer) *metrics {
 	return &metrics{
 		peers: metricsutils.NewGauge(config.SubsystemSupernode, "peers",
 			"Current status of peers", []string{"peer"}, register),
+		standbyPromotions: metricsutils.NewCounter(config.SubsystemSupernode, "standby_promotions_total",
+			"Total number of the warm standbys promoted as the sources of the pieces since their primaries went down.",
+			[]string{}, register),
 	}
 }
 
 // Manager is an implement of the interface of PeerMgr.
 type Manager struct {
+	cfg       *config.Config
 	peerStore *dutil.Store
 	metrics   *metrics
+
+	// leases are renewed by the heart beats of the peers, and expire the peers
+	// by the logical clock of supernode rather than LastHeartbeat in the wall clock.
+	leases *lease.Table
 }
 
 // NewManager returns a new Manager Object.
-func NewManager(register prometheus.Registerer) (*Manager, error) {
+func NewManager(cfg *config.Config, register prometheus.Registerer) (*Manager, error) {
 	return &Manager{
+		cfg:       cfg,
 		peerStore: dutil.NewStore(),
 		metrics:   newMetrics(register),
+		leases:    lease.NewTable(cfg.GetClock()),
 	}, nil
 }
 
@@ -73,15 +88,24 @@ func (pm *Manager) Register(ctx context.Context, peerCreateRequest *types.PeerCr
 	if !netutils.IsValidIP(ipString) {
 		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "peer IP: %s", ipString)
 	}
+	for _, addr := range peerCreateRequest.Addresses {
+		if net.ParseIP(addr) == nil {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "peer address: %s", addr)
+		}
+	}
 
 	id := generatePeerID(peerCreateRequest)
 	peerInfo := &types.PeerInfo{
-		ID:       id,
-		IP:       peerCreateRequest.IP,
-		HostName: peerCreateRequest.HostName,
-		Port:     peerCreateRequest.Port,
-		Version:  peerCreateRequest.Version,
-		Created:  strfmt.DateTime(time.Now()),
+		ID:         id,
+		IP:         peerCreateRequest.IP,
+		Addresses:  peerCreateRequest.Addresses,
+		HostName:   peerCreateRequest.HostName,
+		Labels:     peerCreateRequest.Labels,
+		Port:       peerCreateRequest.Port,
+		Version:    peerCreateRequest.Version,
+		Transports: peerCreateRequest.Transports,
+		AcceptPush: peerCreateRequest.AcceptPush,
+		Created:    strfmt.DateTime(time.Now()),
 	}
 	pm.peerStore.Put(id, peerInfo)
 	pm.metrics.peers.WithLabelValues(peerInfo.IP.String()).Inc()
@@ -99,6 +123,7 @@ func (pm *Manager) DeRegister(ctx context.Context, peerID string) error {
 	}
 
 	pm.peerStore.Delete(peerID)
+	pm.leases.Remove(peerID)
 	// NOTE: DeRegister will be called asynchronously.
 	pm.metrics.peers.WithLabelValues(peerInfo.IP.String()).Dec()
 	return nil
@@ -147,6 +172,188 @@ func (pm *Manager) List(ctx context.Context, filter *dutil.PageFilter) (
 	return
 }
 
+// Heartbeat refreshes the peers which are served by the uploader
+// listening on the IP and port of the heartBeatRequest.
+//
+// A peer is registered for every download of dfget, so all the peers
+// sharing the same uploader are refreshed together. The dead peers will not
+// be revived and they are waiting for gc.
+func (pm *Manager) Heartbeat(ctx context.Context, heartBeatRequest *types.HeartBeatRequest) (*types.HeartBeatResponse, error) {
+	if heartBeatRequest == nil {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "heart beat request")
+	}
+
+	ipString := heartBeatRequest.IP.String()
+	if !netutils.IsValidIP(ipString) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "peer IP: %s", ipString)
+	}
+	if standbyOf := heartBeatRequest.StandbyOf; standbyOf != "" {
+		if _, _, err := net.SplitHostPort(standbyOf); err != nil {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "standbyOf: %s", standbyOf)
+		}
+	}
+
+	peerInfos, err := pm.assertPeerInfoSlice(pm.peerStore.List())
+	if err != nil {
+		return nil, err
+	}
+
+	now := strfmt.DateTime(time.Now())
+	var matched int
+	for _, peerInfo := range peerInfos {
+		if peerInfo.IP != heartBeatRequest.IP || peerInfo.Port != heartBeatRequest.Port {
+			continue
+		}
+		if pm.refreshPeer(peerInfo.ID, now, heartBeatRequest) {
+			matched++
+		}
+	}
+
+	return &types.HeartBeatResponse{
+		NeedRegister: matched == 0,
+	}, nil
+}
+
+// UpdatePeerStates moves the peers which have sent heart beats through
+// alive, suspect and dead states, and returns the sorted IDs of the dead peers.
+// The peers which never send a heart beat are ignored.
+// The time elapsed since the last heart beat is measured by the logical clock of
+// supernode, so the peers aren't expired by the time frozen by a pause of supernode.
+// The warm standbys are promoted or held back by the states of their primaries then.
+func (pm *Manager) UpdatePeerStates(ctx context.Context) (deadPeerIDs []string) {
+	if pm.cfg.PeerDeadTimeout <= 0 {
+		return nil
+	}
+
+	peerInfos, err := pm.assertPeerInfoSlice(pm.peerStore.List())
+	if err != nil {
+		logrus.Errorf("failed to list peers to update states: %v", err)
+		return nil
+	}
+
+	for _, peerInfo := range peerInfos {
+		elapsed, ok := pm.leases.Age(peerInfo.ID)
+		if !ok {
+			continue
+		}
+
+		state := pm.getLivenessState(elapsed)
+		if state != peerInfo.State {
+			pm.updatePeerState(peerInfo.ID, state)
+		}
+		if state == types.PeerInfoStateDead {
+			deadPeerIDs = append(deadPeerIDs, peerInfo.ID)
+		}
+	}
+
+	pm.updateStandbys()
+	sort.Strings(deadPeerIDs)
+	return deadPeerIDs
+}
+
+// updateStandbys promotes the warm standbys as the sources of the pieces when no peer
+// of their primaries is alive, and holds them back again once their primaries come back.
+func (pm *Manager) updateStandbys() {
+	peerInfos, err := pm.assertPeerInfoSlice(pm.peerStore.List())
+	if err != nil {
+		return
+	}
+	alive := make(map[string]bool)
+	for _, peerInfo := range peerInfos {
+		if peerInfo.State == types.PeerInfoStateAlive {
+			alive[fmt.Sprintf("%s:%d", peerInfo.IP, peerInfo.Port)] = true
+		}
+	}
+	for _, peerInfo := range peerInfos {
+		if peerInfo.StandbyOf == "" {
+			continue
+		}
+		if promoted := !alive[peerInfo.StandbyOf]; promoted != peerInfo.Promoted {
+			pm.updatePromoted(peerInfo.ID, promoted)
+		}
+	}
+}
+
+func (pm *Manager) updatePromoted(peerID string, promoted bool) {
+	util.GetLock(peerID, false)
+	defer util.ReleaseLock(peerID, false)
+
+	peerInfo, err := pm.getPeerInfo(peerID)
+	if err != nil || peerInfo.Promoted == promoted {
+		return
+	}
+	if promoted {
+		logrus.Warnf("promote the standby peer %s since its primary %s is down", peerID, peerInfo.StandbyOf)
+		pm.metrics.standbyPromotions.WithLabelValues().Inc()
+	} else {
+		logrus.Infof("hold back the standby peer %s since its primary %s comes back", peerID, peerInfo.StandbyOf)
+	}
+
+	updated := *peerInfo
+	updated.Promoted = promoted
+	pm.peerStore.Put(peerID, &updated)
+}
+
+// getLivenessState returns the state of a peer whose last heart beat is elapsed ago.
+func (pm *Manager) getLivenessState(elapsed time.Duration) string {
+	if elapsed >= pm.cfg.PeerDeadTimeout {
+		return types.PeerInfoStateDead
+	}
+	if pm.cfg.PeerSuspectTimeout > 0 && elapsed >= pm.cfg.PeerSuspectTimeout {
+		return types.PeerInfoStateSuspect
+	}
+	return types.PeerInfoStateAlive
+}
+
+// refreshPeer marks the peer as alive with the heart beat time and renews its lease, and updates
+// the load, the cache utilization and the primary of it from the heart beat.
+// It returns false if the peer doesn't exist or is dead.
+//
+// NOTE: The peerInfo is copied before being modified, because the
+// pointer returned by Get and List may be read without lock.
+func (pm *Manager) refreshPeer(peerID string, heartbeatTime strfmt.DateTime, heartBeatRequest *types.HeartBeatRequest) bool {
+	util.GetLock(peerID, false)
+	defer util.ReleaseLock(peerID, false)
+
+	peerInfo, err := pm.getPeerInfo(peerID)
+	if err != nil || peerInfo.State == types.PeerInfoStateDead {
+		return false
+	}
+	if peerInfo.State != types.PeerInfoStateAlive {
+		logrus.Infof("peer %s turns to be %s from %q by heart beat", peerID, types.PeerInfoStateAlive, peerInfo.State)
+	}
+
+	refreshed := *peerInfo
+	refreshed.State = types.PeerInfoStateAlive
+	refreshed.LastHeartbeat = heartbeatTime
+	refreshed.Load = heartBeatRequest.Load
+	refreshed.CacheCapacity = heartBeatRequest.CacheCapacity
+	refreshed.CacheUsed = heartBeatRequest.CacheUsed
+	refreshed.StandbyOf = heartBeatRequest.StandbyOf
+	if refreshed.StandbyOf == "" {
+		refreshed.Promoted = false
+	}
+	pm.peerStore.Put(peerID, &refreshed)
+	pm.leases.Renew(peerID)
+	return true
+}
+
+func (pm *Manager) updatePeerState(peerID, state string) {
+	util.GetLock(peerID, false)
+	defer util.ReleaseLock(peerID, false)
+
+	peerInfo, err := pm.getPeerInfo(peerID)
+	if err != nil || peerInfo.State == state {
+		return
+	}
+	logrus.Warnf("peer %s turns to be %s from %s, last heart beat: %s",
+		peerID, state, peerInfo.State, peerInfo.LastHeartbeat)
+
+	updated := *peerInfo
+	updated.State = state
+	pm.peerStore.Put(peerID, &updated)
+}
+
 // getPeerInfo gets peer info with specified peerID and
 // returns the underlying PeerInfo value.
 func (pm *Manager) getPeerInfo(peerID string) (*types.PeerInfo, error) {
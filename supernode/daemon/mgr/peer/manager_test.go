@@ -24,10 +24,13 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/lease"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
 	"github.com/dragonflyoss/Dragonfly/version"
 
 	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/client_golang/prometheus"
 	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
 )
@@ -43,8 +46,27 @@ func init() {
 type PeerMgrTestSuite struct {
 }
 
+// fakeClock is the source of the logical clock of supernode in tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock(cfg *config.Config, maxStep time.Duration) *fakeClock {
+	fc := &fakeClock{t: time.Now()}
+	cfg.SetClock(lease.NewClockWithSource(maxStep, fc.now))
+	return fc
+}
+
+func (fc *fakeClock) now() time.Time {
+	return fc.t
+}
+
+func (fc *fakeClock) add(d time.Duration) {
+	fc.t = fc.t.Add(d)
+}
+
 func (s *PeerMgrTestSuite) TestPeerMgr(c *check.C) {
-	manager, _ := NewManager(prometheus.NewRegistry())
+	manager, _ := NewManager(config.NewConfig(), prometheus.NewRegistry())
 	peers := manager.metrics.peers
 	// register
 	request := &types.PeerCreateRequest{
@@ -91,7 +113,7 @@ func (s *PeerMgrTestSuite) TestPeerMgr(c *check.C) {
 }
 
 func (s *PeerMgrTestSuite) TestGet(c *check.C) {
-	manager, _ := NewManager(prometheus.NewRegistry())
+	manager, _ := NewManager(config.NewConfig(), prometheus.NewRegistry())
 
 	// register
 	request := &types.PeerCreateRequest{
@@ -128,8 +150,28 @@ func (s *PeerMgrTestSuite) TestGet(c *check.C) {
 	c.Check(info, check.DeepEquals, expected)
 }
 
+func (s *PeerMgrTestSuite) TestRegisterAddresses(c *check.C) {
+	manager, _ := NewManager(config.NewConfig(), prometheus.NewRegistry())
+
+	request := &types.PeerCreateRequest{
+		IP:        "192.168.10.11",
+		Addresses: []string{"fd00::11", "10.0.1.11"},
+		HostName:  "foo",
+		Port:      65001,
+	}
+	resp, err := manager.Register(context.Background(), request)
+	c.Assert(err, check.IsNil)
+	info, err := manager.Get(context.Background(), resp.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(info.Addresses, check.DeepEquals, request.Addresses)
+
+	request.Addresses = []string{"fd00::11", "foo"}
+	_, err = manager.Register(context.Background(), request)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
 func (s *PeerMgrTestSuite) TestGetAllPeerIDs(c *check.C) {
-	manager, _ := NewManager(prometheus.NewRegistry())
+	manager, _ := NewManager(config.NewConfig(), prometheus.NewRegistry())
 
 	// the first data
 	request := &types.PeerCreateRequest{
@@ -160,7 +202,7 @@ func (s *PeerMgrTestSuite) TestGetAllPeerIDs(c *check.C) {
 }
 
 func (s *PeerMgrTestSuite) TestList(c *check.C) {
-	manager, _ := NewManager(prometheus.NewRegistry())
+	manager, _ := NewManager(config.NewConfig(), prometheus.NewRegistry())
 	// the first data
 	request := &types.PeerCreateRequest{
 		IP:       "192.168.10.11",
@@ -227,3 +269,176 @@ func (s *PeerMgrTestSuite) TestList(c *check.C) {
 	c.Check(err, check.IsNil)
 	c.Check(infoList, check.DeepEquals, []*types.PeerInfo{info2})
 }
+
+func (s *PeerMgrTestSuite) TestHeartbeat(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.PeerSuspectTimeout = time.Minute
+	cfg.PeerDeadTimeout = 2 * time.Minute
+	manager, _ := NewManager(cfg, prometheus.NewRegistry())
+	ctx := context.Background()
+
+	register := func(ip string, port int32) string {
+		resp, err := manager.Register(ctx, &types.PeerCreateRequest{
+			IP:       strfmt.IPv4(ip),
+			HostName: "foo",
+			Port:     port,
+		})
+		c.Assert(err, check.IsNil)
+		// make sure that the generated peerIDs are different
+		time.Sleep(time.Millisecond)
+		return resp.ID
+	}
+	id1 := register("192.168.10.11", 15001)
+	id2 := register("192.168.10.11", 15001)
+	id3 := register("192.168.10.12", 15001)
+
+	resp, err := manager.Heartbeat(ctx, &types.HeartBeatRequest{IP: "192.168.10.11", Port: 15001, Load: 3,
+		CacheCapacity: 100, CacheUsed: 95})
+	c.Assert(err, check.IsNil)
+	c.Check(resp.NeedRegister, check.Equals, false)
+	for _, id := range []string{id1, id2} {
+		info, err := manager.Get(ctx, id)
+		c.Assert(err, check.IsNil)
+		c.Check(info.State, check.Equals, types.PeerInfoStateAlive)
+		c.Check(info.Load, check.Equals, int32(3))
+		c.Check(info.CacheCapacity, check.Equals, int64(100))
+		c.Check(info.CacheUsed, check.Equals, int64(95))
+	}
+
+	// the peer never sending a heart beat is not affected
+	info, err := manager.Get(ctx, id3)
+	c.Assert(err, check.IsNil)
+	c.Check(info.State, check.Equals, "")
+
+	resp, err = manager.Heartbeat(ctx, &types.HeartBeatRequest{IP: "192.168.10.13", Port: 15001})
+	c.Assert(err, check.IsNil)
+	c.Check(resp.NeedRegister, check.Equals, true)
+
+	_, err = manager.Heartbeat(ctx, &types.HeartBeatRequest{})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *PeerMgrTestSuite) TestUpdatePeerStates(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.PeerSuspectTimeout = time.Minute
+	cfg.PeerDeadTimeout = 2 * time.Minute
+	fc := newFakeClock(cfg, 0)
+	manager, _ := NewManager(cfg, prometheus.NewRegistry())
+	ctx := context.Background()
+
+	// put the peers in the order of their heart beats
+	put := func(id string, heartbeat bool) {
+		info := &types.PeerInfo{ID: id, IP: "192.168.10.11"}
+		if heartbeat {
+			info.State = types.PeerInfoStateAlive
+			info.LastHeartbeat = strfmt.DateTime(fc.t)
+			manager.leases.Renew(id)
+		}
+		manager.peerStore.Put(id, info)
+	}
+	put("legacy", false)
+	put("dead1", true)
+	fc.add(2 * time.Minute)
+	put("dead2", true)
+	fc.add(90 * time.Second)
+	put("suspect", true)
+	fc.add(89 * time.Second)
+	put("alive", true)
+	fc.add(time.Second)
+
+	c.Check(manager.UpdatePeerStates(ctx), check.DeepEquals, []string{"dead1", "dead2"})
+	expected := map[string]string{
+		"alive":   types.PeerInfoStateAlive,
+		"suspect": types.PeerInfoStateSuspect,
+		"dead1":   types.PeerInfoStateDead,
+		"dead2":   types.PeerInfoStateDead,
+		"legacy":  "",
+	}
+	for id, state := range expected {
+		info, err := manager.Get(ctx, id)
+		c.Assert(err, check.IsNil)
+		c.Check(info.State, check.Equals, state, check.Commentf("peer %s", id))
+	}
+
+	// a dead peer will not be revived by heart beat
+	resp, err := manager.Heartbeat(ctx, &types.HeartBeatRequest{IP: "192.168.10.11"})
+	c.Assert(err, check.IsNil)
+	c.Check(resp.NeedRegister, check.Equals, false)
+	info, _ := manager.Get(ctx, "dead1")
+	c.Check(info.State, check.Equals, types.PeerInfoStateDead)
+	info, _ = manager.Get(ctx, "suspect")
+	c.Check(info.State, check.Equals, types.PeerInfoStateAlive)
+
+	// the states are not checked if PeerDeadTimeout is disabled
+	cfg.PeerDeadTimeout = 0
+	c.Check(manager.UpdatePeerStates(ctx), check.IsNil)
+}
+
+func (s *PeerMgrTestSuite) TestUpdatePeerStatesAfterPause(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.PeerSuspectTimeout = time.Minute
+	cfg.PeerDeadTimeout = 2 * time.Minute
+	fc := newFakeClock(cfg, 5*time.Second)
+	manager, _ := NewManager(cfg, prometheus.NewRegistry())
+	ctx := context.Background()
+
+	resp, err := manager.Register(ctx, &types.PeerCreateRequest{IP: "192.168.10.11", HostName: "foo", Port: 15001})
+	c.Assert(err, check.IsNil)
+	_, err = manager.Heartbeat(ctx, &types.HeartBeatRequest{IP: "192.168.10.11", Port: 15001})
+	c.Assert(err, check.IsNil)
+
+	// the time frozen by suspending supernode doesn't expire the peer
+	fc.add(time.Hour)
+	c.Check(manager.UpdatePeerStates(ctx), check.IsNil)
+	info, _ := manager.Get(ctx, resp.ID)
+	c.Check(info.State, check.Equals, types.PeerInfoStateAlive)
+
+	// but the peer is still expired if it stops sending heart beats after the resume
+	for i := 0; i < 24; i++ {
+		fc.add(5 * time.Second)
+		manager.UpdatePeerStates(ctx)
+	}
+	c.Check(manager.UpdatePeerStates(ctx), check.DeepEquals, []string{resp.ID})
+
+	c.Assert(manager.DeRegister(ctx, resp.ID), check.IsNil)
+	_, ok := manager.leases.Get(resp.ID)
+	c.Check(ok, check.Equals, false)
+}
+
+func (s *PeerMgrTestSuite) TestUpdateStandbys(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.PeerDeadTimeout = 2 * time.Minute
+	fc := newFakeClock(cfg, 0)
+	manager, _ := NewManager(cfg, prometheus.NewRegistry())
+	ctx := context.Background()
+
+	put := func(id, ip, standbyOf string) {
+		manager.peerStore.Put(id, &types.PeerInfo{ID: id, IP: strfmt.IPv4(ip), Port: 15001,
+			State: types.PeerInfoStateAlive, StandbyOf: standbyOf,
+			LastHeartbeat: strfmt.DateTime(fc.t)})
+		manager.leases.Renew(id)
+	}
+	put("primary", "192.168.10.11", "")
+	put("standby", "192.168.10.12", "192.168.10.11:15001")
+
+	manager.UpdatePeerStates(ctx)
+	info, _ := manager.Get(ctx, "standby")
+	c.Check(info.Promoted, check.Equals, false)
+
+	// the standby is promoted once its primary is dead
+	fc.add(3 * time.Minute)
+	put("standby", "192.168.10.12", "192.168.10.11:15001")
+	manager.UpdatePeerStates(ctx)
+	info, _ = manager.Get(ctx, "standby")
+	c.Check(info.Promoted, check.Equals, true)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.standbyPromotions.WithLabelValues()), check.Equals, float64(1))
+
+	// and it's held back again when its primary comes back
+	put("primary2", "192.168.10.11", "")
+	manager.UpdatePeerStates(ctx)
+	info, _ = manager.Get(ctx, "standby")
+	c.Check(info.Promoted, check.Equals, false)
+
+	_, err := manager.Heartbeat(ctx, &types.HeartBeatRequest{IP: "192.168.10.12", Port: 15001, StandbyOf: "invalid"})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
@@ -42,4 +42,15 @@ type PeerMgr interface {
 
 	// List returns a list of peers info with filter.
 	List(ctx context.Context, filter *util.PageFilter) (peerList []*types.PeerInfo, err error)
+
+	// Heartbeat refreshes the liveness and load of the peers served by
+	// the uploader which sends the heart beat.
+	// NeedRegister of the response will be true if no living peer matches the uploader.
+	Heartbeat(ctx context.Context, heartBeatRequest *types.HeartBeatRequest) (*types.HeartBeatResponse, error)
+
+	// UpdatePeerStates moves the peers which have sent heart beats through
+	// alive, suspect and dead states according to the time of their last heart beats,
+	// and returns the IDs of the peers which are dead. The warm standbys are promoted as
+	// the sources of the pieces if no peer of their primaries is alive.
+	UpdatePeerStates(ctx context.Context) (deadPeerIDs []string)
 }
@@ -18,10 +18,65 @@ package mgr
 
 import (
 	"context"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 )
 
+const (
+	// PoisonVerdictProven means that the piece fetched from the offender again doesn't
+	// match the expected md5, while the one fetched from another holder does.
+	PoisonVerdictProven = "proven"
+
+	// PoisonVerdictUnconfirmed means that the piece fetched from the offender again
+	// matches the expected md5.
+	PoisonVerdictUnconfirmed = "unconfirmed"
+
+	// PoisonVerdictInconclusive means that the piece can't be fetched from the offender,
+	// or no other holder could prove that the expected md5 is right.
+	PoisonVerdictInconclusive = "inconclusive"
+)
+
+// PoisonIncident records a piece which is reported to mismatch its md5 after being
+// downloaded from a peer, and the result of cross-verifying it by supernode.
+type PoisonIncident struct {
+	Time       time.Time `json:"time"`
+	TaskID     string    `json:"taskID"`
+	PieceRange string    `json:"pieceRange"`
+
+	// ReporterCID is the client which reports the piece.
+	ReporterCID string `json:"reporterCID"`
+
+	// OffenderPID is the peer which the piece is downloaded from.
+	OffenderPID string `json:"offenderPID"`
+	OffenderIP  string `json:"offenderIP,omitempty"`
+
+	ExpectedMD5 string `json:"expectedMD5"`
+	ReportedMD5 string `json:"reportedMD5"`
+
+	// OffenderMD5 is the md5 of the piece fetched from the offender again by supernode.
+	OffenderMD5 string `json:"offenderMD5,omitempty"`
+
+	// WitnessPID is the other holder of the piece which the piece is cross-verified against,
+	// and it's supernode if no other peer could provide the piece.
+	WitnessPID string `json:"witnessPID,omitempty"`
+	WitnessMD5 string `json:"witnessMD5,omitempty"`
+
+	// Verdict is one of the PoisonVerdict constants.
+	Verdict string `json:"verdict"`
+}
+
+// PoisonQuery filters the poison incidents. The empty fields match all.
+type PoisonQuery struct {
+	TaskID      string
+	OffenderPID string
+	Verdict     string
+
+	// Limit is the max number of the latest incidents returned, and all are returned
+	// if it's not positive.
+	Limit int
+}
+
 // PieceErrorMgr as an interface defines all operations to handle piece errors.
 type PieceErrorMgr interface {
 	// StartHandleError starts a goroutine to handle the piece error.
@@ -31,4 +86,8 @@ type PieceErrorMgr interface {
 	// it failed to download a piece from supernode.
 	// And the supernode should handle the piece Error and do some repair operations.
 	HandlePieceError(ctx context.Context, pieceErrorRequest *types.PieceErrorRequest) error
+
+	// ListPoisonIncidents returns the incidents of the pieces which mismatch their md5
+	// after being downloaded from the peers, the latest first.
+	ListPoisonIncidents(ctx context.Context, query *PoisonQuery) []*PoisonIncident
 }
@@ -19,10 +19,13 @@ package pieceerror
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
@@ -58,49 +61,68 @@ type Manager struct {
 	cfg      *config.Config
 	handlers map[string]Handler
 
-	gcManager  mgr.GCMgr
-	cdnManager mgr.CDNMgr
+	gcManager        mgr.GCMgr
+	cdnManager       mgr.CDNMgr
+	peerManager      mgr.PeerMgr
+	dfgetTaskManager mgr.DfgetTaskMgr
+	progressManager  mgr.ProgressMgr
 
 	// error handler
 	pieceErrChan       chan *types.PieceErrorRequest
 	errorHandlingStore *syncmap.SyncMap
 	handledStore       *syncmap.SyncMap
+
+	// poisonIncidents are the latest incidents of the pieces which mismatch their md5
+	// after being downloaded from the peers.
+	poisonLock      sync.Mutex
+	poisonIncidents []*mgr.PoisonIncident
+
+	fetch func(url string, headers map[string]string, timeout time.Duration) (*http.Response, error)
 }
 
-func NewManager(cfg *config.Config, gcManager mgr.GCMgr, cdnManager mgr.CDNMgr) (*Manager, error) {
+func NewManager(cfg *config.Config, gcManager mgr.GCMgr, cdnManager mgr.CDNMgr, peerManager mgr.PeerMgr,
+	dfgetTaskManager mgr.DfgetTaskMgr, progressManager mgr.ProgressMgr) (*Manager, error) {
 	return &Manager{
 		cfg:                cfg,
 		handlers:           make(map[string]Handler),
 		gcManager:          gcManager,
 		cdnManager:         cdnManager,
+		peerManager:        peerManager,
+		dfgetTaskManager:   dfgetTaskManager,
+		progressManager:    progressManager,
 		pieceErrChan:       make(chan *types.PieceErrorRequest, ErrHandlerChanSize),
 		errorHandlingStore: syncmap.NewSyncMap(),
 		handledStore:       syncmap.NewSyncMap(),
+		fetch:              httputils.HTTPGetTimeout,
 	}, nil
 }
 
 // HandlePieceError the peer should report the error with related info when
 // it failed to download a piece from supernode.
 // And the supernode should handle the piece Error and do some repair operations.
+// The pieces which mismatch their md5 after being downloaded from the peers are
+// cross-verified to trace the peers serving the poisoned pieces.
 func (em *Manager) HandlePieceError(ctx context.Context, pieceErrorRequest *types.PieceErrorRequest) error {
-	// ignore the error that isn't caused by downloading from supernode
-	if !em.cfg.IsSuperPID(pieceErrorRequest.DstPid) {
+	// ignore the other errors that aren't caused by downloading from supernode
+	if !em.cfg.IsSuperPID(pieceErrorRequest.DstPid) &&
+		pieceErrorRequest.ErrorType != types.PieceErrorRequestErrorTypeFILEMD5NOTMATCH {
 		return nil
 	}
 
 	// if the error is handling, we should ignore it.
-	_, err := em.errorHandlingStore.Get(pieceErrorRequest.TaskID)
+	key := em.handlingKey(pieceErrorRequest)
+	_, err := em.errorHandlingStore.Get(key)
 	if err == nil {
 		return nil
 	}
 	if !errortypes.IsDataNotFound(err) {
-		logrus.Errorf("failed to get taskID(%s) from errorHandlingStore: %v", pieceErrorRequest.TaskID, err)
+		logrus.Errorf("failed to get %s from errorHandlingStore: %v", key, err)
 		return err
 	}
 
 	select {
 	case em.pieceErrChan <- pieceErrorRequest:
-		em.errorHandlingStore.Add(pieceErrorRequest.TaskID, true)
+		em.errorHandlingStore.Add(key, true)
 		return nil
 	default:
 		logrus.Warnf("drop piece error request: %+v", pieceErrorRequest)
@@ -159,9 +181,9 @@ func (em *Manager) deleteHandling(ctx context.Context) {
 			return true
 		}
 
-		if taskID, ok := key.(string); ok {
-			em.errorHandlingStore.Delete(taskID)
-			em.handledStore.Delete(taskID)
+		if k, ok := key.(string); ok {
+			em.errorHandlingStore.Delete(k)
+			em.handledStore.Delete(k)
 		}
 		return true
 	}
@@ -181,11 +203,15 @@ func (em *Manager) startHandleErrorPool(ctx context.Context) {
 }
 
 func (em *Manager) handleError(ctx context.Context, pieceError *types.PieceErrorRequest) error {
-	// add taskID to handledStore regardless of the result of handler
+	// add the key to handledStore regardless of the result of handler
 	defer func() {
-		em.handledStore.Add(pieceError.TaskID, time.Now())
+		em.handledStore.Add(em.handlingKey(pieceError), time.Now())
 	}()
 
+	if !em.cfg.IsSuperPID(pieceError.DstPid) {
+		return em.verifyPoison(ctx, pieceError)
+	}
+
 	handler, err := em.getHandler(ctx, pieceError.ErrorType)
 	if err != nil {
 		return errors.Wrapf(err, "failed to get handler")
@@ -194,6 +220,16 @@ func (em *Manager) handleError(ctx context.Context, pieceError *types.PieceError
 	return handler.Handle(ctx, pieceError)
 }
 
+// handlingKey returns the key of the piece error in the handling stores. The errors of
+// downloading from supernode are handled once per task, and the pieces reported to be
+// poisoned by the peers are handled once per peer and piece.
+func (em *Manager) handlingKey(pieceError *types.PieceErrorRequest) string {
+	if em.cfg.IsSuperPID(pieceError.DstPid) {
+		return pieceError.TaskID
+	}
+	return pieceError.TaskID + "/" + pieceError.DstPid + "/" + pieceError.Range
+}
+
 func (em *Manager) getHandler(ctx context.Context, errType string) (Handler, error) {
 	if v, ok := em.handlers[errType]; ok {
 		return v, nil
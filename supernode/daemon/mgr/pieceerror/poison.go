@@ -0,0 +1,202 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pieceerror
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/rangeutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPoisonIncidents is the max number of the latest poison incidents which are kept.
+	maxPoisonIncidents = 1000
+
+	// fetchPieceTimeout is the timeout of fetching a piece from a peer to verify it.
+	fetchPieceTimeout = 30 * time.Second
+)
+
+// verifyPoison cross-verifies the piece which mismatches its md5 after being downloaded
+// from a peer. The piece is fetched from the offender again, and if it still mismatches
+// the expected md5, it's fetched from another holder of the piece or read from the CDN
+// file of supernode to prove that the expected md5 is right. The offender is marked as
+// service down only if it's proven to serve the poisoned piece, so that no more pieces
+// are scheduled to be downloaded from it.
+func (em *Manager) verifyPoison(ctx context.Context, per *types.PieceErrorRequest) error {
+	pieceNum := rangeutils.CalculatePieceNum(per.Range)
+	incident := &mgr.PoisonIncident{
+		Time:        time.Now(),
+		TaskID:      per.TaskID,
+		PieceRange:  per.Range,
+		ReporterCID: per.SrcCid,
+		OffenderPID: per.DstPid,
+		OffenderIP:  per.DstIP,
+		ExpectedMD5: per.ExpectedMd5,
+		ReportedMD5: per.RealMd5,
+		Verdict:     mgr.PoisonVerdictInconclusive,
+	}
+	defer em.recordPoison(incident)
+
+	// the md5 recorded by CDN takes precedence over the reported one
+	if expected, err := em.cdnManager.GetPieceMD5(ctx, per.TaskID, pieceNum, per.Range, "default"); err == nil && expected != "" {
+		incident.ExpectedMD5 = trimPieceMD5(expected)
+	}
+
+	offenderMD5, offenderIP, err := em.fetchPieceMD5(ctx, per.DstPid, per.TaskID, per.Range, pieceNum)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch piece %s of taskID(%s) from the offender %s", per.Range, per.TaskID, per.DstPid)
+	}
+	incident.OffenderMD5 = offenderMD5
+	incident.OffenderIP = offenderIP
+	if offenderMD5 == incident.ExpectedMD5 {
+		incident.Verdict = mgr.PoisonVerdictUnconfirmed
+		return nil
+	}
+
+	incident.WitnessPID, incident.WitnessMD5 = em.witnessPieceMD5(ctx, per, pieceNum)
+	if incident.WitnessMD5 != incident.ExpectedMD5 {
+		return nil
+	}
+
+	incident.Verdict = mgr.PoisonVerdictProven
+	logrus.Warnf("peer %s is proven to serve the poisoned piece %s of taskID(%s), md5 %s expected %s",
+		per.DstPid, per.Range, per.TaskID, offenderMD5, incident.ExpectedMD5)
+	if err := em.progressManager.DeletePeerIDByPieceNum(ctx, per.TaskID, pieceNum, per.DstPid); err != nil {
+		logrus.Warnf("failed to delete the poisoned piece %s of taskID(%s) from peer %s: %v",
+			per.Range, per.TaskID, per.DstPid, err)
+	}
+	return em.progressManager.UpdatePeerServiceDown(ctx, per.DstPid)
+}
+
+// witnessPieceMD5 returns the md5 of the piece provided by another holder than the offender
+// and the reporter, and supernode is used if no other peer could provide it.
+func (em *Manager) witnessPieceMD5(ctx context.Context, per *types.PieceErrorRequest, pieceNum int) (string, string) {
+	var reporterPID string
+	if dfgetTask, err := em.dfgetTaskManager.Get(ctx, per.SrcCid, per.TaskID); err == nil {
+		reporterPID = dfgetTask.PeerID
+	}
+
+	peerIDs, _ := em.progressManager.GetPeerIDsByPieceNum(ctx, per.TaskID, pieceNum)
+	for _, peerID := range peerIDs {
+		if peerID == per.DstPid || peerID == reporterPID || em.cfg.IsSuperPID(peerID) {
+			continue
+		}
+		if pieceMD5, _, err := em.fetchPieceMD5(ctx, peerID, per.TaskID, per.Range, pieceNum); err == nil {
+			return peerID, pieceMD5
+		}
+	}
+
+	pieceMD5, err := em.cdnManager.GetPieceMD5(ctx, per.TaskID, pieceNum, per.Range, "file")
+	if err != nil {
+		logrus.Warnf("failed to read piece %s of taskID(%s) from the CDN file: %v", per.Range, per.TaskID, err)
+		return "", ""
+	}
+	return em.cfg.GetSuperPID(), trimPieceMD5(pieceMD5)
+}
+
+// fetchPieceMD5 downloads the piece from the peer server of the peer in the same way
+// as dfget does, and returns the md5 of the piece and the ip of the peer.
+func (em *Manager) fetchPieceMD5(ctx context.Context, peerID, taskID, pieceRange string, pieceNum int) (string, string, error) {
+	cid, err := em.dfgetTaskManager.GetCIDByPeerIDAndTaskID(ctx, peerID, taskID)
+	if err != nil {
+		return "", "", err
+	}
+	dfgetTask, err := em.dfgetTaskManager.Get(ctx, cid, taskID)
+	if err != nil {
+		return "", "", err
+	}
+	peerInfo, err := em.peerManager.Get(ctx, peerID)
+	if err != nil {
+		return "", "", err
+	}
+
+	url := fmt.Sprintf("http://%s:%d%s", peerInfo.IP, peerInfo.Port, dfgetTask.Path)
+	// the headers required by the peer server to wrap the piece
+	headers := map[string]string{
+		"Range":     httputils.ConstructRangeStr(pieceRange),
+		"pieceNum":  strconv.Itoa(pieceNum),
+		"pieceSize": strconv.Itoa(int(dfgetTask.PieceSize)),
+	}
+	resp, err := em.fetch(url, headers, fetchPieceTimeout)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), peerInfo.IP.String(), nil
+}
+
+func (em *Manager) recordPoison(incident *mgr.PoisonIncident) {
+	em.poisonLock.Lock()
+	defer em.poisonLock.Unlock()
+
+	em.poisonIncidents = append(em.poisonIncidents, incident)
+	if len(em.poisonIncidents) > maxPoisonIncidents {
+		em.poisonIncidents = append([]*mgr.PoisonIncident(nil), em.poisonIncidents[len(em.poisonIncidents)-maxPoisonIncidents:]...)
+	}
+}
+
+// ListPoisonIncidents returns the latest poison incidents matching the query, the latest first.
+func (em *Manager) ListPoisonIncidents(ctx context.Context, query *mgr.PoisonQuery) []*mgr.PoisonIncident {
+	if query == nil {
+		query = &mgr.PoisonQuery{}
+	}
+
+	em.poisonLock.Lock()
+	defer em.poisonLock.Unlock()
+
+	result := make([]*mgr.PoisonIncident, 0)
+	for i := len(em.poisonIncidents) - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+		incident := em.poisonIncidents[i]
+		if (query.TaskID != "" && incident.TaskID != query.TaskID) ||
+			(query.OffenderPID != "" && incident.OffenderPID != query.OffenderPID) ||
+			(query.Verdict != "" && incident.Verdict != query.Verdict) {
+			continue
+		}
+		result = append(result, incident)
+	}
+	return result
+}
+
+// trimPieceMD5 removes the size appended to the md5 of the piece.
+func trimPieceMD5(pieceMD5 string) string {
+	return strings.Split(pieceMD5, ":")[0]
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pieceerror
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
+	"github.com/golang/mock/gomock"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&PoisonTestSuite{})
+}
+
+type PoisonTestSuite struct{}
+
+func md5Of(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *PoisonTestSuite) TestVerifyPoison(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	cdnMgr := mock.NewMockCDNMgr(ctl)
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	dfgetTaskMgr := mock.NewMockDfgetTaskMgr(ctl)
+	progressMgr := mock.NewMockProgressMgr(ctl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("super")
+	em, _ := NewManager(cfg, nil, cdnMgr, peerMgr, dfgetTaskMgr, progressMgr)
+	ctx := context.Background()
+
+	// the data served by each peer
+	data := map[string]string{"10.0.0.1": "bad", "10.0.0.2": "good"}
+	em.fetch = func(url string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
+		c.Check(headers["Range"], check.Equals, "bytes=0-99")
+		ip := strings.Split(strings.TrimPrefix(url, "http://"), ":")[0]
+		return &http.Response{StatusCode: http.StatusPartialContent,
+			Body: ioutil.NopCloser(strings.NewReader(data[ip]))}, nil
+	}
+	for pid, ip := range map[string]string{"p1": "10.0.0.1", "p2": "10.0.0.2"} {
+		cid := "c" + pid
+		dfgetTaskMgr.EXPECT().GetCIDByPeerIDAndTaskID(gomock.Any(), pid, "foo").Return(cid, nil).AnyTimes()
+		dfgetTaskMgr.EXPECT().Get(gomock.Any(), cid, "foo").Return(&types.DfGetTask{
+			PeerID: pid, Path: "/peer/file/foo", PieceSize: 100}, nil).AnyTimes()
+		peerMgr.EXPECT().Get(gomock.Any(), pid).Return(&types.PeerInfo{
+			ID: pid, IP: strfmt.IPv4(ip), Port: 15000}, nil).AnyTimes()
+	}
+	dfgetTaskMgr.EXPECT().Get(gomock.Any(), "reporter", "foo").Return(&types.DfGetTask{PeerID: "p3"}, nil).AnyTimes()
+	cdnMgr.EXPECT().GetPieceMD5(gomock.Any(), "foo", 0, "0-99", "default").Return(md5Of("good")+":100", nil).AnyTimes()
+
+	request := &types.PieceErrorRequest{
+		TaskID:      "foo",
+		Range:       "0-99",
+		SrcCid:      "reporter",
+		DstPid:      "p1",
+		ErrorType:   types.PieceErrorRequestErrorTypeFILEMD5NOTMATCH,
+		ExpectedMd5: md5Of("good"),
+		RealMd5:     md5Of("bad"),
+	}
+
+	// p2 proves that p1 serves the poisoned piece
+	progressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "foo", 0).Return([]string{"super", "p1", "p3", "p2"}, nil)
+	progressMgr.EXPECT().DeletePeerIDByPieceNum(gomock.Any(), "foo", 0, "p1").Return(nil)
+	progressMgr.EXPECT().UpdatePeerServiceDown(gomock.Any(), "p1").Return(nil)
+	c.Assert(em.handleError(ctx, request), check.IsNil)
+
+	// p2 serves the expected piece
+	request.DstPid = "p2"
+	c.Assert(em.handleError(ctx, request), check.IsNil)
+
+	// the CDN file doesn't prove the expected md5
+	request.DstPid = "p1"
+	progressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "foo", 0).Return(nil, nil)
+	cdnMgr.EXPECT().GetPieceMD5(gomock.Any(), "foo", 0, "0-99", "file").Return(md5Of("bad"), nil)
+	c.Assert(em.handleError(ctx, request), check.IsNil)
+
+	incidents := em.ListPoisonIncidents(ctx, nil)
+	c.Assert(incidents, check.HasLen, 3)
+	c.Check(incidents[0].Verdict, check.Equals, mgr.PoisonVerdictInconclusive)
+	c.Check(incidents[0].WitnessPID, check.Equals, "super")
+	c.Check(incidents[1].Verdict, check.Equals, mgr.PoisonVerdictUnconfirmed)
+	c.Check(incidents[2].Verdict, check.Equals, mgr.PoisonVerdictProven)
+	c.Check(incidents[2].OffenderIP, check.Equals, "10.0.0.1")
+	c.Check(incidents[2].OffenderMD5, check.Equals, md5Of("bad"))
+	c.Check(incidents[2].WitnessPID, check.Equals, "p2")
+
+	proven := em.ListPoisonIncidents(ctx, &mgr.PoisonQuery{OffenderPID: "p1", Verdict: mgr.PoisonVerdictProven})
+	c.Check(proven, check.HasLen, 1)
+	c.Check(em.ListPoisonIncidents(ctx, &mgr.PoisonQuery{Limit: 1}), check.HasLen, 1)
+	c.Check(em.ListPoisonIncidents(ctx, &mgr.PoisonQuery{TaskID: "bar"}), check.HasLen, 0)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
+)
+
+// PriorityLevels is the number of the levels of the priority classes.
+const PriorityLevels = 3
+
+// PriorityLevel returns the level in [0, PriorityLevels) of the priority class,
+// the downloads of a higher level are preferred. The unspecified and unknown
+// priorities are treated as normal.
+func PriorityLevel(priority types.Priority) int {
+	switch priority {
+	case types.PriorityHigh:
+		return 2
+	case types.PriorityLow:
+		return 0
+	}
+	return 1
+}
+
+// GroupUrgent returns whether the deadline of a task group in unix milliseconds is
+// within urgentWindow after now or has passed. It's never urgent if the group has
+// no deadline or urgentWindow is 0.
+func GroupUrgent(deadline int64, urgentWindow time.Duration, now time.Time) bool {
+	if deadline <= 0 || urgentWindow <= 0 {
+		return false
+	}
+	return timeutils.MillisToTime(deadline).Sub(now) <= urgentWindow
+}
+
+// SchedulePriority returns the priority which the dfget task is scheduled with, which
+// is high if the group of the dfget task is urgent, so the files of the group such as
+// the layers of an image finish together in time.
+func SchedulePriority(dfgetTask *types.DfGetTask, urgentWindow time.Duration, now time.Time) types.Priority {
+	if dfgetTask.Group != "" && GroupUrgent(dfgetTask.GroupDeadline, urgentWindow, now) {
+		return types.PriorityHigh
+	}
+	return dfgetTask.Priority
+}
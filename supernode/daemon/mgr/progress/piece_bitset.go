@@ -0,0 +1,130 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/willf/bitset"
+)
+
+const (
+	// bitsPerPiece is the number of bits which stores the status of a piece,
+	// and a word stores the status of 8 pieces.
+	bitsPerPiece   = 8
+	piecesPerWord  = 64 / bitsPerPiece
+	wordsPerSector = 64
+)
+
+// pieceSector is a fixed-size block of the words of a pieceBitSet.
+// The sectors are never reallocated, so the words can be updated with atomic operations.
+type pieceSector [wordsPerSector]uint64
+
+// pieceBitSet maintains the status of each piece of a task with the same layout
+// as the bitset of progress: the bit at pieceNum*8+pieceStatus is set.
+//
+// The status of a piece is updated with a CAS of the word which contains it,
+// so the updates of a task don't contend on any lock. Only growing the bitset
+// for the pieces beyond the allocated sectors is guarded by a mutex.
+type pieceBitSet struct {
+	growLock sync.Mutex
+	// sectors stores []*pieceSector, which is replaced rather than modified when growing.
+	sectors atomic.Value
+}
+
+func newPieceBitSet() *pieceBitSet {
+	b := &pieceBitSet{}
+	b.sectors.Store([]*pieceSector{})
+	return b
+}
+
+// word returns the address of the word which stores the status of pieceNum.
+// It returns nil if the word isn't allocated and grow is false.
+func (b *pieceBitSet) word(pieceNum int, grow bool) *uint64 {
+	w := pieceNum / piecesPerWord
+	index := w / wordsPerSector
+
+	sectors := b.sectors.Load().([]*pieceSector)
+	if index >= len(sectors) {
+		if !grow {
+			return nil
+		}
+		sectors = b.grow(index + 1)
+	}
+	return &sectors[index][w%wordsPerSector]
+}
+
+func (b *pieceBitSet) grow(count int) []*pieceSector {
+	b.growLock.Lock()
+	defer b.growLock.Unlock()
+
+	sectors := b.sectors.Load().([]*pieceSector)
+	if count <= len(sectors) {
+		return sectors
+	}
+	grown := make([]*pieceSector, count)
+	copy(grown, sectors)
+	for i := len(sectors); i < count; i++ {
+		grown[i] = &pieceSector{}
+	}
+	b.sectors.Store(grown)
+	return grown
+}
+
+// update updates the status of pieceNum, and it returns false
+// if the piece has been successful already.
+func (b *pieceBitSet) update(pieceNum, pieceStatus int) bool {
+	if pieceNum < 0 {
+		return false
+	}
+	if pieceStatus == config.PieceSEMISUC {
+		pieceStatus = config.PieceSUCCESS
+	}
+
+	shift := uint(pieceNum%piecesPerWord) * bitsPerPiece
+	var status uint64
+	// keep the bits of pieceNum equal to 0 if the pieceStatus equals waiting.
+	if pieceStatus != config.PieceWAITING {
+		status = 1 << uint(pieceStatus) << shift
+	}
+
+	addr := b.word(pieceNum, true)
+	for {
+		old := atomic.LoadUint64(addr)
+		if old&(1<<uint(config.PieceSUCCESS)<<shift) != 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(addr, old, old&^(0xff<<shift)|status) {
+			return true
+		}
+	}
+}
+
+// snapshot returns a copy of the bitset which isn't changed by the later updates.
+func (b *pieceBitSet) snapshot() *bitset.BitSet {
+	sectors := b.sectors.Load().([]*pieceSector)
+	words := make([]uint64, 0, len(sectors)*wordsPerSector)
+	for _, s := range sectors {
+		for i := range s {
+			words = append(words, atomic.LoadUint64(&s[i]))
+		}
+	}
+	return bitset.From(words)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/willf/bitset"
+)
+
+func init() {
+	check.Suite(&PieceBitSetTestSuite{})
+}
+
+type PieceBitSetTestSuite struct{}
+
+func (s *PieceBitSetTestSuite) TestUpdateConcurrently(c *check.C) {
+	var (
+		pieceTotal = piecesPerWord * wordsPerSector * 3
+		b          = newPieceBitSet()
+		wg         sync.WaitGroup
+		updated    int32
+	)
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < pieceTotal; i++ {
+				b.update(i, config.PieceRUNNING)
+				if b.update(i, config.PieceSUCCESS) {
+					atomic.AddInt32(&updated, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every piece becomes successful exactly once, and it won't be changed then.
+	c.Check(int(updated), check.Equals, pieceTotal)
+	snapshot := b.snapshot()
+	c.Check(int(snapshot.Count()), check.Equals, pieceTotal)
+	for i := 0; i < pieceTotal; i++ {
+		c.Check(snapshot.Test(uint(i*bitsPerPiece+config.PieceSUCCESS)), check.Equals, true)
+	}
+	c.Check(b.update(0, config.PieceFAILED), check.Equals, false)
+	c.Check(b.update(-1, config.PieceSUCCESS), check.Equals, false)
+}
+
+func (s *PieceBitSetTestSuite) TestSnapshot(c *check.C) {
+	b := newPieceBitSet()
+	c.Check(b.snapshot().Count(), check.Equals, uint(0))
+
+	b.update(1, config.PieceSUCCESS)
+	snapshot := b.snapshot()
+	b.update(2, config.PieceSUCCESS)
+	c.Check(snapshot.Count(), check.Equals, uint(1))
+	c.Check(snapshot.Test(9), check.Equals, true)
+	c.Check(b.snapshot().Count(), check.Equals, uint(2))
+}
+
+func (s *PieceBitSetTestSuite) TestStateSyncMapShards(c *check.C) {
+	mmap := newStateSyncMap()
+	for i := 0; i < 100; i++ {
+		c.Assert(mmap.add(fmt.Sprint(i), i), check.IsNil)
+	}
+	count := 0
+	mmap.rangeAll(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	c.Check(count, check.Equals, 100)
+
+	count = 0
+	mmap.rangeAll(func(key, value interface{}) bool {
+		count++
+		return count < 10
+	})
+	c.Check(count, check.Equals, 10)
+
+	c.Check(mmap.loadOrStore("1", -1), check.Equals, 1)
+	c.Check(mmap.remove("1"), check.IsNil)
+	_, err := mmap.get("1")
+	c.Check(err, check.NotNil)
+}
+
+// BenchmarkUpdatePieceBitSetParallel compares updating the piece bitset of a task
+// by many goroutines with the mutex-guarded bitset which it replaces.
+func BenchmarkUpdatePieceBitSetParallel(b *testing.B) {
+	const pieceTotal = 4096
+
+	b.Run("mutex", func(b *testing.B) {
+		var (
+			lock sync.Mutex
+			bs   = &bitset.BitSet{}
+			next int32
+		)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				pieceNum := int(atomic.AddInt32(&next, 1)) % pieceTotal
+				lock.Lock()
+				bs.Set(uint(pieceNum*bitsPerPiece + config.PieceRUNNING))
+				lock.Unlock()
+			}
+		})
+	})
+
+	b.Run("atomic", func(b *testing.B) {
+		var (
+			bs   = newPieceBitSet()
+			next int32
+		)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				pieceNum := int(atomic.AddInt32(&next, 1)) % pieceTotal
+				bs.update(pieceNum, config.PieceRUNNING)
+			}
+		})
+	})
+}
+
+// BenchmarkInitProgressParallel measures registering the progress of many peers concurrently.
+func BenchmarkInitProgressParallel(b *testing.B) {
+	pm, _ := NewManager(config.NewConfig())
+	ctx := context.Background()
+	var next int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := fmt.Sprint(atomic.AddInt64(&next, 1))
+			pm.InitProgress(ctx, "task", "peer"+id, "cid"+id)
+		}
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 
 	"github.com/sirupsen/logrus"
 )
@@ -45,16 +46,48 @@ func (pm *Manager) DeleteCID(ctx context.Context, clientID string) (err error) {
 }
 
 // DeletePeerID deletes the related info with specified PeerID.
+//
+// All the piece assignments of the peer are cleaned up at once,
+// including the pieces it provides and the pieces being downloaded from it,
+// so that these pieces can be scheduled to other peers immediately.
 func (pm *Manager) DeletePeerID(ctx context.Context, peerID string) error {
-	// NOTE: we should delete the peerID from the pieceProgress.
-	// However, it will cost a lot of time to find which one refers to this peerID.
-	// So we leave it to be deleted when scheduled.
 	pm.deletePeerIDFromPeerProgress(ctx, peerID)
 	pm.deletePeerIDFromBlackInfo(ctx, peerID)
+	pm.deletePeerIDFromPieceProgress(ctx, peerID)
+	pm.deleteRunningPiecesByDstPID(ctx, peerID)
 
 	return nil
 }
 
+// deletePeerIDFromPieceProgress deletes the peerID from all pieces
+// which means that the peer no longer provides the service for them.
+func (pm *Manager) deletePeerIDFromPieceProgress(ctx context.Context, peerID string) {
+	pm.pieceProgress.rangeAll(func(key, value interface{}) bool {
+		if ps, ok := value.(*pieceState); ok {
+			ps.delete(peerID)
+		}
+		return true
+	})
+}
+
+// deleteRunningPiecesByDstPID deletes the running pieces which are
+// being downloaded from the dstPID by any client.
+func (pm *Manager) deleteRunningPiecesByDstPID(ctx context.Context, dstPID string) {
+	pm.clientProgress.rangeAll(func(key, value interface{}) bool {
+		cs, ok := value.(*clientState)
+		if !ok {
+			return true
+		}
+		cs.runningPiece.Range(func(pieceNum, pid interface{}) bool {
+			if pid == dstPID {
+				cs.runningPiece.Delete(pieceNum)
+			}
+			return true
+		})
+		return true
+	})
+}
+
 func (pm *Manager) deletePeerIDFromPeerProgress(ctx context.Context, peerID string) bool {
 	if err := pm.peerProgress.remove(peerID); err != nil {
 		logrus.Errorf("failed to delete peerID(%s) from peerProgress: %v", peerID, err)
@@ -68,7 +101,13 @@ func (pm *Manager) deletePeerIDFromBlackInfo(ctx context.Context, peerID string)
 	// delete the black info which use peerID as the key
 	pm.clientBlackInfo.Delete(peerID)
 
-	// TODO: delete the black info which refers to the specified peerID
+	// delete the black info which refers to the specified peerID
+	pm.clientBlackInfo.Range(func(key, value interface{}) bool {
+		if dstPIDMap, ok := value.(*syncmap.SyncMap); ok {
+			dstPIDMap.Delete(peerID)
+		}
+		return true
+	})
 	return result
 }
 
@@ -19,12 +19,12 @@ package progress
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
-	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 
@@ -221,8 +221,8 @@ func (pm *Manager) GetPieceProgressByCID(ctx context.Context, taskID, clientID,
 	if err != nil {
 		return nil, err
 	}
-	clientBitset := cs.pieceBitSet.Clone()
-	cdnBitset := ss.pieceBitSet.Clone()
+	clientBitset := cs.pieceBitSet.snapshot()
+	cdnBitset := ss.pieceBitSet.snapshot()
 
 	// get successful pieces
 	if pieceStatus == PieceSuccess {
@@ -271,11 +271,11 @@ func (pm *Manager) UpdatePeerServiceDown(ctx context.Context, peerID string) (er
 		return errors.Wrapf(err, "failed to get peer state peerID(%s): %v", peerID, err)
 	}
 
-	if peerState.serviceDownTime > 0 {
+	if !peerState.serviceDownTime.IsZero() {
 		return fmt.Errorf("failed to update the service down info because this peer(%s) has been offline", peerID)
 	}
 
-	peerState.serviceDownTime = timeutils.GetCurrentTimeMillis()
+	peerState.serviceDownTime = time.Now()
 	return nil
 }
 
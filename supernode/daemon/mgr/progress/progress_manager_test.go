@@ -17,6 +17,7 @@
 package progress
 
 import (
+	"context"
 	"testing"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
@@ -100,3 +101,33 @@ func (s *ProgressManagerTestSuite) TestGetAvailablePieces(c *check.C) {
 		c.Check(result, check.DeepEquals, v.expected)
 	}
 }
+
+func (s *ProgressManagerTestSuite) TestDeletePeerID(c *check.C) {
+	pm, _ := NewManager(nil)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		key, _ := generatePieceProgressKey("task", i)
+		ps := newPieceState()
+		ps.add("dead")
+		ps.add("alive")
+		pm.pieceProgress.add(key, ps)
+	}
+	cs := newClientState()
+	cs.runningPiece.Add("0", "dead")
+	cs.runningPiece.Add("1", "alive")
+	pm.clientProgress.add("cid", cs)
+	pm.updateBlackInfo("alive", "dead")
+
+	c.Assert(pm.DeletePeerID(ctx, "dead"), check.IsNil)
+
+	for i := 0; i < 2; i++ {
+		peerIDs, err := pm.GetPeerIDsByPieceNum(ctx, "task", i)
+		c.Check(err, check.IsNil)
+		c.Check(peerIDs, check.DeepEquals, []string{"alive"})
+	}
+	c.Check(cs.runningPiece.ListKeyAsIntSlice(), check.DeepEquals, []int{1})
+	dstPIDMap, err := pm.GetBlackInfoByPeerID(ctx, "alive")
+	c.Assert(err, check.IsNil)
+	c.Check(dstPIDMap.ListKeyAsStringSlice(), check.HasLen, 0)
+}
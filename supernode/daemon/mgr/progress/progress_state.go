@@ -21,20 +21,18 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
-
-	"github.com/willf/bitset"
 )
 
 type superState struct {
 	// pieceBitSet maintains the piece bitSet of CID
 	// which means that the status of each pieces of the task corresponding to taskID on the supernode.
-	pieceBitSet *bitset.BitSet
+	pieceBitSet *pieceBitSet
 }
 
 type clientState struct {
 	// pieceBitSet maintains the piece bitSet of CID
 	// which means that the status of each pieces of the task on the peer corresponding to cid.
-	pieceBitSet *bitset.BitSet
+	pieceBitSet *pieceBitSet
 
 	// runningPiece maintains the pieces currently being downloaded from dstCID to srcCID.
 	// key:pieceNum,value:dstPID
@@ -60,7 +58,7 @@ type peerState struct {
 	serviceErrorCount *atomiccount.AtomicInt
 
 	// serviceDownTime the down time of the peer service.
-	serviceDownTime int64
+	serviceDownTime time.Time
 }
 
 type superLoadState struct {
@@ -73,13 +71,13 @@ type superLoadState struct {
 
 func newSuperState() *superState {
 	return &superState{
-		pieceBitSet: &bitset.BitSet{},
+		pieceBitSet: newPieceBitSet(),
 	}
 }
 
 func newClientState() *clientState {
 	return &clientState{
-		pieceBitSet:  &bitset.BitSet{},
+		pieceBitSet:  newPieceBitSet(),
 		runningPiece: syncmap.NewSyncMap(),
 	}
 }
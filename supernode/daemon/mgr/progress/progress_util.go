@@ -28,7 +28,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/willf/bitset"
 )
 
 // updatePieceProgress adds a new peer for the pieceNum when the srcPID successfully downloads the piece.
@@ -110,25 +109,8 @@ func updateRunningPiece(dstPIDMap *syncmap.SyncMap, srcCID, dstPID string, piece
 }
 
 // updatePieceBitSet adds a new piece for srcCID when it successfully downloads the piece.
-func updatePieceBitSet(pieceBitSet *bitset.BitSet, pieceNum, pieceStatus int) bool {
-	if pieceBitSet.Test(uint(getStartIndexByPieceNum(pieceNum) + config.PieceSUCCESS)) {
-		return false
-	}
-
-	// clear the bits from pieceNum * 8 to (pieceNum+1)*8 at first.
-	for i := getStartIndexByPieceNum(pieceNum); i < getStartIndexByPieceNum(pieceNum+1); i++ {
-		pieceBitSet.Clear(uint(i))
-	}
-	// if the pieceStatus equals waiting,
-	// keep bits from pieceNum * 8 to (pieceNum+1)*8 equals to 0.
-	if pieceStatus == config.PieceWAITING {
-		return true
-	}
-	if pieceStatus == config.PieceSEMISUC {
-		pieceStatus = config.PieceSUCCESS
-	}
-	pieceBitSet.Set(uint(pieceNum*8 + pieceStatus))
-	return true
+func updatePieceBitSet(pieceBitSet *pieceBitSet, pieceNum, pieceStatus int) bool {
+	return pieceBitSet.update(pieceNum, pieceStatus)
 }
 
 // updatePeerProgress updates the peer progress.
@@ -36,7 +36,8 @@ func (s *ProgressUtilTestSuite) TestUpdatePieceBitset(c *check.C) {
 		desc        string
 		pieceNum    int
 		pieceStatus int
-		pieceBitSet *bitset.BitSet
+		// initStatus is the status of pieceNum before updating, it's ignored if negative
+		initStatus int
 
 		updateResult   bool
 		expectedBitSet *bitset.BitSet
@@ -45,7 +46,7 @@ func (s *ProgressUtilTestSuite) TestUpdatePieceBitset(c *check.C) {
 			desc:        "update piece status to PieceSUCCESS",
 			pieceNum:    0,
 			pieceStatus: config.PieceSUCCESS,
-			pieceBitSet: bitset.New(8),
+			initStatus:  -1,
 
 			updateResult:   true,
 			expectedBitSet: bitset.New(8).Set(1),
@@ -54,7 +55,7 @@ func (s *ProgressUtilTestSuite) TestUpdatePieceBitset(c *check.C) {
 			desc:        "update piece status to PieceSEMISUC",
 			pieceNum:    1,
 			pieceStatus: config.PieceSEMISUC,
-			pieceBitSet: bitset.New(16),
+			initStatus:  -1,
 
 			updateResult:   true,
 			expectedBitSet: bitset.New(16).Set(9),
@@ -63,7 +64,7 @@ func (s *ProgressUtilTestSuite) TestUpdatePieceBitset(c *check.C) {
 			desc:        "update piece status to PieceWAITING",
 			pieceNum:    1,
 			pieceStatus: config.PieceWAITING,
-			pieceBitSet: bitset.New(16).Set(8),
+			initStatus:  config.PieceRUNNING,
 
 			updateResult:   true,
 			expectedBitSet: bitset.New(16),
@@ -73,7 +74,7 @@ func (s *ProgressUtilTestSuite) TestUpdatePieceBitset(c *check.C) {
 		    and the result should be false`,
 			pieceNum:    1,
 			pieceStatus: config.PieceFAILED,
-			pieceBitSet: bitset.New(16).Set(9),
+			initStatus:  config.PieceSUCCESS,
 
 			updateResult:   false,
 			expectedBitSet: bitset.New(16).Set(9),
@@ -81,9 +82,16 @@ func (s *ProgressUtilTestSuite) TestUpdatePieceBitset(c *check.C) {
 	}
 
 	for _, v := range cases {
-		result := updatePieceBitSet(v.pieceBitSet, v.pieceNum, v.pieceStatus)
-		c.Check(result, check.Equals, v.updateResult)
-		c.Check(v.pieceBitSet, check.DeepEquals, v.expectedBitSet)
+		pieceBitSet := newPieceBitSet()
+		if v.initStatus >= 0 {
+			pieceBitSet.update(v.pieceNum, v.initStatus)
+		}
+		result := updatePieceBitSet(pieceBitSet, v.pieceNum, v.pieceStatus)
+		c.Check(result, check.Equals, v.updateResult, check.Commentf(v.desc))
+		c.Check(pieceBitSet.snapshot().Count(), check.Equals, v.expectedBitSet.Count())
+		for i, e := v.expectedBitSet.NextSet(0); e; i, e = v.expectedBitSet.NextSet(i + 1) {
+			c.Check(pieceBitSet.snapshot().Test(i), check.Equals, true, check.Commentf(v.desc))
+		}
 	}
 }
 
@@ -23,27 +23,72 @@ import (
 	"github.com/pkg/errors"
 )
 
+// stateShardCount is the number of the shards of a stateSyncMap.
+const stateShardCount = 32
+
 // stateSyncMap is a thread-safe map for progress state.
+//
+// The states are sharded by the hash of their keys, which are the taskIDs, CIDs or PeerIDs,
+// so that storing the states of thousands of peers doesn't serialize on the single
+// dirty map of a sync.Map.
 type stateSyncMap struct {
-	*syncmap.SyncMap
+	shards [stateShardCount]*syncmap.SyncMap
 }
 
 // newStateSyncMap returns a new stateSyncMap.
 func newStateSyncMap() *stateSyncMap {
-	return &stateSyncMap{syncmap.NewSyncMap()}
+	mmap := &stateSyncMap{}
+	for i := range mmap.shards {
+		mmap.shards[i] = syncmap.NewSyncMap()
+	}
+	return mmap
+}
+
+// shard returns the shard which stores the key with the FNV-1a hash of it.
+func (mmap *stateSyncMap) shard(key string) *syncmap.SyncMap {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return mmap.shards[h%stateShardCount]
 }
 
 // add a key-value pair into the *sync.Map.
 // The ErrEmptyValue error will be returned if the key is empty.
 func (mmap *stateSyncMap) add(key string, value interface{}) error {
-	return mmap.Add(key, value)
+	return mmap.shard(key).Add(key, value)
 }
 
 // get returns result as interface{} according to the key.
 // The ErrEmptyValue error will be returned if the key is empty.
 // And the ErrDataNotFound error will be returned if the key cannot be found.
 func (mmap *stateSyncMap) get(key string) (interface{}, error) {
-	return mmap.Get(key)
+	return mmap.shard(key).Get(key)
+}
+
+// loadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+func (mmap *stateSyncMap) loadOrStore(key string, value interface{}) interface{} {
+	v, _ := mmap.shard(key).LoadOrStore(key, value)
+	return v
+}
+
+// rangeAll calls f sequentially for each key and value in all shards.
+// If f returns false, rangeAll stops the iteration.
+func (mmap *stateSyncMap) rangeAll(f func(key, value interface{}) bool) {
+	for _, shard := range mmap.shards {
+		stopped := false
+		shard.Range(func(key, value interface{}) bool {
+			if !f(key, value) {
+				stopped = true
+			}
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
 }
 
 // getAsSuperState returns result as *superState.
@@ -106,5 +151,5 @@ func (mmap *stateSyncMap) getAsPieceState(key string) (*pieceState, error) {
 // The ErrEmptyValue error will be returned if the key is empty.
 // And the ErrDataNotFound error will be returned if the key cannot be found.
 func (mmap *stateSyncMap) remove(key string) error {
-	return mmap.Remove(key)
+	return mmap.shard(key).Remove(key)
 }
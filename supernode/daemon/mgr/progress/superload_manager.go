@@ -36,7 +36,7 @@ const (
 //
 // It's considered as a failure when then superload is greater than limit after adding delta.
 func (pm *Manager) UpdateSuperLoad(ctx context.Context, taskID string, delta, limit int32) (updated bool, err error) {
-	v, _ := pm.superLoad.LoadOrStore(taskID, newSuperLoadState())
+	v := pm.superLoad.loadOrStore(taskID, newSuperLoadState())
 	loadState, ok := v.(*superLoadState)
 	if !ok {
 		return false, errortypes.ErrConvertFailed
@@ -74,5 +74,5 @@ func (pm *Manager) renewSuperLoad() {
 		return true
 	}
 
-	pm.superLoad.Range(rangeFunc)
+	pm.superLoad.rangeAll(rangeFunc)
 }
@@ -18,6 +18,7 @@ package mgr
 
 import (
 	"context"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
@@ -38,8 +39,10 @@ type PeerState struct {
 	// ServiceErrorCount maintains the number of times that the other peer nodes failed to downloaded from the PeerID.
 	ServiceErrorCount *atomiccount.AtomicInt
 
-	// ServiceDownTime the down time of the peer service.
-	ServiceDownTime int64
+	// ServiceDownTime the down time of the peer service, which is zero if the service isn't down.
+	// It carries the monotonic clock reading, so the elapsed time since it isn't affected
+	// by the steps of the wall clock.
+	ServiceDownTime time.Time
 }
 
 // ProgressMgr is responsible for maintaining the correspondence between peer and pieces.
@@ -0,0 +1,230 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package purge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var _ mgr.PurgeMgr = &Manager{}
+
+// purge records the uploaders which hold the purged task, by their addresses.
+type purge struct {
+	taskID        string
+	pending       map[string]bool
+	purged        map[string]bool
+	createdTime   time.Time
+	completedTime time.Time
+}
+
+func (p *purge) complete(now time.Time) {
+	if len(p.pending) == 0 && p.completedTime.IsZero() {
+		p.completedTime = now
+		logrus.Infof("purge of task %s completed, %d peers purged", p.taskID, len(p.purged))
+	}
+}
+
+func (p *purge) info() *types.TaskPurge {
+	info := &types.TaskPurge{
+		TaskID:       p.taskID,
+		Status:       types.TaskPurgeStatusPURGING,
+		PendingPeers: sortedKeys(p.pending),
+		PurgedPeers:  sortedKeys(p.purged),
+		CreatedTime:  strfmt.DateTime(p.createdTime),
+	}
+	if len(p.pending) == 0 {
+		info.Status = types.TaskPurgeStatusCOMPLETED
+		info.CompletedTime = strfmt.DateTime(p.completedTime)
+	}
+	return info
+}
+
+// Manager is an implementation of the interface of PurgeMgr.
+//
+// NOTE: The purges are kept in memory, so the uploaders which haven't reported
+// deleting the files of a purged task before supernode restarts are not instructed again.
+type Manager struct {
+	sync.Mutex
+
+	cfg          *config.Config
+	gcMgr        mgr.GCMgr
+	peerMgr      mgr.PeerMgr
+	dfgetTaskMgr mgr.DfgetTaskMgr
+
+	purges map[string]*purge
+
+	now func() time.Time
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config, gcMgr mgr.GCMgr, peerMgr mgr.PeerMgr,
+	dfgetTaskMgr mgr.DfgetTaskMgr) (*Manager, error) {
+	return &Manager{
+		cfg:          cfg,
+		gcMgr:        gcMgr,
+		peerMgr:      peerMgr,
+		dfgetTaskMgr: dfgetTaskMgr,
+		purges:       make(map[string]*purge),
+		now:          time.Now,
+	}, nil
+}
+
+// Purge deletes the task and its CDN files from supernode. The uploaders of the peers
+// which have registered to download the task are pending until they report deleting
+// their files of it, and so are the ones reporting the task by heart beats later.
+func (m *Manager) Purge(ctx context.Context, taskID string) (*types.TaskPurge, error) {
+	if taskID == "" {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+	// the holders must be listed before the dfget tasks are deleted by gc
+	holders := m.listHolders(ctx, taskID)
+	m.gcMgr.GCTask(ctx, taskID, true)
+
+	m.Lock()
+	defer m.Unlock()
+	now := m.now()
+	p, ok := m.purges[taskID]
+	if !ok {
+		p = &purge{
+			taskID:  taskID,
+			pending: make(map[string]bool),
+			purged:  make(map[string]bool),
+		}
+		m.purges[taskID] = p
+	}
+	p.createdTime = now
+	p.completedTime = time.Time{}
+	for _, addr := range holders {
+		// the peer may have downloaded the task again since the last purge
+		delete(p.purged, addr)
+		p.pending[addr] = true
+	}
+	logrus.Infof("purge task %s, %d peers pending", taskID, len(p.pending))
+	p.complete(now)
+	return p.info(), nil
+}
+
+// listHolders returns the addresses of the uploaders of the peers which have registered
+// to download the task, supernode itself excluded.
+func (m *Manager) listHolders(ctx context.Context, taskID string) []string {
+	cids, err := m.dfgetTaskMgr.GetCIDsByTaskID(ctx, taskID)
+	if err != nil {
+		logrus.Warnf("failed to get the clients of task %s to purge: %v", taskID, err)
+		return nil
+	}
+	var holders []string
+	for _, cid := range cids {
+		if m.cfg.IsSuperCID(cid) {
+			continue
+		}
+		dfgetTask, err := m.dfgetTaskMgr.Get(ctx, cid, taskID)
+		if err != nil {
+			continue
+		}
+		peer, err := m.peerMgr.Get(ctx, dfgetTask.PeerID)
+		if err != nil {
+			continue
+		}
+		holders = append(holders, fmt.Sprintf("%s:%d", peer.IP, peer.Port))
+	}
+	return holders
+}
+
+// Get returns the purge of the task.
+func (m *Manager) Get(ctx context.Context, taskID string) (*types.TaskPurge, error) {
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.purges[taskID]
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "purge of task %s", taskID)
+	}
+	return p.info(), nil
+}
+
+// List returns the purges of all tasks sorted by the created time.
+func (m *Manager) List(ctx context.Context) []*types.TaskPurge {
+	m.Lock()
+	defer m.Unlock()
+	result := make([]*types.TaskPurge, 0, len(m.purges))
+	for _, p := range m.purges {
+		result = append(result, p.info())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return time.Time(result[i].CreatedTime).Before(time.Time(result[j].CreatedTime))
+	})
+	return result
+}
+
+// TakePurges records the purged tasks deleted by the uploader, and returns the IDs
+// of the purged tasks which it's pending for, sorted.
+func (m *Manager) TakePurges(ctx context.Context, ip string, port int32, taskIDs, purgedTaskIDs []string) []string {
+	addr := fmt.Sprintf("%s:%d", ip, port)
+	m.Lock()
+	defer m.Unlock()
+	if len(m.purges) == 0 {
+		return nil
+	}
+
+	now := m.now()
+	for _, taskID := range purgedTaskIDs {
+		if p, ok := m.purges[taskID]; ok {
+			delete(p.pending, addr)
+			p.purged[addr] = true
+			p.complete(now)
+		}
+	}
+	// the uploader still serving a purged task is unknown to supernode if it has been
+	// deleted from supernode before the purge, or it's imported from a cache archive.
+	for _, taskID := range taskIDs {
+		if p, ok := m.purges[taskID]; ok && !p.pending[addr] {
+			delete(p.purged, addr)
+			p.pending[addr] = true
+			p.completedTime = time.Time{}
+		}
+	}
+
+	var result []string
+	for taskID, p := range m.purges {
+		if p.pending[addr] {
+			result = append(result, taskID)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
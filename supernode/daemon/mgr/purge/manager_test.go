@@ -0,0 +1,103 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package purge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&PurgeManagerTestSuite{})
+}
+
+type PurgeManagerTestSuite struct{}
+
+// fakeGCMgr records the tasks deleted by GCTask, and the other methods of GCMgr are not used.
+type fakeGCMgr struct {
+	mgr.GCMgr
+	deleted map[string]bool
+}
+
+func (f *fakeGCMgr) GCTask(ctx context.Context, taskID string, full bool) {
+	f.deleted[taskID] = full
+}
+
+func (s *PurgeManagerTestSuite) TestPurge(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	dfgetTaskMgr := mock.NewMockDfgetTaskMgr(ctl)
+	gcMgr := &fakeGCMgr{deleted: make(map[string]bool)}
+
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	superCID := cfg.GetSuperCID("foo")
+	dfgetTaskMgr.EXPECT().GetCIDsByTaskID(gomock.Any(), "foo").Return([]string{"c1", "c2", superCID}, nil)
+	dfgetTaskMgr.EXPECT().Get(gomock.Any(), "c1", "foo").Return(&types.DfGetTask{PeerID: "p1"}, nil)
+	dfgetTaskMgr.EXPECT().Get(gomock.Any(), "c2", "foo").Return(&types.DfGetTask{PeerID: "p2"}, nil)
+	peerMgr.EXPECT().Get(gomock.Any(), "p1").Return(&types.PeerInfo{IP: "1.1.1.1", Port: 15001}, nil)
+	peerMgr.EXPECT().Get(gomock.Any(), "p2").Return(&types.PeerInfo{IP: "2.2.2.2", Port: 15001}, nil)
+
+	manager, err := NewManager(cfg, gcMgr, peerMgr, dfgetTaskMgr)
+	c.Assert(err, check.IsNil)
+	ctx := context.Background()
+
+	purge, err := manager.Purge(ctx, "foo")
+	c.Assert(err, check.IsNil)
+	c.Check(gcMgr.deleted, check.DeepEquals, map[string]bool{"foo": true})
+	c.Check(purge.Status, check.Equals, types.TaskPurgeStatusPURGING)
+	c.Check(purge.PendingPeers, check.DeepEquals, []string{"1.1.1.1:15001", "2.2.2.2:15001"})
+
+	// the uploader which doesn't hold the task is told nothing
+	c.Check(manager.TakePurges(ctx, "3.3.3.3", 15001, []string{"bar"}, nil), check.IsNil)
+	// the pending uploader is told until it reports deleting the task
+	c.Check(manager.TakePurges(ctx, "1.1.1.1", 15001, nil, nil), check.DeepEquals, []string{"foo"})
+	c.Check(manager.TakePurges(ctx, "1.1.1.1", 15001, nil, []string{"foo"}), check.IsNil)
+	// the uploader unknown to supernode joins the purge by reporting the task
+	c.Check(manager.TakePurges(ctx, "3.3.3.3", 15001, []string{"foo"}, nil), check.DeepEquals, []string{"foo"})
+
+	purge, err = manager.Get(ctx, "foo")
+	c.Assert(err, check.IsNil)
+	c.Check(purge.PendingPeers, check.DeepEquals, []string{"2.2.2.2:15001", "3.3.3.3:15001"})
+	c.Check(purge.PurgedPeers, check.DeepEquals, []string{"1.1.1.1:15001"})
+
+	manager.TakePurges(ctx, "2.2.2.2", 15001, nil, []string{"foo"})
+	manager.TakePurges(ctx, "3.3.3.3", 15001, nil, []string{"foo"})
+	purge, err = manager.Get(ctx, "foo")
+	c.Assert(err, check.IsNil)
+	c.Check(purge.Status, check.Equals, types.TaskPurgeStatusCOMPLETED)
+	c.Check(purge.PendingPeers, check.HasLen, 0)
+	c.Check(purge.CompletedTime.String(), check.Not(check.Equals), "")
+	c.Check(manager.List(ctx), check.HasLen, 1)
+
+	_, err = manager.Get(ctx, "bar")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
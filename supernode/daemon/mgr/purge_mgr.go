@@ -0,0 +1,42 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// PurgeMgr as an interface defines all operations to purge all copies of the tasks
+// from supernode and the peers, such as for the data-deletion requests.
+type PurgeMgr interface {
+	// Purge deletes the task and its files from supernode, and records the uploaders
+	// of the peers holding the task, which are instructed to delete their files of it.
+	Purge(ctx context.Context, taskID string) (*types.TaskPurge, error)
+
+	// Get returns the purge of the task.
+	Get(ctx context.Context, taskID string) (*types.TaskPurge, error)
+
+	// List returns the purges of all tasks sorted by the created time.
+	List(ctx context.Context) []*types.TaskPurge
+
+	// TakePurges records the tasks whose files the uploader listening on the ip and port
+	// has deleted, and returns the purged tasks which it should delete, including the ones
+	// in taskIDs reported by it. They're sent to it with the response of its heart beat.
+	TakePurges(ctx context.Context, ip string, port int32, taskIDs, purgedTaskIDs []string) []string
+}
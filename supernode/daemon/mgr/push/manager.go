@@ -0,0 +1,313 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package push
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/progress"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var _ mgr.PushMgr = &Manager{}
+
+// repushIntervals is the number of the intervals in which a piece isn't pushed
+// to the same peer again.
+const repushIntervals = 3
+
+type metrics struct {
+	stragglers *prometheus.GaugeVec
+	pieces     *prometheus.CounterVec
+}
+
+func newMetrics(register prometheus.Registerer) *metrics {
+	return &metrics{
+		stragglers: metricsutils.NewGauge(config.SubsystemSupernode, "push_stragglers",
+			"The number of the nearly-complete downloads which make no progress in the last push interval.",
+			[]string{}, register),
+		pieces: metricsutils.NewCounter(config.SubsystemSupernode, "push_pieces_total",
+			"Total number of the pieces assigned to the uploaders of the seeders to be pushed to the stragglers.",
+			[]string{}, register),
+	}
+}
+
+// uploader is the uploader of an alive peer.
+type uploader struct {
+	addr string
+	peer *types.PeerInfo
+}
+
+// Manager is an implementation of the interface of PushMgr.
+type Manager struct {
+	sync.Mutex
+
+	cfg          *config.Config
+	taskMgr      mgr.TaskMgr
+	peerMgr      mgr.PeerMgr
+	dfgetTaskMgr mgr.DfgetTaskMgr
+	progressMgr  mgr.ProgressMgr
+	metrics      *metrics
+
+	// progress records the number of the pieces downloaded by every client at the last check,
+	// pushed records when every piece is pushed to a client, and pending holds the pieces
+	// not taken by the uploaders yet.
+	progress map[string]int
+	pushed   map[string]map[int]time.Time
+	pending  map[string][]*types.PushTask
+
+	now func() time.Time
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config, taskMgr mgr.TaskMgr, peerMgr mgr.PeerMgr, dfgetTaskMgr mgr.DfgetTaskMgr,
+	progressMgr mgr.ProgressMgr, register prometheus.Registerer) (*Manager, error) {
+	return &Manager{
+		cfg:          cfg,
+		taskMgr:      taskMgr,
+		peerMgr:      peerMgr,
+		dfgetTaskMgr: dfgetTaskMgr,
+		progressMgr:  progressMgr,
+		metrics:      newMetrics(register),
+		progress:     make(map[string]int),
+		pushed:       make(map[string]map[int]time.Time),
+		pending:      make(map[string][]*types.PushTask),
+		now:          time.Now,
+	}, nil
+}
+
+// StartPush starts the job which checks the progress of the peers accepting the pushed
+// pieces every PushInterval. It does nothing if the PushThreshold is not positive, or the
+// pieces served by the peers aren't wrapped by the piece meta with the source CDN pattern.
+func (m *Manager) StartPush(ctx context.Context) {
+	if m.cfg.PushThreshold <= 0 || m.cfg.CDNPattern == config.CDNPatternSource {
+		return
+	}
+	logrus.Infof("start pushing the missing pieces to the stragglers, threshold: %v, interval: %v",
+		m.cfg.PushThreshold, m.interval())
+
+	go func() {
+		ticker := time.NewTicker(m.interval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	}()
+}
+
+// TakePushes returns and clears the pending pushes of the uploader.
+func (m *Manager) TakePushes(ctx context.Context, ip string, port int32) []*types.PushTask {
+	addr := fmt.Sprintf("%s:%d", ip, port)
+	m.Lock()
+	defer m.Unlock()
+	tasks := m.pending[addr]
+	delete(m.pending, addr)
+	return tasks
+}
+
+func (m *Manager) interval() time.Duration {
+	if m.cfg.PushInterval > 0 {
+		return m.cfg.PushInterval
+	}
+	return config.DefaultPushInterval
+}
+
+// check finds the running downloads of the peers accepting the pushed pieces which have
+// got PushThreshold of the pieces but no more since the last check, and assigns their
+// missing pieces to the least loaded alive seeders owning them.
+func (m *Manager) check(ctx context.Context) {
+	uploaders, byPeerID := m.listUploaders(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+	for addr := range m.pending {
+		if _, ok := uploaders[addr]; !ok {
+			delete(m.pending, addr)
+		}
+	}
+
+	progress := make(map[string]int)
+	var stragglers int
+	for _, u := range byPeerID {
+		if !u.peer.AcceptPush {
+			continue
+		}
+		tasks, err := m.dfgetTaskMgr.GetCIDAndTaskIDsByPeerID(ctx, u.peer.ID)
+		if err != nil {
+			continue
+		}
+		for cid, taskID := range tasks {
+			dfgetTask, task, done, ok := m.getProgress(ctx, cid, taskID)
+			if !ok {
+				continue
+			}
+			total := int(task.PieceTotal)
+			last, seen := m.progress[cid]
+			progress[cid] = len(done)
+			if !seen || len(done) > last || len(done) >= total ||
+				float64(len(done)) < m.cfg.PushThreshold*float64(total) {
+				continue
+			}
+			stragglers++
+			m.push(ctx, dfgetTask, task, u, done, byPeerID)
+		}
+	}
+	m.progress = progress
+	m.expire(progress)
+	m.metrics.stragglers.WithLabelValues().Set(float64(stragglers))
+}
+
+// listUploaders returns the addresses of the uploaders of the alive peers,
+// and the uploaders of the alive peers by the peerID.
+func (m *Manager) listUploaders(ctx context.Context) (map[string]bool, map[string]*uploader) {
+	peers, err := m.peerMgr.List(ctx, nil)
+	if err != nil {
+		logrus.Warnf("push: failed to list peers: %v", err)
+		return nil, nil
+	}
+	addrs := make(map[string]bool)
+	byPeerID := make(map[string]*uploader)
+	for _, peer := range peers {
+		if peer.State != types.PeerInfoStateAlive || m.cfg.IsSuperPID(peer.ID) {
+			continue
+		}
+		addr := fmt.Sprintf("%s:%d", peer.IP, peer.Port)
+		addrs[addr] = true
+		byPeerID[peer.ID] = &uploader{addr: addr, peer: peer}
+	}
+	return addrs, byPeerID
+}
+
+// getProgress returns the running client, its task and the pieces downloaded by it.
+func (m *Manager) getProgress(ctx context.Context, cid, taskID string) (*types.DfGetTask, *types.TaskInfo, map[int]bool, bool) {
+	dfgetTask, err := m.dfgetTaskMgr.Get(ctx, cid, taskID)
+	if err != nil || dfgetTask.Status != types.DfGetTaskStatusRUNNING || dfgetTask.Path == "" {
+		return nil, nil, nil, false
+	}
+	task, err := m.taskMgr.Get(ctx, taskID)
+	if err != nil || task.PieceTotal <= 0 {
+		return nil, nil, nil, false
+	}
+	pieceNums, err := m.progressMgr.GetPieceProgressByCID(ctx, taskID, cid, progress.PieceSuccess)
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	done := make(map[int]bool, len(pieceNums))
+	for _, pieceNum := range pieceNums {
+		done[pieceNum] = true
+	}
+	return dfgetTask, task, done, true
+}
+
+// push assigns up to PushMaxPieces missing pieces of the straggler to the seeders.
+func (m *Manager) push(ctx context.Context, dfgetTask *types.DfGetTask, task *types.TaskInfo, target *uploader,
+	done map[int]bool, byPeerID map[string]*uploader) {
+	cid := dfgetTask.CID
+	if m.pushed[cid] == nil {
+		m.pushed[cid] = make(map[int]time.Time)
+	}
+	now := m.now()
+	window := repushIntervals * m.interval()
+
+	pushes := make(map[string]*types.PushTask)
+	var count int
+	for pieceNum := 0; pieceNum < int(task.PieceTotal); pieceNum++ {
+		if m.cfg.PushMaxPieces > 0 && count >= m.cfg.PushMaxPieces {
+			break
+		}
+		if done[pieceNum] {
+			continue
+		}
+		if t, ok := m.pushed[cid][pieceNum]; ok && now.Sub(t) < window {
+			continue
+		}
+		seeder := m.selectSeeder(ctx, task.ID, pieceNum, target, byPeerID)
+		if seeder == nil {
+			continue
+		}
+		p, ok := pushes[seeder.addr]
+		if !ok {
+			p = &types.PushTask{
+				TaskID:         task.ID,
+				PieceSize:      task.PieceSize,
+				TargetFileName: path.Base(dfgetTask.Path),
+				TargetIP:       target.peer.IP.String(),
+				TargetPort:     target.peer.Port,
+			}
+			pushes[seeder.addr] = p
+			m.pending[seeder.addr] = append(m.pending[seeder.addr], p)
+		}
+		p.PieceNums = append(p.PieceNums, int32(pieceNum))
+		m.pushed[cid][pieceNum] = now
+		count++
+	}
+	if count > 0 {
+		m.metrics.pieces.WithLabelValues().Add(float64(count))
+		logrus.Infof("push: assign %d pieces of task %s to %d seeders to push to %s",
+			count, task.ID, len(pushes), target.addr)
+	}
+}
+
+// selectSeeder returns the least loaded alive uploader owning the piece except the target.
+func (m *Manager) selectSeeder(ctx context.Context, taskID string, pieceNum int,
+	target *uploader, byPeerID map[string]*uploader) *uploader {
+	peerIDs, err := m.progressMgr.GetPeerIDsByPieceNum(ctx, taskID, pieceNum)
+	if err != nil && !errortypes.IsDataNotFound(err) {
+		logrus.Warnf("push: failed to get peers of piece %d of task %s: %v", pieceNum, taskID, err)
+	}
+	var seeders []*uploader
+	for _, peerID := range peerIDs {
+		if u, ok := byPeerID[peerID]; ok && u.addr != target.addr {
+			seeders = append(seeders, u)
+		}
+	}
+	if len(seeders) == 0 {
+		return nil
+	}
+	sort.Slice(seeders, func(i, j int) bool {
+		if seeders[i].peer.Load != seeders[j].peer.Load {
+			return seeders[i].peer.Load < seeders[j].peer.Load
+		}
+		return seeders[i].addr < seeders[j].addr
+	})
+	return seeders[0]
+}
+
+// expire drops the pushed records of the clients which aren't running any more.
+func (m *Manager) expire(running map[string]int) {
+	for cid := range m.pushed {
+		if _, ok := running[cid]; !ok {
+			delete(m.pushed, cid)
+		}
+	}
+}
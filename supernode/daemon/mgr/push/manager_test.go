@@ -0,0 +1,141 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package push
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&PushManagerTestSuite{})
+}
+
+type PushManagerTestSuite struct{}
+
+// fakeTaskMgr serves the tasks from a map, and the other methods of TaskMgr are not used.
+type fakeTaskMgr struct {
+	mgr.TaskMgr
+	tasks map[string]*types.TaskInfo
+}
+
+func (f *fakeTaskMgr) Get(ctx context.Context, taskID string) (*types.TaskInfo, error) {
+	if task, ok := f.tasks[taskID]; ok {
+		return task, nil
+	}
+	return nil, errortypes.ErrDataNotFound
+}
+
+func (s *PushManagerTestSuite) TestCheck(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	dfgetTaskMgr := mock.NewMockDfgetTaskMgr(ctl)
+	progressMgr := mock.NewMockProgressMgr(ctl)
+
+	cfg := config.NewConfig()
+	cfg.PushThreshold = 0.5
+	cfg.PushMaxPieces = 2
+	taskMgr := &fakeTaskMgr{tasks: map[string]*types.TaskInfo{
+		"foo": {ID: "foo", PieceSize: 100, PieceTotal: 4},
+	}}
+	manager, err := NewManager(cfg, taskMgr, peerMgr, dfgetTaskMgr, progressMgr, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	peer := func(id, ip string, load int32, acceptPush bool) *types.PeerInfo {
+		return &types.PeerInfo{ID: id, IP: strfmt.IPv4(ip), Port: 15001, State: types.PeerInfoStateAlive,
+			Load: load, AcceptPush: acceptPush}
+	}
+	peerMgr.EXPECT().List(gomock.Any(), gomock.Any()).Return([]*types.PeerInfo{
+		peer("straggler", "1.1.1.1", 0, true),
+		peer("p2", "2.2.2.2", 1, false),
+		peer("p3", "3.3.3.3", 0, false),
+	}, nil).AnyTimes()
+	for _, id := range []string{"p2", "p3"} {
+		dfgetTaskMgr.EXPECT().GetCIDAndTaskIDsByPeerID(gomock.Any(), id).Return(nil, nil).AnyTimes()
+	}
+	dfgetTaskMgr.EXPECT().GetCIDAndTaskIDsByPeerID(gomock.Any(), "straggler").Return(
+		map[string]string{"c1": "foo"}, nil).AnyTimes()
+	dfgetTaskMgr.EXPECT().Get(gomock.Any(), "c1", "foo").Return(&types.DfGetTask{
+		CID: "c1", TaskID: "foo", Path: "/peer/file/foo-file", Status: types.DfGetTaskStatusRUNNING}, nil).AnyTimes()
+
+	done := []int{0}
+	progressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), "foo", "c1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, taskID, clientID, filter string) ([]int, error) {
+			return done, nil
+		}).AnyTimes()
+	owners := map[int][]string{1: {"p2", "p3", "straggler"}, 2: {"p2"}, 3: {"p3"}}
+	progressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "foo", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, taskID string, pieceNum int) ([]string, error) {
+			return owners[pieceNum], nil
+		}).AnyTimes()
+
+	ctx := context.Background()
+	// the progress isn't known at the first check, and then the download is below the threshold
+	manager.check(ctx)
+	done = []int{0, 3}
+	manager.check(ctx)
+	c.Check(manager.pending, check.HasLen, 0)
+
+	// the download stalls beyond the threshold, and the missing pieces are pushed by
+	// the least loaded owners, at most PushMaxPieces of them
+	manager.check(ctx)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.stragglers.WithLabelValues()), check.Equals, float64(1))
+	c.Check(manager.TakePushes(ctx, "3.3.3.3", 15001), check.DeepEquals, []*types.PushTask{{
+		TaskID: "foo", PieceNums: []int32{1}, PieceSize: 100, TargetFileName: "foo-file",
+		TargetIP: "1.1.1.1", TargetPort: 15001,
+	}})
+	c.Check(manager.TakePushes(ctx, "2.2.2.2", 15001), check.DeepEquals, []*types.PushTask{{
+		TaskID: "foo", PieceNums: []int32{2}, PieceSize: 100, TargetFileName: "foo-file",
+		TargetIP: "1.1.1.1", TargetPort: 15001,
+	}})
+	c.Check(manager.TakePushes(ctx, "2.2.2.2", 15001), check.HasLen, 0)
+
+	// the pieces aren't pushed again until the repush window passes
+	manager.check(ctx)
+	c.Check(manager.pending, check.HasLen, 0)
+	now = now.Add(repushIntervals * cfg.PushInterval)
+	manager.check(ctx)
+	c.Check(manager.TakePushes(ctx, "3.3.3.3", 15001), check.HasLen, 1)
+	c.Check(manager.TakePushes(ctx, "2.2.2.2", 15001), check.HasLen, 1)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.pieces.WithLabelValues()), check.Equals, float64(4))
+
+	// the download makes progress
+	done = []int{0, 1, 3}
+	manager.check(ctx)
+	c.Check(manager.pending, check.HasLen, 0)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.stragglers.WithLabelValues()), check.Equals, float64(0))
+}
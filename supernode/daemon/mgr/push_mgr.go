@@ -0,0 +1,36 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// PushMgr as an interface defines all operations to push the missing pieces to the
+// nearly-complete peers whose downloads stall.
+type PushMgr interface {
+	// StartPush starts the job which checks the progress of the peers accepting the
+	// pushed pieces every interval, and assigns the missing pieces of the stragglers
+	// to the uploaders of the seeders owning them.
+	StartPush(ctx context.Context)
+
+	// TakePushes returns the pieces assigned to the uploader listening on the ip and port
+	// to be pushed since the last call, which are sent to it with the response of its heart beat.
+	TakePushes(ctx context.Context, ip string, port int32) []*types.PushTask
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+)
+
+// RedactTask returns a copy of the task whose values of the sensitive headers are redacted,
+// which is logged or responded to the APIs instead of the task.
+func RedactTask(task *types.TaskInfo) *types.TaskInfo {
+	if task == nil {
+		return nil
+	}
+	redacted := *task
+	redacted.Headers = httputils.RedactHeaders(task.Headers)
+	return &redacted
+}
+
+// RedactTaskCreateRequest returns a copy of the request whose values of the sensitive headers
+// are redacted, which is logged instead of the request.
+func RedactTaskCreateRequest(req *types.TaskCreateRequest) *types.TaskCreateRequest {
+	if req == nil {
+		return nil
+	}
+	redacted := *req
+	redacted.Headers = httputils.RedactHeaders(req.Headers)
+	return &redacted
+}
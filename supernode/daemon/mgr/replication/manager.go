@@ -0,0 +1,434 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replication
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var _ mgr.ReplicationMgr = &Manager{}
+
+// assignmentTimeout is the time after which an assignment whose uploader doesn't own
+// the pieces of the task yet is dropped, and then the task may be assigned to another one.
+const assignmentTimeout = 30 * time.Minute
+
+type metrics struct {
+	underReplicatedTasks *prometheus.GaugeVec
+	assignments          *prometheus.CounterVec
+	standbyLaggingTasks  *prometheus.GaugeVec
+	standbyAssignments   *prometheus.CounterVec
+}
+
+func newMetrics(register prometheus.Registerer) *metrics {
+	return &metrics{
+		underReplicatedTasks: metricsutils.NewGauge(config.SubsystemSupernode, "replication_under_replicated_tasks",
+			"The number of the long-lived tasks whose pieces are owned by less alive peers than the replication factor.",
+			[]string{}, register),
+		assignments: metricsutils.NewCounter(config.SubsystemSupernode, "replication_assignments_total",
+			"Total number of the long-lived tasks assigned to the uploaders to be replicated.",
+			[]string{}, register),
+		standbyLaggingTasks: metricsutils.NewGauge(config.SubsystemSupernode, "standby_lagging_tasks",
+			"The number of the tasks cached by the alive primaries which their warm standbys don't own yet.",
+			[]string{}, register),
+		standbyAssignments: metricsutils.NewCounter(config.SubsystemSupernode, "standby_assignments_total",
+			"Total number of the tasks of the primaries assigned to their warm standbys to be replicated.",
+			[]string{}, register),
+	}
+}
+
+// uploader is the uploader of the alive peers listening on the same address.
+type uploader struct {
+	addr string
+	peer *types.PeerInfo
+}
+
+// assignment is a task assigned to an uploader to be replicated.
+type assignment struct {
+	task *types.ReplicateTask
+	time time.Time
+	// standby is true if the task is assigned to the uploader as the warm standby of its primary.
+	standby bool
+}
+
+// Manager is an implementation of the interface of ReplicationMgr.
+type Manager struct {
+	sync.Mutex
+
+	cfg         *config.Config
+	taskMgr     mgr.TaskMgr
+	peerMgr     mgr.PeerMgr
+	progressMgr mgr.ProgressMgr
+	patterns    []*regexp.Regexp
+	metrics     *metrics
+
+	// assigned records the uploaders which every task is assigned to,
+	// and pending holds the assignments not taken by the uploaders yet.
+	assigned map[string]map[string]*assignment
+	pending  map[string][]*types.ReplicateTask
+
+	now func() time.Time
+}
+
+// NewManager returns a new Manager.
+func NewManager(cfg *config.Config, taskMgr mgr.TaskMgr, peerMgr mgr.PeerMgr,
+	progressMgr mgr.ProgressMgr, register prometheus.Registerer) (*Manager, error) {
+	var patterns []*regexp.Regexp
+	for _, expr := range cfg.ReplicationTasks {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "replication task pattern %s: %v", expr, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return &Manager{
+		cfg:         cfg,
+		taskMgr:     taskMgr,
+		peerMgr:     peerMgr,
+		progressMgr: progressMgr,
+		patterns:    patterns,
+		metrics:     newMetrics(register),
+		assigned:    make(map[string]map[string]*assignment),
+		pending:     make(map[string][]*types.ReplicateTask),
+		now:         time.Now,
+	}, nil
+}
+
+// StartReplication starts the job which checks the replicas of the long-lived tasks
+// and the tasks of the primaries which have warm standbys every ReplicationInterval.
+// The long-lived tasks aren't replicated if the ReplicationFactor is not positive.
+func (m *Manager) StartReplication(ctx context.Context) {
+	interval := m.cfg.ReplicationInterval
+	if interval <= 0 {
+		interval = config.DefaultReplicationInterval
+	}
+	logrus.Infof("start replication of the long-lived tasks and the warm standbys, factor: %d, interval: %v",
+		m.cfg.ReplicationFactor, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	}()
+}
+
+// TakeAssignments returns and clears the pending assignments of the uploader.
+func (m *Manager) TakeAssignments(ctx context.Context, ip string, port int32) []*types.ReplicateTask {
+	addr := fmt.Sprintf("%s:%d", ip, port)
+	m.Lock()
+	defer m.Unlock()
+	tasks := m.pending[addr]
+	delete(m.pending, addr)
+	return tasks
+}
+
+// check counts the alive uploaders owning every piece of the long-lived tasks,
+// and assigns the tasks whose pieces are owned by less uploaders than the
+// ReplicationFactor to more ones. The tasks owned by the alive primaries are
+// also assigned to their warm standbys which don't own them yet.
+func (m *Manager) check(ctx context.Context) {
+	uploaders, addrs := m.listUploaders(ctx)
+	standbys := listStandbys(uploaders)
+	if m.cfg.ReplicationFactor <= 0 && len(standbys) == 0 {
+		m.Lock()
+		m.expire(nil)
+		m.Unlock()
+		return
+	}
+	tasks := m.listTasks(ctx, len(standbys) > 0)
+
+	m.Lock()
+	defer m.Unlock()
+	m.expire(tasks)
+
+	var underReplicated, lagging int
+	for _, task := range tasks {
+		replicas, owners := m.countReplicas(ctx, task, addrs)
+		// an assignment is fulfilled once the uploader owns any piece of the task
+		for addr, a := range m.assigned[task.ID] {
+			if owners[addr] {
+				m.unassign(task.ID, addr, a)
+			}
+		}
+		lagging += m.syncStandbys(task, standbys, owners)
+
+		if m.cfg.ReplicationFactor <= 0 || !m.isLongLived(task) {
+			continue
+		}
+		if replicas >= m.cfg.ReplicationFactor {
+			for addr, a := range m.assigned[task.ID] {
+				if !a.standby {
+					m.unassign(task.ID, addr, a)
+				}
+			}
+			continue
+		}
+		underReplicated++
+
+		need := m.cfg.ReplicationFactor - replicas
+		for _, a := range m.assigned[task.ID] {
+			if !a.standby {
+				need--
+			}
+		}
+		for _, u := range m.candidates(task, uploaders, owners) {
+			if need <= 0 {
+				break
+			}
+			m.assign(task, u.addr, false)
+			need--
+		}
+	}
+	m.metrics.underReplicatedTasks.WithLabelValues().Set(float64(underReplicated))
+	m.metrics.standbyLaggingTasks.WithLabelValues().Set(float64(lagging))
+}
+
+// listStandbys returns the uploaders of the warm standbys by the addresses of their primaries.
+func listStandbys(uploaders []*uploader) map[string][]*uploader {
+	standbys := make(map[string][]*uploader)
+	for _, u := range uploaders {
+		if primary := u.peer.StandbyOf; primary != "" && primary != u.addr {
+			standbys[primary] = append(standbys[primary], u)
+		}
+	}
+	return standbys
+}
+
+// syncStandbys assigns the task owned by the alive primaries to their warm standbys
+// which don't own it yet, and returns the number of such standbys.
+func (m *Manager) syncStandbys(task *types.TaskInfo, standbys map[string][]*uploader, owners map[string]bool) int {
+	var lagging int
+	for primary, list := range standbys {
+		if !owners[primary] {
+			continue
+		}
+		for _, u := range list {
+			if owners[u.addr] {
+				continue
+			}
+			lagging++
+			if m.assigned[task.ID][u.addr] == nil && m.fits(task, u) {
+				m.assign(task, u.addr, true)
+			}
+		}
+	}
+	return lagging
+}
+
+// listUploaders returns the uploaders of the alive peers sorted by the load,
+// and the addresses of the uploaders of the alive peers by the peerID.
+func (m *Manager) listUploaders(ctx context.Context) ([]*uploader, map[string]string) {
+	peers, err := m.peerMgr.List(ctx, nil)
+	if err != nil {
+		logrus.Warnf("replication: failed to list peers: %v", err)
+		return nil, nil
+	}
+	addrs := make(map[string]string)
+	byAddr := make(map[string]*uploader)
+	for _, peer := range peers {
+		if peer.State != types.PeerInfoStateAlive {
+			continue
+		}
+		addr := fmt.Sprintf("%s:%d", peer.IP, peer.Port)
+		addrs[peer.ID] = addr
+		if u, ok := byAddr[addr]; !ok || time.Time(peer.LastHeartbeat).After(time.Time(u.peer.LastHeartbeat)) {
+			byAddr[addr] = &uploader{addr: addr, peer: peer}
+		}
+	}
+
+	uploaders := make([]*uploader, 0, len(byAddr))
+	for _, u := range byAddr {
+		uploaders = append(uploaders, u)
+	}
+	sort.Slice(uploaders, func(i, j int) bool {
+		if uploaders[i].peer.Load != uploaders[j].peer.Load {
+			return uploaders[i].peer.Load < uploaders[j].peer.Load
+		}
+		return uploaders[i].addr < uploaders[j].addr
+	})
+	return uploaders, addrs
+}
+
+// listTasks returns the long-lived tasks whose CDN has succeeded,
+// or all the tasks whose CDN has succeeded if all is true.
+func (m *Manager) listTasks(ctx context.Context, all bool) []*types.TaskInfo {
+	accessTimes, err := m.taskMgr.GetAccessTime(ctx)
+	if err != nil {
+		logrus.Warnf("replication: failed to list tasks: %v", err)
+		return nil
+	}
+	var tasks []*types.TaskInfo
+	for _, taskID := range accessTimes.ListKeyAsStringSlice() {
+		task, err := m.taskMgr.Get(ctx, taskID)
+		if err != nil || task.CdnStatus != types.TaskInfoCdnStatusSUCCESS || task.PieceTotal <= 0 {
+			continue
+		}
+		if all || (m.cfg.ReplicationFactor > 0 && m.isLongLived(task)) {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks
+}
+
+func (m *Manager) isLongLived(task *types.TaskInfo) bool {
+	if len(m.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(task.TaskURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// countReplicas returns the least number of the alive uploaders owning a piece of the task,
+// and the uploaders owning any piece of it.
+func (m *Manager) countReplicas(ctx context.Context, task *types.TaskInfo, addrs map[string]string) (int, map[string]bool) {
+	replicas := -1
+	owners := make(map[string]bool)
+	for pieceNum := 0; pieceNum < int(task.PieceTotal); pieceNum++ {
+		peerIDs, err := m.progressMgr.GetPeerIDsByPieceNum(ctx, task.ID, pieceNum)
+		if err != nil && !errortypes.IsDataNotFound(err) {
+			logrus.Warnf("replication: failed to get peers of piece %d of task %s: %v", pieceNum, task.ID, err)
+		}
+		pieceOwners := make(map[string]bool)
+		for _, peerID := range peerIDs {
+			if addr, ok := addrs[peerID]; ok {
+				pieceOwners[addr] = true
+				owners[addr] = true
+			}
+		}
+		if replicas < 0 || len(pieceOwners) < replicas {
+			replicas = len(pieceOwners)
+		}
+	}
+	if replicas < 0 {
+		replicas = 0
+	}
+	return replicas, owners
+}
+
+// candidates returns the uploaders which the task can be assigned to, which don't own
+// any piece of the task and have enough room in their caches for it.
+func (m *Manager) candidates(task *types.TaskInfo, uploaders []*uploader, owners map[string]bool) []*uploader {
+	var result []*uploader
+	for _, u := range uploaders {
+		if owners[u.addr] || m.assigned[task.ID][u.addr] != nil || !m.fits(task, u) {
+			continue
+		}
+		result = append(result, u)
+	}
+	return result
+}
+
+// fits returns whether the cache of the uploader has enough room for the task.
+func (m *Manager) fits(task *types.TaskInfo, u *uploader) bool {
+	if capacity := u.peer.CacheCapacity; capacity > 0 {
+		if capacity-u.peer.CacheUsed < task.HTTPFileLength {
+			return false
+		}
+		if ratio := m.cfg.PeerCacheFullRatio; ratio > 0 && float64(u.peer.CacheUsed) >= ratio*float64(capacity) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) assign(task *types.TaskInfo, addr string, standby bool) {
+	replicate := &types.ReplicateTask{
+		TaskID:     task.ID,
+		RawURL:     task.RawURL,
+		Filter:     task.Filter,
+		Md5:        task.Md5,
+		Digest:     task.Digest,
+		Identifier: task.Identifier,
+		Range:      task.Headers["Range"],
+	}
+	if m.assigned[task.ID] == nil {
+		m.assigned[task.ID] = make(map[string]*assignment)
+	}
+	m.assigned[task.ID][addr] = &assignment{task: replicate, time: m.now(), standby: standby}
+	m.pending[addr] = append(m.pending[addr], replicate)
+	if standby {
+		m.metrics.standbyAssignments.WithLabelValues().Inc()
+		logrus.Infof("replication: assign task %s to standby uploader %s", task.ID, addr)
+		return
+	}
+	m.metrics.assignments.WithLabelValues().Inc()
+	logrus.Infof("replication: assign task %s to uploader %s", task.ID, addr)
+}
+
+// expire drops the assignments which time out or whose tasks are not long-lived any more.
+func (m *Manager) expire(tasks []*types.TaskInfo) {
+	alive := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		alive[task.ID] = true
+	}
+	now := m.now()
+	for taskID, assignments := range m.assigned {
+		for addr, a := range assignments {
+			if !alive[taskID] || now.Sub(a.time) >= assignmentTimeout {
+				m.unassign(taskID, addr, a)
+			}
+		}
+	}
+}
+
+// unassign drops the assignment of the task to the uploader,
+// and it's not sent to the uploader if it hasn't been taken yet.
+func (m *Manager) unassign(taskID, addr string, a *assignment) {
+	delete(m.assigned[taskID], addr)
+	if len(m.assigned[taskID]) == 0 {
+		delete(m.assigned, taskID)
+	}
+
+	tasks := m.pending[addr]
+	for i := range tasks {
+		if tasks[i] == a.task {
+			m.pending[addr] = append(tasks[:i], tasks[i+1:]...)
+			break
+		}
+	}
+	if len(m.pending[addr]) == 0 {
+		delete(m.pending, addr)
+	}
+}
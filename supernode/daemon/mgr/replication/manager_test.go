@@ -0,0 +1,192 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&ReplicationManagerTestSuite{})
+}
+
+type ReplicationManagerTestSuite struct{}
+
+// fakeTaskMgr serves the tasks from a map, and the other methods of TaskMgr are not used.
+type fakeTaskMgr struct {
+	mgr.TaskMgr
+	tasks map[string]*types.TaskInfo
+}
+
+func (f *fakeTaskMgr) GetAccessTime(ctx context.Context) (*syncmap.SyncMap, error) {
+	accessTimes := syncmap.NewSyncMap()
+	for taskID := range f.tasks {
+		accessTimes.Add(taskID, time.Now())
+	}
+	return accessTimes, nil
+}
+
+func (f *fakeTaskMgr) Get(ctx context.Context, taskID string) (*types.TaskInfo, error) {
+	if task, ok := f.tasks[taskID]; ok {
+		return task, nil
+	}
+	return nil, errortypes.ErrDataNotFound
+}
+
+func (s *ReplicationManagerTestSuite) TestCheck(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	progressMgr := mock.NewMockProgressMgr(ctl)
+
+	cfg := config.NewConfig()
+	cfg.ReplicationFactor = 2
+	cfg.ReplicationTasks = []string{"^http://long-lived/"}
+	taskMgr := &fakeTaskMgr{tasks: map[string]*types.TaskInfo{
+		"foo": {ID: "foo", TaskURL: "http://long-lived/foo", RawURL: "http://long-lived/foo?token=x",
+			Md5: "md5", Headers: map[string]string{"Range": "bytes=0-99", "Authorization": "secret"},
+			CdnStatus: types.TaskInfoCdnStatusSUCCESS, PieceTotal: 2, HTTPFileLength: 100},
+		"bar": {ID: "bar", TaskURL: "http://short-lived/bar",
+			CdnStatus: types.TaskInfoCdnStatusSUCCESS, PieceTotal: 1, HTTPFileLength: 100},
+		"baz": {ID: "baz", TaskURL: "http://long-lived/baz",
+			CdnStatus: types.TaskInfoCdnStatusRUNNING, PieceTotal: 1, HTTPFileLength: 100},
+	}}
+	register := prometheus.NewRegistry()
+	manager, err := NewManager(cfg, taskMgr, peerMgr, progressMgr, register)
+	c.Assert(err, check.IsNil)
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	peer := func(id, ip string, state string, load int32, capacity, used int64) *types.PeerInfo {
+		return &types.PeerInfo{ID: id, IP: strfmt.IPv4(ip), Port: 15001, State: state,
+			Load: load, CacheCapacity: capacity, CacheUsed: used}
+	}
+	peers := []*types.PeerInfo{
+		peer("p1", "1.1.1.1", types.PeerInfoStateAlive, 0, 0, 0),
+		peer("p2", "2.2.2.2", types.PeerInfoStateAlive, 0, 0, 0),
+		// the nearly full one and the one without enough room aren't assigned
+		peer("p3", "3.3.3.3", types.PeerInfoStateAlive, 0, 1000, 950),
+		peer("p4", "4.4.4.4", types.PeerInfoStateAlive, 0, 1000, 920),
+		peer("p5", "5.5.5.5", types.PeerInfoStateAlive, 2, 0, 0),
+		peer("p6", "6.6.6.6", types.PeerInfoStateAlive, 1, 0, 0),
+		peer("p7", "7.7.7.7", types.PeerInfoStateSuspect, 0, 0, 0),
+	}
+	peerMgr.EXPECT().List(gomock.Any(), gomock.Any()).Return(peers, nil).AnyTimes()
+
+	owners := map[int][]string{0: {"p1", "p2", "p7"}, 1: {"p1", "p7"}}
+	progressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "foo", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, taskID string, pieceNum int) ([]string, error) {
+			return owners[pieceNum], nil
+		}).AnyTimes()
+
+	ctx := context.Background()
+	manager.check(ctx)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.underReplicatedTasks.WithLabelValues()), check.Equals, float64(1))
+	c.Check(manager.TakeAssignments(ctx, "5.5.5.5", 15001), check.HasLen, 0)
+	tasks := manager.TakeAssignments(ctx, "6.6.6.6", 15001)
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0], check.DeepEquals, &types.ReplicateTask{TaskID: "foo", RawURL: "http://long-lived/foo?token=x",
+		Md5: "md5", Range: "bytes=0-99"})
+	c.Check(manager.TakeAssignments(ctx, "6.6.6.6", 15001), check.HasLen, 0)
+
+	// the task isn't assigned again until the assignment times out
+	manager.check(ctx)
+	c.Check(manager.TakeAssignments(ctx, "5.5.5.5", 15001), check.HasLen, 0)
+	c.Check(manager.TakeAssignments(ctx, "6.6.6.6", 15001), check.HasLen, 0)
+	now = now.Add(assignmentTimeout)
+	manager.check(ctx)
+	c.Check(manager.TakeAssignments(ctx, "6.6.6.6", 15001), check.HasLen, 1)
+
+	// the assignment is fulfilled once the uploader owns the pieces
+	owners[0] = append(owners[0], "p6")
+	owners[1] = append(owners[1], "p6")
+	manager.check(ctx)
+	c.Check(manager.assigned, check.HasLen, 0)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.underReplicatedTasks.WithLabelValues()), check.Equals, float64(0))
+	c.Check(prom_testutil.ToFloat64(manager.metrics.assignments.WithLabelValues()), check.Equals, float64(2))
+}
+
+func (s *ReplicationManagerTestSuite) TestNewManager(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.ReplicationTasks = []string{"("}
+	_, err := NewManager(cfg, nil, nil, nil, prometheus.NewRegistry())
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *ReplicationManagerTestSuite) TestCheckStandby(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	progressMgr := mock.NewMockProgressMgr(ctl)
+
+	cfg := config.NewConfig()
+	taskMgr := &fakeTaskMgr{tasks: map[string]*types.TaskInfo{
+		"foo": {ID: "foo", RawURL: "http://short-lived/foo",
+			CdnStatus: types.TaskInfoCdnStatusSUCCESS, PieceTotal: 1, HTTPFileLength: 100},
+		"bar": {ID: "bar", RawURL: "http://short-lived/bar",
+			CdnStatus: types.TaskInfoCdnStatusSUCCESS, PieceTotal: 1, HTTPFileLength: 100},
+	}}
+	manager, err := NewManager(cfg, taskMgr, peerMgr, progressMgr, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	peers := []*types.PeerInfo{
+		{ID: "primary", IP: "1.1.1.1", Port: 15001, State: types.PeerInfoStateAlive},
+		{ID: "standby", IP: "2.2.2.2", Port: 15001, State: types.PeerInfoStateAlive, StandbyOf: "1.1.1.1:15001"},
+		{ID: "other", IP: "3.3.3.3", Port: 15001, State: types.PeerInfoStateAlive},
+	}
+	peerMgr.EXPECT().List(gomock.Any(), gomock.Any()).Return(peers, nil).AnyTimes()
+	owners := map[string][]string{"foo": {"primary"}, "bar": {"other"}}
+	progressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), gomock.Any(), 0).DoAndReturn(
+		func(ctx context.Context, taskID string, pieceNum int) ([]string, error) {
+			return owners[taskID], nil
+		}).AnyTimes()
+
+	// only the task of the primary is assigned to the standby, without the replication factor
+	ctx := context.Background()
+	manager.check(ctx)
+	tasks := manager.TakeAssignments(ctx, "2.2.2.2", 15001)
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].TaskID, check.Equals, "foo")
+	c.Check(manager.TakeAssignments(ctx, "3.3.3.3", 15001), check.HasLen, 0)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.standbyLaggingTasks.WithLabelValues()), check.Equals, float64(1))
+	c.Check(prom_testutil.ToFloat64(manager.metrics.standbyAssignments.WithLabelValues()), check.Equals, float64(1))
+
+	// the assignment is fulfilled once the standby owns the pieces
+	owners["foo"] = append(owners["foo"], "standby")
+	manager.check(ctx)
+	c.Check(manager.assigned, check.HasLen, 0)
+	c.Check(prom_testutil.ToFloat64(manager.metrics.standbyLaggingTasks.WithLabelValues()), check.Equals, float64(0))
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mgr
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// ReplicationMgr as an interface defines all operations to keep the pieces of the
+// long-lived tasks owned by enough alive peers.
+type ReplicationMgr interface {
+	// StartReplication starts the job which checks the replicas of the pieces of the
+	// long-lived tasks every interval, and assigns the under-replicated tasks to
+	// the uploaders of more peers.
+	StartReplication(ctx context.Context)
+
+	// TakeAssignments returns the tasks assigned to the uploader listening on the ip and port
+	// since the last call, which are sent to it with the response of its heart beat.
+	TakeAssignments(ctx context.Context, ip string, port int32) []*types.ReplicateTask
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// auditLogMaxSizeMB is the max size of the audit log file before it gets rotated.
+const auditLogMaxSizeMB = 100
+
+// auditLog keeps the latest scheduler decisions in a ring buffer,
+// and writes every decision to the writer as a JSON line if it's not nil.
+type auditLog struct {
+	sync.Mutex
+
+	decisions []*mgr.SchedulerDecision
+	// next is the index in decisions to write the next decision.
+	next int
+	full bool
+
+	writer io.WriteCloser
+}
+
+// newAuditLog creates an auditLog which keeps size decisions in memory
+// and appends all decisions to the file if file is not empty.
+// It returns nil if both of them are disabled.
+func newAuditLog(size int, file string) *auditLog {
+	if size <= 0 && file == "" {
+		return nil
+	}
+
+	al := &auditLog{}
+	if size > 0 {
+		al.decisions = make([]*mgr.SchedulerDecision, size)
+	}
+	if file != "" {
+		al.writer = &lumberjack.Logger{
+			Filename:   file,
+			MaxSize:    auditLogMaxSizeMB,
+			MaxBackups: 1,
+		}
+	}
+	return al
+}
+
+func (al *auditLog) record(d *mgr.SchedulerDecision) {
+	if al == nil {
+		return
+	}
+
+	al.Lock()
+	defer al.Unlock()
+
+	if len(al.decisions) > 0 {
+		al.decisions[al.next] = d
+		al.next++
+		if al.next == len(al.decisions) {
+			al.next = 0
+			al.full = true
+		}
+	}
+
+	if al.writer != nil {
+		data, err := json.Marshal(d)
+		if err != nil {
+			logrus.Warnf("failed to marshal scheduler decision %+v: %v", d, err)
+			return
+		}
+		if _, err := al.writer.Write(append(data, '\n')); err != nil {
+			logrus.Warnf("failed to write scheduler decision: %v", err)
+		}
+	}
+}
+
+// list returns at most limit latest decisions of the taskID in chronological order.
+// The decisions of all tasks are returned if taskID is empty.
+func (al *auditLog) list(taskID string, limit int) []*mgr.SchedulerDecision {
+	if al == nil {
+		return nil
+	}
+
+	al.Lock()
+	ordered := make([]*mgr.SchedulerDecision, 0, len(al.decisions))
+	if al.full {
+		ordered = append(ordered, al.decisions[al.next:]...)
+	}
+	ordered = append(ordered, al.decisions[:al.next]...)
+	al.Unlock()
+
+	result := make([]*mgr.SchedulerDecision, 0)
+	for _, d := range ordered {
+		if taskID == "" || d.TaskID == taskID {
+			result = append(result, d)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&AuditTestSuite{})
+}
+
+type AuditTestSuite struct{}
+
+func (s *AuditTestSuite) TestAuditLogList(c *check.C) {
+	c.Check(newAuditLog(0, ""), check.IsNil)
+
+	al := newAuditLog(3, "")
+	c.Check(al.list("", 0), check.HasLen, 0)
+
+	for i := 0; i < 5; i++ {
+		taskID := "foo"
+		if i%2 == 1 {
+			taskID = "bar"
+		}
+		al.record(&mgr.SchedulerDecision{TaskID: taskID, PieceNum: i})
+	}
+
+	var pieceNums []int
+	for _, d := range al.list("", 0) {
+		pieceNums = append(pieceNums, d.PieceNum)
+	}
+	c.Check(pieceNums, check.DeepEquals, []int{2, 3, 4})
+
+	foo := al.list("foo", 0)
+	c.Assert(foo, check.HasLen, 2)
+	c.Check(foo[0].PieceNum, check.Equals, 2)
+	c.Check(foo[1].PieceNum, check.Equals, 4)
+
+	last := al.list("foo", 1)
+	c.Assert(last, check.HasLen, 1)
+	c.Check(last[0].PieceNum, check.Equals, 4)
+}
+
+func (s *AuditTestSuite) TestReplay(c *check.C) {
+	workHome, err := ioutil.TempDir("/tmp", "supernode-AuditTestSuite-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(workHome)
+	file := filepath.Join(workHome, "audit.log")
+
+	al := newAuditLog(0, file)
+	al.record(&mgr.SchedulerDecision{TaskID: "foo", ClientID: "c1", PieceNum: 0,
+		DstPID: "super", Reason: mgr.DecisionReasonNoAvailablePeer,
+		Rejected: map[string]string{"p1": "upload-limit"}})
+	al.record(&mgr.SchedulerDecision{TaskID: "foo", ClientID: "c1", PieceNum: 0,
+		DstPID: "p1", Reason: mgr.DecisionReasonPeer, DistributedCount: 2})
+	al.record(&mgr.SchedulerDecision{TaskID: "foo", ClientID: "c2", PieceNum: 1,
+		Reason: mgr.DecisionReasonSuperLoadLimit})
+	al.record(&mgr.SchedulerDecision{TaskID: "bar", ClientID: "c1", PieceNum: 0,
+		DstPID: "p2", Reason: mgr.DecisionReasonPeer})
+
+	f, err := os.Open(file)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	decisions, err := ReadDecisions(f)
+	c.Assert(err, check.IsNil)
+	c.Assert(decisions, check.HasLen, 4)
+
+	reports := Analyze(decisions)
+	c.Assert(reports, check.HasLen, 2)
+	c.Check(reports[0].TaskID, check.Equals, "bar")
+
+	foo := reports[1]
+	c.Check(foo.Decisions, check.Equals, 3)
+	c.Check(foo.Clients, check.Equals, 2)
+	c.Check(foo.Unassigned, check.Equals, 1)
+	c.Check(foo.Reassigned, check.Equals, 1)
+	c.Check(foo.DstPeers, check.DeepEquals, map[string]int{"super": 1, "p1": 1})
+	c.Check(foo.Rejections, check.DeepEquals, map[string]int{"upload-limit": 1})
+
+	buf := &bytes.Buffer{}
+	WriteTimeline(buf, decisions, "foo")
+	c.Check(strings.Count(buf.String(), "\n"), check.Equals, 3)
+	c.Check(strings.Contains(buf.String(), "rejected:p1=upload-limit"), check.Equals, true)
+
+	_, err = ReadDecisions(strings.NewReader("invalid"))
+	c.Check(err, check.NotNil)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+)
+
+// maxBoostMinutes is the max number of the minutes a bandwidth boost lasts for,
+// so that a forgotten boost doesn't lift the limits of a task for good.
+const maxBoostMinutes = 24 * 60
+
+// boosts holds the temporary bandwidth boosts granted to the tasks,
+// which are dropped once they expire.
+type boosts struct {
+	mu     sync.Mutex
+	boosts map[string]*types.TaskBoost
+	now    func() time.Time
+}
+
+func newBoosts() *boosts {
+	return &boosts{
+		boosts: make(map[string]*types.TaskBoost),
+		now:    time.Now,
+	}
+}
+
+// set grants the boost to the task, which replaces the previous one of the task.
+func (b *boosts) set(taskID string, boost *types.TaskBoost) (*types.TaskBoost, error) {
+	if boost.RateLimit <= 0 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "rateLimit %d of boost", boost.RateLimit)
+	}
+	if boost.Minutes <= 0 || boost.Minutes > maxBoostMinutes {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "minutes %d of boost", boost.Minutes)
+	}
+	state := &types.TaskBoost{
+		TaskID:     taskID,
+		RateLimit:  boost.RateLimit,
+		Minutes:    boost.Minutes,
+		ExpireTime: strfmt.DateTime(b.now().Add(time.Duration(boost.Minutes) * time.Minute)),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.boosts[taskID] = state
+	return copyBoost(state), nil
+}
+
+// get returns the boost of the task, or nil if the task isn't boosted.
+func (b *boosts) get(taskID string) *types.TaskBoost {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	boost, ok := b.boosts[taskID]
+	if !ok {
+		return nil
+	}
+	if b.expired(boost) {
+		delete(b.boosts, taskID)
+		return nil
+	}
+	return copyBoost(boost)
+}
+
+// remove revokes the boost of the task.
+func (b *boosts) remove(taskID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	boost, ok := b.boosts[taskID]
+	if !ok || b.expired(boost) {
+		delete(b.boosts, taskID)
+		return errors.Wrapf(errortypes.ErrDataNotFound, "boost of task %s", taskID)
+	}
+	delete(b.boosts, taskID)
+	return nil
+}
+
+// list returns the copies of the boosts which haven't expired sorted by the expire time.
+func (b *boosts) list() []*types.TaskBoost {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := make([]*types.TaskBoost, 0, len(b.boosts))
+	for taskID, boost := range b.boosts {
+		if b.expired(boost) {
+			delete(b.boosts, taskID)
+			continue
+		}
+		list = append(list, copyBoost(boost))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := time.Time(list[i].ExpireTime), time.Time(list[j].ExpireTime)
+		if ti.Equal(tj) {
+			return list[i].TaskID < list[j].TaskID
+		}
+		return ti.Before(tj)
+	})
+	return list
+}
+
+func (b *boosts) expired(boost *types.TaskBoost) bool {
+	return !b.now().Before(time.Time(boost.ExpireTime))
+}
+
+func copyBoost(boost *types.TaskBoost) *types.TaskBoost {
+	c := *boost
+	return &c
+}
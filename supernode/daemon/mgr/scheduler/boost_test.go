@@ -0,0 +1,95 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	check.Suite(&BoostTestSuite{})
+}
+
+type BoostTestSuite struct{}
+
+func (s *BoostTestSuite) TestSetBoost(c *check.C) {
+	b := newBoosts()
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	var cases = []struct {
+		boost *types.TaskBoost
+		err   bool
+	}{
+		{boost: &types.TaskBoost{}, err: true},
+		{boost: &types.TaskBoost{RateLimit: 1024}, err: true},
+		{boost: &types.TaskBoost{Minutes: 10}, err: true},
+		{boost: &types.TaskBoost{RateLimit: 1024, Minutes: maxBoostMinutes + 1}, err: true},
+		{boost: &types.TaskBoost{RateLimit: 1024, Minutes: 10}},
+	}
+	for _, v := range cases {
+		state, err := b.set("foo", v.boost)
+		cmt := check.Commentf("%+v", v.boost)
+		c.Check(err != nil, check.Equals, v.err, cmt)
+		if err != nil {
+			continue
+		}
+		c.Check(state.TaskID, check.Equals, "foo", cmt)
+		c.Check(time.Time(state.ExpireTime).Equal(now.Add(10*time.Minute)), check.Equals, true, cmt)
+	}
+
+	_, err := b.set("bar", &types.TaskBoost{RateLimit: 2048, Minutes: 5})
+	c.Assert(err, check.IsNil)
+	list := b.list()
+	c.Assert(list, check.HasLen, 2)
+	c.Check(list[0].TaskID, check.Equals, "bar")
+	c.Check(list[1].TaskID, check.Equals, "foo")
+
+	// the boosts are dropped once they expire
+	now = now.Add(5 * time.Minute)
+	c.Check(b.get("bar"), check.IsNil)
+	c.Check(b.get("foo").RateLimit, check.Equals, int64(1024))
+	c.Check(b.list(), check.HasLen, 1)
+	c.Check(errortypes.IsDataNotFound(errors.Cause(b.remove("bar"))), check.Equals, true)
+	c.Check(b.remove("foo"), check.IsNil)
+	c.Check(b.get("foo"), check.IsNil)
+}
+
+func (s *BoostTestSuite) TestManagerBoost(c *check.C) {
+	sm, err := NewManager(config.NewConfig(), nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	ctx := context.Background()
+
+	_, err = sm.GetBoost(ctx, "foo")
+	c.Check(errortypes.IsDataNotFound(errors.Cause(err)), check.Equals, true)
+	_, err = sm.SetBoost(ctx, "foo", &types.TaskBoost{RateLimit: 1024, Minutes: 10})
+	c.Assert(err, check.IsNil)
+	boost, err := sm.GetBoost(ctx, "foo")
+	c.Assert(err, check.IsNil)
+	c.Check(boost.RateLimit, check.Equals, int64(1024))
+	c.Check(sm.ListBoosts(ctx), check.HasLen, 1)
+	c.Check(sm.DeleteBoost(ctx, "foo"), check.IsNil)
+	c.Check(sm.ListBoosts(ctx), check.HasLen, 0)
+}
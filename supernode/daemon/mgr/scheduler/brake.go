@@ -0,0 +1,204 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+)
+
+// brake holds the emergency brakes of the P2P traffic scheduled by supernode.
+// The global one applies to all the peers and it's off unless it's engaged through
+// the API, and the scoped ones only apply to the peers whose labels match their selectors.
+type brake struct {
+	mu     sync.RWMutex
+	global types.EmergencyBrake
+	scoped map[string]*types.EmergencyBrake
+}
+
+func newBrake() *brake {
+	return &brake{
+		global: types.EmergencyBrake{Mode: types.EmergencyBrakeModeOff},
+		scoped: make(map[string]*types.EmergencyBrake),
+	}
+}
+
+// set changes the global brake if the name of state is empty, or the scoped one
+// of the name otherwise, and returns the new one. A scoped brake is removed
+// when it's changed to off.
+func (b *brake) set(state *types.EmergencyBrake) (*types.EmergencyBrake, error) {
+	state, err := normalizeBrake(state)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state.Name == "" {
+		b.global = *state
+		return copyBrake(&b.global), nil
+	}
+	if state.Mode == types.EmergencyBrakeModeOff {
+		delete(b.scoped, state.Name)
+	} else {
+		b.scoped[state.Name] = state
+	}
+	return copyBrake(state), nil
+}
+
+// remove lifts the scoped brake of the name.
+func (b *brake) remove(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.scoped[name]; !ok {
+		return errors.Wrapf(errortypes.ErrDataNotFound, "brake %s", name)
+	}
+	delete(b.scoped, name)
+	return nil
+}
+
+// get returns a copy of the global brake.
+func (b *brake) get() *types.EmergencyBrake {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return copyBrake(&b.global)
+}
+
+// list returns the copies of the scoped brakes sorted by name.
+func (b *brake) list() []*types.EmergencyBrake {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	brakes := make([]*types.EmergencyBrake, 0, len(b.scoped))
+	for _, v := range b.scoped {
+		brakes = append(brakes, copyBrake(v))
+	}
+	sort.Slice(brakes, func(i, j int) bool {
+		return brakes[i].Name < brakes[j].Name
+	})
+	return brakes
+}
+
+// paused returns whether the global brake pauses the traffic of all the peers.
+func (b *brake) paused() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.global.Mode == types.EmergencyBrakeModePause
+}
+
+// hasScoped returns whether there is any scoped brake, so that the labels of
+// the peers need to be checked.
+func (b *brake) hasScoped() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.scoped) > 0
+}
+
+// forLabels returns the strictest one of the brakes which apply to the peer of the labels.
+// A pausing brake is stricter than a throttling one, and a throttling one with a lower
+// rate limit is stricter than the others.
+func (b *brake) forLabels(labels map[string]string) *types.EmergencyBrake {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	strictest := &b.global
+	for _, v := range b.scoped {
+		if matchLabels(v.Selector, labels) && stricterBrake(v, strictest) {
+			strictest = v
+		}
+	}
+	return copyBrake(strictest)
+}
+
+// normalizeBrake validates the state and drops the fields which aren't used by its mode.
+func normalizeBrake(state *types.EmergencyBrake) (*types.EmergencyBrake, error) {
+	normalized := &types.EmergencyBrake{
+		Name:       state.Name,
+		Mode:       state.Mode,
+		UpdateTime: strfmt.DateTime(time.Now()),
+	}
+	switch state.Mode {
+	case types.EmergencyBrakeModeOff, types.EmergencyBrakeModePause:
+	case types.EmergencyBrakeModeThrottle:
+		if state.RateLimit <= 0 {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "rateLimit %d of throttle", state.RateLimit)
+		}
+		normalized.RateLimit = state.RateLimit
+	case "":
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "mode")
+	default:
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "mode %s", state.Mode)
+	}
+
+	if state.Name == "" {
+		if len(state.Selector) > 0 {
+			return nil, errors.Wrap(errortypes.ErrInvalidValue, "selector of the global brake")
+		}
+		return normalized, nil
+	}
+	if len(state.Selector) == 0 {
+		return nil, errors.Wrapf(errortypes.ErrEmptyValue, "selector of brake %s", state.Name)
+	}
+	normalized.Selector = make(map[string]string, len(state.Selector))
+	for k, v := range state.Selector {
+		normalized.Selector[k] = v
+	}
+	return normalized, nil
+}
+
+// matchLabels returns whether the labels contain all the key-value pairs of the selector.
+func matchLabels(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// stricterBrake returns whether a is stricter than b.
+func stricterBrake(a, b *types.EmergencyBrake) bool {
+	rank := func(brake *types.EmergencyBrake) int {
+		switch brake.Mode {
+		case types.EmergencyBrakeModePause:
+			return 2
+		case types.EmergencyBrakeModeThrottle:
+			return 1
+		}
+		return 0
+	}
+	if rank(a) != rank(b) {
+		return rank(a) > rank(b)
+	}
+	return a.Mode == types.EmergencyBrakeModeThrottle && a.RateLimit < b.RateLimit
+}
+
+func copyBrake(state *types.EmergencyBrake) *types.EmergencyBrake {
+	c := *state
+	if state.Selector != nil {
+		c.Selector = make(map[string]string, len(state.Selector))
+		for k, v := range state.Selector {
+			c.Selector[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	check.Suite(&BrakeTestSuite{})
+}
+
+type BrakeTestSuite struct{}
+
+func (s *BrakeTestSuite) TestSetBrake(c *check.C) {
+	b := newBrake()
+	c.Check(b.get().Mode, check.Equals, types.EmergencyBrakeModeOff)
+	c.Check(b.paused(), check.Equals, false)
+
+	var cases = []struct {
+		brake *types.EmergencyBrake
+		err   bool
+	}{
+		{brake: &types.EmergencyBrake{}, err: true},
+		{brake: &types.EmergencyBrake{Mode: "foo"}, err: true},
+		{brake: &types.EmergencyBrake{Mode: types.EmergencyBrakeModeThrottle}, err: true},
+		{brake: &types.EmergencyBrake{Mode: types.EmergencyBrakeModeThrottle, RateLimit: 1024}},
+		{brake: &types.EmergencyBrake{Mode: types.EmergencyBrakeModePause, RateLimit: 1024}},
+	}
+	for _, v := range cases {
+		state, err := b.set(v.brake)
+		cmt := check.Commentf("%+v", v.brake)
+		c.Check(err != nil, check.Equals, v.err, cmt)
+		if err != nil {
+			continue
+		}
+		c.Check(state.Mode, check.Equals, v.brake.Mode, cmt)
+		c.Check(state.UpdateTime.String(), check.Not(check.Equals), "", cmt)
+	}
+
+	// the rate limit is only kept for throttle
+	c.Check(b.get().RateLimit, check.Equals, int64(0))
+	c.Check(b.paused(), check.Equals, true)
+}
+
+func (s *BrakeTestSuite) TestSchedulePaused(c *check.C) {
+	sm, err := NewManager(config.NewConfig(), nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	_, err = sm.SetBrake(context.Background(), &types.EmergencyBrake{Mode: types.EmergencyBrakeModePause})
+	c.Assert(err, check.IsNil)
+
+	// the progress isn't touched while the brake is engaged
+	_, err = sm.Schedule(context.Background(), "task", "client", "peer", types.PriorityNormal, nil)
+	c.Check(errortypes.IsPeerWait(errors.Cause(err)), check.Equals, true)
+}
+
+func (s *BrakeTestSuite) TestScopedBrake(c *check.C) {
+	b := newBrake()
+	_, err := b.set(&types.EmergencyBrake{Name: "idc-a", Mode: types.EmergencyBrakeModePause})
+	c.Check(errortypes.IsEmptyValue(errors.Cause(err)), check.Equals, true)
+	_, err = b.set(&types.EmergencyBrake{Mode: types.EmergencyBrakeModePause, Selector: map[string]string{"idc": "a"}})
+	c.Check(errortypes.IsInvalidValue(errors.Cause(err)), check.Equals, true)
+
+	brakes := []*types.EmergencyBrake{
+		{Name: "idc-a", Mode: types.EmergencyBrakeModeThrottle, RateLimit: 2048, Selector: map[string]string{"idc": "a"}},
+		{Name: "rack-r1", Mode: types.EmergencyBrakeModeThrottle, RateLimit: 1024, Selector: map[string]string{"idc": "a", "rack": "r1"}},
+		{Name: "idc-b", Mode: types.EmergencyBrakeModePause, Selector: map[string]string{"idc": "b"}},
+	}
+	for _, v := range brakes {
+		_, err := b.set(v)
+		c.Assert(err, check.IsNil)
+	}
+	c.Check(b.paused(), check.Equals, false)
+	c.Check(b.hasScoped(), check.Equals, true)
+
+	var names []string
+	for _, v := range b.list() {
+		names = append(names, v.Name)
+	}
+	c.Check(names, check.DeepEquals, []string{"idc-a", "idc-b", "rack-r1"})
+
+	var cases = []struct {
+		labels map[string]string
+		name   string
+		mode   string
+	}{
+		{labels: nil, name: "", mode: types.EmergencyBrakeModeOff},
+		{labels: map[string]string{"idc": "c"}, name: "", mode: types.EmergencyBrakeModeOff},
+		{labels: map[string]string{"idc": "a"}, name: "idc-a", mode: types.EmergencyBrakeModeThrottle},
+		{labels: map[string]string{"idc": "a", "rack": "r1"}, name: "rack-r1", mode: types.EmergencyBrakeModeThrottle},
+		{labels: map[string]string{"idc": "b", "rack": "r1"}, name: "idc-b", mode: types.EmergencyBrakeModePause},
+	}
+	for _, v := range cases {
+		brake := b.forLabels(v.labels)
+		cmt := check.Commentf("%v", v.labels)
+		c.Check(brake.Name, check.Equals, v.name, cmt)
+		c.Check(brake.Mode, check.Equals, v.mode, cmt)
+	}
+
+	// the global brake applies to all the peers if it's stricter
+	_, err = b.set(&types.EmergencyBrake{Mode: types.EmergencyBrakeModeThrottle, RateLimit: 512})
+	c.Assert(err, check.IsNil)
+	c.Check(b.forLabels(map[string]string{"idc": "a", "rack": "r1"}).RateLimit, check.Equals, int64(512))
+
+	// a scoped brake is removed when it's turned off or deleted
+	_, err = b.set(&types.EmergencyBrake{Name: "idc-a", Mode: types.EmergencyBrakeModeOff, Selector: map[string]string{"idc": "a"}})
+	c.Assert(err, check.IsNil)
+	c.Check(b.remove("idc-b"), check.IsNil)
+	c.Check(errortypes.IsDataNotFound(errors.Cause(b.remove("idc-b"))), check.Equals, true)
+	c.Check(b.list(), check.HasLen, 1)
+}
@@ -18,10 +18,12 @@ package scheduler
 
 import (
 	"context"
+	"math"
 	"math/rand"
 	"sort"
 	"time"
 
+	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
@@ -39,25 +41,57 @@ var _ mgr.SchedulerMgr = &Manager{}
 
 // Manager is an implement of the interface of SchedulerMgr.
 type Manager struct {
-	cfg         *config.Config
-	progressMgr mgr.ProgressMgr
+	cfg             *config.Config
+	progressMgr     mgr.ProgressMgr
+	peerMgr         mgr.PeerMgr
+	contributionMgr mgr.ContributionMgr
+	audit           *auditLog
+	brake           *brake
+	boosts          *boosts
+	strategies      *strategySplit
 }
 
 // NewManager returns a new Manager.
-func NewManager(cfg *config.Config, progressMgr mgr.ProgressMgr) (*Manager, error) {
+func NewManager(cfg *config.Config, progressMgr mgr.ProgressMgr, peerMgr mgr.PeerMgr,
+	contributionMgr mgr.ContributionMgr) (*Manager, error) {
+	strategies, err := newStrategySplit(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &Manager{
-		cfg:         cfg,
-		progressMgr: progressMgr,
+		cfg:             cfg,
+		progressMgr:     progressMgr,
+		peerMgr:         peerMgr,
+		contributionMgr: contributionMgr,
+		audit:           newAuditLog(cfg.SchedulerAuditSize, cfg.SchedulerAuditFile),
+		brake:           newBrake(),
+		boosts:          newBoosts(),
+		strategies:      strategies,
 	}, nil
 }
 
 // Schedule gets scheduler result with specified taskID, clientID and peerID through some rules.
-func (sm *Manager) Schedule(ctx context.Context, taskID, clientID, peerID string) ([]*mgr.PieceResult, error) {
+func (sm *Manager) Schedule(ctx context.Context, taskID, clientID, peerID string, priority types.Priority, pieceRange *mgr.PieceRange) ([]*mgr.PieceResult, error) {
+	// the peers are looked up once in the pass, no matter how many pieces they have
+	peers := sm.newPeerLookup()
+	if sm.brake.paused() || sm.peerBrake(ctx, peers, peerID).Mode == types.EmergencyBrakeModePause {
+		return nil, errors.Wrapf(errortypes.ErrPeerWait, "emergency brake is engaged, taskID(%s) clientID(%s)", taskID, clientID)
+	}
+
 	// get available pieces
 	pieceAvailable, err := sm.progressMgr.GetPieceProgressByCID(ctx, taskID, clientID, "available")
 	if err != nil {
 		return nil, err
 	}
+	if pieceRange != nil {
+		var inRange []int
+		for _, pieceNum := range pieceAvailable {
+			if pieceRange.Contains(pieceNum) {
+				inRange = append(inRange, pieceNum)
+			}
+		}
+		pieceAvailable = inRange
+	}
 	if len(pieceAvailable) == 0 {
 		return nil, errors.Wrapf(errortypes.ErrPeerWait, "taskID(%s) clientID(%s)", taskID, clientID)
 	}
@@ -75,17 +109,151 @@ func (sm *Manager) Schedule(ctx context.Context, taskID, clientID, peerID string
 	}
 
 	// prioritize pieces
-	pieceNums, err := sm.sort(ctx, pieceAvailable, pieceRunning, taskID)
+	strategy := sm.strategies.of(taskID)
+	pieceNums, err := sm.sort(ctx, peers, strategy, pieceAvailable, pieceRunning, taskID)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("scheduler get pieces %v with prioritize by %s for taskID(%s) clientID(%s)", pieceNums, strategy, taskID, clientID)
+
+	return sm.getPieceResults(ctx, peers, taskID, clientID, peerID, priority, strategy, pieceNums, runningCount)
+}
+
+// GetDecisions returns the latest scheduler decisions of the taskID.
+func (sm *Manager) GetDecisions(ctx context.Context, taskID string, limit int) ([]*mgr.SchedulerDecision, error) {
+	if sm.audit == nil {
+		return nil, errors.Wrap(errortypes.ErrNotInitialized, "scheduler audit log is disabled")
+	}
+	return sm.audit.list(taskID, limit), nil
+}
+
+// SetBrake engages the emergency brake of the P2P traffic, or lifts it if the mode is off.
+// The brake is the global one if its name is empty, or the scoped one of the name otherwise.
+func (sm *Manager) SetBrake(ctx context.Context, brake *types.EmergencyBrake) (*types.EmergencyBrake, error) {
+	state, err := sm.brake.set(brake)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Warnf("emergency brake(%s) is changed to mode(%s) rateLimit(%d) selector(%v)",
+		state.Name, state.Mode, state.RateLimit, state.Selector)
+	return state, nil
+}
+
+// GetStrategy returns the strategy which schedules the pieces of the task.
+func (sm *Manager) GetStrategy(ctx context.Context, taskID string) string {
+	return sm.strategies.of(taskID)
+}
+
+// GetBrake returns the global emergency brake of the P2P traffic.
+func (sm *Manager) GetBrake(ctx context.Context) *types.EmergencyBrake {
+	return sm.brake.get()
+}
+
+// ListBrakes returns the scoped emergency brakes sorted by name.
+func (sm *Manager) ListBrakes(ctx context.Context) []*types.EmergencyBrake {
+	return sm.brake.list()
+}
+
+// DeleteBrake lifts the scoped emergency brake of the name.
+func (sm *Manager) DeleteBrake(ctx context.Context, name string) error {
+	if err := sm.brake.remove(name); err != nil {
+		return err
+	}
+	logrus.Warnf("emergency brake(%s) is lifted", name)
+	return nil
+}
+
+// GetPeerBrake returns the strictest one of the emergency brakes which apply to the peer.
+func (sm *Manager) GetPeerBrake(ctx context.Context, peerID string) *types.EmergencyBrake {
+	return sm.peerBrake(ctx, sm.newPeerLookup(), peerID)
+}
+
+// SetBoost grants the temporary bandwidth boost to the task, which replaces the previous one.
+func (sm *Manager) SetBoost(ctx context.Context, taskID string, boost *types.TaskBoost) (*types.TaskBoost, error) {
+	state, err := sm.boosts.set(taskID, boost)
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debugf("scheduler get pieces %v with prioritize for taskID(%s) clientID(%s)", pieceNums, taskID, clientID)
+	logrus.Warnf("bandwidth boost of task(%s) is granted with rateLimit(%d) until %s",
+		taskID, state.RateLimit, state.ExpireTime)
+	return state, nil
+}
+
+// GetBoost returns the bandwidth boost of the task which hasn't expired.
+func (sm *Manager) GetBoost(ctx context.Context, taskID string) (*types.TaskBoost, error) {
+	boost := sm.boosts.get(taskID)
+	if boost == nil {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "boost of task %s", taskID)
+	}
+	return boost, nil
+}
+
+// ListBoosts returns the bandwidth boosts which haven't expired sorted by the expire time.
+func (sm *Manager) ListBoosts(ctx context.Context) []*types.TaskBoost {
+	return sm.boosts.list()
+}
+
+// DeleteBoost revokes the bandwidth boost of the task before it expires.
+func (sm *Manager) DeleteBoost(ctx context.Context, taskID string) error {
+	if err := sm.boosts.remove(taskID); err != nil {
+		return err
+	}
+	logrus.Warnf("bandwidth boost of task(%s) is revoked", taskID)
+	return nil
+}
+
+// peerBrake matches the scoped brakes against the labels of the peer only when
+// there is any of them, so that the peer isn't looked up in the common case.
+func (sm *Manager) peerBrake(ctx context.Context, peers *peerLookup, peerID string) *types.EmergencyBrake {
+	if !sm.brake.hasScoped() {
+		return sm.brake.get()
+	}
+	var labels map[string]string
+	if peerInfo := peers.get(ctx, peerID); peerInfo != nil {
+		labels = peerInfo.Labels
+	}
+	return sm.brake.forLabels(labels)
+}
+
+// peerLookup looks up the PeerInfo of the peers in a scheduling pass, each of which is
+// got from the PeerMgr once and shared by all the checks of the pieces in the pass.
+type peerLookup struct {
+	peerMgr mgr.PeerMgr
+	// infos caches the PeerInfo of the peers looked up, it's nil
+	// for the peers never sending a heart beat.
+	infos map[string]*types.PeerInfo
+}
+
+func (sm *Manager) newPeerLookup() *peerLookup {
+	return &peerLookup{
+		peerMgr: sm.peerMgr,
+		infos:   make(map[string]*types.PeerInfo),
+	}
+}
 
-	return sm.getPieceResults(ctx, taskID, clientID, peerID, pieceNums, runningCount)
+// get returns the PeerInfo of the peer, it's nil if the peer is unknown.
+func (p *peerLookup) get(ctx context.Context, peerID string) *types.PeerInfo {
+	if p.peerMgr == nil {
+		return nil
+	}
+	if peerInfo, ok := p.infos[peerID]; ok {
+		return peerInfo
+	}
+	peerInfo, err := p.peerMgr.Get(ctx, peerID)
+	if err != nil {
+		peerInfo = nil
+	}
+	p.infos[peerID] = peerInfo
+	return peerInfo
 }
 
-func (sm *Manager) sort(ctx context.Context, pieceNums, runningPieces []int, taskID string) ([]int, error) {
-	pieceCountMap, err := sm.getPieceCountMap(ctx, pieceNums, taskID)
+func (sm *Manager) sort(ctx context.Context, peers *peerLookup, strategy string, pieceNums, runningPieces []int, taskID string) ([]int, error) {
+	if strategy == config.SchedulerStrategySequential {
+		sort.Ints(pieceNums)
+		return pieceNums, nil
+	}
+
+	pieceCountMap, err := sm.getPieceCountMap(ctx, peers, pieceNums, taskID)
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +262,7 @@ func (sm *Manager) sort(ctx context.Context, pieceNums, runningPieces []int, tas
 	return pieceNums, nil
 }
 
-func (sm *Manager) getPieceCountMap(ctx context.Context, pieceNums []int, taskID string) (map[int]int, error) {
+func (sm *Manager) getPieceCountMap(ctx context.Context, peers *peerLookup, pieceNums []int, taskID string) (map[int]int, error) {
 	pieceCountMap := make(map[int]int)
 	for i := 0; i < len(pieceNums); i++ {
 		// NOTE: should we return errors here or just record an error log?
@@ -102,7 +270,7 @@ func (sm *Manager) getPieceCountMap(ctx context.Context, pieceNums []int, taskID
 		if err != nil {
 			return nil, err
 		}
-		pieceCountMap[pieceNums[i]] = len(peerIDs)
+		pieceCountMap[pieceNums[i]] = len(peerIDs) - sm.countCacheFull(ctx, peers, peerIDs)
 	}
 	return pieceCountMap, nil
 }
@@ -140,7 +308,8 @@ func (sm *Manager) sortExecutor(ctx context.Context, pieceNums []int, centerNum
 	})
 }
 
-func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, srcPID string, pieceNums []int, runningCount int) ([]*mgr.PieceResult, error) {
+func (sm *Manager) getPieceResults(ctx context.Context, peers *peerLookup, taskID, clientID, srcPID string, priority types.Priority,
+	strategy string, pieceNums []int, runningCount int) ([]*mgr.PieceResult, error) {
 	// validate ClientErrorCount
 	var useSupernode bool
 	srcPeerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, srcPID)
@@ -152,12 +321,31 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, srcPID
 			srcPID, srcPeerState.ClientErrorCount.Get(), sm.cfg.FailureCountLimit, taskID)
 		useSupernode = true
 	}
+	upLimit, limitReason := sm.getPeerUpLimit(ctx, peers, srcPID), "incentive-limit"
+	superLimit := int32(sm.cfg.PeerDownLimit)
+	// the clients of low priority leave the rest of the upload slots to the ones of higher priorities.
+	if priority == types.PriorityLow {
+		if limit := sm.getLowPriorityLimit(sm.cfg.PeerUpLimit); limit < upLimit {
+			upLimit, limitReason = limit, "priority-limit"
+		}
+		superLimit = sm.getLowPriorityLimit(sm.cfg.PeerDownLimit)
+	}
 
 	pieceResults := make([]*mgr.PieceResult, 0)
 	for i := 0; i < len(pieceNums); i++ {
 		var dstPID string
+		decision := &mgr.SchedulerDecision{
+			Time:     time.Now(),
+			TaskID:   taskID,
+			ClientID: clientID,
+			PeerID:   srcPID,
+			PieceNum: pieceNums[i],
+			Priority: priority,
+			Strategy: strategy,
+		}
 		if useSupernode {
 			dstPID = sm.cfg.GetSuperPID()
+			decision.Reason = mgr.DecisionReasonClientErrorLimit
 		} else {
 			// get peerIDs by pieceNum
 			peerIDs, err := sm.progressMgr.GetPeerIDsByPieceNum(ctx, taskID, pieceNums[i])
@@ -165,7 +353,8 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, srcPID
 			if err != nil {
 				return nil, errors.Wrapf(errortypes.ErrUnknownError, "failed to get peerIDs for pieceNum: %d of taskID: %s", pieceNums[i], taskID)
 			}
-			dstPID = sm.tryGetPID(ctx, taskID, pieceNums[i], srcPID, peerIDs)
+			decision.DistributedCount = len(peerIDs)
+			dstPID = sm.tryGetPID(ctx, peers, taskID, pieceNums[i], srcPID, peerIDs, upLimit, limitReason, decision)
 		}
 
 		if dstPID == "" {
@@ -174,20 +363,26 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, srcPID
 
 		// We limit the number of simultaneous connections that supernode can accept for each task.
 		if sm.cfg.IsSuperPID(dstPID) {
-			updated, err := sm.progressMgr.UpdateSuperLoad(ctx, taskID, 1, int32(sm.cfg.PeerDownLimit))
+			updated, err := sm.progressMgr.UpdateSuperLoad(ctx, taskID, 1, superLimit)
 			if err != nil {
 				logrus.Warnf("failed to update super load taskID(%s) clientID(%s): %v", taskID, clientID, err)
 				continue
 			}
 			if !updated {
+				decision.Reason = mgr.DecisionReasonSuperLoadLimit
+				sm.audit.record(decision)
 				continue
 			}
 		}
 
 		if err := sm.progressMgr.UpdateClientProgress(ctx, taskID, clientID, dstPID, pieceNums[i], config.PieceRUNNING); err != nil {
 			logrus.Warnf("scheduler: failed to update client progress running for pieceNum(%d) taskID(%s) clientID(%s) dstPID(%s)", pieceNums[i], taskID, clientID, dstPID)
+			decision.Reason = mgr.DecisionReasonUpdateProgressFailed
+			sm.audit.record(decision)
 			continue
 		}
+		decision.DstPID = dstPID
+		sm.audit.record(decision)
 
 		pieceResults = append(pieceResults, &mgr.PieceResult{
 			TaskID:   taskID,
@@ -204,60 +399,257 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, srcPID
 	return pieceResults, nil
 }
 
-// tryGetPID returns an available dstPID from ps.pieceContainer.
-func (sm *Manager) tryGetPID(ctx context.Context, taskID string, pieceNum int, srcPID string, peerIDs []string) (dstPID string) {
+// tryGetPID returns an available dstPID from ps.pieceContainer,
+// and the load of it should not exceed upLimit after assigned.
+// The reason of the choice and the rejected peers are recorded into the decision,
+// and limitReason is the reason of the peers rejected by the upLimit below PeerUpLimit.
+// The states of all the candidates are recorded too if the audit log is enabled,
+// by which the decision is replayed offline.
+func (sm *Manager) tryGetPID(ctx context.Context, peers *peerLookup, taskID string, pieceNum int, srcPID string, peerIDs []string,
+	upLimit int32, limitReason string, decision *mgr.SchedulerDecision) (dstPID string) {
 	defer func() {
 		if dstPID == "" {
 			dstPID = sm.cfg.GetSuperPID()
+			decision.Reason = mgr.DecisionReasonNoAvailablePeer
+			return
 		}
+		decision.Reason = mgr.DecisionReasonPeer
 	}()
-
-	for i := 0; i < len(peerIDs); i++ {
-		// if failed to get peerState, and then it should not be needed.
-		peerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, peerIDs[i])
-		if err != nil {
-			logrus.Warnf("scheduler: failed to GetPeerStateByPeerID taskID(%s) peerID(%s): %v", taskID, peerIDs[i], err)
-			sm.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerIDs[i])
-			continue
+	peerUpLimit := int32(sm.cfg.PeerUpLimit)
+	decision.UpLimit, decision.PeerUpLimit, decision.LimitReason = upLimit, peerUpLimit, limitReason
+	if len(peerIDs) == 0 {
+		return
+	}
+	reject := func(peerID, reason string) {
+		if decision.Rejected == nil {
+			decision.Rejected = make(map[string]string)
 		}
+		decision.Rejected[peerID] = reason
+	}
 
-		// if the service has been down, and then it should not be needed.
-		if peerState.ServiceDownTime > 0 {
-			logrus.Warnf("scheduler: the peer(%s) has been offline and will delete it from piece state", peerIDs[i])
-			sm.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerIDs[i])
-			continue
-		}
+	// the black list of the client is the same for all the candidates
+	blackInfo, blackErr := sm.progressMgr.GetBlackInfoByPeerID(ctx, srcPID)
+	if blackErr != nil && errortypes.IsDataNotFound(blackErr) {
+		blackErr = nil
+	}
+	if blackErr != nil {
+		logrus.Warnf("scheduler: failed to get blackInfo for peerID %s: %v", srcPID, blackErr)
+	}
 
-		// if service has failed for EliminationLimit times, and then it should not be needed.
-		if peerState.ServiceErrorCount != nil {
-			serviceErrorCount := peerState.ServiceErrorCount.Get()
-			if int(serviceErrorCount) >= sm.cfg.EliminationLimit {
-				logrus.Warnf("scheduler: the peer(%s) has been eliminated to because of too many errors(%d) occurred as a peer server", peerIDs[i], serviceErrorCount)
+	peerIDs = sm.sortByCacheFull(ctx, peers, peerIDs)
+	for i := 0; i < len(peerIDs); i++ {
+		candidate, peerState := sm.inspectCandidate(ctx, peers, peerIDs[i], blackInfo, blackErr)
+		if sm.audit != nil {
+			decision.Candidates = append(decision.Candidates, candidate)
+		}
+		if reason, deleted := checkCandidate(candidate, sm.cfg.EliminationLimit); reason != "" {
+			if deleted {
+				logrus.Warnf("scheduler: delete the peer(%s) from the piece state of pieceNum(%d) taskID(%s): %s",
+					peerIDs[i], pieceNum, taskID, reason)
 				sm.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerIDs[i])
-				continue
+			} else if reason == "eliminated" {
+				logrus.Warnf("scheduler: the peer(%s) has been eliminated because of too many errors(%d) occurred as a peer server",
+					peerIDs[i], candidate.ServiceErrorCount)
 			}
-		}
-
-		// if the v is in the blackList, try the next one.
-		blackInfo, err := sm.progressMgr.GetBlackInfoByPeerID(ctx, srcPID)
-		if err != nil && !errortypes.IsDataNotFound(err) {
-			logrus.Warnf("scheduler: failed to get blackInfo for peerID %s: %v", peerIDs[i], err)
-			continue
-		}
-		if blackInfo != nil && isExistInMap(blackInfo, peerIDs[i]) {
+			reject(peerIDs[i], reason)
 			continue
 		}
 
 		if peerState.ProducerLoad != nil {
-			if peerState.ProducerLoad.Add(1) <= int32(sm.cfg.PeerUpLimit) {
+			load := peerState.ProducerLoad.Add(1)
+			candidate.Load = load - 1
+			reason := checkLoad(load, upLimit, peerUpLimit, limitReason)
+			if reason == "" {
+				if sm.audit != nil {
+					for _, peerID := range peerIDs[i+1:] {
+						rest, _ := sm.inspectCandidate(ctx, peers, peerID, blackInfo, blackErr)
+						decision.Candidates = append(decision.Candidates, rest)
+					}
+				}
 				return peerIDs[i]
 			}
 			peerState.ProducerLoad.Add(-1)
+			reject(peerIDs[i], reason)
 		}
 	}
 	return
 }
 
+// inspectCandidate returns the state of the candidate peer checked by the scheduler,
+// and the progress state of the peer which is nil if it's not found.
+func (sm *Manager) inspectCandidate(ctx context.Context, peers *peerLookup, peerID string,
+	blackInfo *syncmap.SyncMap, blackErr error) (*mgr.SchedulerCandidate, *mgr.PeerState) {
+	candidate := &mgr.SchedulerCandidate{PeerID: peerID, Load: -1}
+	peerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, peerID)
+	if err != nil {
+		candidate.NoState = true
+		return candidate, nil
+	}
+
+	candidate.ServiceDown = !peerState.ServiceDownTime.IsZero()
+	candidate.Liveness = sm.getPeerLivenessState(ctx, peers, peerID)
+	candidate.Standby = sm.isStandbyHeld(ctx, peers, peerID)
+	candidate.Braked = sm.brake.hasScoped() && sm.peerBrake(ctx, peers, peerID).Mode == types.EmergencyBrakeModePause
+	if peerState.ServiceErrorCount != nil {
+		candidate.ServiceErrorCount = peerState.ServiceErrorCount.Get()
+	}
+	candidate.BlackInfoError = blackErr != nil
+	candidate.BlackListed = isExistInMap(blackInfo, peerID)
+	if peerState.ProducerLoad != nil {
+		candidate.Load = peerState.ProducerLoad.Get()
+	}
+	return candidate, peerState
+}
+
+// checkCandidate checks the state of the candidate peer before its load, and returns the
+// reason why it's rejected and whether it should be deleted from the piece state.
+// The reason is empty if the peer passes the checks.
+func checkCandidate(candidate *mgr.SchedulerCandidate, eliminationLimit int) (reason string, deleted bool) {
+	switch {
+	// the peer without state is not needed
+	case candidate.NoState:
+		return "peer-state-not-found", true
+	// the peer whose service has been down is not needed
+	case candidate.ServiceDown:
+		return "service-down", true
+	// the peer missing its heart beats is not needed,
+	// and a suspect peer may come back so only the dead one is deleted
+	case candidate.Liveness == types.PeerInfoStateSuspect:
+		return candidate.Liveness, false
+	case candidate.Liveness == types.PeerInfoStateDead:
+		return candidate.Liveness, true
+	// the warm standby of an alive primary is held back until the primary goes down
+	case candidate.Standby:
+		return "standby", false
+	// the peer paused by a scoped emergency brake is not needed
+	case candidate.Braked:
+		return "brake", false
+	// the peer whose service has failed for EliminationLimit times is not needed
+	case int(candidate.ServiceErrorCount) >= eliminationLimit:
+		return "eliminated", false
+	case candidate.BlackInfoError:
+		return "black-info-error", false
+	case candidate.BlackListed:
+		return "black-list", false
+	}
+	return "", false
+}
+
+// checkLoad returns the reason why the candidate peer is rejected by its load after
+// the piece is assigned, and it's empty if the load doesn't exceed the upLimit.
+func checkLoad(load, upLimit, peerUpLimit int32, limitReason string) string {
+	if load <= upLimit {
+		return ""
+	}
+	if load <= peerUpLimit {
+		return limitReason
+	}
+	return "upload-limit"
+}
+
+// getPeerUpLimit returns the max load of the peers which can be assigned to the srcPID.
+// It's PeerUpLimit unless the incentive is enabled by IncentiveWeight, and then the node
+// of srcPID which uploads less than it downloads gets a smaller one, but at least 1.
+// The node which has never downloaded anything from the p2p network is not limited.
+func (sm *Manager) getPeerUpLimit(ctx context.Context, peers *peerLookup, srcPID string) int32 {
+	limit := int32(sm.cfg.PeerUpLimit)
+	weight := sm.cfg.IncentiveWeight
+	if weight <= 0 || sm.peerMgr == nil || sm.contributionMgr == nil {
+		return limit
+	}
+	if weight > 1 {
+		weight = 1
+	}
+
+	peerInfo := peers.get(ctx, srcPID)
+	if peerInfo == nil {
+		return limit
+	}
+	contribution, err := sm.contributionMgr.Get(ctx, peerInfo.IP.String())
+	if err != nil || contribution.DownloadedBytes <= 0 || contribution.Ratio >= 1 {
+		return limit
+	}
+
+	reduced := limit - int32(math.Round(weight*(1-contribution.Ratio)*float64(limit)))
+	if reduced < 1 {
+		reduced = 1
+	}
+	return reduced
+}
+
+// getLowPriorityLimit returns the part of the limit which the clients of low priority
+// can take according to the LowPriorityRatio, but at least 1.
+func (sm *Manager) getLowPriorityLimit(limit int) int32 {
+	ratio := sm.cfg.LowPriorityRatio
+	if ratio <= 0 || ratio >= 1 {
+		return int32(limit)
+	}
+	reduced := int32(math.Round(ratio * float64(limit)))
+	if reduced < 1 {
+		reduced = 1
+	}
+	return reduced
+}
+
+// isCacheFull returns whether the cache utilization of the peer advertised by its
+// heart beats reaches the PeerCacheFullRatio, which means that the peer is about
+// to evict the cached files and should not be relied on as a long-term source.
+func (sm *Manager) isCacheFull(ctx context.Context, peers *peerLookup, peerID string) bool {
+	if sm.cfg.PeerCacheFullRatio <= 0 {
+		return false
+	}
+	peerInfo := peers.get(ctx, peerID)
+	if peerInfo == nil || peerInfo.CacheCapacity <= 0 {
+		return false
+	}
+	return float64(peerInfo.CacheUsed) >= sm.cfg.PeerCacheFullRatio*float64(peerInfo.CacheCapacity)
+}
+
+// countCacheFull returns the number of the peers whose caches are nearly full.
+// They're not counted in the distribution of a piece, so the pieces only owned by them
+// are prioritized and replicated to the other peers before they're evicted.
+func (sm *Manager) countCacheFull(ctx context.Context, peers *peerLookup, peerIDs []string) (count int) {
+	for _, peerID := range peerIDs {
+		if sm.isCacheFull(ctx, peers, peerID) {
+			count++
+		}
+	}
+	return count
+}
+
+// sortByCacheFull moves the peers whose caches are nearly full to the end,
+// so that they're tried after the others. The order is kept otherwise.
+func (sm *Manager) sortByCacheFull(ctx context.Context, peers *peerLookup, peerIDs []string) []string {
+	if sm.peerMgr == nil || sm.cfg.PeerCacheFullRatio <= 0 {
+		return peerIDs
+	}
+	sorted := make([]string, 0, len(peerIDs))
+	var full []string
+	for _, peerID := range peerIDs {
+		if sm.isCacheFull(ctx, peers, peerID) {
+			full = append(full, peerID)
+			continue
+		}
+		sorted = append(sorted, peerID)
+	}
+	return append(sorted, full...)
+}
+
+// getPeerLivenessState returns the liveness state of the peer,
+// and it's empty if the peer never sends a heart beat.
+func (sm *Manager) getPeerLivenessState(ctx context.Context, peers *peerLookup, peerID string) string {
+	if peerInfo := peers.get(ctx, peerID); peerInfo != nil {
+		return peerInfo.State
+	}
+	return ""
+}
+
+// isStandbyHeld returns whether the peer is a warm standby which isn't promoted yet.
+func (sm *Manager) isStandbyHeld(ctx context.Context, peers *peerLookup, peerID string) bool {
+	peerInfo := peers.get(ctx, peerID)
+	return peerInfo != nil && peerInfo.StandbyOf != "" && !peerInfo.Promoted
+}
+
 func (sm *Manager) deletePeerIDByPieceNum(ctx context.Context, taskID string, pieceNum int, peerID string) {
 	if err := sm.progressMgr.DeletePeerIDByPieceNum(ctx, taskID, pieceNum, peerID); err != nil {
 		logrus.Warnf("scheduler: failed to delete the peerID %s for pieceNum %d of taskID: %s: %v", peerID, pieceNum, taskID, err)
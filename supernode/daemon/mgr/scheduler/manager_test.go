@@ -17,17 +17,25 @@
 package scheduler
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
 
 	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
 	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 )
 
 func Test(t *testing.T) {
@@ -52,13 +60,28 @@ func (s *SchedulerMgrTestSuite) SetUpSuite(c *check.C) {
 
 	cfg := config.NewConfig()
 	cfg.SetSuperPID("fooPid")
-	s.manager, _ = NewManager(cfg, s.mockProgressMgr)
+	s.manager, _ = NewManager(cfg, s.mockProgressMgr, nil, nil)
 }
 
 func (s *SchedulerMgrTestSuite) TearDownSuite(c *check.C) {
 	s.mockCtl.Finish()
 }
 
+func (s *SchedulerMgrTestSuite) TestScheduleOutOfPieceRange(c *check.C) {
+	s.mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), "task", "client", "available").Return([]int{0, 1, 2}, nil)
+
+	// none of the available pieces is in the range
+	_, err := s.manager.Schedule(context.Background(), "task", "client", "peer", types.PriorityNormal,
+		&mgr.PieceRange{Start: 3, End: 4})
+	c.Check(errortypes.IsPeerWait(errors.Cause(err)), check.Equals, true)
+
+	var pieceRange *mgr.PieceRange
+	c.Check(pieceRange.Contains(0), check.Equals, true)
+	pieceRange = &mgr.PieceRange{Start: 3, End: -1}
+	c.Check(pieceRange.Contains(2), check.Equals, false)
+	c.Check(pieceRange.Contains(100), check.Equals, true)
+}
+
 func (s *SchedulerMgrTestSuite) TestSortByPieceDistance(c *check.C) {
 	var cases = []struct {
 		pieceNums     []int
@@ -140,6 +163,228 @@ func (s *SchedulerMgrTestSuite) BenchmarkGetPieceCountMap(c *check.C) {
 
 	c.ResetTimer()
 	for i := 0; i < c.N; i++ {
-		s.manager.getPieceCountMap(context.TODO(), pieceNums, "foo")
+		s.manager.getPieceCountMap(context.TODO(), s.manager.newPeerLookup(), pieceNums, "foo")
+	}
+}
+
+func (s *SchedulerMgrTestSuite) TestTryGetPIDWithPeerStates(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	progressMgr := mock.NewMockProgressMgr(ctl)
+	peerMgr := mock.NewMockPeerMgr(ctl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("fooPid")
+	manager, _ := NewManager(cfg, progressMgr, peerMgr, nil)
+
+	progressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, peerID string) (*mgr.PeerState, error) {
+			return &mgr.PeerState{PeerID: peerID, ProducerLoad: atomiccount.NewAtomicInt(0)}, nil
+		}).AnyTimes()
+	progressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	progressMgr.EXPECT().DeletePeerIDByPieceNum(gomock.Any(), "task", 1, "dead").Return(nil)
+
+	states := map[string]string{
+		"dead":    types.PeerInfoStateDead,
+		"suspect": types.PeerInfoStateSuspect,
+		"alive":   types.PeerInfoStateAlive,
+	}
+	peerMgr.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, peerID string) (*types.PeerInfo, error) {
+			return &types.PeerInfo{ID: peerID, State: states[peerID]}, nil
+		}).AnyTimes()
+
+	decision := &mgr.SchedulerDecision{}
+	dstPID := manager.tryGetPID(context.Background(), manager.newPeerLookup(), "task", 1, "src", []string{"dead", "suspect", "alive"},
+		int32(cfg.PeerUpLimit), "incentive-limit", decision)
+	c.Check(dstPID, check.Equals, "alive")
+	c.Check(decision.Reason, check.Equals, mgr.DecisionReasonPeer)
+	c.Check(decision.Rejected, check.DeepEquals, map[string]string{
+		"dead":    types.PeerInfoStateDead,
+		"suspect": types.PeerInfoStateSuspect,
+	})
+}
+
+func (s *SchedulerMgrTestSuite) TestReplayRecordedCandidates(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	progressMgr := mock.NewMockProgressMgr(ctl)
+	peerMgr := mock.NewMockPeerMgr(ctl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("fooPid")
+	cfg.SchedulerAuditSize = 10
+	manager, _ := NewManager(cfg, progressMgr, peerMgr, nil)
+
+	loads := map[string]int32{"busy": int32(cfg.PeerUpLimit)}
+	errorCounts := map[string]int32{"flaky": 3}
+	progressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, peerID string) (*mgr.PeerState, error) {
+			return &mgr.PeerState{
+				PeerID:            peerID,
+				ProducerLoad:      atomiccount.NewAtomicInt(loads[peerID]),
+				ServiceErrorCount: atomiccount.NewAtomicInt(errorCounts[peerID]),
+			}, nil
+		}).AnyTimes()
+	progressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	progressMgr.EXPECT().DeletePeerIDByPieceNum(gomock.Any(), "task", 1, "dead").Return(nil)
+	peerMgr.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, peerID string) (*types.PeerInfo, error) {
+			state := types.PeerInfoStateAlive
+			if peerID == "dead" {
+				state = types.PeerInfoStateDead
+			}
+			return &types.PeerInfo{ID: peerID, State: state}, nil
+		}).AnyTimes()
+
+	decision := &mgr.SchedulerDecision{}
+	dstPID := manager.tryGetPID(context.Background(), manager.newPeerLookup(), "task", 1, "src",
+		[]string{"dead", "busy", "flaky", "alive"}, int32(cfg.PeerUpLimit), "incentive-limit", decision)
+	c.Assert(dstPID, check.Equals, "flaky")
+	c.Assert(decision.Candidates, check.HasLen, 4)
+	c.Check(decision.Candidates[1].Load, check.Equals, int32(cfg.PeerUpLimit))
+	c.Check(decision.Candidates[3].Load, check.Equals, int32(0))
+	decision.DstPID = dstPID
+
+	decisions := []*mgr.SchedulerDecision{decision}
+	results := Replay(decisions, ReplayConfig{EliminationLimit: cfg.EliminationLimit})
+	c.Assert(results, check.HasLen, 1)
+	c.Check(results[0].DstPID, check.Equals, "flaky")
+	c.Check(results[0].Diverged(), check.Equals, false)
+
+	results = Replay(decisions, ReplayConfig{EliminationLimit: 3})
+	c.Check(results[0].DstPID, check.Equals, "alive")
+	c.Check(results[0].Rejected["flaky"], check.Equals, "eliminated")
+	c.Check(results[0].Diverged(), check.Equals, true)
+
+	results = Replay(decisions, ReplayConfig{EliminationLimit: cfg.EliminationLimit, PeerUpLimit: int32(cfg.PeerUpLimit + 1)})
+	c.Check(results[0].DstPID, check.Equals, "busy")
+	c.Check(results[0].Diverged(), check.Equals, true)
+
+	buf := &bytes.Buffer{}
+	WriteReplay(buf, results)
+	c.Check(strings.HasPrefix(buf.String(), "replayed: 1, diverged: 1\n"), check.Equals, true)
+	c.Check(strings.Contains(buf.String(), "recorded:flaky replayed:busy"), check.Equals, true)
+}
+
+func (s *SchedulerMgrTestSuite) TestSchedulePeerLookupOnce(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	progressMgr := mock.NewMockProgressMgr(ctl)
+	peerMgr := mock.NewMockPeerMgr(ctl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("fooPid")
+	cfg.PeerCacheFullRatio = 0.9
+	manager, _ := NewManager(cfg, progressMgr, peerMgr, nil)
+	_, err := manager.SetBrake(context.Background(), &types.EmergencyBrake{
+		Name: "idc-b", Mode: types.EmergencyBrakeModePause, Selector: map[string]string{"idc": "b"},
+	})
+	c.Assert(err, check.IsNil)
+
+	progressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), "task", "client", "available").Return([]int{0, 1, 2}, nil)
+	progressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), "task", "client", "running").Return(nil, nil)
+	progressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "task", gomock.Any()).Return([]string{"a", "b"}, nil).AnyTimes()
+	progressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, peerID string) (*mgr.PeerState, error) {
+			return &mgr.PeerState{PeerID: peerID, ProducerLoad: atomiccount.NewAtomicInt(0),
+				ClientErrorCount: atomiccount.NewAtomicInt(0)}, nil
+		}).AnyTimes()
+	progressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	progressMgr.EXPECT().UpdateClientProgress(gomock.Any(), "task", "client", "a", gomock.Any(), config.PieceRUNNING).
+		Return(nil).Times(3)
+
+	// every peer is looked up once in the pass, though each of them is checked
+	// for the cache, the liveness, the standby and the brake of every piece.
+	for peerID, labels := range map[string]map[string]string{"src": nil, "a": {"idc": "a"}, "b": {"idc": "b"}} {
+		peerMgr.EXPECT().Get(gomock.Any(), peerID).Return(&types.PeerInfo{
+			ID: peerID, State: types.PeerInfoStateAlive, Labels: labels,
+		}, nil).Times(1)
+	}
+
+	results, err := manager.Schedule(context.Background(), "task", "client", "src", types.PriorityNormal, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 3)
+	for _, r := range results {
+		c.Check(r.DstPID, check.Equals, "a")
+	}
+}
+
+func (s *SchedulerMgrTestSuite) TestGetPeerUpLimit(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	contributionMgr := mock.NewMockContributionMgr(ctl)
+
+	cfg := config.NewConfig()
+	cfg.PeerUpLimit = 5
+	manager, _ := NewManager(cfg, nil, peerMgr, contributionMgr)
+
+	peerMgr.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, peerID string) (*types.PeerInfo, error) {
+			return &types.PeerInfo{ID: peerID, IP: strfmt.IPv4(peerID)}, nil
+		}).AnyTimes()
+	contributions := map[string]*types.NodeContribution{
+		"1.1.1.1": {DownloadedBytes: 100, FreeRider: true},
+		"2.2.2.2": {DownloadedBytes: 100, UploadedBytes: 50, Ratio: 0.5},
+		"3.3.3.3": {DownloadedBytes: 100, UploadedBytes: 200, Ratio: 2},
+	}
+	contributionMgr.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, ip string) (*types.NodeContribution, error) {
+			if c, ok := contributions[ip]; ok {
+				return c, nil
+			}
+			return nil, errortypes.ErrDataNotFound
+		}).AnyTimes()
+
+	var cases = []struct {
+		weight   float64
+		srcPID   string
+		expected int32
+	}{
+		// disabled
+		{0, "1.1.1.1", 5},
+		{1, "1.1.1.1", 1},
+		{0.5, "1.1.1.1", 2},
+		{0.5, "2.2.2.2", 4},
+		{0.5, "3.3.3.3", 5},
+		// never downloaded anything
+		{1, "4.4.4.4", 5},
+	}
+	for _, tc := range cases {
+		cfg.IncentiveWeight = tc.weight
+		c.Check(manager.getPeerUpLimit(context.Background(), manager.newPeerLookup(), tc.srcPID), check.Equals, tc.expected,
+			check.Commentf("weight %v srcPID %s", tc.weight, tc.srcPID))
+	}
+}
+
+func (s *SchedulerMgrTestSuite) TestCacheFull(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	peerMgr := mock.NewMockPeerMgr(ctl)
+
+	cfg := config.NewConfig()
+	manager, _ := NewManager(cfg, nil, peerMgr, nil)
+
+	peers := map[string]*types.PeerInfo{
+		"full":      {CacheCapacity: 100, CacheUsed: 95},
+		"free":      {CacheCapacity: 100, CacheUsed: 50},
+		"unlimited": {CacheUsed: 1000},
 	}
+	peerMgr.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, peerID string) (*types.PeerInfo, error) {
+			if info, ok := peers[peerID]; ok {
+				return info, nil
+			}
+			return nil, errortypes.ErrDataNotFound
+		}).AnyTimes()
+
+	peerIDs := []string{"full", "free", "unknown", "unlimited"}
+	c.Check(manager.countCacheFull(context.Background(), manager.newPeerLookup(), peerIDs), check.Equals, 1)
+	c.Check(manager.sortByCacheFull(context.Background(), manager.newPeerLookup(), peerIDs), check.DeepEquals,
+		[]string{"free", "unknown", "unlimited", "full"})
+
+	cfg.PeerCacheFullRatio = 0
+	c.Check(manager.countCacheFull(context.Background(), manager.newPeerLookup(), peerIDs), check.Equals, 0)
+	c.Check(manager.sortByCacheFull(context.Background(), manager.newPeerLookup(), peerIDs), check.DeepEquals, peerIDs)
 }
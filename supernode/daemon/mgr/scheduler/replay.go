@@ -0,0 +1,308 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+// TaskReport is the summary of the scheduler decisions of a task.
+type TaskReport struct {
+	TaskID    string
+	FirstTime time.Time
+	LastTime  time.Time
+
+	Decisions int
+	Clients   int
+
+	// Unassigned is the number of decisions which assign the piece to nobody.
+	Unassigned int
+
+	// Reassigned is the number of times that a piece is assigned to the same
+	// client again, which usually means that the previous download failed.
+	Reassigned int
+
+	// Reasons counts the decisions by reason.
+	Reasons map[string]int
+
+	// DstPeers counts the assigned pieces by the destination peer.
+	DstPeers map[string]int
+
+	// Rejections counts the rejected candidates by reason.
+	Rejections map[string]int
+}
+
+// ReadDecisions reads the decisions written to the audit log file by the scheduler.
+func ReadDecisions(r io.Reader) ([]*mgr.SchedulerDecision, error) {
+	var decisions []*mgr.SchedulerDecision
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		d := &mgr.SchedulerDecision{}
+		if err := json.Unmarshal([]byte(line), d); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse decision at line %d", lineNum)
+		}
+		decisions = append(decisions, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
+
+// Analyze replays the decisions in order and summarizes them by task.
+// The reports are sorted by taskID.
+func Analyze(decisions []*mgr.SchedulerDecision) []*TaskReport {
+	reports := make(map[string]*TaskReport)
+	clients := make(map[string]map[string]bool)
+	assigned := make(map[string]bool)
+
+	for _, d := range decisions {
+		r, ok := reports[d.TaskID]
+		if !ok {
+			r = &TaskReport{
+				TaskID:     d.TaskID,
+				FirstTime:  d.Time,
+				Reasons:    make(map[string]int),
+				DstPeers:   make(map[string]int),
+				Rejections: make(map[string]int),
+			}
+			reports[d.TaskID] = r
+			clients[d.TaskID] = make(map[string]bool)
+		}
+
+		r.Decisions++
+		r.LastTime = d.Time
+		r.Reasons[d.Reason]++
+		clients[d.TaskID][d.ClientID] = true
+		for _, reason := range d.Rejected {
+			r.Rejections[reason]++
+		}
+
+		if d.DstPID == "" {
+			r.Unassigned++
+			continue
+		}
+		r.DstPeers[d.DstPID]++
+
+		key := fmt.Sprintf("%s/%s/%d", d.TaskID, d.ClientID, d.PieceNum)
+		if assigned[key] {
+			r.Reassigned++
+		}
+		assigned[key] = true
+	}
+
+	result := make([]*TaskReport, 0, len(reports))
+	for taskID, r := range reports {
+		r.Clients = len(clients[taskID])
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TaskID < result[j].TaskID
+	})
+	return result
+}
+
+// ReplayConfig is the configuration of the scheduler with which the decisions are replayed.
+type ReplayConfig struct {
+	// EliminationLimit is the limit of the service errors of a candidate peer.
+	EliminationLimit int
+
+	// PeerUpLimit overrides the recorded PeerUpLimit if it's positive.
+	PeerUpLimit int32
+}
+
+// ReplayResult is the result of a decision replayed through the scheduler.
+type ReplayResult struct {
+	Decision *mgr.SchedulerDecision
+
+	// DstPID is the peer chosen by the replay, and it's empty if no peer is available.
+	DstPID   string
+	Reason   string
+	Rejected map[string]string
+}
+
+// Diverged reports whether the replay makes a different decision from the recorded one.
+func (r *ReplayResult) Diverged() bool {
+	d := r.Decision
+	if r.Reason != d.Reason {
+		return true
+	}
+	if r.Reason == mgr.DecisionReasonPeer && r.DstPID != d.DstPID {
+		return true
+	}
+	return !reflect.DeepEqual(r.Rejected, d.Rejected)
+}
+
+// Replay feeds the candidates recorded in the decisions back through the checks of
+// the scheduler with cfg, and returns the results of the decisions which are replayable.
+// A decision is replayable if it recorded its candidates and was made among them.
+//
+// Every decision is replayed against the states of the candidates recorded with it,
+// so the loads changed by the diverged assignments are not carried to the later decisions.
+func Replay(decisions []*mgr.SchedulerDecision, cfg ReplayConfig) []*ReplayResult {
+	var results []*ReplayResult
+	for _, d := range decisions {
+		if len(d.Candidates) == 0 ||
+			(d.Reason != mgr.DecisionReasonPeer && d.Reason != mgr.DecisionReasonNoAvailablePeer) {
+			continue
+		}
+
+		upLimit, peerUpLimit := d.UpLimit, d.PeerUpLimit
+		if cfg.PeerUpLimit > 0 {
+			// the limit reduced by the incentive or priority is kept unless it exceeds the new one.
+			if upLimit >= peerUpLimit || upLimit > cfg.PeerUpLimit {
+				upLimit = cfg.PeerUpLimit
+			}
+			peerUpLimit = cfg.PeerUpLimit
+		}
+
+		r := &ReplayResult{Decision: d, Reason: mgr.DecisionReasonNoAvailablePeer}
+		reject := func(peerID, reason string) {
+			if r.Rejected == nil {
+				r.Rejected = make(map[string]string)
+			}
+			r.Rejected[peerID] = reason
+		}
+		for _, c := range d.Candidates {
+			if reason, _ := checkCandidate(c, cfg.EliminationLimit); reason != "" {
+				reject(c.PeerID, reason)
+				continue
+			}
+			if c.Load < 0 {
+				continue
+			}
+			if reason := checkLoad(c.Load+1, upLimit, peerUpLimit, d.LimitReason); reason != "" {
+				reject(c.PeerID, reason)
+				continue
+			}
+			r.DstPID, r.Reason = c.PeerID, mgr.DecisionReasonPeer
+			break
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// WriteReplay writes the number of the replayed decisions and the diverged ones one per line.
+func WriteReplay(w io.Writer, results []*ReplayResult) {
+	var diverged []*ReplayResult
+	for _, r := range results {
+		if r.Diverged() {
+			diverged = append(diverged, r)
+		}
+	}
+
+	fmt.Fprintf(w, "replayed: %d, diverged: %d\n", len(results), len(diverged))
+	for _, r := range diverged {
+		d := r.Decision
+		fmt.Fprintf(w, "%s task:%s client:%s piece:%d recorded:%s replayed:%s",
+			d.Time.Format(time.RFC3339Nano), d.TaskID, d.ClientID, d.PieceNum,
+			formatDst(d.DstPID, d.Reason), formatDst(r.DstPID, r.Reason))
+		if !reflect.DeepEqual(r.Rejected, d.Rejected) {
+			fmt.Fprintf(w, " rejected:%s -> %s", formatCounts(d.Rejected), formatCounts(r.Rejected))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// WriteReports writes the reports in a human-readable format.
+func WriteReports(w io.Writer, reports []*TaskReport) {
+	for _, r := range reports {
+		fmt.Fprintf(w, "task: %s\n", r.TaskID)
+		fmt.Fprintf(w, "  period: %s ~ %s\n", r.FirstTime.Format(time.RFC3339), r.LastTime.Format(time.RFC3339))
+		fmt.Fprintf(w, "  decisions: %d, clients: %d, unassigned: %d, reassigned: %d\n",
+			r.Decisions, r.Clients, r.Unassigned, r.Reassigned)
+		writeCounts(w, "reasons", r.Reasons)
+		writeCounts(w, "destinations", r.DstPeers)
+		writeCounts(w, "rejections", r.Rejections)
+	}
+}
+
+// WriteTimeline writes the decisions of the taskID one per line in order.
+func WriteTimeline(w io.Writer, decisions []*mgr.SchedulerDecision, taskID string) {
+	for _, d := range decisions {
+		if d.TaskID != taskID {
+			continue
+		}
+		dst := d.DstPID
+		if dst == "" {
+			dst = "-"
+		}
+		fmt.Fprintf(w, "%s client:%s piece:%d -> %s reason:%s distributed:%d",
+			d.Time.Format(time.RFC3339Nano), d.ClientID, d.PieceNum, dst, d.Reason, d.DistributedCount)
+		if len(d.Rejected) > 0 {
+			fmt.Fprintf(w, " rejected:%s", formatCounts(d.Rejected))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func writeCounts(w io.Writer, name string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	// the most frequent first
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(w, "  %s:\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(w, "    %s: %d\n", k, counts[k])
+	}
+}
+
+func formatDst(dstPID, reason string) string {
+	if reason != mgr.DecisionReasonPeer || dstPID == "" {
+		return "-(" + reason + ")"
+	}
+	return dstPID
+}
+
+func formatCounts(m map[string]string) string {
+	items := make([]string, 0, len(m))
+	for k, v := range m {
+		items = append(items, k+"="+v)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
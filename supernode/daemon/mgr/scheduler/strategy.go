@@ -0,0 +1,77 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"hash/fnv"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+// strategySplit splits the tasks between the strategy of the scheduler and the canary one,
+// so that both run side by side on the live traffic.
+type strategySplit struct {
+	strategy string
+	canary   string
+	percent  uint32
+}
+
+func newStrategySplit(cfg *config.Config) (*strategySplit, error) {
+	split := &strategySplit{
+		strategy: cfg.SchedulerStrategy,
+		canary:   cfg.SchedulerCanaryStrategy,
+	}
+	if split.strategy == "" {
+		split.strategy = config.SchedulerStrategyRarestFirst
+	}
+	if !isValidStrategy(split.strategy) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "scheduler strategy: %s", split.strategy)
+	}
+	if split.canary == "" {
+		return split, nil
+	}
+	if !isValidStrategy(split.canary) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "scheduler canary strategy: %s", split.canary)
+	}
+	if cfg.SchedulerCanaryPercent < 0 || cfg.SchedulerCanaryPercent > 100 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "scheduler canary percent: %d", cfg.SchedulerCanaryPercent)
+	}
+	split.percent = uint32(cfg.SchedulerCanaryPercent)
+	return split, nil
+}
+
+// of returns the strategy which schedules the pieces of the task.
+// The task is scheduled with the canary strategy if the hash of its taskID falls
+// in the canary percent, so that all clients of a task share the same strategy.
+func (s *strategySplit) of(taskID string) string {
+	if s.canary == "" || s.percent == 0 {
+		return s.strategy
+	}
+	h := fnv.New32a()
+	h.Write([]byte(taskID))
+	if h.Sum32()%100 < s.percent {
+		return s.canary
+	}
+	return s.strategy
+}
+
+func isValidStrategy(strategy string) bool {
+	return strategy == config.SchedulerStrategyRarestFirst || strategy == config.SchedulerStrategySequential
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&StrategyTestSuite{})
+}
+
+type StrategyTestSuite struct{}
+
+func (s *StrategyTestSuite) TestNewStrategySplit(c *check.C) {
+	cfg := config.NewConfig()
+	split, err := newStrategySplit(cfg)
+	c.Assert(err, check.IsNil)
+	c.Check(split.of("foo"), check.Equals, config.SchedulerStrategyRarestFirst)
+
+	for _, v := range []struct {
+		strategy string
+		canary   string
+		percent  int
+	}{
+		{strategy: "foo"},
+		{strategy: config.SchedulerStrategyRarestFirst, canary: "foo", percent: 10},
+		{strategy: config.SchedulerStrategyRarestFirst, canary: config.SchedulerStrategySequential, percent: 101},
+		{strategy: config.SchedulerStrategyRarestFirst, canary: config.SchedulerStrategySequential, percent: -1},
+	} {
+		cfg.SchedulerStrategy, cfg.SchedulerCanaryStrategy, cfg.SchedulerCanaryPercent = v.strategy, v.canary, v.percent
+		_, err := newStrategySplit(cfg)
+		c.Check(errortypes.IsInvalidValue(err), check.Equals, true, check.Commentf("%v", v))
+	}
+}
+
+func (s *StrategyTestSuite) TestStrategyOf(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SchedulerCanaryStrategy = config.SchedulerStrategySequential
+	cfg.SchedulerCanaryPercent = 30
+	split, err := newStrategySplit(cfg)
+	c.Assert(err, check.IsNil)
+
+	canary := 0
+	for i := 0; i < 1000; i++ {
+		taskID := fmt.Sprintf("task-%d", i)
+		strategy := split.of(taskID)
+		c.Assert(split.of(taskID), check.Equals, strategy)
+		if strategy == config.SchedulerStrategySequential {
+			canary++
+		}
+	}
+	c.Check(canary > 200 && canary < 400, check.Equals, true, check.Commentf("canary: %d", canary))
+
+	cfg.SchedulerCanaryPercent = 100
+	split, _ = newStrategySplit(cfg)
+	c.Check(split.of("foo"), check.Equals, config.SchedulerStrategySequential)
+	cfg.SchedulerCanaryPercent = 0
+	split, _ = newStrategySplit(cfg)
+	c.Check(split.of("foo"), check.Equals, config.SchedulerStrategyRarestFirst)
+}
+
+func (s *StrategyTestSuite) TestSortSequential(c *check.C) {
+	manager, err := NewManager(config.NewConfig(), nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	pieceNums, err := manager.sort(context.Background(), manager.newPeerLookup(), config.SchedulerStrategySequential, []int{5, 2, 9, 0}, []int{9}, "foo")
+	c.Assert(err, check.IsNil)
+	c.Check(pieceNums, check.DeepEquals, []int{0, 2, 5, 9})
+}
@@ -18,6 +18,9 @@ package mgr
 
 import (
 	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
 )
 
 // PieceResult contains the information about which piece to download from which node.
@@ -27,8 +30,153 @@ type PieceResult struct {
 	DstPID   string
 }
 
+// PieceRange is the range of the pieces from Start to End inclusive, which covers the range
+// of the file downloaded by a dfget task. The range ends at the last piece if End is negative.
+type PieceRange struct {
+	Start int
+	End   int
+}
+
+// Contains returns whether the piece is in the range, and every piece is in a nil range.
+func (r *PieceRange) Contains(pieceNum int) bool {
+	return r == nil || (pieceNum >= r.Start && (r.End < 0 || pieceNum <= r.End))
+}
+
+// The reasons of the scheduler decisions.
+const (
+	// DecisionReasonPeer means that the piece is assigned to a peer which has the piece.
+	DecisionReasonPeer = "peer"
+
+	// DecisionReasonNoAvailablePeer means that the piece is assigned to supernode
+	// because none of the peers which have the piece is available.
+	DecisionReasonNoAvailablePeer = "no-available-peer"
+
+	// DecisionReasonClientErrorLimit means that the piece is assigned to supernode
+	// because the errors of the client reach the FailureCountLimit.
+	DecisionReasonClientErrorLimit = "client-error-limit"
+
+	// DecisionReasonSuperLoadLimit means that the piece is not assigned
+	// because the load of supernode reaches the limit.
+	DecisionReasonSuperLoadLimit = "super-load-limit"
+
+	// DecisionReasonUpdateProgressFailed means that the piece is not assigned
+	// because failed to update the progress of client.
+	DecisionReasonUpdateProgressFailed = "update-progress-failed"
+)
+
+// SchedulerDecision records why a piece is assigned to a peer for a client.
+type SchedulerDecision struct {
+	Time     time.Time `json:"time"`
+	TaskID   string    `json:"taskID"`
+	ClientID string    `json:"clientID"`
+	PeerID   string    `json:"peerID"`
+	PieceNum int       `json:"pieceNum"`
+
+	// Priority is the priority class of the client.
+	Priority types.Priority `json:"priority,omitempty"`
+
+	// Strategy is the strategy of the scheduler which prioritizes the piece.
+	Strategy string `json:"strategy,omitempty"`
+
+	// DstPID is the peer which the piece is assigned to,
+	// and it's empty when the piece is not assigned.
+	DstPID string `json:"dstPID,omitempty"`
+
+	// Reason is one of the DecisionReason constants.
+	Reason string `json:"reason"`
+
+	// DistributedCount is the number of peers that have the piece.
+	DistributedCount int `json:"distributedCount"`
+
+	// Rejected records the candidate peers which are skipped with the reason.
+	Rejected map[string]string `json:"rejected,omitempty"`
+
+	// UpLimit is the max load of the candidate peers after the piece is assigned,
+	// PeerUpLimit is the one configured, and LimitReason is the reason of the peers
+	// rejected by the UpLimit below PeerUpLimit.
+	UpLimit     int32  `json:"upLimit,omitempty"`
+	PeerUpLimit int32  `json:"peerUpLimit,omitempty"`
+	LimitReason string `json:"limitReason,omitempty"`
+
+	// Candidates are the states of the peers which have the piece in the order they're
+	// checked, by which the decision is replayed offline. They're only recorded
+	// into the audit log of the scheduler.
+	Candidates []*SchedulerCandidate `json:"candidates,omitempty"`
+}
+
+// SchedulerCandidate is the state of a peer which has the piece when the scheduler checks it.
+type SchedulerCandidate struct {
+	PeerID string `json:"peerID"`
+
+	// NoState indicates that the progress state of the peer isn't found.
+	NoState     bool `json:"noState,omitempty"`
+	ServiceDown bool `json:"serviceDown,omitempty"`
+
+	// Liveness is the liveness state of the peer by its heart beats,
+	// it's empty if the peer never sends a heart beat.
+	Liveness string `json:"liveness,omitempty"`
+
+	// Standby indicates that the peer is a warm standby which isn't promoted yet,
+	// and Braked indicates that the peer is paused by a scoped emergency brake.
+	Standby bool `json:"standby,omitempty"`
+	Braked  bool `json:"braked,omitempty"`
+
+	ServiceErrorCount int32 `json:"serviceErrorCount,omitempty"`
+
+	// BlackInfoError indicates that the black list of the client can't be read,
+	// and BlackListed indicates that the peer is in it.
+	BlackInfoError bool `json:"blackInfoError,omitempty"`
+	BlackListed    bool `json:"blackListed,omitempty"`
+
+	// Load is the load of the peer before the piece is assigned,
+	// it's negative if the load is unknown.
+	Load int32 `json:"load"`
+}
+
 // SchedulerMgr is responsible for calculating scheduling results according to certain rules.
 type SchedulerMgr interface {
 	// Schedule gets scheduler result with specified taskID, clientID and peerID through some rules.
-	Schedule(ctx context.Context, taskID, clientID, peerID string) ([]*PieceResult, error)
+	// The client of low priority can only take part of the upload slots of the peers and supernode,
+	// and only the pieces in the pieceRange are scheduled to the client if it's not nil.
+	Schedule(ctx context.Context, taskID, clientID, peerID string, priority types.Priority, pieceRange *PieceRange) ([]*PieceResult, error)
+
+	// GetDecisions returns at most limit latest scheduler decisions of the taskID
+	// in chronological order. It returns all the decisions when limit <= 0.
+	GetDecisions(ctx context.Context, taskID string, limit int) ([]*SchedulerDecision, error)
+
+	// GetStrategy returns the strategy of the scheduler which prioritizes the pieces of the task,
+	// which is the canary one for part of the tasks while a canary strategy is configured.
+	GetStrategy(ctx context.Context, taskID string) string
+
+	// SetBrake engages the emergency brake of the P2P traffic, or lifts it if the mode is off.
+	// The brake is the global one if its name is empty, or the scoped one of the name otherwise,
+	// which only applies to the peers whose labels match its selector.
+	// No piece is scheduled to or from the peers while the brake pauses their traffic.
+	SetBrake(ctx context.Context, brake *types.EmergencyBrake) (*types.EmergencyBrake, error)
+
+	// GetBrake returns the global emergency brake of the P2P traffic.
+	GetBrake(ctx context.Context) *types.EmergencyBrake
+
+	// ListBrakes returns the scoped emergency brakes sorted by name.
+	ListBrakes(ctx context.Context) []*types.EmergencyBrake
+
+	// DeleteBrake lifts the scoped emergency brake of the name.
+	DeleteBrake(ctx context.Context, name string) error
+
+	// GetPeerBrake returns the strictest one of the emergency brakes which apply to the peer.
+	GetPeerBrake(ctx context.Context, peerID string) *types.EmergencyBrake
+
+	// SetBoost grants the temporary bandwidth boost to the task, which replaces the previous one.
+	// The peers downloading the task are told the rate limit of the boost by the piece tasks
+	// scheduled to them until it expires.
+	SetBoost(ctx context.Context, taskID string, boost *types.TaskBoost) (*types.TaskBoost, error)
+
+	// GetBoost returns the bandwidth boost of the task which hasn't expired.
+	GetBoost(ctx context.Context, taskID string) (*types.TaskBoost, error)
+
+	// ListBoosts returns the bandwidth boosts which haven't expired sorted by the expire time.
+	ListBoosts(ctx context.Context) []*types.TaskBoost
+
+	// DeleteBoost revokes the bandwidth boost of the task before it expires.
+	DeleteBoost(ctx context.Context, taskID string) error
 }
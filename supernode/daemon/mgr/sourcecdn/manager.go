@@ -18,12 +18,18 @@ package cdn
 
 import (
 	"context"
+	"io"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -40,8 +46,8 @@ type Manager struct {
 }
 
 // NewManager returns a new Manager.
-func NewManager(cfg *config.Config, cacheStore *store.Store, progressManager mgr.ProgressMgr,
-	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (mgr.CDNMgr, error) {
+func NewManager(cfg *config.Config, cacheStore *store.Store, metaStore *metastore.Store, progressManager mgr.ProgressMgr,
+	contributionManager mgr.ContributionMgr, originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (mgr.CDNMgr, error) {
 	return &Manager{
 		cfg:             cfg,
 		progressManager: progressManager,
@@ -71,6 +77,21 @@ func (cm *Manager) TriggerCDN(ctx context.Context, task *types.TaskInfo) (*types
 	}, nil
 }
 
+// StartScan does nothing since no file is cached in source CDN pattern.
+func (cm *Manager) StartScan(ctx context.Context) {
+}
+
+// GetScanStatus returns the finished status since no file is cached in source CDN pattern.
+func (cm *Manager) GetScanStatus(ctx context.Context) *types.CacheScanStatus {
+	return &types.CacheScanStatus{Finished: true}
+}
+
+// UpdatePriority does nothing since the files are not fetched from the source
+// by supernode in source CDN pattern.
+func (cm *Manager) UpdatePriority(ctx context.Context, taskID string, priority types.Priority) error {
+	return nil
+}
+
 // GetHTTPPath returns the http download path of taskID.
 func (cm *Manager) GetHTTPPath(ctx context.Context, taskInfo *types.TaskInfo) (string, error) {
 	return taskInfo.RawURL, nil
@@ -97,6 +118,26 @@ func (cm *Manager) Delete(ctx context.Context, taskID string, force bool) error
 	return nil
 }
 
-func (cm *Manager) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr) ([]string, error) {
+func (cm *Manager) GetGCTaskIDs(ctx context.Context, taskMgr mgr.TaskMgr, preemptive bool) ([]string, error) {
 	return nil, nil
 }
+
+// GetAvailSpace is not supported since the task files are not cached in source CDN pattern.
+func (cm *Manager) GetAvailSpace(ctx context.Context) (fileutils.Fsize, error) {
+	return 0, errors.Wrapf(errortypes.ErrInvalidValue, "avail space is not supported in source cdn pattern")
+}
+
+// GetPieceMD5s is not supported since the task files are not cached in source CDN pattern.
+func (cm *Manager) GetPieceMD5s(ctx context.Context, taskID string) ([]string, error) {
+	return nil, errors.Wrapf(errortypes.ErrInvalidValue, "piece md5s are not supported in source cdn pattern")
+}
+
+// ExportBundle is not supported since the task files are not cached in source CDN pattern.
+func (cm *Manager) ExportBundle(ctx context.Context, task *types.TaskInfo, w io.Writer) error {
+	return errors.Wrapf(errortypes.ErrInvalidValue, "bundle is not supported in source cdn pattern")
+}
+
+// ImportBundle is not supported since the task files are not cached in source CDN pattern.
+func (cm *Manager) ImportBundle(ctx context.Context, r io.Reader) (*types.TaskInfo, error) {
+	return nil, errors.Wrapf(errortypes.ErrInvalidValue, "bundle is not supported in source cdn pattern")
+}
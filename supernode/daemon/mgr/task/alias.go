@@ -0,0 +1,196 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// aliasIdentifierPrefix is the prefix of the identifier of the tasks registered by
+// the URLs of an alias, which is followed by the ID of the alias.
+const aliasIdentifierPrefix = "alias:"
+
+var aliasDigestReg = regexp.MustCompile(`^(md5:[0-9a-f]{32}|sha256:[0-9a-f]{64})$`)
+
+// aliasStore maintains the aliases of URLs which are the mirrors of the same content.
+type aliasStore struct {
+	sync.RWMutex
+	aliases map[string]*types.TaskAlias
+	// urls maps the URLs to the IDs of the aliases which they belong to.
+	urls map[string]string
+}
+
+func newAliasStore() *aliasStore {
+	return &aliasStore{
+		aliases: make(map[string]*types.TaskAlias),
+		urls:    make(map[string]string),
+	}
+}
+
+// add adds the alias, and the URLs of it must not be declared by other aliases.
+func (as *aliasStore) add(alias *types.TaskAlias) (*types.TaskAlias, error) {
+	if len(alias.Urls) < 2 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "an alias must have at least 2 urls")
+	}
+	seen := make(map[string]bool)
+	for _, u := range alias.Urls {
+		if !netutils.IsValidURL(u) {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "url: %s", u)
+		}
+		if seen[u] {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "duplicate url: %s", u)
+		}
+		seen[u] = true
+	}
+	d := strings.ToLower(alias.Digest)
+	if !aliasDigestReg.MatchString(d) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "digest must be md5:{hex} or sha256:{hex}: %s", alias.Digest)
+	}
+
+	a := &types.TaskAlias{
+		ID:     digest.Sha256(strings.Join(alias.Urls, "\n") + "\n" + d)[:16],
+		Urls:   append([]string(nil), alias.Urls...),
+		Digest: d,
+	}
+
+	as.Lock()
+	defer as.Unlock()
+	for _, u := range a.Urls {
+		if id, ok := as.urls[u]; ok {
+			return nil, errors.Wrapf(errortypes.ErrTaskIDDuplicate, "url %s has been declared in alias %s", u, id)
+		}
+	}
+	as.aliases[a.ID] = a
+	for _, u := range a.Urls {
+		as.urls[u] = a.ID
+	}
+	return copyAlias(a), nil
+}
+
+func (as *aliasStore) get(id string) (*types.TaskAlias, error) {
+	as.RLock()
+	defer as.RUnlock()
+	a, ok := as.aliases[id]
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "alias: %s", id)
+	}
+	return copyAlias(a), nil
+}
+
+func (as *aliasStore) list() []*types.TaskAlias {
+	as.RLock()
+	defer as.RUnlock()
+	result := make([]*types.TaskAlias, 0, len(as.aliases))
+	for _, a := range as.aliases {
+		result = append(result, copyAlias(a))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+func (as *aliasStore) remove(id string) error {
+	as.Lock()
+	defer as.Unlock()
+	a, ok := as.aliases[id]
+	if !ok {
+		return errors.Wrapf(errortypes.ErrDataNotFound, "alias: %s", id)
+	}
+	delete(as.aliases, id)
+	for _, u := range a.Urls {
+		delete(as.urls, u)
+	}
+	return nil
+}
+
+// lookup returns the enabled alias which the taskURL belongs to, or nil if there's none.
+func (as *aliasStore) lookup(taskURL string) *types.TaskAlias {
+	as.RLock()
+	defer as.RUnlock()
+	if a, ok := as.aliases[as.urls[taskURL]]; ok && !a.Disabled {
+		return copyAlias(a)
+	}
+	return nil
+}
+
+// verify checks the digest of the alias against the content of the task,
+// and disables the alias if it mismatches.
+// Nothing is checked if the alias has been deleted.
+func (as *aliasStore) verify(id, realMd5, realSha256 string) error {
+	as.Lock()
+	defer as.Unlock()
+	a, ok := as.aliases[id]
+	if !ok {
+		return nil
+	}
+
+	kv := strings.SplitN(a.Digest, ":", 2)
+	real := realMd5
+	if kv[0] == "sha256" {
+		real = realSha256
+	}
+	if kv[1] == real {
+		return nil
+	}
+	reason := fmt.Sprintf("%s mismatches, expected:%s real:%s", kv[0], kv[1], real)
+	if !a.Disabled {
+		a.Disabled = true
+		a.Reason = reason
+		logrus.Errorf("disable alias %s: %s", id, reason)
+	}
+	return errors.Wrapf(errortypes.ErrInvalidValue, "alias %s: %s", id, reason)
+}
+
+func copyAlias(a *types.TaskAlias) *types.TaskAlias {
+	c := *a
+	c.Urls = append([]string(nil), a.Urls...)
+	return &c
+}
+
+// AddAlias declares the URLs of the alias as the mirrors of the same content.
+func (tm *Manager) AddAlias(ctx context.Context, alias *types.TaskAlias) (*types.TaskAlias, error) {
+	return tm.aliasStore.add(alias)
+}
+
+// GetAlias gets the alias with the specified ID.
+func (tm *Manager) GetAlias(ctx context.Context, id string) (*types.TaskAlias, error) {
+	return tm.aliasStore.get(id)
+}
+
+// ListAliases returns all the aliases.
+func (tm *Manager) ListAliases(ctx context.Context) []*types.TaskAlias {
+	return tm.aliasStore.list()
+}
+
+// DeleteAlias deletes the alias with the specified ID.
+func (tm *Manager) DeleteAlias(ctx context.Context, id string) error {
+	return tm.aliasStore.remove(id)
+}
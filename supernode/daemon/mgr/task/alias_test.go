@@ -0,0 +1,156 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
+	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	check.Suite(&AliasTestSuite{})
+}
+
+type AliasTestSuite struct {
+	tm *Manager
+}
+
+func (s *AliasTestSuite) SetUpTest(c *check.C) {
+	s.tm = &Manager{
+		taskStore:               dutil.NewStore(),
+		taskURLUnReachableStore: syncmap.NewSyncMap(),
+		aliasStore:              newAliasStore(),
+		manifestStore:           newManifestStore(),
+		metrics:                 newMetrics(prometheus.NewRegistry()),
+	}
+}
+
+func (s *AliasTestSuite) TestAddAlias(c *check.C) {
+	ctx := context.Background()
+	md5 := "md5:" + "0123456789abcdef0123456789abcdef"
+	var cases = []struct {
+		alias *types.TaskAlias
+		err   func(error) bool
+	}{
+		{&types.TaskAlias{Urls: []string{"http://a.com/x"}, Digest: md5}, errortypes.IsInvalidValue},
+		{&types.TaskAlias{Urls: []string{"http://a.com/x", "http://a.com/x"}, Digest: md5}, errortypes.IsInvalidValue},
+		{&types.TaskAlias{Urls: []string{"http://a.com/x", "b.com/x"}, Digest: md5}, errortypes.IsInvalidValue},
+		{&types.TaskAlias{Urls: []string{"http://a.com/x", "http://b.com/x"}, Digest: "md5:123"}, errortypes.IsInvalidValue},
+		{&types.TaskAlias{Urls: []string{"http://a.com/x", "http://b.com/x"}, Digest: md5}, nil},
+		{&types.TaskAlias{Urls: []string{"http://c.com/x", "http://b.com/x"}, Digest: md5}, errortypes.IsTaskIDDuplicate},
+	}
+	for i, cc := range cases {
+		_, err := s.tm.AddAlias(ctx, cc.alias)
+		if cc.err == nil {
+			c.Check(err, check.IsNil, check.Commentf("case %d", i))
+		} else {
+			c.Check(cc.err(err), check.Equals, true, check.Commentf("case %d: %v", i, err))
+		}
+	}
+
+	aliases := s.tm.ListAliases(ctx)
+	c.Assert(aliases, check.HasLen, 1)
+	alias, err := s.tm.GetAlias(ctx, aliases[0].ID)
+	c.Assert(err, check.IsNil)
+	c.Check(alias.Urls, check.DeepEquals, []string{"http://a.com/x", "http://b.com/x"})
+
+	c.Check(s.tm.DeleteAlias(ctx, alias.ID), check.IsNil)
+	c.Check(errortypes.IsDataNotFound(s.tm.DeleteAlias(ctx, alias.ID)), check.Equals, true)
+	_, err = s.tm.GetAlias(ctx, alias.ID)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	c.Check(s.tm.aliasStore.lookup("http://a.com/x"), check.IsNil)
+}
+
+func (s *AliasTestSuite) TestRegisterAlias(c *check.C) {
+	ctx := context.Background()
+	alias, err := s.tm.AddAlias(ctx, &types.TaskAlias{
+		Urls:   []string{"http://a.com/x", "http://b.com/x"},
+		Digest: "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	})
+	c.Assert(err, check.IsNil)
+
+	taskID := generateTaskID("http://a.com/x", "", aliasIdentifierPrefix+alias.ID, nil)
+	s.tm.taskStore.Put(taskID, &types.TaskInfo{
+		ID:             taskID,
+		TaskURL:        "http://a.com/x",
+		Identifier:     aliasIdentifierPrefix + alias.ID,
+		HTTPFileLength: 10,
+		PieceSize:      4,
+		CdnStatus:      types.TaskInfoCdnStatusRUNNING,
+	})
+
+	// the registrations of both urls join the same task
+	for _, u := range alias.Urls {
+		task, err := s.tm.addOrUpdateTask(ctx, &types.TaskCreateRequest{RawURL: u, Md5: "foo"}, 0)
+		c.Assert(err, check.IsNil)
+		c.Check(task.ID, check.Equals, taskID)
+	}
+
+	// the content mismatches the digest
+	c.Assert(s.tm.updateTask(taskID, &types.TaskInfo{
+		CdnStatus:  types.TaskInfoCdnStatusSUCCESS,
+		FileLength: 10,
+		RealSha256: "bar",
+	}), check.IsNil)
+	task, err := s.tm.getTask(taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+
+	alias, err = s.tm.GetAlias(ctx, alias.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(alias.Disabled, check.Equals, true)
+	c.Check(alias.Reason, check.Not(check.Equals), "")
+	c.Check(s.tm.aliasStore.lookup("http://b.com/x"), check.IsNil)
+}
+
+func (s *AliasTestSuite) TestRegisterAliasMd5Mismatch(c *check.C) {
+	ctx := context.Background()
+	_, err := s.tm.AddAlias(ctx, &types.TaskAlias{
+		Urls:   []string{"http://a.com/x", "http://b.com/x"},
+		Digest: "MD5:" + "0123456789ABCDEF0123456789ABCDEF",
+	})
+	c.Assert(err, check.IsNil)
+
+	_, err = s.tm.addOrUpdateTask(ctx, &types.TaskCreateRequest{
+		RawURL: "http://b.com/x",
+		Md5:    "fedcba9876543210fedcba9876543210",
+	}, 0)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *AliasTestSuite) TestRegisterAliasDigestMismatch(c *check.C) {
+	ctx := context.Background()
+	_, err := s.tm.AddAlias(ctx, &types.TaskAlias{
+		Urls:   []string{"http://a.com/x", "http://b.com/x"},
+		Digest: "sha256:" + strings.Repeat("0", 64),
+	})
+	c.Assert(err, check.IsNil)
+
+	_, err = s.tm.addOrUpdateTask(ctx, &types.TaskCreateRequest{
+		RawURL: "http://b.com/x",
+		Digest: "sha256:" + strings.Repeat("f", 64),
+	}, 0)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
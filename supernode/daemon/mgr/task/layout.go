@@ -0,0 +1,85 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+// PieceHashAlgorithm is the algorithm of the hashes of the pieces computed by CDN.
+const PieceHashAlgorithm = "md5"
+
+// PieceLayout returns the boundaries of at most limit pieces from start which a file of
+// fileLength is split into by CDN, with the piece size chosen by the client if it's not 0.
+// All the pieces are returned if limit is 0.
+//
+// The split is deterministic: every piece wraps pieceSize-5 bytes of the file, except that
+// the last one wraps the rest, between a 4-byte big-endian head and a 1-byte tail 0x7f.
+// The head is the content length or'ed with the piece size shifted left by 4 bits, and
+// the md5 of a piece is computed over the head, the content and the tail.
+func PieceLayout(fileLength int64, pieceSize int32, start, limit int) (*types.PieceLayout, error) {
+	if fileLength < 0 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "fileLength: %d", fileLength)
+	}
+	if start < 0 || limit < 0 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "start %d and limit %d should not be negative", start, limit)
+	}
+
+	source := types.TaskInfoPieceSizeSourceClient
+	if pieceSize == 0 {
+		pieceSize, source = computePieceSize(fileLength), types.TaskInfoPieceSizeSourceComputed
+	} else if pieceSize < config.MinPieceSize || pieceSize > config.DefaultPieceSizeLimit {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "pieceSize %d should be between %d and %d",
+			pieceSize, config.MinPieceSize, config.DefaultPieceSizeLimit)
+	}
+
+	contSize := int64(pieceSize - config.PieceWrapSize)
+	total := int((fileLength + contSize - 1) / contSize)
+	layout := &types.PieceLayout{
+		FileLength:      fileLength,
+		HashAlgorithm:   PieceHashAlgorithm,
+		PieceSize:       pieceSize,
+		PieceSizeSource: source,
+		PieceTotal:      int32(total),
+		Start:           int32(start),
+		Pieces:          []*types.PieceBoundary{},
+	}
+
+	end := total
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	for num := start; num < end; num++ {
+		offset := int64(num) * contSize
+		length := contSize
+		if offset+length > fileLength {
+			length = fileLength - offset
+		}
+		layout.Pieces = append(layout.Pieces, &types.PieceBoundary{
+			PieceNum:    int32(num),
+			Start:       offset,
+			End:         offset + length - 1,
+			PieceLength: int32(length) + config.PieceWrapSize,
+			Head:        int64(uint32(int32(length) | (pieceSize << 4))),
+		})
+	}
+	return layout, nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&LayoutTestSuite{})
+}
+
+type LayoutTestSuite struct{}
+
+func (s *LayoutTestSuite) TestPieceLayout(c *check.C) {
+	contSize := int64(config.DefaultPieceSize - config.PieceWrapSize)
+	layout, err := PieceLayout(2*contSize+1, 0, 0, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(layout.PieceSize, check.Equals, int32(config.DefaultPieceSize))
+	c.Check(layout.PieceSizeSource, check.Equals, types.TaskInfoPieceSizeSourceComputed)
+	c.Check(layout.HashAlgorithm, check.Equals, PieceHashAlgorithm)
+	c.Check(layout.PieceTotal, check.Equals, int32(3))
+	c.Assert(layout.Pieces, check.HasLen, 3)
+	c.Check(layout.Pieces[1], check.DeepEquals, &types.PieceBoundary{
+		PieceNum:    1,
+		Start:       contSize,
+		End:         2*contSize - 1,
+		PieceLength: config.DefaultPieceSize,
+		Head:        int64(contSize) | int64(config.DefaultPieceSize)<<4,
+	})
+	c.Check(layout.Pieces[2].Start, check.Equals, 2*contSize)
+	c.Check(layout.Pieces[2].End, check.Equals, 2*contSize)
+	c.Check(layout.Pieces[2].PieceLength, check.Equals, int32(1+config.PieceWrapSize))
+
+	// the piece size chosen by the client is used, and the pieces are paged
+	layout, err = PieceLayout(100, config.MinPieceSize, 0, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(layout.PieceSizeSource, check.Equals, types.TaskInfoPieceSizeSourceClient)
+	c.Check(layout.PieceTotal, check.Equals, int32(1))
+
+	layout, err = PieceLayout(10*contSize, 0, 4, 3)
+	c.Assert(err, check.IsNil)
+	c.Check(layout.Start, check.Equals, int32(4))
+	c.Assert(layout.Pieces, check.HasLen, 3)
+	c.Check(layout.Pieces[0].PieceNum, check.Equals, int32(4))
+	layout, err = PieceLayout(10*contSize, 0, 12, 3)
+	c.Assert(err, check.IsNil)
+	c.Check(layout.Pieces, check.HasLen, 0)
+
+	layout, err = PieceLayout(0, 0, 0, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(layout.PieceTotal, check.Equals, int32(0))
+
+	for _, args := range [][]int64{{-1, 0, 0, 0}, {1, config.MinPieceSize - 1, 0, 0}, {1, 0, -1, 0}, {1, 0, 0, -1}} {
+		_, err = PieceLayout(args[0], int32(args[1]), int(args[2]), int(args[3]))
+		c.Check(errortypes.IsInvalidValue(err), check.Equals, true, check.Commentf("%v", args))
+	}
+}
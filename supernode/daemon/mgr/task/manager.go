@@ -18,10 +18,14 @@ package task
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/lease"
 	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rangeutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
@@ -30,6 +34,7 @@ import (
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
 	"github.com/pkg/errors"
@@ -80,7 +85,15 @@ type Manager struct {
 	// store object
 	taskStore               *dutil.Store
 	accessTimeMap           *syncmap.SyncMap
+	accessLeases            *lease.Table
+	createTimeMap           *syncmap.SyncMap
 	taskURLUnReachableStore *syncmap.SyncMap
+	aliasStore              *aliasStore
+	manifestStore           *manifestStore
+	taskIDRules             []*taskIDRule
+
+	// metaStore persists the tasks and it's nil when the persistence is disabled.
+	metaStore *metastore.Store
 
 	// mgr object
 	peerMgr      mgr.PeerMgr
@@ -93,8 +106,13 @@ type Manager struct {
 // NewManager returns a new Manager Object.
 func NewManager(cfg *config.Config, peerMgr mgr.PeerMgr, dfgetTaskMgr mgr.DfgetTaskMgr,
 	progressMgr mgr.ProgressMgr, cdnMgr mgr.CDNMgr, schedulerMgr mgr.SchedulerMgr,
-	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (*Manager, error) {
-	return &Manager{
+	originClient httpclient.OriginHTTPClient, metaStore *metastore.Store, register prometheus.Registerer) (*Manager, error) {
+	taskIDRules, err := newTaskIDRules(cfg.TaskIDRules)
+	if err != nil {
+		return nil, err
+	}
+
+	tm := &Manager{
 		cfg:                     cfg,
 		taskStore:               dutil.NewStore(),
 		peerMgr:                 peerMgr,
@@ -103,10 +121,21 @@ func NewManager(cfg *config.Config, peerMgr mgr.PeerMgr, dfgetTaskMgr mgr.DfgetT
 		cdnMgr:                  cdnMgr,
 		schedulerMgr:            schedulerMgr,
 		accessTimeMap:           syncmap.NewSyncMap(),
+		accessLeases:            lease.NewTable(cfg.GetClock()),
+		createTimeMap:           syncmap.NewSyncMap(),
 		taskURLUnReachableStore: syncmap.NewSyncMap(),
+		aliasStore:              newAliasStore(),
+		manifestStore:           newManifestStore(),
+		taskIDRules:             taskIDRules,
 		originClient:            originClient,
+		metaStore:               metaStore,
 		metrics:                 newMetrics(register),
-	}, nil
+	}
+
+	if err := tm.recoverTasks(); err != nil {
+		return nil, err
+	}
+	return tm, nil
 }
 
 // Register will not only register a task.
@@ -115,23 +144,26 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 	if err := validateParams(req); err != nil {
 		return nil, err
 	}
+	if req.Priority == "" {
+		req.Priority = types.PriorityNormal
+	}
 
 	// Step2: add a new Task or update the exist task
 	failAccessInterval := tm.cfg.FailAccessInterval
 	task, err := tm.addOrUpdateTask(ctx, req, failAccessInterval)
 	if err != nil {
-		logrus.Infof("failed to add or update task with req %+v: %v", req, err)
+		logrus.Infof("failed to add or update task with req %+v: %v", mgr.RedactTaskCreateRequest(req), err)
 		return nil, err
 	}
 	tm.metrics.tasksRegisterCount.WithLabelValues().Inc()
-	logrus.Debugf("success to get task info: %+v", task)
+	logrus.Debugf("success to get task info: %+v", mgr.RedactTask(task))
 	// TODO: defer rollback the task update
 
 	util.GetLock(task.ID, true)
 	defer util.ReleaseLock(task.ID, true)
 
 	// update accessTime for taskID
-	if err := tm.accessTimeMap.Add(task.ID, time.Now()); err != nil {
+	if err := tm.updateAccessTime(task.ID, time.Now()); err != nil {
 		logrus.Warnf("failed to update accessTime for taskID(%s): %v", task.ID, err)
 	}
 
@@ -160,6 +192,11 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 	// TODO: defer rollback init Progress
 
 	// Step5: trigger CDN
+	// The source is fetched with the trace headers of the request which triggers the CDN,
+	// so that a download can be followed in the access logs of the origin.
+	if isFrozen(task.CdnStatus) {
+		task.Headers = httputils.ReplaceTraceHeaders(task.Headers, httputils.ExtractTraceHeaders(req.Headers))
+	}
 	if err := tm.triggerCdnSyncAction(ctx, task); err != nil {
 		return nil, errors.Wrapf(errortypes.ErrSystemError, "failed to trigger cdn: %v", err)
 	}
@@ -173,6 +210,8 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 		FileLength: task.HTTPFileLength,
 		PieceSize:  task.PieceSize,
 		CdnSource:  cdnSource,
+
+		ResponseHeaders: task.ResponseHeaders,
 	}, nil
 }
 
@@ -186,10 +225,70 @@ func (tm *Manager) GetAccessTime(ctx context.Context) (*syncmap.SyncMap, error)
 	return tm.accessTimeMap, nil
 }
 
-// List returns a list of tasks with filter.
-// TODO: implement it.
-func (tm *Manager) List(ctx context.Context, filter map[string]string) ([]*types.TaskInfo, error) {
-	return nil, nil
+// GetIdleTime returns the time elapsed since the task is accessed last.
+func (tm *Manager) GetIdleTime(ctx context.Context, taskID string) (time.Duration, error) {
+	idle, ok := tm.accessLeases.Age(taskID)
+	if !ok {
+		return 0, errors.Wrapf(errortypes.ErrDataNotFound, "access lease of taskID: %s", taskID)
+	}
+	return idle, nil
+}
+
+// updateAccessTime updates the access time of the task and renews its lease,
+// which expires the task by the logical clock of supernode.
+func (tm *Manager) updateAccessTime(taskID string, atime time.Time) error {
+	tm.accessLeases.Renew(taskID)
+	return tm.accessTimeMap.Add(taskID, atime)
+}
+
+// Touch updates the access time of the task.
+func (tm *Manager) Touch(ctx context.Context, taskID string) error {
+	util.GetLock(taskID, true)
+	defer util.ReleaseLock(taskID, true)
+
+	if _, err := tm.getTask(taskID); err != nil {
+		return err
+	}
+	return tm.updateAccessTime(taskID, time.Now())
+}
+
+// List returns the page of the tasks selected by the filter and the total number of them.
+// The tasks are sorted by the create time unless the sort keys are specified.
+func (tm *Manager) List(ctx context.Context, filter *mgr.TaskFilter) (tasks []*types.TaskInfo, total int, err error) {
+	// when filter is nil, return all values.
+	if filter == nil {
+		filter = &mgr.TaskFilter{}
+	}
+	if filter.SortDirect == "" {
+		filter.SortDirect = dutil.ASCDIRECT
+	}
+	if err := dutil.ValidateFilter(&filter.PageFilter, mgr.TaskSortKeys); err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	var entries []interface{}
+	for _, v := range tm.taskStore.List() {
+		task, ok := v.(*types.TaskInfo)
+		if !ok {
+			continue
+		}
+		entry := &taskEntry{
+			task:       task,
+			createTime: getTime(tm.createTimeMap, task.ID),
+			accessTime: getTime(tm.accessTimeMap, task.ID),
+		}
+		if matchTask(filter, entry, now) {
+			entries = append(entries, entry)
+		}
+	}
+	total = len(entries)
+
+	less := getLessFunc(entries, filter.SortKey, dutil.IsDESC(filter.SortDirect))
+	for _, v := range dutil.GetPageValues(entries, filter.PageNum, filter.PageSize, less) {
+		tasks = append(tasks, v.(*taskEntry).task)
+	}
+	return tasks, total, nil
 }
 
 // CheckTaskStatus checks the task status.
@@ -213,8 +312,12 @@ func (tm *Manager) CheckTaskStatus(ctx context.Context, taskID string) (bool, er
 // Delete deletes a task.
 func (tm *Manager) Delete(ctx context.Context, taskID string) error {
 	tm.accessTimeMap.Delete(taskID)
+	tm.accessLeases.Remove(taskID)
+	tm.createTimeMap.Delete(taskID)
 	tm.taskURLUnReachableStore.Delete(taskID)
 	tm.taskStore.Delete(taskID)
+	tm.manifestStore.remove(taskID)
+	tm.deletePersistedTask(taskID)
 	return nil
 }
 
@@ -249,10 +352,10 @@ func (tm *Manager) GetPieces(ctx context.Context, taskID, clientID string, req *
 	if err != nil {
 		return false, nil, errors.Wrapf(err, "failed to get taskID (%s)", taskID)
 	}
-	logrus.Debugf("success to get task: %+v", task)
+	logrus.Debugf("success to get task: %+v", mgr.RedactTask(task))
 
 	// update accessTime for taskID
-	if err := tm.accessTimeMap.Add(task.ID, time.Now()); err != nil {
+	if err := tm.updateAccessTime(task.ID, time.Now()); err != nil {
 		logrus.Warnf("failed to update accessTime for taskID(%s): %v", task.ID, err)
 	}
 
@@ -304,3 +407,156 @@ func (tm *Manager) UpdatePieceStatus(ctx context.Context, taskID, pieceRange str
 	return tm.progressMgr.UpdateProgress(ctx, taskID, pieceUpdateRequest.ClientID,
 		srcDfgetTask.PeerID, pieceUpdateRequest.DstPID, pieceNum, pieceStatus)
 }
+
+// AddSeeder marks that the peer of clientID owns all pieces of the task.
+func (tm *Manager) AddSeeder(ctx context.Context, taskID, clientID string, pieceMD5s []string) error {
+	util.GetLock(taskID, true)
+	defer util.ReleaseLock(taskID, true)
+
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get taskID (%s)", taskID)
+	}
+	if task.HTTPFileLength <= 0 || task.PieceSize <= config.PieceWrapSize {
+		return errors.Wrapf(errortypes.ErrInvalidValue,
+			"taskID (%s) with fileLength (%d) pieceSize (%d) can not be seeded", taskID, task.HTTPFileLength, task.PieceSize)
+	}
+
+	pieceContSize := int64(task.PieceSize - config.PieceWrapSize)
+	pieceTotal := int((task.HTTPFileLength + pieceContSize - 1) / pieceContSize)
+	if len(pieceMD5s) != pieceTotal {
+		return errors.Wrapf(errortypes.ErrInvalidValue,
+			"taskID (%s) has %d pieces but got %d piece md5s", taskID, pieceTotal, len(pieceMD5s))
+	}
+
+	// the pieces are verified against the manifest of the task until CDN computes them
+	if task.CdnStatus != types.TaskInfoCdnStatusSUCCESS {
+		for pieceNum, pieceMD5 := range pieceMD5s {
+			if expected := tm.manifestStore.pieceMD5(taskID, pieceNum); expected != "" && expected != pieceMD5 {
+				return errors.Wrapf(errortypes.ErrInvalidValue,
+					"the md5 of piece %d for taskID (%s) is %s, expected %s by the manifest", pieceNum, taskID, pieceMD5, expected)
+			}
+		}
+	}
+	if task.CdnStatus == types.TaskInfoCdnStatusSUCCESS {
+		for pieceNum, pieceMD5 := range pieceMD5s {
+			expected, err := tm.cdnMgr.GetPieceMD5(ctx, taskID, pieceNum, "", "default")
+			if err != nil {
+				return errors.Wrapf(err, "failed to get the md5 of piece %d for taskID (%s)", pieceNum, taskID)
+			}
+			if expected != pieceMD5 {
+				return errors.Wrapf(errortypes.ErrInvalidValue,
+					"the md5 of piece %d for taskID (%s) is %s, expected %s", pieceNum, taskID, pieceMD5, expected)
+			}
+		}
+	}
+
+	dfgetTask, err := tm.dfgetTaskMgr.Get(ctx, clientID, taskID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get dfgetTask with taskID (%s) clientID (%s)", taskID, clientID)
+	}
+
+	// the dstPID is empty because the pieces are not downloaded from anyone
+	for pieceNum := 0; pieceNum < pieceTotal; pieceNum++ {
+		if err := tm.progressMgr.UpdateProgress(ctx, taskID, clientID, dfgetTask.PeerID, "", pieceNum, config.PieceSUCCESS); err != nil {
+			return errors.Wrapf(err, "failed to update the progress of piece %d for taskID (%s) clientID (%s)", pieceNum, taskID, clientID)
+		}
+	}
+
+	return tm.dfgetTaskMgr.UpdateStatus(ctx, clientID, taskID, types.DfGetTaskStatusSUCCESS)
+}
+
+// GetPieceMD5s gets the md5 of the pieces of the task whose CDN has finished successfully.
+func (tm *Manager) GetPieceMD5s(ctx context.Context, taskID string, query *mgr.PieceMD5sQuery) (*types.TaskPieceMD5s, error) {
+	if query == nil {
+		query = &mgr.PieceMD5sQuery{}
+	}
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get taskID (%s)", taskID)
+	}
+	if !isSuccessCDN(task.CdnStatus) {
+		return nil, errors.Wrapf(errortypes.ErrCDNWait, "taskID (%s) with cdn status (%s)", taskID, task.CdnStatus)
+	}
+
+	pieceMD5s, err := tm.cdnMgr.GetPieceMD5s(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	total := len(pieceMD5s)
+	if query.Start < 0 || query.Start > total {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "start %d out of range [0, %d]", query.Start, total)
+	}
+	end := total
+	if query.Limit > 0 && query.Start+query.Limit < total {
+		end = query.Start + query.Limit
+	}
+
+	path, err := tm.cdnMgr.GetHTTPPath(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	result := &types.TaskPieceMD5s{
+		TaskID:     taskID,
+		PieceSize:  task.PieceSize,
+		FileLength: task.HTTPFileLength,
+		PieceTotal: int32(total),
+		Start:      int32(query.Start),
+		Path:       path,
+		PeerIP:     tm.cfg.AdvertiseIP,
+		PeerPort:   int32(tm.cfg.DownloadPort),
+		MerkleRoot: digest.MerkleRoot(pieceMD5s),
+	}
+	if query.GroupSize > 0 {
+		result.GroupSize = int32(query.GroupSize)
+		result.PieceGroups = digest.GroupSha1(pieceMD5s[query.Start:end], query.GroupSize)
+	} else {
+		result.PieceMD5s = pieceMD5s[query.Start:end]
+		result.MerkleProof = digest.MerkleRangeProof(pieceMD5s, query.Start, end)
+	}
+	return result, nil
+}
+
+// ExportBundle exports the task whose CDN has finished successfully as a bundle.
+func (tm *Manager) ExportBundle(ctx context.Context, taskID string, w io.Writer) error {
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get taskID (%s)", taskID)
+	}
+	if !isSuccessCDN(task.CdnStatus) {
+		return errors.Wrapf(errortypes.ErrCDNWait, "taskID (%s) with cdn status (%s) can not be exported", taskID, task.CdnStatus)
+	}
+
+	return tm.cdnMgr.ExportBundle(ctx, task, w)
+}
+
+// ImportBundle imports the task in the bundle.
+//
+// The imported task is added in the same way as the recovered one, and its
+// CDN will report the imported file instead of downloading it from the source
+// when a peer registers the task.
+func (tm *Manager) ImportBundle(ctx context.Context, r io.Reader) (*types.TaskInfo, error) {
+	task, err := tm.cdnMgr.ImportBundle(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	util.GetLock(task.ID, true)
+	defer util.ReleaseLock(task.ID, true)
+
+	if v, err := tm.taskStore.Get(task.ID); err == nil {
+		logrus.Infof("taskID (%s) already exists and its cached file is replaced by the bundle", task.ID)
+		return v.(*types.TaskInfo), nil
+	}
+
+	if err := tm.taskStore.Put(task.ID, task); err != nil {
+		return nil, err
+	}
+	tm.persistTask(task)
+	tm.createTimeMap.Add(task.ID, time.Now())
+	if err := tm.updateAccessTime(task.ID, time.Now()); err != nil {
+		logrus.Warnf("failed to update accessTime for taskID(%s): %v", task.ID, err)
+	}
+	tm.metrics.tasks.WithLabelValues(task.CdnStatus).Inc()
+	return task, nil
+}
@@ -18,14 +18,25 @@ package task
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/lease"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
 	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
 	cMock "github.com/dragonflyoss/Dragonfly/supernode/httpclient/mock"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 
 	"github.com/go-check/check"
 	"github.com/golang/mock/gomock"
@@ -66,10 +77,10 @@ func (s *TaskMgrTestSuite) SetUpSuite(c *check.C) {
 	s.mockCDNMgr.EXPECT().TriggerCDN(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
 	s.mockDfgetTaskMgr.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	s.mockProgressMgr.EXPECT().InitProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
-	s.mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(1000), 200, nil)
+	s.mockOriginClient.EXPECT().GetContentInfo(gomock.Any(), gomock.Any()).Return(&httpclient.ContentInfo{Length: 1000, StatusCode: 200}, nil)
 	cfg := config.NewConfig()
 	s.taskManager, _ = NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
-		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, nil, prometheus.NewRegistry())
 }
 
 func (s *TaskMgrTestSuite) TearDownSuite(c *check.C) {
@@ -108,6 +119,53 @@ func (s *TaskMgrTestSuite) TestCheckTaskStatus(c *check.C) {
 	c.Check(isSuccess, check.Equals, true)
 }
 
+func (s *TaskMgrTestSuite) TestTouch(c *check.C) {
+	s.taskManager.taskStore = dutil.NewStore()
+	s.taskManager.taskStore.Put("foo", &types.TaskInfo{ID: "foo"})
+	past := time.Now().Add(-time.Hour)
+	s.taskManager.accessTimeMap.Add("foo", past)
+
+	c.Assert(s.taskManager.Touch(context.Background(), "foo"), check.IsNil)
+	atime, err := s.taskManager.accessTimeMap.GetAsTime("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(atime.After(past), check.Equals, true)
+	idle, err := s.taskManager.GetIdleTime(context.Background(), "foo")
+	c.Assert(err, check.IsNil)
+	c.Check(idle < time.Minute, check.Equals, true)
+
+	err = s.taskManager.Touch(context.Background(), "bar")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	_, err = s.taskManager.accessTimeMap.GetAsTime("bar")
+	c.Check(err, check.NotNil)
+	_, err = s.taskManager.GetIdleTime(context.Background(), "bar")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestGetIdleTime(c *check.C) {
+	now := time.Now()
+	cfg := config.NewConfig()
+	cfg.SetClock(lease.NewClockWithSource(5*time.Second, func() time.Time { return now }))
+	tm, err := NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, nil, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	tm.taskStore.Put("foo", &types.TaskInfo{ID: "foo"})
+	c.Assert(tm.Touch(context.Background(), "foo"), check.IsNil)
+
+	now = now.Add(3 * time.Second)
+	idle, err := tm.GetIdleTime(context.Background(), "foo")
+	c.Assert(err, check.IsNil)
+	c.Check(idle, check.Equals, 3*time.Second)
+
+	// the time frozen by suspending supernode doesn't count
+	now = now.Add(time.Hour)
+	idle, _ = tm.GetIdleTime(context.Background(), "foo")
+	c.Check(idle, check.Equals, 8*time.Second)
+
+	c.Assert(tm.Delete(context.Background(), "foo"), check.IsNil)
+	_, err = tm.GetIdleTime(context.Background(), "foo")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
 func (s *TaskMgrTestSuite) TestUpdateTaskInfo(c *check.C) {
 	s.taskManager.taskStore = dutil.NewStore()
 	req := &types.TaskCreateRequest{
@@ -166,3 +224,228 @@ func (s *TaskMgrTestSuite) TestUpdateTaskInfo(c *check.C) {
 	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
 	c.Check(task.FileLength, check.Equals, int64(2000))
 }
+
+func (s *TaskMgrTestSuite) TestRecoverTasks(c *check.C) {
+	workHome, err := ioutil.TempDir("/tmp", "supernode-TaskMgrTestSuite-")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(workHome)
+	path := filepath.Join(workHome, "tasks.db")
+
+	metaStore, err := metastore.Open(path)
+	c.Assert(err, check.IsNil)
+	tm, err := NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, metaStore, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	task := &types.TaskInfo{
+		ID:             "foo",
+		CdnStatus:      types.TaskInfoCdnStatusRUNNING,
+		HTTPFileLength: 2000,
+		PieceSize:      config.DefaultPieceSize,
+		PieceTotal:     1,
+	}
+	tm.taskStore.Put(task.ID, task)
+	c.Assert(tm.Update(context.Background(), task.ID, &types.TaskInfo{
+		CdnStatus:  types.TaskInfoCdnStatusSUCCESS,
+		FileLength: 2000,
+		RealMd5:    "fooMd5",
+	}), check.IsNil)
+	tm.taskStore.Put("bar", &types.TaskInfo{ID: "bar"})
+	tm.persistTask(&types.TaskInfo{ID: "bar"})
+	c.Assert(tm.Delete(context.Background(), "bar"), check.IsNil)
+	c.Assert(metaStore.Close(), check.IsNil)
+
+	// restart
+	metaStore, err = metastore.Open(path)
+	c.Assert(err, check.IsNil)
+	defer metaStore.Close()
+	tm, err = NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, metaStore, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	recovered, err := tm.Get(context.Background(), task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(recovered.CdnStatus, check.Equals, types.TaskInfoCdnStatusWAITING)
+	c.Check(recovered.HTTPFileLength, check.Equals, int64(2000))
+	c.Check(recovered.RealMd5, check.Equals, "fooMd5")
+	_, err = tm.accessTimeMap.Get(task.ID)
+	c.Check(err, check.IsNil)
+
+	_, err = tm.Get(context.Background(), "bar")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestAddSeeder(c *check.C) {
+	ctx := context.Background()
+	s.taskManager.taskStore = dutil.NewStore()
+	task := &types.TaskInfo{
+		ID:             "foo",
+		CdnStatus:      types.TaskInfoCdnStatusSUCCESS,
+		HTTPFileLength: 2000,
+		PieceSize:      1005,
+	}
+	s.taskManager.taskStore.Put(task.ID, task)
+
+	err := s.taskManager.AddSeeder(ctx, "bar", "cid", []string{"md5"})
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// 2000 bytes are divided into 2 pieces
+	err = s.taskManager.AddSeeder(ctx, task.ID, "cid", []string{"md5"})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+
+	s.mockCDNMgr.EXPECT().GetPieceMD5(gomock.Any(), task.ID, 0, "", "default").Return("md5:1005", nil).Times(2)
+	s.mockCDNMgr.EXPECT().GetPieceMD5(gomock.Any(), task.ID, 1, "", "default").Return("md5:1005", nil).Times(1)
+	err = s.taskManager.AddSeeder(ctx, task.ID, "cid", []string{"other:1005", "md5:1005"})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+
+	s.mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "cid", task.ID).Return(&types.DfGetTask{PeerID: "pid"}, nil)
+	s.mockProgressMgr.EXPECT().UpdateProgress(gomock.Any(), task.ID, "cid", "pid", "", gomock.Any(), config.PieceSUCCESS).Return(nil).Times(2)
+	s.mockDfgetTaskMgr.EXPECT().UpdateStatus(gomock.Any(), "cid", task.ID, types.DfGetTaskStatusSUCCESS).Return(nil)
+	err = s.taskManager.AddSeeder(ctx, task.ID, "cid", []string{"md5:1005", "md5:1005"})
+	c.Check(err, check.IsNil)
+}
+
+func (s *TaskMgrTestSuite) TestInvalidateTask(c *check.C) {
+	ctx := context.Background()
+	s.taskManager.taskStore = dutil.NewStore()
+	task := &types.TaskInfo{ID: "foo", CdnStatus: types.TaskInfoCdnStatusFAILED, PieceTotal: 2}
+	s.taskManager.taskStore.Put(task.ID, task)
+
+	s.mockDfgetTaskMgr.EXPECT().GetCIDsByTaskID(gomock.Any(), task.ID).Return([]string{"cid1", "cid2"}, nil)
+	s.mockProgressMgr.EXPECT().DeleteCID(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	s.mockDfgetTaskMgr.EXPECT().Delete(gomock.Any(), gomock.Any(), task.ID).Return(nil).Times(2)
+	s.mockProgressMgr.EXPECT().DeleteTaskID(gomock.Any(), task.ID, 2).Return(nil)
+	s.taskManager.invalidateTask(ctx, task)
+
+	_, err := s.taskManager.Get(ctx, task.ID)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestGetPieceMD5s(c *check.C) {
+	ctx := context.Background()
+	s.taskManager.taskStore = dutil.NewStore()
+	task := &types.TaskInfo{
+		ID:             "foo",
+		CdnStatus:      types.TaskInfoCdnStatusSUCCESS,
+		HTTPFileLength: 2500,
+		PieceSize:      1005,
+	}
+	s.taskManager.taskStore.Put(task.ID, task)
+	pieceMD5s := []string{"a:1005", "b:1005", "c:505"}
+	s.mockCDNMgr.EXPECT().GetPieceMD5s(gomock.Any(), task.ID).Return(pieceMD5s, nil).AnyTimes()
+	s.mockCDNMgr.EXPECT().GetHTTPPath(gomock.Any(), task).Return("/download/foo", nil).AnyTimes()
+
+	result, err := s.taskManager.GetPieceMD5s(ctx, task.ID, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(result.PieceMD5s, check.DeepEquals, pieceMD5s)
+	c.Check(result.PieceTotal, check.Equals, int32(3))
+
+	result, err = s.taskManager.GetPieceMD5s(ctx, task.ID, &mgr.PieceMD5sQuery{Start: 1, Limit: 1})
+	c.Assert(err, check.IsNil)
+	c.Check(result.PieceMD5s, check.DeepEquals, []string{"b:1005"})
+	c.Check(result.Start, check.Equals, int32(1))
+	c.Check(result.MerkleRoot, check.Equals, digest.MerkleRoot(pieceMD5s))
+	c.Check(digest.VerifyMerkleRange(result.MerkleRoot, 3, 1, result.PieceMD5s, result.MerkleProof), check.Equals, true)
+
+	result, err = s.taskManager.GetPieceMD5s(ctx, task.ID, &mgr.PieceMD5sQuery{GroupSize: 2})
+	c.Assert(err, check.IsNil)
+	c.Check(result.PieceMD5s, check.HasLen, 0)
+	c.Check(result.PieceGroups, check.DeepEquals, digest.GroupSha1(pieceMD5s, 2))
+	c.Check(result.GroupSize, check.Equals, int32(2))
+
+	_, err = s.taskManager.GetPieceMD5s(ctx, task.ID, &mgr.PieceMD5sQuery{Start: 4})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestList(c *check.C) {
+	ctx := context.Background()
+	tm := s.taskManager
+	tm.taskStore = dutil.NewStore()
+	tm.createTimeMap = syncmap.NewSyncMap()
+	tm.accessTimeMap = syncmap.NewSyncMap()
+
+	now := time.Now()
+	for i, task := range []*types.TaskInfo{
+		{ID: "a", TaskURL: "http://a.com/foo", CdnStatus: types.TaskInfoCdnStatusSUCCESS, HTTPFileLength: 300},
+		{ID: "b", TaskURL: "http://b.com/foo", CdnStatus: types.TaskInfoCdnStatusRUNNING, HTTPFileLength: 100},
+		{ID: "c", TaskURL: "http://a.com/bar", CdnStatus: types.TaskInfoCdnStatusSUCCESS, HTTPFileLength: 200},
+	} {
+		tm.taskStore.Put(task.ID, task)
+		tm.createTimeMap.Add(task.ID, now.Add(-time.Duration(3-i)*time.Hour))
+		tm.accessTimeMap.Add(task.ID, now.Add(-time.Duration(i)*time.Hour))
+	}
+	ids := func(tasks []*types.TaskInfo) (result []string) {
+		for _, task := range tasks {
+			result = append(result, task.ID)
+		}
+		return
+	}
+
+	tasks, total, err := tm.List(ctx, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(total, check.Equals, 3)
+	c.Check(ids(tasks), check.DeepEquals, []string{"a", "b", "c"})
+
+	tasks, total, err = tm.List(ctx, &mgr.TaskFilter{
+		URLPattern: regexp.MustCompile(`^http://a\.com/`),
+		CdnStatus:  []string{types.TaskInfoCdnStatusSUCCESS},
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(total, check.Equals, 2)
+	c.Check(ids(tasks), check.DeepEquals, []string{"a", "c"})
+
+	tasks, total, err = tm.List(ctx, &mgr.TaskFilter{MaxAge: 150 * time.Minute, MinSize: 150})
+	c.Assert(err, check.IsNil)
+	c.Check(total, check.Equals, 1)
+	c.Check(ids(tasks), check.DeepEquals, []string{"c"})
+
+	tasks, total, err = tm.List(ctx, &mgr.TaskFilter{PageFilter: dutil.PageFilter{
+		PageNum: 1, PageSize: 2, SortKey: []string{mgr.TaskSortKeySize}, SortDirect: dutil.DESCDIRECT}})
+	c.Assert(err, check.IsNil)
+	c.Check(total, check.Equals, 3)
+	c.Check(ids(tasks), check.DeepEquals, []string{"b"})
+
+	tasks, _, err = tm.List(ctx, &mgr.TaskFilter{PageFilter: dutil.PageFilter{
+		SortKey: []string{mgr.TaskSortKeyAccessTime}}})
+	c.Assert(err, check.IsNil)
+	c.Check(ids(tasks), check.DeepEquals, []string{"c", "b", "a"})
+
+	_, _, err = tm.List(ctx, &mgr.TaskFilter{PageFilter: dutil.PageFilter{SortKey: []string{"foo"}}})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestBundle(c *check.C) {
+	ctx := context.Background()
+	s.taskManager.taskStore = dutil.NewStore()
+	s.taskManager.taskStore.Put("running", &types.TaskInfo{ID: "running", CdnStatus: types.TaskInfoCdnStatusRUNNING})
+
+	err := s.taskManager.ExportBundle(ctx, "foo", ioutil.Discard)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	err = s.taskManager.ExportBundle(ctx, "running", ioutil.Discard)
+	c.Check(errortypes.IsCDNWait(err), check.Equals, true)
+
+	req := &types.TaskCreateRequest{RawURL: "http://aa.bb.com/a", TaskURL: "http://aa.bb.com/a"}
+	imported := &types.TaskInfo{
+		ID:             generateTaskID(req.TaskURL, "", "", nil),
+		CdnStatus:      types.TaskInfoCdnStatusWAITING,
+		HTTPFileLength: 1000,
+		PieceSize:      config.DefaultPieceSize,
+		PieceTotal:     1,
+		RawURL:         req.RawURL,
+		TaskURL:        req.TaskURL,
+	}
+	s.mockCDNMgr.EXPECT().ImportBundle(gomock.Any(), gomock.Any()).Return(imported, nil).Times(2)
+	task, err := s.taskManager.ImportBundle(ctx, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(task, check.Equals, imported)
+
+	// the existing task is kept when it's imported again
+	existing, err := s.taskManager.ImportBundle(ctx, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(existing, check.Equals, imported)
+
+	// the imported task is registered without accessing the source
+	task, err = s.taskManager.addOrUpdateTask(ctx, req, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(task, check.Equals, imported)
+}
@@ -18,32 +18,98 @@ package task
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/digest"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rangeutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// addOrUpdateTask adds a new task or update the exist task to taskStore.
-func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateRequest, failAccessInterval time.Duration) (*types.TaskInfo, error) {
+// taskKey identifies the task which a registration joins.
+type taskKey struct {
+	id         string
+	taskURL    string
+	md5        string
+	digest     string
+	identifier string
+}
+
+// resolveTaskKey returns the key of the task which the registration of req joins,
+// with the task ID rules and the aliases applied.
+func (tm *Manager) resolveTaskKey(req *types.TaskCreateRequest) (*taskKey, error) {
 	taskURL := req.TaskURL
 	if stringutils.IsEmptyStr(req.TaskURL) {
 		taskURL = netutils.FilterURLParam(req.RawURL, req.Filter)
 	}
-	taskID := generateTaskID(taskURL, req.Md5, req.Identifier, req.Headers)
+	taskURL = normalizeTaskURL(tm.taskIDRules, taskURL)
+	md5, taskDigest, identifier := req.Md5, "", req.Identifier
+	var algo, encoded string
+	if stringutils.IsEmptyStr(md5) && !stringutils.IsEmptyStr(req.Digest) {
+		var err error
+		algo, encoded, err = digest.Parse(req.Digest)
+		if err != nil {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "digest: %v", err)
+		}
+		if algo == digest.AlgorithmMD5 {
+			md5 = encoded
+		} else {
+			taskDigest = digest.String(algo, encoded)
+		}
+	}
+	// the registrations of the URLs of an alias join the same task,
+	// which is identified by the first URL and the alias.
+	if alias := tm.aliasStore.lookup(taskURL); alias != nil {
+		if !stringutils.IsEmptyStr(md5) && strings.HasPrefix(alias.Digest, "md5:") &&
+			"md5:"+strings.ToLower(md5) != alias.Digest {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "md5 %s mismatches the digest of alias %s", md5, alias.ID)
+		}
+		if !stringutils.IsEmptyStr(taskDigest) && strings.HasPrefix(alias.Digest, algo+":") &&
+			taskDigest != alias.Digest {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "digest %s mismatches the digest of alias %s", taskDigest, alias.ID)
+		}
+		logrus.Debugf("url %s is registered as alias %s", taskURL, alias.ID)
+		taskURL = alias.Urls[0]
+		md5, taskDigest, identifier = "", "", aliasIdentifierPrefix+alias.ID
+	}
+	// the digest identifies the task the same way as md5.
+	sign := md5
+	if stringutils.IsEmptyStr(sign) {
+		sign = taskDigest
+	}
+	return &taskKey{
+		id:         generateTaskID(taskURL, sign, identifier, req.Headers),
+		taskURL:    taskURL,
+		md5:        md5,
+		digest:     taskDigest,
+		identifier: identifier,
+	}, nil
+}
+
+// addOrUpdateTask adds a new task or update the exist task to taskStore.
+func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateRequest, failAccessInterval time.Duration) (*types.TaskInfo, error) {
+	key, err := tm.resolveTaskKey(req)
+	if err != nil {
+		return nil, err
+	}
+	taskID := key.id
 
 	util.GetLock(taskID, true)
 	defer util.ReleaseLock(taskID, true)
@@ -60,14 +126,18 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 	// using the existing task if it already exists corresponding to taskID
 	var task *types.TaskInfo
 	newTask := &types.TaskInfo{
-		ID:         taskID,
-		Headers:    req.Headers,
-		Identifier: req.Identifier,
-		Md5:        req.Md5,
-		RawURL:     req.RawURL,
-		TaskURL:    taskURL,
-		CdnStatus:  types.TaskInfoCdnStatusWAITING,
-		PieceTotal: -1,
+		ID:          taskID,
+		Filter:      req.Filter,
+		Headers:     req.Headers,
+		HeadersHash: hashHeaders(req.Headers),
+		Identifier:  key.identifier,
+		Md5:         key.md5,
+		Digest:      key.digest,
+		RawURL:      req.RawURL,
+		TaskURL:     key.taskURL,
+		CdnStatus:   types.TaskInfoCdnStatusWAITING,
+		PieceTotal:  -1,
+		Priority:    req.Priority,
 	}
 
 	if v, err := tm.taskStore.Get(taskID); err == nil {
@@ -75,6 +145,7 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 		if !equalsTask(task, newTask) {
 			return nil, errors.Wrapf(errortypes.ErrTaskIDDuplicate, "%s", taskID)
 		}
+		tm.raisePriority(ctx, task, req.Priority)
 	} else {
 		task = newTask
 	}
@@ -83,8 +154,9 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 		return task, nil
 	}
 
-	// get fileLength with req.Headers
-	fileLength, err := tm.getHTTPFileLength(taskID, task.RawURL, req.Headers)
+	// get fileLength with req.RawURL and req.Headers, the rawURL may differ from
+	// the one of the existing task in the queries removed by the taskID rules.
+	fileLength, header, err := tm.getHTTPFileLength(taskID, req.RawURL, req.Headers)
 	if err != nil {
 		logrus.Errorf("failed to get file length from http client for taskID(%s): %v", taskID, err)
 
@@ -101,7 +173,7 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 			return nil, fmt.Errorf("failed to get file length and it is required in source CDN pattern")
 		}
 
-		supportRange, err := tm.originClient.IsSupportRange(task.TaskURL, task.Headers)
+		supportRange, err := tm.originClient.IsSupportRange(task.RawURL, httputils.WithTaskHeader(task.Headers, task.ID))
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to check whether the task(%s) supports partial requests", task.ID)
 		}
@@ -110,24 +182,52 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 		}
 	}
 	task.HTTPFileLength = fileLength
+	task.ResponseHeaders = passThroughHeaders(tm.cfg.PassThroughHeaders, header)
 	logrus.Infof("get file length %d from http client for taskID(%s)", fileLength, taskID)
 
 	// if success to get the information successfully with the req.Headers,
-	// and then update the task.Headers to req.Headers.
+	// and then update the task.RawURL and task.Headers to the ones of req.
+	task.RawURL = req.RawURL
 	if req.Headers != nil {
 		task.Headers = req.Headers
+		task.HeadersHash = hashHeaders(req.Headers)
 	}
 
-	// calculate piece size and update the PieceSize and PieceTotal
-	pieceSize := computePieceSize(fileLength)
+	// calculate piece size and update the PieceSize and PieceTotal,
+	// the one chosen by the client is preferred.
+	// the piece size of the manifest of the task is used unless the client chooses one,
+	// so that the pieces are split the same way as the manifest.
+	pieceSize, source := computePieceSize(fileLength), types.TaskInfoPieceSizeSourceComputed
+	if req.PieceSize > 0 {
+		pieceSize, source = req.PieceSize, types.TaskInfoPieceSizeSourceClient
+	} else if size := tm.manifestStore.pieceSize(taskID); size > 0 && size != pieceSize {
+		pieceSize, source = size, types.TaskInfoPieceSizeSourceClient
+	}
+	tm.manifestStore.verifyFileLength(taskID, fileLength)
 	task.PieceSize = pieceSize
+	task.PieceSizeSource = source
 	task.PieceTotal = int32((fileLength + (int64(pieceSize) - 1)) / int64(pieceSize))
 
 	tm.taskStore.Put(taskID, task)
+	tm.createTimeMap.Add(taskID, time.Now())
+	tm.persistTask(task)
 	tm.metrics.tasks.WithLabelValues(task.CdnStatus).Inc()
 	return task, nil
 }
 
+// raisePriority raises the priority of the task to the one of a new registration if it's higher,
+// so that the running CDN of the task isn't delayed by the downloads of the priority it used to be.
+func (tm *Manager) raisePriority(ctx context.Context, task *types.TaskInfo, priority types.Priority) {
+	if mgr.PriorityLevel(priority) <= mgr.PriorityLevel(task.Priority) {
+		return
+	}
+	logrus.Infof("raise the priority of taskID(%s) from %s to %s", task.ID, task.Priority, priority)
+	task.Priority = priority
+	if err := tm.cdnMgr.UpdatePriority(ctx, task.ID, priority); err != nil {
+		logrus.Warnf("failed to update the cdn priority of taskID(%s): %v", task.ID, err)
+	}
+}
+
 // getTask returns the taskInfo according to the specified taskID.
 func (tm *Manager) getTask(taskID string) (*types.TaskInfo, error) {
 	if stringutils.IsEmptyStr(taskID) {
@@ -176,6 +276,7 @@ func (tm *Manager) updateTask(taskID string, updateTaskInfo *types.TaskInfo) err
 		tm.metrics.tasks.WithLabelValues(task.CdnStatus).Dec()
 		tm.metrics.tasks.WithLabelValues(updateTaskInfo.CdnStatus).Inc()
 		task.CdnStatus = updateTaskInfo.CdnStatus
+		tm.persistTask(task)
 		return nil
 	}
 
@@ -189,6 +290,35 @@ func (tm *Manager) updateTask(taskID string, updateTaskInfo *types.TaskInfo) err
 		task.RealMd5 = updateTaskInfo.RealMd5
 	}
 
+	if !stringutils.IsEmptyStr(updateTaskInfo.RealSha256) {
+		task.RealSha256 = updateTaskInfo.RealSha256
+	}
+
+	// the task of an alias fails if the content mismatches the digest of the alias,
+	// so that the peers download from the source they request instead.
+	if strings.HasPrefix(task.Identifier, aliasIdentifierPrefix) {
+		id := strings.TrimPrefix(task.Identifier, aliasIdentifierPrefix)
+		if err := tm.aliasStore.verify(id, task.RealMd5, task.RealSha256); err != nil {
+			logrus.Errorf("taskID(%s) fails: %v", taskID, err)
+			tm.metrics.tasks.WithLabelValues(task.CdnStatus).Dec()
+			tm.metrics.tasks.WithLabelValues(types.TaskInfoCdnStatusFAILED).Inc()
+			task.CdnStatus = types.TaskInfoCdnStatusFAILED
+			tm.persistTask(task)
+			return nil
+		}
+	}
+
+	// the task fails if the piece md5s computed by CDN mismatch its manifest, since the pieces
+	// verified against the manifest may have been downloaded by the peers already.
+	if !tm.verifyManifest(taskID) {
+		logrus.Errorf("taskID(%s) fails: the piece md5s mismatch the manifest", taskID)
+		tm.metrics.tasks.WithLabelValues(task.CdnStatus).Dec()
+		tm.metrics.tasks.WithLabelValues(types.TaskInfoCdnStatusFAILED).Inc()
+		task.CdnStatus = types.TaskInfoCdnStatusFAILED
+		tm.persistTask(task)
+		return nil
+	}
+
 	var pieceTotal int32
 	if updateTaskInfo.FileLength > 0 {
 		pieceTotal = int32((updateTaskInfo.FileLength + int64(task.PieceSize-1)) / int64(task.PieceSize))
@@ -199,21 +329,87 @@ func (tm *Manager) updateTask(taskID string, updateTaskInfo *types.TaskInfo) err
 	tm.metrics.tasks.WithLabelValues(task.CdnStatus).Dec()
 	tm.metrics.tasks.WithLabelValues(updateTaskInfo.CdnStatus).Inc()
 	task.CdnStatus = updateTaskInfo.CdnStatus
+	tm.persistTask(task)
 
 	return nil
 }
 
+// recoverTasks loads the tasks persisted in the meta store into taskStore.
+//
+// The CdnStatus of the recovered tasks is reset to WAITING, because the
+// progress of the cdn node is not persisted and it should be initialized
+// again. And then the cdn manager will report the cached file with the
+// persisted piece md5s instead of downloading it from the source again.
+func (tm *Manager) recoverTasks() error {
+	if tm.metaStore == nil {
+		return nil
+	}
+
+	count := 0
+	now := time.Now()
+	err := tm.metaStore.ForEach(metastore.BucketTask, func(taskID string, value []byte) error {
+		task := &types.TaskInfo{}
+		if err := json.Unmarshal(value, task); err != nil {
+			logrus.Warnf("failed to unmarshal the persisted task(%s), discard it: %v", taskID, err)
+			return nil
+		}
+
+		task.CdnStatus = types.TaskInfoCdnStatusWAITING
+		if err := tm.taskStore.Put(taskID, task); err != nil {
+			return err
+		}
+		tm.updateAccessTime(taskID, now)
+		tm.createTimeMap.Add(taskID, now)
+		tm.metrics.tasks.WithLabelValues(task.CdnStatus).Inc()
+		count++
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to recover tasks")
+	}
+
+	logrus.Infof("success to recover %d tasks from the meta store", count)
+	return nil
+}
+
+// persistTask writes the task into the meta store.
+// The failure only leads to a cache miss after restart, so it's just logged.
+func (tm *Manager) persistTask(task *types.TaskInfo) {
+	if tm.metaStore == nil {
+		return
+	}
+
+	if err := tm.metaStore.Put(metastore.BucketTask, task.ID, task); err != nil {
+		logrus.Errorf("failed to persist task(%s): %v", task.ID, err)
+	}
+}
+
+func (tm *Manager) deletePersistedTask(taskID string) {
+	if tm.metaStore == nil {
+		return
+	}
+
+	if err := tm.metaStore.Delete(metastore.BucketTask, taskID); err != nil {
+		logrus.Errorf("failed to delete the persisted task(%s): %v", taskID, err)
+	}
+}
+
 func (tm *Manager) addDfgetTask(ctx context.Context, req *types.TaskCreateRequest, task *types.TaskInfo) (*types.DfGetTask, error) {
 	dfgetTask := &types.DfGetTask{
-		CID:         req.CID,
-		CallSystem:  req.CallSystem,
-		Dfdaemon:    req.Dfdaemon,
-		Path:        req.Path,
-		PieceSize:   task.PieceSize,
-		Status:      types.DfGetTaskStatusWAITING,
-		TaskID:      task.ID,
-		PeerID:      req.PeerID,
-		SupernodeIP: req.SupernodeIP,
+		CID:           req.CID,
+		CallSystem:    req.CallSystem,
+		Dfdaemon:      req.Dfdaemon,
+		Group:         req.Group,
+		GroupDeadline: req.GroupDeadline,
+		Path:          req.Path,
+		PieceSize:     task.PieceSize,
+		Priority:      req.Priority,
+		RangeLength:   req.RangeLength,
+		RangeOffset:   req.RangeOffset,
+		Status:        types.DfGetTaskStatusWAITING,
+		TaskID:        task.ID,
+		PeerID:        req.PeerID,
+		SupernodeIP:   req.SupernodeIP,
 	}
 
 	if err := tm.dfgetTaskMgr.Add(ctx, dfgetTask); err != nil {
@@ -250,6 +446,10 @@ func (tm *Manager) triggerCdnSyncAction(ctx context.Context, task *types.TaskInf
 			tm.metrics.triggerCdnFailCount.WithLabelValues().Inc()
 			logrus.Errorf("taskID(%s) trigger cdn get error: %v", task.ID, err)
 		}
+		if errortypes.IsSourceChanged(err) {
+			tm.invalidateTask(ctx, task)
+			return
+		}
 		tm.updateTask(task.ID, updateTaskInfo)
 		logrus.Infof("success to update task cdn %+v", updateTaskInfo)
 	}()
@@ -257,6 +457,33 @@ func (tm *Manager) triggerCdnSyncAction(ctx context.Context, task *types.TaskInf
 	return nil
 }
 
+// invalidateTask removes the task with the progress of all its dfget tasks when the file
+// of the source has changed since it was fetched first, so that the peers register again
+// and download the new version from scratch rather than mixing the pieces of the two versions.
+func (tm *Manager) invalidateTask(ctx context.Context, task *types.TaskInfo) {
+	util.GetLock(task.ID, false)
+	defer util.ReleaseLock(task.ID, false)
+
+	cids, err := tm.dfgetTaskMgr.GetCIDsByTaskID(ctx, task.ID)
+	if err != nil {
+		logrus.Errorf("invalidate task: failed to get cids of taskID(%s): %v", task.ID, err)
+	}
+	for _, cid := range cids {
+		if err := tm.progressMgr.DeleteCID(ctx, cid); err != nil {
+			logrus.Errorf("invalidate task: failed to delete the progress of dfgetTask(%s): %v", cid, err)
+		}
+		if err := tm.dfgetTaskMgr.Delete(ctx, cid, task.ID); err != nil {
+			logrus.Errorf("invalidate task: failed to delete dfgetTask(%s): %v", cid, err)
+		}
+	}
+	if err := tm.progressMgr.DeleteTaskID(ctx, task.ID, int(task.PieceTotal)); err != nil {
+		logrus.Errorf("invalidate task: failed to delete the progress of taskID(%s): %v", task.ID, err)
+	}
+	tm.Delete(ctx, task.ID)
+	logrus.Warnf("invalidate task: taskID(%s) with %d dfgetTasks is removed since the source has changed",
+		task.ID, len(cids))
+}
+
 func (tm *Manager) initCdnNode(ctx context.Context, task *types.TaskInfo) error {
 	var cid = tm.cfg.GetSuperCID(task.ID)
 	var pid = tm.cfg.GetSuperPID()
@@ -335,7 +562,8 @@ func (tm *Manager) parseAvailablePeers(ctx context.Context, clientID string, tas
 	cdnSuccess := task.CdnStatus == types.TaskInfoCdnStatusSUCCESS
 	pieceSuccess, _ := tm.progressMgr.GetPieceProgressByCID(ctx, task.ID, clientID, "success")
 	logrus.Debugf("taskID(%s) clientID(%s) get successful pieces: %v", task.ID, clientID, pieceSuccess)
-	if cdnSuccess && (task.PieceTotal != 0 && (int32(len(pieceSuccess)) == task.PieceTotal)) {
+	pieceRange := tm.pieceRangeOf(task, dfgetTask)
+	if cdnSuccess && task.PieceTotal != 0 && hasAllPieces(pieceSuccess, pieceRange, int(task.PieceTotal)) {
 		// update dfget task status to success
 		if err := tm.dfgetTaskMgr.UpdateStatus(ctx, clientID, task.ID, types.DfGetTaskStatusSUCCESS); err != nil {
 			logrus.Errorf("failed to update dfget task status with "+
@@ -344,13 +572,15 @@ func (tm *Manager) parseAvailablePeers(ctx context.Context, clientID string, tas
 		finishInfo := make(map[string]interface{})
 		finishInfo["md5"] = task.RealMd5
 		finishInfo["fileLength"] = task.FileLength
+		finishInfo["sha256"] = task.RealSha256
 		return true, finishInfo, nil
 	}
 
 	// get scheduler pieceResult
 	logrus.Debugf("start scheduler for taskID: %s clientID: %s", task.ID, clientID)
 	startTime := time.Now()
-	pieceResult, err := tm.schedulerMgr.Schedule(ctx, task.ID, clientID, dfgetTask.PeerID)
+	priority := mgr.SchedulePriority(dfgetTask, tm.cfg.GroupUrgentWindow, time.Now())
+	pieceResult, err := tm.schedulerMgr.Schedule(ctx, task.ID, clientID, dfgetTask.PeerID, priority, pieceRange)
 	if err != nil {
 		return false, nil, err
 	}
@@ -386,6 +616,44 @@ func (tm *Manager) parseAvailablePeers(ctx context.Context, clientID string, tas
 	return false, pieceInfos, nil
 }
 
+// pieceRangeOf returns the range of the pieces covering the range of the file which
+// the dfget task downloads, or nil if it downloads the whole file.
+func (tm *Manager) pieceRangeOf(task *types.TaskInfo, dfgetTask *types.DfGetTask) *mgr.PieceRange {
+	if (dfgetTask.RangeOffset == 0 && dfgetTask.RangeLength == 0) || task.PieceSize <= config.PieceWrapSize {
+		return nil
+	}
+
+	// the pieces of the source pattern aren't wrapped by the head and the tail
+	pieceContSize := int64(task.PieceSize - config.PieceWrapSize)
+	if tm.cfg.CDNPattern == config.CDNPatternSource {
+		pieceContSize = int64(task.PieceSize)
+	}
+	pieceRange := &mgr.PieceRange{Start: int(dfgetTask.RangeOffset / pieceContSize), End: -1}
+	if dfgetTask.RangeLength > 0 {
+		pieceRange.End = int((dfgetTask.RangeOffset + dfgetTask.RangeLength - 1) / pieceContSize)
+	}
+	return pieceRange
+}
+
+// hasAllPieces returns whether all the pieces in the range of the total pieces succeed.
+func hasAllPieces(pieceSuccess []int, pieceRange *mgr.PieceRange, pieceTotal int) bool {
+	if pieceRange == nil {
+		return len(pieceSuccess) == pieceTotal
+	}
+
+	end := pieceRange.End
+	if end < 0 || end >= pieceTotal {
+		end = pieceTotal - 1
+	}
+	count := 0
+	for _, pieceNum := range pieceSuccess {
+		if pieceRange.Contains(pieceNum) && pieceNum <= end {
+			count++
+		}
+	}
+	return count == end-pieceRange.Start+1
+}
+
 func (tm *Manager) pieceResultToPieceInfo(ctx context.Context, pr *mgr.PieceResult, pieceSize int32) (*types.PieceInfo, error) {
 	cid, err := tm.dfgetTaskMgr.GetCIDByPeerIDAndTaskID(ctx, pr.DstPID, pr.TaskID)
 	if err != nil {
@@ -406,14 +674,21 @@ func (tm *Manager) pieceResultToPieceInfo(ctx context.Context, pr *mgr.PieceResu
 		logrus.Warnf("failed to get piece MD5 taskID(%s) pieceNum(%d): %v", pr.TaskID, pr.PieceNum, err)
 		pieceMD5 = ""
 	}
+	// the piece which CDN hasn't computed yet is verified against the manifest of the task
+	tm.manifestStore.verifyPiece(pr.TaskID, pr.PieceNum, pieceMD5)
+	if pieceMD5 == "" {
+		pieceMD5 = tm.manifestStore.pieceMD5(pr.TaskID, pr.PieceNum)
+	}
 	return &types.PieceInfo{
-		PID:        pr.DstPID,
-		Path:       dfgetTask.Path,
-		PeerIP:     peer.IP.String(),
-		PeerPort:   peer.Port,
-		PieceMD5:   pieceMD5,
-		PieceRange: rangeutils.CalculatePieceRange(pr.PieceNum, pieceSize),
-		PieceSize:  pieceSize,
+		PID:            pr.DstPID,
+		Path:           dfgetTask.Path,
+		PeerIP:         peer.IP.String(),
+		PeerAddresses:  peer.Addresses,
+		PeerPort:       peer.Port,
+		PeerTransports: peer.Transports,
+		PieceMD5:       pieceMD5,
+		PieceRange:     rangeutils.CalculatePieceRange(pr.PieceNum, pieceSize),
+		PieceSize:      pieceSize,
 	}, nil
 }
 
@@ -463,7 +738,7 @@ func convertToPeerPieceStatus(result, status string) (int, bool) {
 // equalsTask determines that whether the two task objects are the same.
 //
 // The result is based only on whether the attributes used to generate taskID are the same
-// which including taskURL, md5, identifier.
+// which including taskURL, md5, digest, identifier.
 func equalsTask(existTask, newTask *types.TaskInfo) bool {
 	if existTask.TaskURL != newTask.TaskURL {
 		return false
@@ -473,6 +748,10 @@ func equalsTask(existTask, newTask *types.TaskInfo) bool {
 		return existTask.Md5 == newTask.Md5
 	}
 
+	if !stringutils.IsEmptyStr(existTask.Digest) {
+		return existTask.Digest == newTask.Digest
+	}
+
 	return existTask.Identifier == newTask.Identifier
 }
 
@@ -494,6 +773,26 @@ func validateParams(req *types.TaskCreateRequest) error {
 		return errors.Wrapf(errortypes.ErrEmptyValue, "peerID")
 	}
 
+	switch req.Priority {
+	case "", types.PriorityHigh, types.PriorityNormal, types.PriorityLow:
+	default:
+		return errors.Wrapf(errortypes.ErrInvalidValue, "priority: %s", req.Priority)
+	}
+
+	if req.GroupDeadline != 0 && req.Group == "" {
+		return errors.Wrap(errortypes.ErrInvalidValue, "groupDeadline without group")
+	}
+
+	if req.RangeOffset < 0 || req.RangeLength < 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "range offset %d and length %d should not be negative",
+			req.RangeOffset, req.RangeLength)
+	}
+
+	if req.PieceSize != 0 && (req.PieceSize < config.MinPieceSize || req.PieceSize > config.DefaultPieceSizeLimit) {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "pieceSize %d should be between %d and %d",
+			req.PieceSize, config.MinPieceSize, config.DefaultPieceSizeLimit)
+	}
+
 	return nil
 }
 
@@ -515,10 +814,34 @@ func generateTaskID(taskURL, md5, identifier string, header map[string]string) s
 	return digest.Sha256(id)
 }
 
+// hashHeaders returns the sha256 digest of the sorted headers,
+// it's empty if there is no header.
+func hashHeaders(headers map[string]string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteString(":")
+		sb.WriteString(headers[k])
+		sb.WriteString("\n")
+	}
+	return digest.Sha256(sb.String())
+}
+
 // computePieceSize computes the piece size with specified fileLength.
 //
 // If the fileLength<=0, which means failed to get fileLength
 // and then use the DefaultPieceSize.
+// The piece size of a file larger than 200MB is DefaultPieceSize plus 1MB for every
+// full 100MB beyond 200MB, and it's at most DefaultPieceSizeLimit.
 func computePieceSize(length int64) int32 {
 	if length <= 0 || length <= 200*1024*1024 {
 		return config.DefaultPieceSize
@@ -547,22 +870,142 @@ func isWait(CDNStatus string) bool {
 	return CDNStatus == types.TaskInfoCdnStatusWAITING
 }
 
-func (tm *Manager) getHTTPFileLength(taskID, url string, headers map[string]string) (int64, error) {
-	fileLength, code, err := tm.originClient.GetContentLength(url, headers)
+// getHTTPFileLength gets the file length of the task and the headers of the response
+// from the source, the headers are nil unless the response succeeds.
+func (tm *Manager) getHTTPFileLength(taskID, url string, headers map[string]string) (int64, http.Header, error) {
+	info, err := tm.originClient.GetContentInfo(url, httputils.WithTaskHeader(headers, taskID))
 	if err != nil {
-		return -1, errors.Wrapf(errortypes.ErrUnknownError, "failed to get http file Length: %v", err)
+		return -1, nil, errors.Wrapf(errortypes.ErrUnknownError, "failed to get http file Length: %v", err)
 	}
 
+	code := info.StatusCode
 	if code == http.StatusUnauthorized || code == http.StatusProxyAuthRequired {
-		return -1, errors.Wrapf(errortypes.ErrAuthenticationRequired, "taskID: %s,code: %d", taskID, code)
+		return -1, nil, errors.Wrapf(errortypes.ErrAuthenticationRequired, "taskID: %s,code: %d", taskID, code)
 	}
 	if code != http.StatusOK && code != http.StatusPartialContent {
 		logrus.Warnf("failed to get http file length with unexpected code: %d", code)
 		if code == http.StatusNotFound {
-			return -1, errors.Wrapf(errortypes.ErrURLNotReachable, "taskID: %s, url: %s", taskID, url)
+			return -1, nil, errors.Wrapf(errortypes.ErrURLNotReachable, "taskID: %s, url: %s", taskID, url)
 		}
-		return -1, nil
+		return -1, nil, nil
 	}
 
-	return fileLength, nil
+	return info.Length, info.Header, nil
+}
+
+// passThroughHeaders selects the headers of the response of the source by names,
+// which are kept with the task. It returns nil if none of them is in the response.
+func passThroughHeaders(names []string, header http.Header) map[string]string {
+	var selected map[string]string
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if v := header.Get(name); v != "" {
+			if selected == nil {
+				selected = make(map[string]string)
+			}
+			selected[name] = v
+		}
+	}
+	return selected
+}
+
+// taskEntry is a task listed with the times tracked by the task manager.
+type taskEntry struct {
+	task       *types.TaskInfo
+	createTime time.Time
+	accessTime time.Time
+}
+
+// getTime returns the time of the key in the timeMap,
+// and it returns the zero time if the key doesn't exist.
+func getTime(timeMap *syncmap.SyncMap, key string) time.Time {
+	t, err := timeMap.GetAsTime(key)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// matchTask returns whether the task entry is selected by the filter.
+func matchTask(filter *mgr.TaskFilter, entry *taskEntry, now time.Time) bool {
+	task := entry.task
+	if filter.URLPattern != nil && !filter.URLPattern.MatchString(task.TaskURL) {
+		return false
+	}
+	if len(filter.CdnStatus) > 0 {
+		matched := false
+		for _, status := range filter.CdnStatus {
+			matched = matched || status == task.CdnStatus
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	age := now.Sub(entry.createTime)
+	if filter.MinAge > 0 && age < filter.MinAge {
+		return false
+	}
+	if filter.MaxAge > 0 && age > filter.MaxAge {
+		return false
+	}
+
+	if filter.MinSize > 0 && task.HTTPFileLength < filter.MinSize {
+		return false
+	}
+	if filter.MaxSize > 0 && task.HTTPFileLength > filter.MaxSize {
+		return false
+	}
+	return true
+}
+
+// getLessFunc returns the less function which sorts the task entries by the sort keys in turn,
+// and the entries are sorted by the create time if no sort key is specified.
+func getLessFunc(entries []interface{}, sortKeys []string, desc bool) func(i, j int) bool {
+	if len(sortKeys) == 0 {
+		sortKeys = []string{mgr.TaskSortKeyCreateTime}
+	}
+	return func(i, j int) bool {
+		a, b := entries[i].(*taskEntry), entries[j].(*taskEntry)
+		if desc {
+			a, b = b, a
+		}
+		for _, key := range sortKeys {
+			if c := compareTask(a, b, key); c != 0 {
+				return c < 0
+			}
+		}
+		return a.task.ID < b.task.ID
+	}
+}
+
+// compareTask compares the task entries by the sort key,
+// and it returns a negative number if a sorts before b.
+func compareTask(a, b *taskEntry, sortKey string) int {
+	switch sortKey {
+	case mgr.TaskSortKeyCreateTime:
+		return compareTime(a.createTime, b.createTime)
+	case mgr.TaskSortKeyAccessTime:
+		return compareTime(a.accessTime, b.accessTime)
+	case mgr.TaskSortKeySize:
+		if a.task.HTTPFileLength != b.task.HTTPFileLength {
+			if a.task.HTTPFileLength < b.task.HTTPFileLength {
+				return -1
+			}
+			return 1
+		}
+	case mgr.TaskSortKeyURL:
+		return strings.Compare(a.task.TaskURL, b.task.TaskURL)
+	}
+	return 0
+}
+
+func compareTime(a, b time.Time) int {
+	if a.Before(b) {
+		return -1
+	}
+	if a.After(b) {
+		return 1
+	}
+	return 0
 }
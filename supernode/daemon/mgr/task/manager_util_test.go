@@ -18,10 +18,14 @@ package task
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
 	cMock "github.com/dragonflyoss/Dragonfly/supernode/httpclient/mock"
 
 	"github.com/go-check/check"
@@ -56,9 +60,9 @@ func (s *TaskUtilTestSuite) SetUpSuite(c *check.C) {
 	s.mockSchedulerMgr = mock.NewMockSchedulerMgr(s.mockCtl)
 	s.mockOriginClient = cMock.NewMockOriginHTTPClient(s.mockCtl)
 	s.taskManager, _ = NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
-		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, nil, prometheus.NewRegistry())
 
-	s.mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(1000), 200, nil)
+	s.mockOriginClient.EXPECT().GetContentInfo(gomock.Any(), gomock.Any()).Return(&httpclient.ContentInfo{Length: 1000, StatusCode: 200}, nil)
 }
 
 func (s *TaskUtilTestSuite) TearDownSuite(c *check.C) {
@@ -120,6 +124,17 @@ func (s *TaskUtilTestSuite) TestEqualsTask(c *check.C) {
 			},
 			result: false,
 		},
+		{
+			existTask: &types.TaskInfo{
+				TaskURL: "http://aa.bb.com",
+				Digest:  "sha256:foo",
+			},
+			task: &types.TaskInfo{
+				TaskURL: "http://aa.bb.com",
+				Digest:  "sha256:bar",
+			},
+			result: false,
+		},
 	}
 
 	for _, v := range cases {
@@ -181,3 +196,111 @@ func (s *TaskUtilTestSuite) TestTriggerCdnSyncAction(c *check.C) {
 		}
 	}
 }
+
+func (s *TaskUtilTestSuite) TestValidatePieceSize(c *check.C) {
+	req := &types.TaskCreateRequest{
+		RawURL: "http://a.com/x",
+		Path:   "/peer/file/x",
+		CID:    "cid",
+		PeerID: "peer",
+	}
+	c.Check(validateParams(req), check.IsNil)
+
+	req.PieceSize = config.MinPieceSize
+	c.Check(validateParams(req), check.IsNil)
+
+	req.PieceSize = config.MinPieceSize - 1
+	c.Check(errortypes.IsInvalidValue(validateParams(req)), check.Equals, true)
+
+	req.PieceSize = config.DefaultPieceSizeLimit + 1
+	c.Check(errortypes.IsInvalidValue(validateParams(req)), check.Equals, true)
+}
+
+func (s *TaskUtilTestSuite) TestValidatePriority(c *check.C) {
+	req := &types.TaskCreateRequest{
+		RawURL:   "http://a.com/x",
+		Path:     "/peer/file/x",
+		CID:      "cid",
+		PeerID:   "peer",
+		Priority: types.PriorityLow,
+	}
+	c.Check(validateParams(req), check.IsNil)
+
+	req.Priority = "urgent"
+	c.Check(errortypes.IsInvalidValue(validateParams(req)), check.Equals, true)
+}
+
+func (s *TaskUtilTestSuite) TestValidateGroup(c *check.C) {
+	req := &types.TaskCreateRequest{
+		RawURL:        "http://a.com/x",
+		Path:          "/peer/file/x",
+		CID:           "cid",
+		PeerID:        "peer",
+		GroupDeadline: 1000,
+	}
+	c.Check(errortypes.IsInvalidValue(validateParams(req)), check.Equals, true)
+
+	req.Group = "image"
+	c.Check(validateParams(req), check.IsNil)
+}
+
+func (s *TaskUtilTestSuite) TestPieceRangeOf(c *check.C) {
+	req := &types.TaskCreateRequest{
+		RawURL:      "http://a.com/x",
+		Path:        "/peer/file/x",
+		CID:         "cid",
+		PeerID:      "peer",
+		RangeOffset: -1,
+	}
+	c.Check(errortypes.IsInvalidValue(validateParams(req)), check.Equals, true)
+
+	// every piece wraps 100 bytes of the file
+	task := &types.TaskInfo{PieceSize: 100 + config.PieceWrapSize}
+	c.Check(s.taskManager.pieceRangeOf(task, &types.DfGetTask{}), check.IsNil)
+	c.Check(s.taskManager.pieceRangeOf(task, &types.DfGetTask{RangeOffset: 150}),
+		check.DeepEquals, &mgr.PieceRange{Start: 1, End: -1})
+	pieceRange := s.taskManager.pieceRangeOf(task, &types.DfGetTask{RangeOffset: 150, RangeLength: 150})
+	c.Check(pieceRange, check.DeepEquals, &mgr.PieceRange{Start: 1, End: 2})
+
+	c.Check(hasAllPieces([]int{0, 1}, pieceRange, 5), check.Equals, false)
+	c.Check(hasAllPieces([]int{1, 2}, pieceRange, 5), check.Equals, true)
+	c.Check(hasAllPieces([]int{1, 2}, nil, 5), check.Equals, false)
+	// the range is bounded by the last piece
+	c.Check(hasAllPieces([]int{3, 4}, &mgr.PieceRange{Start: 3, End: -1}, 5), check.Equals, true)
+	c.Check(hasAllPieces([]int{3}, &mgr.PieceRange{Start: 3, End: 10}, 5), check.Equals, false)
+}
+
+func (s *TaskUtilTestSuite) TestRaisePriority(c *check.C) {
+	task := &types.TaskInfo{ID: "foo", Priority: types.PriorityLow}
+	s.mockCDNMgr.EXPECT().UpdatePriority(gomock.Any(), "foo", types.PriorityHigh).Return(nil)
+
+	s.taskManager.raisePriority(context.Background(), task, types.PriorityHigh)
+	c.Check(task.Priority, check.Equals, types.PriorityHigh)
+
+	// a lower priority doesn't change the task
+	s.taskManager.raisePriority(context.Background(), task, types.PriorityNormal)
+	c.Check(task.Priority, check.Equals, types.PriorityHigh)
+}
+
+func (s *TaskUtilTestSuite) TestHashHeaders(c *check.C) {
+	c.Check(hashHeaders(nil), check.Equals, "")
+
+	h := hashHeaders(map[string]string{"a": "1", "b": "2"})
+	c.Check(h, check.Not(check.Equals), "")
+	c.Check(hashHeaders(map[string]string{"b": "2", "a": "1"}), check.Equals, h)
+	c.Check(hashHeaders(map[string]string{"a": "1", "b": "3"}), check.Not(check.Equals), h)
+}
+
+func (s *TaskUtilTestSuite) TestPassThroughHeaders(c *check.C) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-tar")
+	header.Set("Docker-Content-Digest", "sha256:abc")
+	header.Set("X-Secret", "foo")
+
+	c.Check(passThroughHeaders(nil, header), check.IsNil)
+	c.Check(passThroughHeaders(config.DefaultPassThroughHeaders, nil), check.IsNil)
+	c.Check(passThroughHeaders([]string{"content-type", "x-missing"}, header), check.DeepEquals,
+		map[string]string{"Content-Type": "application/x-tar"})
+	c.Check(passThroughHeaders(config.DefaultPassThroughHeaders, header), check.DeepEquals,
+		map[string]string{"Content-Type": "application/x-tar", "Docker-Content-Digest": "sha256:abc"})
+}
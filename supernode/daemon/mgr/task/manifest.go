@@ -0,0 +1,317 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var pieceMD5Reg = regexp.MustCompile(`^[0-9a-f]{32}:[0-9]+$`)
+
+// manifestStore maintains the piece md5s of the tasks computed by the publishers.
+type manifestStore struct {
+	sync.RWMutex
+	manifests map[string]*types.TaskManifest
+}
+
+func newManifestStore() *manifestStore {
+	return &manifestStore{manifests: make(map[string]*types.TaskManifest)}
+}
+
+// put stores the manifest and returns the previous one of the task, it's nil if there's none.
+func (ms *manifestStore) put(manifest *types.TaskManifest) *types.TaskManifest {
+	ms.Lock()
+	defer ms.Unlock()
+	prev := ms.manifests[manifest.TaskID]
+	ms.manifests[manifest.TaskID] = manifest
+	return prev
+}
+
+// add stores the manifest unless the one of the task is still being verified, so that
+// the manifest trusted by the peers can't be replaced before CDN verifies it.
+// It returns the previous one of the task, it's nil if there's none.
+func (ms *manifestStore) add(manifest *types.TaskManifest) (*types.TaskManifest, error) {
+	ms.Lock()
+	defer ms.Unlock()
+	prev := ms.manifests[manifest.TaskID]
+	if prev != nil && prev.Status == types.TaskManifestStatusVERIFYING {
+		return nil, errors.Wrapf(errortypes.ErrTaskIDDuplicate,
+			"the manifest of taskID %s is being verified, delete it before adding another one", manifest.TaskID)
+	}
+	ms.manifests[manifest.TaskID] = manifest
+	return prev, nil
+}
+
+func (ms *manifestStore) get(taskID string) (*types.TaskManifest, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+	m, ok := ms.manifests[taskID]
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "manifest of taskID: %s", taskID)
+	}
+	return copyManifest(m), nil
+}
+
+func (ms *manifestStore) remove(taskID string) bool {
+	ms.Lock()
+	defer ms.Unlock()
+	_, ok := ms.manifests[taskID]
+	delete(ms.manifests, taskID)
+	return ok
+}
+
+func (ms *manifestStore) has(taskID string) bool {
+	ms.RLock()
+	defer ms.RUnlock()
+	_, ok := ms.manifests[taskID]
+	return ok
+}
+
+// pieceSize returns the piece size of the manifest of the task, it's 0 if there's none.
+func (ms *manifestStore) pieceSize(taskID string) int32 {
+	ms.RLock()
+	defer ms.RUnlock()
+	if m, ok := ms.manifests[taskID]; ok {
+		return m.PieceSize
+	}
+	return 0
+}
+
+// verifyFileLength marks the manifest of the task as MISMATCH if the length of the file
+// of the source differs from the one in the manifest. It's skipped if the length is unknown.
+func (ms *manifestStore) verifyFileLength(taskID string, fileLength int64) {
+	ms.RLock()
+	m, ok := ms.manifests[taskID]
+	expected := int64(0)
+	if ok {
+		expected = m.FileLength
+	}
+	ms.RUnlock()
+	if ok && fileLength > 0 && fileLength != expected {
+		ms.mismatch(taskID, fmt.Sprintf("the file length of the source is %d, expected %d", fileLength, expected))
+	}
+}
+
+// pieceMD5 returns the md5 of the piece in the manifest of the task, it's empty
+// if there's no manifest or the manifest mismatches the task.
+func (ms *manifestStore) pieceMD5(taskID string, pieceNum int) string {
+	ms.RLock()
+	defer ms.RUnlock()
+	m, ok := ms.manifests[taskID]
+	if !ok || m.Status == types.TaskManifestStatusMISMATCH || pieceNum < 0 || pieceNum >= len(m.PieceMD5s) {
+		return ""
+	}
+	return m.PieceMD5s[pieceNum]
+}
+
+// verifyPiece verifies the md5 of the piece computed by CDN against the manifest of the task,
+// and the manifest is marked as MISMATCH if they differ.
+func (ms *manifestStore) verifyPiece(taskID string, pieceNum int, pieceMD5 string) {
+	if pieceMD5 == "" {
+		return
+	}
+	if expected := ms.pieceMD5(taskID, pieceNum); expected != "" && expected != pieceMD5 {
+		ms.mismatch(taskID, fmt.Sprintf("the md5 of piece %d computed by CDN is %s, expected %s", pieceNum, pieceMD5, expected))
+	}
+}
+
+// verify verifies the md5s of all pieces computed by CDN against the manifest of the task,
+// it returns false if the manifest mismatches them.
+func (ms *manifestStore) verify(taskID string, pieceMD5s []string) bool {
+	ms.Lock()
+	m, ok := ms.manifests[taskID]
+	if !ok || m.Status == types.TaskManifestStatusMISMATCH {
+		ms.Unlock()
+		return !ok
+	}
+	reason := ""
+	if len(pieceMD5s) != len(m.PieceMD5s) {
+		reason = fmt.Sprintf("CDN computes %d pieces, expected %d", len(pieceMD5s), len(m.PieceMD5s))
+	}
+	for i := 0; reason == "" && i < len(pieceMD5s); i++ {
+		if pieceMD5s[i] != m.PieceMD5s[i] {
+			reason = fmt.Sprintf("the md5 of piece %d computed by CDN is %s, expected %s", i, pieceMD5s[i], m.PieceMD5s[i])
+		}
+	}
+	if reason == "" {
+		m.Status = types.TaskManifestStatusVERIFIED
+	}
+	ms.Unlock()
+
+	if reason != "" {
+		ms.mismatch(taskID, reason)
+		return false
+	}
+	return true
+}
+
+// mismatch marks the manifest of the task as MISMATCH, so that it isn't used any more.
+func (ms *manifestStore) mismatch(taskID, reason string) {
+	ms.Lock()
+	defer ms.Unlock()
+	if m, ok := ms.manifests[taskID]; ok && m.Status != types.TaskManifestStatusMISMATCH {
+		logrus.Errorf("the manifest of taskID(%s) mismatches: %s", taskID, reason)
+		m.Status = types.TaskManifestStatusMISMATCH
+		m.Reason = reason
+	}
+}
+
+// copyManifest returns a copy of the manifest without the piece md5s,
+// which are too many to be returned by the APIs.
+func copyManifest(m *types.TaskManifest) *types.TaskManifest {
+	c := *m
+	c.PieceMD5s = nil
+	c.Filter = append([]string(nil), m.Filter...)
+	return &c
+}
+
+// validateManifest validates the piece md5s of the manifest against the layout
+// of the pieces of the file, and it returns the layout.
+func validateManifest(manifest *types.TaskManifest) (*types.PieceLayout, error) {
+	if manifest == nil {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "manifest")
+	}
+	if !netutils.IsValidURL(manifest.RawURL) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "rawURL: %s", manifest.RawURL)
+	}
+	if manifest.FileLength <= 0 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "fileLength: %d", manifest.FileLength)
+	}
+	layout, err := PieceLayout(manifest.FileLength, manifest.PieceSize, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.PieceMD5s) != len(layout.Pieces) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue,
+			"the file has %d pieces but got %d piece md5s", len(layout.Pieces), len(manifest.PieceMD5s))
+	}
+	for i, pieceMD5 := range manifest.PieceMD5s {
+		if !pieceMD5Reg.MatchString(pieceMD5) {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "the md5 of piece %d should be md5:pieceLength: %s", i, pieceMD5)
+		}
+		length := pieceMD5[strings.IndexByte(pieceMD5, ':')+1:]
+		if length != strconv.Itoa(int(layout.Pieces[i].PieceLength)) {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue,
+				"the length of piece %d should be %d: %s", i, layout.Pieces[i].PieceLength, pieceMD5)
+		}
+	}
+	return layout, nil
+}
+
+// AddManifest registers the task of the manifest, whose pieces are verified against the
+// manifest before the CDN of the task finishes, and then the manifest is verified against
+// the piece md5s computed by CDN. It fails if the task has a manifest being verified.
+func (tm *Manager) AddManifest(ctx context.Context, manifest *types.TaskManifest) (*types.TaskManifest, error) {
+	layout, err := validateManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &types.TaskCreateRequest{
+		RawURL:     manifest.RawURL,
+		Filter:     manifest.Filter,
+		Headers:    manifest.Headers,
+		Identifier: manifest.Identifier,
+		Md5:        manifest.Md5,
+		PieceSize:  manifest.PieceSize,
+		Priority:   types.PriorityNormal,
+	}
+	key, err := tm.resolveTaskKey(req)
+	if err != nil {
+		return nil, err
+	}
+	m := &types.TaskManifest{
+		CreatedTime: strfmt.DateTime(time.Now()),
+		FileLength:  manifest.FileLength,
+		Filter:      manifest.Filter,
+		Headers:     manifest.Headers,
+		Identifier:  manifest.Identifier,
+		Md5:         manifest.Md5,
+		PieceMD5s:   append([]string(nil), manifest.PieceMD5s...),
+		PieceSize:   layout.PieceSize,
+		PieceTotal:  layout.PieceTotal,
+		RawURL:      manifest.RawURL,
+		Status:      types.TaskManifestStatusVERIFYING,
+		TaskID:      key.id,
+	}
+	// the manifest is stored before the task is added, so that the piece size of it is used
+	// by the new task, and the previous one is restored if the task doesn't match it.
+	prev, err := tm.manifestStore.add(m)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := tm.addOrUpdateTask(ctx, req, tm.cfg.FailAccessInterval)
+	if err == nil && (task.HTTPFileLength != manifest.FileLength || task.PieceSize != layout.PieceSize) {
+		err = errors.Wrapf(errortypes.ErrInvalidValue, "taskID (%s) with fileLength (%d) pieceSize (%d) mismatches the manifest",
+			task.ID, task.HTTPFileLength, task.PieceSize)
+	}
+	if err != nil {
+		tm.manifestStore.remove(key.id)
+		if prev != nil {
+			tm.manifestStore.put(prev)
+		}
+		return nil, err
+	}
+
+	if isSuccessCDN(task.CdnStatus) {
+		tm.verifyManifest(task.ID)
+	}
+	logrus.Infof("success to add the manifest of %d pieces for taskID(%s)", layout.PieceTotal, task.ID)
+	return tm.manifestStore.get(task.ID)
+}
+
+// verifyManifest verifies the piece md5s computed by CDN against the manifest of the task
+// whose CDN has finished, it returns false only if they mismatch.
+func (tm *Manager) verifyManifest(taskID string) bool {
+	if !tm.manifestStore.has(taskID) {
+		return true
+	}
+	pieceMD5s, err := tm.cdnMgr.GetPieceMD5s(context.Background(), taskID)
+	if err != nil {
+		logrus.Warnf("failed to get the piece md5s of taskID(%s) to verify the manifest: %v", taskID, err)
+		return true
+	}
+	return tm.manifestStore.verify(taskID, pieceMD5s)
+}
+
+// GetManifest gets the manifest of the task.
+func (tm *Manager) GetManifest(ctx context.Context, taskID string) (*types.TaskManifest, error) {
+	return tm.manifestStore.get(taskID)
+}
+
+// DeleteManifest deletes the manifest of the task.
+func (tm *Manager) DeleteManifest(ctx context.Context, taskID string) error {
+	if !tm.manifestStore.remove(taskID) {
+		return errors.Wrapf(errortypes.ErrDataNotFound, "manifest of taskID: %s", taskID)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/lease"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	cMock "github.com/dragonflyoss/Dragonfly/supernode/httpclient/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	check.Suite(&ManifestTestSuite{})
+}
+
+type ManifestTestSuite struct {
+	mockCtl          *gomock.Controller
+	mockCDNMgr       *mock.MockCDNMgr
+	mockOriginClient *cMock.MockOriginHTTPClient
+
+	tm *Manager
+}
+
+func (s *ManifestTestSuite) SetUpTest(c *check.C) {
+	s.mockCtl = gomock.NewController(c)
+	s.mockCDNMgr = mock.NewMockCDNMgr(s.mockCtl)
+	s.mockOriginClient = cMock.NewMockOriginHTTPClient(s.mockCtl)
+	s.tm = &Manager{
+		cfg:                     config.NewConfig(),
+		taskStore:               dutil.NewStore(),
+		accessTimeMap:           syncmap.NewSyncMap(),
+		accessLeases:            lease.NewTable(lease.NewClock(0)),
+		createTimeMap:           syncmap.NewSyncMap(),
+		taskURLUnReachableStore: syncmap.NewSyncMap(),
+		aliasStore:              newAliasStore(),
+		manifestStore:           newManifestStore(),
+		metrics:                 newMetrics(prometheus.NewRegistry()),
+		cdnMgr:                  s.mockCDNMgr,
+		originClient:            s.mockOriginClient,
+	}
+}
+
+func (s *ManifestTestSuite) TearDownTest(c *check.C) {
+	s.mockCtl.Finish()
+}
+
+func pieceMD5(b byte, length int) string {
+	return fmt.Sprintf("%s:%d", strings.Repeat(string(b), 32), length)
+}
+
+func (s *ManifestTestSuite) TestValidateManifest(c *check.C) {
+	valid := &types.TaskManifest{RawURL: "http://a.com/x", FileLength: 10, PieceMD5s: []string{pieceMD5('a', 15)}}
+	layout, err := validateManifest(valid)
+	c.Assert(err, check.IsNil)
+	c.Check(layout.PieceTotal, check.Equals, int32(1))
+
+	for i, m := range []*types.TaskManifest{
+		nil,
+		{RawURL: "a.com/x", FileLength: 10, PieceMD5s: []string{pieceMD5('a', 15)}},
+		{RawURL: "http://a.com/x", PieceMD5s: []string{pieceMD5('a', 15)}},
+		{RawURL: "http://a.com/x", FileLength: 10},
+		{RawURL: "http://a.com/x", FileLength: 10, PieceMD5s: []string{"foo:15"}},
+		{RawURL: "http://a.com/x", FileLength: 10, PieceMD5s: []string{pieceMD5('a', 14)}},
+		{RawURL: "http://a.com/x", FileLength: 10, PieceSize: 1, PieceMD5s: []string{pieceMD5('a', 15)}},
+	} {
+		_, err := validateManifest(m)
+		c.Check(err, check.NotNil, check.Commentf("case %d", i))
+	}
+}
+
+func (s *ManifestTestSuite) TestAddManifest(c *check.C) {
+	ctx := context.Background()
+	s.mockOriginClient.EXPECT().GetContentInfo(gomock.Any(), gomock.Any()).Return(&httpclient.ContentInfo{Length: 10, StatusCode: 200}, nil)
+	manifest, err := s.tm.AddManifest(ctx, &types.TaskManifest{
+		RawURL:     "http://a.com/x",
+		FileLength: 10,
+		PieceMD5s:  []string{pieceMD5('a', 15)},
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(manifest.Status, check.Equals, types.TaskManifestStatusVERIFYING)
+	c.Check(manifest.PieceMD5s, check.IsNil)
+	c.Check(manifest.PieceSize, check.Equals, int32(config.DefaultPieceSize))
+	task, err := s.tm.getTask(manifest.TaskID)
+	c.Assert(err, check.IsNil)
+	c.Check(task.HTTPFileLength, check.Equals, int64(10))
+
+	// the manifest being verified can't be replaced
+	_, err = s.tm.AddManifest(ctx, &types.TaskManifest{
+		RawURL:     "http://a.com/x",
+		FileLength: 10,
+		PieceMD5s:  []string{pieceMD5('b', 15)},
+	})
+	c.Check(errortypes.IsTaskIDDuplicate(err), check.Equals, true)
+
+	// the manifest is used until CDN computes the piece
+	c.Check(s.tm.manifestStore.pieceMD5(task.ID, 0), check.Equals, pieceMD5('a', 15))
+	s.tm.manifestStore.verifyPiece(task.ID, 0, "")
+	c.Check(s.tm.manifestStore.pieceMD5(task.ID, 0), check.Equals, pieceMD5('a', 15))
+
+	// the manifest is verified once CDN finishes
+	s.mockCDNMgr.EXPECT().GetPieceMD5s(gomock.Any(), task.ID).Return([]string{pieceMD5('a', 15)}, nil)
+	c.Assert(s.tm.updateTask(task.ID, &types.TaskInfo{CdnStatus: types.TaskInfoCdnStatusSUCCESS, FileLength: 10}), check.IsNil)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	manifest, err = s.tm.GetManifest(ctx, task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(manifest.Status, check.Equals, types.TaskManifestStatusVERIFIED)
+
+	// the manifest is removed with the task
+	c.Check(s.tm.Delete(ctx, task.ID), check.IsNil)
+	_, err = s.tm.GetManifest(ctx, task.ID)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	c.Check(errortypes.IsDataNotFound(s.tm.DeleteManifest(ctx, task.ID)), check.Equals, true)
+}
+
+func (s *ManifestTestSuite) TestAddManifestMismatch(c *check.C) {
+	ctx := context.Background()
+	// the file length of the source differs
+	s.mockOriginClient.EXPECT().GetContentInfo(gomock.Any(), gomock.Any()).Return(&httpclient.ContentInfo{Length: 20, StatusCode: 200}, nil)
+	_, err := s.tm.AddManifest(ctx, &types.TaskManifest{
+		RawURL:     "http://a.com/x",
+		FileLength: 10,
+		PieceMD5s:  []string{pieceMD5('a', 15)},
+	})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+
+	s.mockOriginClient.EXPECT().GetContentInfo(gomock.Any(), gomock.Any()).Return(&httpclient.ContentInfo{Length: 10, StatusCode: 200}, nil)
+	manifest, err := s.tm.AddManifest(ctx, &types.TaskManifest{
+		RawURL:     "http://a.com/y",
+		FileLength: 10,
+		PieceMD5s:  []string{pieceMD5('a', 15)},
+	})
+	c.Assert(err, check.IsNil)
+
+	// the task fails once CDN computes the pieces differently
+	s.mockCDNMgr.EXPECT().GetPieceMD5s(gomock.Any(), manifest.TaskID).Return([]string{pieceMD5('b', 15)}, nil)
+	c.Assert(s.tm.updateTask(manifest.TaskID, &types.TaskInfo{CdnStatus: types.TaskInfoCdnStatusSUCCESS, FileLength: 10}), check.IsNil)
+	task, err := s.tm.getTask(manifest.TaskID)
+	c.Assert(err, check.IsNil)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+	manifest, err = s.tm.GetManifest(ctx, task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(manifest.Status, check.Equals, types.TaskManifestStatusMISMATCH)
+	c.Check(manifest.Reason, check.Not(check.Equals), "")
+	c.Check(s.tm.manifestStore.pieceMD5(task.ID, 0), check.Equals, "")
+}
+
+func (s *ManifestTestSuite) TestVerifyPiece(c *check.C) {
+	s.tm.manifestStore.put(&types.TaskManifest{
+		TaskID:    "foo",
+		Status:    types.TaskManifestStatusVERIFYING,
+		PieceMD5s: []string{pieceMD5('a', 15), pieceMD5('b', 15)},
+	})
+	s.tm.manifestStore.verifyPiece("foo", 0, pieceMD5('a', 15))
+	c.Check(s.tm.manifestStore.pieceMD5("foo", 1), check.Equals, pieceMD5('b', 15))
+	s.tm.manifestStore.verifyPiece("foo", 1, pieceMD5('c', 15))
+	c.Check(s.tm.manifestStore.pieceMD5("foo", 1), check.Equals, "")
+	manifest, err := s.tm.manifestStore.get("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(manifest.Status, check.Equals, types.TaskManifestStatusMISMATCH)
+}
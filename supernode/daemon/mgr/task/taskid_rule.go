@@ -0,0 +1,58 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"regexp"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+type taskIDRule struct {
+	pattern *regexp.Regexp
+	queries []string
+}
+
+func newTaskIDRules(rules []*config.TaskIDRule) ([]*taskIDRule, error) {
+	var result []*taskIDRule
+	for _, r := range rules {
+		pattern, err := regexp.Compile(r.URLPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid url pattern of taskID rule: %s", r.URLPattern)
+		}
+		result = append(result, &taskIDRule{
+			pattern: pattern,
+			queries: r.Queries,
+		})
+	}
+	return result, nil
+}
+
+// normalizeTaskURL removes the queries specified by the matched taskID rules
+// from the taskURL, so the urls differing only in them share the same task.
+func normalizeTaskURL(rules []*taskIDRule, taskURL string) string {
+	var queries []string
+	for _, r := range rules {
+		if r.pattern.MatchString(taskURL) {
+			queries = append(queries, r.queries...)
+		}
+	}
+	return netutils.FilterURLParam(taskURL, queries)
+}
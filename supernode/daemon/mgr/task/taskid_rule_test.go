@@ -0,0 +1,48 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&TaskIDRuleTestSuite{})
+}
+
+type TaskIDRuleTestSuite struct{}
+
+func (s *TaskIDRuleTestSuite) TestNormalizeTaskURL(c *check.C) {
+	_, err := newTaskIDRules([]*config.TaskIDRule{{URLPattern: "("}})
+	c.Check(err, check.NotNil)
+
+	rules, err := newTaskIDRules([]*config.TaskIDRule{
+		{URLPattern: "^https://s3.example.com/", Queries: []string{"X-Amz-*"}},
+		{URLPattern: "example.com", Queries: []string{"token"}},
+	})
+	c.Assert(err, check.IsNil)
+
+	c.Check(normalizeTaskURL(nil, "https://s3.example.com/a?token=1"), check.Equals,
+		"https://s3.example.com/a?token=1")
+	c.Check(normalizeTaskURL(rules, "https://s3.example.com/a?X-Amz-Date=1&v=2&X-Amz-Signature=3&token=4"),
+		check.Equals, "https://s3.example.com/a?v=2")
+	c.Check(normalizeTaskURL(rules, "https://cdn.example.com/a?X-Amz-Date=1&token=4"), check.Equals,
+		"https://cdn.example.com/a?X-Amz-Date=1")
+	c.Check(normalizeTaskURL(rules, "https://other.com/a?token=4"), check.Equals, "https://other.com/a?token=4")
+}
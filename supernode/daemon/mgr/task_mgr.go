@@ -18,12 +18,52 @@ package mgr
 
 import (
 	"context"
+	"io"
+	"regexp"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
 )
 
+// The sort keys of the tasks listed by TaskMgr.
+const (
+	TaskSortKeyCreateTime = "createTime"
+	TaskSortKeyAccessTime = "accessTime"
+	TaskSortKeySize       = "size"
+	TaskSortKeyURL        = "url"
+)
+
+// TaskSortKeys are the sort keys supported by TaskMgr#List.
+var TaskSortKeys = map[string]bool{
+	TaskSortKeyCreateTime: true,
+	TaskSortKeyAccessTime: true,
+	TaskSortKeySize:       true,
+	TaskSortKeyURL:        true,
+}
+
+// TaskFilter selects the tasks listed by TaskMgr, and the zero values
+// of the fields mean no restriction.
+type TaskFilter struct {
+	util.PageFilter
+
+	// URLPattern matches the TaskURL of the tasks.
+	URLPattern *regexp.Regexp
+
+	// CdnStatus are the accepted CdnStatus of the tasks.
+	CdnStatus []string
+
+	// MinAge and MaxAge bound the time since the tasks are created.
+	MinAge time.Duration
+	MaxAge time.Duration
+
+	// MinSize and MaxSize bound the length of the files of the tasks from the source.
+	MinSize int64
+	MaxSize int64
+}
+
 // PieceStatusMap maintains the mapping relationship between PieceUpdateRequestResult and PieceStatus code.
 var PieceStatusMap = map[string]int{
 	types.PieceUpdateRequestPieceStatusFAILED:  config.PieceFAILED,
@@ -31,6 +71,23 @@ var PieceStatusMap = map[string]int{
 	types.PieceUpdateRequestPieceStatusSUCCESS: config.PieceSUCCESS,
 }
 
+// PieceMD5sQuery selects the piece md5s of a task to return,
+// which keeps the responses small for the tasks of very large files.
+type PieceMD5sQuery struct {
+	// Start is the number of the first piece to return.
+	// It should be a multiple of GroupSize if GroupSize is set.
+	Start int
+
+	// Limit is the max number of the pieces to return.
+	// All the pieces from Start are returned if it's not positive.
+	Limit int
+
+	// GroupSize is the number of the consecutive pieces in a group.
+	// If it's positive, the SHA-1 of the piece md5s of every group is returned
+	// instead of the piece md5s.
+	GroupSize int
+}
+
 // TaskMgr as an interface defines all operations against Task.
 // A Task will store some meta info about the taskFile, pieces and something else.
 // A Task has a one-to-one correspondence with a file on the disk which is identified by taskID.
@@ -46,8 +103,17 @@ type TaskMgr interface {
 	// GetAccessTime gets all task accessTime.
 	GetAccessTime(ctx context.Context) (*syncmap.SyncMap, error)
 
-	// List returns the list tasks with filter.
-	List(ctx context.Context, filter map[string]string) ([]*types.TaskInfo, error)
+	// GetIdleTime returns the time elapsed since the task is accessed last,
+	// which is measured by the logical clock of supernode.
+	GetIdleTime(ctx context.Context, taskID string) (time.Duration, error)
+
+	// Touch updates the access time of the task so that it isn't garbage-collected,
+	// which is used by the keepalives of the peers downloading it.
+	Touch(ctx context.Context, taskID string) error
+
+	// List returns the page of the tasks selected by the filter, and the total
+	// number of the selected tasks. All tasks are returned if filter is nil.
+	List(ctx context.Context, filter *TaskFilter) (tasks []*types.TaskInfo, total int, err error)
 
 	// CheckTaskStatus checks whether the taskID corresponding file exists.
 	CheckTaskStatus(ctx context.Context, taskID string) (bool, error)
@@ -71,4 +137,46 @@ type TaskMgr interface {
 	// We use a sting called pieceRange to identify a piece.
 	// A pieceRange is separated by a dash, like this: 0-45565, etc.
 	UpdatePieceStatus(ctx context.Context, taskID, pieceRange string, pieceUpdateRequest *types.PieceUpdateRequest) error
+
+	// AddSeeder marks that the peer of clientID owns all pieces of the task,
+	// which is used by the peers serving the task file staged in advance.
+	// The pieceMD5s are verified against the ones computed by CDN if CDN has finished.
+	AddSeeder(ctx context.Context, taskID, clientID string, pieceMD5s []string) error
+
+	// GetPieceMD5s gets the md5 of the pieces of the task whose CDN has finished successfully.
+	// The query selects a page of the pieces, and summarizes them by groups if the group size is set.
+	GetPieceMD5s(ctx context.Context, taskID string, query *PieceMD5sQuery) (*types.TaskPieceMD5s, error)
+
+	// ExportBundle exports the task whose CDN has finished successfully as a bundle
+	// for the distribution in the air-gapped environments.
+	ExportBundle(ctx context.Context, taskID string, w io.Writer) error
+
+	// ImportBundle imports the task in the bundle, and then the peers
+	// could download it without accessing the source.
+	ImportBundle(ctx context.Context, r io.Reader) (*types.TaskInfo, error)
+
+	// AddAlias declares the URLs of the alias as the mirrors of the same content,
+	// and the registrations of any URL of them join the same task.
+	// The digest of the alias is verified when the CDN of the task finishes.
+	AddAlias(ctx context.Context, alias *types.TaskAlias) (*types.TaskAlias, error)
+
+	// GetAlias gets the alias with the specified ID.
+	GetAlias(ctx context.Context, id string) (*types.TaskAlias, error)
+
+	// ListAliases returns all the aliases.
+	ListAliases(ctx context.Context) []*types.TaskAlias
+
+	// DeleteAlias deletes the alias with the specified ID.
+	DeleteAlias(ctx context.Context, id string) error
+
+	// AddManifest registers the task of the manifest of the piece md5s computed by the publisher.
+	// The pieces are verified against the manifest until the CDN of the task finishes,
+	// and the task fails if the piece md5s computed by CDN mismatch it.
+	AddManifest(ctx context.Context, manifest *types.TaskManifest) (*types.TaskManifest, error)
+
+	// GetManifest gets the manifest of the task without the piece md5s.
+	GetManifest(ctx context.Context, taskID string) (*types.TaskManifest, error)
+
+	// DeleteManifest deletes the manifest of the task.
+	DeleteManifest(ctx context.Context, taskID string) error
 }
@@ -65,6 +65,21 @@ func (mr *MockOriginHTTPClientMockRecorder) GetContentLength(url, headers interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContentLength", reflect.TypeOf((*MockOriginHTTPClient)(nil).GetContentLength), url, headers)
 }
 
+// GetContentInfo mocks base method
+func (m *MockOriginHTTPClient) GetContentInfo(url string, headers map[string]string) (*httpclient.ContentInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetContentInfo", url, headers)
+	ret0, _ := ret[0].(*httpclient.ContentInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetContentInfo indicates an expected call of GetContentInfo
+func (mr *MockOriginHTTPClientMockRecorder) GetContentInfo(url, headers interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContentInfo", reflect.TypeOf((*MockOriginHTTPClient)(nil).GetContentInfo), url, headers)
+}
+
 // IsSupportRange mocks base method
 func (m *MockOriginHTTPClient) IsSupportRange(url string, headers map[string]string) (bool, error) {
 	m.ctrl.T.Helper()
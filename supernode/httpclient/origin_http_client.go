@@ -17,23 +17,17 @@
 package httpclient
 
 import (
-	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"net"
 	"net/http"
-	netUrl "net/url"
-	"sync"
+	"net/http/cookiejar"
 	"time"
 
-	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
 
 	strfmt "github.com/go-openapi/strfmt"
-	"github.com/pkg/errors"
 )
 
 type StatusCodeChecker func(int) bool
@@ -42,92 +36,114 @@ type StatusCodeChecker func(int) bool
 type OriginHTTPClient interface {
 	RegisterTLSConfig(rawURL string, insecure bool, caBlock []strfmt.Base64)
 	GetContentLength(url string, headers map[string]string) (int64, int, error)
+	GetContentInfo(url string, headers map[string]string) (*ContentInfo, error)
 	IsSupportRange(url string, headers map[string]string) (bool, error)
 	IsExpired(url string, headers map[string]string, lastModified int64, eTag string) (bool, error)
 	Download(url string, headers map[string]string, checkCode StatusCodeChecker) (*http.Response, error)
 }
 
+// ContentInfo is the information of a file got from the response of the source.
+type ContentInfo struct {
+	// Length is the content length of the response, which is -1 if it's unknown.
+	Length     int64
+	StatusCode int
+	Header     http.Header
+}
+
 // OriginClient is an implementation of the interface of OriginHTTPClient.
 type OriginClient struct {
-	clientMap         *sync.Map
-	defaultHTTPClient *http.Client
+	client *httputils.Client
+	logins *originLogins
 }
 
 // NewOriginClient returns a new OriginClient.
 func NewOriginClient() OriginHTTPClient {
-	defaultTransport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   3 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-	httputils.RegisterProtocolOnTransport(defaultTransport)
 	return &OriginClient{
-		clientMap: &sync.Map{},
-		defaultHTTPClient: &http.Client{
-			Transport: defaultTransport,
-		},
+		client: httputils.NewClient(httputils.WithDialTimeout(3 * time.Second)),
 	}
 }
 
-// RegisterTLSConfig saves tls config into map as http client.
-// tlsMap:
-// key->host value->*http.Client
-func (client *OriginClient) RegisterTLSConfig(rawURL string, insecure bool, caBlock []strfmt.Base64) {
-	url, err := netUrl.Parse(rawURL)
-	if err != nil {
-		return
-	}
+// NewOriginClientWithLogins returns a new OriginClient which logs in the origins
+// by the login requests before downloading from them, and keeps the cookies set
+// by the origins in a cookie jar. It's the same as NewOriginClient if logins is empty.
+func NewOriginClientWithLogins(logins []*config.OriginLogin) (OriginHTTPClient, error) {
+	return NewOriginClientWithConfig(logins, nil)
+}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: insecure,
-	}
-	appendSuccess := false
-	roots := x509.NewCertPool()
-	for _, caBytes := range caBlock {
-		appendSuccess = appendSuccess || roots.AppendCertsFromPEM(caBytes)
-	}
-	if appendSuccess {
-		tlsConfig.RootCAs = roots
-	}
+// NewOriginClientWithConfig returns a new OriginClient like NewOriginClientWithLogins,
+// and the origins are requested through the given egress proxies.
+func NewOriginClientWithConfig(logins []*config.OriginLogin, proxies []*config.OriginProxy) (OriginHTTPClient, error) {
+	return NewOriginClientWithStats(logins, proxies, nil)
+}
 
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   3 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig:       tlsConfig,
+// NewOriginClientWithStats returns a new OriginClient like NewOriginClientWithConfig,
+// and the requests sent to the origins are tracked by stats if it's not nil.
+func NewOriginClientWithStats(logins []*config.OriginLogin, proxies []*config.OriginProxy, stats *OriginStats) (OriginHTTPClient, error) {
+	if len(logins) == 0 && len(proxies) == 0 && stats == nil {
+		return NewOriginClient(), nil
+	}
+
+	opts := []httputils.ClientOption{httputils.WithDialTimeout(3 * time.Second)}
+	if stats != nil {
+		opts = append(opts, httputils.WithTransportWrapper(stats.wrap))
+	}
+	var ol *originLogins
+	if len(logins) > 0 {
+		var err error
+		if ol, err = newOriginLogins(logins); err != nil {
+			return nil, err
+		}
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, httputils.WithCookieJar(jar))
+	}
+	if len(proxies) > 0 {
+		op, err := newOriginProxies(proxies)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, httputils.WithProxy(op.proxy))
 	}
+	return &OriginClient{
+		client: httputils.NewClient(opts...),
+		logins: ol,
+	}, nil
+}
 
-	httputils.RegisterProtocolOnTransport(transport)
-
-	client.clientMap.Store(url.Host, &http.Client{
-		Transport: transport,
-	})
+// RegisterTLSConfig saves tls config into a http client of the url's host.
+func (client *OriginClient) RegisterTLSConfig(rawURL string, insecure bool, caBlock []strfmt.Base64) {
+	caBlocks := make([][]byte, 0, len(caBlock))
+	for _, caBytes := range caBlock {
+		caBlocks = append(caBlocks, caBytes)
+	}
+	client.client.RegisterTLSConfigByURL(rawURL, httputils.GetTLSConfig(caBlocks, insecure))
 }
 
 // GetContentLength sends a head request to get file length.
 func (client *OriginClient) GetContentLength(url string, headers map[string]string) (int64, int, error) {
+	info, err := client.GetContentInfo(url, headers)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Length, info.StatusCode, nil
+}
+
+// GetContentInfo sends a request to get the file length and the headers of the response.
+func (client *OriginClient) GetContentInfo(url string, headers map[string]string) (*ContentInfo, error) {
 	// send request
 	resp, err := client.HTTPWithHeaders(http.MethodGet, url, headers, 4*time.Second)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 	resp.Body.Close()
 
-	return resp.ContentLength, resp.StatusCode, nil
+	return &ContentInfo{
+		Length:     resp.ContentLength,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}, nil
 }
 
 // IsSupportRange checks if the source url support partial requests.
@@ -190,33 +206,29 @@ func (client *OriginClient) Download(url string, headers map[string]string, chec
 }
 
 // HTTPWithHeaders uses host-matched client to request the origin resource.
+// If the origin requires to log in, the login is performed before the request,
+// and it's performed again and the request is retried once if the origin responds
+// 401 or 403 which means that the session has expired.
 func (client *OriginClient) HTTPWithHeaders(method, url string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	if timeout > 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		req = req.WithContext(ctx)
-		defer cancel()
+	login := client.logins.get(url)
+	if login == nil {
+		return client.client.Do(method, url, headers, timeout)
 	}
 
-	for k, v := range headers {
-		req.Header.Add(k, v)
+	if err := login.ensure(client.client); err != nil {
+		return nil, err
 	}
-
-	httpClientObject, existed := client.clientMap.Load(req.Host)
-	if !existed {
-		// use client.defaultHTTPClient to support custom protocols
-		httpClientObject = client.defaultHTTPClient
+	resp, err := client.client.Do(method, url, headers, timeout)
+	if err != nil || !isLoginRequired(resp.StatusCode) {
+		return resp, err
 	}
+	resp.Body.Close()
 
-	httpClient, ok := httpClientObject.(*http.Client)
-	if !ok {
-		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "http client type check error: %T", httpClientObject)
+	login.invalidate()
+	if err := login.ensure(client.client); err != nil {
+		return nil, err
 	}
-	return httpClient.Do(req)
+	return client.client.Do(method, url, headers, timeout)
 }
 
 // CopyHeader copies the src to dst and return a non-nil dst map.
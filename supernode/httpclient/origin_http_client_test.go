@@ -20,12 +20,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/go-check/check"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
 )
 
 func init() {
@@ -87,12 +90,8 @@ func (s *OriginHTTPClientTestSuite) TestRegisterTLSConfig(c *check.C) {
 	protocol := "test"
 	httputils.RegisterProtocol(protocol, &testTransport{})
 	s.client.RegisterTLSConfig(protocol+"://test/test", true, nil)
-	httpClientInterface, ok := s.client.clientMap.Load("test")
-	c.Check(ok, check.Equals, true)
-	httpClient, ok := httpClientInterface.(*http.Client)
-	c.Check(ok, check.Equals, true)
 
-	resp, err := httpClient.Get(protocol + "://test/test")
+	resp, err := s.client.HTTPWithHeaders(http.MethodGet, protocol+"://test/test", nil, time.Second)
 	c.Assert(err, check.IsNil)
 	defer resp.Body.Close()
 	c.Assert(resp, check.NotNil)
@@ -111,3 +110,95 @@ func (s *OriginHTTPClientTestSuite) TestCopyHeader(c *check.C) {
 	dst["test"] = "2"
 	c.Check(src["test"], check.Equals, "1")
 }
+
+func (s *OriginHTTPClientTestSuite) TestHTTPWithLogin(c *check.C) {
+	logins := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			body, _ := ioutil.ReadAll(r.Body)
+			if r.Method != http.MethodPost || string(body) != "user=foo" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(logins), Path: "/"})
+			return
+		}
+		// the session set by the first login expires
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value == "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	client, err := NewOriginClientWithLogins([]*config.OriginLogin{{
+		Host: u.Host,
+		URL:  ts.URL + "/login",
+		Body: "user=foo",
+	}})
+	c.Assert(err, check.IsNil)
+
+	resp, err := client.Download(ts.URL+"/file", nil, func(code int) bool { return code == http.StatusOK })
+	c.Assert(err, check.IsNil)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(string(body), check.Equals, "ok")
+	c.Check(logins, check.Equals, 2)
+
+	length, code, err := client.GetContentLength(ts.URL+"/file", nil)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	c.Check(length, check.Equals, int64(2))
+	c.Check(logins, check.Equals, 2)
+
+	info, err := client.GetContentInfo(ts.URL+"/file", nil)
+	c.Check(err, check.IsNil)
+	c.Check(info.Length, check.Equals, int64(2))
+	c.Check(info.Header.Get("Content-Type"), check.Matches, "text/plain.*")
+
+	_, err = NewOriginClientWithLogins([]*config.OriginLogin{{URL: ts.URL + "/login"}})
+	c.Check(err, check.NotNil)
+}
+
+func (s *OriginHTTPClientTestSuite) TestHTTPWithProxy(c *check.C) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := parseProxyAuth(r); !ok || user != "foo" || password != "bar" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.Write([]byte("proxied " + r.URL.Host))
+	}))
+	defer proxy.Close()
+
+	client, err := NewOriginClientWithConfig(nil, []*config.OriginProxy{
+		{HostPattern: `^direct\.example\.com$`, Direct: true},
+		{HostPattern: `\.example\.com$`, URL: proxy.URL, Username: "foo", Password: "bar"},
+	})
+	c.Assert(err, check.IsNil)
+
+	resp, err := client.Download("http://origin.example.com/file", nil, func(code int) bool { return code == http.StatusOK })
+	c.Assert(err, check.IsNil)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(string(body), check.Equals, "proxied origin.example.com")
+
+	op, err := newOriginProxies([]*config.OriginProxy{{HostPattern: `^direct\.example\.com$`, Direct: true}})
+	c.Assert(err, check.IsNil)
+	req, _ := http.NewRequest(http.MethodGet, "http://direct.example.com/file", nil)
+	u, err := op.proxy(req)
+	c.Check(err, check.IsNil)
+	c.Check(u, check.IsNil)
+
+	_, err = NewOriginClientWithConfig(nil, []*config.OriginProxy{{HostPattern: "(", URL: proxy.URL}})
+	c.Check(err, check.NotNil)
+	_, err = NewOriginClientWithConfig(nil, []*config.OriginProxy{{HostPattern: "example"}})
+	c.Check(err, check.NotNil)
+}
+
+func parseProxyAuth(r *http.Request) (string, string, bool) {
+	req := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+	return req.BasicAuth()
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	netUrl "net/url"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loginTimeout is the timeout of a login request.
+const loginTimeout = 10 * time.Second
+
+// originLogins performs the login requests of the origins before the requests
+// to them. The cookies set by the logins are kept by the cookie jar of the client.
+type originLogins struct {
+	// logins stores the states of the logins.
+	// key: host, value: *loginState
+	logins map[string]*loginState
+}
+
+type loginState struct {
+	sync.Mutex
+	login *config.OriginLogin
+	// loggedAt is the time of the last successful login,
+	// it's zero if the login should be performed again.
+	loggedAt time.Time
+}
+
+func newOriginLogins(logins []*config.OriginLogin) (*originLogins, error) {
+	ol := &originLogins{logins: make(map[string]*loginState)}
+	for _, l := range logins {
+		if l == nil {
+			continue
+		}
+		if l.Host == "" {
+			return nil, fmt.Errorf("the host of the origin login to %s is empty", l.URL)
+		}
+		if _, err := netUrl.ParseRequestURI(l.URL); err != nil {
+			return nil, fmt.Errorf("invalid url of the origin login for %s: %v", l.Host, err)
+		}
+		ol.logins[l.Host] = &loginState{login: l}
+	}
+	return ol, nil
+}
+
+// get returns the login state of the origin which the url belongs to,
+// it's nil if the origin doesn't require to log in.
+func (ol *originLogins) get(url string) *loginState {
+	if ol == nil || len(ol.logins) == 0 {
+		return nil
+	}
+	u, err := netUrl.Parse(url)
+	if err != nil {
+		return nil
+	}
+	return ol.logins[u.Host]
+}
+
+// ensure performs the login if it hasn't been performed or it has expired.
+func (ls *loginState) ensure(client *httputils.Client) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	if !ls.loggedAt.IsZero() && (ls.login.TTL <= 0 || time.Since(ls.loggedAt) < ls.login.TTL) {
+		return nil
+	}
+
+	method := ls.login.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	resp, err := client.DoWithBody(method, ls.login.URL, ls.login.Headers, []byte(ls.login.Body), loginTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to log in origin %s: %v", ls.login.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("failed to log in origin %s: unexpected status code: %d", ls.login.Host, resp.StatusCode)
+	}
+
+	logrus.Infof("success to log in origin %s", ls.login.Host)
+	ls.loggedAt = time.Now()
+	return nil
+}
+
+// invalidate marks that the login should be performed again.
+func (ls *loginState) invalidate() {
+	ls.Lock()
+	ls.loggedAt = time.Time{}
+	ls.Unlock()
+}
+
+func isLoginRequired(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	netUrl "net/url"
+	"regexp"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+)
+
+// originProxies selects the egress proxies of the requests to the origins.
+type originProxies struct {
+	proxies []*originProxy
+}
+
+type originProxy struct {
+	hostPattern *regexp.Regexp
+	// url is nil if the origins are requested directly.
+	url *netUrl.URL
+}
+
+func newOriginProxies(proxies []*config.OriginProxy) (*originProxies, error) {
+	op := &originProxies{}
+	for _, p := range proxies {
+		if p == nil {
+			continue
+		}
+		reg, err := regexp.Compile(p.HostPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host pattern of the origin proxy %s: %v", p.HostPattern, err)
+		}
+		proxy := &originProxy{hostPattern: reg}
+		if !p.Direct {
+			u, err := netUrl.Parse(p.URL)
+			if err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid url of the origin proxy for %s: %s", p.HostPattern, p.URL)
+			}
+			if p.Username != "" {
+				u.User = netUrl.UserPassword(p.Username, p.Password)
+			}
+			proxy.url = u
+		}
+		op.proxies = append(op.proxies, proxy)
+	}
+	return op, nil
+}
+
+// proxy returns the proxy of the request, the proxies set by the environment variables
+// are used if the origin matches none of the proxies.
+// The Proxy-Authorization header is set by net/http if the url of the proxy carries the credentials.
+func (op *originProxies) proxy(req *http.Request) (*netUrl.URL, error) {
+	for _, p := range op.proxies {
+		if p.hostPattern.MatchString(req.URL.Host) {
+			return p.url, nil
+		}
+	}
+	return http.ProxyFromEnvironment(req)
+}
@@ -0,0 +1,352 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxOriginHosts is the max number of the origin hosts tracked separately,
+// the requests to the other hosts are tracked as otherOriginHost.
+const maxOriginHosts = 1000
+
+// otherOriginHost is the host which the requests beyond maxOriginHosts are tracked as.
+const otherOriginHost = "other"
+
+// latencyBuckets are the upper bounds of the buckets of the latencies in seconds.
+var latencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// the phases of a request to the origin
+const (
+	phaseDNS     = "dns"
+	phaseConnect = "connect"
+	phaseTTFB    = "ttfb"
+)
+
+// OriginStats tracks the latencies of the phases, the status codes and the bytes
+// of the requests sent to every origin host, which are exposed as the metrics and
+// listed by List, so that the slowness of the origins can be told from the one
+// of the scheduling when the downloads are slow.
+type OriginStats struct {
+	mu    sync.Mutex
+	hosts map[string]*hostStats
+
+	phaseDuration *prometheus.HistogramVec
+	responseCount *prometheus.CounterVec
+	errorCount    *prometheus.CounterVec
+	receivedBytes *prometheus.CounterVec
+}
+
+// NewOriginStats returns a new OriginStats whose metrics are registered to register.
+func NewOriginStats(register prometheus.Registerer) *OriginStats {
+	return &OriginStats{
+		hosts: make(map[string]*hostStats),
+		phaseDuration: metricsutils.NewHistogram(config.SubsystemSupernode, "origin_request_phase_duration_seconds",
+			"Histogram of the latencies of the phases dns, connect and ttfb of the requests to the origins.",
+			[]string{"host", "phase"}, latencyBuckets, register),
+		responseCount: metricsutils.NewCounter(config.SubsystemSupernode, "origin_responses_total",
+			"Total number of the responses from the origins by the status code.", []string{"host", "code"}, register),
+		errorCount: metricsutils.NewCounter(config.SubsystemSupernode, "origin_request_errors_total",
+			"Total number of the requests to the origins failing without any response.", []string{"host"}, register),
+		receivedBytes: metricsutils.NewCounter(config.SubsystemSupernode, "origin_received_bytes_total",
+			"Total bytes of the response bodies received from the origins.", []string{"host"}, register),
+	}
+}
+
+// hostStats is the statistics of an origin host.
+type hostStats struct {
+	requests int64
+	errors   int64
+	bytes    int64
+	codes    map[int]int64
+	phases   map[string]*latencyStats
+}
+
+// latencyStats counts the latencies by latencyBuckets.
+type latencyStats struct {
+	count   int64
+	sum     time.Duration
+	max     time.Duration
+	buckets []int64
+}
+
+func (l *latencyStats) observe(d time.Duration) {
+	l.count++
+	l.sum += d
+	if d > l.max {
+		l.max = d
+	}
+	i := sort.SearchFloat64s(latencyBuckets, d.Seconds())
+	l.buckets[i]++
+}
+
+// percentile returns the upper bound of the bucket which the percentile p falls into,
+// or the max latency if it's beyond the last bucket.
+func (l *latencyStats) percentile(p float64) float64 {
+	rank := int64(p*float64(l.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var n int64
+	for i, c := range l.buckets {
+		if n += c; n < rank {
+			continue
+		}
+		if i < len(latencyBuckets) && latencyBuckets[i] < l.max.Seconds() {
+			return latencyBuckets[i]
+		}
+		break
+	}
+	return l.max.Seconds()
+}
+
+func (l *latencyStats) distribution() *types.LatencyDistribution {
+	if l == nil || l.count == 0 {
+		return nil
+	}
+	return &types.LatencyDistribution{
+		Count: l.count,
+		Max:   l.max.Seconds(),
+		Mean:  (l.sum / time.Duration(l.count)).Seconds(),
+		P50:   l.percentile(.5),
+		P90:   l.percentile(.9),
+		P99:   l.percentile(.99),
+	}
+}
+
+// List returns the statistics of all origin hosts sorted by the host.
+func (s *OriginStats) List() []*types.OriginStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*types.OriginStats, 0, len(s.hosts))
+	for host, h := range s.hosts {
+		stats := &types.OriginStats{
+			Host:     host,
+			Requests: h.requests,
+			Errors:   h.errors,
+			Bytes:    h.bytes,
+			DNS:      h.phases[phaseDNS].distribution(),
+			Connect:  h.phases[phaseConnect].distribution(),
+			Ttfb:     h.phases[phaseTTFB].distribution(),
+		}
+		if len(h.codes) > 0 {
+			stats.StatusCodes = make(map[string]int64, len(h.codes))
+			for code, n := range h.codes {
+				stats.StatusCodes[strconv.Itoa(code)] = n
+			}
+		}
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Host < result[j].Host
+	})
+	return result
+}
+
+// hostLocked returns the statistics of the host, which is otherOriginHost
+// if there are maxOriginHosts hosts tracked already.
+func (s *OriginStats) hostLocked(host string) (string, *hostStats) {
+	h, ok := s.hosts[host]
+	if ok {
+		return host, h
+	}
+	if len(s.hosts) >= maxOriginHosts {
+		host = otherOriginHost
+		if h, ok = s.hosts[host]; ok {
+			return host, h
+		}
+	}
+	h = &hostStats{
+		codes:  make(map[int]int64),
+		phases: make(map[string]*latencyStats),
+	}
+	s.hosts[host] = h
+	return host, h
+}
+
+// record records a request to the host with the latencies of the phases it has gone through,
+// and the status code of the response which is 0 if the request fails.
+func (s *OriginStats) record(host string, phases map[string]time.Duration, code int) string {
+	s.mu.Lock()
+	host, h := s.hostLocked(host)
+	h.requests++
+	if code == 0 {
+		h.errors++
+	} else {
+		h.codes[code]++
+	}
+	for phase, d := range phases {
+		l := h.phases[phase]
+		if l == nil {
+			l = &latencyStats{buckets: make([]int64, len(latencyBuckets)+1)}
+			h.phases[phase] = l
+		}
+		l.observe(d)
+	}
+	s.mu.Unlock()
+
+	for phase, d := range phases {
+		s.phaseDuration.WithLabelValues(host, phase).Observe(d.Seconds())
+	}
+	if code == 0 {
+		s.errorCount.WithLabelValues(host).Inc()
+	} else {
+		s.responseCount.WithLabelValues(host, strconv.Itoa(code)).Inc()
+	}
+	return host
+}
+
+// addBytes adds the bytes of the response body received from the host,
+// which is the one returned by record.
+func (s *OriginStats) addBytes(host string, n int64) {
+	if n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	if h, ok := s.hosts[host]; ok {
+		h.bytes += n
+	}
+	s.mu.Unlock()
+	s.receivedBytes.WithLabelValues(host).Add(float64(n))
+}
+
+// wrap returns the round tripper tracking the requests sent by rt.
+func (s *OriginStats) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &statsRoundTripper{rt: rt, stats: s}
+}
+
+// statsRoundTripper traces the phases of the requests and records them to the stats.
+type statsRoundTripper struct {
+	rt    http.RoundTripper
+	stats *OriginStats
+}
+
+func (t *statsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		mu        sync.Mutex
+		phases    = make(map[string]time.Duration)
+		dnsStart  time.Time
+		connStart time.Time
+	)
+	set := func(phase string, d time.Duration) {
+		mu.Lock()
+		if _, ok := phases[phase]; !ok {
+			phases[phase] = d
+		}
+		mu.Unlock()
+	}
+
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			d := time.Since(dnsStart)
+			mu.Unlock()
+			set(phaseDNS, d)
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			if connStart.IsZero() {
+				connStart = time.Now()
+			}
+			mu.Unlock()
+		},
+		// the first successful connection of the dual-stack dialing is the one used
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			d := time.Since(connStart)
+			mu.Unlock()
+			set(phaseConnect, d)
+		},
+		GotFirstResponseByte: func() {
+			set(phaseTTFB, time.Since(start))
+		},
+	}
+
+	resp, err := t.rt.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	code := 0
+	if err == nil {
+		code = resp.StatusCode
+	}
+	mu.Lock()
+	recorded := make(map[string]time.Duration, len(phases))
+	for phase, d := range phases {
+		recorded[phase] = d
+	}
+	mu.Unlock()
+
+	host := t.stats.record(req.URL.Host, recorded, code)
+	if err == nil && resp.Body != nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, host: host, stats: t.stats}
+	}
+	return resp, err
+}
+
+// countingBody counts the bytes read from the body and adds them to the stats
+// when it's closed or drained.
+type countingBody struct {
+	io.ReadCloser
+	host  string
+	stats *OriginStats
+
+	mu sync.Mutex
+	n  int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.n += int64(n)
+	if err != nil {
+		b.flushLocked()
+	}
+	b.mu.Unlock()
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.mu.Lock()
+	b.flushLocked()
+	b.mu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+func (b *countingBody) flushLocked() {
+	b.stats.addBytes(b.host, b.n)
+	b.n = 0
+}
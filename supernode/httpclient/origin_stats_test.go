@@ -0,0 +1,98 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (s *OriginHTTPClientTestSuite) TestOriginStats(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer ts.Close()
+
+	stats := NewOriginStats(prometheus.NewRegistry())
+	client, err := NewOriginClientWithStats(nil, nil, stats)
+	c.Assert(err, check.IsNil)
+
+	ok := func(code int) bool { return code == http.StatusOK }
+	for i := 0; i < 2; i++ {
+		resp, err := client.Download(ts.URL+"/file", nil, ok)
+		c.Assert(err, check.IsNil)
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	_, err = client.Download(ts.URL+"/missing", nil, ok)
+	c.Assert(err, check.NotNil)
+	_, err = client.Download("http://127.0.0.1:1/file", nil, ok)
+	c.Assert(err, check.NotNil)
+
+	list := stats.List()
+	c.Assert(list, check.HasLen, 2)
+	c.Check(list[0].Host, check.Equals, "127.0.0.1:1")
+	c.Check(list[0].Errors, check.Equals, int64(1))
+	c.Check(list[0].Ttfb, check.IsNil)
+
+	h := list[1]
+	c.Check(h.Host, check.Equals, strings.TrimPrefix(ts.URL, "http://"))
+	c.Check(h.Requests, check.Equals, int64(3))
+	c.Check(h.Errors, check.Equals, int64(0))
+	c.Check(h.Bytes, check.Equals, int64(20))
+	c.Check(h.StatusCodes, check.DeepEquals, map[string]int64{"200": 2, "404": 1})
+	c.Assert(h.Ttfb, check.NotNil)
+	c.Check(h.Ttfb.Count, check.Equals, int64(3))
+	c.Check(h.Ttfb.P99 >= h.Ttfb.P50, check.Equals, true)
+	c.Check(h.Ttfb.Max >= h.Ttfb.P99, check.Equals, true)
+	// the connections are reused by the keep-alive
+	c.Assert(h.Connect, check.NotNil)
+	c.Check(h.Connect.Count < 3, check.Equals, true)
+}
+
+func (s *OriginHTTPClientTestSuite) TestLatencyPercentile(c *check.C) {
+	l := &latencyStats{buckets: make([]int64, len(latencyBuckets)+1)}
+	for i := 0; i < 98; i++ {
+		l.observe(3 * time.Millisecond)
+	}
+	l.observe(200 * time.Millisecond)
+	l.observe(time.Minute)
+
+	d := l.distribution()
+	c.Check(d.Count, check.Equals, int64(100))
+	c.Check(d.P50, check.Equals, .005)
+	c.Check(d.P90, check.Equals, .005)
+	c.Check(d.P99, check.Equals, .25)
+	c.Check(d.Max, check.Equals, 60.0)
+
+	stats := NewOriginStats(prometheus.NewRegistry())
+	for i := 0; i <= maxOriginHosts; i++ {
+		stats.record(strings.Repeat("h", i+1), nil, http.StatusOK)
+	}
+	c.Check(stats.List(), check.HasLen, maxOriginHosts+1)
+	c.Check(stats.record("new", nil, http.StatusOK), check.Equals, otherOriginHost)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metastore
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	opPut    = "put"
+	opDelete = "del"
+
+	// legacyLogSuffix is appended to the path of the store to which the log
+	// of the earlier versions is moved before it's imported.
+	legacyLogSuffix = ".log"
+)
+
+// legacyRecordReg matches the beginning of the records of the log, which
+// never matches the meta page at the beginning of a bolt database.
+var legacyRecordReg = regexp.MustCompile(`^[0-9a-f]{8} `)
+
+// record is an update in the log written by the earlier versions, which is
+// encoded in format of "<crc32 in hex> <json>\n".
+type record struct {
+	Op     string          `json:"op"`
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value,omitempty"`
+}
+
+// isLegacyLog reports whether the file at path is the log of the earlier versions.
+func isLegacyLog(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to open meta store %s", path)
+	}
+	defer f.Close()
+
+	head := make([]byte, 9)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, errors.Wrapf(err, "failed to read meta store %s", path)
+	}
+	return legacyRecordReg.Match(head[:n]), nil
+}
+
+// readLegacyLog replays the log at path and returns the live values by key
+// by bucket. The corrupted records, such as the ones torn by a crash, are
+// skipped, so that the valid records after them are still recovered.
+func readLegacyLog(path string) (map[string]map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open the log of meta store %s", path)
+	}
+	defer f.Close()
+
+	buckets := make(map[string]map[string][]byte)
+	reader := bufio.NewReader(f)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrapf(err, "failed to read the log of meta store %s", path)
+		}
+		if line = strings.TrimSuffix(line, "\n"); line != "" {
+			if r, decodeErr := decodeRecord(line); decodeErr != nil {
+				logrus.Warnf("skip the record at line %d of the log of meta store %s: %v", lineNum, path, decodeErr)
+			} else if r.Op == opDelete {
+				delete(buckets[r.Bucket], r.Key)
+			} else {
+				if buckets[r.Bucket] == nil {
+					buckets[r.Bucket] = make(map[string][]byte)
+				}
+				buckets[r.Bucket][r.Key] = r.Value
+			}
+		}
+		if err == io.EOF {
+			return buckets, nil
+		}
+	}
+}
+
+func decodeRecord(line string) (*record, error) {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid record format")
+	}
+
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil || len(sum) != 4 {
+		return nil, fmt.Errorf("invalid checksum %q", fields[0])
+	}
+	expected := uint32(sum[0])<<24 | uint32(sum[1])<<16 | uint32(sum[2])<<8 | uint32(sum[3])
+	if real := crc32.ChecksumIEEE([]byte(fields[1])); real != expected {
+		return nil, fmt.Errorf("checksum mismatch, expected: %08x, real: %08x", expected, real)
+	}
+
+	r := &record{}
+	if err := json.Unmarshal([]byte(fields[1]), r); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal record")
+	}
+	if r.Op != opPut && r.Op != opDelete {
+		return nil, fmt.Errorf("unknown operation %q", r.Op)
+	}
+	if r.Op == opPut && len(r.Value) == 0 {
+		return nil, fmt.Errorf("empty value of %s/%s", r.Bucket, r.Key)
+	}
+	return r, nil
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metastore provides an embedded key-value store which is used by
+// supernode to persist the metadata of tasks, so that the cached tasks can
+// be recovered after a restart.
+//
+// The records are stored in a bolt database, every update of which is a
+// transaction committed to disk before returning, so an interrupted update
+// never leaves a torn record behind. The append-only log written by the
+// earlier versions is imported into the database when the store is opened.
+package metastore
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// BucketTask is the bucket to store the TaskInfo of tasks by taskID.
+	BucketTask = "task"
+
+	// BucketPieceMD5 is the bucket to store the piece md5 manifests of tasks by taskID.
+	BucketPieceMD5 = "pieceMD5"
+)
+
+// openTimeout is how long Open waits for the lock of the database file
+// held by another process.
+const openTimeout = 10 * time.Second
+
+// Store is an embedded key-value store whose records are grouped by bucket.
+// It's safe for concurrent use.
+type Store struct {
+	path string
+	db   *bolt.DB
+}
+
+// Open opens the store located at path and recovers the records from it.
+// The file and its parent directories are created if they do not exist.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create the directory of meta store %s", path)
+	}
+
+	legacy, err := isLegacyLog(path)
+	if err != nil {
+		return nil, err
+	}
+	logPath := path + legacyLogSuffix
+	if legacy {
+		if err := os.Rename(path, logPath); err != nil {
+			return nil, errors.Wrapf(err, "failed to move the log of meta store %s", path)
+		}
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open meta store %s", path)
+	}
+	s := &Store{path: path, db: db}
+
+	// the log moved aside is imported, and it's removed only once the import
+	// is committed, so it's imported again if supernode exits in the middle.
+	if err := s.importLegacyLog(logPath); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put stores the value encoded as JSON with the key in the bucket.
+func (s *Store) Put(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal value of %s/%s", bucket, key)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	return errors.Wrapf(err, "failed to put %s/%s into meta store %s", bucket, key, s.path)
+}
+
+// Get decodes the value of the key in the bucket into value.
+// It returns errortypes.ErrDataNotFound if the key does not exist.
+func (s *Store) Get(bucket, key string, value interface{}) error {
+	var data []byte
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bucket)); b != nil {
+			// the value is only valid in the transaction
+			data = append(data, b.Get([]byte(key))...)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "failed to get %s/%s from meta store %s", bucket, key, s.path)
+	}
+
+	if len(data) == 0 {
+		return errors.Wrapf(errortypes.ErrDataNotFound, "key %s/%s", bucket, key)
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Delete removes the key from the bucket.
+// It's not an error if the key does not exist.
+func (s *Store) Delete(bucket, key string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+	return errors.Wrapf(err, "failed to delete %s/%s from meta store %s", bucket, key, s.path)
+}
+
+// ForEach calls fn for every key in the bucket in lexical order.
+// The iteration stops when fn returns an error and the error is returned.
+//
+// fn is called out of the transaction, so that it can update the store.
+func (s *Store) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	var keys []string
+	var values [][]byte
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			values = append(values, append([]byte(nil), v...))
+			return nil
+		})
+	}); err != nil {
+		return errors.Wrapf(err, "failed to iterate over bucket %s of meta store %s", bucket, s.path)
+	}
+
+	for i, k := range keys {
+		if err := fn(k, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// importLegacyLog imports the records of the log at logPath into the store
+// in a transaction, and then removes the log. It's a no-op if there's no log.
+func (s *Store) importLegacyLog(logPath string) error {
+	buckets, err := readLegacyLog(logPath)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	records := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		for bucket, kvs := range buckets {
+			b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+			for k, v := range kvs {
+				if err := b.Put([]byte(k), v); err != nil {
+					return err
+				}
+				records++
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "failed to import the log of meta store %s", s.path)
+	}
+
+	if err := os.Remove(logPath); err != nil {
+		return errors.Wrapf(err, "failed to remove the imported log of meta store %s", s.path)
+	}
+	logrus.Infof("success to import %d records from the log of meta store %s", records, s.path)
+	return nil
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type StoreTestSuite struct {
+	workHome string
+}
+
+func init() {
+	check.Suite(&StoreTestSuite{})
+}
+
+func (s *StoreTestSuite) SetUpTest(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "supernode-metastore-StoreTestSuite-")
+}
+
+func (s *StoreTestSuite) TearDownTest(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+type testValue struct {
+	Name  string
+	Count int
+}
+
+func (s *StoreTestSuite) TestPutGetDelete(c *check.C) {
+	store, err := Open(filepath.Join(s.workHome, "meta", "test.db"))
+	c.Assert(err, check.IsNil)
+	defer store.Close()
+
+	c.Assert(store.Put(BucketTask, "a", &testValue{Name: "a", Count: 1}), check.IsNil)
+	c.Assert(store.Put(BucketTask, "b", &testValue{Name: "b", Count: 2}), check.IsNil)
+	c.Assert(store.Put(BucketPieceMD5, "a", []string{"md5"}), check.IsNil)
+
+	v := &testValue{}
+	c.Assert(store.Get(BucketTask, "a", v), check.IsNil)
+	c.Check(v, check.DeepEquals, &testValue{Name: "a", Count: 1})
+
+	var keys []string
+	err = store.ForEach(BucketTask, func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(keys, check.DeepEquals, []string{"a", "b"})
+
+	c.Assert(store.Delete(BucketTask, "a"), check.IsNil)
+	c.Assert(store.Delete(BucketTask, "not-exist"), check.IsNil)
+	err = store.Get(BucketTask, "a", v)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *StoreTestSuite) TestRecover(c *check.C) {
+	path := filepath.Join(s.workHome, "test.db")
+	store, err := Open(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(store.Put(BucketTask, "a", &testValue{Name: "a", Count: 1}), check.IsNil)
+	c.Assert(store.Put(BucketTask, "a", &testValue{Name: "a", Count: 2}), check.IsNil)
+	c.Assert(store.Put(BucketTask, "b", &testValue{Name: "b"}), check.IsNil)
+	c.Assert(store.Delete(BucketTask, "b"), check.IsNil)
+	c.Assert(store.Close(), check.IsNil)
+
+	store, err = Open(path)
+	c.Assert(err, check.IsNil)
+	defer store.Close()
+
+	v := &testValue{}
+	c.Assert(store.Get(BucketTask, "a", v), check.IsNil)
+	c.Check(v.Count, check.Equals, 2)
+	c.Check(errortypes.IsDataNotFound(store.Get(BucketTask, "b", v)), check.Equals, true)
+	c.Check(errortypes.IsDataNotFound(store.Get(BucketPieceMD5, "a", v)), check.Equals, true)
+}
+
+// encodeRecord encodes the record like the log of the earlier versions.
+func encodeRecord(r *record) string {
+	data, _ := json.Marshal(r)
+	return fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data)
+}
+
+func (s *StoreTestSuite) TestImportLegacyLog(c *check.C) {
+	path := filepath.Join(s.workHome, "test.db")
+	corrupted := strings.Replace(encodeRecord(&record{Op: opPut, Bucket: BucketTask, Key: "b", Value: []byte(`{"Name":"b"}`)}),
+		`"b"`, `"x"`, 1)
+	torn := encodeRecord(&record{Op: opPut, Bucket: BucketTask, Key: "c", Value: []byte(`{"Name":"c"}`)})
+	log := encodeRecord(&record{Op: opPut, Bucket: BucketTask, Key: "a", Value: []byte(`{"Name":"a","Count":1}`)}) +
+		corrupted +
+		// a torn record followed by the next one appended on the same line
+		torn[:len(torn)-5] +
+		encodeRecord(&record{Op: opPut, Bucket: BucketTask, Key: "d", Value: []byte(`{"Name":"d"}`)}) +
+		encodeRecord(&record{Op: opPut, Bucket: BucketTask, Key: "a", Value: []byte(`{"Name":"a","Count":2}`)}) +
+		encodeRecord(&record{Op: opPut, Bucket: BucketPieceMD5, Key: "e", Value: []byte(`["md5"]`)}) +
+		encodeRecord(&record{Op: opDelete, Bucket: BucketPieceMD5, Key: "e"})
+	c.Assert(ioutil.WriteFile(path, []byte(log), 0644), check.IsNil)
+
+	store, err := Open(path)
+	c.Assert(err, check.IsNil)
+	v := &testValue{}
+	c.Assert(store.Get(BucketTask, "a", v), check.IsNil)
+	c.Check(v.Count, check.Equals, 2, check.Commentf("the records after the bad ones are recovered"))
+	for _, key := range []string{"b", "c", "d", "x"} {
+		c.Check(errortypes.IsDataNotFound(store.Get(BucketTask, key, v)), check.Equals, true, check.Commentf("key %s", key))
+	}
+	c.Check(errortypes.IsDataNotFound(store.Get(BucketPieceMD5, "e", &[]string{})), check.Equals, true)
+	c.Assert(store.Close(), check.IsNil)
+
+	// the log is removed once it's imported
+	_, err = os.Stat(path + legacyLogSuffix)
+	c.Check(os.IsNotExist(err), check.Equals, true)
+	store, err = Open(path)
+	c.Assert(err, check.IsNil)
+	defer store.Close()
+	c.Check(store.Get(BucketTask, "a", v), check.IsNil)
+}
+
+func (s *StoreTestSuite) TestImportInterruptedLegacyLog(c *check.C) {
+	path := filepath.Join(s.workHome, "test.db")
+	store, err := Open(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(store.Put(BucketTask, "a", &testValue{Name: "a"}), check.IsNil)
+	c.Assert(store.Close(), check.IsNil)
+
+	// the log moved aside by an interrupted import is imported again
+	log := encodeRecord(&record{Op: opPut, Bucket: BucketTask, Key: "b", Value: []byte(`{"Name":"b"}`)})
+	c.Assert(ioutil.WriteFile(path+legacyLogSuffix, []byte(log), 0644), check.IsNil)
+	store, err = Open(path)
+	c.Assert(err, check.IsNil)
+	defer store.Close()
+	c.Check(store.Get(BucketTask, "a", &testValue{}), check.IsNil)
+	c.Check(store.Get(BucketTask, "b", &testValue{}), check.IsNil)
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/gorilla/schema"
@@ -29,9 +30,12 @@ import (
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/rangeutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 )
 
 // RegisterResponseData is the data when registering supernode successfully.
@@ -46,20 +50,37 @@ type RegisterResponseData struct {
 
 	// in seed pattern, if as seed, SeedTaskID is the taskID of seed file.
 	SeedTaskID string `json:"seedTaskID"`
+
+	// ServerTime is the unix time in milliseconds of supernode when responding,
+	// by which the client estimates the offset of its clock from supernode.
+	ServerTime int64 `json:"serverTime,omitempty"`
+
+	// ResponseHeaders are the headers of the response of the source kept with the task,
+	// which are replayed by dfdaemon on the responses served from the P2P network.
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
 }
 
 // PullPieceTaskResponseContinueData is the data when successfully pulling piece task
 // and the task is continuing.
 type PullPieceTaskResponseContinueData struct {
-	Range     string `json:"range"`
-	PieceNum  int    `json:"pieceNum"`
-	PieceSize int32  `json:"pieceSize"`
-	PieceMd5  string `json:"pieceMd5"`
-	Cid       string `json:"cid"`
-	PeerIP    string `json:"peerIp"`
-	PeerPort  int    `json:"peerPort"`
-	Path      string `json:"path"`
-	DownLink  int    `json:"downLink"`
+	Range     string   `json:"range"`
+	PieceNum  int      `json:"pieceNum"`
+	PieceSize int32    `json:"pieceSize"`
+	PieceMd5  string   `json:"pieceMd5"`
+	Cid       string   `json:"cid"`
+	PeerIP    string   `json:"peerIp"`
+	PeerAddrs []string `json:"peerAddrs,omitempty"`
+	PeerPort  int      `json:"peerPort"`
+	// PeerTransports are the names of the piece transports served by the uploader of the peer.
+	PeerTransports []string `json:"peerTransports,omitempty"`
+	Path           string   `json:"path"`
+	DownLink       int      `json:"downLink"`
+	// BoostLink is the download rate limit in KB/s of the bandwidth boost granted to the task,
+	// which lifts the local limits of dfget. It's 0 if the task isn't boosted.
+	BoostLink int `json:"boostLink,omitempty"`
+	// EdgeURLs are the URLs of the file in the edge caches,
+	// which dfget fetches the piece from before the peer.
+	EdgeURLs []string `json:"edgeURLs,omitempty"`
 }
 
 var statusMap = map[string]string{
@@ -100,12 +121,20 @@ func (s *Server) registry(ctx context.Context, rw http.ResponseWriter, req *http
 	if err := request.Validate(strfmt.NewFormats()); err != nil {
 		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
 	}
+	if err := authorizeNode(ctx, request.IP.String()); err != nil {
+		return err
+	}
+	s.checkClockSkew(request)
 
 	peerCreateRequest := &types.PeerCreateRequest{
-		IP:       request.IP,
-		HostName: strfmt.Hostname(request.HostName),
-		Port:     request.Port,
-		Version:  request.Version,
+		IP:         request.IP,
+		Addresses:  request.Addresses,
+		HostName:   strfmt.Hostname(request.HostName),
+		Labels:     request.Labels,
+		Port:       request.Port,
+		Version:    request.Version,
+		Transports: request.Transports,
+		AcceptPush: request.AcceptPush,
 	}
 	peerCreateResponse, err := s.PeerMgr.Register(ctx, peerCreateRequest)
 	if err != nil {
@@ -116,25 +145,44 @@ func (s *Server) registry(ctx context.Context, rw http.ResponseWriter, req *http
 
 	peerID := peerCreateResponse.ID
 	taskCreateRequest := &types.TaskCreateRequest{
-		CID:         request.CID,
-		CallSystem:  request.CallSystem,
-		Dfdaemon:    request.Dfdaemon,
-		Headers:     netutils.ConvertHeaders(request.Headers),
-		Identifier:  request.Identifier,
-		Md5:         request.Md5,
-		Path:        request.Path,
-		PeerID:      peerID,
-		RawURL:      request.RawURL,
-		TaskURL:     request.TaskURL,
-		SupernodeIP: request.SuperNodeIP,
+		CID:           request.CID,
+		CallSystem:    request.CallSystem,
+		Dfdaemon:      request.Dfdaemon,
+		Filter:        request.Filter,
+		Group:         request.Group,
+		GroupDeadline: request.GroupDeadline,
+		Headers:       netutils.ConvertHeaders(request.Headers),
+		Identifier:    request.Identifier,
+		Md5:           request.Md5,
+		Digest:        request.Digest,
+		Path:          request.Path,
+		PeerID:        peerID,
+		PieceSize:     request.PieceSize,
+		Priority:      request.Priority,
+		RangeLength:   request.RangeLength,
+		RangeOffset:   request.RangeOffset,
+		RawURL:        request.RawURL,
+		TaskURL:       request.TaskURL,
+		SupernodeIP:   request.SuperNodeIP,
+	}
+	// take the trace headers of the HTTP request if there is none in the task headers,
+	// which are passed to the origin as well.
+	if httputils.ExtractTraceHeaders(taskCreateRequest.Headers) == nil {
+		taskCreateRequest.Headers = httputils.ReplaceTraceHeaders(taskCreateRequest.Headers,
+			httputils.ExtractHTTPTraceHeaders(req.Header))
+	}
+	if trace := httputils.FormatTraceHeaders(taskCreateRequest.Headers); trace != "" {
+		logrus.Infof("register task of url %s for peer %s with trace headers: %s", request.RawURL, peerID, trace)
 	}
 	s.originClient.RegisterTLSConfig(taskCreateRequest.RawURL, request.Insecure, request.RootCAs)
 	resp, err := s.TaskMgr.Register(ctx, taskCreateRequest)
 	if err != nil {
-		logrus.Errorf("failed to register task %+v: %v", taskCreateRequest, err)
+		logrus.Errorf("failed to register task %+v: %v", mgr.RedactTaskCreateRequest(taskCreateRequest), err)
 		return err
 	}
-	logrus.Debugf("success to register task %+v", taskCreateRequest)
+	logrus.Debugf("success to register task %+v", mgr.RedactTaskCreateRequest(taskCreateRequest))
+	s.DeadlineMgr.Track(ctx, resp.ID, request.CID)
+	s.GroupMgr.Join(ctx, request.Group, resp.ID, request.CID, request.GroupDeadline)
 	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
 		Code: constants.Success,
 		Msg:  constants.GetMsgByCode(constants.Success),
@@ -143,14 +191,39 @@ func (s *Server) registry(ctx context.Context, rw http.ResponseWriter, req *http
 			FileLength: resp.FileLength,
 			PieceSize:  resp.PieceSize,
 			CDNSource:  string(resp.CdnSource),
+			ServerTime: timeutils.GetCurrentTimeMillis(),
+
+			ResponseHeaders: resp.ResponseHeaders,
 		},
 	})
 }
 
+// checkClockSkew warns if the clock of the peer is skewed from supernode by more than
+// ClockSkewTolerance, which is detected by the time when the client sends the request.
+// The timeouts of supernode are measured by its monotonic clock only, and the client
+// compensates its offset when interpreting the deadlines from supernode, so the skew
+// doesn't expire the downloads spuriously. But it still confuses the logs and the
+// TTLs of the files cached by the peer.
+func (s *Server) checkClockSkew(request *types.TaskRegisterRequest) {
+	if request.ClientTime <= 0 || s.Config.ClockSkewTolerance <= 0 {
+		return
+	}
+
+	skew := timeutils.MillisToTime(request.ClientTime).Sub(time.Now())
+	if skew <= s.Config.ClockSkewTolerance && skew >= -s.Config.ClockSkewTolerance {
+		return
+	}
+	m.clockSkewedRegistrations.WithLabelValues().Inc()
+	logrus.Warnf("the clock of peer %s(%s) is skewed by %v from supernode", request.HostName, request.IP, skew)
+}
+
 func (s *Server) pullPieceTask(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
 	params := req.URL.Query()
 	taskID := params.Get("taskId")
 	srcCID := params.Get("srcCid")
+	if err := s.authorizeClient(ctx, srcCID, taskID); err != nil {
+		return err
+	}
 
 	request := &types.PiecePullRequest{
 		DfgetTaskStatus: statusMap[params.Get("status")],
@@ -170,7 +243,26 @@ func (s *Server) pullPieceTask(ctx context.Context, rw http.ResponseWriter, req
 		}
 	}
 
-	isFinished, data, err := s.TaskMgr.GetPieces(ctx, taskID, srcCID, request)
+	if request.PieceResult == types.PiecePullRequestPieceResultFAILED {
+		s.AnomalyMgr.ObservePiece(ctx, taskID, s.peerLabels(ctx, srcCID, taskID), false)
+	}
+
+	var (
+		isFinished bool
+		data       interface{}
+	)
+	dispatchErr := s.dispatcher.dispatch(ctx, taskID, s.dispatchPriority(ctx, srcCID, taskID), func() {
+		isFinished, data, err = s.TaskMgr.GetPieces(ctx, taskID, srcCID, request)
+	})
+	if dispatchErr == errDispatchOverloaded {
+		return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
+			Code: constants.CodePeerWait,
+			Msg:  dispatchErr.Error(),
+		})
+	}
+	if dispatchErr != nil {
+		return dispatchErr
+	}
 	if err != nil {
 		if errortypes.IsCDNFail(err) {
 			logrus.Errorf("taskID:%s, failed to get pieces %+v: %v", taskID, request, err)
@@ -191,6 +283,9 @@ func (s *Server) pullPieceTask(ctx context.Context, rw http.ResponseWriter, req
 	}
 
 	var datas []*PullPieceTaskResponseContinueData
+	downLink := s.brakeDownLink(ctx, srcCID, taskID)
+	boostLink := s.boostLink(ctx, taskID)
+	edgeURLs := s.edgeURLs(ctx, taskID)
 	pieceInfos, ok := data.([]*types.PieceInfo)
 	if !ok {
 		return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
@@ -205,14 +300,19 @@ func (s *Server) pullPieceTask(ctx context.Context, rw http.ResponseWriter, req
 			continue
 		}
 		datas = append(datas, &PullPieceTaskResponseContinueData{
-			Range:     v.PieceRange,
-			PieceNum:  rangeutils.CalculatePieceNum(v.PieceRange),
-			PieceSize: v.PieceSize,
-			PieceMd5:  v.PieceMD5,
-			Cid:       cid,
-			PeerIP:    v.PeerIP,
-			PeerPort:  int(v.PeerPort),
-			Path:      v.Path,
+			Range:          v.PieceRange,
+			PieceNum:       rangeutils.CalculatePieceNum(v.PieceRange),
+			PieceSize:      v.PieceSize,
+			PieceMd5:       v.PieceMD5,
+			Cid:            cid,
+			PeerIP:         v.PeerIP,
+			PeerAddrs:      v.PeerAddresses,
+			PeerPort:       int(v.PeerPort),
+			PeerTransports: v.PeerTransports,
+			Path:           v.Path,
+			DownLink:       downLink,
+			BoostLink:      boostLink,
+			EdgeURLs:       edgeURLs,
 		})
 	}
 	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
@@ -227,7 +327,59 @@ func (s *Server) reportPiece(ctx context.Context, rw http.ResponseWriter, req *h
 	srcCID := params.Get("cid")
 	dstCID := params.Get("dstCid")
 	pieceRange := params.Get("pieceRange")
+	if err := s.authorizeClient(ctx, srcCID, taskID); err != nil {
+		return err
+	}
+
+	if err := s.updatePieceSuccess(ctx, taskID, srcCID, dstCID, pieceRange); err != nil {
+		return err
+	}
+	m.pieceReportBatchSize.WithLabelValues().Observe(1)
+
+	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
+		Code: constants.CodeGetPieceReport,
+	})
+}
 
+// reportPieces handles the pieces reported in a batch in the same way as reportPiece,
+// and the error of the first failed piece is returned after all of them are handled.
+func (s *Server) reportPieces(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	request := &types.PieceSuccessRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+	if stringutils.IsEmptyStr(request.TaskID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+	if stringutils.IsEmptyStr(request.CID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "cID")
+	}
+	if err := s.authorizeClient(ctx, request.CID, request.TaskID); err != nil {
+		return err
+	}
+
+	m.pieceReportBatchSize.WithLabelValues().Observe(float64(len(request.Pieces)))
+	var firstErr error
+	for _, piece := range request.Pieces {
+		if piece == nil {
+			continue
+		}
+		err := s.updatePieceSuccess(ctx, request.TaskID, request.CID, piece.DstCID, piece.PieceRange)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
+		Code: constants.CodeGetPieceReport,
+	})
+}
+
+// updatePieceSuccess marks the piece of srcCID downloaded from dstCID successfully.
+func (s *Server) updatePieceSuccess(ctx context.Context, taskID, srcCID, dstCID, pieceRange string) error {
 	dstDfgetTask, err := s.DfgetTaskMgr.Get(ctx, dstCID, taskID)
 	if err != nil {
 		return err
@@ -248,16 +400,18 @@ func (s *Server) reportPiece(ctx context.Context, rw http.ResponseWriter, req *h
 		logrus.Errorf("failed to update pieces status %+v: %v", request, err)
 		return err
 	}
-
-	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
-		Code: constants.CodeGetPieceReport,
-	})
+	s.AnomalyMgr.ObservePiece(ctx, taskID, s.peerLabels(ctx, srcCID, taskID), true)
+	s.DeadlineMgr.Progress(ctx, taskID, srcCID)
+	return nil
 }
 
 func (s *Server) reportServiceDown(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
 	params := req.URL.Query()
 	taskID := params.Get("taskId")
 	cID := params.Get("cid")
+	if err := s.authorizeClient(ctx, cID, taskID); err != nil {
+		return err
+	}
 
 	// get peerID according to the CID and taskID
 	dfgetTask, err := s.DfgetTaskMgr.Get(ctx, cID, taskID)
@@ -285,6 +439,9 @@ func (s *Server) reportPieceError(ctx context.Context, rw http.ResponseWriter, r
 	realMd5 := params.Get("realMd5")
 	expectedMd5 := params.Get("expectedMd5")
 	errorType := params.Get("errorType")
+	if err := s.authorizeClient(ctx, srcCid, taskID); err != nil {
+		return err
+	}
 
 	// get peerID according to the CID and taskID
 	dstDfgetTask, err := s.DfgetTaskMgr.Get(ctx, dstCid, taskID)
@@ -320,5 +477,153 @@ func (s *Server) fetchP2PNetworkInfo(ctx context.Context, rw http.ResponseWriter
 }
 
 func (s *Server) reportPeerHealth(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
-	return EncodeResponse(rw, http.StatusOK, &types.HeartBeatResponse{})
+	reader := req.Body
+	request := &types.HeartBeatRequest{}
+	if err := json.NewDecoder(reader).Decode(request); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+
+	if err := request.Validate(strfmt.NewFormats()); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+	if err := authorizeNode(ctx, request.IP.String()); err != nil {
+		return err
+	}
+
+	resp, err := s.PeerMgr.Heartbeat(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	// tell the peer to delete the files of the purged tasks, which it reports
+	// by the next heart beat.
+	resp.PurgeTaskIds = s.PurgeMgr.TakePurges(ctx, request.IP.String(), request.Port,
+		request.TaskIds, request.PurgedTaskIds)
+	purging := make(map[string]bool, len(resp.PurgeTaskIds))
+	for _, taskID := range resp.PurgeTaskIds {
+		purging[taskID] = true
+	}
+
+	// tell the peer to stop seeding the tasks which have been deleted from supernode,
+	// because no one will schedule to download them from the peer.
+	uploaded := make(map[string]int64, len(request.TaskUploadedBytes))
+	for taskID, bytes := range request.TaskUploadedBytes {
+		uploaded[taskID] = bytes
+	}
+	for _, taskID := range request.TaskIds {
+		if purging[taskID] {
+			delete(uploaded, taskID)
+			continue
+		}
+		if _, err := s.TaskMgr.Get(ctx, taskID); errortypes.IsDataNotFound(err) {
+			resp.StopSeedingTaskIds = append(resp.StopSeedingTaskIds, taskID)
+			// the statistics of the deleted task should not be created again
+			delete(uploaded, taskID)
+		}
+	}
+	s.ContributionMgr.ReportUploaded(ctx, request.IP.String(), uploaded)
+	resp.ReplicateTasks = s.ReplicationMgr.TakeAssignments(ctx, request.IP.String(), request.Port)
+	resp.PushTasks = s.PushMgr.TakePushes(ctx, request.IP.String(), request.Port)
+	return EncodeResponse(rw, http.StatusOK, resp)
+}
+
+func (s *Server) reportSeed(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	reader := req.Body
+	request := &types.PeerSeedRequest{}
+	if err := json.NewDecoder(reader).Decode(request); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+
+	if stringutils.IsEmptyStr(request.TaskID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+	if stringutils.IsEmptyStr(request.CID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "cID")
+	}
+	if err := s.authorizeClient(ctx, request.CID, request.TaskID); err != nil {
+		return err
+	}
+
+	if err := s.TaskMgr.AddSeeder(ctx, request.TaskID, request.CID, request.PieceMD5s); err != nil {
+		logrus.Errorf("failed to add seeder cID(%s) for taskID(%s): %v", request.CID, request.TaskID, err)
+		return err
+	}
+	logrus.Infof("success to add seeder cID(%s) for taskID(%s)", request.CID, request.TaskID)
+	// the seeder downloads nothing, so its progress is never checked.
+	s.DeadlineMgr.Untrack(ctx, request.CID)
+
+	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
+		Code: constants.Success,
+		Msg:  constants.GetMsgByCode(constants.Success),
+	})
+}
+
+// keepalive refreshes the access time of the task downloaded by the dfget task,
+// so that it isn't garbage-collected while the download is in progress.
+// The response tells the client to register again if either of them has been
+// garbage-collected already.
+func (s *Server) keepalive(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	request := &types.PeerKeepaliveRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+	if stringutils.IsEmptyStr(request.TaskID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+	if stringutils.IsEmptyStr(request.CID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "cID")
+	}
+
+	resp := &types.PeerKeepaliveResponse{
+		ExpireAfter: int64(s.Config.TaskExpireTime / time.Second),
+	}
+	if _, err := s.DfgetTaskMgr.Get(ctx, request.CID, request.TaskID); err != nil {
+		if !errortypes.IsDataNotFound(err) {
+			return err
+		}
+		logrus.Warnf("keepalive of cID(%s) for taskID(%s): the dfget task is not registered",
+			request.CID, request.TaskID)
+		return EncodeResponse(rw, http.StatusOK, resp)
+	}
+	if err := s.authorizeClient(ctx, request.CID, request.TaskID); err != nil {
+		return err
+	}
+	if err := s.TaskMgr.Touch(ctx, request.TaskID); err != nil {
+		if !errortypes.IsDataNotFound(err) {
+			return err
+		}
+		logrus.Warnf("keepalive of cID(%s) for taskID(%s): the task is not registered",
+			request.CID, request.TaskID)
+		return EncodeResponse(rw, http.StatusOK, resp)
+	}
+	resp.Registered = true
+	return EncodeResponse(rw, http.StatusOK, resp)
+}
+
+// extendProgress grants or rejects an extension of the progress deadline of the dfget task,
+// which is requested periodically by the client making progress slowly.
+func (s *Server) extendProgress(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	request := &types.ProgressExtensionRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+	if stringutils.IsEmptyStr(request.TaskID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+	if stringutils.IsEmptyStr(request.CID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "cID")
+	}
+	if err := s.authorizeClient(ctx, request.CID, request.TaskID); err != nil {
+		return err
+	}
+
+	resp, err := s.DeadlineMgr.Extend(ctx, request.TaskID, request.CID, request.CompletedBytes)
+	if err != nil {
+		return err
+	}
+	if !resp.Granted {
+		logrus.Warnf("reject the progress extension of cID(%s) for taskID(%s): %s",
+			request.CID, request.TaskID, resp.Reason)
+	}
+	return EncodeResponse(rw, http.StatusOK, resp)
 }
@@ -0,0 +1,54 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// listAlerts returns the latest alerts on the abnormal back-source rate and
+// piece failure rate, the latest first. The max number of the returned alerts
+// can be specified by the query parameter limit.
+func (s *Server) listAlerts(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	limit := 0
+	if v := req.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "limit: %s", v)
+		}
+	}
+	return EncodeResponse(rw, http.StatusOK, s.AnomalyMgr.ListAlerts(ctx, limit))
+}
+
+// peerLabels returns the labels of the peer which runs the dfget task of cid,
+// and nil if the peer is not found.
+func (s *Server) peerLabels(ctx context.Context, cid, taskID string) map[string]string {
+	dfgetTask, err := s.DfgetTaskMgr.Get(ctx, cid, taskID)
+	if err != nil {
+		return nil
+	}
+	peerInfo, err := s.PeerMgr.Get(ctx, dfgetTask.PeerID)
+	if err != nil {
+		return nil
+	}
+	return peerInfo.Labels
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// minCompressSize is the min size of the JSON response to be compressed,
+// the smaller ones are sent as they are since compressing them saves little.
+const minCompressSize = 1024
+
+// compressWriter compresses the JSON response with gzip if the client accepts it.
+// The response is only compressed when its first write is large enough,
+// so the header is delayed until then.
+type compressWriter struct {
+	http.ResponseWriter
+
+	acceptGzip bool
+	code       int
+	decided    bool
+	gz         *gzip.Writer
+}
+
+func newCompressWriter(w http.ResponseWriter, req *http.Request) *compressWriter {
+	return &compressWriter{
+		ResponseWriter: w,
+		acceptGzip:     strings.Contains(req.Header.Get("Accept-Encoding"), "gzip"),
+		code:           http.StatusOK,
+	}
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided {
+		return
+	}
+	cw.code = code
+	// nothing will be written for these responses
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(0)
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.decide(len(b))
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(0)
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the header if nothing has been written, and flushes the compressed data.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		cw.decide(0)
+	}
+	if cw.gz != nil {
+		return cw.gz.Close()
+	}
+	return nil
+}
+
+// decide decides whether to compress the response by the size of its first write,
+// and then writes the header.
+func (cw *compressWriter) decide(size int) {
+	cw.decided = true
+	header := cw.Header()
+	if cw.acceptGzip && size >= minCompressSize &&
+		header.Get("Content-Encoding") == "" &&
+		strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		cw.gz = gzip.NewWriter(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+}
@@ -68,25 +68,29 @@ func SendResponse(w http.ResponseWriter, code int, data interface{}) error {
 
 // HandleErrorResponse handles err from server side and constructs response
 // for client side.
+// The status code and the reason of the response are decided by the error code
+// defined in package errortypes, and it returns code 500 for unknown errors.
 func HandleErrorResponse(w http.ResponseWriter, err error) error {
 	switch e := err.(type) {
 	case *errortypes.HTTPError:
-		return SendResponse(w, e.Code, errResp(e.Code, e.Msg))
+		return SendResponse(w, e.Code, errResp(e.Code, e.Msg, err))
 	default:
-		// By default, server side returns code 500 if error happens.
-		return SendResponse(w, http.StatusInternalServerError,
-			errResp(http.StatusInternalServerError, e.Error()))
+		code := errortypes.HTTPStatus(err)
+		return SendResponse(w, code, errResp(code, e.Error(), err))
 	}
 }
 
 // WrapHandler converts the 'api.HandlerFunc' into type 'http.HandlerFunc' and
 // format the error response if any error happens.
+// The large JSON responses are compressed with gzip if the client accepts it.
 func WrapHandler(handler HandlerFunc) http.HandlerFunc {
 	pCtx := context.Background()
 
-	return func(w http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
 		ctx, cancel := context.WithCancel(pCtx)
 		defer cancel()
+		w := newCompressWriter(rw, req)
+		defer w.Close()
 
 		// Start to handle request.
 		start := time.Now()
@@ -97,16 +101,18 @@ func WrapHandler(handler HandlerFunc) http.HandlerFunc {
 				logrus.Errorf("%s %v remote:%s cost:%v handleError:%v sendError:%v",
 					req.Method, req.URL, req.RemoteAddr, time.Since(start), err, sendErr)
 			}
+			// the requests are recorded by the access log, only the error is logged here
+			logrus.Debugf("%s %v remote:%s err:%v", req.Method, req.URL, req.RemoteAddr, err)
 		}
-		logrus.Debugf("%s %v remote:%s cost:%v err:%v", req.Method, req.URL,
-			req.RemoteAddr, time.Since(start), err)
 	}
 }
 
-func errResp(code int, msg string) *types.ErrorResponse {
+func errResp(code int, msg string, err error) *types.ErrorResponse {
 	return &types.ErrorResponse{
-		Code:    int64(code),
-		Message: msg,
+		Code:      int64(code),
+		Message:   msg,
+		Reason:    errortypes.Reason(err),
+		Retryable: errortypes.IsRetryable(err),
 	}
 }
 
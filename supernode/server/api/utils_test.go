@@ -18,14 +18,18 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
@@ -121,11 +125,19 @@ func (s *TestUtilSuite) TestHandleErrorResponse() {
 	}{
 		{
 			errortypes.NewHTTPError(400, "user"),
-			400, "{\"code\":400,\"message\":\"user\"}\n",
+			400, "{\"code\":400,\"message\":\"user\",\"reason\":\"BadRequest\"}\n",
+		},
+		{
+			errortypes.NewHTTPError(503, "busy"),
+			503, "{\"code\":503,\"message\":\"busy\",\"reason\":\"ServiceUnavailable\",\"retryable\":true}\n",
 		},
 		{
 			fmt.Errorf("hello"),
-			500, "{\"code\":500,\"message\":\"hello\"}\n",
+			500, "{\"code\":500,\"message\":\"hello\",\"reason\":\"Unknown\"}\n",
+		},
+		{
+			errors.Wrap(errortypes.ErrDataNotFound, "task"),
+			404, "{\"code\":404,\"message\":\"task: {\\\"Code\\\":0,\\\"Msg\\\":\\\"data not found\\\"}\",\"reason\":\"DataNotFound\"}\n",
 		},
 	}
 	for i, c := range cases {
@@ -137,6 +149,37 @@ func (s *TestUtilSuite) TestHandleErrorResponse() {
 	}
 }
 
+// TestHandleErrorResponseLegacy checks the responses read by the old clients, which only
+// decode the code and the message of the body. The code is the same as the status code,
+// and the errors without an error code are still answered with 500.
+func (s *TestUtilSuite) TestHandleErrorResponseLegacy() {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("hello"), http.StatusInternalServerError},
+		{errors.Wrap(errortypes.ErrNotInitialized, "cdn"), http.StatusInternalServerError},
+		{errors.Wrap(errortypes.ErrShortWrite, "piece"), http.StatusInternalServerError},
+		{errors.Wrap(errortypes.ErrDataNotFound, "task"), http.StatusNotFound},
+		{errors.Wrap(errortypes.ErrInvalidValue, "cid"), http.StatusBadRequest},
+		{errors.Wrap(errortypes.ErrUnavailable, "peer"), http.StatusServiceUnavailable},
+	}
+	for i, c := range cases {
+		msg := fmt.Sprintf("case %d: %v", i, c)
+		w := httptest.NewRecorder()
+		HandleErrorResponse(w, c.err)
+		s.Equal(c.code, w.Code, msg)
+
+		legacy := struct {
+			Code    int64  `json:"code"`
+			Message string `json:"message"`
+		}{}
+		s.Nil(json.NewDecoder(w.Body).Decode(&legacy), msg)
+		s.Equal(int64(c.code), legacy.Code, msg)
+		s.Equal(c.err.Error(), legacy.Message, msg)
+	}
+}
+
 func (s *TestUtilSuite) TestWrapHandler() {
 	var tf HandlerFunc = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 		switch req.Method {
@@ -157,11 +200,11 @@ func (s *TestUtilSuite) TestWrapHandler() {
 	}{
 		{
 			"GET",
-			500, "{\"code\":500,\"message\":\"test\"}\n",
+			500, "{\"code\":500,\"message\":\"test\",\"reason\":\"Unknown\"}\n",
 		},
 		{
 			"POST",
-			400, "{\"code\":400,\"message\":\"test\"}\n",
+			400, "{\"code\":400,\"message\":\"test\",\"reason\":\"BadRequest\"}\n",
 		},
 		{
 			"PUT",
@@ -180,6 +223,42 @@ func (s *TestUtilSuite) TestWrapHandler() {
 	}
 }
 
+func (s *TestUtilSuite) TestWrapHandlerCompress() {
+	large := strings.Repeat("a", minCompressSize)
+	h := WrapHandler(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		if req.Method == "GET" {
+			return SendResponse(rw, 200, large)
+		}
+		return SendResponse(rw, 200, "test")
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http:", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	h(w, r)
+	s.Equal(200, w.Code)
+	s.Equal("gzip", w.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(w.Body)
+	s.Nil(err)
+	body, err := ioutil.ReadAll(gz)
+	s.Nil(err)
+	s.Equal("\""+large+"\"\n", string(body))
+
+	// the small response isn't compressed
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "http:", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	h(w, r)
+	s.Equal("", w.Header().Get("Content-Encoding"))
+	s.Equal("\"test\"\n", w.Body.String())
+
+	// the client doesn't accept gzip
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "http:", nil))
+	s.Equal("", w.Header().Get("Content-Encoding"))
+	s.Equal("\""+large+"\"\n", w.Body.String())
+}
+
 // -----------------------------------------------------------------------------
 // testing helpers
 
@@ -0,0 +1,77 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/server/api"
+
+	"github.com/gorilla/mux"
+)
+
+// setTaskBoost grants the temporary bandwidth boost to the task in the path.
+func (s *Server) setTaskBoost(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.TaskBoost{}
+	if err := api.ParseJSONRequest(req.Body, request, request.Validate); err != nil {
+		return err
+	}
+	taskID := mux.Vars(req)["id"]
+	if _, err := s.TaskMgr.Get(ctx, taskID); err != nil {
+		return err
+	}
+	boost, err := s.SchedulerMgr.SetBoost(ctx, taskID, request)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, boost)
+}
+
+func (s *Server) getTaskBoost(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	boost, err := s.SchedulerMgr.GetBoost(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, boost)
+}
+
+func (s *Server) deleteTaskBoost(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	if err := s.SchedulerMgr.DeleteBoost(ctx, mux.Vars(req)["id"]); err != nil {
+		return err
+	}
+	rw.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) listBoosts(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, s.SchedulerMgr.ListBoosts(ctx))
+}
+
+// boostLink returns the download rate limit in KB/s of the bandwidth boost granted to the task,
+// and it's 0 if the task isn't boosted.
+func (s *Server) boostLink(ctx context.Context, taskID string) int {
+	boost, err := s.SchedulerMgr.GetBoost(ctx, taskID)
+	if err != nil {
+		return 0
+	}
+	if boostLink := int(boost.RateLimit / 1024); boostLink > 0 {
+		return boostLink
+	}
+	return 1
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/server/api"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) getBrake(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, s.SchedulerMgr.GetBrake(ctx))
+}
+
+// setBrake engages or lifts the global emergency brake of the P2P traffic.
+func (s *Server) setBrake(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.EmergencyBrake{}
+	if err := api.ParseJSONRequest(req.Body, request, request.Validate); err != nil {
+		return err
+	}
+	request.Name = ""
+	brake, err := s.SchedulerMgr.SetBrake(ctx, request)
+	if err != nil {
+		return err
+	}
+	m.updateBrake(brake)
+	return EncodeResponse(rw, http.StatusOK, brake)
+}
+
+func (s *Server) listBrakes(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, s.SchedulerMgr.ListBrakes(ctx))
+}
+
+// setScopedBrake engages or lifts the scoped emergency brake of the name in the path.
+func (s *Server) setScopedBrake(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.EmergencyBrake{}
+	if err := api.ParseJSONRequest(req.Body, request, request.Validate); err != nil {
+		return err
+	}
+	request.Name = mux.Vars(req)["name"]
+	brake, err := s.SchedulerMgr.SetBrake(ctx, request)
+	if err != nil {
+		return err
+	}
+	m.updateScopedBrakes(s.SchedulerMgr.ListBrakes(ctx))
+	return EncodeResponse(rw, http.StatusOK, brake)
+}
+
+func (s *Server) deleteBrake(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	if err := s.SchedulerMgr.DeleteBrake(ctx, mux.Vars(req)["name"]); err != nil {
+		return err
+	}
+	m.updateScopedBrakes(s.SchedulerMgr.ListBrakes(ctx))
+	rw.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// brakeDownLink returns the download rate limit in KB/s of the peer which pulls the
+// piece tasks, and it's 0 if no brake throttles the traffic of the peer.
+func (s *Server) brakeDownLink(ctx context.Context, srcCID, taskID string) int {
+	var peerID string
+	if dfgetTask, err := s.DfgetTaskMgr.Get(ctx, srcCID, taskID); err == nil {
+		peerID = dfgetTask.PeerID
+	}
+	brake := s.SchedulerMgr.GetPeerBrake(ctx, peerID)
+	if brake.Mode != types.EmergencyBrakeModeThrottle {
+		return 0
+	}
+	if downLink := int(brake.RateLimit / 1024); downLink > 0 {
+		return downLink
+	}
+	return 1
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// listContributions returns the contribution statistics of all nodes.
+// Only the free-riders are returned if the query parameter freeRider is true.
+func (s *Server) listContributions(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	freeRiderOnly := false
+	if v := req.URL.Query().Get("freeRider"); v != "" {
+		if freeRiderOnly, err = strconv.ParseBool(v); err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "freeRider: %s", v)
+		}
+	}
+
+	contributions := s.ContributionMgr.List(ctx)
+	if freeRiderOnly {
+		freeRiders := make([]*types.NodeContribution, 0)
+		for _, c := range contributions {
+			if c.FreeRider {
+				freeRiders = append(freeRiders, c)
+			}
+		}
+		contributions = freeRiders
+	}
+	return EncodeResponse(rw, http.StatusOK, contributions)
+}
+
+func (s *Server) getContribution(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	ip := mux.Vars(req)["ip"]
+
+	contribution, err := s.ContributionMgr.Get(ctx, ip)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, contribution)
+}
+
+// getUsage returns the usage summaries of the period specified by the query parameter
+// period(default: daily), the latest first. Only the latest ones are returned if
+// the query parameter limit is positive.
+func (s *Server) getUsage(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	period := req.URL.Query().Get("period")
+	if period == "" {
+		period = types.UsageSummaryPeriodDaily
+	}
+	limit := 0
+	if v := req.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "limit: %s", v)
+		}
+	}
+
+	summaries, err := s.AnalyticsMgr.GetSummaries(ctx, period)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+	return EncodeResponse(rw, http.StatusOK, summaries)
+}
+
+// listBackSourceCauses returns the causes of the downloads backing to the source per task
+// and per peer label, the most frequent first. Only the groups of the kind specified by
+// the query parameter group(task or label) are returned if it's set, and only the first ones
+// are returned if the query parameter limit is positive.
+func (s *Server) listBackSourceCauses(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	limit := 0
+	if v := req.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "limit: %s", v)
+		}
+	}
+
+	causes, err := s.AnalyticsMgr.ListBackSourceCauses(ctx, req.URL.Query().Get("group"))
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(causes) > limit {
+		causes = causes[:limit]
+	}
+	return EncodeResponse(rw, http.StatusOK, causes)
+}
+
+// getSavings returns the bytes fetched from the source against the ones delivered
+// to the nodes. Only the task is returned in tasks if the query parameter taskID is set.
+func (s *Server) getSavings(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	savings := s.ContributionMgr.GetSavings(ctx)
+	if taskID := req.URL.Query().Get("taskID"); taskID != "" {
+		tasks := make([]*types.TaskBandwidthSavings, 0, 1)
+		for _, t := range savings.Tasks {
+			if t.TaskID == taskID {
+				tasks = append(tasks, t)
+			}
+		}
+		savings.Tasks = tasks
+	}
+	return EncodeResponse(rw, http.StatusOK, savings)
+}
+
+// listOriginStats returns the statistics of the requests sent to every origin host,
+// such as the latencies of the phases and the status codes of the responses.
+func (s *Server) listOriginStats(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	stats := []*types.OriginStats{}
+	if s.originStats != nil {
+		stats = s.originStats.List()
+	}
+	return EncodeResponse(rw, http.StatusOK, stats)
+}
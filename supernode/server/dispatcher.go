@@ -0,0 +1,310 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+// errDispatchOverloaded is returned by the dispatcher if its queue is full.
+var errDispatchOverloaded = errors.New("piece dispatch queue is full")
+
+const (
+	jobQueued int32 = iota
+	jobRunning
+	jobCanceled
+	jobShed
+)
+
+// dispatchJob is a pull of piece tasks waiting in the queue of the dispatcher.
+type dispatchJob struct {
+	fn       func()
+	state    int32
+	enqueued time.Time
+	done     chan struct{}
+}
+
+// taskQueue is the queue of the pulls of a task waiting for the dispatch workers.
+type taskQueue struct {
+	taskID string
+	weight int
+	// credit is the number of the pulls which can still be dispatched
+	// in the current turn of the task.
+	credit int
+	jobs   []*dispatchJob
+}
+
+// pieceDispatcher dispatches the piece tasks on a fixed pool of workers decoupled from
+// the goroutines handling the HTTP requests, so the number of the peers pulling piece tasks
+// at the same time doesn't multiply the contention on the tasks and the scheduling.
+//
+// The pulls are queued by task and the tasks take turns in a weighted round robin,
+// in which a task dispatches as many pulls as its weight in every turn. So a task with
+// thousands of peers can't starve the pulls of the small tasks behind it.
+// The pulls beyond the bounded queue are shed rather than piling up, and the newest pull
+// of the task queuing the most pulls is shed first.
+type pieceDispatcher struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queueSize int
+	weights   map[types.Priority]int
+
+	// idle is the number of the workers waiting for a pull.
+	idle   int
+	queued int
+	queues map[string]*taskQueue
+	// turns are the tasks having pulls queued in the order of their turns.
+	turns []*taskQueue
+}
+
+// newPieceDispatcher starts the workers of a dispatcher.
+// It returns nil if workers is not positive, which runs the jobs in the callers.
+// The weights of the tasks are looked up by the priorities of the pulls, and are 1 by default.
+func newPieceDispatcher(workers, queueSize int, weights map[string]int) (*pieceDispatcher, error) {
+	if workers <= 0 {
+		return nil, nil
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	d := &pieceDispatcher{
+		queueSize: queueSize,
+		weights:   make(map[types.Priority]int),
+		queues:    make(map[string]*taskQueue),
+	}
+	for priority, weight := range weights {
+		switch types.Priority(priority) {
+		case types.PriorityHigh, types.PriorityNormal, types.PriorityLow:
+		default:
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "dispatch weight priority: %s", priority)
+		}
+		if weight <= 0 {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "dispatch weight of %s: %d", priority, weight)
+		}
+		d.weights[types.Priority(priority)] = weight
+	}
+	d.cond = sync.NewCond(&d.mu)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d, nil
+}
+
+func (d *pieceDispatcher) work() {
+	for {
+		job := d.next()
+		m.dispatchWaitDuration.WithLabelValues().Observe(time.Since(job.enqueued).Seconds())
+		job.fn()
+		close(job.done)
+	}
+}
+
+// next waits for the next pull in the turn of the tasks and marks it running.
+func (d *pieceDispatcher) next() *dispatchJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.idle++
+	for d.queued == 0 {
+		d.cond.Wait()
+	}
+	d.idle--
+
+	q := d.turns[0]
+	job := q.jobs[0]
+	q.jobs[0] = nil
+	q.jobs = q.jobs[1:]
+	q.credit--
+	d.queued--
+	if len(q.jobs) == 0 {
+		d.removeTurn(0)
+	} else if q.credit <= 0 {
+		q.credit = q.weight
+		d.turns = append(d.turns[1:], q)
+	}
+	job.state = jobRunning
+	m.dispatchQueueLength.WithLabelValues().Set(float64(d.queued))
+	return job
+}
+
+// dispatch runs fn on a worker and waits for it to finish.
+// It returns errDispatchOverloaded if the queue is full, or the error of ctx if ctx is done
+// before a worker picks fn up, and fn is never run in both cases.
+// Once fn is running, dispatch always waits for it.
+func (d *pieceDispatcher) dispatch(ctx context.Context, taskID string, priority types.Priority, fn func()) error {
+	if d == nil {
+		fn()
+		return nil
+	}
+
+	job := &dispatchJob{
+		fn:       fn,
+		enqueued: time.Now(),
+		done:     make(chan struct{}),
+	}
+	if !d.enqueue(taskID, priority, job) {
+		m.dispatchShedCount.WithLabelValues().Inc()
+		return errDispatchOverloaded
+	}
+
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		if d.cancel(taskID, job) {
+			return ctx.Err()
+		}
+		<-job.done
+	}
+	if job.state == jobShed {
+		return errDispatchOverloaded
+	}
+	return nil
+}
+
+// enqueue queues the job of the task. If the queue is full, the job is queued only if another
+// task queues more pulls than the task, whose newest pull is shed to make room for the job.
+func (d *pieceDispatcher) enqueue(taskID string, priority types.Priority, job *dispatchJob) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	q := d.queues[taskID]
+	if d.queued >= d.queueSize+d.idle {
+		queued := 0
+		if q != nil {
+			queued = len(q.jobs)
+		}
+		longest := d.longest()
+		if longest == nil || queued+1 >= len(longest.jobs) {
+			return false
+		}
+		d.shed(longest)
+	}
+
+	weight := d.weight(priority)
+	if q == nil {
+		q = &taskQueue{taskID: taskID, weight: weight, credit: weight}
+		d.queues[taskID] = q
+		d.turns = append(d.turns, q)
+	} else if weight > q.weight {
+		q.credit += weight - q.weight
+		q.weight = weight
+	}
+	q.jobs = append(q.jobs, job)
+	d.queued++
+	m.dispatchQueueLength.WithLabelValues().Set(float64(d.queued))
+	d.cond.Signal()
+	return true
+}
+
+// cancel removes the job of the task from the queue.
+// It returns false if the job isn't queued any more.
+func (d *pieceDispatcher) cancel(taskID string, job *dispatchJob) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if job.state != jobQueued {
+		return false
+	}
+	job.state = jobCanceled
+	q := d.queues[taskID]
+	for i, j := range q.jobs {
+		if j == job {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			break
+		}
+	}
+	d.queued--
+	if len(q.jobs) == 0 {
+		for i, t := range d.turns {
+			if t == q {
+				d.removeTurn(i)
+				break
+			}
+		}
+	}
+	m.dispatchQueueLength.WithLabelValues().Set(float64(d.queued))
+	return true
+}
+
+// shed drops the newest job of the queue, whose caller is told the queue is full.
+func (d *pieceDispatcher) shed(q *taskQueue) {
+	job := q.jobs[len(q.jobs)-1]
+	q.jobs = q.jobs[:len(q.jobs)-1]
+	d.queued--
+	job.state = jobShed
+	close(job.done)
+	m.dispatchShedCount.WithLabelValues().Inc()
+}
+
+func (d *pieceDispatcher) longest() *taskQueue {
+	var longest *taskQueue
+	for _, q := range d.turns {
+		if longest == nil || len(q.jobs) > len(longest.jobs) {
+			longest = q
+		}
+	}
+	return longest
+}
+
+func (d *pieceDispatcher) removeTurn(i int) {
+	delete(d.queues, d.turns[i].taskID)
+	d.turns = append(d.turns[:i], d.turns[i+1:]...)
+}
+
+func (d *pieceDispatcher) weight(priority types.Priority) int {
+	if weight, ok := d.weights[priority]; ok {
+		return weight
+	}
+	return 1
+}
+
+// queuedOf returns the number of the pulls of the task waiting in the queue.
+func (d *pieceDispatcher) queuedOf(taskID string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if q := d.queues[taskID]; q != nil {
+		return len(q.jobs)
+	}
+	return 0
+}
+
+// dispatchPriority returns the priority of the dfget task of cid, by which the weight
+// of the task in the dispatcher is looked up, and normal if the dfget task is not found.
+func (s *Server) dispatchPriority(ctx context.Context, cid, taskID string) types.Priority {
+	if s.dispatcher == nil {
+		return types.PriorityNormal
+	}
+	dfgetTask, err := s.DfgetTaskMgr.Get(ctx, cid, taskID)
+	if err != nil {
+		return types.PriorityNormal
+	}
+	if priority := mgr.SchedulePriority(dfgetTask, s.Config.GroupUrgentWindow, time.Now()); priority != "" {
+		return priority
+	}
+	return types.PriorityNormal
+}
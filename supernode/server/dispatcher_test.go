@@ -0,0 +1,185 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&DispatcherTestSuite{})
+}
+
+type DispatcherTestSuite struct{}
+
+func (s *DispatcherTestSuite) TestDispatchInline(c *check.C) {
+	d, err := newPieceDispatcher(0, 10, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(d, check.IsNil)
+
+	ran := false
+	c.Check(d.dispatch(context.Background(), "foo", types.PriorityNormal, func() { ran = true }), check.IsNil)
+	c.Check(ran, check.Equals, true)
+}
+
+func (s *DispatcherTestSuite) TestDispatchShed(c *check.C) {
+	d, err := newPieceDispatcher(1, 1, nil)
+	c.Assert(err, check.IsNil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	busy := make(chan error)
+	go func() {
+		busy <- d.dispatch(context.Background(), "foo", types.PriorityNormal, func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	// the only worker is busy, so the next job waits in the queue
+	// and the one after it is shed.
+	var ran int32
+	queued := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		queued <- d.dispatch(ctx, "foo", types.PriorityNormal, func() { atomic.AddInt32(&ran, 1) })
+	}()
+	for d.queuedOf("foo") == 0 {
+		runtime.Gosched()
+	}
+	c.Check(d.dispatch(context.Background(), "foo", types.PriorityNormal, func() { atomic.AddInt32(&ran, 1) }),
+		check.Equals, errDispatchOverloaded)
+
+	// the queued job is canceled before a worker picks it up, so it never runs.
+	cancel()
+	c.Check(<-queued, check.Equals, context.Canceled)
+	close(release)
+	c.Check(<-busy, check.IsNil)
+
+	c.Check(d.dispatch(context.Background(), "foo", types.PriorityNormal, func() { atomic.AddInt32(&ran, 1) }), check.IsNil)
+	c.Check(atomic.LoadInt32(&ran), check.Equals, int32(1))
+}
+
+func (s *DispatcherTestSuite) TestInvalidWeights(c *check.C) {
+	_, err := newPieceDispatcher(1, 1, map[string]int{"urgent": 1})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+	_, err = newPieceDispatcher(1, 1, map[string]int{"high": 0})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+// blockDispatcher occupies the only worker of d until the returned func is called.
+func blockDispatcher(c *check.C, d *pieceDispatcher) func() {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	busy := make(chan error)
+	go func() {
+		busy <- d.dispatch(context.Background(), "busy", types.PriorityNormal, func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+	return func() {
+		close(release)
+		c.Check(<-busy, check.IsNil)
+	}
+}
+
+func (s *DispatcherTestSuite) TestDispatchFairness(c *check.C) {
+	d, err := newPieceDispatcher(1, 100, map[string]int{"high": 2})
+	c.Assert(err, check.IsNil)
+	release := blockDispatcher(c, d)
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	queue := func(taskID string, priority types.Priority, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Check(d.dispatch(context.Background(), taskID, priority, func() {
+					mu.Lock()
+					defer mu.Unlock()
+					order = append(order, taskID)
+				}), check.IsNil)
+			}()
+		}
+		for d.queuedOf(taskID) < n {
+			runtime.Gosched()
+		}
+	}
+	// the huge task queues its pulls first, but the small ones are dispatched
+	// in their turns rather than behind all of them.
+	queue("huge", types.PriorityNormal, 6)
+	queue("small", types.PriorityNormal, 1)
+	queue("interactive", types.PriorityHigh, 3)
+	release()
+	wg.Wait()
+
+	c.Check(order, check.DeepEquals, []string{
+		"huge", "small", "interactive", "interactive",
+		"huge", "interactive", "huge", "huge", "huge", "huge",
+	})
+}
+
+func (s *DispatcherTestSuite) TestShedLongest(c *check.C) {
+	d, err := newPieceDispatcher(1, 3, nil)
+	c.Assert(err, check.IsNil)
+	release := blockDispatcher(c, d)
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			results <- d.dispatch(context.Background(), "huge", types.PriorityNormal, func() {})
+		}()
+		for d.queuedOf("huge") < i+1 {
+			runtime.Gosched()
+		}
+	}
+
+	// the queue is full, and the newest pull of the huge task is shed for the small one.
+	small := make(chan error)
+	go func() {
+		small <- d.dispatch(context.Background(), "small", types.PriorityNormal, func() {})
+	}()
+	c.Check(<-results, check.Equals, errDispatchOverloaded)
+	for d.queuedOf("small") == 0 {
+		runtime.Gosched()
+	}
+	c.Check(d.queuedOf("huge"), check.Equals, 2)
+
+	// but the task queuing the most pulls can't shed the others.
+	c.Check(d.dispatch(context.Background(), "huge", types.PriorityNormal, func() {}),
+		check.Equals, errDispatchOverloaded)
+
+	release()
+	c.Check(<-small, check.IsNil)
+	c.Check(<-results, check.IsNil)
+	c.Check(<-results, check.IsNil)
+}
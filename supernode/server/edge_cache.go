@@ -0,0 +1,93 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+// edgeCaches maps the URLs of the tasks to the URLs of the files in the external caches,
+// which are advertised to dfget as the alternative sources of the pieces.
+type edgeCaches struct {
+	rules []*edgeCacheRule
+}
+
+type edgeCacheRule struct {
+	pattern *regexp.Regexp
+	urls    []string
+}
+
+// newEdgeCaches returns nil if no edge cache is configured.
+func newEdgeCaches(caches []*config.EdgeCache) (*edgeCaches, error) {
+	ec := &edgeCaches{}
+	for _, c := range caches {
+		if c == nil {
+			continue
+		}
+		pattern, err := regexp.Compile(c.URLPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid url pattern of edge cache: %s", c.URLPattern)
+		}
+		ec.rules = append(ec.rules, &edgeCacheRule{
+			pattern: pattern,
+			urls:    c.URLs,
+		})
+	}
+	if len(ec.rules) == 0 {
+		return nil, nil
+	}
+	return ec, nil
+}
+
+// urls returns the URLs of the file of url in the edge caches by the first matched rule.
+func (ec *edgeCaches) urls(url string) []string {
+	if ec == nil {
+		return nil
+	}
+	for _, r := range ec.rules {
+		loc := r.pattern.FindStringSubmatchIndex(url)
+		if loc == nil {
+			continue
+		}
+		var urls []string
+		for _, u := range r.urls {
+			edge := url[:loc[0]] + string(r.pattern.ExpandString(nil, u, url, loc)) + url[loc[1]:]
+			if edge != url {
+				urls = append(urls, edge)
+			}
+		}
+		return urls
+	}
+	return nil
+}
+
+// edgeURLs returns the URLs of the file of the task in the edge caches.
+func (s *Server) edgeURLs(ctx context.Context, taskID string) []string {
+	if s.edgeCaches == nil {
+		return nil
+	}
+	task, err := s.TaskMgr.Get(ctx, taskID)
+	if err != nil {
+		return nil
+	}
+	return s.edgeCaches.urls(task.RawURL)
+}
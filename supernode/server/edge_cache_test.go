@@ -0,0 +1,56 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&EdgeCacheTestSuite{})
+}
+
+type EdgeCacheTestSuite struct{}
+
+func (s *EdgeCacheTestSuite) TestEdgeCaches(c *check.C) {
+	ec, err := newEdgeCaches(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(ec, check.IsNil)
+	c.Check(ec.urls("http://a.com/foo"), check.IsNil)
+
+	_, err = newEdgeCaches([]*config.EdgeCache{{URLPattern: "("}})
+	c.Check(err, check.NotNil)
+
+	ec, err = newEdgeCaches([]*config.EdgeCache{
+		{
+			URLPattern: `^https?://registry\.com/(.*)$`,
+			URLs:       []string{"http://edge1.com/${1}", "http://edge2.com/${1}"},
+		},
+		{
+			URLPattern: "a.com",
+			URLs:       []string{"a.com", "b.com"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(ec.urls("https://registry.com/foo/bar"), check.DeepEquals,
+		[]string{"http://edge1.com/foo/bar", "http://edge2.com/foo/bar"})
+	// the URL itself isn't advertised as an edge cache
+	c.Check(ec.urls("http://a.com/foo"), check.DeepEquals, []string{"http://b.com/foo"})
+	c.Check(ec.urls("http://c.com/foo"), check.IsNil)
+}
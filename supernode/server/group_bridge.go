@@ -0,0 +1,34 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// getTaskGroup returns the downloads of the task group in the path,
+// which tells whether they've all finished.
+func (s *Server) getTaskGroup(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	info, err := s.GroupMgr.Get(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, info)
+}
@@ -21,11 +21,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/pkg/errors"
@@ -47,11 +49,28 @@ type metrics struct {
 	dfgetDownloadCount     *prometheus.CounterVec
 	dfgetDownloadFailCount *prometheus.CounterVec
 
+	// the downloads by the strategy of the scheduler, to compare the canary strategy with the other one
+	strategyDownloadDuration *prometheus.HistogramVec
+	strategyDownloadCount    *prometheus.CounterVec
+
 	pieceDownloadedBytes *prometheus.CounterVec
+	pieceReportBatchSize *prometheus.HistogramVec
+
+	clockSkewedRegistrations *prometheus.CounterVec
+
+	// piece dispatch metrics
+	dispatchQueueLength  *prometheus.GaugeVec
+	dispatchWaitDuration *prometheus.HistogramVec
+	dispatchShedCount    *prometheus.CounterVec
+
+	// emergency brake metrics
+	brakeMode      *prometheus.GaugeVec
+	brakeRateLimit *prometheus.GaugeVec
+	brakesScoped   *prometheus.GaugeVec
 }
 
 func newMetrics(register prometheus.Registerer) *metrics {
-	return &metrics{
+	m := &metrics{
 		requestCounter: metricsutils.NewCounter(config.SubsystemSupernode, "http_requests_total",
 			"Counter of HTTP requests.", []string{"code", "handler"}, register,
 		),
@@ -70,6 +89,23 @@ func newMetrics(register prometheus.Registerer) *metrics {
 		pieceDownloadedBytes: metricsutils.NewCounter(config.SubsystemSupernode, "pieces_downloaded_size_bytes_total",
 			"total file size of pieces downloaded from supernode in bytes", []string{}, register,
 		),
+		pieceReportBatchSize: metricsutils.NewHistogram(config.SubsystemSupernode, "pieces_reported_batch_size",
+			"Histogram of the number of pieces reported by dfget in a request.", []string{},
+			prometheus.ExponentialBuckets(1, 2, 8), register,
+		),
+		clockSkewedRegistrations: metricsutils.NewCounter(config.SubsystemSupernode, "clock_skewed_registrations_total",
+			"Total number of the registrations whose peers' clocks are skewed beyond the tolerance.", []string{}, register,
+		),
+		dispatchQueueLength: metricsutils.NewGauge(config.SubsystemSupernode, "dispatch_queue_length",
+			"The number of the pulls of piece tasks waiting for the dispatch workers.", []string{}, register,
+		),
+		dispatchWaitDuration: metricsutils.NewHistogram(config.SubsystemSupernode, "dispatch_wait_seconds",
+			"Histogram of the time that the pulls of piece tasks wait for the dispatch workers.", []string{},
+			prometheus.ExponentialBuckets(0.001, 4, 8), register,
+		),
+		dispatchShedCount: metricsutils.NewCounter(config.SubsystemSupernode, "dispatch_shed_total",
+			"Total number of the pulls of piece tasks shed since the dispatch queue is full.", []string{}, register,
+		),
 		dfgetDownloadDuration: metricsutils.NewHistogram(config.SubsystemDfget, "download_duration_seconds",
 			"Histogram of duration for dfget download.", []string{"callsystem", "peer"},
 			[]float64{10, 30, 60, 120, 300, 600}, register,
@@ -83,7 +119,64 @@ func newMetrics(register prometheus.Registerer) *metrics {
 		dfgetDownloadFailCount: metricsutils.NewCounter(config.SubsystemDfget, "download_failed_total",
 			"Total failure times of dfget download", []string{"callsystem", "peer", "reason"}, register,
 		),
+		strategyDownloadDuration: metricsutils.NewHistogram(config.SubsystemSupernode, "scheduler_download_seconds",
+			"Histogram of duration for the dfget downloads finished in the P2P network by the strategy of the scheduler.", []string{"strategy"},
+			[]float64{10, 30, 60, 120, 300, 600}, register,
+		),
+		strategyDownloadCount: metricsutils.NewCounter(config.SubsystemSupernode, "scheduler_downloads_total",
+			"Total times of dfget download by the strategy of the scheduler and the result.", []string{"strategy", "result"}, register,
+		),
+		brakeMode: metricsutils.NewGauge(config.SubsystemSupernode, "emergency_brake_mode",
+			"The mode of the emergency brake of the P2P traffic, 1 for the current mode.", []string{"mode"}, register,
+		),
+		brakeRateLimit: metricsutils.NewGauge(config.SubsystemSupernode, "emergency_brake_rate_limit_bytes",
+			"The download rate limit of every peer when the emergency brake throttles the P2P traffic.", []string{}, register,
+		),
+		brakesScoped: metricsutils.NewGauge(config.SubsystemSupernode, "emergency_brakes_scoped",
+			"The number of the scoped emergency brakes engaged by mode.", []string{"mode"}, register,
+		),
+	}
+	m.updateBrake(&types.EmergencyBrake{Mode: types.EmergencyBrakeModeOff})
+	m.updateScopedBrakes(nil)
+	return m
+}
+
+// updateBrake updates the metrics of the emergency brake to the state.
+func (m *metrics) updateBrake(brake *types.EmergencyBrake) {
+	for _, mode := range []string{types.EmergencyBrakeModeOff, types.EmergencyBrakeModePause, types.EmergencyBrakeModeThrottle} {
+		v := 0.0
+		if mode == brake.Mode {
+			v = 1
+		}
+		m.brakeMode.WithLabelValues(mode).Set(v)
 	}
+	m.brakeRateLimit.WithLabelValues().Set(float64(brake.RateLimit))
+}
+
+// updateScopedBrakes updates the number of the scoped emergency brakes by mode.
+func (m *metrics) updateScopedBrakes(brakes []*types.EmergencyBrake) {
+	counts := make(map[string]int)
+	for _, brake := range brakes {
+		counts[brake.Mode]++
+	}
+	for _, mode := range []string{types.EmergencyBrakeModePause, types.EmergencyBrakeModeThrottle} {
+		m.brakesScoped.WithLabelValues(mode).Set(float64(counts[mode]))
+	}
+}
+
+// observeStrategy records the download reported by dfget into the metrics of the strategy
+// of the scheduler. The result is one of success, backsource and failed.
+func (m *metrics) observeStrategy(strategy string, request *types.TaskMetricsRequest, backSourced bool) {
+	result := "success"
+	switch {
+	case !request.Success:
+		result = "failed"
+	case backSourced:
+		result = "backsource"
+	default:
+		m.strategyDownloadDuration.WithLabelValues(strategy).Observe(request.Duration)
+	}
+	m.strategyDownloadCount.WithLabelValues(strategy, result).Inc()
 }
 
 // instrumentHandler will update metrics for every http request.
@@ -103,7 +196,7 @@ func (m *metrics) instrumentHandler(handlerName string, handler http.HandlerFunc
 	)
 }
 
-func (m *metrics) handleMetricsReport(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+func (s *Server) handleMetricsReport(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
 	reader := req.Body
 	request := &types.TaskMetricsRequest{}
 	if err := json.NewDecoder(reader).Decode(request); err != nil {
@@ -113,6 +206,9 @@ func (m *metrics) handleMetricsReport(ctx context.Context, rw http.ResponseWrite
 	if err := request.Validate(strfmt.NewFormats()); err != nil {
 		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
 	}
+	if err := authorizeNode(ctx, request.IP); err != nil {
+		return err
+	}
 	status := "success"
 	if !request.Success {
 		status = "failed"
@@ -126,9 +222,33 @@ func (m *metrics) handleMetricsReport(ctx context.Context, rw http.ResponseWrite
 	if request.Success {
 		m.dfgetDownloadDuration.WithLabelValues(request.CallSystem, request.IP).Observe(request.Duration)
 		m.dfgetDownloadFileSize.WithLabelValues(request.CallSystem, request.IP).Add(float64(request.FileLength))
+		// the file downloaded from the source directly doesn't come from the p2p network
+		if request.BacksourceReason == "" || request.BacksourceReason == "0" {
+			s.ContributionMgr.ReportDownloaded(ctx, request.IP, request.TaskID, request.FileLength)
+		} else {
+			s.ContributionMgr.ReportBacksourced(ctx, request.TaskID, request.FileLength)
+		}
 	} else {
 		m.dfgetDownloadFailCount.WithLabelValues(request.CallSystem, request.IP, request.BacksourceReason).Inc()
 	}
+	labels := s.peerLabels(ctx, request.CID, request.TaskID)
+	s.AnalyticsMgr.RecordDownload(ctx, request, labels)
+	backSourced := request.BacksourceReason != "" && request.BacksourceReason != "0"
+	m.observeStrategy(s.SchedulerMgr.GetStrategy(ctx, request.TaskID), request, backSourced)
+	s.AnomalyMgr.ObserveDownload(ctx, request.TaskID, labels, backSourced)
+	if len(request.Events) > 0 || request.EventsDropped > 0 {
+		s.EventLogMgr.Record(ctx, &mgr.TaskEventLog{
+			Time:             time.Now(),
+			TaskID:           request.TaskID,
+			CID:              request.CID,
+			IP:               request.IP,
+			Success:          request.Success,
+			BacksourceReason: request.BacksourceReason,
+			Duration:         request.Duration,
+			Events:           request.Events,
+			Dropped:          request.EventsDropped,
+		})
+	}
 
 	return EncodeResponse(rw, http.StatusOK, nil)
 }
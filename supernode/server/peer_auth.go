@@ -0,0 +1,80 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/peertoken"
+	"github.com/dragonflyoss/Dragonfly/supernode/server/api"
+
+	"github.com/pkg/errors"
+)
+
+// nodeIPKey is the key of the ip of the authenticated node in the context.
+type nodeIPKey struct{}
+
+// authenticatePeer wraps the handler of the requests sent by the peers. If PeerTokenSecret
+// is set, the requests without a valid token of the node they are sent from are rejected,
+// and the ip of the node is passed to the handler by the context.
+func (s *Server) authenticatePeer(handler api.HandlerFunc) api.HandlerFunc {
+	return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		if s.Config.PeerTokenSecret == "" {
+			return handler(ctx, rw, req)
+		}
+
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			ip = req.RemoteAddr
+		}
+		if !peertoken.Verify(s.Config.PeerTokenSecret, ip, req.Header.Get(peertoken.Header)) {
+			return errors.Wrapf(errortypes.ErrPermissionDenied, "invalid peer token of node %s", ip)
+		}
+		return handler(context.WithValue(ctx, nodeIPKey{}, ip), rw, req)
+	}
+}
+
+// authorizeNode checks that the ip claimed by the request is the one of the authenticated
+// node. It always passes if the request is not authenticated.
+func authorizeNode(ctx context.Context, ip string) error {
+	nodeIP, ok := ctx.Value(nodeIPKey{}).(string)
+	if !ok || nodeIP == ip {
+		return nil
+	}
+	return errors.Wrapf(errortypes.ErrPermissionDenied, "node %s can't act as %s", nodeIP, ip)
+}
+
+// authorizeClient checks that the dfget task of cid is run by a peer on the authenticated node,
+// so that a node can't report the pieces of the clients on other nodes.
+func (s *Server) authorizeClient(ctx context.Context, cid, taskID string) error {
+	if _, ok := ctx.Value(nodeIPKey{}).(string); !ok {
+		return nil
+	}
+
+	dfgetTask, err := s.DfgetTaskMgr.Get(ctx, cid, taskID)
+	if err != nil {
+		return err
+	}
+	peerInfo, err := s.PeerMgr.Get(ctx, dfgetTask.PeerID)
+	if err != nil {
+		return err
+	}
+	return authorizeNode(ctx, peerInfo.IP.String())
+}
@@ -40,6 +40,9 @@ func (s *Server) registerPeer(ctx context.Context, rw http.ResponseWriter, req *
 	if err := request.Validate(strfmt.NewFormats()); err != nil {
 		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
 	}
+	if err := authorizeNode(ctx, request.IP.String()); err != nil {
+		return err
+	}
 
 	resp, err := s.PeerMgr.Register(ctx, request)
 	if err != nil {
@@ -52,6 +55,17 @@ func (s *Server) registerPeer(ctx context.Context, rw http.ResponseWriter, req *
 func (s *Server) deRegisterPeer(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
 	id := mux.Vars(req)["id"]
 
+	// only the peers on the authenticated node can be deregistered by it
+	if _, ok := ctx.Value(nodeIPKey{}).(string); ok {
+		peerInfo, err := s.PeerMgr.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := authorizeNode(ctx, peerInfo.IP.String()); err != nil {
+			return err
+		}
+	}
+
 	if err = s.PeerMgr.DeRegister(ctx, id); err != nil {
 		return err
 	}
@@ -20,10 +20,12 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/gorilla/mux"
@@ -55,6 +57,9 @@ func (s *Server) handlePieceError(ctx context.Context, rw http.ResponseWriter, r
 	if stringutils.IsEmptyStr(request.Range) {
 		request.Range = pieceRange
 	}
+	if err := s.authorizeClient(ctx, request.SrcCid, request.TaskID); err != nil {
+		return err
+	}
 
 	if err := s.PieceErrorMgr.HandlePieceError(ctx, request); err != nil {
 		return err
@@ -63,3 +68,28 @@ func (s *Server) handlePieceError(ctx context.Context, rw http.ResponseWriter, r
 	rw.WriteHeader(http.StatusOK)
 	return nil
 }
+
+// listPoisonIncidents returns the incidents of the pieces which mismatch their md5 after
+// being downloaded from the peers, which helps to investigate the poisoning incidents.
+// They can be filtered by the query parameters taskId, peerId of the offender and verdict,
+// and the max number of the returned incidents can be specified by limit.
+func (s *Server) listPoisonIncidents(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	params := req.URL.Query()
+	query := &mgr.PoisonQuery{
+		TaskID:      params.Get("taskId"),
+		OffenderPID: params.Get("peerId"),
+		Verdict:     params.Get("verdict"),
+	}
+	switch query.Verdict {
+	case "", mgr.PoisonVerdictProven, mgr.PoisonVerdictUnconfirmed, mgr.PoisonVerdictInconclusive:
+	default:
+		return errors.Wrapf(errortypes.ErrInvalidValue, "verdict: %s", query.Verdict)
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "limit: %s", v)
+		}
+	}
+
+	return EncodeResponse(rw, http.StatusOK, s.PieceErrorMgr.ListPoisonIncidents(ctx, query))
+}
@@ -23,7 +23,6 @@ import (
 	"strings"
 
 	"github.com/dragonflyoss/Dragonfly/supernode/server/api"
-	"github.com/dragonflyoss/Dragonfly/version"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
@@ -55,19 +54,63 @@ func registerCoreHandlers(s *Server) {
 func registerV1(s *Server) {
 	v1Handlers := []*api.HandlerSpec{
 		// peer
-		{Method: http.MethodPost, Path: "/peers", HandlerFunc: s.registerPeer},
-		{Method: http.MethodDelete, Path: "/peers/{id}", HandlerFunc: s.deRegisterPeer},
+		{Method: http.MethodPost, Path: "/peers", HandlerFunc: s.authenticatePeer(s.registerPeer)},
+		{Method: http.MethodDelete, Path: "/peers/{id}", HandlerFunc: s.authenticatePeer(s.deRegisterPeer)},
 		{Method: http.MethodGet, Path: "/peers/{id}", HandlerFunc: s.getPeer},
 		{Method: http.MethodGet, Path: "/peers", HandlerFunc: s.listPeers},
+		{Method: http.MethodGet, Path: "/contributions", HandlerFunc: s.listContributions},
+		{Method: http.MethodGet, Path: "/contributions/{ip}", HandlerFunc: s.getContribution},
+		{Method: http.MethodGet, Path: "/savings", HandlerFunc: s.getSavings},
+		{Method: http.MethodGet, Path: "/usage", HandlerFunc: s.getUsage},
+		{Method: http.MethodGet, Path: "/usage/backsource", HandlerFunc: s.listBackSourceCauses},
+		{Method: http.MethodGet, Path: "/origins", HandlerFunc: s.listOriginStats},
+		{Method: http.MethodGet, Path: "/alerts", HandlerFunc: s.listAlerts},
+		{Method: http.MethodGet, Path: "/tasks", HandlerFunc: s.listTasks},
 		{Method: http.MethodGet, Path: "/tasks/{id}", HandlerFunc: s.getTaskInfo},
-		{Method: http.MethodPost, Path: "/peer/network", HandlerFunc: s.fetchP2PNetworkInfo},
-		{Method: http.MethodPost, Path: "/peer/heartbeat", HandlerFunc: s.reportPeerHealth},
+		{Method: http.MethodPost, Path: "/peer/network", HandlerFunc: s.authenticatePeer(s.fetchP2PNetworkInfo)},
+		{Method: http.MethodPost, Path: "/peer/heartbeat", HandlerFunc: s.authenticatePeer(s.reportPeerHealth)},
+		{Method: http.MethodPost, Path: "/peer/seed", HandlerFunc: s.authenticatePeer(s.reportSeed)},
+		{Method: http.MethodPost, Path: "/peer/pieces", HandlerFunc: s.authenticatePeer(s.reportPieces)},
+		{Method: http.MethodPost, Path: "/peer/extension", HandlerFunc: s.authenticatePeer(s.extendProgress)},
+		{Method: http.MethodPost, Path: "/peer/keepalive", HandlerFunc: s.authenticatePeer(s.keepalive)},
+		{Method: http.MethodGet, Path: "/peer/probe", HandlerFunc: s.authenticatePeer(s.probeBandwidth)},
 
 		// task
 		{Method: http.MethodDelete, Path: "/tasks/{id}", HandlerFunc: s.deleteTask},
+		{Method: http.MethodGet, Path: "/tasks/{id}/scheduler/decisions", HandlerFunc: s.getSchedulerDecisions},
+		{Method: http.MethodGet, Path: "/tasks/{id}/md5s", HandlerFunc: s.getTaskPieceMD5s},
+		{Method: http.MethodGet, Path: "/tasks/{id}/events", HandlerFunc: s.getTaskEventLogs},
+		{Method: http.MethodGet, Path: "/tasks/{id}/bundle", HandlerFunc: s.exportTaskBundle},
+		{Method: http.MethodPost, Path: "/tasks/bundle", HandlerFunc: s.importTaskBundle},
+		{Method: http.MethodPost, Path: "/tasks/{id}/purge", HandlerFunc: s.purgeTask},
+		{Method: http.MethodGet, Path: "/tasks/{id}/purge", HandlerFunc: s.getTaskPurge},
+		{Method: http.MethodGet, Path: "/purges", HandlerFunc: s.listPurges},
+		{Method: http.MethodPut, Path: "/tasks/{id}/boost", HandlerFunc: s.setTaskBoost},
+		{Method: http.MethodGet, Path: "/tasks/{id}/boost", HandlerFunc: s.getTaskBoost},
+		{Method: http.MethodDelete, Path: "/tasks/{id}/boost", HandlerFunc: s.deleteTaskBoost},
+		{Method: http.MethodGet, Path: "/boosts", HandlerFunc: s.listBoosts},
+		{Method: http.MethodGet, Path: "/groups/{id}", HandlerFunc: s.getTaskGroup},
+		{Method: http.MethodPost, Path: "/manifests", HandlerFunc: s.authenticatePeer(s.createTaskManifest)},
+		{Method: http.MethodGet, Path: "/tasks/{id}/manifest", HandlerFunc: s.getTaskManifest},
+		{Method: http.MethodDelete, Path: "/tasks/{id}/manifest", HandlerFunc: s.authenticatePeer(s.deleteTaskManifest)},
+
+		// alias
+		{Method: http.MethodPost, Path: "/aliases", HandlerFunc: s.createTaskAlias},
+		{Method: http.MethodGet, Path: "/aliases", HandlerFunc: s.listTaskAliases},
+		{Method: http.MethodGet, Path: "/aliases/{id}", HandlerFunc: s.getTaskAlias},
+		{Method: http.MethodDelete, Path: "/aliases/{id}", HandlerFunc: s.deleteTaskAlias},
 
 		// piece
-		{Method: http.MethodGet, Path: "/tasks/{id}/pieces/{pieceRange}/error", HandlerFunc: s.handlePieceError},
+		{Method: http.MethodGet, Path: "/pieces/layout", HandlerFunc: s.getPieceLayout},
+		{Method: http.MethodGet, Path: "/tasks/{id}/pieces/{pieceRange}/error", HandlerFunc: s.authenticatePeer(s.handlePieceError)},
+		{Method: http.MethodGet, Path: "/poisoning", HandlerFunc: s.listPoisonIncidents},
+
+		// brake
+		{Method: http.MethodGet, Path: "/brake", HandlerFunc: s.getBrake},
+		{Method: http.MethodPut, Path: "/brake", HandlerFunc: s.setBrake},
+		{Method: http.MethodGet, Path: "/brakes", HandlerFunc: s.listBrakes},
+		{Method: http.MethodPut, Path: "/brakes/{name}", HandlerFunc: s.setScopedBrake},
+		{Method: http.MethodDelete, Path: "/brakes/{name}", HandlerFunc: s.deleteBrake},
 	}
 
 	api.V1.Register(v1Handlers...)
@@ -79,11 +122,12 @@ func registerSystem(s *Server) {
 	systemHandlers := []*api.HandlerSpec{
 		// system
 		{Method: http.MethodGet, Path: "/_ping", HandlerFunc: s.ping},
-		{Method: http.MethodGet, Path: "/version", HandlerFunc: version.HandlerWithCtx},
+		{Method: http.MethodGet, Path: "/health", HandlerFunc: s.getHealth},
+		{Method: http.MethodGet, Path: "/version", HandlerFunc: s.getVersion},
 
 		// metrics
 		{Method: http.MethodGet, Path: "/metrics", HandlerFunc: handleMetrics},
-		{Method: http.MethodPost, Path: "/task/metrics", HandlerFunc: m.handleMetricsReport},
+		{Method: http.MethodPost, Path: "/task/metrics", HandlerFunc: s.authenticatePeer(s.handleMetricsReport)},
 	}
 	api.Legacy.Register(systemHandlers...)
 }
@@ -91,13 +135,14 @@ func registerSystem(s *Server) {
 func registerLegacy(s *Server) {
 	legacyHandlers := []*api.HandlerSpec{
 		// v0.3
-		{Method: http.MethodPost, Path: "/peer/registry", HandlerFunc: s.registry},
-		{Method: http.MethodGet, Path: "/peer/task", HandlerFunc: s.pullPieceTask},
-		{Method: http.MethodGet, Path: "/peer/piece/suc", HandlerFunc: s.reportPiece},
-		{Method: http.MethodGet, Path: "/peer/service/down", HandlerFunc: s.reportServiceDown},
-		{Method: http.MethodGet, Path: "/peer/piece/error", HandlerFunc: s.reportPieceError},
-		{Method: http.MethodPost, Path: "/peer/network", HandlerFunc: s.fetchP2PNetworkInfo},
-		{Method: http.MethodPost, Path: "/peer/heartbeat", HandlerFunc: s.reportPeerHealth},
+		{Method: http.MethodPost, Path: "/peer/registry", HandlerFunc: s.authenticatePeer(s.registry)},
+		{Method: http.MethodGet, Path: "/peer/task", HandlerFunc: s.authenticatePeer(s.pullPieceTask)},
+		{Method: http.MethodGet, Path: "/peer/piece/suc", HandlerFunc: s.authenticatePeer(s.reportPiece)},
+		{Method: http.MethodGet, Path: "/peer/service/down", HandlerFunc: s.authenticatePeer(s.reportServiceDown)},
+		{Method: http.MethodGet, Path: "/peer/piece/error", HandlerFunc: s.authenticatePeer(s.reportPieceError)},
+		{Method: http.MethodPost, Path: "/peer/network", HandlerFunc: s.authenticatePeer(s.fetchP2PNetworkInfo)},
+		{Method: http.MethodPost, Path: "/peer/heartbeat", HandlerFunc: s.authenticatePeer(s.reportPeerHealth)},
+		{Method: http.MethodPost, Path: "/peer/seed", HandlerFunc: s.authenticatePeer(s.reportSeed)},
 	}
 	api.Legacy.Register(legacyHandlers...)
 	api.Legacy.Register(preheatHandlers(s)...)
@@ -17,24 +17,35 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/peertoken"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	_ "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/cdn"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
 	_ "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/sourcecdn"
+	"github.com/dragonflyoss/Dragonfly/supernode/server/api"
 	"github.com/dragonflyoss/Dragonfly/version"
 
 	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
+	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
@@ -54,6 +65,7 @@ type RouterTestSuite struct {
 	addr     string
 	listener net.Listener
 	router   *mux.Router
+	server   *Server
 }
 
 func (rs *RouterTestSuite) SetUpSuite(c *check.C) {
@@ -82,6 +94,7 @@ func (rs *RouterTestSuite) SetUpSuite(c *check.C) {
 		GoVersion: runtime.Version(),
 	}
 
+	rs.server = s
 	rs.router = createRouter(s)
 	rs.listener, err = net.Listen("tcp", rs.addr)
 	c.Check(err, check.IsNil)
@@ -116,6 +129,18 @@ func (rs *RouterTestSuite) TestDebugHandler(c *check.C) {
 	}
 }
 
+func (rs *RouterTestSuite) TestHealthHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/health", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, 200)
+
+	health := &types.SupernodeHealth{}
+	c.Assert(json.Unmarshal(res, health), check.IsNil)
+	c.Assert(health.CacheScan, check.NotNil)
+	// the scan is disabled without the scan workers
+	c.Check(health.CacheScan.Finished, check.Equals, true)
+}
+
 func (rs *RouterTestSuite) TestVersionHandler(c *check.C) {
 	code, res, err := httputils.Get("http://"+rs.addr+"/version", 0)
 	c.Check(err, check.IsNil)
@@ -127,10 +152,12 @@ func (rs *RouterTestSuite) TestVersionHandler(c *check.C) {
 		Arch:      runtime.GOARCH,
 		OS:        runtime.GOOS,
 		GoVersion: runtime.Version(),
+		Component: "supernode",
+		Features:  []string{},
 	})
 
 	c.Check(err, check.IsNil)
-	c.Check(string(expectDFVersion), check.Equals, string(res))
+	c.Check(string(expectDFVersion)+"\n", check.Equals, string(res))
 }
 
 func (rs *RouterTestSuite) TestHTTPMetrics(c *check.C) {
@@ -151,3 +178,425 @@ func (rs *RouterTestSuite) TestHTTPMetrics(c *check.C) {
 			int(prom_testutil.ToFloat64(counter.WithLabelValues(strconv.Itoa(http.StatusOK), "/_ping"))))
 	}
 }
+
+func (rs *RouterTestSuite) TestContributionHandler(c *check.C) {
+	code, _, err := httputils.PostJSON("http://"+rs.addr+"/task/metrics", &types.TaskMetricsRequest{
+		IP:               "192.168.1.1",
+		TaskID:           "foo",
+		CallSystem:       "test",
+		Success:          true,
+		BacksourceReason: "0",
+		FileLength:       100,
+	}, 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, 200)
+
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/contributions?freeRider=true", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, 200)
+	var contributions []*types.NodeContribution
+	c.Assert(json.Unmarshal(res, &contributions), check.IsNil)
+	c.Assert(contributions, check.HasLen, 1)
+	c.Check(contributions[0].IP, check.Equals, "192.168.1.1")
+	c.Check(contributions[0].FreeRider, check.Equals, true)
+
+	code, res, err = httputils.Get("http://"+rs.addr+"/api/v1/contributions/192.168.1.1", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, 200)
+	contribution := &types.NodeContribution{}
+	c.Assert(json.Unmarshal(res, contribution), check.IsNil)
+	c.Check(contribution.DownloadedBytes, check.Equals, int64(100))
+	c.Assert(contribution.Tasks, check.HasLen, 1)
+	c.Check(contribution.Tasks[0].TaskID, check.Equals, "foo")
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/contributions/192.168.1.2", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, 404)
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/contributions?freeRider=foo", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, 400)
+}
+
+func (rs *RouterTestSuite) TestTaskAliasHandler(c *check.C) {
+	request := &types.TaskAlias{
+		Digest: "md5:" + strings.Repeat("a", 32),
+		Urls:   []string{"http://a.com/foo", "http://b.com/foo"},
+	}
+	code, res, err := httputils.PostJSON("http://"+rs.addr+"/api/v1/aliases", request, 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, 201)
+	alias := &types.TaskAlias{}
+	c.Assert(json.Unmarshal(res, alias), check.IsNil)
+	c.Check(alias.ID, check.Not(check.Equals), "")
+
+	code, _, err = httputils.PostJSON("http://"+rs.addr+"/api/v1/aliases", request, 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, 409)
+
+	code, res, err = httputils.Get("http://"+rs.addr+"/api/v1/aliases/"+alias.ID, 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, 200)
+	got := &types.TaskAlias{}
+	c.Assert(json.Unmarshal(res, got), check.IsNil)
+	c.Check(got.Urls, check.DeepEquals, request.Urls)
+
+	code, _, err = httputils.PostJSON("http://"+rs.addr+"/api/v1/aliases", &types.TaskAlias{
+		Digest: "md5:" + strings.Repeat("a", 32),
+		Urls:   []string{"http://c.com/foo"},
+	}, 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, 400)
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/aliases/foo", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, 404)
+}
+
+func (rs *RouterTestSuite) TestBrakeHandler(c *check.C) {
+	put := func(brake *types.EmergencyBrake) (int, *types.EmergencyBrake) {
+		b, err := json.Marshal(brake)
+		c.Assert(err, check.IsNil)
+		req, err := http.NewRequest(http.MethodPut, "http://"+rs.addr+"/api/v1/brake", strings.NewReader(string(b)))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		defer resp.Body.Close()
+		got := &types.EmergencyBrake{}
+		if resp.StatusCode == http.StatusOK {
+			c.Assert(json.NewDecoder(resp.Body).Decode(got), check.IsNil)
+		}
+		return resp.StatusCode, got
+	}
+
+	code, brake := put(&types.EmergencyBrake{Mode: types.EmergencyBrakeModeThrottle, RateLimit: 1024})
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(brake.Mode, check.Equals, types.EmergencyBrakeModeThrottle)
+	c.Check(brake.RateLimit, check.Equals, int64(1024))
+	c.Check(prom_testutil.ToFloat64(m.brakeMode.WithLabelValues(types.EmergencyBrakeModeThrottle)), check.Equals, float64(1))
+	c.Check(prom_testutil.ToFloat64(m.brakeRateLimit.WithLabelValues()), check.Equals, float64(1024))
+
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/brake", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	got := &types.EmergencyBrake{}
+	c.Assert(json.Unmarshal(res, got), check.IsNil)
+	c.Check(got.Mode, check.Equals, types.EmergencyBrakeModeThrottle)
+
+	code, _ = put(&types.EmergencyBrake{Mode: "foo"})
+	c.Check(code, check.Equals, http.StatusBadRequest)
+	code, _ = put(&types.EmergencyBrake{Mode: types.EmergencyBrakeModeThrottle})
+	c.Check(code, check.Equals, http.StatusBadRequest)
+
+	code, brake = put(&types.EmergencyBrake{Mode: types.EmergencyBrakeModeOff, RateLimit: 1024})
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(brake.RateLimit, check.Equals, int64(0))
+	c.Check(prom_testutil.ToFloat64(m.brakeMode.WithLabelValues(types.EmergencyBrakeModeThrottle)), check.Equals, float64(0))
+	c.Check(prom_testutil.ToFloat64(m.brakeMode.WithLabelValues(types.EmergencyBrakeModeOff)), check.Equals, float64(1))
+}
+
+func (rs *RouterTestSuite) TestTaskBoostHandler(c *check.C) {
+	put := func(boost *types.TaskBoost) int {
+		b, err := json.Marshal(boost)
+		c.Assert(err, check.IsNil)
+		req, err := http.NewRequest(http.MethodPut, "http://"+rs.addr+"/api/v1/tasks/foo/boost", strings.NewReader(string(b)))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	c.Check(put(&types.TaskBoost{RateLimit: 1024, Minutes: 2000}), check.Equals, http.StatusBadRequest)
+	// the task which doesn't exist can't be boosted
+	c.Check(put(&types.TaskBoost{RateLimit: 1024, Minutes: 10}), check.Equals, http.StatusNotFound)
+
+	code, _, err := httputils.Get("http://"+rs.addr+"/api/v1/tasks/foo/boost", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusNotFound)
+
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/boosts", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	var boosts []*types.TaskBoost
+	c.Assert(json.Unmarshal(res, &boosts), check.IsNil)
+	c.Check(boosts, check.HasLen, 0)
+}
+
+func (rs *RouterTestSuite) TestTaskManifestHandler(c *check.C) {
+	code, _, err := httputils.PostJSON("http://"+rs.addr+"/api/v1/manifests", &types.TaskManifest{
+		RawURL:     "http://a.com/x",
+		FileLength: 10,
+	}, 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusBadRequest)
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/tasks/foo/manifest", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusNotFound)
+
+	// only the authenticated peers can change the manifests once the peer token secret is set
+	rs.server.Config.PeerTokenSecret = "secret"
+	defer func() { rs.server.Config.PeerTokenSecret = "" }()
+	code, _, err = httputils.PostJSON("http://"+rs.addr+"/api/v1/manifests", &types.TaskManifest{
+		RawURL:     "http://a.com/x",
+		FileLength: 10,
+		PieceMD5s:  []string{strings.Repeat("a", 32) + ":15"},
+	}, 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusForbidden)
+
+	req, err := http.NewRequest(http.MethodDelete, "http://"+rs.addr+"/api/v1/tasks/foo/manifest", nil)
+	c.Assert(err, check.IsNil)
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusForbidden)
+}
+
+func (rs *RouterTestSuite) TestPieceLayoutHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/pieces/layout?fileLength=1000&pieceSize=262144&limit=1", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	layout := &types.PieceLayout{}
+	c.Assert(json.Unmarshal(res, layout), check.IsNil)
+	c.Check(layout.PieceTotal, check.Equals, int32(1))
+	c.Assert(layout.Pieces, check.HasLen, 1)
+	c.Check(layout.Pieces[0].End, check.Equals, int64(999))
+
+	for _, query := range []string{"", "fileLength=-1", "fileLength=1&pieceSize=1", "fileLength=1&start=x"} {
+		code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/pieces/layout?"+query, 0)
+		c.Check(err, check.IsNil)
+		c.Check(code, check.Equals, http.StatusBadRequest, check.Commentf("query: %s", query))
+	}
+}
+
+func (rs *RouterTestSuite) TestUsageHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/usage?period=weekly", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	var summaries []*types.UsageSummary
+	c.Assert(json.Unmarshal(res, &summaries), check.IsNil)
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/usage?period=monthly", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusBadRequest)
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/usage?limit=x", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusBadRequest)
+}
+
+func (rs *RouterTestSuite) TestListOriginStatsHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/origins", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	var stats []*types.OriginStats
+	c.Assert(json.Unmarshal(res, &stats), check.IsNil)
+	c.Check(stats, check.NotNil)
+}
+
+func (rs *RouterTestSuite) TestListBackSourceCausesHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/usage/backsource?group=task&limit=10", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(strings.TrimSpace(string(res)), check.Equals, "[]")
+
+	for _, query := range []string{"group=peer", "limit=-1"} {
+		code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/usage/backsource?"+query, 0)
+		c.Check(err, check.IsNil)
+		c.Check(code, check.Equals, http.StatusBadRequest, check.Commentf("query: %s", query))
+	}
+}
+
+func (rs *RouterTestSuite) TestListTasksHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/tasks?status=SUCCESS&minSize=1MB&pageSize=10", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(strings.TrimSpace(string(res)), check.Equals, "[]")
+
+	for _, query := range []string{"url=(", "status=DONE", "minAge=1", "maxSize=foo", "sortKey=foo", "pageNum=-1"} {
+		code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/tasks?"+query, 0)
+		c.Check(err, check.IsNil)
+		c.Check(code, check.Equals, http.StatusBadRequest, check.Commentf("query: %s", query))
+	}
+}
+
+func (rs *RouterTestSuite) TestKeepaliveHandler(c *check.C) {
+	url := "http://" + rs.addr + "/api/v1/peer/keepalive"
+	code, res, err := httputils.PostJSON(url, &types.PeerKeepaliveRequest{TaskID: "foo", CID: "bar"}, 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	resp := &types.PeerKeepaliveResponse{}
+	c.Assert(json.Unmarshal(res, resp), check.IsNil)
+	c.Check(resp.Registered, check.Equals, false)
+
+	code, _, err = httputils.PostJSON(url, &types.PeerKeepaliveRequest{CID: "bar"}, 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusBadRequest)
+}
+
+func (rs *RouterTestSuite) TestProbeBandwidthHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/peer/probe?size=100000", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(res, check.HasLen, 100000)
+
+	code, res, err = httputils.Get("http://"+rs.addr+"/api/v1/peer/probe?size=1073741824", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(res, check.HasLen, int(config.MaxBandwidthProbeSize))
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/peer/probe?size=-1", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusBadRequest)
+}
+
+func (rs *RouterTestSuite) TestAlertsHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/alerts?limit=10", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	var alerts []*mgr.AnomalyAlert
+	c.Assert(json.Unmarshal(res, &alerts), check.IsNil)
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/alerts?limit=x", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusBadRequest)
+}
+
+func (rs *RouterTestSuite) TestPoisoningHandler(c *check.C) {
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/poisoning?verdict=proven&limit=10", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	var incidents []*mgr.PoisonIncident
+	c.Assert(json.Unmarshal(res, &incidents), check.IsNil)
+	c.Check(incidents, check.HasLen, 0)
+
+	code, _, err = httputils.Get("http://"+rs.addr+"/api/v1/poisoning?verdict=x", 0)
+	c.Check(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusBadRequest)
+}
+
+func (rs *RouterTestSuite) TestAuthenticatePeer(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	dfgetTaskMgr := mock.NewMockDfgetTaskMgr(ctl)
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	s := &Server{
+		Config: &config.Config{BaseProperties: &config.BaseProperties{
+			PeerTokenSecret: "secret",
+		}},
+		DfgetTaskMgr: dfgetTaskMgr,
+		PeerMgr:      peerMgr,
+	}
+
+	var authorized []error
+	handler := s.authenticatePeer(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		authorized = append(authorized, authorizeNode(ctx, "10.0.0.1"), authorizeNode(ctx, "10.0.0.2"),
+			s.authorizeClient(ctx, "cid", "foo"))
+		return nil
+	})
+	do := func(token string) error {
+		req := httptest.NewRequest(http.MethodGet, "/peer/task", nil)
+		req.RemoteAddr = "10.0.0.1:35000"
+		if token != "" {
+			req.Header.Set(peertoken.Header, token)
+		}
+		return handler(context.Background(), httptest.NewRecorder(), req)
+	}
+
+	c.Check(errortypes.IsPermissionDenied(do("")), check.Equals, true)
+	c.Check(errortypes.IsPermissionDenied(do(peertoken.Sign("secret", "10.0.0.2"))), check.Equals, true)
+	c.Check(authorized, check.HasLen, 0)
+
+	dfgetTaskMgr.EXPECT().Get(gomock.Any(), "cid", "foo").Return(&types.DfGetTask{PeerID: "p1"}, nil)
+	peerMgr.EXPECT().Get(gomock.Any(), "p1").Return(&types.PeerInfo{IP: strfmt.IPv4("10.0.0.2")}, nil)
+	c.Check(do(peertoken.Sign("secret", "10.0.0.1")), check.IsNil)
+	c.Assert(authorized, check.HasLen, 3)
+	c.Check(authorized[0], check.IsNil)
+	c.Check(errortypes.IsPermissionDenied(authorized[1]), check.Equals, true)
+	c.Check(errortypes.IsPermissionDenied(authorized[2]), check.Equals, true)
+
+	// all are authorized if the request is not authenticated
+	c.Check(authorizeNode(context.Background(), "10.0.0.2"), check.IsNil)
+	c.Check(s.authorizeClient(context.Background(), "cid", "foo"), check.IsNil)
+}
+
+func (rs *RouterTestSuite) TestAuthorizePeerRoutes(c *check.C) {
+	ctl := gomock.NewController(c)
+	defer ctl.Finish()
+	dfgetTaskMgr := mock.NewMockDfgetTaskMgr(ctl)
+	peerMgr := mock.NewMockPeerMgr(ctl)
+	s := &Server{DfgetTaskMgr: dfgetTaskMgr, PeerMgr: peerMgr}
+	ctx := context.WithValue(context.Background(), nodeIPKey{}, "10.0.0.1")
+	// do routes the request by the pattern so that the path variables are parsed by mux
+	do := func(method, pattern, path string, handler api.HandlerFunc, body interface{}) (err error) {
+		r := mux.NewRouter()
+		r.Path(pattern).HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			err = handler(ctx, rw, req)
+		})
+		b, _ := json.Marshal(body)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, strings.NewReader(string(b))))
+		return err
+	}
+
+	// register a peer of another node
+	err := do(http.MethodPost, "/peers", "/peers", s.registerPeer, &types.PeerCreateRequest{
+		IP:       strfmt.IPv4("10.0.0.2"),
+		HostName: strfmt.Hostname("foo"),
+		Port:     15001,
+	})
+	c.Check(errortypes.IsPermissionDenied(err), check.Equals, true)
+
+	// deregister a peer of another node
+	peerMgr.EXPECT().Get(gomock.Any(), "p1").Return(&types.PeerInfo{IP: strfmt.IPv4("10.0.0.2")}, nil)
+	err = do(http.MethodDelete, "/peers/{id}", "/peers/p1", s.deRegisterPeer, nil)
+	c.Check(errortypes.IsPermissionDenied(err), check.Equals, true)
+
+	// report the piece error of a client on another node
+	dfgetTaskMgr.EXPECT().Get(gomock.Any(), "cid", "foo").Return(&types.DfGetTask{PeerID: "p1"}, nil)
+	peerMgr.EXPECT().Get(gomock.Any(), "p1").Return(&types.PeerInfo{IP: strfmt.IPv4("10.0.0.2")}, nil)
+	err = do(http.MethodGet, "/tasks/{id}/pieces/{pieceRange}/error", "/tasks/foo/pieces/0-99/error", s.handlePieceError,
+		&types.PieceErrorRequest{SrcCid: "cid", DstPid: "p2", ErrorType: types.PieceErrorRequestErrorTypeFILENOTEXIST})
+	c.Check(errortypes.IsPermissionDenied(err), check.Equals, true)
+}
+
+func (rs *RouterTestSuite) TestScopedBrakeHandler(c *check.C) {
+	do := func(method, name string, brake *types.EmergencyBrake) int {
+		var body io.Reader
+		if brake != nil {
+			b, err := json.Marshal(brake)
+			c.Assert(err, check.IsNil)
+			body = strings.NewReader(string(b))
+		}
+		req, err := http.NewRequest(method, "http://"+rs.addr+"/api/v1/brakes/"+name, body)
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	c.Check(do(http.MethodPut, "idc-a", &types.EmergencyBrake{Mode: types.EmergencyBrakeModePause}), check.Equals, http.StatusBadRequest)
+	c.Check(do(http.MethodPut, "idc-a", &types.EmergencyBrake{
+		Mode:     types.EmergencyBrakeModePause,
+		Selector: map[string]string{"idc": "a"},
+	}), check.Equals, http.StatusOK)
+	c.Check(prom_testutil.ToFloat64(m.brakesScoped.WithLabelValues(types.EmergencyBrakeModePause)), check.Equals, float64(1))
+
+	code, res, err := httputils.Get("http://"+rs.addr+"/api/v1/brakes", 0)
+	c.Check(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	var brakes []*types.EmergencyBrake
+	c.Assert(json.Unmarshal(res, &brakes), check.IsNil)
+	c.Assert(brakes, check.HasLen, 1)
+	c.Check(brakes[0].Name, check.Equals, "idc-a")
+	c.Check(brakes[0].Selector, check.DeepEquals, map[string]string{"idc": "a"})
+
+	c.Check(do(http.MethodDelete, "idc-a", nil), check.Equals, http.StatusNoContent)
+	c.Check(do(http.MethodDelete, "idc-a", nil), check.Equals, http.StatusNotFound)
+	c.Check(prom_testutil.ToFloat64(m.brakesScoped.WithLabelValues(types.EmergencyBrakeModePause)), check.Equals, float64(0))
+}
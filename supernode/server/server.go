@@ -23,17 +23,32 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dragonflyoss/Dragonfly/pkg/accesslog"
+	"github.com/dragonflyoss/Dragonfly/pkg/diagnostics"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/sourceprotocol"
+	"github.com/dragonflyoss/Dragonfly/pkg/systemd"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/analytics"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/anomaly"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/contribution"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/deadline"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/dfgettask"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/eventlog"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/gc"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/group"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/peer"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/pieceerror"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/preheat"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/progress"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/purge"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/push"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/replication"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/scheduler"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/task"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/metastore"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 	"github.com/dragonflyoss/Dragonfly/version"
 
@@ -45,16 +60,30 @@ var dfgetLogger *logrus.Logger
 
 // Server is supernode server struct.
 type Server struct {
-	Config        *config.Config
-	PeerMgr       mgr.PeerMgr
-	TaskMgr       mgr.TaskMgr
-	DfgetTaskMgr  mgr.DfgetTaskMgr
-	ProgressMgr   mgr.ProgressMgr
-	GCMgr         mgr.GCMgr
-	PieceErrorMgr mgr.PieceErrorMgr
-	PreheatMgr    mgr.PreheatManager
+	Config          *config.Config
+	PeerMgr         mgr.PeerMgr
+	TaskMgr         mgr.TaskMgr
+	CDNMgr          mgr.CDNMgr
+	DfgetTaskMgr    mgr.DfgetTaskMgr
+	ProgressMgr     mgr.ProgressMgr
+	SchedulerMgr    mgr.SchedulerMgr
+	GCMgr           mgr.GCMgr
+	PieceErrorMgr   mgr.PieceErrorMgr
+	PreheatMgr      mgr.PreheatManager
+	ContributionMgr mgr.ContributionMgr
+	AnalyticsMgr    mgr.AnalyticsMgr
+	AnomalyMgr      mgr.AnomalyMgr
+	DeadlineMgr     mgr.DeadlineMgr
+	EventLogMgr     mgr.EventLogMgr
+	ReplicationMgr  mgr.ReplicationMgr
+	PushMgr         mgr.PushMgr
+	PurgeMgr        mgr.PurgeMgr
+	GroupMgr        mgr.GroupMgr
 
 	originClient httpclient.OriginHTTPClient
+	originStats  *httpclient.OriginStats
+	dispatcher   *pieceDispatcher
+	edgeCaches   *edgeCaches
 }
 
 // New creates a brand new server instance.
@@ -74,8 +103,22 @@ func New(cfg *config.Config, logger *logrus.Logger, register prometheus.Register
 		return nil, err
 	}
 
-	originClient := httpclient.NewOriginClient()
-	peerMgr, err := peer.NewManager(register)
+	var metaStore *metastore.Store
+	if cfg.PersistTaskMeta {
+		if metaStore, err = metastore.Open(cfg.GetMetaStorePath()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sourceprotocol.Register(cfg.SourceProtocols); err != nil {
+		return nil, err
+	}
+	originStats := httpclient.NewOriginStats(register)
+	originClient, err := httpclient.NewOriginClientWithStats(cfg.OriginLogins, cfg.OriginProxies, originStats)
+	if err != nil {
+		return nil, err
+	}
+	peerMgr, err := peer.NewManager(cfg, register)
 	if err != nil {
 		return nil, err
 	}
@@ -90,28 +133,54 @@ func New(cfg *config.Config, logger *logrus.Logger, register prometheus.Register
 		return nil, err
 	}
 
-	schedulerMgr, err := scheduler.NewManager(cfg, progressMgr)
+	contributionMgr, err := contribution.NewManager(register)
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerMgr, err := scheduler.NewManager(cfg, progressMgr, peerMgr, contributionMgr)
 	if err != nil {
 		return nil, err
 	}
 
-	cdnMgr, err := mgr.GetCDNManager(cfg, storeLocal, progressMgr, originClient, register)
+	cdnMgr, err := mgr.GetCDNManager(cfg, storeLocal, metaStore, progressMgr, contributionMgr, originClient, register)
 	if err != nil {
 		return nil, err
 	}
 
 	taskMgr, err := task.NewManager(cfg, peerMgr, dfgetTaskMgr, progressMgr, cdnMgr,
-		schedulerMgr, originClient, register)
+		schedulerMgr, originClient, metaStore, register)
+	if err != nil {
+		return nil, err
+	}
+
+	analyticsMgr, err := analytics.NewManager(cfg, taskMgr, contributionMgr)
 	if err != nil {
 		return nil, err
 	}
 
-	gcMgr, err := gc.NewManager(cfg, taskMgr, peerMgr, dfgetTaskMgr, progressMgr, cdnMgr, register)
+	anomalyMgr, err := anomaly.NewManager(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	pieceErrorMgr, err := pieceerror.NewManager(cfg, gcMgr, cdnMgr)
+	deadlineMgr, err := deadline.NewManager(cfg, register)
+	if err != nil {
+		return nil, err
+	}
+
+	eventLogMgr, err := eventlog.NewManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	gcMgr, err := gc.NewManager(cfg, taskMgr, peerMgr, dfgetTaskMgr, progressMgr, cdnMgr, contributionMgr,
+		deadlineMgr, register)
+	if err != nil {
+		return nil, err
+	}
+
+	pieceErrorMgr, err := pieceerror.NewManager(cfg, gcMgr, cdnMgr, peerMgr, dfgetTaskMgr, progressMgr)
 	if err != nil {
 		return nil, err
 	}
@@ -121,22 +190,69 @@ func New(cfg *config.Config, logger *logrus.Logger, register prometheus.Register
 		return nil, err
 	}
 
+	replicationMgr, err := replication.NewManager(cfg, taskMgr, peerMgr, progressMgr, register)
+	if err != nil {
+		return nil, err
+	}
+
+	pushMgr, err := push.NewManager(cfg, taskMgr, peerMgr, dfgetTaskMgr, progressMgr, register)
+	if err != nil {
+		return nil, err
+	}
+
+	purgeMgr, err := purge.NewManager(cfg, gcMgr, peerMgr, dfgetTaskMgr)
+	if err != nil {
+		return nil, err
+	}
+
+	groupMgr, err := group.NewManager(cfg, dfgetTaskMgr)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatcher, err := newPieceDispatcher(cfg.DispatchWorkers, cfg.DispatchQueueSize, cfg.DispatchWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	edgeCaches, err := newEdgeCaches(cfg.EdgeCaches)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Server{
-		Config:        cfg,
-		PeerMgr:       peerMgr,
-		TaskMgr:       taskMgr,
-		DfgetTaskMgr:  dfgetTaskMgr,
-		ProgressMgr:   progressMgr,
-		GCMgr:         gcMgr,
-		PieceErrorMgr: pieceErrorMgr,
-		PreheatMgr:    preheatMgr,
-		originClient:  originClient,
+		Config:          cfg,
+		PeerMgr:         peerMgr,
+		TaskMgr:         taskMgr,
+		CDNMgr:          cdnMgr,
+		DfgetTaskMgr:    dfgetTaskMgr,
+		ProgressMgr:     progressMgr,
+		SchedulerMgr:    schedulerMgr,
+		GCMgr:           gcMgr,
+		PieceErrorMgr:   pieceErrorMgr,
+		PreheatMgr:      preheatMgr,
+		ContributionMgr: contributionMgr,
+		AnalyticsMgr:    analyticsMgr,
+		AnomalyMgr:      anomalyMgr,
+		DeadlineMgr:     deadlineMgr,
+		EventLogMgr:     eventLogMgr,
+		ReplicationMgr:  replicationMgr,
+		PushMgr:         pushMgr,
+		PurgeMgr:        purgeMgr,
+		GroupMgr:        groupMgr,
+		originClient:    originClient,
+		originStats:     originStats,
+		dispatcher:      dispatcher,
+		edgeCaches:      edgeCaches,
 	}, nil
 }
 
 // Start runs supernode server.
 func (s *Server) Start() error {
+	accessLog := accesslog.New("supernode", s.Config.AccessLogSampleRate, nil)
 	router := createRouter(s)
+	router.Path(accesslog.ConfigPath).Methods(http.MethodGet, http.MethodPut).
+		HandlerFunc(accessLog.ConfigHandler())
 
 	address := fmt.Sprintf("0.0.0.0:%d", s.Config.ListenPort)
 
@@ -146,15 +262,43 @@ func (s *Server) Start() error {
 		return err
 	}
 
+	if _, err := diagnostics.Serve("supernode", s.Config.AdminPort); err != nil {
+		return err
+	}
+
+	stopExporters, err := metricsutils.StartExporters("supernode", prometheus.DefaultGatherer, s.Config.MetricsExporters)
+	if err != nil {
+		return err
+	}
+	defer stopExporters()
+
+	// keep the logical clock expiring the peers and the tasks advancing
+	done := make(chan struct{})
+	defer close(done)
+	go s.Config.GetClock().Run(done)
+
 	// start to handle piece error
+	s.CDNMgr.StartScan(context.Background())
 	s.PieceErrorMgr.StartHandleError(context.Background())
 	s.GCMgr.StartGC(context.Background())
+	s.AnalyticsMgr.StartAggregation(context.Background())
+	s.AnomalyMgr.StartMonitor(context.Background())
+	s.ReplicationMgr.StartReplication(context.Background())
+	s.PushMgr.StartPush(context.Background())
 
 	server := &http.Server{
-		Handler:           router,
+		Handler:           accessLog.Handler(router),
 		ReadTimeout:       time.Minute * 10,
 		ReadHeaderTimeout: time.Minute * 10,
 		IdleTimeout:       time.Minute * 10,
 	}
+
+	// the connections are queued by the listener until they're served,
+	// so supernode is ready once all managers are started.
+	if _, err := systemd.Notify(systemd.StateReady); err != nil {
+		logrus.Warnf("failed to notify systemd: %v", err)
+	}
+	go systemd.RunWatchdog(done, systemd.HTTPCheck(systemd.LoopbackURL("http", l.Addr(), "/_ping"), nil))
+
 	return server.Serve(l)
 }
@@ -19,6 +19,14 @@ package server
 import (
 	"context"
 	"net/http"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/version"
+
+	"github.com/pkg/errors"
 )
 
 func (s *Server) ping(context context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
@@ -26,3 +34,44 @@ func (s *Server) ping(context context.Context, rw http.ResponseWriter, req *http
 	_, err = rw.Write([]byte{'O', 'K'})
 	return err
 }
+
+// getHealth returns the health of supernode, including the progress of the scan of the cached files.
+func (s *Server) getHealth(context context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, &types.SupernodeHealth{
+		CacheScan: s.CDNMgr.GetScanStatus(context),
+	})
+}
+
+func (s *Server) getVersion(context context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, version.Info("supernode", s.Config.Features()))
+}
+
+// probeBandwidth sends the bytes of the size in the query, so that dfget can
+// measure the bandwidth between them before downloading.
+func (s *Server) probeBandwidth(context context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	size := int64(config.DefaultBandwidthProbeSize)
+	if v := req.URL.Query().Get("size"); v != "" {
+		if size, err = strconv.ParseInt(v, 10, 64); err != nil || size < 0 {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "size: %s", v)
+		}
+	}
+	if size > int64(config.MaxBandwidthProbeSize) {
+		size = int64(config.MaxBandwidthProbeSize)
+	}
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	rw.WriteHeader(http.StatusOK)
+	buf := make([]byte, 64*1024)
+	for size > 0 {
+		n := int64(len(buf))
+		if n > size {
+			n = size
+		}
+		if _, err = rw.Write(buf[:n]); err != nil {
+			return nil
+		}
+		size -= n
+	}
+	return nil
+}
@@ -18,10 +18,22 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/task"
+	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
+	"github.com/dragonflyoss/Dragonfly/supernode/server/api"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
 func (s *Server) deleteTask(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
@@ -35,12 +47,277 @@ func (s *Server) deleteTask(ctx context.Context, rw http.ResponseWriter, req *ht
 	return nil
 }
 
+// headerTotalCount is the header of the response of listTasks
+// which tells the total number of the selected tasks.
+const headerTotalCount = "X-Total-Count"
+
+var taskCdnStatus = map[string]bool{
+	types.TaskInfoCdnStatusWAITING:     true,
+	types.TaskInfoCdnStatusRUNNING:     true,
+	types.TaskInfoCdnStatusFAILED:      true,
+	types.TaskInfoCdnStatusSUCCESS:     true,
+	types.TaskInfoCdnStatusSOURCEERROR: true,
+}
+
+// listTasks lists the tasks selected by the query parameters:
+// url is a regexp matching the task URL, status is repeatable,
+// minAge/maxAge are durations and minSize/maxSize are sizes like 10MB.
+// The tasks are paginated and sorted by pageNum, pageSize, sortKey and sortDirect.
+func (s *Server) listTasks(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	filter, err := parseTaskFilter(req)
+	if err != nil {
+		return err
+	}
+	tasks, total, err := s.TaskMgr.List(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if tasks == nil {
+		tasks = []*types.TaskInfo{}
+	}
+	for i, task := range tasks {
+		tasks[i] = mgr.RedactTask(task)
+	}
+
+	rw.Header().Set(headerTotalCount, strconv.Itoa(total))
+	return EncodeResponse(rw, http.StatusOK, tasks)
+}
+
+func parseTaskFilter(req *http.Request) (*mgr.TaskFilter, error) {
+	pageFilter, err := dutil.ParseFilter(req, mgr.TaskSortKeys)
+	if err != nil {
+		return nil, err
+	}
+	filter := &mgr.TaskFilter{PageFilter: *pageFilter}
+
+	params := req.URL.Query()
+	if v := params.Get("url"); v != "" {
+		if filter.URLPattern, err = regexp.Compile(v); err != nil {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "url: %v", err)
+		}
+	}
+	for _, status := range params["status"] {
+		if !taskCdnStatus[status] {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "status: %s", status)
+		}
+		filter.CdnStatus = append(filter.CdnStatus, status)
+	}
+
+	durations := map[string]*time.Duration{"minAge": &filter.MinAge, "maxAge": &filter.MaxAge}
+	for name, d := range durations {
+		if v := params.Get(name); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil {
+				return nil, errors.Wrapf(errortypes.ErrInvalidValue, "%s: %s", name, v)
+			}
+		}
+	}
+
+	sizes := map[string]*int64{"minSize": &filter.MinSize, "maxSize": &filter.MaxSize}
+	for name, size := range sizes {
+		if v := params.Get(name); v != "" {
+			fsize, err := fileutils.StringToFSize(v)
+			if err != nil {
+				return nil, errors.Wrapf(errortypes.ErrInvalidValue, "%s: %s", name, v)
+			}
+			*size = int64(fsize)
+		}
+	}
+	return filter, nil
+}
+
 func (s *Server) getTaskInfo(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
 	id := mux.Vars(req)["id"]
 	task, err := s.TaskMgr.Get(ctx, id)
 	if err != nil {
 		return err
 	}
-	return EncodeResponse(rw, http.StatusOK, task)
+	return EncodeResponse(rw, http.StatusOK, mgr.RedactTask(task))
+
+}
+
+// getSchedulerDecisions dumps the latest scheduler decisions of the task.
+// The max number of the returned decisions can be specified by the query parameter limit.
+func (s *Server) getSchedulerDecisions(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	limit := 0
+	if v := req.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "limit: %s", v)
+		}
+	}
+
+	decisions, err := s.SchedulerMgr.GetDecisions(ctx, id, limit)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, decisions)
+}
+
+// getTaskEventLogs returns the event logs of the downloads of the task uploaded by dfget,
+// which could be filtered by the cid.
+func (s *Server) getTaskEventLogs(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	logs, err := s.EventLogMgr.Get(ctx, id, req.URL.Query().Get("cid"))
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, logs)
+}
+
+// getTaskPieceMD5s returns the md5 of the pieces of the task, which could be used
+// to verify a local file without downloading the data.
+func (s *Server) getTaskPieceMD5s(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	query := &mgr.PieceMD5sQuery{}
+	for key, value := range map[string]*int{
+		"start":     &query.Start,
+		"limit":     &query.Limit,
+		"groupSize": &query.GroupSize,
+	} {
+		v := req.URL.Query().Get(key)
+		if v == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(v); err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "%s: %s", key, v)
+		}
+	}
+
+	pieceMD5s, err := s.TaskMgr.GetPieceMD5s(ctx, id, query)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, pieceMD5s)
+}
+
+// getPieceLayout returns the boundaries of the pieces which a file of the given length
+// is split into, so that the md5s of the pieces could be computed without CDN.
+func (s *Server) getPieceLayout(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	params := req.URL.Query()
+	fileLength, err := strconv.ParseInt(params.Get("fileLength"), 10, 64)
+	if err != nil {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "fileLength: %s", params.Get("fileLength"))
+	}
+	var pieceSize, start, limit int
+	for key, value := range map[string]*int{
+		"pieceSize": &pieceSize,
+		"start":     &start,
+		"limit":     &limit,
+	} {
+		v := params.Get(key)
+		if v == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(v); err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "%s: %s", key, v)
+		}
+	}
+
+	layout, err := task.PieceLayout(fileLength, int32(pieceSize), start, limit)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, layout)
+}
+
+// exportTaskBundle streams the bundle of the task which can be imported by
+// another supernode, such as one in an air-gapped environment.
+func (s *Server) exportTaskBundle(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.bundle", id))
+	return s.TaskMgr.ExportBundle(ctx, id, rw)
+}
+
+// importTaskBundle imports the bundle in the request body and returns the imported task.
+func (s *Server) importTaskBundle(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	task, err := s.TaskMgr.ImportBundle(ctx, req.Body)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, mgr.RedactTask(task))
+}
+
+// createTaskAlias declares the URLs in the request body as the mirrors of the same
+// content, and the registrations of them join the same task afterwards.
+func (s *Server) createTaskAlias(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.TaskAlias{}
+	if err := api.ParseJSONRequest(req.Body, request, request.Validate); err != nil {
+		return err
+	}
+	alias, err := s.TaskMgr.AddAlias(ctx, request)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusCreated, alias)
+}
+
+func (s *Server) listTaskAliases(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, s.TaskMgr.ListAliases(ctx))
+}
+
+func (s *Server) getTaskAlias(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	alias, err := s.TaskMgr.GetAlias(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, alias)
+}
+
+func (s *Server) deleteTaskAlias(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	if err := s.TaskMgr.DeleteAlias(ctx, mux.Vars(req)["id"]); err != nil {
+		return err
+	}
+	rw.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// createTaskManifest registers the task of the manifest in the request body, whose pieces
+// are verified against the piece md5s of the manifest before the CDN of the task finishes.
+func (s *Server) createTaskManifest(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.TaskManifest{}
+	if err := api.ParseJSONRequest(req.Body, request, request.Validate); err != nil {
+		return err
+	}
+	manifest, err := s.TaskMgr.AddManifest(ctx, request)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusCreated, manifest)
+}
+
+func (s *Server) getTaskManifest(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	manifest, err := s.TaskMgr.GetManifest(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, manifest)
+}
+
+func (s *Server) deleteTaskManifest(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	if err := s.TaskMgr.DeleteManifest(ctx, mux.Vars(req)["id"]); err != nil {
+		return err
+	}
+	rw.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) purgeTask(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	purge, err := s.PurgeMgr.Purge(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusAccepted, purge)
+}
+
+func (s *Server) getTaskPurge(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	purge, err := s.PurgeMgr.Get(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, purge)
+}
 
+func (s *Server) listPurges(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, s.PurgeMgr.List(ctx))
 }
@@ -35,6 +35,9 @@ var (
 
 	// ErrRangeNotSatisfiable represents the length of file is insufficient.
 	ErrRangeNotSatisfiable = StorageError{codeRangeNotSatisfiable, "range not satisfiable"}
+
+	// ErrNotSupported represents the operation is not supported by the storage.
+	ErrNotSupported = StorageError{codeNotSupported, "not supported"}
 )
 
 const (
@@ -42,6 +45,7 @@ const (
 	codeEmptyKey
 	codeInvalidValue
 	codeRangeNotSatisfiable
+	codeNotSupported
 )
 
 // StorageError represents a storage error.
@@ -80,6 +84,11 @@ func IsRangeNotSatisfiable(err error) bool {
 	return checkError(err, codeRangeNotSatisfiable)
 }
 
+// IsNotSupported checks the error is the operation is not supported or not.
+func IsNotSupported(err error) bool {
+	return checkError(err, codeNotSupported)
+}
+
 func checkError(err error, code int) bool {
 	e, ok := errors.Cause(err).(StorageError)
 	return ok && e.Code == code
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	statutils "github.com/dragonflyoss/Dragonfly/pkg/stat"
@@ -240,6 +241,84 @@ func (ls *localStorage) PutBytes(ctx context.Context, raw *Raw, data []byte) err
 	return nil
 }
 
+// Clone makes the content of dst share the content of src by reflinks.
+func (ls *localStorage) Clone(ctx context.Context, src, dst *Raw) error {
+	if src.Length <= 0 {
+		return errors.Wrapf(ErrInvalidValue, "the length of src must be positive")
+	}
+	if err := checkPutRaw(dst); err != nil {
+		return err
+	}
+
+	srcPath, info, err := ls.statPath(src.Bucket, src.Key)
+	if err != nil {
+		return err
+	}
+	if err := checkGetRaw(src, info.Size()); err != nil {
+		return err
+	}
+	dstPath, err := ls.preparePath(dst.Bucket, dst.Key)
+	if err != nil {
+		return err
+	}
+
+	lock(srcPath, src.Offset, true)
+	defer unLock(srcPath, src.Offset, true)
+	lock(dstPath, dst.Offset, false)
+	defer unLock(dstPath, dst.Offset, false)
+
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := fileutils.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if err := fileutils.CloneRange(srcFile, src.Offset, dstFile, dst.Offset, src.Length); err != nil {
+		if err == syscall.ENOTSUP {
+			return errors.Wrapf(ErrNotSupported, "clone %s to %s", srcPath, dstPath)
+		}
+		return err
+	}
+	return nil
+}
+
+// Preallocate allocates the disk space of the file without changing its size.
+func (ls *localStorage) Preallocate(ctx context.Context, raw *Raw) error {
+	if raw.Length <= 0 {
+		return errors.Wrapf(ErrInvalidValue, "the length must be positive")
+	}
+	if err := checkPutRaw(raw); err != nil {
+		return err
+	}
+
+	path, err := ls.preparePath(raw.Bucket, raw.Key)
+	if err != nil {
+		return err
+	}
+
+	lock(path, raw.Offset, false)
+	defer unLock(path, raw.Offset, false)
+
+	f, err := fileutils.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := fileutils.Preallocate(f, raw.Offset, raw.Length); err != nil {
+		if err == syscall.ENOTSUP {
+			return errors.Wrapf(ErrNotSupported, "preallocate %s", path)
+		}
+		return err
+	}
+	return nil
+}
+
 // Stat determines whether the file exists.
 func (ls *localStorage) Stat(ctx context.Context, raw *Raw) (*StorageInfo, error) {
 	_, fileInfo, err := ls.statPath(raw.Bucket, raw.Key)
@@ -370,6 +370,47 @@ func (s *LocalStorageSuite) TestPutParallel(c *check.C) {
 	c.Check(info.Size, check.Equals, int64(routineCount)*int64(testStrLength))
 }
 
+func (s *LocalStorageSuite) TestClone(c *check.C) {
+	data := strings.Repeat("a", 4096)
+	c.Assert(s.storeLocal.PutBytes(context.TODO(), &Raw{Key: "fooCloneSrc"}, []byte(data)), check.IsNil)
+
+	err := s.storeLocal.Clone(context.TODO(), &Raw{Key: "fooCloneSrc"}, &Raw{Key: "fooCloneDst"})
+	c.Check(IsInvalidValue(err), check.Equals, true)
+
+	src := &Raw{Key: "fooCloneSrc", Length: int64(len(data))}
+	err = s.storeLocal.Clone(context.TODO(), src, &Raw{Key: "fooCloneDst", Offset: 4096})
+	if IsNotSupported(err) {
+		c.Skip("the file system doesn't support reflinks")
+	}
+	c.Assert(err, check.IsNil)
+
+	result, err := s.storeLocal.GetBytes(context.TODO(), &Raw{Key: "fooCloneDst", Offset: 4096})
+	c.Assert(err, check.IsNil)
+	c.Check(string(result), check.Equals, data)
+}
+
+func (s *LocalStorageSuite) TestPreallocate(c *check.C) {
+	err := s.storeLocal.Preallocate(context.TODO(), &Raw{Key: "fooPreallocate"})
+	c.Check(IsInvalidValue(err), check.Equals, true)
+
+	err = s.storeLocal.Preallocate(context.TODO(), &Raw{Key: "fooPreallocate", Length: 1 << 20})
+	if IsNotSupported(err) {
+		c.Skip("the file system doesn't support preallocation")
+	}
+	c.Assert(err, check.IsNil)
+
+	// the size of the file isn't changed
+	info, err := s.storeLocal.Stat(context.TODO(), &Raw{Key: "fooPreallocate"})
+	c.Assert(err, check.IsNil)
+	c.Check(info.Size, check.Equals, int64(0))
+
+	data := []byte("hello dragonfly")
+	c.Assert(s.storeLocal.PutBytes(context.TODO(), &Raw{Key: "fooPreallocate"}, data), check.IsNil)
+	result, err := s.storeLocal.GetBytes(context.TODO(), &Raw{Key: "fooPreallocate"})
+	c.Assert(err, check.IsNil)
+	c.Check(result, check.DeepEquals, data)
+}
+
 func (s *LocalStorageSuite) BenchmarkPutParallel(c *check.C) {
 	var wg sync.WaitGroup
 	for k := 0; k < c.N; k++ {
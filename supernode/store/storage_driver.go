@@ -69,6 +69,24 @@ type StorageDriver interface {
 	Walk(ctx context.Context, raw *Raw) error
 }
 
+// Cloner is an optional interface of StorageDriver, which makes the data of
+// the dst share the data of the src without copying it.
+type Cloner interface {
+	// Clone makes the data of dst starting at dst.Offset share the data of src
+	// which starts from src.Offset and the length is src.Length.
+	// The ErrNotSupported should be returned if the storage doesn't support it.
+	Clone(ctx context.Context, src, dst *Raw) error
+}
+
+// Preallocator is an optional interface of StorageDriver, which reserves the space
+// of the data before it's written.
+type Preallocator interface {
+	// Preallocate reserves the space of the data which starts from raw.Offset and
+	// the length is raw.Length, without changing the size of the data.
+	// The ErrNotSupported should be returned if the storage doesn't support it.
+	Preallocate(ctx context.Context, raw *Raw) error
+}
+
 // Raw identifies a piece of data uniquely.
 // If the length<=0, it represents all data.
 type Raw struct {
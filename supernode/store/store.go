@@ -108,6 +108,35 @@ func (s *Store) Remove(ctx context.Context, raw *Raw) error {
 	return s.driver.Remove(ctx, raw)
 }
 
+// Clone makes the data of dst share the data of src without copying it,
+// and the ErrNotSupported is returned if the storage driver doesn't support it.
+func (s *Store) Clone(ctx context.Context, src, dst *Raw) error {
+	if err := checkEmptyKey(src); err != nil {
+		return err
+	}
+	if err := checkEmptyKey(dst); err != nil {
+		return err
+	}
+	cloner, ok := s.driver.(Cloner)
+	if !ok {
+		return errors.Wrapf(ErrNotSupported, "storage driver %s", s.driverName)
+	}
+	return cloner.Clone(ctx, src, dst)
+}
+
+// Preallocate reserves the space of the data before it's written,
+// and the ErrNotSupported is returned if the storage driver doesn't support it.
+func (s *Store) Preallocate(ctx context.Context, raw *Raw) error {
+	if err := checkEmptyKey(raw); err != nil {
+		return err
+	}
+	preallocator, ok := s.driver.(Preallocator)
+	if !ok {
+		return errors.Wrapf(ErrNotSupported, "storage driver %s", s.driverName)
+	}
+	return preallocator.Preallocate(ctx, raw)
+}
+
 // Stat determines whether the data exists based on raw information.
 // If that, and return some info that in the form of struct StorageInfo.
 // If not, return the ErrNotFound.
@@ -0,0 +1,455 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package conformance replays the golden fixtures of the protocols of Dragonfly
+// against an implementation, so that the refactors and the third-party supernodes
+// and peers can validate that they're compatible on the wire.
+//
+// A fixture is a JSON file describing a Scenario, which is a sequence of HTTP
+// requests sent to one protocol and the responses expected of them. The expected
+// responses may contain placeholders, see Expect for how they're matched.
+package conformance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The protocols covered by the fixtures.
+const (
+	// ProtocolSupernode is the protocol between dfget and supernode.
+	ProtocolSupernode = "supernode"
+
+	// ProtocolPeer is the protocol between the peers, which is served by the uploader of dfget.
+	ProtocolPeer = "peer"
+)
+
+// Scenario is a sequence of the requests sent to a protocol in the order.
+type Scenario struct {
+	// Name identifies the scenario, it's the name of the fixture file if it's empty.
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Protocol is the protocol which the requests are sent to.
+	Protocol string `json:"protocol"`
+
+	Steps []*Step `json:"steps"`
+}
+
+// Step is a request and the response expected of it.
+type Step struct {
+	Name    string   `json:"name"`
+	Request *Request `json:"request"`
+	Expect  *Expect  `json:"expect"`
+
+	// Local indicates that the step prepares the state of the in-process implementation
+	// with an API which isn't part of the protocol, and it's skipped for the other ones.
+	Local bool `json:"local,omitempty"`
+
+	// Retry resends the request until the response matches, which is used
+	// to wait for the state changed asynchronously, such as the CDN of a task.
+	Retry *Retry `json:"retry,omitempty"`
+}
+
+// Retry is the policy of resending a request.
+type Retry struct {
+	Attempts int      `json:"attempts"`
+	Interval Duration `json:"interval"`
+}
+
+// Duration is a time.Duration decoded from the string like 100ms.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+// Request is an HTTP request, and the placeholders ${name} in its path, headers
+// and body are replaced with the variables of the Runner.
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// JSON is the body sent as application/json.
+	JSON interface{} `json:"json,omitempty"`
+
+	// Form is the body sent as application/x-www-form-urlencoded.
+	Form map[string]string `json:"form,omitempty"`
+}
+
+// Expect is the expected response.
+//
+// The strings of Headers, Body and JSON are matched after the placeholders are replaced,
+// and two more placeholders are recognized when they're the whole string:
+// ${any} matches any value, and ${capture:name} matches any value and sets it as
+// the variable name for the following steps.
+//
+// The objects of JSON match the ones with the same fields and any extra fields,
+// so that the fields can be added to the protocol compatibly.
+type Expect struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is the whole body in text.
+	Body *string `json:"body,omitempty"`
+
+	// BodyHex is the whole body in hex, which is used for the binary bodies such as pieces.
+	BodyHex string `json:"bodyHex,omitempty"`
+
+	// JSON is the body decoded as JSON.
+	JSON interface{} `json:"json,omitempty"`
+}
+
+// LoadScenarios loads the scenarios of the fixtures matching the pattern, such as testdata/*/*.json.
+func LoadScenarios(pattern string) ([]*Scenario, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var scenarios []*Scenario
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		scenario := &Scenario{}
+		if err := json.Unmarshal(b, scenario); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+		if scenario.Name == "" {
+			scenario.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, nil
+}
+
+// Runner runs the scenarios against the implementations of the protocols.
+type Runner struct {
+	// Targets are the base URLs of the implementations of the protocols,
+	// such as http://127.0.0.1:8002 of ProtocolSupernode.
+	Targets map[string]string
+
+	// Vars are the variables replacing the placeholders. The ones captured
+	// by a scenario are only visible to its following steps.
+	Vars map[string]string
+
+	// Local are the protocols whose targets are the in-process implementations,
+	// the local steps of the scenarios of the other protocols are skipped.
+	Local map[string]bool
+
+	Client *http.Client
+}
+
+// Run runs the steps of the scenario in the order and returns the first mismatch.
+func (r *Runner) Run(scenario *Scenario) error {
+	target, ok := r.Targets[scenario.Protocol]
+	if !ok {
+		return fmt.Errorf("no target of protocol %s", scenario.Protocol)
+	}
+
+	vars := make(map[string]string, len(r.Vars))
+	for k, v := range r.Vars {
+		vars[k] = v
+	}
+	for i, step := range scenario.Steps {
+		if step.Local && !r.Local[scenario.Protocol] {
+			continue
+		}
+		if err := r.runStep(target, step, vars); err != nil {
+			return fmt.Errorf("step %d %s: %v", i, step.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) runStep(target string, step *Step, vars map[string]string) (err error) {
+	attempts, interval := 1, time.Duration(0)
+	if step.Retry != nil {
+		attempts, interval = step.Retry.Attempts, time.Duration(step.Retry.Interval)
+	}
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		// the variables are only captured by the matched response
+		captured := make(map[string]string)
+		if err = r.send(target, step, vars, captured); err == nil {
+			for k, v := range captured {
+				vars[k] = v
+			}
+			return nil
+		}
+	}
+	return err
+}
+
+func (r *Runner) send(target string, step *Step, vars, captured map[string]string) error {
+	req, err := newHTTPRequest(target, step.Request, vars)
+	if err != nil {
+		return err
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return matchResponse(step.Expect, resp, body, vars, captured)
+}
+
+func newHTTPRequest(target string, r *Request, vars map[string]string) (*http.Request, error) {
+	path, err := expand(r.Path, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	contentType := ""
+	switch {
+	case r.JSON != nil:
+		v, err := expandValue(r.JSON, vars)
+		if err != nil {
+			return nil, err
+		}
+		if body, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+		contentType = "application/json"
+	case r.Form != nil:
+		form := url.Values{}
+		for k, v := range r.Form {
+			if v, err = expand(v, vars); err != nil {
+				return nil, err
+			}
+			form.Set(k, v)
+		}
+		body = []byte(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	req, err := http.NewRequest(r.Method, strings.TrimSuffix(target, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range r.Headers {
+		if v, err = expand(v, vars); err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func matchResponse(e *Expect, resp *http.Response, body []byte, vars, captured map[string]string) error {
+	if e == nil {
+		return nil
+	}
+	if e.Status != 0 && resp.StatusCode != e.Status {
+		return fmt.Errorf("status %d, expected %d: %s", resp.StatusCode, e.Status, body)
+	}
+	for k, v := range e.Headers {
+		if err := matchString("header "+k, v, resp.Header.Get(k), vars, captured); err != nil {
+			return err
+		}
+	}
+	if e.Body != nil {
+		if err := matchString("body", *e.Body, string(body), vars, captured); err != nil {
+			return err
+		}
+	}
+	if e.BodyHex != "" {
+		if actual := hex.EncodeToString(body); actual != e.BodyHex {
+			return fmt.Errorf("body %s, expected %s", actual, e.BodyHex)
+		}
+	}
+	if e.JSON != nil {
+		var actual interface{}
+		if err := json.Unmarshal(body, &actual); err != nil {
+			return fmt.Errorf("body isn't JSON: %v: %s", err, body)
+		}
+		if err := matchValue("body", e.JSON, actual, vars, captured); err != nil {
+			return fmt.Errorf("%v: %s", err, body)
+		}
+	}
+	return nil
+}
+
+var (
+	placeholder        = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+	capturePlaceholder = regexp.MustCompile(`^\$\{capture:([A-Za-z0-9_.-]+)\}$`)
+)
+
+const anyPlaceholder = "${any}"
+
+// expand replaces the placeholders in s with the variables.
+func expand(s string, vars map[string]string) (string, error) {
+	var err error
+	result := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined variable %s", name)
+		}
+		return v
+	})
+	return result, err
+}
+
+// expandValue replaces the placeholders in the strings of the JSON value.
+func expandValue(v interface{}, vars map[string]string) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return expand(v, vars)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i := range v {
+			e, err := expandValue(v[i], vars)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = e
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k := range v {
+			e, err := expandValue(v[k], vars)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = e
+		}
+		return result, nil
+	}
+	return v, nil
+}
+
+// matchString matches the actual string with the expected one which may be a placeholder.
+func matchString(path, expected, actual string, vars, captured map[string]string) error {
+	if expected == anyPlaceholder {
+		return nil
+	}
+	if m := capturePlaceholder.FindStringSubmatch(expected); m != nil {
+		captured[m[1]] = actual
+		return nil
+	}
+	expected, err := expand(expected, vars)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("%s is %q, expected %q", path, actual, expected)
+	}
+	return nil
+}
+
+// matchValue matches the actual JSON value with the expected one recursively.
+func matchValue(path string, expected, actual interface{}, vars, captured map[string]string) error {
+	if s, ok := expected.(string); ok {
+		if s == anyPlaceholder {
+			return nil
+		}
+		if m := capturePlaceholder.FindStringSubmatch(s); m != nil {
+			captured[m[1]] = formatValue(actual)
+			return nil
+		}
+		a, ok := actual.(string)
+		if !ok {
+			return fmt.Errorf("%s is %v, expected a string", path, actual)
+		}
+		return matchString(path, s, a, vars, captured)
+	}
+
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is %v, expected an object", path, actual)
+		}
+		keys := make([]string, 0, len(expected))
+		for k := range expected {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v, ok := a[k]
+			if !ok {
+				return fmt.Errorf("%s.%s is missing", path, k)
+			}
+			if err := matchValue(path+"."+k, expected[k], v, vars, captured); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(expected) {
+			return fmt.Errorf("%s is %v, expected %d elements", path, actual, len(expected))
+		}
+		for i := range expected {
+			if err := matchValue(fmt.Sprintf("%s[%d]", path, i), expected[i], a[i], vars, captured); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		return fmt.Errorf("%s is %v, expected %v", path, actual, expected)
+	}
+	return nil
+}
+
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conformance
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dfgetConfig "github.com/dragonflyoss/Dragonfly/dfget/config"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/core/uploader"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon"
+	_ "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/cdn"
+	_ "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/sourcecdn"
+
+	"github.com/go-check/check"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	supernodeTarget = flag.String("conformance.supernode", "",
+		"the base URL of the supernode to validate, an in-process one is started if it's empty")
+	peerTarget = flag.String("conformance.peer", "",
+		"the base URL of the peer to validate, an in-process one is started if it's empty")
+	originURL = flag.String("conformance.origin", "",
+		"the base URL of the origin serving testdata/files, which must be reachable by the supernode, "+
+			"an in-process one is started if it's empty")
+	fixtures = flag.String("conformance.fixtures", "testdata/*/*.json", "the pattern of the fixture files")
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&ConformanceSuite{})
+}
+
+type ConformanceSuite struct {
+	workHome string
+	runner   *Runner
+	origin   *httptest.Server
+}
+
+func (s *ConformanceSuite) SetUpSuite(c *check.C) {
+	var err error
+	s.workHome, err = ioutil.TempDir("", "dragonfly-ConformanceSuite-")
+	c.Assert(err, check.IsNil)
+	logrus.SetOutput(ioutil.Discard)
+
+	origin := *originURL
+	if origin == "" {
+		s.origin = httptest.NewServer(http.FileServer(http.Dir("testdata/files")))
+		origin = s.origin.URL
+	}
+	s.runner = &Runner{
+		Targets: map[string]string{
+			ProtocolSupernode: *supernodeTarget,
+			ProtocolPeer:      *peerTarget,
+		},
+		Vars: map[string]string{"origin": origin},
+		Local: map[string]bool{
+			ProtocolSupernode: *supernodeTarget == "",
+			ProtocolPeer:      *peerTarget == "",
+		},
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if *supernodeTarget == "" {
+		s.runner.Targets[ProtocolSupernode], err = startSupernode(filepath.Join(s.workHome, "supernode"))
+		c.Assert(err, check.IsNil)
+	}
+	if *peerTarget == "" {
+		s.runner.Targets[ProtocolPeer], err = startPeer(filepath.Join(s.workHome, "dfget"))
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *ConformanceSuite) TearDownSuite(c *check.C) {
+	if s.origin != nil {
+		s.origin.Close()
+	}
+	os.RemoveAll(s.workHome)
+}
+
+func (s *ConformanceSuite) TestFixtures(c *check.C) {
+	scenarios, err := LoadScenarios(*fixtures)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(scenarios) > 0, check.Equals, true)
+
+	for _, scenario := range scenarios {
+		err := s.runner.Run(scenario)
+		c.Check(err, check.IsNil, check.Commentf("%s/%s", scenario.Protocol, scenario.Name))
+	}
+}
+
+func (s *ConformanceSuite) TestMatch(c *check.C) {
+	vars := map[string]string{"id": "foo"}
+	captured := map[string]string{}
+	expected := map[string]interface{}{
+		"id":    "${id}",
+		"size":  float64(3),
+		"cid":   "${capture:cid}",
+		"extra": "${any}",
+		"list":  []interface{}{"a"},
+	}
+	actual := map[string]interface{}{
+		"id":    "foo",
+		"size":  float64(3),
+		"cid":   "bar",
+		"extra": float64(1),
+		"list":  []interface{}{"a"},
+		"added": true,
+	}
+	c.Check(matchValue("body", expected, actual, vars, captured), check.IsNil)
+	c.Check(captured["cid"], check.Equals, "bar")
+
+	actual["id"] = "bar"
+	c.Check(matchValue("body", expected, actual, vars, captured), check.ErrorMatches, `body.id is "bar", expected "foo"`)
+	delete(actual, "extra")
+	actual["id"] = "foo"
+	c.Check(matchValue("body", expected, actual, vars, captured), check.ErrorMatches, "body.extra is missing")
+
+	_, err := expand("${undefined}", vars)
+	c.Check(err, check.NotNil)
+}
+
+// startSupernode starts a supernode in the process and returns its base URL.
+func startSupernode(home string) (string, error) {
+	port, err := freePort()
+	if err != nil {
+		return "", err
+	}
+	cfg := config.NewConfig()
+	cfg.HomeDir = home
+	cfg.ListenPort = port
+	cfg.AdvertiseIP = "127.0.0.1"
+	cfg.SetCIDPrefix(cfg.AdvertiseIP)
+
+	d, err := daemon.New(cfg, logrus.StandardLogger())
+	if err != nil {
+		return "", err
+	}
+	if err := d.RegisterSuperNode(); err != nil {
+		return "", err
+	}
+	go d.Run()
+
+	target := fmt.Sprintf("http://127.0.0.1:%d", port)
+	return target, waitFor(target + "/_ping")
+}
+
+// startPeer starts a peer server in the process and returns its base URL.
+func startPeer(workHome string) (string, error) {
+	// the logger is set up once by the suite before the supernode starts logging,
+	// so the config isn't created by helper.CreateConfig which resets its output
+	cfg := dfgetConfig.NewConfig()
+	cfg.WorkHome = workHome
+	cfg.RV.MetaPath = filepath.Join(workHome, "meta", "host.meta")
+	cfg.RV.SystemDataDir = filepath.Join(workHome, "data")
+	if err := os.MkdirAll(filepath.Dir(cfg.RV.MetaPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(cfg.RV.SystemDataDir, 0755); err != nil {
+		return "", err
+	}
+	cfg.RV.LocalIP = "127.0.0.1"
+	cfg.RV.ServerAliveTime = 0
+
+	port, err := uploader.LaunchPeerServer(cfg)
+	if err != nil {
+		return "", err
+	}
+	target := fmt.Sprintf("http://127.0.0.1:%d", port)
+	if err := waitFor(target + dfgetConfig.LocalHTTPPing); err != nil {
+		return "", err
+	}
+
+	// The files are served as the ones downloaded completely by dfget. They're
+	// registered to the peer server before being written, otherwise they're
+	// removed by its gc as the files of the unknown tasks.
+	files, err := filepath.Glob("testdata/files/*")
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		if err := waitFor(fmt.Sprintf("%s%sfinish?taskFileName=%s&taskID=%s&cid=%s",
+			target, dfgetConfig.LocalHTTPPathClient, name, name, name)); err != nil {
+			return "", err
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		serviceFile := helper.GetServiceFile(name, cfg.RV.SystemDataDir)
+		if err := ioutil.WriteFile(serviceFile, b, 0644); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func waitFor(url string) (err error) {
+	for i := 0; i < 50; i++ {
+		var resp *http.Response
+		if resp, err = http.Get(url); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("%s responds %d", url, resp.StatusCode)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
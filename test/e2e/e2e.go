@@ -0,0 +1,249 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package e2e launches a local Dragonfly cluster of a supernode, several dfget peers
+// and a mock origin, and runs the scripted distribution scenarios against it, so that
+// the bugs of the p2p distribution can be reproduced with a single command.
+//
+// A scenario is a JSON file describing the files served by the origin, the number of
+// the peers, the config of the supernode and the steps downloading the files. The
+// efficiency of every step is summarized from the summaries written by dfget, and it's
+// checked against the expectations of the scenario, see Expect.
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scenario is a sequence of the downloads run against a launched cluster.
+type Scenario struct {
+	// Name identifies the scenario, it's the name of the scenario file if it's empty.
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Files are the files served by the origin.
+	Files []*File `json:"files"`
+
+	// Peers is the number of the dfget peers, which are referred to by their
+	// indexes in the steps.
+	Peers int `json:"peers"`
+
+	// Supernode is the base properties of the supernode, such as
+	// {"cdnPattern": "source"}. The ports and the home directory are always
+	// set by the launcher.
+	Supernode map[string]interface{} `json:"supernode,omitempty"`
+
+	// DfgetArgs are the extra arguments of every download, such as ["--notbs"].
+	DfgetArgs []string `json:"dfgetArgs,omitempty"`
+
+	Steps []*Step `json:"steps"`
+
+	// Expect is checked against all downloads of the scenario after the steps are run.
+	Expect *Expect `json:"expect,omitempty"`
+}
+
+// File is a file served by the origin, its content is generated from its name.
+type File struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Step downloads a file by some peers.
+type Step struct {
+	Name string `json:"name"`
+
+	// File is the name of the file downloaded.
+	File string `json:"file"`
+
+	// Peers are the indexes of the peers downloading the file.
+	Peers []int `json:"peers"`
+
+	// Concurrent indicates that the peers download the file at the same time,
+	// otherwise they download it one by one.
+	Concurrent bool `json:"concurrent,omitempty"`
+
+	Expect *Expect `json:"expect,omitempty"`
+}
+
+// Expect is the expected efficiency of the downloads. The zero values aren't checked.
+type Expect struct {
+	// MinPeerRatio is the min ratio of the bytes downloaded from the other peers
+	// to the bytes of the downloaded files.
+	MinPeerRatio float64 `json:"minPeerRatio,omitempty"`
+
+	// MaxSupernodeRatio is the max ratio of the bytes downloaded from supernode
+	// to the bytes of the downloaded files.
+	MaxSupernodeRatio float64 `json:"maxSupernodeRatio,omitempty"`
+
+	// MaxSourceRatio is the max ratio of the bytes served by the origin, including
+	// the ones fetched by the CDN of supernode, to the bytes of the distinct files.
+	// It's only checked against the whole scenario.
+	MaxSourceRatio float64 `json:"maxSourceRatio,omitempty"`
+
+	// MaxDuration is the max duration of a step.
+	MaxDuration Duration `json:"maxDuration,omitempty"`
+}
+
+// Duration is a time.Duration decoded from the string like 30s.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenarios loads the scenarios of the files matching the pattern, such as testdata/*.json.
+func LoadScenarios(pattern string) ([]*Scenario, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var scenarios []*Scenario
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		scenario := &Scenario{}
+		if err := json.Unmarshal(b, scenario); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+		if scenario.Name == "" {
+			scenario.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		if err := scenario.validate(); err != nil {
+			return nil, fmt.Errorf("invalid scenario %s: %v", file, err)
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, nil
+}
+
+func (s *Scenario) validate() error {
+	if s.Peers <= 0 {
+		return fmt.Errorf("peers must be positive")
+	}
+	files := make(map[string]bool, len(s.Files))
+	for _, f := range s.Files {
+		if f.Name == "" || strings.Contains(f.Name, "/") || f.Size < 0 {
+			return fmt.Errorf("invalid file %q", f.Name)
+		}
+		files[f.Name] = true
+	}
+	for i, step := range s.Steps {
+		if !files[step.File] {
+			return fmt.Errorf("step %d %s: unknown file %q", i, step.Name, step.File)
+		}
+		if len(step.Peers) == 0 {
+			return fmt.Errorf("step %d %s: no peers", i, step.Name)
+		}
+		for _, p := range step.Peers {
+			if p < 0 || p >= s.Peers {
+				return fmt.Errorf("step %d %s: peer %d out of range [0, %d)", i, step.Name, p, s.Peers)
+			}
+		}
+	}
+	return nil
+}
+
+// Summary is the summary of a download written by dfget with --summary-file.
+type Summary struct {
+	Peer           int     `json:"peer"`
+	Success        bool    `json:"success"`
+	Duration       float64 `json:"duration"`
+	FileLength     int64   `json:"fileLength"`
+	PeerBytes      int64   `json:"peerBytes"`
+	SupernodeBytes int64   `json:"supernodeBytes"`
+	SourceBytes    int64   `json:"sourceBytes"`
+	Retries        int64   `json:"retries"`
+}
+
+// StepReport is the result of a step.
+type StepReport struct {
+	Name      string     `json:"name"`
+	Duration  Duration   `json:"duration"`
+	Downloads []*Summary `json:"downloads"`
+
+	PeerRatio      float64 `json:"peerRatio"`
+	SupernodeRatio float64 `json:"supernodeRatio"`
+}
+
+// Report is the result of a scenario.
+type Report struct {
+	Scenario string        `json:"scenario"`
+	Steps    []*StepReport `json:"steps"`
+
+	// OriginBytes is the number of the bytes served by the origin.
+	OriginBytes int64 `json:"originBytes"`
+
+	PeerRatio      float64 `json:"peerRatio"`
+	SupernodeRatio float64 `json:"supernodeRatio"`
+	SourceRatio    float64 `json:"sourceRatio"`
+}
+
+// summarize computes the ratios of the bytes of the downloads.
+func summarize(downloads []*Summary) (peerRatio, supernodeRatio float64) {
+	var total, peer, supernode int64
+	for _, d := range downloads {
+		total += d.FileLength
+		peer += d.PeerBytes
+		supernode += d.SupernodeBytes
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(peer) / float64(total), float64(supernode) / float64(total)
+}
+
+// check returns the violations of the expectation by the ratios and the duration.
+func (e *Expect) check(peerRatio, supernodeRatio, sourceRatio float64, duration time.Duration) []string {
+	if e == nil {
+		return nil
+	}
+	var violations []string
+	if e.MinPeerRatio > 0 && peerRatio < e.MinPeerRatio {
+		violations = append(violations, fmt.Sprintf("peer ratio %.3f < %.3f", peerRatio, e.MinPeerRatio))
+	}
+	if e.MaxSupernodeRatio > 0 && supernodeRatio > e.MaxSupernodeRatio {
+		violations = append(violations, fmt.Sprintf("supernode ratio %.3f > %.3f", supernodeRatio, e.MaxSupernodeRatio))
+	}
+	if e.MaxSourceRatio > 0 && sourceRatio > e.MaxSourceRatio {
+		violations = append(violations, fmt.Sprintf("source ratio %.3f > %.3f", sourceRatio, e.MaxSourceRatio))
+	}
+	if e.MaxDuration > 0 && duration > time.Duration(e.MaxDuration) {
+		violations = append(violations, fmt.Sprintf("duration %v > %v", duration, time.Duration(e.MaxDuration)))
+	}
+	return violations
+}
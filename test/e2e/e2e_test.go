@@ -0,0 +1,138 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package e2e
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-check/check"
+)
+
+var (
+	supernodeBinary = flag.String("e2e.supernode", "",
+		"the path of the supernode binary, the one of the repo is built if it's empty")
+	dfgetBinary = flag.String("e2e.dfget", "",
+		"the path of the dfget binary, the one of the repo is built if it's empty")
+	scenarioFiles = flag.String("e2e.scenarios", "testdata/*.json", "the pattern of the scenario files")
+	keep          = flag.Bool("e2e.keep", false,
+		"keep the work home with the logs and the reports of the scenarios")
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&E2ESuite{})
+}
+
+type E2ESuite struct {
+	workHome string
+	binaries *Binaries
+}
+
+func (s *E2ESuite) SetUpSuite(c *check.C) {
+	if testing.Short() {
+		c.Skip("the e2e test is skipped in the short mode")
+	}
+	var err error
+	s.workHome, err = ioutil.TempDir("", "dragonfly-E2ESuite-")
+	c.Assert(err, check.IsNil)
+
+	s.binaries = &Binaries{Supernode: *supernodeBinary, Dfget: *dfgetBinary}
+	if s.binaries.Supernode == "" || s.binaries.Dfget == "" {
+		built, err := BuildBinaries(filepath.Join(s.workHome, "bin"))
+		c.Assert(err, check.IsNil)
+		if s.binaries.Supernode == "" {
+			s.binaries.Supernode = built.Supernode
+		}
+		if s.binaries.Dfget == "" {
+			s.binaries.Dfget = built.Dfget
+		}
+	}
+}
+
+func (s *E2ESuite) TearDownSuite(c *check.C) {
+	if *keep {
+		c.Logf("the logs and the reports are kept in %s", s.workHome)
+		return
+	}
+	os.RemoveAll(s.workHome)
+}
+
+func (s *E2ESuite) TestScenarios(c *check.C) {
+	scenarios, err := LoadScenarios(*scenarioFiles)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(scenarios) > 0, check.Equals, true)
+
+	for _, scenario := range scenarios {
+		workHome := filepath.Join(s.workHome, scenario.Name)
+		c.Assert(os.MkdirAll(workHome, 0755), check.IsNil)
+		cluster, err := Launch(scenario, s.binaries, workHome)
+		c.Assert(err, check.IsNil, check.Commentf("launch %s", scenario.Name))
+
+		report, err := cluster.Run()
+		cluster.Close()
+		b, _ := json.MarshalIndent(report, "", "  ")
+		ioutil.WriteFile(filepath.Join(workHome, "report.json"), b, 0644)
+		c.Logf("%s: %s", scenario.Name, b)
+		c.Check(err, check.IsNil, check.Commentf("%s, see %s", scenario.Name, workHome))
+	}
+}
+
+func (s *E2ESuite) TestExpect(c *check.C) {
+	var e *Expect
+	c.Check(e.check(0, 1, 1, time.Hour), check.HasLen, 0)
+
+	e = &Expect{MinPeerRatio: 0.5, MaxSupernodeRatio: 0.5, MaxSourceRatio: 1.1, MaxDuration: Duration(time.Minute)}
+	c.Check(e.check(0.5, 0.5, 1, time.Second), check.HasLen, 0)
+	c.Check(e.check(0.4, 0.6, 2, time.Hour), check.DeepEquals, []string{
+		"peer ratio 0.400 < 0.500",
+		"supernode ratio 0.600 > 0.500",
+		"source ratio 2.000 > 1.100",
+		"duration 1h0m0s > 1m0s",
+	})
+
+	peerRatio, supernodeRatio := summarize([]*Summary{
+		{FileLength: 100, SupernodeBytes: 100},
+		{FileLength: 100, PeerBytes: 50, SupernodeBytes: 50},
+	})
+	c.Check(peerRatio, check.Equals, 0.25)
+	c.Check(supernodeRatio, check.Equals, 0.75)
+}
+
+func (s *E2ESuite) TestValidate(c *check.C) {
+	scenario := &Scenario{
+		Files: []*File{{Name: "a", Size: 1}},
+		Peers: 2,
+		Steps: []*Step{{File: "a", Peers: []int{0, 1}}},
+	}
+	c.Check(scenario.validate(), check.IsNil)
+
+	scenario.Steps[0].Peers = []int{2}
+	c.Check(scenario.validate(), check.ErrorMatches, `step 0 : peer 2 out of range \[0, 2\)`)
+	scenario.Steps[0].File = "b"
+	c.Check(scenario.validate(), check.ErrorMatches, `step 0 : unknown file "b"`)
+	scenario.Peers = 0
+	c.Check(scenario.validate(), check.ErrorMatches, "peers must be positive")
+}
@@ -0,0 +1,441 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dfgetConfig "github.com/dragonflyoss/Dragonfly/dfget/config"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultStepTimeout is the timeout of a download whose step has no MaxDuration.
+const defaultStepTimeout = 5 * time.Minute
+
+// Binaries are the paths of the binaries the cluster is launched with.
+type Binaries struct {
+	Supernode string
+	Dfget     string
+}
+
+// BuildBinaries builds the supernode and dfget of the repo into the directory.
+func BuildBinaries(dir string) (*Binaries, error) {
+	b := &Binaries{
+		Supernode: filepath.Join(dir, "supernode"),
+		Dfget:     filepath.Join(dir, "dfget"),
+	}
+	for pkg, out := range map[string]string{
+		"github.com/dragonflyoss/Dragonfly/cmd/supernode": b.Supernode,
+		"github.com/dragonflyoss/Dragonfly/cmd/dfget":     b.Dfget,
+	} {
+		if output, err := exec.Command("go", "build", "-o", out, pkg).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to build %s: %v: %s", pkg, err, output)
+		}
+	}
+	return b, nil
+}
+
+// Cluster is a supernode, the dfget peers and the origin launched for a scenario.
+// The logs of the processes are kept in the work home.
+type Cluster struct {
+	WorkHome string
+
+	scenario  *Scenario
+	binaries  *Binaries
+	origin    *Origin
+	repo      *httptest.Server
+	supernode *exec.Cmd
+	node      string
+	peers     []*peer
+}
+
+type peer struct {
+	home string
+	port int
+	cmd  *exec.Cmd
+}
+
+// Launch launches the cluster of the scenario in the work home.
+func Launch(scenario *Scenario, binaries *Binaries, workHome string) (c *Cluster, err error) {
+	c = &Cluster{
+		WorkHome: workHome,
+		scenario: scenario,
+		binaries: binaries,
+	}
+	defer func() {
+		if err != nil {
+			c.Close()
+		}
+	}()
+
+	c.origin = NewOrigin(scenario.Files)
+	if err = c.launchSupernode(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < scenario.Peers; i++ {
+		if err = c.launchPeer(i); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// launchSupernode starts the supernode with the config generated from the scenario,
+// and a file server serving its repo at the download port.
+func (c *Cluster) launchSupernode() error {
+	home := filepath.Join(c.WorkHome, "supernode")
+	repo := filepath.Join(home, "repo")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		return err
+	}
+	c.repo = httptest.NewServer(http.FileServer(http.Dir(repo)))
+
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	base := make(map[string]interface{}, len(c.scenario.Supernode)+4)
+	for k, v := range c.scenario.Supernode {
+		base[k] = v
+	}
+	base["homeDir"] = home
+	base["listenPort"] = port
+	base["downloadPort"] = c.repo.Listener.Addr().(*net.TCPAddr).Port
+	base["advertiseIP"] = "127.0.0.1"
+	b, err := yaml.Marshal(map[string]interface{}{"base": base})
+	if err != nil {
+		return err
+	}
+	configFile := filepath.Join(c.WorkHome, "supernode.yml")
+	if err := ioutil.WriteFile(configFile, b, 0644); err != nil {
+		return err
+	}
+
+	c.node = fmt.Sprintf("127.0.0.1:%d", port)
+	if c.supernode, err = c.start("supernode", c.binaries.Supernode, "--config", configFile); err != nil {
+		return err
+	}
+	return waitFor(fmt.Sprintf("http://%s/_ping", c.node))
+}
+
+// launchPeer starts the peer server of the peer, which serves the files downloaded by it
+// until the cluster is closed. The meta and data paths are the ones used by the downloads
+// with the same home, so the downloads find the server instead of starting their own.
+func (c *Cluster) launchPeer(i int) error {
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	p := &peer{
+		home: filepath.Join(c.WorkHome, "peer"+strconv.Itoa(i)),
+		port: port,
+	}
+	p.cmd, err = c.start("peer"+strconv.Itoa(i), c.binaries.Dfget, "server",
+		"--home", p.home, "--ip", "127.0.0.1", "--port", strconv.Itoa(port),
+		"--meta", filepath.Join(p.home, "meta", "host.meta"), "--data", filepath.Join(p.home, "data"),
+		"--alivetime", "24h", "--expiretime", "24h", "--node", c.node)
+	if err != nil {
+		return err
+	}
+	c.peers = append(c.peers, p)
+	return waitFor(fmt.Sprintf("http://127.0.0.1:%d%s", port, dfgetConfig.LocalHTTPPing))
+}
+
+// start starts the binary with its output written to the log file of the name.
+func (c *Cluster) start(name, binary string, args ...string) (*exec.Cmd, error) {
+	log, err := os.Create(filepath.Join(c.WorkHome, name+".log"))
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	go func() {
+		cmd.Wait()
+		log.Close()
+	}()
+	return cmd, nil
+}
+
+// Close kills the processes and stops the servers of the cluster.
+func (c *Cluster) Close() {
+	for _, p := range c.peers {
+		p.cmd.Process.Kill()
+	}
+	if c.supernode != nil {
+		c.supernode.Process.Kill()
+	}
+	if c.repo != nil {
+		c.repo.Close()
+	}
+	if c.origin != nil {
+		c.origin.Close()
+	}
+}
+
+// Run runs the steps of the scenario in the order, and returns the report and
+// the violations of the expectations of the scenario.
+func (c *Cluster) Run() (*Report, error) {
+	report := &Report{Scenario: c.scenario.Name}
+	var violations []string
+	var all []*Summary
+	for i, step := range c.scenario.Steps {
+		sr, err := c.runStep(i, step)
+		if err != nil {
+			return report, fmt.Errorf("step %d %s: %v", i, step.Name, err)
+		}
+		report.Steps = append(report.Steps, sr)
+		all = append(all, sr.Downloads...)
+		for _, v := range step.Expect.check(sr.PeerRatio, sr.SupernodeRatio, 0, time.Duration(sr.Duration)) {
+			violations = append(violations, fmt.Sprintf("step %d %s: %s", i, step.Name, v))
+		}
+	}
+
+	report.PeerRatio, report.SupernodeRatio = summarize(all)
+	report.OriginBytes = c.origin.Served()
+	if size := c.origin.Size(); size > 0 {
+		report.SourceRatio = float64(report.OriginBytes) / float64(size)
+	}
+	violations = append(violations, c.scenario.Expect.check(report.PeerRatio, report.SupernodeRatio,
+		report.SourceRatio, 0)...)
+	if len(violations) > 0 {
+		return report, fmt.Errorf("%s", strings.Join(violations, "; "))
+	}
+	return report, nil
+}
+
+func (c *Cluster) runStep(i int, step *Step) (*StepReport, error) {
+	timeout := defaultStepTimeout
+	if step.Expect != nil && step.Expect.MaxDuration > 0 {
+		// the downloads are killed a while after the max duration, so that
+		// the report tells how slow they're.
+		timeout = 2 * time.Duration(step.Expect.MaxDuration)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sr := &StepReport{Name: step.Name, Downloads: make([]*Summary, len(step.Peers))}
+	errs := make([]error, len(step.Peers))
+	start := time.Now()
+	if step.Concurrent {
+		var wg sync.WaitGroup
+		for j := range step.Peers {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				sr.Downloads[j], errs[j] = c.download(ctx, i, step, step.Peers[j])
+			}(j)
+		}
+		wg.Wait()
+	} else {
+		for j := range step.Peers {
+			sr.Downloads[j], errs[j] = c.download(ctx, i, step, step.Peers[j])
+		}
+	}
+	sr.Duration = Duration(time.Since(start))
+
+	for _, err := range errs {
+		if err != nil {
+			return sr, err
+		}
+	}
+	sr.PeerRatio, sr.SupernodeRatio = summarize(sr.Downloads)
+	return sr, nil
+}
+
+// download downloads the file of the step by the peer, and verifies the downloaded file.
+func (c *Cluster) download(ctx context.Context, i int, step *Step, peerIndex int) (*Summary, error) {
+	p := c.peers[peerIndex]
+	name := fmt.Sprintf("step%d-peer%d", i, peerIndex)
+	output := filepath.Join(c.WorkHome, "output", name, step.File)
+	summaryFile := filepath.Join(c.WorkHome, "output", name+".json")
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return nil, err
+	}
+	md5sum := c.origin.Md5(step.File)
+
+	args := append([]string{
+		"--url", c.origin.URL(step.File),
+		"--output", output,
+		"--node", c.node,
+		"--home", p.home,
+		"--ip", "127.0.0.1",
+		"--port", strconv.Itoa(p.port),
+		"--md5", md5sum,
+		"--summary-file", summaryFile,
+	}, c.scenario.DfgetArgs...)
+	cmd := exec.CommandContext(ctx, c.binaries.Dfget, args...)
+	out, err := cmd.CombinedOutput()
+	ioutil.WriteFile(filepath.Join(c.WorkHome, "output", name+".log"), out, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("peer %d failed to download %s: %v, see %s.log", peerIndex, step.File, err, name)
+	}
+
+	summary := &Summary{}
+	b, err := ioutil.ReadFile(summaryFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, summary); err != nil {
+		return nil, err
+	}
+	summary.Peer = peerIndex
+	if !summary.Success {
+		return summary, fmt.Errorf("peer %d failed to download %s, see %s.log", peerIndex, step.File, name)
+	}
+	if actual, err := fileMd5(output); err != nil || actual != md5sum {
+		return summary, fmt.Errorf("peer %d downloaded %s with md5 %s, expected %s: %v",
+			peerIndex, step.File, actual, md5sum, err)
+	}
+	return summary, nil
+}
+
+// Origin is a mock origin serving the generated files, and counting the bytes
+// it serves. It supports the range requests.
+type Origin struct {
+	server *httptest.Server
+	files  map[string][]byte
+	served int64
+}
+
+// NewOrigin starts an origin serving the files at /{name}. The content of a file
+// is generated from its name, so it's the same across the runs.
+func NewOrigin(files []*File) *Origin {
+	o := &Origin{files: make(map[string][]byte, len(files))}
+	for _, f := range files {
+		h := fnv.New64a()
+		h.Write([]byte(f.Name))
+		data := make([]byte, f.Size)
+		rand.New(rand.NewSource(int64(h.Sum64()))).Read(data)
+		o.files[f.Name] = data
+	}
+	o.server = httptest.NewServer(http.HandlerFunc(o.serve))
+	return o
+}
+
+func (o *Origin) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	data, ok := o.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(&countingWriter{ResponseWriter: w, n: &o.served}, r, name,
+		time.Time{}, bytes.NewReader(data))
+}
+
+// URL returns the URL of the file.
+func (o *Origin) URL(name string) string {
+	return o.server.URL + "/" + name
+}
+
+// Md5 returns the md5 of the file.
+func (o *Origin) Md5(name string) string {
+	sum := md5.Sum(o.files[name])
+	return hex.EncodeToString(sum[:])
+}
+
+// Size returns the total size of the files.
+func (o *Origin) Size() (size int64) {
+	for _, data := range o.files {
+		size += int64(len(data))
+	}
+	return size
+}
+
+// Served returns the number of the bytes served.
+func (o *Origin) Served() int64 {
+	return atomic.LoadInt64(&o.served)
+}
+
+// Close stops the origin.
+func (o *Origin) Close() {
+	o.server.Close()
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+func fileMd5(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func waitFor(url string) (err error) {
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = http.Get(url); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("%s responds %d", url, resp.StatusCode)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
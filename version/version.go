@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -74,10 +75,20 @@ func init() {
 		Arch:      arch,
 		OS:        os,
 		GoVersion: goVersion,
+		Revision:  revision,
 		Version:   version,
 	}
 }
 
+// Info returns the build information of the program with the optional features enabled.
+func Info(program string, features []string) *types.DragonflyVersion {
+	info := *DFVersion
+	info.Component = program
+	info.Features = append([]string{}, features...)
+	sort.Strings(info.Features)
+	return &info
+}
+
 // versionInfoTmpl contains the template used by Info.
 var versionInfoTmpl = `
 {{.program}} version  {{.version}}
@@ -130,6 +141,21 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// NewHandler returns the handler of the build information of the program together
+// with the optional features returned by features, which could be nil.
+func NewHandler(program string, features func() []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var enabled []string
+		if features != nil {
+			enabled = features()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Info(program, enabled)); err != nil {
+			http.Error(w, fmt.Sprintf("error encoding JSON: %s", err), http.StatusInternalServerError)
+		}
+	}
+}
+
 // HandlerWithCtx returns build information.
 func HandlerWithCtx(context context.Context, w http.ResponseWriter, r *http.Request) (err error) {
 	Handler(w, r)